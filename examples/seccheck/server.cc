@@ -31,6 +31,7 @@
 #include "absl/strings/string_view.h"
 #include "pkg/sentry/seccheck/points/common.pb.h"
 #include "pkg/sentry/seccheck/points/container.pb.h"
+#include "pkg/sentry/seccheck/points/netstack.pb.h"
 #include "pkg/sentry/seccheck/points/sentry.pb.h"
 #include "pkg/sentry/seccheck/points/syscall.pb.h"
 #include "google/protobuf/text_format.h"
@@ -123,6 +124,8 @@ std::vector<Callback> dispatchers = {
     unpackSyscall<::gvisor::syscall::InotifyRmWatch>,
     unpackSyscall<::gvisor::syscall::SocketPair>,
     unpackSyscall<::gvisor::syscall::Write>,
+    unpack<::gvisor::sentry::PageFault>,
+    unpack<::gvisor::netstack::SocketClose>,
 };
 
 void unpack(absl::string_view buf) {
@@ -0,0 +1,34 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package amdgpu tracks the ABI of the AMD GPU Linux kernel drivers used by
+// ROCm: the amdkfd compute interface (/dev/kfd) and the amdgpu DRM render
+// nodes (/dev/dri/renderD#). See include/uapi/linux/kfd_ioctl.h,
+// include/uapi/drm/drm.h and include/uapi/drm/amdgpu_drm.h.
+package amdgpu
+
+// Device numbers.
+const (
+	// DRM_MAJOR is the major device number of DRM device nodes, from
+	// include/drm/drm_file.h. /dev/kfd uses a dynamically allocated major
+	// device number.
+	DRM_MAJOR = 226
+
+	// DRM_RENDER_MINOR_BASE is the first minor device number used by render
+	// nodes, from drivers/gpu/drm/drm_drv.c.
+	DRM_RENDER_MINOR_BASE = 128
+
+	// KFD_MINOR is the minor device number of /dev/kfd.
+	KFD_MINOR = 0
+)
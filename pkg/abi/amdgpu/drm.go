@@ -0,0 +1,139 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdgpu
+
+// DRM_IOCTL_BASE is the IOC_TYPE of DRM ioctls.
+const DRM_IOCTL_BASE = uint32('d')
+
+// Generic DRM ioctl numbers, from include/uapi/drm/drm.h.
+// Note that these are only the IOC_NR part of the ioctl command.
+const (
+	DRM_IOCTL_VERSION   = 0x00
+	DRM_IOCTL_GEM_CLOSE = 0x09
+	DRM_IOCTL_GET_CAP   = 0x0c
+
+	// DRM_COMMAND_BASE is the first driver-specific ioctl number.
+	DRM_COMMAND_BASE = 0x40
+)
+
+// amdgpu DRM ioctl numbers, from include/uapi/drm/amdgpu_drm.h.
+const (
+	DRM_IOCTL_AMDGPU_GEM_CREATE = DRM_COMMAND_BASE + 0x00
+	DRM_IOCTL_AMDGPU_GEM_MMAP   = DRM_COMMAND_BASE + 0x01
+	DRM_IOCTL_AMDGPU_CTX        = DRM_COMMAND_BASE + 0x02
+	DRM_IOCTL_AMDGPU_INFO       = DRM_COMMAND_BASE + 0x05
+)
+
+// DRMVersion is struct drm_version, the parameter type for
+// DRM_IOCTL_VERSION.
+//
+// +marshal
+type DRMVersion struct {
+	VersionMajor      int32
+	VersionMinor      int32
+	VersionPatchlevel int32
+	Pad               uint32
+	NameLen           uint64
+	Name              uint64
+	DateLen           uint64
+	Date              uint64
+	DescLen           uint64
+	Desc              uint64
+}
+
+// DRMGEMClose is struct drm_gem_close, the parameter type for
+// DRM_IOCTL_GEM_CLOSE.
+//
+// +marshal
+type DRMGEMClose struct {
+	Handle uint32
+	Pad    uint32
+}
+
+// DRMAMDGPUGEMCreate is union drm_amdgpu_gem_create, the parameter type for
+// DRM_IOCTL_AMDGPU_GEM_CREATE. The fields are those of struct
+// drm_amdgpu_gem_create_in; on success, the driver overwrites them with
+// struct drm_amdgpu_gem_create_out, see Handle.
+//
+// +marshal
+type DRMAMDGPUGEMCreate struct {
+	BOSize      uint64
+	Alignment   uint64
+	Domains     uint64
+	DomainFlags uint64
+}
+
+// Handle returns the handle of the buffer object created by a successful
+// DRM_IOCTL_AMDGPU_GEM_CREATE, which is the first field of struct
+// drm_amdgpu_gem_create_out.
+func (p *DRMAMDGPUGEMCreate) Handle() uint32 {
+	return uint32(p.BOSize)
+}
+
+// DRM_IOCTL_AMDGPU_CTX operations, from include/uapi/drm/amdgpu_drm.h.
+const (
+	AMDGPU_CTX_OP_ALLOC_CTX = 1
+	AMDGPU_CTX_OP_FREE_CTX  = 2
+)
+
+// DRMAMDGPUCtx is union drm_amdgpu_ctx, the parameter type for
+// DRM_IOCTL_AMDGPU_CTX. The fields are those of struct drm_amdgpu_ctx_in; on
+// success, the driver overwrites them with union drm_amdgpu_ctx_out, see
+// AllocatedCtxID.
+//
+// +marshal
+type DRMAMDGPUCtx struct {
+	Op       uint32
+	Flags    uint32
+	CtxID    uint32
+	Priority int32
+}
+
+// AllocatedCtxID returns the ID of the context allocated by a successful
+// AMDGPU_CTX_OP_ALLOC_CTX, which is the first field of union
+// drm_amdgpu_ctx_out.
+func (p *DRMAMDGPUCtx) AllocatedCtxID() uint32 {
+	return p.Op
+}
+
+// DRMAMDGPUInfo is struct drm_amdgpu_info, the parameter type for
+// DRM_IOCTL_AMDGPU_INFO. Query is the union of per-query inputs, none of
+// which contain pointers.
+//
+// +marshal
+type DRMAMDGPUInfo struct {
+	// ReturnPointer points to a buffer of ReturnSize bytes that receives the
+	// query result.
+	ReturnPointer uint64
+	ReturnSize    uint32
+	QueryID       uint32
+	Query         [16]byte
+}
+
+// Sizes of DRM ioctl parameter structs whose layout is not tracked by this
+// package, which are all free of pointers.
+const (
+	SizeofDRMGetCap        = 16 // struct drm_get_cap
+	SizeofDRMAMDGPUGEMMMap = 8  // union drm_amdgpu_gem_mmap
+)
+
+// Sizes of DRM ioctl parameter structs tracked by this package.
+var (
+	SizeofDRMVersion         = uint32((*DRMVersion)(nil).SizeBytes())
+	SizeofDRMGEMClose        = uint32((*DRMGEMClose)(nil).SizeBytes())
+	SizeofDRMAMDGPUGEMCreate = uint32((*DRMAMDGPUGEMCreate)(nil).SizeBytes())
+	SizeofDRMAMDGPUCtx       = uint32((*DRMAMDGPUCtx)(nil).SizeBytes())
+	SizeofDRMAMDGPUInfo      = uint32((*DRMAMDGPUInfo)(nil).SizeBytes())
+)
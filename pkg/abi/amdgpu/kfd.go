@@ -0,0 +1,323 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdgpu
+
+// AMDKFD_IOCTL_BASE is the IOC_TYPE of /dev/kfd ioctls.
+const AMDKFD_IOCTL_BASE = uint32('K')
+
+// KFD ioctl interface version, from include/uapi/linux/kfd_ioctl.h. The
+// driver only adds ioctls and flags within a major version.
+const (
+	KFD_IOCTL_MAJOR_VERSION = 1
+)
+
+// KFD ioctl numbers, from include/uapi/linux/kfd_ioctl.h.
+// Note that these are only the IOC_NR part of the ioctl command.
+const (
+	AMDKFD_IOC_GET_VERSION               = 0x01
+	AMDKFD_IOC_CREATE_QUEUE              = 0x02
+	AMDKFD_IOC_DESTROY_QUEUE             = 0x03
+	AMDKFD_IOC_SET_MEMORY_POLICY         = 0x04
+	AMDKFD_IOC_GET_CLOCK_COUNTERS        = 0x05
+	AMDKFD_IOC_GET_PROCESS_APERTURES     = 0x06
+	AMDKFD_IOC_UPDATE_QUEUE              = 0x07
+	AMDKFD_IOC_CREATE_EVENT              = 0x08
+	AMDKFD_IOC_DESTROY_EVENT             = 0x09
+	AMDKFD_IOC_SET_EVENT                 = 0x0a
+	AMDKFD_IOC_RESET_EVENT               = 0x0b
+	AMDKFD_IOC_WAIT_EVENTS               = 0x0c
+	AMDKFD_IOC_SET_SCRATCH_BACKING_VA    = 0x11
+	AMDKFD_IOC_GET_TILE_CONFIG           = 0x12
+	AMDKFD_IOC_SET_TRAP_HANDLER          = 0x13
+	AMDKFD_IOC_GET_PROCESS_APERTURES_NEW = 0x14
+	AMDKFD_IOC_ACQUIRE_VM                = 0x15
+	AMDKFD_IOC_ALLOC_MEMORY_OF_GPU       = 0x16
+	AMDKFD_IOC_FREE_MEMORY_OF_GPU        = 0x17
+	AMDKFD_IOC_MAP_MEMORY_TO_GPU         = 0x18
+	AMDKFD_IOC_UNMAP_MEMORY_FROM_GPU     = 0x19
+	AMDKFD_IOC_SET_CU_MASK               = 0x1a
+	AMDKFD_IOC_GET_QUEUE_WAVE_STATE      = 0x1b
+	AMDKFD_IOC_GET_DMABUF_INFO           = 0x1c
+	AMDKFD_IOC_IMPORT_DMABUF             = 0x1d
+	AMDKFD_IOC_ALLOC_QUEUE_GWS           = 0x1e
+	AMDKFD_IOC_SMI_EVENTS                = 0x1f
+	AMDKFD_IOC_SVM                       = 0x20
+	AMDKFD_IOC_SET_XNACK_MODE            = 0x21
+	AMDKFD_IOC_CRIU_OP                   = 0x22
+	AMDKFD_IOC_AVAILABLE_MEMORY          = 0x23
+	AMDKFD_IOC_EXPORT_DMABUF             = 0x24
+	AMDKFD_IOC_RUNTIME_ENABLE            = 0x25
+	AMDKFD_IOC_DBG_TRAP                  = 0x26
+)
+
+// NUM_OF_SUPPORTED_GPUS is the number of apertures returned by
+// AMDKFD_IOC_GET_PROCESS_APERTURES.
+const NUM_OF_SUPPORTED_GPUS = 7
+
+// Flags for KFDIoctlAllocMemoryOfGPUArgs.Flags.
+const (
+	KFD_IOC_ALLOC_MEM_FLAGS_VRAM          = 1 << 0
+	KFD_IOC_ALLOC_MEM_FLAGS_GTT           = 1 << 1
+	KFD_IOC_ALLOC_MEM_FLAGS_USERPTR       = 1 << 2
+	KFD_IOC_ALLOC_MEM_FLAGS_DOORBELL      = 1 << 3
+	KFD_IOC_ALLOC_MEM_FLAGS_MMIO_REMAP    = 1 << 4
+	KFD_IOC_ALLOC_MEM_FLAGS_WRITABLE      = 1 << 31
+	KFD_IOC_ALLOC_MEM_FLAGS_EXECUTABLE    = 1 << 30
+	KFD_IOC_ALLOC_MEM_FLAGS_PUBLIC        = 1 << 29
+	KFD_IOC_ALLOC_MEM_FLAGS_NO_SUBSTITUTE = 1 << 28
+	KFD_IOC_ALLOC_MEM_FLAGS_AQL_QUEUE_MEM = 1 << 27
+	KFD_IOC_ALLOC_MEM_FLAGS_COHERENT      = 1 << 26
+	KFD_IOC_ALLOC_MEM_FLAGS_UNCACHED      = 1 << 25
+	KFD_IOC_ALLOC_MEM_FLAGS_EXT_COHERENT  = 1 << 24
+)
+
+// Values for KFDIoctlWaitEventsArgs.
+const (
+	KFD_EVENT_TIMEOUT_IMMEDIATE = 0
+	KFD_EVENT_TIMEOUT_INFINITE  = 0xffffffff
+
+	KFD_IOC_WAIT_RESULT_COMPLETE = 0
+	KFD_IOC_WAIT_RESULT_TIMEOUT  = 1
+	KFD_IOC_WAIT_RESULT_FAIL     = 2
+
+	// KFD_SIGNAL_EVENT_LIMIT is the maximum number of signal events per
+	// process, from drivers/gpu/drm/amd/amdkfd/kfd_priv.h.
+	KFD_SIGNAL_EVENT_LIMIT = 4096
+)
+
+// KFDIoctlGetVersionArgs is struct kfd_ioctl_get_version_args, the parameter
+// type for AMDKFD_IOC_GET_VERSION.
+//
+// +marshal
+type KFDIoctlGetVersionArgs struct {
+	MajorVersion uint32
+	MinorVersion uint32
+}
+
+// KFDProcessDeviceApertures is struct kfd_process_device_apertures.
+//
+// +marshal
+type KFDProcessDeviceApertures struct {
+	LDSBase      uint64
+	LDSLimit     uint64
+	ScratchBase  uint64
+	ScratchLimit uint64
+	GPUVMBase    uint64
+	GPUVMLimit   uint64
+	GPUID        uint32
+	Pad          uint32
+}
+
+// KFDIoctlGetProcessAperturesNewArgs is struct
+// kfd_ioctl_get_process_apertures_new_args, the parameter type for
+// AMDKFD_IOC_GET_PROCESS_APERTURES_NEW.
+//
+// +marshal
+type KFDIoctlGetProcessAperturesNewArgs struct {
+	// KFDProcessDeviceAperturesPtr points to an array of NumOfNodes
+	// KFDProcessDeviceApertures.
+	KFDProcessDeviceAperturesPtr uint64
+	NumOfNodes                   uint32
+	Pad                          uint32
+}
+
+// KFDIoctlWaitEventsArgs is struct kfd_ioctl_wait_events_args, the parameter
+// type for AMDKFD_IOC_WAIT_EVENTS.
+//
+// +marshal
+type KFDIoctlWaitEventsArgs struct {
+	// EventsPtr points to an array of NumEvents KFDEventData.
+	EventsPtr  uint64
+	NumEvents  uint32
+	WaitForAll uint32
+	Timeout    uint32
+	WaitResult uint32
+}
+
+// KFDEventData is struct kfd_event_data. Data is the union of struct
+// kfd_hsa_memory_exception_data, struct kfd_hsa_hw_exception_data and struct
+// kfd_hsa_signal_event_data, none of which contain pointers.
+//
+// +marshal
+type KFDEventData struct {
+	Data            [32]byte
+	KFDEventDataExt uint64
+	EventID         uint32
+	Pad             uint32
+}
+
+// KFDIoctlGetTileConfigArgs is struct kfd_ioctl_get_tile_config_args, the
+// parameter type for AMDKFD_IOC_GET_TILE_CONFIG.
+//
+// +marshal
+type KFDIoctlGetTileConfigArgs struct {
+	// TileConfigPtr points to an array of NumTileConfigs uint32s.
+	TileConfigPtr uint64
+	// MacroTileConfigPtr points to an array of NumMacroTileConfigs uint32s.
+	MacroTileConfigPtr  uint64
+	NumTileConfigs      uint32
+	NumMacroTileConfigs uint32
+	GPUID               uint32
+	GBAddrConfig        uint32
+	NumBanks            uint32
+	NumRanks            uint32
+}
+
+// KFDIoctlCreateQueueArgs is struct kfd_ioctl_create_queue_args, the
+// parameter type for AMDKFD_IOC_CREATE_QUEUE.
+//
+// +marshal
+type KFDIoctlCreateQueueArgs struct {
+	RingBaseAddress       uint64
+	WritePointerAddress   uint64
+	ReadPointerAddress    uint64
+	DoorbellOffset        uint64
+	RingSize              uint32
+	GPUID                 uint32
+	QueueType             uint32
+	QueuePercentage       uint32
+	QueuePriority         uint32
+	QueueID               uint32
+	EOPBufferAddress      uint64
+	EOPBufferSize         uint64
+	CtxSaveRestoreAddress uint64
+	CtxSaveRestoreSize    uint32
+	CtlStackSize          uint32
+}
+
+// KFDIoctlDestroyQueueArgs is struct kfd_ioctl_destroy_queue_args, the
+// parameter type for AMDKFD_IOC_DESTROY_QUEUE.
+//
+// +marshal
+type KFDIoctlDestroyQueueArgs struct {
+	QueueID uint32
+	Pad     uint32
+}
+
+// KFDIoctlCreateEventArgs is struct kfd_ioctl_create_event_args, the
+// parameter type for AMDKFD_IOC_CREATE_EVENT.
+//
+// +marshal
+type KFDIoctlCreateEventArgs struct {
+	EventPageOffset  uint64
+	EventTriggerData uint32
+	EventType        uint32
+	AutoReset        uint32
+	NodeID           uint32
+	EventID          uint32
+	EventSlotIndex   uint32
+}
+
+// KFDIoctlEventArgs is struct kfd_ioctl_destroy_event_args, the parameter
+// type for AMDKFD_IOC_DESTROY_EVENT. struct kfd_ioctl_set_event_args and
+// struct kfd_ioctl_reset_event_args, the parameter types for
+// AMDKFD_IOC_SET_EVENT and AMDKFD_IOC_RESET_EVENT, have the same layout.
+//
+// +marshal
+type KFDIoctlEventArgs struct {
+	EventID uint32
+	Pad     uint32
+}
+
+// KFDIoctlAcquireVMArgs is struct kfd_ioctl_acquire_vm_args, the parameter
+// type for AMDKFD_IOC_ACQUIRE_VM.
+//
+// +marshal
+type KFDIoctlAcquireVMArgs struct {
+	DRMFD int32
+	GPUID uint32
+}
+
+// KFDIoctlAllocMemoryOfGPUArgs is struct kfd_ioctl_alloc_memory_of_gpu_args,
+// the parameter type for AMDKFD_IOC_ALLOC_MEMORY_OF_GPU.
+//
+// +marshal
+type KFDIoctlAllocMemoryOfGPUArgs struct {
+	VAAddr uint64
+	Size   uint64
+	Handle uint64
+	// MMapOffset is the CPU address of the memory to register for
+	// KFD_IOC_ALLOC_MEM_FLAGS_USERPTR allocations, and an output otherwise.
+	MMapOffset uint64
+	GPUID      uint32
+	Flags      uint32
+}
+
+// KFDIoctlFreeMemoryOfGPUArgs is struct kfd_ioctl_free_memory_of_gpu_args,
+// the parameter type for AMDKFD_IOC_FREE_MEMORY_OF_GPU.
+//
+// +marshal
+type KFDIoctlFreeMemoryOfGPUArgs struct {
+	Handle uint64
+}
+
+// KFDIoctlMapMemoryToGPUArgs is struct kfd_ioctl_map_memory_to_gpu_args, the
+// parameter type for AMDKFD_IOC_MAP_MEMORY_TO_GPU. struct
+// kfd_ioctl_unmap_memory_from_gpu_args, the parameter type for
+// AMDKFD_IOC_UNMAP_MEMORY_FROM_GPU, has the same layout.
+//
+// +marshal
+type KFDIoctlMapMemoryToGPUArgs struct {
+	Handle uint64
+	// DeviceIDsArrayPtr points to an array of NDevices GPU IDs.
+	DeviceIDsArrayPtr uint64
+	NDevices          uint32
+	NSuccess          uint32
+}
+
+// KFDIoctlSetCUMaskArgs is struct kfd_ioctl_set_cu_mask_args, the parameter
+// type for AMDKFD_IOC_SET_CU_MASK.
+//
+// +marshal
+type KFDIoctlSetCUMaskArgs struct {
+	QueueID uint32
+	// NumCUMask is the number of bits in the mask pointed to by CUMaskPtr.
+	NumCUMask uint32
+	CUMaskPtr uint64
+}
+
+// Sizes of KFD ioctl parameter structs whose layout is not tracked by this
+// package, which are all free of pointers.
+const (
+	SizeofKFDIoctlSetMemoryPolicyArgs     = 32  // struct kfd_ioctl_set_memory_policy_args
+	SizeofKFDIoctlGetClockCountersArgs    = 40  // struct kfd_ioctl_get_clock_counters_args
+	SizeofKFDIoctlGetProcessAperturesArgs = 400 // struct kfd_ioctl_get_process_apertures_args
+	SizeofKFDIoctlUpdateQueueArgs         = 24  // struct kfd_ioctl_update_queue_args
+	SizeofKFDIoctlSetScratchBackingVAArgs = 16  // struct kfd_ioctl_set_scratch_backing_va_args
+	SizeofKFDIoctlSetTrapHandlerArgs      = 24  // struct kfd_ioctl_set_trap_handler_args
+	SizeofKFDIoctlAllocQueueGWSArgs       = 16  // struct kfd_ioctl_alloc_queue_gws_args
+	SizeofKFDIoctlSetXNACKModeArgs        = 4   // struct kfd_ioctl_set_xnack_mode_args
+	SizeofKFDIoctlGetAvailableMemoryArgs  = 16  // struct kfd_ioctl_get_available_memory_args
+	SizeofKFDIoctlRuntimeEnableArgs       = 16  // struct kfd_ioctl_runtime_enable_args
+)
+
+// Sizes of KFD ioctl parameter structs tracked by this package.
+var (
+	SizeofKFDIoctlGetVersionArgs             = uint32((*KFDIoctlGetVersionArgs)(nil).SizeBytes())
+	SizeofKFDIoctlCreateQueueArgs            = uint32((*KFDIoctlCreateQueueArgs)(nil).SizeBytes())
+	SizeofKFDIoctlDestroyQueueArgs           = uint32((*KFDIoctlDestroyQueueArgs)(nil).SizeBytes())
+	SizeofKFDIoctlCreateEventArgs            = uint32((*KFDIoctlCreateEventArgs)(nil).SizeBytes())
+	SizeofKFDIoctlEventArgs                  = uint32((*KFDIoctlEventArgs)(nil).SizeBytes())
+	SizeofKFDIoctlGetProcessAperturesNewArgs = uint32((*KFDIoctlGetProcessAperturesNewArgs)(nil).SizeBytes())
+	SizeofKFDIoctlWaitEventsArgs             = uint32((*KFDIoctlWaitEventsArgs)(nil).SizeBytes())
+	SizeofKFDIoctlGetTileConfigArgs          = uint32((*KFDIoctlGetTileConfigArgs)(nil).SizeBytes())
+	SizeofKFDIoctlAcquireVMArgs              = uint32((*KFDIoctlAcquireVMArgs)(nil).SizeBytes())
+	SizeofKFDIoctlAllocMemoryOfGPUArgs       = uint32((*KFDIoctlAllocMemoryOfGPUArgs)(nil).SizeBytes())
+	SizeofKFDIoctlFreeMemoryOfGPUArgs        = uint32((*KFDIoctlFreeMemoryOfGPUArgs)(nil).SizeBytes())
+	SizeofKFDIoctlMapMemoryToGPUArgs         = uint32((*KFDIoctlMapMemoryToGPUArgs)(nil).SizeBytes())
+	SizeofKFDIoctlSetCUMaskArgs              = uint32((*KFDIoctlSetCUMaskArgs)(nil).SizeBytes())
+	SizeofKFDProcessDeviceApertures          = uint32((*KFDProcessDeviceApertures)(nil).SizeBytes())
+	SizeofKFDEventData                       = uint32((*KFDEventData)(nil).SizeBytes())
+)
@@ -0,0 +1,42 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// ASHMEM_NAME_LEN is the maximum length of an ashmem region name, including
+// the terminating NUL, from include/uapi/linux/android/ashmem.h.
+const ASHMEM_NAME_LEN = 256
+
+// Return values of ASHMEM_PIN, ASHMEM_UNPIN and ASHMEM_GET_PIN_STATUS, from
+// include/uapi/linux/android/ashmem.h.
+const (
+	ASHMEM_NOT_PURGED  = 0
+	ASHMEM_WAS_PURGED  = 1
+	ASHMEM_IS_UNPINNED = 0
+	ASHMEM_IS_PINNED   = 1
+)
+
+// ioctl(2) request numbers from include/uapi/linux/android/ashmem.h.
+var (
+	ASHMEM_SET_NAME         = IOW(0x77, 1, ASHMEM_NAME_LEN)
+	ASHMEM_GET_NAME         = IOR(0x77, 2, ASHMEM_NAME_LEN)
+	ASHMEM_SET_SIZE         = IOW(0x77, 3, 8)
+	ASHMEM_GET_SIZE         = IO(0x77, 4)
+	ASHMEM_SET_PROT_MASK    = IOW(0x77, 5, 8)
+	ASHMEM_GET_PROT_MASK    = IO(0x77, 6)
+	ASHMEM_PIN              = IOW(0x77, 7, 8)
+	ASHMEM_UNPIN            = IOW(0x77, 8, 8)
+	ASHMEM_GET_PIN_STATUS   = IO(0x77, 9)
+	ASHMEM_PURGE_ALL_CACHES = IO(0x77, 10)
+)
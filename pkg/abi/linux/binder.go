@@ -0,0 +1,142 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// BINDER_CURRENT_PROTOCOL_VERSION is the binder protocol version for 64-bit
+// binder, from include/uapi/linux/android/binder.h.
+const BINDER_CURRENT_PROTOCOL_VERSION = 8
+
+// SizeOfBinderTransactionData is the size of struct binder_transaction_data.
+const SizeOfBinderTransactionData = 64
+
+// ioctl(2) request numbers from include/uapi/linux/android/binder.h.
+var (
+	BINDER_WRITE_READ                   = IOWR('b', 1, 48)
+	BINDER_SET_MAX_THREADS              = IOW('b', 5, 4)
+	BINDER_SET_CONTEXT_MGR              = IOW('b', 7, 4)
+	BINDER_THREAD_EXIT                  = IOW('b', 8, 4)
+	BINDER_VERSION                      = IOWR('b', 9, 4)
+	BINDER_SET_CONTEXT_MGR_EXT          = IOW('b', 13, 24)
+	BINDER_ENABLE_ONEWAY_SPAM_DETECTION = IOW('b', 16, 4)
+)
+
+// Commands written to the binder driver, from
+// include/uapi/linux/android/binder.h.
+var (
+	BC_TRANSACTION                = IOW('c', 0, SizeOfBinderTransactionData)
+	BC_REPLY                      = IOW('c', 1, SizeOfBinderTransactionData)
+	BC_FREE_BUFFER                = IOW('c', 3, 8)
+	BC_INCREFS                    = IOW('c', 4, 4)
+	BC_ACQUIRE                    = IOW('c', 5, 4)
+	BC_RELEASE                    = IOW('c', 6, 4)
+	BC_DECREFS                    = IOW('c', 7, 4)
+	BC_INCREFS_DONE               = IOW('c', 8, 16)
+	BC_ACQUIRE_DONE               = IOW('c', 9, 16)
+	BC_REGISTER_LOOPER            = IO('c', 11)
+	BC_ENTER_LOOPER               = IO('c', 12)
+	BC_EXIT_LOOPER                = IO('c', 13)
+	BC_REQUEST_DEATH_NOTIFICATION = IOW('c', 14, 12)
+	BC_CLEAR_DEATH_NOTIFICATION   = IOW('c', 15, 12)
+	BC_DEAD_BINDER_DONE           = IOW('c', 16, 8)
+)
+
+// Replies read from the binder driver, from
+// include/uapi/linux/android/binder.h.
+var (
+	BR_ERROR                         = IOR('r', 0, 4)
+	BR_OK                            = IO('r', 1)
+	BR_TRANSACTION                   = IOR('r', 2, SizeOfBinderTransactionData)
+	BR_REPLY                         = IOR('r', 3, SizeOfBinderTransactionData)
+	BR_DEAD_REPLY                    = IO('r', 5)
+	BR_TRANSACTION_COMPLETE          = IO('r', 6)
+	BR_NOOP                          = IO('r', 12)
+	BR_SPAWN_LOOPER                  = IO('r', 13)
+	BR_DEAD_BINDER                   = IOR('r', 15, 8)
+	BR_CLEAR_DEATH_NOTIFICATION_DONE = IOR('r', 16, 8)
+	BR_FAILED_REPLY                  = IO('r', 17)
+)
+
+// binderPackChars is the B_PACK_CHARS macro from
+// include/uapi/linux/android/binder.h.
+func binderPackChars(c1, c2, c3, c4 byte) uint32 {
+	return uint32(c1)<<24 | uint32(c2)<<16 | uint32(c3)<<8 | uint32(c4)
+}
+
+// Types of objects passed in transactions, from
+// include/uapi/linux/android/binder.h.
+var (
+	BINDER_TYPE_BINDER      = binderPackChars('s', 'b', '*', 0x85)
+	BINDER_TYPE_WEAK_BINDER = binderPackChars('w', 'b', '*', 0x85)
+	BINDER_TYPE_HANDLE      = binderPackChars('s', 'h', '*', 0x85)
+	BINDER_TYPE_WEAK_HANDLE = binderPackChars('w', 'h', '*', 0x85)
+	BINDER_TYPE_FD          = binderPackChars('f', 'd', '*', 0x85)
+)
+
+// Transaction flags, from include/uapi/linux/android/binder.h.
+const (
+	TF_ONE_WAY     = 0x01
+	TF_ROOT_OBJECT = 0x04
+	TF_STATUS_CODE = 0x08
+	TF_ACCEPT_FDS  = 0x10
+)
+
+// BinderWriteRead is struct binder_write_read, from
+// include/uapi/linux/android/binder.h.
+//
+// +marshal
+type BinderWriteRead struct {
+	WriteSize     uint64
+	WriteConsumed uint64
+	WriteBuffer   uint64
+	ReadSize      uint64
+	ReadConsumed  uint64
+	ReadBuffer    uint64
+}
+
+// BinderTransactionData is struct binder_transaction_data, from
+// include/uapi/linux/android/binder.h.
+//
+// +marshal
+type BinderTransactionData struct {
+	// Target is the union of the target handle, for commands, and of the
+	// target pointer, for replies.
+	Target      uint64
+	Cookie      uint64
+	Code        uint32
+	Flags       uint32
+	SenderPID   int32
+	SenderEUID  uint32
+	DataSize    uint64
+	OffsetsSize uint64
+	// Buffer and Offsets are the addresses of the transaction data and of the
+	// offsets of the objects it contains.
+	Buffer  uint64
+	Offsets uint64
+}
+
+// FlatBinderObject is struct flat_binder_object, from
+// include/uapi/linux/android/binder.h. BINDER_TYPE_FD objects use the same
+// layout, with the file descriptor in the low 32 bits of Binder.
+//
+// +marshal
+type FlatBinderObject struct {
+	Type  uint32
+	Flags uint32
+	// Binder is the union of the binder pointer, for BINDER_TYPE_BINDER and
+	// BINDER_TYPE_WEAK_BINDER objects, and of the handle, for
+	// BINDER_TYPE_HANDLE and BINDER_TYPE_WEAK_HANDLE objects.
+	Binder uint64
+	Cookie uint64
+}
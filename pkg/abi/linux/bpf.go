@@ -33,3 +33,211 @@ type BPFInstruction struct {
 	// K is a constant parameter. The meaning depends on the value of OpCode.
 	K uint32
 }
+
+// EBPFInstruction is a raw eBPF virtual machine instruction, struct bpf_insn
+// from include/uapi/linux/bpf.h.
+//
+// +marshal slice:EBPFInstructionSlice
+// +stateify savable
+type EBPFInstruction struct {
+	// OpCode is the operation to execute.
+	OpCode uint8
+
+	// Regs holds the destination register in the low 4 bits and the source
+	// register in the high 4 bits.
+	Regs uint8
+
+	// Offset is a signed offset, whose meaning depends on OpCode.
+	Offset int16
+
+	// Imm is a signed immediate constant, whose meaning depends on OpCode.
+	Imm int32
+}
+
+// DstReg returns the instruction's destination register.
+func (i EBPFInstruction) DstReg() uint8 {
+	return i.Regs & 0xf
+}
+
+// SrcReg returns the instruction's source register.
+func (i EBPFInstruction) SrcReg() uint8 {
+	return i.Regs >> 4
+}
+
+// Commands for bpf(2), from include/uapi/linux/bpf.h.
+const (
+	BPF_MAP_CREATE         = 0
+	BPF_MAP_LOOKUP_ELEM    = 1
+	BPF_MAP_UPDATE_ELEM    = 2
+	BPF_MAP_DELETE_ELEM    = 3
+	BPF_MAP_GET_NEXT_KEY   = 4
+	BPF_PROG_LOAD          = 5
+	BPF_OBJ_PIN            = 6
+	BPF_OBJ_GET            = 7
+	BPF_PROG_ATTACH        = 8
+	BPF_PROG_DETACH        = 9
+	BPF_PROG_TEST_RUN      = 10
+	BPF_PROG_GET_NEXT_ID   = 11
+	BPF_MAP_GET_NEXT_ID    = 12
+	BPF_PROG_GET_FD_BY_ID  = 13
+	BPF_MAP_GET_FD_BY_ID   = 14
+	BPF_OBJ_GET_INFO_BY_FD = 15
+	BPF_PROG_QUERY         = 16
+)
+
+// Map types, from include/uapi/linux/bpf.h.
+const (
+	BPF_MAP_TYPE_UNSPEC           = 0
+	BPF_MAP_TYPE_HASH             = 1
+	BPF_MAP_TYPE_ARRAY            = 2
+	BPF_MAP_TYPE_PROG_ARRAY       = 3
+	BPF_MAP_TYPE_PERF_EVENT_ARRAY = 4
+	BPF_MAP_TYPE_PERCPU_HASH      = 5
+	BPF_MAP_TYPE_PERCPU_ARRAY     = 6
+)
+
+// Program types, from include/uapi/linux/bpf.h.
+const (
+	BPF_PROG_TYPE_UNSPEC        = 0
+	BPF_PROG_TYPE_SOCKET_FILTER = 1
+	BPF_PROG_TYPE_KPROBE        = 2
+	BPF_PROG_TYPE_SCHED_CLS     = 3
+	BPF_PROG_TYPE_SCHED_ACT     = 4
+	BPF_PROG_TYPE_TRACEPOINT    = 5
+	BPF_PROG_TYPE_XDP           = 6
+	BPF_PROG_TYPE_PERF_EVENT    = 7
+	BPF_PROG_TYPE_CGROUP_SKB    = 8
+	BPF_PROG_TYPE_CGROUP_SOCK   = 9
+)
+
+// Attach types, from include/uapi/linux/bpf.h.
+const (
+	BPF_CGROUP_INET_INGRESS     = 0
+	BPF_CGROUP_INET_EGRESS      = 1
+	BPF_CGROUP_INET_SOCK_CREATE = 2
+)
+
+// Flags for BPF_PROG_ATTACH.
+const (
+	BPF_F_ALLOW_OVERRIDE = 1 << 0
+	BPF_F_ALLOW_MULTI    = 1 << 1
+	BPF_F_REPLACE        = 1 << 2
+)
+
+// Flags for BPF_PROG_QUERY.
+const (
+	BPF_F_QUERY_EFFECTIVE = 1 << 0
+)
+
+// Flags for BPF_MAP_UPDATE_ELEM.
+const (
+	BPF_ANY     = 0
+	BPF_NOEXIST = 1
+	BPF_EXIST   = 2
+)
+
+// Flags for BPF_MAP_CREATE.
+const (
+	BPF_F_NO_PREALLOC = 1 << 0
+	BPF_F_RDONLY      = 1 << 3
+	BPF_F_WRONLY      = 1 << 4
+)
+
+// BPF_PSEUDO_MAP_FD is the value of the source register of a 64-bit immediate
+// load whose immediate is a map file descriptor.
+const BPF_PSEUDO_MAP_FD = 1
+
+// BPF_OBJ_NAME_LEN is the size of map and program names.
+const BPF_OBJ_NAME_LEN = 16
+
+// BPFMapCreateAttr is the BPF_MAP_CREATE variant of union bpf_attr.
+//
+// +marshal
+type BPFMapCreateAttr struct {
+	MapType        uint32
+	KeySize        uint32
+	ValueSize      uint32
+	MaxEntries     uint32
+	MapFlags       uint32
+	InnerMapFD     uint32
+	NumaNode       uint32
+	MapName        [BPF_OBJ_NAME_LEN]byte
+	MapIfindex     uint32
+	BTFFD          uint32
+	BTFKeyTypeID   uint32
+	BTFValueTypeID uint32
+}
+
+// BPFMapElemAttr is the BPF_MAP_*_ELEM and BPF_MAP_GET_NEXT_KEY variant of
+// union bpf_attr. For BPF_MAP_GET_NEXT_KEY, Value is the address of the next
+// key.
+//
+// +marshal
+type BPFMapElemAttr struct {
+	MapFD uint32
+	_     uint32
+	Key   uint64
+	Value uint64
+	Flags uint64
+}
+
+// BPFProgLoadAttr is the BPF_PROG_LOAD variant of union bpf_attr.
+//
+// +marshal
+type BPFProgLoadAttr struct {
+	ProgType           uint32
+	InsnCnt            uint32
+	Insns              uint64
+	License            uint64
+	LogLevel           uint32
+	LogSize            uint32
+	LogBuf             uint64
+	KernVersion        uint32
+	ProgFlags          uint32
+	ProgName           [BPF_OBJ_NAME_LEN]byte
+	ProgIfindex        uint32
+	ExpectedAttachType uint32
+}
+
+// BPFProgAttachAttr is the BPF_PROG_ATTACH and BPF_PROG_DETACH variant of
+// union bpf_attr.
+//
+// +marshal
+type BPFProgAttachAttr struct {
+	TargetFD     uint32
+	AttachBPFFD  uint32
+	AttachType   uint32
+	AttachFlags  uint32
+	ReplaceBPFFD uint32
+}
+
+// BPFProgTestRunAttr is the BPF_PROG_TEST_RUN variant of union bpf_attr.
+//
+// +marshal
+type BPFProgTestRunAttr struct {
+	ProgFD      uint32
+	Retval      uint32
+	DataSizeIn  uint32
+	DataSizeOut uint32
+	DataIn      uint64
+	DataOut     uint64
+	Repeat      uint32
+	Duration    uint32
+	CtxSizeIn   uint32
+	CtxSizeOut  uint32
+	CtxIn       uint64
+	CtxOut      uint64
+}
+
+// BPFProgQueryAttr is the BPF_PROG_QUERY variant of union bpf_attr.
+//
+// +marshal
+type BPFProgQueryAttr struct {
+	TargetFD    uint32
+	AttachType  uint32
+	QueryFlags  uint32
+	AttachFlags uint32
+	ProgIDs     uint64
+	ProgCnt     uint32
+	_           uint32
+}
@@ -18,6 +18,7 @@ package linux
 const (
 	CSIGNAL = 0xff
 
+	CLONE_NEWTIME        = 0x80
 	CLONE_VM             = 0x100
 	CLONE_FS             = 0x200
 	CLONE_FILES          = 0x400
@@ -90,6 +90,24 @@ const (
 	AT_SYSINFO_EHDR = 33
 )
 
+// AT_FLAGS_PRESERVE_ARGV0 is set in AT_FLAGS if the program was executed by a
+// binfmt_misc interpreter registered with the 'P' flag, in which case the
+// original argv[0] follows the path to the program in argv.
+//
+// See include/uapi/linux/binfmts.h.
+const AT_FLAGS_PRESERVE_ARGV0 = 1 << 0
+
+// AT_HWCAP and AT_HWCAP2 bits on arm64.
+//
+// See arch/arm64/include/uapi/asm/hwcap.h.
+const (
+	// HWCAP_PACA indicates support for address authentication.
+	HWCAP_PACA = 1 << 30
+
+	// HWCAP_PACG indicates support for generic authentication.
+	HWCAP_PACG = 1 << 31
+)
+
 // ELF ET_CORE and ptrace GETREGSET/SETREGSET register set types.
 //
 // See include/uapi/linux/elf.h.
@@ -85,6 +85,59 @@ const (
 	UMOUNT_NOFOLLOW = 0x8
 )
 
+// Constants for fsopen(2).
+const (
+	FSOPEN_CLOEXEC = 0x1
+)
+
+// Commands for fsconfig(2).
+const (
+	FSCONFIG_SET_FLAG        = 0
+	FSCONFIG_SET_STRING      = 1
+	FSCONFIG_SET_BINARY      = 2
+	FSCONFIG_SET_PATH        = 3
+	FSCONFIG_SET_PATH_EMPTY  = 4
+	FSCONFIG_SET_FD          = 5
+	FSCONFIG_CMD_CREATE      = 6
+	FSCONFIG_CMD_RECONFIGURE = 7
+	FSCONFIG_CMD_CREATE_EXCL = 8
+)
+
+// Constants for fsmount(2).
+const (
+	FSMOUNT_CLOEXEC = 0x1
+
+	MOUNT_ATTR_RDONLY      = 0x1
+	MOUNT_ATTR_NOSUID      = 0x2
+	MOUNT_ATTR_NODEV       = 0x4
+	MOUNT_ATTR_NOEXEC      = 0x8
+	MOUNT_ATTR__ATIME      = 0x70
+	MOUNT_ATTR_RELATIME    = 0x0
+	MOUNT_ATTR_NOATIME     = 0x10
+	MOUNT_ATTR_STRICTATIME = 0x20
+	MOUNT_ATTR_NODIRATIME  = 0x80
+	MOUNT_ATTR_IDMAP       = 0x100000
+	MOUNT_ATTR_NOSYMFOLLOW = 0x200000
+)
+
+// Constants for open_tree(2).
+const (
+	OPEN_TREE_CLONE   = 0x1
+	OPEN_TREE_CLOEXEC = O_CLOEXEC
+)
+
+// Constants for move_mount(2).
+const (
+	MOVE_MOUNT_F_SYMLINKS   = 0x1
+	MOVE_MOUNT_F_AUTOMOUNTS = 0x2
+	MOVE_MOUNT_F_EMPTY_PATH = 0x4
+	MOVE_MOUNT_T_SYMLINKS   = 0x10
+	MOVE_MOUNT_T_AUTOMOUNTS = 0x20
+	MOVE_MOUNT_T_EMPTY_PATH = 0x40
+	MOVE_MOUNT_SET_GROUP    = 0x100
+	MOVE_MOUNT_BENEATH      = 0x200
+)
+
 // Constants for unlinkat(2).
 const (
 	AT_REMOVEDIR = 0x200
@@ -96,6 +149,11 @@ const (
 	AT_EMPTY_PATH     = 0x1000
 )
 
+// Constants for open_tree(2).
+const (
+	AT_RECURSIVE = 0x8000
+)
+
 // Constants for faccessat2(2).
 const (
 	AT_EACCESS = 0x200
@@ -405,6 +463,8 @@ var fileType = abi.ValueSet{
 const (
 	MFD_CLOEXEC       = 0x0001
 	MFD_ALLOW_SEALING = 0x0002
+	MFD_NOEXEC_SEAL   = 0x0008
+	MFD_EXEC          = 0x0010
 )
 
 // Constants related to file seals. Source: include/uapi/{asm-generic,linux}/fcntl.h
@@ -417,6 +477,9 @@ const (
 	F_SEAL_SHRINK = 0x0002 // Prevent file from shrinking.
 	F_SEAL_GROW   = 0x0004 // Prevent file from growing.
 	F_SEAL_WRITE  = 0x0008 // Prevent writes.
+
+	F_SEAL_FUTURE_WRITE = 0x0010 // Prevent future writes while mapped.
+	F_SEAL_EXEC         = 0x0020 // Prevent chmod modifying exec bits.
 )
 
 // Constants related to fallocate(2). Source: include/uapi/linux/falloc.h
@@ -24,11 +24,13 @@ const (
 	EXT_SUPER_MAGIC       = 0xef53
 	FUSE_SUPER_MAGIC      = 0x65735546
 	MQUEUE_MAGIC          = 0x19800202
+	NFS_SUPER_MAGIC       = 0x6969
 	NSFS_MAGIC            = 0x6e736673
 	OVERLAYFS_SUPER_MAGIC = 0x794c7630
 	PIPEFS_MAGIC          = 0x50495045
 	PROC_SUPER_MAGIC      = 0x9fa0
 	RAMFS_MAGIC           = 0x09041934
+	SECRETMEM_MAGIC       = 0x5345434d
 	SOCKFS_MAGIC          = 0x534F434B
 	SYSFS_MAGIC           = 0x62656572
 	TMPFS_MAGIC           = 0x01021994
@@ -121,3 +123,28 @@ const (
 	RENAME_EXCHANGE  = (1 << 1) // Exchange src and dst.
 	RENAME_WHITEOUT  = (1 << 2) // Whiteout src.
 )
+
+// Fsxattr is struct fsxattr, from include/uapi/linux/fs.h.
+//
+// +marshal
+type Fsxattr struct {
+	XFlags     uint32
+	ExtSize    uint32
+	NExtents   uint32
+	ProjID     uint32
+	CowExtSize uint32
+	_          [8]byte
+}
+
+// ioctl(2) requests for Fsxattr, from include/uapi/linux/fs.h.
+const (
+	FS_IOC_FSGETXATTR = 0x801c581f
+	FS_IOC_FSSETXATTR = 0x401c5820
+)
+
+// Flags for Fsxattr.XFlags, from include/uapi/linux/fs.h.
+const (
+	// FS_XFLAG_PROJINHERIT makes files created in a directory inherit its
+	// project ID.
+	FS_XFLAG_PROJINHERIT = 0x00000200
+)
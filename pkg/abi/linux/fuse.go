@@ -17,6 +17,7 @@ package linux
 import (
 	"time"
 
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 )
 
@@ -80,6 +81,12 @@ const (
 	FUSE_NOTIFY_REPLY = 41
 	FUSE_BATCH_FORGET = 42
 	FUSE_FALLOCATE    = 43
+	_
+	_
+	_
+	_
+	FUSE_SETUPMAPPING  = 48
+	FUSE_REMOVEMAPPING = 49
 )
 
 const (
@@ -160,6 +167,7 @@ const (
 	FUSE_WRITEBACK_CACHE  = 1 << 16
 	FUSE_NO_OPEN_SUPPORT  = 1 << 17
 	FUSE_MAX_PAGES        = 1 << 22 // From FUSE 7.28
+	FUSE_MAP_ALIGNMENT    = 1 << 26 // From FUSE 7.31
 )
 
 // currently supported FUSE protocol version numbers.
@@ -236,7 +244,9 @@ type FUSEInitOut struct {
 	// if the value from daemon is too large.
 	MaxPages uint16
 
-	_ uint16
+	// MapAlignment is the log2 of the alignment of DAX mappings, if
+	// FUSE_MAP_ALIGNMENT is set in Flags.
+	MapAlignment uint16
 
 	_ [8]uint32
 }
@@ -1135,3 +1145,72 @@ type FUSEFlushIn struct {
 	_         uint32 // padding
 	LockOwner uint64
 }
+
+// FUSE_SETUPMAPPING flags, consistent with the ones in
+// include/uapi/linux/fuse.h.
+const (
+	FUSE_SETUPMAPPING_FLAG_WRITE = 1 << 0
+	FUSE_SETUPMAPPING_FLAG_READ  = 1 << 1
+)
+
+// FUSESetupMappingIn is the request sent by the kernel to the daemon to map a
+// range of a file into the DAX window.
+//
+// +marshal
+type FUSESetupMappingIn struct {
+	// Fh is the file handle of the file to map.
+	Fh uint64
+
+	// FOffset is the offset of the range in the file.
+	FOffset uint64
+
+	// Len is the length of the range.
+	Len uint64
+
+	// Flags are FUSE_SETUPMAPPING_FLAG_*.
+	Flags uint64
+
+	// MOffset is the offset of the mapping in the DAX window.
+	MOffset uint64
+}
+
+// FUSERemoveMappingOne describes a range of the DAX window to unmap.
+//
+// +marshal
+type FUSERemoveMappingOne struct {
+	// MOffset is the offset of the range in the DAX window.
+	MOffset uint64
+
+	// Len is the length of the range.
+	Len uint64
+}
+
+// FUSERemoveMappingIn is the request sent by the kernel to the daemon to
+// remove mappings from the DAX window.
+//
+// +marshal dynamic
+type FUSERemoveMappingIn struct {
+	// Mappings are the ranges to unmap. They follow the 32-bit count of
+	// ranges in the request.
+	Mappings []FUSERemoveMappingOne
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (r *FUSERemoveMappingIn) MarshalBytes(buf []byte) []byte {
+	hostarch.ByteOrder.PutUint32(buf, uint32(len(r.Mappings)))
+	buf = buf[4:]
+	for i := range r.Mappings {
+		buf = r.Mappings[i].MarshalBytes(buf)
+	}
+	return buf
+}
+
+// UnmarshalBytes implements marshal.Marshallable.UnmarshalBytes.
+func (r *FUSERemoveMappingIn) UnmarshalBytes(buf []byte) []byte {
+	panic("Unimplemented, FUSERemoveMappingIn is never unmarshalled")
+}
+
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (r *FUSERemoveMappingIn) SizeBytes() int {
+	return 4 + len(r.Mappings)*(*FUSERemoveMappingOne)(nil).SizeBytes()
+}
@@ -16,8 +16,9 @@ package linux
 
 // ioctl(2) request numbers from linux/if_tun.h
 var (
-	TUNSETIFF = IOW('T', 202, 4)
-	TUNGETIFF = IOR('T', 210, 4)
+	TUNSETIFF   = IOW('T', 202, 4)
+	TUNGETIFF   = IOR('T', 210, 4)
+	TUNSETQUEUE = IOW('T', 217, 4)
 )
 
 // Flags from net/if_tun.h
@@ -27,6 +28,10 @@ const (
 	IFF_NO_PI    = 0x1000
 	IFF_NOFILTER = 0x1000
 
+	IFF_MULTI_QUEUE  = 0x0100
+	IFF_ATTACH_QUEUE = 0x0200
+	IFF_DETACH_QUEUE = 0x0400
+
 	// According to linux/if_tun.h "This flag has no real effect"
 	IFF_ONE_QUEUE = 0x2000
 )
@@ -28,12 +28,30 @@ const (
 
 // Constants for io_uring_enter(2). See include/uapi/linux/io_uring.h.
 const (
-	IORING_ENTER_GETEVENTS = (1 << 0)
+	IORING_ENTER_GETEVENTS       = (1 << 0)
+	IORING_ENTER_SQ_WAKEUP       = (1 << 1)
+	IORING_ENTER_SQ_WAIT         = (1 << 2)
+	IORING_ENTER_EXT_ARG         = (1 << 3)
+	IORING_ENTER_REGISTERED_RING = (1 << 4)
+)
+
+// Constants for IORings.sqFlags. See include/uapi/linux/io_uring.h.
+const (
+	IORING_SQ_NEED_WAKEUP = (1 << 0)
+	IORING_SQ_CQ_OVERFLOW = (1 << 1)
+	IORING_SQ_TASKRUN     = (1 << 2)
+)
+
+// Constants for io_uring_register(2). See include/uapi/linux/io_uring.h.
+const (
+	IORING_REGISTER_RING_FDS   = 20
+	IORING_UNREGISTER_RING_FDS = 21
 )
 
 // Constants for IoUringParams.Features. See include/uapi/linux/io_uring.h.
 const (
-	IORING_FEAT_SINGLE_MMAP = (1 << 0)
+	IORING_FEAT_SINGLE_MMAP     = (1 << 0)
+	IORING_FEAT_SQPOLL_NONFIXED = (1 << 7)
 )
 
 // Constants for IO_URING. See include/uapi/linux/io_uring.h.
@@ -50,6 +68,10 @@ const (
 	IORING_MAX_CQ_ENTRIES = (2 * IORING_MAX_ENTRIES)
 )
 
+// IO_RINGFD_REG_MAX is the maximum number of io_uring file descriptors a task
+// can register with IORING_REGISTER_RING_FDS. See io_uring/io_uring.h.
+const IO_RINGFD_REG_MAX = 16
+
 // Constants for the offsets for the application to mmap the data it needs.
 // See include/uapi/linux/io_uring.h.
 const (
@@ -120,6 +142,16 @@ type IOUringParams struct {
 	CqOff        IOCqRingOffsets
 }
 
+// IOUringRsrcUpdate implements io_uring_rsrc_update struct.
+// See struct io_uring_rsrc_update in include/uapi/linux/io_uring.h.
+//
+// +marshal slice:IOUringRsrcUpdateSlice
+type IOUringRsrcUpdate struct {
+	Offset uint32
+	Resv   uint32
+	Data   uint64
+}
+
 // IOUringCqe implements IO completion data structure (Completion Queue Entry)
 // io_uring_cqe struct. As we don't currently support IORING_SETUP_CQE32 flag
 // its size is 16 bytes.
@@ -0,0 +1,193 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// KVMIO is the ioctl type for KVM, from include/uapi/linux/kvm.h.
+const KVMIO = 0xae
+
+// KVM_MINOR is the minor device number of /dev/kvm in MISC_MAJOR, from
+// include/linux/miscdevice.h.
+const KVM_MINOR = 232
+
+// KVM_API_VERSION is the KVM API version, from include/uapi/linux/kvm.h.
+const KVM_API_VERSION = 12
+
+// ioctl(2) requests on the KVM system file descriptor, from
+// include/uapi/linux/kvm.h.
+var (
+	KVM_GET_API_VERSION            = IO(KVMIO, 0x00)
+	KVM_CREATE_VM                  = IO(KVMIO, 0x01)
+	KVM_GET_MSR_INDEX_LIST         = IOWR(KVMIO, 0x02, 4)
+	KVM_CHECK_EXTENSION            = IO(KVMIO, 0x03)
+	KVM_GET_VCPU_MMAP_SIZE         = IO(KVMIO, 0x04)
+	KVM_GET_SUPPORTED_CPUID        = IOWR(KVMIO, 0x05, 8)
+	KVM_GET_EMULATED_CPUID         = IOWR(KVMIO, 0x09, 8)
+	KVM_GET_MSR_FEATURE_INDEX_LIST = IOWR(KVMIO, 0x0a, 4)
+)
+
+// ioctl(2) requests on KVM VM file descriptors, from
+// include/uapi/linux/kvm.h.
+var (
+	KVM_CREATE_VCPU            = IO(KVMIO, 0x41)
+	KVM_GET_DIRTY_LOG          = IOW(KVMIO, 0x42, SizeOfKVMDirtyLog)
+	KVM_SET_USER_MEMORY_REGION = IOW(KVMIO, 0x46, SizeOfKVMUserspaceMemoryRegion)
+	KVM_SET_TSS_ADDR           = IO(KVMIO, 0x47)
+	KVM_SET_IDENTITY_MAP_ADDR  = IOW(KVMIO, 0x48, 8)
+	KVM_CREATE_IRQCHIP         = IO(KVMIO, 0x60)
+	KVM_IRQ_LINE               = IOW(KVMIO, 0x61, 8)
+	KVM_GET_IRQCHIP            = IOWR(KVMIO, 0x62, 520)
+	KVM_SET_IRQCHIP            = IOR(KVMIO, 0x63, 520)
+	KVM_IRQ_LINE_STATUS        = IOWR(KVMIO, 0x67, 8)
+	KVM_SET_GSI_ROUTING        = IOW(KVMIO, 0x6a, 8)
+	KVM_IRQFD                  = IOW(KVMIO, 0x76, SizeOfKVMIRQFD)
+	KVM_CREATE_PIT2            = IOW(KVMIO, 0x77, 64)
+	KVM_IOEVENTFD              = IOW(KVMIO, 0x79, SizeOfKVMIOEventFD)
+	KVM_SET_CLOCK              = IOW(KVMIO, 0x7b, 48)
+	KVM_GET_CLOCK              = IOR(KVMIO, 0x7c, 48)
+	KVM_GET_PIT2               = IOR(KVMIO, 0x9f, 112)
+	KVM_SET_PIT2               = IOW(KVMIO, 0xa0, 112)
+	KVM_ENABLE_CAP             = IOW(KVMIO, 0xa3, 104)
+	KVM_SIGNAL_MSI             = IOW(KVMIO, 0xa5, 32)
+)
+
+// ioctl(2) requests on KVM vCPU file descriptors, from
+// include/uapi/linux/kvm.h.
+var (
+	KVM_RUN             = IO(KVMIO, 0x80)
+	KVM_GET_REGS        = IOR(KVMIO, 0x81, 144)
+	KVM_SET_REGS        = IOW(KVMIO, 0x82, 144)
+	KVM_GET_SREGS       = IOR(KVMIO, 0x83, 312)
+	KVM_SET_SREGS       = IOW(KVMIO, 0x84, 312)
+	KVM_TRANSLATE       = IOWR(KVMIO, 0x85, 24)
+	KVM_INTERRUPT       = IOW(KVMIO, 0x86, 4)
+	KVM_GET_MSRS        = IOWR(KVMIO, 0x88, 8)
+	KVM_SET_MSRS        = IOW(KVMIO, 0x89, 8)
+	KVM_GET_FPU         = IOR(KVMIO, 0x8c, 416)
+	KVM_SET_FPU         = IOW(KVMIO, 0x8d, 416)
+	KVM_GET_LAPIC       = IOR(KVMIO, 0x8e, 1024)
+	KVM_SET_LAPIC       = IOW(KVMIO, 0x8f, 1024)
+	KVM_SET_CPUID2      = IOW(KVMIO, 0x90, 8)
+	KVM_GET_CPUID2      = IOWR(KVMIO, 0x91, 8)
+	KVM_GET_MP_STATE    = IOR(KVMIO, 0x98, 4)
+	KVM_SET_MP_STATE    = IOW(KVMIO, 0x99, 4)
+	KVM_NMI             = IO(KVMIO, 0x9a)
+	KVM_GET_VCPU_EVENTS = IOR(KVMIO, 0x9f, 64)
+	KVM_SET_VCPU_EVENTS = IOW(KVMIO, 0xa0, 64)
+	KVM_GET_DEBUGREGS   = IOR(KVMIO, 0xa1, 128)
+	KVM_SET_DEBUGREGS   = IOW(KVMIO, 0xa2, 128)
+	KVM_SET_TSC_KHZ     = IO(KVMIO, 0xa2)
+	KVM_GET_TSC_KHZ     = IO(KVMIO, 0xa3)
+	KVM_GET_XSAVE       = IOR(KVMIO, 0xa4, 4096)
+	KVM_SET_XSAVE       = IOW(KVMIO, 0xa5, 4096)
+	KVM_GET_XCRS        = IOR(KVMIO, 0xa6, 392)
+	KVM_SET_XCRS        = IOW(KVMIO, 0xa7, 392)
+	KVM_KVMCLOCK_CTRL   = IO(KVMIO, 0xad)
+)
+
+// KVM capabilities, from include/uapi/linux/kvm.h.
+const (
+	KVM_CAP_COALESCED_MMIO         = 15
+	KVM_CAP_SET_GUEST_DEBUG        = 23
+	KVM_CAP_DEVICE_CTRL            = 89
+	KVM_CAP_SPLIT_IRQCHIP          = 121
+	KVM_CAP_HYPERV_SYNIC           = 123
+	KVM_CAP_X2APIC_API             = 129
+	KVM_CAP_X86_DISABLE_EXITS      = 143
+	KVM_CAP_HYPERV_SYNIC2          = 148
+	KVM_CAP_COALESCED_PIO          = 162
+	KVM_CAP_DIRTY_LOG_RING         = 192
+	KVM_CAP_XSAVE2                 = 208
+	KVM_CAP_DIRTY_LOG_RING_ACQ_REL = 223
+	KVM_CAP_USER_MEMORY2           = 231
+	KVM_CAP_GUEST_MEMFD            = 234
+)
+
+// Flags for KVMUserspaceMemoryRegion.Flags, from include/uapi/linux/kvm.h.
+const (
+	KVM_MEM_LOG_DIRTY_PAGES = 1 << 0
+	KVM_MEM_READONLY        = 1 << 1
+)
+
+// Flags for KVMIRQFD.Flags, from include/uapi/linux/kvm.h.
+const (
+	KVM_IRQFD_FLAG_DEASSIGN = 1 << 0
+	KVM_IRQFD_FLAG_RESAMPLE = 1 << 1
+)
+
+// Flags for KVMIOEventFD.Flags, from include/uapi/linux/kvm.h.
+const (
+	KVM_IOEVENTFD_FLAG_DATAMATCH = 1 << 0
+	KVM_IOEVENTFD_FLAG_PIO       = 1 << 1
+	KVM_IOEVENTFD_FLAG_DEASSIGN  = 1 << 2
+)
+
+// KVMRunImmediateExitOffset is the offset of immediate_exit in struct kvm_run.
+const KVMRunImmediateExitOffset = 1
+
+// SizeOfKVMUserspaceMemoryRegion is the size of KVMUserspaceMemoryRegion.
+const SizeOfKVMUserspaceMemoryRegion = 32
+
+// KVMUserspaceMemoryRegion is struct kvm_userspace_memory_region, from
+// include/uapi/linux/kvm.h.
+//
+// +marshal
+type KVMUserspaceMemoryRegion struct {
+	Slot          uint32
+	Flags         uint32
+	GuestPhysAddr uint64
+	MemorySize    uint64
+	UserspaceAddr uint64
+}
+
+// SizeOfKVMDirtyLog is the size of KVMDirtyLog.
+const SizeOfKVMDirtyLog = 16
+
+// KVMDirtyLog is struct kvm_dirty_log, from include/uapi/linux/kvm.h.
+//
+// +marshal
+type KVMDirtyLog struct {
+	Slot        uint32
+	_           uint32
+	DirtyBitmap uint64
+}
+
+// SizeOfKVMIRQFD is the size of KVMIRQFD.
+const SizeOfKVMIRQFD = 32
+
+// KVMIRQFD is struct kvm_irqfd, from include/uapi/linux/kvm.h.
+//
+// +marshal
+type KVMIRQFD struct {
+	FD         uint32
+	GSI        uint32
+	Flags      uint32
+	ResampleFD uint32
+	_          [16]uint8
+}
+
+// SizeOfKVMIOEventFD is the size of KVMIOEventFD.
+const SizeOfKVMIOEventFD = 64
+
+// KVMIOEventFD is struct kvm_ioeventfd, from include/uapi/linux/kvm.h.
+//
+// +marshal
+type KVMIOEventFD struct {
+	Datamatch uint64
+	Addr      uint64
+	Len       uint32
+	FD        int32
+	Flags     uint32
+	_         [36]uint8
+}
@@ -145,6 +145,10 @@ const (
 	// Protection eXtensions (MPX) bounds tables.
 	PR_MPX_DISABLE_MANAGEMENT = 44
 
+	// PR_PAC_RESET_KEYS resets the calling thread's arm64 pointer
+	// authentication keys.
+	PR_PAC_RESET_KEYS = 54
+
 	// The following constants are used to control thread scheduling on cores.
 	PR_SCHED_CORE_SCOPE_THREAD       = 0
 	PR_SCHED_CORE_SCOPE_THREAD_GROUP = 1
@@ -155,6 +159,15 @@ const (
 	PR_SET_PTRACER_ANY = -1
 )
 
+// Keys for prctl(PR_PAC_RESET_KEYS), defined in include/uapi/linux/prctl.h.
+const (
+	PR_PAC_APIAKEY = 1 << 0
+	PR_PAC_APIBKEY = 1 << 1
+	PR_PAC_APDAKEY = 1 << 2
+	PR_PAC_APDBKEY = 1 << 3
+	PR_PAC_APGAKEY = 1 << 4
+)
+
 // From <asm/prctl.h>
 // Flags are used in syscall arch_prctl(2).
 const (
@@ -0,0 +1,64 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// PTP_CLK_MAGIC is the ioctl type for PTP hardware clocks, from
+// include/uapi/linux/ptp_clock.h.
+const PTP_CLK_MAGIC = '='
+
+// PTPClockCaps is struct ptp_clock_caps, from include/uapi/linux/ptp_clock.h.
+//
+// +marshal
+type PTPClockCaps struct {
+	MaxAdj            int32
+	NAlarm            int32
+	NExtTS            int32
+	NPerOut           int32
+	PPS               int32
+	NPins             int32
+	CrossTimestamping int32
+	AdjustPhase       int32
+	MaxPhaseAdj       int32
+	_                 [11]int32
+}
+
+// PTPClockTime is struct ptp_clock_time, from include/uapi/linux/ptp_clock.h.
+//
+// +marshal
+type PTPClockTime struct {
+	Sec      int64
+	Nsec     uint32
+	Reserved uint32
+}
+
+// PTPSysOffsetPrecise is struct ptp_sys_offset_precise, from
+// include/uapi/linux/ptp_clock.h.
+//
+// +marshal
+type PTPSysOffsetPrecise struct {
+	Device      PTPClockTime
+	SysRealtime PTPClockTime
+	SysMonoRaw  PTPClockTime
+	_           [4]uint32
+}
+
+// ioctl(2) requests on PTP hardware clocks, from
+// include/uapi/linux/ptp_clock.h.
+var (
+	PTP_CLOCK_GETCAPS       = IOR(PTP_CLK_MAGIC, 1, 80)
+	PTP_SYS_OFFSET_PRECISE  = IOWR(PTP_CLK_MAGIC, 8, 64)
+	PTP_CLOCK_GETCAPS2      = IOR(PTP_CLK_MAGIC, 10, 80)
+	PTP_SYS_OFFSET_PRECISE2 = IOWR(PTP_CLK_MAGIC, 17, 64)
+)
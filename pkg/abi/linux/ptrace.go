@@ -43,6 +43,7 @@ const (
 	PTRACE_SETSIGMASK           = 0x420b
 	PTRACE_SECCOMP_GET_FILTER   = 0x420c
 	PTRACE_SECCOMP_GET_METADATA = 0x420d
+	PTRACE_GET_SYSCALL_INFO     = 0x420e
 )
 
 // ptrace commands from arch/x86/include/uapi/asm/ptrace-abi.h.
@@ -88,6 +89,64 @@ const (
 	PTRACE_O_SUSPEND_SECCOMP = 1 << 21
 )
 
+// PTRACE_GETEVENTMSG values for syscall-stops, from
+// include/uapi/linux/ptrace.h.
+const (
+	PTRACE_EVENTMSG_SYSCALL_ENTRY = 1
+	PTRACE_EVENTMSG_SYSCALL_EXIT  = 2
+)
+
+// PTRACE_GET_SYSCALL_INFO operations from include/uapi/linux/ptrace.h.
+const (
+	PTRACE_SYSCALL_INFO_NONE    = 0
+	PTRACE_SYSCALL_INFO_ENTRY   = 1
+	PTRACE_SYSCALL_INFO_EXIT    = 2
+	PTRACE_SYSCALL_INFO_SECCOMP = 3
+)
+
+// PTRACE_PEEKSIGINFO_SHARED is a flag for PtracePeekSigInfoArgs.Flags that
+// requests signals from the thread group's shared queue rather than the
+// thread's own queue.
+const PTRACE_PEEKSIGINFO_SHARED = 1 << 0
+
+// PtracePeekSigInfoArgs is struct ptrace_peeksiginfo_args, from
+// include/uapi/linux/ptrace.h.
+//
+// +marshal
+type PtracePeekSigInfoArgs struct {
+	Off   uint64
+	Flags uint32
+	Nr    int32
+}
+
+// PtraceSyscallInfo is struct ptrace_syscall_info, from
+// include/uapi/linux/ptrace.h. The union following the common fields is
+// represented by Data; its layout depends on Op:
+//
+//   - PTRACE_SYSCALL_INFO_ENTRY: nr, followed by 6 arguments.
+//   - PTRACE_SYSCALL_INFO_EXIT: rval, followed by the is_error byte.
+//   - PTRACE_SYSCALL_INFO_SECCOMP: nr, followed by 6 arguments and the 32-bit
+//     SECCOMP_RET_DATA.
+//
+// +marshal
+type PtraceSyscallInfo struct {
+	Op                 uint8
+	_                  [3]uint8
+	Arch               uint32
+	InstructionPointer uint64
+	StackPointer       uint64
+	Data               [8]uint64
+}
+
+// Sizes of the valid prefix of PtraceSyscallInfo for each operation, as
+// returned by PTRACE_GET_SYSCALL_INFO.
+const (
+	PtraceSyscallInfoNoneSize    = 24
+	PtraceSyscallInfoEntrySize   = PtraceSyscallInfoNoneSize + 7*8
+	PtraceSyscallInfoExitSize    = PtraceSyscallInfoNoneSize + 8 + 1
+	PtraceSyscallInfoSeccompSize = PtraceSyscallInfoEntrySize + 4
+)
+
 // YAMA ptrace_scope levels from security/yama/yama_lsm.c.
 const (
 	YAMA_SCOPE_DISABLED   = 0
@@ -0,0 +1,132 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Quota types, from uapi/linux/quota.h.
+const (
+	USRQUOTA  = 0
+	GRPQUOTA  = 1
+	PRJQUOTA  = 2
+	MAXQUOTAS = 3
+)
+
+// quotactl(2) commands are built from a subcommand and a quota type, from
+// uapi/linux/quota.h.
+const (
+	SUBCMDMASK  = 0x00ff
+	SUBCMDSHIFT = 8
+)
+
+// quotactl(2) subcommands, from uapi/linux/quota.h.
+const (
+	Q_SYNC         = 0x800001
+	Q_QUOTAON      = 0x800002
+	Q_QUOTAOFF     = 0x800003
+	Q_GETFMT       = 0x800004
+	Q_GETINFO      = 0x800005
+	Q_SETINFO      = 0x800006
+	Q_GETQUOTA     = 0x800007
+	Q_SETQUOTA     = 0x800008
+	Q_GETNEXTQUOTA = 0x800009
+)
+
+// Quota format IDs, from uapi/linux/quota.h.
+const (
+	QFMT_VFS_OLD = 1
+	QFMT_VFS_V0  = 2
+	QFMT_OCFS2   = 3
+	QFMT_VFS_V1  = 4
+	QFMT_SHMEM   = 5
+)
+
+// QIF_DQBLKSIZE is the size of the blocks in which IfDqblk block limits are
+// expressed, from uapi/linux/quota.h.
+const QIF_DQBLKSIZE = 1 << 10
+
+// Flags for IfDqblk.Valid, from uapi/linux/quota.h.
+const (
+	QIF_BLIMITS = 1 << 0
+	QIF_SPACE   = 1 << 1
+	QIF_ILIMITS = 1 << 2
+	QIF_INODES  = 1 << 3
+	QIF_BTIME   = 1 << 4
+	QIF_ITIME   = 1 << 5
+	QIF_LIMITS  = QIF_BLIMITS | QIF_ILIMITS
+	QIF_USAGE   = QIF_SPACE | QIF_INODES
+	QIF_TIMES   = QIF_BTIME | QIF_ITIME
+	QIF_ALL     = QIF_LIMITS | QIF_USAGE | QIF_TIMES
+)
+
+// Flags for IfDqinfo.Valid, from uapi/linux/quota.h.
+const (
+	IIF_BGRACE = 1
+	IIF_IGRACE = 2
+	IIF_FLAGS  = 4
+	IIF_ALL    = IIF_BGRACE | IIF_IGRACE | IIF_FLAGS
+)
+
+// Flags for IfDqinfo.Flags, from uapi/linux/quota.h.
+const (
+	DQF_ROOT_SQUASH = 1 << 0
+	DQF_SYS_FILE    = 1 << 16
+)
+
+// Default grace periods in seconds, from include/linux/quota.h.
+const (
+	MAX_DQ_TIME = 604800
+	MAX_IQ_TIME = 604800
+)
+
+// IfDqblk is struct if_dqblk, from uapi/linux/quota.h.
+//
+// +marshal
+type IfDqblk struct {
+	BHardLimit uint64
+	BSoftLimit uint64
+	CurSpace   uint64
+	IHardLimit uint64
+	ISoftLimit uint64
+	CurInodes  uint64
+	BTime      uint64
+	ITime      uint64
+	Valid      uint32
+	_          uint32
+}
+
+// IfNextDqblk is struct if_nextdqblk, from uapi/linux/quota.h.
+//
+// +marshal
+type IfNextDqblk struct {
+	BHardLimit uint64
+	BSoftLimit uint64
+	CurSpace   uint64
+	IHardLimit uint64
+	ISoftLimit uint64
+	CurInodes  uint64
+	BTime      uint64
+	ITime      uint64
+	Valid      uint32
+	ID         uint32
+}
+
+// IfDqinfo is struct if_dqinfo, from uapi/linux/quota.h.
+//
+// +marshal
+type IfDqinfo struct {
+	BGrace uint64
+	IGrace uint64
+	Flags  uint32
+	Valid  uint32
+}
@@ -66,17 +66,19 @@ func (a BPFAction) Data() uint16 {
 	return uint16(a & SECCOMP_RET_DATA)
 }
 
-// WithReturnCode sets the lower 16 bits of the SECCOMP_RET_ERRNO or
-// SECCOMP_RET_TRACE actions to the provided return code, overwriting the previous
-// action, and returns a new BPFAction. If not SECCOMP_RET_ERRNO or
-// SECCOMP_RET_TRACE then this panics.
+// WithReturnCode sets the lower 16 bits of the SECCOMP_RET_ERRNO,
+// SECCOMP_RET_TRAP or SECCOMP_RET_TRACE actions to the provided return code,
+// overwriting the previous action, and returns a new BPFAction. For
+// SECCOMP_RET_TRAP, the return code is passed to the SIGSYS handler as
+// si_errno. If not SECCOMP_RET_ERRNO, SECCOMP_RET_TRAP or SECCOMP_RET_TRACE
+// then this panics.
 func (a BPFAction) WithReturnCode(code uint16) BPFAction {
 	// mask out the previous return value
 	baseAction := a & SECCOMP_RET_ACTION_FULL
-	if baseAction == SECCOMP_RET_ERRNO || baseAction == SECCOMP_RET_TRACE {
+	if baseAction == SECCOMP_RET_ERRNO || baseAction == SECCOMP_RET_TRAP || baseAction == SECCOMP_RET_TRACE {
 		return BPFAction(uint32(baseAction) | uint32(code))
 	}
-	panic("WithReturnCode only valid for SECCOMP_RET_ERRNO and SECCOMP_RET_TRACE")
+	panic("WithReturnCode only valid for SECCOMP_RET_ERRNO, SECCOMP_RET_TRAP and SECCOMP_RET_TRACE")
 }
 
 // SockFprog is sock_fprog taken from <linux/filter.h>.
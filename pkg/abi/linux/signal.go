@@ -271,6 +271,18 @@ const (
 	SYS_SECCOMP = 1
 )
 
+// TRAP_* codes are only meaningful for SIGTRAP.
+const (
+	// TRAP_BRKPT indicates a process breakpoint.
+	TRAP_BRKPT = 1
+
+	// TRAP_TRACE indicates a process trace trap, e.g. after single-stepping.
+	TRAP_TRACE = 2
+
+	// TRAP_HWBKPT indicates a hardware breakpoint or watchpoint.
+	TRAP_HWBKPT = 4
+)
+
 // Possible values for Sigevent.Notify, aka struct sigevent::sigev_notify.
 const (
 	SIGEV_SIGNAL    = 0
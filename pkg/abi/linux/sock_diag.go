@@ -0,0 +1,237 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Netlink message types for NETLINK_SOCK_DIAG sockets, from
+// uapi/linux/sock_diag.h.
+const (
+	SOCK_DIAG_BY_FAMILY = 20
+	SOCK_DESTROY        = 21
+)
+
+// SockDiagReq is struct sock_diag_req, from uapi/linux/sock_diag.h. It is the
+// common prefix of all family-specific requests.
+//
+// +marshal
+type SockDiagReq struct {
+	Family   uint8
+	Protocol uint8
+}
+
+// Socket memory information indices, from uapi/linux/sock_diag.h.
+const (
+	SK_MEMINFO_RMEM_ALLOC = iota
+	SK_MEMINFO_RCVBUF
+	SK_MEMINFO_WMEM_ALLOC
+	SK_MEMINFO_SNDBUF
+	SK_MEMINFO_FWD_ALLOC
+	SK_MEMINFO_WMEM_QUEUED
+	SK_MEMINFO_OPTMEM
+	SK_MEMINFO_BACKLOG
+	SK_MEMINFO_DROPS
+
+	SK_MEMINFO_VARS
+)
+
+// InetDiagNoCookie is INET_DIAG_NOCOOKIE, the cookie value that matches any
+// socket.
+const InetDiagNoCookie = ^uint32(0)
+
+// InetDiagSockID is struct inet_diag_sockid, from uapi/linux/inet_diag.h.
+// Ports and addresses are in network byte order.
+//
+// +marshal
+type InetDiagSockID struct {
+	SPort     [2]byte
+	DPort     [2]byte
+	Src       [16]byte
+	Dst       [16]byte
+	Interface uint32
+	Cookie    [2]uint32
+}
+
+// InetDiagReqV2 is struct inet_diag_req_v2, from uapi/linux/inet_diag.h.
+//
+// +marshal
+type InetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	_        uint8
+	States   uint32
+	ID       InetDiagSockID
+}
+
+// InetDiagMsg is struct inet_diag_msg, from uapi/linux/inet_diag.h.
+//
+// +marshal
+type InetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      InetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+// Request attributes of InetDiagReqV2, from uapi/linux/inet_diag.h.
+const (
+	INET_DIAG_REQ_NONE     = 0
+	INET_DIAG_REQ_BYTECODE = 1
+)
+
+// Attributes of InetDiagMsg, from uapi/linux/inet_diag.h. Requests select
+// attributes A by setting bit A-1 of InetDiagReqV2.Ext.
+const (
+	INET_DIAG_NONE            = 0
+	INET_DIAG_MEMINFO         = 1
+	INET_DIAG_INFO            = 2
+	INET_DIAG_VEGASINFO       = 3
+	INET_DIAG_CONG            = 4
+	INET_DIAG_TOS             = 5
+	INET_DIAG_TCLASS          = 6
+	INET_DIAG_SKMEMINFO       = 7
+	INET_DIAG_SHUTDOWN        = 8
+	INET_DIAG_DCTCPINFO       = 9
+	INET_DIAG_PROTOCOL        = 10
+	INET_DIAG_SKV6ONLY        = 11
+	INET_DIAG_LOCALS          = 12
+	INET_DIAG_PEERS           = 13
+	INET_DIAG_PAD             = 14
+	INET_DIAG_MARK            = 15
+	INET_DIAG_BBRINFO         = 16
+	INET_DIAG_CLASS_ID        = 17
+	INET_DIAG_MD5SIG          = 18
+	INET_DIAG_ULP_INFO        = 19
+	INET_DIAG_SK_BPF_STORAGES = 20
+	INET_DIAG_CGROUP_ID       = 21
+	INET_DIAG_SOCKOPT         = 22
+)
+
+// InetDiagMemInfo is struct inet_diag_meminfo, from uapi/linux/inet_diag.h.
+//
+// +marshal
+type InetDiagMemInfo struct {
+	RMem uint32
+	WMem uint32
+	FMem uint32
+	TMem uint32
+}
+
+// InetDiagBCOp is struct inet_diag_bc_op, from uapi/linux/inet_diag.h. It is a
+// single instruction of the filter bytecode carried by
+// INET_DIAG_REQ_BYTECODE.
+//
+// +marshal
+type InetDiagBCOp struct {
+	Code uint8
+	Yes  uint8
+	No   uint16
+}
+
+// SizeOfInetDiagBCOp is the size of InetDiagBCOp.
+const SizeOfInetDiagBCOp = 4
+
+// Bytecode operations, from uapi/linux/inet_diag.h.
+const (
+	INET_DIAG_BC_NOP         = 0
+	INET_DIAG_BC_JMP         = 1
+	INET_DIAG_BC_S_GE        = 2
+	INET_DIAG_BC_S_LE        = 3
+	INET_DIAG_BC_D_GE        = 4
+	INET_DIAG_BC_D_LE        = 5
+	INET_DIAG_BC_AUTO        = 6
+	INET_DIAG_BC_S_COND      = 7
+	INET_DIAG_BC_D_COND      = 8
+	INET_DIAG_BC_DEV_COND    = 9
+	INET_DIAG_BC_MARK_COND   = 10
+	INET_DIAG_BC_S_EQ        = 11
+	INET_DIAG_BC_D_EQ        = 12
+	INET_DIAG_BC_CGROUP_COND = 13
+)
+
+// InetDiagHostCond is struct inet_diag_hostcond, from uapi/linux/inet_diag.h,
+// without the trailing address.
+//
+// +marshal
+type InetDiagHostCond struct {
+	Family    uint8
+	PrefixLen uint8
+	_         uint16
+	Port      int32
+}
+
+// SizeOfInetDiagHostCond is the size of InetDiagHostCond.
+const SizeOfInetDiagHostCond = 8
+
+// UnixDiagReq is struct unix_diag_req, from uapi/linux/unix_diag.h.
+//
+// +marshal
+type UnixDiagReq struct {
+	Family   uint8
+	Protocol uint8
+	_        uint16
+	States   uint32
+	Ino      uint32
+	Show     uint32
+	Cookie   [2]uint32
+}
+
+// Flags of UnixDiagReq.Show, from uapi/linux/unix_diag.h.
+const (
+	UDIAG_SHOW_NAME    = 0x00000001
+	UDIAG_SHOW_VFS     = 0x00000002
+	UDIAG_SHOW_PEER    = 0x00000004
+	UDIAG_SHOW_ICONS   = 0x00000008
+	UDIAG_SHOW_RQLEN   = 0x00000010
+	UDIAG_SHOW_MEMINFO = 0x00000020
+	UDIAG_SHOW_UID     = 0x00000040
+)
+
+// UnixDiagMsg is struct unix_diag_msg, from uapi/linux/unix_diag.h.
+//
+// +marshal
+type UnixDiagMsg struct {
+	Family uint8
+	Type   uint8
+	State  uint8
+	_      uint8
+	Ino    uint32
+	Cookie [2]uint32
+}
+
+// Attributes of UnixDiagMsg, from uapi/linux/unix_diag.h.
+const (
+	UNIX_DIAG_NAME     = 0
+	UNIX_DIAG_VFS      = 1
+	UNIX_DIAG_PEER     = 2
+	UNIX_DIAG_ICONS    = 3
+	UNIX_DIAG_RQLEN    = 4
+	UNIX_DIAG_MEMINFO  = 5
+	UNIX_DIAG_SHUTDOWN = 6
+	UNIX_DIAG_UID      = 7
+)
+
+// UnixDiagRQLen is struct unix_diag_rqlen, from uapi/linux/unix_diag.h.
+//
+// +marshal
+type UnixDiagRQLen struct {
+	RQueue uint32
+	WQueue uint32
+}
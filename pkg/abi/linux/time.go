@@ -55,6 +55,7 @@ const (
 
 	CPUCLOCK_CLOCK_MASK     = 3
 	CPUCLOCK_PERTHREAD_MASK = 4
+	CLOCKFD_MASK            = CPUCLOCK_PERTHREAD_MASK | CPUCLOCK_CLOCK_MASK
 )
 
 // Clock identifiers for use with clock_gettime(2), clock_getres(2),
@@ -70,6 +71,7 @@ const (
 	CLOCK_BOOTTIME           = 7
 	CLOCK_REALTIME_ALARM     = 8
 	CLOCK_BOOTTIME_ALARM     = 9
+	CLOCK_TAI                = 11
 )
 
 // Flags for clock_nanosleep(2).
@@ -0,0 +1,111 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// TLS socket options and control messages, from uapi/linux/tls.h.
+const (
+	TLS_TX               = 1
+	TLS_RX               = 2
+	TLS_TX_ZEROCOPY_RO   = 3
+	TLS_RX_EXPECT_NO_PAD = 4
+
+	TLS_SET_RECORD_TYPE = 1
+	TLS_GET_RECORD_TYPE = 2
+)
+
+// TLS protocol versions, from uapi/linux/tls.h.
+const (
+	TLS_1_2_VERSION = 0x0303
+	TLS_1_3_VERSION = 0x0304
+)
+
+// TLS ciphers, from uapi/linux/tls.h.
+const (
+	TLS_CIPHER_AES_GCM_128       = 51
+	TLS_CIPHER_AES_GCM_256       = 52
+	TLS_CIPHER_AES_CCM_128       = 53
+	TLS_CIPHER_CHACHA20_POLY1305 = 54
+
+	TLS_CIPHER_AES_GCM_128_IV_SIZE      = 8
+	TLS_CIPHER_AES_GCM_128_KEY_SIZE     = 16
+	TLS_CIPHER_AES_GCM_128_SALT_SIZE    = 4
+	TLS_CIPHER_AES_GCM_128_TAG_SIZE     = 16
+	TLS_CIPHER_AES_GCM_128_REC_SEQ_SIZE = 8
+
+	TLS_CIPHER_AES_GCM_256_IV_SIZE      = 8
+	TLS_CIPHER_AES_GCM_256_KEY_SIZE     = 32
+	TLS_CIPHER_AES_GCM_256_SALT_SIZE    = 4
+	TLS_CIPHER_AES_GCM_256_TAG_SIZE     = 16
+	TLS_CIPHER_AES_GCM_256_REC_SEQ_SIZE = 8
+)
+
+// TLS record content types, from include/net/tls.h.
+const (
+	TLS_RECORD_TYPE_CHANGE_CIPHER_SPEC = 20
+	TLS_RECORD_TYPE_ALERT              = 21
+	TLS_RECORD_TYPE_HANDSHAKE          = 22
+	TLS_RECORD_TYPE_DATA               = 23
+)
+
+// TLS record limits, from include/net/tls.h.
+const (
+	TLS_HEADER_SIZE      = 5
+	TLS_MAX_PAYLOAD_SIZE = 1 << 14
+)
+
+// TLSCryptoInfo is struct tls_crypto_info, from uapi/linux/tls.h.
+//
+// +marshal
+type TLSCryptoInfo struct {
+	Version    uint16
+	CipherType uint16
+}
+
+// SizeOfTLSCryptoInfo is the size of a TLSCryptoInfo.
+const SizeOfTLSCryptoInfo = 4
+
+// TLS12CryptoInfoAESGCM128 is struct tls12_crypto_info_aes_gcm_128, from
+// uapi/linux/tls.h.
+//
+// +marshal
+type TLS12CryptoInfoAESGCM128 struct {
+	Info   TLSCryptoInfo
+	IV     [TLS_CIPHER_AES_GCM_128_IV_SIZE]byte
+	Key    [TLS_CIPHER_AES_GCM_128_KEY_SIZE]byte
+	Salt   [TLS_CIPHER_AES_GCM_128_SALT_SIZE]byte
+	RecSeq [TLS_CIPHER_AES_GCM_128_REC_SEQ_SIZE]byte
+}
+
+// SizeOfTLS12CryptoInfoAESGCM128 is the size of a TLS12CryptoInfoAESGCM128.
+const SizeOfTLS12CryptoInfoAESGCM128 = 40
+
+// TLS12CryptoInfoAESGCM256 is struct tls12_crypto_info_aes_gcm_256, from
+// uapi/linux/tls.h.
+//
+// +marshal
+type TLS12CryptoInfoAESGCM256 struct {
+	Info   TLSCryptoInfo
+	IV     [TLS_CIPHER_AES_GCM_256_IV_SIZE]byte
+	Key    [TLS_CIPHER_AES_GCM_256_KEY_SIZE]byte
+	Salt   [TLS_CIPHER_AES_GCM_256_SALT_SIZE]byte
+	RecSeq [TLS_CIPHER_AES_GCM_256_REC_SEQ_SIZE]byte
+}
+
+// SizeOfTLS12CryptoInfoAESGCM256 is the size of a TLS12CryptoInfoAESGCM256.
+const SizeOfTLS12CryptoInfoAESGCM256 = 56
+
+// SizeOfControlMessageTLSRecordType is the size of a TLS_GET_RECORD_TYPE or
+// TLS_SET_RECORD_TYPE control message.
+const SizeOfControlMessageTLSRecordType = 1
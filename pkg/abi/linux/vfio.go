@@ -0,0 +1,180 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// VFIO_TYPE is the ioctl type for VFIO, from include/uapi/linux/vfio.h.
+const VFIO_TYPE = ';'
+
+// VFIO_BASE is the first ioctl number used by VFIO, from
+// include/uapi/linux/vfio.h.
+const VFIO_BASE = 100
+
+// VFIO_MINOR is the minor device number of /dev/vfio/vfio in MISC_MAJOR, from
+// include/linux/miscdevice.h.
+const VFIO_MINOR = 196
+
+// VFIO_API_VERSION is the VFIO API version, from include/uapi/linux/vfio.h.
+const VFIO_API_VERSION = 0
+
+// ioctl(2) requests on VFIO container, group and device file descriptors,
+// from include/uapi/linux/vfio.h. VFIO ioctls do not encode their argument
+// size; structure arguments instead begin with an argsz field.
+var (
+	VFIO_GET_API_VERSION               = IO(VFIO_TYPE, VFIO_BASE+0)
+	VFIO_CHECK_EXTENSION               = IO(VFIO_TYPE, VFIO_BASE+1)
+	VFIO_SET_IOMMU                     = IO(VFIO_TYPE, VFIO_BASE+2)
+	VFIO_GROUP_GET_STATUS              = IO(VFIO_TYPE, VFIO_BASE+3)
+	VFIO_GROUP_SET_CONTAINER           = IO(VFIO_TYPE, VFIO_BASE+4)
+	VFIO_GROUP_UNSET_CONTAINER         = IO(VFIO_TYPE, VFIO_BASE+5)
+	VFIO_GROUP_GET_DEVICE_FD           = IO(VFIO_TYPE, VFIO_BASE+6)
+	VFIO_DEVICE_GET_INFO               = IO(VFIO_TYPE, VFIO_BASE+7)
+	VFIO_DEVICE_GET_REGION_INFO        = IO(VFIO_TYPE, VFIO_BASE+8)
+	VFIO_DEVICE_GET_IRQ_INFO           = IO(VFIO_TYPE, VFIO_BASE+9)
+	VFIO_DEVICE_SET_IRQS               = IO(VFIO_TYPE, VFIO_BASE+10)
+	VFIO_DEVICE_RESET                  = IO(VFIO_TYPE, VFIO_BASE+11)
+	VFIO_DEVICE_GET_PCI_HOT_RESET_INFO = IO(VFIO_TYPE, VFIO_BASE+12)
+	VFIO_IOMMU_GET_INFO                = IO(VFIO_TYPE, VFIO_BASE+12)
+	VFIO_IOMMU_MAP_DMA                 = IO(VFIO_TYPE, VFIO_BASE+13)
+	VFIO_IOMMU_UNMAP_DMA               = IO(VFIO_TYPE, VFIO_BASE+14)
+)
+
+// VFIO extensions and IOMMU types, from include/uapi/linux/vfio.h.
+const (
+	VFIO_TYPE1_IOMMU         = 1
+	VFIO_SPAPR_TCE_IOMMU     = 2
+	VFIO_TYPE1v2_IOMMU       = 3
+	VFIO_DMA_CC_IOMMU        = 4
+	VFIO_EEH                 = 5
+	VFIO_TYPE1_NESTING_IOMMU = 6
+	VFIO_SPAPR_TCE_v2_IOMMU  = 7
+	VFIO_NOIOMMU_IOMMU       = 8
+	VFIO_UNMAP_ALL           = 9
+	VFIO_UPDATE_VADDR        = 10
+)
+
+// Flags for VFIORegionInfo.Flags, from include/uapi/linux/vfio.h.
+const (
+	VFIO_REGION_INFO_FLAG_READ  = 1 << 0
+	VFIO_REGION_INFO_FLAG_WRITE = 1 << 1
+	VFIO_REGION_INFO_FLAG_MMAP  = 1 << 2
+	VFIO_REGION_INFO_FLAG_CAPS  = 1 << 3
+)
+
+// VFIO_REGION_INFO_CAP_SPARSE_MMAP is the ID of the region info capability
+// describing the mmap-able areas of a region, from include/uapi/linux/vfio.h.
+const VFIO_REGION_INFO_CAP_SPARSE_MMAP = 1
+
+// Flags for VFIOIRQSet.Flags, from include/uapi/linux/vfio.h.
+const (
+	VFIO_IRQ_SET_DATA_NONE      = 1 << 0
+	VFIO_IRQ_SET_DATA_BOOL      = 1 << 1
+	VFIO_IRQ_SET_DATA_EVENTFD   = 1 << 2
+	VFIO_IRQ_SET_ACTION_MASK    = 1 << 3
+	VFIO_IRQ_SET_ACTION_UNMASK  = 1 << 4
+	VFIO_IRQ_SET_ACTION_TRIGGER = 1 << 5
+
+	VFIO_IRQ_SET_DATA_TYPE_MASK   = VFIO_IRQ_SET_DATA_NONE | VFIO_IRQ_SET_DATA_BOOL | VFIO_IRQ_SET_DATA_EVENTFD
+	VFIO_IRQ_SET_ACTION_TYPE_MASK = VFIO_IRQ_SET_ACTION_MASK | VFIO_IRQ_SET_ACTION_UNMASK | VFIO_IRQ_SET_ACTION_TRIGGER
+)
+
+// Flags for VFIOIOMMUType1DMAMap.Flags, from include/uapi/linux/vfio.h.
+const (
+	VFIO_DMA_MAP_FLAG_READ  = 1 << 0
+	VFIO_DMA_MAP_FLAG_WRITE = 1 << 1
+	VFIO_DMA_MAP_FLAG_VADDR = 1 << 2
+)
+
+// Flags for VFIOIOMMUType1DMAUnmap.Flags, from include/uapi/linux/vfio.h.
+const (
+	VFIO_DMA_UNMAP_FLAG_GET_DIRTY_BITMAP = 1 << 0
+	VFIO_DMA_UNMAP_FLAG_ALL              = 1 << 1
+	VFIO_DMA_UNMAP_FLAG_VADDR            = 1 << 2
+)
+
+// SizeOfVFIODeviceInfo is the size of VFIODeviceInfo before cap_offset was
+// added, which is the smallest argsz accepted by VFIO_DEVICE_GET_INFO.
+const SizeOfVFIODeviceInfo = 16
+
+// VFIODeviceInfo is struct vfio_device_info, from include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIODeviceInfo struct {
+	Argsz      uint32
+	Flags      uint32
+	NumRegions uint32
+	NumIRQs    uint32
+	CapOffset  uint32
+	_          uint32
+}
+
+// SizeOfVFIORegionInfo is the size of VFIORegionInfo.
+const SizeOfVFIORegionInfo = 32
+
+// VFIORegionInfo is struct vfio_region_info, from include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIORegionInfo struct {
+	Argsz     uint32
+	Flags     uint32
+	Index     uint32
+	CapOffset uint32
+	Size      uint64
+	Offset    uint64
+}
+
+// SizeOfVFIOIRQSet is the size of VFIOIRQSet, which is followed by Count
+// entries of data whose type is given by Flags.
+const SizeOfVFIOIRQSet = 20
+
+// VFIOIRQSet is struct vfio_irq_set, excluding the trailing data, from
+// include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIOIRQSet struct {
+	Argsz uint32
+	Flags uint32
+	Index uint32
+	Start uint32
+	Count uint32
+}
+
+// SizeOfVFIOIOMMUType1DMAMap is the size of VFIOIOMMUType1DMAMap.
+const SizeOfVFIOIOMMUType1DMAMap = 32
+
+// VFIOIOMMUType1DMAMap is struct vfio_iommu_type1_dma_map, from
+// include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIOIOMMUType1DMAMap struct {
+	Argsz uint32
+	Flags uint32
+	Vaddr uint64
+	IOVA  uint64
+	Size  uint64
+}
+
+// SizeOfVFIOIOMMUType1DMAUnmap is the size of VFIOIOMMUType1DMAUnmap.
+const SizeOfVFIOIOMMUType1DMAUnmap = 24
+
+// VFIOIOMMUType1DMAUnmap is struct vfio_iommu_type1_dma_unmap, excluding the
+// trailing dirty bitmap, from include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIOIOMMUType1DMAUnmap struct {
+	Argsz uint32
+	Flags uint32
+	IOVA  uint64
+	Size  uint64
+}
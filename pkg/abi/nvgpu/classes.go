@@ -31,17 +31,26 @@ const (
 	FERMI_CONTEXT_SHARE_A            = 0x00009067
 	FERMI_VASPACE_A                  = 0x000090f1
 	KEPLER_CHANNEL_GROUP_A           = 0x0000a06c
+	NVENC_SW_SESSION                 = 0x0000a0bc
+	NVB8B0_VIDEO_DECODER             = 0x0000b8b0
 	TURING_USERMODE_A                = 0x0000c461
 	TURING_CHANNEL_GPFIFO_A          = 0x0000c46f
+	NVC4B0_VIDEO_DECODER             = 0x0000c4b0
+	NVC4B7_VIDEO_ENCODER             = 0x0000c4b7
 	AMPERE_CHANNEL_GPFIFO_A          = 0x0000c56f
 	TURING_DMA_COPY_A                = 0x0000c5b5
 	TURING_COMPUTE_A                 = 0x0000c5c0
 	HOPPER_USERMODE_A                = 0x0000c661
+	NVC6B0_VIDEO_DECODER             = 0x0000c6b0
 	AMPERE_DMA_COPY_A                = 0x0000c6b5
 	AMPERE_COMPUTE_A                 = 0x0000c6c0
+	NVC7B0_VIDEO_DECODER             = 0x0000c7b0
 	AMPERE_DMA_COPY_B                = 0x0000c7b5
+	NVC7B7_VIDEO_ENCODER             = 0x0000c7b7
 	AMPERE_COMPUTE_B                 = 0x0000c7c0
 	HOPPER_DMA_COPY_A                = 0x0000c8b5
+	NVC9B0_VIDEO_DECODER             = 0x0000c9b0
+	NVC9B7_VIDEO_ENCODER             = 0x0000c9b7
 	ADA_COMPUTE_A                    = 0x0000c9c0
 	HOPPER_COMPUTE_A                 = 0x0000cbc0
 )
@@ -182,6 +191,18 @@ type NV_CHANNEL_ALLOC_PARAMS struct {
 	SubProcessID        uint32
 }
 
+// NVA0BC_ALLOC_PARAMETERS is the alloc param type for NVENC_SW_SESSION, from
+// src/common/sdk/nvidia/inc/class/cla0bc.h.
+//
+// +marshal
+type NVA0BC_ALLOC_PARAMETERS struct {
+	CodecType   uint32
+	HResolution uint32
+	VResolution uint32
+	Version     uint32
+	HMem        Handle
+}
+
 // NVB0B5_ALLOCATION_PARAMETERS is the alloc param type for TURING_DMA_COPY_A,
 // AMPERE_DMA_COPY_A, and AMPERE_DMA_COPY_B from
 // src/common/sdk/nvidia/inc/class/clb0b5sw.h.
@@ -203,6 +224,26 @@ type NV_GR_ALLOCATION_PARAMETERS struct {
 	Caps    uint32
 }
 
+// NV_BSP_ALLOCATION_PARAMETERS is the alloc param type for the
+// NV*_VIDEO_DECODER (NVDEC) classes, from src/common/sdk/nvidia/inc/nvos.h.
+//
+// +marshal
+type NV_BSP_ALLOCATION_PARAMETERS struct {
+	Size                      uint32
+	ProhibitMultipleInstances uint32
+	EngineInstance            uint32
+}
+
+// NV_MSENC_ALLOCATION_PARAMETERS is the alloc param type for the
+// NV*_VIDEO_ENCODER (NVENC) classes, from src/common/sdk/nvidia/inc/nvos.h.
+//
+// +marshal
+type NV_MSENC_ALLOCATION_PARAMETERS struct {
+	Size                      uint32
+	ProhibitMultipleInstances uint32
+	EngineInstance            uint32
+}
+
 // NV_HOPPER_USERMODE_A_PARAMS is the alloc param type for HOPPER_USERMODE_A,
 // from src/common/sdk/nvidia/inc/nvos.h.
 //
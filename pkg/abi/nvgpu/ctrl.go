@@ -46,6 +46,21 @@ const (
 	NV0000_CTRL_CMD_GPU_GET_MEMOP_ENABLE  = 0x27b
 )
 
+// NV0000_CTRL_GPU_GET_ID_INFO_V2_PARAMS is the param type for
+// NV0000_CTRL_CMD_GPU_GET_ID_INFO_V2.
+//
+// +marshal
+type NV0000_CTRL_GPU_GET_ID_INFO_V2_PARAMS struct {
+	GpuID             uint32
+	GpuFlags          uint32
+	DeviceInstance    uint32
+	SubDeviceInstance uint32
+	SliStatus         uint32
+	BoardID           uint32
+	GpuInstance       uint32
+	NumaID            int32
+}
+
 // From src/common/sdk/nvidia/inc/ctrl/ctrl0000/ctrl0000syncgpuboost.h:
 const (
 	NV0000_CTRL_CMD_SYNC_GPU_BOOST_GROUP_INFO = 0xa04
@@ -70,6 +85,99 @@ type NV0000_CTRL_SYSTEM_GET_BUILD_VERSION_PARAMS struct {
 	OfficialChangelistNumber uint32
 }
 
+// From src/common/sdk/nvidia/inc/ctrl/ctrl0000/ctrl0000unix.h:
+const (
+	NV0000_CTRL_CMD_OS_UNIX_EXPORT_OBJECT_TO_FD    = 0x3d05
+	NV0000_CTRL_CMD_OS_UNIX_IMPORT_OBJECT_FROM_FD  = 0x3d06
+	NV0000_CTRL_CMD_OS_UNIX_GET_EXPORT_OBJECT_INFO = 0x3d08
+)
+
+// HasFrontendFD is a type constraint for control parameter structs containing
+// a frontend device file descriptor. This is necessary because, as of this
+// writing (Go 1.20), there is no way to enable field access using a Go type
+// constraint.
+type HasFrontendFD interface {
+	GetFrontendFD() int32
+	SetFrontendFD(int32)
+}
+
+// NV0000_CTRL_OS_UNIX_EXPORT_OBJECT_TYPE_RM is the only supported value of
+// NV0000_CTRL_OS_UNIX_EXPORT_OBJECT.Type.
+const NV0000_CTRL_OS_UNIX_EXPORT_OBJECT_TYPE_RM = 1
+
+// NV0000_OS_UNIX_EXPORT_OBJECT_FD_BUFFER_SIZE is the size of
+// NV0000_CTRL_OS_UNIX_GET_EXPORT_OBJECT_INFO_PARAMS.Metadata.
+const NV0000_OS_UNIX_EXPORT_OBJECT_FD_BUFFER_SIZE = 64
+
+// NV0000_CTRL_OS_UNIX_EXPORT_OBJECT identifies an RM object to be exported.
+// Data is a union whose only member is the (hDevice, hParent, hObject)
+// triple used by NV0000_CTRL_OS_UNIX_EXPORT_OBJECT_TYPE_RM.
+//
+// +marshal
+type NV0000_CTRL_OS_UNIX_EXPORT_OBJECT struct {
+	Type    uint32
+	HDevice Handle
+	HParent Handle
+	HObject Handle
+}
+
+// +marshal
+type NV0000_CTRL_OS_UNIX_EXPORT_OBJECT_TO_FD_PARAMS struct {
+	Object NV0000_CTRL_OS_UNIX_EXPORT_OBJECT
+	FD     int32
+	Flags  uint32
+}
+
+// GetFrontendFD implements HasFrontendFD.GetFrontendFD.
+func (p *NV0000_CTRL_OS_UNIX_EXPORT_OBJECT_TO_FD_PARAMS) GetFrontendFD() int32 {
+	return p.FD
+}
+
+// SetFrontendFD implements HasFrontendFD.SetFrontendFD.
+func (p *NV0000_CTRL_OS_UNIX_EXPORT_OBJECT_TO_FD_PARAMS) SetFrontendFD(fd int32) {
+	p.FD = fd
+}
+
+// +marshal
+type NV0000_CTRL_OS_UNIX_IMPORT_OBJECT_FROM_FD_PARAMS struct {
+	FD     int32
+	Object NV0000_CTRL_OS_UNIX_EXPORT_OBJECT
+}
+
+// GetFrontendFD implements HasFrontendFD.GetFrontendFD.
+func (p *NV0000_CTRL_OS_UNIX_IMPORT_OBJECT_FROM_FD_PARAMS) GetFrontendFD() int32 {
+	return p.FD
+}
+
+// SetFrontendFD implements HasFrontendFD.SetFrontendFD.
+func (p *NV0000_CTRL_OS_UNIX_IMPORT_OBJECT_FROM_FD_PARAMS) SetFrontendFD(fd int32) {
+	p.FD = fd
+}
+
+// +marshal
+type NV0000_CTRL_OS_UNIX_GET_EXPORT_OBJECT_INFO_PARAMS struct {
+	FD             int32
+	DeviceInstance uint32
+	MaxObjects     uint16
+	Metadata       [NV0000_OS_UNIX_EXPORT_OBJECT_FD_BUFFER_SIZE]uint8
+	Pad            [2]byte
+}
+
+// GetFrontendFD implements HasFrontendFD.GetFrontendFD.
+func (p *NV0000_CTRL_OS_UNIX_GET_EXPORT_OBJECT_INFO_PARAMS) GetFrontendFD() int32 {
+	return p.FD
+}
+
+// SetFrontendFD implements HasFrontendFD.SetFrontendFD.
+func (p *NV0000_CTRL_OS_UNIX_GET_EXPORT_OBJECT_INFO_PARAMS) SetFrontendFD(fd int32) {
+	p.FD = fd
+}
+
+// From src/common/sdk/nvidia/inc/ctrl/ctrl0080/ctrl0080bsp.h:
+const (
+	NV0080_CTRL_CMD_BSP_GET_CAPS_V2 = 0x801c02
+)
+
 // From src/common/sdk/nvidia/inc/ctrl/ctrl0080/ctrl0080fb.h:
 const (
 	NV0080_CTRL_CMD_FB_GET_CAPS_V2 = 0x801307
@@ -159,12 +267,51 @@ const (
 	NV2080_CTRL_CMD_GPU_ACQUIRE_COMPUTE_MODE_RESERVATION = 0x20800145 // undocumented; paramSize == 0
 	NV2080_CTRL_CMD_GPU_RELEASE_COMPUTE_MODE_RESERVATION = 0x20800146 // undocumented; paramSize == 0
 	NV2080_CTRL_CMD_GPU_GET_GID_INFO                     = 0x2080014a
+	NV2080_CTRL_CMD_GPU_GET_ENCODER_CAPACITY             = 0x2080016c
+	NV2080_CTRL_CMD_GPU_GET_NVENC_SW_SESSION_STATS       = 0x2080016d
 	NV2080_CTRL_CMD_GPU_GET_ENGINES_V2                   = 0x20800170
 	NV2080_CTRL_CMD_GPU_GET_ACTIVE_PARTITION_IDS         = 0x2080018b
 	NV2080_CTRL_CMD_GPU_GET_COMPUTE_POLICY_CONFIG        = 0x20800195
 	NV2080_CTRL_CMD_GET_GPU_FABRIC_PROBE_INFO            = 0x208001a3
 )
 
+// NV2080_GPU_MAX_NAME_STRING_LENGTH is the length of the ASCII name string
+// returned by NV2080_CTRL_CMD_GPU_GET_NAME_STRING.
+const NV2080_GPU_MAX_NAME_STRING_LENGTH = 0x40
+
+// NV2080_CTRL_GPU_GET_NAME_STRING_PARAMS is the param type for
+// NV2080_CTRL_CMD_GPU_GET_NAME_STRING, with the name string returned in ASCII
+// (NV2080_CTRL_GPU_GET_NAME_STRING_FLAGS_TYPE_ASCII) rather than UTF-16.
+//
+// +marshal
+type NV2080_CTRL_GPU_GET_NAME_STRING_PARAMS struct {
+	GpuNameStringFlags uint32
+	GpuNameString      [128]byte // union of [NV2080_GPU_MAX_NAME_STRING_LENGTH]byte and [NV2080_GPU_MAX_NAME_STRING_LENGTH]uint16
+}
+
+// NV2080_CTRL_GPU_GET_NAME_STRING_FLAGS_TYPE_ASCII requests the name string in
+// ASCII.
+const NV2080_CTRL_GPU_GET_NAME_STRING_FLAGS_TYPE_ASCII = 0
+
+// NV2080_GPU_MAX_GID_LENGTH is the maximum length of the GPU ID returned by
+// NV2080_CTRL_CMD_GPU_GET_GID_INFO.
+const NV2080_GPU_MAX_GID_LENGTH = 0x100
+
+// NV2080_CTRL_GPU_GET_GID_INFO_PARAMS is the param type for
+// NV2080_CTRL_CMD_GPU_GET_GID_INFO.
+//
+// +marshal
+type NV2080_CTRL_GPU_GET_GID_INFO_PARAMS struct {
+	Index  uint32
+	Flags  uint32
+	Length uint32
+	Data   [NV2080_GPU_MAX_GID_LENGTH]byte
+}
+
+// NV2080_GPU_CMD_GPU_GET_GID_FLAGS_FORMAT_ASCII requests the GPU ID as an
+// ASCII UUID string ("GPU-...").
+const NV2080_GPU_CMD_GPU_GET_GID_FLAGS_FORMAT_ASCII = 0
+
 // From src/common/sdk/nvidia/inc/ctrl/ctrl2080/ctrl2080gr.h:
 const (
 	NV2080_CTRL_CMD_GR_GET_INFO                  = 0x20801201
@@ -253,3 +400,27 @@ const (
 	NVA06C_CTRL_CMD_SET_TIMESLICE   = 0xa06c0103
 	NVA06C_CTRL_CMD_PREEMPT         = 0xa06c0105
 )
+
+// From src/common/sdk/nvidia/inc/ctrl/ctrla0bc.h:
+const (
+	NVA0BC_CTRL_CMD_NVENC_SW_SESSION_UPDATE_INFO = 0xa0bc0101
+
+	NVA0BC_MAX_BUFFERED_TIMESTAMPS = 60
+)
+
+// +marshal
+type NVA0BC_CTRL_NVENC_TIMESTAMP struct {
+	StartTime uint64
+	EndTime   uint64
+}
+
+// +marshal
+type NVA0BC_CTRL_NVENC_SW_SESSION_UPDATE_INFO_PARAMS struct {
+	HResolution          uint32
+	VResolution          uint32
+	AverageEncodeLatency uint32
+	AverageEncodeFps     uint32
+	TimestampBufferSize  uint32 // in elements
+	Pad                  [4]byte
+	TimestampBuffer      P64
+}
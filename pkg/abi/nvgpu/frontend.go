@@ -50,9 +50,47 @@ const (
 	NV_ESC_RM_UPDATE_DEVICE_MAPPING_INFO = 0x5e
 )
 
+// NV_MAX_DEVICES is the maximum number of GPUs supported by the driver, from
+// kernel-open/common/inc/nv.h.
+const NV_MAX_DEVICES = 32
+
 // Frontend ioctl parameter structs, from src/common/sdk/nvidia/inc/nvos.h or
 // kernel-open/common/inc/nv-ioctl.h.
 
+// PCIInfo is nv_pci_info_t.
+//
+// +marshal
+type PCIInfo struct {
+	Domain   uint32
+	Bus      uint8
+	Slot     uint8
+	Function uint8
+	Pad0     uint8
+	VendorID uint16
+	DeviceID uint16
+}
+
+// IoctlCardInfo is nv_ioctl_card_info_t, the parameter type for
+// NV_ESC_CARD_INFO. The driver fills an array of these, one per GPU, up to
+// the length implied by the ioctl's argument size.
+//
+// +marshal
+type IoctlCardInfo struct {
+	Valid         uint8
+	Pad0          [3]byte
+	PCIInfo       PCIInfo
+	GPUID         uint32
+	InterruptLine uint16
+	Pad1          [2]byte
+	RegAddress    uint64
+	RegSize       uint64
+	FBAddress     uint64
+	FBSize        uint64
+	MinorNumber   uint32
+	DevName       [10]byte
+	Pad2          [2]byte
+}
+
 // IoctlRegisterFD is nv_ioctl_register_fd_t, the parameter type for
 // NV_ESC_REGISTER_FD.
 //
@@ -259,6 +297,16 @@ const (
 	NVOS32_FUNCTION_ALLOC_SIZE = 2
 )
 
+// Fields of NVOS32AllocSize.Attr:
+const (
+	NVOS32_ATTR_LOCATION_SHIFT = 25
+	NVOS32_ATTR_LOCATION_MASK  = 0x3
+
+	NVOS32_ATTR_LOCATION_VIDMEM = 0
+	NVOS32_ATTR_LOCATION_PCI    = 1
+	NVOS32_ATTR_LOCATION_ANY    = 3
+)
+
 // NVOS32AllocSize is the type of NVOS32Parameters.Data for
 // NVOS32_FUNCTION_ALLOC_SIZE.
 type NVOS32AllocSize struct {
@@ -16,6 +16,7 @@ package nvgpu
 
 // Status codes, from src/common/sdk/nvidia/inc/nvstatuscodes.h.
 const (
+	NV_OK                  = 0x00000000
 	NV_ERR_INVALID_ADDRESS = 0x0000001e
 	NV_ERR_INVALID_LIMIT   = 0x0000002e
 	NV_ERR_NOT_SUPPORTED   = 0x00000056
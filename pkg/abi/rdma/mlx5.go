@@ -0,0 +1,102 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdma
+
+// Driver data of mlx5 uverbs commands, from include/uapi/rdma/mlx5-abi.h.
+// Older user-space providers may pass shorter structures; only the leading
+// fields are guaranteed to be present.
+
+// Sizes of mlx5 work queue entries, from drivers/infiniband/hw/mlx5.
+const (
+	// MLX5_SEND_WQE_BB is the size of a send queue basic block.
+	MLX5_SEND_WQE_BB = 64
+
+	// MLX5_SRQ_WQE_MIN_SIZE is the minimum size of a shared receive queue
+	// entry, and MLX5_SRQ_WQE_SEG_SIZE is the size of struct
+	// mlx5_wqe_srq_next_seg and of struct mlx5_wqe_data_seg.
+	MLX5_SRQ_WQE_MIN_SIZE = 32
+	MLX5_SRQ_WQE_SEG_SIZE = 16
+)
+
+// MLX5IBCreateCQ is struct mlx5_ib_create_cq.
+//
+// +marshal
+type MLX5IBCreateCQ struct {
+	BufAddr          uint64
+	DBAddr           uint64
+	CQESize          uint32
+	CQECompEn        uint8
+	CQECompResFormat uint8
+	Flags            uint16
+	UARPageIndex     uint16
+	Reserved0        uint16
+	Reserved1        uint32
+}
+
+// MLX5IBResizeCQ is struct mlx5_ib_resize_cq.
+//
+// +marshal
+type MLX5IBResizeCQ struct {
+	BufAddr   uint64
+	CQESize   uint16
+	Reserved0 uint16
+	Reserved1 uint32
+}
+
+// MLX5IBCreateSRQ is struct mlx5_ib_create_srq.
+//
+// +marshal
+type MLX5IBCreateSRQ struct {
+	BufAddr   uint64
+	DBAddr    uint64
+	Flags     uint32
+	Reserved0 uint32
+	UIDX      uint32
+	Reserved1 uint32
+}
+
+// MLX5IBCreateQP is struct mlx5_ib_create_qp.
+//
+// +marshal
+type MLX5IBCreateQP struct {
+	BufAddr    uint64
+	DBAddr     uint64
+	SQWQECount uint32
+	RQWQECount uint32
+	RQWQEShift uint32
+	Flags      uint32
+	UIDX       uint32
+	BFRegIndex uint32
+	SQBufAddr  uint64
+	ECEOptions uint32
+	Reserved   uint32
+}
+
+// MLX5IBCreateWQ is struct mlx5_ib_create_wq.
+//
+// +marshal
+type MLX5IBCreateWQ struct {
+	BufAddr                   uint64
+	DBAddr                    uint64
+	RQWQECount                uint32
+	RQWQEShift                uint32
+	UserIndex                 uint32
+	Flags                     uint32
+	CompMask                  uint32
+	SingleStrideLogNumOfBytes uint32
+	SingleWQELogNumOfStrides  uint16
+	TwoByteShiftEn            uint16
+	Pad                       uint32
+}
@@ -0,0 +1,29 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rdma contains definitions from the Linux RDMA user-space ABI,
+// include/uapi/rdma.
+package rdma
+
+// Device numbers of uverbs devices, from drivers/infiniband/core/uverbs_main.c.
+// Minor numbers beyond IB_UVERBS_NUM_FIXED_MINOR are dynamically allocated.
+const (
+	IB_UVERBS_MAJOR           = 231
+	IB_UVERBS_BASE_MINOR      = 192
+	IB_UVERBS_NUM_FIXED_MINOR = 32
+)
+
+// IB_USER_VERBS_ABI_VERSION is the version of the uverbs write() ABI, as
+// reported by /sys/class/infiniband_verbs/abi_version.
+const IB_USER_VERBS_ABI_VERSION = 6
@@ -0,0 +1,431 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdma
+
+// Legacy uverbs commands, from include/uapi/rdma/ib_user_verbs.h: enum
+// ib_uverbs_write_cmds.
+const (
+	IB_USER_VERBS_CMD_GET_CONTEXT         = 0
+	IB_USER_VERBS_CMD_QUERY_DEVICE        = 1
+	IB_USER_VERBS_CMD_QUERY_PORT          = 2
+	IB_USER_VERBS_CMD_ALLOC_PD            = 3
+	IB_USER_VERBS_CMD_DEALLOC_PD          = 4
+	IB_USER_VERBS_CMD_CREATE_AH           = 5
+	IB_USER_VERBS_CMD_MODIFY_AH           = 6
+	IB_USER_VERBS_CMD_QUERY_AH            = 7
+	IB_USER_VERBS_CMD_DESTROY_AH          = 8
+	IB_USER_VERBS_CMD_REG_MR              = 9
+	IB_USER_VERBS_CMD_REG_SMR             = 10
+	IB_USER_VERBS_CMD_REREG_MR            = 11
+	IB_USER_VERBS_CMD_QUERY_MR            = 12
+	IB_USER_VERBS_CMD_DEREG_MR            = 13
+	IB_USER_VERBS_CMD_ALLOC_MW            = 14
+	IB_USER_VERBS_CMD_BIND_MW             = 15
+	IB_USER_VERBS_CMD_DEALLOC_MW          = 16
+	IB_USER_VERBS_CMD_CREATE_COMP_CHANNEL = 17
+	IB_USER_VERBS_CMD_CREATE_CQ           = 18
+	IB_USER_VERBS_CMD_RESIZE_CQ           = 19
+	IB_USER_VERBS_CMD_DESTROY_CQ          = 20
+	IB_USER_VERBS_CMD_POLL_CQ             = 21
+	IB_USER_VERBS_CMD_PEEK_CQ             = 22
+	IB_USER_VERBS_CMD_REQ_NOTIFY_CQ       = 23
+	IB_USER_VERBS_CMD_CREATE_QP           = 24
+	IB_USER_VERBS_CMD_QUERY_QP            = 25
+	IB_USER_VERBS_CMD_MODIFY_QP           = 26
+	IB_USER_VERBS_CMD_DESTROY_QP          = 27
+	IB_USER_VERBS_CMD_POST_SEND           = 28
+	IB_USER_VERBS_CMD_POST_RECV           = 29
+	IB_USER_VERBS_CMD_ATTACH_MCAST        = 30
+	IB_USER_VERBS_CMD_DETACH_MCAST        = 31
+	IB_USER_VERBS_CMD_CREATE_SRQ          = 32
+	IB_USER_VERBS_CMD_MODIFY_SRQ          = 33
+	IB_USER_VERBS_CMD_QUERY_SRQ           = 34
+	IB_USER_VERBS_CMD_DESTROY_SRQ         = 35
+	IB_USER_VERBS_CMD_POST_SRQ_RECV       = 36
+	IB_USER_VERBS_CMD_OPEN_XRCD           = 37
+	IB_USER_VERBS_CMD_CLOSE_XRCD          = 38
+	IB_USER_VERBS_CMD_CREATE_XSRQ         = 39
+	IB_USER_VERBS_CMD_OPEN_QP             = 40
+)
+
+// Extended uverbs commands, from include/uapi/rdma/ib_user_verbs.h.
+const (
+	IB_USER_VERBS_EX_CMD_QUERY_DEVICE        = IB_USER_VERBS_CMD_QUERY_DEVICE
+	IB_USER_VERBS_EX_CMD_CREATE_CQ           = IB_USER_VERBS_CMD_CREATE_CQ
+	IB_USER_VERBS_EX_CMD_CREATE_QP           = IB_USER_VERBS_CMD_CREATE_QP
+	IB_USER_VERBS_EX_CMD_MODIFY_QP           = IB_USER_VERBS_CMD_MODIFY_QP
+	IB_USER_VERBS_EX_CMD_CREATE_FLOW         = IB_USER_VERBS_CMD_THRESHOLD
+	IB_USER_VERBS_EX_CMD_DESTROY_FLOW        = 51
+	IB_USER_VERBS_EX_CMD_CREATE_WQ           = 52
+	IB_USER_VERBS_EX_CMD_MODIFY_WQ           = 53
+	IB_USER_VERBS_EX_CMD_DESTROY_WQ          = 54
+	IB_USER_VERBS_EX_CMD_CREATE_RWQ_IND_TBL  = 55
+	IB_USER_VERBS_EX_CMD_DESTROY_RWQ_IND_TBL = 56
+	IB_USER_VERBS_EX_CMD_MODIFY_CQ           = 57
+)
+
+// IB_USER_VERBS_CMD_THRESHOLD is the first extended command number that has
+// no legacy counterpart.
+const IB_USER_VERBS_CMD_THRESHOLD = 50
+
+// Fields of IBUverbsCmdHdr.Command.
+const (
+	IB_USER_VERBS_CMD_COMMAND_MASK  = 0xff
+	IB_USER_VERBS_CMD_FLAG_EXTENDED = 0x80
+	IB_USER_VERBS_CMD_FLAGS_SHIFT   = 24
+)
+
+// Memory region access flags, from include/rdma/ib_verbs.h: enum
+// ib_access_flags.
+const (
+	IB_ACCESS_LOCAL_WRITE   = 1 << 0
+	IB_ACCESS_REMOTE_WRITE  = 1 << 1
+	IB_ACCESS_REMOTE_READ   = 1 << 2
+	IB_ACCESS_REMOTE_ATOMIC = 1 << 3
+	IB_ACCESS_MW_BIND       = 1 << 4
+	IB_ZERO_BASED           = 1 << 5
+	IB_ACCESS_ON_DEMAND     = 1 << 6
+)
+
+// Flags for IBUverbsReregMR.Flags, from include/rdma/ib_verbs.h: enum
+// ib_mr_rereg_flags.
+const (
+	IB_MR_REREG_TRANS  = 1 << 0
+	IB_MR_REREG_PD     = 1 << 1
+	IB_MR_REREG_ACCESS = 1 << 2
+)
+
+// QP types, from include/uapi/rdma/ib_user_verbs.h: enum ib_uverbs_qp_type.
+const (
+	IB_UVERBS_QPT_RC         = 2
+	IB_UVERBS_QPT_UC         = 3
+	IB_UVERBS_QPT_UD         = 4
+	IB_UVERBS_QPT_RAW_PACKET = 8
+	IB_UVERBS_QPT_XRC_INI    = 9
+	IB_UVERBS_QPT_XRC_TGT    = 10
+	IB_UVERBS_QPT_DRIVER     = 0xff
+)
+
+// Bits in IBUverbsExCreateQP.CompMask.
+const (
+	IB_UVERBS_CREATE_QP_MASK_IND_TABLE = 1 << 0
+)
+
+// Bits in IBUverbsModifySRQ.AttrMask, from include/rdma/ib_verbs.h: enum
+// ib_srq_attr_mask.
+const (
+	IB_SRQ_MAX_WR = 1 << 0
+	IB_SRQ_LIMIT  = 1 << 1
+)
+
+// IBUverbsCmdHdr is struct ib_uverbs_cmd_hdr, which begins every command
+// written to a uverbs device.
+//
+// +marshal
+type IBUverbsCmdHdr struct {
+	Command  uint32
+	InWords  uint16
+	OutWords uint16
+}
+
+// IBUverbsExCmdHdr is struct ib_uverbs_ex_cmd_hdr, which follows
+// IBUverbsCmdHdr in extended commands.
+//
+// +marshal
+type IBUverbsExCmdHdr struct {
+	Response         uint64
+	ProviderInWords  uint16
+	ProviderOutWords uint16
+	CmdHdrReserved   uint32
+}
+
+// IBUverbsGetContextResp is struct ib_uverbs_get_context_resp.
+//
+// +marshal
+type IBUverbsGetContextResp struct {
+	AsyncFD        uint32
+	NumCompVectors uint32
+}
+
+// IBUverbsCreateCompChannelResp is struct ib_uverbs_create_comp_channel_resp.
+//
+// +marshal
+type IBUverbsCreateCompChannelResp struct {
+	FD uint32
+}
+
+// IBUverbsRegMR is struct ib_uverbs_reg_mr.
+//
+// +marshal
+type IBUverbsRegMR struct {
+	Response    uint64
+	Start       uint64
+	Length      uint64
+	HCAVA       uint64
+	PDHandle    uint32
+	AccessFlags uint32
+}
+
+// IBUverbsRegMRResp is struct ib_uverbs_reg_mr_resp.
+//
+// +marshal
+type IBUverbsRegMRResp struct {
+	MRHandle uint32
+	LKey     uint32
+	RKey     uint32
+}
+
+// IBUverbsReregMR is struct ib_uverbs_rereg_mr.
+//
+// +marshal
+type IBUverbsReregMR struct {
+	Response    uint64
+	MRHandle    uint32
+	Flags       uint32
+	Start       uint64
+	Length      uint64
+	HCAVA       uint64
+	PDHandle    uint32
+	AccessFlags uint32
+}
+
+// IBUverbsDeregMR is struct ib_uverbs_dereg_mr.
+//
+// +marshal
+type IBUverbsDeregMR struct {
+	MRHandle uint32
+}
+
+// IBUverbsCreateCQ is struct ib_uverbs_create_cq.
+//
+// +marshal
+type IBUverbsCreateCQ struct {
+	Response    uint64
+	UserHandle  uint64
+	CQE         uint32
+	CompVector  uint32
+	CompChannel int32
+	Reserved    uint32
+}
+
+// IBUverbsExCreateCQ is struct ib_uverbs_ex_create_cq.
+//
+// +marshal
+type IBUverbsExCreateCQ struct {
+	UserHandle  uint64
+	CQE         uint32
+	CompVector  uint32
+	CompChannel int32
+	CompMask    uint32
+	Flags       uint32
+	Reserved    uint32
+}
+
+// IBUverbsCreateCQResp is struct ib_uverbs_create_cq_resp. It is also the
+// beginning of struct ib_uverbs_ex_create_cq_resp.
+//
+// +marshal
+type IBUverbsCreateCQResp struct {
+	CQHandle uint32
+	CQE      uint32
+}
+
+// IBUverbsResizeCQ is struct ib_uverbs_resize_cq.
+//
+// +marshal
+type IBUverbsResizeCQ struct {
+	Response uint64
+	CQHandle uint32
+	CQE      uint32
+}
+
+// IBUverbsDestroyCQ is struct ib_uverbs_destroy_cq.
+//
+// +marshal
+type IBUverbsDestroyCQ struct {
+	Response uint64
+	CQHandle uint32
+	Reserved uint32
+}
+
+// IBUverbsCreateQP is struct ib_uverbs_create_qp.
+//
+// +marshal
+type IBUverbsCreateQP struct {
+	Response      uint64
+	UserHandle    uint64
+	PDHandle      uint32
+	SendCQHandle  uint32
+	RecvCQHandle  uint32
+	SRQHandle     uint32
+	MaxSendWR     uint32
+	MaxRecvWR     uint32
+	MaxSendSGE    uint32
+	MaxRecvSGE    uint32
+	MaxInlineData uint32
+	SQSigAll      uint8
+	QPType        uint8
+	IsSRQ         uint8
+	Reserved      uint8
+}
+
+// IBUverbsExCreateQP is struct ib_uverbs_ex_create_qp.
+//
+// +marshal
+type IBUverbsExCreateQP struct {
+	UserHandle      uint64
+	PDHandle        uint32
+	SendCQHandle    uint32
+	RecvCQHandle    uint32
+	SRQHandle       uint32
+	MaxSendWR       uint32
+	MaxRecvWR       uint32
+	MaxSendSGE      uint32
+	MaxRecvSGE      uint32
+	MaxInlineData   uint32
+	SQSigAll        uint8
+	QPType          uint8
+	IsSRQ           uint8
+	Reserved        uint8
+	CompMask        uint32
+	CreateFlags     uint32
+	RWQIndTblHandle uint32
+	SourceQPN       uint32
+}
+
+// IBUverbsCreateQPResp is struct ib_uverbs_create_qp_resp. It is also the
+// beginning of struct ib_uverbs_ex_create_qp_resp.
+//
+// +marshal
+type IBUverbsCreateQPResp struct {
+	QPHandle      uint32
+	QPN           uint32
+	MaxSendWR     uint32
+	MaxRecvWR     uint32
+	MaxSendSGE    uint32
+	MaxRecvSGE    uint32
+	MaxInlineData uint32
+	Reserved      uint32
+}
+
+// IBUverbsDestroyQP is struct ib_uverbs_destroy_qp.
+//
+// +marshal
+type IBUverbsDestroyQP struct {
+	Response uint64
+	QPHandle uint32
+	Reserved uint32
+}
+
+// IBUverbsCreateSRQ is struct ib_uverbs_create_srq.
+//
+// +marshal
+type IBUverbsCreateSRQ struct {
+	Response   uint64
+	UserHandle uint64
+	PDHandle   uint32
+	MaxWR      uint32
+	MaxSGE     uint32
+	SRQLimit   uint32
+}
+
+// IBUverbsCreateXSRQ is struct ib_uverbs_create_xsrq.
+//
+// +marshal
+type IBUverbsCreateXSRQ struct {
+	Response   uint64
+	UserHandle uint64
+	SRQType    uint32
+	PDHandle   uint32
+	MaxWR      uint32
+	MaxSGE     uint32
+	SRQLimit   uint32
+	MaxNumTags uint32
+	XRCDHandle uint32
+	CQHandle   uint32
+}
+
+// IBUverbsCreateSRQResp is struct ib_uverbs_create_srq_resp.
+//
+// +marshal
+type IBUverbsCreateSRQResp struct {
+	SRQHandle uint32
+	MaxWR     uint32
+	MaxSGE    uint32
+	SRQN      uint32
+}
+
+// IBUverbsModifySRQ is struct ib_uverbs_modify_srq.
+//
+// +marshal
+type IBUverbsModifySRQ struct {
+	SRQHandle uint32
+	AttrMask  uint32
+	MaxWR     uint32
+	SRQLimit  uint32
+}
+
+// IBUverbsDestroySRQ is struct ib_uverbs_destroy_srq.
+//
+// +marshal
+type IBUverbsDestroySRQ struct {
+	Response  uint64
+	SRQHandle uint32
+	Reserved  uint32
+}
+
+// IBUverbsOpenXRCD is struct ib_uverbs_open_xrcd.
+//
+// +marshal
+type IBUverbsOpenXRCD struct {
+	Response uint64
+	FD       uint32
+	OFlags   uint32
+}
+
+// IBUverbsExCreateWQ is struct ib_uverbs_ex_create_wq.
+//
+// +marshal
+type IBUverbsExCreateWQ struct {
+	CompMask    uint32
+	WQType      uint32
+	UserHandle  uint64
+	PDHandle    uint32
+	CQHandle    uint32
+	MaxWR       uint32
+	MaxSGE      uint32
+	CreateFlags uint32
+	Reserved    uint32
+}
+
+// IBUverbsExCreateWQResp is struct ib_uverbs_ex_create_wq_resp.
+//
+// +marshal
+type IBUverbsExCreateWQResp struct {
+	CompMask       uint32
+	ResponseLength uint32
+	WQHandle       uint32
+	MaxWR          uint32
+	MaxSGE         uint32
+	WQN            uint32
+}
+
+// IBUverbsExDestroyWQ is struct ib_uverbs_ex_destroy_wq.
+//
+// +marshal
+type IBUverbsExDestroyWQ struct {
+	CompMask uint32
+	WQHandle uint32
+}
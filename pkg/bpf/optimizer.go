@@ -15,9 +15,26 @@
 package bpf
 
 // optimizerFunc is a function type that can optimize a BPF program.
-// It returns the updated set of instructions, along with whether any
-// modification was made.
-type optimizerFunc func(insns []Instruction) ([]Instruction, bool)
+// It returns whether any modification was made.
+type optimizerFunc func(p *optimizerProgram) bool
+
+// optimizerProgram is a BPF program being optimized.
+type optimizerProgram struct {
+	// insns are the instructions of the program.
+	insns []Instruction
+
+	// origins holds, for each instruction in insns, the index of the
+	// instruction it originates from in the unoptimized program.
+	origins []int
+}
+
+// remove removes the instruction at index pc, and rewrites the jumps that
+// straddled over it.
+func (p *optimizerProgram) remove(pc int) {
+	p.insns = append(p.insns[:pc], p.insns[pc+1:]...)
+	p.origins = append(p.origins[:pc], p.origins[pc+1:]...)
+	decrementJumps(p.insns, pc)
+}
 
 // optimizeConditionalJumps looks for conditional jumps which go to an
 // unconditional jump that goes to a final target fewer than 256 instructions
@@ -25,7 +42,8 @@ type optimizerFunc func(insns []Instruction) ([]Instruction, bool)
 // These can safely be rewritten to not require the extra unconditional jump.
 // It returns the optimized set of instructions, along with whether any change
 // was made.
-func optimizeConditionalJumps(insns []Instruction) ([]Instruction, bool) {
+func optimizeConditionalJumps(p *optimizerProgram) bool {
+	insns := p.insns
 	changed := false
 	for pc, ins := range insns {
 		if !ins.IsConditionalJump() {
@@ -57,7 +75,7 @@ func optimizeConditionalJumps(insns []Instruction) ([]Instruction, bool) {
 		}
 		insns[pc] = ins
 	}
-	return insns, changed
+	return changed
 }
 
 // optimizeSameTargetConditionalJumps looks for conditional jumps where both
@@ -67,7 +85,8 @@ func optimizeConditionalJumps(insns []Instruction) ([]Instruction, bool) {
 // indirect jumps ends up at the same place.
 // It returns the optimized set of instructions, along with whether any change
 // was made.
-func optimizeSameTargetConditionalJumps(insns []Instruction) ([]Instruction, bool) {
+func optimizeSameTargetConditionalJumps(p *optimizerProgram) bool {
+	insns := p.insns
 	changed := false
 	for pc, ins := range insns {
 		if !ins.IsConditionalJump() {
@@ -79,12 +98,13 @@ func optimizeSameTargetConditionalJumps(insns []Instruction) ([]Instruction, boo
 		insns[pc] = Jump(Jmp|Ja, uint32(ins.JumpIfTrue), 0, 0)
 		changed = true
 	}
-	return insns, changed
+	return changed
 }
 
 // optimizeUnconditionalJumps looks for conditional jumps which go to another
 // unconditional jump.
-func optimizeUnconditionalJumps(insns []Instruction) ([]Instruction, bool) {
+func optimizeUnconditionalJumps(p *optimizerProgram) bool {
+	insns := p.insns
 	changed := false
 	for pc, ins := range insns {
 		if !ins.IsUnconditionalJump() {
@@ -106,7 +126,7 @@ func optimizeUnconditionalJumps(insns []Instruction) ([]Instruction, bool) {
 		insns[pc] = ins
 		changed = true
 	}
-	return insns, changed
+	return changed
 }
 
 // decrementJumps decrements all jumps within `insns` that are jumping to an
@@ -144,22 +164,21 @@ func decrementJumps(insns []Instruction, target int) {
 // removeZeroInstructionJumps removes unconditional jumps that jump zero
 // instructions forward. This may seem silly but it can happen due to other
 // optimizations in this file which decrement jump target indexes.
-func removeZeroInstructionJumps(insns []Instruction) ([]Instruction, bool) {
+func removeZeroInstructionJumps(p *optimizerProgram) bool {
 	changed := false
-	for pc := 0; pc < len(insns); pc++ {
-		ins := insns[pc]
+	for pc := 0; pc < len(p.insns); pc++ {
+		ins := p.insns[pc]
 		if !ins.IsUnconditionalJump() || ins.K != 0 {
 			continue
 		}
-		insns = append(insns[:pc], insns[pc+1:]...)
-		decrementJumps(insns, pc)
+		p.remove(pc)
 		changed = true
 
 		// Rewind back one instruction, in case the instruction now at `pc`
 		// is also a zero-instruction unconditional jump.
 		pc--
 	}
-	return insns, changed
+	return changed
 }
 
 // removeDeadCode removes instructions which are unreachable.
@@ -167,9 +186,10 @@ func removeZeroInstructionJumps(insns []Instruction) ([]Instruction, bool) {
 // e.g. optimizeConditionalJumps.
 // In addition, removing dead code means the program is shorter,
 // which in turn may make further jump optimizations possible.
-func removeDeadCode(insns []Instruction) ([]Instruction, bool) {
+func removeDeadCode(p *optimizerProgram) bool {
+	insns := p.insns
 	if len(insns) == 0 {
-		return insns, false
+		return false
 	}
 
 	// Keep track of which lines are reachable from all instructions in the program.
@@ -213,11 +233,9 @@ func removeDeadCode(insns []Instruction) ([]Instruction, bool) {
 	// And finally cull unreachable code.
 	for u := 0; u < len(unreachable); u++ {
 		i := unreachable[u]
-		// Remove the instruction at this index:
-		insns = append(insns[:i], insns[i+1:]...)
-
-		// Rewrite all previous jumps which would have straddled over this instruction:
-		decrementJumps(insns, i)
+		// Remove the instruction at this index, and rewrite all previous jumps
+		// which would have straddled over it:
+		p.remove(i)
 
 		// And decrement all future unreachable indexes, since we just shortened `insns` by one:
 		for u2 := u + 1; u2 < len(unreachable); u2++ {
@@ -225,12 +243,13 @@ func removeDeadCode(insns []Instruction) ([]Instruction, bool) {
 		}
 	}
 
-	return insns, len(unreachable) > 0
+	return len(unreachable) > 0
 }
 
 // optimizeJumpsToReturn replaces unconditional jumps that go to return
 // statements by a copy of that return statement.
-func optimizeJumpsToReturn(insns []Instruction) ([]Instruction, bool) {
+func optimizeJumpsToReturn(p *optimizerProgram) bool {
+	insns := p.insns
 	changed := false
 	for pc, ins := range insns {
 		if !ins.IsUnconditionalJump() {
@@ -243,7 +262,7 @@ func optimizeJumpsToReturn(insns []Instruction) ([]Instruction, bool) {
 		insns[pc] = targetIns
 		changed = true
 	}
-	return insns, changed
+	return changed
 }
 
 // Optimize losslessly optimizes a BPF program using the given optimization
@@ -255,15 +274,34 @@ func optimizeJumpsToReturn(insns []Instruction) ([]Instruction, bool) {
 // The BPF instructions are assumed to have been checked for validity and
 // consistency.
 // The instructions in `insns` may be modified in-place.
-func optimize(insns []Instruction, funcs []optimizerFunc) []Instruction {
+// It returns the optimized instructions, along with the index in `insns` of
+// the instruction each of them originates from.
+func optimize(insns []Instruction, funcs []optimizerFunc) ([]Instruction, []int) {
+	p := &optimizerProgram{
+		insns:   insns,
+		origins: make([]int, len(insns)),
+	}
+	for i := range p.origins {
+		p.origins[i] = i
+	}
 	for changed := true; changed; {
 		for _, fn := range funcs {
-			if insns, changed = fn(insns); changed {
+			if changed = fn(p); changed {
 				break
 			}
 		}
 	}
-	return insns
+	return p.insns, p.origins
+}
+
+// optimizers is the list of optimizers used by Optimize.
+var optimizers = []optimizerFunc{
+	optimizeConditionalJumps,
+	optimizeSameTargetConditionalJumps,
+	optimizeUnconditionalJumps,
+	optimizeJumpsToReturn,
+	removeZeroInstructionJumps,
+	removeDeadCode,
 }
 
 // Optimize losslessly optimizes a BPF program.
@@ -271,12 +309,14 @@ func optimize(insns []Instruction, funcs []optimizerFunc) []Instruction {
 // consistency.
 // The instructions in `insns` may be modified in-place.
 func Optimize(insns []Instruction) []Instruction {
-	return optimize(insns, []optimizerFunc{
-		optimizeConditionalJumps,
-		optimizeSameTargetConditionalJumps,
-		optimizeUnconditionalJumps,
-		optimizeJumpsToReturn,
-		removeZeroInstructionJumps,
-		removeDeadCode,
-	})
+	insns, _ = optimize(insns, optimizers)
+	return insns
+}
+
+// OptimizeWithOrigins is like Optimize, but also returns, for each of the
+// optimized instructions, the index of the instruction of `insns` it
+// originates from. This allows metadata about the unoptimized program to be
+// carried over to the optimized one.
+func OptimizeWithOrigins(insns []Instruction) ([]Instruction, []int) {
+	return optimize(insns, optimizers)
 }
@@ -189,7 +189,7 @@ func TestOptimize(t *testing.T) {
 			optimizedInsns := make([]Instruction, len(test.insns))
 			copy(optimizedInsns, test.insns)
 			if len(test.optimizers) > 0 {
-				optimizedInsns = optimize(optimizedInsns, test.optimizers)
+				optimizedInsns, _ = optimize(optimizedInsns, test.optimizers)
 			} else {
 				optimizedInsns = Optimize(optimizedInsns)
 			}
@@ -199,3 +199,30 @@ func TestOptimize(t *testing.T) {
 		})
 	}
 }
+
+func TestOptimizeWithOrigins(t *testing.T) {
+	insns := []Instruction{
+		Stmt(Ld|Imm|W, 42),
+		Jump(Jmp|Jeq|K, 42, 0, 1),
+		Jump(Jmp|Ja, 1, 0, 0),
+		Jump(Jmp|Ja, 2, 0, 0),
+		Stmt(Ld|Imm|W, 37),
+		Stmt(Ret|K, 0),
+		Stmt(Ret|K, 1),
+	}
+	want := []Instruction{
+		Stmt(Ld|Imm|W, 42),
+		Jump(Jmp|Jeq|K, 42, 0, 2),
+		Stmt(Ld|Imm|W, 37),
+		Stmt(Ret|K, 0),
+		Stmt(Ret|K, 1),
+	}
+	wantOrigins := []int{0, 1, 4, 5, 6}
+	optimizedInsns, origins := OptimizeWithOrigins(insns)
+	if !reflect.DeepEqual(optimizedInsns, want) {
+		t.Errorf("got optimized instructions:\n%v\nwant:\n%v\n", prettyInstructions(optimizedInsns), prettyInstructions(want))
+	}
+	if !reflect.DeepEqual(origins, wantOrigins) {
+		t.Errorf("got origins %v, want %v", origins, wantOrigins)
+	}
+}
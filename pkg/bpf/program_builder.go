@@ -243,6 +243,13 @@ func (f ProgramFragment) String() string {
 	return fmt.Sprintf("fromPC=%d toPC=%d", f.fromPC, f.toPC)
 }
 
+// Range returns the index of the first recorded instruction, and the index
+// after the last recorded instruction. These indexes are the same in the
+// program returned by `ProgramBuilder.Instructions`.
+func (f ProgramFragment) Range() (fromPC, toPC int) {
+	return f.fromPC, f.toPC
+}
+
 // FragmentOutcomes represents the set of outcomes that a ProgramFragment
 // execution may result into.
 type FragmentOutcomes struct {
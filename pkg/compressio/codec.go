@@ -0,0 +1,123 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compressio
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Codec compresses and decompresses individual chunks of a stream.
+//
+// The codec used to write a stream is not recorded in it; readers must be
+// created with the same codec.
+type Codec interface {
+	// Compress appends the compressed form of src to dst.
+	Compress(dst *bytes.Buffer, src []byte) error
+
+	// Decompress appends the decompressed form of src to dst. It returns an
+	// error if the decompressed form is larger than limit bytes.
+	Decompress(dst *bytes.Buffer, src []byte, limit int) error
+}
+
+// errChunkTooLarge is returned when a chunk decompresses to more than the
+// chunk size of the stream.
+var errChunkTooLarge = errors.New("decompressed chunk exceeds chunk size")
+
+// flateCodec is a Codec using DEFLATE (RFC 1951).
+type flateCodec struct {
+	level int
+}
+
+// Flate returns a Codec that uses DEFLATE with the given compression level,
+// as defined by package compress/flate. The level is ignored when
+// decompressing.
+func Flate(level int) Codec {
+	return flateCodec{level: level}
+}
+
+// Compress implements Codec.Compress.
+func (c flateCodec) Compress(dst *bytes.Buffer, src []byte) error {
+	fw, err := flate.NewWriter(dst, c.level)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(src); err != nil {
+		return err
+	}
+	return fw.Close()
+}
+
+// Decompress implements Codec.Decompress.
+func (flateCodec) Decompress(dst *bytes.Buffer, src []byte, limit int) error {
+	fr := flate.NewReader(bytes.NewReader(src))
+	n, err := io.Copy(dst, io.LimitReader(fr, int64(limit)+1))
+	if err != nil {
+		return err
+	}
+	if n > int64(limit) {
+		return errChunkTooLarge
+	}
+	return nil
+}
+
+// lz4Codec is a Codec using the LZ4 block format.
+type lz4Codec struct{}
+
+// LZ4 is a Codec that uses the LZ4 block format. It compresses less than
+// DEFLATE, but is several times faster in both directions.
+//
+// Each compressed chunk is the 4-byte big endian length of the uncompressed
+// data, followed by a single LZ4 block.
+var LZ4 Codec = lz4Codec{}
+
+// Compress implements Codec.Compress.
+func (lz4Codec) Compress(dst *bytes.Buffer, src []byte) error {
+	s := lz4ScratchPool.Get().(*lz4Scratch)
+	defer lz4ScratchPool.Put(s)
+	s.out = binary.BigEndian.AppendUint32(s.out[:0], uint32(len(src)))
+	s.out = lz4Compress(s.out, src, &s.table)
+	_, err := dst.Write(s.out)
+	return err
+}
+
+// Decompress implements Codec.Decompress.
+func (lz4Codec) Decompress(dst *bytes.Buffer, src []byte, limit int) error {
+	if len(src) < 4 {
+		return io.ErrUnexpectedEOF
+	}
+	size := int(binary.BigEndian.Uint32(src))
+	if size > limit {
+		return errChunkTooLarge
+	}
+	s := lz4ScratchPool.Get().(*lz4Scratch)
+	defer lz4ScratchPool.Put(s)
+	if cap(s.out) < size {
+		s.out = make([]byte, 0, size)
+	}
+	out, err := lz4Decompress(s.out[:0], src[4:], size)
+	if err != nil {
+		return err
+	}
+	if len(out) != size {
+		return fmt.Errorf("lz4: decompressed %d bytes, expected %d", len(out), size)
+	}
+	_, err = dst.Write(out)
+	return err
+}
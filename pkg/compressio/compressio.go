@@ -42,11 +42,13 @@
 //
 // so the stream integrity cannot be compromised by switching and mixing
 // compressed chunks.
+//
+// Each chunk is compressed independently with a Codec, which is DEFLATE unless
+// the stream was created with NewWriterWithCodec.
 package compressio
 
 import (
 	"bytes"
-	"compress/flate"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/binary"
@@ -137,8 +139,9 @@ type worker struct {
 	scratch [4]byte
 }
 
-// work is the main work routine; see worker.
-func (w *worker) work(compress bool, level int) {
+// work is the main work routine; see worker. Decompressed chunks may not be
+// larger than chunkSize.
+func (w *worker) work(compress bool, codec Codec, chunkSize uint32) {
 	defer close(w.output)
 
 	var h hash.Hash
@@ -148,30 +151,15 @@ func (w *worker) work(compress bool, level int) {
 			h = w.hashPool.getHash()
 		}
 		if compress {
-			mw := io.Writer(c.compressed)
-			if h != nil {
-				mw = io.MultiWriter(mw, h)
-			}
-
-			// Encode this slice.
-			fw, err := flate.NewWriter(mw, level)
-			if err != nil {
-				w.output <- result{c, err}
-				continue
-			}
-
 			// Encode the input.
-			if _, err := io.CopyN(fw, c.uncompressed, int64(c.uncompressed.Len())); err != nil {
-				w.output <- result{c, err}
-				continue
-			}
-			if err := fw.Close(); err != nil {
+			if err := codec.Compress(c.compressed, c.uncompressed.Bytes()); err != nil {
 				w.output <- result{c, err}
 				continue
 			}
 
 			// Write the hash, if enabled.
 			if h != nil {
+				h.Write(c.compressed.Bytes())
 				binary.BigEndian.PutUint32(w.scratch[:], uint32(c.compressed.Len()))
 				h.Write(w.scratch[:4])
 				c.h = h
@@ -193,11 +181,8 @@ func (w *worker) work(compress bool, level int) {
 				}
 			}
 
-			// Decode this slice.
-			fr := flate.NewReader(c.compressed)
-
 			// Decode the input.
-			if _, err := io.Copy(c.uncompressed, fr); err != nil {
+			if err := codec.Decompress(c.uncompressed, c.compressed.Bytes(), int(chunkSize)); err != nil {
 				w.output <- result{c, err}
 				continue
 			}
@@ -278,8 +263,8 @@ type pool struct {
 
 // init initializes the worker pool.
 //
-// This should only be called once.
-func (p *pool) init(key []byte, workers int, compress bool, level int) {
+// This should only be called once, after chunkSize is set.
+func (p *pool) init(key []byte, workers int, compress bool, codec Codec) {
 	if key != nil {
 		p.hashPool = &hashPool{key: key}
 	}
@@ -290,7 +275,7 @@ func (p *pool) init(key []byte, workers int, compress bool, level int) {
 			input:    make(chan *chunk, 1),
 			output:   make(chan result, 1),
 		}
-		go p.workers[i].work(compress, level) // S/R-SAFE: In save path only.
+		go p.workers[i].work(compress, codec, p.chunkSize) // S/R-SAFE: In save path only.
 	}
 	runtime.SetFinalizer(p, (*pool).stop)
 }
@@ -372,18 +357,24 @@ var _ io.Reader = (*Reader)(nil)
 // hash values computed from the compressed bytes. See package comments for
 // details.
 func NewReader(in io.Reader, key []byte) (*Reader, error) {
+	return NewReaderWithCodec(in, key, Flate(0))
+}
+
+// NewReaderWithCodec is like NewReader, but decompresses chunks with codec,
+// which must match the codec used to write the stream.
+func NewReaderWithCodec(in io.Reader, key []byte, codec Codec) (*Reader, error) {
 	r := &Reader{
 		in: in,
 	}
 
-	// Use double buffering for read.
-	r.init(key, 2*runtime.GOMAXPROCS(0), false, 0)
-
 	if _, err := io.ReadFull(in, r.scratch[:4]); err != nil {
 		return nil, err
 	}
 	r.chunkSize = binary.BigEndian.Uint32(r.scratch[:4])
 
+	// Use double buffering for read.
+	r.init(key, 2*runtime.GOMAXPROCS(0), false, codec)
+
 	if r.hashPool != nil {
 		h := r.hashPool.getHash()
 		binary.BigEndian.PutUint32(r.scratch[:], r.chunkSize)
@@ -601,6 +592,11 @@ var _ io.Writer = (*Writer)(nil)
 // buffered (in the form of read-ahead, or buffered writes), and is limited to
 // O(chunkSize * [1+GOMAXPROCS]).
 func NewWriter(out io.Writer, key []byte, chunkSize uint32, level int) (*Writer, error) {
+	return NewWriterWithCodec(out, key, chunkSize, Flate(level))
+}
+
+// NewWriterWithCodec is like NewWriter, but compresses chunks with codec.
+func NewWriterWithCodec(out io.Writer, key []byte, chunkSize uint32, codec Codec) (*Writer, error) {
 	w := &Writer{
 		pool: pool{
 			chunkSize: chunkSize,
@@ -608,7 +604,7 @@ func NewWriter(out io.Writer, key []byte, chunkSize uint32, level int) (*Writer,
 		},
 		out: out,
 	}
-	w.init(key, 1+runtime.GOMAXPROCS(0), true, level)
+	w.init(key, 1+runtime.GOMAXPROCS(0), true, codec)
 
 	binary.BigEndian.PutUint32(w.scratch[:], chunkSize)
 	if _, err := w.out.Write(w.scratch[:4]); err != nil {
@@ -211,6 +211,62 @@ func TestCompress(t *testing.T) {
 	}
 }
 
+func TestCompressLZ4(t *testing.T) {
+	data := initTest(t, 1024*1024)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 32*1024)
+	for _, data := range [][]byte{
+		data[:0],
+		data[:1],
+		data[:16],
+		data,
+		make([]byte, 1024*1024),
+		text,
+	} {
+		for _, blockSize := range []uint32{1024, 64 * 1024, 1024 * 1024} {
+			for _, key := range [][]byte{nil, hashKey} {
+				doTest(t, testOpts{
+					Name: fmt.Sprintf("len(data)=%d, blockSize=%d, key=%s, lz4", len(data), blockSize, string(key)),
+					Data: data,
+					NewWriter: func(b *bytes.Buffer) (io.Writer, error) {
+						return NewWriterWithCodec(b, key, blockSize, LZ4)
+					},
+					NewReader: func(b *bytes.Buffer) (io.Reader, error) {
+						return NewReaderWithCodec(b, key, LZ4)
+					},
+				})
+			}
+		}
+	}
+}
+
+func TestLZ4Corrupt(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	var compressed bytes.Buffer
+	if err := LZ4.Compress(&compressed, data); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	// Truncated and bit-flipped blocks must fail or decode to something
+	// within the limit; they must never panic.
+	for i := 0; i < compressed.Len(); i++ {
+		var out bytes.Buffer
+		if err := LZ4.Decompress(&out, compressed.Bytes()[:i], len(data)); err == nil {
+			t.Errorf("Decompress of %d/%d bytes succeeded", i, compressed.Len())
+		}
+		corrupt := append([]byte(nil), compressed.Bytes()...)
+		corrupt[i] ^= 0xff
+		out.Reset()
+		if err := LZ4.Decompress(&out, corrupt, len(data)); err == nil && out.Len() > len(data) {
+			t.Errorf("Decompress with byte %d flipped returned %d bytes", i, out.Len())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := LZ4.Decompress(&out, compressed.Bytes(), len(data)-1); err == nil {
+		t.Errorf("Decompress with limit %d succeeded", len(data)-1)
+	}
+}
+
 const (
 	benchDataSize = 600 * 1024 * 1024
 )
@@ -0,0 +1,226 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compressio
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// This file implements the LZ4 block format, as described in
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md.
+//
+// A block is a sequence of sequences, each consisting of a token, literals
+// copied verbatim, and a match copied from earlier output. The high 4 bits of
+// the token are the number of literals and the low 4 bits are the match
+// length minus lz4MinMatch; either is followed by extra length bytes if it's
+// 15. The match is given by a 2-byte little endian offset back from the end of
+// the output. The last sequence has only literals.
+
+const (
+	// lz4MinMatch is the minimum length of a match.
+	lz4MinMatch = 4
+
+	// lz4LastLiterals is the number of bytes at the end of a block that
+	// must be literals.
+	lz4LastLiterals = 5
+
+	// lz4MFLimit is the minimum distance between the start of a match and
+	// the end of the block.
+	lz4MFLimit = 12
+
+	// lz4MaxOffset is the maximum offset of a match.
+	lz4MaxOffset = 65535
+
+	// lz4HashLog is the log2 of the size of the compressor's hash table.
+	lz4HashLog = 14
+
+	// lz4SkipTrigger controls how quickly the compressor skips ahead in
+	// incompressible data.
+	lz4SkipTrigger = 6
+)
+
+// errLZ4Corrupt is returned when decompressing a malformed LZ4 block.
+var errLZ4Corrupt = errors.New("lz4: corrupt block")
+
+// lz4Scratch holds buffers reused across calls to lz4Codec methods.
+type lz4Scratch struct {
+	table [1 << lz4HashLog]int32
+	out   []byte
+}
+
+var lz4ScratchPool = sync.Pool{
+	New: func() any {
+		return new(lz4Scratch)
+	},
+}
+
+func lz4Hash(v uint32) uint32 {
+	return (v * 2654435761) >> (32 - lz4HashLog)
+}
+
+// lz4AppendLength appends the extra length bytes encoding n.
+func lz4AppendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4AppendSequence appends a sequence with the given literals and, if
+// matchLen is not zero, a match.
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	litLen := len(literals)
+	token := byte(15 << 4)
+	if litLen < 15 {
+		token = byte(litLen) << 4
+	}
+	if matchLen != 0 {
+		if matchLen-lz4MinMatch < 15 {
+			token |= byte(matchLen - lz4MinMatch)
+		} else {
+			token |= 15
+		}
+	}
+	dst = append(dst, token)
+	if litLen >= 15 {
+		dst = lz4AppendLength(dst, litLen-15)
+	}
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if matchLen-lz4MinMatch >= 15 {
+		dst = lz4AppendLength(dst, matchLen-lz4MinMatch-15)
+	}
+	return dst
+}
+
+// lz4Compress appends the LZ4 block encoding src to dst. table is used to
+// find matches; its initial contents don't affect correctness.
+func lz4Compress(dst, src []byte, table *[1 << lz4HashLog]int32) []byte {
+	anchor := 0
+	if len(src) > lz4MFLimit {
+		*table = [1 << lz4HashLog]int32{}
+		matchLimit := len(src) - lz4LastLiterals
+		for i, searched := 0, 0; i <= len(src)-lz4MFLimit; {
+			seq := binary.LittleEndian.Uint32(src[i:])
+			h := lz4Hash(seq)
+			cand := int(table[h])
+			table[h] = int32(i)
+			if cand >= i || i-cand > lz4MaxOffset || binary.LittleEndian.Uint32(src[cand:]) != seq {
+				// Skip ahead faster the longer no match is found.
+				searched++
+				i += 1 + searched>>lz4SkipTrigger
+				continue
+			}
+			searched = 0
+
+			// Extend the match forwards, then backwards.
+			matchLen := lz4MinMatch
+			for i+matchLen < matchLimit && src[cand+matchLen] == src[i+matchLen] {
+				matchLen++
+			}
+			for i > anchor && cand > 0 && src[i-1] == src[cand-1] {
+				i--
+				cand--
+				matchLen++
+			}
+
+			dst = lz4AppendSequence(dst, src[anchor:i], i-cand, matchLen)
+			i += matchLen
+			anchor = i
+		}
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4ReadLength reads extra length bytes from src at i, adding them to n.
+func lz4ReadLength(src []byte, i, n int) (int, int, error) {
+	for {
+		if i >= len(src) {
+			return 0, 0, errLZ4Corrupt
+		}
+		b := src[i]
+		i++
+		n += int(b)
+		if b != 255 {
+			return i, n, nil
+		}
+	}
+}
+
+// lz4Decompress appends the data encoded by the LZ4 block src to dst. It
+// returns an error if more than limit bytes would be appended.
+func lz4Decompress(dst, src []byte, limit int) ([]byte, error) {
+	base := len(dst)
+	for i := 0; ; {
+		if i >= len(src) {
+			return nil, errLZ4Corrupt
+		}
+		token := src[i]
+		i++
+
+		litLen := int(token >> 4)
+		if litLen == 15 {
+			var err error
+			if i, litLen, err = lz4ReadLength(src, i, litLen); err != nil {
+				return nil, err
+			}
+		}
+		if litLen > len(src)-i || litLen > limit-(len(dst)-base) {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+		if i == len(src) {
+			// The last sequence has no match.
+			return dst, nil
+		}
+
+		if len(src)-i < 2 {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		matchLen := int(token & 15)
+		if matchLen == 15 {
+			var err error
+			if i, matchLen, err = lz4ReadLength(src, i, matchLen); err != nil {
+				return nil, err
+			}
+		}
+		matchLen += lz4MinMatch
+		if offset == 0 || offset > len(dst)-base || matchLen > limit-(len(dst)-base) {
+			return nil, errLZ4Corrupt
+		}
+
+		// The match may overlap the bytes it produces, so copy it in
+		// pieces no longer than offset.
+		start := len(dst) - offset
+		for matchLen > 0 {
+			n := matchLen
+			if n > offset {
+				n = offset
+			}
+			dst = append(dst, dst[start:start+n]...)
+			start += n
+			matchLen -= n
+		}
+	}
+}
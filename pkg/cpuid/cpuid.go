@@ -158,6 +158,22 @@ func (fs FeatureSet) FlagString() string {
 	return strings.Join(s, " ")
 }
 
+// CPUInfoTopology is the position of a CPU in the CPU topology, as reported
+// in /proc/cpuinfo.
+type CPUInfoTopology struct {
+	// PhysicalID is the ID of the CPU's socket.
+	PhysicalID uint
+
+	// Siblings is the number of CPUs in the CPU's socket.
+	Siblings uint
+
+	// CoreID is the ID of the CPU's core within its socket.
+	CoreID uint
+
+	// CPUCores is the number of cores in the CPU's socket.
+	CPUCores uint
+}
+
 // ErrIncompatible is returned for incompatible feature sets.
 type ErrIncompatible struct {
 	reason string
@@ -308,7 +308,7 @@ func (fs FeatureSet) HasFeature(feature Feature) bool {
 // WriteCPUInfoTo is to generate a section of one cpu in /proc/cpuinfo. This is
 // a minimal /proc/cpuinfo, it is missing some fields like "microcode" that are
 // not always printed in Linux. The bogomips field is simply made up.
-func (fs FeatureSet) WriteCPUInfoTo(cpu uint, w io.Writer) {
+func (fs FeatureSet) WriteCPUInfoTo(cpu uint, topo CPUInfoTopology, w io.Writer) {
 	// Avoid many redunant calls here, since this can occasionally appear
 	// in the hot path. Read all basic information up front, see above.
 	ax, _, _, _ := fs.query(featureInfo)
@@ -318,9 +318,17 @@ func (fs FeatureSet) WriteCPUInfoTo(cpu uint, w io.Writer) {
 	fmt.Fprintf(w, "vendor_id\t: %s\n", string(vendor[:]))
 	fmt.Fprintf(w, "cpu family\t: %d\n", ((ef<<4)&0xff)|f)
 	fmt.Fprintf(w, "model\t\t: %d\n", ((em<<4)&0xff)|m)
-	fmt.Fprintf(w, "model name\t: %s\n", "unknown") // Unknown for now.
-	fmt.Fprintf(w, "stepping\t: %s\n", "unknown")   // Unknown for now.
+	modelName := fs.BrandString()
+	if modelName == "" {
+		modelName = "unknown"
+	}
+	fmt.Fprintf(w, "model name\t: %s\n", modelName)
+	fmt.Fprintf(w, "stepping\t: %s\n", "unknown") // Unknown for now.
 	fmt.Fprintf(w, "cpu MHz\t\t: %.3f\n", cpuFreqMHz)
+	fmt.Fprintf(w, "physical id\t: %d\n", topo.PhysicalID)
+	fmt.Fprintf(w, "siblings\t: %d\n", topo.Siblings)
+	fmt.Fprintf(w, "core id\t\t: %d\n", topo.CoreID)
+	fmt.Fprintf(w, "cpu cores\t: %d\n", topo.CPUCores)
 	fmt.Fprintf(w, "fpu\t\t: yes\n")
 	fmt.Fprintf(w, "fpu_exception\t: yes\n")
 	fmt.Fprintf(w, "cpuid level\t: %d\n", uint32(xSaveInfo)) // Same as ax in vendorID.
@@ -110,3 +110,61 @@ func TestRemove(t *testing.T) {
 		t.Errorf("Remove failed, got %q want %q", testFeatures.FlagString(), justFPU.FlagString())
 	}
 }
+
+func TestApplyPolicy(t *testing.T) {
+	fs := makeFeatureSet(X86FeatureFPU, X86FeatureXSAVE, X86FeatureSSE, X86FeatureSSE2, X86FeatureAVX, X86FeatureAVX2, X86FeatureAVX512F, X86FeatureAVX512BW, X86FeatureAES)
+
+	masked, err := fs.ApplyPolicy(Policy{MaskFeatures: []Feature{X86FeatureAVX512F}})
+	if err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+	for _, f := range []Feature{X86FeatureAVX512F, X86FeatureAVX512BW} {
+		if masked.HasFeature(f) {
+			t.Errorf("masked feature set %q has %v", masked.FlagString(), f)
+		}
+	}
+	for _, f := range []Feature{X86FeatureAVX, X86FeatureAVX2, X86FeatureAES} {
+		if !masked.HasFeature(f) {
+			t.Errorf("masked feature set %q doesn't have %v", masked.FlagString(), f)
+		}
+	}
+	if !fs.HasFeature(X86FeatureAVX512F) {
+		t.Errorf("ApplyPolicy changed the original feature set")
+	}
+
+	if _, err := fs.ApplyPolicy(Policy{MaskFeatures: []Feature{X86FeatureXSAVE}}); err == nil {
+		t.Errorf("ApplyPolicy masking XSAVE succeeded, want error")
+	}
+	if _, err := fs.ApplyPolicy(Policy{MicroarchLevel: "x86-64-v2"}); err == nil {
+		t.Errorf("ApplyPolicy with unsupported microarchitecture level succeeded, want error")
+	}
+	if _, err := fs.ApplyPolicy(Policy{MicroarchLevel: "x86-64-v5"}); err == nil {
+		t.Errorf("ApplyPolicy with invalid microarchitecture level succeeded, want error")
+	}
+
+	const brand = "Test CPU @ 1.00GHz"
+	branded, err := fs.ApplyPolicy(Policy{BrandString: brand})
+	if err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+	if got := branded.BrandString(); got != brand {
+		t.Errorf("BrandString got %q, want %q", got, brand)
+	}
+}
+
+func TestApplyPolicyMicroarchLevel(t *testing.T) {
+	hostFeatures := HostFeatureSet()
+	if !hostFeatures.HasFeature(X86FeatureAVX2) || !hostFeatures.HasFeature(X86FeatureBMI2) || !hostFeatures.HasFeature(X86FeatureMOVBE) {
+		t.Skip("host doesn't support x86-64-v3")
+	}
+	fs, err := hostFeatures.ApplyPolicy(Policy{MicroarchLevel: "x86-64-v3"})
+	if err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+	if fs.HasFeature(X86FeatureAVX512F) {
+		t.Errorf("x86-64-v3 feature set %q has AVX-512", fs.FlagString())
+	}
+	if !fs.HasFeature(X86FeatureAVX2) {
+		t.Errorf("x86-64-v3 feature set %q doesn't have AVX2", fs.FlagString())
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpuid
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy describes changes to the CPU features exposed to applications. It
+// allows sandboxes on heterogeneous hosts to see the same features, and to be
+// restored on any host that has the exposed features.
+//
+// A Policy only changes what applications observe, i.e. CPUID results
+// emulated by the sentry, /proc/cpuinfo and the auxiliary vector. It doesn't
+// prevent applications from using instructions for masked features.
+type Policy struct {
+	// MaskFeatures are features to hide, along with the features that depend
+	// on them.
+	MaskFeatures []Feature
+
+	// MicroarchLevel, if not empty, hides the features that are only part of
+	// higher microarchitecture levels, e.g. "x86-64-v3" hides AVX-512. The
+	// host must support all features of the level.
+	MicroarchLevel string
+
+	// BrandString, if not empty, replaces the processor brand string.
+	BrandString string
+}
+
+// IsEmpty returns true if p doesn't change anything.
+func (p *Policy) IsEmpty() bool {
+	return len(p.MaskFeatures) == 0 && p.MicroarchLevel == "" && p.BrandString == ""
+}
+
+// ParseFeatures parses a comma-separated list of feature names, as they
+// appear in /proc/cpuinfo.
+func ParseFeatures(s string) ([]Feature, error) {
+	var features []Feature
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		feature, ok := FeatureFromString(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown CPU feature %q", name)
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64
+// +build amd64
+
+package cpuid
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// maxBrandStringLen is the maximum length of the processor brand string,
+// which is stored in 48 bytes including a terminating NUL.
+const maxBrandStringLen = 47
+
+// featureDependents maps features to the features that depend on them, which
+// must be masked along with them. This is a subset of
+// arch/x86/kernel/cpu/cpuid-deps.c in Linux.
+var featureDependents = map[Feature][]Feature{
+	X86FeatureSSE:    {X86FeatureSSE2},
+	X86FeatureSSE2:   {X86FeatureSSE3},
+	X86FeatureSSE3:   {X86FeatureSSSE3},
+	X86FeatureSSSE3:  {X86FeatureSSE4_1},
+	X86FeatureSSE4_1: {X86FeatureSSE4_2},
+	X86FeatureSSE4_2: {X86FeatureAVX},
+	X86FeatureAVX: {
+		X86FeatureAVX2,
+		X86FeatureFMA,
+		X86FeatureF16C,
+		X86FeatureVAES,
+		X86FeatureVPCLMULQDQ,
+		X86FeatureAVX512F,
+	},
+	X86FeatureAVX512F: {
+		X86FeatureAVX512DQ,
+		X86FeatureAVX512PF,
+		X86FeatureAVX512ER,
+		X86FeatureAVX512CD,
+		X86FeatureAVX512BW,
+		X86FeatureAVX512VL,
+		X86FeatureAVX512VBMI,
+		X86FeatureAVX512_VBMI2,
+		X86FeatureAVX512_VNNI,
+		X86FeatureAVX512_BITALG,
+		X86FeatureAVX512_VPOPCNTDQ,
+	},
+}
+
+// unmaskableFeatures are features that the sentry relies on to manage
+// application state, and which therefore can't be masked.
+var unmaskableFeatures = map[Feature]struct{}{
+	X86FeatureFPU:      {},
+	X86FeatureFXSR:     {},
+	X86FeatureXSAVE:    {},
+	X86FeatureOSXSAVE:  {},
+	X86FeatureXSAVEOPT: {},
+	X86FeatureXSAVEC:   {},
+	X86FeatureXSAVES:   {},
+}
+
+// microarchLevels are the x86-64 microarchitecture levels defined by the
+// x86-64 psABI, and the features that they add to the previous level.
+// Features that can't be masked, i.e. XSAVE, are omitted.
+var microarchLevels = []struct {
+	name     string
+	features []Feature
+}{
+	{
+		name: "x86-64-v1",
+		features: []Feature{
+			X86FeatureCMOV, X86FeatureCX8, X86FeatureFPU, X86FeatureFXSR,
+			X86FeatureMMX, X86FeatureSYSCALL, X86FeatureSSE, X86FeatureSSE2,
+		},
+	},
+	{
+		name: "x86-64-v2",
+		features: []Feature{
+			X86FeatureCX16, X86FeatureLAHF64, X86FeaturePOPCNT, X86FeatureSSE3,
+			X86FeatureSSE4_1, X86FeatureSSE4_2, X86FeatureSSSE3,
+		},
+	},
+	{
+		name: "x86-64-v3",
+		features: []Feature{
+			X86FeatureAVX, X86FeatureAVX2, X86FeatureBMI1, X86FeatureBMI2,
+			X86FeatureF16C, X86FeatureFMA, X86FeatureLZCNT, X86FeatureMOVBE,
+		},
+	},
+	{
+		name: "x86-64-v4",
+		features: []Feature{
+			X86FeatureAVX512F, X86FeatureAVX512BW, X86FeatureAVX512CD,
+			X86FeatureAVX512DQ, X86FeatureAVX512VL,
+		},
+	},
+}
+
+// ApplyPolicy returns a copy of fs changed according to p.
+func (fs FeatureSet) ApplyPolicy(p Policy) (FeatureSet, error) {
+	if p.IsEmpty() {
+		return fs, nil
+	}
+	mask := append([]Feature(nil), p.MaskFeatures...)
+	if p.MicroarchLevel != "" {
+		found := false
+		for _, level := range microarchLevels {
+			if found {
+				mask = append(mask, level.features...)
+				continue
+			}
+			for _, feature := range level.features {
+				if !fs.HasFeature(feature) {
+					return FeatureSet{}, fmt.Errorf("microarchitecture level %s requires CPU feature %q, which is not supported", level.name, feature)
+				}
+			}
+			found = level.name == p.MicroarchLevel
+		}
+		if !found {
+			names := make([]string, 0, len(microarchLevels))
+			for _, level := range microarchLevels {
+				names = append(names, level.name)
+			}
+			return FeatureSet{}, fmt.Errorf("invalid microarchitecture level %q, must be one of: %s", p.MicroarchLevel, strings.Join(names, ", "))
+		}
+	}
+	if len(p.BrandString) > maxBrandStringLen {
+		return FeatureSet{}, fmt.Errorf("brand string %q is longer than %d bytes", p.BrandString, maxBrandStringLen)
+	}
+
+	s := fs.ToStatic()
+	for len(mask) != 0 {
+		feature := mask[len(mask)-1]
+		mask = mask[:len(mask)-1]
+		if _, ok := unmaskableFeatures[feature]; ok {
+			return FeatureSet{}, fmt.Errorf("CPU feature %q can't be masked", feature)
+		}
+		s.Remove(feature)
+		mask = append(mask, featureDependents[feature]...)
+	}
+	if p.BrandString != "" {
+		s.setBrandString(p.BrandString)
+	}
+	nfs := s.ToFeatureSet()
+	nfs.hwCap = fs.hwCap
+	return nfs, nil
+}
+
+// BrandString returns the processor brand string.
+func (fs FeatureSet) BrandString() string {
+	var b [48]byte
+	for i, fn := range []cpuidFunction{processorBrandString2, processorBrandString3, processorBrandString4} {
+		ax, bx, cx, dx := fs.query(fn)
+		for j, r := range []uint32{ax, bx, cx, dx} {
+			binary.LittleEndian.PutUint32(b[i*16+j*4:], r)
+		}
+	}
+	if i := strings.IndexByte(string(b[:]), 0); i >= 0 {
+		return strings.TrimSpace(string(b[:i]))
+	}
+	return strings.TrimSpace(string(b[:]))
+}
+
+// setBrandString sets the processor brand string.
+//
+// Preconditions: len(brand) <= maxBrandStringLen.
+func (s Static) setBrandString(brand string) {
+	var b [48]byte
+	copy(b[:], brand)
+	for i, fn := range []cpuidFunction{processorBrandString2, processorBrandString3, processorBrandString4} {
+		s[In{Eax: uint32(fn)}] = Out{
+			Eax: binary.LittleEndian.Uint32(b[i*16:]),
+			Ebx: binary.LittleEndian.Uint32(b[i*16+4:]),
+			Ecx: binary.LittleEndian.Uint32(b[i*16+8:]),
+			Edx: binary.LittleEndian.Uint32(b[i*16+12:]),
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build arm64
+// +build arm64
+
+package cpuid
+
+import "fmt"
+
+// ApplyPolicy returns a copy of fs changed according to p.
+//
+// Policies are not supported on arm64, where features are exposed through
+// HWCAPs rather than CPUID.
+func (fs FeatureSet) ApplyPolicy(p Policy) (FeatureSet, error) {
+	if !p.IsEmpty() {
+		return FeatureSet{}, fmt.Errorf("CPU feature policies are not supported on arm64")
+	}
+	return fs, nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ebpf implements loading, verification and interpretation of
+// extended BPF (eBPF) programs, and the maps they use. More information on
+// eBPF can be found in Linux's Documentation/bpf/instruction-set.rst.
+//
+// Only a subset of Linux's verifier is implemented. Programs are checked for
+// valid instructions, termination and initialized registers when loaded; the
+// memory safety of loads and stores is enforced by the interpreter when the
+// program runs.
+package ebpf
+
+import (
+	"fmt"
+)
+
+const (
+	// MaxInstructions is the maximum number of instructions in an eBPF
+	// program, and is equal to Linux's BPF_MAXINSNS.
+	MaxInstructions = 4096
+
+	// StackSize is the size of a program's stack in bytes, and is equal to
+	// Linux's MAX_BPF_STACK.
+	StackSize = 512
+
+	// numRegisters is the number of registers, R0 to R10.
+	numRegisters = 11
+
+	// framePointer is the read-only register that points to the top of the
+	// stack.
+	framePointer = 10
+)
+
+// Parts of a linux.EBPFInstruction.OpCode. Compare to Linux's
+// include/uapi/linux/bpf_common.h and include/uapi/linux/bpf.h.
+const (
+	// Instruction class, stored in bits 0-2.
+	Ld                   = 0x00
+	Ldx                  = 0x01
+	St                   = 0x02
+	Stx                  = 0x03
+	Alu                  = 0x04 // 32-bit arithmetic
+	Jmp                  = 0x05 // 64-bit comparisons
+	Jmp32                = 0x06 // 32-bit comparisons
+	Alu64                = 0x07 // 64-bit arithmetic
+	instructionClassMask = 0x07
+
+	// Size of a load or store, stored in bits 3-4.
+	W            = 0x00 // 32 bits
+	H            = 0x08 // 16 bits
+	B            = 0x10 // 8 bits
+	DW           = 0x18 // 64 bits
+	loadSizeMask = 0x18
+
+	// Mode of a load or store, stored in bits 5-7.
+	Imm          = 0x00 // 64-bit immediate, using two instructions
+	Abs          = 0x20 // packet data at offset imm
+	Ind          = 0x40 // packet data at offset src+imm
+	Mem          = 0x60 // memory at src+off (loads) or dst+off (stores)
+	Atomic       = 0xc0 // atomic add to memory at dst+off
+	loadModeMask = 0xe0
+
+	// Source operand for arithmetic and jump instructions, stored in bit 3.
+	K       = 0x00 // imm
+	X       = 0x08 // src register
+	srcMask = 0x08
+
+	// Arithmetic instructions, stored in bits 4-7.
+	Add     = 0x00
+	Sub     = 0x10
+	Mul     = 0x20
+	Div     = 0x30
+	Or      = 0x40
+	And     = 0x50
+	Lsh     = 0x60
+	Rsh     = 0x70
+	Neg     = 0x80
+	Mod     = 0x90
+	Xor     = 0xa0
+	Mov     = 0xb0
+	Arsh    = 0xc0
+	End     = 0xd0 // byte swap; the source bit selects big endian
+	aluMask = 0xf0
+
+	// Jump instructions, stored in bits 4-7.
+	Ja      = 0x00
+	Jeq     = 0x10
+	Jgt     = 0x20
+	Jge     = 0x30
+	Jset    = 0x40
+	Jne     = 0x50
+	Jsgt    = 0x60
+	Jsge    = 0x70
+	Call    = 0x80
+	Exit    = 0x90
+	Jlt     = 0xa0
+	Jle     = 0xb0
+	Jslt    = 0xc0
+	Jsle    = 0xd0
+	jmpMask = 0xf0
+)
+
+// Helper function IDs, from Linux's include/uapi/linux/bpf.h. These are the
+// helpers supported by the interpreter.
+const (
+	HelperMapLookupElem     = 1
+	HelperMapUpdateElem     = 2
+	HelperMapDeleteElem     = 3
+	HelperKtimeGetNS        = 5
+	HelperGetPrandomU32     = 7
+	HelperGetSMPProcessorID = 8
+	HelperSKBLoadBytes      = 26
+)
+
+// Possible values for Error.Code.
+const (
+	// InvalidInstructionCount indicates that a program has zero instructions
+	// or more than MaxInstructions instructions.
+	InvalidInstructionCount = iota
+
+	// InvalidOpcode indicates that a program contains an instruction with an
+	// invalid or unsupported opcode.
+	InvalidOpcode
+
+	// InvalidRegister indicates that a program contains a reference to a
+	// non-existent register, or a write to the frame pointer.
+	InvalidRegister
+
+	// InvalidJumpTarget indicates that a program contains a jump whose target
+	// is outside of the program's bounds, or into the middle of a 64-bit
+	// immediate load.
+	InvalidJumpTarget
+
+	// BackwardJump indicates that a program contains a jump to an earlier
+	// instruction. Programs must not contain loops.
+	BackwardJump
+
+	// UnreachableInstruction indicates that a program contains an
+	// instruction that can't be executed.
+	UnreachableInstruction
+
+	// UninitializedRegister indicates that a program may read a register
+	// before writing to it.
+	UninitializedRegister
+
+	// InvalidEndOfProgram indicates that execution may run past the last
+	// instruction of a program.
+	InvalidEndOfProgram
+
+	// DivisionByZero indicates that a program contains a division or modulo
+	// by the constant zero.
+	DivisionByZero
+
+	// InvalidHelper indicates that a program calls a helper function that is
+	// unknown or not available to the program's type.
+	InvalidHelper
+
+	// InvalidMap indicates that a program refers to a map that doesn't exist.
+	InvalidMap
+
+	// InvalidMemoryAccess indicates that a program executed a load or store
+	// outside of the memory it may access, or through a value that isn't a
+	// pointer.
+	InvalidMemoryAccess
+
+	// InvalidPointerArithmetic indicates that a program executed an operation
+	// on a pointer other than adding or subtracting a scalar.
+	InvalidPointerArithmetic
+
+	// InvalidHelperArgument indicates that a program passed an invalid
+	// argument to a helper function.
+	InvalidHelperArgument
+)
+
+// Error is an error encountered while loading or executing an eBPF program.
+type Error struct {
+	// Code indicates the kind of error that occurred.
+	Code int
+
+	// PC is the program counter (index into the list of instructions) at which
+	// the error occurred.
+	PC int
+}
+
+func (e Error) codeString() string {
+	switch e.Code {
+	case InvalidInstructionCount:
+		return "invalid number of instructions"
+	case InvalidOpcode:
+		return "invalid or unsupported instruction opcode"
+	case InvalidRegister:
+		return "invalid register"
+	case InvalidJumpTarget:
+		return "jump target out of bounds"
+	case BackwardJump:
+		return "back-edge jumps are not supported"
+	case UnreachableInstruction:
+		return "unreachable instruction"
+	case UninitializedRegister:
+		return "read of uninitialized register"
+	case InvalidEndOfProgram:
+		return "execution may fall off the end of the program"
+	case DivisionByZero:
+		return "division by zero"
+	case InvalidHelper:
+		return "invalid helper function call"
+	case InvalidMap:
+		return "invalid map reference"
+	case InvalidMemoryAccess:
+		return "invalid memory access"
+	case InvalidPointerArithmetic:
+		return "invalid pointer arithmetic"
+	case InvalidHelperArgument:
+		return "invalid helper function argument"
+	default:
+		return "unknown error"
+	}
+}
+
+// Error implements error.Error.
+func (e Error) Error() string {
+	return fmt.Sprintf("at insn %d: %s", e.PC, e.codeString())
+}
@@ -0,0 +1,702 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+// SKB is the input to programs of type linux.BPF_PROG_TYPE_SOCKET_FILTER and
+// linux.BPF_PROG_TYPE_CGROUP_SKB, which access it as a struct __sk_buff.
+// Fields of struct __sk_buff that aren't represented here read as zero.
+type SKB struct {
+	// Data is the packet, starting at the network header. Socket filters of
+	// TCP, UDP and ICMP sockets see the packet from the transport header
+	// instead.
+	Data []byte
+
+	// Protocol is the packet's ethertype, in network byte order.
+	Protocol uint16
+
+	// PktType is the packet type, one of linux.PACKET_*.
+	PktType uint32
+
+	// Mark is the packet's mark.
+	Mark uint32
+
+	// Priority is the packet's queueing priority.
+	Priority uint32
+
+	// Ifindex is the index of the interface the packet was received on or
+	// will be sent on.
+	Ifindex uint32
+
+	// Family is the address family of the associated socket.
+	Family uint32
+
+	// CB is scratch space shared by programs that run on the same packet.
+	CB [5]uint32
+}
+
+// Offsets of the fields of struct __sk_buff, from Linux's
+// include/uapi/linux/bpf.h.
+const (
+	skbLen            = 0
+	skbPktType        = 4
+	skbMark           = 8
+	skbProtocol       = 16
+	skbPriority       = 32
+	skbIngressIfindex = 36
+	skbIfindex        = 40
+	skbCB             = 48
+	skbCBEnd          = 68
+	skbData           = 76
+	skbDataEnd        = 80
+	skbFamily         = 88
+	skbSize           = 192
+)
+
+// Env provides the services used by helper functions.
+type Env interface {
+	// MonotonicNanoseconds returns the current time of CLOCK_MONOTONIC.
+	MonotonicNanoseconds() int64
+
+	// RandomUint32 returns a pseudo-random number.
+	RandomUint32() uint32
+}
+
+// regKind is the kind of value that a register holds.
+type regKind uint8
+
+const (
+	scalar regKind = iota
+	ctxPtr
+	stackPtr
+	packetPtr
+	mapValuePtr
+	mapPtr
+)
+
+// register is the value of an eBPF register. Pointers carry the memory they
+// point into, so that Exec can check every load and store.
+type register struct {
+	kind regKind
+
+	// val is the value of a scalar, or the offset of a pointer into mem.
+	val uint64
+
+	// mem is the memory that a stackPtr, packetPtr or mapValuePtr points into.
+	mem []byte
+
+	// m is the map that a mapPtr refers to.
+	m Map
+}
+
+// numeric returns the value of r used in comparisons. Pointers of different
+// kinds never compare equal, and are never equal to zero.
+func (r *register) numeric() uint64 {
+	if r.kind == scalar {
+		return r.val
+	}
+	return uint64(r.kind)<<48 + r.val
+}
+
+// machine is the state of a running program.
+type machine struct {
+	p    *Program
+	skb  *SKB
+	env  Env
+	regs [numRegisters]register
+
+	stack [StackSize]byte
+
+	// spills holds pointers stored to 8-byte aligned stack slots, which are
+	// restored by 64-bit loads from the same slot.
+	spills [StackSize / 8]register
+}
+
+// Exec runs a program of type linux.BPF_PROG_TYPE_SOCKET_FILTER or
+// linux.BPF_PROG_TYPE_CGROUP_SKB on a packet, and returns the value of R0 at
+// exit. Stores to the packet's mark, priority and scratch space are written
+// back to skb.
+//
+// Exec returns an Error if the program performs an invalid memory access or
+// pointer operation, which Linux's verifier would have rejected when the
+// program was loaded.
+func Exec(p *Program, skb *SKB, env Env) (uint64, error) {
+	m := machine{p: p, skb: skb, env: env}
+	m.regs[1] = register{kind: ctxPtr}
+	m.regs[framePointer] = register{kind: stackPtr, val: StackSize, mem: m.stack[:]}
+	for pc := 0; pc < len(p.insns); pc++ {
+		ins := p.insns[pc]
+		dst, src := &m.regs[ins.DstReg()], &m.regs[ins.SrcReg()]
+		switch ins.OpCode & instructionClassMask {
+		case Ld:
+			if ins.OpCode == Ld|Imm|DW {
+				if ins.SrcReg() == linux.BPF_PSEUDO_MAP_FD {
+					*dst = register{kind: mapPtr, m: p.maps[ins.Imm]}
+				} else {
+					*dst = register{val: uint64(uint32(ins.Imm)) | uint64(uint32(p.insns[pc+1].Imm))<<32}
+				}
+				pc++
+				continue
+			}
+			off := int64(ins.Imm)
+			if ins.OpCode&loadModeMask == Ind {
+				if src.kind != scalar {
+					return 0, Error{InvalidMemoryAccess, pc}
+				}
+				off += int64(int32(src.val))
+			}
+			if m.regs[6].kind != ctxPtr {
+				return 0, Error{InvalidMemoryAccess, pc}
+			}
+			v, ok := loadPacket(skb.Data, off, ins.OpCode&loadSizeMask)
+			if !ok {
+				// Like Linux, an out of bounds packet load terminates the
+				// program with a return value of 0.
+				return 0, nil
+			}
+			m.regs[0] = register{val: v}
+			m.clobber()
+
+		case Ldx:
+			v, err := m.load(src, ins.Offset, ins.OpCode&loadSizeMask, pc)
+			if err != nil {
+				return 0, err
+			}
+			*dst = v
+
+		case St:
+			if err := m.store(dst, ins.Offset, ins.OpCode&loadSizeMask, register{val: uint64(int64(ins.Imm))}, pc); err != nil {
+				return 0, err
+			}
+
+		case Stx:
+			size := ins.OpCode & loadSizeMask
+			if ins.OpCode&loadModeMask == Atomic {
+				if src.kind != scalar {
+					return 0, Error{InvalidPointerArithmetic, pc}
+				}
+				old, err := m.load(dst, ins.Offset, size, pc)
+				if err != nil {
+					return 0, err
+				}
+				if old.kind != scalar {
+					return 0, Error{InvalidPointerArithmetic, pc}
+				}
+				if err := m.store(dst, ins.Offset, size, register{val: old.val + src.val}, pc); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			if err := m.store(dst, ins.Offset, size, *src, pc); err != nil {
+				return 0, err
+			}
+
+		case Alu, Alu64:
+			operand := register{val: uint64(int64(ins.Imm))}
+			if ins.OpCode&srcMask == X {
+				operand = *src
+			}
+			if err := alu(ins, dst, operand, pc); err != nil {
+				return 0, err
+			}
+
+		case Jmp, Jmp32:
+			switch op := ins.OpCode & jmpMask; op {
+			case Exit:
+				if m.regs[0].kind != scalar {
+					return 0, Error{InvalidPointerArithmetic, pc}
+				}
+				return m.regs[0].val, nil
+			case Call:
+				if err := m.call(ins.Imm, pc); err != nil {
+					return 0, err
+				}
+				m.clobber()
+			case Ja:
+				pc += int(ins.Offset)
+			default:
+				operand := uint64(int64(ins.Imm))
+				if ins.OpCode&srcMask == X {
+					operand = src.numeric()
+				}
+				if compare(op, dst.numeric(), operand, ins.OpCode&instructionClassMask == Jmp32) {
+					pc += int(ins.Offset)
+				}
+			}
+		}
+	}
+	// Load ensures that execution can't fall off the end of the program.
+	panic("unreachable")
+}
+
+// clobber resets the registers that helper calls and packet loads don't
+// preserve.
+func (m *machine) clobber() {
+	for i := 1; i <= 5; i++ {
+		m.regs[i] = register{}
+	}
+}
+
+// loadPacket loads a big-endian value of the given size from data at off.
+func loadPacket(data []byte, off int64, size uint8) (uint64, bool) {
+	n := int64(sizeBytes(size))
+	if off < 0 || off+n > int64(len(data)) {
+		return 0, false
+	}
+	b := data[off : off+n]
+	switch size {
+	case W:
+		return uint64(binary.BigEndian.Uint32(b)), true
+	case H:
+		return uint64(binary.BigEndian.Uint16(b)), true
+	default:
+		return uint64(b[0]), true
+	}
+}
+
+func sizeBytes(size uint8) int {
+	switch size {
+	case W:
+		return 4
+	case H:
+		return 2
+	case B:
+		return 1
+	default:
+		return 8
+	}
+}
+
+// memory returns the n bytes at offset off from pointer r.
+func (m *machine) memory(r *register, off int16, n int, write bool, pc int) ([]byte, error) {
+	switch r.kind {
+	case stackPtr, mapValuePtr:
+	case packetPtr:
+		if write {
+			return nil, Error{InvalidMemoryAccess, pc}
+		}
+	default:
+		return nil, Error{InvalidMemoryAccess, pc}
+	}
+	base := int64(r.val)
+	if base < -maxPointerOffset || base > maxPointerOffset {
+		return nil, Error{InvalidMemoryAccess, pc}
+	}
+	// base and off are bounded, so addr can't overflow.
+	addr := base + int64(off)
+	if addr < 0 || addr > int64(len(r.mem)) || int64(n) > int64(len(r.mem))-addr {
+		return nil, Error{InvalidMemoryAccess, pc}
+	}
+	return r.mem[addr : addr+int64(n)], nil
+}
+
+// load implements a load of the given size from r+off.
+func (m *machine) load(r *register, off int16, size uint8, pc int) (register, error) {
+	n := sizeBytes(size)
+	if r.kind == ctxPtr {
+		return m.loadContext(int64(r.val)+int64(off), n, pc)
+	}
+	b, err := m.memory(r, off, n, false, pc)
+	if err != nil {
+		return register{}, err
+	}
+	if r.kind == stackPtr && n == 8 {
+		if addr := int64(r.val) + int64(off); addr%8 == 0 {
+			if spill := m.spills[addr/8]; spill.kind != scalar {
+				return spill, nil
+			}
+		}
+	}
+	switch n {
+	case 8:
+		return register{val: hostarch.ByteOrder.Uint64(b)}, nil
+	case 4:
+		return register{val: uint64(hostarch.ByteOrder.Uint32(b))}, nil
+	case 2:
+		return register{val: uint64(hostarch.ByteOrder.Uint16(b))}, nil
+	default:
+		return register{val: uint64(b[0])}, nil
+	}
+}
+
+// store implements a store of v of the given size to r+off.
+func (m *machine) store(r *register, off int16, size uint8, v register, pc int) error {
+	n := sizeBytes(size)
+	if r.kind == ctxPtr {
+		if v.kind != scalar {
+			return Error{InvalidMemoryAccess, pc}
+		}
+		return m.storeContext(int64(r.val)+int64(off), n, uint32(v.val), pc)
+	}
+	b, err := m.memory(r, off, n, true, pc)
+	if err != nil {
+		return err
+	}
+	if r.kind == stackPtr {
+		addr := int64(r.val) + int64(off)
+		// Any store invalidates the pointers spilled to the slots it
+		// overlaps.
+		for slot := addr / 8; slot <= (addr+int64(n)-1)/8; slot++ {
+			m.spills[slot] = register{}
+		}
+		if v.kind != scalar {
+			// Pointers may only be spilled to aligned stack slots.
+			if n != 8 || addr%8 != 0 {
+				return Error{InvalidMemoryAccess, pc}
+			}
+			m.spills[addr/8] = v
+			hostarch.ByteOrder.PutUint64(b, v.numeric())
+			return nil
+		}
+	} else if v.kind != scalar {
+		return Error{InvalidMemoryAccess, pc}
+	}
+	switch n {
+	case 8:
+		hostarch.ByteOrder.PutUint64(b, v.val)
+	case 4:
+		hostarch.ByteOrder.PutUint32(b, uint32(v.val))
+	case 2:
+		hostarch.ByteOrder.PutUint16(b, uint16(v.val))
+	default:
+		b[0] = uint8(v.val)
+	}
+	return nil
+}
+
+// loadContext implements a load of n bytes from offset off of struct
+// __sk_buff.
+func (m *machine) loadContext(off int64, n int, pc int) (register, error) {
+	if off < 0 || off+int64(n) > skbSize || off%int64(n) != 0 {
+		return register{}, Error{InvalidMemoryAccess, pc}
+	}
+	if off == skbData || off == skbDataEnd {
+		// Direct packet access is only available to CGROUP_SKB programs.
+		if m.p.progType != linux.BPF_PROG_TYPE_CGROUP_SKB || n != 4 {
+			return register{}, Error{InvalidMemoryAccess, pc}
+		}
+		r := register{kind: packetPtr, mem: m.skb.Data}
+		if off == skbDataEnd {
+			r.val = uint64(len(m.skb.Data))
+		}
+		return r, nil
+	}
+	if n != 4 {
+		return register{}, Error{InvalidMemoryAccess, pc}
+	}
+	var v uint32
+	switch {
+	case off == skbLen:
+		v = uint32(len(m.skb.Data))
+	case off == skbPktType:
+		v = m.skb.PktType
+	case off == skbMark:
+		v = m.skb.Mark
+	case off == skbProtocol:
+		v = uint32(m.skb.Protocol)
+	case off == skbPriority:
+		v = m.skb.Priority
+	case off == skbIngressIfindex, off == skbIfindex:
+		v = m.skb.Ifindex
+	case off >= skbCB && off < skbCBEnd:
+		v = m.skb.CB[(off-skbCB)/4]
+	case off == skbFamily:
+		v = m.skb.Family
+	}
+	return register{val: uint64(v)}, nil
+}
+
+// storeContext implements a store of n bytes to offset off of struct
+// __sk_buff.
+func (m *machine) storeContext(off int64, n int, v uint32, pc int) error {
+	if n != 4 || off%4 != 0 {
+		return Error{InvalidMemoryAccess, pc}
+	}
+	switch {
+	case off >= skbCB && off < skbCBEnd:
+		m.skb.CB[(off-skbCB)/4] = v
+	case off == skbMark && m.p.progType == linux.BPF_PROG_TYPE_CGROUP_SKB:
+		m.skb.Mark = v
+	case off == skbPriority && m.p.progType == linux.BPF_PROG_TYPE_CGROUP_SKB:
+		m.skb.Priority = v
+	default:
+		return Error{InvalidMemoryAccess, pc}
+	}
+	return nil
+}
+
+// alu implements arithmetic instructions.
+func alu(ins linux.EBPFInstruction, dst *register, operand register, pc int) error {
+	op := ins.OpCode & aluMask
+	is64 := ins.OpCode&instructionClassMask == Alu64
+	if op == Mov {
+		if !is64 {
+			if operand.kind != scalar {
+				return Error{InvalidPointerArithmetic, pc}
+			}
+			operand.val = uint64(uint32(operand.val))
+		}
+		*dst = operand
+		return nil
+	}
+	if dst.kind != scalar || operand.kind != scalar {
+		return pointerArithmetic(op, is64, dst, operand, pc)
+	}
+	a, b := dst.val, operand.val
+	if !is64 {
+		a, b = uint64(uint32(a)), uint64(uint32(b))
+	}
+	var r uint64
+	switch op {
+	case Add:
+		r = a + b
+	case Sub:
+		r = a - b
+	case Mul:
+		r = a * b
+	case Div:
+		// Like Linux, division by zero results in zero.
+		if b != 0 {
+			r = a / b
+		}
+	case Mod:
+		// Like Linux, modulo by zero leaves the destination unchanged.
+		r = a
+		if b != 0 {
+			r = a % b
+		}
+	case Or:
+		r = a | b
+	case And:
+		r = a & b
+	case Xor:
+		r = a ^ b
+	case Lsh:
+		if is64 {
+			r = a << (b & 63)
+		} else {
+			r = a << (b & 31)
+		}
+	case Rsh:
+		if is64 {
+			r = a >> (b & 63)
+		} else {
+			r = a >> (b & 31)
+		}
+	case Arsh:
+		if is64 {
+			r = uint64(int64(a) >> (b & 63))
+		} else {
+			r = uint64(uint32(int32(a) >> (b & 31)))
+		}
+	case Neg:
+		r = -a
+	case End:
+		r = byteSwap(a, ins.Imm, ins.OpCode&srcMask == X)
+		is64 = true
+	}
+	if !is64 {
+		r = uint64(uint32(r))
+	}
+	dst.val = r
+	return nil
+}
+
+// maxPointerOffset is the maximum magnitude of the offset of a pointer into
+// its memory, as in Linux's kernel/bpf/verifier.c:BPF_MAX_VAR_OFF.
+const maxPointerOffset = 1 << 29
+
+// pointerArithmetic implements the arithmetic that is allowed on pointers:
+// adding a scalar to a pointer, subtracting a scalar from a pointer, and
+// subtracting two pointers into the same memory. The resulting pointer's
+// offset must be within maxPointerOffset of the start of its memory.
+func pointerArithmetic(op uint8, is64 bool, dst *register, operand register, pc int) error {
+	if !is64 {
+		return Error{InvalidPointerArithmetic, pc}
+	}
+	switch {
+	case op == Add && dst.kind != scalar && operand.kind == scalar:
+		dst.val += operand.val
+	case op == Add && dst.kind == scalar && operand.kind != scalar:
+		operand.val += dst.val
+		*dst = operand
+	case op == Sub && dst.kind != scalar && operand.kind == scalar:
+		dst.val -= operand.val
+	case op == Sub && dst.kind == operand.kind && dst.kind != mapPtr && dst.kind != ctxPtr && sameMemory(dst.mem, operand.mem):
+		*dst = register{val: dst.val - operand.val}
+	default:
+		return Error{InvalidPointerArithmetic, pc}
+	}
+	if dst.kind == mapPtr || dst.kind == ctxPtr && dst.val != 0 {
+		// Map pointers can't be offset, and context accesses must use
+		// constant offsets from the context pointer.
+		return Error{InvalidPointerArithmetic, pc}
+	}
+	if off := int64(dst.val); dst.kind != scalar && (off < -maxPointerOffset || off > maxPointerOffset) {
+		return Error{InvalidPointerArithmetic, pc}
+	}
+	return nil
+}
+
+func sameMemory(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// byteSwap implements the End instruction, which converts the low size bits
+// of v between host byte order and little or big endian.
+func byteSwap(v uint64, size int32, toBigEndian bool) uint64 {
+	var buf [8]byte
+	order := binary.ByteOrder(binary.LittleEndian)
+	if toBigEndian {
+		order = binary.BigEndian
+	}
+	switch size {
+	case 16:
+		order.PutUint16(buf[:], uint16(v))
+		return uint64(hostarch.ByteOrder.Uint16(buf[:]))
+	case 32:
+		order.PutUint32(buf[:], uint32(v))
+		return uint64(hostarch.ByteOrder.Uint32(buf[:]))
+	default:
+		order.PutUint64(buf[:], v)
+		return hostarch.ByteOrder.Uint64(buf[:])
+	}
+}
+
+// compare evaluates the condition of a conditional jump.
+func compare(op uint8, a, b uint64, is32 bool) bool {
+	if is32 {
+		a, b = uint64(uint32(a)), uint64(uint32(b))
+	}
+	sa, sb := int64(a), int64(b)
+	if is32 {
+		sa, sb = int64(int32(a)), int64(int32(b))
+	}
+	switch op {
+	case Jeq:
+		return a == b
+	case Jne:
+		return a != b
+	case Jgt:
+		return a > b
+	case Jge:
+		return a >= b
+	case Jlt:
+		return a < b
+	case Jle:
+		return a <= b
+	case Jsgt:
+		return sa > sb
+	case Jsge:
+		return sa >= sb
+	case Jslt:
+		return sa < sb
+	case Jsle:
+		return sa <= sb
+	case Jset:
+		return a&b != 0
+	default:
+		return false
+	}
+}
+
+// call implements calls to helper functions.
+func (m *machine) call(helper int32, pc int) error {
+	r := &m.regs
+	switch helper {
+	case HelperMapLookupElem, HelperMapUpdateElem, HelperMapDeleteElem:
+		if r[1].kind != mapPtr {
+			return Error{InvalidHelperArgument, pc}
+		}
+		mp := r[1].m
+		spec := mp.Spec()
+		key, err := m.memory(&r[2], 0, int(spec.KeySize), false, pc)
+		if err != nil {
+			return err
+		}
+		switch helper {
+		case HelperMapLookupElem:
+			if v := mp.Lookup(key); v != nil {
+				r[0] = register{kind: mapValuePtr, mem: v}
+			} else {
+				r[0] = register{}
+			}
+		case HelperMapUpdateElem:
+			value, err := m.memory(&r[3], 0, int(spec.ValueSize), false, pc)
+			if err != nil {
+				return err
+			}
+			if r[4].kind != scalar {
+				return Error{InvalidHelperArgument, pc}
+			}
+			r[0] = errnoResult(mp.Update(key, value, r[4].val))
+		case HelperMapDeleteElem:
+			r[0] = errnoResult(mp.Delete(key))
+		}
+	case HelperKtimeGetNS:
+		r[0] = register{val: uint64(m.env.MonotonicNanoseconds())}
+	case HelperGetPrandomU32:
+		r[0] = register{val: uint64(m.env.RandomUint32())}
+	case HelperGetSMPProcessorID:
+		r[0] = register{}
+	case HelperSKBLoadBytes:
+		if r[1].kind != ctxPtr || r[2].kind != scalar || r[4].kind != scalar {
+			return Error{InvalidHelperArgument, pc}
+		}
+		n := r[4].val
+		if n == 0 || n > StackSize {
+			return Error{InvalidHelperArgument, pc}
+		}
+		to, err := m.memory(&r[3], 0, int(n), true, pc)
+		if err != nil {
+			return err
+		}
+		off := r[2].val
+		if off > uint64(len(m.skb.Data)) || n > uint64(len(m.skb.Data))-off {
+			// Like Linux, clear the destination on failure.
+			for i := range to {
+				to[i] = 0
+			}
+			r[0] = errnoResult(linuxerr.EFAULT)
+			break
+		}
+		copy(to, m.skb.Data[off:])
+		r[0] = register{}
+	default:
+		return Error{InvalidHelper, pc}
+	}
+	return nil
+}
+
+// errnoResult returns the helper function return value for err: zero on
+// success, or a negative errno.
+func errnoResult(err error) register {
+	if err == nil {
+		return register{}
+	}
+	e, ok := err.(*errors.Error)
+	if !ok {
+		e = linuxerr.EINVAL
+	}
+	return register{val: uint64(-int64(e.Errno()))}
+}
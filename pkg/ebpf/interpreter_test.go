@@ -0,0 +1,418 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+func insn(op uint8, dst, src uint8, off int16, imm int32) linux.EBPFInstruction {
+	return linux.EBPFInstruction{OpCode: op, Regs: src<<4 | dst, Offset: off, Imm: imm}
+}
+
+func mov(dst uint8, imm int32) linux.EBPFInstruction {
+	return insn(Alu64|Mov|K, dst, 0, 0, imm)
+}
+
+func exit() linux.EBPFInstruction {
+	return insn(Jmp|Exit, 0, 0, 0, 0)
+}
+
+type testEnv struct{}
+
+func (testEnv) MonotonicNanoseconds() int64 { return 42 }
+
+func (testEnv) RandomUint32() uint32 { return 7 }
+
+func noMaps(fd int32) (Map, error) {
+	return nil, linuxerr.EBADF
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		insns []linux.EBPFInstruction
+		code  int
+	}{
+		{
+			name: "empty",
+			code: InvalidInstructionCount,
+		},
+		{
+			name:  "no exit",
+			insns: []linux.EBPFInstruction{mov(0, 0)},
+			code:  InvalidEndOfProgram,
+		},
+		{
+			name: "backward jump",
+			insns: []linux.EBPFInstruction{
+				mov(0, 0),
+				insn(Jmp|Ja, 0, 0, -2, 0),
+				exit(),
+			},
+			code: BackwardJump,
+		},
+		{
+			name: "jump out of bounds",
+			insns: []linux.EBPFInstruction{
+				mov(0, 0),
+				insn(Jmp|Jeq|K, 0, 0, 5, 0),
+				exit(),
+			},
+			code: InvalidJumpTarget,
+		},
+		{
+			name: "jump into immediate",
+			insns: []linux.EBPFInstruction{
+				insn(Jmp|Ja, 0, 0, 1, 0),
+				insn(Ld|Imm|DW, 0, 0, 0, 1),
+				insn(0, 0, 0, 0, 0),
+				exit(),
+			},
+			code: InvalidJumpTarget,
+		},
+		{
+			name: "unreachable",
+			insns: []linux.EBPFInstruction{
+				mov(0, 0),
+				exit(),
+				exit(),
+			},
+			code: UnreachableInstruction,
+		},
+		{
+			name: "uninitialized register",
+			insns: []linux.EBPFInstruction{
+				insn(Alu64|Mov|X, 0, 2, 0, 0),
+				exit(),
+			},
+			code: UninitializedRegister,
+		},
+		{
+			name: "uninitialized on one path",
+			insns: []linux.EBPFInstruction{
+				insn(Jmp|Jeq|K, 1, 0, 1, 0),
+				mov(0, 1),
+				exit(),
+			},
+			code: UninitializedRegister,
+		},
+		{
+			name: "clobbered by call",
+			insns: []linux.EBPFInstruction{
+				insn(Jmp|Call, 0, 0, 0, HelperKtimeGetNS),
+				insn(Alu64|Mov|X, 0, 1, 0, 0),
+				exit(),
+			},
+			code: UninitializedRegister,
+		},
+		{
+			name: "write frame pointer",
+			insns: []linux.EBPFInstruction{
+				mov(framePointer, 0),
+				exit(),
+			},
+			code: InvalidRegister,
+		},
+		{
+			name: "division by zero",
+			insns: []linux.EBPFInstruction{
+				mov(0, 1),
+				insn(Alu64|Div|K, 0, 0, 0, 0),
+				exit(),
+			},
+			code: DivisionByZero,
+		},
+		{
+			name: "unknown helper",
+			insns: []linux.EBPFInstruction{
+				insn(Jmp|Call, 0, 0, 0, 1000),
+				exit(),
+			},
+			code: InvalidHelper,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(ProgramSpec{Type: linux.BPF_PROG_TYPE_SOCKET_FILTER, Instructions: test.insns}, noMaps)
+			e, ok := err.(Error)
+			if !ok {
+				t.Fatalf("Load got error %v, want Error with code %d", err, test.code)
+			}
+			if e.Code != test.code {
+				t.Errorf("Load got error %v, want code %d", e, test.code)
+			}
+		})
+	}
+}
+
+func TestLoadUnsupportedType(t *testing.T) {
+	_, err := Load(ProgramSpec{Type: linux.BPF_PROG_TYPE_KPROBE, Instructions: []linux.EBPFInstruction{mov(0, 0), exit()}}, noMaps)
+	if err != linuxerr.EINVAL {
+		t.Errorf("Load got error %v, want EINVAL", err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	// An IPv4 header with protocol UDP, followed by 4 bytes of payload.
+	packet := []byte{
+		0x45, 0, 0, 24, 0, 0, 0, 0, 64, 17, 0, 0,
+		10, 0, 0, 1, 10, 0, 0, 2,
+		1, 2, 3, 4,
+	}
+	for _, test := range []struct {
+		name     string
+		progType uint32
+		insns    []linux.EBPFInstruction
+		want     uint64
+		wantErr  int
+	}{
+		{
+			name: "constant",
+			insns: []linux.EBPFInstruction{
+				mov(0, 5),
+				exit(),
+			},
+			want: 5,
+		},
+		{
+			name: "64-bit immediate",
+			insns: []linux.EBPFInstruction{
+				insn(Ld|Imm|DW, 0, 0, 0, 1),
+				insn(0, 0, 0, 0, 2),
+				exit(),
+			},
+			want: 2<<32 | 1,
+		},
+		{
+			name: "packet load",
+			insns: []linux.EBPFInstruction{
+				insn(Alu64|Mov|X, 6, 1, 0, 0),
+				insn(Ld|Abs|B, 0, 0, 0, 9),
+				exit(),
+			},
+			want: 17,
+		},
+		{
+			name: "packet load out of bounds",
+			insns: []linux.EBPFInstruction{
+				insn(Alu64|Mov|X, 6, 1, 0, 0),
+				insn(Ld|Abs|W, 0, 0, 0, 22),
+				mov(0, 1),
+				exit(),
+			},
+			want: 0,
+		},
+		{
+			name: "context length",
+			insns: []linux.EBPFInstruction{
+				insn(Ldx|Mem|W, 0, 1, skbLen, 0),
+				exit(),
+			},
+			want: 24,
+		},
+		{
+			name: "conditional",
+			insns: []linux.EBPFInstruction{
+				insn(Ldx|Mem|W, 2, 1, skbLen, 0),
+				mov(0, 1),
+				insn(Jmp|Jgt|K, 2, 0, 1, 20),
+				mov(0, 2),
+				exit(),
+			},
+			want: 1,
+		},
+		{
+			name: "spill and fill context",
+			insns: []linux.EBPFInstruction{
+				insn(Stx|Mem|DW, framePointer, 1, -8, 0),
+				insn(Ldx|Mem|DW, 2, framePointer, -8, 0),
+				insn(Ldx|Mem|W, 0, 2, skbLen, 0),
+				exit(),
+			},
+			want: 24,
+		},
+		{
+			name:     "direct packet access",
+			progType: linux.BPF_PROG_TYPE_CGROUP_SKB,
+			insns: []linux.EBPFInstruction{
+				insn(Ldx|Mem|W, 2, 1, skbData, 0),
+				insn(Ldx|Mem|W, 3, 1, skbDataEnd, 0),
+				mov(0, 0),
+				insn(Alu64|Mov|X, 4, 2, 0, 0),
+				insn(Alu64|Add|K, 4, 0, 0, 20),
+				insn(Jmp|Jgt|X, 4, 3, 1, 0),
+				insn(Ldx|Mem|B, 0, 2, 9, 0),
+				exit(),
+			},
+			want: 17,
+		},
+		{
+			name:     "direct packet access out of bounds",
+			progType: linux.BPF_PROG_TYPE_CGROUP_SKB,
+			insns: []linux.EBPFInstruction{
+				insn(Ldx|Mem|W, 2, 1, skbData, 0),
+				insn(Ldx|Mem|B, 0, 2, 100, 0),
+				exit(),
+			},
+			wantErr: InvalidMemoryAccess,
+		},
+		{
+			name: "no direct packet access for socket filters",
+			insns: []linux.EBPFInstruction{
+				insn(Ldx|Mem|W, 0, 1, skbData, 0),
+				exit(),
+			},
+			wantErr: InvalidMemoryAccess,
+		},
+		{
+			name: "stack out of bounds",
+			insns: []linux.EBPFInstruction{
+				insn(St|Mem|DW, framePointer, 0, 0, 1),
+				mov(0, 0),
+				exit(),
+			},
+			wantErr: InvalidMemoryAccess,
+		},
+		{
+			name: "pointer leak",
+			insns: []linux.EBPFInstruction{
+				insn(Alu64|Mov|X, 0, 1, 0, 0),
+				exit(),
+			},
+			wantErr: InvalidPointerArithmetic,
+		},
+		{
+			name: "byte swap",
+			insns: []linux.EBPFInstruction{
+				mov(0, 0x1234),
+				insn(Alu|End|X, 0, 0, 0, 16),
+				exit(),
+			},
+			want: 0x3412,
+		},
+		{
+			name: "helper",
+			insns: []linux.EBPFInstruction{
+				insn(Jmp|Call, 0, 0, 0, HelperKtimeGetNS),
+				exit(),
+			},
+			want: 42,
+		},
+		{
+			name: "stack pointer offset too large",
+			insns: []linux.EBPFInstruction{
+				insn(Ld|Imm|DW, 2, 0, 0, -16),
+				insn(0, 0, 0, 0, 0x7fffffff),
+				insn(Alu64|Mov|X, 3, 10, 0, 0),
+				insn(Alu64|Add|X, 3, 2, 0, 0),
+				mov(0, 0),
+				exit(),
+			},
+			wantErr: InvalidPointerArithmetic,
+		},
+		{
+			name: "stack pointer subtraction too large",
+			insns: []linux.EBPFInstruction{
+				insn(Ld|Imm|DW, 2, 0, 0, 0),
+				insn(0, 0, 0, 0, 1),
+				insn(Alu64|Mov|X, 3, 10, 0, 0),
+				insn(Alu64|Sub|X, 3, 2, 0, 0),
+				mov(0, 0),
+				exit(),
+			},
+			wantErr: InvalidPointerArithmetic,
+		},
+		{
+			name: "stack access at maximum offset",
+			insns: []linux.EBPFInstruction{
+				insn(Ld|Imm|DW, 2, 0, 0, maxPointerOffset-StackSize),
+				insn(0, 0, 0, 0, 0),
+				insn(Alu64|Mov|X, 3, 10, 0, 0),
+				insn(Alu64|Add|X, 3, 2, 0, 0),
+				insn(Ldx|Mem|DW, 0, 3, 0x7fff, 0),
+				exit(),
+			},
+			wantErr: InvalidMemoryAccess,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			progType := test.progType
+			if progType == 0 {
+				progType = linux.BPF_PROG_TYPE_SOCKET_FILTER
+			}
+			p, err := Load(ProgramSpec{Type: progType, Instructions: test.insns}, noMaps)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			got, err := Exec(p, &SKB{Data: packet}, testEnv{})
+			if test.wantErr != 0 {
+				if e, ok := err.(Error); !ok || e.Code != test.wantErr {
+					t.Errorf("Exec got (%d, %v), want error code %d", got, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exec failed: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Exec got %#x, want %#x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExecMap(t *testing.T) {
+	m, err := NewMap(MapSpec{Type: linux.BPF_MAP_TYPE_ARRAY, KeySize: 4, ValueSize: 8, MaxEntries: 1})
+	if err != nil {
+		t.Fatalf("NewMap failed: %v", err)
+	}
+	resolve := func(fd int32) (Map, error) {
+		if fd != 3 {
+			return nil, linuxerr.EBADF
+		}
+		return m, nil
+	}
+	// Count packets in the map's first element.
+	insns := []linux.EBPFInstruction{
+		insn(St|Mem|W, framePointer, 0, -4, 0),
+		insn(Alu64|Mov|X, 2, framePointer, 0, 0),
+		insn(Alu64|Add|K, 2, 0, 0, -4),
+		insn(Ld|Imm|DW, 1, linux.BPF_PSEUDO_MAP_FD, 0, 3),
+		insn(0, 0, 0, 0, 0),
+		insn(Jmp|Call, 0, 0, 0, HelperMapLookupElem),
+		insn(Jmp|Jeq|K, 0, 0, 2, 0),
+		mov(1, 1),
+		insn(Stx|Atomic|DW, 0, 1, 0, Add),
+		mov(0, 0),
+		exit(),
+	}
+	p, err := Load(ProgramSpec{Type: linux.BPF_PROG_TYPE_SOCKET_FILTER, Instructions: insns}, resolve)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := Exec(p, &SKB{}, testEnv{}); err != nil {
+			t.Fatalf("Exec failed: %v", err)
+		}
+	}
+	v := m.Lookup(make([]byte, 4))
+	if got := hostarch.ByteOrder.Uint64(v); got != 3 {
+		t.Errorf("got count %d, want 3", got)
+	}
+}
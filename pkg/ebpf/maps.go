@@ -0,0 +1,277 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// maxMapBytes is the maximum amount of key and value storage of a single map.
+const maxMapBytes = 64 << 20
+
+// MapSpec describes a map.
+//
+// +stateify savable
+type MapSpec struct {
+	// Type is the map type, one of linux.BPF_MAP_TYPE_*.
+	Type uint32
+
+	// KeySize is the size of the map's keys in bytes.
+	KeySize uint32
+
+	// ValueSize is the size of the map's values in bytes.
+	ValueSize uint32
+
+	// MaxEntries is the maximum number of entries in the map.
+	MaxEntries uint32
+
+	// Flags are the linux.BPF_F_* flags the map was created with.
+	Flags uint32
+
+	// Name is the map's name, for debugging.
+	Name string
+}
+
+// Map is an eBPF map. Maps are shared by the programs that refer to them and
+// by userspace, and are safe for concurrent use.
+type Map interface {
+	// Spec returns the map's description.
+	Spec() MapSpec
+
+	// Lookup returns the value associated with key, or nil if there is none.
+	// The returned slice aliases the map's storage, and remains valid after
+	// the entry is updated or deleted.
+	Lookup(key []byte) []byte
+
+	// Update sets the value associated with key. flags is one of
+	// linux.BPF_ANY, linux.BPF_NOEXIST or linux.BPF_EXIST.
+	Update(key, value []byte, flags uint64) error
+
+	// Delete removes the value associated with key.
+	Delete(key []byte) error
+
+	// NextKey returns the key that follows key in the map's iteration order.
+	// If key is nil or isn't in the map, NextKey returns the first key. If key
+	// is the last key, NextKey returns ENOENT.
+	NextKey(key []byte) ([]byte, error)
+}
+
+// NewMap returns a new, empty map as described by spec.
+func NewMap(spec MapSpec) (Map, error) {
+	if spec.KeySize == 0 || spec.ValueSize == 0 || spec.MaxEntries == 0 {
+		return nil, linuxerr.EINVAL
+	}
+	if spec.Flags&^(linux.BPF_F_NO_PREALLOC|linux.BPF_F_RDONLY|linux.BPF_F_WRONLY) != 0 {
+		return nil, linuxerr.EINVAL
+	}
+	if spec.Flags&linux.BPF_F_RDONLY != 0 && spec.Flags&linux.BPF_F_WRONLY != 0 {
+		return nil, linuxerr.EINVAL
+	}
+	// Keys are copied from the program's stack.
+	if spec.KeySize > StackSize {
+		return nil, linuxerr.E2BIG
+	}
+	if uint64(spec.MaxEntries)*(uint64(spec.KeySize)+uint64(spec.ValueSize)) > maxMapBytes {
+		return nil, linuxerr.E2BIG
+	}
+	switch spec.Type {
+	case linux.BPF_MAP_TYPE_HASH:
+		return &hashMap{
+			spec:    spec,
+			entries: make(map[string][]byte),
+			index:   make(map[string]int),
+		}, nil
+	case linux.BPF_MAP_TYPE_ARRAY:
+		if spec.KeySize != 4 || spec.Flags&linux.BPF_F_NO_PREALLOC != 0 {
+			return nil, linuxerr.EINVAL
+		}
+		return &arrayMap{
+			spec:   spec,
+			values: make([]byte, uint64(spec.MaxEntries)*uint64(spec.ValueSize)),
+		}, nil
+	default:
+		return nil, linuxerr.EINVAL
+	}
+}
+
+// hashMap implements Map for linux.BPF_MAP_TYPE_HASH.
+//
+// +stateify savable
+type hashMap struct {
+	// spec is immutable.
+	spec MapSpec
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// entries maps keys to values.
+	entries map[string][]byte
+
+	// keys contains the keys of entries in iteration order, and index maps
+	// each key to its position in keys.
+	keys  []string
+	index map[string]int
+}
+
+// Spec implements Map.Spec.
+func (m *hashMap) Spec() MapSpec {
+	return m.spec
+}
+
+// Lookup implements Map.Lookup.
+func (m *hashMap) Lookup(key []byte) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entries[string(key)]
+}
+
+// Update implements Map.Update.
+func (m *hashMap) Update(key, value []byte, flags uint64) error {
+	if flags > linux.BPF_EXIST {
+		return linuxerr.EINVAL
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := string(key)
+	if v, ok := m.entries[k]; ok {
+		if flags == linux.BPF_NOEXIST {
+			return linuxerr.EEXIST
+		}
+		copy(v, value)
+		return nil
+	}
+	if flags == linux.BPF_EXIST {
+		return linuxerr.ENOENT
+	}
+	if uint32(len(m.entries)) >= m.spec.MaxEntries {
+		return linuxerr.E2BIG
+	}
+	m.entries[k] = append([]byte(nil), value...)
+	m.index[k] = len(m.keys)
+	m.keys = append(m.keys, k)
+	return nil
+}
+
+// Delete implements Map.Delete.
+func (m *hashMap) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := string(key)
+	i, ok := m.index[k]
+	if !ok {
+		return linuxerr.ENOENT
+	}
+	last := len(m.keys) - 1
+	m.keys[i] = m.keys[last]
+	m.index[m.keys[i]] = i
+	m.keys = m.keys[:last]
+	delete(m.index, k)
+	delete(m.entries, k)
+	return nil
+}
+
+// NextKey implements Map.NextKey.
+func (m *hashMap) NextKey(key []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next := 0
+	if key != nil {
+		if i, ok := m.index[string(key)]; ok {
+			next = i + 1
+		}
+	}
+	if next >= len(m.keys) {
+		return nil, linuxerr.ENOENT
+	}
+	return []byte(m.keys[next]), nil
+}
+
+// arrayMap implements Map for linux.BPF_MAP_TYPE_ARRAY. Keys are 32-bit
+// indices, and every entry always exists.
+//
+// +stateify savable
+type arrayMap struct {
+	// spec is immutable.
+	spec MapSpec
+
+	// mu protects values.
+	mu sync.Mutex `state:"nosave"`
+
+	// values contains all values, in index order.
+	values []byte
+}
+
+// Spec implements Map.Spec.
+func (m *arrayMap) Spec() MapSpec {
+	return m.spec
+}
+
+func (m *arrayMap) slot(key []byte) ([]byte, bool) {
+	i := hostarch.ByteOrder.Uint32(key)
+	if i >= m.spec.MaxEntries {
+		return nil, false
+	}
+	off := uint64(i) * uint64(m.spec.ValueSize)
+	return m.values[off : off+uint64(m.spec.ValueSize) : off+uint64(m.spec.ValueSize)], true
+}
+
+// Lookup implements Map.Lookup.
+func (m *arrayMap) Lookup(key []byte) []byte {
+	v, _ := m.slot(key)
+	return v
+}
+
+// Update implements Map.Update.
+func (m *arrayMap) Update(key, value []byte, flags uint64) error {
+	if flags > linux.BPF_EXIST {
+		return linuxerr.EINVAL
+	}
+	v, ok := m.slot(key)
+	if !ok {
+		return linuxerr.E2BIG
+	}
+	if flags == linux.BPF_NOEXIST {
+		// All elements of an array always exist.
+		return linuxerr.EEXIST
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copy(v, value)
+	return nil
+}
+
+// Delete implements Map.Delete.
+func (m *arrayMap) Delete(key []byte) error {
+	return linuxerr.EINVAL
+}
+
+// NextKey implements Map.NextKey.
+func (m *arrayMap) NextKey(key []byte) ([]byte, error) {
+	var next uint32
+	if key != nil {
+		if i := hostarch.ByteOrder.Uint32(key); i < m.spec.MaxEntries {
+			next = i + 1
+		}
+	}
+	if next >= m.spec.MaxEntries {
+		return nil, linuxerr.ENOENT
+	}
+	b := make([]byte, 4)
+	hostarch.ByteOrder.PutUint32(b, next)
+	return b, nil
+}
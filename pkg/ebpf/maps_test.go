@@ -0,0 +1,115 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+)
+
+func TestHashMap(t *testing.T) {
+	m, err := NewMap(MapSpec{Type: linux.BPF_MAP_TYPE_HASH, KeySize: 1, ValueSize: 1, MaxEntries: 2})
+	if err != nil {
+		t.Fatalf("NewMap failed: %v", err)
+	}
+	if err := m.Update([]byte{1}, []byte{10}, linux.BPF_EXIST); err != linuxerr.ENOENT {
+		t.Errorf("Update(BPF_EXIST) of missing key got %v, want ENOENT", err)
+	}
+	if err := m.Update([]byte{1}, []byte{10}, linux.BPF_NOEXIST); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := m.Update([]byte{1}, []byte{11}, linux.BPF_NOEXIST); err != linuxerr.EEXIST {
+		t.Errorf("Update(BPF_NOEXIST) of existing key got %v, want EEXIST", err)
+	}
+	if err := m.Update([]byte{2}, []byte{20}, linux.BPF_ANY); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := m.Update([]byte{3}, []byte{30}, linux.BPF_ANY); err != linuxerr.E2BIG {
+		t.Errorf("Update of full map got %v, want E2BIG", err)
+	}
+	if v := m.Lookup([]byte{2}); len(v) != 1 || v[0] != 20 {
+		t.Errorf("Lookup got %v, want [20]", v)
+	}
+
+	// Iterate over all keys.
+	var keys []byte
+	var key []byte
+	for {
+		next, err := m.NextKey(key)
+		if err == linuxerr.ENOENT {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextKey failed: %v", err)
+		}
+		keys = append(keys, next[0])
+		key = next
+	}
+	if len(keys) != 2 {
+		t.Errorf("got keys %v, want 2 keys", keys)
+	}
+
+	if err := m.Delete([]byte{1}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := m.Delete([]byte{1}); err != linuxerr.ENOENT {
+		t.Errorf("Delete of missing key got %v, want ENOENT", err)
+	}
+	if v := m.Lookup([]byte{1}); v != nil {
+		t.Errorf("Lookup of deleted key got %v, want nil", v)
+	}
+}
+
+func TestArrayMap(t *testing.T) {
+	if _, err := NewMap(MapSpec{Type: linux.BPF_MAP_TYPE_ARRAY, KeySize: 8, ValueSize: 4, MaxEntries: 2}); err != linuxerr.EINVAL {
+		t.Errorf("NewMap with 8-byte keys got %v, want EINVAL", err)
+	}
+	m, err := NewMap(MapSpec{Type: linux.BPF_MAP_TYPE_ARRAY, KeySize: 4, ValueSize: 4, MaxEntries: 2})
+	if err != nil {
+		t.Fatalf("NewMap failed: %v", err)
+	}
+	key := func(i byte) []byte {
+		k := make([]byte, 4)
+		k[0] = i
+		return k
+	}
+	if v := m.Lookup(key(1)); len(v) != 4 || v[0] != 0 {
+		t.Errorf("Lookup got %v, want zero value", v)
+	}
+	if v := m.Lookup(key(2)); v != nil {
+		t.Errorf("Lookup out of bounds got %v, want nil", v)
+	}
+	if err := m.Update(key(1), []byte{1, 2, 3, 4}, linux.BPF_NOEXIST); err != linuxerr.EEXIST {
+		t.Errorf("Update(BPF_NOEXIST) got %v, want EEXIST", err)
+	}
+	if err := m.Update(key(1), []byte{1, 2, 3, 4}, linux.BPF_ANY); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if v := m.Lookup(key(1)); v[3] != 4 {
+		t.Errorf("Lookup got %v, want [1 2 3 4]", v)
+	}
+	if err := m.Delete(key(0)); err != linuxerr.EINVAL {
+		t.Errorf("Delete got %v, want EINVAL", err)
+	}
+	next, err := m.NextKey(key(0))
+	if err != nil || next[0] != 1 {
+		t.Errorf("NextKey(0) got (%v, %v), want 1", next, err)
+	}
+	if _, err := m.NextKey(key(1)); err != linuxerr.ENOENT {
+		t.Errorf("NextKey(last) got %v, want ENOENT", err)
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebpf
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+)
+
+// ProgramSpec describes a program to load.
+type ProgramSpec struct {
+	// Type is the program type, one of linux.BPF_PROG_TYPE_*.
+	Type uint32
+
+	// Name is the program's name, for debugging.
+	Name string
+
+	// ID is the program's unique ID, assigned by the caller.
+	ID uint32
+
+	// Instructions are the program's instructions.
+	Instructions []linux.EBPFInstruction
+}
+
+// Program is an eBPF program that has been verified.
+//
+// +stateify savable
+type Program struct {
+	// progType, name and id are immutable.
+	progType uint32
+	name     string
+	id       uint32
+
+	// insns are the program's instructions. The immediates of 64-bit
+	// immediate loads that refer to maps are indices into maps.
+	insns []linux.EBPFInstruction
+
+	// maps contains the maps that the program refers to.
+	maps []Map
+}
+
+// Type returns the program's type.
+func (p *Program) Type() uint32 {
+	return p.progType
+}
+
+// Name returns the program's name.
+func (p *Program) Name() string {
+	return p.name
+}
+
+// ID returns the program's ID.
+func (p *Program) ID() uint32 {
+	return p.id
+}
+
+// Length returns the number of instructions in the program.
+func (p *Program) Length() int {
+	return len(p.insns)
+}
+
+// SupportedProgramType returns true if programs of type progType can be
+// loaded.
+func SupportedProgramType(progType uint32) bool {
+	switch progType {
+	case linux.BPF_PROG_TYPE_SOCKET_FILTER, linux.BPF_PROG_TYPE_CGROUP_SKB:
+		return true
+	default:
+		return false
+	}
+}
+
+// helperArgs maps the supported helper functions to their number of
+// arguments.
+var helperArgs = map[int32]int{
+	HelperMapLookupElem:     2,
+	HelperMapUpdateElem:     4,
+	HelperMapDeleteElem:     2,
+	HelperKtimeGetNS:        0,
+	HelperGetPrandomU32:     0,
+	HelperGetSMPProcessorID: 0,
+	HelperSKBLoadBytes:      4,
+}
+
+// regSet is a set of registers.
+type regSet uint16
+
+func regBit(r uint8) regSet {
+	return 1 << r
+}
+
+// Registers clobbered by helper calls and packet loads.
+const callerSaved = regSet(1<<1 | 1<<2 | 1<<3 | 1<<4 | 1<<5)
+
+// Load verifies the instructions in spec and returns the resulting program.
+// resolveMap returns the map referred to by a file descriptor in a 64-bit
+// immediate load.
+//
+// Load returns linuxerr.EINVAL if the program type is unsupported, the error
+// returned by resolveMap if it fails, or an Error describing the first
+// problem found in the program.
+//
+// Like Linux's verifier, Load ensures that every instruction is valid and
+// reachable, that the program terminates, and that no register is read before
+// it is written. Unlike Linux, Load rejects all backward jumps, including
+// bounded loops, and doesn't track pointer types; memory safety is instead
+// enforced by Exec.
+func Load(spec ProgramSpec, resolveMap func(fd int32) (Map, error)) (*Program, error) {
+	if !SupportedProgramType(spec.Type) {
+		return nil, linuxerr.EINVAL
+	}
+	n := len(spec.Instructions)
+	if n == 0 || n > MaxInstructions {
+		return nil, Error{InvalidInstructionCount, n}
+	}
+	p := &Program{
+		progType: spec.Type,
+		name:     spec.Name,
+		id:       spec.ID,
+		insns:    append([]linux.EBPFInstruction(nil), spec.Instructions...),
+	}
+
+	// Validate each instruction and find the second halves of 64-bit
+	// immediate loads, which can't be executed or jumped to.
+	imm64Tail := make([]bool, n)
+	for pc := 0; pc < n; pc++ {
+		ins := &p.insns[pc]
+		if err := validate(*ins, pc); err != nil {
+			return nil, err
+		}
+		if ins.OpCode != Ld|Imm|DW {
+			continue
+		}
+		if pc+1 >= n {
+			return nil, Error{InvalidOpcode, pc}
+		}
+		if next := p.insns[pc+1]; next.OpCode != 0 || next.Regs != 0 || next.Offset != 0 {
+			return nil, Error{InvalidOpcode, pc + 1}
+		}
+		switch ins.SrcReg() {
+		case 0:
+		case linux.BPF_PSEUDO_MAP_FD:
+			if p.insns[pc+1].Imm != 0 {
+				return nil, Error{InvalidMap, pc}
+			}
+			m, err := resolveMap(ins.Imm)
+			if err != nil {
+				return nil, err
+			}
+			ins.Imm = int32(len(p.maps))
+			p.maps = append(p.maps, m)
+		default:
+			return nil, Error{InvalidOpcode, pc}
+		}
+		imm64Tail[pc+1] = true
+		pc++
+	}
+
+	// Check jumps, reachability and register initialization. All jumps are
+	// forward, so visiting instructions in order visits every instruction
+	// after all of its predecessors.
+	reached := make([]bool, n)
+	initialized := make([]regSet, n)
+	reached[0] = true
+	initialized[0] = regBit(1) | regBit(framePointer)
+	for pc := 0; pc < n; pc++ {
+		if imm64Tail[pc] {
+			continue
+		}
+		if !reached[pc] {
+			return nil, Error{UnreachableInstruction, pc}
+		}
+		ins := p.insns[pc]
+		reads, writes, clobbers := registerUse(ins)
+		if reads&^initialized[pc] != 0 {
+			return nil, Error{UninitializedRegister, pc}
+		}
+		out := (initialized[pc] | writes) &^ clobbers
+
+		var succs [2]int
+		nsuccs := 0
+		class := ins.OpCode & instructionClassMask
+		isJump := class == Jmp || class == Jmp32
+		op := ins.OpCode & jmpMask
+		switch {
+		case ins.OpCode == Ld|Imm|DW:
+			succs[0], nsuccs = pc+2, 1
+		case isJump && op == Exit:
+		case isJump && op == Call:
+			succs[0], nsuccs = pc+1, 1
+		case isJump && op == Ja:
+			succs[0], nsuccs = pc+1+int(ins.Offset), 1
+		case isJump:
+			succs[0], succs[1], nsuccs = pc+1, pc+1+int(ins.Offset), 2
+		default:
+			succs[0], nsuccs = pc+1, 1
+		}
+		for i, succ := range succs[:nsuccs] {
+			if isJump && (i == 1 || op == Ja) {
+				if ins.Offset < 0 {
+					return nil, Error{BackwardJump, pc}
+				}
+				if succ >= n || imm64Tail[succ] {
+					return nil, Error{InvalidJumpTarget, pc}
+				}
+			}
+			if succ >= n {
+				return nil, Error{InvalidEndOfProgram, pc}
+			}
+			if !reached[succ] {
+				reached[succ] = true
+				initialized[succ] = out
+			} else {
+				initialized[succ] &= out
+			}
+		}
+	}
+	return p, nil
+}
+
+// validate checks that a single instruction is valid. It doesn't check jump
+// targets or the second half of 64-bit immediate loads.
+func validate(ins linux.EBPFInstruction, pc int) error {
+	dst, src := ins.DstReg(), ins.SrcReg()
+	if dst >= numRegisters || src >= numRegisters {
+		return Error{InvalidRegister, pc}
+	}
+	switch ins.OpCode & instructionClassMask {
+	case Ld:
+		switch ins.OpCode &^ loadSizeMask {
+		case Ld | Imm:
+			if ins.OpCode&loadSizeMask != DW || ins.Offset != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+			if dst == framePointer {
+				return Error{InvalidRegister, pc}
+			}
+		case Ld | Abs, Ld | Ind:
+			if ins.OpCode&loadSizeMask == DW || ins.Offset != 0 || dst != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+			if ins.OpCode&loadModeMask == Abs && src != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+		default:
+			return Error{InvalidOpcode, pc}
+		}
+	case Ldx:
+		if ins.OpCode&loadModeMask != Mem || ins.Imm != 0 {
+			return Error{InvalidOpcode, pc}
+		}
+		if dst == framePointer {
+			return Error{InvalidRegister, pc}
+		}
+	case St:
+		if ins.OpCode&loadModeMask != Mem || src != 0 {
+			return Error{InvalidOpcode, pc}
+		}
+	case Stx:
+		switch ins.OpCode & loadModeMask {
+		case Mem:
+			if ins.Imm != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+		case Atomic:
+			// Only atomic add without fetch, formerly BPF_XADD, is supported.
+			size := ins.OpCode & loadSizeMask
+			if (size != W && size != DW) || ins.Imm != Add {
+				return Error{InvalidOpcode, pc}
+			}
+		default:
+			return Error{InvalidOpcode, pc}
+		}
+	case Alu, Alu64:
+		op := ins.OpCode & aluMask
+		if op > End || ins.Offset != 0 {
+			return Error{InvalidOpcode, pc}
+		}
+		if dst == framePointer {
+			return Error{InvalidRegister, pc}
+		}
+		switch op {
+		case Neg:
+			if ins.OpCode&srcMask != K || src != 0 || ins.Imm != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+		case End:
+			if ins.OpCode&instructionClassMask != Alu || src != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+			if ins.Imm != 16 && ins.Imm != 32 && ins.Imm != 64 {
+				return Error{InvalidOpcode, pc}
+			}
+		case Div, Mod:
+			if ins.OpCode&srcMask == K && ins.Imm == 0 {
+				return Error{DivisionByZero, pc}
+			}
+		}
+		if ins.OpCode&srcMask == K && src != 0 {
+			return Error{InvalidOpcode, pc}
+		}
+	case Jmp, Jmp32:
+		op := ins.OpCode & jmpMask
+		switch op {
+		case Call:
+			if ins.OpCode != Jmp|Call || src != 0 || dst != 0 || ins.Offset != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+			if _, ok := helperArgs[ins.Imm]; !ok {
+				return Error{InvalidHelper, pc}
+			}
+		case Exit, Ja:
+			if ins.OpCode&^jmpMask != Jmp || ins.Regs != 0 || ins.Imm != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+			if op == Exit && ins.Offset != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+		default:
+			if op > Jsle {
+				return Error{InvalidOpcode, pc}
+			}
+			if ins.OpCode&srcMask == K && src != 0 {
+				return Error{InvalidOpcode, pc}
+			}
+		}
+	}
+	return nil
+}
+
+// registerUse returns the registers that an instruction reads, writes and
+// clobbers.
+func registerUse(ins linux.EBPFInstruction) (reads, writes, clobbers regSet) {
+	dst, src := regBit(ins.DstReg()), regBit(ins.SrcReg())
+	switch ins.OpCode & instructionClassMask {
+	case Ld:
+		switch ins.OpCode & loadModeMask {
+		case Imm:
+			return 0, dst, 0
+		case Abs:
+			// Packet loads implicitly use R6 as the context.
+			return regBit(6), regBit(0), callerSaved
+		case Ind:
+			return regBit(6) | src, regBit(0), callerSaved
+		}
+	case Ldx:
+		return src, dst, 0
+	case St:
+		return dst, 0, 0
+	case Stx:
+		return dst | src, 0, 0
+	case Alu, Alu64:
+		switch ins.OpCode & aluMask {
+		case Mov:
+			if ins.OpCode&srcMask == X {
+				return src, dst, 0
+			}
+			return 0, dst, 0
+		case Neg, End:
+			return dst, dst, 0
+		}
+		if ins.OpCode&srcMask == X {
+			return dst | src, dst, 0
+		}
+		return dst, dst, 0
+	case Jmp, Jmp32:
+		switch ins.OpCode & jmpMask {
+		case Ja:
+			return 0, 0, 0
+		case Exit:
+			return regBit(0), 0, 0
+		case Call:
+			for i := 1; i <= helperArgs[ins.Imm]; i++ {
+				reads |= regBit(uint8(i))
+			}
+			return reads, regBit(0), callerSaved
+		}
+		if ins.OpCode&srcMask == X {
+			return dst | src, 0, 0
+		}
+		return dst, 0, 0
+	}
+	return 0, 0, 0
+}
@@ -57,6 +57,16 @@ func Utimensat(dirFd int, name string, times [2]unix.Timespec, flags int) error
 // RenameAt is a convenience wrapper to make the renameat(2) syscall. It
 // additionally handles empty names.
 func RenameAt(oldDirFD int, oldName string, newDirFD int, newName string) error {
+	return renameAt(unix.SYS_RENAMEAT, oldDirFD, oldName, newDirFD, newName, 0)
+}
+
+// RenameAt2 is like RenameAt, but makes the renameat2(2) syscall with the
+// given flags.
+func RenameAt2(oldDirFD int, oldName string, newDirFD int, newName string, flags uint32) error {
+	return renameAt(unix.SYS_RENAMEAT2, oldDirFD, oldName, newDirFD, newName, flags)
+}
+
+func renameAt(sysno uintptr, oldDirFD int, oldName string, newDirFD int, newName string, flags uint32) error {
 	var oldNamePtr unsafe.Pointer
 	if oldName != "" {
 		nameBytes, err := unix.BytePtrFromString(oldName)
@@ -75,12 +85,12 @@ func RenameAt(oldDirFD int, oldName string, newDirFD int, newName string) error
 	}
 
 	if _, _, errno := unix.Syscall6(
-		unix.SYS_RENAMEAT,
+		sysno,
 		uintptr(oldDirFD),
 		uintptr(oldNamePtr),
 		uintptr(newDirFD),
 		uintptr(newNamePtr),
-		0,
+		uintptr(flags),
 		0); errno != 0 {
 
 		return syserr.FromHost(errno).ToError()
@@ -17,11 +17,13 @@ package lisafs
 import (
 	"fmt"
 	"math"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/flipcall"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/unet"
 )
@@ -32,6 +34,12 @@ const (
 	fdsToCloseBatchSize = 100
 )
 
+// rpcLatency records the round trip time of RPCs made to the gofer. It is only
+// recorded when hot path timers are enabled.
+var rpcLatency = metric.MustCreateNewTimerMetric("/gofer/rpc_latency",
+	metric.NewDurationBucketer(20, time.Microsecond, 10*time.Second),
+	"Round trip time of RPCs made to the gofer.")
+
 // Client helps manage a connection to the lisafs server and pass messages
 // efficiently. There is a 1:1 mapping between a Connection and a Client.
 type Client struct {
@@ -311,6 +319,50 @@ func (c *Client) SyncFDs(ctx context.Context, fds []FDID) error {
 	return err
 }
 
+// InotifyInit makes the InotifyInit RPC. It returns the host FD from which
+// InotifyEvents are read. The caller owns the returned FD.
+func (c *Client) InotifyInit(ctx context.Context) (int, error) {
+	var (
+		req     InotifyInitReq
+		resp    InotifyInitResp
+		eventFD = [1]int{-1}
+	)
+	ctx.UninterruptibleSleepStart(false)
+	err := c.SndRcvMessage(InotifyInit, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, eventFD[:], req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	if err == nil && eventFD[0] < 0 {
+		err = unix.EBADF
+	}
+	return eventFD[0], err
+}
+
+// DelegationInit makes the DelegationInit RPC. It returns the host FD from
+// which DelegationRecalls are read. The caller owns the returned FD.
+func (c *Client) DelegationInit(ctx context.Context) (int, error) {
+	var (
+		req      DelegationInitReq
+		resp     DelegationInitResp
+		recallFD = [1]int{-1}
+	)
+	ctx.UninterruptibleSleepStart(false)
+	err := c.SndRcvMessage(DelegationInit, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, recallFD[:], req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	if err == nil && recallFD[0] < 0 {
+		err = unix.EBADF
+	}
+	return recallFD[0], err
+}
+
+// InotifyRmWatch makes the InotifyRmWatch RPC.
+func (c *Client) InotifyRmWatch(ctx context.Context, wd int32) error {
+	req := InotifyRmWatchReq{WD: wd}
+	var resp InotifyRmWatchResp
+	ctx.UninterruptibleSleepStart(false)
+	err := c.SndRcvMessage(InotifyRmWatch, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return err
+}
+
 // SndRcvMessage invokes reqMarshal to marshal the request onto the payload
 // buffer, wakes up the server to process the request, waits for the response
 // and invokes respUnmarshal with the response payload. respFDs is populated
@@ -342,7 +394,9 @@ func (c *Client) SndRcvMessage(m MID, payloadLen uint32, reqMarshal marshalFunc,
 
 	// Marshal the request into comm's payload buffer and make the RPC.
 	reqMarshal(comm.PayloadBuf(payloadLen))
+	latency := rpcLatency.StartHotPath()
 	respM, respPayloadLen, err := comm.SndRcvMessage(m, payloadLen, uint8(wantFDs))
+	latency.Finish()
 
 	// Handle FD donation.
 	rcvFDs := comm.ReleaseFDs()
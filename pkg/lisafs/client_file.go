@@ -387,6 +387,50 @@ func (f *ClientFD) StatFSTo(ctx context.Context, statFS *StatFS) error {
 	return err
 }
 
+// SetLock makes the SetLock RPC.
+func (f *ClientFD) SetLock(ctx context.Context, kind, typ uint32, start, length uint64) error {
+	req := SetLockReq{
+		FD:     f.fd,
+		Kind:   kind,
+		Type:   typ,
+		Start:  start,
+		Length: length,
+	}
+	var resp SetLockResp
+	ctx.UninterruptibleSleepStart(false)
+	err := f.client.SndRcvMessage(SetLock, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return err
+}
+
+// Delegate makes the Delegate RPC.
+func (f *ClientFD) Delegate(ctx context.Context, typ uint32) error {
+	req := DelegateReq{
+		FD:   f.fd,
+		Type: typ,
+	}
+	var resp DelegateResp
+	ctx.UninterruptibleSleepStart(false)
+	err := f.client.SndRcvMessage(Delegate, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return err
+}
+
+// InotifyAddWatch makes the InotifyAddWatch RPC to watch the file at path
+// relative to f.
+func (f *ClientFD) InotifyAddWatch(ctx context.Context, path []string, mask uint32) (int32, error) {
+	req := InotifyAddWatchReq{
+		FD:   f.fd,
+		Mask: primitive.Uint32(mask),
+		Path: path,
+	}
+	var resp InotifyAddWatchResp
+	ctx.UninterruptibleSleepStart(false)
+	err := f.client.SndRcvMessage(InotifyAddWatch, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return resp.WD, err
+}
+
 // Allocate makes the FAllocate RPC.
 func (f *ClientFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
 	req := FAllocateReq{
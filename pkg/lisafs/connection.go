@@ -81,6 +81,16 @@ type Connection struct {
 	fds map[FDID]genericFD
 	// nextFDID is the next available FDID. It is protected by fdsMu.
 	nextFDID FDID
+
+	notifierMu sync.Mutex
+	// notifier forwards host filesystem events to the client. It is nil until
+	// the client makes an InotifyInit RPC. It is protected by notifierMu.
+	notifier Notifier
+
+	delegatorMu sync.Mutex
+	// delegator grants delegations to the client. It is nil until the client
+	// makes a DelegationInit RPC. It is protected by delegatorMu.
+	delegator Delegator
 }
 
 // CreateConnection initializes a new connection which will be mounted at
@@ -243,6 +253,22 @@ func (c *Connection) close() {
 	// Ensure the connection is closed.
 	c.sockComm.destroy()
 
+	// Stop forwarding host filesystem events.
+	c.notifierMu.Lock()
+	if c.notifier != nil {
+		c.notifier.Close()
+		c.notifier = nil
+	}
+	c.notifierMu.Unlock()
+
+	// Return all delegations.
+	c.delegatorMu.Lock()
+	if c.delegator != nil {
+		c.delegator.Close()
+		c.delegator = nil
+	}
+	c.delegatorMu.Unlock()
+
 	// Cleanup all FDs.
 	c.fdsMu.Lock()
 	defer c.fdsMu.Unlock()
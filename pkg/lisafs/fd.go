@@ -599,6 +599,14 @@ type OpenFDImpl interface {
 	// On the server, Allocate has a write concurrency guarantee.
 	Allocate(mode, off, length uint64) error
 
+	// SetLock takes or releases an advisory lock of kind LockKindBSD or
+	// LockKindPOSIX on the file. Locks are owned by this open FD, and must not
+	// block: if the lock conflicts with another lock, SetLock fails with
+	// EAGAIN.
+	//
+	// On the server, SetLock has a read concurrency guarantee.
+	SetLock(kind, typ uint32, start, length uint64) error
+
 	// Flush can be used to clean up the file state. Behavior is
 	// implementation-specific.
 	//
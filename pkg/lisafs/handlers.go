@@ -46,38 +46,44 @@ const (
 type RPCHandler func(c *Connection, comm Communicator, payloadLen uint32) (uint32, error)
 
 var handlers = [...]RPCHandler{
-	Error:        ErrorHandler,
-	Mount:        MountHandler,
-	Channel:      ChannelHandler,
-	FStat:        FStatHandler,
-	SetStat:      SetStatHandler,
-	Walk:         WalkHandler,
-	WalkStat:     WalkStatHandler,
-	OpenAt:       OpenAtHandler,
-	OpenCreateAt: OpenCreateAtHandler,
-	Close:        CloseHandler,
-	FSync:        FSyncHandler,
-	PWrite:       PWriteHandler,
-	PRead:        PReadHandler,
-	MkdirAt:      MkdirAtHandler,
-	MknodAt:      MknodAtHandler,
-	SymlinkAt:    SymlinkAtHandler,
-	LinkAt:       LinkAtHandler,
-	FStatFS:      FStatFSHandler,
-	FAllocate:    FAllocateHandler,
-	ReadLinkAt:   ReadLinkAtHandler,
-	Flush:        FlushHandler,
-	UnlinkAt:     UnlinkAtHandler,
-	RenameAt:     RenameAtHandler,
-	Getdents64:   Getdents64Handler,
-	FGetXattr:    FGetXattrHandler,
-	FSetXattr:    FSetXattrHandler,
-	FListXattr:   FListXattrHandler,
-	FRemoveXattr: FRemoveXattrHandler,
-	Connect:      ConnectHandler,
-	BindAt:       BindAtHandler,
-	Listen:       ListenHandler,
-	Accept:       AcceptHandler,
+	Error:           ErrorHandler,
+	Mount:           MountHandler,
+	Channel:         ChannelHandler,
+	FStat:           FStatHandler,
+	SetStat:         SetStatHandler,
+	Walk:            WalkHandler,
+	WalkStat:        WalkStatHandler,
+	OpenAt:          OpenAtHandler,
+	OpenCreateAt:    OpenCreateAtHandler,
+	Close:           CloseHandler,
+	FSync:           FSyncHandler,
+	PWrite:          PWriteHandler,
+	PRead:           PReadHandler,
+	MkdirAt:         MkdirAtHandler,
+	MknodAt:         MknodAtHandler,
+	SymlinkAt:       SymlinkAtHandler,
+	LinkAt:          LinkAtHandler,
+	FStatFS:         FStatFSHandler,
+	FAllocate:       FAllocateHandler,
+	ReadLinkAt:      ReadLinkAtHandler,
+	Flush:           FlushHandler,
+	UnlinkAt:        UnlinkAtHandler,
+	RenameAt:        RenameAtHandler,
+	Getdents64:      Getdents64Handler,
+	FGetXattr:       FGetXattrHandler,
+	FSetXattr:       FSetXattrHandler,
+	FListXattr:      FListXattrHandler,
+	FRemoveXattr:    FRemoveXattrHandler,
+	Connect:         ConnectHandler,
+	BindAt:          BindAtHandler,
+	Listen:          ListenHandler,
+	Accept:          AcceptHandler,
+	InotifyInit:     InotifyInitHandler,
+	InotifyAddWatch: InotifyAddWatchHandler,
+	InotifyRmWatch:  InotifyRmWatchHandler,
+	SetLock:         SetLockHandler,
+	DelegationInit:  DelegationInitHandler,
+	Delegate:        DelegateHandler,
 }
 
 // ErrorHandler handles Error message.
@@ -981,6 +987,38 @@ func FAllocateHandler(c *Connection, comm Communicator, payloadLen uint32) (uint
 	})
 }
 
+// SetLockHandler handles the SetLock RPC.
+func SetLockHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req SetLockReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+	switch req.Kind {
+	case LockKindBSD, LockKindPOSIX:
+	default:
+		return 0, unix.EINVAL
+	}
+	switch req.Type {
+	case unix.F_RDLCK, unix.F_UNLCK:
+	case unix.F_WRLCK:
+		if c.readonly {
+			return 0, unix.EROFS
+		}
+	default:
+		return 0, unix.EINVAL
+	}
+
+	fd, err := c.lookupOpenFD(req.FD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+
+	return 0, fd.controlFD.safelyRead(func() error {
+		return fd.impl.SetLock(req.Kind, req.Type, req.Start, req.Length)
+	})
+}
+
 // ReadLinkAtHandler handles the ReadLinkAt RPC.
 func ReadLinkAtHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
 	var req ReadLinkAtReq
@@ -1174,6 +1212,170 @@ func AcceptHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32,
 	return respLen, nil
 }
 
+// InotifyInitHandler handles the InotifyInit RPC.
+func InotifyInitHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	impl, ok := c.server.impl.(NotifierServerImpl)
+	if !ok {
+		return 0, unix.EOPNOTSUPP
+	}
+
+	c.notifierMu.Lock()
+	defer c.notifierMu.Unlock()
+	if c.notifier != nil {
+		return 0, unix.EBUSY
+	}
+	notifier, err := impl.NewNotifier(c)
+	if err != nil {
+		return 0, err
+	}
+	// The donated FD is closed once it has been sent to the client.
+	eventFD, err := unix.Dup(notifier.EventFD())
+	if err != nil {
+		notifier.Close()
+		return 0, err
+	}
+	c.notifier = notifier
+
+	comm.DonateFD(eventFD)
+	var resp InotifyInitResp
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalBytes(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
+// InotifyAddWatchHandler handles the InotifyAddWatch RPC.
+func InotifyAddWatchHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req InotifyAddWatchReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	for _, name := range req.Path {
+		if err := checkSafeName(name); err != nil {
+			return 0, err
+		}
+	}
+
+	fd, err := c.lookupControlFD(req.FD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+	if len(req.Path) > 0 && !fd.IsDir() {
+		return 0, unix.ENOTDIR
+	}
+
+	c.notifierMu.Lock()
+	defer c.notifierMu.Unlock()
+	if c.notifier == nil {
+		return 0, unix.EINVAL
+	}
+	var wd int32
+	if err := fd.safelyRead(func() error {
+		wd, err = c.notifier.AddWatch(fd.impl, req.Path, uint32(req.Mask))
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	resp := InotifyAddWatchResp{WD: wd}
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalUnsafe(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
+// InotifyRmWatchHandler handles the InotifyRmWatch RPC.
+func InotifyRmWatchHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req InotifyRmWatchReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	c.notifierMu.Lock()
+	defer c.notifierMu.Unlock()
+	if c.notifier == nil {
+		return 0, unix.EINVAL
+	}
+	if err := c.notifier.RmWatch(req.WD); err != nil {
+		return 0, err
+	}
+
+	var resp InotifyRmWatchResp
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalBytes(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
+// DelegationInitHandler handles the DelegationInit RPC.
+func DelegationInitHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	impl, ok := c.server.impl.(DelegatorServerImpl)
+	if !ok {
+		return 0, unix.EOPNOTSUPP
+	}
+
+	c.delegatorMu.Lock()
+	defer c.delegatorMu.Unlock()
+	if c.delegator != nil {
+		return 0, unix.EBUSY
+	}
+	delegator, err := impl.NewDelegator(c)
+	if err != nil {
+		return 0, err
+	}
+	// The donated FD is closed once it has been sent to the client.
+	recallFD, err := unix.Dup(delegator.RecallFD())
+	if err != nil {
+		delegator.Close()
+		return 0, err
+	}
+	c.delegator = delegator
+
+	comm.DonateFD(recallFD)
+	var resp DelegationInitResp
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalBytes(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
+// DelegateHandler handles the Delegate RPC.
+func DelegateHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req DelegateReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+	switch req.Type {
+	case unix.F_RDLCK, unix.F_UNLCK:
+	case unix.F_WRLCK:
+		if c.readonly {
+			return 0, unix.EROFS
+		}
+	default:
+		return 0, unix.EINVAL
+	}
+
+	fd, err := c.lookupOpenFD(req.FD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+
+	c.delegatorMu.Lock()
+	defer c.delegatorMu.Unlock()
+	if c.delegator == nil {
+		return 0, unix.EINVAL
+	}
+	if err := fd.controlFD.safelyRead(func() error {
+		return c.delegator.Delegate(fd.impl, req.FD, req.Type)
+	}); err != nil {
+		return 0, err
+	}
+
+	var resp DelegateResp
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalBytes(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
 // UnlinkAtHandler handles the UnlinkAt RPC.
 func UnlinkAtHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
 	if c.readonly {
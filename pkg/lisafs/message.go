@@ -172,6 +172,29 @@ const (
 
 	// Accept is analogous to accept4(2).
 	Accept MID = 31
+
+	// InotifyInit is loosely analogous to inotify_init1(2). The server starts
+	// forwarding host filesystem events for this connection and donates the
+	// FD on which events are delivered.
+	InotifyInit MID = 32
+
+	// InotifyAddWatch is analogous to inotify_add_watch(2).
+	InotifyAddWatch MID = 33
+
+	// InotifyRmWatch is analogous to inotify_rm_watch(2).
+	InotifyRmWatch MID = 34
+
+	// SetLock is loosely analogous to non-blocking flock(2) and
+	// fcntl(F_OFD_SETLK). It takes an advisory lock on the host file.
+	SetLock MID = 35
+
+	// DelegationInit starts the delivery of delegation recalls for this
+	// connection. The server donates the FD on which recalls are delivered.
+	DelegationInit MID = 36
+
+	// Delegate is loosely analogous to fcntl(F_SETLEASE). It acquires,
+	// downgrades or returns a delegation on the file backing an open FD.
+	Delegate MID = 37
 )
 
 const (
@@ -1236,6 +1259,43 @@ func (*FAllocateResp) String() string {
 	return "FAllocateResp{}"
 }
 
+// Lock kinds used in SetLockReq.
+const (
+	// LockKindBSD is a whole-file lock, as taken by flock(2).
+	LockKindBSD = 0
+
+	// LockKindPOSIX is a byte-range lock, as taken by fcntl(2).
+	LockKindPOSIX = 1
+)
+
+// SetLockReq is used to take or release a lock on an open FD. Type is one of
+// F_RDLCK, F_WRLCK and F_UNLCK. Start and Length are only used for
+// LockKindPOSIX locks, where a Length of 0 extends the lock to the end of the
+// file. This has no response. If the lock conflicts with a lock held through
+// another open FD, the request fails with EAGAIN.
+//
+// +marshal boundCheck
+type SetLockReq struct {
+	FD     FDID
+	Kind   uint32
+	Type   uint32
+	Start  uint64
+	Length uint64
+}
+
+// String implements fmt.Stringer.String.
+func (l *SetLockReq) String() string {
+	return fmt.Sprintf("SetLockReq{FD: %d, Kind: %d, Type: %d, Start: %d, Length: %d}", l.FD, l.Kind, l.Type, l.Start, l.Length)
+}
+
+// SetLockResp is an empty response to SetLockReq.
+type SetLockResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*SetLockResp) String() string {
+	return "SetLockResp{}"
+}
+
 // ReadLinkAtReq is used to readlinkat(2) at the specified FD.
 //
 // +marshal boundCheck
@@ -1852,3 +1912,171 @@ func (l *FListXattrResp) MarshalBytes(dst []byte) []byte {
 func (l *FListXattrResp) CheckedUnmarshal(src []byte) ([]byte, bool) {
 	return l.Xattrs.CheckedUnmarshal(src)
 }
+
+// InotifyInitReq is an empty request to InotifyInit.
+type InotifyInitReq struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*InotifyInitReq) String() string {
+	return "InotifyInitReq{}"
+}
+
+// InotifyInitResp is an empty response to InotifyInit. The server donates the
+// read end of the event FD, from which the client reads InotifyEvents.
+type InotifyInitResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*InotifyInitResp) String() string {
+	return "InotifyInitResp{}"
+}
+
+// InotifyAddWatchReq is used to make InotifyAddWatch requests. The watched
+// file is at Path relative to FD. If Path is empty, FD itself is watched.
+type InotifyAddWatchReq struct {
+	FD   FDID
+	Mask primitive.Uint32
+	Path StringArray
+}
+
+// String implements fmt.Stringer.String.
+func (i *InotifyAddWatchReq) String() string {
+	return fmt.Sprintf("InotifyAddWatchReq{FD: %d, Mask: %#x, Path: %s}", i.FD, i.Mask, i.Path.String())
+}
+
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (i *InotifyAddWatchReq) SizeBytes() int {
+	return i.FD.SizeBytes() + i.Mask.SizeBytes() + i.Path.SizeBytes()
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (i *InotifyAddWatchReq) MarshalBytes(dst []byte) []byte {
+	dst = i.FD.MarshalUnsafe(dst)
+	dst = i.Mask.MarshalUnsafe(dst)
+	return i.Path.MarshalBytes(dst)
+}
+
+// CheckedUnmarshal implements marshal.CheckedMarshallable.CheckedUnmarshal.
+func (i *InotifyAddWatchReq) CheckedUnmarshal(src []byte) ([]byte, bool) {
+	i.Path = i.Path[:0]
+	if i.SizeBytes() > len(src) {
+		return src, false
+	}
+	srcRemain := i.FD.UnmarshalUnsafe(src)
+	srcRemain = i.Mask.UnmarshalUnsafe(srcRemain)
+	if srcRemain, ok := i.Path.CheckedUnmarshal(srcRemain); ok {
+		return srcRemain, true
+	}
+	return src, false
+}
+
+// InotifyAddWatchResp is the response to a successful InotifyAddWatch request.
+//
+// +marshal boundCheck
+type InotifyAddWatchResp struct {
+	WD int32
+	_  uint32
+}
+
+// String implements fmt.Stringer.String.
+func (i *InotifyAddWatchResp) String() string {
+	return fmt.Sprintf("InotifyAddWatchResp{WD: %d}", i.WD)
+}
+
+// InotifyRmWatchReq is used to make InotifyRmWatch requests.
+//
+// +marshal boundCheck
+type InotifyRmWatchReq struct {
+	WD int32
+	_  uint32
+}
+
+// String implements fmt.Stringer.String.
+func (i *InotifyRmWatchReq) String() string {
+	return fmt.Sprintf("InotifyRmWatchReq{WD: %d}", i.WD)
+}
+
+// InotifyRmWatchResp is an empty response to InotifyRmWatch.
+type InotifyRmWatchResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*InotifyRmWatchResp) String() string {
+	return "InotifyRmWatchResp{}"
+}
+
+// InotifyEvent is the header of an event written by the server to the event
+// FD donated on InotifyInit. It has the layout of struct inotify_event and is
+// followed by NameLen bytes holding the NUL-padded name of the file that the
+// event is about, if the watched file is a directory.
+//
+// WD is the watch descriptor returned by InotifyAddWatch, or -1 for
+// IN_Q_OVERFLOW, which indicates that events were dropped because the client
+// was not reading the event FD fast enough.
+//
+// +marshal
+type InotifyEvent struct {
+	WD      int32
+	Mask    uint32
+	Cookie  uint32
+	NameLen uint32
+}
+
+// DelegationInitReq is an empty request to DelegationInit.
+type DelegationInitReq struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*DelegationInitReq) String() string {
+	return "DelegationInitReq{}"
+}
+
+// DelegationInitResp is an empty response to DelegationInit. The server
+// donates the read end of the recall FD, from which the client reads
+// DelegationRecalls.
+type DelegationInitResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*DelegationInitResp) String() string {
+	return "DelegationInitResp{}"
+}
+
+// DelegateReq is used to acquire, downgrade or return the delegation held
+// through an open FD. Type is F_RDLCK for a read delegation, which allows the
+// client to cache file data and size until another user opens the file for
+// writing; F_WRLCK for a write delegation, which also allows the client to
+// cache writes until another user opens the file at all; or F_UNLCK to return
+// the delegation. If the delegation can't be granted because of other users
+// of the file, the request fails with EAGAIN. This has no response.
+//
+// +marshal boundCheck
+type DelegateReq struct {
+	FD   FDID
+	Type uint32
+	_    uint32
+}
+
+// String implements fmt.Stringer.String.
+func (d *DelegateReq) String() string {
+	return fmt.Sprintf("DelegateReq{FD: %d, Type: %d}", d.FD, d.Type)
+}
+
+// DelegateResp is an empty response to DelegateReq.
+type DelegateResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*DelegateResp) String() string {
+	return "DelegateResp{}"
+}
+
+// DelegationRecall is written by the server to the recall FD donated on
+// DelegationInit when another user of the file conflicts with the delegation
+// held through FD. Type is the strongest delegation that the client may keep
+// (F_RDLCK or F_UNLCK). The client must stop relying on the delegation, write
+// back any cached writes, and downgrade or return the delegation with a
+// Delegate request. Read delegations are returned by the server on the
+// client's behalf when they are recalled.
+//
+// +marshal
+type DelegationRecall struct {
+	FD   FDID
+	Type uint32
+	_    uint32
+}
@@ -125,3 +125,69 @@ type ServerImpl interface {
 	// to this server implementation.
 	MaxMessageSize() uint32
 }
+
+// NotifierServerImpl is an optional interface that ServerImpls can implement
+// to forward filesystem events that happen on the host to clients. Servers
+// implementing it should list InotifyInit, InotifyAddWatch and InotifyRmWatch
+// in SupportedMessages.
+type NotifierServerImpl interface {
+	// NewNotifier creates a Notifier for c. It is called at most once per
+	// connection.
+	NewNotifier(c *Connection) (Notifier, error)
+}
+
+// Notifier watches files on the host on behalf of a connection. Events are
+// written to the event FD as InotifyEvent records, each followed by its name.
+type Notifier interface {
+	// EventFD returns the host FD from which the client reads events. The
+	// Notifier retains ownership of the FD.
+	EventFD() int
+
+	// AddWatch starts watching the file at path relative to fd, or fd itself
+	// if path is empty, for the events in mask. It returns the watch
+	// descriptor that identifies the file in events. If the file is already
+	// being watched, AddWatch returns the existing watch descriptor and
+	// replaces its mask. Path components are valid file names, but may be
+	// symlinks, which must not be followed.
+	//
+	// AddWatch has a read concurrency guarantee on fd.
+	AddWatch(fd ControlFDImpl, path StringArray, mask uint32) (int32, error)
+
+	// RmWatch stops watching the file identified by wd.
+	RmWatch(wd int32) error
+
+	// Close stops all watches and releases the resources held by the
+	// Notifier. It is called when the connection is closed.
+	Close()
+}
+
+// DelegatorServerImpl is an optional interface that ServerImpls can implement
+// to grant clients delegations on files, which let clients cache file state
+// until another user of the file conflicts with it. Servers implementing it
+// should list DelegationInit and Delegate in SupportedMessages.
+type DelegatorServerImpl interface {
+	// NewDelegator creates a Delegator for c. It is called at most once per
+	// connection.
+	NewDelegator(c *Connection) (Delegator, error)
+}
+
+// Delegator manages the delegations held by a connection. Recalls are written
+// to the recall FD as DelegationRecall records.
+type Delegator interface {
+	// RecallFD returns the host FD from which the client reads recalls. The
+	// Delegator retains ownership of the FD.
+	RecallFD() int
+
+	// Delegate acquires, downgrades or returns (if typ is F_UNLCK) the
+	// delegation held through fd, which the client refers to as id. It must
+	// not block: if the delegation conflicts with other users of the file,
+	// Delegate fails with EAGAIN. Delegations held through fd are returned
+	// when fd is closed.
+	//
+	// Delegate has a read concurrency guarantee on fd's control FD.
+	Delegate(fd OpenFDImpl, id FDID, typ uint32) error
+
+	// Close returns all delegations and releases the resources held by the
+	// Delegator. It is called when the connection is closed.
+	Close()
+}
@@ -1147,6 +1147,29 @@ func (t *TimerMetric) Start(fields ...*FieldValue) TimedOperation {
 	}
 }
 
+// hotPathTimersEnabled is set by EnableHotPathTimers.
+var hotPathTimersEnabled atomicbitops.Bool
+
+// EnableHotPathTimers makes TimerMetric.StartHotPath record samples.
+//
+// Timers on hot paths, such as syscall dispatch, are disabled by default so
+// that sandboxes which do not export metrics do not pay for them.
+func EnableHotPathTimers() {
+	hotPathTimersEnabled.Store(true)
+}
+
+// StartHotPath is like Start, but the returned TimedOperation records nothing
+// unless EnableHotPathTimers has been called.
+// +checkescape:all
+//
+//go:nosplit
+func (t *TimerMetric) StartHotPath(fields ...*FieldValue) TimedOperation {
+	if !hotPathTimersEnabled.Load() {
+		return TimedOperation{}
+	}
+	return t.Start(fields...)
+}
+
 // Finish marks an operation as finished and records its duration.
 // `extraFields` is the rest of the fields appended to the fields passed to
 // `TimerMetric.Start`. The concatenation of these two must be the exact
@@ -1155,6 +1178,10 @@ func (t *TimerMetric) Start(fields ...*FieldValue) TimedOperation {
 //
 //go:nosplit
 func (o TimedOperation) Finish(extraFields ...*FieldValue) {
+	if o.metric == nil {
+		// Returned by StartHotPath while hot path timers are disabled.
+		return
+	}
 	ended := CheapNowNano()
 	fieldKey := o.metric.fieldsToKey.lookupConcat(o.partialFields, extraFields)
 	o.metric.addSampleByKey(ended-o.startedNs, fieldKey)
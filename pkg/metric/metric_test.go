@@ -748,6 +748,40 @@ func TestTimerMetric(t *testing.T) {
 	verifyPrometheusParsing(t)
 }
 
+func TestTimerMetricHotPath(t *testing.T) {
+	defer resetTest()
+	timer, err := NewTimerMetric("/timer", NewDurationBucketer(5, time.Microsecond, time.Second), "a hot path timer metric")
+	if err != nil {
+		t.Fatalf("NewTimerMetric: %v", err)
+	}
+	if err := Initialize(); err != nil {
+		t.Fatalf("Initialize(): %s", err)
+	}
+	// Don't care about the registration metrics.
+	emitter.Reset()
+
+	timer.StartHotPath().Finish()
+	EnableHotPathTimers()
+	timer.StartHotPath().Finish()
+	timer.StartHotPath().Finish()
+	EmitMetricUpdate()
+	if len(emitter) != 1 {
+		t.Fatalf("EmitMetricUpdate emitted %d events want %d", len(emitter), 1)
+	}
+	m := emitter[0].(*pb.MetricUpdate).Metrics[0]
+	dv, ok := m.Value.(*pb.MetricValue_DistributionValue)
+	if !ok {
+		t.Fatalf("%+v: want pb.MetricValue_DistributionValue", m)
+	}
+	var total uint64
+	for _, s := range dv.DistributionValue.GetNewSamples() {
+		total += s
+	}
+	if total != 2 {
+		t.Errorf("%+v: got %d samples, want 2", dv.DistributionValue, total)
+	}
+}
+
 func TestBucketer(t *testing.T) {
 	for _, test := range []struct {
 		name                    string
@@ -52,6 +52,7 @@ func init() {
 
 func resetTest() {
 	initialized.Store(false)
+	hotPathTimersEnabled.Store(false)
 	allMetrics = makeMetricSet()
 	emitter.Reset()
 }
@@ -40,6 +40,10 @@ const (
 	IterationIDLabel = "iteration"
 )
 
+// ContainerIDLabel is the Prometheus label name used to identify a container
+// within a sandbox.
+const ContainerIDLabel = "container"
+
 // Type is a Prometheus metric type.
 type Type int
 
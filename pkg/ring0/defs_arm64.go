@@ -19,6 +19,7 @@ package ring0
 
 import (
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
 )
 
 const (
@@ -139,4 +140,8 @@ type SwitchArchOpts struct {
 
 	// KernelASID indicates that the kernel ASID to be used on return,
 	KernelASID uint16
+
+	// PACKeys are the application's pointer authentication keys, or nil
+	// if pointer authentication is not enabled.
+	PACKeys *arch.PACKeys
 }
@@ -67,6 +67,9 @@ func IsCanonical(addr uint64) bool {
 func (c *CPU) SwitchToUser(switchOpts SwitchOpts) (vector Vector) {
 	storeAppASID(uintptr(switchOpts.UserASID))
 	storeEl0Fpstate(switchOpts.FloatingPointState.BytePointer())
+	if switchOpts.PACKeys != nil {
+		loadPACKeys(switchOpts.PACKeys)
+	}
 
 	if switchOpts.Flush {
 		LocalFlushTlbByASID(uintptr(switchOpts.UserASID))
@@ -17,12 +17,19 @@
 
 package ring0
 
+import (
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+)
+
 // storeEl0Fpstate writes the address of application's fpstate.
 func storeEl0Fpstate(value *byte)
 
 // storeAppASID writes the application's asid value.
 func storeAppASID(asid uintptr)
 
+// loadPACKeys loads the application's pointer authentication keys.
+func loadPACKeys(keys *arch.PACKeys)
+
 // LocalFlushTlbAll same as FlushTlbAll, but only applies to the calling CPU.
 func LocalFlushTlbAll()
 
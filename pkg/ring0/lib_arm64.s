@@ -186,3 +186,25 @@ TEXT ·SaveFloatingPoint(SB),NOSPLIT,$0-8
 	WORD $0xad0f7c1e       //  stp	q30, q31, [x0, #480]
 
 	RET
+
+// loadPACKeys loads the pointer authentication keys. The new keys take effect
+// at the exception return to the application, which is a context
+// synchronization event.
+TEXT ·loadPACKeys(SB),NOSPLIT,$0-8
+	MOVD keys+0(FP), R0
+	LDP 0(R0), (R1, R2)
+	WORD $0xd5182101	// MSR R1, APIAKEYLO_EL1
+	WORD $0xd5182122	// MSR R2, APIAKEYHI_EL1
+	LDP 16(R0), (R1, R2)
+	WORD $0xd5182141	// MSR R1, APIBKEYLO_EL1
+	WORD $0xd5182162	// MSR R2, APIBKEYHI_EL1
+	LDP 32(R0), (R1, R2)
+	WORD $0xd5182201	// MSR R1, APDAKEYLO_EL1
+	WORD $0xd5182222	// MSR R2, APDAKEYHI_EL1
+	LDP 48(R0), (R1, R2)
+	WORD $0xd5182241	// MSR R1, APDBKEYLO_EL1
+	WORD $0xd5182262	// MSR R2, APDBKEYHI_EL1
+	LDP 64(R0), (R1, R2)
+	WORD $0xd5182301	// MSR R1, APGAKEYLO_EL1
+	WORD $0xd5182322	// MSR R2, APGAKEYHI_EL1
+	RET
@@ -19,6 +19,7 @@ package seccomp
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/bpf"
@@ -55,6 +56,13 @@ func NonNegativeFDCheck() LessThanOrEqual {
 // However, it will leave a SECCOMP audit event trail behind. In any case, the
 // syscall is still blocked from executing.
 func Install(rules SyscallRules, denyRules SyscallRules) error {
+	return InstallCached(rules, denyRules, nil)
+}
+
+// InstallCached is like Install, but the program is looked up in cache before
+// it's built, and added to cache once built. Building the program is the most
+// expensive part of installing filters with many rules. cache may be nil.
+func InstallCached(rules SyscallRules, denyRules SyscallRules, cache ProgramCache) error {
 	defaultAction, err := defaultAction()
 	if err != nil {
 		return err
@@ -62,30 +70,46 @@ func Install(rules SyscallRules, denyRules SyscallRules) error {
 
 	// ***   DEBUG TIP   ***
 	// If you suspect the process is getting killed due to a seccomp violation, uncomment the line
-	// below to get a panic stack trace when there is a violation.
+	// below to get a panic stack trace when there is a violation. The
+	// subsystems that allow the offending syscall are then listed by
+	// `rules.Provenance(sysno)`, and the instructions checking its arguments
+	// are attributed to them in the program dump logged below.
 	// defaultAction = linux.BPFAction(linux.SECCOMP_RET_TRAP)
 
 	log.Infof("Installing seccomp filters for %d syscalls (action=%v)", len(rules), defaultAction)
 
-	instrs, err := BuildProgram([]RuleSet{
-		{
-			Rules:  denyRules,
-			Action: defaultAction,
-		},
-		{
-			Rules:  rules,
-			Action: linux.SECCOMP_RET_ALLOW,
-		},
-	}, defaultAction, defaultAction)
-	if log.IsLogging(log.Debug) {
-		programStr, errDecode := bpf.DecodeInstructions(instrs)
-		if errDecode != nil {
-			programStr = fmt.Sprintf("Error: %v\n%s", errDecode, programStr)
-		}
-		log.Debugf("Seccomp program dump:\n%s", programStr)
+	var key string
+	var instrs []bpf.Instruction
+	if cache != nil {
+		key = ProgramKey(rules, denyRules, defaultAction)
+		instrs = loadCachedProgram(cache, key)
 	}
-	if err != nil {
-		return err
+	if instrs == nil {
+		program, err := BuildAnnotatedProgram([]RuleSet{
+			{
+				Rules:  denyRules,
+				Action: defaultAction,
+			},
+			{
+				Rules:  rules,
+				Action: linux.SECCOMP_RET_ALLOW,
+			},
+		}, defaultAction, defaultAction)
+		if log.IsLogging(log.Debug) && program != nil {
+			log.Debugf("Seccomp program dump:\n%s", program)
+		}
+		if err != nil {
+			return err
+		}
+		if subsystems := program.Subsystems(); len(subsystems) > 0 {
+			log.Infof("Seccomp filters include rules from: %s", strings.Join(subsystems, ", "))
+		}
+		instrs = program.Instructions
+		if cache != nil {
+			if err := cache.Store(key, instrs); err != nil {
+				log.Warningf("Failed to cache seccomp program %s: %v", key, err)
+			}
+		}
 	}
 
 	// Perform the actual installation.
@@ -110,7 +134,10 @@ func defaultAction() (linux.BPFAction, error) {
 
 // RuleSet is a set of rules and associated action.
 type RuleSet struct {
-	Rules  SyscallRules
+	Rules SyscallRules
+
+	// Action is the action to take when a rule matches, unless the rule
+	// overrides it with WithAction.
 	Action linux.BPFAction
 
 	// Vsyscall indicates that a check is made for a function being called
@@ -132,6 +159,10 @@ var SyscallName = func(sysno uintptr) string {
 type syscallProgram struct {
 	// program is the underlying BPF program being built.
 	program *bpf.ProgramBuilder
+
+	// annotations are the ranges of instructions rendered from `Annotated`
+	// rules, in the order the rules were rendered.
+	annotations []annotation
 }
 
 // Stmt adds a statement to the program.
@@ -272,6 +303,19 @@ func (l *labelSet) Push(labelSuffix string, newRuleMatch, newRuleMismatch label)
 // BuildProgram builds a BPF program from the given map of actions to matching
 // SyscallRules. The single generated program covers all provided RuleSets.
 func BuildProgram(rules []RuleSet, defaultAction, badArchAction linux.BPFAction) ([]bpf.Instruction, error) {
+	program, err := BuildAnnotatedProgram(rules, defaultAction, badArchAction)
+	if program == nil {
+		return nil, err
+	}
+	return program.Instructions, err
+}
+
+// BuildAnnotatedProgram is like BuildProgram, but also returns the
+// provenance of the instructions rendered from `Annotated` rules.
+//
+// If the program fails to build after rules are rendered, the returned
+// Program holds the unoptimized instructions along with the error.
+func BuildAnnotatedProgram(rules []RuleSet, defaultAction, badArchAction linux.BPFAction) (*Program, error) {
 	program := &syscallProgram{
 		program: bpf.NewProgramBuilder(),
 	}
@@ -297,13 +341,13 @@ func BuildProgram(rules []RuleSet, defaultAction, badArchAction linux.BPFAction)
 
 	insns, err := program.program.Instructions()
 	if err != nil {
-		return insns, err
+		return &Program{Instructions: insns}, err
 	}
 	beforeOpt := len(insns)
-	insns = bpf.Optimize(insns)
-	afterOpt := len(insns)
+	p := newProgram(insns, program.annotations)
+	afterOpt := len(p.Instructions)
 	log.Debugf("Seccomp program optimized from %d to %d instructions", beforeOpt, afterOpt)
-	return insns, nil
+	return p, nil
 }
 
 // buildIndex builds a BST to quickly search through all syscalls.
@@ -425,10 +469,34 @@ func buildBSTProgram(n *node, rules []RuleSet, program *syscallProgram) error {
 		// check the next rule set. We need to ensure
 		// that at the very end, we insert a direct
 		// jump label for the unmatched case.
-		rule.Render(program, ruleSetLabelSet)
-		frag.MustHaveJumpedTo(ruleSetLabelSet.Matched(), ruleSetLabelSet.Mismatched())
-		program.Label(ruleSetLabelSet.Matched())
-		program.Ret(rs.Action)
+		groups := actionGroups(rule, rs.Action)
+		if len(groups) == 1 {
+			groups[0].rule.Render(program, ruleSetLabelSet)
+			frag.MustHaveJumpedTo(ruleSetLabelSet.Matched(), ruleSetLabelSet.Mismatched())
+			program.Label(ruleSetLabelSet.Matched())
+			program.Ret(groups[0].action)
+		} else {
+			// Some rules override the rule set's action.
+			// Render each group of rules separately; a
+			// group returns its own action if it matches,
+			// and moves on to the next group otherwise.
+			nextGroup := ruleSetLabelSet.NewLabel()
+			program.JumpTo(nextGroup)
+			frag.MustHaveJumpedTo(nextGroup, ruleSetLabelSet.Mismatched())
+			for i, group := range groups {
+				program.Label(nextGroup)
+				nextGroup = ruleSetLabelSet.Mismatched()
+				if i < len(groups)-1 {
+					nextGroup = ruleSetLabelSet.NewLabel()
+				}
+				groupLabelSet := ruleSetLabelSet.Push(fmt.Sprintf("action[%d]", i), ruleSetLabelSet.NewLabel(), nextGroup)
+				groupFrag := program.Record()
+				group.rule.Render(program, groupLabelSet)
+				groupFrag.MustHaveJumpedTo(groupLabelSet.Matched(), groupLabelSet.Mismatched())
+				program.Label(groupLabelSet.Matched())
+				program.Ret(group.action)
+			}
+		}
 		program.Label(ruleSetLabelSet.Mismatched())
 	}
 	program.JumpTo(defaultLabel)
@@ -0,0 +1,62 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// ProgramCache stores the programs built by InstallCached, so that processes
+// installing the same rules don't have to build the program again.
+//
+// The cache must only be writable by processes that are trusted to install
+// filters, since a cached program is installed as is.
+type ProgramCache interface {
+	// Load returns the program cached under key, or false if there is none.
+	Load(key string) ([]bpf.Instruction, bool)
+
+	// Store caches program under key.
+	Store(key string, program []bpf.Instruction) error
+}
+
+// ProgramKey returns the key under which the program built from rules and
+// denyRules, with the given default action, is cached. Keys only depend on
+// the rules and the architecture, so they are stable across processes.
+func ProgramKey(rules, denyRules SyscallRules, defaultAction linux.BPFAction) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "arch: %#x\naction: %#x\ndeny:\n%v\nallow:\n%v\n", LINUX_AUDIT_ARCH, uint32(defaultAction), denyRules, rules)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadCachedProgram returns the program cached under key, or nil if there is
+// none or it isn't valid.
+func loadCachedProgram(cache ProgramCache, key string) []bpf.Instruction {
+	instrs, ok := cache.Load(key)
+	if !ok {
+		return nil
+	}
+	if _, err := bpf.Compile(instrs); err != nil {
+		log.Warningf("Ignoring invalid cached seccomp program %s: %v", key, err)
+		return nil
+	}
+	log.Infof("Using cached seccomp program %s (%d instructions)", key, len(instrs))
+	return instrs
+}
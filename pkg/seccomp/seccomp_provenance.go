@@ -0,0 +1,228 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/bpf"
+)
+
+// Provenance describes where a rule comes from, so that the instructions
+// it is rendered into can be attributed to it.
+type Provenance struct {
+	// Subsystem is the name of the subsystem that added the rule, e.g.
+	// "hostinet" or "nvproxy".
+	Subsystem string
+
+	// File and Line are the location where the rule was annotated.
+	File string
+	Line int
+
+	// Rationale explains why the rule is needed.
+	Rationale string
+}
+
+// String returns a human-readable representation of the provenance.
+func (p Provenance) String() string {
+	var sb strings.Builder
+	sb.WriteString(p.Subsystem)
+	if p.Rationale != "" {
+		sb.WriteString(": ")
+		sb.WriteString(p.Rationale)
+	}
+	if p.File != "" {
+		fmt.Fprintf(&sb, " (%s:%d)", filepath.Base(p.File), p.Line)
+	}
+	return sb.String()
+}
+
+// callerProvenance returns a Provenance with the file and line of the caller
+// of the function calling callerProvenance.
+func callerProvenance(subsystem, rationale string) Provenance {
+	p := Provenance{
+		Subsystem: subsystem,
+		Rationale: rationale,
+	}
+	if _, file, line, ok := runtime.Caller(2); ok {
+		p.File = file
+		p.Line = line
+	}
+	return p
+}
+
+// Annotated is a `SyscallRule` that attaches a `Provenance` to another rule.
+// It matches exactly what `Rule` matches.
+type Annotated struct {
+	Rule   SyscallRule
+	Source Provenance
+}
+
+// Annotate returns `rule` annotated with the given subsystem and rationale,
+// and the file and line of the caller.
+func Annotate(rule SyscallRule, subsystem, rationale string) Annotated {
+	return Annotated{
+		Rule:   rule,
+		Source: callerProvenance(subsystem, rationale),
+	}
+}
+
+// Render implements `SyscallRule.Render`.
+//
+// The range of instructions that `Rule` is rendered into is recorded, so
+// that the program built from it can attribute them to `Source`.
+func (a Annotated) Render(program *syscallProgram, labelSet *labelSet) {
+	frag := program.Record()
+	// Add the annotation before rendering `Rule`, so that annotations of
+	// enclosing rules are recorded before those of nested ones.
+	i := len(program.annotations)
+	program.annotations = append(program.annotations, annotation{source: a.Source})
+	a.Rule.Render(program, labelSet)
+	program.annotations[i].fromPC, program.annotations[i].toPC = frag.getFragment().Range()
+}
+
+// String implements `SyscallRule.String`.
+func (a Annotated) String() string {
+	return fmt.Sprintf("%v /* %v */", a.Rule, a.Source)
+}
+
+// Annotate returns a copy of `sr` in which each rule is annotated with the
+// given subsystem and rationale, and the file and line of the caller.
+func (sr SyscallRules) Annotate(subsystem, rationale string) SyscallRules {
+	source := callerProvenance(subsystem, rationale)
+	annotated := make(SyscallRules, len(sr))
+	for sysno, rule := range sr {
+		annotated[sysno] = Annotated{Rule: rule, Source: source}
+	}
+	return annotated
+}
+
+// Provenance returns the provenance of the annotated rules for the given
+// syscall, outermost first, or nil if there are none. It can be used to
+// attribute a seccomp violation to the subsystems that allow the syscall.
+func (sr SyscallRules) Provenance(sysno uintptr) []Provenance {
+	rule, ok := sr[sysno]
+	if !ok {
+		return nil
+	}
+	var sources []Provenance
+	var walk func(rule SyscallRule)
+	walk = func(rule SyscallRule) {
+		switch r := rule.(type) {
+		case Annotated:
+			sources = append(sources, r.Source)
+			walk(r.Rule)
+		case WithAction:
+			walk(r.Rule)
+		case Or:
+			for _, subRule := range r {
+				walk(subRule)
+			}
+		}
+	}
+	walk(rule)
+	return sources
+}
+
+// annotation is a range of instructions rendered from an `Annotated` rule.
+type annotation struct {
+	// fromPC and toPC are the index of the first instruction of the range,
+	// and the index after its last instruction.
+	fromPC int
+	toPC   int
+
+	// source is the provenance of the rule.
+	source Provenance
+}
+
+// Program is a BPF program built from syscall rules, along with the
+// provenance of its instructions.
+type Program struct {
+	// Instructions are the instructions of the program.
+	Instructions []bpf.Instruction
+
+	// Provenance maps the index of an instruction to the provenance of the
+	// `Annotated` rules it was rendered from, outermost first. Instructions
+	// that were not rendered from annotated rules have no entry. Rules may
+	// have no instructions left after optimization, e.g. `MatchAll`.
+	Provenance map[int][]Provenance
+}
+
+// newProgram returns a Program for the unoptimized `insns` with the given
+// annotations, optimizing it in the process. Provenance is carried through
+// optimizations: an optimized instruction is attributed to the rules of the
+// instruction it originates from.
+func newProgram(insns []bpf.Instruction, annotations []annotation) *Program {
+	unoptimized := make(map[int][]Provenance)
+	for _, a := range annotations {
+		for pc := a.fromPC; pc < a.toPC; pc++ {
+			unoptimized[pc] = append(unoptimized[pc], a.source)
+		}
+	}
+	insns, origins := bpf.OptimizeWithOrigins(insns)
+	p := &Program{
+		Instructions: insns,
+		Provenance:   make(map[int][]Provenance),
+	}
+	for pc, origin := range origins {
+		if sources, ok := unoptimized[origin]; ok {
+			p.Provenance[pc] = sources
+		}
+	}
+	return p
+}
+
+// Subsystems returns the sorted list of subsystems that the instructions of
+// the program are attributed to.
+func (p *Program) Subsystems() []string {
+	set := make(map[string]struct{})
+	for _, sources := range p.Provenance {
+		for _, source := range sources {
+			set[source.Subsystem] = struct{}{}
+		}
+	}
+	subsystems := make([]string, 0, len(set))
+	for subsystem := range set {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+	return subsystems
+}
+
+// String returns a dump of the program, in which each instruction is
+// followed by the provenance of the rules it was rendered from, if any.
+func (p *Program) String() string {
+	dump, err := bpf.DecodeInstructions(p.Instructions)
+	if err != nil {
+		return fmt.Sprintf("Error: %v\n%s", err, dump)
+	}
+	var sb strings.Builder
+	for pc, line := range strings.Split(strings.TrimSuffix(dump, "\n"), "\n") {
+		sb.WriteString(line)
+		if sources := p.Provenance[pc]; len(sources) > 0 {
+			strs := make([]string, len(sources))
+			for i, source := range sources {
+				strs[i] = source.String()
+			}
+			fmt.Fprintf(&sb, " ; %s", strings.Join(strs, " > "))
+		}
+		sb.WriteRune('\n')
+	}
+	return sb.String()
+}
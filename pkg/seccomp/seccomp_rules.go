@@ -21,6 +21,7 @@ import (
 	"strings"
 
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/bpf"
 )
 
@@ -180,12 +181,112 @@ func (or Or) String() string {
 	}
 }
 
+// WithAction expresses a rule that, when it matches, returns its own action
+// instead of the action of the `RuleSet` it is part of. This allows rules for
+// the same syscall to result in different actions, e.g. SECCOMP_RET_TRAP or
+// SECCOMP_RET_ERRNO with distinct return codes, so that a violation can be
+// told apart from others by its si_errno or errno.
+//
+// Rules are evaluated in order, and the first one that matches determines the
+// action. If `WithAction` rules are nested, the innermost action applies.
+type WithAction struct {
+	Rule   SyscallRule
+	Action linux.BPFAction
+}
+
+// Render implements `SyscallRule.Render`.
+//
+// The action is applied by the program builder, which splits each syscall's
+// rules into groups of consecutive rules with the same action; see
+// `actionGroups`. Rendered on its own, `WithAction` behaves like `Rule`.
+func (wa WithAction) Render(program *syscallProgram, labelSet *labelSet) {
+	wa.Rule.Render(program, labelSet)
+}
+
+// String implements `SyscallRule.String`.
+func (wa WithAction) String() string {
+	return fmt.Sprintf("(%v => %v)", wa.Rule, wa.Action)
+}
+
+// actionGroup is a rule and the action to take if it matches.
+type actionGroup struct {
+	rule   SyscallRule
+	action linux.BPFAction
+}
+
+// actionGroups splits `rule` into an ordered list of rules with the action
+// each of them results in, given that `rule` results in `action` unless
+// overridden by `WithAction`. Consecutive rules with the same action are
+// merged, so a rule without `WithAction` results in a single group.
+func actionGroups(rule SyscallRule, action linux.BPFAction) []actionGroup {
+	switch r := rule.(type) {
+	case WithAction:
+		return actionGroups(r.Rule, r.Action)
+	case Annotated:
+		// Keep the provenance of each group.
+		groups := actionGroups(r.Rule, action)
+		for i := range groups {
+			groups[i].rule = Annotated{Rule: groups[i].rule, Source: r.Source}
+		}
+		return groups
+	case Or:
+		var (
+			groups []actionGroup
+			rules  [][]SyscallRule
+		)
+		for _, subRule := range r {
+			for _, g := range actionGroups(subRule, action) {
+				if last := len(groups) - 1; last >= 0 && groups[last].action == g.action {
+					rules[last] = append(rules[last], g.rule)
+					continue
+				}
+				groups = append(groups, g)
+				rules = append(rules, []SyscallRule{g.rule})
+			}
+		}
+		if len(groups) == 0 {
+			// An empty Or matches nothing.
+			return []actionGroup{{rule: r, action: action}}
+		}
+		for i := range groups {
+			if len(rules[i]) > 1 {
+				groups[i].rule = Or(rules[i])
+			}
+		}
+		return groups
+	default:
+		return []actionGroup{{rule: rule, action: action}}
+	}
+}
+
+// hasAction returns true if `rule` contains a `WithAction` rule.
+func hasAction(rule SyscallRule) bool {
+	switch r := rule.(type) {
+	case WithAction:
+		return true
+	case Annotated:
+		return hasAction(r.Rule)
+	case Or:
+		for _, subRule := range r {
+			if hasAction(subRule) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // merge merges `rule1` and `rule2`, simplifying `MatchAll` and `Or` rules.
+//
+// `rule1` is evaluated before `rule2`, which matters when they carry distinct
+// actions using `WithAction`.
 func merge(rule1, rule2 SyscallRule) SyscallRule {
-	_, rule1IsMatchAll := rule1.(MatchAll)
-	_, rule2IsMatchAll := rule2.(MatchAll)
-	if rule1IsMatchAll || rule2IsMatchAll {
-		return MatchAll{}
+	// Keep the provenance of the rule that matches everything, if any.
+	if isMatchAll(rule1) {
+		return rule1
+	}
+	if isMatchAll(rule2) && !hasAction(rule1) {
+		return rule2
 	}
 	rule1Or, rule1IsOr := rule1.(Or)
 	rule2Or, rule2IsOr := rule2.(Or)
@@ -196,11 +297,22 @@ func merge(rule1, rule2 SyscallRule) SyscallRule {
 		return append(rule1Or, rule2)
 	}
 	if rule2IsOr {
-		return append(rule2Or, rule1)
+		return append(Or{rule1}, rule2Or...)
 	}
 	return Or{rule1, rule2}
 }
 
+// isMatchAll returns true if `rule` is `MatchAll`, possibly annotated.
+func isMatchAll(rule SyscallRule) bool {
+	switch r := rule.(type) {
+	case MatchAll:
+		return true
+	case Annotated:
+		return isMatchAll(r.Rule)
+	}
+	return false
+}
+
 // PerArg implements SyscallRule and verifies the syscall arguments and RIP.
 //
 // For example:
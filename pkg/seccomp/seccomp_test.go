@@ -875,6 +875,66 @@ func TestBasic(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Per-rule actions",
+			ruleSets: []RuleSet{
+				{
+					Rules: SyscallRules{
+						1: Or{
+							PerArg{EqualTo(0x1)},
+							WithAction{
+								Rule:   PerArg{EqualTo(0x2)},
+								Action: linux.SECCOMP_RET_TRAP.WithReturnCode(2),
+							},
+							WithAction{
+								Rule:   PerArg{EqualTo(0x3)},
+								Action: linux.SECCOMP_RET_ERRNO.WithReturnCode(3),
+							},
+							PerArg{EqualTo(0x4)},
+						},
+						2: WithAction{
+							Rule:   MatchAll{},
+							Action: linux.SECCOMP_RET_TRAP.WithReturnCode(5),
+						},
+					},
+					Action: linux.SECCOMP_RET_ALLOW,
+				},
+			},
+			defaultAction: linux.SECCOMP_RET_TRAP,
+			badArchAction: linux.SECCOMP_RET_KILL_THREAD,
+			specs: []spec{
+				{
+					desc: "ruleset action before override",
+					data: linux.SeccompData{Nr: 1, Arch: LINUX_AUDIT_ARCH, Args: [6]uint64{0x1}},
+					want: linux.SECCOMP_RET_ALLOW,
+				},
+				{
+					desc: "trap with si_errno",
+					data: linux.SeccompData{Nr: 1, Arch: LINUX_AUDIT_ARCH, Args: [6]uint64{0x2}},
+					want: linux.SECCOMP_RET_TRAP.WithReturnCode(2),
+				},
+				{
+					desc: "errno",
+					data: linux.SeccompData{Nr: 1, Arch: LINUX_AUDIT_ARCH, Args: [6]uint64{0x3}},
+					want: linux.SECCOMP_RET_ERRNO.WithReturnCode(3),
+				},
+				{
+					desc: "ruleset action after override",
+					data: linux.SeccompData{Nr: 1, Arch: LINUX_AUDIT_ARCH, Args: [6]uint64{0x4}},
+					want: linux.SECCOMP_RET_ALLOW,
+				},
+				{
+					desc: "no rule matched",
+					data: linux.SeccompData{Nr: 1, Arch: LINUX_AUDIT_ARCH, Args: [6]uint64{0x5}},
+					want: linux.SECCOMP_RET_TRAP,
+				},
+				{
+					desc: "whole syscall overridden",
+					data: linux.SeccompData{Nr: 2, Arch: LINUX_AUDIT_ARCH},
+					want: linux.SECCOMP_RET_TRAP.WithReturnCode(5),
+				},
+			},
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			instrs, err := BuildProgram(test.ruleSets, test.defaultAction, test.badArchAction)
@@ -1019,6 +1079,24 @@ func TestMerge(t *testing.T) {
 			merge: MatchAll{},
 			want:  MatchAll{},
 		},
+		{
+			name:  "WithAction and AllowAll",
+			main:  WithAction{Rule: PerArg{EqualTo(0)}, Action: linux.SECCOMP_RET_TRAP},
+			merge: MatchAll{},
+			want:  Or{WithAction{Rule: PerArg{EqualTo(0)}, Action: linux.SECCOMP_RET_TRAP}, MatchAll{}},
+		},
+		{
+			name:  "Annotated AllowAll and Or",
+			main:  Annotated{Rule: MatchAll{}, Source: Provenance{Subsystem: "test"}},
+			merge: Or{PerArg{EqualTo(0)}},
+			want:  Annotated{Rule: MatchAll{}, Source: Provenance{Subsystem: "test"}},
+		},
+		{
+			name:  "Or and annotated AllowAll",
+			main:  Or{PerArg{EqualTo(0)}},
+			merge: Annotated{Rule: MatchAll{}, Source: Provenance{Subsystem: "test"}},
+			want:  Annotated{Rule: MatchAll{}, Source: Provenance{Subsystem: "test"}},
+		},
 		{
 			name:  "2 Ors",
 			main:  Or{PerArg{EqualTo(0)}},
@@ -1037,3 +1115,58 @@ func TestMerge(t *testing.T) {
 		})
 	}
 }
+
+// TestAnnotatedProgram checks that annotations don't change the program, and
+// that they are carried through optimizations.
+func TestAnnotatedProgram(t *testing.T) {
+	rules := SyscallRules{
+		1: PerArg{EqualTo(0)},
+		2: Or{
+			PerArg{EqualTo(1)},
+			PerArg{EqualTo(2), EqualTo(3)},
+		},
+		3: PerArg{AnyValue{}, EqualTo(4)},
+	}
+	annotated := SyscallRules{
+		1: Annotate(PerArg{EqualTo(0)}, "foo", "for testing"),
+		2: Or{
+			PerArg{EqualTo(1)},
+			Annotate(PerArg{EqualTo(2), EqualTo(3)}, "bar", ""),
+		},
+	}
+	annotated.Merge(SyscallRules{3: PerArg{AnyValue{}, EqualTo(4)}}.Annotate("baz", ""))
+
+	want, err := BuildProgram([]RuleSet{{Rules: rules, Action: linux.SECCOMP_RET_ALLOW}}, linux.SECCOMP_RET_TRAP, linux.SECCOMP_RET_KILL_THREAD)
+	if err != nil {
+		t.Fatalf("BuildProgram() got error: %v", err)
+	}
+	got, err := BuildAnnotatedProgram([]RuleSet{{Rules: annotated, Action: linux.SECCOMP_RET_ALLOW}}, linux.SECCOMP_RET_TRAP, linux.SECCOMP_RET_KILL_THREAD)
+	if err != nil {
+		t.Fatalf("BuildAnnotatedProgram() got error: %v", err)
+	}
+	if !reflect.DeepEqual(got.Instructions, want) {
+		t.Errorf("annotated program differs from the unannotated one:\n%v", got)
+	}
+
+	if subsystems := got.Subsystems(); !reflect.DeepEqual(subsystems, []string{"bar", "baz", "foo"}) {
+		t.Errorf("Subsystems() got %v, want [bar baz foo]", subsystems)
+	}
+	for pc, sources := range got.Provenance {
+		if pc >= len(got.Instructions) {
+			t.Errorf("provenance of instruction %d which is out of bounds", pc)
+		}
+		if len(sources) != 1 {
+			t.Errorf("instruction %d got provenance %v, want one source", pc, sources)
+		}
+	}
+	if dump := got.String(); !strings.Contains(dump, "foo: for testing (seccomp_test.go:") {
+		t.Errorf("program dump doesn't mention the annotation file and line:\n%s", dump)
+	}
+
+	if sources := annotated.Provenance(2); len(sources) != 1 || sources[0].Subsystem != "bar" {
+		t.Errorf("Provenance(2) got %v, want bar", sources)
+	}
+	if sources := annotated.Provenance(4); sources != nil {
+		t.Errorf("Provenance(4) got %v, want nil", sources)
+	}
+}
@@ -204,6 +204,15 @@ type contextInterface interface {
 	// PtracePokeUser implements ptrace(PTRACE_POKEUSR).
 	PtracePokeUser(addr, data uintptr) error
 
+	// Watchpoints returns the hardware breakpoints and watchpoints enabled
+	// with PtracePokeUser. The sentry emulates them by single-stepping the
+	// task.
+	Watchpoints() []Watchpoint
+
+	// SetWatchpointsHit records that the watchpoints whose Index bits are set
+	// in hits stopped the task, for the tracer to read with PtracePeekUser.
+	SetWatchpointsHit(hits uint32)
+
 	// PtraceGetRegs implements ptrace(PTRACE_GETREGS) by writing the
 	// general-purpose registers represented by this Context to dst and
 	// returning the number of bytes written.
@@ -239,6 +248,23 @@ type contextInterface interface {
 // Compile-time assertion that Context64 implements contextInterface.
 var _ = (contextInterface)((*Context64)(nil))
 
+// Watchpoint is a hardware breakpoint or watchpoint set by a debugger.
+type Watchpoint struct {
+	// Index is the index of the debug register that holds the watchpoint.
+	Index int
+
+	// Addr is the watched address.
+	Addr hostarch.Addr
+
+	// Len is the number of watched bytes.
+	Len int
+
+	// Execute is true for breakpoints, which stop the task before it executes
+	// the instruction at Addr. Otherwise, the watchpoint stops the task after
+	// it writes to the watched bytes.
+	Execute bool
+}
+
 // MmapDirection is a search direction for mmaps.
 type MmapDirection int
 
@@ -18,12 +18,15 @@
 package arch
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"io"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/cpuid"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch/fpu"
 	rpb "gvisor.dev/gvisor/pkg/sentry/arch/registers_go_proto"
 )
@@ -46,6 +49,52 @@ const (
 // ARMTrapFlag is the mask for the trap flag.
 const ARMTrapFlag = uint64(1) << 21
 
+// PACKeys are the pointer authentication keys of a thread. Each key is
+// stored as its low and high halves, in the order of the corresponding
+// APxxKeyLo_EL1 and APxxKeyHi_EL1 registers.
+//
+// +stateify savable
+type PACKeys struct {
+	APIAKey [2]uint64
+	APIBKey [2]uint64
+	APDAKey [2]uint64
+	APDBKey [2]uint64
+	APGAKey [2]uint64
+}
+
+// allPACKeys is the set of all keys accepted by PR_PAC_RESET_KEYS.
+const allPACKeys = linux.PR_PAC_APIAKEY | linux.PR_PAC_APIBKEY | linux.PR_PAC_APDAKEY | linux.PR_PAC_APDBKEY | linux.PR_PAC_APGAKEY
+
+// hwCap is the value of AT_HWCAP passed to applications. It only includes
+// features that the platform explicitly makes available to applications; see
+// SetHWCap.
+var hwCap uint64
+
+// SetHWCap sets the value of AT_HWCAP passed to applications. It must be
+// called, if at all, before any application is started.
+//
+// If hwcap includes linux.HWCAP_PACA or linux.HWCAP_PACG, each new
+// application is given random pointer authentication keys, which the
+// platform must load on every switch to the application.
+func SetHWCap(hwcap uint64) {
+	hwCap = hwcap
+}
+
+// HWCapAuxv returns the auxiliary vector entries describing the hardware
+// capabilities available to applications.
+func HWCapAuxv() Auxv {
+	if hwCap == 0 {
+		return nil
+	}
+	return Auxv{AuxEntry{linux.AT_HWCAP, hostarch.Addr(hwCap)}}
+}
+
+// PACEnabled returns true if pointer authentication is available to
+// applications.
+func PACEnabled() bool {
+	return hwCap&(linux.HWCAP_PACA|linux.HWCAP_PACG) != 0
+}
+
 // State contains the common architecture bits for aarch64 (the build tag of this
 // file ensures it's only built on aarch64).
 //
@@ -59,6 +108,10 @@ type State struct {
 
 	// OrigR0 stores the value of register R0.
 	OrigR0 uint64
+
+	// PACKeys are the pointer authentication keys. They are only used if
+	// PACEnabled returns true.
+	PACKeys PACKeys
 }
 
 // Proto returns a protobuf representation of the system registers in State.
@@ -109,6 +162,47 @@ func (s *State) Fork() State {
 		Regs:    s.Regs,
 		fpState: s.fpState.Fork(),
 		OrigR0:  s.OrigR0,
+		PACKeys: s.PACKeys,
+	}
+}
+
+// ResetPACKeys implements prctl(PR_PAC_RESET_KEYS): it replaces the pointer
+// authentication keys selected by keys, a mask of linux.PR_PAC_* bits, with
+// random values. If keys is 0, all keys are replaced.
+func (s *State) ResetPACKeys(keys uint64) error {
+	// Compare arch/arm64/kernel/pointer_auth.c:ptrauth_prctl_reset_keys().
+	if !PACEnabled() {
+		return linuxerr.EINVAL
+	}
+	if keys == 0 {
+		keys = allPACKeys
+	}
+	if keys&^allPACKeys != 0 {
+		return linuxerr.EINVAL
+	}
+	s.resetPACKeys(keys)
+	return nil
+}
+
+// resetPACKeys replaces the pointer authentication keys selected by keys with
+// random values.
+func (s *State) resetPACKeys(keys uint64) {
+	for i, key := range []*[2]uint64{
+		&s.PACKeys.APIAKey,
+		&s.PACKeys.APIBKey,
+		&s.PACKeys.APDAKey,
+		&s.PACKeys.APDBKey,
+		&s.PACKeys.APGAKey,
+	} {
+		if keys&(1<<i) == 0 {
+			continue
+		}
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(fmt.Sprintf("failed to read random bytes: %v", err))
+		}
+		key[0] = binary.LittleEndian.Uint64(b[:8])
+		key[1] = binary.LittleEndian.Uint64(b[8:])
 	}
 }
 
@@ -257,12 +351,17 @@ func (s *State) FullRestore() bool {
 func New(arch Arch) *Context64 {
 	switch arch {
 	case ARM64:
-		return &Context64{
+		c := &Context64{
 			State{
 				fpState: fpu.NewState(),
 			},
 			[]fpu.State(nil),
 		}
+		if PACEnabled() {
+			// As in Linux, each new program gets new keys.
+			c.resetPACKeys(allPACKeys)
+		}
+		return c
 	}
 	panic(fmt.Sprintf("unknown architecture %v", arch))
 }
@@ -23,6 +23,7 @@ import (
 	"math/rand"
 
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/marshal"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
@@ -285,6 +286,31 @@ func (c *Context64) PIELoadAddress(l MmapLayout) hostarch.Addr {
 // userStructSize is the size in bytes of Linux's struct user on amd64.
 const userStructSize = 928
 
+// userDebugRegOffset is the offset of u_debugreg in Linux's struct user on
+// amd64.
+const userDebugRegOffset = 848
+
+// Debug register fields in DR6 and DR7. See Intel SDM Vol. 3, 18.2.
+const (
+	// dr6Reserved is the value of the reserved bits of DR6, which DR6 holds
+	// along with its other bits cleared after reset.
+	dr6Reserved = 0xffff0ff0
+
+	// dr7EnableMask is the set of bits in DR7 that enable hardware breakpoints
+	// and watchpoints. Each of DR0-DR3 has a local and global enable bit.
+	dr7EnableMask = 0xff
+
+	// dr7ControlShift is the offset of the R/W and LEN fields of DR0 in DR7.
+	// Each of DR0-DR3 has 4 bits.
+	dr7ControlShift = 16
+
+	// Values of the R/W fields in DR7.
+	dr7Execute   = 0
+	dr7Write     = 1
+	dr7IO        = 2
+	dr7ReadWrite = 3
+)
+
 // PtracePeekUser implements Context.PtracePeekUser.
 func (c *Context64) PtracePeekUser(addr uintptr) (marshal.Marshallable, error) {
 	if addr&7 != 0 || addr >= userStructSize {
@@ -299,7 +325,14 @@ func (c *Context64) PtracePeekUser(addr uintptr) (marshal.Marshallable, error) {
 		regs.MarshalUnsafe(buf)
 		return c.Native(uintptr(hostarch.ByteOrder.Uint64(buf[addr:]))), nil
 	}
-	// Note: x86 debug registers are missing.
+	if addr >= userDebugRegOffset && addr < userDebugRegOffset+8*8 {
+		n := (addr - userDebugRegOffset) / 8
+		v := c.debugRegs[n]
+		if n == 6 {
+			v ^= dr6Reserved
+		}
+		return c.Native(uintptr(v)), nil
+	}
 	return c.Native(0), nil
 }
 
@@ -316,6 +349,105 @@ func (c *Context64) PtracePokeUser(addr, data uintptr) error {
 		_, err := c.PtraceSetRegs(bytes.NewBuffer(buf))
 		return err
 	}
-	// Note: x86 debug registers are missing.
+	if addr >= userDebugRegOffset && addr < userDebugRegOffset+8*8 {
+		return c.setDebugReg(int((addr-userDebugRegOffset)/8), uint64(data))
+	}
+	return nil
+}
+
+// setDebugReg sets debug register n to v, as in Linux's
+// arch/x86/kernel/ptrace.c:ptrace_set_debugreg().
+func (c *Context64) setDebugReg(n int, v uint64) error {
+	switch n {
+	case 4, 5:
+		return unix.EIO
+	case 6:
+		v ^= dr6Reserved
+	case 7:
+		for i := 0; i < 4; i++ {
+			if v&(3<<(2*i)) == 0 {
+				continue
+			}
+			rw, length := dr7Control(v, i)
+			switch rw {
+			case dr7Execute:
+				if length != 1 {
+					return unix.EINVAL
+				}
+			case dr7Write:
+				if c.debugRegs[i]%uint64(length) != 0 {
+					return unix.EINVAL
+				}
+			case dr7IO:
+				return unix.EINVAL
+			case dr7ReadWrite:
+				// Reads can't be detected by single-stepping. Fail as
+				// Linux does when it runs out of debug registers, so that
+				// debuggers report the failure instead of never
+				// stopping.
+				return unix.ENOSPC
+			}
+		}
+	}
+	c.debugRegs[n] = v
+	return nil
+}
+
+// dr7Control returns the R/W field and the length encoded by the LEN field
+// of debug register i in dr7.
+func dr7Control(dr7 uint64, i int) (rw uint64, length int) {
+	ctl := dr7 >> (dr7ControlShift + 4*i)
+	rw = ctl & 3
+	switch (ctl >> 2) & 3 {
+	case 0:
+		length = 1
+	case 1:
+		length = 2
+	case 2:
+		length = 8
+	case 3:
+		length = 4
+	}
+	return rw, length
+}
+
+// Watchpoints implements Context.Watchpoints.
+func (c *Context64) Watchpoints() []Watchpoint {
+	dr7 := c.debugRegs[7]
+	if dr7&dr7EnableMask == 0 {
+		return nil
+	}
+	var wps []Watchpoint
+	for i := 0; i < 4; i++ {
+		if dr7&(3<<(2*i)) == 0 {
+			continue
+		}
+		rw, length := dr7Control(dr7, i)
+		wps = append(wps, Watchpoint{
+			Index:   i,
+			Addr:    hostarch.Addr(c.debugRegs[i]),
+			Len:     length,
+			Execute: rw == dr7Execute,
+		})
+	}
+	return wps
+}
+
+// SetWatchpointsHit implements Context.SetWatchpointsHit.
+func (c *Context64) SetWatchpointsHit(hits uint32) {
+	// As in Linux, DR6 only reports the watchpoints hit by the last debug
+	// exception.
+	c.debugRegs[6] = uint64(hits & 0xf)
+}
+
+// HWCapAuxv returns the auxiliary vector entries describing the hardware
+// capabilities available to applications.
+func HWCapAuxv() Auxv {
 	return nil
 }
+
+// ResetPACKeys implements prctl(PR_PAC_RESET_KEYS), which is only supported
+// on arm64.
+func (c *Context64) ResetPACKeys(keys uint64) error {
+	return linuxerr.EINVAL
+}
@@ -283,6 +283,15 @@ func (c *Context64) PtracePokeUser(addr, data uintptr) error {
 	return nil
 }
 
+// Watchpoints implements Context.Watchpoints. Hardware breakpoints and
+// watchpoints are set with PTRACE_SETREGSET on arm64, which isn't supported.
+func (c *Context64) Watchpoints() []Watchpoint {
+	return nil
+}
+
+// SetWatchpointsHit implements Context.SetWatchpointsHit.
+func (c *Context64) SetWatchpointsHit(hits uint32) {}
+
 // FloatingPointData returns the state of the floating-point unit.
 func (c *Context64) FloatingPointData() *fpu.State {
 	return &c.State.fpState
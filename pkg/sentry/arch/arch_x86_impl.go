@@ -32,6 +32,11 @@ type State struct {
 
 	// Our floating point state.
 	fpState fpu.State `state:"wait"`
+
+	// debugRegs holds the debug registers DR0-DR7 as set by ptrace. They
+	// aren't loaded into the CPU; see Context64.Watchpoints. DR4 and DR5 are
+	// always zero, and DR6 holds the bits that differ from its reset value.
+	debugRegs [8]uint64
 }
 
 // afterLoad is invoked by stateify.
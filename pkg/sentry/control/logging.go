@@ -20,6 +20,7 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/strace"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
+	"gvisor.dev/gvisor/pkg/urpc"
 )
 
 // LoggingArgs are the arguments to use for changing the logging
@@ -63,6 +64,22 @@ type LoggingArgs struct {
 	// StraceEventAllowlist is the allowlist of syscalls to trace
 	// to event log.
 	StraceEventAllowlist []string
+
+	// SetJSONStrace is a flag used to indicate that JSON strace
+	// related arguments were passed in.
+	SetJSONStrace bool
+
+	// EnableJSONStrace specifies whether to enable JSON strace. If
+	// false, JSON strace is disabled for all system calls.
+	EnableJSONStrace bool
+
+	// StraceJSONAllowlist is the allowlist of syscalls to trace to
+	// the JSON output. If empty, all system calls are traced.
+	StraceJSONAllowlist []string
+
+	// FilePayload optionally contains the destination for JSON strace
+	// records. If it is empty, the current destination is kept.
+	urpc.FilePayload
 }
 
 // Logging provides functions related to logging.
@@ -101,6 +118,12 @@ func (l *Logging) Change(args *LoggingArgs, code *int) error {
 		}
 	}
 
+	if args.SetJSONStrace {
+		if err := l.configureJSONStrace(args); err != nil {
+			return fmt.Errorf("error configuring JSON strace: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -133,3 +156,18 @@ func (l *Logging) configureEventStrace(args *LoggingArgs) error {
 	}
 	return nil
 }
+
+func (l *Logging) configureJSONStrace(args *LoggingArgs) error {
+	if len(args.FilePayload.Files) > 0 {
+		strace.SetJSONOutput(args.FilePayload.Files[0])
+	}
+	if !args.EnableJSONStrace {
+		strace.Disable(strace.SinkTypeJSON)
+		return nil
+	}
+	if len(args.StraceJSONAllowlist) > 0 {
+		return strace.Enable(args.StraceJSONAllowlist, strace.SinkTypeJSON)
+	}
+	strace.EnableAll(strace.SinkTypeJSON)
+	return nil
+}
@@ -25,10 +25,12 @@ import (
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
 	"gvisor.dev/gvisor/pkg/fd"
 	"gvisor.dev/gvisor/pkg/sentry/fdimport"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/host"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/user"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
@@ -139,6 +141,21 @@ type ExecArgs struct {
 	// PIDNamespace is the pid namespace for the process being executed.
 	PIDNamespace *kernel.PIDNamespace
 
+	// UTSNamespace, IPCNamespace and NetworkNamespace are the namespaces of
+	// the process being executed. If nil, the root namespaces are used. A
+	// reference on each must be held for the lifetime of the ExecArgs.
+	UTSNamespace     *kernel.UTSNamespace `json:"-"`
+	IPCNamespace     *kernel.IPCNamespace `json:"-"`
+	NetworkNamespace *inet.Namespace      `json:"-"`
+
+	// InitialCgroups is the set of cgroups the process is placed in. If nil,
+	// the process is placed in the root cgroups.
+	InitialCgroups map[kernel.Cgroup]struct{} `json:"-"`
+
+	// SyscallFilters are seccomp-bpf filters installed on the process before
+	// it starts.
+	SyscallFilters []bpf.Program `json:"-"`
+
 	// Limits is the limit set for the process being executed.
 	Limits *limits.LimitSet
 }
@@ -197,22 +214,38 @@ func (proc *Proc) execAsync(args *ExecArgs) (*kernel.ThreadGroup, kernel.ThreadI
 	if limitSet == nil {
 		limitSet = limits.NewLimitSet()
 	}
+	// initArgs must hold references on the UTS and IPC namespaces, which will
+	// be donated to the new process in CreateProcess.
+	utsns := args.UTSNamespace
+	if utsns == nil {
+		utsns = proc.Kernel.RootUTSNamespace()
+	} else {
+		utsns.IncRef()
+	}
+	ipcns := args.IPCNamespace
+	if ipcns == nil {
+		ipcns = proc.Kernel.RootIPCNamespace()
+	} else {
+		ipcns.IncRef()
+	}
 	initArgs := kernel.CreateProcessArgs{
-		Filename:                args.Filename,
-		Argv:                    args.Argv,
-		Envv:                    args.Envv,
-		WorkingDirectory:        args.WorkingDirectory,
-		MountNamespace:          args.MountNamespace,
-		Credentials:             creds,
-		FDTable:                 fdTable,
-		Umask:                   0022,
-		Limits:                  limitSet,
-		MaxSymlinkTraversals:    linux.MaxSymlinkTraversals,
-		UTSNamespace:            proc.Kernel.RootUTSNamespace(),
-		IPCNamespace:            proc.Kernel.RootIPCNamespace(),
-		AbstractSocketNamespace: proc.Kernel.RootAbstractSocketNamespace(),
-		ContainerID:             args.ContainerID,
-		PIDNamespace:            pidns,
+		Filename:             args.Filename,
+		Argv:                 args.Argv,
+		Envv:                 args.Envv,
+		WorkingDirectory:     args.WorkingDirectory,
+		MountNamespace:       args.MountNamespace,
+		Credentials:          creds,
+		FDTable:              fdTable,
+		Umask:                0022,
+		Limits:               limitSet,
+		MaxSymlinkTraversals: linux.MaxSymlinkTraversals,
+		UTSNamespace:         utsns,
+		IPCNamespace:         ipcns,
+		ContainerID:          args.ContainerID,
+		PIDNamespace:         pidns,
+		NetworkNamespace:     args.NetworkNamespace,
+		InitialCgroups:       args.InitialCgroups,
+		SyscallFilters:       args.SyscallFilters,
 	}
 	if initArgs.MountNamespace != nil {
 		// initArgs must hold a reference on MountNamespace, which will
@@ -22,6 +22,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/state"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/state/chunkstore"
 	"gvisor.dev/gvisor/pkg/urpc"
 )
 
@@ -29,6 +30,10 @@ import (
 // appropriate file payload (e.g. there is no output file!).
 var ErrInvalidFiles = errors.New("exactly one file must be provided")
 
+// errInvalidChunkStoreFiles is returned when the urpc call to Save requests a
+// chunk store but does not include the files that make it up.
+var errInvalidChunkStoreFiles = errors.New("state, chunk index, chunk pack and chunk refs files must be provided")
+
 // State includes state-related functions.
 type State struct {
 	Kernel   *kernel.Kernel
@@ -43,14 +48,37 @@ type SaveOpts struct {
 	// Metadata is the set of metadata to prepend to the state file.
 	Metadata map[string]string `json:"metadata"`
 
-	// FilePayload contains the destination for the state.
+	// ChunkStore indicates that memory contents should be saved to a chunk
+	// store instead of the state file. See chunkstore.Store.
+	ChunkStore bool `json:"chunk_store"`
+
+	// Resume indicates that the sandbox keeps running after it's saved,
+	// whether or not the save succeeded, instead of exiting.
+	Resume bool `json:"resume"`
+
+	// FilePayload contains the destination for the state. If ChunkStore is
+	// set, it's followed by the chunk store's index and pack files, and a
+	// file that the hashes of the chunks referenced by the state are written
+	// to.
 	urpc.FilePayload
 }
 
 // Save saves the running system.
 func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 	// Create an output stream.
-	if len(o.FilePayload.Files) != 1 {
+	var store *chunkstore.Store
+	if o.ChunkStore {
+		if len(o.FilePayload.Files) != 4 {
+			return errInvalidChunkStoreFiles
+		}
+		for _, f := range o.FilePayload.Files[1:] {
+			defer f.Close()
+		}
+		var err error
+		if store, err = chunkstore.Open(o.FilePayload.Files[1], o.FilePayload.Files[2]); err != nil {
+			return err
+		}
+	} else if len(o.FilePayload.Files) != 1 {
 		return ErrInvalidFiles
 	}
 	defer o.FilePayload.Files[0].Close()
@@ -60,7 +88,22 @@ func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 		Destination: o.FilePayload.Files[0],
 		Key:         o.Key,
 		Metadata:    o.Metadata,
+		ChunkStore:  store,
 		Callback: func(err error) {
+			if err == nil && store != nil {
+				// Record the chunks used by this image, so that the chunk
+				// store can later be compacted.
+				log.Infof("Saved memory to chunk store: %d new bytes written, %d bytes stored", store.Written(), store.Size())
+				err = chunkstore.WriteRefs(o.FilePayload.Files[3], store.Used())
+			}
+			if o.Resume {
+				if err == nil {
+					log.Infof("Save succeeded: resuming...")
+				} else {
+					log.Warningf("Save failed: resuming...")
+				}
+				return
+			}
 			if err == nil {
 				log.Infof("Save succeeded: exiting...")
 				s.Kernel.SetSaveSuccess(false /* autosave */)
@@ -23,6 +23,7 @@ import (
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/urpc"
 )
@@ -49,6 +50,8 @@ type MemoryUsage struct {
 	Mapped    uint64 `json:"Mapped"`
 	Tmpfs     uint64 `json:"Tmpfs"`
 	Ramdiskfs uint64 `json:"Ramdiskfs"`
+	Shmem     uint64 `json:"Shmem"`
+	Stack     uint64 `json:"Stack"`
 	Total     uint64 `json:"Total"`
 }
 
@@ -101,6 +104,8 @@ func (u *Usage) Collect(opts *MemoryUsageOpts, out *MemoryUsage) error {
 			Mapped:    snapshot.Mapped,
 			Tmpfs:     snapshot.Tmpfs,
 			Ramdiskfs: snapshot.Ramdiskfs,
+			Shmem:     snapshot.Shmem,
+			Stack:     snapshot.Stack,
 			Total:     total,
 		}
 	} else {
@@ -139,6 +144,11 @@ type UsageReduceOpts struct {
 	// any time during program execution, so a routine GC is still possible even
 	// when this option set to `true`.
 	DoNotGC bool `json:"do_not_gc"`
+
+	// If PageOut is true, Reduce also pages out all allocated memory with
+	// MADV_PAGEOUT, so that the host can reclaim it immediately, e.g. to
+	// swap. Pages are faulted back in when they are next used.
+	PageOut bool `json:"page_out"`
 }
 
 // UsageReduceOutput contains output from Usage.Reduce().
@@ -154,6 +164,11 @@ func (u *Usage) Reduce(opts *UsageReduceOpts, out *UsageReduceOutput) error {
 	if !opts.DoNotGC {
 		runtime.GC()
 	}
+	if opts.PageOut {
+		if err := mf.ReclaimAllocated(pgalloc.IdleReclaimPageOut); err != nil {
+			return fmt.Errorf("paging out memory: %w", err)
+		}
+	}
 	return nil
 }
 
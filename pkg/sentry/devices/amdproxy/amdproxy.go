@@ -0,0 +1,141 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package amdproxy implements proxying for the AMD GPU Linux kernel drivers
+// used by ROCm compute workloads: the amdkfd compute interface (/dev/kfd) and
+// amdgpu DRM render nodes (/dev/dri/renderD#).
+//
+// amdkfd associates all GPU state (memory allocations, queues, events and
+// the GPU virtual address space) with the host process that opened
+// /dev/kfd, and only allows /dev/kfd to be used and mapped by that process.
+// amdproxy therefore shares a single host /dev/kfd file, and a single host
+// file per render node, between all application file descriptions; all
+// application processes in the sandbox share one amdkfd process. Since
+// doorbell and MMIO mappings of /dev/kfd must be created by the sentry, this
+// package requires a platform that owns page tables (e.g. KVM), on which
+// application mappings of device memory are backed by sentry mappings.
+//
+// Supported AMD GPUs: MI210, MI250, MI250X and MI300X.
+package amdproxy
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/amdgpu"
+	"gvisor.dev/gvisor/pkg/cleanup"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+const kfdHostPath = "/dev/kfd"
+
+// Register registers all devices implemented by this package in vfsObj.
+// renderMinors are the minor device numbers of the render nodes to expose.
+func Register(vfsObj *vfs.VirtualFilesystem, kfdDevMajor uint32, renderMinors []uint32) error {
+	kfdHostFD, err := unix.Openat(-1, kfdHostPath, unix.O_RDWR|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open host %s: %w", kfdHostPath, err)
+	}
+	cu := cleanup.Make(func() { unix.Close(kfdHostFD) })
+	defer cu.Clean()
+
+	// The kernel driver's interface only grows within a major version, so use
+	// the latest ABI known to be supported that the host driver also
+	// supports.
+	hostVersion, err := hostKFDVersion(int32(kfdHostFD))
+	if err != nil {
+		return fmt.Errorf("failed to get KFD ioctl interface version: %w", err)
+	}
+	version, abiCons, ok := abiFor(hostVersion)
+	if !ok {
+		return fmt.Errorf("unsupported KFD ioctl interface version: %s", hostVersion)
+	}
+	log.Infof("KFD ioctl interface version: %s, proxying version %s", hostVersion, version)
+	amdp := &amdproxy{
+		version:       version,
+		abi:           abiCons(),
+		kfdHostFD:     int32(kfdHostFD),
+		renderHostFDs: make(map[uint32]int32),
+	}
+	for _, minor := range renderMinors {
+		hostPath := renderHostPath(minor)
+		hostFD, err := unix.Openat(-1, hostPath, unix.O_RDWR|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open host %s: %w", hostPath, err)
+		}
+		cu.Add(func() { unix.Close(hostFD) })
+		amdp.renderHostFDs[minor] = int32(hostFD)
+	}
+
+	if err := vfsObj.RegisterDevice(vfs.CharDevice, kfdDevMajor, amdgpu.KFD_MINOR, &kfdDevice{
+		amdp: amdp,
+	}, &vfs.RegisterDeviceOptions{
+		GroupName: "kfd",
+	}); err != nil {
+		return err
+	}
+	for _, minor := range renderMinors {
+		if err := vfsObj.RegisterDevice(vfs.CharDevice, amdgpu.DRM_MAJOR, minor, &renderDevice{
+			amdp:  amdp,
+			minor: minor,
+		}, &vfs.RegisterDeviceOptions{
+			GroupName: "drm-render",
+		}); err != nil {
+			return err
+		}
+	}
+	cu.Release()
+	return nil
+}
+
+// CreateDevtmpfsFiles creates device special files in dev for /dev/kfd and
+// the given render nodes.
+func CreateDevtmpfsFiles(ctx context.Context, dev *devtmpfs.Accessor, kfdDevMajor uint32, renderMinors []uint32) error {
+	if err := dev.CreateDeviceFile(ctx, "kfd", vfs.CharDevice, kfdDevMajor, amdgpu.KFD_MINOR, 0666); err != nil {
+		return err
+	}
+	for _, minor := range renderMinors {
+		if err := dev.CreateDeviceFile(ctx, fmt.Sprintf("dri/renderD%d", minor), vfs.CharDevice, amdgpu.DRM_MAJOR, minor, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderHostPath(minor uint32) string {
+	return fmt.Sprintf("/dev/dri/renderD%d", minor)
+}
+
+// amdproxy holds state shared by all devices implemented by this package.
+//
+// The host files are opened once and remain open for the lifetime of the
+// sandbox, since amdkfd binds state to both the host process and the render
+// node file used to acquire each GPU's virtual address space. They are not
+// saved; we do not implement save/restore of host GPU state.
+//
+// +stateify savable
+type amdproxy struct {
+	version kfdVersion `state:"nosave"`
+	abi     *driverABI `state:"nosave"`
+
+	// kfdHostFD is the host /dev/kfd file descriptor shared by all kfdFDs.
+	kfdHostFD int32 `state:"nosave"`
+	// renderHostFDs maps render node minor device numbers to the host render
+	// node file descriptor shared by all renderFDs for that minor.
+	// renderHostFDs is immutable.
+	renderHostFDs map[uint32]int32 `state:"nosave"`
+}
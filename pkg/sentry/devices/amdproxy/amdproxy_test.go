@@ -0,0 +1,139 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	// Test that initializing all driverABI works (does not panic or anything).
+	Init()
+	for _, cons := range abis {
+		cons()
+	}
+}
+
+func TestABIFor(t *testing.T) {
+	Init()
+	for _, test := range []struct {
+		host kfdVersion
+		want kfdVersion
+		ok   bool
+	}{
+		{kfdVersion{1, 8}, kfdVersion{}, false},
+		{kfdVersion{1, 9}, kfdVersion{1, 9}, true},
+		{kfdVersion{1, 11}, kfdVersion{1, 9}, true},
+		{kfdVersion{1, 13}, kfdVersion{1, 13}, true},
+		{kfdVersion{1, 16}, kfdVersion{1, 14}, true},
+		{kfdVersion{2, 0}, kfdVersion{}, false},
+	} {
+		got, _, ok := abiFor(test.host)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("abiFor(%v) = %v, %t, want %v, %t", test.host, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestIoctlSizes(t *testing.T) {
+	// Every ioctl with a handler must be allowed by the seccomp filters, which
+	// are derived from kfdIoctlSizes and renderIoctlSizes.
+	Init()
+	for v, cons := range abis {
+		abi := cons()
+		for nr := range abi.kfdIoctl {
+			if _, ok := kfdIoctlSizes[nr]; !ok {
+				t.Errorf("version %v: kfd ioctl %#x has a handler but no entry in kfdIoctlSizes", v, nr)
+			}
+		}
+		for nr := range abi.renderIoctl {
+			if _, ok := renderIoctlSizes[nr]; !ok {
+				t.Errorf("version %v: render node ioctl %#x has a handler but no entry in renderIoctlSizes", v, nr)
+			}
+		}
+	}
+}
+
+func TestKFDResources(t *testing.T) {
+	var r kfdResources
+	r.addQueue(2)
+	r.addQueue(1)
+	r.addEvent(7)
+	r.addEvent(8)
+	r.removeEvent(8)
+	r.addMemory(0x20)
+	r.addMemory(0x10)
+	r.setMapped(0x10, []uint32{3, 1}, true)
+	r.setMapped(0x10, []uint32{3}, false)
+	r.setMapped(0x30, []uint32{1}, true) // Not tracked; ignored.
+
+	if !r.hasQueue(1) || r.hasQueue(3) {
+		t.Errorf("hasQueue: got (1: %t, 3: %t), want (true, false)", r.hasQueue(1), r.hasQueue(3))
+	}
+	if r.hasEvent(8) {
+		t.Errorf("hasEvent(8) = true after removeEvent(8)")
+	}
+	if r.hasMemory(0x30) {
+		t.Errorf("hasMemory(0x30) = true after setMapped of untracked handle")
+	}
+
+	queues, events, memory := r.drain()
+	if want := []uint32{1, 2}; !reflect.DeepEqual(queues, want) {
+		t.Errorf("drain() queues = %v, want %v", queues, want)
+	}
+	if want := []uint32{7}; !reflect.DeepEqual(events, want) {
+		t.Errorf("drain() events = %v, want %v", events, want)
+	}
+	wantMemory := []kfdMemory{
+		{handle: 0x10, gpuIDs: []uint32{1}},
+		{handle: 0x20, gpuIDs: []uint32{}},
+	}
+	if !reflect.DeepEqual(memory, wantMemory) {
+		t.Errorf("drain() memory = %+v, want %+v", memory, wantMemory)
+	}
+
+	queues, events, memory = r.drain()
+	if len(queues) != 0 || len(events) != 0 || len(memory) != 0 {
+		t.Errorf("second drain() = %v, %v, %+v, want empty", queues, events, memory)
+	}
+}
+
+func TestRenderResources(t *testing.T) {
+	var r renderResources
+	r.addGEMHandle(5)
+	r.addGEMHandle(4)
+	r.addContext(2)
+	r.addContext(1)
+	r.removeContext(2)
+
+	if !r.hasGEMHandle(4) || r.hasGEMHandle(6) {
+		t.Errorf("hasGEMHandle: got (4: %t, 6: %t), want (true, false)", r.hasGEMHandle(4), r.hasGEMHandle(6))
+	}
+	if r.hasContext(2) {
+		t.Errorf("hasContext(2) = true after removeContext(2)")
+	}
+
+	contexts, gemHandles := r.drain()
+	if want := []uint32{1}; !reflect.DeepEqual(contexts, want) {
+		t.Errorf("drain() contexts = %v, want %v", contexts, want)
+	}
+	if want := []uint32{4, 5}; !reflect.DeepEqual(gemHandles, want) {
+		t.Errorf("drain() gemHandles = %v, want %v", gemHandles, want)
+	}
+	if r.hasGEMHandle(4) || r.hasContext(1) {
+		t.Errorf("objects still tracked after drain()")
+	}
+}
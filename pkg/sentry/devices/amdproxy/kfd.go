@@ -0,0 +1,317 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/amdgpu"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// kfdDevice implements vfs.Device for /dev/kfd.
+//
+// +stateify savable
+type kfdDevice struct {
+	amdp *amdproxy
+}
+
+// Open implements vfs.Device.Open.
+func (dev *kfdDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &kfdFD{
+		amdp: dev.amdp,
+	}
+	fd.mappings.init(dev.amdp.kfdHostFD)
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// kfdFD implements vfs.FileDescriptionImpl for /dev/kfd.
+//
+// kfdFD is not savable; we do not implement save/restore of host GPU state.
+type kfdFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	amdp      *amdproxy
+	mappings  hostMappings
+	resources kfdResources
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *kfdFD) Release(context.Context) {
+	fd.releaseResources()
+	fd.mappings.release()
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *kfdFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	return vfs.GenericConfigureMMap(&fd.vfsfd, &fd.mappings, opts)
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *kfdFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	cmd := args[1].Uint()
+	nr := linux.IOC_NR(cmd)
+	argPtr := args[2].Pointer()
+	argSize := linux.IOC_SIZE(cmd)
+
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+
+	ki := kfdIoctlState{
+		fd:              fd,
+		ctx:             ctx,
+		t:               t,
+		nr:              nr,
+		ioctlParamsAddr: argPtr,
+		ioctlParamsSize: argSize,
+	}
+
+	// Implementors:
+	// - To map nr to a symbol and parameter type, look in
+	// include/uapi/linux/kfd_ioctl.h.
+	// - Add symbol and parameter type definitions to //pkg/abi/amdgpu.
+	// - Add the parameter size to kfdIoctlSizes.
+	// - Add handling to the driverABI in version.go.
+	handler := fd.amdp.abi.kfdIoctl[nr]
+	if handler == nil {
+		ctx.Warningf("amdproxy: unknown kfd ioctl %d == %#x (argSize=%d, cmd=%#x)", nr, nr, argSize, cmd)
+		return 0, linuxerr.EINVAL
+	}
+	if argSize != kfdIoctlSizes[nr] {
+		ctx.Warningf("amdproxy: kfd ioctl %d == %#x has unexpected argSize=%d (cmd=%#x), want %d", nr, nr, argSize, cmd, kfdIoctlSizes[nr])
+		return 0, linuxerr.EINVAL
+	}
+	return handler(&ki)
+}
+
+// kfdIoctlSizes maps supported /dev/kfd ioctl numbers to the size of their
+// parameter struct.
+var kfdIoctlSizes = map[uint32]uint32{
+	amdgpu.AMDKFD_IOC_GET_VERSION:               amdgpu.SizeofKFDIoctlGetVersionArgs,
+	amdgpu.AMDKFD_IOC_CREATE_QUEUE:              amdgpu.SizeofKFDIoctlCreateQueueArgs,
+	amdgpu.AMDKFD_IOC_DESTROY_QUEUE:             amdgpu.SizeofKFDIoctlDestroyQueueArgs,
+	amdgpu.AMDKFD_IOC_SET_MEMORY_POLICY:         amdgpu.SizeofKFDIoctlSetMemoryPolicyArgs,
+	amdgpu.AMDKFD_IOC_GET_CLOCK_COUNTERS:        amdgpu.SizeofKFDIoctlGetClockCountersArgs,
+	amdgpu.AMDKFD_IOC_GET_PROCESS_APERTURES:     amdgpu.SizeofKFDIoctlGetProcessAperturesArgs,
+	amdgpu.AMDKFD_IOC_UPDATE_QUEUE:              amdgpu.SizeofKFDIoctlUpdateQueueArgs,
+	amdgpu.AMDKFD_IOC_CREATE_EVENT:              amdgpu.SizeofKFDIoctlCreateEventArgs,
+	amdgpu.AMDKFD_IOC_DESTROY_EVENT:             amdgpu.SizeofKFDIoctlEventArgs,
+	amdgpu.AMDKFD_IOC_SET_EVENT:                 amdgpu.SizeofKFDIoctlEventArgs,
+	amdgpu.AMDKFD_IOC_RESET_EVENT:               amdgpu.SizeofKFDIoctlEventArgs,
+	amdgpu.AMDKFD_IOC_WAIT_EVENTS:               amdgpu.SizeofKFDIoctlWaitEventsArgs,
+	amdgpu.AMDKFD_IOC_SET_SCRATCH_BACKING_VA:    amdgpu.SizeofKFDIoctlSetScratchBackingVAArgs,
+	amdgpu.AMDKFD_IOC_GET_TILE_CONFIG:           amdgpu.SizeofKFDIoctlGetTileConfigArgs,
+	amdgpu.AMDKFD_IOC_SET_TRAP_HANDLER:          amdgpu.SizeofKFDIoctlSetTrapHandlerArgs,
+	amdgpu.AMDKFD_IOC_GET_PROCESS_APERTURES_NEW: amdgpu.SizeofKFDIoctlGetProcessAperturesNewArgs,
+	amdgpu.AMDKFD_IOC_ACQUIRE_VM:                amdgpu.SizeofKFDIoctlAcquireVMArgs,
+	amdgpu.AMDKFD_IOC_ALLOC_MEMORY_OF_GPU:       amdgpu.SizeofKFDIoctlAllocMemoryOfGPUArgs,
+	amdgpu.AMDKFD_IOC_FREE_MEMORY_OF_GPU:        amdgpu.SizeofKFDIoctlFreeMemoryOfGPUArgs,
+	amdgpu.AMDKFD_IOC_MAP_MEMORY_TO_GPU:         amdgpu.SizeofKFDIoctlMapMemoryToGPUArgs,
+	amdgpu.AMDKFD_IOC_UNMAP_MEMORY_FROM_GPU:     amdgpu.SizeofKFDIoctlMapMemoryToGPUArgs,
+	amdgpu.AMDKFD_IOC_SET_CU_MASK:               amdgpu.SizeofKFDIoctlSetCUMaskArgs,
+	amdgpu.AMDKFD_IOC_ALLOC_QUEUE_GWS:           amdgpu.SizeofKFDIoctlAllocQueueGWSArgs,
+	amdgpu.AMDKFD_IOC_SET_XNACK_MODE:            amdgpu.SizeofKFDIoctlSetXNACKModeArgs,
+	amdgpu.AMDKFD_IOC_AVAILABLE_MEMORY:          amdgpu.SizeofKFDIoctlGetAvailableMemoryArgs,
+	amdgpu.AMDKFD_IOC_RUNTIME_ENABLE:            amdgpu.SizeofKFDIoctlRuntimeEnableArgs,
+}
+
+func kfdIoctlCmd(nr, argSize uint32) uintptr {
+	// amdkfd ignores the direction bits of the command, using those of its
+	// own definition instead.
+	return uintptr(linux.IOWR(amdgpu.AMDKFD_IOCTL_BASE, nr, argSize))
+}
+
+// kfdIoctlState holds the state of a call to kfdFD.Ioctl().
+type kfdIoctlState struct {
+	fd              *kfdFD
+	ctx             context.Context
+	t               *kernel.Task
+	nr              uint32
+	ioctlParamsAddr hostarch.Addr
+	ioctlParamsSize uint32
+}
+
+// kfdIoctlSimple implements a kfd ioctl whose parameters don't contain any
+// pointers requiring translation, file descriptors, or special cases or
+// effects, and consequently don't need to be typed by the sentry.
+func kfdIoctlSimple(ki *kfdIoctlState) (uintptr, error) {
+	ioctlParams := make([]byte, ki.ioctlParamsSize)
+	if _, err := ki.t.CopyInBytes(ki.ioctlParamsAddr, ioctlParams); err != nil {
+		return 0, err
+	}
+	n, err := kfdIoctlInvoke(ki, &ioctlParams[0])
+	if err != nil {
+		return n, err
+	}
+	if _, err := ki.t.CopyOutBytes(ki.ioctlParamsAddr, ioctlParams); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func kfdGetVersion(ki *kfdIoctlState) (uintptr, error) {
+	// Report the proxied interface version rather than the host's, so that
+	// the application doesn't use newer features that amdproxy does not
+	// support.
+	ioctlParams := amdgpu.KFDIoctlGetVersionArgs{
+		MajorVersion: ki.fd.amdp.version.major,
+		MinorVersion: ki.fd.amdp.version.minor,
+	}
+	_, err := ioctlParams.CopyOut(ki.t, ki.ioctlParamsAddr)
+	return 0, err
+}
+
+func kfdAcquireVM(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlAcquireVMArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	drmFileGeneric, _ := ki.t.FDTable().Get(ioctlParams.DRMFD)
+	if drmFileGeneric == nil {
+		return 0, linuxerr.EBADF
+	}
+	defer drmFileGeneric.DecRef(ki.ctx)
+	drmFile, ok := drmFileGeneric.Impl().(*renderFD)
+	if !ok {
+		return 0, linuxerr.EINVAL
+	}
+	sentryIoctlParams := ioctlParams
+	sentryIoctlParams.DRMFD = drmFile.hostFD()
+	// Nothing is copied out.
+	return kfdIoctlInvoke(ki, &sentryIoctlParams)
+}
+
+func kfdAllocMemoryOfGPU(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlAllocMemoryOfGPUArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if ioctlParams.Flags&amdgpu.KFD_IOC_ALLOC_MEM_FLAGS_USERPTR != 0 {
+		// Userptr allocations register application memory by its address in
+		// the host process, which is the sentry's address space rather than
+		// the application's.
+		log.Debugf("amdproxy: rejecting AMDKFD_IOC_ALLOC_MEMORY_OF_GPU with KFD_IOC_ALLOC_MEM_FLAGS_USERPTR")
+		return 0, linuxerr.EINVAL
+	}
+	n, err := kfdIoctlInvoke(ki, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	ki.fd.resources.addMemory(ioctlParams.Handle)
+	if _, err := ioctlParams.CopyOut(ki.t, ki.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func kfdFreeMemoryOfGPU(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlFreeMemoryOfGPUArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if !ki.fd.resources.hasMemory(ioctlParams.Handle) {
+		return 0, linuxerr.EINVAL
+	}
+	n, err := kfdIoctlInvoke(ki, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	ki.fd.resources.removeMemory(ioctlParams.Handle)
+	// Nothing is copied out.
+	return n, nil
+}
+
+func kfdCreateQueue(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlCreateQueueArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	n, err := kfdIoctlInvoke(ki, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	ki.fd.resources.addQueue(ioctlParams.QueueID)
+	if _, err := ioctlParams.CopyOut(ki.t, ki.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func kfdDestroyQueue(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlDestroyQueueArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if !ki.fd.resources.hasQueue(ioctlParams.QueueID) {
+		return 0, linuxerr.EINVAL
+	}
+	n, err := kfdIoctlInvoke(ki, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	ki.fd.resources.removeQueue(ioctlParams.QueueID)
+	// Nothing is copied out.
+	return n, nil
+}
+
+func kfdCreateEvent(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlCreateEventArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	n, err := kfdIoctlInvoke(ki, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	ki.fd.resources.addEvent(ioctlParams.EventID)
+	if _, err := ioctlParams.CopyOut(ki.t, ki.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func kfdDestroyEvent(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlEventArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if !ki.fd.resources.hasEvent(ioctlParams.EventID) {
+		return 0, linuxerr.EINVAL
+	}
+	n, err := kfdIoctlInvoke(ki, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	ki.fd.resources.removeEvent(ioctlParams.EventID)
+	// Nothing is copied out.
+	return n, nil
+}
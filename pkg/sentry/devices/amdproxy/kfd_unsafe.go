@@ -0,0 +1,304 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/amdgpu"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+const (
+	// maxKFDNodes bounds the number of apertures and GPU IDs copied for a
+	// single ioctl. It is larger than the number of GPUs in any supported
+	// system.
+	maxKFDNodes = 128
+
+	// maxTileConfigs bounds the size of the arrays copied for
+	// AMDKFD_IOC_GET_TILE_CONFIG.
+	maxTileConfigs = 64
+
+	// maxCUMaskBits bounds the size of the mask copied for
+	// AMDKFD_IOC_SET_CU_MASK.
+	maxCUMaskBits = 4096
+
+	// kfdWaitEventsSliceMS is the maximum time in milliseconds that
+	// AMDKFD_IOC_WAIT_EVENTS blocks in the host before the sentry checks for
+	// interruption.
+	kfdWaitEventsSliceMS = 10
+)
+
+func hostKFDVersion(hostFD int32) (kfdVersion, error) {
+	var ioctlParams amdgpu.KFDIoctlGetVersionArgs
+	if _, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(hostFD), kfdIoctlCmd(amdgpu.AMDKFD_IOC_GET_VERSION, amdgpu.SizeofKFDIoctlGetVersionArgs), uintptr(unsafe.Pointer(&ioctlParams))); errno != 0 {
+		return kfdVersion{}, errno
+	}
+	return kfdVersion{ioctlParams.MajorVersion, ioctlParams.MinorVersion}, nil
+}
+
+func kfdHostIoctl[Params any](hostFD int32, nr, argSize uint32, sentryParams *Params) (uintptr, error) {
+	n, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(hostFD), kfdIoctlCmd(nr, argSize), uintptr(unsafe.Pointer(sentryParams)))
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
+
+func kfdIoctlInvoke[Params any](ki *kfdIoctlState, sentryParams *Params) (uintptr, error) {
+	return kfdHostIoctl(ki.fd.amdp.kfdHostFD, ki.nr, ki.ioctlParamsSize, sentryParams)
+}
+
+// releaseResources destroys the amdkfd objects created through fd that the
+// application didn't destroy.
+func (fd *kfdFD) releaseResources() {
+	hostFD := fd.amdp.kfdHostFD
+	queues, events, memory := fd.resources.drain()
+	for _, id := range queues {
+		ioctlParams := amdgpu.KFDIoctlDestroyQueueArgs{QueueID: id}
+		if _, err := kfdHostIoctl(hostFD, amdgpu.AMDKFD_IOC_DESTROY_QUEUE, amdgpu.SizeofKFDIoctlDestroyQueueArgs, &ioctlParams); err != nil {
+			log.Warningf("amdproxy: failed to destroy queue %d: %v", id, err)
+		}
+	}
+	for _, id := range events {
+		ioctlParams := amdgpu.KFDIoctlEventArgs{EventID: id}
+		if _, err := kfdHostIoctl(hostFD, amdgpu.AMDKFD_IOC_DESTROY_EVENT, amdgpu.SizeofKFDIoctlEventArgs, &ioctlParams); err != nil {
+			log.Warningf("amdproxy: failed to destroy event %d: %v", id, err)
+		}
+	}
+	for _, mem := range memory {
+		if len(mem.gpuIDs) != 0 {
+			ioctlParams := amdgpu.KFDIoctlMapMemoryToGPUArgs{
+				Handle:            mem.handle,
+				DeviceIDsArrayPtr: uint64FromPtr(unsafe.Pointer(&mem.gpuIDs[0])),
+				NDevices:          uint32(len(mem.gpuIDs)),
+			}
+			_, err := kfdHostIoctl(hostFD, amdgpu.AMDKFD_IOC_UNMAP_MEMORY_FROM_GPU, amdgpu.SizeofKFDIoctlMapMemoryToGPUArgs, &ioctlParams)
+			runtime.KeepAlive(mem.gpuIDs)
+			if err != nil {
+				// The driver refuses to free mapped memory.
+				log.Warningf("amdproxy: failed to unmap memory %#x: %v", mem.handle, err)
+				continue
+			}
+		}
+		ioctlParams := amdgpu.KFDIoctlFreeMemoryOfGPUArgs{Handle: mem.handle}
+		if _, err := kfdHostIoctl(hostFD, amdgpu.AMDKFD_IOC_FREE_MEMORY_OF_GPU, amdgpu.SizeofKFDIoctlFreeMemoryOfGPUArgs, &ioctlParams); err != nil {
+			log.Warningf("amdproxy: failed to free memory %#x: %v", mem.handle, err)
+		}
+	}
+}
+
+func uint64FromPtr(ptr unsafe.Pointer) uint64 {
+	return uint64(uintptr(ptr))
+}
+
+func kfdGetProcessAperturesNew(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlGetProcessAperturesNewArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if ioctlParams.NumOfNodes > maxKFDNodes {
+		return 0, linuxerr.EINVAL
+	}
+	// If NumOfNodes is 0, the driver only returns the number of nodes.
+	var apertures []byte
+	sentryIoctlParams := ioctlParams
+	if ioctlParams.NumOfNodes != 0 {
+		apertures = make([]byte, ioctlParams.NumOfNodes*amdgpu.SizeofKFDProcessDeviceApertures)
+		sentryIoctlParams.KFDProcessDeviceAperturesPtr = uint64FromPtr(unsafe.Pointer(&apertures[0]))
+	}
+	n, err := kfdIoctlInvoke(ki, &sentryIoctlParams)
+	runtime.KeepAlive(apertures)
+	if err != nil {
+		return n, err
+	}
+	if ioctlParams.NumOfNodes != 0 {
+		if sentryIoctlParams.NumOfNodes > ioctlParams.NumOfNodes {
+			return n, linuxerr.EINVAL
+		}
+		if _, err := ki.t.CopyOutBytes(hostarch.Addr(ioctlParams.KFDProcessDeviceAperturesPtr), apertures[:sentryIoctlParams.NumOfNodes*amdgpu.SizeofKFDProcessDeviceApertures]); err != nil {
+			return n, err
+		}
+	}
+	outIoctlParams := sentryIoctlParams
+	outIoctlParams.KFDProcessDeviceAperturesPtr = ioctlParams.KFDProcessDeviceAperturesPtr
+	if _, err := outIoctlParams.CopyOut(ki.t, ki.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// kfdMapMemoryToGPU implements AMDKFD_IOC_MAP_MEMORY_TO_GPU and
+// AMDKFD_IOC_UNMAP_MEMORY_FROM_GPU, which have the same parameter layout.
+func kfdMapMemoryToGPU(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlMapMemoryToGPUArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if ioctlParams.NDevices == 0 || ioctlParams.NDevices > maxKFDNodes {
+		return 0, linuxerr.EINVAL
+	}
+	if !ki.fd.resources.hasMemory(ioctlParams.Handle) {
+		return 0, linuxerr.EINVAL
+	}
+	deviceIDs := make([]byte, ioctlParams.NDevices*4)
+	if _, err := ki.t.CopyInBytes(hostarch.Addr(ioctlParams.DeviceIDsArrayPtr), deviceIDs); err != nil {
+		return 0, err
+	}
+	sentryIoctlParams := ioctlParams
+	sentryIoctlParams.DeviceIDsArrayPtr = uint64FromPtr(unsafe.Pointer(&deviceIDs[0]))
+	n, err := kfdIoctlInvoke(ki, &sentryIoctlParams)
+	runtime.KeepAlive(deviceIDs)
+	// The driver processes the devices in order, starting at NSuccess, and
+	// updates NSuccess even if it fails partway through.
+	if done := sentryIoctlParams.NSuccess; done <= ioctlParams.NDevices {
+		gpuIDs := make([]uint32, done)
+		for i := range gpuIDs {
+			gpuIDs[i] = hostarch.ByteOrder.Uint32(deviceIDs[i*4:])
+		}
+		ki.fd.resources.setMapped(ioctlParams.Handle, gpuIDs, ki.nr == amdgpu.AMDKFD_IOC_MAP_MEMORY_TO_GPU)
+	}
+	if err != nil {
+		return n, err
+	}
+	outIoctlParams := sentryIoctlParams
+	outIoctlParams.DeviceIDsArrayPtr = ioctlParams.DeviceIDsArrayPtr
+	if _, err := outIoctlParams.CopyOut(ki.t, ki.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func kfdSetCUMask(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlSetCUMaskArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if ioctlParams.NumCUMask == 0 || ioctlParams.NumCUMask%32 != 0 || ioctlParams.NumCUMask > maxCUMaskBits {
+		return 0, linuxerr.EINVAL
+	}
+	cuMask := make([]byte, ioctlParams.NumCUMask/8)
+	if _, err := ki.t.CopyInBytes(hostarch.Addr(ioctlParams.CUMaskPtr), cuMask); err != nil {
+		return 0, err
+	}
+	sentryIoctlParams := ioctlParams
+	sentryIoctlParams.CUMaskPtr = uint64FromPtr(unsafe.Pointer(&cuMask[0]))
+	n, err := kfdIoctlInvoke(ki, &sentryIoctlParams)
+	runtime.KeepAlive(cuMask)
+	// Nothing is copied out.
+	return n, err
+}
+
+func kfdGetTileConfig(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlGetTileConfigArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if ioctlParams.NumTileConfigs > maxTileConfigs || ioctlParams.NumMacroTileConfigs > maxTileConfigs {
+		return 0, linuxerr.EINVAL
+	}
+	// Allocate at least one element for each array so that the sentry's
+	// pointers are valid; the driver writes at most the requested number of
+	// elements.
+	tileConfig := make([]byte, (ioctlParams.NumTileConfigs+1)*4)
+	macroTileConfig := make([]byte, (ioctlParams.NumMacroTileConfigs+1)*4)
+	sentryIoctlParams := ioctlParams
+	sentryIoctlParams.TileConfigPtr = uint64FromPtr(unsafe.Pointer(&tileConfig[0]))
+	sentryIoctlParams.MacroTileConfigPtr = uint64FromPtr(unsafe.Pointer(&macroTileConfig[0]))
+	n, err := kfdIoctlInvoke(ki, &sentryIoctlParams)
+	runtime.KeepAlive(tileConfig)
+	runtime.KeepAlive(macroTileConfig)
+	if err != nil {
+		return n, err
+	}
+	// The driver reduces each count to the number of elements written.
+	if sentryIoctlParams.NumTileConfigs > ioctlParams.NumTileConfigs || sentryIoctlParams.NumMacroTileConfigs > ioctlParams.NumMacroTileConfigs {
+		return n, linuxerr.EINVAL
+	}
+	if sentryIoctlParams.NumTileConfigs != 0 {
+		if _, err := ki.t.CopyOutBytes(hostarch.Addr(ioctlParams.TileConfigPtr), tileConfig[:sentryIoctlParams.NumTileConfigs*4]); err != nil {
+			return n, err
+		}
+	}
+	if sentryIoctlParams.NumMacroTileConfigs != 0 {
+		if _, err := ki.t.CopyOutBytes(hostarch.Addr(ioctlParams.MacroTileConfigPtr), macroTileConfig[:sentryIoctlParams.NumMacroTileConfigs*4]); err != nil {
+			return n, err
+		}
+	}
+	outIoctlParams := sentryIoctlParams
+	outIoctlParams.TileConfigPtr = ioctlParams.TileConfigPtr
+	outIoctlParams.MacroTileConfigPtr = ioctlParams.MacroTileConfigPtr
+	if _, err := outIoctlParams.CopyOut(ki.t, ki.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func kfdWaitEvents(ki *kfdIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.KFDIoctlWaitEventsArgs
+	if _, err := ioctlParams.CopyIn(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if ioctlParams.NumEvents == 0 || ioctlParams.NumEvents > amdgpu.KFD_SIGNAL_EVENT_LIMIT {
+		return 0, linuxerr.EINVAL
+	}
+	events := make([]byte, ioctlParams.NumEvents*amdgpu.SizeofKFDEventData)
+	if _, err := ki.t.CopyInBytes(hostarch.Addr(ioctlParams.EventsPtr), events); err != nil {
+		return 0, err
+	}
+	sentryIoctlParams := ioctlParams
+	sentryIoctlParams.EventsPtr = uint64FromPtr(unsafe.Pointer(&events[0]))
+
+	// The driver may block for the entire timeout, which may be infinite, and
+	// can't be interrupted by the sentry. Wait in bounded slices instead, and
+	// check for interruption between them.
+	remaining := ioctlParams.Timeout
+	for {
+		slice := remaining
+		if slice > kfdWaitEventsSliceMS {
+			slice = kfdWaitEventsSliceMS
+		}
+		sentryIoctlParams.Timeout = slice
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(ki.fd.amdp.kfdHostFD), kfdIoctlCmd(ki.nr, ki.ioctlParamsSize), uintptr(unsafe.Pointer(&sentryIoctlParams)))
+		runtime.KeepAlive(events)
+		if errno != 0 {
+			return 0, errno
+		}
+		if sentryIoctlParams.WaitResult != amdgpu.KFD_IOC_WAIT_RESULT_TIMEOUT || slice == remaining {
+			break
+		}
+		if remaining != amdgpu.KFD_EVENT_TIMEOUT_INFINITE {
+			remaining -= slice
+		}
+		if ki.t.Interrupted() {
+			return 0, linuxerr.ERESTARTSYS
+		}
+	}
+
+	if _, err := ki.t.CopyOutBytes(hostarch.Addr(ioctlParams.EventsPtr), events); err != nil {
+		return 0, err
+	}
+	outIoctlParams := sentryIoctlParams
+	outIoctlParams.EventsPtr = ioctlParams.EventsPtr
+	outIoctlParams.Timeout = ioctlParams.Timeout
+	if _, err := outIoctlParams.CopyOut(ki.t, ki.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// hostMappings implements memmap.Mappable and memmap.File for a host device
+// file by mapping it into the sentry.
+//
+// amdkfd only allows /dev/kfd to be mapped by the host process that opened
+// it, and both amdkfd and amdgpu only allow mappings of exactly the ranges
+// they have handed out (e.g. a single doorbell page or buffer object). Thus,
+// unlike other device proxies, hostMappings maps each range that the
+// application maps into the sentry, exactly, when the application mapping is
+// created, and serves MapInternal from that mapping.
+type hostMappings struct {
+	hostFD int32
+
+	mu sync.Mutex
+	// mappings maps ranges of the host file mapped by the application to
+	// sentry mappings of those ranges. mappings is protected by mu.
+	mappings map[memmap.MappableRange]*hostMapping
+}
+
+type hostMapping struct {
+	addr uintptr
+	refs int
+}
+
+func (hm *hostMappings) init(hostFD int32) {
+	hm.hostFD = hostFD
+	hm.mappings = make(map[memmap.MappableRange]*hostMapping)
+}
+
+// release unmaps all remaining sentry mappings.
+func (hm *hostMappings) release() {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	for mr, m := range hm.mappings {
+		hostMunmap(m.addr, mr.Length())
+		delete(hm.mappings, mr)
+	}
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (hm *hostMappings) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	mr := memmap.MappableRange{Start: offset, End: offset + uint64(ar.Length())}
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if m, ok := hm.mappings[mr]; ok {
+		m.refs++
+		return nil
+	}
+	addr, err := hostMmap(hm.hostFD, mr)
+	if err != nil {
+		ctx.Debugf("amdproxy: failed to map host file range %v: %v", mr, err)
+		return err
+	}
+	hm.mappings[mr] = &hostMapping{addr: addr, refs: 1}
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (hm *hostMappings) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+	mr := memmap.MappableRange{Start: offset, End: offset + uint64(ar.Length())}
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	m, ok := hm.mappings[mr]
+	if !ok {
+		// This happens if the application partially unmaps a mapping. The
+		// sentry mapping remains until release.
+		return
+	}
+	m.refs--
+	if m.refs == 0 {
+		hostMunmap(m.addr, mr.Length())
+		delete(hm.mappings, mr)
+	}
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (hm *hostMappings) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return hm.AddMapping(ctx, ms, dstAR, offset, writable)
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (hm *hostMappings) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	for mr := range hm.mappings {
+		if !mr.IsSupersetOf(required) {
+			continue
+		}
+		source := mr.Intersect(optional)
+		return []memmap.Translation{
+			{
+				Source: source,
+				File:   hm,
+				Offset: source.Start,
+				Perms:  at,
+			},
+		}, nil
+	}
+	return nil, &memmap.BusError{Err: linuxerr.EFAULT}
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (hm *hostMappings) InvalidateUnsavable(ctx context.Context) error {
+	return nil
+}
+
+// IncRef implements memmap.File.IncRef.
+func (hm *hostMappings) IncRef(fr memmap.FileRange, memCgID uint32) {
+}
+
+// DecRef implements memmap.File.DecRef.
+func (hm *hostMappings) DecRef(fr memmap.FileRange) {
+}
+
+// MapInternal implements memmap.File.MapInternal.
+func (hm *hostMappings) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (safemem.BlockSeq, error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	for mr, m := range hm.mappings {
+		if mr.Start <= fr.Start && fr.End <= mr.End {
+			return safemem.BlockSeqOf(blockFromHostMapping(m.addr+uintptr(fr.Start-mr.Start), fr.Length())), nil
+		}
+	}
+	log.Traceback("amdproxy: MapInternal of unmapped range %v", fr)
+	return safemem.BlockSeq{}, linuxerr.EINVAL
+}
+
+// FD implements memmap.File.FD.
+func (hm *hostMappings) FD() int {
+	return int(hm.hostFD)
+}
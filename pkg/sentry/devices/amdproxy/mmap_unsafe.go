@@ -0,0 +1,45 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+// hostMmap maps mr of the given host file into the sentry.
+func hostMmap(hostFD int32, mr memmap.MappableRange) (uintptr, error) {
+	addr, _, errno := unix.RawSyscall6(unix.SYS_MMAP, 0, uintptr(mr.Length()), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED, uintptr(hostFD), uintptr(mr.Start))
+	if errno != 0 {
+		return 0, errno
+	}
+	return addr, nil
+}
+
+func hostMunmap(addr uintptr, length uint64) {
+	if _, _, errno := unix.RawSyscall(unix.SYS_MUNMAP, addr, uintptr(length), 0); errno != 0 {
+		// This leaks address space and is unexpected, but is otherwise
+		// harmless, so complain but don't panic.
+		log.Warningf("amdproxy: failed to unmap %#x: %v", addr, errno)
+	}
+}
+
+func blockFromHostMapping(addr uintptr, length uint64) safemem.Block {
+	return safemem.BlockFromUnsafePointer(unsafe.Pointer(addr), int(length))
+}
@@ -0,0 +1,226 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/amdgpu"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// renderDevice implements vfs.Device for /dev/dri/renderD#.
+//
+// +stateify savable
+type renderDevice struct {
+	amdp  *amdproxy
+	minor uint32
+}
+
+// Open implements vfs.Device.Open.
+func (dev *renderDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &renderFD{
+		amdp:  dev.amdp,
+		minor: dev.minor,
+	}
+	fd.mappings.init(fd.hostFD())
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// renderFD implements vfs.FileDescriptionImpl for /dev/dri/renderD#.
+//
+// renderFD is not savable; we do not implement save/restore of host GPU
+// state.
+type renderFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	amdp      *amdproxy
+	minor     uint32
+	mappings  hostMappings
+	resources renderResources
+}
+
+// hostFD returns the host render node file descriptor backing fd.
+func (fd *renderFD) hostFD() int32 {
+	return fd.amdp.renderHostFDs[fd.minor]
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *renderFD) Release(context.Context) {
+	fd.releaseResources()
+	fd.mappings.release()
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *renderFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	return vfs.GenericConfigureMMap(&fd.vfsfd, &fd.mappings, opts)
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *renderFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	cmd := args[1].Uint()
+	nr := linux.IOC_NR(cmd)
+	argPtr := args[2].Pointer()
+	argSize := linux.IOC_SIZE(cmd)
+
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+
+	ri := renderIoctlState{
+		fd:              fd,
+		ctx:             ctx,
+		t:               t,
+		nr:              nr,
+		ioctlParamsAddr: argPtr,
+		ioctlParamsSize: argSize,
+	}
+
+	// Implementors:
+	// - To map nr to a symbol and parameter type, look in
+	// include/uapi/drm/drm.h and include/uapi/drm/amdgpu_drm.h.
+	// - Add symbol and parameter type definitions to //pkg/abi/amdgpu.
+	// - Add the parameter size to renderIoctlSizes.
+	// - Add handling to the driverABI in version.go.
+	handler := fd.amdp.abi.renderIoctl[nr]
+	if handler == nil {
+		ctx.Warningf("amdproxy: unknown render node ioctl %d == %#x (argSize=%d, cmd=%#x)", nr, nr, argSize, cmd)
+		return 0, linuxerr.EINVAL
+	}
+	if argSize != renderIoctlSizes[nr] {
+		ctx.Warningf("amdproxy: render node ioctl %d == %#x has unexpected argSize=%d (cmd=%#x), want %d", nr, nr, argSize, cmd, renderIoctlSizes[nr])
+		return 0, linuxerr.EINVAL
+	}
+	return handler(&ri)
+}
+
+// renderIoctlSizes maps supported render node ioctl numbers to the size of
+// their parameter struct.
+var renderIoctlSizes = map[uint32]uint32{
+	amdgpu.DRM_IOCTL_VERSION:           amdgpu.SizeofDRMVersion,
+	amdgpu.DRM_IOCTL_GEM_CLOSE:         amdgpu.SizeofDRMGEMClose,
+	amdgpu.DRM_IOCTL_GET_CAP:           amdgpu.SizeofDRMGetCap,
+	amdgpu.DRM_IOCTL_AMDGPU_GEM_CREATE: amdgpu.SizeofDRMAMDGPUGEMCreate,
+	amdgpu.DRM_IOCTL_AMDGPU_GEM_MMAP:   amdgpu.SizeofDRMAMDGPUGEMMMap,
+	amdgpu.DRM_IOCTL_AMDGPU_CTX:        amdgpu.SizeofDRMAMDGPUCtx,
+	amdgpu.DRM_IOCTL_AMDGPU_INFO:       amdgpu.SizeofDRMAMDGPUInfo,
+}
+
+func renderIoctlCmd(nr, argSize uint32) uintptr {
+	// DRM copies parameters in and out as permitted by both the command and
+	// its own definition, so _IOWR defers entirely to the latter.
+	return uintptr(linux.IOWR(amdgpu.DRM_IOCTL_BASE, nr, argSize))
+}
+
+// renderIoctlState holds the state of a call to renderFD.Ioctl().
+type renderIoctlState struct {
+	fd              *renderFD
+	ctx             context.Context
+	t               *kernel.Task
+	nr              uint32
+	ioctlParamsAddr hostarch.Addr
+	ioctlParamsSize uint32
+}
+
+// renderIoctlSimple implements a render node ioctl whose parameters don't
+// contain any pointers requiring translation, file descriptors, or special
+// cases or effects, and consequently don't need to be typed by the sentry.
+func renderIoctlSimple(ri *renderIoctlState) (uintptr, error) {
+	ioctlParams := make([]byte, ri.ioctlParamsSize)
+	if _, err := ri.t.CopyInBytes(ri.ioctlParamsAddr, ioctlParams); err != nil {
+		return 0, err
+	}
+	n, err := renderIoctlInvoke(ri, &ioctlParams[0])
+	if err != nil {
+		return n, err
+	}
+	if _, err := ri.t.CopyOutBytes(ri.ioctlParamsAddr, ioctlParams); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func renderGEMCreate(ri *renderIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.DRMAMDGPUGEMCreate
+	if _, err := ioctlParams.CopyIn(ri.t, ri.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	n, err := renderIoctlInvoke(ri, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	ri.fd.resources.addGEMHandle(ioctlParams.Handle())
+	if _, err := ioctlParams.CopyOut(ri.t, ri.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func renderGEMClose(ri *renderIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.DRMGEMClose
+	if _, err := ioctlParams.CopyIn(ri.t, ri.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if !ri.fd.resources.hasGEMHandle(ioctlParams.Handle) {
+		return 0, linuxerr.EINVAL
+	}
+	n, err := renderIoctlInvoke(ri, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	ri.fd.resources.removeGEMHandle(ioctlParams.Handle)
+	// Nothing is copied out.
+	return n, nil
+}
+
+func renderAMDGPUCtx(ri *renderIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.DRMAMDGPUCtx
+	if _, err := ioctlParams.CopyIn(ri.t, ri.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	op, ctxID := ioctlParams.Op, ioctlParams.CtxID
+	if op != amdgpu.AMDGPU_CTX_OP_ALLOC_CTX && !ri.fd.resources.hasContext(ctxID) {
+		return 0, linuxerr.EINVAL
+	}
+	n, err := renderIoctlInvoke(ri, &ioctlParams)
+	if err != nil {
+		return n, err
+	}
+	switch op {
+	case amdgpu.AMDGPU_CTX_OP_ALLOC_CTX:
+		ri.fd.resources.addContext(ioctlParams.AllocatedCtxID())
+	case amdgpu.AMDGPU_CTX_OP_FREE_CTX:
+		ri.fd.resources.removeContext(ctxID)
+	}
+	if _, err := ioctlParams.CopyOut(ri.t, ri.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/amdgpu"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+const (
+	// maxDRMVersionStringLen bounds the size of each string copied for
+	// DRM_IOCTL_VERSION.
+	maxDRMVersionStringLen = 4096
+
+	// maxAMDGPUInfoReturnSize bounds the size of the buffer copied for
+	// DRM_IOCTL_AMDGPU_INFO. The largest query result is the VBIOS image.
+	maxAMDGPUInfoReturnSize = 1 << 20
+)
+
+func renderHostIoctl[Params any](hostFD int32, nr, argSize uint32, sentryParams *Params) (uintptr, error) {
+	n, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(hostFD), renderIoctlCmd(nr, argSize), uintptr(unsafe.Pointer(sentryParams)))
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
+
+func renderIoctlInvoke[Params any](ri *renderIoctlState, sentryParams *Params) (uintptr, error) {
+	return renderHostIoctl(ri.fd.hostFD(), ri.nr, ri.ioctlParamsSize, sentryParams)
+}
+
+// releaseResources destroys the DRM objects created through fd that the
+// application didn't destroy.
+func (fd *renderFD) releaseResources() {
+	hostFD := fd.hostFD()
+	contexts, gemHandles := fd.resources.drain()
+	for _, id := range contexts {
+		ioctlParams := amdgpu.DRMAMDGPUCtx{
+			Op:    amdgpu.AMDGPU_CTX_OP_FREE_CTX,
+			CtxID: id,
+		}
+		if _, err := renderHostIoctl(hostFD, amdgpu.DRM_IOCTL_AMDGPU_CTX, amdgpu.SizeofDRMAMDGPUCtx, &ioctlParams); err != nil {
+			log.Warningf("amdproxy: failed to free GPU context %d: %v", id, err)
+		}
+	}
+	for _, handle := range gemHandles {
+		ioctlParams := amdgpu.DRMGEMClose{Handle: handle}
+		if _, err := renderHostIoctl(hostFD, amdgpu.DRM_IOCTL_GEM_CLOSE, amdgpu.SizeofDRMGEMClose, &ioctlParams); err != nil {
+			log.Warningf("amdproxy: failed to close GEM handle %d: %v", handle, err)
+		}
+	}
+}
+
+// drmVersionString is a string buffer for DRM_IOCTL_VERSION.
+type drmVersionString struct {
+	addr uint64
+	buf  []byte
+}
+
+func newDRMVersionString(addr, length uint64) (drmVersionString, error) {
+	if length > maxDRMVersionStringLen {
+		return drmVersionString{}, linuxerr.EINVAL
+	}
+	// Allocate at least one byte so that the sentry's pointer is valid; the
+	// driver writes at most the requested number of bytes.
+	return drmVersionString{addr: addr, buf: make([]byte, length+1)}, nil
+}
+
+func (s *drmVersionString) ptr() uint64 {
+	return uint64FromPtr(unsafe.Pointer(&s.buf[0]))
+}
+
+// copyOut copies out the first min(length, len) bytes of the string, where
+// len is the length requested by the application and length is the length of
+// the full string as returned by the driver.
+func (s *drmVersionString) copyOut(ri *renderIoctlState, length uint64) error {
+	n := uint64(len(s.buf) - 1)
+	if length < n {
+		n = length
+	}
+	if n == 0 {
+		return nil
+	}
+	_, err := ri.t.CopyOutBytes(hostarch.Addr(s.addr), s.buf[:n])
+	return err
+}
+
+func renderVersion(ri *renderIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.DRMVersion
+	if _, err := ioctlParams.CopyIn(ri.t, ri.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	name, err := newDRMVersionString(ioctlParams.Name, ioctlParams.NameLen)
+	if err != nil {
+		return 0, err
+	}
+	date, err := newDRMVersionString(ioctlParams.Date, ioctlParams.DateLen)
+	if err != nil {
+		return 0, err
+	}
+	desc, err := newDRMVersionString(ioctlParams.Desc, ioctlParams.DescLen)
+	if err != nil {
+		return 0, err
+	}
+	sentryIoctlParams := ioctlParams
+	sentryIoctlParams.Name = name.ptr()
+	sentryIoctlParams.Date = date.ptr()
+	sentryIoctlParams.Desc = desc.ptr()
+	n, err := renderIoctlInvoke(ri, &sentryIoctlParams)
+	runtime.KeepAlive(name.buf)
+	runtime.KeepAlive(date.buf)
+	runtime.KeepAlive(desc.buf)
+	if err != nil {
+		return n, err
+	}
+	if err := name.copyOut(ri, sentryIoctlParams.NameLen); err != nil {
+		return n, err
+	}
+	if err := date.copyOut(ri, sentryIoctlParams.DateLen); err != nil {
+		return n, err
+	}
+	if err := desc.copyOut(ri, sentryIoctlParams.DescLen); err != nil {
+		return n, err
+	}
+	outIoctlParams := sentryIoctlParams
+	outIoctlParams.Name = ioctlParams.Name
+	outIoctlParams.Date = ioctlParams.Date
+	outIoctlParams.Desc = ioctlParams.Desc
+	if _, err := outIoctlParams.CopyOut(ri.t, ri.ioctlParamsAddr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func renderAMDGPUInfo(ri *renderIoctlState) (uintptr, error) {
+	var ioctlParams amdgpu.DRMAMDGPUInfo
+	if _, err := ioctlParams.CopyIn(ri.t, ri.ioctlParamsAddr); err != nil {
+		return 0, err
+	}
+	if ioctlParams.ReturnSize == 0 || ioctlParams.ReturnSize > maxAMDGPUInfoReturnSize {
+		return 0, linuxerr.EINVAL
+	}
+	// The driver may write fewer than ReturnSize bytes, so start from the
+	// application's buffer to preserve the remainder.
+	buf := make([]byte, ioctlParams.ReturnSize)
+	if _, err := ri.t.CopyInBytes(hostarch.Addr(ioctlParams.ReturnPointer), buf); err != nil {
+		return 0, err
+	}
+	sentryIoctlParams := ioctlParams
+	sentryIoctlParams.ReturnPointer = uint64FromPtr(unsafe.Pointer(&buf[0]))
+	n, err := renderIoctlInvoke(ri, &sentryIoctlParams)
+	runtime.KeepAlive(buf)
+	if err != nil {
+		return n, err
+	}
+	if _, err := ri.t.CopyOutBytes(hostarch.Addr(ioctlParams.ReturnPointer), buf); err != nil {
+		return n, err
+	}
+	// The driver doesn't modify the parameters, so skip copying them out.
+	return n, nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// kfdResources tracks the amdkfd objects created through a kfdFD.
+//
+// All kfdFDs share the host /dev/kfd file, so amdkfd only destroys objects
+// when the sandbox exits. kfdFD.Release destroys the objects that the
+// application created through the kfdFD instead, as amdkfd does when a
+// process's last reference to /dev/kfd is closed. For the same reason, an
+// object can only be destroyed through the kfdFD that created it, so that
+// applications can't destroy each other's objects.
+type kfdResources struct {
+	mu sync.Mutex
+
+	// queues contains the IDs of queues.
+	//
+	// +checklocks:mu
+	queues map[uint32]struct{}
+
+	// events contains the IDs of events.
+	//
+	// +checklocks:mu
+	events map[uint32]struct{}
+
+	// memory maps the handles of memory allocations to the IDs of the GPUs
+	// that they're mapped to.
+	//
+	// +checklocks:mu
+	memory map[uint64]map[uint32]struct{}
+}
+
+func (r *kfdResources) addQueue(id uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.queues == nil {
+		r.queues = make(map[uint32]struct{})
+	}
+	r.queues[id] = struct{}{}
+}
+
+func (r *kfdResources) hasQueue(id uint32) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.queues[id]
+	return ok
+}
+
+func (r *kfdResources) removeQueue(id uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.queues, id)
+}
+
+func (r *kfdResources) addEvent(id uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events == nil {
+		r.events = make(map[uint32]struct{})
+	}
+	r.events[id] = struct{}{}
+}
+
+func (r *kfdResources) hasEvent(id uint32) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.events[id]
+	return ok
+}
+
+func (r *kfdResources) removeEvent(id uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.events, id)
+}
+
+func (r *kfdResources) addMemory(handle uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.memory == nil {
+		r.memory = make(map[uint64]map[uint32]struct{})
+	}
+	r.memory[handle] = make(map[uint32]struct{})
+}
+
+func (r *kfdResources) hasMemory(handle uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.memory[handle]
+	return ok
+}
+
+func (r *kfdResources) removeMemory(handle uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.memory, handle)
+}
+
+// setMapped records that the memory allocation with the given handle is
+// mapped to, or unmapped from, the given GPUs.
+func (r *kfdResources) setMapped(handle uint64, gpuIDs []uint32, mapped bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	gpus, ok := r.memory[handle]
+	if !ok {
+		return
+	}
+	for _, id := range gpuIDs {
+		if mapped {
+			gpus[id] = struct{}{}
+		} else {
+			delete(gpus, id)
+		}
+	}
+}
+
+// kfdMemory is a memory allocation returned by kfdResources.drain.
+type kfdMemory struct {
+	handle uint64
+	// gpuIDs are the IDs of the GPUs that the allocation is mapped to.
+	gpuIDs []uint32
+}
+
+// drain returns all tracked objects, in the order in which they're
+// destroyed, and stops tracking them. Queues are destroyed before the memory
+// that backs them is freed, and memory must be unmapped before it can be
+// freed.
+func (r *kfdResources) drain() (queues, events []uint32, memory []kfdMemory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queues = sortedKeys(r.queues)
+	events = sortedKeys(r.events)
+	for _, handle := range sortedKeys(r.memory) {
+		memory = append(memory, kfdMemory{
+			handle: handle,
+			gpuIDs: sortedKeys(r.memory[handle]),
+		})
+	}
+	r.queues = nil
+	r.events = nil
+	r.memory = nil
+	return queues, events, memory
+}
+
+// renderResources tracks the DRM objects created through a renderFD. See
+// kfdResources for why this is necessary.
+type renderResources struct {
+	mu sync.Mutex
+
+	// gemHandles contains the handles of GEM buffer objects.
+	//
+	// +checklocks:mu
+	gemHandles map[uint32]struct{}
+
+	// contexts contains the IDs of GPU contexts.
+	//
+	// +checklocks:mu
+	contexts map[uint32]struct{}
+}
+
+func (r *renderResources) addGEMHandle(handle uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gemHandles == nil {
+		r.gemHandles = make(map[uint32]struct{})
+	}
+	r.gemHandles[handle] = struct{}{}
+}
+
+func (r *renderResources) hasGEMHandle(handle uint32) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.gemHandles[handle]
+	return ok
+}
+
+func (r *renderResources) removeGEMHandle(handle uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.gemHandles, handle)
+}
+
+func (r *renderResources) addContext(id uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.contexts == nil {
+		r.contexts = make(map[uint32]struct{})
+	}
+	r.contexts[id] = struct{}{}
+}
+
+func (r *renderResources) hasContext(id uint32) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.contexts[id]
+	return ok
+}
+
+func (r *renderResources) removeContext(id uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.contexts, id)
+}
+
+// drain returns all tracked objects and stops tracking them. Contexts are
+// destroyed before the buffer objects that they may use.
+func (r *renderResources) drain() (contexts, gemHandles []uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	contexts = sortedKeys(r.contexts)
+	gemHandles = sortedKeys(r.gemHandles)
+	r.contexts = nil
+	r.gemHandles = nil
+	return contexts, gemHandles
+}
+
+func sortedKeys[K uint32 | uint64, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
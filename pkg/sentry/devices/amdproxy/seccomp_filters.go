@@ -0,0 +1,58 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"sort"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// Filters returns seccomp-bpf filters for this package.
+func Filters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_OPENAT: seccomp.PerArg{
+			// All paths that we openat() are absolute, so we pass a dirfd
+			// of -1 (which is invalid for relative paths, but ignored for
+			// absolute paths) to hedge against bugs involving AT_FDCWD or
+			// real dirfds.
+			seccomp.EqualTo(^uintptr(0)),
+			seccomp.AnyValue{},
+			seccomp.MaskedEqual(unix.O_CREAT|unix.O_NOFOLLOW, unix.O_NOFOLLOW),
+			seccomp.AnyValue{},
+		},
+		unix.SYS_IOCTL: append(ioctlRules(kfdIoctlSizes, kfdIoctlCmd), ioctlRules(renderIoctlSizes, renderIoctlCmd)...),
+	}
+}
+
+// ioctlRules returns rules allowing the ioctl commands constructed by cmd from
+// each ioctl number and parameter size in sizes.
+func ioctlRules(sizes map[uint32]uint32, cmd func(nr, argSize uint32) uintptr) seccomp.Or {
+	nrs := make([]uint32, 0, len(sizes))
+	for nr := range sizes {
+		nrs = append(nrs, nr)
+	}
+	sort.Slice(nrs, func(i, j int) bool { return nrs[i] < nrs[j] })
+	nonNegativeFD := seccomp.NonNegativeFDCheck()
+	rules := make(seccomp.Or, 0, len(nrs))
+	for _, nr := range nrs {
+		rules = append(rules, seccomp.PerArg{
+			nonNegativeFD,
+			seccomp.EqualTo(cmd(nr, sizes[nr])),
+		})
+	}
+	return rules
+}
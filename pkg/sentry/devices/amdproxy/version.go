@@ -0,0 +1,145 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amdproxy
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/amdgpu"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// kfdVersion is a KFD ioctl interface version, as returned by
+// AMDKFD_IOC_GET_VERSION.
+type kfdVersion struct {
+	major uint32
+	minor uint32
+}
+
+func (v kfdVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+type kfdIoctlHandler func(ki *kfdIoctlState) (uintptr, error)
+type renderIoctlHandler func(ri *renderIoctlState) (uintptr, error)
+
+// A driverABIFunc constructs and returns a driverABI.
+// This indirection exists to avoid memory usage from unused driver ABIs.
+type driverABIFunc func() *driverABI
+
+// driverABI defines the AMD kernel driver ABI proxied at a given KFD ioctl
+// interface version.
+//
+// Versioning is supported for /dev/kfd ioctls (based on IOC_NR(cmd)). Render
+// node ioctls are part of the stable DRM uAPI and are shared by all versions.
+type driverABI struct {
+	kfdIoctl    map[uint32]kfdIoctlHandler
+	renderIoctl map[uint32]renderIoctlHandler
+}
+
+// abis is a global map containing all supported KFD ioctl interface versions.
+// This is initialized on Init() and is immutable henceforth.
+var abis map[kfdVersion]driverABIFunc
+var abisOnce sync.Once
+
+func addDriverABI(major, minor uint32, cons driverABIFunc) driverABIFunc {
+	if abis == nil {
+		abis = make(map[kfdVersion]driverABIFunc)
+	}
+	abis[kfdVersion{major, minor}] = cons
+	return cons
+}
+
+// Init initializes abis global map.
+func Init() {
+	abisOnce.Do(func() {
+		v1_9 := addDriverABI(1, 9, func() *driverABI {
+			// 1.9 (AMDKFD_IOC_AVAILABLE_MEMORY) is the earliest interface version
+			// supported by amdproxy. Since there is no parent to inherit from, the
+			// driverABI needs to be constructed with the entirety of the amdproxy
+			// functionality at this version.
+			return &driverABI{
+				kfdIoctl: map[uint32]kfdIoctlHandler{
+					amdgpu.AMDKFD_IOC_GET_VERSION:               kfdGetVersion,
+					amdgpu.AMDKFD_IOC_CREATE_QUEUE:              kfdCreateQueue,
+					amdgpu.AMDKFD_IOC_DESTROY_QUEUE:             kfdDestroyQueue,
+					amdgpu.AMDKFD_IOC_SET_MEMORY_POLICY:         kfdIoctlSimple, // struct kfd_ioctl_set_memory_policy_args
+					amdgpu.AMDKFD_IOC_GET_CLOCK_COUNTERS:        kfdIoctlSimple, // struct kfd_ioctl_get_clock_counters_args
+					amdgpu.AMDKFD_IOC_GET_PROCESS_APERTURES:     kfdIoctlSimple, // struct kfd_ioctl_get_process_apertures_args
+					amdgpu.AMDKFD_IOC_UPDATE_QUEUE:              kfdIoctlSimple, // struct kfd_ioctl_update_queue_args
+					amdgpu.AMDKFD_IOC_CREATE_EVENT:              kfdCreateEvent,
+					amdgpu.AMDKFD_IOC_DESTROY_EVENT:             kfdDestroyEvent,
+					amdgpu.AMDKFD_IOC_SET_EVENT:                 kfdIoctlSimple, // struct kfd_ioctl_set_event_args
+					amdgpu.AMDKFD_IOC_RESET_EVENT:               kfdIoctlSimple, // struct kfd_ioctl_reset_event_args
+					amdgpu.AMDKFD_IOC_WAIT_EVENTS:               kfdWaitEvents,
+					amdgpu.AMDKFD_IOC_SET_SCRATCH_BACKING_VA:    kfdIoctlSimple, // struct kfd_ioctl_set_scratch_backing_va_args
+					amdgpu.AMDKFD_IOC_GET_TILE_CONFIG:           kfdGetTileConfig,
+					amdgpu.AMDKFD_IOC_SET_TRAP_HANDLER:          kfdIoctlSimple, // struct kfd_ioctl_set_trap_handler_args
+					amdgpu.AMDKFD_IOC_GET_PROCESS_APERTURES_NEW: kfdGetProcessAperturesNew,
+					amdgpu.AMDKFD_IOC_ACQUIRE_VM:                kfdAcquireVM,
+					amdgpu.AMDKFD_IOC_ALLOC_MEMORY_OF_GPU:       kfdAllocMemoryOfGPU,
+					amdgpu.AMDKFD_IOC_FREE_MEMORY_OF_GPU:        kfdFreeMemoryOfGPU,
+					amdgpu.AMDKFD_IOC_MAP_MEMORY_TO_GPU:         kfdMapMemoryToGPU,
+					amdgpu.AMDKFD_IOC_UNMAP_MEMORY_FROM_GPU:     kfdMapMemoryToGPU,
+					amdgpu.AMDKFD_IOC_SET_CU_MASK:               kfdSetCUMask,
+					amdgpu.AMDKFD_IOC_ALLOC_QUEUE_GWS:           kfdIoctlSimple, // struct kfd_ioctl_alloc_queue_gws_args
+					amdgpu.AMDKFD_IOC_SET_XNACK_MODE:            kfdIoctlSimple, // struct kfd_ioctl_set_xnack_mode_args
+					amdgpu.AMDKFD_IOC_AVAILABLE_MEMORY:          kfdIoctlSimple, // struct kfd_ioctl_get_available_memory_args
+				},
+				renderIoctl: map[uint32]renderIoctlHandler{
+					amdgpu.DRM_IOCTL_VERSION:           renderVersion,
+					amdgpu.DRM_IOCTL_GEM_CLOSE:         renderGEMClose,
+					amdgpu.DRM_IOCTL_GET_CAP:           renderIoctlSimple, // struct drm_get_cap
+					amdgpu.DRM_IOCTL_AMDGPU_GEM_CREATE: renderGEMCreate,
+					amdgpu.DRM_IOCTL_AMDGPU_GEM_MMAP:   renderIoctlSimple, // union drm_amdgpu_gem_mmap
+					amdgpu.DRM_IOCTL_AMDGPU_CTX:        renderAMDGPUCtx,
+					amdgpu.DRM_IOCTL_AMDGPU_INFO:       renderAMDGPUInfo,
+				},
+			}
+		})
+
+		// 1.10 - 1.12 add SMI profiler events, unified ctx save/restore memory
+		// and AMDKFD_IOC_EXPORT_DMABUF, none of which are supported.
+		v1_12 := addDriverABI(1, 12, v1_9)
+
+		v1_13 := addDriverABI(1, 13, func() *driverABI {
+			abi := v1_12()
+			abi.kfdIoctl[amdgpu.AMDKFD_IOC_RUNTIME_ENABLE] = kfdIoctlSimple // struct kfd_ioctl_runtime_enable_args
+			return abi
+		})
+
+		// 1.14 adds the signal event age to struct kfd_event_data, which does
+		// not change its size.
+		_ = addDriverABI(1, 14, v1_13)
+	})
+}
+
+// abiFor returns the latest supported KFD ioctl interface version that is no
+// newer than hostVersion, and the constructor for its driverABI.
+func abiFor(hostVersion kfdVersion) (kfdVersion, driverABIFunc, bool) {
+	var (
+		best     kfdVersion
+		bestCons driverABIFunc
+	)
+	for v, cons := range abis {
+		if v.major != hostVersion.major || v.minor > hostVersion.minor {
+			continue
+		}
+		if bestCons == nil || v.minor > best.minor {
+			best, bestCons = v, cons
+		}
+	}
+	return best, bestCons, bestCons != nil
+}
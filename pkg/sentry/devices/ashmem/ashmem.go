@@ -0,0 +1,273 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ashmem implements the Android anonymous shared memory device,
+// /dev/ashmem.
+//
+// Each open file description of /dev/ashmem is a shared memory region, whose
+// name, size and protection mask may be set until it is first mapped. Regions
+// are backed by shmem-like tmpfs files. Pinning and unpinning of pages is
+// accepted, but unpinned pages are never purged.
+package ashmem
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	ashmemDevMinor = 0
+
+	// defaultName is the name reported for regions without a name, from
+	// drivers/staging/android/ashmem.c:ASHMEM_NAME_DEF.
+	defaultName = "dev/ashmem"
+
+	// protMask is the default protection mask of regions.
+	protMask = linux.PROT_READ | linux.PROT_WRITE | linux.PROT_EXEC
+)
+
+// ashmemDevice implements vfs.Device for /dev/ashmem.
+//
+// +stateify savable
+type ashmemDevice struct{}
+
+// Open implements vfs.Device.Open.
+func (ashmemDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &ashmemFD{
+		protMask: protMask,
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// ashmemFD implements vfs.FileDescriptionImpl for /dev/ashmem.
+//
+// +stateify savable
+type ashmemFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// name is the name of the region, set by ASHMEM_SET_NAME.
+	name string
+
+	// size is the size of the region in bytes, set by ASHMEM_SET_SIZE.
+	size uint64
+
+	// protMask is the set of PROT_* flags that mappings of the region may be
+	// given.
+	protMask uint64
+
+	// file is the tmpfs file backing the region. It is nil until the region
+	// is first mapped, after which its name and size can no longer change.
+	file *vfs.FileDescription
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *ashmemFD) Release(ctx context.Context) {
+	if fd.file != nil {
+		fd.file.DecRef(ctx)
+	}
+}
+
+// backingFile returns the file backing the region, or nil if it has not been
+// mapped yet.
+func (fd *ashmemFD) backingFile() *vfs.FileDescription {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.file
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *ashmemFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	file := fd.backingFile()
+	if file == nil {
+		return 0, nil
+	}
+	return file.Read(ctx, dst, opts)
+}
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *ashmemFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	file := fd.backingFile()
+	if file == nil {
+		return 0, linuxerr.EBADF
+	}
+	return file.Seek(ctx, offset, whence)
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *ashmemFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.size == 0 {
+		return linuxerr.EINVAL
+	}
+	if size, ok := hostarch.PageRoundUp(fd.size); !ok || opts.Length > size {
+		return linuxerr.EINVAL
+	}
+	allowed := hostarch.AccessType{
+		Read:    fd.protMask&linux.PROT_READ != 0,
+		Write:   fd.protMask&linux.PROT_WRITE != 0,
+		Execute: fd.protMask&linux.PROT_EXEC != 0,
+	}
+	if !allowed.SupersetOf(opts.Perms) {
+		return linuxerr.EPERM
+	}
+	opts.MaxPerms = opts.MaxPerms.Intersect(allowed)
+	if fd.file == nil {
+		file, err := tmpfs.NewZeroFile(ctx, auth.CredentialsFromContext(ctx), kernel.KernelFromContext(ctx).ShmMount(), fd.size)
+		if err != nil {
+			return err
+		}
+		fd.file = file
+	}
+	return fd.file.ConfigureMMap(ctx, opts)
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *ashmemFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	cmd := args[1].Uint()
+	arg := args[2]
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	switch cmd {
+	case linux.ASHMEM_SET_NAME:
+		if fd.file != nil {
+			return 0, linuxerr.EINVAL
+		}
+		name, err := t.CopyInString(arg.Pointer(), linux.ASHMEM_NAME_LEN)
+		if linuxerr.Equals(linuxerr.ENAMETOOLONG, err) {
+			// Linux silently truncates the name.
+			name = name[:linux.ASHMEM_NAME_LEN-1]
+		} else if err != nil {
+			return 0, err
+		}
+		fd.name = name
+		return 0, nil
+
+	case linux.ASHMEM_GET_NAME:
+		name := fd.name
+		if name == "" {
+			name = defaultName
+		}
+		_, err := t.CopyOutBytes(arg.Pointer(), append([]byte(name), 0))
+		return 0, err
+
+	case linux.ASHMEM_SET_SIZE:
+		if fd.file != nil {
+			return 0, linuxerr.EINVAL
+		}
+		fd.size = arg.Uint64()
+		return 0, nil
+
+	case linux.ASHMEM_GET_SIZE:
+		return uintptr(fd.size), nil
+
+	case linux.ASHMEM_SET_PROT_MASK:
+		mask := arg.Uint64()
+		// The protection mask can only be restricted.
+		if mask&^fd.protMask != 0 {
+			return 0, linuxerr.EINVAL
+		}
+		fd.protMask = mask
+		return 0, nil
+
+	case linux.ASHMEM_GET_PROT_MASK:
+		return uintptr(fd.protMask), nil
+
+	case linux.ASHMEM_PIN, linux.ASHMEM_UNPIN, linux.ASHMEM_GET_PIN_STATUS:
+		if fd.file == nil {
+			return 0, linuxerr.EINVAL
+		}
+		if cmd == linux.ASHMEM_GET_PIN_STATUS {
+			return linux.ASHMEM_IS_PINNED, nil
+		}
+		if err := fd.checkPinRange(t, arg.Pointer()); err != nil {
+			return 0, err
+		}
+		// Pages are never purged, so they are always still present when
+		// pinned again.
+		return linux.ASHMEM_NOT_PURGED, nil
+
+	case linux.ASHMEM_PURGE_ALL_CACHES:
+		if !t.HasCapability(linux.CAP_SYS_ADMIN) {
+			return 0, linuxerr.EPERM
+		}
+		return 0, nil
+
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// checkPinRange validates the struct ashmem_pin at addr.
+//
+// Preconditions: fd.mu must be locked.
+func (fd *ashmemFD) checkPinRange(t *kernel.Task, addr hostarch.Addr) error {
+	var buf [8]byte
+	if _, err := t.CopyInBytes(addr, buf[:]); err != nil {
+		return err
+	}
+	offset := uint64(hostarch.ByteOrder.Uint32(buf[0:]))
+	length := uint64(hostarch.ByteOrder.Uint32(buf[4:]))
+	if offset%hostarch.PageSize != 0 || length%hostarch.PageSize != 0 {
+		return linuxerr.EINVAL
+	}
+	size, _ := hostarch.PageRoundUp(fd.size)
+	if length == 0 {
+		length = size - offset
+	}
+	if offset+length > size || offset >= size {
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
+// Register registers the ashmem device with the given major device number.
+func Register(vfsObj *vfs.VirtualFilesystem, major uint32) error {
+	return vfsObj.RegisterDevice(vfs.CharDevice, major, ashmemDevMinor, ashmemDevice{}, &vfs.RegisterDeviceOptions{
+		GroupName: "ashmem",
+	})
+}
+
+// CreateDevtmpfsFiles creates device special files in dev representing all
+// devices implemented by this package.
+func CreateDevtmpfsFiles(ctx context.Context, dev *devtmpfs.Accessor, major uint32) error {
+	return dev.CreateDeviceFile(ctx, "ashmem", vfs.CharDevice, major, ashmemDevMinor, 0666 /* mode */)
+}
@@ -0,0 +1,220 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package binder implements the Android binder IPC devices, /dev/binder,
+// /dev/hwbinder and /dev/vndbinder, for processes in the same sandbox.
+//
+// Each device is a separate binder context with its own context manager.
+// Each open file description of a device is a binder process, which may
+// own nodes (binder objects), hold references (handles) to nodes of other
+// processes, and send transactions to them.
+//
+// The implementation covers the protocol used by libbinder: synchronous and
+// one-way transactions and replies, translation of binder objects, handles
+// and file descriptors in transaction data, and death notifications. The
+// following are not supported:
+//
+//   - binderfs, and hence dynamically created binder devices.
+//   - Scatter-gather transactions (BC_TRANSACTION_SG and BC_REPLY_SG), and
+//     the BINDER_TYPE_PTR and BINDER_TYPE_FDA objects they carry.
+//   - Reference counting of nodes: nodes and references live as long as the
+//     processes owning and holding them, and BR_INCREFS, BR_ACQUIRE and
+//     their counterparts are never sent.
+//   - BR_SPAWN_LOOPER: processes only use the threads they start themselves.
+//   - Save/restore of the binder state.
+package binder
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// devices are the names of the binder devices, indexed by minor device
+// number.
+var devices = []string{"binder", "hwbinder", "vndbinder"}
+
+// binderDevice implements vfs.Device for a binder device.
+//
+// +stateify savable
+type binderDevice struct {
+	bc *binderContext
+}
+
+// Open implements vfs.Device.Open.
+func (dev *binderDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &binderFD{
+		proc: newProc(dev.bc),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// binderFD implements vfs.FileDescriptionImpl for a binder device.
+//
+// +stateify savable
+type binderFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	proc *proc
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *binderFD) Release(ctx context.Context) {
+	fd.proc.release(ctx)
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *binderFD) EventRegister(e *waiter.Entry) error {
+	fd.proc.queue.EventRegister(e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *binderFD) EventUnregister(e *waiter.Entry) {
+	fd.proc.queue.EventUnregister(e)
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *binderFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	if fd.proc.hasWork() {
+		return mask & waiter.ReadableEvents
+	}
+	return 0
+}
+
+// Epollable implements vfs.FileDescriptionImpl.Epollable.
+func (fd *binderFD) Epollable() bool {
+	return true
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *binderFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	// The buffer in which transactions are received is only written by the
+	// driver.
+	if opts.Perms.Write {
+		return linuxerr.EPERM
+	}
+	opts.MaxPerms.Write = false
+	return fd.proc.mmap(ctx, opts)
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *binderFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	cmd := args[1].Uint()
+	addr := args[2].Pointer()
+
+	switch cmd {
+	case linux.BINDER_WRITE_READ:
+		return 0, fd.writeRead(t, addr)
+
+	case linux.BINDER_VERSION:
+		version := primitive.Int32(linux.BINDER_CURRENT_PROTOCOL_VERSION)
+		_, err := version.CopyOut(t, addr)
+		return 0, err
+
+	case linux.BINDER_SET_MAX_THREADS:
+		var maxThreads primitive.Uint32
+		if _, err := maxThreads.CopyIn(t, addr); err != nil {
+			return 0, err
+		}
+		fd.proc.setMaxThreads(uint32(maxThreads))
+		return 0, nil
+
+	case linux.BINDER_SET_CONTEXT_MGR:
+		return 0, fd.proc.setContextManager(0, 0)
+
+	case linux.BINDER_SET_CONTEXT_MGR_EXT:
+		var obj linux.FlatBinderObject
+		if _, err := obj.CopyIn(t, addr); err != nil {
+			return 0, err
+		}
+		return 0, fd.proc.setContextManager(obj.Binder, obj.Cookie)
+
+	case linux.BINDER_THREAD_EXIT:
+		fd.proc.threadExit(t)
+		return 0, nil
+
+	case linux.BINDER_ENABLE_ONEWAY_SPAM_DETECTION:
+		// One-way transactions are never reported as spam.
+		return 0, nil
+
+	default:
+		return 0, linuxerr.EINVAL
+	}
+}
+
+// writeRead handles BINDER_WRITE_READ.
+func (fd *binderFD) writeRead(t *kernel.Task, addr hostarch.Addr) error {
+	var bwr linux.BinderWriteRead
+	if _, err := bwr.CopyIn(t, addr); err != nil {
+		return err
+	}
+	var err error
+	if bwr.WriteConsumed < bwr.WriteSize {
+		err = fd.proc.write(t, &bwr)
+	}
+	if err == nil && bwr.ReadConsumed < bwr.ReadSize {
+		err = fd.proc.read(t, &bwr, fd.vfsfd.StatusFlags()&linux.O_NONBLOCK != 0)
+	}
+	if _, cerr := bwr.CopyOut(t, addr); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Register registers the binder devices with the given major device number.
+func Register(vfsObj *vfs.VirtualFilesystem, major uint32) error {
+	for minor, name := range devices {
+		if err := vfsObj.RegisterDevice(vfs.CharDevice, major, uint32(minor), &binderDevice{
+			bc: &binderContext{name: name},
+		}, &vfs.RegisterDeviceOptions{
+			GroupName: "binder",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateDevtmpfsFiles creates device special files in dev representing all
+// devices implemented by this package.
+func CreateDevtmpfsFiles(ctx context.Context, dev *devtmpfs.Accessor, major uint32) error {
+	for minor, name := range devices {
+		if err := dev.CreateDeviceFile(ctx, name, vfs.CharDevice, major, uint32(minor), 0666 /* mode */); err != nil {
+			return err
+		}
+	}
+	return nil
+}
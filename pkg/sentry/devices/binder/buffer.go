@@ -0,0 +1,153 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binder
+
+import (
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// maxBufferSize is the maximum usable size of a buffer, as in Linux.
+const maxBufferSize = 4 << 20
+
+// buffer is the memory in which a process receives transactions, the
+// equivalent of Linux's struct binder_alloc. It is backed by a tmpfs file
+// that the process maps read-only, and that the driver writes to.
+//
+// +stateify savable
+type buffer struct {
+	// file is the tmpfs file backing the buffer, or nil if the process has
+	// not mapped it yet.
+	file *vfs.FileDescription
+
+	// size is the usable size of the buffer.
+	size uint64
+
+	// base is the address at which the buffer is mapped, or 0 if unknown.
+	// It is accessed using atomic memory operations, since it is set by
+	// bufferMappable.AddMapping with memory manager locks held.
+	base atomicbitops.Uint64
+
+	// allocs are the allocated ranges of the buffer, sorted by offset.
+	allocs []allocation
+}
+
+// allocation is an allocated range of a buffer.
+//
+// +stateify savable
+type allocation struct {
+	off  uint64
+	size uint64
+}
+
+// alignUp rounds x up to a multiple of 8 bytes, the alignment of
+// transaction data and offsets.
+func alignUp(x uint64) uint64 {
+	return (x + 7) &^ 7
+}
+
+// alloc allocates size bytes of b and returns their offset.
+func (b *buffer) alloc(size uint64) (uint64, bool) {
+	size = alignUp(size)
+	if size == 0 {
+		size = 8
+	}
+	var off uint64
+	i := 0
+	for ; i < len(b.allocs); i++ {
+		if b.allocs[i].off-off >= size {
+			break
+		}
+		off = b.allocs[i].off + b.allocs[i].size
+	}
+	if off+size > b.size || off+size < off {
+		return 0, false
+	}
+	b.allocs = append(b.allocs, allocation{})
+	copy(b.allocs[i+1:], b.allocs[i:])
+	b.allocs[i] = allocation{off: off, size: size}
+	return off, true
+}
+
+// free frees the allocation at off. It returns false if there is none.
+func (b *buffer) free(off uint64) bool {
+	for i, a := range b.allocs {
+		if a.off == off {
+			b.allocs = append(b.allocs[:i], b.allocs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// writeAt writes data to b at off.
+func (b *buffer) writeAt(ctx context.Context, data []byte, off uint64) error {
+	_, err := b.file.PWrite(ctx, usermem.BytesIOSequence(data), int64(off), vfs.WriteOptions{})
+	return err
+}
+
+// mmap creates the buffer of p when it is mapped.
+func (p *proc) mmap(ctx context.Context, opts *memmap.MMapOpts) error {
+	p.bc.mu.Lock()
+	defer p.bc.mu.Unlock()
+	if p.buf.file != nil {
+		return linuxerr.EBUSY
+	}
+	file, err := tmpfs.NewZeroFile(ctx, auth.CredentialsFromContext(ctx), kernel.KernelFromContext(ctx).ShmMount(), opts.Length)
+	if err != nil {
+		return err
+	}
+	opts.Offset = 0
+	if err := file.ConfigureMMap(ctx, opts); err != nil {
+		file.DecRef(ctx)
+		return err
+	}
+	opts.Mappable = &bufferMappable{
+		Mappable: opts.Mappable,
+		proc:     p,
+	}
+	p.buf.file = file
+	p.buf.size = opts.Length
+	if p.buf.size > maxBufferSize {
+		p.buf.size = maxBufferSize
+	}
+	return nil
+}
+
+// bufferMappable wraps the memmap.Mappable of the file backing a buffer, to
+// learn the address at which the buffer is mapped.
+//
+// +stateify savable
+type bufferMappable struct {
+	memmap.Mappable
+	proc *proc
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (m *bufferMappable) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	if err := m.Mappable.AddMapping(ctx, ms, ar, offset, writable); err != nil {
+		return err
+	}
+	m.proc.buf.base.CompareAndSwap(0, uint64(ar.Start)-offset)
+	return nil
+}
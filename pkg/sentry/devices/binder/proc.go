@@ -0,0 +1,470 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binder
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// binderContext is the state shared by all processes using a binder device,
+// the equivalent of Linux's struct binder_context.
+//
+// +stateify savable
+type binderContext struct {
+	// name is the name of the device.
+	name string
+
+	// mu protects the state of the context and of all of its processes,
+	// threads, nodes and references.
+	mu sync.Mutex `state:"nosave"`
+
+	// mgr is the node of the context manager, which is referred to by
+	// handle 0 in all processes, or nil if there is none.
+	mgr *node
+}
+
+// proc is the binder state of an open file description of a binder device,
+// the equivalent of Linux's struct binder_proc.
+//
+// +stateify savable
+type proc struct {
+	bc *binderContext
+
+	// queue is notified when work is queued for the process or any of its
+	// threads.
+	queue waiter.Queue
+
+	// All fields below are protected by bc.mu.
+
+	// dead is true once the file description has been released.
+	dead bool
+
+	// threads are the threads that used the process, by task.
+	threads map[*kernel.Task]*thread
+
+	// todo is work that may be handled by any thread of the process.
+	todo []work
+
+	// nodes are the nodes owned by the process, by pointer.
+	nodes map[uint64]*node
+
+	// refs are the references held by the process, by handle. refsByNode
+	// indexes the same references by node.
+	refs       map[uint32]*ref
+	refsByNode map[*node]*ref
+
+	// maxThreads is set by BINDER_SET_MAX_THREADS.
+	maxThreads uint32
+
+	// buf is the buffer in which the process receives transactions.
+	buf buffer
+}
+
+// thread is the binder state of a task using a process, the equivalent of
+// Linux's struct binder_thread.
+//
+// +stateify savable
+type thread struct {
+	proc *proc
+
+	// All fields below are protected by proc.bc.mu.
+
+	// todo is work that must be handled by this thread.
+	todo []work
+
+	// incoming is the stack of synchronous transactions received by the
+	// thread and not replied to yet, innermost last.
+	incoming []*transaction
+
+	// waiting is the number of synchronous transactions sent by the thread
+	// whose reply has not been read yet.
+	waiting int
+
+	// dead is true once the thread has exited.
+	dead bool
+}
+
+// node is a binder object owned by a process, the equivalent of Linux's
+// struct binder_node.
+//
+// +stateify savable
+type node struct {
+	proc *proc
+
+	// ptr and cookie identify the object in the owning process.
+	ptr    uint64
+	cookie uint64
+
+	// refs are the references to the node, protected by proc.bc.mu.
+	refs map[*ref]struct{}
+}
+
+// ref is a reference held by a process to a node, the equivalent of Linux's
+// struct binder_ref.
+//
+// +stateify savable
+type ref struct {
+	proc   *proc
+	node   *node
+	handle uint32
+
+	// death is the cookie of the death notification requested for the
+	// node, valid if hasDeath is true. Protected by proc.bc.mu.
+	death    uint64
+	hasDeath bool
+}
+
+// transaction is a transaction or a reply, the equivalent of Linux's struct
+// binder_transaction.
+//
+// +stateify savable
+type transaction struct {
+	// from is the sending thread of a synchronous transaction, which is
+	// waiting for a reply. It is nil for one-way transactions and replies.
+	from *thread
+
+	// fromTG and fromEUID identify the sender of a synchronous transaction.
+	fromTG   *kernel.ThreadGroup
+	fromEUID auth.KUID
+
+	// to is the receiving process, and node the target of a transaction. node
+	// is nil for replies.
+	to   *proc
+	node *node
+
+	code  uint32
+	flags uint32
+
+	// off is the offset of the transaction's data in the buffer of the
+	// receiving process, followed by the offsets of objects at
+	// alignUp(dataSize).
+	off         uint64
+	dataSize    uint64
+	offsetsSize uint64
+
+	// fds are the files to install in the receiving process.
+	fds []transactionFD
+}
+
+// transactionFD is a file sent in a transaction.
+//
+// +stateify savable
+type transactionFD struct {
+	// off is the offset of the BINDER_TYPE_FD object in the transaction's
+	// data.
+	off uint64
+
+	// file is the file to install. The transaction holds a reference on it.
+	file *vfs.FileDescription
+}
+
+// work is an item of a todo list, the equivalent of Linux's struct
+// binder_work.
+//
+// +stateify savable
+type work struct {
+	// cmd is the BR_* reply returned to userspace.
+	cmd uint32
+
+	// tr is the transaction for BR_TRANSACTION and BR_REPLY.
+	tr *transaction
+
+	// cookie is the cookie for BR_DEAD_BINDER and
+	// BR_CLEAR_DEATH_NOTIFICATION_DONE.
+	cookie uint64
+
+	// endsWait is true if cmd is returned instead of the reply to a
+	// synchronous transaction, i.e. for BR_DEAD_REPLY and BR_FAILED_REPLY.
+	endsWait bool
+}
+
+func newProc(bc *binderContext) *proc {
+	return &proc{
+		bc:         bc,
+		threads:    make(map[*kernel.Task]*thread),
+		nodes:      make(map[uint64]*node),
+		refs:       make(map[uint32]*ref),
+		refsByNode: make(map[*node]*ref),
+	}
+}
+
+// threadFor returns the thread of p for t, creating it if needed.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) threadFor(t *kernel.Task) *thread {
+	th, ok := p.threads[t]
+	if !ok {
+		th = &thread{proc: p}
+		p.threads[t] = th
+	}
+	return th
+}
+
+// nodeFor returns the node of p for the object identified by ptr and
+// cookie, creating it if needed.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) nodeFor(ptr, cookie uint64) *node {
+	n, ok := p.nodes[ptr]
+	if !ok {
+		n = &node{
+			proc:   p,
+			ptr:    ptr,
+			cookie: cookie,
+			refs:   make(map[*ref]struct{}),
+		}
+		p.nodes[ptr] = n
+	}
+	return n
+}
+
+// refFor returns the reference held by p to n, creating it if needed.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) refFor(n *node) *ref {
+	if r, ok := p.refsByNode[n]; ok {
+		return r
+	}
+	r := &ref{
+		proc: p,
+		node: n,
+	}
+	if n == p.bc.mgr {
+		if old, ok := p.refs[0]; ok {
+			// old refers to a previous context manager.
+			p.removeRef(old)
+		}
+	} else {
+		// Use the lowest free handle, as Linux does. Handle 0 is reserved for
+		// the context manager.
+		for r.handle = 1; p.refs[r.handle] != nil; r.handle++ {
+		}
+	}
+	p.refs[r.handle] = r
+	p.refsByNode[n] = r
+	n.refs[r] = struct{}{}
+	return r
+}
+
+// removeRef removes r from the references held by p.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) removeRef(r *ref) {
+	delete(p.refs, r.handle)
+	delete(p.refsByNode, r.node)
+	delete(r.node.refs, r)
+}
+
+// lookupRef returns the reference held by p with the given handle, or nil if
+// there is none.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) lookupRef(handle uint32) *ref {
+	r := p.refs[handle]
+	if mgr := p.bc.mgr; handle == 0 && mgr != nil && (r == nil || r.node != mgr) {
+		r = p.refFor(mgr)
+	}
+	return r
+}
+
+// queueWork queues w for th if it is not nil, and otherwise for any thread
+// of p.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) queueWork(th *thread, w work) {
+	if th != nil {
+		th.todo = append(th.todo, w)
+	} else {
+		p.todo = append(p.todo, w)
+	}
+	p.queue.Notify(waiter.ReadableEvents)
+}
+
+// canHandleProcWork returns true if th may handle work queued for any thread
+// of its process: threads that are in the middle of a synchronous
+// transaction only handle their own work, as in Linux.
+//
+// Preconditions: th.proc.bc.mu must be locked.
+func (th *thread) canHandleProcWork() bool {
+	return len(th.incoming) == 0 && th.waiting == 0 && len(th.todo) == 0
+}
+
+// nextWork dequeues the next work for th.
+//
+// Preconditions: th.proc.bc.mu must be locked.
+func (th *thread) nextWork() (work, bool) {
+	p := th.proc
+	if len(th.todo) != 0 {
+		w := th.todo[0]
+		th.todo = th.todo[1:]
+		return w, true
+	}
+	if th.canHandleProcWork() && len(p.todo) != 0 {
+		w := p.todo[0]
+		p.todo = p.todo[1:]
+		return w, true
+	}
+	return work{}, false
+}
+
+// hasWork returns true if any thread of p has work to handle.
+func (p *proc) hasWork() bool {
+	p.bc.mu.Lock()
+	defer p.bc.mu.Unlock()
+	if len(p.todo) != 0 {
+		return true
+	}
+	for _, th := range p.threads {
+		if len(th.todo) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// setMaxThreads handles BINDER_SET_MAX_THREADS.
+func (p *proc) setMaxThreads(maxThreads uint32) {
+	p.bc.mu.Lock()
+	defer p.bc.mu.Unlock()
+	p.maxThreads = maxThreads
+}
+
+// setContextManager handles BINDER_SET_CONTEXT_MGR and
+// BINDER_SET_CONTEXT_MGR_EXT.
+func (p *proc) setContextManager(ptr, cookie uint64) error {
+	p.bc.mu.Lock()
+	defer p.bc.mu.Unlock()
+	if p.bc.mgr != nil {
+		return linuxerr.EBUSY
+	}
+	p.bc.mgr = p.nodeFor(ptr, cookie)
+	return nil
+}
+
+// failTransaction returns cmd to the sender of tr, if it is a synchronous
+// transaction whose sender is still alive, instead of the reply.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) failTransaction(tr *transaction, cmd uint32) {
+	if from := tr.from; from != nil && !from.dead {
+		from.proc.queueWork(from, work{cmd: cmd, endsWait: true})
+	}
+}
+
+// dropWork discards the work in todo, failing the synchronous transactions
+// it contains, and returns the files that must be released.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) dropWork(todo []work, files []*vfs.FileDescription) []*vfs.FileDescription {
+	for _, w := range todo {
+		if w.tr == nil {
+			continue
+		}
+		if w.cmd == linux.BR_TRANSACTION {
+			p.failTransaction(w.tr, linux.BR_DEAD_REPLY)
+		}
+		files = w.tr.releaseFDs(files)
+	}
+	return files
+}
+
+// releaseFDs appends the files held by tr to files, and returns the result.
+func (tr *transaction) releaseFDs(files []*vfs.FileDescription) []*vfs.FileDescription {
+	for _, fd := range tr.fds {
+		files = append(files, fd.file)
+	}
+	tr.fds = nil
+	return files
+}
+
+// exit marks th as dead, failing the transactions it received.
+//
+// Preconditions: th.proc.bc.mu must be locked.
+func (th *thread) exit(files []*vfs.FileDescription) []*vfs.FileDescription {
+	p := th.proc
+	th.dead = true
+	for _, tr := range th.incoming {
+		p.failTransaction(tr, linux.BR_DEAD_REPLY)
+	}
+	th.incoming = nil
+	files = p.dropWork(th.todo, files)
+	th.todo = nil
+	return files
+}
+
+// threadExit handles BINDER_THREAD_EXIT.
+func (p *proc) threadExit(t *kernel.Task) {
+	p.bc.mu.Lock()
+	var files []*vfs.FileDescription
+	if th, ok := p.threads[t]; ok {
+		files = th.exit(files)
+		delete(p.threads, t)
+	}
+	p.bc.mu.Unlock()
+	decRefAll(t, files)
+}
+
+// release is called when the file description of p is released. Pending
+// transactions are failed, and death notifications are sent for the nodes
+// of p.
+func (p *proc) release(ctx context.Context) {
+	p.bc.mu.Lock()
+	p.dead = true
+	var files []*vfs.FileDescription
+	for t, th := range p.threads {
+		files = th.exit(files)
+		delete(p.threads, t)
+	}
+	files = p.dropWork(p.todo, files)
+	p.todo = nil
+	for _, n := range p.nodes {
+		for r := range n.refs {
+			if r.hasDeath {
+				r.proc.queueWork(nil, work{cmd: linux.BR_DEAD_BINDER, cookie: r.death})
+			}
+		}
+	}
+	if mgr := p.bc.mgr; mgr != nil && mgr.proc == p {
+		p.bc.mgr = nil
+	}
+	for _, r := range p.refs {
+		delete(r.node.refs, r)
+	}
+	p.refs = nil
+	p.refsByNode = nil
+	bufFile := p.buf.file
+	p.buf.file = nil
+	p.bc.mu.Unlock()
+
+	decRefAll(ctx, files)
+	if bufFile != nil {
+		bufFile.DecRef(ctx)
+	}
+}
+
+// decRefAll releases files. It must be called without bc.mu locked, since
+// releasing a file may release a binder file description.
+func decRefAll(ctx context.Context, files []*vfs.FileDescription) {
+	for _, file := range files {
+		file.DecRef(ctx)
+	}
+}
@@ -0,0 +1,466 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binder
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// write handles the commands in the write buffer of bwr, the equivalent of
+// Linux's binder_thread_write().
+func (p *proc) write(t *kernel.Task, bwr *linux.BinderWriteRead) error {
+	for bwr.WriteConsumed < bwr.WriteSize {
+		addr := hostarch.Addr(bwr.WriteBuffer + bwr.WriteConsumed)
+		var cmd primitive.Uint32
+		if _, err := cmd.CopyIn(t, addr); err != nil {
+			return err
+		}
+		size := uint64(linux.IOC_SIZE(uint32(cmd)))
+		if size > bwr.WriteSize-bwr.WriteConsumed-4 {
+			return linuxerr.EINVAL
+		}
+		arg := make([]byte, size)
+		if _, err := t.CopyInBytes(addr+4, arg); err != nil {
+			return err
+		}
+		bwr.WriteConsumed += 4 + size
+		if stop, err := p.command(t, uint32(cmd), arg); stop || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// command handles a single command with the given argument. It returns true
+// if the following commands must not be handled, because the command failed
+// and userspace must read the failure first.
+func (p *proc) command(t *kernel.Task, cmd uint32, arg []byte) (bool, error) {
+	switch cmd {
+	case linux.BC_TRANSACTION, linux.BC_REPLY:
+		var td linux.BinderTransactionData
+		td.UnmarshalBytes(arg)
+		return p.transact(t, &td, cmd == linux.BC_REPLY), nil
+
+	case linux.BC_FREE_BUFFER:
+		p.freeBuffer(t, hostarch.ByteOrder.Uint64(arg))
+		return false, nil
+
+	case linux.BC_INCREFS, linux.BC_ACQUIRE, linux.BC_RELEASE, linux.BC_DECREFS, linux.BC_INCREFS_DONE, linux.BC_ACQUIRE_DONE:
+		// Reference counts are not tracked.
+		return false, nil
+
+	case linux.BC_REGISTER_LOOPER, linux.BC_ENTER_LOOPER, linux.BC_EXIT_LOOPER:
+		// Looper state is only used to spawn threads, which is not supported.
+		return false, nil
+
+	case linux.BC_REQUEST_DEATH_NOTIFICATION, linux.BC_CLEAR_DEATH_NOTIFICATION:
+		handle := hostarch.ByteOrder.Uint32(arg)
+		cookie := hostarch.ByteOrder.Uint64(arg[4:])
+		p.deathNotification(t, handle, cookie, cmd == linux.BC_REQUEST_DEATH_NOTIFICATION)
+		return false, nil
+
+	case linux.BC_DEAD_BINDER_DONE:
+		return false, nil
+
+	default:
+		t.Debugf("binder: unsupported command %#x", cmd)
+		return false, linuxerr.EINVAL
+	}
+}
+
+// freeBuffer handles BC_FREE_BUFFER.
+func (p *proc) freeBuffer(t *kernel.Task, ptr uint64) {
+	p.bc.mu.Lock()
+	defer p.bc.mu.Unlock()
+	if base := p.buf.base.Load(); ptr < base || !p.buf.free(ptr-base) {
+		t.Debugf("binder: BC_FREE_BUFFER of unallocated buffer %#x", ptr)
+	}
+}
+
+// deathNotification handles BC_REQUEST_DEATH_NOTIFICATION and
+// BC_CLEAR_DEATH_NOTIFICATION.
+func (p *proc) deathNotification(t *kernel.Task, handle uint32, cookie uint64, request bool) {
+	p.bc.mu.Lock()
+	defer p.bc.mu.Unlock()
+	r := p.lookupRef(handle)
+	if r == nil {
+		t.Debugf("binder: death notification for invalid handle %d", handle)
+		return
+	}
+	if request {
+		if r.hasDeath {
+			return
+		}
+		r.death, r.hasDeath = cookie, true
+		if r.node.proc.dead {
+			p.queueWork(nil, work{cmd: linux.BR_DEAD_BINDER, cookie: cookie})
+		}
+		return
+	}
+	if !r.hasDeath || r.death != cookie {
+		return
+	}
+	r.hasDeath = false
+	p.queueWork(p.threadFor(t), work{cmd: linux.BR_CLEAR_DEATH_NOTIFICATION_DONE, cookie: cookie})
+}
+
+// transact handles BC_TRANSACTION and BC_REPLY. It returns true if the
+// transaction failed.
+func (p *proc) transact(t *kernel.Task, td *linux.BinderTransactionData, reply bool) bool {
+	var (
+		data    []byte
+		offsets []byte
+		err     error
+	)
+	if td.DataSize > maxBufferSize || td.OffsetsSize > maxBufferSize || td.OffsetsSize%8 != 0 {
+		err = linuxerr.EINVAL
+	} else {
+		data = make([]byte, td.DataSize)
+		offsets = make([]byte, td.OffsetsSize)
+		if _, err = t.CopyInBytes(hostarch.Addr(td.Buffer), data); err == nil {
+			_, err = t.CopyInBytes(hostarch.Addr(td.Offsets), offsets)
+		}
+	}
+
+	p.bc.mu.Lock()
+	th := p.threadFor(t)
+	files, result := p.transactLocked(t, th, td, data, offsets, err, reply)
+	p.queueWork(th, work{cmd: result})
+	p.bc.mu.Unlock()
+
+	decRefAll(t, files)
+	return result != linux.BR_TRANSACTION_COMPLETE
+}
+
+// transactLocked sends the transaction or reply described by td, with the
+// given data and offsets of objects in the data, or fails it if copyErr is
+// not nil. It returns
+// BR_TRANSACTION_COMPLETE if it succeeds, and otherwise the error to return
+// to the sender and the files that must be released.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) transactLocked(t *kernel.Task, th *thread, td *linux.BinderTransactionData, data, offsets []byte, copyErr error, reply bool) ([]*vfs.FileDescription, uint32) {
+	tr := &transaction{
+		fromEUID:    t.Credentials().EffectiveKUID,
+		code:        td.Code,
+		flags:       td.Flags,
+		dataSize:    td.DataSize,
+		offsetsSize: td.OffsetsSize,
+	}
+	// target is the thread to which the transaction must be delivered, or
+	// nil if it may be handled by any thread.
+	var target *thread
+	var inReplyTo *transaction
+	if reply {
+		if len(th.incoming) == 0 {
+			return nil, linux.BR_FAILED_REPLY
+		}
+		inReplyTo = th.incoming[len(th.incoming)-1]
+		th.incoming = th.incoming[:len(th.incoming)-1]
+		target = inReplyTo.from
+		if target.dead {
+			return nil, linux.BR_DEAD_REPLY
+		}
+		tr.to = target.proc
+	} else {
+		r := p.lookupRef(uint32(td.Target))
+		if r == nil {
+			return nil, linux.BR_FAILED_REPLY
+		}
+		tr.node = r.node
+		tr.to = r.node.proc
+		if tr.to.dead {
+			return nil, linux.BR_DEAD_REPLY
+		}
+		if td.Flags&linux.TF_ONE_WAY == 0 {
+			tr.from = th
+			tr.fromTG = t.ThreadGroup()
+			// If a thread of the target process is waiting for a reply from
+			// this thread, let it handle the transaction rather than
+			// deadlocking, as Linux does.
+			for i := len(th.incoming) - 1; i >= 0; i-- {
+				if from := th.incoming[i].from; from != nil && from.proc == tr.to && !from.dead {
+					target = from
+					break
+				}
+			}
+		}
+	}
+
+	var files []*vfs.FileDescription
+	result := linux.BR_FAILED_REPLY
+	if copyErr == nil {
+		files, result = p.sendLocked(t, tr, data, offsets)
+	}
+	if result != linux.BR_TRANSACTION_COMPLETE {
+		if inReplyTo != nil {
+			p.failTransaction(inReplyTo, result)
+		}
+		return files, result
+	}
+	cmd := uint32(linux.BR_TRANSACTION)
+	if reply {
+		cmd = linux.BR_REPLY
+	}
+	if tr.from != nil {
+		th.waiting++
+	}
+	tr.to.queueWork(target, work{cmd: cmd, tr: tr})
+	return nil, linux.BR_TRANSACTION_COMPLETE
+}
+
+// sendLocked translates the objects in the data of tr, and copies the data
+// and offsets to the buffer of the receiving process.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) sendLocked(t *kernel.Task, tr *transaction, data, offsets []byte) ([]*vfs.FileDescription, uint32) {
+	if result := p.translate(t, tr, data, offsets); result != linux.BR_TRANSACTION_COMPLETE {
+		return tr.releaseFDs(nil), result
+	}
+	buf := &tr.to.buf
+	if buf.file == nil || buf.base.Load() == 0 {
+		return tr.releaseFDs(nil), linux.BR_FAILED_REPLY
+	}
+	off, ok := buf.alloc(alignUp(tr.dataSize) + tr.offsetsSize)
+	if !ok {
+		t.Debugf("binder: no space in buffer of %s for %d bytes of data and %d bytes of offsets", tr.to.bc.name, tr.dataSize, tr.offsetsSize)
+		return tr.releaseFDs(nil), linux.BR_FAILED_REPLY
+	}
+	if err := buf.writeAt(t, data, off); err != nil {
+		buf.free(off)
+		return tr.releaseFDs(nil), linux.BR_FAILED_REPLY
+	}
+	if err := buf.writeAt(t, offsets, off+alignUp(tr.dataSize)); err != nil {
+		buf.free(off)
+		return tr.releaseFDs(nil), linux.BR_FAILED_REPLY
+	}
+	tr.off = off
+	return nil, linux.BR_TRANSACTION_COMPLETE
+}
+
+// translate translates the objects at the given offsets in the data of a
+// transaction sent by p, for the receiving process of tr. Binder objects and
+// handles are turned into handles of the receiving process, or into binder
+// objects if it owns them. File descriptors are installed when the
+// transaction is received.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) translate(t *kernel.Task, tr *transaction, data, offsets []byte) uint32 {
+	var obj linux.FlatBinderObject
+	objSize := uint64(obj.SizeBytes())
+	// end is the end of the previous object. Objects may not overlap.
+	var end uint64
+	for i := 0; i < len(offsets); i += 8 {
+		off := hostarch.ByteOrder.Uint64(offsets[i:])
+		if off < end || off%4 != 0 || off > uint64(len(data)) || uint64(len(data))-off < objSize {
+			return linux.BR_FAILED_REPLY
+		}
+		end = off + objSize
+		obj.UnmarshalBytes(data[off:])
+		switch obj.Type {
+		case linux.BINDER_TYPE_BINDER, linux.BINDER_TYPE_WEAK_BINDER:
+			n := p.nodeFor(obj.Binder, obj.Cookie)
+			if obj.Type == linux.BINDER_TYPE_BINDER {
+				obj.Type = linux.BINDER_TYPE_HANDLE
+			} else {
+				obj.Type = linux.BINDER_TYPE_WEAK_HANDLE
+			}
+			obj.Binder = uint64(tr.to.refFor(n).handle)
+			obj.Cookie = 0
+
+		case linux.BINDER_TYPE_HANDLE, linux.BINDER_TYPE_WEAK_HANDLE:
+			r := p.lookupRef(uint32(obj.Binder))
+			if r == nil {
+				return linux.BR_FAILED_REPLY
+			}
+			if n := r.node; n.proc == tr.to {
+				if obj.Type == linux.BINDER_TYPE_HANDLE {
+					obj.Type = linux.BINDER_TYPE_BINDER
+				} else {
+					obj.Type = linux.BINDER_TYPE_WEAK_BINDER
+				}
+				obj.Binder = n.ptr
+				obj.Cookie = n.cookie
+			} else {
+				obj.Binder = uint64(tr.to.refFor(n).handle)
+				obj.Cookie = 0
+			}
+
+		case linux.BINDER_TYPE_FD:
+			file := t.GetFile(int32(obj.Binder))
+			if file == nil {
+				return linux.BR_FAILED_REPLY
+			}
+			tr.fds = append(tr.fds, transactionFD{off: off, file: file})
+
+		default:
+			t.Debugf("binder: unsupported object type %#x", obj.Type)
+			return linux.BR_FAILED_REPLY
+		}
+		obj.MarshalBytes(data[off:])
+	}
+	return linux.BR_TRANSACTION_COMPLETE
+}
+
+// read fills the read buffer of bwr with work for the calling thread,
+// blocking until there is some unless nonblocking is true, the equivalent of
+// Linux's binder_thread_read().
+func (p *proc) read(t *kernel.Task, bwr *linux.BinderWriteRead, nonblocking bool) error {
+	avail := bwr.ReadSize - bwr.ReadConsumed
+	var out []byte
+	if bwr.ReadConsumed == 0 && avail >= 4 {
+		out = hostarch.ByteOrder.AppendUint32(out, linux.BR_NOOP)
+	}
+
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	p.queue.EventRegister(&e)
+	defer p.queue.EventUnregister(&e)
+	for {
+		var files []*vfs.FileDescription
+		handled, full := false, false
+		p.bc.mu.Lock()
+		th := p.threadFor(t)
+		for {
+			// Only dequeue work if its largest possible output fits.
+			if uint64(len(out))+4+linux.SizeOfBinderTransactionData > avail {
+				full = true
+				break
+			}
+			w, ok := th.nextWork()
+			if !ok {
+				break
+			}
+			handled = true
+			out, files = p.receive(t, th, w, out, files)
+		}
+		p.bc.mu.Unlock()
+		decRefAll(t, files)
+
+		if handled || full {
+			break
+		}
+		if nonblocking {
+			return linuxerr.EAGAIN
+		}
+		if err := t.Block(ch); err != nil {
+			return err
+		}
+	}
+
+	if _, err := t.CopyOutBytes(hostarch.Addr(bwr.ReadBuffer+bwr.ReadConsumed), out); err != nil {
+		return err
+	}
+	bwr.ReadConsumed += uint64(len(out))
+	return nil
+}
+
+// receive appends the output of w, received by th, to out. It returns the
+// result, and files with the files that must be released appended.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) receive(t *kernel.Task, th *thread, w work, out []byte, files []*vfs.FileDescription) ([]byte, []*vfs.FileDescription) {
+	switch w.cmd {
+	case linux.BR_TRANSACTION, linux.BR_REPLY:
+		tr := w.tr
+		if w.cmd == linux.BR_REPLY {
+			th.waiting--
+		}
+		var (
+			td  linux.BinderTransactionData
+			err error
+		)
+		td, files, err = p.receiveTransaction(t, tr, files)
+		if err != nil {
+			t.Debugf("binder: failed to receive transaction: %v", err)
+			p.buf.free(tr.off)
+			if w.cmd == linux.BR_REPLY {
+				return hostarch.ByteOrder.AppendUint32(out, linux.BR_FAILED_REPLY), files
+			}
+			p.failTransaction(tr, linux.BR_FAILED_REPLY)
+			return out, files
+		}
+		if w.cmd == linux.BR_TRANSACTION && tr.from != nil {
+			th.incoming = append(th.incoming, tr)
+		}
+		out = hostarch.ByteOrder.AppendUint32(out, w.cmd)
+		tdBuf := make([]byte, td.SizeBytes())
+		td.MarshalBytes(tdBuf)
+		return append(out, tdBuf...), files
+
+	case linux.BR_DEAD_BINDER, linux.BR_CLEAR_DEATH_NOTIFICATION_DONE:
+		out = hostarch.ByteOrder.AppendUint32(out, w.cmd)
+		return hostarch.ByteOrder.AppendUint64(out, w.cookie), files
+
+	default:
+		if w.endsWait {
+			th.waiting--
+		}
+		return hostarch.ByteOrder.AppendUint32(out, w.cmd), files
+	}
+}
+
+// receiveTransaction installs the files sent in tr in the calling process,
+// and returns the struct binder_transaction_data describing tr. It returns
+// files with the files that must be released appended.
+//
+// Preconditions: p.bc.mu must be locked.
+func (p *proc) receiveTransaction(t *kernel.Task, tr *transaction, files []*vfs.FileDescription) (linux.BinderTransactionData, []*vfs.FileDescription, error) {
+	var installed []int32
+	for _, fd := range tr.fds {
+		fdNum, err := t.NewFDFrom(0, fd.file, kernel.FDFlags{CloseOnExec: true})
+		if err == nil {
+			installed = append(installed, fdNum)
+			var fdBuf [4]byte
+			hostarch.ByteOrder.PutUint32(fdBuf[:], uint32(fdNum))
+			// The file descriptor is stored in the low 32 bits of
+			// FlatBinderObject.Binder.
+			err = p.buf.writeAt(t, fdBuf[:], tr.off+fd.off+8)
+		}
+		if err != nil {
+			for _, fdNum := range installed {
+				if file := t.FDTable().Remove(t, fdNum); file != nil {
+					files = append(files, file)
+				}
+			}
+			return linux.BinderTransactionData{}, tr.releaseFDs(files), err
+		}
+	}
+	files = tr.releaseFDs(files)
+
+	base := p.buf.base.Load()
+	td := linux.BinderTransactionData{
+		Code:        tr.code,
+		Flags:       tr.flags,
+		SenderEUID:  uint32(tr.fromEUID.In(t.UserNamespace()).OrOverflow()),
+		DataSize:    tr.dataSize,
+		OffsetsSize: tr.offsetsSize,
+		Buffer:      base + tr.off,
+		Offsets:     base + tr.off + alignUp(tr.dataSize),
+	}
+	if tr.fromTG != nil {
+		td.SenderPID = int32(t.PIDNamespace().IDOfThreadGroup(tr.fromTG))
+	}
+	if tr.node != nil {
+		td.Target = tr.node.ptr
+		td.Cookie = tr.node.cookie
+	}
+	return td, files, nil
+}
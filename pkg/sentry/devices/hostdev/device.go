@@ -0,0 +1,133 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostdev
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fdnotifier"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// Spec describes a host character device exposed to the sandbox.
+type Spec struct {
+	// Path is the absolute path of the device under /dev, in the host and in
+	// the sandbox.
+	Path string
+
+	// Ioctls are the ioctls that are passed through to the device.
+	Ioctls []Ioctl
+}
+
+// MaxIoctlSize is the maximum Ioctl.Size.
+const MaxIoctlSize = hostarch.PageSize
+
+// Ioctl describes an ioctl that is passed through to a host device.
+type Ioctl struct {
+	// Request is the ioctl request number.
+	Request uint32
+
+	// Size is the size in bytes of the buffer that the ioctl's argument
+	// points to. The buffer is copied in before and copied out after the
+	// host ioctl, regardless of the direction encoded in Request, since
+	// drivers don't always honor it. If Size is 0, the argument is passed
+	// by value and must not be dereferenced by the driver.
+	Size uint32
+}
+
+// hostDevice implements vfs.Device for a host character device.
+//
+// +stateify savable
+type hostDevice struct {
+	path string
+
+	// ioctls maps allowed ioctl request numbers to the size of their
+	// argument buffer. It is immutable.
+	ioctls map[uint32]uint32
+}
+
+// Open implements vfs.Device.Open.
+func (dev *hostDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	hostFD, err := openHostPath(dev.path, int((opts.Flags&unix.O_ACCMODE)|unix.O_NONBLOCK|unix.O_NOFOLLOW|unix.O_CLOEXEC))
+	if err != nil {
+		ctx.Warningf("hostdev: failed to open host %s: %v", dev.path, err)
+		return nil, err
+	}
+	fd := &hostDeviceFD{
+		hostFD: int32(hostFD),
+		device: dev,
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	if err := fdnotifier.AddFD(int32(hostFD), &fd.queue); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// hostDeviceNumber returns the major and minor device numbers and the
+// permissions of the host character device at path.
+func hostDeviceNumber(path string) (major, minor uint32, perms uint16, err error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return 0, 0, 0, fmt.Errorf("stat(%q): %w", path, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFCHR {
+		return 0, 0, 0, fmt.Errorf("%q is not a character device", path)
+	}
+	return unix.Major(stat.Rdev), unix.Minor(stat.Rdev), uint16(stat.Mode & 0777), nil
+}
+
+// Register registers the host device described by spec in vfsObj, with the
+// same device numbers as in the host.
+func Register(vfsObj *vfs.VirtualFilesystem, spec Spec) error {
+	major, minor, _, err := hostDeviceNumber(spec.Path)
+	if err != nil {
+		return err
+	}
+	dev := &hostDevice{
+		path:   spec.Path,
+		ioctls: make(map[uint32]uint32, len(spec.Ioctls)),
+	}
+	for _, ioctl := range spec.Ioctls {
+		if ioctl.Size > MaxIoctlSize {
+			return fmt.Errorf("ioctl %#x on %q has size %d, maximum is %d", ioctl.Request, spec.Path, ioctl.Size, MaxIoctlSize)
+		}
+		dev.ioctls[ioctl.Request] = ioctl.Size
+	}
+	return vfsObj.RegisterDevice(vfs.CharDevice, major, minor, dev, &vfs.RegisterDeviceOptions{
+		GroupName: "hostdev",
+	})
+}
+
+// CreateDevtmpfsFile creates the device file for the host device described by
+// spec, with the same permissions as in the host.
+func CreateDevtmpfsFile(ctx context.Context, dev *devtmpfs.Accessor, spec Spec) error {
+	major, minor, perms, err := hostDeviceNumber(spec.Path)
+	if err != nil {
+		return err
+	}
+	return dev.CreateDeviceFile(ctx, strings.TrimPrefix(spec.Path, "/dev/"), vfs.CharDevice, major, minor, perms)
+}
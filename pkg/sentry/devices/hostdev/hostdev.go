@@ -0,0 +1,160 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hostdev implements generic proxying of host character devices.
+//
+// Reads, writes and polling are passed through to the host device. Only
+// allowlisted ioctls are passed through, and the size of each one's argument
+// buffer is given explicitly by the allowlist rather than trusted from the
+// ioctl request number: ioctls whose argument contains pointers are not
+// supported. Memory mappings of the device are not supported.
+package hostdev
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/fdnotifier"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/hostfd"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// hostDeviceFD implements vfs.FileDescriptionImpl for a host character
+// device.
+//
+// hostDeviceFD is not savable; we do not implement save/restore of host
+// device state.
+type hostDeviceFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD int32
+	device *hostDevice
+	queue  waiter.Queue
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *hostDeviceFD) Release(context.Context) {
+	fdnotifier.RemoveFD(fd.hostFD)
+	unix.Close(int(fd.hostFD))
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *hostDeviceFD) EventRegister(e *waiter.Entry) error {
+	fd.queue.EventRegister(e)
+	if err := fdnotifier.UpdateFD(fd.hostFD); err != nil {
+		fd.queue.EventUnregister(e)
+		return err
+	}
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *hostDeviceFD) EventUnregister(e *waiter.Entry) {
+	fd.queue.EventUnregister(e)
+	if err := fdnotifier.UpdateFD(fd.hostFD); err != nil {
+		panic(fmt.Sprint("UpdateFD:", err))
+	}
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *hostDeviceFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return fdnotifier.NonBlockingPoll(fd.hostFD, mask)
+}
+
+// Epollable implements vfs.FileDescriptionImpl.Epollable.
+func (fd *hostDeviceFD) Epollable() bool {
+	return true
+}
+
+// isBlockError returns true if err indicates that the host device would have
+// blocked.
+func isBlockError(err error) bool {
+	return linuxerr.Equals(linuxerr.EAGAIN, err) || linuxerr.Equals(linuxerr.EWOULDBLOCK, err)
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *hostDeviceFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	if opts.Flags != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	reader := hostfd.GetReadWriterAt(fd.hostFD, -1, 0)
+	n, err := dst.CopyOutFrom(ctx, reader)
+	hostfd.PutReadWriterAt(reader)
+	if isBlockError(err) {
+		// If we got any data at all, return it as a "completed" partial read
+		// rather than retrying until complete.
+		if n != 0 {
+			err = nil
+		} else {
+			err = linuxerr.ErrWouldBlock
+		}
+	}
+	return n, err
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *hostDeviceFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	if opts.Flags != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	writer := hostfd.GetReadWriterAt(fd.hostFD, -1, 0)
+	n, err := src.CopyInTo(ctx, writer)
+	hostfd.PutReadWriterAt(writer)
+	if isBlockError(err) {
+		err = linuxerr.ErrWouldBlock
+	}
+	return n, err
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *hostDeviceFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	cmd := args[1].Uint()
+	size, ok := fd.device.ioctls[cmd]
+	if !ok {
+		ctx.Debugf("hostdev: rejecting ioctl %#x on %s", cmd, fd.device.path)
+		return 0, linuxerr.ENOTTY
+	}
+
+	if size == 0 {
+		// The argument is passed by value.
+		return ioctlInvoke(fd.hostFD, cmd, uintptr(args[2].Uint64()))
+	}
+
+	// The argument points to a buffer of the configured size. Application
+	// addresses are meaningless to the host, so the driver is given a
+	// sentry copy. The size and direction encoded in cmd can't be trusted
+	// (e.g. TUNSETIFF claims 4 bytes but copies a struct ifreq in and out),
+	// so the whole buffer is copied in both directions.
+	argPtr := args[2].Pointer()
+	buf := make([]byte, size)
+	if _, err := uio.CopyIn(ctx, argPtr, buf, usermem.IOOpts{}); err != nil {
+		return 0, err
+	}
+	n, err := ioctlInvokeBuf(fd.hostFD, cmd, buf)
+	if err != nil {
+		return n, err
+	}
+	if _, err := uio.CopyOut(ctx, argPtr, buf, usermem.IOOpts{}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostdev
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/seccomp"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// newTestFD returns a hostDeviceFD for a host pseudoterminal master, which
+// supports the TIOC[GS]WINSZ ioctls.
+func newTestFD(t *testing.T, ioctls map[uint32]uint32) *hostDeviceFD {
+	hostFD, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Skipf("opening /dev/ptmx: %v", err)
+	}
+	t.Cleanup(func() { unix.Close(hostFD) })
+	return &hostDeviceFD{
+		hostFD: int32(hostFD),
+		device: &hostDevice{path: "/dev/ptmx", ioctls: ioctls},
+	}
+}
+
+func ioctlArgs(cmd uint32, addr uintptr) arch.SyscallArguments {
+	var args arch.SyscallArguments
+	args[1].Value = uintptr(cmd)
+	args[2].Value = addr
+	return args
+}
+
+func TestIoctlNotAllowed(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fd := newTestFD(t, map[uint32]uint32{unix.TIOCGWINSZ: 8})
+	uio := &usermem.BytesIO{Bytes: make([]byte, 8)}
+	if _, err := fd.Ioctl(ctx, uio, 0, ioctlArgs(unix.TIOCSWINSZ, 0)); !linuxerr.Equals(linuxerr.ENOTTY, err) {
+		t.Errorf("Ioctl(TIOCSWINSZ) got error %v, want ENOTTY", err)
+	}
+}
+
+func TestIoctlUsesConfiguredSize(t *testing.T) {
+	ctx := contexttest.Context(t)
+	// TIOCGWINSZ writes 8 bytes. The allowlist claims 16, so the last 8
+	// bytes must be copied in and back out unchanged.
+	fd := newTestFD(t, map[uint32]uint32{
+		unix.TIOCSWINSZ: 8,
+		unix.TIOCGWINSZ: 16,
+	})
+
+	mem := make([]byte, 32)
+	binary.LittleEndian.PutUint16(mem[0:], 24) // ws_row
+	binary.LittleEndian.PutUint16(mem[2:], 80) // ws_col
+	uio := &usermem.BytesIO{Bytes: mem}
+	if _, err := fd.Ioctl(ctx, uio, 0, ioctlArgs(unix.TIOCSWINSZ, 0)); err != nil {
+		t.Fatalf("Ioctl(TIOCSWINSZ) failed: %v", err)
+	}
+
+	marker := bytes.Repeat([]byte{0xaa}, 8)
+	copy(mem[24:], marker)
+	if _, err := fd.Ioctl(ctx, uio, 0, ioctlArgs(unix.TIOCGWINSZ, 16)); err != nil {
+		t.Fatalf("Ioctl(TIOCGWINSZ) failed: %v", err)
+	}
+	if row, col := binary.LittleEndian.Uint16(mem[16:]), binary.LittleEndian.Uint16(mem[18:]); row != 24 || col != 80 {
+		t.Errorf("TIOCGWINSZ got %dx%d, want 24x80", row, col)
+	}
+	if !bytes.Equal(mem[24:], marker) {
+		t.Errorf("bytes beyond the driver's struct were modified: got %x, want %x", mem[24:], marker)
+	}
+}
+
+func TestIoctlBadAddress(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fd := newTestFD(t, map[uint32]uint32{unix.TIOCGWINSZ: 8})
+	uio := &usermem.BytesIO{Bytes: make([]byte, 4)}
+	// The configured size doesn't fit in application memory, so the ioctl
+	// must fail before reaching the host.
+	if _, err := fd.Ioctl(ctx, uio, 0, ioctlArgs(unix.TIOCGWINSZ, 0)); !linuxerr.Equals(linuxerr.EFAULT, err) {
+		t.Errorf("Ioctl(TIOCGWINSZ) got error %v, want EFAULT", err)
+	}
+}
+
+func TestFiltersRestrictOpenPaths(t *testing.T) {
+	specs := []Spec{
+		{Path: "/dev/hidraw0", Ioctls: []Ioctl{{Request: 0x80044801, Size: 4}}},
+		{Path: "/dev/ttyUSB0"},
+	}
+	rules := Filters(specs)
+	opens, ok := rules[unix.SYS_OPENAT].(seccomp.Or)
+	if !ok {
+		t.Fatalf("openat rule is %T, want seccomp.Or", rules[unix.SYS_OPENAT])
+	}
+	if len(opens) != len(specs) {
+		t.Fatalf("got %d openat rules, want %d", len(opens), len(specs))
+	}
+	for i, spec := range specs {
+		args, ok := opens[i].(seccomp.PerArg)
+		if !ok {
+			t.Fatalf("openat rule %d is %T, want seccomp.PerArg", i, opens[i])
+		}
+		want := seccomp.EqualTo(hostPathAddr(spec.Path))
+		if args[1] != want {
+			t.Errorf("openat rule for %q allows path %v, want %v", spec.Path, args[1], want)
+		}
+	}
+	if hostPathAddr("/dev/hidraw0") == hostPathAddr("/dev/ttyUSB0") {
+		t.Errorf("different paths have the same address")
+	}
+}
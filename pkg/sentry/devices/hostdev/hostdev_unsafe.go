@@ -0,0 +1,72 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostdev
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// hostPaths contains NUL-terminated copies of the paths of host devices,
+// which are never freed, so that their addresses can be allowed by seccomp
+// filters.
+var hostPaths struct {
+	mu    sync.Mutex
+	paths map[string][]byte
+}
+
+// hostPathAddr returns the address of a NUL-terminated copy of path. The
+// address is the same for all calls with the same path.
+func hostPathAddr(path string) uintptr {
+	hostPaths.mu.Lock()
+	defer hostPaths.mu.Unlock()
+	p, ok := hostPaths.paths[path]
+	if !ok {
+		if hostPaths.paths == nil {
+			hostPaths.paths = make(map[string][]byte)
+		}
+		p = append([]byte(path), 0)
+		hostPaths.paths[path] = p
+	}
+	return uintptr(unsafe.Pointer(&p[0]))
+}
+
+// openHostPath opens the host device at path, using the path address allowed
+// by Filters.
+func openHostPath(path string, flags int) (int, error) {
+	fd, _, errno := unix.Syscall6(unix.SYS_OPENAT, ^uintptr(0) /* -1 */, hostPathAddr(path), uintptr(flags), 0, 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+func ioctlInvoke(hostFD int32, cmd uint32, arg uintptr) (uintptr, error) {
+	n, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), arg)
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
+
+func ioctlInvokeBuf(hostFD int32, cmd uint32, buf []byte) (uintptr, error) {
+	n, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostdev
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// Filters returns seccomp-bpf filters for the given host devices.
+func Filters(specs []Spec) seccomp.SyscallRules {
+	nonNegativeFD := seccomp.NonNegativeFDCheck()
+	ioctls := seccomp.Or{}
+	opens := seccomp.Or{}
+	seen := make(map[uint32]struct{})
+	for _, spec := range specs {
+		// Only the configured paths may be opened. openHostPath always
+		// passes the same address for a given path, so it can be matched
+		// without inspecting the string.
+		opens = append(opens, seccomp.PerArg{
+			// All paths that we openat() are absolute, so we pass a dirfd
+			// of -1 (which is invalid for relative paths, but ignored for
+			// absolute paths) to hedge against bugs involving AT_FDCWD or
+			// real dirfds.
+			seccomp.EqualTo(^uintptr(0)),
+			seccomp.EqualTo(hostPathAddr(spec.Path)),
+			seccomp.MaskedEqual(unix.O_CREAT|unix.O_NOFOLLOW, unix.O_NOFOLLOW),
+			seccomp.AnyValue{},
+		})
+		for _, ioctl := range spec.Ioctls {
+			if _, ok := seen[ioctl.Request]; ok {
+				continue
+			}
+			seen[ioctl.Request] = struct{}{}
+			ioctls = append(ioctls, seccomp.PerArg{
+				nonNegativeFD,
+				seccomp.EqualTo(ioctl.Request),
+			})
+		}
+	}
+	rules := seccomp.SyscallRules{}
+	if len(opens) > 0 {
+		rules[unix.SYS_OPENAT] = opens
+	}
+	if len(ioctls) > 0 {
+		rules[unix.SYS_IOCTL] = ioctls
+	}
+	return rules
+}
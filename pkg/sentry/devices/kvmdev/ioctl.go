@@ -0,0 +1,111 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvmdev
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/eventfd"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// ioctlInfo describes an ioctl that is passed through to the host.
+//
+// If IOC_SIZE(cmd) is 0, the ioctl's argument is passed through unmodified.
+// Otherwise, it points to an IOC_SIZE(cmd)-byte buffer that is copied in
+// before the ioctl is invoked, and copied out afterward if IOC_DIR(cmd)
+// includes IOC_READ. No ioctl in the allowlist contains pointers in its
+// buffer.
+type ioctlInfo struct {
+	// If entrySize is not 0, the buffer is a header whose first field is a
+	// 32-bit count of entrySize-byte entries that immediately follow it.
+	entrySize uint32
+
+	// maxEntries is the maximum count of entries. Larger counts are clamped
+	// for ioctls that read from the host, and rejected for ioctls that only
+	// write to it.
+	maxEntries uint32
+}
+
+// passthroughIoctl invokes the allowlisted ioctl cmd on hostFD.
+func passthroughIoctl(ctx context.Context, uio usermem.IO, hostFD int32, allowlist map[uint32]ioctlInfo, cmd uint32, arg arch.SyscallArgument) (uintptr, error) {
+	info, ok := allowlist[cmd]
+	if !ok {
+		ctx.Warningf("kvmdev: unsupported ioctl %#x", cmd)
+		return 0, linuxerr.EINVAL
+	}
+	size := linux.IOC_SIZE(cmd)
+	if size == 0 {
+		return ioctlInvoke(hostFD, cmd, uintptr(arg.Uint64()))
+	}
+
+	// Note that buffers are copied in regardless of IOC_DIR(cmd), since some
+	// KVM ioctls (e.g. KVM_SET_IRQCHIP) are misdeclared as read-only.
+	addr := arg.Pointer()
+	buf := make([]byte, size)
+	if _, err := uio.CopyIn(ctx, addr, buf, usermem.IOOpts{}); err != nil {
+		return 0, err
+	}
+	isRead := linux.IOC_DIR(cmd)&linux.IOC_READ != 0
+	if info.entrySize != 0 {
+		count := hostarch.ByteOrder.Uint32(buf)
+		if count > info.maxEntries {
+			if !isRead {
+				return 0, linuxerr.E2BIG
+			}
+			count = info.maxEntries
+			hostarch.ByteOrder.PutUint32(buf, count)
+		}
+		buf = append(buf, make([]byte, count*info.entrySize)...)
+		if _, err := uio.CopyIn(ctx, addr+hostarch.Addr(size), buf[size:], usermem.IOOpts{}); err != nil {
+			return 0, err
+		}
+	}
+	n, err := ioctlInvokeBuf(hostFD, cmd, buf)
+	if !isRead {
+		return n, err
+	}
+	switch err {
+	case nil:
+	case unix.E2BIG:
+		// The host updated the header with the required count of entries.
+		buf = buf[:size]
+	default:
+		return n, err
+	}
+	if _, cerr := uio.CopyOut(ctx, addr, buf, usermem.IOOpts{}); cerr != nil {
+		return n, cerr
+	}
+	return n, err
+}
+
+// hostEventFD returns the host eventfd backing the application eventfd fd.
+func hostEventFD(t *kernel.Task, fd int32) (int, error) {
+	file, _ := t.FDTable().Get(fd)
+	if file == nil {
+		return -1, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	efd, ok := file.Impl().(*eventfd.EventFileDescription)
+	if !ok {
+		return -1, linuxerr.EINVAL
+	}
+	return efd.HostFD()
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvmdev
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// archSupported is true if /dev/kvm passthrough is supported.
+const archSupported = true
+
+// Limits on the number of entries in variable-length ioctl arguments, from
+// arch/x86/include/asm/kvm_host.h and arch/x86/kvm/x86.c.
+const (
+	maxCPUIDEntries    = 256
+	maxMSRIndexEntries = 1024
+	maxMSREntries      = 256
+	maxIRQRoutes       = 4096
+)
+
+// Sizes of entries in variable-length ioctl arguments, from
+// arch/x86/include/uapi/asm/kvm.h and include/uapi/linux/kvm.h.
+const (
+	sizeofCPUIDEntry2  = 40
+	sizeofMSRIndex     = 4
+	sizeofMSREntry     = 16
+	sizeofRoutingEntry = 48
+)
+
+// systemIoctls are the ioctls passed through on /dev/kvm, other than those
+// handled by kvmFD.Ioctl.
+var systemIoctls = map[uint32]ioctlInfo{
+	linux.KVM_GET_API_VERSION:            {},
+	linux.KVM_GET_VCPU_MMAP_SIZE:         {},
+	linux.KVM_GET_MSR_INDEX_LIST:         {entrySize: sizeofMSRIndex, maxEntries: maxMSRIndexEntries},
+	linux.KVM_GET_MSR_FEATURE_INDEX_LIST: {entrySize: sizeofMSRIndex, maxEntries: maxMSRIndexEntries},
+	linux.KVM_GET_SUPPORTED_CPUID:        {entrySize: sizeofCPUIDEntry2, maxEntries: maxCPUIDEntries},
+	linux.KVM_GET_EMULATED_CPUID:         {entrySize: sizeofCPUIDEntry2, maxEntries: maxCPUIDEntries},
+}
+
+// vmIoctls are the ioctls passed through on VM file descriptors, other than
+// those handled by vmFD.Ioctl.
+var vmIoctls = map[uint32]ioctlInfo{
+	linux.KVM_SET_TSS_ADDR:          {},
+	linux.KVM_SET_IDENTITY_MAP_ADDR: {},
+	linux.KVM_CREATE_IRQCHIP:        {},
+	linux.KVM_IRQ_LINE:              {},
+	linux.KVM_IRQ_LINE_STATUS:       {},
+	linux.KVM_GET_IRQCHIP:           {},
+	linux.KVM_SET_IRQCHIP:           {},
+	linux.KVM_SET_GSI_ROUTING:       {entrySize: sizeofRoutingEntry, maxEntries: maxIRQRoutes},
+	linux.KVM_CREATE_PIT2:           {},
+	linux.KVM_GET_PIT2:              {},
+	linux.KVM_SET_PIT2:              {},
+	linux.KVM_GET_CLOCK:             {},
+	linux.KVM_SET_CLOCK:             {},
+	linux.KVM_SIGNAL_MSI:            {},
+}
+
+// vcpuIoctls are the ioctls passed through on vCPU file descriptors, other
+// than those handled by vcpuFD.Ioctl.
+var vcpuIoctls = map[uint32]ioctlInfo{
+	linux.KVM_GET_REGS:        {},
+	linux.KVM_SET_REGS:        {},
+	linux.KVM_GET_SREGS:       {},
+	linux.KVM_SET_SREGS:       {},
+	linux.KVM_TRANSLATE:       {},
+	linux.KVM_INTERRUPT:       {},
+	linux.KVM_GET_MSRS:        {entrySize: sizeofMSREntry, maxEntries: maxMSREntries},
+	linux.KVM_SET_MSRS:        {entrySize: sizeofMSREntry, maxEntries: maxMSREntries},
+	linux.KVM_GET_FPU:         {},
+	linux.KVM_SET_FPU:         {},
+	linux.KVM_GET_LAPIC:       {},
+	linux.KVM_SET_LAPIC:       {},
+	linux.KVM_GET_CPUID2:      {entrySize: sizeofCPUIDEntry2, maxEntries: maxCPUIDEntries},
+	linux.KVM_SET_CPUID2:      {entrySize: sizeofCPUIDEntry2, maxEntries: maxCPUIDEntries},
+	linux.KVM_GET_MP_STATE:    {},
+	linux.KVM_SET_MP_STATE:    {},
+	linux.KVM_NMI:             {},
+	linux.KVM_GET_VCPU_EVENTS: {},
+	linux.KVM_SET_VCPU_EVENTS: {},
+	linux.KVM_GET_DEBUGREGS:   {},
+	linux.KVM_SET_DEBUGREGS:   {},
+	linux.KVM_GET_TSC_KHZ:     {},
+	linux.KVM_SET_TSC_KHZ:     {},
+	linux.KVM_GET_XSAVE:       {},
+	linux.KVM_SET_XSAVE:       {},
+	linux.KVM_GET_XCRS:        {},
+	linux.KVM_SET_XCRS:        {},
+	linux.KVM_KVMCLOCK_CTRL:   {},
+}
+
+// enableCapabilities are the capabilities that may be enabled by
+// KVM_ENABLE_CAP. None of them take pointer arguments.
+//
+// KVM_CAP_X86_DISABLE_EXITS is deliberately excluded: it lets the guest
+// execute HLT, MWAIT and PAUSE without exiting, monopolizing host CPUs
+// outside of the sandbox's scheduling.
+var enableCapabilities = map[uint32]struct{}{
+	linux.KVM_CAP_SPLIT_IRQCHIP: {},
+	linux.KVM_CAP_HYPERV_SYNIC:  {},
+	linux.KVM_CAP_X2APIC_API:    {},
+	linux.KVM_CAP_HYPERV_SYNIC2: {},
+}
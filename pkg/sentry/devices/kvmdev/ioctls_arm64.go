@@ -0,0 +1,26 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvmdev
+
+// archSupported is false since arm64 VMMs require in-kernel interrupt
+// controllers created by KVM_CREATE_DEVICE, which is not passed through.
+const archSupported = false
+
+var (
+	systemIoctls       = map[uint32]ioctlInfo{}
+	vmIoctls           = map[uint32]ioctlInfo{}
+	vcpuIoctls         = map[uint32]ioctlInfo{}
+	enableCapabilities = map[uint32]struct{}{}
+)
@@ -0,0 +1,204 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kvmdev implements a mediated passthrough of the host's /dev/kvm,
+// allowing lightweight virtual machine monitors to run in the sandbox.
+//
+// Only allowlisted ioctls are passed through to the host. Ioctls whose
+// arguments refer to application memory or file descriptors are translated:
+// guest memory regions are mirrored into the sentry's address space, from
+// which the host KVM maps them, and eventfds are replaced by their host
+// eventfds. KVM_RUN is executed on a dedicated host thread, so that it can be
+// interrupted when the calling task is.
+package kvmdev
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	kvmDevMajor = linux.MISC_MAJOR
+	kvmDevMinor = linux.KVM_MINOR
+
+	// hostPath is the path of the host KVM device.
+	hostPath = "/dev/kvm"
+)
+
+// kvmDevice implements vfs.Device for /dev/kvm.
+//
+// +stateify savable
+type kvmDevice struct{}
+
+// Open implements vfs.Device.Open.
+func (kvmDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	hostFD, err := unix.Openat(-1, hostPath, unix.O_RDWR|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		ctx.Warningf("kvmdev: failed to open host %s: %v", hostPath, err)
+		return nil, err
+	}
+	fd := &kvmFD{
+		hostFD: int32(hostFD),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// kvmFD implements vfs.FileDescriptionImpl for /dev/kvm.
+//
+// kvmFD is not savable; we do not implement save/restore of KVM state.
+type kvmFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD int32
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *kvmFD) Release(context.Context) {
+	unix.Close(int(fd.hostFD))
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *kvmFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	switch cmd := args[1].Uint(); cmd {
+	case linux.KVM_CREATE_VM:
+		return fd.createVM(t, args[2].Uint64())
+	case linux.KVM_CHECK_EXTENSION:
+		return checkExtension(fd.hostFD, args[2].Uint64())
+	default:
+		return passthroughIoctl(ctx, uio, fd.hostFD, systemIoctls, cmd, args[2])
+	}
+}
+
+func (fd *kvmFD) createVM(t *kernel.Task, machineType uint64) (uintptr, error) {
+	mmapSize, err := ioctlInvoke(fd.hostFD, linux.KVM_GET_VCPU_MMAP_SIZE, 0)
+	if err != nil {
+		return 0, err
+	}
+	hostVMFD, err := ioctlInvoke(fd.hostFD, linux.KVM_CREATE_VM, uintptr(machineType))
+	if err != nil {
+		return 0, err
+	}
+	vfd := &vmFD{
+		vm: &vm{
+			hostFD:       int32(hostVMFD),
+			vcpuMmapSize: uint64(mmapSize),
+			refs:         1,
+			slots:        make(map[uint32]*memorySlot),
+		},
+	}
+	return installAnonFD(t, &vfd.vfsfd, vfd, "kvm-vm", func() {
+		unix.Close(int(hostVMFD))
+	})
+}
+
+// installAnonFD initializes vfsfd as an anonymous file description with the
+// given implementation and name, and installs it in t's file descriptor
+// table. If initialization fails, release is called to release resources
+// owned by impl.
+func installAnonFD(t *kernel.Task, vfsfd *vfs.FileDescription, impl vfs.FileDescriptionImpl, name string, release func()) (uintptr, error) {
+	vd := t.Kernel().VFS().NewAnonVirtualDentry(name)
+	defer vd.DecRef(t)
+	if err := vfsfd.Init(impl, linux.O_RDWR, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		release()
+		return 0, err
+	}
+	defer vfsfd.DecRef(t)
+	newFD, err := t.NewFDFrom(0, vfsfd, kernel.FDFlags{CloseOnExec: true})
+	if err != nil {
+		return 0, err
+	}
+	return uintptr(newFD), nil
+}
+
+// hiddenCapabilities are KVM capabilities that are reported as unsupported,
+// since using them requires ioctls, mappings or capabilities that are not
+// passed through.
+var hiddenCapabilities = map[uint64]struct{}{
+	linux.KVM_CAP_X86_DISABLE_EXITS:      {},
+	linux.KVM_CAP_COALESCED_MMIO:         {},
+	linux.KVM_CAP_SET_GUEST_DEBUG:        {},
+	linux.KVM_CAP_DEVICE_CTRL:            {},
+	linux.KVM_CAP_COALESCED_PIO:          {},
+	linux.KVM_CAP_DIRTY_LOG_RING:         {},
+	linux.KVM_CAP_XSAVE2:                 {},
+	linux.KVM_CAP_DIRTY_LOG_RING_ACQ_REL: {},
+	linux.KVM_CAP_USER_MEMORY2:           {},
+	linux.KVM_CAP_GUEST_MEMFD:            {},
+}
+
+// checkExtension handles KVM_CHECK_EXTENSION on system and VM file
+// descriptors.
+func checkExtension(hostFD int32, capability uint64) (uintptr, error) {
+	if _, ok := hiddenCapabilities[capability]; ok {
+		return 0, nil
+	}
+	return ioctlInvoke(hostFD, linux.KVM_CHECK_EXTENSION, uintptr(capability))
+}
+
+// enableCap handles KVM_ENABLE_CAP on VM and vCPU file descriptors.
+//
+// Only capabilities in enableCapabilities may be enabled, since the arguments
+// of some capabilities are pointers that the host would dereference in the
+// sentry's address space.
+func enableCap(ctx context.Context, uio usermem.IO, hostFD int32, addr hostarch.Addr) (uintptr, error) {
+	buf := make([]byte, linux.IOC_SIZE(linux.KVM_ENABLE_CAP))
+	if _, err := uio.CopyIn(ctx, addr, buf, usermem.IOOpts{}); err != nil {
+		return 0, err
+	}
+	if _, ok := enableCapabilities[hostarch.ByteOrder.Uint32(buf)]; !ok {
+		return 0, linuxerr.EINVAL
+	}
+	return ioctlInvokeBuf(hostFD, linux.KVM_ENABLE_CAP, buf)
+}
+
+// Register registers /dev/kvm.
+func Register(vfsObj *vfs.VirtualFilesystem) error {
+	if !archSupported {
+		return fmt.Errorf("/dev/kvm passthrough is not supported on %s", runtime.GOARCH)
+	}
+	return vfsObj.RegisterDevice(vfs.CharDevice, kvmDevMajor, kvmDevMinor, kvmDevice{}, &vfs.RegisterDeviceOptions{
+		GroupName: "kvm",
+	})
+}
+
+// CreateDevtmpfsFile creates the device special file for /dev/kvm.
+func CreateDevtmpfsFile(ctx context.Context, dev *devtmpfs.Accessor) error {
+	return dev.CreateDeviceFile(ctx, "kvm", vfs.CharDevice, kvmDevMajor, kvmDevMinor, 0666 /* mode */)
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvmdev
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+func TestDirtyBitmapSize(t *testing.T) {
+	for _, tc := range []struct {
+		size uint64
+		want uint64
+	}{
+		{size: 4096, want: 8},
+		{size: 64 * 4096, want: 8},
+		{size: 65 * 4096, want: 16},
+		{size: 1 << 30, want: 32768},
+	} {
+		if got := dirtyBitmapSize(tc.size); got != tc.want {
+			t.Errorf("dirtyBitmapSize(%#x) = %d, want %d", tc.size, got, tc.want)
+		}
+	}
+}
+
+func TestIoctlAllowlists(t *testing.T) {
+	special := make(map[uint32]struct{})
+	for _, cmd := range specialIoctls {
+		special[cmd] = struct{}{}
+	}
+	for _, allowlist := range []map[uint32]ioctlInfo{systemIoctls, vmIoctls, vcpuIoctls} {
+		for cmd, info := range allowlist {
+			if _, ok := special[cmd]; ok {
+				t.Errorf("ioctl %#x is both special and passed through", cmd)
+			}
+			if info.entrySize != 0 && linux.IOC_SIZE(cmd) < 4 {
+				t.Errorf("ioctl %#x has entries but no count", cmd)
+			}
+		}
+	}
+}
+
+// openHostKVM returns a host /dev/kvm file descriptor, or skips the test if
+// KVM is unavailable.
+func openHostKVM(t *testing.T) int32 {
+	fd, err := unix.Open(hostPath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Skipf("opening %s: %v", hostPath, err)
+	}
+	t.Cleanup(func() { unix.Close(fd) })
+	return int32(fd)
+}
+
+func ioctlArg(v uintptr) arch.SyscallArgument {
+	return arch.SyscallArgument{Value: v}
+}
+
+func TestPassthroughIoctlNotAllowed(t *testing.T) {
+	ctx := contexttest.Context(t)
+	uio := &usermem.BytesIO{Bytes: make([]byte, 8)}
+	if _, err := passthroughIoctl(ctx, uio, -1, map[uint32]ioctlInfo{}, linux.KVM_GET_API_VERSION, ioctlArg(0)); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("passthroughIoctl got error %v, want EINVAL", err)
+	}
+}
+
+func TestPassthroughIoctlTooManyEntries(t *testing.T) {
+	ctx := contexttest.Context(t)
+	// An ioctl that only writes to the host must not be truncated, so it
+	// fails before reaching the host.
+	const cmd = linux.KVM_SET_MSRS
+	allowlist := map[uint32]ioctlInfo{cmd: {entrySize: 16, maxEntries: 4}}
+	mem := make([]byte, 8+5*16)
+	hostarch.ByteOrder.PutUint32(mem, 5)
+	uio := &usermem.BytesIO{Bytes: mem}
+	if _, err := passthroughIoctl(ctx, uio, -1, allowlist, cmd, ioctlArg(0)); !linuxerr.Equals(linuxerr.E2BIG, err) {
+		t.Errorf("passthroughIoctl got error %v, want E2BIG", err)
+	}
+}
+
+func TestPassthroughIoctlHost(t *testing.T) {
+	ctx := contexttest.Context(t)
+	hostFD := openHostKVM(t)
+
+	uio := &usermem.BytesIO{Bytes: make([]byte, 8)}
+	n, err := passthroughIoctl(ctx, uio, hostFD, systemIoctls, linux.KVM_GET_API_VERSION, ioctlArg(0))
+	if err != nil {
+		t.Fatalf("KVM_GET_API_VERSION failed: %v", err)
+	}
+	if n != 12 {
+		t.Errorf("KVM_GET_API_VERSION got %d, want 12", n)
+	}
+
+	// With no room for entries, the host reports the required count, which
+	// must be copied out along with E2BIG.
+	if _, ok := systemIoctls[linux.KVM_GET_MSR_INDEX_LIST]; !ok {
+		t.Skip("KVM_GET_MSR_INDEX_LIST is not supported on this architecture")
+	}
+	mem := make([]byte, 4)
+	uio = &usermem.BytesIO{Bytes: mem}
+	if _, err := passthroughIoctl(ctx, uio, hostFD, systemIoctls, linux.KVM_GET_MSR_INDEX_LIST, ioctlArg(0)); err != unix.E2BIG {
+		t.Fatalf("KVM_GET_MSR_INDEX_LIST got error %v, want E2BIG", err)
+	}
+	if count := hostarch.ByteOrder.Uint32(mem); count == 0 {
+		t.Errorf("KVM_GET_MSR_INDEX_LIST did not copy out the required count")
+	}
+}
+
+func TestEnableCapNotAllowed(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mem := make([]byte, linux.IOC_SIZE(linux.KVM_ENABLE_CAP))
+	hostarch.ByteOrder.PutUint32(mem, linux.KVM_CAP_X86_DISABLE_EXITS)
+	uio := &usermem.BytesIO{Bytes: mem}
+	if _, err := enableCap(ctx, uio, -1, 0); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("enableCap(KVM_CAP_X86_DISABLE_EXITS) got error %v, want EINVAL", err)
+	}
+}
+
+func TestCheckExtensionHidden(t *testing.T) {
+	hostFD := openHostKVM(t)
+	for capability := range hiddenCapabilities {
+		if n, err := checkExtension(hostFD, capability); err != nil || n != 0 {
+			t.Errorf("checkExtension(%d) = %d, %v; want 0, nil", capability, n, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvmdev
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+func ioctlInvoke(hostFD int32, cmd uint32, arg uintptr) (uintptr, error) {
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), arg)
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
+
+func ioctlInvokePtrArg[Params any](hostFD int32, cmd uint32, params *Params) (uintptr, error) {
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), uintptr(unsafe.Pointer(params)))
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
+
+func ioctlInvokeBuf(hostFD int32, cmd uint32, buf []byte) (uintptr, error) {
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
+
+// ioctlGetDirtyLog invokes KVM_GET_DIRTY_LOG on hostFD, storing the dirty
+// bitmap in bitmap.
+func ioctlGetDirtyLog(hostFD int32, dl linux.KVMDirtyLog, bitmap []byte) (uintptr, error) {
+	dl.DirtyBitmap = uint64(uintptr(unsafe.Pointer(&bitmap[0])))
+	n, err := ioctlInvokePtrArg(hostFD, linux.KVM_GET_DIRTY_LOG, &dl)
+	runtime.KeepAlive(bitmap)
+	return n, err
+}
+
+// immediateExit returns a pointer to the immediate_exit field of the vCPU's
+// struct kvm_run.
+func (fd *vcpuFD) immediateExit() *uint8 {
+	return (*uint8)(unsafe.Pointer(fd.run + linux.KVMRunImmediateExitOffset))
+}
+
+// MapInternal implements memmap.File.MapInternal.
+func (mf *vcpuMemmapFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (safemem.BlockSeq, error) {
+	if fr.End > mf.fd.vm.vcpuMmapSize {
+		return safemem.BlockSeq{}, linuxerr.EFAULT
+	}
+	return safemem.BlockSeqOf(safemem.BlockFromSafePointer(unsafe.Pointer(mf.fd.run+uintptr(fr.Start)), int(fr.Length()))), nil
+}
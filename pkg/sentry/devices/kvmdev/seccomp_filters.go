@@ -0,0 +1,96 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvmdev
+
+import (
+	"sort"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// specialIoctls are the ioctls that are translated rather than passed
+// through unmodified.
+var specialIoctls = []uint32{
+	linux.KVM_CREATE_VM,
+	linux.KVM_CHECK_EXTENSION,
+	linux.KVM_GET_VCPU_MMAP_SIZE,
+	linux.KVM_ENABLE_CAP,
+	linux.KVM_CREATE_VCPU,
+	linux.KVM_SET_USER_MEMORY_REGION,
+	linux.KVM_GET_DIRTY_LOG,
+	linux.KVM_IRQFD,
+	linux.KVM_IOEVENTFD,
+	linux.KVM_RUN,
+}
+
+// Filters returns seccomp-bpf filters for this package.
+func Filters() seccomp.SyscallRules {
+	cmds := make(map[uint32]struct{})
+	for _, cmd := range specialIoctls {
+		cmds[cmd] = struct{}{}
+	}
+	for _, allowlist := range []map[uint32]ioctlInfo{systemIoctls, vmIoctls, vcpuIoctls} {
+		for cmd := range allowlist {
+			cmds[cmd] = struct{}{}
+		}
+	}
+	sorted := make([]uint32, 0, len(cmds))
+	for cmd := range cmds {
+		sorted = append(sorted, cmd)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	nonNegativeFD := seccomp.NonNegativeFDCheck()
+	var ioctlRules seccomp.Or
+	for _, cmd := range sorted {
+		ioctlRules = append(ioctlRules, seccomp.PerArg{
+			nonNegativeFD,
+			seccomp.EqualTo(cmd),
+		})
+	}
+	return seccomp.SyscallRules{
+		unix.SYS_OPENAT: seccomp.PerArg{
+			// All paths that we openat() are absolute, so we pass a dirfd
+			// of -1 (which is invalid for relative paths, but ignored for
+			// absolute paths) to hedge against bugs involving AT_FDCWD or
+			// real dirfds.
+			seccomp.EqualTo(^uintptr(0)),
+			seccomp.AnyValue{},
+			seccomp.MaskedEqual(unix.O_ACCMODE|unix.O_CREAT|unix.O_NOFOLLOW, unix.O_RDWR|unix.O_NOFOLLOW),
+			seccomp.AnyValue{},
+		},
+		unix.SYS_IOCTL: ioctlRules,
+		unix.SYS_EVENTFD2: seccomp.Or{
+			seccomp.PerArg{
+				seccomp.AnyValue{},
+				seccomp.EqualTo(linux.EFD_NONBLOCK),
+			},
+			seccomp.PerArg{
+				seccomp.AnyValue{},
+				seccomp.EqualTo(linux.EFD_NONBLOCK | linux.EFD_SEMAPHORE),
+			},
+		},
+		unix.SYS_MREMAP: seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(0), /* old_size */
+			seccomp.AnyValue{},
+			seccomp.EqualTo(linux.MREMAP_MAYMOVE | linux.MREMAP_FIXED),
+			seccomp.AnyValue{},
+			seccomp.EqualTo(0),
+		},
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvmdev
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// vcpuFD implements vfs.FileDescriptionImpl for KVM vCPU file descriptors.
+//
+// vcpuFD is not savable; we do not implement save/restore of KVM state.
+type vcpuFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD     int32
+	vm         *vm
+	memmapFile vcpuMemmapFile
+
+	// run is the address of the sentry's mapping of the vCPU's mappable
+	// region, which begins with struct kvm_run. run is immutable.
+	run uintptr
+
+	// runMu serializes KVM_RUN, as in Linux.
+	runMu sync.Mutex
+
+	// runReq is sent to by KVM_RUN to request that the runner goroutine
+	// invokes KVM_RUN on the host, and runDone is sent to by the runner
+	// goroutine when it has done so. The results of the host KVM_RUN are
+	// stored in runN and runErrno, which are protected by this handoff.
+	runReq   chan struct{}
+	runDone  chan struct{}
+	runN     uintptr
+	runErrno unix.Errno
+
+	// runnerTID is the host thread ID of the runner goroutine, which is locked
+	// to its thread. runnerTID is immutable.
+	runnerTID int
+
+	// kicked is set when the sentry interrupts the host KVM_RUN.
+	kicked atomicbitops.Bool
+}
+
+// newVCPUFD returns a vcpuFD for the given host vCPU file descriptor, which
+// it takes ownership of on success.
+func newVCPUFD(v *vm, hostFD int32) (*vcpuFD, error) {
+	run, _, errno := unix.RawSyscall6(unix.SYS_MMAP, 0 /* addr */, uintptr(v.vcpuMmapSize), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED, uintptr(hostFD), 0 /* offset */)
+	if errno != 0 {
+		return nil, errno
+	}
+	fd := &vcpuFD{
+		hostFD:  hostFD,
+		vm:      v,
+		run:     run,
+		runReq:  make(chan struct{}),
+		runDone: make(chan struct{}, 1),
+	}
+	fd.memmapFile.fd = fd
+	started := make(chan struct{})
+	go fd.runner(started) // S/R-SAFE: vcpuFD is not savable.
+	<-started
+	v.incRef()
+	return fd, nil
+}
+
+// runner invokes KVM_RUN on the host when requested by KVM_RUN.
+func (fd *vcpuFD) runner(started chan<- struct{}) {
+	// The runner's thread is destroyed when the runner returns, since it's
+	// never unlocked.
+	runtime.LockOSThread()
+	fd.runnerTID = unix.Gettid()
+	close(started)
+	for range fd.runReq {
+		for {
+			n, err := ioctlInvoke(fd.hostFD, linux.KVM_RUN, 0)
+			if err == unix.EINTR && !fd.kicked.Load() && *fd.immediateExit() == 0 {
+				// Interrupted by a signal that wasn't sent by the sentry to
+				// interrupt KVM_RUN, e.g. for Go runtime preemption.
+				continue
+			}
+			fd.runN = n
+			fd.runErrno = 0
+			if err != nil {
+				fd.runErrno = err.(unix.Errno)
+			}
+			break
+		}
+		fd.runDone <- struct{}{}
+	}
+}
+
+// release releases resources held by fd.
+func (fd *vcpuFD) release() {
+	close(fd.runReq)
+	unix.RawSyscall(unix.SYS_MUNMAP, fd.run, uintptr(fd.vm.vcpuMmapSize), 0)
+	unix.Close(int(fd.hostFD))
+	fd.vm.decRef()
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *vcpuFD) Release(context.Context) {
+	fd.release()
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *vcpuFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	switch cmd := args[1].Uint(); cmd {
+	case linux.KVM_RUN:
+		return fd.kvmRun(t)
+	case linux.KVM_ENABLE_CAP:
+		return enableCap(ctx, uio, fd.hostFD, args[2].Pointer())
+	default:
+		return passthroughIoctl(ctx, uio, fd.hostFD, vcpuIoctls, cmd, args[2])
+	}
+}
+
+func (fd *vcpuFD) kvmRun(t *kernel.Task) (uintptr, error) {
+	fd.runMu.Lock()
+	defer fd.runMu.Unlock()
+	fd.vm.refreshSlots(t)
+	for {
+		n, err := fd.kvmRunOnce(t)
+		// If guest memory was invalidated while the guest was running, the
+		// host fails KVM_RUN with EFAULT when the guest accesses it; retry
+		// after re-establishing it.
+		if err == unix.EFAULT && fd.vm.refreshSlots(t) {
+			continue
+		}
+		return n, err
+	}
+}
+
+// kvmRunOnce invokes KVM_RUN on the host once.
+//
+// Preconditions: fd.runMu must be locked.
+func (fd *vcpuFD) kvmRunOnce(t *kernel.Task) (uintptr, error) {
+	fd.kicked.Store(false)
+	fd.runReq <- struct{}{}
+	if err := t.Block(fd.runDone); err != nil {
+		// Force the host KVM_RUN to return. Setting immediate_exit ensures
+		// that it does so even if the signal is delivered before KVM_RUN
+		// enters the guest.
+		immediateExit := fd.immediateExit()
+		prev := *immediateExit
+		*immediateExit = 1
+		fd.kicked.Store(true)
+		unix.Tgkill(unix.Getpid(), fd.runnerTID, unix.SIGURG)
+		<-fd.runDone
+		*immediateExit = prev
+		if fd.runErrno == unix.EINTR {
+			return 0, linuxerr.EINTR
+		}
+	}
+	if fd.runErrno != 0 {
+		return fd.runN, fd.runErrno
+	}
+	return fd.runN, nil
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *vcpuFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	return vfs.GenericConfigureMMap(&fd.vfsfd, fd, opts)
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (fd *vcpuFD) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (fd *vcpuFD) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (fd *vcpuFD) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return nil
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (fd *vcpuFD) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	size := fd.vm.vcpuMmapSize
+	if required.End > size {
+		return nil, &memmap.BusError{linuxerr.EFAULT}
+	}
+	source := optional
+	if source.End > size {
+		source.End = size
+	}
+	return []memmap.Translation{
+		{
+			Source: source,
+			File:   &fd.memmapFile,
+			Offset: source.Start,
+			Perms:  at,
+		},
+	}, nil
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (fd *vcpuFD) InvalidateUnsavable(ctx context.Context) error {
+	return nil
+}
+
+// vcpuMemmapFile implements memmap.File for the mappable region of a vCPU
+// file descriptor.
+type vcpuMemmapFile struct {
+	fd *vcpuFD
+}
+
+// IncRef implements memmap.File.IncRef.
+func (mf *vcpuMemmapFile) IncRef(memmap.FileRange, uint32) {
+}
+
+// DecRef implements memmap.File.DecRef.
+func (mf *vcpuMemmapFile) DecRef(fr memmap.FileRange) {
+}
+
+// FD implements memmap.File.FD.
+func (mf *vcpuMemmapFile) FD() int {
+	return int(mf.fd.hostFD)
+}
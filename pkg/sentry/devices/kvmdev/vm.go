@@ -0,0 +1,411 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvmdev
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// vm is a host KVM virtual machine.
+type vm struct {
+	// hostFD is the host VM file descriptor. hostFD is immutable.
+	hostFD int32
+
+	// vcpuMmapSize is the size of the mappable region of vCPU file
+	// descriptors. vcpuMmapSize is immutable.
+	vcpuMmapSize uint64
+
+	mu sync.Mutex
+
+	// refs is the number of vmFDs and vcpuFDs referring to the VM.
+	//
+	// +checklocks:mu
+	refs int
+
+	// slots maps memory slot numbers, including the address space ID in the
+	// upper 16 bits, to guest memory regions.
+	//
+	// +checklocks:mu
+	slots map[uint32]*memorySlot
+}
+
+func (v *vm) incRef() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.refs++
+}
+
+func (v *vm) decRef() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.refs--
+	if v.refs != 0 {
+		return
+	}
+	// Guest memory may only be unmapped from the sentry once the host VM has
+	// been destroyed, which happens when the last host file descriptor
+	// referring to it is closed; otherwise the guest could access whatever
+	// the sentry maps at the same addresses later.
+	unix.Close(int(v.hostFD))
+	for slot, s := range v.slots {
+		s.release()
+		delete(v.slots, slot)
+	}
+}
+
+// refreshSlots re-establishes the mirrors of guest memory regions whose
+// application mappings have changed. It returns true if any were refreshed.
+func (v *vm) refreshSlots(ctx context.Context) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	refreshed := false
+	for _, s := range v.slots {
+		if s.refreshLocked(ctx) {
+			refreshed = true
+		}
+	}
+	return refreshed
+}
+
+// memorySlot is a guest memory region backed by application memory.
+//
+// The host KVM accesses guest memory through a mirror of the application's
+// mappings in the sentry's address space. When the application's mappings
+// change, the memory slot is notified by the MemoryManager, and replaces the
+// affected part of the mirror with an inaccessible mapping; the host KVM
+// then stops using the previous memory, and the mirror is re-established
+// before the guest runs again, as Linux's KVM does using MMU notifiers.
+type memorySlot struct {
+	// mm is the MemoryManager whose memory backs the region. mm is
+	// immutable.
+	mm *mm.MemoryManager
+
+	// appAR is the application address range backing the region. appAR is
+	// immutable.
+	appAR hostarch.AddrRange
+
+	// at is the access type with which application memory is pinned. at is
+	// immutable.
+	at hostarch.AccessType
+
+	// mirror is the address of a mapping of appAR's memory in the sentry's
+	// address space, which is used by the host KVM to access guest memory.
+	// mirror is immutable.
+	mirror uintptr
+
+	// stale is set when part of the mirror was invalidated and must be
+	// re-established by refresh.
+	stale atomicbitops.Bool
+
+	// prs are the pinned ranges of application memory mapped at mirror.
+	// prs is protected by vm.mu.
+	prs []mm.PinnedRange
+}
+
+// newMemorySlot pins the application memory in appAR and maps it into a new
+// range of the sentry's address space.
+func newMemorySlot(t *kernel.Task, appAR hostarch.AddrRange, at hostarch.AccessType) (*memorySlot, error) {
+	// Reserve a range in our address space.
+	m, _, errno := unix.RawSyscall6(unix.SYS_MMAP, 0 /* addr */, uintptr(appAR.Length()), unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS, ^uintptr(0) /* fd */, 0 /* offset */)
+	if errno != 0 {
+		return nil, errno
+	}
+	s := &memorySlot{
+		mm:     t.MemoryManager(),
+		appAR:  appAR,
+		at:     at,
+		mirror: m,
+	}
+	// Register before pinning, so that changes that race with pinning are
+	// not missed.
+	s.mm.RegisterMMUNotifier(appAR, s)
+	if err := s.mirrorLocked(t); err != nil {
+		s.release()
+		return nil, err
+	}
+	return s, nil
+}
+
+// mirrorLocked pins the application memory in s.appAR and maps it at
+// s.mirror, replacing any previously pinned memory. If not all of s.appAR is
+// mapped, the parts that are mapped are mirrored, and an error is returned.
+//
+// Preconditions: vm.mu must be locked, or s must not be visible to other
+// goroutines.
+func (s *memorySlot) mirrorLocked(ctx context.Context) error {
+	prs, err := s.mm.Pin(ctx, s.appAR, s.at, false /* ignorePermissions */)
+	for _, pr := range prs {
+		if merr := s.mirrorRange(pr); merr != nil {
+			// The mirror may now map a mix of old and new memory, so make
+			// all of it inaccessible before unpinning either.
+			unix.RawSyscall6(unix.SYS_MMAP, s.mirror, uintptr(s.appAR.Length()), unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_FIXED, ^uintptr(0) /* fd */, 0 /* offset */)
+			mm.Unpin(prs)
+			mm.Unpin(s.prs)
+			s.prs = nil
+			return merr
+		}
+	}
+	mm.Unpin(s.prs)
+	s.prs = prs
+	return err
+}
+
+// mirrorRange maps the pinned memory in pr at the corresponding addresses in
+// s.mirror.
+func (s *memorySlot) mirrorRange(pr mm.PinnedRange) error {
+	ims, err := pr.File.MapInternal(pr.FileRange(), s.at)
+	if err != nil {
+		return err
+	}
+	sentryAddr := s.mirror + uintptr(pr.Source.Start-s.appAR.Start)
+	for !ims.IsEmpty() {
+		im := ims.Head()
+		if _, _, errno := unix.RawSyscall6(unix.SYS_MREMAP, im.Addr(), 0 /* old_size */, uintptr(im.Len()), linux.MREMAP_MAYMOVE|linux.MREMAP_FIXED, sentryAddr, 0); errno != 0 {
+			return errno
+		}
+		sentryAddr += uintptr(im.Len())
+		ims = ims.Tail()
+	}
+	return nil
+}
+
+// InvalidateRange implements mm.MMUNotifier.InvalidateRange.
+func (s *memorySlot) InvalidateRange(ar hostarch.AddrRange) {
+	// Replace the mirror of ar with an inaccessible mapping. This can't fail
+	// for a page-aligned range within our own reservation.
+	unix.RawSyscall6(unix.SYS_MMAP, s.mirror+uintptr(ar.Start-s.appAR.Start), uintptr(ar.Length()), unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_FIXED, ^uintptr(0) /* fd */, 0 /* offset */)
+	s.stale.Store(true)
+}
+
+// refreshLocked re-establishes the mirror if it was invalidated. It returns
+// true if it did so.
+//
+// Preconditions: vm.mu must be locked.
+func (s *memorySlot) refreshLocked(ctx context.Context) bool {
+	refreshed := false
+	// Repeat if the mirror was invalidated again while being
+	// re-established.
+	for s.stale.Swap(false) {
+		refreshed = true
+		if err := s.mirrorLocked(ctx); err != nil {
+			// Addresses that are no longer mapped remain inaccessible to
+			// the guest, which will cause KVM_RUN to fail with EFAULT if
+			// it accesses them, as in Linux.
+			log.Debugf("kvmdev: failed to refresh guest memory at %v: %v", s.appAR, err)
+		}
+	}
+	return refreshed
+}
+
+// release unmaps and unpins the slot's memory.
+func (s *memorySlot) release() {
+	// Ensure that InvalidateRange can't race with unmapping the mirror.
+	s.mm.UnregisterMMUNotifier(s)
+	unix.RawSyscall(unix.SYS_MUNMAP, s.mirror, uintptr(s.appAR.Length()), 0)
+	mm.Unpin(s.prs)
+}
+
+// dirtyBitmapSize returns the size in bytes of the dirty page bitmap of a
+// memory slot of the given size, from
+// virt/kvm/kvm_main.c:kvm_dirty_bitmap_bytes().
+func dirtyBitmapSize(size uint64) uint64 {
+	pages := size / hostarch.PageSize
+	return (pages + 63) / 64 * 8
+}
+
+// vmFD implements vfs.FileDescriptionImpl for KVM VM file descriptors.
+//
+// vmFD is not savable; we do not implement save/restore of KVM state.
+type vmFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	vm *vm
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *vmFD) Release(context.Context) {
+	fd.vm.decRef()
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *vmFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	switch cmd := args[1].Uint(); cmd {
+	case linux.KVM_CHECK_EXTENSION:
+		return checkExtension(fd.vm.hostFD, args[2].Uint64())
+	case linux.KVM_ENABLE_CAP:
+		return enableCap(ctx, uio, fd.vm.hostFD, args[2].Pointer())
+	case linux.KVM_CREATE_VCPU:
+		return fd.createVCPU(t, args[2].Uint64())
+	case linux.KVM_SET_USER_MEMORY_REGION:
+		return fd.setUserMemoryRegion(t, args[2].Pointer())
+	case linux.KVM_GET_DIRTY_LOG:
+		return fd.getDirtyLog(t, args[2].Pointer())
+	case linux.KVM_IRQFD:
+		return fd.irqfd(t, args[2].Pointer())
+	case linux.KVM_IOEVENTFD:
+		return fd.ioeventfd(t, args[2].Pointer())
+	default:
+		return passthroughIoctl(ctx, uio, fd.vm.hostFD, vmIoctls, cmd, args[2])
+	}
+}
+
+func (fd *vmFD) createVCPU(t *kernel.Task, id uint64) (uintptr, error) {
+	hostVCPUFD, err := ioctlInvoke(fd.vm.hostFD, linux.KVM_CREATE_VCPU, uintptr(id))
+	if err != nil {
+		return 0, err
+	}
+	vfd, err := newVCPUFD(fd.vm, int32(hostVCPUFD))
+	if err != nil {
+		unix.Close(int(hostVCPUFD))
+		return 0, err
+	}
+	return installAnonFD(t, &vfd.vfsfd, vfd, fmt.Sprintf("kvm-vcpu:%d", id), vfd.release)
+}
+
+func (fd *vmFD) setUserMemoryRegion(t *kernel.Task, addr hostarch.Addr) (uintptr, error) {
+	var region linux.KVMUserspaceMemoryRegion
+	if _, err := region.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	v := fd.vm
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	old := v.slots[region.Slot]
+	sentryRegion := region
+
+	if region.MemorySize == 0 {
+		// Delete the slot.
+		sentryRegion.UserspaceAddr = 0
+		n, err := ioctlInvokePtrArg(v.hostFD, linux.KVM_SET_USER_MEMORY_REGION, &sentryRegion)
+		if err != nil {
+			return n, err
+		}
+		if old != nil {
+			old.release()
+			delete(v.slots, region.Slot)
+		}
+		return n, nil
+	}
+
+	appAR, ok := hostarch.Addr(region.UserspaceAddr).ToRange(region.MemorySize)
+	if !ok || !appAR.IsPageAligned() {
+		return 0, linuxerr.EINVAL
+	}
+	if old != nil && old.appAR == appAR {
+		// The slot's flags or guest physical address are changing; the host
+		// VM continues to access guest memory through the existing mirror.
+		sentryRegion.UserspaceAddr = uint64(old.mirror)
+		return ioctlInvokePtrArg(v.hostFD, linux.KVM_SET_USER_MEMORY_REGION, &sentryRegion)
+	}
+
+	at := hostarch.ReadWrite
+	if region.Flags&linux.KVM_MEM_READONLY != 0 {
+		at = hostarch.Read
+	}
+	s, err := newMemorySlot(t, appAR, at)
+	if err != nil {
+		return 0, err
+	}
+	sentryRegion.UserspaceAddr = uint64(s.mirror)
+	n, err := ioctlInvokePtrArg(v.hostFD, linux.KVM_SET_USER_MEMORY_REGION, &sentryRegion)
+	if err != nil {
+		s.release()
+		return n, err
+	}
+	if old != nil {
+		old.release()
+	}
+	v.slots[region.Slot] = s
+	return n, nil
+}
+
+func (fd *vmFD) getDirtyLog(t *kernel.Task, addr hostarch.Addr) (uintptr, error) {
+	var dl linux.KVMDirtyLog
+	if _, err := dl.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	v := fd.vm
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.slots[dl.Slot]
+	if !ok {
+		return 0, linuxerr.ENOENT
+	}
+	bitmap := make([]byte, dirtyBitmapSize(uint64(s.appAR.Length())))
+	n, err := ioctlGetDirtyLog(v.hostFD, dl, bitmap)
+	if err != nil {
+		return n, err
+	}
+	if _, err := t.CopyOutBytes(hostarch.Addr(dl.DirtyBitmap), bitmap); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (fd *vmFD) irqfd(t *kernel.Task, addr hostarch.Addr) (uintptr, error) {
+	var irqfd linux.KVMIRQFD
+	if _, err := irqfd.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	sentryIRQFD := irqfd
+	hostFD, err := hostEventFD(t, int32(irqfd.FD))
+	if err != nil {
+		return 0, err
+	}
+	sentryIRQFD.FD = uint32(hostFD)
+	if irqfd.Flags&linux.KVM_IRQFD_FLAG_RESAMPLE != 0 {
+		hostResampleFD, err := hostEventFD(t, int32(irqfd.ResampleFD))
+		if err != nil {
+			return 0, err
+		}
+		sentryIRQFD.ResampleFD = uint32(hostResampleFD)
+	}
+	return ioctlInvokePtrArg(fd.vm.hostFD, linux.KVM_IRQFD, &sentryIRQFD)
+}
+
+func (fd *vmFD) ioeventfd(t *kernel.Task, addr hostarch.Addr) (uintptr, error) {
+	var ioeventfd linux.KVMIOEventFD
+	if _, err := ioeventfd.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	sentryIOEventFD := ioeventfd
+	hostFD, err := hostEventFD(t, ioeventfd.FD)
+	if err != nil {
+		return 0, err
+	}
+	sentryIOEventFD.FD = int32(hostFD)
+	return ioctlInvokePtrArg(fd.vm.hostFD, linux.KVM_IOEVENTFD, &sentryIOEventFD)
+}
@@ -27,6 +27,7 @@ import (
 	"gvisor.dev/gvisor/pkg/fdnotifier"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/marshal"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
@@ -99,6 +100,7 @@ type frontendFD struct {
 
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *frontendFD) Release(context.Context) {
+	fd.nvp.unaccountFD(fd)
 	fdnotifier.RemoveFD(fd.hostFD)
 	fd.queue.Notify(waiter.EventHUp)
 	unix.Close(int(fd.hostFD))
@@ -459,6 +461,9 @@ func rmFree(fi *frontendIoctlState) (uintptr, error) {
 	if ok {
 		o.Release(fi.ctx)
 	}
+	if ioctlParams.Status == nvgpu.NV_OK {
+		fi.fd.nvp.unaccountObject(ioctlParams.HRoot, ioctlParams.HObjectOld)
+	}
 
 	if _, err := ioctlParams.CopyOut(fi.t, fi.ioctlParamsAddr); err != nil {
 		return n, err
@@ -604,6 +609,55 @@ func ctrlSubdevFIFODisableChannels(fi *frontendIoctlState, ioctlParams *nvgpu.NV
 	return n, nil
 }
 
+type hasFrontendFDPtr[T any] interface {
+	*T
+	marshal.Marshallable
+	nvgpu.HasFrontendFD
+}
+
+// ctrlHasFrontendFD implements control commands whose parameters contain a
+// file descriptor for a frontend device, such as the
+// NV0000_CTRL_CMD_OS_UNIX_*_OBJECT_* commands used to export RM objects
+// (e.g. for CUDA IPC) from one client and import them into another. The
+// exported object is attached to the host file description, so both the
+// exporting and importing processes must name a frontendFD in the sandbox;
+// in particular, frontend FDs obtained from outside of the sandbox (e.g. from
+// another sandbox sharing the GPU) can't be used.
+func ctrlHasFrontendFD[Params any, PParams hasFrontendFDPtr[Params]](fi *frontendIoctlState, ioctlParams *nvgpu.NVOS54Parameters) (uintptr, error) {
+	var ctrlParams Params
+	if (PParams)(&ctrlParams).SizeBytes() != int(ioctlParams.ParamsSize) {
+		return 0, linuxerr.EINVAL
+	}
+	if _, err := (PParams)(&ctrlParams).CopyIn(fi.t, addrFromP64(ioctlParams.Params)); err != nil {
+		return 0, err
+	}
+
+	origFD := (PParams)(&ctrlParams).GetFrontendFD()
+	ctlFileGeneric, _ := fi.t.FDTable().Get(origFD)
+	if ctlFileGeneric == nil {
+		return 0, linuxerr.EINVAL
+	}
+	defer ctlFileGeneric.DecRef(fi.ctx)
+	ctlFile, ok := ctlFileGeneric.Impl().(*frontendFD)
+	if !ok {
+		return 0, linuxerr.EINVAL
+	}
+
+	sentryCtrlParams := ctrlParams
+	(PParams)(&sentryCtrlParams).SetFrontendFD(ctlFile.hostFD)
+	n, err := rmControlInvoke(fi, ioctlParams, &sentryCtrlParams)
+	if err != nil {
+		return n, err
+	}
+
+	outCtrlParams := sentryCtrlParams
+	(PParams)(&outCtrlParams).SetFrontendFD(origFD)
+	if _, err := (PParams)(&outCtrlParams).CopyOut(fi.t, addrFromP64(ioctlParams.Params)); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
 func rmAlloc(fi *frontendIoctlState) (uintptr, error) {
 	var isNVOS64 bool
 	switch fi.ioctlParamsSize {
@@ -662,6 +716,40 @@ func rmAllocSimple[Params any, PParams marshalPtr[Params]](fi *frontendIoctlStat
 	return n, nil
 }
 
+func rmAllocRoot(fi *frontendIoctlState, ioctlParams *nvgpu.NVOS64Parameters, isNVOS64 bool) (uintptr, error) {
+	n, err := rmAllocSimple[nvgpu.Handle](fi, ioctlParams, isNVOS64)
+	if err == nil && ioctlParams.Status == nvgpu.NV_OK {
+		fi.fd.nvp.accountClient(fi.fd, ioctlParams.HObjectNew)
+	}
+	return n, err
+}
+
+func rmAllocDevice(fi *frontendIoctlState, ioctlParams *nvgpu.NVOS64Parameters, isNVOS64 bool) (uintptr, error) {
+	var allocParams nvgpu.NV0080_ALLOC_PARAMETERS
+	if _, err := allocParams.CopyIn(fi.t, addrFromP64(ioctlParams.PAllocParms)); err != nil {
+		return 0, err
+	}
+	n, err := rmAllocInvoke(fi, ioctlParams, &allocParams, isNVOS64)
+	if err != nil {
+		return n, err
+	}
+	if ioctlParams.Status == nvgpu.NV_OK {
+		fi.fd.nvp.accountDevice(ioctlParams.HRoot, ioctlParams.HObjectParent, ioctlParams.HObjectNew, allocParams.DeviceID, false /* inherit */)
+	}
+	if _, err := allocParams.CopyOut(fi.t, addrFromP64(ioctlParams.PAllocParms)); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func rmAllocSubdevice(fi *frontendIoctlState, ioctlParams *nvgpu.NVOS64Parameters, isNVOS64 bool) (uintptr, error) {
+	n, err := rmAllocSimple[nvgpu.NV2080_ALLOC_PARAMETERS](fi, ioctlParams, isNVOS64)
+	if err == nil && ioctlParams.Status == nvgpu.NV_OK {
+		fi.fd.nvp.accountDevice(ioctlParams.HRoot, ioctlParams.HObjectParent, ioctlParams.HObjectNew, 0 /* instance */, true /* inherit */)
+	}
+	return n, err
+}
+
 func rmAllocNoParams(fi *frontendIoctlState, ioctlParams *nvgpu.NVOS64Parameters, isNVOS64 bool) (uintptr, error) {
 	return rmAllocInvoke[byte](fi, ioctlParams, nil, isNVOS64)
 }
@@ -158,6 +158,48 @@ func ctrlSubdevGRGetInfo(fi *frontendIoctlState, ioctlParams *nvgpu.NVOS54Parame
 	return n, nil
 }
 
+func ctrlNvencSwSessionUpdateInfo(fi *frontendIoctlState, ioctlParams *nvgpu.NVOS54Parameters) (uintptr, error) {
+	var ctrlParams nvgpu.NVA0BC_CTRL_NVENC_SW_SESSION_UPDATE_INFO_PARAMS
+	if ctrlParams.SizeBytes() != int(ioctlParams.ParamsSize) {
+		return 0, linuxerr.EINVAL
+	}
+	if _, err := ctrlParams.CopyIn(fi.t, addrFromP64(ioctlParams.Params)); err != nil {
+		return 0, err
+	}
+	if ctrlParams.TimestampBuffer == 0 || ctrlParams.TimestampBufferSize == 0 {
+		return rmControlSimple(fi, ioctlParams)
+	}
+	// The driver doesn't buffer more than NVA0BC_MAX_BUFFERED_TIMESTAMPS
+	// timestamps; bounding the buffer here keeps applications from making the
+	// sentry allocate arbitrarily large buffers.
+	if ctrlParams.TimestampBufferSize > nvgpu.NVA0BC_MAX_BUFFERED_TIMESTAMPS {
+		return 0, linuxerr.EINVAL
+	}
+	timestampBuffer := make([]byte, int(ctrlParams.TimestampBufferSize)*(*nvgpu.NVA0BC_CTRL_NVENC_TIMESTAMP)(nil).SizeBytes())
+	if _, err := fi.t.CopyInBytes(addrFromP64(ctrlParams.TimestampBuffer), timestampBuffer); err != nil {
+		return 0, err
+	}
+	sentryCtrlParams := ctrlParams
+	sentryCtrlParams.TimestampBuffer = p64FromPtr(unsafe.Pointer(&timestampBuffer[0]))
+
+	// The timestamp buffer is input-only, so it doesn't need to be copied out.
+	n, err := rmControlInvoke(fi, ioctlParams, &sentryCtrlParams)
+	if err != nil {
+		return n, err
+	}
+
+	outCtrlParams := sentryCtrlParams
+	outCtrlParams.TimestampBuffer = ctrlParams.TimestampBuffer
+	if _, err := outCtrlParams.CopyOut(fi.t, addrFromP64(ioctlParams.Params)); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// rmAllocInvoke invokes NV_ESC_RM_ALLOC with the given parameters. On
+// success, ioctlParams.HObjectNew and ioctlParams.Status are updated with the
+// values returned by the driver.
 func rmAllocInvoke[Params any](fi *frontendIoctlState, ioctlParams *nvgpu.NVOS64Parameters, allocParams *Params, isNVOS64 bool) (uintptr, error) {
 	defer runtime.KeepAlive(allocParams) // since we convert to non-pointer-typed P64
 
@@ -175,6 +217,9 @@ func rmAllocInvoke[Params any](fi *frontendIoctlState, ioctlParams *nvgpu.NVOS64
 	if err != nil {
 		return n, err
 	}
+	outIoctlParams := sentryIoctlParams.ToOS64()
+	ioctlParams.HObjectNew = outIoctlParams.HObjectNew
+	ioctlParams.Status = outIoctlParams.Status
 	if ioctlParams.PRightsRequested != 0 {
 		if _, err := rightsRequested.CopyOut(fi.t, addrFromP64(ioctlParams.PRightsRequested)); err != nil {
 			return n, err
@@ -211,6 +256,9 @@ func rmVidHeapControlAllocSize(fi *frontendIoctlState, ioctlParams *nvgpu.NVOS32
 
 	outIoctlParams := sentryIoctlParams
 	outAllocSizeParams := (*nvgpu.NVOS32AllocSize)(unsafe.Pointer(&outIoctlParams.Data))
+	if outIoctlParams.Status == nvgpu.NV_OK && (outAllocSizeParams.Attr>>nvgpu.NVOS32_ATTR_LOCATION_SHIFT)&nvgpu.NVOS32_ATTR_LOCATION_MASK != nvgpu.NVOS32_ATTR_LOCATION_PCI {
+		fi.fd.nvp.accountMemory(outIoctlParams.HRoot, outIoctlParams.HObjectParent, outAllocSizeParams.HMemory, outAllocSizeParams.Size)
+	}
 	if allocSizeParams.Address != 0 {
 		if _, err := primitive.CopyUint64Out(fi.t, addrFromP64(allocSizeParams.Address), addr); err != nil {
 			return n, err
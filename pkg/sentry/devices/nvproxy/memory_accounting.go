@@ -0,0 +1,168 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvproxy
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/nvgpu"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+)
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/nvproxy/gpu_memory_allocated_bytes", false /* cumulative */, false /* sync */, "Bytes of GPU device memory allocated by the sandbox through nvproxy.", func(...*metric.FieldValue) uint64 {
+		return usage.GPUMemoryAccounting.Total()
+	})
+}
+
+// memClient tracks the GPU memory allocated by a client of the host driver, so
+// that it can be unaccounted when the memory, its device, or the client is
+// freed. Only objects relevant to memory accounting are tracked.
+type memClient struct {
+	// fd is the frontendFD through which the client was allocated. The host
+	// driver frees the client when fd is closed.
+	fd *frontendFD
+
+	// devices maps the handles of device and subdevice objects to their
+	// parent objects and device instances.
+	devices map[nvgpu.Handle]memObject
+
+	// mems maps the handles of memory objects to their parent objects, device
+	// instances and sizes.
+	mems map[nvgpu.Handle]memObject
+}
+
+// memObject is an object tracked by memClient.
+type memObject struct {
+	parent   nvgpu.Handle
+	instance uint32
+	size     uint64
+}
+
+// accountClient begins tracking the client hClient allocated through fd.
+func (nvp *nvproxy) accountClient(fd *frontendFD, hClient nvgpu.Handle) {
+	nvp.memClientsMu.Lock()
+	defer nvp.memClientsMu.Unlock()
+	nvp.memClients[hClient] = &memClient{
+		fd:      fd,
+		devices: make(map[nvgpu.Handle]memObject),
+		mems:    make(map[nvgpu.Handle]memObject),
+	}
+}
+
+// accountDevice records that hDevice, a child of hParent owned by hClient,
+// represents the device with the given instance, or shares its parent's
+// device instance if inherit is true.
+func (nvp *nvproxy) accountDevice(hClient, hParent, hDevice nvgpu.Handle, instance uint32, inherit bool) {
+	nvp.memClientsMu.Lock()
+	defer nvp.memClientsMu.Unlock()
+	c, ok := nvp.memClients[hClient]
+	if !ok {
+		return
+	}
+	if inherit {
+		parent, ok := c.devices[hParent]
+		if !ok {
+			return
+		}
+		instance = parent.instance
+	}
+	c.devices[hDevice] = memObject{
+		parent:   hParent,
+		instance: instance,
+	}
+}
+
+// accountMemory records that hMemory, a child of hParent owned by hClient, is
+// an allocation of size bytes of device memory.
+func (nvp *nvproxy) accountMemory(hClient, hParent, hMemory nvgpu.Handle, size uint64) {
+	nvp.memClientsMu.Lock()
+	defer nvp.memClientsMu.Unlock()
+	c, ok := nvp.memClients[hClient]
+	if !ok {
+		return
+	}
+	parent, ok := c.devices[hParent]
+	if !ok {
+		return
+	}
+	if _, ok := c.mems[hMemory]; ok {
+		// Shouldn't happen since the driver doesn't reuse live handles.
+		return
+	}
+	c.mems[hMemory] = memObject{
+		parent:   hParent,
+		instance: parent.instance,
+		size:     size,
+	}
+	usage.GPUMemoryAccounting.Inc(parent.instance, hClient.Val, size)
+}
+
+// unaccountObject stops tracking hObject, owned by hClient, and all of its
+// tracked descendants.
+func (nvp *nvproxy) unaccountObject(hClient, hObject nvgpu.Handle) {
+	nvp.memClientsMu.Lock()
+	defer nvp.memClientsMu.Unlock()
+	c, ok := nvp.memClients[hClient]
+	if !ok {
+		return
+	}
+	if hObject == hClient {
+		nvp.unaccountClientLocked(hClient, c)
+		return
+	}
+	if m, ok := c.mems[hObject]; ok {
+		delete(c.mems, hObject)
+		usage.GPUMemoryAccounting.Dec(m.instance, hClient.Val, m.size)
+		return
+	}
+	if _, ok := c.devices[hObject]; !ok {
+		return
+	}
+	// Devices may be the parent of subdevices, which may be the parent of
+	// memory objects.
+	freed := map[nvgpu.Handle]struct{}{hObject: {}}
+	delete(c.devices, hObject)
+	for h, d := range c.devices {
+		if _, ok := freed[d.parent]; ok {
+			freed[h] = struct{}{}
+			delete(c.devices, h)
+		}
+	}
+	for h, m := range c.mems {
+		if _, ok := freed[m.parent]; ok {
+			delete(c.mems, h)
+			usage.GPUMemoryAccounting.Dec(m.instance, hClient.Val, m.size)
+		}
+	}
+}
+
+// unaccountFD stops tracking all clients allocated through fd.
+func (nvp *nvproxy) unaccountFD(fd *frontendFD) {
+	nvp.memClientsMu.Lock()
+	defer nvp.memClientsMu.Unlock()
+	for hClient, c := range nvp.memClients {
+		if c.fd == fd {
+			nvp.unaccountClientLocked(hClient, c)
+		}
+	}
+}
+
+// Preconditions: nvp.memClientsMu must be locked.
+func (nvp *nvproxy) unaccountClientLocked(hClient nvgpu.Handle, c *memClient) {
+	for _, m := range c.mems {
+		usage.GPUMemoryAccounting.Dec(m.instance, hClient.Val, m.size)
+	}
+	delete(nvp.memClients, hClient)
+}
@@ -28,6 +28,7 @@ import (
 	"gvisor.dev/gvisor/pkg/marshal"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
 	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
@@ -49,8 +50,9 @@ func Register(vfsObj *vfs.VirtualFilesystem, uvmDevMajor uint32) error {
 	}
 	log.Infof("Nvidia driver version: %s", versionStr)
 	nvp := &nvproxy{
-		objsLive: make(map[nvgpu.Handle]*object),
-		abi:      abiCons(),
+		objsLive:   make(map[nvgpu.Handle]*object),
+		abi:        abiCons(),
+		memClients: make(map[nvgpu.Handle]*memClient),
 	}
 	for minor := uint32(0); minor <= nvgpu.NV_CONTROL_DEVICE_MINOR; minor++ {
 		if err := vfsObj.RegisterDevice(vfs.CharDevice, nvgpu.NV_MAJOR_DEVICE_NUMBER, minor, &frontendDevice{
@@ -69,6 +71,7 @@ func Register(vfsObj *vfs.VirtualFilesystem, uvmDevMajor uint32) error {
 	}); err != nil {
 		return err
 	}
+	usage.GPUMemoryAccounting.Enable()
 	return nil
 }
 
@@ -96,6 +99,11 @@ type nvproxy struct {
 	objsMu   objsMutex `state:"nosave"`
 	objsLive map[nvgpu.Handle]*object
 	abi      *driverABI
+
+	// memClients tracks driver clients for GPU memory accounting; see
+	// memory_accounting.go.
+	memClientsMu memClientsMutex             `state:"nosave"`
+	memClients   map[nvgpu.Handle]*memClient `state:"nosave"`
 }
 
 // object tracks an object allocated through the driver.
@@ -25,3 +25,42 @@ func TestInit(t *testing.T) {
 		cons()
 	}
 }
+
+func TestABIDiff(t *testing.T) {
+	a := &driverABI{
+		frontendIoctl: map[uint32]frontendIoctlHandler{1: nil, 2: nil},
+		controlCmd:    map[uint32]controlCmdHandler{0x20800101: nil},
+	}
+	b := &driverABI{
+		frontendIoctl: map[uint32]frontendIoctlHandler{1: nil},
+	}
+	diff := abiDiff(a, b)
+	if diff == nil {
+		t.Fatalf("abiDiff(a, b) = nil, want non-nil")
+	}
+	if got, want := diff.FrontendIoctl, []string{"0x2"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("abiDiff(a, b).FrontendIoctl = %v, want %v", got, want)
+	}
+	if got, want := diff.ControlCmd, []string{"0x20800101"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("abiDiff(a, b).ControlCmd = %v, want %v", got, want)
+	}
+	if diff := abiDiff(b, a); diff != nil {
+		t.Errorf("abiDiff(b, a) = %+v, want nil", diff)
+	}
+}
+
+func TestDriverVersionLess(t *testing.T) {
+	for _, test := range []struct {
+		a, b driverVersion
+		want bool
+	}{
+		{driverVersion{525, 60, 13}, driverVersion{525, 105, 17}, true},
+		{driverVersion{525, 105, 17}, driverVersion{525, 60, 13}, false},
+		{driverVersion{525, 125, 6}, driverVersion{535, 43, 2}, true},
+		{driverVersion{525, 60, 13}, driverVersion{525, 60, 13}, false},
+	} {
+		if got := test.a.less(test.b); got != test.want {
+			t.Errorf("%v.less(%v) = %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvproxy
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+
+	"gvisor.dev/gvisor/pkg/abi/nvgpu"
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// ProcDriverFiles returns the contents of the files that the host driver
+// exposes in /proc/driver/nvidia, restricted to the GPUs with the given device
+// minor numbers. Keys are paths relative to /proc/driver.
+//
+// Only information that can be obtained from the host driver through its
+// device files is included; for example, the VBIOS version and DMA mask are
+// omitted.
+func ProcDriverFiles(minors []uint32) (map[string]string, error) {
+	versionStr, err := hostDriverVersion()
+	if err != nil {
+		return nil, err
+	}
+	cards, err := hostCardInfo()
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{
+		"nvidia/version": fmt.Sprintf("NVRM version: NVIDIA UNIX %s Kernel Module  %s\n", procArch(), versionStr),
+	}
+	attached := make(map[uint32]struct{}, len(minors))
+	for _, minor := range minors {
+		attached[minor] = struct{}{}
+	}
+	for i := range cards {
+		card := &cards[i]
+		if card.Valid == 0 {
+			continue
+		}
+		if _, ok := attached[card.MinorNumber]; !ok {
+			continue
+		}
+		model, uuid, err := hostGPUNameAndUUID(card)
+		if err != nil {
+			log.Warningf("nvproxy: failed to get name and UUID of GPU with device minor %d: %v", card.MinorNumber, err)
+			model, uuid = "Unknown", "Unknown"
+		}
+		busLocation := fmt.Sprintf("%04x:%02x:%02x.%x", card.PCIInfo.Domain, card.PCIInfo.Bus, card.PCIInfo.Slot, card.PCIInfo.Function)
+		// Formatted as in kernel-open/nvidia/nv-procfs.c:nv_procfs_read_gpu_info().
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "Model: \t\t %s\n", model)
+		fmt.Fprintf(&buf, "IRQ:   \t\t %d\n", card.InterruptLine)
+		fmt.Fprintf(&buf, "GPU UUID: \t %s\n", uuid)
+		fmt.Fprintf(&buf, "Bus Type: \t PCIe\n")
+		fmt.Fprintf(&buf, "Bus Location: \t %s\n", busLocation)
+		fmt.Fprintf(&buf, "Device Minor: \t %d\n", card.MinorNumber)
+		fmt.Fprintf(&buf, "GPU Excluded:\t No\n")
+		files["nvidia/gpus/"+busLocation+"/information"] = buf.String()
+	}
+	return files, nil
+}
+
+// procArch returns the architecture name used by the driver in
+// /proc/driver/nvidia/version.
+func procArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	default:
+		return runtime.GOARCH
+	}
+}
+
+// cString returns the NUL-terminated string at the beginning of b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
+
+// Handles used for objects allocated by hostGPUNameAndUUID. These are
+// arbitrary, but must be unique within the client.
+var (
+	procDeviceHandle    = nvgpu.Handle{Val: 0xcaf00001}
+	procSubdeviceHandle = nvgpu.Handle{Val: 0xcaf00002}
+)
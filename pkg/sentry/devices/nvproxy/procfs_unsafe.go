@@ -0,0 +1,139 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvproxy
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/nvgpu"
+)
+
+// hostCardInfo returns the host driver's NV_ESC_CARD_INFO entries for all
+// GPUs. Entries for nonexistent GPUs have Valid == 0.
+func hostCardInfo() ([]nvgpu.IoctlCardInfo, error) {
+	ctlFD, err := unix.Openat(-1, "/dev/nvidiactl", unix.O_RDONLY|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open /dev/nvidiactl: %w", err)
+	}
+	defer unix.Close(ctlFD)
+
+	cards := make([]nvgpu.IoctlCardInfo, nvgpu.NV_MAX_DEVICES)
+	size := uint32(len(cards)) * uint32(unsafe.Sizeof(cards[0]))
+	if _, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(ctlFD), frontendIoctlCmd(nvgpu.NV_ESC_CARD_INFO, size), uintptr(unsafe.Pointer(&cards[0]))); errno != 0 {
+		return nil, fmt.Errorf("NV_ESC_CARD_INFO ioctl error: %w", errno)
+	}
+	return cards, nil
+}
+
+// hostGPUNameAndUUID returns the model name and UUID of the given GPU, using
+// a temporary client of the host driver.
+func hostGPUNameAndUUID(card *nvgpu.IoctlCardInfo) (string, string, error) {
+	// The driver only initializes a GPU while its device file is open.
+	devPath := fmt.Sprintf("/dev/nvidia%d", card.MinorNumber)
+	devFD, err := unix.Openat(-1, devPath, unix.O_RDWR|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open %s: %w", devPath, err)
+	}
+	defer unix.Close(devFD)
+	ctlFD, err := unix.Openat(-1, "/dev/nvidiactl", unix.O_RDWR|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open /dev/nvidiactl: %w", err)
+	}
+	// Closing ctlFD frees the client and all objects allocated under it.
+	defer unix.Close(ctlFD)
+
+	var clientParams nvgpu.Handle
+	hClient, err := hostRMAlloc(ctlFD, nvgpu.Handle{}, nvgpu.Handle{}, nvgpu.Handle{}, nvgpu.NV01_ROOT, unsafe.Pointer(&clientParams))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to allocate client: %w", err)
+	}
+
+	idInfo := nvgpu.NV0000_CTRL_GPU_GET_ID_INFO_V2_PARAMS{
+		GpuID: card.GPUID,
+	}
+	if err := hostRMControl(ctlFD, hClient, hClient, nvgpu.NV0000_CTRL_CMD_GPU_GET_ID_INFO_V2, unsafe.Pointer(&idInfo), unsafe.Sizeof(idInfo)); err != nil {
+		return "", "", fmt.Errorf("NV0000_CTRL_CMD_GPU_GET_ID_INFO_V2 failed: %w", err)
+	}
+	deviceParams := nvgpu.NV0080_ALLOC_PARAMETERS{
+		DeviceID: idInfo.DeviceInstance,
+	}
+	if _, err := hostRMAlloc(ctlFD, hClient, hClient, procDeviceHandle, nvgpu.NV01_DEVICE_0, unsafe.Pointer(&deviceParams)); err != nil {
+		return "", "", fmt.Errorf("failed to allocate device: %w", err)
+	}
+	var subdeviceParams nvgpu.NV2080_ALLOC_PARAMETERS
+	if _, err := hostRMAlloc(ctlFD, hClient, procDeviceHandle, procSubdeviceHandle, nvgpu.NV20_SUBDEVICE_0, unsafe.Pointer(&subdeviceParams)); err != nil {
+		return "", "", fmt.Errorf("failed to allocate subdevice: %w", err)
+	}
+
+	nameParams := nvgpu.NV2080_CTRL_GPU_GET_NAME_STRING_PARAMS{
+		GpuNameStringFlags: nvgpu.NV2080_CTRL_GPU_GET_NAME_STRING_FLAGS_TYPE_ASCII,
+	}
+	if err := hostRMControl(ctlFD, hClient, procSubdeviceHandle, nvgpu.NV2080_CTRL_CMD_GPU_GET_NAME_STRING, unsafe.Pointer(&nameParams), unsafe.Sizeof(nameParams)); err != nil {
+		return "", "", fmt.Errorf("NV2080_CTRL_CMD_GPU_GET_NAME_STRING failed: %w", err)
+	}
+	gidParams := nvgpu.NV2080_CTRL_GPU_GET_GID_INFO_PARAMS{
+		Flags: nvgpu.NV2080_GPU_CMD_GPU_GET_GID_FLAGS_FORMAT_ASCII,
+	}
+	if err := hostRMControl(ctlFD, hClient, procSubdeviceHandle, nvgpu.NV2080_CTRL_CMD_GPU_GET_GID_INFO, unsafe.Pointer(&gidParams), unsafe.Sizeof(gidParams)); err != nil {
+		return "", "", fmt.Errorf("NV2080_CTRL_CMD_GPU_GET_GID_INFO failed: %w", err)
+	}
+	length := gidParams.Length
+	if length > nvgpu.NV2080_GPU_MAX_GID_LENGTH {
+		length = nvgpu.NV2080_GPU_MAX_GID_LENGTH
+	}
+	return cString(nameParams.GpuNameString[:nvgpu.NV2080_GPU_MAX_NAME_STRING_LENGTH]), cString(gidParams.Data[:length]), nil
+}
+
+// hostRMAlloc invokes NV_ESC_RM_ALLOC on the host file ctlFD, and returns the
+// handle of the new object.
+func hostRMAlloc(ctlFD int, hRoot, hParent, hNew nvgpu.Handle, hClass uint32, allocParams unsafe.Pointer) (nvgpu.Handle, error) {
+	defer runtime.KeepAlive(allocParams) // since we convert to non-pointer-typed P64
+	ioctlParams := nvgpu.NVOS21Parameters{
+		HRoot:         hRoot,
+		HObjectParent: hParent,
+		HObjectNew:    hNew,
+		HClass:        hClass,
+		PAllocParms:   p64FromPtr(allocParams),
+	}
+	if _, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(ctlFD), frontendIoctlCmd(nvgpu.NV_ESC_RM_ALLOC, uint32(unsafe.Sizeof(ioctlParams))), uintptr(unsafe.Pointer(&ioctlParams))); errno != 0 {
+		return nvgpu.Handle{}, errno
+	}
+	if ioctlParams.Status != nvgpu.NV_OK {
+		return nvgpu.Handle{}, fmt.Errorf("status %#x", ioctlParams.Status)
+	}
+	return ioctlParams.HObjectNew, nil
+}
+
+// hostRMControl invokes NV_ESC_RM_CONTROL on the host file ctlFD.
+func hostRMControl(ctlFD int, hClient, hObject nvgpu.Handle, cmd uint32, params unsafe.Pointer, size uintptr) error {
+	defer runtime.KeepAlive(params) // since we convert to non-pointer-typed P64
+	ioctlParams := nvgpu.NVOS54Parameters{
+		HClient:    hClient,
+		HObject:    hObject,
+		Cmd:        cmd,
+		Params:     p64FromPtr(params),
+		ParamsSize: uint32(size),
+	}
+	if _, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(ctlFD), frontendIoctlCmd(nvgpu.NV_ESC_RM_CONTROL, uint32(unsafe.Sizeof(ioctlParams))), uintptr(unsafe.Pointer(&ioctlParams))); errno != 0 {
+		return errno
+	}
+	if ioctlParams.Status != nvgpu.NV_OK {
+		return fmt.Errorf("status %#x", ioctlParams.Status)
+	}
+	return nil
+}
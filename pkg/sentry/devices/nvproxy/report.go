@@ -0,0 +1,179 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// AttachReport summarizes how nvproxy is set up for a sandbox, so that GPU
+// issues can be debugged without having to enable debug logs.
+type AttachReport struct {
+	// DriverVersion is the version of the host driver. It is empty if the
+	// version couldn't be determined, in which case DriverError is set.
+	DriverVersion string `json:"driver_version,omitempty"`
+
+	// DriverError is the error that occurred while determining the version of
+	// the host driver, if any.
+	DriverError string `json:"driver_error,omitempty"`
+
+	// Supported is true if the host driver version is supported by nvproxy.
+	Supported bool `json:"supported"`
+
+	// SupportedVersions lists the supported driver versions. It is only set
+	// if the host driver version is not supported.
+	SupportedVersions []string `json:"supported_versions,omitempty"`
+
+	// ABIChain lists the supported driver versions up to the host driver
+	// version, oldest first, along with how the proxied ABI changed relative
+	// to the previous version. The proxied ABI is the result of applying all
+	// changes in the chain.
+	ABIChain []ABIChange `json:"abi_chain,omitempty"`
+
+	// Unavailable lists the ioctls that are proxied for the latest supported
+	// driver version but not for the host driver version.
+	Unavailable *ABITables `json:"unavailable,omitempty"`
+
+	// GPUs lists the device minor numbers of the GPUs attached to the
+	// sandbox.
+	GPUs []uint32 `json:"gpus"`
+}
+
+// ABIChange describes how the proxied ABI changed in a driver version.
+type ABIChange struct {
+	// Version is the driver version.
+	Version string `json:"version"`
+
+	// Added and Removed list the ioctls that were added and removed. They are
+	// nil for the first version in a chain.
+	Added   *ABITables `json:"added,omitempty"`
+	Removed *ABITables `json:"removed,omitempty"`
+}
+
+// ABITables lists ioctls in each of the branching points of a driverABI, as
+// hexadecimal numbers.
+type ABITables struct {
+	FrontendIoctl   []string `json:"frontend_ioctl,omitempty"`
+	UVMIoctl        []string `json:"uvm_ioctl,omitempty"`
+	ControlCmd      []string `json:"control_cmd,omitempty"`
+	AllocationClass []string `json:"allocation_class,omitempty"`
+}
+
+// NewAttachReport returns an AttachReport for the host driver and the GPUs
+// with the given device minor numbers.
+//
+// Preconditions: Init() must have been called.
+func NewAttachReport(gpus []uint32) *AttachReport {
+	r := &AttachReport{GPUs: gpus}
+	versionStr, err := hostDriverVersion()
+	if err != nil {
+		r.DriverError = err.Error()
+		return r
+	}
+	r.DriverVersion = versionStr
+	version, err := driverVersionFrom(versionStr)
+	if err != nil {
+		r.DriverError = err.Error()
+		return r
+	}
+
+	versions := make([]driverVersion, 0, len(abis))
+	for v := range abis {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].less(versions[j])
+	})
+	if _, ok := abis[version]; !ok {
+		for _, v := range versions {
+			r.SupportedVersions = append(r.SupportedVersions, v.String())
+		}
+		return r
+	}
+	r.Supported = true
+
+	var prev *driverABI
+	for _, v := range versions {
+		if version.less(v) {
+			break
+		}
+		abi := abis[v]()
+		change := ABIChange{Version: v.String()}
+		if prev != nil {
+			change.Added = abiDiff(abi, prev)
+			change.Removed = abiDiff(prev, abi)
+		}
+		r.ABIChain = append(r.ABIChain, change)
+		prev = abi
+	}
+	if latest := versions[len(versions)-1]; latest != version {
+		r.Unavailable = abiDiff(abis[latest](), prev)
+	}
+	return r
+}
+
+// String implements fmt.Stringer.String. It returns r as JSON.
+func (r *AttachReport) String() string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Sprintf("<invalid AttachReport: %v>", err)
+	}
+	return string(b)
+}
+
+// less returns true if v is an older version than other.
+func (v driverVersion) less(other driverVersion) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	if v.minor != other.minor {
+		return v.minor < other.minor
+	}
+	return v.patch < other.patch
+}
+
+// abiDiff returns the ioctls that are handled by a but not by b, or nil if
+// there are none.
+func abiDiff(a, b *driverABI) *ABITables {
+	t := &ABITables{
+		FrontendIoctl:   keysDiff(a.frontendIoctl, b.frontendIoctl),
+		UVMIoctl:        keysDiff(a.uvmIoctl, b.uvmIoctl),
+		ControlCmd:      keysDiff(a.controlCmd, b.controlCmd),
+		AllocationClass: keysDiff(a.allocationClass, b.allocationClass),
+	}
+	if t.FrontendIoctl == nil && t.UVMIoctl == nil && t.ControlCmd == nil && t.AllocationClass == nil {
+		return nil
+	}
+	return t
+}
+
+// keysDiff returns the keys of a that are not keys of b, sorted and formatted
+// as hexadecimal numbers.
+func keysDiff[V any](a, b map[uint32]V) []string {
+	var keys []uint32
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	var strs []string
+	for _, k := range keys {
+		strs = append(strs, fmt.Sprintf("%#x", k))
+	}
+	return strs
+}
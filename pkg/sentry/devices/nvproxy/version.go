@@ -160,6 +160,7 @@ func Init() {
 					nvgpu.NV0000_CTRL_CMD_SYSTEM_GET_P2P_CAPS:               rmControlSimple,
 					nvgpu.NV0000_CTRL_CMD_SYSTEM_GET_FABRIC_STATUS:          rmControlSimple,
 					nvgpu.NV0000_CTRL_CMD_SYSTEM_GET_P2P_CAPS_MATRIX:        rmControlSimple,
+					nvgpu.NV0080_CTRL_CMD_BSP_GET_CAPS_V2:                   rmControlSimple,
 					nvgpu.NV0080_CTRL_CMD_FB_GET_CAPS_V2:                    rmControlSimple,
 					nvgpu.NV0080_CTRL_CMD_GPU_GET_NUM_SUBDEVICES:            rmControlSimple,
 					nvgpu.NV0080_CTRL_CMD_GPU_QUERY_SW_STATE_PERSISTENCE:    rmControlSimple,
@@ -182,6 +183,8 @@ func Init() {
 					nvgpu.NV2080_CTRL_CMD_GPU_ACQUIRE_COMPUTE_MODE_RESERVATION:             rmControlSimple,
 					nvgpu.NV2080_CTRL_CMD_GPU_RELEASE_COMPUTE_MODE_RESERVATION:             rmControlSimple,
 					nvgpu.NV2080_CTRL_CMD_GPU_GET_GID_INFO:                                 rmControlSimple,
+					nvgpu.NV2080_CTRL_CMD_GPU_GET_ENCODER_CAPACITY:                         rmControlSimple,
+					nvgpu.NV2080_CTRL_CMD_GPU_GET_NVENC_SW_SESSION_STATS:                   rmControlSimple,
 					nvgpu.NV2080_CTRL_CMD_GPU_GET_ENGINES_V2:                               rmControlSimple,
 					nvgpu.NV2080_CTRL_CMD_GPU_GET_ACTIVE_PARTITION_IDS:                     rmControlSimple,
 					nvgpu.NV2080_CTRL_CMD_GPU_GET_COMPUTE_POLICY_CONFIG:                    rmControlSimple,
@@ -215,17 +218,21 @@ func Init() {
 					nvgpu.NVA06C_CTRL_CMD_SET_TIMESLICE:                                    rmControlSimple,
 					nvgpu.NVA06C_CTRL_CMD_PREEMPT:                                          rmControlSimple,
 					nvgpu.NV0000_CTRL_CMD_SYSTEM_GET_BUILD_VERSION:                         ctrlClientSystemGetBuildVersion,
+					nvgpu.NV0000_CTRL_CMD_OS_UNIX_EXPORT_OBJECT_TO_FD:                      ctrlHasFrontendFD[nvgpu.NV0000_CTRL_OS_UNIX_EXPORT_OBJECT_TO_FD_PARAMS],
+					nvgpu.NV0000_CTRL_CMD_OS_UNIX_IMPORT_OBJECT_FROM_FD:                    ctrlHasFrontendFD[nvgpu.NV0000_CTRL_OS_UNIX_IMPORT_OBJECT_FROM_FD_PARAMS],
+					nvgpu.NV0000_CTRL_CMD_OS_UNIX_GET_EXPORT_OBJECT_INFO:                   ctrlHasFrontendFD[nvgpu.NV0000_CTRL_OS_UNIX_GET_EXPORT_OBJECT_INFO_PARAMS],
 					nvgpu.NV0080_CTRL_CMD_FIFO_GET_CHANNELLIST:                             ctrlDevFIFOGetChannelList,
 					nvgpu.NV2080_CTRL_CMD_FIFO_DISABLE_CHANNELS:                            ctrlSubdevFIFODisableChannels,
 					nvgpu.NV2080_CTRL_CMD_GR_GET_INFO:                                      ctrlSubdevGRGetInfo,
+					nvgpu.NVA0BC_CTRL_CMD_NVENC_SW_SESSION_UPDATE_INFO:                     ctrlNvencSwSessionUpdateInfo,
 				},
 				allocationClass: map[uint32]allocationClassHandler{
-					nvgpu.NV01_ROOT:               rmAllocSimple[nvgpu.Handle],
-					nvgpu.NV01_ROOT_NON_PRIV:      rmAllocSimple[nvgpu.Handle],
-					nvgpu.NV01_ROOT_CLIENT:        rmAllocSimple[nvgpu.Handle],
+					nvgpu.NV01_ROOT:               rmAllocRoot,
+					nvgpu.NV01_ROOT_NON_PRIV:      rmAllocRoot,
+					nvgpu.NV01_ROOT_CLIENT:        rmAllocRoot,
 					nvgpu.NV01_EVENT_OS_EVENT:     rmAllocEventOSEvent,
-					nvgpu.NV01_DEVICE_0:           rmAllocSimple[nvgpu.NV0080_ALLOC_PARAMETERS],
-					nvgpu.NV20_SUBDEVICE_0:        rmAllocSimple[nvgpu.NV2080_ALLOC_PARAMETERS],
+					nvgpu.NV01_DEVICE_0:           rmAllocDevice,
+					nvgpu.NV20_SUBDEVICE_0:        rmAllocSubdevice,
 					nvgpu.NV50_THIRD_PARTY_P2P:    rmAllocSimple[nvgpu.NV503C_ALLOC_PARAMETERS],
 					nvgpu.GT200_DEBUGGER:          rmAllocSimple[nvgpu.NV83DE_ALLOC_PARAMETERS],
 					nvgpu.FERMI_CONTEXT_SHARE_A:   rmAllocSimple[nvgpu.NV_CTXSHARE_ALLOCATION_PARAMETERS],
@@ -246,6 +253,15 @@ func Init() {
 					nvgpu.GF100_SUBDEVICE_MASTER:  rmAllocNoParams,
 					nvgpu.TURING_USERMODE_A:       rmAllocNoParams,
 					nvgpu.NV_MEMORY_FABRIC:        rmAllocSimple[nvgpu.NV00F8_ALLOCATION_PARAMETERS],
+					nvgpu.NVENC_SW_SESSION:        rmAllocSimple[nvgpu.NVA0BC_ALLOC_PARAMETERS],
+					nvgpu.NVC4B0_VIDEO_DECODER:    rmAllocSimple[nvgpu.NV_BSP_ALLOCATION_PARAMETERS],
+					nvgpu.NVC6B0_VIDEO_DECODER:    rmAllocSimple[nvgpu.NV_BSP_ALLOCATION_PARAMETERS],
+					nvgpu.NVC7B0_VIDEO_DECODER:    rmAllocSimple[nvgpu.NV_BSP_ALLOCATION_PARAMETERS],
+					nvgpu.NVC9B0_VIDEO_DECODER:    rmAllocSimple[nvgpu.NV_BSP_ALLOCATION_PARAMETERS],
+					nvgpu.NVB8B0_VIDEO_DECODER:    rmAllocSimple[nvgpu.NV_BSP_ALLOCATION_PARAMETERS],
+					nvgpu.NVC4B7_VIDEO_ENCODER:    rmAllocSimple[nvgpu.NV_MSENC_ALLOCATION_PARAMETERS],
+					nvgpu.NVC7B7_VIDEO_ENCODER:    rmAllocSimple[nvgpu.NV_MSENC_ALLOCATION_PARAMETERS],
+					nvgpu.NVC9B7_VIDEO_ENCODER:    rmAllocSimple[nvgpu.NV_MSENC_ALLOCATION_PARAMETERS],
 				},
 			}
 		})
@@ -0,0 +1,127 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ptpdev implements a PTP hardware clock device, /dev/ptp0.
+//
+// The clock is synthesized from the sandbox's CLOCK_TAI, which is how PTP
+// hardware clocks are usually disciplined on Linux. It can be read with
+// clock_gettime(2) using FD_TO_CLOCKID, and with the PTP_SYS_OFFSET_PRECISE
+// ioctl, but it can't be adjusted and has no auxiliary functions.
+package ptpdev
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const ptpDevMinor = 0
+
+// ptpDevice implements vfs.Device for /dev/ptp0.
+//
+// +stateify savable
+type ptpDevice struct{}
+
+// Open implements vfs.Device.Open.
+func (ptpDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &ptpFD{
+		k: kernel.KernelFromContext(ctx),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// ptpFD implements vfs.FileDescriptionImpl for /dev/ptp0.
+//
+// +stateify savable
+type ptpFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	k *kernel.Kernel
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *ptpFD) Release(context.Context) {}
+
+// Clock returns the clock read by clock_gettime(FD_TO_CLOCKID(fd)).
+func (fd *ptpFD) Clock() ktime.Clock {
+	return fd.k.TAIClock()
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *ptpFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	cmd := args[1].Uint()
+	arg := args[2].Pointer()
+
+	// Compare drivers/ptp/ptp_chardev.c:ptp_ioctl().
+	switch cmd {
+	case linux.PTP_CLOCK_GETCAPS, linux.PTP_CLOCK_GETCAPS2:
+		caps := linux.PTPClockCaps{
+			CrossTimestamping: 1,
+		}
+		_, err := caps.CopyOut(t, arg)
+		return 0, err
+
+	case linux.PTP_SYS_OFFSET_PRECISE, linux.PTP_SYS_OFFSET_PRECISE2:
+		// There is no separate device time to cross-timestamp, so the
+		// three clocks are read back to back.
+		var off linux.PTPSysOffsetPrecise
+		off.Device = ptpClockTime(fd.k.TAIClock().Now())
+		off.SysRealtime = ptpClockTime(fd.k.RealtimeClock().Now())
+		off.SysMonoRaw = ptpClockTime(fd.k.MonotonicClock().Now())
+		_, err := off.CopyOut(t, arg)
+		return 0, err
+
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// ptpClockTime converts a ktime.Time to a struct ptp_clock_time.
+func ptpClockTime(now ktime.Time) linux.PTPClockTime {
+	sec, nsec := now.Unix()
+	return linux.PTPClockTime{
+		Sec:  sec,
+		Nsec: uint32(nsec),
+	}
+}
+
+// Register registers /dev/ptp0 with the given major device number.
+func Register(vfsObj *vfs.VirtualFilesystem, major uint32) error {
+	return vfsObj.RegisterDevice(vfs.CharDevice, major, ptpDevMinor, ptpDevice{}, &vfs.RegisterDeviceOptions{
+		GroupName: "ptp",
+	})
+}
+
+// CreateDevtmpfsFile creates the device special file for /dev/ptp0.
+func CreateDevtmpfsFile(ctx context.Context, dev *devtmpfs.Accessor, major uint32) error {
+	return dev.CreateDeviceFile(ctx, "ptp0", vfs.CharDevice, major, ptpDevMinor, 0600 /* mode */)
+}
@@ -0,0 +1,581 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/rdma"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// command is a uverbs command being executed.
+type command struct {
+	t  *kernel.Task
+	fd *uverbsFD
+
+	// num is the command number, and extended is true if the command is an
+	// extended command.
+	num      uint32
+	extended bool
+
+	// buf is the command, which is written to the host file. core and udata
+	// are the command's core input and driver data, which are slices of buf.
+	// The core input of legacy commands with a response begins with the
+	// address of resp.
+	buf   []byte
+	core  []byte
+	udata []byte
+
+	// resp is the buffer receiving the command's response from the host.
+	resp []byte
+
+	// handler executes the command.
+	handler func(c *command) error
+
+	// obj contains the mirrors of application memory created for the
+	// command. They are released when the command completes, unless they
+	// have been transferred to an object.
+	obj object
+}
+
+// commandInfo describes a uverbs command that may be executed.
+type commandInfo struct {
+	// coreSize is the minimum size of the command's core input. For legacy
+	// commands, it is also the size of the core input, which precedes the
+	// command's driver data.
+	coreSize int
+
+	// hasResp is true if the core input of the legacy command begins with
+	// the address of its response buffer.
+	hasResp bool
+
+	// handler executes the command. If handler is nil, the command is
+	// executed without translation.
+	handler func(c *command) error
+}
+
+// legacyCommands are the legacy commands that may be executed.
+var legacyCommands = map[uint32]commandInfo{
+	rdma.IB_USER_VERBS_CMD_GET_CONTEXT:         {coreSize: 8, hasResp: true, handler: getContext},
+	rdma.IB_USER_VERBS_CMD_QUERY_DEVICE:        {coreSize: 8, hasResp: true},
+	rdma.IB_USER_VERBS_CMD_QUERY_PORT:          {coreSize: 8, hasResp: true},
+	rdma.IB_USER_VERBS_CMD_ALLOC_PD:            {coreSize: 8, hasResp: true},
+	rdma.IB_USER_VERBS_CMD_DEALLOC_PD:          {},
+	rdma.IB_USER_VERBS_CMD_CREATE_AH:           {coreSize: 8, hasResp: true},
+	rdma.IB_USER_VERBS_CMD_DESTROY_AH:          {},
+	rdma.IB_USER_VERBS_CMD_REG_MR:              {coreSize: (*rdma.IBUverbsRegMR)(nil).SizeBytes(), hasResp: true, handler: regMR},
+	rdma.IB_USER_VERBS_CMD_REREG_MR:            {coreSize: (*rdma.IBUverbsReregMR)(nil).SizeBytes(), hasResp: true, handler: reregMR},
+	rdma.IB_USER_VERBS_CMD_DEREG_MR:            {coreSize: (*rdma.IBUverbsDeregMR)(nil).SizeBytes(), handler: deregMR},
+	rdma.IB_USER_VERBS_CMD_ALLOC_MW:            {coreSize: 8, hasResp: true},
+	rdma.IB_USER_VERBS_CMD_DEALLOC_MW:          {},
+	rdma.IB_USER_VERBS_CMD_CREATE_COMP_CHANNEL: {coreSize: 8, hasResp: true, handler: createCompChannel},
+	rdma.IB_USER_VERBS_CMD_CREATE_CQ:           {coreSize: (*rdma.IBUverbsCreateCQ)(nil).SizeBytes(), hasResp: true, handler: createCQ},
+	rdma.IB_USER_VERBS_CMD_RESIZE_CQ:           {coreSize: (*rdma.IBUverbsResizeCQ)(nil).SizeBytes(), hasResp: true, handler: resizeCQ},
+	rdma.IB_USER_VERBS_CMD_DESTROY_CQ:          {coreSize: (*rdma.IBUverbsDestroyCQ)(nil).SizeBytes(), hasResp: true, handler: destroyCQ},
+	rdma.IB_USER_VERBS_CMD_POLL_CQ:             {coreSize: 8, hasResp: true},
+	rdma.IB_USER_VERBS_CMD_REQ_NOTIFY_CQ:       {},
+	rdma.IB_USER_VERBS_CMD_CREATE_QP:           {coreSize: (*rdma.IBUverbsCreateQP)(nil).SizeBytes(), hasResp: true, handler: createQP},
+	rdma.IB_USER_VERBS_CMD_QUERY_QP:            {coreSize: 8, hasResp: true},
+	rdma.IB_USER_VERBS_CMD_MODIFY_QP:           {},
+	rdma.IB_USER_VERBS_CMD_DESTROY_QP:          {coreSize: (*rdma.IBUverbsDestroyQP)(nil).SizeBytes(), hasResp: true, handler: destroyQP},
+	rdma.IB_USER_VERBS_CMD_POST_SEND:           {coreSize: 8, hasResp: true, handler: postWorkRequests},
+	rdma.IB_USER_VERBS_CMD_POST_RECV:           {coreSize: 8, hasResp: true, handler: postWorkRequests},
+	rdma.IB_USER_VERBS_CMD_ATTACH_MCAST:        {},
+	rdma.IB_USER_VERBS_CMD_DETACH_MCAST:        {},
+	rdma.IB_USER_VERBS_CMD_CREATE_SRQ:          {coreSize: (*rdma.IBUverbsCreateSRQ)(nil).SizeBytes(), hasResp: true, handler: createSRQ},
+	rdma.IB_USER_VERBS_CMD_MODIFY_SRQ:          {coreSize: (*rdma.IBUverbsModifySRQ)(nil).SizeBytes(), handler: modifySRQ},
+	rdma.IB_USER_VERBS_CMD_QUERY_SRQ:           {coreSize: 8, hasResp: true},
+	rdma.IB_USER_VERBS_CMD_DESTROY_SRQ:         {coreSize: (*rdma.IBUverbsDestroySRQ)(nil).SizeBytes(), hasResp: true, handler: destroySRQ},
+	rdma.IB_USER_VERBS_CMD_POST_SRQ_RECV:       {coreSize: 8, hasResp: true, handler: postWorkRequests},
+	rdma.IB_USER_VERBS_CMD_OPEN_XRCD:           {coreSize: (*rdma.IBUverbsOpenXRCD)(nil).SizeBytes(), hasResp: true, handler: openXRCD},
+	rdma.IB_USER_VERBS_CMD_CLOSE_XRCD:          {},
+	rdma.IB_USER_VERBS_CMD_CREATE_XSRQ:         {coreSize: (*rdma.IBUverbsCreateXSRQ)(nil).SizeBytes(), hasResp: true, handler: createSRQ},
+	rdma.IB_USER_VERBS_CMD_OPEN_QP:             {coreSize: 8, hasResp: true},
+}
+
+// extendedCommands are the extended commands that may be executed.
+var extendedCommands = map[uint32]commandInfo{
+	rdma.IB_USER_VERBS_EX_CMD_QUERY_DEVICE:        {},
+	rdma.IB_USER_VERBS_EX_CMD_CREATE_CQ:           {coreSize: 20 /* through CompChannel */, handler: createCQ},
+	rdma.IB_USER_VERBS_EX_CMD_CREATE_QP:           {coreSize: 52 /* through CompMask */, handler: createQP},
+	rdma.IB_USER_VERBS_EX_CMD_MODIFY_QP:           {},
+	rdma.IB_USER_VERBS_EX_CMD_CREATE_FLOW:         {},
+	rdma.IB_USER_VERBS_EX_CMD_DESTROY_FLOW:        {},
+	rdma.IB_USER_VERBS_EX_CMD_CREATE_WQ:           {handler: createWQ},
+	rdma.IB_USER_VERBS_EX_CMD_MODIFY_WQ:           {},
+	rdma.IB_USER_VERBS_EX_CMD_DESTROY_WQ:          {coreSize: (*rdma.IBUverbsExDestroyWQ)(nil).SizeBytes(), handler: destroyWQ},
+	rdma.IB_USER_VERBS_EX_CMD_CREATE_RWQ_IND_TBL:  {},
+	rdma.IB_USER_VERBS_EX_CMD_DESTROY_RWQ_IND_TBL: {},
+	rdma.IB_USER_VERBS_EX_CMD_MODIFY_CQ:           {},
+}
+
+// unsupported logs and returns the error for an unsupported command.
+func (c *command) unsupported() error {
+	c.t.Warningf("rdmaproxy: unsupported uverbs command %d (extended: %t)", c.num, c.extended)
+	return linuxerr.EOPNOTSUPP
+}
+
+// requireResp returns an error if the command's response buffer is shorter
+// than size. Commands that create objects using application memory must
+// receive the object's handle, since the memory must remain pinned until the
+// object is destroyed.
+func (c *command) requireResp(size int) error {
+	if len(c.resp) < size {
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
+// mirrorBuf mirrors the driver buffer of the given length at *addr, and
+// replaces *addr by the address of the mirror.
+//
+// +checklocks:c.fd.mu
+func (c *command) mirrorBuf(addr *uint64, length uint64) error {
+	if *addr == 0 || length == 0 {
+		return nil
+	}
+	m, sentryAddr, err := newMirror(c.t, *addr, length, hostarch.ReadWrite, driverBufferGuard)
+	if err != nil {
+		return err
+	}
+	c.obj.bufs = append(c.obj.bufs, m)
+	*addr = sentryAddr
+	return nil
+}
+
+// mirrorDB mirrors the page containing the doorbell record at *addr, and
+// replaces *addr by the address of the doorbell record in the mirror.
+//
+// +checklocks:c.fd.mu
+func (c *command) mirrorDB(addr *uint64) error {
+	if *addr == 0 {
+		return nil
+	}
+	page := hostarch.Addr(*addr).RoundDown()
+	dp, ok := c.fd.dbPages[page]
+	if !ok {
+		m, _, err := newMirror(c.t, uint64(page), hostarch.PageSize, hostarch.ReadWrite, 0 /* guard */)
+		if err != nil {
+			return err
+		}
+		dp = &dbPage{m: m}
+		c.fd.dbPages[page] = dp
+	}
+	dp.refs++
+	c.obj.dbPages = append(c.obj.dbPages, page)
+	*addr = uint64(dp.m.addr) + hostarch.Addr(*addr).PageOffset()
+	return nil
+}
+
+// releaseObject releases the application memory used by obj.
+//
+// +checklocks:fd.mu
+func (fd *uverbsFD) releaseObject(obj *object) {
+	for _, m := range obj.bufs {
+		m.release()
+	}
+	obj.bufs = nil
+	for _, page := range obj.dbPages {
+		dp := fd.dbPages[page]
+		dp.refs--
+		if dp.refs == 0 {
+			dp.m.release()
+			delete(fd.dbPages, page)
+		}
+	}
+	obj.dbPages = nil
+}
+
+// releaseUnused releases the mirrors created for the command that have not
+// been transferred to an object.
+//
+// +checklocks:c.fd.mu
+func (c *command) releaseUnused() {
+	c.fd.releaseObject(&c.obj)
+}
+
+// addObject transfers the mirrors created for the command to the object with
+// the given type and handle.
+//
+// +checklocks:c.fd.mu
+func (c *command) addObject(typ objectType, handle uint32) {
+	if len(c.obj.bufs) == 0 && len(c.obj.dbPages) == 0 {
+		return
+	}
+	obj := c.obj
+	c.fd.objects[objectKey{typ, handle}] = &obj
+	c.obj = object{}
+}
+
+// removeObject releases the application memory used by the destroyed object
+// with the given type and handle.
+//
+// +checklocks:c.fd.mu
+func (c *command) removeObject(typ objectType, handle uint32) {
+	key := objectKey{typ, handle}
+	if obj, ok := c.fd.objects[key]; ok {
+		c.fd.releaseObject(obj)
+		delete(c.fd.objects, key)
+	}
+}
+
+// mrAccessType returns the access type with which memory registered with the
+// given access flags is pinned.
+func mrAccessType(flags uint32) (hostarch.AccessType, error) {
+	if flags&rdma.IB_ACCESS_ON_DEMAND != 0 {
+		// On-demand paging would require the host driver to track changes
+		// to application mappings, which it cannot observe.
+		return hostarch.NoAccess, linuxerr.EOPNOTSUPP
+	}
+	at := hostarch.Read
+	if flags&(rdma.IB_ACCESS_LOCAL_WRITE|rdma.IB_ACCESS_REMOTE_WRITE|rdma.IB_ACCESS_REMOTE_ATOMIC|rdma.IB_ACCESS_MW_BIND) != 0 {
+		at.Write = true
+	}
+	return at, nil
+}
+
+func getContext(c *command) error {
+	var resp rdma.IBUverbsGetContextResp
+	if err := c.requireResp(resp.SizeBytes()); err != nil {
+		return err
+	}
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	resp.UnmarshalUnsafe(c.resp)
+	asyncFD, err := installEventFD(c.t, int32(resp.AsyncFD), false /* compChannel */)
+	if err != nil {
+		return err
+	}
+	resp.AsyncFD = uint32(asyncFD)
+	resp.MarshalUnsafe(c.resp)
+	return nil
+}
+
+func createCompChannel(c *command) error {
+	var resp rdma.IBUverbsCreateCompChannelResp
+	if err := c.requireResp(resp.SizeBytes()); err != nil {
+		return err
+	}
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	resp.UnmarshalUnsafe(c.resp)
+	fd, err := installEventFD(c.t, int32(resp.FD), true /* compChannel */)
+	if err != nil {
+		return err
+	}
+	resp.FD = uint32(fd)
+	resp.MarshalUnsafe(c.resp)
+	return nil
+}
+
+func regMR(c *command) error {
+	var cmd rdma.IBUverbsRegMR
+	cmd.UnmarshalUnsafe(c.core)
+	var resp rdma.IBUverbsRegMRResp
+	if err := c.requireResp(resp.SizeBytes()); err != nil {
+		return err
+	}
+	at, err := mrAccessType(cmd.AccessFlags)
+	if err != nil {
+		return err
+	}
+	m, addr, err := newMirror(c.t, cmd.Start, cmd.Length, at, 0 /* guard */)
+	if err != nil {
+		return err
+	}
+	c.obj.bufs = append(c.obj.bufs, m)
+	c.obj.access = cmd.AccessFlags
+	cmd.Start = addr
+	cmd.MarshalUnsafe(c.core)
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	resp.UnmarshalUnsafe(c.resp)
+	c.addObject(mrObject, resp.MRHandle)
+	return nil
+}
+
+func reregMR(c *command) error {
+	var cmd rdma.IBUverbsReregMR
+	cmd.UnmarshalUnsafe(c.core)
+	obj, ok := c.fd.objects[objectKey{mrObject, cmd.MRHandle}]
+	if !ok {
+		return linuxerr.EINVAL
+	}
+	access := obj.access
+	if cmd.Flags&rdma.IB_MR_REREG_ACCESS != 0 {
+		access = cmd.AccessFlags
+	}
+	at, err := mrAccessType(access)
+	if err != nil {
+		return err
+	}
+	if cmd.Flags&rdma.IB_MR_REREG_TRANS != 0 {
+		m, addr, err := newMirror(c.t, cmd.Start, cmd.Length, at, 0 /* guard */)
+		if err != nil {
+			return err
+		}
+		c.obj.bufs = append(c.obj.bufs, m)
+		cmd.Start = addr
+		cmd.MarshalUnsafe(c.core)
+	} else if prevAT, _ := mrAccessType(obj.access); at.Write && !prevAT.Write {
+		// The host driver may reuse the existing pins, which do not allow
+		// writes.
+		return linuxerr.EINVAL
+	}
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	if cmd.Flags&rdma.IB_MR_REREG_TRANS != 0 {
+		for _, m := range obj.bufs {
+			m.release()
+		}
+		obj.bufs = c.obj.bufs
+		c.obj.bufs = nil
+	}
+	obj.access = access
+	return nil
+}
+
+func deregMR(c *command) error {
+	var cmd rdma.IBUverbsDeregMR
+	cmd.UnmarshalUnsafe(c.core)
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	c.removeObject(mrObject, cmd.MRHandle)
+	return nil
+}
+
+func createCQ(c *command) error {
+	var resp rdma.IBUverbsCreateCQResp
+	if err := c.requireResp(resp.SizeBytes()); err != nil {
+		return err
+	}
+	var cqe uint32
+	if c.extended {
+		var cmd rdma.IBUverbsExCreateCQ
+		unmarshalPrefix(&cmd, c.core, 0)
+		hostChannel, err := hostCompChannel(c.t, cmd.CompChannel)
+		if err != nil {
+			return err
+		}
+		cmd.CompChannel = hostChannel
+		marshalPrefix(&cmd, c.core)
+		cqe = cmd.CQE
+	} else {
+		var cmd rdma.IBUverbsCreateCQ
+		cmd.UnmarshalUnsafe(c.core)
+		hostChannel, err := hostCompChannel(c.t, cmd.CompChannel)
+		if err != nil {
+			return err
+		}
+		cmd.CompChannel = hostChannel
+		cmd.MarshalUnsafe(c.core)
+		cqe = cmd.CQE
+	}
+	if c.fd.driver.createCQ != nil {
+		if err := c.fd.driver.createCQ(c, cqe); err != nil {
+			return err
+		}
+	}
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	resp.UnmarshalUnsafe(c.resp)
+	c.addObject(cqObject, resp.CQHandle)
+	return nil
+}
+
+func resizeCQ(c *command) error {
+	var cmd rdma.IBUverbsResizeCQ
+	cmd.UnmarshalUnsafe(c.core)
+	if c.fd.driver.resizeCQ != nil {
+		if err := c.fd.driver.resizeCQ(c, cmd.CQE); err != nil {
+			return err
+		}
+	}
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	if len(c.obj.bufs) == 0 {
+		return nil
+	}
+	// The host driver has replaced the CQ's buffer.
+	key := objectKey{cqObject, cmd.CQHandle}
+	obj, ok := c.fd.objects[key]
+	if !ok {
+		obj = &object{}
+		c.fd.objects[key] = obj
+	}
+	for _, m := range obj.bufs {
+		m.release()
+	}
+	obj.bufs = c.obj.bufs
+	c.obj.bufs = nil
+	return nil
+}
+
+func destroyCQ(c *command) error {
+	var cmd rdma.IBUverbsDestroyCQ
+	cmd.UnmarshalUnsafe(c.core)
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	c.removeObject(cqObject, cmd.CQHandle)
+	return nil
+}
+
+func createQP(c *command) error {
+	var resp rdma.IBUverbsCreateQPResp
+	if err := c.requireResp(4 /* QPHandle */); err != nil {
+		return err
+	}
+	var qpType uint8
+	rss := false
+	if c.extended {
+		var cmd rdma.IBUverbsExCreateQP
+		unmarshalPrefix(&cmd, c.core, 0)
+		qpType = cmd.QPType
+		rss = cmd.CompMask&rdma.IB_UVERBS_CREATE_QP_MASK_IND_TABLE != 0
+	} else {
+		var cmd rdma.IBUverbsCreateQP
+		cmd.UnmarshalUnsafe(c.core)
+		qpType = cmd.QPType
+	}
+	if c.fd.driver.createQP != nil {
+		if err := c.fd.driver.createQP(c, qpType, rss); err != nil {
+			return err
+		}
+	}
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	unmarshalPrefix(&resp, c.resp, 0)
+	c.addObject(qpObject, resp.QPHandle)
+	return nil
+}
+
+func destroyQP(c *command) error {
+	var cmd rdma.IBUverbsDestroyQP
+	cmd.UnmarshalUnsafe(c.core)
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	c.removeObject(qpObject, cmd.QPHandle)
+	return nil
+}
+
+func createSRQ(c *command) error {
+	var resp rdma.IBUverbsCreateSRQResp
+	if err := c.requireResp(4 /* SRQHandle */); err != nil {
+		return err
+	}
+	var maxWR, maxSGE uint32
+	if c.num == rdma.IB_USER_VERBS_CMD_CREATE_XSRQ {
+		var cmd rdma.IBUverbsCreateXSRQ
+		cmd.UnmarshalUnsafe(c.core)
+		maxWR, maxSGE = cmd.MaxWR, cmd.MaxSGE
+	} else {
+		var cmd rdma.IBUverbsCreateSRQ
+		cmd.UnmarshalUnsafe(c.core)
+		maxWR, maxSGE = cmd.MaxWR, cmd.MaxSGE
+	}
+	if c.fd.driver.createSRQ != nil {
+		if err := c.fd.driver.createSRQ(c, maxWR, maxSGE); err != nil {
+			return err
+		}
+	}
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	unmarshalPrefix(&resp, c.resp, 0)
+	c.addObject(srqObject, resp.SRQHandle)
+	return nil
+}
+
+func modifySRQ(c *command) error {
+	var cmd rdma.IBUverbsModifySRQ
+	cmd.UnmarshalUnsafe(c.core)
+	if c.fd.driver.modifySRQ != nil {
+		if err := c.fd.driver.modifySRQ(c, cmd.AttrMask); err != nil {
+			return err
+		}
+	}
+	return c.invoke()
+}
+
+func destroySRQ(c *command) error {
+	var cmd rdma.IBUverbsDestroySRQ
+	cmd.UnmarshalUnsafe(c.core)
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	c.removeObject(srqObject, cmd.SRQHandle)
+	return nil
+}
+
+func createWQ(c *command) error {
+	var resp rdma.IBUverbsExCreateWQResp
+	if err := c.requireResp(12 /* through WQHandle */); err != nil {
+		return err
+	}
+	if c.fd.driver.createWQ != nil {
+		if err := c.fd.driver.createWQ(c); err != nil {
+			return err
+		}
+	}
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	unmarshalPrefix(&resp, c.resp, 0)
+	c.addObject(wqObject, resp.WQHandle)
+	return nil
+}
+
+func destroyWQ(c *command) error {
+	var cmd rdma.IBUverbsExDestroyWQ
+	unmarshalPrefix(&cmd, c.core, 0)
+	if err := c.invoke(); err != nil {
+		return err
+	}
+	c.removeObject(wqObject, cmd.WQHandle)
+	return nil
+}
+
+// postWorkRequests executes POST_SEND, POST_RECV and POST_SRQ_RECV, which
+// only notify software drivers of new work requests in application memory.
+// Other drivers would execute the work requests in the host kernel.
+func postWorkRequests(c *command) error {
+	if !c.fd.driver.postCommands {
+		return c.unsupported()
+	}
+	return c.invoke()
+}
+
+func openXRCD(c *command) error {
+	var cmd rdma.IBUverbsOpenXRCD
+	cmd.UnmarshalUnsafe(c.core)
+	if int32(cmd.FD) != -1 {
+		// Sharing XRC domains between processes through files is not
+		// supported.
+		c.t.Warningf("rdmaproxy: XRC domains associated with files are not supported")
+		return linuxerr.EOPNOTSUPP
+	}
+	return c.invoke()
+}
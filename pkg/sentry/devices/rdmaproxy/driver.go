@@ -0,0 +1,233 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/rdma"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/marshal"
+)
+
+// driver describes the driver-specific parts of the uverbs ABI of a host
+// driver.
+type driver struct {
+	// name is the name of the driver's user-space provider.
+	name string
+
+	// postCommands is true if the driver's provider uses the POST_SEND,
+	// POST_RECV and POST_SRQ_RECV commands to notify the driver of new work
+	// requests, which are otherwise executed in the host kernel.
+	postCommands bool
+
+	// The following functions translate the driver data of the corresponding
+	// commands in place, before the command is executed by the host. If a
+	// function is nil, the driver data of the command is passed through
+	// unmodified, and must not contain pointers.
+	createCQ  func(c *command, cqe uint32) error
+	resizeCQ  func(c *command, cqe uint32) error
+	createQP  func(c *command, qpType uint8, rss bool) error
+	createSRQ func(c *command, maxWR, maxSGE uint32) error
+	modifySRQ func(c *command, attrMask uint32) error
+	createWQ  func(c *command) error
+}
+
+// drivers maps the names of supported host drivers to their uverbs ABIs.
+var drivers = map[string]*driver{
+	"mlx5_core": {
+		name:      "mlx5",
+		createCQ:  mlx5CreateCQ,
+		resizeCQ:  mlx5ResizeCQ,
+		createQP:  mlx5CreateQP,
+		createSRQ: mlx5CreateSRQ,
+		createWQ:  mlx5CreateWQ,
+	},
+	"efa": {
+		name: "efa",
+	},
+	"rdma_rxe": {
+		name:         "rxe",
+		postCommands: true,
+		modifySRQ:    rxeModifySRQ,
+	},
+	"siw": {
+		name:         "siw",
+		postCommands: true,
+	},
+}
+
+// unmarshalPrefix unmarshals m from buf, which must contain at least minLen
+// bytes. If buf is shorter than m, the remaining fields of m are zeroed.
+func unmarshalPrefix(m marshal.Marshallable, buf []byte, minLen int) bool {
+	if len(buf) < minLen {
+		return false
+	}
+	tmp := make([]byte, m.SizeBytes())
+	copy(tmp, buf)
+	m.UnmarshalBytes(tmp)
+	return true
+}
+
+// marshalPrefix marshals the first len(buf) bytes of m into buf.
+func marshalPrefix(m marshal.Marshallable, buf []byte) {
+	tmp := make([]byte, m.SizeBytes())
+	m.MarshalBytes(tmp)
+	copy(buf, tmp)
+}
+
+// roundUpPow2 returns the smallest power of 2 greater than or equal to x.
+func roundUpPow2(x uint64) uint64 {
+	p := uint64(1)
+	for p < x && p != 0 {
+		p <<= 1
+	}
+	return p
+}
+
+// mlx5CQSize returns the size of an mlx5 CQ buffer, from
+// drivers/infiniband/hw/mlx5/cq.c:create_cq_user() and resize_user().
+func mlx5CQSize(cqe uint32, cqeSize uint32) (uint64, error) {
+	if cqeSize != 64 && cqeSize != 128 {
+		return 0, linuxerr.EINVAL
+	}
+	return roundUpPow2(uint64(cqe)+1) * uint64(cqeSize), nil
+}
+
+func mlx5CreateCQ(c *command, cqe uint32) error {
+	var ucmd rdma.MLX5IBCreateCQ
+	if !unmarshalPrefix(&ucmd, c.udata, 20 /* through CQESize */) {
+		return linuxerr.EINVAL
+	}
+	size, err := mlx5CQSize(cqe, ucmd.CQESize)
+	if err != nil {
+		return err
+	}
+	if err := c.mirrorBuf(&ucmd.BufAddr, size); err != nil {
+		return err
+	}
+	if err := c.mirrorDB(&ucmd.DBAddr); err != nil {
+		return err
+	}
+	marshalPrefix(&ucmd, c.udata)
+	return nil
+}
+
+func mlx5ResizeCQ(c *command, cqe uint32) error {
+	var ucmd rdma.MLX5IBResizeCQ
+	if !unmarshalPrefix(&ucmd, c.udata, 10 /* through CQESize */) {
+		return linuxerr.EINVAL
+	}
+	size, err := mlx5CQSize(cqe, uint32(ucmd.CQESize))
+	if err != nil {
+		return err
+	}
+	if err := c.mirrorBuf(&ucmd.BufAddr, size); err != nil {
+		return err
+	}
+	marshalPrefix(&ucmd, c.udata)
+	return nil
+}
+
+// mlx5CreateQP translates struct mlx5_ib_create_qp. The buffer sizes are
+// from drivers/infiniband/hw/mlx5/qp.c:set_user_buf_size().
+func mlx5CreateQP(c *command, qpType uint8, rss bool) error {
+	if rss {
+		// RSS QPs use struct mlx5_ib_create_qp_rss, which has no pointers.
+		return nil
+	}
+	var ucmd rdma.MLX5IBCreateQP
+	if !unmarshalPrefix(&ucmd, c.udata, 28 /* through RQWQEShift */) {
+		return linuxerr.EINVAL
+	}
+	if ucmd.RQWQEShift >= 32 {
+		return linuxerr.EINVAL
+	}
+	rqSize := uint64(ucmd.RQWQECount) << ucmd.RQWQEShift
+	sqSize := uint64(ucmd.SQWQECount) * rdma.MLX5_SEND_WQE_BB
+	if qpType == rdma.IB_UVERBS_QPT_RAW_PACKET {
+		// Raw packet QPs have separate receive and send queue buffers.
+		if sqSize != 0 && len(c.udata) < 48 /* through SQBufAddr */ {
+			return linuxerr.EINVAL
+		}
+		if err := c.mirrorBuf(&ucmd.BufAddr, rqSize); err != nil {
+			return err
+		}
+		if err := c.mirrorBuf(&ucmd.SQBufAddr, sqSize); err != nil {
+			return err
+		}
+	} else if err := c.mirrorBuf(&ucmd.BufAddr, rqSize+sqSize); err != nil {
+		return err
+	}
+	if err := c.mirrorDB(&ucmd.DBAddr); err != nil {
+		return err
+	}
+	marshalPrefix(&ucmd, c.udata)
+	return nil
+}
+
+// mlx5CreateSRQ translates struct mlx5_ib_create_srq. The buffer size is from
+// drivers/infiniband/hw/mlx5/srq.c:mlx5_ib_create_srq().
+func mlx5CreateSRQ(c *command, maxWR, maxSGE uint32) error {
+	var ucmd rdma.MLX5IBCreateSRQ
+	if !unmarshalPrefix(&ucmd, c.udata, 16 /* through DBAddr */) {
+		return linuxerr.EINVAL
+	}
+	// These limits are far beyond what the driver supports, and prevent
+	// overflow below.
+	if maxWR >= 1<<31 || maxSGE >= 1<<16 {
+		return linuxerr.EINVAL
+	}
+	descSize := roundUpPow2(rdma.MLX5_SRQ_WQE_SEG_SIZE + uint64(maxSGE)*rdma.MLX5_SRQ_WQE_SEG_SIZE)
+	if descSize < rdma.MLX5_SRQ_WQE_MIN_SIZE {
+		descSize = rdma.MLX5_SRQ_WQE_MIN_SIZE
+	}
+	if err := c.mirrorBuf(&ucmd.BufAddr, roundUpPow2(uint64(maxWR)+1)*descSize); err != nil {
+		return err
+	}
+	if err := c.mirrorDB(&ucmd.DBAddr); err != nil {
+		return err
+	}
+	marshalPrefix(&ucmd, c.udata)
+	return nil
+}
+
+// mlx5CreateWQ translates struct mlx5_ib_create_wq. The buffer size is from
+// drivers/infiniband/hw/mlx5/qp.c:create_user_rq().
+func mlx5CreateWQ(c *command) error {
+	var ucmd rdma.MLX5IBCreateWQ
+	if !unmarshalPrefix(&ucmd, c.udata, 24 /* through RQWQEShift */) {
+		return linuxerr.EINVAL
+	}
+	if ucmd.RQWQEShift >= 32 {
+		return linuxerr.EINVAL
+	}
+	if err := c.mirrorBuf(&ucmd.BufAddr, uint64(ucmd.RQWQECount)<<ucmd.RQWQEShift); err != nil {
+		return err
+	}
+	if err := c.mirrorDB(&ucmd.DBAddr); err != nil {
+		return err
+	}
+	marshalPrefix(&ucmd, c.udata)
+	return nil
+}
+
+// rxeModifySRQ rejects resizing of rxe SRQs, whose driver data contains the
+// address to which the driver writes the new queue's mmap information.
+func rxeModifySRQ(c *command, attrMask uint32) error {
+	if attrMask&rdma.IB_SRQ_MAX_WR != 0 && len(c.udata) != 0 {
+		c.t.Warningf("rdmaproxy: rxe SRQ resizing is not supported")
+		return linuxerr.EOPNOTSUPP
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/fdnotifier"
+	"gvisor.dev/gvisor/pkg/sentry/hostfd"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// eventFD implements vfs.FileDescriptionImpl for the asynchronous event and
+// completion channel files returned by uverbs commands, which are backed by
+// the corresponding host files.
+//
+// eventFD is not savable; we do not implement save/restore of uverbs state.
+type eventFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD int32
+	queue  waiter.Queue
+
+	// compChannel is true if the file is a completion channel, which may be
+	// used by CQs.
+	compChannel bool
+}
+
+// installEventFD installs an eventFD for the host event file hostFD in t's
+// file descriptor table, and returns its file descriptor. eventFD takes
+// ownership of hostFD, even if installEventFD fails.
+func installEventFD(t *kernel.Task, hostFD int32, compChannel bool) (int32, error) {
+	if err := unix.SetNonblock(int(hostFD), true); err != nil {
+		unix.Close(int(hostFD))
+		return -1, err
+	}
+	fd := &eventFD{
+		hostFD:      hostFD,
+		compChannel: compChannel,
+	}
+	vd := t.Kernel().VFS().NewAnonVirtualDentry("[infinibandevent]")
+	defer vd.DecRef(t)
+	if err := fd.vfsfd.Init(fd, linux.O_RDONLY, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(int(hostFD))
+		return -1, err
+	}
+	defer fd.vfsfd.DecRef(t)
+	if err := fdnotifier.AddFD(hostFD, &fd.queue); err != nil {
+		return -1, err
+	}
+	return t.NewFDFrom(0, &fd.vfsfd, kernel.FDFlags{CloseOnExec: true})
+}
+
+// hostCompChannel returns the host completion channel backing the
+// application completion channel fd, or -1 if fd is -1.
+func hostCompChannel(t *kernel.Task, fd int32) (int32, error) {
+	if fd == -1 {
+		return -1, nil
+	}
+	file, _ := t.FDTable().Get(fd)
+	if file == nil {
+		return -1, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	efd, ok := file.Impl().(*eventFD)
+	if !ok || !efd.compChannel {
+		return -1, linuxerr.EINVAL
+	}
+	return efd.hostFD, nil
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *eventFD) Release(context.Context) {
+	fdnotifier.RemoveFD(fd.hostFD)
+	unix.Close(int(fd.hostFD))
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *eventFD) EventRegister(e *waiter.Entry) error {
+	fd.queue.EventRegister(e)
+	if err := fdnotifier.UpdateFD(fd.hostFD); err != nil {
+		fd.queue.EventUnregister(e)
+		return err
+	}
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *eventFD) EventUnregister(e *waiter.Entry) {
+	fd.queue.EventUnregister(e)
+	if err := fdnotifier.UpdateFD(fd.hostFD); err != nil {
+		panic(fmt.Sprint("UpdateFD:", err))
+	}
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *eventFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return fdnotifier.NonBlockingPoll(fd.hostFD, mask)
+}
+
+// Epollable implements vfs.FileDescriptionImpl.Epollable.
+func (fd *eventFD) Epollable() bool {
+	return true
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *eventFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	if opts.Flags != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	reader := hostfd.GetReadWriterAt(fd.hostFD, -1, 0)
+	n, err := dst.CopyOutFrom(ctx, reader)
+	hostfd.PutReadWriterAt(reader)
+	if linuxerr.Equals(linuxerr.EAGAIN, err) || linuxerr.Equals(linuxerr.EWOULDBLOCK, err) {
+		// Event files return whole events, so a partial read is complete.
+		if n != 0 {
+			err = nil
+		} else {
+			err = linuxerr.ErrWouldBlock
+		}
+	}
+	return n, err
+}
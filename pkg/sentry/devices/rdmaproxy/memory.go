@@ -0,0 +1,130 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/cleanup"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+)
+
+const (
+	// maxMirrorLength is the maximum length of application memory that may
+	// be registered with the host driver in a single mirror.
+	maxMirrorLength = 1 << 40
+
+	// driverBufferGuard is the length of the inaccessible range reserved
+	// after mirrors of driver buffers. The host driver computes the size of
+	// driver buffers itself; the guard ensures that it fails to pin memory
+	// beyond the mirror, rather than pinning unrelated sentry memory, if
+	// that size is larger than the one computed by the sentry.
+	driverBufferGuard = 1 << 30
+)
+
+// mirror is a mapping of pinned application memory into the sentry's address
+// space, from which the host driver pins it.
+type mirror struct {
+	// appAR is the page-aligned application address range that is mirrored.
+	appAR hostarch.AddrRange
+
+	// addr is the address of the mirror in the sentry's address space.
+	addr uintptr
+
+	// reserved is the length of the range reserved at addr, which includes
+	// any guard following the mirror.
+	reserved uintptr
+
+	// prs are the pinned ranges of application memory mapped at addr.
+	prs []mm.PinnedRange
+}
+
+// newMirror pins the application memory containing [addr, addr+length) and
+// maps it into a new range of the sentry's address space, followed by guard
+// bytes of inaccessible memory. It returns the mirror and the address in the
+// sentry's address space corresponding to addr.
+func newMirror(t *kernel.Task, addr, length uint64, at hostarch.AccessType, guard uint64) (*mirror, uint64, error) {
+	if length == 0 || length > maxMirrorLength {
+		return nil, 0, linuxerr.EINVAL
+	}
+	ar, ok := hostarch.Addr(addr).ToRange(length)
+	if !ok {
+		return nil, 0, linuxerr.EFAULT
+	}
+	end, ok := ar.End.RoundUp()
+	if !ok {
+		return nil, 0, linuxerr.EFAULT
+	}
+	appAR := hostarch.AddrRange{ar.Start.RoundDown(), end}
+	reserved := uintptr(appAR.Length()) + uintptr(guard)
+
+	// Reserve a range in our address space.
+	m, _, errno := unix.RawSyscall6(unix.SYS_MMAP, 0 /* addr */, reserved, unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS, ^uintptr(0) /* fd */, 0 /* offset */)
+	if errno != 0 {
+		return nil, 0, errno
+	}
+	cu := cleanup.Make(func() {
+		unix.RawSyscall(unix.SYS_MUNMAP, m, reserved, 0)
+	})
+	defer cu.Clean()
+	// Mirror application mappings into the reserved range.
+	prs, err := t.MemoryManager().Pin(t, appAR, at, false /* ignorePermissions */)
+	cu.Add(func() {
+		mm.Unpin(prs)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sentryAddr := m
+	for _, pr := range prs {
+		ims, err := pr.File.MapInternal(memmap.FileRange{pr.Offset, pr.Offset + uint64(pr.Source.Length())}, at)
+		if err != nil {
+			return nil, 0, err
+		}
+		for !ims.IsEmpty() {
+			im := ims.Head()
+			if _, _, errno := unix.RawSyscall6(unix.SYS_MREMAP, im.Addr(), 0 /* old_size */, uintptr(im.Len()), linux.MREMAP_MAYMOVE|linux.MREMAP_FIXED, sentryAddr, 0); errno != 0 {
+				return nil, 0, errno
+			}
+			sentryAddr += uintptr(im.Len())
+			ims = ims.Tail()
+		}
+	}
+	cu.Release()
+	return &mirror{
+		appAR:    appAR,
+		addr:     m,
+		reserved: reserved,
+		prs:      prs,
+	}, uint64(m) + (addr - uint64(appAR.Start)), nil
+}
+
+// release unmaps and unpins the mirrored memory.
+func (m *mirror) release() {
+	unix.RawSyscall(unix.SYS_MUNMAP, m.addr, m.reserved, 0)
+	mm.Unpin(m.prs)
+}
+
+// dbPage is a mirror of an application page containing doorbell records.
+// Drivers share a single pinned page between all doorbell records in the same
+// page of a context's address space, so dbPages are shared in the same way.
+type dbPage struct {
+	m    *mirror
+	refs int
+}
@@ -0,0 +1,178 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rdmaproxy implements a proxy for host InfiniBand user verbs
+// (uverbs) devices, allowing RDMA applications using rdma-core's libibverbs
+// to access host RDMA devices from the sandbox.
+//
+// /dev/infiniband/uverbs<N> is backed by the corresponding host device. Only
+// the write()-based uverbs command interface is supported; the ioctl()-based
+// interface is reported as unavailable, which causes libibverbs to fall back
+// to write() commands. Allowlisted commands are passed through after their
+// response buffers are replaced by sentry buffers, and after translation of
+// their arguments that refer to application memory or file descriptors:
+//
+//   - Memory regions and the queue and doorbell buffers of driver objects are
+//     pinned and mirrored into the sentry's address space, from which the
+//     host driver pins them. The pins are held until the object is destroyed.
+//
+//   - Asynchronous event files and completion channels are backed by the
+//     corresponding host files.
+//
+// Driver-specific command data may contain pointers to application memory, so
+// only drivers whose command data is understood by the proxy are supported.
+// On-demand paging, XRC domains shared through files, and the RDMA connection
+// manager (/dev/infiniband/rdma_cm) are not supported.
+package rdmaproxy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+const (
+	// uverbsSysfsPath is the host sysfs directory containing uverbs devices.
+	uverbsSysfsPath = "/sys/class/infiniband_verbs"
+
+	// ibdevSysfsPath is the host sysfs directory containing RDMA devices.
+	ibdevSysfsPath = "/sys/class/infiniband"
+)
+
+// Device describes a host uverbs device exposed to the sandbox.
+type Device struct {
+	// Index is the index of the device, as in /dev/infiniband/uverbs<Index>.
+	Index uint32
+
+	// Major and Minor are the device numbers of the host device.
+	Major uint32
+	Minor uint32
+
+	// Driver is the name of the host driver of the RDMA device.
+	Driver string
+}
+
+func uverbsHostPath(index uint32) string {
+	return fmt.Sprintf("/dev/infiniband/uverbs%d", index)
+}
+
+// hostDriver returns the name of the host driver of the RDMA device backing
+// the uverbs device with the given index.
+func hostDriver(index uint32) (string, error) {
+	uverbsDir := path.Join(uverbsSysfsPath, fmt.Sprintf("uverbs%d", index))
+	ibdev, err := os.ReadFile(path.Join(uverbsDir, "ibdev"))
+	if err != nil {
+		return "", err
+	}
+	ibdevDir := path.Join(ibdevSysfsPath, strings.TrimSpace(string(ibdev)))
+	// Software RDMA devices are attached to a network device, which is
+	// named by their "parent" attribute; their "device" is the network
+	// device's parent.
+	if _, err := os.Stat(path.Join(ibdevDir, "parent")); err == nil {
+		nodeType, err := os.ReadFile(path.Join(ibdevDir, "node_type"))
+		if err != nil {
+			return "", err
+		}
+		// Soft-iWARP devices are RNICs; soft-RoCE devices are CAs.
+		if strings.HasPrefix(string(nodeType), "4:") {
+			return "siw", nil
+		}
+		return "rdma_rxe", nil
+	}
+	driver, err := os.Readlink(path.Join(uverbsDir, "device", "driver"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(driver), nil
+}
+
+// HostDevices returns the host uverbs devices that are supported by the
+// proxy. Devices whose drivers are not supported are skipped.
+func HostDevices() ([]Device, error) {
+	paths, err := filepath.Glob("/dev/infiniband/uverbs*")
+	if err != nil {
+		return nil, fmt.Errorf("enumerating uverbs device files: %w", err)
+	}
+	uverbsDeviceRegex := regexp.MustCompile(`^/dev/infiniband/uverbs(\d+)$`)
+	var devs []Device
+	for _, devPath := range paths {
+		ms := uverbsDeviceRegex.FindStringSubmatch(devPath)
+		if ms == nil {
+			continue
+		}
+		index, err := strconv.ParseUint(ms[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		var stat unix.Stat_t
+		if err := unix.Stat(devPath, &stat); err != nil {
+			return nil, fmt.Errorf("stat(%q): %w", devPath, err)
+		}
+		if stat.Mode&unix.S_IFMT != unix.S_IFCHR {
+			return nil, fmt.Errorf("%q is not a character device", devPath)
+		}
+		driver, err := hostDriver(uint32(index))
+		if err != nil {
+			return nil, fmt.Errorf("determining driver of %q: %w", devPath, err)
+		}
+		if _, ok := drivers[driver]; !ok {
+			log.Warningf("rdmaproxy: skipping %s: unsupported driver %q", devPath, driver)
+			continue
+		}
+		devs = append(devs, Device{
+			Index:  uint32(index),
+			Major:  unix.Major(stat.Rdev),
+			Minor:  unix.Minor(stat.Rdev),
+			Driver: driver,
+		})
+	}
+	return devs, nil
+}
+
+// Register registers the given uverbs devices in vfsObj, with the same device
+// numbers as in the host.
+func Register(vfsObj *vfs.VirtualFilesystem, devs []Device) error {
+	for _, dev := range devs {
+		if err := vfsObj.RegisterDevice(vfs.CharDevice, dev.Major, dev.Minor, &uverbsDevice{
+			index:  dev.Index,
+			driver: dev.Driver,
+		}, &vfs.RegisterDeviceOptions{
+			GroupName: "infiniband_verbs",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateDevtmpfsFiles creates the device special files for the given uverbs
+// devices.
+func CreateDevtmpfsFiles(ctx context.Context, dev *devtmpfs.Accessor, devs []Device) error {
+	for _, d := range devs {
+		if err := dev.CreateDeviceFile(ctx, fmt.Sprintf("infiniband/uverbs%d", d.Index), vfs.CharDevice, d.Major, d.Minor, 0666 /* mode */); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// bufferAddr returns the address of buf in the sentry's address space, or 0
+// if buf is empty. buf must be kept alive until the address is no longer
+// used.
+func bufferAddr(buf []byte) uint64 {
+	if len(buf) == 0 {
+		return 0
+	}
+	return uint64(uintptr(unsafe.Pointer(&buf[0])))
+}
+
+// invoke writes the command to the host file. The host writes the command's
+// response, if any, directly to c.resp.
+func (c *command) invoke() error {
+	_, _, errno := unix.Syscall(unix.SYS_WRITE, uintptr(c.fd.hostFD), uintptr(unsafe.Pointer(&c.buf[0])), uintptr(len(c.buf)))
+	runtime.KeepAlive(c.resp)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
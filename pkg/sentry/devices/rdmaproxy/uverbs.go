@@ -0,0 +1,317 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rdmaproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/rdma"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// maxCommandSize is the maximum size of a uverbs command, including headers.
+// It exceeds the largest size that can be described by the command headers.
+const maxCommandSize = 2 << 20
+
+// uverbsDevice implements vfs.Device for /dev/infiniband/uverbs<N>.
+//
+// +stateify savable
+type uverbsDevice struct {
+	index  uint32
+	driver string
+}
+
+// Open implements vfs.Device.Open.
+func (dev *uverbsDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	drv, ok := drivers[dev.driver]
+	if !ok {
+		return nil, linuxerr.ENXIO
+	}
+	hostPath := uverbsHostPath(dev.index)
+	hostFD, err := unix.Openat(-1, hostPath, unix.O_RDWR|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		ctx.Warningf("rdmaproxy: failed to open host %s: %v", hostPath, err)
+		return nil, err
+	}
+	fd := &uverbsFD{
+		hostFD:  int32(hostFD),
+		driver:  drv,
+		objects: make(map[objectKey]*object),
+		dbPages: make(map[hostarch.Addr]*dbPage),
+	}
+	fd.memmapFile.fd = fd
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// objectType is the type of a uverbs object.
+type objectType int
+
+const (
+	mrObject objectType = iota
+	cqObject
+	qpObject
+	srqObject
+	wqObject
+)
+
+// objectKey identifies a uverbs object.
+type objectKey struct {
+	typ    objectType
+	handle uint32
+}
+
+// object is a uverbs object that uses application memory.
+type object struct {
+	// bufs are the mirrors of the object's buffers.
+	bufs []*mirror
+
+	// dbPages are the application addresses of the doorbell pages used by
+	// the object.
+	dbPages []hostarch.Addr
+
+	// access is the access flags of a memory region.
+	access uint32
+}
+
+// uverbsFD implements vfs.FileDescriptionImpl for /dev/infiniband/uverbs<N>.
+//
+// uverbsFD is not savable; we do not implement save/restore of uverbs state.
+type uverbsFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD     int32
+	driver     *driver
+	memmapFile uverbsMemmapFile
+
+	// mu serializes commands, and protects the following fields.
+	mu sync.Mutex
+
+	// objects are the objects created by the application that use
+	// application memory.
+	//
+	// +checklocks:mu
+	objects map[objectKey]*object
+
+	// dbPages maps the application addresses of doorbell pages to their
+	// mirrors.
+	//
+	// +checklocks:mu
+	dbPages map[hostarch.Addr]*dbPage
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *uverbsFD) Release(context.Context) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	// Application memory may only be unpinned once the host has destroyed
+	// the objects using it, which happens when the host file is closed.
+	unix.Close(int(fd.hostFD))
+	for key, obj := range fd.objects {
+		for _, m := range obj.bufs {
+			m.release()
+		}
+		delete(fd.objects, key)
+	}
+	for addr, page := range fd.dbPages {
+		page.m.release()
+		delete(fd.dbPages, addr)
+	}
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *uverbsFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	// The ioctl() command interface (RDMA_VERBS_IOCTL) is not supported.
+	// libibverbs falls back to write() commands when it fails with ENOTTY.
+	return 0, linuxerr.ENOTTY
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *uverbsFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	if opts.Flags != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Write should be called from a task context")
+	}
+	var hdr rdma.IBUverbsCmdHdr
+	var exHdr rdma.IBUverbsExCmdHdr
+	size := src.NumBytes()
+	if size < int64(hdr.SizeBytes()) || size > maxCommandSize {
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, size)
+	if _, err := src.CopyIn(ctx, buf); err != nil {
+		return 0, err
+	}
+	hdr.UnmarshalUnsafe(buf)
+	c := &command{
+		t:   t,
+		fd:  fd,
+		num: hdr.Command & rdma.IB_USER_VERBS_CMD_COMMAND_MASK,
+		buf: buf,
+	}
+	var respAddr hostarch.Addr
+	switch hdr.Command &^ rdma.IB_USER_VERBS_CMD_COMMAND_MASK {
+	case 0:
+		info, ok := legacyCommands[c.num]
+		if !ok {
+			return 0, c.unsupported()
+		}
+		if int64(hdr.InWords)*4 != size {
+			return 0, linuxerr.EINVAL
+		}
+		payload := buf[hdr.SizeBytes():]
+		if len(payload) < info.coreSize {
+			return 0, linuxerr.EINVAL
+		}
+		c.core, c.udata = payload[:info.coreSize], payload[info.coreSize:]
+		if info.hasResp {
+			respAddr = hostarch.Addr(hostarch.ByteOrder.Uint64(payload))
+			c.resp = make([]byte, int(hdr.OutWords)*4)
+			hostarch.ByteOrder.PutUint64(payload, bufferAddr(c.resp))
+		}
+		c.handler = info.handler
+	case rdma.IB_USER_VERBS_CMD_FLAG_EXTENDED << rdma.IB_USER_VERBS_CMD_FLAGS_SHIFT:
+		c.extended = true
+		info, ok := extendedCommands[c.num]
+		if !ok {
+			return 0, c.unsupported()
+		}
+		hdrsSize := int64(hdr.SizeBytes() + exHdr.SizeBytes())
+		if size < hdrsSize {
+			return 0, linuxerr.EINVAL
+		}
+		exHdr.UnmarshalUnsafe(buf[hdr.SizeBytes():])
+		if exHdr.CmdHdrReserved != 0 || (int64(hdr.InWords)+int64(exHdr.ProviderInWords))*8 != size-hdrsSize {
+			return 0, linuxerr.EINVAL
+		}
+		payload := buf[hdrsSize:]
+		coreSize := int(hdr.InWords) * 8
+		if coreSize < info.coreSize {
+			return 0, linuxerr.EINVAL
+		}
+		c.core, c.udata = payload[:coreSize], payload[coreSize:]
+		if exHdr.Response != 0 {
+			respAddr = hostarch.Addr(exHdr.Response)
+			c.resp = make([]byte, (int(hdr.OutWords)+int(exHdr.ProviderOutWords))*8)
+			exHdr.Response = bufferAddr(c.resp)
+			exHdr.MarshalUnsafe(buf[hdr.SizeBytes():])
+		}
+		c.handler = info.handler
+	default:
+		return 0, linuxerr.EINVAL
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	var err error
+	if c.handler != nil {
+		err = c.handler(c)
+	} else {
+		err = c.invoke()
+	}
+	c.releaseUnused()
+	if err != nil {
+		return 0, err
+	}
+	if respAddr != 0 && len(c.resp) != 0 {
+		if _, err := t.CopyOutBytes(respAddr, c.resp); err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *uverbsFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	return vfs.GenericConfigureMMap(&fd.vfsfd, fd, opts)
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (fd *uverbsFD) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (fd *uverbsFD) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (fd *uverbsFD) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return nil
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (fd *uverbsFD) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	// Drivers only allow mappings of exactly the ranges they have handed out
+	// (e.g. a single UAR page), so translate as much of the application
+	// mapping as possible.
+	return []memmap.Translation{
+		{
+			Source: optional,
+			File:   &fd.memmapFile,
+			Offset: optional.Start,
+			Perms:  at,
+		},
+	}, nil
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (fd *uverbsFD) InvalidateUnsavable(ctx context.Context) error {
+	return nil
+}
+
+// uverbsMemmapFile implements memmap.File for /dev/infiniband/uverbs<N>.
+type uverbsMemmapFile struct {
+	fd *uverbsFD
+}
+
+// IncRef implements memmap.File.IncRef.
+func (mf *uverbsMemmapFile) IncRef(memmap.FileRange, uint32) {
+}
+
+// DecRef implements memmap.File.DecRef.
+func (mf *uverbsMemmapFile) DecRef(fr memmap.FileRange) {
+}
+
+// MapInternal implements memmap.File.MapInternal.
+func (mf *uverbsMemmapFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (safemem.BlockSeq, error) {
+	log.Traceback("rdmaproxy: rejecting uverbsMemmapFile.MapInternal")
+	return safemem.BlockSeq{}, linuxerr.EINVAL
+}
+
+// FD implements memmap.File.FD.
+func (mf *uverbsMemmapFile) FD() int {
+	return int(mf.fd.hostFD)
+}
@@ -0,0 +1,355 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmdev
+
+import (
+	"encoding/binary"
+)
+
+// headerSize is the size of command and response headers: a 16-bit tag, a
+// 32-bit size and a 32-bit command or response code.
+const headerSize = 10
+
+// Structure tags, from TPM 2.0 Part 2, "TPM_ST".
+const (
+	stNoSessions = 0x8001
+	stSessions   = 0x8002
+)
+
+// Command codes, from TPM 2.0 Part 2, "TPM_CC".
+const (
+	ccNVUndefineSpaceSpecial     = 0x11f
+	ccEvictControl               = 0x120
+	ccHierarchyControl           = 0x121
+	ccNVUndefineSpace            = 0x122
+	ccChangeEPS                  = 0x124
+	ccChangePPS                  = 0x125
+	ccClear                      = 0x126
+	ccClearControl               = 0x127
+	ccClockSet                   = 0x128
+	ccHierarchyChangeAuth        = 0x129
+	ccNVDefineSpace              = 0x12a
+	ccPCRAllocate                = 0x12b
+	ccPCRSetAuthPolicy           = 0x12c
+	ccPPCommands                 = 0x12d
+	ccSetPrimaryPolicy           = 0x12e
+	ccFieldUpgradeStart          = 0x12f
+	ccClockRateAdjust            = 0x130
+	ccCreatePrimary              = 0x131
+	ccNVGlobalWriteLock          = 0x132
+	ccGetCommandAuditDigest      = 0x133
+	ccNVIncrement                = 0x134
+	ccNVSetBits                  = 0x135
+	ccNVExtend                   = 0x136
+	ccNVWrite                    = 0x137
+	ccNVWriteLock                = 0x138
+	ccDictionaryAttackLockReset  = 0x139
+	ccDictionaryAttackParameters = 0x13a
+	ccNVChangeAuth               = 0x13b
+	ccPCREvent                   = 0x13c
+	ccPCRReset                   = 0x13d
+	ccSequenceComplete           = 0x13e
+	ccSetAlgorithmSet            = 0x13f
+	ccSetCommandCodeAuditStatus  = 0x140
+	ccFieldUpgradeData           = 0x141
+	ccIncrementalSelfTest        = 0x142
+	ccSelfTest                   = 0x143
+	ccStartup                    = 0x144
+	ccShutdown                   = 0x145
+	ccStirRandom                 = 0x146
+	ccActivateCredential         = 0x147
+	ccCertify                    = 0x148
+	ccPolicyNV                   = 0x149
+	ccCertifyCreation            = 0x14a
+	ccDuplicate                  = 0x14b
+	ccGetTime                    = 0x14c
+	ccGetSessionAuditDigest      = 0x14d
+	ccNVRead                     = 0x14e
+	ccNVReadLock                 = 0x14f
+	ccObjectChangeAuth           = 0x150
+	ccPolicySecret               = 0x151
+	ccRewrap                     = 0x152
+	ccCreate                     = 0x153
+	ccECDHZGen                   = 0x154
+	ccHMAC                       = 0x155
+	ccImport                     = 0x156
+	ccLoad                       = 0x157
+	ccQuote                      = 0x158
+	ccRSADecrypt                 = 0x159
+	ccHMACStart                  = 0x15b
+	ccSequenceUpdate             = 0x15c
+	ccSign                       = 0x15d
+	ccUnseal                     = 0x15e
+	ccPolicySigned               = 0x160
+	ccContextLoad                = 0x161
+	ccContextSave                = 0x162
+	ccECDHKeyGen                 = 0x163
+	ccEncryptDecrypt             = 0x164
+	ccFlushContext               = 0x165
+	ccLoadExternal               = 0x167
+	ccMakeCredential             = 0x168
+	ccNVReadPublic               = 0x169
+	ccPolicyAuthorize            = 0x16a
+	ccPolicyAuthValue            = 0x16b
+	ccPolicyCommandCode          = 0x16c
+	ccPolicyCounterTimer         = 0x16d
+	ccPolicyCpHash               = 0x16e
+	ccPolicyLocality             = 0x16f
+	ccPolicyNameHash             = 0x170
+	ccPolicyOR                   = 0x171
+	ccPolicyTicket               = 0x172
+	ccReadPublic                 = 0x173
+	ccRSAEncrypt                 = 0x174
+	ccStartAuthSession           = 0x176
+	ccVerifySignature            = 0x177
+	ccECCParameters              = 0x178
+	ccFirmwareRead               = 0x179
+	ccGetCapability              = 0x17a
+	ccGetRandom                  = 0x17b
+	ccGetTestResult              = 0x17c
+	ccHash                       = 0x17d
+	ccPCRRead                    = 0x17e
+	ccPolicyPCR                  = 0x17f
+	ccPolicyRestart              = 0x180
+	ccReadClock                  = 0x181
+	ccPCRExtend                  = 0x182
+	ccPCRSetAuthValue            = 0x183
+	ccNVCertify                  = 0x184
+	ccEventSequenceComplete      = 0x185
+	ccHashSequenceStart          = 0x186
+	ccPolicyPhysicalPresence     = 0x187
+	ccPolicyDuplicationSelect    = 0x188
+	ccPolicyGetDigest            = 0x189
+	ccTestParms                  = 0x18a
+	ccCommit                     = 0x18b
+	ccPolicyPassword             = 0x18c
+	ccZGen2Phase                 = 0x18d
+	ccECEphemeral                = 0x18e
+	ccPolicyNvWritten            = 0x18f
+	ccPolicyTemplate             = 0x190
+	ccCreateLoaded               = 0x191
+	ccPolicyAuthorizeNV          = 0x192
+	ccEncryptDecrypt2            = 0x193
+)
+
+// Response codes, from TPM 2.0 Part 2, "TPM_RC".
+const (
+	rcSuccess     = 0x000
+	rcBadTag      = 0x01e
+	rcInitialize  = 0x100
+	rcCommandCode = 0x143
+	rcAuthMissing = 0x125
+	rcHash        = 0x083
+	rcValue       = 0x084
+	rcHandle      = 0x08b
+	rcAuthFail    = 0x08e
+	rcSize        = 0x095
+	rcLocality    = 0x907
+
+	// rcParam1, rcHandle1 and rcSession1 qualify format-one response codes
+	// with the first parameter, handle or session of the command.
+	rcParam1   = 0x140
+	rcHandle1  = 0x100
+	rcSession1 = 0x900
+
+	// rcResMgrLayer is the layer of response codes synthesized by the
+	// resource manager, from include/linux/tpm.h:TSS2_RESMGR_TPM_RC_LAYER.
+	rcResMgrLayer = 11 << 16
+)
+
+// hostCommands is the set of commands that are proxied to the host TPM. It
+// excludes commands that modify state that outlives the host resource
+// manager's sessions and transient objects, e.g. PCRs, NV indices, persistent
+// objects, hierarchies and dictionary attack protection, since that state is
+// shared with the host and other sandboxes.
+var hostCommands = map[uint32]struct{}{
+	ccActivateCredential:      {},
+	ccCertify:                 {},
+	ccCertifyCreation:         {},
+	ccCommit:                  {},
+	ccContextLoad:             {},
+	ccContextSave:             {},
+	ccCreate:                  {},
+	ccCreateLoaded:            {},
+	ccCreatePrimary:           {},
+	ccDuplicate:               {},
+	ccECCParameters:           {},
+	ccECDHKeyGen:              {},
+	ccECDHZGen:                {},
+	ccECEphemeral:             {},
+	ccEncryptDecrypt:          {},
+	ccEncryptDecrypt2:         {},
+	ccFlushContext:            {},
+	ccGetCapability:           {},
+	ccGetCommandAuditDigest:   {},
+	ccGetRandom:               {},
+	ccGetSessionAuditDigest:   {},
+	ccGetTestResult:           {},
+	ccGetTime:                 {},
+	ccHMAC:                    {},
+	ccHMACStart:               {},
+	ccHash:                    {},
+	ccHashSequenceStart:       {},
+	ccImport:                  {},
+	ccLoad:                    {},
+	ccLoadExternal:            {},
+	ccMakeCredential:          {},
+	ccNVCertify:               {},
+	ccNVRead:                  {},
+	ccNVReadPublic:            {},
+	ccObjectChangeAuth:        {},
+	ccPCRRead:                 {},
+	ccPolicyAuthValue:         {},
+	ccPolicyAuthorize:         {},
+	ccPolicyAuthorizeNV:       {},
+	ccPolicyCommandCode:       {},
+	ccPolicyCounterTimer:      {},
+	ccPolicyCpHash:            {},
+	ccPolicyDuplicationSelect: {},
+	ccPolicyGetDigest:         {},
+	ccPolicyLocality:          {},
+	ccPolicyNV:                {},
+	ccPolicyNameHash:          {},
+	ccPolicyNvWritten:         {},
+	ccPolicyOR:                {},
+	ccPolicyPCR:               {},
+	ccPolicyPassword:          {},
+	ccPolicyPhysicalPresence:  {},
+	ccPolicyRestart:           {},
+	ccPolicySecret:            {},
+	ccPolicySigned:            {},
+	ccPolicyTemplate:          {},
+	ccPolicyTicket:            {},
+	ccQuote:                   {},
+	ccRSADecrypt:              {},
+	ccRSAEncrypt:              {},
+	ccReadClock:               {},
+	ccReadPublic:              {},
+	ccRewrap:                  {},
+	ccSequenceComplete:        {},
+	ccSequenceUpdate:          {},
+	ccSign:                    {},
+	ccStartAuthSession:        {},
+	ccStirRandom:              {},
+	ccTestParms:               {},
+	ccUnseal:                  {},
+	ccVerifySignature:         {},
+	ccZGen2Phase:              {},
+}
+
+// commandTag returns the tag of cmd, whose header has been validated.
+func commandTag(cmd []byte) uint16 {
+	return binary.BigEndian.Uint16(cmd)
+}
+
+// commandCode returns the command code of cmd, whose header has been
+// validated.
+func commandCode(cmd []byte) uint32 {
+	return binary.BigEndian.Uint32(cmd[6:])
+}
+
+// responseBuilder builds a response.
+type responseBuilder struct {
+	buf []byte
+}
+
+func newResponseBuilder(tag uint16) *responseBuilder {
+	rb := &responseBuilder{buf: make([]byte, headerSize, maxBufferSize)}
+	binary.BigEndian.PutUint16(rb.buf, tag)
+	return rb
+}
+
+func (rb *responseBuilder) putUint8(v uint8) {
+	rb.buf = append(rb.buf, v)
+}
+
+func (rb *responseBuilder) putUint16(v uint16) {
+	rb.buf = binary.BigEndian.AppendUint16(rb.buf, v)
+}
+
+func (rb *responseBuilder) putUint32(v uint32) {
+	rb.buf = binary.BigEndian.AppendUint32(rb.buf, v)
+}
+
+// put2B appends a TPM2B structure, i.e. a size-prefixed buffer.
+func (rb *responseBuilder) put2B(b []byte) {
+	rb.putUint16(uint16(len(b)))
+	rb.buf = append(rb.buf, b...)
+}
+
+// finish returns the response, after filling in its header.
+func (rb *responseBuilder) finish() []byte {
+	binary.BigEndian.PutUint32(rb.buf[2:], uint32(len(rb.buf)))
+	return rb.buf
+}
+
+// errorResponse returns a response with the given error code.
+func errorResponse(rc uint32) []byte {
+	rb := newResponseBuilder(stNoSessions)
+	binary.BigEndian.PutUint32(rb.buf[6:], rc)
+	return rb.finish()
+}
+
+// commandParser parses the body of a command.
+type commandParser struct {
+	buf []byte
+	err bool
+}
+
+func newCommandParser(cmd []byte) *commandParser {
+	return &commandParser{buf: cmd[headerSize:]}
+}
+
+func (cp *commandParser) take(n int) []byte {
+	if cp.err || len(cp.buf) < n {
+		cp.err = true
+		return nil
+	}
+	b := cp.buf[:n]
+	cp.buf = cp.buf[n:]
+	return b
+}
+
+func (cp *commandParser) uint8() uint8 {
+	if b := cp.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (cp *commandParser) uint16() uint16 {
+	if b := cp.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (cp *commandParser) uint32() uint32 {
+	if b := cp.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// get2B parses a TPM2B structure and returns its contents.
+func (cp *commandParser) get2B() []byte {
+	return cp.take(int(cp.uint16()))
+}
+
+// ok returns true if all parsing succeeded and the whole command was
+// consumed.
+func (cp *commandParser) ok() bool {
+	return !cp.err && len(cp.buf) == 0
+}
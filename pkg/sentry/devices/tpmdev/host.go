@@ -0,0 +1,82 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmdev
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// hostBackend proxies commands to a file description of the host's TPM
+// resource manager. Since the host resource manager flushes the sessions and
+// transient objects of a file description when it is closed, each hostBackend
+// has its own.
+//
+// hostBackend is not savable; we do not implement save/restore of host TPM
+// state.
+type hostBackend struct {
+	hostFD int
+}
+
+// openHost returns a new hostBackend.
+func openHost(ctx context.Context) (*hostBackend, error) {
+	// The host FD is blocking, since commands are executed synchronously.
+	hostFD, err := unix.Openat(-1, hostPath, unix.O_RDWR|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		ctx.Warningf("tpmdev: failed to open host %s: %v", hostPath, err)
+		return nil, err
+	}
+	return &hostBackend{hostFD: hostFD}, nil
+}
+
+// execute implements backend.execute.
+func (b *hostBackend) execute(ctx context.Context, cmd []byte) ([]byte, error) {
+	cc := commandCode(cmd)
+	if _, ok := hostCommands[cc]; !ok {
+		ctx.Debugf("tpmdev: rejecting command %#x", cc)
+		// Compare drivers/char/tpm/tpm-interface.c:tpm_try_transmit(), which
+		// synthesizes this response for commands not implemented by the TPM.
+		return errorResponse(rcCommandCode | rcResMgrLayer), nil
+	}
+	for {
+		_, err := unix.Write(b.hostFD, cmd)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	rsp := make([]byte, maxBufferSize)
+	for {
+		n, err := unix.Read(b.hostFD, rsp)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return rsp[:n], nil
+	}
+}
+
+// release implements backend.release.
+func (b *hostBackend) release() {
+	if err := unix.Close(b.hostFD); err != nil {
+		log.Warningf("tpmdev: failed to close host fd %d: %v", b.hostFD, err)
+	}
+}
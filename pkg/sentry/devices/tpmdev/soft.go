@@ -0,0 +1,322 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmdev
+
+import (
+	"crypto/sha256"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+const (
+	// numPCRs is the number of PCRs in each bank.
+	numPCRs = 24
+
+	// pcrSelectSize is the minimum size of PCR selection bitmaps.
+	pcrSelectSize = numPCRs / 8
+
+	// maxPCRReadDigests is the maximum number of digests returned by
+	// TPM2_PCR_Read, from TPM 2.0 Part 2, "TPML_DIGEST".
+	maxPCRReadDigests = 8
+
+	// algSHA256 is the only hash algorithm supported by the software TPM,
+	// from TPM 2.0 Part 2, "TPM_ALG_ID".
+	algSHA256 = 0x000b
+
+	// rsPW is the password authorization session handle, from TPM 2.0 Part 2,
+	// "TPM_RS_PW".
+	rsPW = 0x40000009
+
+	// sessionContinue is the continueSession session attribute.
+	sessionContinue = 0x01
+)
+
+// Capabilities, from TPM 2.0 Part 2, "TPM_CAP".
+const (
+	capPCRs          = 0x5
+	capTPMProperties = 0x6
+)
+
+// tpmProperties are the fixed properties reported by TPM2_GetCapability, from
+// TPM 2.0 Part 2, "TPM_PT", sorted by property.
+var tpmProperties = []struct {
+	property uint32
+	value    uint32
+}{
+	{0x100, 0x322e3000},    // TPM_PT_FAMILY_INDICATOR: "2.0"
+	{0x101, 0},             // TPM_PT_LEVEL
+	{0x102, 138},           // TPM_PT_REVISION: 1.38
+	{0x105, 0x47565352},    // TPM_PT_MANUFACTURER: "GVSR"
+	{0x106, 0x67566973},    // TPM_PT_VENDOR_STRING_1: "gVis"
+	{0x107, 0x6f720000},    // TPM_PT_VENDOR_STRING_2: "or"
+	{0x112, numPCRs},       // TPM_PT_PCR_COUNT
+	{0x113, pcrSelectSize}, // TPM_PT_PCR_SELECT_MIN
+}
+
+// softTPM is a minimal software TPM, with a single SHA-256 PCR bank and no
+// persistent storage. It supports reading and extending PCRs, random number
+// generation and capability queries; other commands fail with
+// TPM_RC_COMMAND_CODE. As in Linux, the TPM is started when the device is
+// registered.
+//
+// +stateify savable
+type softTPM struct {
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// pcrs is the SHA-256 PCR bank.
+	pcrs [numPCRs][sha256.Size]byte
+
+	// pcrUpdateCounter is incremented whenever a PCR is extended.
+	pcrUpdateCounter uint32
+}
+
+func newSoftTPM() *softTPM {
+	t := &softTPM{}
+	// PCRs 17 to 22 are reset to all ones, until a dynamic root of trust for
+	// measurement is established.
+	for i := 17; i <= 22; i++ {
+		for j := range t.pcrs[i] {
+			t.pcrs[i][j] = 0xff
+		}
+	}
+	return t
+}
+
+// execute implements backend.execute.
+func (t *softTPM) execute(ctx context.Context, cmd []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tag := commandTag(cmd)
+	cc := commandCode(cmd)
+	if cc == ccPCRExtend {
+		if tag != stSessions {
+			return errorResponse(rcAuthMissing), nil
+		}
+		return t.pcrExtend(cmd), nil
+	}
+	if tag != stNoSessions {
+		return errorResponse(rcBadTag), nil
+	}
+	switch cc {
+	case ccStartup:
+		// The TPM is already started.
+		return errorResponse(rcInitialize), nil
+	case ccShutdown:
+		cp := newCommandParser(cmd)
+		cp.uint16()
+		if !cp.ok() {
+			return errorResponse(rcSize), nil
+		}
+		return newResponseBuilder(stNoSessions).finish(), nil
+	case ccSelfTest:
+		cp := newCommandParser(cmd)
+		cp.uint8()
+		if !cp.ok() {
+			return errorResponse(rcSize), nil
+		}
+		return newResponseBuilder(stNoSessions).finish(), nil
+	case ccGetTestResult:
+		rb := newResponseBuilder(stNoSessions)
+		rb.put2B(nil)
+		rb.putUint32(rcSuccess)
+		return rb.finish(), nil
+	case ccGetRandom:
+		return t.getRandom(cmd), nil
+	case ccGetCapability:
+		return t.getCapability(cmd), nil
+	case ccPCRRead:
+		return t.pcrRead(cmd), nil
+	default:
+		ctx.Debugf("tpmdev: unsupported command %#x", cc)
+		return errorResponse(rcCommandCode), nil
+	}
+}
+
+// release implements backend.release.
+func (t *softTPM) release() {}
+
+func (t *softTPM) getRandom(cmd []byte) []byte {
+	cp := newCommandParser(cmd)
+	n := int(cp.uint16())
+	if !cp.ok() {
+		return errorResponse(rcSize)
+	}
+	// As in hardware TPMs, return at most the size of the largest digest.
+	if n > sha256.Size {
+		n = sha256.Size
+	}
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic("rand.Read failed: " + err.Error())
+	}
+	rb := newResponseBuilder(stNoSessions)
+	rb.put2B(buf)
+	return rb.finish()
+}
+
+func (t *softTPM) getCapability(cmd []byte) []byte {
+	cp := newCommandParser(cmd)
+	capability := cp.uint32()
+	property := cp.uint32()
+	count := cp.uint32()
+	if !cp.ok() {
+		return errorResponse(rcSize)
+	}
+	rb := newResponseBuilder(stNoSessions)
+	switch capability {
+	case capPCRs:
+		rb.putUint8(0) // moreData
+		rb.putUint32(capability)
+		rb.putUint32(1)
+		rb.putUint16(algSHA256)
+		rb.putUint8(pcrSelectSize)
+		for i := 0; i < pcrSelectSize; i++ {
+			rb.putUint8(0xff)
+		}
+	case capTPMProperties:
+		var props []int
+		for i, p := range tpmProperties {
+			if p.property >= property {
+				props = append(props, i)
+			}
+		}
+		moreData := uint8(0)
+		if uint32(len(props)) > count {
+			props = props[:count]
+			moreData = 1
+		}
+		rb.putUint8(moreData)
+		rb.putUint32(capability)
+		rb.putUint32(uint32(len(props)))
+		for _, i := range props {
+			rb.putUint32(tpmProperties[i].property)
+			rb.putUint32(tpmProperties[i].value)
+		}
+	default:
+		return errorResponse(rcValue | rcParam1)
+	}
+	return rb.finish()
+}
+
+// pcrSelection is a TPMS_PCR_SELECTION.
+type pcrSelection struct {
+	hash   uint16
+	bitmap []byte
+}
+
+func (t *softTPM) pcrRead(cmd []byte) []byte {
+	cp := newCommandParser(cmd)
+	count := cp.uint32()
+	var selections []pcrSelection
+	for i := uint32(0); i < count && !cp.err; i++ {
+		hash := cp.uint16()
+		bitmap := cp.take(int(cp.uint8()))
+		selections = append(selections, pcrSelection{hash, bitmap})
+	}
+	if !cp.ok() {
+		return errorResponse(rcSize)
+	}
+
+	// Return the selected PCRs in order, up to maxPCRReadDigests, and the
+	// selection of PCRs that were actually returned.
+	var digests [][]byte
+	rb := newResponseBuilder(stNoSessions)
+	rb.putUint32(t.pcrUpdateCounter)
+	rb.putUint32(uint32(len(selections)))
+	for _, sel := range selections {
+		rb.putUint16(sel.hash)
+		rb.putUint8(uint8(len(sel.bitmap)))
+		for i, b := range sel.bitmap {
+			var out uint8
+			for bit := 0; bit < 8; bit++ {
+				pcr := i*8 + bit
+				if b&(1<<bit) == 0 || sel.hash != algSHA256 || pcr >= numPCRs || len(digests) == maxPCRReadDigests {
+					continue
+				}
+				out |= 1 << bit
+				digests = append(digests, t.pcrs[pcr][:])
+			}
+			rb.putUint8(out)
+		}
+	}
+	rb.putUint32(uint32(len(digests)))
+	for _, d := range digests {
+		rb.put2B(d)
+	}
+	return rb.finish()
+}
+
+func (t *softTPM) pcrExtend(cmd []byte) []byte {
+	cp := newCommandParser(cmd)
+	pcr := cp.uint32()
+	auth := &commandParser{buf: cp.take(int(cp.uint32()))}
+	if cp.err {
+		return errorResponse(rcSize)
+	}
+	if pcr >= numPCRs {
+		return errorResponse(rcValue | rcHandle1)
+	}
+	// Only PCRs 0 to 16 and 23 can be extended from locality 0.
+	if pcr > 16 && pcr < 23 {
+		return errorResponse(rcLocality)
+	}
+
+	// PCRs have an empty authorization value, so only a single password
+	// session with an empty password is accepted.
+	session := auth.uint32()
+	auth.get2B() // nonce
+	attrs := auth.uint8()
+	password := auth.get2B()
+	if !auth.ok() {
+		return errorResponse(rcSize)
+	}
+	if session != rsPW {
+		return errorResponse(rcHandle | rcSession1)
+	}
+	if len(password) != 0 {
+		return errorResponse(rcAuthFail | rcSession1)
+	}
+
+	count := cp.uint32()
+	var digests [][]byte
+	for i := uint32(0); i < count && !cp.err; i++ {
+		if alg := cp.uint16(); alg != algSHA256 {
+			if !cp.err {
+				return errorResponse(rcHash | rcParam1)
+			}
+			break
+		}
+		digests = append(digests, cp.take(sha256.Size))
+	}
+	if !cp.ok() {
+		return errorResponse(rcSize)
+	}
+	for _, d := range digests {
+		t.pcrs[pcr] = sha256.Sum256(append(t.pcrs[pcr][:], d...))
+	}
+	if len(digests) != 0 {
+		t.pcrUpdateCounter++
+	}
+
+	rb := newResponseBuilder(stSessions)
+	rb.putUint32(0) // parameterSize
+	rb.put2B(nil)   // nonce
+	rb.putUint8(attrs & sessionContinue)
+	rb.put2B(nil) // hmac
+	return rb.finish()
+}
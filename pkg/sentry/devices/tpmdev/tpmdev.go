@@ -0,0 +1,211 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tpmdev implements the TPM 2.0 resource manager device, /dev/tpmrm0.
+//
+// As in Linux, a command is submitted by writing it with a single write(2),
+// and its response is then read with read(2). Commands are either proxied to
+// the host's TPM resource manager, after filtering out commands that modify
+// TPM state shared with the host, or executed by a minimal software TPM.
+package tpmdev
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	tpmrmDevMinor = 0
+
+	// hostPath is the path of the host TPM resource manager.
+	hostPath = "/dev/tpmrm0"
+
+	// maxBufferSize is the maximum size of commands and responses, from
+	// include/linux/tpm.h:TPM_BUFSIZE.
+	maxBufferSize = 4096
+)
+
+// backend executes TPM commands.
+type backend interface {
+	// execute executes cmd, whose header has been validated, and returns the
+	// response.
+	execute(ctx context.Context, cmd []byte) ([]byte, error)
+
+	// release releases resources held by the backend for a file description.
+	release()
+}
+
+// tpmDevice implements vfs.Device for /dev/tpmrm0.
+//
+// +stateify savable
+type tpmDevice struct {
+	// soft is the software TPM, or nil if commands are proxied to the host
+	// TPM. soft is shared by all file descriptions of the device.
+	soft *softTPM
+}
+
+// Open implements vfs.Device.Open.
+func (dev *tpmDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	var b backend
+	if dev.soft != nil {
+		b = dev.soft
+	} else {
+		hb, err := openHost(ctx)
+		if err != nil {
+			return nil, err
+		}
+		b = hb
+	}
+	fd := &tpmFD{
+		backend: b,
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		b.release()
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// tpmFD implements vfs.FileDescriptionImpl for /dev/tpmrm0.
+//
+// tpmFD is only savable when the software TPM is used; we do not implement
+// save/restore of host TPM state.
+//
+// +stateify savable
+type tpmFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	backend backend
+	queue   waiter.Queue
+
+	// mu serializes commands, and protects response.
+	mu sync.Mutex `state:"nosave"`
+
+	// response is the unread part of the response to the last command.
+	response []byte
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *tpmFD) Release(context.Context) {
+	fd.backend.release()
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *tpmFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.mu.Lock()
+	if len(fd.response) == 0 {
+		fd.response = nil
+		fd.mu.Unlock()
+		// Compare drivers/char/tpm/tpm-dev-common.c:tpm_common_read().
+		return 0, nil
+	}
+	n, err := dst.CopyOut(ctx, fd.response)
+	fd.response = fd.response[n:]
+	done := len(fd.response) == 0
+	if done {
+		fd.response = nil
+	}
+	fd.mu.Unlock()
+	if done {
+		fd.queue.Notify(waiter.WritableEvents)
+	}
+	return int64(n), err
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+//
+// Commands are executed synchronously, so that their response is available
+// when Write returns.
+func (fd *tpmFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	// Compare drivers/char/tpm/tpm-dev-common.c:tpm_common_write().
+	size := src.NumBytes()
+	if size > maxBufferSize {
+		return 0, linuxerr.E2BIG
+	}
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.response != nil {
+		return 0, linuxerr.EBUSY
+	}
+	cmd := make([]byte, size)
+	if _, err := src.CopyIn(ctx, cmd); err != nil {
+		return 0, err
+	}
+	if len(cmd) < headerSize || binary.BigEndian.Uint32(cmd[2:]) != uint32(len(cmd)) {
+		return 0, linuxerr.EINVAL
+	}
+	rsp, err := fd.backend.execute(ctx, cmd)
+	if err != nil {
+		return 0, err
+	}
+	fd.response = rsp
+	fd.queue.Notify(waiter.ReadableEvents)
+	return size, nil
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *tpmFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.response != nil {
+		return mask & waiter.ReadableEvents
+	}
+	return mask & waiter.WritableEvents
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *tpmFD) EventRegister(e *waiter.Entry) error {
+	fd.queue.EventRegister(e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *tpmFD) EventUnregister(e *waiter.Entry) {
+	fd.queue.EventUnregister(e)
+}
+
+// Epollable implements vfs.FileDescriptionImpl.Epollable.
+func (fd *tpmFD) Epollable() bool {
+	return true
+}
+
+// Register registers /dev/tpmrm0 with the given major device number. If
+// emulated is true, commands are executed by a software TPM; otherwise, they
+// are proxied to the host's /dev/tpmrm0.
+func Register(vfsObj *vfs.VirtualFilesystem, major uint32, emulated bool) error {
+	dev := &tpmDevice{}
+	if emulated {
+		dev.soft = newSoftTPM()
+	}
+	return vfsObj.RegisterDevice(vfs.CharDevice, major, tpmrmDevMinor, dev, &vfs.RegisterDeviceOptions{
+		GroupName: "tpmrm",
+	})
+}
+
+// CreateDevtmpfsFile creates the device special file for /dev/tpmrm0.
+func CreateDevtmpfsFile(ctx context.Context, dev *devtmpfs.Accessor, major uint32) error {
+	return dev.CreateDeviceFile(ctx, "tpmrm0", vfs.CharDevice, major, tpmrmDevMinor, 0660 /* mode */)
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmdev
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+)
+
+// command returns a command with the given tag, command code and body.
+func command(tag uint16, cc uint32, body ...[]byte) []byte {
+	cmd := binary.BigEndian.AppendUint16(nil, tag)
+	cmd = binary.BigEndian.AppendUint32(cmd, 0)
+	cmd = binary.BigEndian.AppendUint32(cmd, cc)
+	for _, b := range body {
+		cmd = append(cmd, b...)
+	}
+	binary.BigEndian.PutUint32(cmd[2:], uint32(len(cmd)))
+	return cmd
+}
+
+func u8(v uint8) []byte {
+	return []byte{v}
+}
+
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// execute executes cmd on tpm, checks that the response is well-formed and has
+// the given response code, and returns its body.
+func execute(t *testing.T, tpm *softTPM, cmd []byte, wantRC uint32) []byte {
+	t.Helper()
+	rsp, err := tpm.execute(contexttest.Context(t), cmd)
+	if err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if len(rsp) < headerSize || binary.BigEndian.Uint32(rsp[2:]) != uint32(len(rsp)) {
+		t.Fatalf("malformed response %x", rsp)
+	}
+	if rc := binary.BigEndian.Uint32(rsp[6:]); rc != wantRC {
+		t.Fatalf("got response code %#x, want %#x", rc, wantRC)
+	}
+	return rsp[headerSize:]
+}
+
+// readPCR returns the value of the given SHA-256 PCR.
+func readPCR(t *testing.T, tpm *softTPM, pcr int) []byte {
+	t.Helper()
+	bitmap := make([]byte, pcrSelectSize)
+	bitmap[pcr/8] = 1 << (pcr % 8)
+	body := execute(t, tpm, command(stNoSessions, ccPCRRead, u32(1), u16(algSHA256), u8(pcrSelectSize), bitmap), rcSuccess)
+	// Skip pcrUpdateCounter and pcrSelectionOut.
+	body = body[4+4+2+1+pcrSelectSize:]
+	if got := binary.BigEndian.Uint32(body); got != 1 {
+		t.Fatalf("got %d digests, want 1", got)
+	}
+	return body[4+2:]
+}
+
+func TestSoftTPMPCRExtend(t *testing.T) {
+	tpm := newSoftTPM()
+	if got, want := readPCR(t, tpm, 10), make([]byte, sha256.Size); !bytes.Equal(got, want) {
+		t.Errorf("initial PCR 10 = %x, want %x", got, want)
+	}
+
+	digest := sha256.Sum256([]byte("measurement"))
+	auth := bytes.Join([][]byte{u32(rsPW), u16(0), u8(sessionContinue), u16(0)}, nil)
+	extend := command(stSessions, ccPCRExtend, u32(10), u32(uint32(len(auth))), auth, u32(1), u16(algSHA256), digest[:])
+	execute(t, tpm, extend, rcSuccess)
+
+	want := sha256.Sum256(append(make([]byte, sha256.Size), digest[:]...))
+	if got := readPCR(t, tpm, 10); !bytes.Equal(got, want[:]) {
+		t.Errorf("extended PCR 10 = %x, want %x", got, want)
+	}
+
+	// PCR 17 can't be extended from locality 0.
+	extend = command(stSessions, ccPCRExtend, u32(17), u32(uint32(len(auth))), auth, u32(1), u16(algSHA256), digest[:])
+	execute(t, tpm, extend, rcLocality)
+
+	// PCR_Extend requires authorization.
+	execute(t, tpm, command(stNoSessions, ccPCRExtend, u32(10), u32(1), u16(algSHA256), digest[:]), rcAuthMissing)
+}
+
+func TestSoftTPMGetRandom(t *testing.T) {
+	tpm := newSoftTPM()
+	body := execute(t, tpm, command(stNoSessions, ccGetRandom, u16(1000)), rcSuccess)
+	if got := binary.BigEndian.Uint16(body); got != sha256.Size {
+		t.Errorf("got %d random bytes, want %d", got, sha256.Size)
+	}
+}
+
+func TestSoftTPMUnsupported(t *testing.T) {
+	tpm := newSoftTPM()
+	execute(t, tpm, command(stNoSessions, ccStartup, u16(0)), rcInitialize)
+	execute(t, tpm, command(stNoSessions, ccCreatePrimary), rcCommandCode)
+	execute(t, tpm, command(stNoSessions, ccGetRandom), rcSize)
+}
+
+func TestHostCommands(t *testing.T) {
+	for _, cc := range []uint32{ccGetRandom, ccPCRRead, ccCreatePrimary, ccUnseal, ccQuote} {
+		if _, ok := hostCommands[cc]; !ok {
+			t.Errorf("command %#x is not proxied to the host", cc)
+		}
+	}
+	for _, cc := range []uint32{ccClear, ccEvictControl, ccNVDefineSpace, ccNVWrite, ccPCRExtend, ccPCRReset, ccHierarchyChangeAuth, ccShutdown} {
+		if _, ok := hostCommands[cc]; ok {
+			t.Errorf("command %#x is proxied to the host", cc)
+		}
+	}
+}
@@ -98,7 +98,24 @@ func (fd *tunFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args
 		if err != nil {
 			return 0, err
 		}
-		return 0, fd.device.SetIff(stack.Stack, req.Name(), flags)
+		return 0, fd.device.SetIff(t, stack.Stack, req.Name(), flags)
+
+	case linux.TUNSETQUEUE:
+		var req linux.IFReq
+		if _, err := req.CopyIn(t, data); err != nil {
+			return 0, err
+		}
+		switch flags := hostarch.ByteOrder.Uint16(req.Data[:]); flags {
+		case linux.IFF_ATTACH_QUEUE:
+			if !t.HasCapability(linux.CAP_NET_ADMIN) {
+				return 0, linuxerr.EPERM
+			}
+			return 0, fd.device.SetQueue(true /* attach */)
+		case linux.IFF_DETACH_QUEUE:
+			return 0, fd.device.SetQueue(false /* attach */)
+		default:
+			return 0, linuxerr.EINVAL
+		}
 
 	case linux.TUNGETIFF:
 		var req linux.IFReq
@@ -149,11 +166,11 @@ func (fd *tunFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.Wri
 	if src.NumBytes() == 0 {
 		return 0, unix.EINVAL
 	}
-	mtu, err := fd.device.MTU()
+	maxSize, err := fd.device.MaxWriteSize()
 	if err != nil {
 		return 0, err
 	}
-	if int64(mtu) < src.NumBytes() {
+	if maxSize < src.NumBytes() {
 		return 0, unix.EMSGSIZE
 	}
 	data := buffer.NewView(int(src.NumBytes()))
@@ -0,0 +1,307 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfiodev
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/cleanup"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// containerDevice implements vfs.Device for /dev/vfio/vfio.
+//
+// +stateify savable
+type containerDevice struct{}
+
+// Open implements vfs.Device.Open.
+func (containerDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	hostFD, err := openHost(ctx, containerHostPath)
+	if err != nil {
+		return nil, err
+	}
+	fd := &containerFD{
+		c: &container{
+			hostFD:   hostFD,
+			refs:     1,
+			mappings: make(map[uint64]*dmaMapping),
+		},
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(int(hostFD))
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// container is a host VFIO container.
+type container struct {
+	// hostFD is the host container file descriptor. hostFD is immutable.
+	hostFD int32
+
+	mu sync.Mutex
+
+	// refs is the number of containerFDs, and of groupFDs and deviceFDs
+	// whose host file descriptors refer to the container.
+	//
+	// +checklocks:mu
+	refs int
+
+	// mappings maps the IOVA of each DMA mapping to the application memory
+	// backing it.
+	//
+	// +checklocks:mu
+	mappings map[uint64]*dmaMapping
+}
+
+func (c *container) incRef() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refs++
+}
+
+func (c *container) decRef() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refs--
+	if c.refs != 0 {
+		return
+	}
+	// Application memory may only be unpinned once the host container has
+	// been destroyed, which happens when the last host file descriptor
+	// referring to it is closed; otherwise devices could access whatever the
+	// sentry later allocates in the same memory.
+	unix.Close(int(c.hostFD))
+	for iova, dm := range c.mappings {
+		log.Infof("vfiodev: audit: DMA unmap iova=[%#x, %#x) on container release", iova, iova+uint64(dm.appAR.Length()))
+		dm.release()
+		delete(c.mappings, iova)
+	}
+}
+
+// dmaMapping is an IOMMU mapping of application memory.
+type dmaMapping struct {
+	// appAR is the application address range that was mapped.
+	appAR hostarch.AddrRange
+
+	// mirror is the address of a mapping of appAR's memory in the sentry's
+	// address space, from which the host IOMMU driver pins it.
+	mirror uintptr
+
+	// prs are the pinned ranges of application memory mapped at mirror.
+	prs []mm.PinnedRange
+}
+
+// newDMAMapping pins the application memory in appAR and maps it into a new
+// range of the sentry's address space.
+func newDMAMapping(t *kernel.Task, appAR hostarch.AddrRange, at hostarch.AccessType) (*dmaMapping, error) {
+	// Reserve a range in our address space.
+	m, _, errno := unix.RawSyscall6(unix.SYS_MMAP, 0 /* addr */, uintptr(appAR.Length()), unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS, ^uintptr(0) /* fd */, 0 /* offset */)
+	if errno != 0 {
+		return nil, errno
+	}
+	cu := cleanup.Make(func() {
+		unix.RawSyscall(unix.SYS_MUNMAP, m, uintptr(appAR.Length()), 0)
+	})
+	defer cu.Clean()
+	// Mirror application mappings into the reserved range.
+	prs, err := t.MemoryManager().Pin(t, appAR, at, false /* ignorePermissions */)
+	cu.Add(func() {
+		mm.Unpin(prs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sentryAddr := uintptr(m)
+	for _, pr := range prs {
+		ims, err := pr.File.MapInternal(memmap.FileRange{pr.Offset, pr.Offset + uint64(pr.Source.Length())}, at)
+		if err != nil {
+			return nil, err
+		}
+		for !ims.IsEmpty() {
+			im := ims.Head()
+			if _, _, errno := unix.RawSyscall6(unix.SYS_MREMAP, im.Addr(), 0 /* old_size */, uintptr(im.Len()), linux.MREMAP_MAYMOVE|linux.MREMAP_FIXED, sentryAddr, 0); errno != 0 {
+				return nil, errno
+			}
+			sentryAddr += uintptr(im.Len())
+			ims = ims.Tail()
+		}
+	}
+	cu.Release()
+	return &dmaMapping{
+		appAR:  appAR,
+		mirror: m,
+		prs:    prs,
+	}, nil
+}
+
+// release unmaps and unpins the mapping's memory.
+func (dm *dmaMapping) release() {
+	unix.RawSyscall(unix.SYS_MUNMAP, dm.mirror, uintptr(dm.appAR.Length()), 0)
+	mm.Unpin(dm.prs)
+}
+
+// containerFD implements vfs.FileDescriptionImpl for /dev/vfio/vfio.
+//
+// containerFD is not savable; we do not implement save/restore of VFIO state.
+type containerFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	c *container
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *containerFD) Release(context.Context) {
+	fd.c.decRef()
+}
+
+// hiddenExtensions are VFIO extensions that are reported as unsupported.
+// Only type1 IOMMUs are supported, and VFIO_NOIOMMU_IOMMU would allow devices
+// to access arbitrary host memory.
+var hiddenExtensions = map[uint64]struct{}{
+	linux.VFIO_SPAPR_TCE_IOMMU:     {},
+	linux.VFIO_EEH:                 {},
+	linux.VFIO_TYPE1_NESTING_IOMMU: {},
+	linux.VFIO_SPAPR_TCE_v2_IOMMU:  {},
+	linux.VFIO_NOIOMMU_IOMMU:       {},
+	linux.VFIO_UPDATE_VADDR:        {},
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *containerFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	switch cmd := args[1].Uint(); cmd {
+	case linux.VFIO_GET_API_VERSION:
+		return ioctlInvoke(fd.c.hostFD, cmd, 0)
+	case linux.VFIO_CHECK_EXTENSION:
+		ext := args[2].Uint64()
+		if _, ok := hiddenExtensions[ext]; ok {
+			return 0, nil
+		}
+		return ioctlInvoke(fd.c.hostFD, cmd, uintptr(ext))
+	case linux.VFIO_SET_IOMMU:
+		switch iommuType := args[2].Uint64(); iommuType {
+		case linux.VFIO_TYPE1_IOMMU, linux.VFIO_TYPE1v2_IOMMU:
+			return ioctlInvoke(fd.c.hostFD, cmd, uintptr(iommuType))
+		default:
+			return 0, linuxerr.EINVAL
+		}
+	case linux.VFIO_IOMMU_GET_INFO:
+		return argszIoctl(t, fd.c.hostFD, cmd, args[2].Pointer(), nil /* fixup */)
+	case linux.VFIO_IOMMU_MAP_DMA:
+		return fd.mapDMA(t, args[2].Pointer())
+	case linux.VFIO_IOMMU_UNMAP_DMA:
+		return fd.unmapDMA(t, args[2].Pointer())
+	default:
+		t.Warningf("vfiodev: unsupported container ioctl %#x", cmd)
+		return 0, linuxerr.EINVAL
+	}
+}
+
+func (fd *containerFD) mapDMA(t *kernel.Task, addr hostarch.Addr) (uintptr, error) {
+	var dmaMap linux.VFIOIOMMUType1DMAMap
+	if _, err := dmaMap.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	if dmaMap.Argsz < linux.SizeOfVFIOIOMMUType1DMAMap || dmaMap.Flags&^(linux.VFIO_DMA_MAP_FLAG_READ|linux.VFIO_DMA_MAP_FLAG_WRITE) != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	at := hostarch.AccessType{
+		Read:  dmaMap.Flags&linux.VFIO_DMA_MAP_FLAG_READ != 0,
+		Write: dmaMap.Flags&linux.VFIO_DMA_MAP_FLAG_WRITE != 0,
+	}
+	appAR, ok := hostarch.Addr(dmaMap.Vaddr).ToRange(dmaMap.Size)
+	if !ok || appAR.Length() == 0 || !appAR.IsPageAligned() || !at.Any() {
+		return 0, linuxerr.EINVAL
+	}
+
+	c := fd.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dm, err := newDMAMapping(t, appAR, at)
+	if err != nil {
+		t.Infof("vfiodev: audit: DMA map iova=[%#x, %#x) vaddr=%#x perms=%s failed: %v", dmaMap.IOVA, dmaMap.IOVA+dmaMap.Size, dmaMap.Vaddr, at, err)
+		return 0, err
+	}
+	sentryMap := dmaMap
+	sentryMap.Argsz = linux.SizeOfVFIOIOMMUType1DMAMap
+	sentryMap.Vaddr = uint64(dm.mirror)
+	n, err := ioctlInvokePtrArg(c.hostFD, linux.VFIO_IOMMU_MAP_DMA, &sentryMap)
+	if err != nil {
+		t.Infof("vfiodev: audit: DMA map iova=[%#x, %#x) vaddr=%#x perms=%s failed: %v", dmaMap.IOVA, dmaMap.IOVA+dmaMap.Size, dmaMap.Vaddr, at, err)
+		dm.release()
+		return n, err
+	}
+	t.Infof("vfiodev: audit: DMA map iova=[%#x, %#x) vaddr=%#x perms=%s", dmaMap.IOVA, dmaMap.IOVA+dmaMap.Size, dmaMap.Vaddr, at)
+	c.mappings[dmaMap.IOVA] = dm
+	return n, nil
+}
+
+func (fd *containerFD) unmapDMA(t *kernel.Task, addr hostarch.Addr) (uintptr, error) {
+	var dmaUnmap linux.VFIOIOMMUType1DMAUnmap
+	if _, err := dmaUnmap.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	// Dirty page tracking and vaddr invalidation are not supported.
+	if dmaUnmap.Argsz < linux.SizeOfVFIOIOMMUType1DMAUnmap || dmaUnmap.Flags&^linux.VFIO_DMA_UNMAP_FLAG_ALL != 0 {
+		return 0, linuxerr.EINVAL
+	}
+
+	c := fd.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sentryUnmap := dmaUnmap
+	sentryUnmap.Argsz = linux.SizeOfVFIOIOMMUType1DMAUnmap
+	n, err := ioctlInvokePtrArg(c.hostFD, linux.VFIO_IOMMU_UNMAP_DMA, &sentryUnmap)
+	if err != nil {
+		t.Infof("vfiodev: audit: DMA unmap iova=[%#x, %#x) flags=%#x failed: %v", dmaUnmap.IOVA, dmaUnmap.IOVA+dmaUnmap.Size, dmaUnmap.Flags, err)
+		return n, err
+	}
+	// The host unmaps every mapping that intersects the requested range in
+	// its entirety, and returns the number of bytes unmapped in Size.
+	all := dmaUnmap.Flags&linux.VFIO_DMA_UNMAP_FLAG_ALL != 0
+	for iova, dm := range c.mappings {
+		end := iova + uint64(dm.appAR.Length())
+		if all || (iova < dmaUnmap.IOVA+dmaUnmap.Size && dmaUnmap.IOVA < end) {
+			t.Infof("vfiodev: audit: DMA unmap iova=[%#x, %#x) vaddr=%#x", iova, end, dm.appAR.Start)
+			dm.release()
+			delete(c.mappings, iova)
+		}
+	}
+	outUnmap := sentryUnmap
+	outUnmap.Argsz = dmaUnmap.Argsz
+	if _, err := outUnmap.CopyOut(t, addr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,354 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfiodev
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	// maxRegions is the maximum number of device regions that are tracked.
+	// PCI devices have 9 regions, plus device-specific regions.
+	maxRegions = 64
+
+	// maxIRQs is the maximum number of interrupts that can be configured by
+	// a single VFIO_DEVICE_SET_IRQS, which is the maximum number of MSI-X
+	// vectors.
+	maxIRQs = 2048
+
+	// maxRWSize is the maximum number of bytes read or written by a single
+	// pread(2) or pwrite(2) of a device region.
+	maxRWSize = 1 << 20
+)
+
+// deviceRegion is a region of a VFIO device.
+type deviceRegion struct {
+	index  uint32
+	flags  uint32
+	offset uint64
+	size   uint64
+
+	// mmapAllowed is true if the region may be mapped by the application.
+	mmapAllowed bool
+}
+
+// deviceFD implements vfs.FileDescriptionImpl for VFIO device file
+// descriptors.
+//
+// deviceFD is not savable; we do not implement save/restore of VFIO state.
+type deviceFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD    int32
+	opts      *GroupOptions
+	container *container
+
+	// regions are the device's regions. regions is immutable.
+	regions []deviceRegion
+
+	memmapFile deviceMemmapFile
+}
+
+// newDeviceFD returns a deviceFD for the host device file descriptor hostFD,
+// whose regions are queried from the host.
+func newDeviceFD(hostFD int32, opts *GroupOptions) (*deviceFD, error) {
+	info := linux.VFIODeviceInfo{
+		Argsz: linux.SizeOfVFIODeviceInfo,
+	}
+	if _, err := ioctlInvokePtrArg(hostFD, linux.VFIO_DEVICE_GET_INFO, &info); err != nil {
+		return nil, err
+	}
+	if info.NumRegions > maxRegions {
+		log.Warningf("vfiodev: device has %d regions, only tracking %d", info.NumRegions, maxRegions)
+		info.NumRegions = maxRegions
+	}
+	fd := &deviceFD{
+		hostFD: hostFD,
+		opts:   opts,
+	}
+	for i := uint32(0); i < info.NumRegions; i++ {
+		ri := linux.VFIORegionInfo{
+			Argsz: linux.SizeOfVFIORegionInfo,
+			Index: i,
+		}
+		// Optional regions, e.g. the VGA region of non-VGA PCI devices, are
+		// reported as invalid.
+		if _, err := ioctlInvokePtrArg(hostFD, linux.VFIO_DEVICE_GET_REGION_INFO, &ri); err != nil || ri.Size == 0 {
+			continue
+		}
+		fd.regions = append(fd.regions, deviceRegion{
+			index:       i,
+			flags:       ri.Flags,
+			offset:      ri.Offset,
+			size:        ri.Size,
+			mmapAllowed: ri.Flags&linux.VFIO_REGION_INFO_FLAG_MMAP != 0 && opts.mmapAllowed(i),
+		})
+	}
+	fd.memmapFile.fd = fd
+	return fd, nil
+}
+
+// regionFor returns the region containing [offset, offset+length), or nil if
+// there is no such region.
+func (fd *deviceFD) regionFor(offset, length uint64) *deviceRegion {
+	for i := range fd.regions {
+		r := &fd.regions[i]
+		if offset >= r.offset && offset-r.offset <= r.size && length <= r.size-(offset-r.offset) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (fd *deviceFD) release() {
+	unix.Close(int(fd.hostFD))
+	if fd.container != nil {
+		fd.container.decRef()
+	}
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *deviceFD) Release(context.Context) {
+	fd.release()
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *deviceFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	switch cmd := args[1].Uint(); cmd {
+	case linux.VFIO_DEVICE_GET_INFO, linux.VFIO_DEVICE_GET_IRQ_INFO, linux.VFIO_DEVICE_GET_PCI_HOT_RESET_INFO:
+		return argszIoctl(t, fd.hostFD, cmd, args[2].Pointer(), nil /* fixup */)
+	case linux.VFIO_DEVICE_GET_REGION_INFO:
+		return argszIoctl(t, fd.hostFD, cmd, args[2].Pointer(), fd.fixupRegionInfo)
+	case linux.VFIO_DEVICE_SET_IRQS:
+		return setIRQs(t, fd.hostFD, args[2].Pointer())
+	case linux.VFIO_DEVICE_RESET:
+		return ioctlInvoke(fd.hostFD, cmd, 0)
+	default:
+		t.Warningf("vfiodev: unsupported device ioctl %#x", cmd)
+		return 0, linuxerr.EINVAL
+	}
+}
+
+// fixupRegionInfo clears VFIO_REGION_INFO_FLAG_MMAP in the struct
+// vfio_region_info in buf if the region may not be mapped.
+func (fd *deviceFD) fixupRegionInfo(buf []byte) {
+	if len(buf) < linux.SizeOfVFIORegionInfo {
+		return
+	}
+	var ri linux.VFIORegionInfo
+	ri.UnmarshalUnsafe(buf)
+	for _, r := range fd.regions {
+		if r.index == ri.Index && r.mmapAllowed {
+			return
+		}
+	}
+	ri.Flags &^= linux.VFIO_REGION_INFO_FLAG_MMAP
+	ri.MarshalUnsafe(buf)
+}
+
+// setIRQs handles VFIO_DEVICE_SET_IRQS, translating eventfds to their host
+// eventfds.
+func setIRQs(t *kernel.Task, hostFD int32, addr hostarch.Addr) (uintptr, error) {
+	var irqSet linux.VFIOIRQSet
+	if _, err := irqSet.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	if irqSet.Argsz < linux.SizeOfVFIOIRQSet || irqSet.Count > maxIRQs {
+		return 0, linuxerr.EINVAL
+	}
+	var entrySize uint32
+	switch irqSet.Flags & linux.VFIO_IRQ_SET_DATA_TYPE_MASK {
+	case linux.VFIO_IRQ_SET_DATA_NONE:
+		entrySize = 0
+	case linux.VFIO_IRQ_SET_DATA_BOOL:
+		entrySize = 1
+	case linux.VFIO_IRQ_SET_DATA_EVENTFD:
+		entrySize = 4
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	size := linux.SizeOfVFIOIRQSet + irqSet.Count*entrySize
+	if irqSet.Argsz < size {
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, size)
+	if _, err := t.CopyInBytes(addr, buf); err != nil {
+		return 0, err
+	}
+	hostarch.ByteOrder.PutUint32(buf, size)
+	if entrySize == 4 {
+		for off := uint32(linux.SizeOfVFIOIRQSet); off < size; off += entrySize {
+			// -1 disables the interrupt.
+			efd := int32(hostarch.ByteOrder.Uint32(buf[off:]))
+			if efd < 0 {
+				continue
+			}
+			hostEFD, err := hostEventFD(t, efd)
+			if err != nil {
+				return 0, err
+			}
+			hostarch.ByteOrder.PutUint32(buf[off:], uint32(hostEFD))
+		}
+	}
+	return ioctlInvokeBuf(hostFD, linux.VFIO_DEVICE_SET_IRQS, buf)
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *deviceFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	size := dst.NumBytes()
+	if size > maxRWSize {
+		size = maxRWSize
+	}
+	buf := make([]byte, size)
+	n, err := unix.Pread(int(fd.hostFD), buf, offset)
+	if n <= 0 {
+		return 0, err
+	}
+	cn, cerr := dst.CopyOut(ctx, buf[:n])
+	if cerr != nil {
+		return int64(cn), cerr
+	}
+	return int64(cn), err
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *deviceFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	return 0, linuxerr.ESPIPE
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *deviceFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	size := src.NumBytes()
+	if size > maxRWSize {
+		size = maxRWSize
+	}
+	buf := make([]byte, size)
+	cn, err := src.CopyIn(ctx, buf)
+	if cn == 0 {
+		return 0, err
+	}
+	n, err := unix.Pwrite(int(fd.hostFD), buf[:cn], offset)
+	if n < 0 {
+		n = 0
+	}
+	return int64(n), err
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *deviceFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	return 0, linuxerr.ESPIPE
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *deviceFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	r := fd.regionFor(opts.Offset, opts.Length)
+	if r == nil || !r.mmapAllowed {
+		ctx.Warningf("vfiodev: rejecting mmap of device offset %#x, length %#x", opts.Offset, opts.Length)
+		return linuxerr.EPERM
+	}
+	return vfs.GenericConfigureMMap(&fd.vfsfd, fd, opts)
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (fd *deviceFD) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (fd *deviceFD) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (fd *deviceFD) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return nil
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (fd *deviceFD) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	// ConfigureMMap only allows mappings within a mappable region.
+	r := fd.regionFor(required.Start, required.Length())
+	if r == nil || !r.mmapAllowed {
+		return nil, &memmap.BusError{linuxerr.EFAULT}
+	}
+	source := optional
+	if source.Start < r.offset {
+		source.Start = r.offset
+	}
+	if source.End > r.offset+r.size {
+		source.End = r.offset + r.size
+	}
+	return []memmap.Translation{
+		{
+			Source: source,
+			File:   &fd.memmapFile,
+			Offset: source.Start,
+			Perms:  at,
+		},
+	}, nil
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (fd *deviceFD) InvalidateUnsavable(ctx context.Context) error {
+	return nil
+}
+
+// deviceMemmapFile implements memmap.File for the mappable regions of a VFIO
+// device.
+type deviceMemmapFile struct {
+	fd *deviceFD
+}
+
+// IncRef implements memmap.File.IncRef.
+func (mf *deviceMemmapFile) IncRef(memmap.FileRange, uint32) {
+}
+
+// DecRef implements memmap.File.DecRef.
+func (mf *deviceMemmapFile) DecRef(fr memmap.FileRange) {
+}
+
+// MapInternal implements memmap.File.MapInternal.
+func (mf *deviceMemmapFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (safemem.BlockSeq, error) {
+	log.Traceback("vfiodev: rejecting deviceMemmapFile.MapInternal")
+	return safemem.BlockSeq{}, linuxerr.EINVAL
+}
+
+// FD implements memmap.File.FD.
+func (mf *deviceMemmapFile) FD() int {
+	return int(mf.fd.hostFD)
+}
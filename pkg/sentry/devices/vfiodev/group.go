@@ -0,0 +1,184 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfiodev
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// maxDeviceNameLen is the maximum length of the device names passed to
+// VFIO_GROUP_GET_DEVICE_FD, e.g. PCI addresses or mediated device UUIDs.
+const maxDeviceNameLen = 256
+
+// groupDevice implements vfs.Device for /dev/vfio/<group>.
+//
+// +stateify savable
+type groupDevice struct {
+	opts GroupOptions
+}
+
+// Open implements vfs.Device.Open.
+func (dev *groupDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	hostFD, err := openHost(ctx, groupHostPath(dev.opts.Group))
+	if err != nil {
+		return nil, err
+	}
+	fd := &groupFD{
+		hostFD: hostFD,
+		dev:    dev,
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(int(hostFD))
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// groupFD implements vfs.FileDescriptionImpl for /dev/vfio/<group>.
+//
+// groupFD is not savable; we do not implement save/restore of VFIO state.
+type groupFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD int32
+	dev    *groupDevice
+
+	mu sync.Mutex
+
+	// container is the container that the group was added to with
+	// VFIO_GROUP_SET_CONTAINER, or nil if it hasn't been added to one.
+	//
+	// +checklocks:mu
+	container *container
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *groupFD) Release(context.Context) {
+	// Closing the host group removes it from the host container, so the
+	// container reference must be dropped afterward.
+	unix.Close(int(fd.hostFD))
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.container != nil {
+		fd.container.decRef()
+		fd.container = nil
+	}
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *groupFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	switch cmd := args[1].Uint(); cmd {
+	case linux.VFIO_GROUP_GET_STATUS:
+		return argszIoctl(t, fd.hostFD, cmd, args[2].Pointer(), nil /* fixup */)
+	case linux.VFIO_GROUP_SET_CONTAINER:
+		return fd.setContainer(t, args[2].Pointer())
+	case linux.VFIO_GROUP_UNSET_CONTAINER:
+		return fd.unsetContainer()
+	case linux.VFIO_GROUP_GET_DEVICE_FD:
+		return fd.getDeviceFD(t, args[2].Pointer())
+	default:
+		t.Warningf("vfiodev: unsupported group ioctl %#x", cmd)
+		return 0, linuxerr.EINVAL
+	}
+}
+
+func (fd *groupFD) setContainer(t *kernel.Task, addr hostarch.Addr) (uintptr, error) {
+	var containerFDNum primitive.Int32
+	if _, err := containerFDNum.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	file, _ := t.FDTable().Get(int32(containerFDNum))
+	if file == nil {
+		return 0, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	cfd, ok := file.Impl().(*containerFD)
+	if !ok {
+		return 0, linuxerr.EINVAL
+	}
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	hostContainerFD := cfd.c.hostFD
+	n, err := ioctlInvokePtrArg(fd.hostFD, linux.VFIO_GROUP_SET_CONTAINER, &hostContainerFD)
+	if err != nil {
+		return n, err
+	}
+	cfd.c.incRef()
+	fd.container = cfd.c
+	return n, nil
+}
+
+func (fd *groupFD) unsetContainer() (uintptr, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	n, err := ioctlInvoke(fd.hostFD, linux.VFIO_GROUP_UNSET_CONTAINER, 0)
+	if err != nil {
+		return n, err
+	}
+	if fd.container != nil {
+		fd.container.decRef()
+		fd.container = nil
+	}
+	return n, nil
+}
+
+func (fd *groupFD) getDeviceFD(t *kernel.Task, addr hostarch.Addr) (uintptr, error) {
+	name, err := t.CopyInString(addr, maxDeviceNameLen)
+	if err != nil {
+		return 0, err
+	}
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	// The host fails VFIO_GROUP_GET_DEVICE_FD for groups that haven't been
+	// added to a container with an IOMMU.
+	hostDeviceFD, err := ioctlInvokeBuf(fd.hostFD, linux.VFIO_GROUP_GET_DEVICE_FD, append([]byte(name), 0))
+	if err != nil {
+		return 0, err
+	}
+	if fd.container == nil {
+		unix.Close(int(hostDeviceFD))
+		return 0, linuxerr.EINVAL
+	}
+	dfd, err := newDeviceFD(int32(hostDeviceFD), &fd.dev.opts)
+	if err != nil {
+		unix.Close(int(hostDeviceFD))
+		return 0, err
+	}
+	// The host device holds a reference on the host group, which keeps it in
+	// its container.
+	c := fd.container
+	c.incRef()
+	dfd.container = c
+	return installAnonFD(t, &dfd.vfsfd, dfd, "vfio-device:"+name, dfd.release)
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfiodev
+
+import (
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/eventfd"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+const (
+	// maxArgsz is the maximum size of the argument buffers of ioctls that
+	// are passed through by argszIoctl. Larger buffers are truncated, in
+	// which case the host reports the required size in argsz.
+	maxArgsz = 64 << 10
+
+	// minArgszBuffer is the minimum size of the buffers passed to the host by
+	// argszIoctl. The host reads the fixed-size part of the argument before
+	// validating argsz, so buffers must be at least as large as the largest
+	// fixed-size part of a passed-through argument.
+	minArgszBuffer = 64
+)
+
+// argszIoctl invokes the ioctl cmd on hostFD, whose argument is a structure
+// beginning with a 32-bit argsz field giving its total size. The structure
+// must not contain pointers or file descriptors. If fixup is not nil, it is
+// called on the structure returned by the host before it is copied out.
+func argszIoctl(t *kernel.Task, hostFD int32, cmd uint32, addr hostarch.Addr, fixup func(buf []byte)) (uintptr, error) {
+	var argsz primitive.Uint32
+	if _, err := argsz.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	size := uint32(argsz)
+	if size < 4 {
+		return 0, linuxerr.EINVAL
+	}
+	if size > maxArgsz {
+		size = maxArgsz
+	}
+	bufLen := size
+	if bufLen < minArgszBuffer {
+		bufLen = minArgszBuffer
+	}
+	buf := make([]byte, bufLen)
+	if _, err := t.CopyInBytes(addr, buf[:size]); err != nil {
+		return 0, err
+	}
+	hostarch.ByteOrder.PutUint32(buf, size)
+	n, err := ioctlInvokeBuf(hostFD, cmd, buf)
+	if err != nil {
+		return n, err
+	}
+	if fixup != nil {
+		fixup(buf[:size])
+	}
+	// Unless the host requested a larger buffer, report the application's
+	// argsz back to it.
+	if hostarch.ByteOrder.Uint32(buf) == size {
+		hostarch.ByteOrder.PutUint32(buf, uint32(argsz))
+	}
+	if _, err := t.CopyOutBytes(addr, buf[:size]); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// hostEventFD returns the host eventfd backing the application eventfd fd.
+func hostEventFD(t *kernel.Task, fd int32) (int, error) {
+	file, _ := t.FDTable().Get(fd)
+	if file == nil {
+		return -1, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	efd, ok := file.Impl().(*eventfd.EventFileDescription)
+	if !ok {
+		return -1, linuxerr.EINVAL
+	}
+	return efd.HostFD()
+}
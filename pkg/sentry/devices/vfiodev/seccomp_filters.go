@@ -0,0 +1,84 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfiodev
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// ioctls are the VFIO ioctls invoked on host file descriptors.
+// VFIO_IOMMU_GET_INFO is equal to VFIO_DEVICE_GET_PCI_HOT_RESET_INFO.
+var ioctls = []uint32{
+	linux.VFIO_GET_API_VERSION,
+	linux.VFIO_CHECK_EXTENSION,
+	linux.VFIO_SET_IOMMU,
+	linux.VFIO_GROUP_GET_STATUS,
+	linux.VFIO_GROUP_SET_CONTAINER,
+	linux.VFIO_GROUP_UNSET_CONTAINER,
+	linux.VFIO_GROUP_GET_DEVICE_FD,
+	linux.VFIO_DEVICE_GET_INFO,
+	linux.VFIO_DEVICE_GET_REGION_INFO,
+	linux.VFIO_DEVICE_GET_IRQ_INFO,
+	linux.VFIO_DEVICE_SET_IRQS,
+	linux.VFIO_DEVICE_RESET,
+	linux.VFIO_IOMMU_GET_INFO,
+	linux.VFIO_IOMMU_MAP_DMA,
+	linux.VFIO_IOMMU_UNMAP_DMA,
+}
+
+// Filters returns seccomp-bpf filters for this package.
+func Filters() seccomp.SyscallRules {
+	nonNegativeFD := seccomp.NonNegativeFDCheck()
+	var ioctlRules seccomp.Or
+	for _, cmd := range ioctls {
+		ioctlRules = append(ioctlRules, seccomp.PerArg{
+			nonNegativeFD,
+			seccomp.EqualTo(cmd),
+		})
+	}
+	return seccomp.SyscallRules{
+		unix.SYS_OPENAT: seccomp.PerArg{
+			// All paths that we openat() are absolute, so we pass a dirfd
+			// of -1 (which is invalid for relative paths, but ignored for
+			// absolute paths) to hedge against bugs involving AT_FDCWD or
+			// real dirfds.
+			seccomp.EqualTo(^uintptr(0)),
+			seccomp.AnyValue{},
+			seccomp.MaskedEqual(unix.O_ACCMODE|unix.O_CREAT|unix.O_NOFOLLOW, unix.O_RDWR|unix.O_NOFOLLOW),
+			seccomp.AnyValue{},
+		},
+		unix.SYS_IOCTL: ioctlRules,
+		unix.SYS_EVENTFD2: seccomp.Or{
+			seccomp.PerArg{
+				seccomp.AnyValue{},
+				seccomp.EqualTo(linux.EFD_NONBLOCK),
+			},
+			seccomp.PerArg{
+				seccomp.AnyValue{},
+				seccomp.EqualTo(linux.EFD_NONBLOCK | linux.EFD_SEMAPHORE),
+			},
+		},
+		unix.SYS_MREMAP: seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(0), /* old_size */
+			seccomp.AnyValue{},
+			seccomp.EqualTo(linux.MREMAP_MAYMOVE | linux.MREMAP_FIXED),
+			seccomp.AnyValue{},
+			seccomp.EqualTo(0),
+		},
+	}
+}
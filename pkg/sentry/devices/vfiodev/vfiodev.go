@@ -0,0 +1,148 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vfiodev implements a mediated passthrough of host VFIO groups,
+// allowing user-space drivers (e.g. DPDK and SPDK) to access devices from the
+// sandbox.
+//
+// /dev/vfio/vfio and /dev/vfio/<group> are backed by the corresponding host
+// files, and only allowlisted ioctls are passed through to them. Ioctls whose
+// arguments refer to application memory or file descriptors are translated:
+// DMA mappings are mirrored into the sentry's address space, from which the
+// host IOMMU driver pins them, and eventfds are replaced by their host
+// eventfds. Only type1 IOMMUs are supported.
+//
+// Mapping of device regions is controlled per group: regions that may not be
+// mapped are reported as such by VFIO_DEVICE_GET_REGION_INFO, and can only be
+// accessed with pread(2) and pwrite(2). All DMA mappings and unmappings are
+// logged, to provide an audit trail of the application memory that devices
+// may access.
+package vfiodev
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+const (
+	containerDevMajor = linux.MISC_MAJOR
+	containerDevMinor = linux.VFIO_MINOR
+
+	// containerHostPath is the path of the host VFIO container device.
+	containerHostPath = "/dev/vfio/vfio"
+)
+
+// GroupOptions configures a host VFIO group exposed to the sandbox.
+//
+// +stateify savable
+type GroupOptions struct {
+	// Group is the IOMMU group number, as in /dev/vfio/<group>.
+	Group uint32
+
+	// MmapAllRegions is true if all device regions that the host allows to
+	// be mapped may be mapped by the application.
+	MmapAllRegions bool
+
+	// MmapRegions are the indices of the device regions that may be mapped
+	// if MmapAllRegions is false.
+	MmapRegions []uint32
+}
+
+// mmapAllowed returns true if the region with the given index may be mapped.
+func (opts *GroupOptions) mmapAllowed(index uint32) bool {
+	if opts.MmapAllRegions {
+		return true
+	}
+	for _, region := range opts.MmapRegions {
+		if region == index {
+			return true
+		}
+	}
+	return false
+}
+
+func groupHostPath(group uint32) string {
+	return fmt.Sprintf("/dev/vfio/%d", group)
+}
+
+// installAnonFD initializes vfsfd as an anonymous file description with the
+// given implementation and name, and installs it in t's file descriptor
+// table. If initialization fails, release is called to release resources
+// owned by impl.
+func installAnonFD(t *kernel.Task, vfsfd *vfs.FileDescription, impl vfs.FileDescriptionImpl, name string, release func()) (uintptr, error) {
+	vd := t.Kernel().VFS().NewAnonVirtualDentry(name)
+	defer vd.DecRef(t)
+	if err := vfsfd.Init(impl, linux.O_RDWR, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		release()
+		return 0, err
+	}
+	defer vfsfd.DecRef(t)
+	newFD, err := t.NewFDFrom(0, vfsfd, kernel.FDFlags{CloseOnExec: true})
+	if err != nil {
+		return 0, err
+	}
+	return uintptr(newFD), nil
+}
+
+// Register registers /dev/vfio/vfio, and /dev/vfio/<group> for each of the
+// given groups using groupMajor.
+func Register(vfsObj *vfs.VirtualFilesystem, groupMajor uint32, groups []GroupOptions) error {
+	if err := vfsObj.RegisterDevice(vfs.CharDevice, containerDevMajor, containerDevMinor, containerDevice{}, &vfs.RegisterDeviceOptions{
+		GroupName: "vfio",
+	}); err != nil {
+		return err
+	}
+	for i := range groups {
+		if err := vfsObj.RegisterDevice(vfs.CharDevice, groupMajor, groups[i].Group, &groupDevice{
+			opts: groups[i],
+		}, &vfs.RegisterDeviceOptions{
+			GroupName: "vfio-group",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateDevtmpfsFiles creates the device special files for /dev/vfio/vfio and
+// /dev/vfio/<group> for each of the given groups.
+func CreateDevtmpfsFiles(ctx context.Context, dev *devtmpfs.Accessor, groupMajor uint32, groups []GroupOptions) error {
+	if err := dev.CreateDeviceFile(ctx, "vfio/vfio", vfs.CharDevice, containerDevMajor, containerDevMinor, 0666 /* mode */); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if err := dev.CreateDeviceFile(ctx, fmt.Sprintf("vfio/%d", group.Group), vfs.CharDevice, groupMajor, group.Group, 0666 /* mode */); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openHost opens the host file at path for reading and writing.
+func openHost(ctx context.Context, path string) (int32, error) {
+	hostFD, err := unix.Openat(-1, path, unix.O_RDWR|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		ctx.Warningf("vfiodev: failed to open host %s: %v", path, err)
+		return -1, err
+	}
+	return int32(hostFD), nil
+}
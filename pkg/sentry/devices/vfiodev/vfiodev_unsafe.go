@@ -0,0 +1,45 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfiodev
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func ioctlInvoke(hostFD int32, cmd uint32, arg uintptr) (uintptr, error) {
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), arg)
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
+
+func ioctlInvokePtrArg[Params any](hostFD int32, cmd uint32, params *Params) (uintptr, error) {
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), uintptr(unsafe.Pointer(params)))
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
+
+func ioctlInvokeBuf(hostFD int32, cmd uint32, buf []byte) (uintptr, error) {
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
@@ -53,7 +53,8 @@ func Import(ctx context.Context, fdTable *kernel.FDTable, console bool, uid auth
 	var ttyFile *vfs.FileDescription
 	for appFD, hostFD := range fds {
 		fdOpts := host.NewFDOptions{
-			Savable: true,
+			Savable:    true,
+			AsyncWrite: true,
 		}
 		if uid != auth.NoID || gid != auth.NoID {
 			fdOpts.VirtualOwner = true
@@ -0,0 +1,109 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bpffd implements the file descriptions that represent eBPF maps and
+// programs created by bpf(2).
+package bpffd
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/ebpf"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// MapFileDescription implements vfs.FileDescriptionImpl for an eBPF map.
+//
+// +stateify savable
+type MapFileDescription struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	// Map is the map represented by this file description. Map is immutable.
+	Map ebpf.Map
+}
+
+var _ vfs.FileDescriptionImpl = (*MapFileDescription)(nil)
+
+// NewMap returns a new file description for m.
+func NewMap(ctx context.Context, vfsObj *vfs.VirtualFilesystem, m ebpf.Map, flags uint32) (*vfs.FileDescription, error) {
+	vd := vfsObj.NewAnonVirtualDentry("bpf-map")
+	defer vd.DecRef(ctx)
+	fd := &MapFileDescription{Map: m}
+	if err := fd.vfsfd.Init(fd, flags, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *MapFileDescription) Release(context.Context) {}
+
+// ProgramFileDescription implements vfs.FileDescriptionImpl for an eBPF
+// program.
+//
+// +stateify savable
+type ProgramFileDescription struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	// Program is the program represented by this file description. Program
+	// is immutable.
+	Program *ebpf.Program
+}
+
+var _ vfs.FileDescriptionImpl = (*ProgramFileDescription)(nil)
+
+// NewProgram returns a new file description for p.
+func NewProgram(ctx context.Context, vfsObj *vfs.VirtualFilesystem, p *ebpf.Program, flags uint32) (*vfs.FileDescription, error) {
+	vd := vfsObj.NewAnonVirtualDentry("bpf-prog")
+	defer vd.DecRef(ctx)
+	fd := &ProgramFileDescription{Program: p}
+	if err := fd.vfsfd.Init(fd, flags, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *ProgramFileDescription) Release(context.Context) {}
+
+// ProgramFromFD returns the program represented by fd, or nil if fd doesn't
+// represent a program.
+func ProgramFromFD(fd *vfs.FileDescription) *ebpf.Program {
+	if pfd, ok := fd.Impl().(*ProgramFileDescription); ok {
+		return pfd.Program
+	}
+	return nil
+}
+
+// MapFromFD returns the map represented by fd, or nil if fd doesn't represent
+// a map.
+func MapFromFD(fd *vfs.FileDescription) ebpf.Map {
+	if mfd, ok := fd.Impl().(*MapFileDescription); ok {
+		return mfd.Map
+	}
+	return nil
+}
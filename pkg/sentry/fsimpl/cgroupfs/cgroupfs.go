@@ -189,6 +189,35 @@ func (fs *filesystem) RootCgroup() kernel.Cgroup {
 	}
 }
 
+// CreateCgroup implements kernel.cgroupFS.CreateCgroup.
+func (fs *filesystem) CreateCgroup(ctx context.Context, p fspath.Path) error {
+	vfsObj := fs.VFSFilesystem().VirtualFilesystem()
+	creds := auth.CredentialsFromContext(ctx)
+	d := fs.root
+	d.IncRef()
+	defer func() { d.DecRef(ctx) }()
+	for pit := p.Begin; pit.Ok(); pit = pit.Next() {
+		name := pit.String()
+		if name == "." || name == ".." {
+			return linuxerr.EINVAL
+		}
+		cgi, ok := d.Inode().(*cgroupInode)
+		if !ok {
+			return linuxerr.ENOTDIR
+		}
+		if _, err := cgi.newDirWithOwner(ctx, creds, name, vfs.MkdirOptions{Mode: defaultDirMode}); err != nil && !linuxerr.Equals(linuxerr.EEXIST, err) {
+			return err
+		}
+		next, err := d.WalkDentryTree(ctx, vfsObj, fspath.Parse(name))
+		if err != nil {
+			return err
+		}
+		d.DecRef(ctx)
+		d = next
+	}
+	return nil
+}
+
 // Name implements vfs.FilesystemType.Name.
 func (FilesystemType) Name() string {
 	return Name
@@ -341,7 +370,7 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		var c controller
 		switch ty {
 		case kernel.CgroupControllerCPU:
-			c = newCPUController(fs, defaults)
+			c = newCPUController(k, fs, defaults)
 		case kernel.CgroupControllerCPUAcct:
 			c = newCPUAcctController(fs)
 		case kernel.CgroupControllerCPUSet:
@@ -15,22 +15,39 @@
 package cgroupfs
 
 import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Limits on CFS bandwidth control parameters, from Linux's
+// kernel/sched/core.c.
+const (
+	minCFSPeriod = time.Millisecond
+	maxCFSPeriod = time.Second
+	minCFSQuota  = time.Millisecond
 )
 
 // +stateify savable
 type cpuController struct {
 	controllerCommon
-	controllerStateless
 	controllerNoResource
 
-	// CFS bandwidth control parameters, values in microseconds.
-	cfsPeriod atomicbitops.Int64
-	cfsQuota  atomicbitops.Int64
+	// bandwidth is the CFS bandwidth limit, set through cpu.cfs_quota_us and
+	// cpu.cfs_period_us, or cpu.max.
+	bandwidth *kernel.CgroupCPUBandwidth
 
 	// CPU shares, values should be (num core * 1024).
 	shares atomicbitops.Int64
@@ -38,26 +55,27 @@ type cpuController struct {
 
 var _ controller = (*cpuController)(nil)
 
-func newCPUController(fs *filesystem, defaults map[string]int64) *cpuController {
+func newCPUController(k *kernel.Kernel, fs *filesystem, defaults map[string]int64) *cpuController {
 	// Default values for controller parameters from Linux.
+	period := int64(100000)
+	quota := int64(-1)
 	c := &cpuController{
-		cfsPeriod: atomicbitops.FromInt64(100000),
-		cfsQuota:  atomicbitops.FromInt64(-1),
-		shares:    atomicbitops.FromInt64(1024),
+		shares: atomicbitops.FromInt64(1024),
 	}
 
 	if val, ok := defaults["cpu.cfs_period_us"]; ok {
-		c.cfsPeriod = atomicbitops.FromInt64(val)
+		period = val
 		delete(defaults, "cpu.cfs_period_us")
 	}
 	if val, ok := defaults["cpu.cfs_quota_us"]; ok {
-		c.cfsQuota = atomicbitops.FromInt64(val)
+		quota = val
 		delete(defaults, "cpu.cfs_quota_us")
 	}
 	if val, ok := defaults["cpu.shares"]; ok {
 		c.shares = atomicbitops.FromInt64(val)
 		delete(defaults, "cpu.shares")
 	}
+	c.bandwidth = k.NewCgroupCPUBandwidth(time.Duration(quota)*time.Microsecond, time.Duration(period)*time.Microsecond)
 
 	c.controllerCommon.init(kernel.CgroupControllerCPU, fs)
 	return c
@@ -66,8 +84,7 @@ func newCPUController(fs *filesystem, defaults map[string]int64) *cpuController
 // Clone implements controller.Clone.
 func (c *cpuController) Clone() controller {
 	new := &cpuController{
-		cfsPeriod: atomicbitops.FromInt64(c.cfsPeriod.Load()),
-		cfsQuota:  atomicbitops.FromInt64(c.cfsQuota.Load()),
+		bandwidth: c.bandwidth.NewChild(),
 		shares:    atomicbitops.FromInt64(c.shares.Load()),
 	}
 	new.controllerCommon.cloneFromParent(c)
@@ -76,7 +93,186 @@ func (c *cpuController) Clone() controller {
 
 // AddControlFiles implements controller.AddControlFiles.
 func (c *cpuController) AddControlFiles(ctx context.Context, creds *auth.Credentials, _ *cgroupInode, contents map[string]kernfs.Inode) {
-	contents["cpu.cfs_period_us"] = c.fs.newStubControllerFile(ctx, creds, &c.cfsPeriod, true)
-	contents["cpu.cfs_quota_us"] = c.fs.newStubControllerFile(ctx, creds, &c.cfsQuota, true)
+	contents["cpu.cfs_period_us"] = c.fs.newControllerWritableFile(ctx, creds, &cpuCFSPeriodData{c: c}, true)
+	contents["cpu.cfs_quota_us"] = c.fs.newControllerWritableFile(ctx, creds, &cpuCFSQuotaData{c: c}, true)
 	contents["cpu.shares"] = c.fs.newStubControllerFile(ctx, creds, &c.shares, true)
+	contents["cpu.stat"] = c.fs.newControllerFile(ctx, creds, &cpuStatData{c: c}, true)
+	// cpu.max is the cgroup v2 interface to CFS bandwidth control, provided
+	// for applications that only support cgroup v2.
+	contents["cpu.max"] = c.fs.newControllerWritableFile(ctx, creds, &cpuMaxData{c: c}, true)
+}
+
+// Enter implements controller.Enter.
+func (c *cpuController) Enter(t *kernel.Task) {
+	t.SetCgroupCPUBandwidth(c.bandwidth)
+}
+
+// Leave implements controller.Leave.
+func (c *cpuController) Leave(t *kernel.Task) {
+	t.SetCgroupCPUBandwidth(nil)
+}
+
+// PrepareMigrate implements controller.PrepareMigrate.
+func (c *cpuController) PrepareMigrate(t *kernel.Task, src controller) error {
+	return nil
+}
+
+// CommitMigrate implements controller.CommitMigrate.
+func (c *cpuController) CommitMigrate(t *kernel.Task, src controller) {
+	t.SetCgroupCPUBandwidth(c.bandwidth)
+}
+
+// AbortMigrate implements controller.AbortMigrate.
+func (c *cpuController) AbortMigrate(t *kernel.Task, src controller) {}
+
+// setBandwidth validates and sets the CFS bandwidth limit. A negative quota
+// is unlimited.
+func (c *cpuController) setBandwidth(quota, period time.Duration) error {
+	if period < minCFSPeriod || period > maxCFSPeriod {
+		return linuxerr.EINVAL
+	}
+	if quota >= 0 && quota < minCFSQuota {
+		return linuxerr.EINVAL
+	}
+	return c.bandwidth.SetLimit(quota, period)
+}
+
+// +stateify savable
+type cpuCFSPeriodData struct {
+	c *cpuController
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *cpuCFSPeriodData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	_, period := d.c.bandwidth.Limit()
+	fmt.Fprintf(buf, "%d\n", period.Microseconds())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *cpuCFSPeriodData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	return d.WriteBackground(ctx, src)
+}
+
+// WriteBackground implements writableControllerFileImpl.WriteBackground.
+func (d *cpuCFSPeriodData) WriteBackground(ctx context.Context, src usermem.IOSequence) (int64, error) {
+	val, n, err := parseInt64FromString(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	quota, _ := d.c.bandwidth.Limit()
+	if err := d.c.setBandwidth(quota, time.Duration(val)*time.Microsecond); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// +stateify savable
+type cpuCFSQuotaData struct {
+	c *cpuController
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *cpuCFSQuotaData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	quota, _ := d.c.bandwidth.Limit()
+	if quota < 0 {
+		fmt.Fprintf(buf, "-1\n")
+	} else {
+		fmt.Fprintf(buf, "%d\n", quota.Microseconds())
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *cpuCFSQuotaData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	return d.WriteBackground(ctx, src)
+}
+
+// WriteBackground implements writableControllerFileImpl.WriteBackground.
+func (d *cpuCFSQuotaData) WriteBackground(ctx context.Context, src usermem.IOSequence) (int64, error) {
+	val, n, err := parseInt64FromString(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	quota := time.Duration(-1)
+	if val >= 0 {
+		quota = time.Duration(val) * time.Microsecond
+	}
+	_, period := d.c.bandwidth.Limit()
+	if err := d.c.setBandwidth(quota, period); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// +stateify savable
+type cpuMaxData struct {
+	c *cpuController
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *cpuMaxData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	quota, period := d.c.bandwidth.Limit()
+	if quota < 0 {
+		fmt.Fprintf(buf, "max %d\n", period.Microseconds())
+	} else {
+		fmt.Fprintf(buf, "%d %d\n", quota.Microseconds(), period.Microseconds())
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *cpuMaxData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	return d.WriteBackground(ctx, src)
+}
+
+// WriteBackground implements writableControllerFileImpl.WriteBackground.
+//
+// The format is "$MAX $PERIOD", where $MAX is either a quota in microseconds
+// or "max", and $PERIOD is optional.
+func (d *cpuMaxData) WriteBackground(ctx context.Context, src usermem.IOSequence) (int64, error) {
+	buf := copyScratchBufferFromContext(ctx, hostarch.PageSize)
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(buf[:n]))
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, linuxerr.EINVAL
+	}
+	quota, period := d.c.bandwidth.Limit()
+	if fields[0] == "max" {
+		quota = -1
+	} else {
+		val, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || val < 0 {
+			return 0, linuxerr.EINVAL
+		}
+		quota = time.Duration(val) * time.Microsecond
+	}
+	if len(fields) == 2 {
+		val, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, linuxerr.EINVAL
+		}
+		period = time.Duration(val) * time.Microsecond
+	}
+	if err := d.c.setBandwidth(quota, period); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// +stateify savable
+type cpuStatData struct {
+	c *cpuController
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *cpuStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	_, nrPeriods, nrThrottled, throttledTime := d.c.bandwidth.Stats()
+	fmt.Fprintf(buf, "nr_periods %d\n", nrPeriods)
+	fmt.Fprintf(buf, "nr_throttled %d\n", nrThrottled)
+	fmt.Fprintf(buf, "throttled_time %d\n", throttledTime.Nanoseconds())
+	return nil
 }
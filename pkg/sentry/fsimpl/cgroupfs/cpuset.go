@@ -52,13 +52,14 @@ func newCPUSetController(k *kernel.Kernel, fs *filesystem) *cpusetController {
 	cores := uint32(k.ApplicationCores())
 	cpus := bitmap.New(cores)
 	cpus.FlipRange(0, cores)
-	mems := bitmap.New(1)
-	mems.FlipRange(0, 1)
+	nodes := uint32(k.CPUTopology().NUMANodes)
+	mems := bitmap.New(nodes)
+	mems.FlipRange(0, nodes)
 	c := &cpusetController{
 		cpus:    &cpus,
 		mems:    &mems,
 		maxCpus: uint32(k.ApplicationCores()),
-		maxMems: 1, // We always report a single NUMA node.
+		maxMems: nodes,
 	}
 	c.controllerCommon.init(kernel.CgroupControllerCPUSet, fs)
 	return c
@@ -18,14 +18,20 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
 )
 
 // +stateify savable
@@ -33,11 +39,14 @@ type memoryController struct {
 	controllerCommon
 	controllerNoResource
 
-	limitBytes            atomicbitops.Int64
 	softLimitBytes        atomicbitops.Int64
 	moveChargeAtImmigrate atomicbitops.Int64
 	pressureLevel         int64
 
+	// limit holds the memory limits, set through memory.limit_in_bytes, or
+	// memory.max and memory.high.
+	limit *kernel.CgroupMemoryLimit
+
 	// memCg is the memory cgroup for this controller.
 	memCg *memoryCgroup
 }
@@ -50,7 +59,6 @@ func newMemoryController(fs *filesystem, defaults map[string]int64) *memoryContr
 		// which is ~ 2**63 on a 64-bit system. So essentially, inifinity. The
 		// exact value isn't very important.
 
-		limitBytes:     atomicbitops.FromInt64(math.MaxInt64),
 		softLimitBytes: atomicbitops.FromInt64(math.MaxInt64),
 	}
 
@@ -61,9 +69,11 @@ func newMemoryController(fs *filesystem, defaults map[string]int64) *memoryContr
 		}
 	}
 
-	consumeDefault("memory.limit_in_bytes", &c.limitBytes)
+	limitBytes := atomicbitops.FromInt64(kernel.CgroupMemoryUnlimited)
+	consumeDefault("memory.limit_in_bytes", &limitBytes)
 	consumeDefault("memory.soft_limit_in_bytes", &c.softLimitBytes)
 	consumeDefault("memory.move_charge_at_immigrate", &c.moveChargeAtImmigrate)
+	c.limit = kernel.NewCgroupMemoryLimit(nil, c, limitBytes.Load())
 
 	c.controllerCommon.init(kernel.CgroupControllerMemory, fs)
 	return c
@@ -72,10 +82,10 @@ func newMemoryController(fs *filesystem, defaults map[string]int64) *memoryContr
 // Clone implements controller.Clone.
 func (c *memoryController) Clone() controller {
 	new := &memoryController{
-		limitBytes:            atomicbitops.FromInt64(c.limitBytes.Load()),
 		softLimitBytes:        atomicbitops.FromInt64(c.softLimitBytes.Load()),
 		moveChargeAtImmigrate: atomicbitops.FromInt64(c.moveChargeAtImmigrate.Load()),
 	}
+	new.limit = kernel.NewCgroupMemoryLimit(c.limit, new, c.limit.Max())
 	new.controllerCommon.cloneFromParent(c)
 	return new
 }
@@ -84,22 +94,31 @@ func (c *memoryController) Clone() controller {
 func (c *memoryController) AddControlFiles(ctx context.Context, creds *auth.Credentials, cg *cgroupInode, contents map[string]kernfs.Inode) {
 	c.memCg = &memoryCgroup{cg}
 	contents["memory.usage_in_bytes"] = c.fs.newControllerFile(ctx, creds, &memoryUsageInBytesData{memCg: &memoryCgroup{cg}}, true)
-	contents["memory.limit_in_bytes"] = c.fs.newStubControllerFile(ctx, creds, &c.limitBytes, true)
+	contents["memory.stat"] = c.fs.newControllerFile(ctx, creds, &memoryStatData{memCg: &memoryCgroup{cg}}, true)
+	contents["memory.limit_in_bytes"] = c.fs.newControllerWritableFile(ctx, creds, &memoryLimitData{c: c}, true)
 	contents["memory.soft_limit_in_bytes"] = c.fs.newStubControllerFile(ctx, creds, &c.softLimitBytes, true)
 	contents["memory.move_charge_at_immigrate"] = c.fs.newStubControllerFile(ctx, creds, &c.moveChargeAtImmigrate, true)
 	contents["memory.pressure_level"] = c.fs.newStaticControllerFile(ctx, creds, linux.FileMode(0644), fmt.Sprintf("%d\n", c.pressureLevel))
+	// memory.max, memory.high and memory.events are the cgroup v2 interface
+	// to memory limits, provided for applications that only support cgroup
+	// v2.
+	contents["memory.max"] = c.fs.newControllerWritableFile(ctx, creds, &memoryLimitData{c: c, v2: true}, true)
+	contents["memory.high"] = c.fs.newControllerWritableFile(ctx, creds, &memoryLimitData{c: c, v2: true, high: true}, true)
+	contents["memory.events"] = c.fs.newControllerFile(ctx, creds, &memoryEventsData{c: c}, true)
 }
 
 // Enter implements controller.Enter.
 func (c *memoryController) Enter(t *kernel.Task) {
 	// Update the new cgroup id for the task.
 	t.SetMemCgID(c.memCg.ID())
+	t.SetCgroupMemoryLimit(c.limit)
 }
 
 // Leave implements controller.Leave.
 func (c *memoryController) Leave(t *kernel.Task) {
 	// Update the cgroup id for the task to zero.
 	t.SetMemCgID(0)
+	t.SetCgroupMemoryLimit(nil)
 }
 
 // PrepareMigrate implements controller.PrepareMigrate.
@@ -111,11 +130,22 @@ func (c *memoryController) PrepareMigrate(t *kernel.Task, src controller) error
 func (c *memoryController) CommitMigrate(t *kernel.Task, src controller) {
 	// Start tracking t at dst by updating the memCgID.
 	t.SetMemCgID(c.memCg.ID())
+	t.SetCgroupMemoryLimit(c.limit)
 }
 
 // AbortMigrate implements controller.AbortMigrate.
 func (c *memoryController) AbortMigrate(t *kernel.Task, src controller) {}
 
+// ID implements kernel.CgroupMemoryUsage.ID.
+func (c *memoryController) ID() uint32 {
+	return c.memCg.ID()
+}
+
+// MemoryUsage implements kernel.CgroupMemoryUsage.MemoryUsage.
+func (c *memoryController) MemoryUsage() uint64 {
+	return c.memCg.collectMemoryUsage()
+}
+
 // +stateify savable
 type memoryCgroup struct {
 	*cgroupInode
@@ -131,6 +161,18 @@ func (memCg *memoryCgroup) collectMemoryUsage() uint64 {
 	return totalBytes
 }
 
+// collectMemoryStats returns the memory usage breakdown of memCg and all of
+// its descendants.
+func (memCg *memoryCgroup) collectMemoryStats() usage.MemoryStats {
+	stats, _ := usage.MemoryAccounting.CopyPerCg(memCg.ID())
+
+	memCg.forEachChildDir(func(d *dir) {
+		cg := memoryCgroup{d.cgi}
+		stats.Add(cg.collectMemoryStats())
+	})
+	return stats
+}
+
 // +stateify savable
 type memoryUsageInBytesData struct {
 	memCg *memoryCgroup
@@ -146,3 +188,116 @@ func (d *memoryUsageInBytesData) Generate(ctx context.Context, buf *bytes.Buffer
 	fmt.Fprintf(buf, "%d\n", totalBytes)
 	return nil
 }
+
+// memoryStatData implements memory.stat.
+//
+// +stateify savable
+type memoryStatData struct {
+	memCg *memoryCgroup
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+//
+// Unprefixed fields account for memory charged to this cgroup only, and
+// "total_" fields include descendant cgroups, as in cgroup v1.
+func (d *memoryStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	k := kernel.KernelFromContext(ctx)
+	mf := k.MemoryFile()
+	mf.UpdateUsage(d.memCg.ID())
+
+	local, _ := usage.MemoryAccounting.CopyPerCg(d.memCg.ID())
+	total := d.memCg.collectMemoryStats()
+	for _, s := range []struct {
+		prefix string
+		stats  *usage.MemoryStats
+	}{
+		{"", &local},
+		{"total_", &total},
+	} {
+		fmt.Fprintf(buf, "%scache %d\n", s.prefix, s.stats.Cache())
+		fmt.Fprintf(buf, "%srss %d\n", s.prefix, s.stats.RSS())
+		fmt.Fprintf(buf, "%sshmem %d\n", s.prefix, s.stats.Tmpfs+s.stats.Shmem)
+		fmt.Fprintf(buf, "%smapped_file %d\n", s.prefix, s.stats.Mapped)
+		fmt.Fprintf(buf, "%sstack %d\n", s.prefix, s.stats.Stack)
+	}
+	return nil
+}
+
+// memoryLimitData implements memory.limit_in_bytes, memory.max and
+// memory.high.
+//
+// +stateify savable
+type memoryLimitData struct {
+	c *memoryController
+
+	// v2 is true if the file uses the cgroup v2 format, in which unlimited is
+	// "max" rather than a large number.
+	v2 bool
+
+	// high is true for memory.high, and false for the max limit.
+	high bool
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *memoryLimitData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	val := d.c.limit.Max()
+	if d.high {
+		val = d.c.limit.High()
+	}
+	if d.v2 && val == kernel.CgroupMemoryUnlimited {
+		fmt.Fprintf(buf, "max\n")
+	} else {
+		fmt.Fprintf(buf, "%d\n", val)
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *memoryLimitData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	return d.WriteBackground(ctx, src)
+}
+
+// WriteBackground implements writableControllerFileImpl.WriteBackground.
+//
+// Limits are rounded down to a multiple of the page size. "-1" and "max" set
+// an unlimited limit.
+func (d *memoryLimitData) WriteBackground(ctx context.Context, src usermem.IOSequence) (int64, error) {
+	buf := copyScratchBufferFromContext(ctx, hostarch.PageSize)
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	str := strings.TrimSpace(string(buf[:n]))
+	val := int64(kernel.CgroupMemoryUnlimited)
+	if str != "max" && str != "-1" {
+		val, err = strconv.ParseInt(str, 10, 64)
+		if err != nil || val < 0 {
+			return 0, linuxerr.EINVAL
+		}
+		val &^= hostarch.PageSize - 1
+	}
+	if d.high {
+		d.c.limit.SetHigh(val)
+	} else {
+		d.c.limit.SetMax(val)
+	}
+	return int64(n), nil
+}
+
+// memoryEventsData implements memory.events.
+//
+// +stateify savable
+type memoryEventsData struct {
+	c *memoryController
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *memoryEventsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	high, max, oom, oomKill := d.c.limit.Events()
+	fmt.Fprintf(buf, "low 0\n")
+	fmt.Fprintf(buf, "high %d\n", high)
+	fmt.Fprintf(buf, "max %d\n", max)
+	fmt.Fprintf(buf, "oom %d\n", oom)
+	fmt.Fprintf(buf, "oom_kill %d\n", oomKill)
+	return nil
+}
@@ -287,7 +287,7 @@ func (d *pidsMaxData) WriteBackground(ctx context.Context, src usermem.IOSequenc
 	if err != nil {
 		return 0, err
 	}
-	if strings.TrimSpace(string(buf)) == "max" {
+	if strings.TrimSpace(string(buf[:ncpy])) == "max" {
 		d.c.mu.Lock()
 		defer d.c.mu.Unlock()
 		d.c.max = pidLimitUnlimited
@@ -148,6 +148,9 @@ type connection struct {
 	// Negotiated in FUSE_INIT.
 	maxPages uint16
 
+	// initFlags are the flags sent in FUSE_INIT.
+	initFlags uint32
+
 	// maxActiveRequests specifies the maximum number of active requests that can
 	// exist at any time. Any further requests will block when trying to CAll
 	// the server.
@@ -212,12 +215,17 @@ func newFUSEConnection(_ context.Context, fuseFD *DeviceFD, opts *filesystemOpti
 	fuseFD.completions = make(map[linux.FUSEOpID]*futureResponse)
 	fuseFD.fullQueueCh = make(chan struct{}, opts.maxActiveRequests)
 
+	initFlags := uint32(fuseDefaultInitFlags)
+	if opts.dax {
+		initFlags |= linux.FUSE_MAP_ALIGNMENT
+	}
 	return &connection{
 		fd:                       fuseFD,
 		asyncNumMax:              fuseDefaultMaxBackground,
 		asyncCongestionThreshold: fuseDefaultCongestionThreshold,
 		maxRead:                  opts.maxRead,
 		maxPages:                 fuseDefaultMaxPagesPerReq,
+		initFlags:                initFlags,
 		maxActiveRequests:        opts.maxActiveRequests,
 		initializedChan:          make(chan struct{}),
 		connected:                true,
@@ -19,6 +19,7 @@ import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 )
 
@@ -83,7 +84,7 @@ func (conn *connection) InitSend(creds *auth.Credentials, pid uint32) error {
 		Minor: linux.FUSE_KERNEL_MINOR_VERSION,
 		// TODO(gvisor.dev/issue/3196): find appropriate way to calculate this
 		MaxReadahead: fuseDefaultMaxReadahead,
-		Flags:        fuseDefaultInitFlags,
+		Flags:        conn.initFlags,
 	}
 
 	req := conn.NewRequest(creds, pid, 0, linux.FUSE_INIT, &in)
@@ -128,6 +129,12 @@ func (conn *connection) initProcessReply(out *linux.FUSEInitOut, hasSysAdminCap
 		return nil
 	}
 
+	// DAX mappings must be aligned to the server's alignment.
+	if conn.initFlags&linux.FUSE_MAP_ALIGNMENT != 0 && out.Flags&linux.FUSE_MAP_ALIGNMENT != 0 && out.MapAlignment > daxMappingShift {
+		conn.connInitError = true
+		return nil
+	}
+
 	// Start processing the reply.
 	conn.connInitSuccess = true
 	conn.minor = out.Minor
@@ -164,6 +171,12 @@ func (conn *connection) initProcessReply(out *linux.FUSEInitOut, hasSysAdminCap
 		}
 	}
 
+	// Writes never exceed maxPages, so don't require larger request buffers
+	// from the server; see DeviceFD.Read.
+	if maxWrite := uint32(conn.maxPages) << hostarch.PageShift; conn.maxWrite > maxWrite {
+		conn.maxWrite = maxWrite
+	}
+
 	// No support for limits before minor version 13.
 	if out.Minor >= 13 {
 		conn.asyncMu.Lock()
@@ -0,0 +1,212 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/vhostuser"
+)
+
+const (
+	// daxMappingShift is the log2 of the size of DAX mappings. Compare Linux's
+	// fs/fuse/dax.c:FUSE_DAX_SHIFT.
+	daxMappingShift = 21
+
+	// daxMappingSize is the size of DAX mappings.
+	daxMappingSize = 1 << daxMappingShift
+)
+
+// daxWindow is the DAX window of a virtio-fs device.
+//
+// In a VM, the device maps ranges of files into a window of guest memory on
+// FUSE_SETUPMAPPING, and the guest maps the window into applications. The
+// sentry maps files into applications from their host FDs instead, so the
+// window only serves to receive the host FD that the device maps into it.
+// It is a single mapping in size, and only holds the mapping of a file until
+// the host FD is taken out of it.
+type daxWindow struct {
+	// mu serializes uses of the window.
+	mu sync.Mutex
+
+	// fdMu protects fd and writable.
+	fdMu sync.Mutex
+
+	// fd is the host FD that the device mapped into the window, or -1.
+	//
+	// +checklocks:fdMu
+	fd int
+
+	// writable is true if fd was mapped writable.
+	//
+	// +checklocks:fdMu
+	writable bool
+}
+
+func newDAXWindow() *daxWindow {
+	return &daxWindow{fd: -1}
+}
+
+// release closes the host FD mapped into the window, if any.
+func (w *daxWindow) release() {
+	w.fdMu.Lock()
+	defer w.fdMu.Unlock()
+	if w.fd >= 0 {
+		_ = unix.Close(w.fd)
+		w.fd = -1
+	}
+}
+
+// handleBackendRequest handles requests from the back-end channel of the
+// device. It implements vhostuser.Config.HandleBackendRequest.
+func (w *daxWindow) handleBackendRequest(request uint32, payload []byte, fds []int) uint64 {
+	switch request {
+	case vhostuser.BackendFSMap:
+		ms, err := vhostuser.ParseFSBackendMsg(payload)
+		if err != nil || len(ms) != 1 || len(fds) != 1 {
+			log.Warningf("virtiofs: invalid DAX mapping request (%d ranges, %d FDs): %v", len(ms), len(fds), err)
+			break
+		}
+		m := ms[0]
+		// The mapping must be the one requested by setUpMapping, so that
+		// offsets in the FD are offsets in the file.
+		if m.FDOffset != 0 || m.CacheOffset != 0 || m.Len > daxMappingSize || m.Flags&vhostuser.FSMapFlagRead == 0 {
+			log.Warningf("virtiofs: invalid DAX mapping request: %+v", m)
+			break
+		}
+		w.fdMu.Lock()
+		if w.fd >= 0 {
+			_ = unix.Close(w.fd)
+		}
+		w.fd = fds[0]
+		w.writable = m.Flags&vhostuser.FSMapFlagWrite != 0
+		w.fdMu.Unlock()
+		return 0
+	case vhostuser.BackendFSUnmap:
+		// Host FDs are taken out of the window when they are mapped, so
+		// there is nothing left to unmap.
+		closeHostFDs(fds)
+		return 0
+	default:
+		log.Warningf("virtiofs: unsupported back-end request %d", request)
+	}
+	closeHostFDs(fds)
+	return 1
+}
+
+// take takes the host FD mapped into the window out of it.
+func (w *daxWindow) take() (int, bool) {
+	w.fdMu.Lock()
+	defer w.fdMu.Unlock()
+	fd := w.fd
+	w.fd = -1
+	return fd, w.writable
+}
+
+// setUpMapping returns a host FD for the file with node ID nodeID and file
+// handle fh, and whether it allows shared writable mappings. It asks the
+// device to map the file into the window, and takes the host FD of the
+// mapping out of it.
+func (w *daxWindow) setUpMapping(ctx context.Context, conn *connection, nodeID, fh uint64) (int, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	creds := auth.CredentialsFromContext(ctx)
+	pid := pidFromContext(ctx)
+	var err error
+	// Fall back to a read-only mapping if the file can't be written.
+	for _, flags := range []uint64{linux.FUSE_SETUPMAPPING_FLAG_READ | linux.FUSE_SETUPMAPPING_FLAG_WRITE, linux.FUSE_SETUPMAPPING_FLAG_READ} {
+		in := linux.FUSESetupMappingIn{
+			Fh:    fh,
+			Len:   daxMappingSize,
+			Flags: flags,
+		}
+		req := conn.NewRequest(creds, pid, nodeID, linux.FUSE_SETUPMAPPING, &in)
+		var res *Response
+		res, err = conn.Call(ctx, req)
+		if err == nil {
+			err = res.Error()
+		}
+		if err != nil {
+			continue
+		}
+		fd, writable := w.take()
+		w.removeMapping(ctx, conn, nodeID)
+		if fd < 0 {
+			log.Warningf("virtiofs: device didn't send the host FD of DAX mapping")
+			return -1, false, linuxerr.EIO
+		}
+		return fd, writable, nil
+	}
+	if linuxerr.Equals(linuxerr.ENOSYS, err) {
+		err = linuxerr.ENODEV
+	}
+	return -1, false, err
+}
+
+// removeMapping asks the device to remove the mapping in the window.
+func (w *daxWindow) removeMapping(ctx context.Context, conn *connection, nodeID uint64) {
+	in := linux.FUSERemoveMappingIn{
+		Mappings: []linux.FUSERemoveMappingOne{{Len: daxMappingSize}},
+	}
+	req := conn.NewRequest(auth.CredentialsFromContext(ctx), pidFromContext(ctx), nodeID, linux.FUSE_REMOVEMAPPING, &in)
+	res, err := conn.Call(ctx, req)
+	if err == nil {
+		err = res.Error()
+	}
+	if err != nil {
+		log.Warningf("virtiofs: removing DAX mapping failed: %v", err)
+	}
+}
+
+// setUpDAX makes i mappable from a host FD of the file, which it gets from the
+// DAX window using the file handle fh if i isn't mappable yet. It returns
+// whether i allows shared writable mappings.
+func (i *inode) setUpDAX(ctx context.Context, fh uint64) (bool, error) {
+	i.daxMu.Lock()
+	defer i.daxMu.Unlock()
+	if i.daxFD < 0 {
+		fd, writable, err := i.fs.transport.dax.setUpMapping(ctx, i.fs.conn, i.nodeID, fh)
+		if err != nil {
+			return false, err
+		}
+		i.daxFD = fd
+		i.daxWritable = writable
+		i.CachedMappable.Init(fd)
+	}
+	i.CachedMappable.InitFileMapperOnce()
+	return i.daxWritable, nil
+}
+
+// releaseDAX closes the host FD that i is mapped from, if any.
+func (i *inode) releaseDAX() {
+	i.daxMu.Lock()
+	defer i.daxMu.Unlock()
+	if i.daxFD >= 0 {
+		_ = unix.Close(i.daxFD)
+		i.daxFD = -1
+	}
+}
+
+func closeHostFDs(fds []int) {
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+}
@@ -16,6 +16,7 @@
 package fuse
 
 import (
+	"fmt"
 	"math"
 	"strconv"
 
@@ -78,6 +79,12 @@ type filesystemOptions struct {
 	//
 	// Immutable after mount.
 	allowOther bool
+
+	// dax is true if file contents are mapped directly from the host through
+	// the DAX window of a virtio-fs device.
+	//
+	// Immutable after mount.
+	dax bool
 }
 
 // filesystem implements vfs.FilesystemImpl.
@@ -96,6 +103,10 @@ type filesystem struct {
 
 	// clock is a real-time clock used to set timestamps in file operations.
 	clock time.Clock
+
+	// transport forwards requests to a virtio-fs device. It's only set for
+	// virtio-fs filesystems, which can't be saved; see PrepareSave.
+	transport *virtiofsTransport `state:"nosave"`
 }
 
 // Name implements vfs.FilesystemType.Name.
@@ -257,7 +268,7 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 
 // newFUSEFilesystem creates a new FUSE filesystem.
 // +checklocks:fuseFD.mu
-func newFUSEFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, fsType *FilesystemType, fuseFD *DeviceFD, devMinor uint32, opts *filesystemOptions) (*filesystem, error) {
+func newFUSEFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, fsType vfs.FilesystemType, fuseFD *DeviceFD, devMinor uint32, opts *filesystemOptions) (*filesystem, error) {
 	if !fuseFD.connected() {
 		conn, err := newFUSEConnection(ctx, fuseFD, opts)
 		if err != nil {
@@ -279,17 +290,36 @@ func newFUSEFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, fsTyp
 
 // Release implements vfs.FilesystemImpl.Release.
 func (fs *filesystem) Release(ctx context.Context) {
+	if fs.transport != nil {
+		fs.transport.close(ctx)
+	}
 	fs.Filesystem.VFSFilesystem().VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
 	fs.Filesystem.Release(ctx)
 }
 
+// PrepareSave implements vfs.FilesystemImplSaveRestoreExtension.PrepareSave.
+func (fs *filesystem) PrepareSave(ctx context.Context) error {
+	if fs.transport != nil {
+		// The state of the connection lives in the virtio-fs device outside
+		// of the sandbox, and can't be carried over to a restored sandbox.
+		return fmt.Errorf("virtio-fs mounts can't be checkpointed")
+	}
+	return nil
+}
+
+// CompleteRestore implements
+// vfs.FilesystemImplSaveRestoreExtension.CompleteRestore.
+func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRestoreOptions) error {
+	return nil
+}
+
 // MountOptions implements vfs.FilesystemImpl.MountOptions.
 func (fs *filesystem) MountOptions() string {
 	return fs.opts.mopts
 }
 
 func (fs *filesystem) newRoot(ctx context.Context, creds *auth.Credentials, mode linux.FileMode) *kernfs.Dentry {
-	i := &inode{fs: fs, nodeID: 1}
+	i := &inode{fs: fs, nodeID: 1, daxFD: -1}
 	i.attrMu.Lock()
 	i.init(creds, linux.UNNAMED_MAJOR, fs.devMinor, 1, linux.ModeDirectory|0755, 2)
 	i.attrMu.Unlock()
@@ -302,7 +332,7 @@ func (fs *filesystem) newRoot(ctx context.Context, creds *auth.Credentials, mode
 }
 
 func (fs *filesystem) newInode(ctx context.Context, nodeID uint64, attr linux.FUSEAttr) kernfs.Inode {
-	i := &inode{fs: fs, nodeID: nodeID}
+	i := &inode{fs: fs, nodeID: nodeID, daxFD: -1}
 	creds := auth.Credentials{EffectiveKGID: auth.KGID(attr.UID), EffectiveKUID: auth.KUID(attr.UID)}
 	i.attrMu.Lock()
 	i.init(&creds, linux.UNNAMED_MAJOR, fs.devMinor, nodeID, linux.FileMode(attr.Mode), attr.Nlink)
@@ -103,6 +103,19 @@ type inode struct {
 
 	// +checklocks:attrMu
 	blockSize atomicbitops.Uint32 // 0 if unknown.
+
+	// daxMu protects daxFD and daxWritable.
+	daxMu sync.Mutex
+
+	// daxFD is the host FD that DAX mappings of the file are backed by, or -1
+	// if the file wasn't mapped. daxWritable is true if daxFD allows shared
+	// writable mappings. Host FDs can't be saved, and neither can virtio-fs
+	// filesystems, which are the only ones that use DAX.
+	//
+	// +checklocks:daxMu
+	daxFD int `state:"nosave"`
+	// +checklocks:daxMu
+	daxWritable bool `state:"nosave"`
 }
 
 func blockerFromContext(ctx context.Context) context.Blocker {
@@ -697,7 +710,10 @@ func (i *inode) Stat(ctx context.Context, fs *vfs.Filesystem, opts vfs.StatOptio
 
 // DecRef implements kernfs.Inode.DecRef.
 func (i *inode) DecRef(ctx context.Context) {
-	i.inodeRefs.DecRef(func() { i.Destroy(ctx) })
+	i.inodeRefs.DecRef(func() {
+		i.Destroy(ctx)
+		i.releaseDAX()
+	})
 }
 
 // StatFS implements kernfs.Inode.StatFS.
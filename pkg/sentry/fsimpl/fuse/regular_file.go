@@ -286,7 +286,21 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
 func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
-	return linuxerr.ENOSYS
+	inode := fd.inode()
+	if !inode.fs.opts.dax {
+		return linuxerr.ENOSYS
+	}
+	writable, err := inode.setUpDAX(ctx, fd.Fh)
+	if err != nil {
+		return err
+	}
+	if !opts.Private && !writable {
+		if opts.Perms.Write {
+			return linuxerr.EACCES
+		}
+		opts.MaxPerms.Write = false
+	}
+	return vfs.GenericConfigureMMap(&fd.vfsfd, inode, opts)
 }
 
 // AddMapping implements memmap.Mappable.AddMapping.
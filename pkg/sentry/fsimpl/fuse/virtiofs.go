@@ -0,0 +1,177 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/vhostuser"
+)
+
+// VirtiofsName is the virtio-fs filesystem name.
+const VirtiofsName = "virtiofs"
+
+// VirtiofsFilesystemType implements vfs.FilesystemType for virtio-fs.
+//
+// virtio-fs speaks the FUSE protocol to a virtio-fs device whose back-end runs
+// outside of the sandbox, typically virtiofsd. Instead of an
+// application-provided /dev/fuse FD, the connection is backed by the
+// vhost-user socket of the device, and FUSE messages are exchanged through
+// its virtqueues.
+//
+// With the dax mount option, file contents are mapped directly from the host
+// FDs that the device passes for its DAX window, instead of being unmappable.
+//
+// virtio-fs filesystems can't be mounted by applications, since they require
+// a host FD passed in VirtiofsInternalData, and can't be saved.
+//
+// +stateify savable
+type VirtiofsFilesystemType struct{}
+
+// VirtiofsInternalData contains internal data passed in to the virtio-fs mount
+// via vfs.GetFilesystemOptions.InternalData.
+type VirtiofsInternalData struct {
+	// FD is the host FD connected to the vhost-user back-end of the virtio-fs
+	// device. If the mount succeeds, the filesystem takes ownership of FD.
+	FD int
+}
+
+// Name implements vfs.FilesystemType.Name.
+func (VirtiofsFilesystemType) Name() string {
+	return VirtiofsName
+}
+
+// Release implements vfs.FilesystemType.Release.
+func (VirtiofsFilesystemType) Release(ctx context.Context) {}
+
+// GetFilesystem implements vfs.FilesystemType.GetFilesystem.
+func (fsType VirtiofsFilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, source string, opts vfs.GetFilesystemOptions) (*vfs.Filesystem, *vfs.Dentry, error) {
+	idata, ok := opts.InternalData.(*VirtiofsInternalData)
+	if !ok || idata == nil {
+		ctx.Warningf("%s.GetFilesystem: missing internal data", fsType.Name())
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	// Like Linux, virtio-fs mounts always perform permission checks in the
+	// sentry and are accessible by every user.
+	fsopts := filesystemOptions{
+		mopts:              opts.Data,
+		uid:                creds.EffectiveKUID,
+		gid:                creds.EffectiveKGID,
+		rootMode:           linux.ModeDirectory | 0755,
+		maxActiveRequests:  maxActiveRequestsDefault,
+		maxRead:            math.MaxUint32,
+		defaultPermissions: true,
+		allowOther:         true,
+	}
+	mopts := vfs.GenericParseMountOptions(opts.Data)
+	if maxReadStr, ok := mopts["max_read"]; ok {
+		delete(mopts, "max_read")
+		maxRead, err := strconv.ParseUint(maxReadStr, 10, 32)
+		if err != nil {
+			ctx.Warningf("%s.GetFilesystem: invalid max_read: max_read=%s", fsType.Name(), maxReadStr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		if maxRead < fuseMinMaxRead {
+			maxRead = fuseMinMaxRead
+		}
+		fsopts.maxRead = uint32(maxRead)
+	}
+	if daxStr, ok := mopts["dax"]; ok {
+		delete(mopts, "dax")
+		switch daxStr {
+		case "", "always":
+			fsopts.dax = true
+		case "never":
+		case "inode":
+			// Per-file DAX requires FUSE_ATTR_DAX, which isn't supported.
+			ctx.Warningf("%s.GetFilesystem: dax=inode is not supported", fsType.Name())
+			return nil, nil, linuxerr.EINVAL
+		default:
+			ctx.Warningf("%s.GetFilesystem: invalid dax: dax=%s", fsType.Name(), daxStr)
+			return nil, nil, linuxerr.EINVAL
+		}
+	}
+	if len(mopts) != 0 {
+		ctx.Warningf("%s.GetFilesystem: unsupported or unknown options: %v", fsType.Name(), mopts)
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	k := kernel.KernelFromContext(ctx)
+	if k == nil {
+		ctx.Warningf("%s.GetFilesystem: couldn't get kernel from context", fsType.Name())
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	devMinor, err := vfsObj.GetAnonBlockDevMinor()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The device FD is internal to the filesystem and is never installed in
+	// a file table. It's only used as the request queue of the connection.
+	fuseFD := &DeviceFD{}
+	vd := vfsObj.NewAnonVirtualDentry("[virtiofs]")
+	defer vd.DecRef(ctx)
+	if err := fuseFD.vfsfd.Init(fuseFD, linux.O_RDWR, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		vfsObj.PutAnonBlockDevMinor(devMinor)
+		return nil, nil, err
+	}
+
+	transport, err := newVirtiofsTransport(k.SupervisorContext(), fuseFD, idata.FD, fsopts.dax)
+	if err != nil {
+		fuseFD.vfsfd.DecRef(ctx)
+		vfsObj.PutAnonBlockDevMinor(devMinor)
+		ctx.Warningf("%s.GetFilesystem: setting up the virtio-fs device failed: %v", fsType.Name(), err)
+		if errors.Is(err, vhostuser.ErrUnsupported) {
+			return nil, nil, linuxerr.EINVAL
+		}
+		return nil, nil, linuxerr.EIO
+	}
+
+	fuseFD.mu.Lock()
+	fs, err := newFUSEFilesystem(ctx, vfsObj, &fsType, fuseFD, devMinor, &fsopts)
+	fuseFD.mu.Unlock()
+	if err != nil {
+		transport.close(ctx)
+		vfsObj.PutAnonBlockDevMinor(devMinor)
+		log.Warningf("%s.GetFilesystem: newFUSEFilesystem failed: %v", fsType.Name(), err)
+		return nil, nil, err
+	}
+	// From now on, releasing the filesystem closes the transport.
+	fs.transport = transport
+
+	// FUSE_INIT is queued until the transport starts forwarding requests.
+	if err := fs.conn.InitSend(creds, 0 /* pid */); err != nil {
+		log.Warningf("%s.InitSend: failed with error: %v", fsType.Name(), err)
+		fs.VFSFilesystem().DecRef(ctx)
+		return nil, nil, err
+	}
+	transport.start()
+
+	root := fs.newRoot(ctx, creds, fsopts.rootMode)
+	return fs.VFSFilesystem(), root.VFSDentry(), nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/vhostuser"
+)
+
+func TestVirtiofsInvalidOptions(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	creds := auth.CredentialsFromContext(s.Ctx)
+	for _, data := range []string{
+		"dax=inode",
+		"dax=sometimes",
+		"max_read=big",
+		"allow_other",
+	} {
+		_, _, err := VirtiofsFilesystemType{}.GetFilesystem(s.Ctx, s.VFS, creds, "", vfs.GetFilesystemOptions{
+			Data:         data,
+			InternalData: &VirtiofsInternalData{FD: -1},
+		})
+		if !linuxerr.Equals(linuxerr.EINVAL, err) {
+			t.Errorf("GetFilesystem(%q) = %v, want %v", data, err, linuxerr.EINVAL)
+		}
+	}
+}
+
+func TestVirtiofsInitDAX(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		alignment uint16
+		wantErr   bool
+	}{
+		{name: "page", alignment: hostarch.PageShift},
+		{name: "mapping", alignment: daxMappingShift},
+		{name: "too large", alignment: daxMappingShift + 1, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := &connection{
+				initFlags:       fuseDefaultInitFlags | linux.FUSE_MAP_ALIGNMENT,
+				initializedChan: make(chan struct{}),
+			}
+			out := linux.FUSEInitOut{
+				Major:        linux.FUSE_KERNEL_VERSION,
+				Minor:        linux.FUSE_KERNEL_MINOR_VERSION,
+				Flags:        linux.FUSE_MAP_ALIGNMENT,
+				MapAlignment: tc.alignment,
+			}
+			if err := conn.initProcessReply(&out, false); err != nil {
+				t.Fatalf("initProcessReply: %v", err)
+			}
+			if conn.connInitError != tc.wantErr {
+				t.Errorf("connInitError = %t, want %t", conn.connInitError, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxWriteBoundedByMaxPages(t *testing.T) {
+	conn := &connection{
+		initFlags:       fuseDefaultInitFlags,
+		initializedChan: make(chan struct{}),
+	}
+	out := linux.FUSEInitOut{
+		Major:    linux.FUSE_KERNEL_VERSION,
+		Minor:    linux.FUSE_KERNEL_MINOR_VERSION,
+		Flags:    linux.FUSE_MAX_PAGES,
+		MaxWrite: 16 << 20,
+		MaxPages: 32,
+	}
+	if err := conn.initProcessReply(&out, false); err != nil {
+		t.Fatalf("initProcessReply: %v", err)
+	}
+	if want := uint32(32 * hostarch.PageSize); conn.maxWrite != want {
+		t.Errorf("maxWrite = %d, want %d", conn.maxWrite, want)
+	}
+}
+
+func TestVirtiofsPrepareSave(t *testing.T) {
+	fs := &filesystem{}
+	if err := fs.PrepareSave(nil); err != nil {
+		t.Errorf("PrepareSave without virtio-fs transport: %v", err)
+	}
+	fs.transport = &virtiofsTransport{}
+	if err := fs.PrepareSave(nil); err == nil {
+		t.Errorf("PrepareSave with virtio-fs transport succeeded, want error")
+	}
+}
+
+// fsMapPayload returns a VhostUserFSBackendMsg with a single range.
+func fsMapPayload(m vhostuser.FSMapping) []byte {
+	const entries = 8
+	payload := make([]byte, 4*8*entries)
+	for f, v := range []uint64{m.FDOffset, m.CacheOffset, m.Len, m.Flags} {
+		hostarch.ByteOrder.PutUint64(payload[8*f*entries:], v)
+	}
+	return payload
+}
+
+func TestDAXWindow(t *testing.T) {
+	newFD := func() int {
+		fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+		if err != nil {
+			t.Fatalf("Eventfd: %v", err)
+		}
+		return fd
+	}
+
+	w := newDAXWindow()
+	defer w.release()
+	if fd, _ := w.take(); fd != -1 {
+		t.Fatalf("take() on empty window = %d, want -1", fd)
+	}
+
+	for _, m := range []vhostuser.FSMapping{
+		{FDOffset: hostarch.PageSize, Len: daxMappingSize, Flags: vhostuser.FSMapFlagRead},
+		{CacheOffset: daxMappingSize, Len: daxMappingSize, Flags: vhostuser.FSMapFlagRead},
+		{Len: 2 * daxMappingSize, Flags: vhostuser.FSMapFlagRead},
+		{Len: daxMappingSize, Flags: vhostuser.FSMapFlagWrite},
+	} {
+		if got := w.handleBackendRequest(vhostuser.BackendFSMap, fsMapPayload(m), []int{newFD()}); got == 0 {
+			t.Errorf("mapping %+v succeeded, want failure", m)
+		}
+	}
+	if fd, _ := w.take(); fd != -1 {
+		t.Fatalf("take() after invalid mappings = %d, want -1", fd)
+	}
+
+	want := newFD()
+	m := vhostuser.FSMapping{Len: daxMappingSize, Flags: vhostuser.FSMapFlagRead | vhostuser.FSMapFlagWrite}
+	if got := w.handleBackendRequest(vhostuser.BackendFSMap, fsMapPayload(m), []int{want}); got != 0 {
+		t.Fatalf("mapping %+v failed: %d", m, got)
+	}
+	if got := w.handleBackendRequest(vhostuser.BackendFSUnmap, fsMapPayload(m), nil); got != 0 {
+		t.Errorf("unmapping %+v failed: %d", m, got)
+	}
+	fd, writable := w.take()
+	if fd != want || !writable {
+		t.Errorf("take() = %d, %t, want %d, true", fd, writable, want)
+	}
+	if fd >= 0 {
+		unix.Close(fd)
+	}
+}
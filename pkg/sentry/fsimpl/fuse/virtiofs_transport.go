@@ -0,0 +1,322 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/vhostuser"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// Virtqueues of virtio-fs devices. See the virtio specification, 5.11.2
+// "Virtqueues".
+const (
+	virtiofsHiprioQueue  = 0
+	virtiofsRequestQueue = 1
+	virtiofsNumQueues    = 2
+)
+
+const (
+	// virtiofsNumSlots is the maximum number of requests that may be in
+	// flight on a virtio-fs device.
+	virtiofsNumSlots = 16
+
+	// virtiofsQueueSize is the number of descriptors in each virtqueue. Each
+	// request uses at most two descriptors.
+	virtiofsQueueSize = 2 * virtiofsNumSlots
+
+	// virtiofsMaxData is the size of the largest payload of a request or
+	// reply, which is bounded by the maximum number of pages per request.
+	virtiofsMaxData = fuseMaxMaxPages * hostarch.PageSize
+)
+
+// virtiofsTransport forwards FUSE requests queued in a DeviceFD to a vhost-user
+// virtio-fs device, and feeds the device's replies back into the DeviceFD. It
+// plays the role that the FUSE server plays for /dev/fuse.
+//
+// Each request in flight occupies a slot in the memory shared with the
+// device, which holds the request and the buffer for its reply.
+type virtiofsTransport struct {
+	// ctx is the context used to read requests from and write replies to fd.
+	ctx context.Context
+
+	// fd is the request queue of the connection.
+	fd *DeviceFD
+
+	// dev is the virtio-fs device. dev is immutable.
+	dev *vhostuser.Device
+
+	// requestSize and replySize are the sizes of the request and reply
+	// buffers of each slot. They are immutable.
+	requestSize uint64
+	replySize   uint64
+
+	// free receives the indices of slots that aren't in use.
+	free chan int
+
+	// mu protects inflight.
+	mu sync.Mutex
+
+	// inflight maps the head descriptor of each request in flight on each
+	// virtqueue to the request's slot.
+	inflight [virtiofsNumQueues]map[uint16]int
+
+	// dax is the state of the DAX window. It is nil if DAX isn't enabled.
+	dax *daxWindow
+
+	// stop is closed to tell the request and reply loops to exit.
+	stop chan struct{}
+
+	// wg tracks the request and reply loops.
+	wg sync.WaitGroup
+
+	// closeOnce ensures that close only runs once.
+	closeOnce sync.Once
+}
+
+// newVirtiofsTransport sets up the virtio-fs device whose vhost-user back-end
+// is connected to hostFD. If it succeeds, the transport takes ownership of
+// hostFD.
+func newVirtiofsTransport(ctx context.Context, fd *DeviceFD, hostFD int, dax bool) (*virtiofsTransport, error) {
+	t := &virtiofsTransport{
+		ctx:         ctx,
+		fd:          fd,
+		requestSize: hostarch.MustPageRoundUp(uint64(linux.SizeOfFUSEHeaderIn+linux.SizeOfFUSEHeaderOut) + virtiofsMaxData),
+		replySize:   hostarch.MustPageRoundUp(uint64(linux.SizeOfFUSEHeaderOut) + virtiofsMaxData),
+		free:        make(chan int, virtiofsNumSlots),
+		stop:        make(chan struct{}),
+	}
+	for i := range t.inflight {
+		t.inflight[i] = make(map[uint16]int)
+	}
+	cfg := vhostuser.Config{
+		NumQueues:  virtiofsNumQueues,
+		QueueSize:  virtiofsQueueSize,
+		BufferSize: virtiofsNumSlots * (t.requestSize + t.replySize),
+	}
+	if dax {
+		// The device sends the host FDs of DAX mappings on the back-end
+		// channel, and must wait for them to be received before replying to
+		// FUSE_SETUPMAPPING.
+		t.dax = newDAXWindow()
+		cfg.ProtocolFeatures = vhostuser.ProtocolFeatureBackendSendFD | vhostuser.ProtocolFeatureReplyAck
+		cfg.HandleBackendRequest = t.dax.handleBackendRequest
+	}
+	dev, err := vhostuser.Connect(hostFD, cfg)
+	if err != nil {
+		return nil, err
+	}
+	t.dev = dev
+	for i := 0; i < virtiofsNumSlots; i++ {
+		t.free <- i
+	}
+	return t, nil
+}
+
+// start starts forwarding requests and replies.
+func (t *virtiofsTransport) start() {
+	t.wg.Add(1 + virtiofsNumQueues)
+	go t.requestLoop() // S/R-SAFE: virtio-fs filesystems can't be saved.
+	for i := 0; i < virtiofsNumQueues; i++ {
+		go t.replyLoop(i) // S/R-SAFE: virtio-fs filesystems can't be saved.
+	}
+}
+
+// close disconnects the FUSE connection and the device. It waits for the
+// request and reply loops to exit.
+func (t *virtiofsTransport) close(ctx context.Context) {
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		// Abort all pending requests, and unblock the request loop.
+		t.fd.vfsfd.DecRef(ctx)
+		// Unblock the reply loops.
+		for i := 0; i < virtiofsNumQueues; i++ {
+			t.dev.Queue(i).Interrupt()
+		}
+		t.wg.Wait()
+		t.dev.Close()
+		if t.dax != nil {
+			t.dax.release()
+		}
+	})
+}
+
+// request returns the request buffer of slot.
+func (t *virtiofsTransport) request(slot int) []byte {
+	off := uint64(slot) * (t.requestSize + t.replySize)
+	return t.dev.Buffers()[off : off+t.requestSize]
+}
+
+// reply returns the reply buffer of slot.
+func (t *virtiofsTransport) reply(slot int) []byte {
+	off := uint64(slot)*(t.requestSize+t.replySize) + t.requestSize
+	return t.dev.Buffers()[off : off+t.replySize]
+}
+
+// requestLoop reads requests from the connection queue and makes them
+// available to the device.
+func (t *virtiofsTransport) requestLoop() {
+	defer t.wg.Done()
+
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents | waiter.EventErr)
+	if err := t.fd.EventRegister(&e); err != nil {
+		log.Warningf("virtiofs: registering for requests failed: %v", err)
+		return
+	}
+	defer t.fd.EventUnregister(&e)
+
+	for {
+		var slot int
+		select {
+		case slot = <-t.free:
+		case <-t.stop:
+			return
+		}
+		n, err := t.read(t.request(slot), ch)
+		if err != nil {
+			// The connection is no longer usable, e.g. it was aborted.
+			log.Debugf("virtiofs: request loop exiting: %v", err)
+			return
+		}
+		if err := t.send(slot, n); err != nil {
+			log.Warningf("virtiofs: sending request to device failed: %v", err)
+			t.abort()
+			return
+		}
+	}
+}
+
+// read reads the next request from the connection queue into buf, blocking
+// until a request is available.
+func (t *virtiofsTransport) read(buf []byte, ch <-chan struct{}) (int, error) {
+	for {
+		n, err := t.fd.Read(t.ctx, usermem.BytesIOSequence(buf), vfs.ReadOptions{})
+		if !linuxerr.Equals(linuxerr.ErrWouldBlock, err) {
+			return int(n), err
+		}
+		select {
+		case <-ch:
+		case <-t.stop:
+			return 0, linuxerr.ENODEV
+		}
+	}
+}
+
+// send makes the request of n bytes in slot available to the device.
+func (t *virtiofsTransport) send(slot, n int) error {
+	off := uint64(slot) * (t.requestSize + t.replySize)
+	queue := virtiofsRequestQueue
+	bufs := []vhostuser.Buffer{{Offset: off, Len: uint32(n)}}
+	switch hostarch.ByteOrder.Uint32(t.request(slot)[4:]) {
+	case linux.FUSE_FORGET, linux.FUSE_BATCH_FORGET:
+		// Requests without replies go to the high priority queue, so that
+		// they don't wait for regular requests; see the virtio specification,
+		// 5.11.6.1 "Device Operation: High Priority Queue".
+		queue = virtiofsHiprioQueue
+	default:
+		bufs = append(bufs, vhostuser.Buffer{Offset: off + t.requestSize, Len: uint32(t.replySize), Writable: true})
+	}
+	q := t.dev.Queue(queue)
+	t.mu.Lock()
+	head, err := q.Add(bufs)
+	if err == nil {
+		t.inflight[queue][head] = slot
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return q.Kick()
+}
+
+// replyLoop completes the requests that the device used on the given
+// virtqueue.
+func (t *virtiofsTransport) replyLoop(queue int) {
+	defer t.wg.Done()
+
+	q := t.dev.Queue(queue)
+	for {
+		if err := q.Wait(); err != nil {
+			log.Warningf("virtiofs: waiting for virtqueue %d failed: %v", queue, err)
+			t.abort()
+			return
+		}
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+		for {
+			head, written, ok, err := q.Used()
+			if err != nil {
+				log.Warningf("virtiofs: %v", err)
+				t.abort()
+				return
+			}
+			if !ok {
+				break
+			}
+			t.mu.Lock()
+			slot, ok := t.inflight[queue][head]
+			delete(t.inflight[queue], head)
+			t.mu.Unlock()
+			if !ok {
+				log.Warningf("virtiofs: device used descriptor %d on virtqueue %d, which isn't a request", head, queue)
+				t.abort()
+				return
+			}
+			if queue == virtiofsRequestQueue {
+				t.complete(slot, written)
+			}
+			t.free <- slot
+		}
+	}
+}
+
+// complete completes the request in slot with the reply of the given length
+// that the device wrote.
+func (t *virtiofsTransport) complete(slot int, written uint32) {
+	if uint64(written) > t.replySize {
+		log.Warningf("virtiofs: device wrote %d bytes to a reply buffer of %d bytes", written, t.replySize)
+		written = uint32(t.replySize)
+	}
+	if written < linux.SizeOfFUSEHeaderOut {
+		log.Warningf("virtiofs: dropping short reply of %d bytes", written)
+		return
+	}
+	reply := t.reply(slot)[:written]
+	if _, err := t.fd.Write(t.ctx, usermem.BytesIOSequence(reply), vfs.WriteOptions{}); err != nil {
+		if !linuxerr.Equals(linuxerr.EPERM, err) {
+			log.Warningf("virtiofs: dropping reply: %v", err)
+		}
+	}
+}
+
+// abort aborts the FUSE connection after the device became unusable. All
+// pending and future requests fail.
+func (t *virtiofsTransport) abort() {
+	t.fd.mu.Lock()
+	defer t.fd.mu.Unlock()
+	if t.fd.conn != nil {
+		t.fd.conn.Abort(t.ctx) // +checklocksforce: t.fd.conn.fd.mu=t.fd.mu
+	}
+}
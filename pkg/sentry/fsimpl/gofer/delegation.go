@@ -0,0 +1,313 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"math"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fdnotifier"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// Delegations.
+//
+// With the "delegations" mount option, the sentry asks the gofer to delegate
+// regular files when they are opened through lisafs. The gofer backs
+// delegations with host file leases: a read delegation is held through a
+// read-only handle, and a write delegation through a read-write handle. While
+// a file is delegated, no process outside of the sandbox has it open in a
+// conflicting way, so its cached data and metadata are up to date.
+//
+// When a process outside of the sandbox opens a delegated file, the gofer
+// recalls the delegation. The sentry writes dirty cached data back (for
+// write delegations), returns the delegation, and drops clean cached data
+// and metadata. The host delays the conflicting open until the delegation is
+// returned, or until the host's lease break time expires. Files that are not
+// delegated are revalidated when they are opened, which provides
+// close-to-open consistency.
+
+// delegationType is the type of delegation held on a dentry. The zero value
+// is delegationNone, unlike F_RDLCK.
+type delegationType uint8
+
+const (
+	delegationNone delegationType = iota
+	delegationRead
+	delegationWrite
+)
+
+// recaller handles delegation recalls sent by the gofer over an FD donated by
+// the DelegationInit RPC.
+//
+// Delegations are not preserved across checkpoint/restore.
+type recaller struct {
+	fs *filesystem
+
+	// recallFD is the host FD from which recalls are read. It is immutable.
+	recallFD int
+
+	// queue is notified when recallFD is readable.
+	queue waiter.Queue
+
+	// stop is closed to stop the recall loop.
+	stop chan struct{}
+
+	// done is closed when the recall loop exits.
+	done chan struct{}
+
+	// mu protects dentries.
+	mu sync.Mutex
+
+	// dentries maps gofer FDs through which files are delegated to the
+	// corresponding dentries.
+	dentries map[lisafs.FDID]*dentry
+}
+
+// getRecaller returns the filesystem's recaller, creating it if needed. It
+// returns nil if the gofer doesn't grant delegations.
+func (fs *filesystem) getRecaller(ctx context.Context) *recaller {
+	fs.recallerMu.Lock()
+	defer fs.recallerMu.Unlock()
+	if fs.recaller != nil || fs.client == nil || !fs.client.IsSupported(lisafs.DelegationInit) {
+		return fs.recaller
+	}
+	recallFD, err := fs.client.DelegationInit(ctx)
+	if err != nil {
+		log.Warningf("gofer.filesystem: DelegationInit failed, files won't be delegated: %v", err)
+		return nil
+	}
+	r := &recaller{
+		fs:       fs,
+		recallFD: recallFD,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		dentries: make(map[lisafs.FDID]*dentry),
+	}
+	if err := fdnotifier.AddFD(int32(recallFD), &r.queue); err != nil {
+		log.Warningf("gofer.filesystem: failed to register delegation recall FD: %v", err)
+		_ = unix.Close(recallFD)
+		return nil
+	}
+	go r.run() // S/R-SAFE: stopped on filesystem release, not saved.
+	fs.recaller = r
+	return r
+}
+
+// releaseRecaller stops handling delegation recalls. Delegations are returned
+// when the gofer connection is closed.
+func (fs *filesystem) releaseRecaller() {
+	fs.recallerMu.Lock()
+	defer fs.recallerMu.Unlock()
+	if r := fs.recaller; r != nil {
+		close(r.stop)
+		<-r.done
+		fdnotifier.RemoveFD(int32(r.recallFD))
+		_ = unix.Close(r.recallFD)
+		fs.recaller = nil
+	}
+}
+
+// ensureDelegation acquires a delegation on d's current handles, if possible.
+// It returns true if d was already delegated, in which case d's cached data
+// and metadata are up to date.
+//
+// Preconditions: d is a regular file. !d.isSynthetic().
+func (d *dentry) ensureDelegation(ctx context.Context) bool {
+	dt, ok := d.impl.(*lisafsDentry)
+	if !ok {
+		// Directfs dentries don't have gofer FDs to delegate.
+		return false
+	}
+	d.handleMu.RLock()
+	held := d.delegation != delegationNone
+	d.handleMu.RUnlock()
+	if held {
+		return true
+	}
+	r := d.fs.getRecaller(ctx)
+	if r == nil {
+		return false
+	}
+
+	d.handleMu.Lock()
+	defer d.handleMu.Unlock()
+	if d.delegation != delegationNone {
+		return true
+	}
+	// Delegations are held through a single gofer FD. Read delegations
+	// conflict with any writable open of the file, and write delegations with
+	// any open at all, so files with separate read and write handles can't be
+	// delegated.
+	var (
+		fd  lisafs.ClientFD
+		typ delegationType
+	)
+	switch {
+	case dt.writeFDLisa.Ok() && dt.readFDLisa.ID() == dt.writeFDLisa.ID():
+		fd, typ = dt.writeFDLisa, delegationWrite
+	case dt.readFDLisa.Ok() && !dt.writeFDLisa.Ok():
+		fd, typ = dt.readFDLisa, delegationRead
+	default:
+		return false
+	}
+	lockType := uint32(unix.F_RDLCK)
+	if typ == delegationWrite {
+		lockType = unix.F_WRLCK
+	}
+	// Register d before the RPC, since the gofer may recall the delegation as
+	// soon as it is granted.
+	r.mu.Lock()
+	r.dentries[fd.ID()] = d
+	r.mu.Unlock()
+	if err := fd.Delegate(ctx, lockType); err != nil {
+		// The file is open outside of the sandbox, or the host doesn't support
+		// leases on it.
+		log.Debugf("gofer.dentry.ensureDelegation: Delegate failed: %v", err)
+		r.mu.Lock()
+		delete(r.dentries, fd.ID())
+		r.mu.Unlock()
+		return false
+	}
+	d.delegation = typ
+	d.delegationFD = fd.ID()
+	return false
+}
+
+// returnDelegationLocked returns d's delegation, if any. It is called before
+// d's handles are replaced. Dirty cached data doesn't need to be written back
+// first, since the sentry itself is the conflicting user of the file.
+//
+// Preconditions: d.handleMu must be locked for writing.
+func (d *dentry) returnDelegationLocked(ctx context.Context) {
+	if d.delegation == delegationNone {
+		return
+	}
+	fd := d.fs.client.NewFD(d.delegationFD)
+	if err := fd.Delegate(ctx, unix.F_UNLCK); err != nil {
+		log.Warningf("gofer.dentry.returnDelegationLocked: Delegate failed: %v", err)
+	}
+	d.forgetDelegationLocked()
+}
+
+// forgetDelegationLocked marks d as not delegated. Delegations held through a
+// gofer FD are returned by the gofer when the FD is closed.
+//
+// Preconditions: d.handleMu must be locked for writing.
+func (d *dentry) forgetDelegationLocked() {
+	if d.delegation == delegationNone {
+		return
+	}
+	d.fs.recallerMu.Lock()
+	r := d.fs.recaller
+	d.fs.recallerMu.Unlock()
+	if r != nil {
+		r.mu.Lock()
+		delete(r.dentries, d.delegationFD)
+		r.mu.Unlock()
+	}
+	d.delegation = delegationNone
+	d.delegationFD = lisafs.InvalidFDID
+}
+
+// run handles recalls from the gofer until the recaller is stopped.
+func (r *recaller) run() {
+	defer close(r.done)
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	r.queue.EventRegister(&e)
+	defer r.queue.EventUnregister(&e)
+
+	var recall lisafs.DelegationRecall
+	buf := make([]byte, 64*recall.SizeBytes())
+	for {
+		n, err := unix.Read(r.recallFD, buf)
+		switch err {
+		case nil:
+			if n == 0 {
+				// The gofer closed the connection.
+				return
+			}
+			// The gofer writes whole recalls, so buf doesn't end mid-recall.
+			for b := buf[:n]; len(b) >= recall.SizeBytes(); {
+				b = recall.UnmarshalUnsafe(b)
+				r.recall(recall.FD)
+			}
+			continue
+		case unix.EAGAIN:
+		default:
+			log.Warningf("gofer.recaller: reading recalls failed: %v", err)
+			return
+		}
+		select {
+		case <-ch:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// recall gives up the delegation held through the gofer FD id. The gofer only
+// asks the sentry to return write delegations, and returns read delegations
+// by itself, so delegations are never downgraded.
+func (r *recaller) recall(id lisafs.FDID) {
+	r.mu.Lock()
+	d := r.dentries[id]
+	r.mu.Unlock()
+	if d == nil {
+		// The delegation was already returned.
+		return
+	}
+	ctx := context.Background()
+
+	d.handleMu.RLock()
+	typ := d.delegation
+	held := d.delegationFD == id
+	d.handleMu.RUnlock()
+	if !held {
+		return
+	}
+	if typ == delegationWrite {
+		// Make cached writes visible to the conflicting user of the file.
+		if err := d.writeback(ctx, 0, math.MaxInt64); err != nil {
+			log.Warningf("gofer.recaller: failed to write back dirty data: %v", err)
+		}
+	}
+
+	d.handleMu.Lock()
+	if d.delegationFD != id {
+		d.handleMu.Unlock()
+		return
+	}
+	if typ == delegationWrite {
+		fd := d.fs.client.NewFD(id)
+		if err := fd.Delegate(ctx, unix.F_UNLCK); err != nil {
+			log.Warningf("gofer.recaller: Delegate failed: %v", err)
+		}
+	}
+	d.forgetDelegationLocked()
+	d.handleMu.Unlock()
+
+	// The file may now be changed outside of the sandbox. Metadata and data
+	// are refreshed after the delegation is returned, since the conflicting
+	// open may be holding up sentry operations on d until then.
+	d.dropCleanCachedData()
+	if err := d.updateMetadata(ctx); err != nil {
+		log.Debugf("gofer.recaller: failed to update metadata: %v", err)
+	}
+}
@@ -18,7 +18,6 @@ import (
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
-	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/fsutil"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
@@ -267,8 +266,7 @@ func (d *dentry) listXattrImpl(ctx context.Context, size uint64) ([]string, erro
 	case *lisafsDentry:
 		return dt.controlFD.ListXattr(ctx, size)
 	case *directfsDentry:
-		// Consistent with runsc/fsgofer.
-		return nil, linuxerr.EOPNOTSUPP
+		return dt.listXattr()
 	default:
 		panic("unknown dentry implementation")
 	}
@@ -280,8 +278,7 @@ func (d *dentry) getXattrImpl(ctx context.Context, opts *vfs.GetXattrOptions) (s
 	case *lisafsDentry:
 		return dt.controlFD.GetXattr(ctx, opts.Name, opts.Size)
 	case *directfsDentry:
-		// Consistent with runsc/fsgofer.
-		return "", linuxerr.EOPNOTSUPP
+		return dt.getXattr(opts.Name, opts.Size)
 	default:
 		panic("unknown dentry implementation")
 	}
@@ -293,8 +290,7 @@ func (d *dentry) setXattrImpl(ctx context.Context, opts *vfs.SetXattrOptions) er
 	case *lisafsDentry:
 		return dt.controlFD.SetXattr(ctx, opts.Name, opts.Value, opts.Flags)
 	case *directfsDentry:
-		// Consistent with runsc/fsgofer.
-		return linuxerr.EOPNOTSUPP
+		return dt.setXattr(opts)
 	default:
 		panic("unknown dentry implementation")
 	}
@@ -306,8 +302,7 @@ func (d *dentry) removeXattrImpl(ctx context.Context, name string) error {
 	case *lisafsDentry:
 		return dt.controlFD.RemoveXattr(ctx, name)
 	case *directfsDentry:
-		// Consistent with runsc/fsgofer.
-		return linuxerr.EOPNOTSUPP
+		return dt.removeXattr(name)
 	default:
 		panic("unknown dentry implementation")
 	}
@@ -457,12 +452,17 @@ func (d *dentry) unlink(ctx context.Context, name string, flags uint32) error {
 	}
 }
 
-// Precondition: !d.isSynthetic().
-func (d *dentry) rename(ctx context.Context, oldName string, newParent *dentry, newName string) error {
+// Preconditions:
+//   - !d.isSynthetic().
+//   - flags is 0 unless directfs is enabled.
+func (d *dentry) rename(ctx context.Context, oldName string, newParent *dentry, newName string, flags uint32) error {
 	switch dt := d.impl.(type) {
 	case *lisafsDentry:
 		return dt.controlFD.RenameAt(ctx, oldName, newParent.impl.(*lisafsDentry).controlFD.ID(), newName)
 	case *directfsDentry:
+		if flags != 0 {
+			return fsutil.RenameAt2(dt.controlFD, oldName, newParent.impl.(*directfsDentry).controlFD, newName, flags)
+		}
 		return fsutil.RenameAt(dt.controlFD, oldName, newParent.impl.(*directfsDentry).controlFD, newName)
 	default:
 		panic("unknown dentry implementation")
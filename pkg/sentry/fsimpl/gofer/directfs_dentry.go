@@ -19,6 +19,7 @@ import (
 	"math"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -633,6 +634,114 @@ func (d *directfsDentry) statfs() (linux.Statfs, error) {
 	}, nil
 }
 
+// withXattrFD calls fn with a host FD that f*xattr(2) can be used on.
+//
+// The control FD of a regular file or directory is opened O_RDONLY if the
+// file is readable, which is sufficient. Otherwise it is an O_PATH FD, and we
+// use the read handle if one exists, since we can't reopen the file from
+// here without holding fs.renameMu.
+func (d *directfsDentry) withXattrFD(fn func(hostFD int) error) error {
+	if !d.isRegularFile() && !d.isDir() {
+		// Linux only permits user xattrs on regular files and directories.
+		// Other file types are opened with O_PATH anyway.
+		return unix.EOPNOTSUPP
+	}
+	if err := fn(d.controlFD); err != unix.EBADF {
+		return err
+	}
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	if readFD := d.readFD.RacyLoad(); readFD >= 0 {
+		return fn(int(readFD))
+	}
+	return unix.EOPNOTSUPP
+}
+
+// directfs only passes through xattrs in the "user" namespace. Other
+// namespaces may affect the host's behavior, e.g. "security.capability" can
+// grant capabilities to host executables.
+func directfsXattrAllowed(name string) bool {
+	return strings.HasPrefix(name, linux.XATTR_USER_PREFIX)
+}
+
+func (d *directfsDentry) listXattr() ([]string, error) {
+	var names []string
+	err := d.withXattrFD(func(hostFD int) error {
+		// Retry if the list grows between the two calls.
+		for {
+			n, err := unix.Flistxattr(hostFD, nil)
+			if err != nil || n == 0 {
+				return err
+			}
+			buf := make([]byte, n)
+			n, err = unix.Flistxattr(hostFD, buf)
+			if err == unix.ERANGE {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			for _, name := range strings.Split(string(buf[:n]), "\x00") {
+				if directfsXattrAllowed(name) {
+					names = append(names, name)
+				}
+			}
+			return nil
+		}
+	})
+	return names, err
+}
+
+func (d *directfsDentry) getXattr(name string, size uint64) (string, error) {
+	if !directfsXattrAllowed(name) {
+		// Consistent with tmpfs.
+		return "", unix.ENODATA
+	}
+	var value string
+	err := d.withXattrFD(func(hostFD int) error {
+		// Get the value's size first, and retry if it grows before it is
+		// read. The syscall layer checks the result against size.
+		for {
+			n, err := unix.Fgetxattr(hostFD, name, nil)
+			if err != nil {
+				return err
+			}
+			if n > linux.XATTR_SIZE_MAX || (size != 0 && uint64(n) > size) {
+				return unix.ERANGE
+			}
+			buf := make([]byte, n)
+			n, err = unix.Fgetxattr(hostFD, name, buf)
+			if err == unix.ERANGE {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			value = string(buf[:n])
+			return nil
+		}
+	})
+	return value, err
+}
+
+func (d *directfsDentry) setXattr(opts *vfs.SetXattrOptions) error {
+	if !directfsXattrAllowed(opts.Name) {
+		return unix.EOPNOTSUPP
+	}
+	return d.withXattrFD(func(hostFD int) error {
+		return unix.Fsetxattr(hostFD, opts.Name, []byte(opts.Value), int(opts.Flags))
+	})
+}
+
+func (d *directfsDentry) removeXattr(name string) error {
+	if !directfsXattrAllowed(name) {
+		return unix.EOPNOTSUPP
+	}
+	return d.withXattrFD(func(hostFD int) error {
+		return unix.Fremovexattr(hostFD, name)
+	})
+}
+
 func (d *directfsDentry) restoreFile(ctx context.Context, controlFD int, opts *vfs.CompleteRestoreOptions) error {
 	if controlFD < 0 {
 		log.Warningf("directfsDentry.restoreFile called with invalid controlFD")
@@ -533,7 +533,7 @@ func (fs *filesystem) doCreateAt(ctx context.Context, rp *vfs.ResolvingPath, dir
 	if dir {
 		ev |= linux.IN_ISDIR
 	}
-	parent.watches.Notify(ctx, name, uint32(ev), 0, vfs.InodeEvent, false /* unlinked */)
+	parent.notify(ctx, name, uint32(ev), 0, vfs.InodeEvent, false /* unlinked */)
 	return nil
 }
 
@@ -698,14 +698,21 @@ func (fs *filesystem) unlinkAt(ctx context.Context, rp *vfs.ResolvingPath, dir b
 
 	// Generate inotify events for rmdir or unlink.
 	if dir {
-		parent.watches.Notify(ctx, name, linux.IN_DELETE|linux.IN_ISDIR, 0, vfs.InodeEvent, true /* unlinked */)
+		parent.notify(ctx, name, linux.IN_DELETE|linux.IN_ISDIR, 0, vfs.InodeEvent, true /* unlinked */)
 	} else {
 		var cw *vfs.Watches
 		if child != nil {
 			cw = &child.watches
+			child.expectHostEvents("", linux.IN_ATTRIB)
 		}
+		parent.expectHostEvents(name, linux.IN_DELETE)
 		vfs.InotifyRemoveChild(ctx, cw, &parent.watches, name)
 	}
+	if child != nil {
+		// The sentry generates IN_DELETE_SELF when child is destroyed, which may
+		// happen long after the host reports it.
+		child.expectHostEvents("", linux.IN_DELETE_SELF)
+	}
 
 	parent.childrenMu.Lock()
 	defer parent.childrenMu.Unlock()
@@ -1076,9 +1083,23 @@ func (d *dentry) open(ctx context.Context, rp *vfs.ResolvingPath, opts *vfs.Open
 	switch d.fileType() {
 	case linux.S_IFREG:
 		if !d.fs.opts.regularFilesUseSpecialFileFD {
+			if d.fs.opts.closeToOpen && !d.fs.opts.delegations && !trunc && !d.isSynthetic() {
+				if err := d.revalidateCachedData(ctx); err != nil {
+					return nil, err
+				}
+			}
 			if err := d.ensureSharedHandle(ctx, ats.MayRead(), ats.MayWrite(), trunc); err != nil {
 				return nil, err
 			}
+			if d.fs.opts.delegations && !trunc && !d.isSynthetic() {
+				// Cached data can only be trusted if the file was already
+				// delegated before it was opened.
+				if !d.ensureDelegation(ctx) {
+					if err := d.revalidateCachedData(ctx); err != nil {
+						return nil, err
+					}
+				}
+			}
 			fd, err := newRegularFileFD(mnt, d, opts.Flags)
 			if err != nil {
 				return nil, err
@@ -1308,7 +1329,7 @@ func (d *dentry) createAndOpenChildLocked(ctx context.Context, rp *vfs.Resolving
 		}
 		childVFSFD = &fd.vfsfd
 	}
-	d.watches.Notify(ctx, name, linux.IN_CREATE, 0, vfs.PathEvent, false /* unlinked */)
+	d.notify(ctx, name, linux.IN_CREATE, 0, vfs.PathEvent, false /* unlinked */)
 	return childVFSFD, nil
 }
 
@@ -1349,9 +1370,9 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 	if opts.Flags&^linux.RENAME_NOREPLACE != 0 {
 		return linuxerr.EINVAL
 	}
-	if fs.opts.interop == InteropModeShared && opts.Flags&linux.RENAME_NOREPLACE != 0 {
+	if fs.opts.interop == InteropModeShared && opts.Flags&linux.RENAME_NOREPLACE != 0 && !fs.opts.directfs.enabled {
 		// Requires 9P support to synchronize with other remote filesystem
-		// users.
+		// users. With directfs, the host enforces it in renameat2(2).
 		return linuxerr.EINVAL
 	}
 
@@ -1464,7 +1485,11 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 
 	// Update the remote filesystem.
 	if !renamed.isSynthetic() {
-		if err := oldParent.rename(ctx, oldName, newParent, newName); err != nil {
+		var flags uint32
+		if fs.opts.directfs.enabled {
+			flags = opts.Flags
+		}
+		if err := oldParent.rename(ctx, oldName, newParent, newName, flags); err != nil {
 			vfsObj.AbortRenameDentry(&renamed.vfsd, replacedVFSD)
 			return err
 		}
@@ -1533,6 +1558,9 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 			newParent.incLinks()
 		}
 	}
+	oldParent.expectHostEvents(oldName, linux.IN_MOVED_FROM)
+	newParent.expectHostEvents(newName, linux.IN_MOVED_TO)
+	renamed.expectHostEvents("", linux.IN_MOVE_SELF)
 	vfs.InotifyRename(ctx, &renamed.watches, &oldParent.watches, &newParent.watches, oldName, newName, renamed.isDir())
 	return nil
 }
@@ -1779,6 +1807,18 @@ func (fs *filesystem) MountOptions() string {
 	if fs.opts.directfs.enabled {
 		optsKV = append(optsKV, mopt{moptDirectfs, nil})
 	}
+	if fs.opts.readahead != defaultReadahead {
+		optsKV = append(optsKV, mopt{moptReadahead, fs.opts.readahead})
+	}
+	if fs.opts.writebackInterval != 0 {
+		optsKV = append(optsKV, mopt{moptWritebackInterval, fs.opts.writebackInterval})
+	}
+	if fs.opts.closeToOpen {
+		optsKV = append(optsKV, mopt{moptCloseToOpen, nil})
+	}
+	if fs.opts.delegations {
+		optsKV = append(optsKV, mopt{moptDelegations, nil})
+	}
 
 	opts := make([]string, 0, len(optsKV))
 	for _, opt := range optsKV {
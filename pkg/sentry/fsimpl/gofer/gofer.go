@@ -30,9 +30,20 @@
 //	            *** "memmap.Mappable locks taken by Translate" below this point
 //	            dentry.handleMu
 //	              dentry.dataMu
+//	                filesystem.writebackMu
+//	              filesystem.recallerMu
+//	                recaller.mu
 //	          filesystem.inoMu
 //	specialFileFD.mu
 //	  specialFileFD.bufMu
+//	filesystem.writebackRunMu
+//	  filesystem.syncMu
+//	  dentry.handleMu
+//	    dentry.dataMu
+//	dentry.hostWatchMu
+//	  filesystem.renameMu
+//	  filesystem.hostWatcherMu
+//	  hostWatcher.mu
 //
 // Locking dentry.opMu and dentry.metadataMu in multiple dentries requires that
 // either ancestor dentries are locked before descendant dentries, or that
@@ -45,6 +56,7 @@ import (
 	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -86,6 +98,11 @@ const (
 	moptOverlayfsStaleRead       = "overlayfs_stale_read"
 	moptDisableFileHandleSharing = "disable_file_handle_sharing"
 	moptDisableFifoOpen          = "disable_fifo_open"
+	moptHostLocks                = "host_locks"
+	moptReadahead                = "readahead"
+	moptWritebackInterval        = "writeback_interval"
+	moptCloseToOpen              = "close_to_open"
+	moptDelegations              = "delegations"
 
 	// Directfs options.
 	moptDirectfs = "directfs"
@@ -101,6 +118,10 @@ const (
 const (
 	defaultMaxCachedDentries  = 1000
 	maxCachedNegativeChildren = 1000
+
+	// defaultReadahead is the default value of the "readahead" mount option,
+	// in bytes. It was chosen arbitrarily.
+	defaultReadahead = 64 << 10
 )
 
 // stringFixedCache is a fixed sized cache, once initialized,
@@ -238,6 +259,27 @@ type filesystem struct {
 
 	// released is nonzero once filesystem.Release has been called.
 	released atomicbitops.Int32
+
+	// hostWatcher delivers inotify events for changes made on the host. It is
+	// nil until a dentry gains its first inotify watch, or if the gofer
+	// doesn't forward host events. hostWatcher is protected by hostWatcherMu.
+	hostWatcherMu sync.Mutex   `state:"nosave"`
+	hostWatcher   *hostWatcher `state:"nosave"`
+
+	// recaller handles delegation recalls from the gofer. It is nil until a
+	// file is first delegated. recaller is protected by recallerMu.
+	recallerMu sync.Mutex `state:"nosave"`
+	recaller   *recaller  `state:"nosave"`
+
+	// If writebackTimer is not nil, it writes dirty cached file data back to
+	// the remote filesystem when it fires. It is armed when data is first
+	// dirtied after the previous writeback, if opts.writebackInterval is
+	// non-zero. writebackTimer is protected by writebackMu.
+	writebackMu    sync.Mutex  `state:"nosave"`
+	writebackTimer *time.Timer `state:"nosave"`
+
+	// writebackRunMu is held while writebackTimer's callback runs.
+	writebackRunMu sync.Mutex `state:"nosave"`
 }
 
 // +stateify savable
@@ -282,6 +324,39 @@ type filesystemOptions struct {
 	// are disallowed.
 	disableFifoOpen bool
 
+	// If hostLocks is true, advisory file locks are also taken on the host
+	// files, through the gofer.
+	hostLocks bool
+
+	// readahead is the maximum number of bytes read into the page cache
+	// around a read that misses it. Larger values reduce the number of
+	// round trips to the remote filesystem for sequential reads, at the cost
+	// of memory.
+	readahead uint64
+
+	// If writebackInterval is non-zero, dirty cached file data is written back
+	// to the remote filesystem at most writebackInterval after it is dirtied.
+	// Otherwise, it is only written back on sync, eviction, and in the cases
+	// required by the interop mode.
+	writebackInterval time.Duration
+
+	// If closeToOpen is true, regular files have close-to-open consistency:
+	// closing a writable file writes all of its dirty cached data back to the
+	// remote filesystem, and opening a file drops its cached data if the
+	// remote file changed since it was cached. This is only meaningful under
+	// InteropModeExclusive, where cached data is otherwise trusted
+	// indefinitely.
+	closeToOpen bool
+
+	// If delegations is true, regular files opened through lisafs hold
+	// delegations from the gofer while they are open. Cached data and metadata
+	// of a file are trusted while it is delegated, and are dropped when the
+	// gofer recalls the delegation because the file is opened outside of the
+	// sandbox. Files that can't be delegated are revalidated when they are
+	// opened, as with closeToOpen. Like closeToOpen, this is only meaningful
+	// when InteropModeShared is not in effect.
+	delegations bool
+
 	// directfs holds options for directfs mode.
 	directfs directfsOpts
 }
@@ -470,6 +545,10 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		delete(mopts, moptDisableFifoOpen)
 		fsopts.disableFifoOpen = true
 	}
+	if _, ok := mopts[moptHostLocks]; ok {
+		delete(mopts, moptHostLocks)
+		fsopts.hostLocks = true
+	}
 	if _, ok := mopts[moptForcePageCache]; ok {
 		delete(mopts, moptForcePageCache)
 		fsopts.forcePageCache = true
@@ -486,9 +565,45 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		delete(mopts, moptDirectfs)
 		fsopts.directfs.enabled = true
 	}
+	if _, ok := mopts[moptCloseToOpen]; ok {
+		delete(mopts, moptCloseToOpen)
+		fsopts.closeToOpen = true
+	}
+	if _, ok := mopts[moptDelegations]; ok {
+		delete(mopts, moptDelegations)
+		fsopts.delegations = true
+	}
+
 	// fsopts.regularFilesUseSpecialFileFD can only be enabled by specifying
 	// "cache=none".
 
+	// Parse the page cache tunables.
+	fsopts.readahead = defaultReadahead
+	if readaheadstr, ok := mopts[moptReadahead]; ok {
+		delete(mopts, moptReadahead)
+		readahead, err := strconv.ParseUint(readaheadstr, 10, 64)
+		if err != nil {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid readahead: %s=%s", moptReadahead, readaheadstr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		// Readahead is done in units of pages.
+		readaheadPages, ok := hostarch.PageRoundUp(readahead)
+		if !ok {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: readahead too large: %s=%s", moptReadahead, readaheadstr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.readahead = readaheadPages
+	}
+	if intervalstr, ok := mopts[moptWritebackInterval]; ok {
+		delete(mopts, moptWritebackInterval)
+		interval, err := time.ParseDuration(intervalstr)
+		if err != nil || interval < 0 {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid writeback interval: %s=%s", moptWritebackInterval, intervalstr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.writebackInterval = interval
+	}
+
 	// Check for unparsed options.
 	if len(mopts) != 0 {
 		ctx.Warningf("gofer.FilesystemType.GetFilesystem: unknown options: %v", mopts)
@@ -656,6 +771,9 @@ func getFDFromMountOptionsMap(ctx context.Context, mopts map[string]string) (int
 // Release implements vfs.FilesystemImpl.Release.
 func (fs *filesystem) Release(ctx context.Context) {
 	fs.released.Store(1)
+	fs.releaseHostWatcher()
+	fs.releaseRecaller()
+	fs.cancelWriteback()
 
 	mf := fs.mfp.MemoryFile()
 	fs.syncMu.Lock()
@@ -970,6 +1088,19 @@ type dentry struct {
 
 	locks vfs.FileLocks
 
+	// hostLockFDs maps lock owners to the open FDs through which their locks
+	// are taken on the host, if the filesystem delegates locks to the host.
+	// hostLockFDs is protected by hostLocksMu.
+	hostLocksMu sync.Mutex                          `state:"nosave"`
+	hostLockFDs map[fslock.UniqueID]lisafs.ClientFD `state:"nosave"`
+
+	// If delegation is not delegationNone, the gofer has delegated this
+	// regular file through delegationFD, which is the ID of
+	// lisafsDentry.readFDLisa. delegation and delegationFD are protected by
+	// handleMu.
+	delegation   delegationType `state:"nosave"`
+	delegationFD lisafs.FDID    `state:"nosave"`
+
 	// Inotify watches for this dentry.
 	//
 	// Note that inotify may behave unexpectedly in the presence of hard links,
@@ -980,6 +1111,15 @@ type dentry struct {
 	// a more in-depth discussion on this matter).
 	watches vfs.Watches
 
+	// hostWatchMu serializes starting and stopping the host inotify watch for
+	// this dentry. See dentry.syncHostWatch.
+	hostWatchMu sync.Mutex `state:"nosave"`
+
+	// hostWatched is true while the gofer forwards host inotify events for
+	// this dentry. It is a hint that lets the sentry skip hostWatcher
+	// bookkeeping for unwatched dentries; hostWatcher.wds is authoritative.
+	hostWatched atomicbitops.Bool `state:"nosave"`
+
 	// impl is the specific dentry implementation for non-synthetic dentries.
 	// impl is immutable.
 	//
@@ -1411,6 +1551,14 @@ func (d *dentry) checkXattrPermissions(creds *auth.Credentials, name string, ats
 	if strings.HasPrefix(name, linux.XATTR_SYSTEM_PREFIX) || strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) {
 		return linuxerr.EOPNOTSUPP
 	}
+	// The "security" namespace is not passed through either, since the
+	// remote filesystem's security labels are meaningless in the sandbox.
+	if strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX) {
+		if ats.MayWrite() {
+			return linuxerr.EOPNOTSUPP
+		}
+		return linuxerr.ENODATA
+	}
 	mode := linux.FileMode(d.mode.Load())
 	kuid := auth.KUID(d.uid.Load())
 	kgid := auth.KGID(d.gid.Load())
@@ -1518,9 +1666,9 @@ func (d *dentry) InotifyWithParent(ctx context.Context, events, cookie uint32, e
 	d.fs.renameMu.RLock()
 	// The ordering below is important, Linux always notifies the parent first.
 	if parent := d.parent.Load(); parent != nil {
-		parent.watches.Notify(ctx, d.name, events, cookie, et, d.isDeleted())
+		parent.notify(ctx, d.name, events, cookie, et, d.isDeleted())
 	}
-	d.watches.Notify(ctx, "", events, cookie, et, d.isDeleted())
+	d.notify(ctx, "", events, cookie, et, d.isDeleted())
 	d.fs.renameMu.RUnlock()
 }
 
@@ -1533,6 +1681,7 @@ func (d *dentry) Watches() *vfs.Watches {
 //
 // If no watches are left on this dentry and it has no references, cache it.
 func (d *dentry) OnZeroWatches(ctx context.Context) {
+	d.syncHostWatch(ctx)
 	d.checkCachingLocked(ctx, false /* renameMuWriteLocked */)
 }
 
@@ -1589,6 +1738,7 @@ func (d *dentry) checkCachingLocked(ctx context.Context, renameMuWriteLocked boo
 			}
 		}
 		if d.isDeleted() {
+			d.forgetHostWatch()
 			d.watches.HandleDeletion(ctx)
 		}
 		d.destroyLocked(ctx) // +checklocksforce: renameMu must be acquired at this point.
@@ -1783,6 +1933,8 @@ func (d *dentry) destroyDisconnected(ctx context.Context) {
 	d.dataMu.Unlock()
 
 	// Close any resources held by the implementation.
+	d.forgetDelegationLocked()
+	d.closeHostLockFDs(ctx)
 	d.destroyImpl(ctx)
 
 	// Can use RacyLoad() because handleMu is locked.
@@ -1924,6 +2076,9 @@ func (d *dentry) ensureSharedHandle(ctx context.Context, read, write, trunc bool
 		d.handleMu.Unlock()
 		return nil
 	}
+	// The new handle would conflict with a delegation held through the
+	// current ones.
+	d.returnDelegationLocked(ctx)
 
 	var fdsToCloseArr [2]int32
 	fdsToClose := fdsToCloseArr[:0]
@@ -2194,23 +2349,67 @@ func (fd *fileDescription) RemoveXattr(ctx context.Context, name string) error {
 
 // LockBSD implements vfs.FileDescriptionImpl.LockBSD.
 func (fd *fileDescription) LockBSD(ctx context.Context, uid fslock.UniqueID, ownerPID int32, t fslock.LockType, block bool) error {
-	fd.lockLogging.Do(func() {
-		log.Infof("File lock using gofer file handled internally.")
-	})
-	return fd.LockFD.LockBSD(ctx, uid, ownerPID, t, block)
+	d := fd.dentry()
+	if !d.hostLocksEnabled() {
+		fd.lockLogging.Do(func() {
+			log.Infof("File lock using gofer file handled internally.")
+		})
+		return fd.LockFD.LockBSD(ctx, uid, ownerPID, t, block)
+	}
+	if err := fd.LockFD.LockBSD(ctx, uid, ownerPID, t, block); err != nil {
+		return err
+	}
+	whole := fslock.LockRange{Start: 0, End: fslock.LockEOF}
+	if err := d.setHostLock(ctx, uid, lisafs.LockKindBSD, t, whole, block); err != nil {
+		// As on Linux, a failed lock conversion drops the lock held before.
+		fd.LockFD.UnlockBSD(ctx, uid)
+		d.releaseHostLocks(ctx, uid)
+		return err
+	}
+	return nil
+}
+
+// UnlockBSD implements vfs.FileDescriptionImpl.UnlockBSD.
+func (fd *fileDescription) UnlockBSD(ctx context.Context, uid fslock.UniqueID) error {
+	err := fd.LockFD.UnlockBSD(ctx, uid)
+	if d := fd.dentry(); d.hostLocksEnabled() {
+		d.releaseHostLocks(ctx, uid)
+	}
+	return err
 }
 
 // LockPOSIX implements vfs.FileDescriptionImpl.LockPOSIX.
 func (fd *fileDescription) LockPOSIX(ctx context.Context, uid fslock.UniqueID, ownerPID int32, t fslock.LockType, r fslock.LockRange, block bool) error {
-	fd.lockLogging.Do(func() {
-		log.Infof("Range lock using gofer file handled internally.")
-	})
-	return fd.Locks().LockPOSIX(ctx, uid, ownerPID, t, r, block)
+	d := fd.dentry()
+	if !d.hostLocksEnabled() {
+		fd.lockLogging.Do(func() {
+			log.Infof("Range lock using gofer file handled internally.")
+		})
+		return fd.Locks().LockPOSIX(ctx, uid, ownerPID, t, r, block)
+	}
+	held := fd.Locks().HeldPOSIX(uid, r)
+	if err := fd.Locks().LockPOSIX(ctx, uid, ownerPID, t, r, block); err != nil {
+		return err
+	}
+	if err := d.setHostLock(ctx, uid, lisafs.LockKindPOSIX, t, r, block); err != nil {
+		// As on Linux, a failed F_SETLK leaves the locks held before in place.
+		// The host lock is set atomically, so it is left unchanged; restore
+		// the locks in the sandbox to match.
+		fd.Locks().RestorePOSIX(uid, r, held)
+		return err
+	}
+	return nil
 }
 
 // UnlockPOSIX implements vfs.FileDescriptionImpl.UnlockPOSIX.
 func (fd *fileDescription) UnlockPOSIX(ctx context.Context, uid fslock.UniqueID, r fslock.LockRange) error {
-	return fd.Locks().UnlockPOSIX(ctx, uid, r)
+	if err := fd.Locks().UnlockPOSIX(ctx, uid, r); err != nil {
+		return err
+	}
+	if d := fd.dentry(); d.hostLocksEnabled() {
+		return d.unlockHostRange(ctx, uid, r)
+	}
+	return nil
 }
 
 // resolvingPath is just a wrapper around *vfs.ResolvingPath. It additionally
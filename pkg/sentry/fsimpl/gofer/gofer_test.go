@@ -21,6 +21,7 @@ import (
 	"gvisor.dev/gvisor/pkg/lisafs"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 )
 
@@ -100,3 +101,103 @@ func TestStringFixedCache(t *testing.T) {
 		}
 	}
 }
+
+func TestMaxFillRange(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		required     memmap.MappableRange
+		optional     memmap.MappableRange
+		maxReadahead uint64
+		want         memmap.MappableRange
+	}{
+		{
+			name:         "optional fits",
+			required:     memmap.MappableRange{0x1000, 0x2000},
+			optional:     memmap.MappableRange{0, 0x4000},
+			maxReadahead: 0x10000,
+			want:         memmap.MappableRange{0, 0x4000},
+		},
+		{
+			name:         "optional after required fits",
+			required:     memmap.MappableRange{0x1000, 0x2000},
+			optional:     memmap.MappableRange{0, 0x4000},
+			maxReadahead: 0x3000,
+			want:         memmap.MappableRange{0x1000, 0x4000},
+		},
+		{
+			name:         "optional truncated",
+			required:     memmap.MappableRange{0x1000, 0x2000},
+			optional:     memmap.MappableRange{0, 0x100000},
+			maxReadahead: 0x4000,
+			want:         memmap.MappableRange{0x1000, 0x5000},
+		},
+		{
+			name:         "required exceeds readahead",
+			required:     memmap.MappableRange{0x1000, 0x9000},
+			optional:     memmap.MappableRange{0, 0x100000},
+			maxReadahead: 0x4000,
+			want:         memmap.MappableRange{0x1000, 0x9000},
+		},
+		{
+			name:         "no readahead",
+			required:     memmap.MappableRange{0x1000, 0x2000},
+			optional:     memmap.MappableRange{0, 0x100000},
+			maxReadahead: 0,
+			want:         memmap.MappableRange{0x1000, 0x2000},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := maxFillRange(tc.required, tc.optional, tc.maxReadahead); got != tc.want {
+				t.Errorf("maxFillRange(%v, %v, %#x) = %v, want %v", tc.required, tc.optional, tc.maxReadahead, got, tc.want)
+			}
+		})
+	}
+}
+
+func hostEvent(wd int32, mask uint32, name string) []byte {
+	hdr := lisafs.InotifyEvent{WD: wd, Mask: mask, NameLen: uint32(len(name))}
+	buf := make([]byte, hdr.SizeBytes()+len(name))
+	copy(hdr.MarshalUnsafe(buf), name)
+	return buf
+}
+
+func TestHostWatcherDropsEchoes(t *testing.T) {
+	d := &dentry{}
+	w := &hostWatcher{
+		dentries: map[int32]map[*dentry]struct{}{1: {d: {}}},
+		wds:      map[*dentry]int32{d: 1},
+		expected: make(map[hostEventKey]expectedEvents),
+		stopped:  true,
+	}
+
+	// The sentry's event comes first.
+	w.expect(d, "foo", linux.IN_CREATE|linux.IN_ISDIR)
+	w.hold(hostEvent(1, linux.IN_CREATE|linux.IN_ISDIR, "foo"))
+	if len(w.held) != 0 || len(w.expected) != 0 {
+		t.Errorf("echo of a sentry event wasn't dropped: held %+v, expected %+v", w.held, w.expected)
+	}
+
+	// The host's event comes first.
+	w.hold(hostEvent(1, linux.IN_DELETE, "foo"))
+	if len(w.held) != 1 {
+		t.Fatalf("got %d held events, want 1", len(w.held))
+	}
+	w.expect(d, "foo", linux.IN_DELETE)
+	if len(w.held) != 0 || len(w.expected) != 0 {
+		t.Errorf("held echo of a sentry event wasn't dropped: held %+v, expected %+v", w.held, w.expected)
+	}
+
+	// Changes the sentry didn't make are delivered.
+	w.expect(d, "foo", linux.IN_MODIFY)
+	w.hold(hostEvent(1, linux.IN_MODIFY, "bar"))
+	w.hold(hostEvent(1, linux.IN_ATTRIB, "foo"))
+	if len(w.held) != 2 {
+		t.Errorf("got %d held events, want 2", len(w.held))
+	}
+
+	// Forgetting d drops its pending events.
+	w.forgetLocked(d)
+	if len(w.held) != 0 || len(w.expected) != 0 || len(w.dentries) != 0 {
+		t.Errorf("forgotten dentry has pending events: held %+v, expected %+v", w.held, w.expected)
+	}
+}
@@ -0,0 +1,553 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"bytes"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fdnotifier"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// hostWatchEvents is the mask of events requested from the gofer. Events
+	// are filtered according to the mask of each sandbox watch when delivered.
+	hostWatchEvents = linux.IN_ALL_EVENTS
+
+	// hostEventDelay is how long events read from the gofer are held back
+	// before they are delivered, so that the sentry can claim the ones that
+	// report its own changes even if the host reported them first.
+	hostEventDelay = 20 * time.Millisecond
+
+	// hostEchoTimeout is how long an event generated by the sentry suppresses
+	// the same event reported by the host.
+	hostEchoTimeout = time.Second
+)
+
+// hostEventKey identifies the events reported for a change to a dentry, or to
+// one of its children if name is not empty. mask has a single event bit set.
+type hostEventKey struct {
+	d    *dentry
+	name string
+	mask uint32
+}
+
+// newHostEventKey returns the key for an event on d. IN_ISDIR is ignored,
+// since the sentry and the host don't agree on when it is set.
+func newHostEventKey(d *dentry, name string, mask uint32) hostEventKey {
+	return hostEventKey{d: d, name: name, mask: mask &^ linux.IN_ISDIR}
+}
+
+// expectedEvents counts events generated by the sentry that the host has not
+// reported yet.
+type expectedEvents struct {
+	count    int
+	deadline time.Time
+}
+
+// heldEvent is an event reported by the host that hasn't been delivered yet.
+type heldEvent struct {
+	key      hostEventKey
+	mask     uint32
+	cookie   uint32
+	deadline time.Time
+}
+
+// hostWatcher delivers inotify events for changes made to the host files
+// backing a filesystem, e.g. by processes outside of the sandbox, to the
+// inotify watches on the corresponding dentries. The gofer watches host files
+// on behalf of the sentry and forwards events over an FD donated by the
+// InotifyInit RPC.
+//
+// Changes made by the sandbox itself are also reported by the host, duplicating
+// the events generated by the sentry. The sentry records the events it
+// generates for watched dentries (dentry.notify), and a host event that
+// matches one of them is dropped. Since either side may come first, host
+// events are delivered after hostEventDelay. A change made outside of the
+// sandbox that matches a recent sentry event is indistinguishable from its
+// echo and is dropped too.
+//
+// Host watches are not preserved across checkpoint/restore.
+type hostWatcher struct {
+	fs *filesystem
+
+	// eventFD is the host FD from which events are read. It is immutable.
+	eventFD int
+
+	// queue is notified when eventFD is readable.
+	queue waiter.Queue
+
+	// stop is closed to stop the event loop.
+	stop chan struct{}
+
+	// done is closed when the event loop exits.
+	done chan struct{}
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// dentries maps gofer watch descriptors to the watched dentries. Dentries
+	// that are hard links to the same host file share a watch descriptor.
+	dentries map[int32]map[*dentry]struct{}
+
+	// wds maps each watched dentry to its watch descriptor.
+	wds map[*dentry]int32
+
+	// expected holds the events generated by the sentry for watched dentries
+	// that the host has not reported yet.
+	expected map[hostEventKey]expectedEvents
+
+	// held holds the events reported by the host that haven't been delivered
+	// yet, oldest first.
+	held []heldEvent
+
+	// flushTimer delivers held events. It is nil until an event is held.
+	flushTimer *time.Timer
+
+	// stopped is true once the watcher is released.
+	stopped bool
+}
+
+// getHostWatcher returns the filesystem's hostWatcher, creating it if needed.
+// It returns nil if the gofer doesn't forward host events.
+func (fs *filesystem) getHostWatcher(ctx context.Context) *hostWatcher {
+	fs.hostWatcherMu.Lock()
+	defer fs.hostWatcherMu.Unlock()
+	if fs.hostWatcher != nil || fs.client == nil || !fs.client.IsSupported(lisafs.InotifyInit) {
+		return fs.hostWatcher
+	}
+	eventFD, err := fs.client.InotifyInit(ctx)
+	if err != nil {
+		log.Warningf("gofer.filesystem: InotifyInit failed, host changes won't generate inotify events: %v", err)
+		return nil
+	}
+	w := &hostWatcher{
+		fs:       fs,
+		eventFD:  eventFD,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		dentries: make(map[int32]map[*dentry]struct{}),
+		wds:      make(map[*dentry]int32),
+		expected: make(map[hostEventKey]expectedEvents),
+	}
+	if err := fdnotifier.AddFD(int32(eventFD), &w.queue); err != nil {
+		log.Warningf("gofer.filesystem: failed to register inotify event FD: %v", err)
+		_ = unix.Close(eventFD)
+		return nil
+	}
+	go w.run() // S/R-SAFE: stopped on filesystem release, not saved.
+	fs.hostWatcher = w
+	return w
+}
+
+// releaseHostWatcher stops delivering host events.
+func (fs *filesystem) releaseHostWatcher() {
+	fs.hostWatcherMu.Lock()
+	defer fs.hostWatcherMu.Unlock()
+	if w := fs.hostWatcher; w != nil {
+		close(w.stop)
+		<-w.done
+		w.mu.Lock()
+		w.stopped = true
+		if w.flushTimer != nil {
+			w.flushTimer.Stop()
+		}
+		w.held = nil
+		w.mu.Unlock()
+		fdnotifier.RemoveFD(int32(w.eventFD))
+		_ = unix.Close(w.eventFD)
+		fs.hostWatcher = nil
+	}
+}
+
+// watchTarget returns the gofer FD and the path relative to it that identify
+// the host file backing d.
+//
+// Precondition: d is not synthetic.
+func (d *dentry) watchTarget() (lisafs.ClientFD, []string) {
+	switch dt := d.impl.(type) {
+	case *lisafsDentry:
+		return dt.controlFD, nil
+	case *directfsDentry:
+		// Directfs dentries don't have a gofer FD. The gofer walks from the root
+		// of the mount instead.
+		d.fs.renameMu.RLock()
+		defer d.fs.renameMu.RUnlock()
+		var path []string
+		for cur := d; cur != d.fs.root; cur = cur.parent.Load() {
+			if cur == nil {
+				// d is no longer connected to the root.
+				return lisafs.ClientFD{}, nil
+			}
+			path = append(path, cur.name)
+		}
+		for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+			path[i], path[j] = path[j], path[i]
+		}
+		return d.fs.root.impl.(*directfsDentry).controlFDLisa, path
+	default:
+		panic("unknown dentry implementation")
+	}
+}
+
+// OnFirstWatch implements vfs.OnFirstWatchDentryImpl.OnFirstWatch.
+func (d *dentry) OnFirstWatch(ctx context.Context) {
+	d.syncHostWatch(ctx)
+}
+
+// syncHostWatch starts or stops the host watch for d so that it exists iff d
+// has inotify watches. Watches are added and removed without holding
+// d.hostWatchMu, and the hooks that call syncHostWatch run after the fact, so
+// the number of watches is checked again under d.hostWatchMu: the last call
+// following a change sees its outcome.
+func (d *dentry) syncHostWatch(ctx context.Context) {
+	if d.isSynthetic() {
+		return
+	}
+	d.hostWatchMu.Lock()
+	defer d.hostWatchMu.Unlock()
+	if d.watches.Size() > 0 {
+		d.startHostWatchLocked(ctx)
+	} else {
+		d.stopHostWatchLocked(ctx)
+	}
+}
+
+// startHostWatchLocked starts delivering host events to d.
+//
+// Preconditions: d.hostWatchMu is locked.
+func (d *dentry) startHostWatchLocked(ctx context.Context) {
+	w := d.fs.getHostWatcher(ctx)
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	_, ok := w.wds[d]
+	w.mu.Unlock()
+	if ok {
+		return
+	}
+	fd, path := d.watchTarget()
+	if !fd.Ok() {
+		return
+	}
+	wd, err := fd.InotifyAddWatch(ctx, path, hostWatchEvents)
+	if err != nil {
+		// The file may be unwatchable on the host, e.g. because the host ran out
+		// of watches. Watches in the sandbox still see changes made through the
+		// sentry.
+		log.Debugf("gofer.dentry.startHostWatchLocked: InotifyAddWatch failed: %v", err)
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wds[d] = wd
+	ds := w.dentries[wd]
+	if ds == nil {
+		ds = make(map[*dentry]struct{})
+		w.dentries[wd] = ds
+	}
+	ds[d] = struct{}{}
+	d.hostWatched.Store(true)
+}
+
+// stopHostWatchLocked stops delivering host events to d, and removes the host
+// watch if no other dentry shares it.
+//
+// Preconditions: d.hostWatchMu is locked.
+func (d *dentry) stopHostWatchLocked(ctx context.Context) {
+	d.fs.hostWatcherMu.Lock()
+	w := d.fs.hostWatcher
+	d.fs.hostWatcherMu.Unlock()
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	wd, ok := w.wds[d]
+	last := ok && w.forgetLocked(d)
+	w.mu.Unlock()
+
+	if last {
+		// The gofer removes the host watch by itself if the file is deleted, in
+		// which case this fails harmlessly.
+		if err := d.fs.client.InotifyRmWatch(ctx, wd); err != nil {
+			log.Debugf("gofer.dentry.stopHostWatchLocked: InotifyRmWatch(%d) failed: %v", wd, err)
+		}
+	}
+}
+
+// forgetHostWatch stops delivering host events to d without removing the host
+// watch. It is called when d is destroyed after being deleted, in which case
+// the host removes the watch by itself once the file is gone.
+func (d *dentry) forgetHostWatch() {
+	if !d.hostWatched.Load() {
+		return
+	}
+	d.fs.hostWatcherMu.Lock()
+	w := d.fs.hostWatcher
+	d.fs.hostWatcherMu.Unlock()
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.wds[d]; ok {
+		w.forgetLocked(d)
+	}
+}
+
+// forgetLocked removes d and its pending events from w. It returns true if no
+// other dentry shares d's watch descriptor.
+//
+// Preconditions: w.mu is locked. d is in w.wds.
+func (w *hostWatcher) forgetLocked(d *dentry) bool {
+	wd := w.wds[d]
+	delete(w.wds, d)
+	d.hostWatched.Store(false)
+	ds := w.dentries[wd]
+	delete(ds, d)
+	last := len(ds) == 0
+	if last {
+		delete(w.dentries, wd)
+	}
+	for key := range w.expected {
+		if key.d == d {
+			delete(w.expected, key)
+		}
+	}
+	held := w.held[:0]
+	for _, ev := range w.held {
+		if ev.key.d != d {
+			held = append(held, ev)
+		}
+	}
+	w.held = held
+	return last
+}
+
+// notify notifies d's watches of events generated by the sentry for a change
+// to d, or to its child name if name is not empty.
+func (d *dentry) notify(ctx context.Context, name string, events, cookie uint32, et vfs.EventType, unlinked bool) {
+	d.expectHostEvents(name, events)
+	d.watches.Notify(ctx, name, events, cookie, et, unlinked)
+}
+
+// expectHostEvents records that the sentry generated events for a change to d,
+// or to its child name if name is not empty, so that the host's report of the
+// same change is not delivered again.
+func (d *dentry) expectHostEvents(name string, events uint32) {
+	if !d.hostWatched.Load() {
+		return
+	}
+	d.fs.hostWatcherMu.Lock()
+	w := d.fs.hostWatcher
+	d.fs.hostWatcherMu.Unlock()
+	if w == nil {
+		return
+	}
+	w.expect(d, name, events)
+}
+
+// expect implements dentry.expectHostEvents.
+func (w *hostWatcher) expect(d *dentry, name string, events uint32) {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.wds[d]; !ok {
+		return
+	}
+	events &= linux.IN_ALL_EVENTS
+	for events != 0 {
+		bit := events & -events
+		events &^= bit
+		key := newHostEventKey(d, name, bit)
+		if w.cancelHeldLocked(key) {
+			continue
+		}
+		e := w.expected[key]
+		e.count++
+		e.deadline = now.Add(hostEchoTimeout)
+		w.expected[key] = e
+	}
+	if len(w.expected) > 1024 {
+		for key, e := range w.expected {
+			if now.After(e.deadline) {
+				delete(w.expected, key)
+			}
+		}
+	}
+}
+
+// cancelHeldLocked drops the oldest held event matching key, and returns true
+// if there was one.
+//
+// Preconditions: w.mu is locked.
+func (w *hostWatcher) cancelHeldLocked(key hostEventKey) bool {
+	for i, ev := range w.held {
+		if ev.key == key {
+			w.held = append(w.held[:i], w.held[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// claimExpectedLocked consumes an event generated by the sentry that matches
+// key, and returns true if there was one.
+//
+// Preconditions: w.mu is locked.
+func (w *hostWatcher) claimExpectedLocked(key hostEventKey, now time.Time) bool {
+	e, ok := w.expected[key]
+	if !ok {
+		return false
+	}
+	if now.After(e.deadline) {
+		delete(w.expected, key)
+		return false
+	}
+	if e.count--; e.count == 0 {
+		delete(w.expected, key)
+	} else {
+		w.expected[key] = e
+	}
+	return true
+}
+
+// run reads events from the gofer until the watcher is stopped.
+func (w *hostWatcher) run() {
+	defer close(w.done)
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	w.queue.EventRegister(&e)
+	defer w.queue.EventUnregister(&e)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := unix.Read(w.eventFD, buf)
+		switch err {
+		case nil:
+			if n == 0 {
+				// The gofer closed the connection.
+				return
+			}
+			w.hold(buf[:n])
+			continue
+		case unix.EAGAIN:
+		default:
+			log.Warningf("gofer.hostWatcher: reading events failed: %v", err)
+			return
+		}
+		select {
+		case <-ch:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// hold queues the events in buf for delivery to the watches on the dentries
+// they are about, unless they report changes made by the sentry. The gofer
+// writes whole events, so buf doesn't end mid-event.
+func (w *hostWatcher) hold(buf []byte) {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	held := len(w.held)
+	var hdr lisafs.InotifyEvent
+	for len(buf) >= hdr.SizeBytes() {
+		buf = hdr.UnmarshalUnsafe(buf)
+		if int(hdr.NameLen) > len(buf) {
+			log.Warningf("gofer.hostWatcher: truncated event %+v", hdr)
+			break
+		}
+		name := buf[:hdr.NameLen]
+		buf = buf[hdr.NameLen:]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+
+		if hdr.Mask&linux.IN_Q_OVERFLOW != 0 {
+			log.Warningf("gofer.hostWatcher: host events were dropped")
+			continue
+		}
+		if hdr.Mask&linux.IN_IGNORED != 0 {
+			// The host watch is gone, e.g. because the file was deleted on the
+			// host. Watches in the sandbox are removed when the sentry notices.
+			for d := range w.dentries[hdr.WD] {
+				w.forgetLocked(d)
+			}
+			continue
+		}
+		for d := range w.dentries[hdr.WD] {
+			key := newHostEventKey(d, string(name), hdr.Mask)
+			if w.claimExpectedLocked(key, now) {
+				continue
+			}
+			w.held = append(w.held, heldEvent{
+				key:      key,
+				mask:     hdr.Mask,
+				cookie:   hdr.Cookie,
+				deadline: now.Add(hostEventDelay),
+			})
+		}
+	}
+	if held == 0 && len(w.held) != 0 {
+		w.scheduleFlushLocked(hostEventDelay)
+	}
+}
+
+// scheduleFlushLocked arranges for w.flush to run after delay.
+//
+// Preconditions: w.mu is locked.
+func (w *hostWatcher) scheduleFlushLocked(delay time.Duration) {
+	if w.flushTimer == nil {
+		w.flushTimer = time.AfterFunc(delay, w.flush)
+		return
+	}
+	w.flushTimer.Reset(delay)
+}
+
+// flush delivers the held events whose delay has elapsed.
+func (w *hostWatcher) flush() {
+	ctx := context.Background()
+	now := time.Now()
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return
+	}
+	n := 0
+	for n < len(w.held) && !now.Before(w.held[n].deadline) {
+		n++
+	}
+	ready := append([]heldEvent(nil), w.held[:n]...)
+	w.held = append(w.held[:0], w.held[n:]...)
+	if len(w.held) != 0 {
+		w.scheduleFlushLocked(w.held[0].deadline.Sub(now))
+	}
+	w.mu.Unlock()
+
+	for _, ev := range ready {
+		unlinked := ev.mask&linux.IN_DELETE_SELF != 0
+		ev.key.d.watches.Notify(ctx, ev.key.name, ev.mask, ev.cookie, vfs.InodeEvent, unlinked)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	fslock "gvisor.dev/gvisor/pkg/sentry/fsimpl/lock"
+)
+
+// Host locks.
+//
+// With the "host_locks" mount option, advisory locks taken in the sandbox are
+// also taken on the host file through the gofer, so that they are enforced
+// against other sandboxes and host processes sharing the mount. Locks are
+// first taken in the sentry's lock table, which resolves conflicts between
+// processes in the sandbox, and then on the host.
+//
+// The gofer opens a separate host file description for each lock owner, and
+// takes non-blocking flock(2) and OFD locks on it. OFD locks held through
+// different file descriptions conflict with each other, so host locks of
+// different owners in the sandbox behave like POSIX locks of different
+// processes. Blocking lock requests poll the host until the lock is available.
+//
+// F_GETLK only reports locks held in the sandbox.
+
+const (
+	// hostLockMinBackoff and hostLockMaxBackoff bound the interval between
+	// attempts to take a host lock that is held outside of the sandbox.
+	hostLockMinBackoff = time.Millisecond
+	hostLockMaxBackoff = 100 * time.Millisecond
+)
+
+// hostLocksEnabled returns true if locks on d are delegated to the host.
+func (d *dentry) hostLocksEnabled() bool {
+	return d.fs.opts.hostLocks && !d.isSynthetic() && (d.isRegularFile() || d.isDir()) && d.fs.client.IsSupported(lisafs.SetLock)
+}
+
+// lisafsControlFD returns a lisafs FD for d.
+func (d *dentry) lisafsControlFD(ctx context.Context) (lisafs.ClientFD, error) {
+	switch dt := d.impl.(type) {
+	case *lisafsDentry:
+		return dt.controlFD, nil
+	case *directfsDentry:
+		d.fs.renameMu.RLock()
+		defer d.fs.renameMu.RUnlock()
+		if err := dt.ensureLisafsControlFD(ctx); err != nil {
+			return lisafs.ClientFD{}, err
+		}
+		return dt.controlFDLisa, nil
+	default:
+		panic("unknown dentry implementation")
+	}
+}
+
+// hostLockFD returns the open FD through which uid's host locks on d are
+// taken, opening it if needed.
+func (d *dentry) hostLockFD(ctx context.Context, uid fslock.UniqueID) (lisafs.ClientFD, error) {
+	d.hostLocksMu.Lock()
+	defer d.hostLocksMu.Unlock()
+	if fd, ok := d.hostLockFDs[uid]; ok {
+		return fd, nil
+	}
+	controlFD, err := d.lisafsControlFD(ctx)
+	if err != nil {
+		return lisafs.ClientFD{}, err
+	}
+	// Host write locks require a writable file description. Whether the owner
+	// may take write locks was checked against its own FD in the sandbox, so
+	// only fall back to a read-only file description if the file can't be
+	// opened for writing, e.g. because it's a directory.
+	openFD, hostFD, err := controlFD.OpenAt(ctx, unix.O_RDWR)
+	if err != nil {
+		openFD, hostFD, err = controlFD.OpenAt(ctx, unix.O_RDONLY)
+	}
+	if err != nil {
+		return lisafs.ClientFD{}, err
+	}
+	if hostFD >= 0 {
+		// Locks are only taken by the gofer.
+		_ = unix.Close(hostFD)
+	}
+	fd := d.fs.client.NewFD(openFD)
+	if d.hostLockFDs == nil {
+		d.hostLockFDs = make(map[fslock.UniqueID]lisafs.ClientFD)
+	}
+	d.hostLockFDs[uid] = fd
+	return fd, nil
+}
+
+// releaseHostLocks releases all host locks held by uid on d.
+func (d *dentry) releaseHostLocks(ctx context.Context, uid fslock.UniqueID) {
+	d.hostLocksMu.Lock()
+	fd, ok := d.hostLockFDs[uid]
+	delete(d.hostLockFDs, uid)
+	d.hostLocksMu.Unlock()
+	if ok {
+		// Closing the host file description releases its locks.
+		fd.Close(ctx, true /* flush */)
+	}
+}
+
+// setHostLock takes a host lock of the given kind on d for uid. If block is
+// true, it waits until the lock is available.
+func (d *dentry) setHostLock(ctx context.Context, uid fslock.UniqueID, kind uint32, t fslock.LockType, r fslock.LockRange, block bool) error {
+	typ := uint32(unix.F_RDLCK)
+	if t == fslock.WriteLock {
+		typ = unix.F_WRLCK
+	}
+	length := uint64(0)
+	if r.End != fslock.LockEOF {
+		length = r.End - r.Start
+	}
+	fd, err := d.hostLockFD(ctx, uid)
+	if err != nil {
+		return err
+	}
+	backoff := hostLockMinBackoff
+	for {
+		err := fd.SetLock(ctx, kind, typ, r.Start, length)
+		if err != unix.EAGAIN || !block {
+			return err
+		}
+		if err := blockFor(ctx, backoff); err != nil {
+			return err
+		}
+		if backoff *= 2; backoff > hostLockMaxBackoff {
+			backoff = hostLockMaxBackoff
+		}
+	}
+}
+
+// blockFor blocks for d, unless it is interrupted.
+func blockFor(ctx context.Context, d time.Duration) error {
+	expired := make(chan struct{})
+	timer := time.AfterFunc(d, func() { close(expired) })
+	defer timer.Stop()
+	if ctx.Block(expired) != nil {
+		return linuxerr.ErrInterrupted
+	}
+	return nil
+}
+
+// unlockHostRange releases uid's host POSIX locks on d in r.
+func (d *dentry) unlockHostRange(ctx context.Context, uid fslock.UniqueID, r fslock.LockRange) error {
+	if r.Start == 0 && r.End == fslock.LockEOF {
+		d.releaseHostLocks(ctx, uid)
+		return nil
+	}
+	d.hostLocksMu.Lock()
+	fd, ok := d.hostLockFDs[uid]
+	d.hostLocksMu.Unlock()
+	if !ok {
+		return nil
+	}
+	length := uint64(0)
+	if r.End != fslock.LockEOF {
+		length = r.End - r.Start
+	}
+	return fd.SetLock(ctx, lisafs.LockKindPOSIX, unix.F_UNLCK, r.Start, length)
+}
+
+// closeHostLockFDs closes all FDs used for host locks on d.
+func (d *dentry) closeHostLockFDs(ctx context.Context) {
+	d.hostLocksMu.Lock()
+	defer d.hostLocksMu.Unlock()
+	for uid, fd := range d.hostLockFDs {
+		fd.Close(ctx, false /* flush */)
+		delete(d.hostLockFDs, uid)
+	}
+}
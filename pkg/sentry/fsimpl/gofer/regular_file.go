@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -28,6 +29,7 @@ import (
 	"gvisor.dev/gvisor/pkg/safemem"
 	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
 	"gvisor.dev/gvisor/pkg/sentry/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/hostfd"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
@@ -78,6 +80,14 @@ func (fd *regularFileFD) OnClose(ctx context.Context) error {
 		return nil
 	}
 	d := fd.dentry()
+	if d.fs.opts.closeToOpen {
+		// Make all data written through fd visible to the next opener,
+		// including those on other clients of the remote filesystem.
+		if err := d.writeback(ctx, 0, math.MaxInt64); err != nil {
+			return err
+		}
+		return d.flush(ctx)
+	}
 	if d.fs.opts.interop == InteropModeExclusive {
 		// d may have dirty pages that we won't write back now (and wouldn't
 		// have in VFS1), making a flushf RPC ineffective. If this is the case,
@@ -176,6 +186,26 @@ func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts
 	return n, err
 }
 
+// SendfileTo implements hostfd.SendfileSource.SendfileTo.
+func (fd *regularFileFD) SendfileTo(dst int32, offset, count int64) (int64, bool, error) {
+	d := fd.dentry()
+	d.handleMu.RLock()
+	// As in dentryReadWriter.ReadToBlocks, file contents may only be read
+	// directly from the host FD if they are never cached by the sentry.
+	h := d.readHandle()
+	if h.fd < 0 || !((d.mmapFD.RacyLoad() >= 0 && !d.fs.opts.forcePageCache) || d.fs.opts.interop == InteropModeShared) {
+		d.handleMu.RUnlock()
+		return 0, false, nil
+	}
+	n, err := hostfd.Sendfile(dst, h.fd, offset, count)
+	d.handleMu.RUnlock()
+	if n > 0 && d.fs.opts.interop != InteropModeShared {
+		// Compare Linux's mm/filemap.c:do_generic_file_read() => file_accessed().
+		d.touchAtime(fd.vfsfd.Mount())
+	}
+	return n, true, err
+}
+
 // PWrite implements vfs.FileDescriptionImpl.PWrite.
 func (fd *regularFileFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
 	n, _, err := fd.pwrite(ctx, src, offset, opts)
@@ -435,7 +465,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 					End:   gapEnd,
 				}
 				optMR := gap.Range()
-				_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), rw.d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
+				_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR, rw.d.fs.opts.readahead), rw.d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
 				mf.MarkEvictable(rw.d, pgalloc.EvictableRange{optMR.Start, optMR.End})
 				seg, gap = rw.d.cache.Find(rw.off)
 				if !seg.Ok() {
@@ -534,6 +564,7 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 			rw.off += n
 			srcs = srcs.DropFirst64(n)
 			rw.d.dirty.MarkDirty(segMR)
+			rw.d.fs.scheduleWriteback()
 			if err != nil {
 				retErr = err
 				goto exitLoop
@@ -611,6 +642,117 @@ func (d *dentry) writeback(ctx context.Context, offset, size int64) error {
 	}, &d.cache, &d.dirty, dentrySize, d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
 }
 
+// revalidateCachedData provides the open half of close-to-open consistency.
+// It refreshes d's metadata from the remote file, and drops d's cached data if
+// the remote file's size or modification time changed since they were last
+// observed. Dirty data and memory-mapped pages are kept, since they can't be
+// discarded without losing writes or invalidating application mappings.
+//
+// Preconditions: !d.isSynthetic(). d.metadataMu must be unlocked.
+func (d *dentry) revalidateCachedData(ctx context.Context) error {
+	d.metadataMu.Lock()
+	defer d.metadataMu.Unlock()
+	oldSize, oldMtime := d.size.Load(), d.mtime.Load()
+	if err := d.updateMetadataLocked(ctx, noHandle); err != nil {
+		return err
+	}
+	if d.size.Load() == oldSize && d.mtime.Load() == oldMtime {
+		return nil
+	}
+	d.dropCleanCachedData()
+	return nil
+}
+
+// dropCleanCachedData drops d's cached data, unless d has dirty data. Cached
+// data that is memory-mapped is kept.
+//
+// Preconditions: d.mapsMu and d.dataMu must be unlocked.
+func (d *dentry) dropCleanCachedData() {
+	mf := d.fs.mfp.MemoryFile()
+	d.mapsMu.Lock()
+	defer d.mapsMu.Unlock()
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+	if !d.dirty.IsEmpty() {
+		return
+	}
+	for mgap := d.mappings.FirstGap(); mgap.Ok(); mgap = mgap.NextGap() {
+		d.cache.Drop(mgap.Range(), mf)
+	}
+}
+
+// scheduleWriteback arms fs.writebackTimer, if periodic writeback is enabled
+// and the timer isn't already armed.
+func (fs *filesystem) scheduleWriteback() {
+	if fs.opts.writebackInterval == 0 {
+		return
+	}
+	fs.writebackMu.Lock()
+	defer fs.writebackMu.Unlock()
+	if fs.writebackTimer == nil {
+		fs.writebackTimer = time.AfterFunc(fs.opts.writebackInterval, fs.writebackDirty)
+	}
+}
+
+// cancelWriteback disarms fs.writebackTimer and waits for a running writeback
+// to complete. The timer is armed again when data is next dirtied.
+func (fs *filesystem) cancelWriteback() {
+	fs.writebackMu.Lock()
+	if fs.writebackTimer != nil {
+		fs.writebackTimer.Stop()
+		fs.writebackTimer = nil
+	}
+	fs.writebackMu.Unlock()
+	fs.writebackRunMu.Lock()
+	fs.writebackRunMu.Unlock()
+}
+
+// writebackDirty is the callback of fs.writebackTimer. It writes dirty cached
+// data in all regular files back to the remote filesystem.
+func (fs *filesystem) writebackDirty() {
+	fs.writebackRunMu.Lock()
+	defer fs.writebackRunMu.Unlock()
+	fs.writebackMu.Lock()
+	if fs.writebackTimer == nil {
+		// Cancelled by cancelWriteback.
+		fs.writebackMu.Unlock()
+		return
+	}
+	fs.writebackTimer = nil
+	fs.writebackMu.Unlock()
+
+	fs.syncMu.Lock()
+	ds := make([]*dentry, 0, fs.syncableDentries.Len())
+	for elem := fs.syncableDentries.Front(); elem != nil; elem = elem.Next() {
+		if elem.d.isRegularFile() {
+			ds = append(ds, elem.d)
+		}
+	}
+	fs.syncMu.Unlock()
+
+	ctx := context.Background()
+	mf := fs.mfp.MemoryFile()
+	keptDirty := false
+	for _, d := range ds {
+		d.handleMu.RLock()
+		if d.isWriteHandleOk() {
+			h := d.writeHandle()
+			d.dataMu.Lock()
+			if err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), mf, h.writeFromBlocksAt); err != nil {
+				log.Warningf("gofer.filesystem.writebackDirty: failed to write back dentry: %v", err)
+			}
+			// Pages that are writably mapped stay dirty, since they can be
+			// written again at any time.
+			keptDirty = keptDirty || !d.dirty.IsEmpty()
+			d.dataMu.Unlock()
+		}
+		d.handleMu.RUnlock()
+	}
+	if keptDirty {
+		fs.scheduleWriteback()
+	}
+}
+
 // Seek implements vfs.FileDescriptionImpl.Seek.
 func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
 	fd.mu.Lock()
@@ -761,7 +903,7 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 		d.handleMu.RUnlock()
 		mr := optional
 		if d.fs.opts.limitHostFDTranslation {
-			mr = maxFillRange(required, optional)
+			mr = maxFillRange(required, optional, d.fs.opts.readahead)
 		}
 		return []memmap.Translation{
 			{
@@ -794,7 +936,7 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 
 	mf := d.fs.mfp.MemoryFile()
 	h := d.readHandle()
-	_, cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional), d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
+	_, cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional, d.fs.opts.readahead), d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -810,6 +952,7 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 			// From this point forward, this memory can be dirtied through the
 			// mapping at any time.
 			d.dirty.KeepDirty(segMR)
+			d.fs.scheduleWriteback()
 			perms.Write = true
 		}
 		ts = append(ts, memmap.Translation{
@@ -835,8 +978,10 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 	return ts, nil
 }
 
-func maxFillRange(required, optional memmap.MappableRange) memmap.MappableRange {
-	const maxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
+// maxFillRange returns the range to fill, given the required range and the
+// optional range that may also be filled, with at most maxReadahead bytes
+// beyond the required range.
+func maxFillRange(required, optional memmap.MappableRange, maxReadahead uint64) memmap.MappableRange {
 	if required.Length() >= maxReadahead {
 		return required
 	}
@@ -907,6 +1052,38 @@ func (d *dentry) Evict(ctx context.Context, er pgalloc.EvictableRange) {
 	}
 }
 
+// EvictClean implements pgalloc.CleanEvictableMemoryUser.EvictClean.
+func (d *dentry) EvictClean(ctx context.Context, er pgalloc.EvictableRange) {
+	mr := memmap.MappableRange{er.Start, er.End}
+	mf := d.fs.mfp.MemoryFile()
+	d.mapsMu.Lock()
+	defer d.mapsMu.Unlock()
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+
+	// As in Evict, only allow pages that are no longer memory-mapped to be
+	// evicted. Dirty pages stay evictable, so that they are written back and
+	// evicted if evicting clean pages doesn't free enough memory.
+	for mgap := d.mappings.LowerBoundGap(mr.Start); mgap.Ok() && mgap.Start() < mr.End; mgap = mgap.NextGap() {
+		mgapMR := mgap.Range().Intersect(mr)
+		if mgapMR.Length() == 0 {
+			continue
+		}
+		start := mgapMR.Start
+		for dseg := d.dirty.LowerBoundSegment(mgapMR.Start); dseg.Ok() && dseg.Start() < mgapMR.End; dseg = dseg.NextSegment() {
+			dirtyMR := dseg.Range().Intersect(mgapMR)
+			if start < dirtyMR.Start {
+				d.cache.Drop(memmap.MappableRange{start, dirtyMR.Start}, mf)
+			}
+			mf.MarkEvictable(d, pgalloc.EvictableRange{dirtyMR.Start, dirtyMR.End})
+			start = dirtyMR.End
+		}
+		if start < mgapMR.End {
+			d.cache.Drop(memmap.MappableRange{start, mgapMR.End}, mf)
+		}
+	}
+}
+
 // dentryPlatformFile implements memmap.File. It exists solely because dentry
 // cannot implement both vfs.DentryImpl.IncRef and memmap.File.IncRef.
 //
@@ -69,6 +69,10 @@ func (fs *filesystem) PrepareSave(ctx context.Context) error {
 	}
 	fs.syncMu.Unlock()
 
+	// Stop periodic writeback, which would otherwise race with serialization
+	// of dirty cached data. Writes after restore arm it again.
+	fs.cancelWriteback()
+
 	// Flush local state to the remote filesystem.
 	if err := fs.Sync(ctx); err != nil {
 		return err
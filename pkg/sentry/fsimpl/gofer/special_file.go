@@ -466,8 +466,8 @@ func (fd *specialFileFD) CopyMapping(ctx context.Context, ms memmap.MappingSpace
 // Translate implements memmap.Mappable.Translate.
 func (fd *specialFileFD) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
 	mr := optional
-	if fd.filesystem().opts.limitHostFDTranslation {
-		mr = maxFillRange(required, optional)
+	if fs := fd.filesystem(); fs.opts.limitHostFDTranslation {
+		mr = maxFillRange(required, optional, fs.opts.readahead)
 	}
 	return []memmap.Translation{
 		{
@@ -0,0 +1,112 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/sentry/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// SyncFiles implements vfs.BatchSyncFilesystemImpl.SyncFiles. It is used for
+// mounts with the vfs.SyncBatch policy.
+//
+// Dirty cached pages are written back for each file, and then all handles
+// that are only accessible through lisafs are synced with a single FSync RPC.
+// Handles backed by a host FD are fsynced directly, as in handle.sync().
+func (fs *filesystem) SyncFiles(ctx context.Context, fds []*vfs.FileDescription) error {
+	var (
+		retErr error
+		ds     = make(map[*dentry]struct{}, len(fds))
+		ids    []lisafs.FDID
+		// batched are the files with handles synced by the FSync RPC.
+		batched []*vfs.FileDescription
+	)
+	setErr := func(err error) {
+		if err != nil && retErr == nil {
+			retErr = err
+		}
+	}
+	for _, vfd := range fds {
+		fd, ok := vfd.Impl().(*regularFileFD)
+		if !ok {
+			setErr(vfd.Impl().Sync(ctx))
+			continue
+		}
+		d := fd.dentry()
+		if _, ok := ds[d]; ok {
+			continue
+		}
+		ds[d] = struct{}{}
+		n := len(ids)
+		var err error
+		ids, err = d.prepareBatchSync(ctx, ids)
+		setErr(err)
+		if len(ids) > n {
+			batched = append(batched, vfd)
+		}
+	}
+	if err := fs.client.SyncFDs(ctx, ids); err != nil {
+		// Handles may have been replaced and closed since their FDs were
+		// collected. Sync the files one at a time to find out which failed.
+		for _, vfd := range batched {
+			setErr(vfd.Impl().Sync(ctx))
+		}
+	}
+	return retErr
+}
+
+// prepareBatchSync writes back d's dirty pages and syncs its handles that are
+// backed by a host FD. It appends the lisafs FDs of its other handles to ids.
+//
+// d.handleMu is only held for the duration of the call, so that SyncFiles
+// never holds it on several dentries at once. The returned FDs may be closed
+// concurrently by dentry.ensureSharedHandle(), in which case syncing them
+// fails.
+func (d *dentry) prepareBatchSync(ctx context.Context, ids []lisafs.FDID) ([]lisafs.FDID, error) {
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	if d.isWriteHandleOk() {
+		// Write back dirty pages to the remote file.
+		d.dataMu.Lock()
+		h := d.writeHandle()
+		err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
+		d.dataMu.Unlock()
+		if err != nil {
+			return ids, err
+		}
+	}
+	// Prefer syncing write handles over read handles, as in
+	// dentry.syncRemoteFileLocked().
+	var retErr error
+	wh := d.writeHandle()
+	rh := d.readHandle()
+	for i, h := range []handle{wh, rh} {
+		switch {
+		case h.fd >= 0:
+			if err := h.sync(ctx); err != nil && retErr == nil {
+				retErr = err
+			}
+		case h.fdLisa.Ok():
+			if i == 1 && wh.fdLisa.Ok() && wh.fdLisa.ID() == h.fdLisa.ID() {
+				// The read and write handles are the same.
+				continue
+			}
+			ids = append(ids, h.fdLisa.ID())
+		}
+	}
+	return ids, retErr
+}
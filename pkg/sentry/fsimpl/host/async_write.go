@@ -0,0 +1,301 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// AsyncWriteOptions configures the offloading of writes to slow donated host
+// FDs, e.g. container logs backed by congested disks, to buffered
+// asynchronous writers.
+type AsyncWriteOptions struct {
+	// SlowThreshold is how long a write to a host FD may be blocked before
+	// subsequent writes to it are offloaded. If zero, writes are never
+	// offloaded.
+	SlowThreshold time.Duration
+
+	// BufferSize is the maximum number of bytes buffered for each offloaded
+	// host FD.
+	BufferSize int
+
+	// Drop determines what happens to writes that don't fit in the buffer. If
+	// true, they are dropped and reported as successful. Otherwise, the writer
+	// blocks until buffer space is available.
+	Drop bool
+}
+
+// asyncWriteOpts is the global AsyncWriteOptions, set by SetAsyncWriteOptions.
+var asyncWriteOpts AsyncWriteOptions
+
+// SetAsyncWriteOptions sets the options used to offload writes to slow host
+// FDs imported with NewFDOptions.AsyncWrite. It must be called before any such
+// FD is imported.
+func SetAsyncWriteOptions(opts AsyncWriteOptions) {
+	if opts.SlowThreshold < 0 || opts.BufferSize <= 0 {
+		opts.SlowThreshold = 0
+	}
+	asyncWriteOpts = opts
+}
+
+// asyncWriter writes buffered data to a host FD from a dedicated goroutine,
+// so that a host FD that blocks does not stall the tasks writing to it.
+type asyncWriter struct {
+	hostFD int
+	opts   AsyncWriteOptions
+
+	// queue is notified when buffer space becomes available.
+	queue *waiter.Queue
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// cond is signaled when buf becomes non-empty or closed is set.
+	cond sync.Cond
+
+	// buf contains data not yet picked up by the flusher.
+	buf []byte
+
+	// inflight is the number of bytes being written by the flusher.
+	inflight int
+
+	// err is the error returned by the last failed host write. Once set, all
+	// subsequent writes fail with it.
+	err error
+
+	// dropped is the number of bytes dropped because the buffer was full.
+	dropped uint64
+
+	// closed is true once the inode has been released. The flusher then
+	// writes out remaining data and closes hostFD.
+	closed bool
+}
+
+func newAsyncWriter(hostFD int, queue *waiter.Queue, opts AsyncWriteOptions) *asyncWriter {
+	aw := &asyncWriter{
+		hostFD: hostFD,
+		opts:   opts,
+		queue:  queue,
+	}
+	aw.cond.L = &aw.mu
+	go aw.run() // S/R-SAFE: inode.beforeSave drains the writer.
+	return aw
+}
+
+// buffered returns the number of bytes not yet written to the host FD.
+//
+// Preconditions: aw.mu must be locked.
+func (aw *asyncWriter) buffered() int {
+	return len(aw.buf) + aw.inflight
+}
+
+// write buffers the contents of src to be written to the host FD.
+func (aw *asyncWriter) write(ctx context.Context, src usermem.IOSequence) (int64, error) {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.err != nil {
+		return 0, aw.err
+	}
+	total := src.NumBytes()
+	n := int64(aw.opts.BufferSize - aw.buffered())
+	if n > total {
+		n = total
+	}
+	var copied int
+	if n > 0 {
+		off := len(aw.buf)
+		aw.buf = append(aw.buf, make([]byte, n)...)
+		var err error
+		copied, err = src.CopyIn(ctx, aw.buf[off:])
+		aw.buf = aw.buf[:off+copied]
+		if copied > 0 {
+			aw.cond.Signal()
+		}
+		if err != nil {
+			return int64(copied), err
+		}
+	}
+	if int64(copied) == total {
+		return total, nil
+	}
+	if !aw.opts.Drop {
+		return int64(copied), linuxerr.ErrWouldBlock
+	}
+	if aw.dropped == 0 {
+		log.Warningf("host FD %d: async write buffer full, dropping data", aw.hostFD)
+	}
+	aw.dropped += uint64(total - int64(copied))
+	return total, nil
+}
+
+// writable returns true if a write would not block.
+func (aw *asyncWriter) writable() bool {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	return aw.opts.Drop || aw.err != nil || aw.buffered() < aw.opts.BufferSize
+}
+
+// drain waits until all buffered data has been written to the host FD.
+func (aw *asyncWriter) drain() {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	for aw.buffered() != 0 && aw.err == nil {
+		aw.cond.Wait()
+	}
+}
+
+// close causes the flusher to close the host FD once all buffered data has
+// been written.
+func (aw *asyncWriter) close() {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	aw.closed = true
+	aw.cond.Broadcast()
+}
+
+// run is the flusher's main loop.
+func (aw *asyncWriter) run() {
+	aw.mu.Lock()
+	for {
+		for len(aw.buf) == 0 && !aw.closed {
+			aw.cond.Wait()
+		}
+		if len(aw.buf) == 0 || aw.err != nil {
+			break
+		}
+		buf := aw.buf
+		aw.buf = nil
+		aw.inflight = len(buf)
+		aw.mu.Unlock()
+
+		err := writeFull(aw.hostFD, buf)
+
+		aw.mu.Lock()
+		aw.inflight = 0
+		if err != nil {
+			log.Warningf("host FD %d: async write failed: %v", aw.hostFD, err)
+			aw.err = err
+			aw.buf = nil
+		}
+		// Wake up drain().
+		aw.cond.Broadcast()
+		aw.mu.Unlock()
+		aw.queue.Notify(waiter.WritableEvents)
+		aw.mu.Lock()
+	}
+	// Only reached once closed is set, or after an error. Wait for the inode
+	// to be released in the latter case, since hostFD is still in use.
+	for !aw.closed {
+		aw.cond.Wait()
+	}
+	if aw.dropped != 0 {
+		log.Warningf("host FD %d: dropped %d bytes due to a full async write buffer", aw.hostFD, aw.dropped)
+	}
+	aw.mu.Unlock()
+	if err := unix.Close(aw.hostFD); err != nil {
+		log.Warningf("failed to close host fd %d: %v", aw.hostFD, err)
+	}
+}
+
+// writeFull writes buf to hostFD, waiting for it to become writable if it is
+// non-blocking.
+func writeFull(hostFD int, buf []byte) error {
+	for len(buf) > 0 {
+		n, err := unix.Write(hostFD, buf)
+		if n > 0 {
+			buf = buf[n:]
+		}
+		switch err {
+		case nil:
+		case unix.EINTR:
+		case unix.EAGAIN:
+			fds := []unix.PollFd{{Fd: int32(hostFD), Events: unix.POLLOUT}}
+			if _, err := unix.Ppoll(fds, nil, nil); err != nil && err != unix.EINTR {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// noteWriteStall records that a write to the host FD was blocked for the
+// given duration, and offloads subsequent writes if it exceeds the configured
+// threshold.
+func (i *inode) noteWriteStall(stall time.Duration) {
+	opts := asyncWriteOpts
+	if opts.SlowThreshold == 0 || stall < opts.SlowThreshold {
+		return
+	}
+	i.asyncMu.Lock()
+	defer i.asyncMu.Unlock()
+	if i.async != nil {
+		return
+	}
+	log.Warningf("host FD %d blocked writes for %v, offloading writes to it (buffer: %d bytes, drop when full: %t)", i.hostFD, stall, opts.BufferSize, opts.Drop)
+	i.async = newAsyncWriter(i.hostFD, &i.queue, opts)
+}
+
+// asyncWriter returns the inode's asyncWriter, or nil if writes to the host
+// FD are not offloaded.
+func (i *inode) asyncWriter() *asyncWriter {
+	if !i.asyncWrite {
+		return nil
+	}
+	i.asyncMu.Lock()
+	defer i.asyncMu.Unlock()
+	return i.async
+}
+
+// writeToSlowHostFD writes src to the inode's non-seekable host FD, either
+// directly or through the inode's asyncWriter, detecting host FDs that block
+// writes.
+func (f *fileDescription) writeToSlowHostFD(ctx context.Context, src usermem.IOSequence, flags uint32) (int64, error) {
+	i := f.inode
+	if aw := i.asyncWriter(); aw != nil {
+		if i.readonly {
+			return 0, linuxerr.EPERM
+		}
+		if flags != 0 {
+			return 0, linuxerr.EOPNOTSUPP
+		}
+		return aw.write(ctx, src)
+	}
+	start := time.Now()
+	n, err := f.writeToHostFD(ctx, src, -1, flags)
+	if !i.epollable {
+		// The write blocked the sentry until it completed.
+		i.noteWriteStall(time.Since(start))
+		return n, err
+	}
+	if isBlockError(err) {
+		// The calling task is about to block until the host FD is writable.
+		i.writeBlockedSince.CompareAndSwap(0, start.UnixNano())
+		return n, linuxerr.ErrWouldBlock
+	}
+	if since := i.writeBlockedSince.Swap(0); since != 0 {
+		i.noteWriteStall(time.Duration(start.UnixNano() - since))
+	}
+	return n, err
+}
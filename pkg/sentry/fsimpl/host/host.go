@@ -151,6 +151,22 @@ type inode struct {
 	// This field is initialized at creation time and is immutable.
 	readonly bool
 
+	// asyncWrite is true if writes to hostFD may be offloaded to an
+	// asyncWriter once hostFD is found to block writes. See AsyncWriteOptions.
+	//
+	// This field is initialized at creation time and is immutable.
+	asyncWrite bool
+
+	// writeBlockedSince is the time, in nanoseconds since the Unix epoch, at
+	// which a write to hostFD first failed with EAGAIN since the last
+	// successful one, or zero.
+	writeBlockedSince atomicbitops.Int64 `state:"nosave"`
+
+	// async is the asyncWriter that writes to hostFD are offloaded to, or nil.
+	// async is protected by asyncMu.
+	asyncMu sync.Mutex   `state:"nosave"`
+	async   *asyncWriter `state:"nosave"`
+
 	// Event queue for blocking operations.
 	queue waiter.Queue
 
@@ -167,7 +183,7 @@ type inode struct {
 	buf     []byte
 }
 
-func newInode(ctx context.Context, fs *filesystem, hostFD int, savable bool, fileType linux.FileMode, isTTY bool, readonly bool) (*inode, error) {
+func newInode(ctx context.Context, fs *filesystem, hostFD int, savable bool, fileType linux.FileMode, isTTY bool, readonly bool, asyncWrite bool) (*inode, error) {
 	// Determine if hostFD is seekable.
 	_, err := unix.Seek(hostFD, 0, linux.SEEK_CUR)
 	seekable := !linuxerr.Equals(linuxerr.ESPIPE, err)
@@ -187,6 +203,9 @@ func newInode(ctx context.Context, fs *filesystem, hostFD int, savable bool, fil
 		isTTY:     isTTY,
 		savable:   savable,
 		readonly:  readonly,
+		// Only writes to non-seekable files can be offloaded, since buffered
+		// data would otherwise be visible to reads and seeks.
+		asyncWrite: asyncWrite && !seekable && !isTTY && fileType != unix.S_IFSOCK,
 	}
 	i.InitRefs()
 	i.CachedMappable.Init(hostFD)
@@ -228,6 +247,11 @@ type NewFDOptions struct {
 	// If Readonly is true, we disallow operations that can potentially change
 	// the host file associated with the file descriptor.
 	Readonly bool
+
+	// If AsyncWrite is true, writes to a non-seekable host file may be
+	// offloaded to a buffered asynchronous writer if the host file is found to
+	// block them. See SetAsyncWriteOptions.
+	AsyncWrite bool
 }
 
 // NewFD returns a vfs.FileDescription representing the given host file
@@ -272,7 +296,7 @@ func NewFD(ctx context.Context, mnt *vfs.Mount, hostFD int, opts *NewFDOptions)
 	}
 
 	fileType := linux.FileMode(stat.Mode).FileType()
-	i, err := newInode(ctx, fs, hostFD, opts.Savable, fileType, opts.IsTTY, opts.Readonly)
+	i, err := newInode(ctx, fs, hostFD, opts.Savable, fileType, opts.IsTTY, opts.Readonly, opts.AsyncWrite)
 	if err != nil {
 		return nil, err
 	}
@@ -615,7 +639,10 @@ func (i *inode) DecRef(ctx context.Context) {
 		if i.epollable {
 			fdnotifier.RemoveFD(int32(i.hostFD))
 		}
-		if err := unix.Close(i.hostFD); err != nil {
+		if aw := i.asyncWriter(); aw != nil {
+			// The asyncWriter closes hostFD once buffered data is written.
+			aw.close()
+		} else if err := unix.Close(i.hostFD); err != nil {
 			log.Warningf("failed to close host fd %d: %v", i.hostFD, err)
 		}
 		// We can't rely on fdnotifier when closing the fd, because the event may race
@@ -843,6 +870,9 @@ func (f *fileDescription) PWrite(ctx context.Context, src usermem.IOSequence, of
 func (f *fileDescription) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
 	i := f.inode
 	if !i.seekable {
+		if i.asyncWrite {
+			return f.writeToSlowHostFD(ctx, src, opts.Flags)
+		}
 		n, err := f.writeToHostFD(ctx, src, -1, opts.Flags)
 		if isBlockError(err) {
 			err = linuxerr.ErrWouldBlock
@@ -890,6 +920,19 @@ func (f *fileDescription) writeToHostFD(ctx context.Context, src usermem.IOSeque
 	return int64(n), err
 }
 
+// SpliceHostFD implements hostfd.Spliceable.SpliceHostFD.
+func (f *fileDescription) SpliceHostFD() (int32, bool, bool) {
+	i := f.inode
+	// Data buffered by inode.beforeSave and writes offloaded to an
+	// asyncWriter would be reordered with respect to the host splice. The
+	// host splice would also bypass file offsets, the readonly check and TTY
+	// job control.
+	if i.seekable || !i.epollable || i.readonly || i.isTTY || i.asyncWrite || i.haveBuf.Load() != 0 {
+		return 0, false, false
+	}
+	return int32(i.hostFD), i.ftype == unix.S_IFIFO, true
+}
+
 // Seek implements vfs.FileDescriptionImpl.Seek.
 //
 // Note that we do not support seeking on directories, since we do not even
@@ -1000,7 +1043,15 @@ func (f *fileDescription) EventUnregister(e *waiter.Entry) {
 
 // Readiness uses the poll() syscall to check the status of the underlying FD.
 func (f *fileDescription) Readiness(mask waiter.EventMask) waiter.EventMask {
-	return fdnotifier.NonBlockingPoll(int32(f.inode.hostFD), mask)
+	ready := fdnotifier.NonBlockingPoll(int32(f.inode.hostFD), mask)
+	if aw := f.inode.asyncWriter(); aw != nil && mask&waiter.WritableEvents != 0 {
+		// Writability is determined by space in the asyncWriter's buffer.
+		ready &^= waiter.WritableEvents
+		if aw.writable() {
+			ready |= mask & waiter.WritableEvents
+		}
+	}
+	return ready
 }
 
 // Epollable implements FileDescriptionImpl.Epollable.
@@ -30,6 +30,11 @@ func (i *inode) beforeSave() {
 	if !i.savable {
 		panic("host.inode is not savable")
 	}
+	if aw := i.asyncWriter(); aw != nil {
+		// Buffered data is not saved, so write it out. Writes are no longer
+		// offloaded after restore.
+		aw.drain()
+	}
 	if i.ftype == unix.S_IFIFO {
 		// If this pipe FD is readable, drain it so that bytes in the pipe can
 		// be read after restore. (This is a legacy VFS1 feature.) We don't
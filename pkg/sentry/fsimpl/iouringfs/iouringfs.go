@@ -13,9 +13,10 @@
 // limitations under the License.
 
 // Package iouringfs provides a filesystem implementation for IO_URING basing
-// it on anonfs. Currently, we don't support neither IOPOLL nor SQPOLL modes.
-// Thus, user needs to set up IO_URING first with io_uring_setup(2) syscall and
-// then issue submission request using io_uring_enter(2).
+// it on anonfs. Currently, we don't support IOPOLL mode. Thus, user needs to
+// set up IO_URING first with io_uring_setup(2) syscall and then issue
+// submission request using io_uring_enter(2), or, in SQPOLL mode, let the
+// sentry poll the submission queue (see sqpoll.go).
 //
 // Another important note, as of now, we don't support deferred CQE. In other
 // words, the size of the backlogged set of CQE is zero. Whenever, completion
@@ -34,10 +35,12 @@ import (
 	"gvisor.dev/gvisor/pkg/safemem"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // FileDescription implements vfs.FileDescriptionImpl for file-based IO_URING.
@@ -71,6 +74,14 @@ type FileDescription struct {
 	// remap indicates whether the shared buffers need to be remapped
 	// due to a S/R. Protected by ProcessSubmissions critical section.
 	remap bool
+
+	// sqpoll is the submission queue poller if the ring was set up with
+	// IORING_SETUP_SQPOLL, or nil otherwise. sqpoll is immutable.
+	sqpoll *sqPoller
+
+	// cq is notified with waiter.ReadableEvents when the submission queue
+	// poller posts completions.
+	cq waiter.Queue
 }
 
 var _ vfs.FileDescriptionImpl = (*FileDescription)(nil)
@@ -138,6 +149,15 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 		return nil, linuxerr.ENOMEM
 	}
 
+	var sqpoll *sqPoller
+	if params.Flags&linux.IORING_SETUP_SQPOLL != 0 {
+		t := kernel.TaskFromContext(ctx)
+		if t == nil {
+			panic(fmt.Sprintf("context.Context %T lacks non-nil value for key %T", ctx, kernel.CtxTask))
+		}
+		sqpoll = newSQPoller(t, params.SqThreadIdle)
+	}
+
 	iouringfd := &FileDescription{
 		mfp: mfp,
 		rbmf: ringsBufferFile{
@@ -147,7 +167,8 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 			fr: sqefr,
 		},
 		// See ProcessSubmissions for why the capacity is 1.
-		runC: make(chan struct{}, 1),
+		runC:   make(chan struct{}, 1),
+		sqpoll: sqpoll,
 	}
 
 	// iouringfd is always set up with read/write mode.
@@ -183,7 +204,7 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 	params.CqOff.Cqes = uint32(cqesOffset)
 
 	// Set features supported by the current IO_URING implementation.
-	params.Features = linux.IORING_FEAT_SINGLE_MMAP
+	params.Features = linux.IORING_FEAT_SINGLE_MMAP | linux.IORING_FEAT_SQPOLL_NONFIXED
 
 	// Map all shared buffers.
 	if err := iouringfd.mapSharedBuffers(); err != nil {
@@ -210,9 +231,65 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 		return nil, err
 	}
 
+	// Like Linux, start polling the submission queue immediately.
+	if sqpoll != nil {
+		sqpoll.wake(iouringfd)
+	}
+
 	return &iouringfd.vfsfd, nil
 }
 
+// SQPoll returns true if the ring was set up with IORING_SETUP_SQPOLL.
+func (fd *FileDescription) SQPoll() bool {
+	return fd.sqpoll != nil
+}
+
+// WakeSQPoll wakes the submission queue poller if it went to sleep, as for
+// io_uring_enter(2) IORING_ENTER_SQ_WAKEUP.
+//
+// Preconditions: fd.SQPoll() == true.
+func (fd *FileDescription) WakeSQPoll() {
+	fd.sqpoll.wake(fd)
+}
+
+// PokeSQPoll makes the submission queue poller, if it's running, poll the
+// submission queue immediately rather than after its current backoff. It's
+// called by io_uring_enter(2) in SQPOLL mode, which is a strong hint that
+// entries were submitted.
+//
+// Preconditions: fd.SQPoll() == true.
+func (fd *FileDescription) PokeSQPoll() {
+	fd.sqpoll.poke()
+}
+
+// WaitCompletions blocks until the completion queue holds at least
+// minComplete entries, or the completion queue's capacity if that's lower, as
+// for io_uring_enter(2) IORING_ENTER_GETEVENTS in SQPOLL mode.
+//
+// Preconditions: fd.SQPoll() == true.
+func (fd *FileDescription) WaitCompletions(t *kernel.Task, minComplete uint32) error {
+	if minComplete > fd.ioRings.CqRingEntries {
+		minComplete = fd.ioRings.CqRingEntries
+	}
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	fd.cq.EventRegister(&e)
+	defer fd.cq.EventUnregister(&e)
+	for {
+		fd.beginProcessing(t)
+		n, err := fd.cqCount()
+		fd.endProcessing()
+		if err != nil {
+			return err
+		}
+		if n >= minComplete {
+			return nil
+		}
+		if err := t.Block(ch); err != nil {
+			return linuxerr.EINTR
+		}
+	}
+}
+
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *FileDescription) Release(ctx context.Context) {
 	mf := pgalloc.MemoryFileProviderFromContext(ctx).MemoryFile()
@@ -319,27 +396,81 @@ func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, m
 	// When the active task is done, it releases the critical section by setting
 	// running = 0, then doing a non-blocking send on runC. The send needs to be
 	// non-blocking, as there may not be a concurrent sleeper.
-	for !fd.running.CompareAndSwap(0, 1) {
-		t.Block(fd.runC)
-	}
+	fd.beginProcessing(t)
 	// We successfully set fd.running, so we're the active task now.
-	defer func() {
-		// Unblock any potentially waiting tasks.
-		if !fd.running.CompareAndSwap(1, 0) {
-			panic(fmt.Sprintf("iouringfs.FileDescription.ProcessSubmissions: active task encountered invalid fd.running state %v", fd.running.Load()))
-		}
-		select {
-		case fd.runC <- struct{}{}:
-		default:
-		}
-	}()
+	defer fd.endProcessing()
 
 	// The rest of this function is a critical section with respect to
 	// concurrent callers.
+	return fd.processSubmissions(&submitter{
+		ctx:     t,
+		t:       t,
+		fdTable: t.FDTable(),
+		mm:      t.MemoryManager(),
+	}, toSubmit, flags)
+}
+
+// beginProcessing enters the ProcessSubmissions critical section on behalf of
+// t, blocking t until it can.
+func (fd *FileDescription) beginProcessing(t *kernel.Task) {
+	for !fd.running.CompareAndSwap(0, 1) {
+		t.Block(fd.runC)
+	}
+}
+
+// endProcessing leaves the critical section entered by ProcessSubmissions or
+// the submission queue poller.
+func (fd *FileDescription) endProcessing() {
+	// Unblock any potentially waiting tasks.
+	if !fd.running.CompareAndSwap(1, 0) {
+		panic(fmt.Sprintf("iouringfs.FileDescription.endProcessing: active task encountered invalid fd.running state %v", fd.running.Load()))
+	}
+	select {
+	case fd.runC <- struct{}{}:
+	default:
+	}
+}
+
+// remapIfNeeded remaps the shared buffers after a restore.
+//
+// Preconditions: The caller must be in the ProcessSubmissions critical
+// section.
+func (fd *FileDescription) remapIfNeeded() error {
+	if !fd.remap {
+		return nil
+	}
+	if err := fd.mapSharedBuffers(); err != nil {
+		return err
+	}
+	fd.remap = false
+	return nil
+}
 
-	if fd.remap {
-		fd.mapSharedBuffers()
-		fd.remap = false
+// submitter is the context in which submissions are processed: either a task
+// calling io_uring_enter(2), or the submission queue poller acting on behalf
+// of the task that set up the ring.
+type submitter struct {
+	// ctx is the context used for I/O.
+	ctx context.Context
+
+	// t is the task calling io_uring_enter(2), or nil for the poller.
+	t *kernel.Task
+
+	// fdTable is used to look up file descriptors in submissions.
+	fdTable *kernel.FDTable
+
+	// mm is the address space that buffers in submissions refer to.
+	mm *mm.MemoryManager
+}
+
+// processSubmissions processes up to toSubmit entries from the submission
+// queue.
+//
+// Preconditions: The caller must be in the ProcessSubmissions critical
+// section.
+func (fd *FileDescription) processSubmissions(s *submitter, toSubmit uint32, flags uint32) (int, error) {
+	if err := fd.remapIfNeeded(); err != nil {
+		return -1, err
 	}
 
 	var err error
@@ -361,7 +492,7 @@ func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, m
 	for toSubmit > submitted {
 		// This loop can take a long time to process, so periodically check for
 		// interrupts. This also pets the watchdog.
-		if t.Interrupted() {
+		if s.t != nil && s.t.Interrupted() {
 			return -1, linuxerr.EINTR
 		}
 
@@ -404,7 +535,7 @@ func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, m
 		fetchSQA = fd.sqesBuf.drop()
 
 		// Dispatch request from unmarshalled entry.
-		cqe := fd.ProcessSubmission(t, &sqe, flags)
+		cqe := fd.processSubmission(s, &sqe, flags)
 
 		// Advance sq head.
 		sqHeadPtr.Add(1)
@@ -449,8 +580,8 @@ func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, m
 	return int(submitted), nil
 }
 
-// ProcessSubmission processes a single submission request.
-func (fd *FileDescription) ProcessSubmission(t *kernel.Task, sqe *linux.IOUringSqe, flags uint32) *linux.IOUringCqe {
+// processSubmission processes a single submission request.
+func (fd *FileDescription) processSubmission(s *submitter, sqe *linux.IOUringSqe, flags uint32) *linux.IOUringCqe {
 	var (
 		cqeErr   error
 		cqeFlags uint32
@@ -461,7 +592,7 @@ func (fd *FileDescription) ProcessSubmission(t *kernel.Task, sqe *linux.IOUringS
 	case linux.IORING_OP_NOP:
 		// For the NOP operation, we don't do anything special.
 	case linux.IORING_OP_READV:
-		retValue, cqeErr = fd.handleReadv(t, sqe, flags)
+		retValue, cqeErr = fd.handleReadv(s, sqe, flags)
 		if cqeErr == io.EOF {
 			// Don't raise EOF as errno, error translation will fail. Short
 			// reads aren't failures.
@@ -483,7 +614,7 @@ func (fd *FileDescription) ProcessSubmission(t *kernel.Task, sqe *linux.IOUringS
 }
 
 // handleReadv handles IORING_OP_READV.
-func (fd *FileDescription) handleReadv(t *kernel.Task, sqe *linux.IOUringSqe, flags uint32) (int32, error) {
+func (fd *FileDescription) handleReadv(s *submitter, sqe *linux.IOUringSqe, flags uint32) (int32, error) {
 	// Check that a file descriptor is valid.
 	if sqe.Fd < 0 {
 		return 0, linuxerr.EBADF
@@ -501,20 +632,20 @@ func (fd *FileDescription) handleReadv(t *kernel.Task, sqe *linux.IOUringSqe, fl
 		return 0, linuxerr.EINVAL
 	}
 
-	// AddressSpaceActive is set to true as we are doing this from the task goroutine.And this is a
-	// case as we currently don't support neither IOPOLL nor SQPOLL modes.
-	dst, err := t.IovecsIOSequence(hostarch.Addr(sqe.AddrOrSpliceOff), int(sqe.Len), usermem.IOOpts{
-		AddressSpaceActive: true,
+	// AddressSpaceActive is set to true only if we are doing this from the
+	// task goroutine. The submission queue poller runs on its own goroutine.
+	dst, err := kernel.IovecsIOSequenceIn(s.ctx, s.mm, hostarch.Addr(sqe.AddrOrSpliceOff), int(sqe.Len), usermem.IOOpts{
+		AddressSpaceActive: s.t != nil,
 	})
 	if err != nil {
 		return 0, err
 	}
-	file := t.GetFile(sqe.Fd)
+	file, _ := s.fdTable.Get(sqe.Fd)
 	if file == nil {
 		return 0, linuxerr.EBADF
 	}
-	defer file.DecRef(t)
-	n, err := file.PRead(t, dst, 0, vfs.ReadOptions{})
+	defer file.DecRef(s.ctx)
+	n, err := file.PRead(s.ctx, dst, 0, vfs.ReadOptions{})
 	if err != nil {
 		return 0, err
 	}
@@ -27,3 +27,8 @@ func (fd *FileDescription) afterLoad() {
 	fd.remap = true
 	fd.runC = make(chan struct{}, 1)
 }
+
+// afterLoad is invoked by stateify.
+func (p *sqPoller) afterLoad() {
+	p.kick = make(chan struct{}, 1)
+}
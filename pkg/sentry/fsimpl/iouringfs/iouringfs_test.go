@@ -19,6 +19,7 @@ import (
 	"math"
 	"strings"
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/hostarch"
 )
@@ -71,6 +72,25 @@ func TestRoundUpPowerOfTwoOverflow(t *testing.T) {
 	}
 }
 
+func TestSQPollerIdle(t *testing.T) {
+	tests := []struct {
+		idleMS uint32
+		want   time.Duration
+	}{
+		{0, defaultSQThreadIdle},
+		{1, time.Millisecond},
+		{500, 500 * time.Millisecond},
+		{math.MaxUint32, maxSQThreadIdle},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("case-%d", i), func(t *testing.T) {
+			if got := newSQPoller(nil, tt.idleMS).idle; got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestAtomicUint32AtOffset(t *testing.T) {
 	buf := make([]byte, 4096)
 	a := atomicUint32AtOffset(buf, 512)
@@ -0,0 +1,316 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iouringfs
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// defaultSQThreadIdle is the poller's idle time if
+	// io_uring_params.sq_thread_idle is 0. This is one second, as in Linux.
+	defaultSQThreadIdle = time.Second
+
+	// maxSQThreadIdle is the longest idle time the poller accepts. Since
+	// Kernel.Pause waits for the poller to go to sleep, this bounds how long
+	// the poller can delay it.
+	maxSQThreadIdle = time.Second
+
+	// sqPollSpin is how long the poller keeps polling an empty submission
+	// queue without sleeping.
+	sqPollSpin = 50 * time.Microsecond
+
+	// maxSQPollBackoff is the longest the poller sleeps between polls of an
+	// empty submission queue, unless it's kicked by io_uring_enter(2).
+	maxSQPollBackoff = time.Millisecond
+)
+
+// sqPoller emulates the kernel thread that Linux creates for rings set up with
+// IORING_SETUP_SQPOLL (io_uring/sqpoll.c:io_sq_thread()). While it is awake,
+// the poller processes submission queue entries as soon as userspace publishes
+// them, so that submitting I/O doesn't require io_uring_enter(2).
+//
+// The poller runs on an asynchronous I/O goroutine of the task that set up
+// the ring, using that task's credentials, file table and address space. If
+// the submission queue stays empty for the idle time, the poller sets
+// IORING_SQ_NEED_WAKEUP in the shared ring flags and exits, and userspace must
+// call io_uring_enter(2) with IORING_ENTER_SQ_WAKEUP to restart it.
+//
+// Unlike Linux's thread, which spins for the whole idle time, the poller only
+// spins briefly after finding the submission queue empty, then polls it with
+// exponentially increasing sleeps. io_uring_enter(2) kicks it out of these
+// sleeps.
+//
+// +stateify savable
+type sqPoller struct {
+	// creator is the task that set up the ring. creator is immutable.
+	creator *kernel.Task
+
+	// idle is how long the poller polls an empty submission queue before it
+	// goes to sleep. idle is immutable.
+	idle time.Duration
+
+	// mu protects active.
+	mu sync.Mutex `state:"nosave"`
+
+	// active is true while a poller goroutine is running. active is not saved
+	// since Kernel.Pause waits for the poller goroutine to exit.
+	active bool `state:"nosave"`
+
+	// kick is signaled to make the poller poll the submission queue without
+	// waiting for its backoff to expire.
+	kick chan struct{} `state:"nosave"`
+}
+
+// newSQPoller returns a poller for a ring set up by t, with an idle time of
+// idleMS milliseconds.
+func newSQPoller(t *kernel.Task, idleMS uint32) *sqPoller {
+	idle := time.Duration(idleMS) * time.Millisecond
+	if idle == 0 {
+		idle = defaultSQThreadIdle
+	}
+	if idle > maxSQThreadIdle {
+		idle = maxSQThreadIdle
+	}
+	return &sqPoller{
+		creator: t,
+		idle:    idle,
+		kick:    make(chan struct{}, 1),
+	}
+}
+
+// poke makes a running poller poll the submission queue immediately.
+func (p *sqPoller) poke() {
+	select {
+	case p.kick <- struct{}{}:
+	default:
+	}
+}
+
+// wake starts a poller goroutine for fd if none is running.
+//
+// Preconditions: The caller must hold a reference on fd.
+func (p *sqPoller) wake(fd *FileDescription) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active {
+		p.poke()
+		return
+	}
+	p.active = true
+	// The poller goroutine holds a reference on fd, so that the ring isn't
+	// released while it's being processed.
+	fd.vfsfd.IncRef()
+	p.creator.QueueAIO(func(ctx context.Context) {
+		defer fd.vfsfd.DecRef(ctx)
+		p.run(ctx, fd)
+	})
+}
+
+// run polls fd's submission queue until it stays empty for p.idle.
+func (p *sqPoller) run(ctx context.Context, fd *FileDescription) {
+	// Like Linux's SQPOLL thread, which shares the creator's files and
+	// address space, borrow the creator's for the duration of the run. If
+	// the creator has exited, there is nothing to act on behalf of.
+	var (
+		fdTable *kernel.FDTable
+		m       *mm.MemoryManager
+	)
+	p.creator.WithMuLocked(func(t *kernel.Task) {
+		if fdTable = t.FDTable(); fdTable != nil {
+			fdTable.IncRef()
+		}
+		if m = t.MemoryManager(); m != nil && !m.IncUsers() {
+			m = nil
+		}
+	})
+	if fdTable != nil {
+		defer fdTable.DecRef(ctx)
+	}
+	if m != nil {
+		defer m.DecUsers(ctx)
+	}
+	if fdTable == nil || m == nil {
+		p.sleep(fd, true /* force */)
+		return
+	}
+
+	s := &submitter{
+		ctx:     ctx,
+		fdTable: fdTable,
+		mm:      m,
+	}
+	fd.beginPolling()
+	err := fd.updateSQFlags(0, linux.IORING_SQ_NEED_WAKEUP)
+	fd.endProcessing()
+	if err != nil {
+		log.Warningf("io_uring SQPOLL: failed to clear IORING_SQ_NEED_WAKEUP: %v", err)
+	}
+	lastWork := time.Now()
+	backoff := time.Duration(0)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		fd.beginPolling()
+		n, err := fd.processSubmissions(s, math.MaxUint32, 0 /* flags */)
+		fd.endProcessing()
+		if err != nil {
+			log.Warningf("io_uring SQPOLL: failed to process submissions: %v", err)
+			p.sleep(fd, true /* force */)
+			return
+		}
+		if n > 0 {
+			// Wake tasks waiting for completions in io_uring_enter(2).
+			fd.cq.Notify(waiter.ReadableEvents)
+			lastWork = time.Now()
+			backoff = 0
+			continue
+		}
+		idle := time.Since(lastWork)
+		if idle >= p.idle {
+			if p.sleep(fd, false /* force */) {
+				return
+			}
+			lastWork = time.Now()
+			backoff = 0
+			continue
+		}
+		if idle < sqPollSpin {
+			sync.Goyield()
+			continue
+		}
+		if backoff == 0 {
+			backoff = sqPollSpin
+		} else if backoff < maxSQPollBackoff {
+			backoff *= 2
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(backoff)
+		select {
+		case <-p.kick:
+		case <-timer.C:
+		}
+	}
+}
+
+// sleep sets IORING_SQ_NEED_WAKEUP and marks the poller inactive, unless
+// force is false and userspace submitted entries concurrently. It returns
+// true if the poller is now inactive, in which case the caller must return.
+func (p *sqPoller) sleep(fd *FileDescription, force bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fd.beginPolling()
+	defer fd.endProcessing()
+	if err := fd.updateSQFlags(linux.IORING_SQ_NEED_WAKEUP, 0); err != nil {
+		log.Warningf("io_uring SQPOLL: failed to set IORING_SQ_NEED_WAKEUP: %v", err)
+		force = true
+	}
+	// Userspace checks IORING_SQ_NEED_WAKEUP after publishing entries, so
+	// entries published before the flag was set must be processed here.
+	if !force {
+		empty, err := fd.sqEmpty()
+		if err == nil && !empty {
+			if err := fd.updateSQFlags(0, linux.IORING_SQ_NEED_WAKEUP); err == nil {
+				return false
+			}
+		}
+	}
+	p.active = false
+	return true
+}
+
+// beginPolling enters the ProcessSubmissions critical section on behalf of
+// the poller. Since the poller has no task to block, it spins; contention is
+// rare, as tasks don't process submissions in SQPOLL mode.
+func (fd *FileDescription) beginPolling() {
+	for !fd.running.CompareAndSwap(0, 1) {
+		sync.Goyield()
+	}
+}
+
+// cqCount returns the number of entries in the completion queue.
+//
+// Preconditions: The caller must be in the ProcessSubmissions critical
+// section.
+func (fd *FileDescription) cqCount() (uint32, error) {
+	if err := fd.remapIfNeeded(); err != nil {
+		return 0, err
+	}
+	view, err := fd.ioRingsBuf.view(fd.ioRings.SizeBytes())
+	if err != nil {
+		return 0, err
+	}
+	cqOff := linux.PreComputedIOCqRingOffsets()
+	n := atomicUint32AtOffset(view, int(cqOff.Tail)).Load() - atomicUint32AtOffset(view, int(cqOff.Head)).Load()
+	fd.ioRingsBuf.drop()
+	return n, nil
+}
+
+// updateSQFlags sets the flags in set and clears the flags in unset in the
+// submission queue ring's flags, which are shared with userspace.
+//
+// Preconditions: The caller must be in the ProcessSubmissions critical
+// section.
+func (fd *FileDescription) updateSQFlags(set, unset uint32) error {
+	if err := fd.remapIfNeeded(); err != nil {
+		return err
+	}
+	view, err := fd.ioRingsBuf.view(fd.ioRings.SizeBytes())
+	if err != nil {
+		return err
+	}
+	flags := atomicUint32AtOffset(view, int(linux.PreComputedIOSqRingOffsets().Flags))
+	if set != 0 {
+		atomicbitops.OrUint32(flags, set)
+	}
+	if unset != 0 {
+		atomicbitops.AndUint32(flags, ^unset)
+	}
+	_, err = fd.ioRingsBuf.writeback(fd.ioRings.SizeBytes())
+	return err
+}
+
+// sqEmpty returns true if the submission queue is empty.
+//
+// Preconditions: The caller must be in the ProcessSubmissions critical
+// section.
+func (fd *FileDescription) sqEmpty() (bool, error) {
+	if err := fd.remapIfNeeded(); err != nil {
+		return false, err
+	}
+	view, err := fd.ioRingsBuf.view(fd.ioRings.SizeBytes())
+	if err != nil {
+		return false, err
+	}
+	sqOff := linux.PreComputedIOSqRingOffsets()
+	empty := atomicUint32AtOffset(view, int(sqOff.Head)).Load() == atomicUint32AtOffset(view, int(sqOff.Tail)).Load()
+	fd.ioRingsBuf.drop()
+	return empty, nil
+}
@@ -57,6 +57,7 @@ import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
@@ -194,6 +195,60 @@ func (l *Locks) UnlockRegion(uid UniqueID, r LockRange) {
 	l.blockedQueue.Notify(waiter.EventIn)
 }
 
+// LockedRegion is a region of a file on which an owner holds a lock.
+type LockedRegion struct {
+	// Range is the locked region.
+	Range LockRange
+
+	// Type is the type of the lock.
+	Type LockType
+
+	// Info describes the owner.
+	Info OwnerInfo
+}
+
+// HeldRegions returns the regions within r on which uid holds locks, in
+// order.
+func (l *Locks) HeldRegions(uid UniqueID, r LockRange) []LockedRegion {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var held []LockedRegion
+	for seg := l.locks.LowerBoundSegment(r.Start); seg.Ok() && seg.Start() < r.End; seg = seg.NextSegment() {
+		value := seg.Value()
+		region := LockedRegion{Range: seg.Range().Intersect(r)}
+		if value.Writer == uid {
+			region.Type = WriteLock
+			region.Info = value.WriterInfo
+		} else if info, ok := value.Readers[uid]; ok {
+			region.Type = ReadLock
+			region.Info = info
+		} else {
+			continue
+		}
+		held = append(held, region)
+	}
+	return held
+}
+
+// RestoreRegion replaces the locks that uid holds within r with held, as
+// returned by HeldRegions for r.
+//
+// Locks in held that conflict with locks that other owners took since
+// HeldRegions was called are not restored. This can only happen if uid's
+// locks within r were weakened in the meantime.
+func (l *Locks) RestoreRegion(uid UniqueID, r LockRange, held []LockedRegion) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.locks.unlock(uid, r)
+	for _, region := range held {
+		if err := l.locks.lock(uid, region.Info.PID, region.Type, region.Range, region.Info.OFD); err != nil {
+			log.Warningf("Failed to restore lock of type %d on %v: %v", region.Type, region.Range, err)
+		}
+	}
+	// Waiters may be able to take locks that uid no longer holds.
+	l.blockedQueue.Notify(waiter.EventIn)
+}
+
 // makeLock returns a new typed Lock that has either uid as its only reader
 // or uid as its only writer.
 func makeLock(uid UniqueID, ownerPID int32, t LockType, ofd bool) Lock {
@@ -1044,3 +1044,46 @@ func TestUnlock(t *testing.T) {
 		})
 	}
 }
+
+func TestRestoreRegion(t *testing.T) {
+	var l Locks
+	const owner, other = 1, 2
+	for _, region := range []LockedRegion{
+		{Range: LockRange{0, 100}, Type: ReadLock, Info: OwnerInfo{PID: 10}},
+		{Range: LockRange{100, 200}, Type: WriteLock, Info: OwnerInfo{PID: 10}},
+		{Range: LockRange{300, 400}, Type: WriteLock, Info: OwnerInfo{PID: 10}},
+	} {
+		if err := l.locks.lock(owner, region.Info.PID, region.Type, region.Range, region.Info.OFD); err != nil {
+			t.Fatalf("lock(%+v): %v", region, err)
+		}
+	}
+	if err := l.locks.lock(other, 20, ReadLock, LockRange{0, 50}, false); err != nil {
+		t.Fatalf("lock by other owner: %v", err)
+	}
+
+	r := LockRange{50, 350}
+	held := l.HeldRegions(owner, r)
+	want := []LockedRegion{
+		{Range: LockRange{50, 100}, Type: ReadLock, Info: OwnerInfo{PID: 10}},
+		{Range: LockRange{100, 200}, Type: WriteLock, Info: OwnerInfo{PID: 10}},
+		{Range: LockRange{300, 350}, Type: WriteLock, Info: OwnerInfo{PID: 10}},
+	}
+	if !reflect.DeepEqual(held, want) {
+		t.Fatalf("HeldRegions(%v) = %+v, want %+v", r, held, want)
+	}
+
+	// Replace the locks within r with a single write lock, and restore them.
+	if err := l.locks.lock(owner, 10, WriteLock, r, false); err != nil {
+		t.Fatalf("lock(%v): %v", r, err)
+	}
+	l.RestoreRegion(owner, r, held)
+	if got := l.HeldRegions(owner, r); !reflect.DeepEqual(got, want) {
+		t.Errorf("HeldRegions(%v) after RestoreRegion = %+v, want %+v", r, got, want)
+	}
+	if got, want := l.HeldRegions(owner, LockRange{0, 50}), []LockedRegion{{Range: LockRange{0, 50}, Type: ReadLock, Info: OwnerInfo{PID: 10}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("HeldRegions outside of restored region = %+v, want %+v", got, want)
+	}
+	if !l.locks.canLock(other, WriteLock, LockRange{200, 300}) {
+		t.Errorf("region without restored locks can't be locked")
+	}
+}
@@ -0,0 +1,533 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+const (
+	exchangeIDFlagUseNonPNFS = 0x00010000
+	sp4None                  = 0
+
+	// seq4StatusRestartReclaimNeeded is set in SEQUENCE results when the
+	// server restarted and the client's state must be reclaimed.
+	seq4StatusRestartReclaimNeeded = 0x1
+
+	// channelMaxIO is the largest READ or WRITE payload that the client
+	// issues.
+	channelMaxIO = 1 << 20
+
+	// channelOverhead is the room left in requests and replies for the RPC
+	// header and the operations that accompany a READ or WRITE.
+	channelOverhead = 16 << 10
+
+	// maxSlots bounds the number of concurrent requests in the session.
+	maxSlots = 64
+
+	// maxRetries bounds the number of times an operation is retried when the
+	// server asks the client to try again later.
+	maxRetries = 10
+
+	// attrLeaseTime is FATTR4_LEASE_TIME.
+	attrLeaseTime = 10
+
+	// defaultLeaseTime is used when the server doesn't report a lease time.
+	defaultLeaseTime = 90 * time.Second
+)
+
+// ClientOptions configures a Client.
+type ClientOptions struct {
+	// OwnerID identifies the client to the server. It must be unique among
+	// the server's clients and stable across reconnections of the same mount,
+	// so that the server can release the state of a previous incarnation.
+	OwnerID string
+
+	// MachineName, UID and GID are the AUTH_SYS credentials presented to the
+	// server.
+	MachineName string
+	UID         uint32
+	GID         uint32
+}
+
+// session is an NFSv4.1 session and the client ID that it belongs to.
+type session struct {
+	id    [16]byte
+	slots *slotTable
+
+	// epoch identifies the client ID that the session belongs to. It's
+	// incremented every time the client ID is re-established, at which point
+	// all open and lock state acquired in earlier epochs is lost.
+	epoch uint64
+}
+
+// slotTable is the slot table of a session's fore channel. Each request
+// occupies a slot for its duration, and the slot's sequence ID lets the server
+// detect retransmissions.
+type slotTable struct {
+	free chan uint32
+
+	// seqIDs holds the sequence ID of the last request sent on each slot. An
+	// entry is only accessed by the holder of the slot.
+	seqIDs []uint32
+}
+
+func newSlotTable(n uint32) *slotTable {
+	if n == 0 {
+		n = 1
+	}
+	if n > maxSlots {
+		n = maxSlots
+	}
+	t := &slotTable{
+		free:   make(chan uint32, n),
+		seqIDs: make([]uint32, n),
+	}
+	for i := uint32(0); i < n; i++ {
+		t.free <- i
+	}
+	return t
+}
+
+func (t *slotTable) acquire() uint32 {
+	return <-t.free
+}
+
+func (t *slotTable) release(slot uint32) {
+	t.free <- slot
+}
+
+// Client is an NFSv4.1 client connected to a single server.
+type Client struct {
+	rpc      *rpcClient
+	opts     ClientOptions
+	verifier [8]byte
+
+	// rootFH is the file handle of the server's root.
+	rootFH FileHandle
+
+	// leaseTime is the server's lease period.
+	leaseTime time.Duration
+
+	// recoveryMu serializes re-establishment of the session and client ID.
+	recoveryMu sync.Mutex
+
+	// openMu serializes OPEN and CLOSE operations, so that a CLOSE of the last
+	// reference to an open state can't race with an OPEN that reuses it.
+	openMu sync.Mutex
+
+	mu sync.Mutex
+
+	// clientID is the client ID assigned by the server.
+	//
+	// +checklocks:mu
+	clientID uint64
+
+	// createSeq is the sequence ID for the next CREATE_SESSION.
+	//
+	// +checklocks:mu
+	createSeq uint32
+
+	// sess is the current session.
+	//
+	// +checklocks:mu
+	sess *session
+
+	// lastRenew is the last time the server renewed the lease.
+	//
+	// +checklocks:mu
+	lastRenew time.Time
+
+	// opens maps open stateids to their state.
+	//
+	// +checklocks:mu
+	opens map[[12]byte]*openState
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewClient establishes a client ID and session with the NFSv4.1 server on
+// the other end of conn. The client takes ownership of conn.
+func NewClient(conn io.ReadWriteCloser, opts ClientOptions) (*Client, error) {
+	c := &Client{
+		rpc: newRPCClient(conn, nfsProgram, nfsVersion, &authSysCred{
+			machineName: opts.MachineName,
+			uid:         opts.UID,
+			gid:         opts.GID,
+		}),
+		opts:  opts,
+		opens: make(map[[12]byte]*openState),
+		stop:  make(chan struct{}),
+	}
+	if _, err := rand.Read(c.verifier[:]); err != nil {
+		c.rpc.close()
+		return nil, fmt.Errorf("generating verifier: %w", err)
+	}
+	if err := c.establish(0); err != nil {
+		c.rpc.close()
+		return nil, err
+	}
+	if err := c.fetchRoot(); err != nil {
+		c.destroy()
+		return nil, err
+	}
+	c.wg.Add(1)
+	go c.renewLoop() // S/R-SAFE: NFS mounts can't be saved.
+	return c, nil
+}
+
+// Root returns the file handle of the server's root.
+func (c *Client) Root() FileHandle {
+	return c.rootFH
+}
+
+// Shutdown stops the client, releasing all state held on the server. It must
+// be called once no other methods are in progress.
+func (c *Client) Shutdown() {
+	close(c.stop)
+	c.wg.Wait()
+	c.destroy()
+}
+
+// destroy destroys the session and client ID and closes the connection.
+func (c *Client) destroy() {
+	c.mu.Lock()
+	sess := c.sess
+	clientID := c.clientID
+	c.mu.Unlock()
+
+	var comp compound
+	comp.op(opDestroySession).writeFixedOpaque(sess.id[:])
+	if err := c.sendStandalone(&comp, opDestroySession, nil); err != nil {
+		log.Debugf("nfs: DESTROY_SESSION failed: %v", err)
+	}
+	comp = compound{}
+	comp.op(opDestroyClientID).writeUint64(clientID)
+	if err := c.sendStandalone(&comp, opDestroyClientID, nil); err != nil {
+		log.Debugf("nfs: DESTROY_CLIENTID failed: %v", err)
+	}
+	c.rpc.close()
+}
+
+// establish obtains a new client ID and creates a session for it, in the
+// given epoch.
+func (c *Client) establish(epoch uint64) error {
+	if err := c.exchangeID(); err != nil {
+		return fmt.Errorf("EXCHANGE_ID: %w", err)
+	}
+	if err := c.createSession(epoch); err != nil {
+		return fmt.Errorf("CREATE_SESSION: %w", err)
+	}
+	// The client never reclaims state after a server restart; state that is
+	// lost is reported as EIO to its users, like Linux does for lost locks.
+	var comp compound
+	comp.op(opReclaimComplete).writeBool(false /* rca_one_fs */)
+	err := c.callOnce(&comp, func(r *compoundResult) error {
+		_, err := r.next(opReclaimComplete)
+		return err
+	})
+	var s statusError
+	if err != nil && !(errors.As(err, &s) && s == nfs4ErrCompleteAlready) {
+		return fmt.Errorf("RECLAIM_COMPLETE: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) exchangeID() error {
+	var comp compound
+	e := comp.op(opExchangeID)
+	e.writeFixedOpaque(c.verifier[:])
+	e.writeString(c.opts.OwnerID)
+	e.writeUint32(exchangeIDFlagUseNonPNFS)
+	e.writeUint32(sp4None)
+	e.writeUint32(0) // eia_client_impl_id<1>
+	return c.sendStandalone(&comp, opExchangeID, func(d *xdrDecoder) error {
+		clientID := d.readUint64()
+		seq := d.readUint32()
+		d.readUint32() // eir_flags
+		if sp := d.readUint32(); d.err == nil && sp != sp4None {
+			return fmt.Errorf("unsupported state protection %d", sp)
+		}
+		if d.err != nil {
+			return d.err
+		}
+		c.mu.Lock()
+		c.clientID = clientID
+		c.createSeq = seq
+		c.mu.Unlock()
+		return nil
+	})
+}
+
+func writeChannelAttrs(e *xdrEncoder, maxReq, maxResp, maxOps, maxReqs uint32) {
+	e.writeUint32(0) // ca_headerpadsize
+	e.writeUint32(maxReq)
+	e.writeUint32(maxResp)
+	e.writeUint32(0) // ca_maxresponsesize_cached
+	e.writeUint32(maxOps)
+	e.writeUint32(maxReqs)
+	e.writeUint32(0) // ca_rdma_ird<1>
+}
+
+// readChannelAttrs decodes channel_attrs4 and returns ca_maxrequests.
+func readChannelAttrs(d *xdrDecoder) uint32 {
+	for i := 0; i < 5; i++ {
+		d.readUint32()
+	}
+	maxReqs := d.readUint32()
+	if n := d.readUint32(); n > 1 {
+		d.err = fmt.Errorf("invalid ca_rdma_ird length %d", n)
+	} else if n == 1 {
+		d.readUint32()
+	}
+	return maxReqs
+}
+
+func (c *Client) createSession(epoch uint64) error {
+	c.mu.Lock()
+	clientID := c.clientID
+	seq := c.createSeq
+	c.mu.Unlock()
+
+	var comp compound
+	e := comp.op(opCreateSession)
+	e.writeUint64(clientID)
+	e.writeUint32(seq)
+	e.writeUint32(0) // csa_flags: no persistence, no back channel.
+	writeChannelAttrs(e, channelMaxIO+channelOverhead, channelMaxIO+channelOverhead, 16, maxSlots)
+	writeChannelAttrs(e, 4096, 4096, 2, 1)
+	e.writeUint32(0) // csa_cb_program
+	e.writeUint32(1) // csa_sec_parms<>
+	e.writeUint32(authNone)
+	return c.sendStandalone(&comp, opCreateSession, func(d *xdrDecoder) error {
+		sess := &session{epoch: epoch}
+		copy(sess.id[:], d.readFixedOpaque(len(sess.id)))
+		d.readUint32() // csr_sequence
+		d.readUint32() // csr_flags
+		maxReqs := readChannelAttrs(d)
+		readChannelAttrs(d)
+		if d.err != nil {
+			return d.err
+		}
+		sess.slots = newSlotTable(maxReqs)
+		c.mu.Lock()
+		c.sess = sess
+		c.createSeq++
+		c.lastRenew = time.Now()
+		c.mu.Unlock()
+		return nil
+	})
+}
+
+func (c *Client) fetchRoot() error {
+	var comp compound
+	comp.op(opPutRootFH)
+	comp.op(opGetFH)
+	comp.op(opGetAttr).writeBitmap(attrLeaseTime)
+	return c.call(func() *compound { return &comp }, func(r *compoundResult) error {
+		if _, err := r.next(opPutRootFH); err != nil {
+			return err
+		}
+		d, err := r.next(opGetFH)
+		if err != nil {
+			return err
+		}
+		c.rootFH = FileHandle(d.readOpaque(maxFHSize))
+		if d, err = r.next(opGetAttr); err != nil {
+			return err
+		}
+		c.leaseTime = defaultLeaseTime
+		if words := d.readBitmap(); len(words) > 0 && words[0]&(1<<attrLeaseTime) != 0 {
+			vals := xdrDecoder{buf: d.readOpaque(maxNameLen)}
+			if lease := vals.readUint32(); vals.err == nil && lease > 0 {
+				c.leaseTime = time.Duration(lease) * time.Second
+			}
+		}
+		return d.err
+	})
+}
+
+// sendStandalone sends a compound that isn't part of a session, and decodes
+// the result of its single operation with parse, if provided.
+func (c *Client) sendStandalone(comp *compound, opnum uint32, parse func(*xdrDecoder) error) error {
+	res, err := c.rpc.call(procCompound, comp.encode())
+	if err != nil {
+		return err
+	}
+	r, err := decodeCompoundResult(res)
+	if err != nil {
+		return err
+	}
+	d, err := r.next(opnum)
+	if err != nil || parse == nil {
+		return err
+	}
+	return parse(d)
+}
+
+// call sends the compound returned by build in the current session, and
+// decodes its results with parse. build is called again for every retry, so
+// that it can pick up state that changed in the meantime.
+//
+// The session and client ID are transparently re-established if the server
+// lost them.
+func (c *Client) call(build func() *compound, parse func(*compoundResult) error) error {
+	for attempt := 0; ; attempt++ {
+		c.mu.Lock()
+		sess := c.sess
+		c.mu.Unlock()
+
+		err := c.callOnce(build(), parse)
+		var s statusError
+		if !errors.As(err, &s) {
+			return err
+		}
+		switch {
+		case s.retriable():
+			if attempt >= maxRetries {
+				return err
+			}
+			time.Sleep(time.Duration(attempt+1) * 100 * time.Millisecond)
+		case s.sessionLost():
+			if err := c.recover(sess, false /* clientLost */); err != nil {
+				return err
+			}
+		case s.clientLost():
+			if err := c.recover(sess, true /* clientLost */); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// callOnce sends comp in the current session, preceded by a SEQUENCE
+// operation.
+func (c *Client) callOnce(comp *compound, parse func(*compoundResult) error) error {
+	c.mu.Lock()
+	sess := c.sess
+	c.mu.Unlock()
+
+	slot := sess.slots.acquire()
+	defer sess.slots.release(slot)
+	seq := sess.slots.seqIDs[slot] + 1
+
+	var full compound
+	e := full.op(opSequence)
+	e.writeFixedOpaque(sess.id[:])
+	e.writeUint32(seq)
+	e.writeUint32(slot)
+	e.writeUint32(uint32(len(sess.slots.seqIDs) - 1)) // sa_highest_slotid
+	e.writeBool(false)                                // sa_cachethis
+	full.numOps += comp.numOps
+	full.ops.buf = append(full.ops.buf, comp.ops.buf...)
+
+	res, err := c.rpc.call(procCompound, full.encode())
+	if err != nil {
+		return err
+	}
+	r, err := decodeCompoundResult(res)
+	if err != nil {
+		return err
+	}
+	d, err := r.next(opSequence)
+	if err != nil {
+		return err
+	}
+	sess.slots.seqIDs[slot] = seq
+	d.readFixedOpaque(len(sess.id))
+	for i := 0; i < 4; i++ {
+		d.readUint32() // sequenceid, slotid, highest_slotid, target_highest_slotid
+	}
+	flags := d.readUint32()
+	if d.err != nil {
+		return d.err
+	}
+	if flags&seq4StatusRestartReclaimNeeded != 0 {
+		log.Warningf("nfs: server restarted, open and lock state was lost")
+	}
+	c.mu.Lock()
+	c.lastRenew = time.Now()
+	c.mu.Unlock()
+	return parse(r)
+}
+
+// recover re-establishes the session, or the client ID if clientLost is true,
+// unless that already happened since sess was current.
+func (c *Client) recover(sess *session, clientLost bool) error {
+	c.recoveryMu.Lock()
+	defer c.recoveryMu.Unlock()
+
+	c.mu.Lock()
+	cur := c.sess
+	c.mu.Unlock()
+	if cur != sess {
+		return nil
+	}
+
+	if !clientLost {
+		log.Infof("nfs: session lost, creating a new one")
+		err := c.createSession(sess.epoch)
+		var s statusError
+		if !errors.As(err, &s) || !s.clientLost() {
+			return err
+		}
+	}
+	log.Warningf("nfs: client ID lost, all open and lock state is gone")
+	return c.establish(sess.epoch + 1)
+}
+
+// epoch returns the epoch of the current client ID.
+func (c *Client) epoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sess.epoch
+}
+
+// renewLoop keeps the lease alive while the client is idle. Every successful
+// SEQUENCE operation renews the lease, so it only sends requests when no
+// other request was sent for a third of the lease period.
+func (c *Client) renewLoop() {
+	defer c.wg.Done()
+	interval := c.leaseTime / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		idle := time.Since(c.lastRenew) >= interval
+		c.mu.Unlock()
+		if !idle {
+			continue
+		}
+		err := c.call(func() *compound { return &compound{} }, func(*compoundResult) error { return nil })
+		if err != nil {
+			log.Warningf("nfs: renewing lease failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"fmt"
+)
+
+const (
+	// maxFHSize is NFS4_FHSIZE.
+	maxFHSize = 128
+
+	// maxNameLen bounds names and other strings received from the server.
+	maxNameLen = 4096
+
+	// maxDataLen bounds READ replies.
+	maxDataLen = rpcMaxRecord
+)
+
+// compound builds the arguments of a COMPOUND procedure.
+type compound struct {
+	ops    xdrEncoder
+	numOps uint32
+}
+
+// op starts an operation and returns the encoder for its arguments.
+func (c *compound) op(opnum uint32) *xdrEncoder {
+	c.numOps++
+	c.ops.writeUint32(opnum)
+	return &c.ops
+}
+
+// encode returns the encoded COMPOUND4args.
+func (c *compound) encode() []byte {
+	var e xdrEncoder
+	e.writeString("") // tag
+	e.writeUint32(nfsMinorVers)
+	e.writeUint32(c.numOps)
+	e.buf = append(e.buf, c.ops.buf...)
+	return e.buf
+}
+
+// compoundResult decodes the results of a COMPOUND procedure.
+type compoundResult struct {
+	d xdrDecoder
+
+	// status is the status of the last operation that the server evaluated.
+	status uint32
+
+	// remaining is the number of operation results that haven't been decoded.
+	remaining uint32
+}
+
+func decodeCompoundResult(b []byte) (*compoundResult, error) {
+	r := &compoundResult{d: xdrDecoder{buf: b}}
+	r.status = r.d.readUint32()
+	r.d.readString(maxNameLen) // tag
+	r.remaining = r.d.readUint32()
+	if r.d.err != nil {
+		return nil, r.d.err
+	}
+	return r, nil
+}
+
+// next decodes the header of the next operation result, which must be for
+// opnum, and returns the decoder for the operation's result body. If the
+// operation failed, next returns a statusError and the decoder can still be
+// used to read failure details, e.g. LOCK4denied.
+func (r *compoundResult) next(opnum uint32) (*xdrDecoder, error) {
+	if r.remaining == 0 {
+		if r.status != nfs4OK {
+			// The server stopped before opnum, because of an error in an
+			// operation whose result was already consumed.
+			return nil, statusError(r.status)
+		}
+		return nil, fmt.Errorf("missing result for operation %d", opnum)
+	}
+	r.remaining--
+	got := r.d.readUint32()
+	status := r.d.readUint32()
+	if r.d.err != nil {
+		return nil, r.d.err
+	}
+	if got != opnum {
+		return nil, fmt.Errorf("unexpected result for operation %d, want %d", got, opnum)
+	}
+	if status != nfs4OK {
+		return &r.d, statusError(status)
+	}
+	return &r.d, nil
+}
+
+// stateID is a stateid4.
+type stateID struct {
+	seqID uint32
+	other [12]byte
+}
+
+func (e *xdrEncoder) writeStateID(s stateID) {
+	e.writeUint32(s.seqID)
+	e.writeFixedOpaque(s.other[:])
+}
+
+func (d *xdrDecoder) readStateID() stateID {
+	var s stateID
+	s.seqID = d.readUint32()
+	copy(s.other[:], d.readFixedOpaque(len(s.other)))
+	return s
+}
@@ -0,0 +1,372 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"reflect"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	fslock "gvisor.dev/gvisor/pkg/sentry/fsimpl/lock"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	// lockMinBackoff and lockMaxBackoff bound the interval at which blocking
+	// lock requests poll the server. NFSv4.1 servers can't notify the client
+	// without a back channel.
+	lockMinBackoff = 10 * time.Millisecond
+	lockMaxBackoff = time.Second
+)
+
+// regularFileFD implements vfs.FileDescriptionImpl for regular files.
+//
+// Data isn't cached in the sentry: reads and writes go to the server, so
+// regular files on NFS mounts can't be memory-mapped.
+//
+// +stateify savable
+type regularFileFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.LockFD
+
+	// inode is the file's inode. inode is immutable.
+	inode *inode
+
+	// file is the open state of the file on the server. file is immutable.
+	file *OpenFile `state:"nosave"`
+
+	// mu protects off.
+	mu sync.Mutex `state:"nosave"`
+
+	// +checklocks:mu
+	off int64
+}
+
+// openRegular opens the regular file represented by i.
+func (i *inode) openRegular(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	if opts.Flags&linux.O_DIRECT != 0 {
+		return nil, linuxerr.EINVAL
+	}
+	i.attrMu.Lock()
+	f := i.created
+	i.created = nil
+	i.attrMu.Unlock()
+	if f == nil {
+		var (
+			attr Attr
+			err  error
+		)
+		f, attr, err = i.fs.client.OpenHandle(i.fh, openAccess(opts.Flags))
+		if err != nil {
+			return nil, ToErrno(err)
+		}
+		i.attrMu.Lock()
+		i.setAttrLocked(attr)
+		i.attrMu.Unlock()
+	}
+	fd := &regularFileFD{inode: i, file: f}
+	if opts.Flags&linux.O_TRUNC != 0 && opts.Flags&linux.O_ACCMODE != linux.O_RDONLY {
+		i.attrMu.Lock()
+		attr, err := i.fs.client.SetAttr(i.fh, SetAttrOptions{Mask: SetSize})
+		if err == nil {
+			i.setAttrLocked(attr)
+		}
+		i.attrMu.Unlock()
+		if err != nil {
+			fd.closeFile()
+			return nil, ToErrno(err)
+		}
+	}
+	fd.LockFD.Init(&i.locks)
+	if err := fd.vfsfd.Init(fd, opts.Flags, rp.Mount(), d.VFSDentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		fd.closeFile()
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// closeFile releases fd.file.
+func (fd *regularFileFD) closeFile() {
+	if err := fd.inode.fs.client.CloseFile(fd.file); err != nil {
+		log.Warningf("nfs: closing file failed: %v", err)
+	}
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *regularFileFD) Release(ctx context.Context) {
+	fd.closeFile()
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if opts.Flags&^linux.RWF_HIPRI != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	var total int64
+	for dst.NumBytes() > 0 {
+		count := uint32(fd.inode.fs.opts.rsize)
+		if int64(count) > dst.NumBytes() {
+			count = uint32(dst.NumBytes())
+		}
+		data, eof, err := fd.inode.fs.client.Read(fd.file, uint64(offset+total), count)
+		if err != nil {
+			return total, ToErrno(err)
+		}
+		n, err := dst.CopyOut(ctx, data)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		if eof || len(data) == 0 {
+			break
+		}
+		dst = dst.DropFirst(n)
+	}
+	return total, nil
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	n, err := fd.PRead(ctx, dst, fd.off, opts)
+	fd.off += n
+	return n, err
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *regularFileFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if opts.Flags&^(linux.RWF_HIPRI|linux.RWF_DSYNC|linux.RWF_SYNC) != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	limit, err := vfs.CheckLimit(ctx, offset, src.NumBytes())
+	if err != nil {
+		return 0, err
+	}
+	src = src.TakeFirst64(limit)
+	stable := opts.Flags&(linux.RWF_DSYNC|linux.RWF_SYNC) != 0 || fd.vfsfd.StatusFlags()&(linux.O_DSYNC|linux.O_SYNC) != 0
+
+	var total int64
+	err = nil
+	buf := make([]byte, 0, fd.inode.fs.opts.wsize)
+	for src.NumBytes() > 0 {
+		count := int64(cap(buf))
+		if count > src.NumBytes() {
+			count = src.NumBytes()
+		}
+		buf = buf[:count]
+		var n int
+		n, err = src.CopyIn(ctx, buf)
+		if n == 0 {
+			break
+		}
+		written, werr := fd.inode.fs.client.Write(fd.file, uint64(offset+total), buf[:n], stable)
+		total += int64(written)
+		if werr != nil {
+			err = ToErrno(werr)
+		}
+		if err != nil || int(written) < n {
+			break
+		}
+		src = src.DropFirst(n)
+	}
+	if total > 0 {
+		fd.inode.invalidateAttr()
+	}
+	return total, err
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *regularFileFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.vfsfd.StatusFlags()&linux.O_APPEND != 0 {
+		// Other clients may have extended the file.
+		i := fd.inode
+		i.attrMu.Lock()
+		err := i.refreshAttrLocked(true /* force */)
+		size := i.attr.Size
+		i.attrMu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		fd.off = int64(size)
+	}
+	n, err := fd.PWrite(ctx, src, fd.off, opts)
+	fd.off += n
+	return n, err
+}
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	switch whence {
+	case linux.SEEK_SET:
+	case linux.SEEK_CUR:
+		offset += fd.off
+	case linux.SEEK_END:
+		i := fd.inode
+		i.attrMu.Lock()
+		err := i.refreshAttrLocked(true /* force */)
+		size := i.attr.Size
+		i.attrMu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(size)
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	fd.off = offset
+	return offset, nil
+}
+
+// Sync implements vfs.FileDescriptionImpl.Sync.
+func (fd *regularFileFD) Sync(ctx context.Context) error {
+	return ToErrno(fd.inode.fs.client.Commit(fd.file))
+}
+
+// lockOwner returns the lock owner for uid. Lock owners only need to be
+// unique among the lock owners that hold locks at the same time, and uid is
+// a pointer to an object that outlives its locks, since they are released
+// when the FD table or file description that owns them is dropped.
+func lockOwner(uid fslock.UniqueID) uint64 {
+	return uint64(reflect.ValueOf(uid).Pointer())
+}
+
+// lockRange returns the offset and length of r.
+func lockRange(r fslock.LockRange) (uint64, uint64) {
+	if r.End == fslock.LockEOF {
+		return r.Start, LockToEOF
+	}
+	return r.Start, r.End - r.Start
+}
+
+// LockPOSIX implements vfs.FileDescriptionImpl.LockPOSIX.
+//
+// Unless the nolock mount option is set, locks are taken on the server, so
+// that they are enforced against other clients. They are also recorded in
+// the sentry, so that F_GETLK can report the PID of conflicting lock holders
+// in the sandbox.
+func (fd *regularFileFD) LockPOSIX(ctx context.Context, uid fslock.UniqueID, ownerPID int32, t fslock.LockType, r fslock.LockRange, block bool) error {
+	if fd.inode.fs.opts.localLocks {
+		return fd.Locks().LockPOSIX(ctx, uid, ownerPID, t, r, block)
+	}
+	typ := ReadLock
+	if t == fslock.WriteLock {
+		typ = WriteLock
+	}
+	off, length := lockRange(r)
+	owner := lockOwner(uid)
+	backoff := lockMinBackoff
+	for {
+		err := fd.inode.fs.client.Lock(fd.file, owner, typ, off, length)
+		if err == nil {
+			break
+		}
+		if err = ToErrno(err); !linuxerr.Equals(linuxerr.EAGAIN, err) {
+			return err
+		}
+		if !block {
+			return linuxerr.ErrWouldBlock
+		}
+		ch := make(chan struct{})
+		timer := time.AfterFunc(backoff, func() { close(ch) })
+		err = ctx.Block(ch)
+		timer.Stop()
+		if err != nil {
+			return linuxerr.ERESTARTSYS
+		}
+		if backoff *= 2; backoff > lockMaxBackoff {
+			backoff = lockMaxBackoff
+		}
+	}
+	// The server resolved conflicts with all other lock owners, including
+	// those in the sandbox, so this can't block.
+	if err := fd.Locks().LockPOSIX(ctx, uid, ownerPID, t, r, false /* block */); err != nil {
+		log.Warningf("nfs: lock granted by the server conflicts with a local lock: %v", err)
+	}
+	return nil
+}
+
+// UnlockPOSIX implements vfs.FileDescriptionImpl.UnlockPOSIX.
+func (fd *regularFileFD) UnlockPOSIX(ctx context.Context, uid fslock.UniqueID, r fslock.LockRange) error {
+	fd.Locks().UnlockPOSIX(ctx, uid, r)
+	if fd.inode.fs.opts.localLocks {
+		return nil
+	}
+	off, length := lockRange(r)
+	if err := fd.inode.fs.client.Unlock(fd.file, lockOwner(uid), off, length); err != nil {
+		// Unlocking never fails on Linux either: a lock that can't be
+		// released on the server is dropped when the file is closed or the
+		// lease expires.
+		log.Warningf("nfs: releasing lock on the server failed: %v", err)
+	}
+	return nil
+}
+
+// TestPOSIX implements vfs.FileDescriptionImpl.TestPOSIX.
+func (fd *regularFileFD) TestPOSIX(ctx context.Context, uid fslock.UniqueID, t fslock.LockType, r fslock.LockRange) (linux.Flock, error) {
+	flock, err := fd.Locks().TestPOSIX(ctx, uid, t, r)
+	if err != nil || flock.Type != linux.F_UNLCK || fd.inode.fs.opts.localLocks {
+		return flock, err
+	}
+	typ := ReadLock
+	if t == fslock.WriteLock {
+		typ = WriteLock
+	}
+	off, length := lockRange(r)
+	conflict, err := fd.inode.fs.client.TestLock(fd.file, lockOwner(uid), typ, off, length)
+	if err != nil {
+		return linux.Flock{}, ToErrno(err)
+	}
+	if conflict == nil {
+		return flock, nil
+	}
+	flock = linux.Flock{
+		Type:   linux.F_RDLCK,
+		Whence: linux.SEEK_SET,
+		Start:  int64(conflict.Offset),
+		// The holder is another client, which has no PID in the sandbox.
+		PID: 0,
+	}
+	if conflict.Type == WriteLock {
+		flock.Type = linux.F_WRLCK
+	}
+	if conflict.Length != LockToEOF {
+		flock.Len = int64(conflict.Length)
+	}
+	return flock, nil
+}
@@ -0,0 +1,314 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// Name is the filesystem name.
+const Name = "nfs"
+
+const (
+	// minIOSize is the smallest rsize or wsize accepted.
+	minIOSize = 4096
+
+	// defaultAttrTimeout is the default value of the actimeo mount option.
+	defaultAttrTimeout = 3 * time.Second
+)
+
+// FilesystemType implements vfs.FilesystemType.
+//
+// NFS filesystems can't be mounted by applications, since they require a
+// connection to the server passed in InternalData.
+//
+// +stateify savable
+type FilesystemType struct{}
+
+// InternalData contains internal data passed in to the NFS mount via
+// vfs.GetFilesystemOptions.InternalData.
+type InternalData struct {
+	// FD is the host FD of a stream socket connected to the server.
+	// GetFilesystem takes ownership of FD.
+	FD int
+}
+
+// filesystemOptions are the parsed mount options.
+//
+// +stateify savable
+type filesystemOptions struct {
+	// mopts contains the raw, unparsed mount options.
+	mopts string
+
+	// rsize and wsize are the maximum number of bytes in a READ or WRITE
+	// request.
+	rsize uint32
+	wsize uint32
+
+	// attrTimeout is how long cached attributes are used before they are
+	// fetched from the server again. It's set by the actimeo and noac mount
+	// options.
+	attrTimeout time.Duration
+
+	// localLocks is set by the nolock mount option. If true, POSIX locks are
+	// only visible within the sandbox instead of being taken on the server.
+	localLocks bool
+}
+
+// parseOptions parses the mount options in data.
+func parseOptions(data string) (filesystemOptions, error) {
+	opts := filesystemOptions{
+		mopts:       data,
+		rsize:       channelMaxIO,
+		wsize:       channelMaxIO,
+		attrTimeout: defaultAttrTimeout,
+	}
+	mopts := vfs.GenericParseMountOptions(data)
+	parseSize := func(name string) (uint32, error) {
+		size, err := strconv.ParseUint(mopts[name], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %q", name, mopts[name])
+		}
+		delete(mopts, name)
+		if size < minIOSize {
+			size = minIOSize
+		}
+		if size > channelMaxIO {
+			size = channelMaxIO
+		}
+		return uint32(size), nil
+	}
+	for _, name := range []string{"vers", "nfsvers"} {
+		if vers, ok := mopts[name]; ok {
+			delete(mopts, name)
+			// vers=4 lets the client pick the minor version.
+			if vers != "4" && vers != "4.1" {
+				return opts, fmt.Errorf("unsupported NFS version %q, only 4.1 is supported", vers)
+			}
+		}
+	}
+	if minor, ok := mopts["minorversion"]; ok {
+		delete(mopts, "minorversion")
+		if minor != "1" {
+			return opts, fmt.Errorf("unsupported NFS minor version %q, only 1 is supported", minor)
+		}
+	}
+	if _, ok := mopts["rsize"]; ok {
+		size, err := parseSize("rsize")
+		if err != nil {
+			return opts, err
+		}
+		opts.rsize = size
+	}
+	if _, ok := mopts["wsize"]; ok {
+		size, err := parseSize("wsize")
+		if err != nil {
+			return opts, err
+		}
+		opts.wsize = size
+	}
+	if str, ok := mopts["actimeo"]; ok {
+		delete(mopts, "actimeo")
+		secs, err := strconv.ParseUint(str, 10, 32)
+		if err != nil {
+			return opts, fmt.Errorf("invalid actimeo: %q", str)
+		}
+		opts.attrTimeout = time.Duration(secs) * time.Second
+	}
+	if _, ok := mopts["noac"]; ok {
+		delete(mopts, "noac")
+		opts.attrTimeout = 0
+	}
+	if _, ok := mopts["lock"]; ok {
+		delete(mopts, "lock")
+		opts.localLocks = false
+	}
+	if _, ok := mopts["nolock"]; ok {
+		delete(mopts, "nolock")
+		opts.localLocks = true
+	}
+	if len(mopts) != 0 {
+		return opts, fmt.Errorf("unsupported or unknown options: %v", mopts)
+	}
+	return opts, nil
+}
+
+// parseSource splits an NFS mount source of the form "host:/path" and returns
+// the components of the path. host may be a bracketed IPv6 address.
+func parseSource(source string) ([]string, error) {
+	i := strings.Index(source, ":/")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid source %q, want host:/path", source)
+	}
+	var components []string
+	for _, c := range strings.Split(source[i+1:], "/") {
+		switch c {
+		case "", ".":
+		case "..":
+			return nil, fmt.Errorf("invalid source %q: path contains \"..\"", source)
+		default:
+			components = append(components, c)
+		}
+	}
+	return components, nil
+}
+
+// filesystem implements vfs.FilesystemImpl.
+//
+// +stateify savable
+type filesystem struct {
+	kernfs.Filesystem
+
+	devMinor uint32
+
+	// opts are the mount options. opts is immutable.
+	opts filesystemOptions
+
+	// client is the connection to the server. NFS mounts can't be saved, see
+	// PrepareSave.
+	client *Client `state:"nosave"`
+}
+
+// Name implements vfs.FilesystemType.Name.
+func (FilesystemType) Name() string {
+	return Name
+}
+
+// Release implements vfs.FilesystemType.Release.
+func (FilesystemType) Release(ctx context.Context) {}
+
+// GetFilesystem implements vfs.FilesystemType.GetFilesystem.
+func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, source string, opts vfs.GetFilesystemOptions) (*vfs.Filesystem, *vfs.Dentry, error) {
+	idata, ok := opts.InternalData.(*InternalData)
+	if !ok || idata == nil {
+		ctx.Warningf("%s.GetFilesystem: missing internal data", fsType.Name())
+		return nil, nil, linuxerr.EINVAL
+	}
+	fsopts, err := parseOptions(opts.Data)
+	if err != nil {
+		_ = unix.Close(idata.FD)
+		ctx.Warningf("%s.GetFilesystem: %v", fsType.Name(), err)
+		return nil, nil, linuxerr.EINVAL
+	}
+	path, err := parseSource(source)
+	if err != nil {
+		_ = unix.Close(idata.FD)
+		ctx.Warningf("%s.GetFilesystem: %v", fsType.Name(), err)
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	machineName := "gvisor"
+	if k := kernel.KernelFromContext(ctx); k != nil {
+		machineName = k.RootUTSNamespace().HostName()
+	}
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		_ = unix.Close(idata.FD)
+		return nil, nil, err
+	}
+	client, err := NewClient(&hostConn{fd: idata.FD}, ClientOptions{
+		// The owner ID must be unique among all clients of the server,
+		// including other mounts in the same sandbox.
+		OwnerID:     fmt.Sprintf("gvisor/%s/%s", machineName, hex.EncodeToString(nonce[:])),
+		MachineName: machineName,
+		UID:         uint32(creds.EffectiveKUID),
+		GID:         uint32(creds.EffectiveKGID),
+	})
+	if err != nil {
+		// NewClient closed conn.
+		ctx.Warningf("%s.GetFilesystem: connecting to the server: %v", fsType.Name(), err)
+		return nil, nil, ToErrno(err)
+	}
+
+	rootFH := client.Root()
+	rootAttr, err := client.GetAttr(rootFH)
+	for _, name := range path {
+		if err != nil {
+			break
+		}
+		rootFH, rootAttr, err = client.Lookup(rootFH, name)
+	}
+	if err == nil && rootAttr.Type != TypeDirectory {
+		err = linuxerr.ENOTDIR
+	}
+	if err != nil {
+		client.Shutdown()
+		ctx.Warningf("%s.GetFilesystem: looking up %q: %v", fsType.Name(), source, err)
+		return nil, nil, ToErrno(err)
+	}
+
+	devMinor, err := vfsObj.GetAnonBlockDevMinor()
+	if err != nil {
+		client.Shutdown()
+		return nil, nil, err
+	}
+	fs := &filesystem{
+		devMinor: devMinor,
+		opts:     fsopts,
+		client:   client,
+	}
+	fs.VFSFilesystem().Init(vfsObj, &fsType, fs)
+
+	var root kernfs.Dentry
+	root.InitRoot(&fs.Filesystem, fs.newInode(rootFH, rootAttr))
+	return fs.VFSFilesystem(), root.VFSDentry(), nil
+}
+
+// Release implements vfs.FilesystemImpl.Release.
+func (fs *filesystem) Release(ctx context.Context) {
+	fs.Filesystem.VFSFilesystem().VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
+	fs.Filesystem.Release(ctx)
+	fs.client.Shutdown()
+}
+
+// MountOptions implements vfs.FilesystemImpl.MountOptions.
+func (fs *filesystem) MountOptions() string {
+	return fs.opts.mopts
+}
+
+// PrepareSave implements vfs.FilesystemImplSaveRestoreExtension.PrepareSave.
+func (fs *filesystem) PrepareSave(ctx context.Context) error {
+	// Open and lock state lives on the server and is tied to the client ID,
+	// which can't be carried over to a restored sandbox.
+	return fmt.Errorf("NFS mounts can't be checkpointed")
+}
+
+// CompleteRestore implements
+// vfs.FilesystemImplSaveRestoreExtension.CompleteRestore.
+func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRestoreOptions) error {
+	return nil
+}
+
+// statFS returns the result of statfs(2) on the filesystem.
+func (fs *filesystem) statFS() linux.Statfs {
+	st := vfs.GenericStatFS(linux.NFS_SUPER_MAGIC)
+	st.BlockSize = int64(fs.opts.wsize)
+	st.FragmentSize = int64(fs.opts.wsize)
+	return st
+}
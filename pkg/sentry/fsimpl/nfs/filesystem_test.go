@@ -0,0 +1,170 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOptions(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		data    string
+		want    filesystemOptions
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			data: "",
+			want: filesystemOptions{
+				rsize:       channelMaxIO,
+				wsize:       channelMaxIO,
+				attrTimeout: defaultAttrTimeout,
+			},
+		},
+		{
+			name: "all",
+			data: "vers=4.1,minorversion=1,rsize=65536,wsize=8192,actimeo=10,nolock",
+			want: filesystemOptions{
+				rsize:       65536,
+				wsize:       8192,
+				attrTimeout: 10 * time.Second,
+				localLocks:  true,
+			},
+		},
+		{
+			name: "clamped sizes",
+			data: "nfsvers=4,rsize=1,wsize=4294967295,noac,lock",
+			want: filesystemOptions{
+				rsize: minIOSize,
+				wsize: channelMaxIO,
+			},
+		},
+		{
+			name:    "NFSv3",
+			data:    "vers=3",
+			wantErr: true,
+		},
+		{
+			name:    "NFSv4.2",
+			data:    "minorversion=2",
+			wantErr: true,
+		},
+		{
+			name:    "invalid size",
+			data:    "rsize=big",
+			wantErr: true,
+		},
+		{
+			name:    "invalid actimeo",
+			data:    "actimeo=-1",
+			wantErr: true,
+		},
+		{
+			name:    "unknown option",
+			data:    "hard",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseOptions(test.data)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parseOptions(%q) succeeded, want error", test.data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOptions(%q) failed: %v", test.data, err)
+			}
+			test.want.mopts = test.data
+			if got != test.want {
+				t.Errorf("parseOptions(%q) = %+v, want %+v", test.data, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	for _, test := range []struct {
+		source  string
+		want    []string
+		wantErr bool
+	}{
+		{source: "server:/", want: nil},
+		{source: "server:/export/./home//user/", want: []string{"export", "home", "user"}},
+		{source: "[fd00::1]:/export", want: []string{"export"}},
+		{source: "server", wantErr: true},
+		{source: "server:/export/../etc", wantErr: true},
+	} {
+		got, err := parseSource(test.source)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseSource(%q) succeeded, want error", test.source)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSource(%q) failed: %v", test.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseSource(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestWriteAttr(t *testing.T) {
+	var e xdrEncoder
+	e.writeAttr(&SetAttrOptions{
+		Mask:     SetSize | SetMode | SetGID | SetAtime | SetMtime,
+		Size:     1 << 33,
+		Mode:     0o104755,
+		GID:      100,
+		Atime:    Time{Sec: 5, Nsec: 6},
+		MtimeNow: true,
+	})
+
+	d := xdrDecoder{buf: e.buf}
+	words := d.readBitmap()
+	want := []uint32{1 << attrSize, 1<<(attrMode-32) | 1<<(attrOwnerGroup-32) | 1<<(attrTimeAccessSet-32) | 1<<(attrTimeModifySet-32)}
+	if !reflect.DeepEqual(words, want) {
+		t.Fatalf("bitmap = %#x, want %#x", words, want)
+	}
+	vals := xdrDecoder{buf: d.readOpaque(1024)}
+	if got := vals.readUint64(); got != 1<<33 {
+		t.Errorf("size = %d, want %d", got, uint64(1<<33))
+	}
+	if got := vals.readUint32(); got != 0o4755 {
+		t.Errorf("mode = %#o, want %#o", got, 0o4755)
+	}
+	if got := vals.readString(64); got != "100" {
+		t.Errorf("owner_group = %q, want %q", got, "100")
+	}
+	if how := vals.readUint32(); how != 1 {
+		t.Errorf("time_access_set = %d, want SET_TO_CLIENT_TIME4", how)
+	}
+	if sec, nsec := vals.readUint64(), vals.readUint32(); sec != 5 || nsec != 6 {
+		t.Errorf("atime = %d.%09d, want 5.000000006", sec, nsec)
+	}
+	if how := vals.readUint32(); how != 0 {
+		t.Errorf("time_modify_set = %d, want SET_TO_SERVER_TIME4", how)
+	}
+	if vals.err != nil || len(vals.buf) != 0 || d.err != nil || len(d.buf) != 0 {
+		t.Errorf("decoder errors %v, %v; %d, %d bytes left", vals.err, d.err, len(vals.buf), len(d.buf))
+	}
+}
@@ -0,0 +1,455 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// inode implements kernfs.Inode for a file on the server.
+//
+// Inodes are not kept in the dentry tree once they're unused, so that path
+// resolution picks up changes made by other clients of the server.
+//
+// +stateify savable
+type inode struct {
+	kernfs.InodeNoopRefCount
+	kernfs.InodeNotAnonymous
+	kernfs.InodeTemporary
+	kernfs.InodeWatches
+
+	// OrderedChildren is always empty. It only provides the static children
+	// of kernfs.GenericDirectoryFD, which are followed by the entries
+	// returned by IterDirents.
+	kernfs.OrderedChildren
+
+	// fs is the owning filesystem. fs is immutable.
+	fs *filesystem
+
+	// fh is the file handle of the file. fh is immutable.
+	fh FileHandle
+
+	// ftype is the file type. ftype is immutable.
+	ftype linux.FileMode
+
+	locks vfs.FileLocks
+
+	// attrMu protects the fields below. It may be held across calls to the
+	// server.
+	attrMu sync.Mutex `state:"nosave"`
+
+	// attr are the cached attributes of the file.
+	//
+	// +checklocks:attrMu
+	attr Attr `state:"nosave"`
+
+	// attrTime is the time at which attr was fetched. It's zero if attr must
+	// be fetched again before it's used.
+	//
+	// +checklocks:attrMu
+	attrTime time.Time `state:"nosave"`
+
+	// created is the open file returned by the OPEN that created the file. It
+	// is consumed by the first Open, which would otherwise have to open the
+	// file again.
+	//
+	// +checklocks:attrMu
+	created *OpenFile `state:"nosave"`
+}
+
+// fileType returns the file type bits for an nfs_ftype4.
+func fileType(typ uint32) linux.FileMode {
+	switch typ {
+	case TypeDirectory:
+		return linux.ModeDirectory
+	case TypeBlock:
+		return linux.ModeBlockDevice
+	case TypeChar:
+		return linux.ModeCharacterDevice
+	case TypeSymlink:
+		return linux.ModeSymlink
+	case TypeSocket:
+		return linux.ModeSocket
+	case TypeFIFO:
+		return linux.ModeNamedPipe
+	default:
+		return linux.ModeRegular
+	}
+}
+
+func (fs *filesystem) newInode(fh FileHandle, attr Attr) *inode {
+	i := &inode{
+		fs:       fs,
+		fh:       fh,
+		ftype:    fileType(attr.Type),
+		attr:     attr,
+		attrTime: time.Now(),
+	}
+	i.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	return i
+}
+
+// refreshAttrLocked fetches the attributes of the file from the server if
+// force is true or the cached attributes expired.
+//
+// +checklocks:i.attrMu
+func (i *inode) refreshAttrLocked(force bool) error {
+	if !force && !i.attrTime.IsZero() && time.Since(i.attrTime) < i.fs.opts.attrTimeout {
+		return nil
+	}
+	attr, err := i.fs.client.GetAttr(i.fh)
+	if err != nil {
+		return ToErrno(err)
+	}
+	i.setAttrLocked(attr)
+	return nil
+}
+
+// +checklocks:i.attrMu
+func (i *inode) setAttrLocked(attr Attr) {
+	i.attr = attr
+	i.attrTime = time.Now()
+}
+
+// invalidateAttr causes the attributes to be fetched from the server the next
+// time they're used, after the file was changed.
+func (i *inode) invalidateAttr() {
+	i.attrMu.Lock()
+	i.attrTime = time.Time{}
+	i.attrMu.Unlock()
+}
+
+// +checklocks:i.attrMu
+func (i *inode) modeLocked() linux.FileMode {
+	return i.ftype | linux.FileMode(i.attr.Mode&^linux.S_IFMT)
+}
+
+// Mode implements kernfs.Inode.Mode.
+func (i *inode) Mode() linux.FileMode {
+	i.attrMu.Lock()
+	defer i.attrMu.Unlock()
+	return i.modeLocked()
+}
+
+// UID implements kernfs.Inode.UID.
+func (i *inode) UID() auth.KUID {
+	i.attrMu.Lock()
+	defer i.attrMu.Unlock()
+	return auth.KUID(i.attr.UID)
+}
+
+// GID implements kernfs.Inode.GID.
+func (i *inode) GID() auth.KGID {
+	i.attrMu.Lock()
+	defer i.attrMu.Unlock()
+	return auth.KGID(i.attr.GID)
+}
+
+// Valid implements kernfs.Inode.Valid.
+func (i *inode) Valid(ctx context.Context) bool {
+	i.attrMu.Lock()
+	defer i.attrMu.Unlock()
+	err := i.refreshAttrLocked(false /* force */)
+	// Other failures, e.g. a lost connection, don't mean that the file is
+	// gone.
+	return !linuxerr.Equals(linuxerr.ESTALE, err) && !linuxerr.Equals(linuxerr.ENOENT, err)
+}
+
+// CheckPermissions implements kernfs.Inode.CheckPermissions.
+//
+// All requests are sent with the credentials of the mount, so the sentry
+// checks permissions on behalf of the server, based on the file's attributes.
+func (i *inode) CheckPermissions(ctx context.Context, creds *auth.Credentials, ats vfs.AccessTypes) error {
+	i.attrMu.Lock()
+	defer i.attrMu.Unlock()
+	if err := i.refreshAttrLocked(false /* force */); err != nil {
+		return err
+	}
+	return vfs.GenericCheckPermissions(creds, ats, i.modeLocked(), auth.KUID(i.attr.UID), auth.KGID(i.attr.GID))
+}
+
+// Stat implements kernfs.Inode.Stat.
+func (i *inode) Stat(ctx context.Context, fs *vfs.Filesystem, opts vfs.StatOptions) (linux.Statx, error) {
+	i.attrMu.Lock()
+	defer i.attrMu.Unlock()
+	if err := i.refreshAttrLocked(opts.Sync == linux.AT_STATX_FORCE_SYNC); err != nil {
+		return linux.Statx{}, err
+	}
+	attr := &i.attr
+	return linux.Statx{
+		Mask:     linux.STATX_BASIC_STATS,
+		Blksize:  i.fs.opts.rsize,
+		Nlink:    attr.Nlink,
+		UID:      attr.UID,
+		GID:      attr.GID,
+		Mode:     uint16(i.modeLocked()),
+		Ino:      attr.FileID,
+		Size:     attr.Size,
+		Blocks:   (attr.SpaceUsed + 511) / 512,
+		Atime:    linux.StatxTimestamp{Sec: attr.Atime.Sec, Nsec: attr.Atime.Nsec},
+		Ctime:    linux.StatxTimestamp{Sec: attr.Ctime.Sec, Nsec: attr.Ctime.Nsec},
+		Mtime:    linux.StatxTimestamp{Sec: attr.Mtime.Sec, Nsec: attr.Mtime.Nsec},
+		DevMajor: linux.UNNAMED_MAJOR,
+		DevMinor: i.fs.devMinor,
+	}, nil
+}
+
+// SetStat implements kernfs.Inode.SetStat.
+func (i *inode) SetStat(ctx context.Context, fs *vfs.Filesystem, creds *auth.Credentials, opts vfs.SetStatOptions) error {
+	stat := &opts.Stat
+	if stat.Mask == 0 {
+		return nil
+	}
+	if stat.Mask&^(linux.STATX_SIZE|linux.STATX_MODE|linux.STATX_UID|linux.STATX_GID|linux.STATX_ATIME|linux.STATX_MTIME) != 0 {
+		return linuxerr.EPERM
+	}
+	i.attrMu.Lock()
+	defer i.attrMu.Unlock()
+	if err := vfs.CheckSetStat(ctx, creds, &opts, i.modeLocked(), auth.KUID(i.attr.UID), auth.KGID(i.attr.GID)); err != nil {
+		return err
+	}
+	var sopts SetAttrOptions
+	if stat.Mask&linux.STATX_SIZE != 0 {
+		switch i.ftype {
+		case linux.ModeRegular:
+		case linux.ModeDirectory:
+			return linuxerr.EISDIR
+		default:
+			return linuxerr.EINVAL
+		}
+		sopts.Mask |= SetSize
+		sopts.Size = stat.Size
+	}
+	if stat.Mask&linux.STATX_MODE != 0 {
+		sopts.Mask |= SetMode
+		sopts.Mode = uint32(stat.Mode)
+	}
+	if stat.Mask&linux.STATX_UID != 0 {
+		sopts.Mask |= SetUID
+		sopts.UID = stat.UID
+	}
+	if stat.Mask&linux.STATX_GID != 0 {
+		sopts.Mask |= SetGID
+		sopts.GID = stat.GID
+	}
+	if stat.Mask&linux.STATX_ATIME != 0 && stat.Atime.Nsec != linux.UTIME_OMIT {
+		sopts.Mask |= SetAtime
+		sopts.Atime = Time{Sec: stat.Atime.Sec, Nsec: stat.Atime.Nsec}
+		sopts.AtimeNow = stat.Atime.Nsec == linux.UTIME_NOW
+	}
+	if stat.Mask&linux.STATX_MTIME != 0 && stat.Mtime.Nsec != linux.UTIME_OMIT {
+		sopts.Mask |= SetMtime
+		sopts.Mtime = Time{Sec: stat.Mtime.Sec, Nsec: stat.Mtime.Nsec}
+		sopts.MtimeNow = stat.Mtime.Nsec == linux.UTIME_NOW
+	}
+	if sopts.Mask == 0 {
+		return nil
+	}
+	attr, err := i.fs.client.SetAttr(i.fh, sopts)
+	if err != nil {
+		return ToErrno(err)
+	}
+	i.setAttrLocked(attr)
+	return nil
+}
+
+// StatFS implements kernfs.Inode.StatFS.
+func (i *inode) StatFS(ctx context.Context, fs *vfs.Filesystem) (linux.Statfs, error) {
+	return i.fs.statFS(), nil
+}
+
+// Open implements kernfs.Inode.Open.
+func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	switch i.ftype {
+	case linux.ModeRegular:
+		return i.openRegular(ctx, rp, d, opts)
+	case linux.ModeDirectory:
+		fd, err := kernfs.NewGenericDirectoryFD(rp.Mount(), d, &i.OrderedChildren, &i.locks, &opts, kernfs.GenericDirectoryFDOptions{
+			SeekEnd: kernfs.SeekEndZero,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return fd.VFSFileDescription(), nil
+	case linux.ModeSymlink:
+		return nil, linuxerr.ELOOP
+	default:
+		// Device special files, sockets and FIFOs on the server can't be
+		// opened, like with the nodev mount option.
+		return nil, linuxerr.ENXIO
+	}
+}
+
+// Lookup implements kernfs.Inode.Lookup.
+func (i *inode) Lookup(ctx context.Context, name string) (kernfs.Inode, error) {
+	fh, attr, err := i.fs.client.Lookup(i.fh, name)
+	if err != nil {
+		return nil, ToErrno(err)
+	}
+	return i.fs.newInode(fh, attr), nil
+}
+
+// IterDirents implements kernfs.Inode.IterDirents.
+func (i *inode) IterDirents(ctx context.Context, mnt *vfs.Mount, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	entries, err := i.fs.client.ReadDir(i.fh)
+	if err != nil {
+		return offset, ToErrno(err)
+	}
+	if relOffset >= int64(len(entries)) {
+		return offset, nil
+	}
+	for _, entry := range entries[relOffset:] {
+		dirent := vfs.Dirent{
+			Name:    entry.Name,
+			Type:    fileType(entry.Type).DirentType(),
+			Ino:     entry.FileID,
+			NextOff: offset + 1,
+		}
+		if err := cb.Handle(dirent); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
+// HasChildren implements kernfs.Inode.HasChildren. Whether a directory is
+// empty is checked by the server when it's removed.
+func (i *inode) HasChildren() bool {
+	return false
+}
+
+// openAccess returns the share access for an OPEN with the given flags.
+func openAccess(flags uint32) uint32 {
+	switch flags & linux.O_ACCMODE {
+	case linux.O_WRONLY:
+		return AccessWrite
+	case linux.O_RDWR:
+		return AccessReadWrite
+	default:
+		return AccessRead
+	}
+}
+
+// NewFile implements kernfs.Inode.NewFile.
+func (i *inode) NewFile(ctx context.Context, name string, opts vfs.OpenOptions) (kernfs.Inode, error) {
+	f, attr, err := i.fs.client.Open(i.fh, name, openAccess(opts.Flags), true /* create */, uint32(opts.Mode.Permissions()))
+	if err != nil {
+		return nil, ToErrno(err)
+	}
+	i.invalidateAttr()
+	child := i.fs.newInode(f.FileHandle(), attr)
+	child.attrMu.Lock()
+	child.created = f
+	child.attrMu.Unlock()
+	return child, nil
+}
+
+// NewDir implements kernfs.Inode.NewDir.
+func (i *inode) NewDir(ctx context.Context, name string, opts vfs.MkdirOptions) (kernfs.Inode, error) {
+	fh, attr, err := i.fs.client.Mkdir(i.fh, name, uint32(opts.Mode.Permissions()))
+	if err != nil {
+		return nil, ToErrno(err)
+	}
+	i.invalidateAttr()
+	return i.fs.newInode(fh, attr), nil
+}
+
+// NewLink implements kernfs.Inode.NewLink.
+func (i *inode) NewLink(ctx context.Context, name string, target kernfs.Inode) (kernfs.Inode, error) {
+	t, ok := target.(*inode)
+	if !ok || t.fs != i.fs {
+		return nil, linuxerr.EXDEV
+	}
+	attr, err := i.fs.client.Link(t.fh, i.fh, name)
+	if err != nil {
+		return nil, ToErrno(err)
+	}
+	i.invalidateAttr()
+	t.attrMu.Lock()
+	t.setAttrLocked(attr)
+	t.attrMu.Unlock()
+	return t, nil
+}
+
+// NewSymlink implements kernfs.Inode.NewSymlink.
+func (i *inode) NewSymlink(ctx context.Context, name, target string) (kernfs.Inode, error) {
+	fh, attr, err := i.fs.client.Symlink(i.fh, name, target)
+	if err != nil {
+		return nil, ToErrno(err)
+	}
+	i.invalidateAttr()
+	return i.fs.newInode(fh, attr), nil
+}
+
+// NewNode implements kernfs.Inode.NewNode.
+func (i *inode) NewNode(ctx context.Context, name string, opts vfs.MknodOptions) (kernfs.Inode, error) {
+	// Special files couldn't be opened anyway; see Open.
+	return nil, linuxerr.EPERM
+}
+
+// Unlink implements kernfs.Inode.Unlink.
+func (i *inode) Unlink(ctx context.Context, name string, child kernfs.Inode) error {
+	if err := i.fs.client.Remove(i.fh, name); err != nil {
+		return ToErrno(err)
+	}
+	i.invalidateAttr()
+	child.(*inode).invalidateAttr()
+	return nil
+}
+
+// RmDir implements kernfs.Inode.RmDir.
+func (i *inode) RmDir(ctx context.Context, name string, child kernfs.Inode) error {
+	if err := i.fs.client.Remove(i.fh, name); err != nil {
+		return ToErrno(err)
+	}
+	i.invalidateAttr()
+	return nil
+}
+
+// Rename implements kernfs.Inode.Rename.
+func (i *inode) Rename(ctx context.Context, oldname, newname string, child, dstDir kernfs.Inode) error {
+	dst := dstDir.(*inode)
+	if err := i.fs.client.Rename(i.fh, oldname, dst.fh, newname); err != nil {
+		return ToErrno(err)
+	}
+	i.invalidateAttr()
+	dst.invalidateAttr()
+	child.(*inode).invalidateAttr()
+	return nil
+}
+
+// Readlink implements kernfs.Inode.Readlink.
+func (i *inode) Readlink(ctx context.Context, mnt *vfs.Mount) (string, error) {
+	if i.ftype != linux.ModeSymlink {
+		return "", linuxerr.EINVAL
+	}
+	target, err := i.fs.client.Readlink(i.fh)
+	return target, ToErrno(err)
+}
+
+// Getlink implements kernfs.Inode.Getlink.
+func (i *inode) Getlink(ctx context.Context, mnt *vfs.Mount) (vfs.VirtualDentry, string, error) {
+	target, err := i.Readlink(ctx, mnt)
+	return vfs.VirtualDentry{}, target, err
+}
@@ -0,0 +1,258 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nfs implements an NFSv4.1 client (RFC 8881) and a filesystem that
+// mounts NFS exports with it.
+//
+// The client speaks ONC RPC over a stream connection to the server, which is
+// established outside of the sandbox and donated to the sentry. It manages
+// the client ID, session and slot table, renews the lease while the client is
+// idle, and tracks open and lock state so that byte-range locks are enforced
+// by the server, consistently with other clients of the same export.
+//
+// The filesystem doesn't cache file data, and caches file attributes for at
+// most the attribute timeout (actimeo), so that changes made by other clients
+// become visible.
+//
+// Lock ordering:
+//
+//	regularFileFD.mu
+//	  inode.attrMu
+//	    Client.openMu
+//	      openState.mu
+//	        Client.mu
+package nfs
+
+import (
+	"errors"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+)
+
+// RPC program and procedure numbers.
+const (
+	nfsProgram   = 100003
+	nfsVersion   = 4
+	nfsMinorVers = 1
+
+	procCompound = 1
+)
+
+// Operation numbers, RFC 8881 Section 16.
+const (
+	opClose           = 4
+	opCommit          = 5
+	opCreate          = 6
+	opGetAttr         = 9
+	opGetFH           = 10
+	opLink            = 11
+	opLock            = 12
+	opLockT           = 13
+	opLockU           = 14
+	opLookup          = 15
+	opOpen            = 18
+	opPutFH           = 22
+	opPutRootFH       = 24
+	opRead            = 25
+	opReadDir         = 26
+	opReadLink        = 27
+	opRemove          = 28
+	opRename          = 29
+	opSaveFH          = 32
+	opSetAttr         = 34
+	opWrite           = 38
+	opExchangeID      = 42
+	opCreateSession   = 43
+	opDestroySession  = 44
+	opSequence        = 53
+	opDestroyClientID = 57
+	opReclaimComplete = 58
+)
+
+// Status codes, RFC 8881 Section 15.
+const (
+	nfs4OK                 = 0
+	nfs4ErrPerm            = 1
+	nfs4ErrNoEnt           = 2
+	nfs4ErrNXIO            = 6
+	nfs4ErrAccess          = 13
+	nfs4ErrExist           = 17
+	nfs4ErrXDev            = 18
+	nfs4ErrNotDir          = 20
+	nfs4ErrIsDir           = 21
+	nfs4ErrInval           = 22
+	nfs4ErrFBig            = 27
+	nfs4ErrNoSpc           = 28
+	nfs4ErrROFS            = 30
+	nfs4ErrMLink           = 31
+	nfs4ErrNameTooLong     = 63
+	nfs4ErrNotEmpty        = 66
+	nfs4ErrDQuot           = 69
+	nfs4ErrStale           = 70
+	nfs4ErrBadHandle       = 10001
+	nfs4ErrNotSupp         = 10004
+	nfs4ErrDelay           = 10008
+	nfs4ErrDenied          = 10010
+	nfs4ErrExpired         = 10011
+	nfs4ErrLocked          = 10012
+	nfs4ErrGrace           = 10013
+	nfs4ErrShareDenied     = 10015
+	nfs4ErrStaleClientID   = 10022
+	nfs4ErrLockRange       = 10028
+	nfs4ErrAttrNotSupp     = 10032
+	nfs4ErrOpenMode        = 10038
+	nfs4ErrBadOwner        = 10039
+	nfs4ErrLockNotSupp     = 10043
+	nfs4ErrDeadlock        = 10045
+	nfs4ErrFileOpen        = 10046
+	nfs4ErrBadSession      = 10052
+	nfs4ErrCompleteAlready = 10054
+	nfs4ErrDeadSession     = 10078
+	nfs4ErrWrongType       = 10083
+)
+
+// File types (nfs_ftype4).
+const (
+	// TypeRegular is a regular file.
+	TypeRegular = 1
+	// TypeDirectory is a directory.
+	TypeDirectory = 2
+	// TypeBlock is a block device.
+	TypeBlock = 3
+	// TypeChar is a character device.
+	TypeChar = 4
+	// TypeSymlink is a symbolic link.
+	TypeSymlink = 5
+	// TypeSocket is a Unix domain socket.
+	TypeSocket = 6
+	// TypeFIFO is a named pipe.
+	TypeFIFO = 7
+)
+
+// Share access modes for Open.
+const (
+	// AccessRead opens a file for reading.
+	AccessRead = 1
+	// AccessWrite opens a file for writing.
+	AccessWrite = 2
+	// AccessReadWrite opens a file for reading and writing.
+	AccessReadWrite = AccessRead | AccessWrite
+
+	shareAccessWantNoDeleg = 0x0400
+	shareDenyNone          = 0
+)
+
+// LockType is an NFSv4 byte-range lock type.
+type LockType uint32
+
+// Lock types (nfs_lock_type4).
+const (
+	// ReadLock is a shared lock.
+	ReadLock LockType = 1
+	// WriteLock is an exclusive lock.
+	WriteLock LockType = 2
+)
+
+// LockToEOF is the lock length for a range that extends to the end of the
+// file, regardless of the file's size.
+const LockToEOF = ^uint64(0)
+
+// statusError is a non-OK nfsstat4 returned by the server.
+type statusError uint32
+
+// Error implements error.Error.
+func (s statusError) Error() string {
+	return fmt.Sprintf("NFS4 status %d", uint32(s))
+}
+
+// Errno returns the Linux error that corresponds to the status, following
+// nfs4_map_errors() in Linux's fs/nfs/nfs4proc.c.
+func (s statusError) Errno() error {
+	switch s {
+	case nfs4ErrPerm:
+		return linuxerr.EPERM
+	case nfs4ErrNoEnt:
+		return linuxerr.ENOENT
+	case nfs4ErrNXIO:
+		return linuxerr.ENXIO
+	case nfs4ErrAccess, nfs4ErrOpenMode:
+		return linuxerr.EACCES
+	case nfs4ErrExist, nfs4ErrFileOpen:
+		return linuxerr.EEXIST
+	case nfs4ErrXDev:
+		return linuxerr.EXDEV
+	case nfs4ErrNotDir:
+		return linuxerr.ENOTDIR
+	case nfs4ErrIsDir:
+		return linuxerr.EISDIR
+	case nfs4ErrInval, nfs4ErrBadOwner, nfs4ErrWrongType, nfs4ErrLockRange:
+		return linuxerr.EINVAL
+	case nfs4ErrFBig:
+		return linuxerr.EFBIG
+	case nfs4ErrNoSpc:
+		return linuxerr.ENOSPC
+	case nfs4ErrROFS:
+		return linuxerr.EROFS
+	case nfs4ErrMLink:
+		return linuxerr.EMLINK
+	case nfs4ErrNameTooLong:
+		return linuxerr.ENAMETOOLONG
+	case nfs4ErrNotEmpty:
+		return linuxerr.ENOTEMPTY
+	case nfs4ErrDQuot:
+		return linuxerr.EDQUOT
+	case nfs4ErrStale, nfs4ErrBadHandle:
+		return linuxerr.ESTALE
+	case nfs4ErrNotSupp, nfs4ErrAttrNotSupp:
+		return linuxerr.EOPNOTSUPP
+	case nfs4ErrDenied, nfs4ErrLocked, nfs4ErrShareDenied:
+		return linuxerr.EAGAIN
+	case nfs4ErrDeadlock:
+		return linuxerr.EDEADLK
+	case nfs4ErrLockNotSupp:
+		return linuxerr.ENOLCK
+	default:
+		return linuxerr.EIO
+	}
+}
+
+// retriable returns true if the operation should be retried after a delay.
+func (s statusError) retriable() bool {
+	return s == nfs4ErrDelay || s == nfs4ErrGrace
+}
+
+// sessionLost returns true if the session must be re-established before the
+// operation can be retried.
+func (s statusError) sessionLost() bool {
+	return s == nfs4ErrBadSession || s == nfs4ErrDeadSession
+}
+
+// clientLost returns true if the server no longer recognizes the client ID, in
+// which case all open and lock state held by the client is gone.
+func (s statusError) clientLost() bool {
+	return s == nfs4ErrStaleClientID || s == nfs4ErrExpired
+}
+
+// ToErrno converts an error returned by the client to a Linux error.
+func ToErrno(err error) error {
+	if err == nil {
+		return nil
+	}
+	var s statusError
+	if errors.As(err, &s) {
+		return s.Errno()
+	}
+	return linuxerr.EIO
+}
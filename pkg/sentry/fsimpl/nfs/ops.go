@@ -0,0 +1,1028 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Attributes (fattr4), RFC 8881 Section 5.
+const (
+	attrType          = 1
+	attrChange        = 3
+	attrSize          = 4
+	attrFileID        = 20
+	attrMode          = 33
+	attrNumLinks      = 35
+	attrOwner         = 36
+	attrOwnerGroup    = 37
+	attrSpaceUsed     = 45
+	attrTimeAccess    = 47
+	attrTimeAccessSet = 48
+	attrTimeMetadata  = 52
+	attrTimeModify    = 53
+	attrTimeModifySet = 54
+)
+
+// statAttrs are the attributes requested for Attr.
+var statAttrs = []uint32{
+	attrType, attrChange, attrSize, attrFileID, attrMode, attrNumLinks,
+	attrOwner, attrOwnerGroup, attrSpaceUsed, attrTimeAccess,
+	attrTimeMetadata, attrTimeModify,
+}
+
+// nobodyID is used for owners that can't be mapped to a numeric ID.
+const nobodyID = 65534
+
+// FileHandle is an NFSv4 file handle.
+type FileHandle []byte
+
+// Time is an nfstime4.
+type Time struct {
+	Sec  int64
+	Nsec uint32
+}
+
+// Attr holds the attributes of a file.
+type Attr struct {
+	Type      uint32
+	Change    uint64
+	Size      uint64
+	FileID    uint64
+	Mode      uint32
+	Nlink     uint32
+	UID       uint32
+	GID       uint32
+	SpaceUsed uint64
+	Atime     Time
+	Ctime     Time
+	Mtime     Time
+}
+
+// DirEntry is a directory entry returned by ReadDir.
+type DirEntry struct {
+	Name   string
+	Type   uint32
+	FileID uint64
+}
+
+// parseOwner maps an owner or owner_group attribute to a numeric ID. Servers
+// that don't use ID mapping send the numeric ID, optionally followed by
+// "@domain".
+func parseOwner(s string) uint32 {
+	if i := strings.IndexByte(s, '@'); i >= 0 {
+		s = s[:i]
+	}
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return nobodyID
+	}
+	return uint32(id)
+}
+
+func (d *xdrDecoder) readTime() Time {
+	return Time{Sec: int64(d.readUint64()), Nsec: d.readUint32()}
+}
+
+// readAttr decodes an fattr4 containing a subset of statAttrs.
+func (d *xdrDecoder) readAttr() (Attr, error) {
+	var attr Attr
+	words := d.readBitmap()
+	vals := xdrDecoder{buf: d.readOpaque(maxDataLen)}
+	if d.err != nil {
+		return attr, d.err
+	}
+	for w, word := range words {
+		for b := uint32(0); b < 32 && word != 0; b++ {
+			if word&(1<<b) == 0 {
+				continue
+			}
+			word &^= 1 << b
+			switch bit := uint32(w)*32 + b; bit {
+			case attrType:
+				attr.Type = vals.readUint32()
+			case attrChange:
+				attr.Change = vals.readUint64()
+			case attrSize:
+				attr.Size = vals.readUint64()
+			case attrFileID:
+				attr.FileID = vals.readUint64()
+			case attrMode:
+				attr.Mode = vals.readUint32()
+			case attrNumLinks:
+				attr.Nlink = vals.readUint32()
+			case attrOwner:
+				attr.UID = parseOwner(vals.readString(maxNameLen))
+			case attrOwnerGroup:
+				attr.GID = parseOwner(vals.readString(maxNameLen))
+			case attrSpaceUsed:
+				attr.SpaceUsed = vals.readUint64()
+			case attrTimeAccess:
+				attr.Atime = vals.readTime()
+			case attrTimeMetadata:
+				attr.Ctime = vals.readTime()
+			case attrTimeModify:
+				attr.Mtime = vals.readTime()
+			default:
+				return attr, fmt.Errorf("unexpected attribute %d", bit)
+			}
+		}
+	}
+	return attr, vals.err
+}
+
+// GetAttr returns the attributes of the file with handle fh.
+func (c *Client) GetAttr(fh FileHandle) (Attr, error) {
+	var attr Attr
+	err := c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(fh)
+		comp.op(opGetAttr).writeBitmap(statAttrs...)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opGetAttr)
+		if err != nil {
+			return err
+		}
+		attr, err = d.readAttr()
+		return err
+	})
+	return attr, err
+}
+
+// Lookup looks up name in the directory with handle dir.
+func (c *Client) Lookup(dir FileHandle, name string) (FileHandle, Attr, error) {
+	var (
+		fh   FileHandle
+		attr Attr
+	)
+	err := c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(dir)
+		comp.op(opLookup).writeString(name)
+		comp.op(opGetFH)
+		comp.op(opGetAttr).writeBitmap(statAttrs...)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		if _, err := r.next(opLookup); err != nil {
+			return err
+		}
+		d, err := r.next(opGetFH)
+		if err != nil {
+			return err
+		}
+		fh = FileHandle(d.readOpaque(maxFHSize))
+		if d, err = r.next(opGetAttr); err != nil {
+			return err
+		}
+		attr, err = d.readAttr()
+		return err
+	})
+	return fh, attr, err
+}
+
+// ReadDir returns all entries of the directory with handle dir, excluding "."
+// and "..".
+func (c *Client) ReadDir(dir FileHandle) ([]DirEntry, error) {
+	var (
+		entries []DirEntry
+		cookie  uint64
+		verf    [8]byte
+	)
+	for eof := false; !eof; {
+		err := c.call(func() *compound {
+			var comp compound
+			comp.op(opPutFH).writeOpaque(dir)
+			e := comp.op(opReadDir)
+			e.writeUint64(cookie)
+			e.writeFixedOpaque(verf[:])
+			e.writeUint32(8192)  // dircount
+			e.writeUint32(32768) // maxcount
+			e.writeBitmap(attrType, attrFileID)
+			return &comp
+		}, func(r *compoundResult) error {
+			if _, err := r.next(opPutFH); err != nil {
+				return err
+			}
+			d, err := r.next(opReadDir)
+			if err != nil {
+				return err
+			}
+			copy(verf[:], d.readFixedOpaque(len(verf)))
+			for d.readBool() {
+				cookie = d.readUint64()
+				name := d.readString(maxNameLen)
+				attr, err := d.readAttr()
+				if err != nil {
+					return err
+				}
+				entries = append(entries, DirEntry{
+					Name:   name,
+					Type:   attr.Type,
+					FileID: attr.FileID,
+				})
+			}
+			eof = d.readBool()
+			return d.err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Bits of SetAttrOptions.Mask.
+const (
+	// SetSize changes the size of the file.
+	SetSize = 1 << iota
+	// SetMode changes the permission bits of the file.
+	SetMode
+	// SetUID changes the owner of the file.
+	SetUID
+	// SetGID changes the group of the file.
+	SetGID
+	// SetAtime changes the access time of the file.
+	SetAtime
+	// SetMtime changes the modification time of the file.
+	SetMtime
+)
+
+// SetAttrOptions are the attributes changed by SetAttr.
+type SetAttrOptions struct {
+	// Mask selects the attributes that are changed.
+	Mask uint32
+
+	Size uint64
+	Mode uint32
+	UID  uint32
+	GID  uint32
+
+	// Atime and Mtime are ignored if AtimeNow or MtimeNow are true
+	// respectively, in which case the server sets the time to its current
+	// time.
+	Atime    Time
+	Mtime    Time
+	AtimeNow bool
+	MtimeNow bool
+}
+
+func writeSetTime(e *xdrEncoder, t Time, now bool) {
+	if now {
+		e.writeUint32(0) // SET_TO_SERVER_TIME4
+		return
+	}
+	e.writeUint32(1) // SET_TO_CLIENT_TIME4
+	e.writeUint64(uint64(t.Sec))
+	e.writeUint32(t.Nsec)
+}
+
+// writeAttr encodes the attributes selected by opts as an fattr4.
+func (e *xdrEncoder) writeAttr(opts *SetAttrOptions) {
+	var (
+		bits []uint32
+		vals xdrEncoder
+	)
+	// Attribute values are encoded in increasing order of attribute number.
+	if opts.Mask&SetSize != 0 {
+		bits = append(bits, attrSize)
+		vals.writeUint64(opts.Size)
+	}
+	if opts.Mask&SetMode != 0 {
+		bits = append(bits, attrMode)
+		vals.writeUint32(opts.Mode & 07777)
+	}
+	if opts.Mask&SetUID != 0 {
+		bits = append(bits, attrOwner)
+		vals.writeString(strconv.FormatUint(uint64(opts.UID), 10))
+	}
+	if opts.Mask&SetGID != 0 {
+		bits = append(bits, attrOwnerGroup)
+		vals.writeString(strconv.FormatUint(uint64(opts.GID), 10))
+	}
+	if opts.Mask&SetAtime != 0 {
+		bits = append(bits, attrTimeAccessSet)
+		writeSetTime(&vals, opts.Atime, opts.AtimeNow)
+	}
+	if opts.Mask&SetMtime != 0 {
+		bits = append(bits, attrTimeModifySet)
+		writeSetTime(&vals, opts.Mtime, opts.MtimeNow)
+	}
+	e.writeBitmap(bits...)
+	e.writeOpaque(vals.buf)
+}
+
+// SetAttr changes the attributes of the file with handle fh, and returns its
+// updated attributes. Size changes use the anonymous stateid, so they don't
+// require the file to be open.
+func (c *Client) SetAttr(fh FileHandle, opts SetAttrOptions) (Attr, error) {
+	var attr Attr
+	err := c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(fh)
+		e := comp.op(opSetAttr)
+		e.writeStateID(stateID{})
+		e.writeAttr(&opts)
+		comp.op(opGetAttr).writeBitmap(statAttrs...)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		if _, err := r.next(opSetAttr); err != nil {
+			return err
+		}
+		d, err := r.next(opGetAttr)
+		if err != nil {
+			return err
+		}
+		attr, err = d.readAttr()
+		return err
+	})
+	return attr, err
+}
+
+// readChangeInfo decodes a change_info4.
+func readChangeInfo(d *xdrDecoder) {
+	d.readBool()   // atomic
+	d.readUint64() // before
+	d.readUint64() // after
+}
+
+// create creates a directory, or a symlink to target if target isn't empty,
+// named name in the directory with handle dir.
+func (c *Client) create(dir FileHandle, name string, target string, mode uint32) (FileHandle, Attr, error) {
+	var (
+		fh   FileHandle
+		attr Attr
+	)
+	err := c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(dir)
+		e := comp.op(opCreate)
+		if target != "" {
+			e.writeUint32(TypeSymlink)
+			e.writeString(target)
+		} else {
+			e.writeUint32(TypeDirectory)
+		}
+		e.writeString(name)
+		e.writeAttr(&SetAttrOptions{Mask: SetMode, Mode: mode})
+		comp.op(opGetFH)
+		comp.op(opGetAttr).writeBitmap(statAttrs...)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opCreate)
+		if err != nil {
+			return err
+		}
+		readChangeInfo(d)
+		d.readBitmap() // attrset
+		if d, err = r.next(opGetFH); err != nil {
+			return err
+		}
+		fh = FileHandle(d.readOpaque(maxFHSize))
+		if d, err = r.next(opGetAttr); err != nil {
+			return err
+		}
+		attr, err = d.readAttr()
+		return err
+	})
+	return fh, attr, err
+}
+
+// Mkdir creates a directory named name in the directory with handle dir.
+func (c *Client) Mkdir(dir FileHandle, name string, mode uint32) (FileHandle, Attr, error) {
+	return c.create(dir, name, "", mode)
+}
+
+// Symlink creates a symbolic link to target named name in the directory with
+// handle dir.
+func (c *Client) Symlink(dir FileHandle, name, target string) (FileHandle, Attr, error) {
+	if target == "" {
+		return nil, Attr{}, linuxerr.ENOENT
+	}
+	return c.create(dir, name, target, 0777)
+}
+
+// Readlink returns the target of the symbolic link with handle fh.
+func (c *Client) Readlink(fh FileHandle) (string, error) {
+	var target string
+	err := c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(fh)
+		comp.op(opReadLink)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opReadLink)
+		if err != nil {
+			return err
+		}
+		target = d.readString(maxNameLen)
+		return d.err
+	})
+	return target, err
+}
+
+// Remove removes name from the directory with handle dir. name may be a
+// non-directory or an empty directory.
+func (c *Client) Remove(dir FileHandle, name string) error {
+	return c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(dir)
+		comp.op(opRemove).writeString(name)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opRemove)
+		if err != nil {
+			return err
+		}
+		readChangeInfo(d)
+		return d.err
+	})
+}
+
+// Link creates a hard link named name in the directory with handle dir to the
+// file with handle target, and returns the file's updated attributes.
+func (c *Client) Link(target FileHandle, dir FileHandle, name string) (Attr, error) {
+	var attr Attr
+	err := c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(target)
+		comp.op(opSaveFH)
+		comp.op(opPutFH).writeOpaque(dir)
+		comp.op(opLink).writeString(name)
+		// LINK leaves the directory as the current filehandle; restore the
+		// target to fetch its attributes.
+		comp.op(opPutFH).writeOpaque(target)
+		comp.op(opGetAttr).writeBitmap(statAttrs...)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		if _, err := r.next(opSaveFH); err != nil {
+			return err
+		}
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opLink)
+		if err != nil {
+			return err
+		}
+		readChangeInfo(d)
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		if d, err = r.next(opGetAttr); err != nil {
+			return err
+		}
+		attr, err = d.readAttr()
+		return err
+	})
+	return attr, err
+}
+
+// Rename renames oldName in the directory with handle oldDir to newName in
+// the directory with handle newDir, replacing newName if it exists.
+func (c *Client) Rename(oldDir FileHandle, oldName string, newDir FileHandle, newName string) error {
+	return c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(oldDir)
+		comp.op(opSaveFH)
+		comp.op(opPutFH).writeOpaque(newDir)
+		e := comp.op(opRename)
+		e.writeString(oldName)
+		e.writeString(newName)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		if _, err := r.next(opSaveFH); err != nil {
+			return err
+		}
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opRename)
+		if err != nil {
+			return err
+		}
+		readChangeInfo(d) // source_cinfo
+		readChangeInfo(d) // target_cinfo
+		return d.err
+	})
+}
+
+// openState is the open state of a file. All OpenFiles for the same file
+// share it, since the client uses a single open-owner: the server merges
+// OPENs of the same file by the same open-owner into one stateid.
+type openState struct {
+	// other identifies the state; it doesn't change for the lifetime of the
+	// state.
+	other [12]byte
+
+	// epoch is the client ID epoch in which the state was acquired.
+	epoch uint64
+
+	// refs is the number of OpenFiles using the state. It's protected by
+	// Client.openMu.
+	refs int
+
+	// mu serializes operations that modify lock state.
+	mu sync.Mutex
+
+	// stateID is the latest open stateid.
+	//
+	// +checklocks:mu
+	stateID stateID
+
+	// locks maps lock owners to their lock stateids for the file.
+	//
+	// +checklocks:mu
+	locks map[uint64]stateID
+}
+
+// OpenFile is a file opened with Open.
+type OpenFile struct {
+	fh    FileHandle
+	state *openState
+}
+
+// FileHandle returns the file handle of the opened file.
+func (f *OpenFile) FileHandle() FileHandle {
+	return f.fh
+}
+
+// openOwner is the open-owner for all OPENs issued by the client.
+var openOwner = []byte("gvisor")
+
+// Open opens name in the directory with handle dir with the given access
+// mode. If create is true, the file is created with the given mode if it
+// doesn't exist.
+func (c *Client) Open(dir FileHandle, name string, access uint32, create bool, mode uint32) (*OpenFile, Attr, error) {
+	if name == "" {
+		return nil, Attr{}, linuxerr.ENOENT
+	}
+	return c.open(dir, name, access, create, mode)
+}
+
+// OpenHandle opens the file with handle fh with the given access mode.
+func (c *Client) OpenHandle(fh FileHandle, access uint32) (*OpenFile, Attr, error) {
+	return c.open(fh, "", access, false /* create */, 0)
+}
+
+// open implements Open and OpenHandle. If name is empty, fh is the file to
+// open, otherwise it's the directory containing name.
+func (c *Client) open(fh FileHandle, name string, access uint32, create bool, mode uint32) (*OpenFile, Attr, error) {
+	c.openMu.Lock()
+	defer c.openMu.Unlock()
+
+	var (
+		sid    stateID
+		fileFH FileHandle
+		attr   Attr
+	)
+	var epoch uint64
+	err := c.call(func() *compound {
+		epoch = c.epoch()
+		c.mu.Lock()
+		clientID := c.clientID
+		c.mu.Unlock()
+
+		var comp compound
+		comp.op(opPutFH).writeOpaque(fh)
+		e := comp.op(opOpen)
+		e.writeUint32(0) // seqid, ignored in NFSv4.1.
+		e.writeUint32(access | shareAccessWantNoDeleg)
+		e.writeUint32(shareDenyNone)
+		e.writeUint64(clientID)
+		e.writeOpaque(openOwner)
+		if create {
+			e.writeUint32(1) // OPEN4_CREATE
+			e.writeUint32(0) // UNCHECKED4
+			e.writeBitmap(attrMode)
+			var vals xdrEncoder
+			vals.writeUint32(mode)
+			e.writeOpaque(vals.buf)
+		} else {
+			e.writeUint32(0) // OPEN4_NOCREATE
+		}
+		if name == "" {
+			e.writeUint32(4) // CLAIM_FH
+		} else {
+			e.writeUint32(0) // CLAIM_NULL
+			e.writeString(name)
+		}
+		comp.op(opGetFH)
+		comp.op(opGetAttr).writeBitmap(statAttrs...)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opOpen)
+		if err != nil {
+			return err
+		}
+		sid = d.readStateID()
+		d.readBool()   // cinfo.atomic
+		d.readUint64() // cinfo.before
+		d.readUint64() // cinfo.after
+		d.readUint32() // rflags
+		d.readBitmap() // attrset
+		if err := skipDelegation(d); err != nil {
+			return err
+		}
+		if d, err = r.next(opGetFH); err != nil {
+			return err
+		}
+		fileFH = FileHandle(d.readOpaque(maxFHSize))
+		if d, err = r.next(opGetAttr); err != nil {
+			return err
+		}
+		attr, err = d.readAttr()
+		return err
+	})
+	if err != nil {
+		return nil, Attr{}, err
+	}
+
+	c.mu.Lock()
+	state, ok := c.opens[sid.other]
+	if !ok || state.epoch != epoch {
+		state = &openState{
+			other: sid.other,
+			epoch: epoch,
+			locks: make(map[uint64]stateID),
+		}
+		c.opens[sid.other] = state
+	}
+	c.mu.Unlock()
+	state.refs++
+	state.mu.Lock()
+	state.stateID = sid
+	state.mu.Unlock()
+	return &OpenFile{fh: fileFH, state: state}, attr, nil
+}
+
+// skipDelegation decodes an open_delegation4. The client asks for no
+// delegations and has no callback channel, but servers may still grant them.
+func skipDelegation(d *xdrDecoder) error {
+	switch typ := d.readUint32(); typ {
+	case 0: // OPEN_DELEGATE_NONE
+	case 1, 2: // OPEN_DELEGATE_READ, OPEN_DELEGATE_WRITE
+		d.readStateID()
+		d.readBool() // recall
+		if typ == 2 {
+			switch limit := d.readUint32(); limit {
+			case 1: // NFS_LIMIT_SIZE
+				d.readUint64()
+			case 2: // NFS_LIMIT_BLOCKS
+				d.readUint32()
+				d.readUint32()
+			default:
+				return fmt.Errorf("invalid space limit %d", limit)
+			}
+		}
+		// nfsace4 permissions.
+		d.readUint32()
+		d.readUint32()
+		d.readUint32()
+		d.readString(maxNameLen)
+	case 3: // OPEN_DELEGATE_NONE_EXT
+		// WND4_CONTENTION and WND4_RESOURCE carry a boolean.
+		if why := d.readUint32(); why == 7 || why == 8 {
+			d.readBool()
+		}
+	default:
+		return fmt.Errorf("invalid delegation type %d", typ)
+	}
+	return d.err
+}
+
+// currentStateID returns the open stateid of f, or EIO if the state was lost.
+//
+// +checklocks:f.state.mu
+func (c *Client) currentStateID(f *OpenFile) (stateID, error) {
+	if f.state.epoch != c.epoch() {
+		return stateID{}, linuxerr.EIO
+	}
+	return f.state.stateID, nil
+}
+
+// CloseFile releases f. The open state is closed on the server when the last
+// OpenFile that uses it is closed, which releases all locks held on the file.
+func (c *Client) CloseFile(f *OpenFile) error {
+	c.openMu.Lock()
+	defer c.openMu.Unlock()
+
+	f.state.refs--
+	if f.state.refs > 0 {
+		return nil
+	}
+	c.mu.Lock()
+	if c.opens[f.state.other] == f.state {
+		delete(c.opens, f.state.other)
+	}
+	c.mu.Unlock()
+
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	sid, err := c.currentStateID(f)
+	if err != nil {
+		// The state is already gone on the server.
+		return nil
+	}
+	return c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(f.fh)
+		e := comp.op(opClose)
+		e.writeUint32(0) // seqid
+		e.writeStateID(sid)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		_, err := r.next(opClose)
+		return err
+	})
+}
+
+// Read reads up to count bytes at offset off. It returns the data and whether
+// the end of the file was reached.
+func (c *Client) Read(f *OpenFile, off uint64, count uint32) ([]byte, bool, error) {
+	f.state.mu.Lock()
+	sid, err := c.currentStateID(f)
+	f.state.mu.Unlock()
+	if err != nil {
+		return nil, false, err
+	}
+	if count > channelMaxIO {
+		count = channelMaxIO
+	}
+	var (
+		data []byte
+		eof  bool
+	)
+	err = c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(f.fh)
+		e := comp.op(opRead)
+		e.writeStateID(sid)
+		e.writeUint64(off)
+		e.writeUint32(count)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opRead)
+		if err != nil {
+			return err
+		}
+		eof = d.readBool()
+		data = d.readOpaque(int(count))
+		return d.err
+	})
+	return data, eof, err
+}
+
+// Write writes data at offset off, and returns the number of bytes written.
+// If sync is true, the data is committed to stable storage before Write
+// returns.
+func (c *Client) Write(f *OpenFile, off uint64, data []byte, sync bool) (uint32, error) {
+	f.state.mu.Lock()
+	sid, err := c.currentStateID(f)
+	f.state.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if len(data) > channelMaxIO {
+		data = data[:channelMaxIO]
+	}
+	stable := uint32(0) // UNSTABLE4
+	if sync {
+		stable = 2 // FILE_SYNC4
+	}
+	var n uint32
+	err = c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(f.fh)
+		e := comp.op(opWrite)
+		e.writeStateID(sid)
+		e.writeUint64(off)
+		e.writeUint32(stable)
+		e.writeOpaque(data)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opWrite)
+		if err != nil {
+			return err
+		}
+		n = d.readUint32()
+		return d.err
+	})
+	return n, err
+}
+
+// Commit commits all data written to f with unstable writes to stable
+// storage.
+func (c *Client) Commit(f *OpenFile) error {
+	return c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(f.fh)
+		e := comp.op(opCommit)
+		e.writeUint64(0) // offset
+		e.writeUint32(0) // count: up to the end of the file.
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opCommit)
+		if err != nil {
+			return err
+		}
+		d.readFixedOpaque(8) // writeverf
+		return d.err
+	})
+}
+
+// LockConflict describes a lock that conflicts with a requested lock.
+type LockConflict struct {
+	Type   LockType
+	Offset uint64
+	Length uint64
+}
+
+func lockOwnerBytes(owner uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, owner)
+}
+
+// readDenied decodes a LOCK4denied.
+func readDenied(d *xdrDecoder) *LockConflict {
+	conflict := &LockConflict{
+		Offset: d.readUint64(),
+		Length: d.readUint64(),
+		Type:   LockType(d.readUint32()),
+	}
+	d.readUint64()           // owner.clientid
+	d.readOpaque(maxNameLen) // owner.owner
+	return conflict
+}
+
+// Lock acquires a byte-range lock on behalf of owner, which identifies the
+// lock owner among all lock owners of the client. It doesn't wait for
+// conflicting locks to be released: if there is a conflict, it returns
+// statusError(nfs4ErrDenied), which ToErrno maps to EAGAIN.
+func (c *Client) Lock(f *OpenFile, owner uint64, typ LockType, off, length uint64) error {
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	openSID, err := c.currentStateID(f)
+	if err != nil {
+		return err
+	}
+	return c.call(func() *compound {
+		c.mu.Lock()
+		clientID := c.clientID
+		c.mu.Unlock()
+
+		var comp compound
+		comp.op(opPutFH).writeOpaque(f.fh)
+		e := comp.op(opLock)
+		e.writeUint32(uint32(typ))
+		e.writeBool(false) // reclaim
+		e.writeUint64(off)
+		e.writeUint64(length)
+		if lockSID, ok := f.state.locks[owner]; ok {
+			e.writeBool(false) // exist_lock_owner4
+			e.writeStateID(lockSID)
+			e.writeUint32(0) // lock_seqid
+		} else {
+			e.writeBool(true) // open_to_lock_owner4
+			e.writeUint32(0)  // open_seqid
+			e.writeStateID(openSID)
+			e.writeUint32(0) // lock_seqid
+			e.writeUint64(clientID)
+			e.writeOpaque(lockOwnerBytes(owner))
+		}
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opLock)
+		if err != nil {
+			return err
+		}
+		f.state.locks[owner] = d.readStateID()
+		return d.err
+	})
+}
+
+// Unlock releases the byte-range locks held by owner in the given range.
+func (c *Client) Unlock(f *OpenFile, owner uint64, off, length uint64) error {
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	if _, err := c.currentStateID(f); err != nil {
+		return err
+	}
+	lockSID, ok := f.state.locks[owner]
+	if !ok {
+		// owner never acquired a lock on the file.
+		return nil
+	}
+	return c.call(func() *compound {
+		var comp compound
+		comp.op(opPutFH).writeOpaque(f.fh)
+		e := comp.op(opLockU)
+		e.writeUint32(uint32(WriteLock))
+		e.writeUint32(0) // seqid
+		e.writeStateID(lockSID)
+		e.writeUint64(off)
+		e.writeUint64(length)
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opLockU)
+		if err != nil {
+			return err
+		}
+		f.state.locks[owner] = d.readStateID()
+		return d.err
+	})
+}
+
+// TestLock returns the first lock held by another lock owner that conflicts
+// with the given lock, or nil if there is no conflict.
+func (c *Client) TestLock(f *OpenFile, owner uint64, typ LockType, off, length uint64) (*LockConflict, error) {
+	var conflict *LockConflict
+	err := c.call(func() *compound {
+		c.mu.Lock()
+		clientID := c.clientID
+		c.mu.Unlock()
+
+		var comp compound
+		comp.op(opPutFH).writeOpaque(f.fh)
+		e := comp.op(opLockT)
+		e.writeUint32(uint32(typ))
+		e.writeUint64(off)
+		e.writeUint64(length)
+		e.writeUint64(clientID)
+		e.writeOpaque(lockOwnerBytes(owner))
+		return &comp
+	}, func(r *compoundResult) error {
+		if _, err := r.next(opPutFH); err != nil {
+			return err
+		}
+		d, err := r.next(opLockT)
+		if s, ok := err.(statusError); ok && s == nfs4ErrDenied {
+			conflict = readDenied(d)
+			return d.err
+		}
+		return err
+	})
+	return conflict, err
+}
@@ -0,0 +1,266 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// ONC RPC (RFC 5531) constants.
+const (
+	rpcVersion = 2
+
+	rpcCall  = 0
+	rpcReply = 1
+
+	rpcMsgAccepted = 0
+	rpcMsgDenied   = 1
+
+	rpcSuccess = 0
+
+	authNone = 0
+	authSys  = 1
+
+	// rpcLastFragment is set in the record marker of the last fragment of a
+	// record (RFC 5531 Section 11).
+	rpcLastFragment = 1 << 31
+
+	// rpcMaxRecord is the largest record that the client accepts. It's well
+	// above the negotiated maximum response size.
+	rpcMaxRecord = 16 << 20
+
+	// rpcMaxAuth is the maximum size of an authentication body.
+	rpcMaxAuth = 400
+)
+
+// errConnClosed is returned by calls that are pending when the connection to
+// the server fails.
+var errConnClosed = errors.New("RPC connection closed")
+
+// authSysCred is an AUTH_SYS credential (RFC 5531 Appendix A).
+type authSysCred struct {
+	machineName string
+	uid         uint32
+	gid         uint32
+	gids        []uint32
+}
+
+func (a *authSysCred) encode() []byte {
+	var e xdrEncoder
+	e.writeUint32(0) // stamp
+	e.writeString(a.machineName)
+	e.writeUint32(a.uid)
+	e.writeUint32(a.gid)
+	e.writeUint32(uint32(len(a.gids)))
+	for _, g := range a.gids {
+		e.writeUint32(g)
+	}
+	return e.buf
+}
+
+// rpcReplyMsg is the result of a call.
+type rpcReplyMsg struct {
+	body []byte
+	err  error
+}
+
+// rpcClient is an ONC RPC client over a stream connection. Calls may be
+// issued concurrently; replies are matched to calls by XID.
+type rpcClient struct {
+	conn io.ReadWriteCloser
+	prog uint32
+	vers uint32
+	cred []byte
+
+	// writeMu serializes writes of records to conn.
+	writeMu sync.Mutex
+
+	mu sync.Mutex
+
+	// +checklocks:mu
+	nextXID uint32
+
+	// pending maps the XIDs of calls waiting for a reply to the channel that
+	// receives the reply.
+	//
+	// +checklocks:mu
+	pending map[uint32]chan rpcReplyMsg
+
+	// err is set once the connection fails. No calls can be made after that.
+	//
+	// +checklocks:mu
+	err error
+
+	// done is closed when the reply loop exits.
+	done chan struct{}
+}
+
+func newRPCClient(conn io.ReadWriteCloser, prog, vers uint32, cred *authSysCred) *rpcClient {
+	c := &rpcClient{
+		conn:    conn,
+		prog:    prog,
+		vers:    vers,
+		cred:    cred.encode(),
+		nextXID: 1,
+		pending: make(map[uint32]chan rpcReplyMsg),
+		done:    make(chan struct{}),
+	}
+	go c.replyLoop() // S/R-SAFE: NFS mounts can't be saved.
+	return c
+}
+
+// call sends a call to proc with the given encoded arguments and waits for
+// the reply. It returns the encoded results.
+func (c *rpcClient) call(proc uint32, args []byte) ([]byte, error) {
+	ch := make(chan rpcReplyMsg, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
+	xid := c.nextXID
+	c.nextXID++
+	c.pending[xid] = ch
+	c.mu.Unlock()
+
+	var e xdrEncoder
+	e.writeUint32(0) // Record marker, filled in below.
+	e.writeUint32(xid)
+	e.writeUint32(rpcCall)
+	e.writeUint32(rpcVersion)
+	e.writeUint32(c.prog)
+	e.writeUint32(c.vers)
+	e.writeUint32(proc)
+	e.writeUint32(authSys)
+	e.writeOpaque(c.cred)
+	e.writeUint32(authNone)
+	e.writeOpaque(nil)
+	e.buf = append(e.buf, args...)
+	binary.BigEndian.PutUint32(e.buf, rpcLastFragment|uint32(len(e.buf)-4))
+
+	c.writeMu.Lock()
+	_, err := c.conn.Write(e.buf)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.fail(fmt.Errorf("writing RPC call: %w", err))
+	}
+
+	reply := <-ch
+	return reply.body, reply.err
+}
+
+// close closes the connection and fails all pending calls.
+func (c *rpcClient) close() {
+	c.fail(errConnClosed)
+	<-c.done
+}
+
+// fail marks the connection as failed with err, closes it and fails all
+// pending calls.
+func (c *rpcClient) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	_ = c.conn.Close()
+	for xid, ch := range c.pending {
+		ch <- rpcReplyMsg{err: err}
+		delete(c.pending, xid)
+	}
+}
+
+// readRecord reads a complete record, which may consist of several fragments.
+func (c *rpcClient) readRecord() ([]byte, error) {
+	var rec []byte
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(c.conn, hdr[:]); err != nil {
+			return nil, err
+		}
+		marker := binary.BigEndian.Uint32(hdr[:])
+		n := int(marker &^ rpcLastFragment)
+		if len(rec)+n > rpcMaxRecord {
+			return nil, fmt.Errorf("RPC record too large: %d bytes", len(rec)+n)
+		}
+		off := len(rec)
+		rec = append(rec, make([]byte, n)...)
+		if _, err := io.ReadFull(c.conn, rec[off:]); err != nil {
+			return nil, err
+		}
+		if marker&rpcLastFragment != 0 {
+			return rec, nil
+		}
+	}
+}
+
+// replyLoop reads replies and dispatches them to the pending calls.
+func (c *rpcClient) replyLoop() {
+	defer close(c.done)
+	for {
+		rec, err := c.readRecord()
+		if err != nil {
+			c.fail(fmt.Errorf("reading RPC reply: %w", err))
+			return
+		}
+		d := xdrDecoder{buf: rec}
+		xid := d.readUint32()
+		if msgType := d.readUint32(); d.err != nil || msgType != rpcReply {
+			log.Warningf("nfs: dropping malformed RPC message")
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[xid]
+		delete(c.pending, xid)
+		c.mu.Unlock()
+		if !ok {
+			log.Warningf("nfs: dropping RPC reply with unknown XID %d", xid)
+			continue
+		}
+		body, err := parseReply(&d)
+		ch <- rpcReplyMsg{body: body, err: err}
+	}
+}
+
+// parseReply parses the remainder of a reply message following the message
+// type, and returns the encoded results.
+func parseReply(d *xdrDecoder) ([]byte, error) {
+	switch stat := d.readUint32(); stat {
+	case rpcMsgAccepted:
+		d.readUint32() // Verifier flavor.
+		d.readOpaque(rpcMaxAuth)
+		acceptStat := d.readUint32()
+		if d.err != nil {
+			return nil, d.err
+		}
+		if acceptStat != rpcSuccess {
+			return nil, fmt.Errorf("RPC call not accepted: accept_stat %d", acceptStat)
+		}
+		return d.buf, nil
+	case rpcMsgDenied:
+		rejectStat := d.readUint32()
+		return nil, fmt.Errorf("RPC call denied: reject_stat %d", rejectStat)
+	default:
+		return nil, fmt.Errorf("invalid RPC reply_stat %d", stat)
+	}
+}
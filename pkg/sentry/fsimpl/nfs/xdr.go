@@ -0,0 +1,167 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errShortBuffer is returned when decoding runs past the end of a message.
+var errShortBuffer = errors.New("XDR: short buffer")
+
+// xdrPad returns the number of padding bytes that follow n bytes of opaque
+// data. XDR aligns all items to 4 bytes.
+func xdrPad(n int) int {
+	return (4 - n%4) % 4
+}
+
+// xdrEncoder encodes XDR (RFC 4506) data.
+type xdrEncoder struct {
+	buf []byte
+}
+
+func (e *xdrEncoder) writeUint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *xdrEncoder) writeUint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *xdrEncoder) writeBool(v bool) {
+	if v {
+		e.writeUint32(1)
+	} else {
+		e.writeUint32(0)
+	}
+}
+
+// writeFixedOpaque writes opaque data whose length is known to the decoder.
+func (e *xdrEncoder) writeFixedOpaque(b []byte) {
+	e.buf = append(e.buf, b...)
+	for i := xdrPad(len(b)); i > 0; i-- {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// writeOpaque writes variable-length opaque data.
+func (e *xdrEncoder) writeOpaque(b []byte) {
+	e.writeUint32(uint32(len(b)))
+	e.writeFixedOpaque(b)
+}
+
+func (e *xdrEncoder) writeString(s string) {
+	e.writeOpaque([]byte(s))
+}
+
+// writeBitmap writes a bitmap4 with the given bits set.
+func (e *xdrEncoder) writeBitmap(bits ...uint32) {
+	var words []uint32
+	for _, bit := range bits {
+		w := int(bit / 32)
+		for len(words) <= w {
+			words = append(words, 0)
+		}
+		words[w] |= 1 << (bit % 32)
+	}
+	e.writeUint32(uint32(len(words)))
+	for _, w := range words {
+		e.writeUint32(w)
+	}
+}
+
+// xdrDecoder decodes XDR data. Errors are sticky: once decoding fails, all
+// subsequent reads return zero values, and err reports the first failure.
+type xdrDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *xdrDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = errShortBuffer
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *xdrDecoder) readUint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *xdrDecoder) readUint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *xdrDecoder) readBool() bool {
+	return d.readUint32() != 0
+}
+
+// readFixedOpaque reads n bytes of opaque data and its padding. The returned
+// slice aliases the message buffer.
+func (d *xdrDecoder) readFixedOpaque(n int) []byte {
+	b := d.next(n)
+	d.next(xdrPad(n))
+	return b
+}
+
+// readOpaque reads variable-length opaque data of at most max bytes.
+func (d *xdrDecoder) readOpaque(max int) []byte {
+	n := d.readUint32()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(n) > uint64(max) {
+		d.err = fmt.Errorf("XDR: opaque length %d exceeds maximum %d", n, max)
+		return nil
+	}
+	return d.readFixedOpaque(int(n))
+}
+
+func (d *xdrDecoder) readString(max int) string {
+	return string(d.readOpaque(max))
+}
+
+// readBitmap reads a bitmap4 and returns the words.
+func (d *xdrDecoder) readBitmap() []uint32 {
+	n := d.readUint32()
+	if d.err != nil {
+		return nil
+	}
+	if n > 8 {
+		d.err = fmt.Errorf("XDR: bitmap too long: %d words", n)
+		return nil
+	}
+	words := make([]uint32, n)
+	for i := range words {
+		words[i] = d.readUint32()
+	}
+	return words
+}
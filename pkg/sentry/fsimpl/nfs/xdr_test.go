@@ -0,0 +1,204 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+)
+
+func TestXDRRoundTrip(t *testing.T) {
+	var e xdrEncoder
+	e.writeUint32(7)
+	e.writeUint64(1 << 40)
+	e.writeBool(true)
+	e.writeOpaque([]byte{1, 2, 3, 4, 5})
+	e.writeString("abc")
+	e.writeBitmap(attrType, attrMode)
+	if len(e.buf)%4 != 0 {
+		t.Fatalf("encoded length %d is not 4-byte aligned", len(e.buf))
+	}
+
+	d := xdrDecoder{buf: e.buf}
+	if got := d.readUint32(); got != 7 {
+		t.Errorf("readUint32 = %d, want 7", got)
+	}
+	if got := d.readUint64(); got != 1<<40 {
+		t.Errorf("readUint64 = %d, want %d", got, uint64(1<<40))
+	}
+	if got := d.readBool(); !got {
+		t.Errorf("readBool = false, want true")
+	}
+	if got := d.readOpaque(16); !bytes.Equal(got, []byte{1, 2, 3, 4, 5}) {
+		t.Errorf("readOpaque = %v, want [1 2 3 4 5]", got)
+	}
+	if got := d.readString(16); got != "abc" {
+		t.Errorf("readString = %q, want %q", got, "abc")
+	}
+	words := d.readBitmap()
+	if len(words) != 2 || words[0] != 1<<attrType || words[1] != 1<<(attrMode-32) {
+		t.Errorf("readBitmap = %#x, want [%#x %#x]", words, 1<<attrType, 1<<(attrMode-32))
+	}
+	if d.err != nil || len(d.buf) != 0 {
+		t.Errorf("decoder error %v, %d bytes left", d.err, len(d.buf))
+	}
+}
+
+func TestXDRShortBuffer(t *testing.T) {
+	var e xdrEncoder
+	e.writeOpaque([]byte("hello"))
+	d := xdrDecoder{buf: e.buf[:6]}
+	d.readOpaque(16)
+	if d.err != errShortBuffer {
+		t.Errorf("got error %v, want %v", d.err, errShortBuffer)
+	}
+	// Errors are sticky.
+	if got := d.readUint32(); got != 0 {
+		t.Errorf("readUint32 after error = %d, want 0", got)
+	}
+
+	d = xdrDecoder{buf: e.buf}
+	if d.readOpaque(4); d.err == nil {
+		t.Errorf("readOpaque exceeding the maximum length succeeded")
+	}
+}
+
+func TestCompoundResult(t *testing.T) {
+	var e xdrEncoder
+	e.writeUint32(nfs4ErrDenied) // status
+	e.writeString("")            // tag
+	e.writeUint32(2)             // resarray length
+	e.writeUint32(opPutFH)
+	e.writeUint32(nfs4OK)
+	e.writeUint32(opLockT)
+	e.writeUint32(nfs4ErrDenied)
+	e.writeUint64(10) // offset
+	e.writeUint64(20) // length
+	e.writeUint32(uint32(WriteLock))
+	e.writeUint64(1) // owner.clientid
+	e.writeOpaque(lockOwnerBytes(2))
+
+	r, err := decodeCompoundResult(e.buf)
+	if err != nil {
+		t.Fatalf("decodeCompoundResult failed: %v", err)
+	}
+	if _, err := r.next(opPutFH); err != nil {
+		t.Fatalf("PUTFH result: %v", err)
+	}
+	d, err := r.next(opLockT)
+	if !errors.Is(ToErrno(err), linuxerr.EAGAIN) {
+		t.Fatalf("LOCKT result: got error %v, want EAGAIN", err)
+	}
+	conflict := readDenied(d)
+	if d.err != nil {
+		t.Fatalf("readDenied failed: %v", d.err)
+	}
+	if want := (LockConflict{Type: WriteLock, Offset: 10, Length: 20}); *conflict != want {
+		t.Errorf("got conflict %+v, want %+v", *conflict, want)
+	}
+	if _, err := r.next(opGetAttr); err != statusError(nfs4ErrDenied) {
+		t.Errorf("result past the failed operation: got error %v, want %v", err, statusError(nfs4ErrDenied))
+	}
+}
+
+// serveRPC reads one call from conn and sends reply as the results. The
+// reply is split into two fragments.
+func serveRPC(t *testing.T, conn net.Conn, reply []byte) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		t.Errorf("reading record marker: %v", err)
+		return
+	}
+	marker := binary.BigEndian.Uint32(hdr[:])
+	if marker&rpcLastFragment == 0 {
+		t.Errorf("call is not a single fragment")
+	}
+	call := make([]byte, marker&^rpcLastFragment)
+	if _, err := io.ReadFull(conn, call); err != nil {
+		t.Errorf("reading call: %v", err)
+		return
+	}
+	d := xdrDecoder{buf: call}
+	xid := d.readUint32()
+	if msgType := d.readUint32(); msgType != rpcCall {
+		t.Errorf("got message type %d, want %d", msgType, rpcCall)
+	}
+
+	var e xdrEncoder
+	e.writeUint32(xid)
+	e.writeUint32(rpcReply)
+	e.writeUint32(rpcMsgAccepted)
+	e.writeUint32(authNone)
+	e.writeOpaque(nil)
+	e.writeUint32(rpcSuccess)
+	e.buf = append(e.buf, reply...)
+
+	half := len(e.buf) / 2
+	var rec xdrEncoder
+	rec.writeUint32(uint32(half))
+	rec.buf = append(rec.buf, e.buf[:half]...)
+	rec.writeUint32(rpcLastFragment | uint32(len(e.buf)-half))
+	rec.buf = append(rec.buf, e.buf[half:]...)
+	if _, err := conn.Write(rec.buf); err != nil {
+		t.Errorf("writing reply: %v", err)
+	}
+}
+
+func TestRPCCall(t *testing.T) {
+	client, server := net.Pipe()
+	c := newRPCClient(client, nfsProgram, nfsVersion, &authSysCred{machineName: "test"})
+	defer c.close()
+
+	want := []byte{0, 0, 0, 42}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveRPC(t, server, want)
+	}()
+	got, err := c.call(procCompound, nil)
+	<-done
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got results %v, want %v", got, want)
+	}
+}
+
+func TestRPCConnectionClosed(t *testing.T) {
+	client, server := net.Pipe()
+	c := newRPCClient(client, nfsProgram, nfsVersion, &authSysCred{machineName: "test"})
+	defer c.close()
+
+	go func() {
+		// Consume the call and hang up without replying.
+		var buf [512]byte
+		_, _ = server.Read(buf[:])
+		_ = server.Close()
+	}()
+	if _, err := c.call(procCompound, nil); err == nil {
+		t.Fatalf("call succeeded after the server hung up")
+	}
+	// The connection can't be used anymore.
+	if _, err := c.call(procCompound, nil); err == nil {
+		t.Errorf("call succeeded on a failed connection")
+	}
+}
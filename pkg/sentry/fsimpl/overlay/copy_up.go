@@ -16,6 +16,7 @@ package overlay
 
 import (
 	"fmt"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -395,6 +396,12 @@ func (d *dentry) copyXattrsLocked(ctx context.Context) error {
 		}
 
 		if err := vfsObj.SetXattrAt(ctx, d.fs.creds, upperPop, &vfs.SetXattrOptions{Name: name, Value: value}); err != nil {
+			// As in Linux's fs/overlayfs/copy_up.c:ovl_copy_xattr(), ignore
+			// attributes that the upper layer doesn't support, except for
+			// security attributes, which must be preserved.
+			if linuxerr.Equals(linuxerr.EOPNOTSUPP, err) && !strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX) {
+				continue
+			}
 			ctx.Infof("failed to copy up xattrs because SetXattrAt failed: %v", err)
 			return err
 		}
@@ -0,0 +1,112 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// Unlike Linux's overlayfs, overlay filesystems forward quotactl(2) to their
+// upper layer, since that is where all of their writes end up. This allows
+// quotas to be used on overlay mounts, such as the root filesystem, without
+// access to the upper layer's mount.
+
+// upperQuotaImpl returns the vfs.QuotaFilesystemImpl of fs' upper layer, or
+// ENOSYS if it has none.
+func (fs *filesystem) upperQuotaImpl() (vfs.QuotaFilesystemImpl, error) {
+	if !fs.opts.UpperRoot.Ok() {
+		return nil, linuxerr.ENOSYS
+	}
+	impl, ok := fs.opts.UpperRoot.Mount().Filesystem().Impl().(vfs.QuotaFilesystemImpl)
+	if !ok {
+		return nil, linuxerr.ENOSYS
+	}
+	return impl, nil
+}
+
+// QuotaFormat implements vfs.QuotaFilesystemImpl.QuotaFormat.
+func (fs *filesystem) QuotaFormat(qtype int) (uint32, error) {
+	impl, err := fs.upperQuotaImpl()
+	if err != nil {
+		return 0, err
+	}
+	return impl.QuotaFormat(qtype)
+}
+
+// QuotaOn implements vfs.QuotaFilesystemImpl.QuotaOn.
+func (fs *filesystem) QuotaOn(ctx context.Context, qtype int) error {
+	impl, err := fs.upperQuotaImpl()
+	if err != nil {
+		return err
+	}
+	return impl.QuotaOn(ctx, qtype)
+}
+
+// QuotaOff implements vfs.QuotaFilesystemImpl.QuotaOff.
+func (fs *filesystem) QuotaOff(ctx context.Context, qtype int) error {
+	impl, err := fs.upperQuotaImpl()
+	if err != nil {
+		return err
+	}
+	return impl.QuotaOff(ctx, qtype)
+}
+
+// GetQuotaInfo implements vfs.QuotaFilesystemImpl.GetQuotaInfo.
+func (fs *filesystem) GetQuotaInfo(ctx context.Context, qtype int) (linux.IfDqinfo, error) {
+	impl, err := fs.upperQuotaImpl()
+	if err != nil {
+		return linux.IfDqinfo{}, err
+	}
+	return impl.GetQuotaInfo(ctx, qtype)
+}
+
+// SetQuotaInfo implements vfs.QuotaFilesystemImpl.SetQuotaInfo.
+func (fs *filesystem) SetQuotaInfo(ctx context.Context, qtype int, info linux.IfDqinfo) error {
+	impl, err := fs.upperQuotaImpl()
+	if err != nil {
+		return err
+	}
+	return impl.SetQuotaInfo(ctx, qtype, info)
+}
+
+// GetQuota implements vfs.QuotaFilesystemImpl.GetQuota.
+func (fs *filesystem) GetQuota(ctx context.Context, qtype int, id uint32) (linux.IfDqblk, error) {
+	impl, err := fs.upperQuotaImpl()
+	if err != nil {
+		return linux.IfDqblk{}, err
+	}
+	return impl.GetQuota(ctx, qtype, id)
+}
+
+// SetQuota implements vfs.QuotaFilesystemImpl.SetQuota.
+func (fs *filesystem) SetQuota(ctx context.Context, qtype int, id uint32, dqb linux.IfDqblk) error {
+	impl, err := fs.upperQuotaImpl()
+	if err != nil {
+		return err
+	}
+	return impl.SetQuota(ctx, qtype, id, dqb)
+}
+
+// GetNextQuota implements vfs.QuotaFilesystemImpl.GetNextQuota.
+func (fs *filesystem) GetNextQuota(ctx context.Context, qtype int, id uint32) (uint32, linux.IfDqblk, error) {
+	impl, err := fs.upperQuotaImpl()
+	if err != nil {
+		return 0, linux.IfDqblk{}, err
+	}
+	return impl.GetNextQuota(ctx, qtype, id)
+}
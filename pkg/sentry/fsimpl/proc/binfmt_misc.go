@@ -0,0 +1,298 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// binfmtMiscRegisterMaxLen is the maximum length of a registration string
+// written to /proc/sys/fs/binfmt_misc/register. From
+// fs/binfmt_misc.c:MAX_REGISTER_LENGTH.
+const binfmtMiscRegisterMaxLen = 1920
+
+// binfmtMiscDirInode represents the inode for /proc/sys/fs/binfmt_misc.
+//
+// +stateify savable
+type binfmtMiscDirInode struct {
+	implStatFS
+	kernfs.InodeAlwaysValid
+	kernfs.InodeAttrs
+	kernfs.InodeDirectoryNoNewChildren
+	kernfs.InodeNotAnonymous
+	kernfs.InodeNotSymlink
+	kernfs.InodeTemporary
+	kernfs.InodeWatches
+	kernfs.OrderedChildren
+	binfmtMiscDirInodeRefs
+
+	locks vfs.FileLocks
+
+	fs   *filesystem
+	k    *kernel.Kernel
+	root *auth.Credentials
+}
+
+var _ kernfs.Inode = (*binfmtMiscDirInode)(nil)
+
+func (fs *filesystem) newBinfmtMiscDir(ctx context.Context, root *auth.Credentials, k *kernel.Kernel) kernfs.Inode {
+	inode := &binfmtMiscDirInode{
+		fs:   fs,
+		k:    k,
+		root: root,
+	}
+	inode.InodeAttrs.Init(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), linux.ModeDirectory|0555)
+	inode.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	inode.InitRefs()
+	return inode
+}
+
+// Lookup implements kernfs.inodeDirectory.Lookup.
+func (i *binfmtMiscDirInode) Lookup(ctx context.Context, name string) (kernfs.Inode, error) {
+	switch name {
+	case "register":
+		return i.fs.newInode(ctx, i.root, 0200, &binfmtMiscRegisterData{k: i.k}), nil
+	case "status":
+		return i.fs.newInode(ctx, i.root, 0644, &binfmtMiscStatusData{k: i.k}), nil
+	}
+	if !i.k.BinfmtMisc().Has(name) {
+		return nil, linuxerr.ENOENT
+	}
+	return i.fs.newInode(ctx, i.root, 0644, &binfmtMiscEntryData{k: i.k, name: name}), nil
+}
+
+// IterDirents implements kernfs.inodeDirectory.IterDirents.
+func (i *binfmtMiscDirInode) IterDirents(ctx context.Context, mnt *vfs.Mount, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	names := append([]string{"register", "status"}, i.k.BinfmtMisc().Names()...)
+	if relOffset >= int64(len(names)) {
+		return offset, nil
+	}
+	for _, name := range names[relOffset:] {
+		dirent := vfs.Dirent{
+			Name:    name,
+			Type:    linux.DT_REG,
+			Ino:     i.fs.NextIno(),
+			NextOff: offset + 1,
+		}
+		if err := cb.Handle(dirent); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
+// Open implements kernfs.Inode.Open.
+func (i *binfmtMiscDirInode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd, err := kernfs.NewGenericDirectoryFD(rp.Mount(), d, &i.OrderedChildren, &i.locks, &opts, kernfs.GenericDirectoryFDOptions{
+		SeekEnd: kernfs.SeekEndZero,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fd.VFSFileDescription(), nil
+}
+
+// SetStat implements kernfs.Inode.SetStat not allowing inode attributes to be changed.
+func (*binfmtMiscDirInode) SetStat(context.Context, *vfs.Filesystem, *auth.Credentials, vfs.SetStatOptions) error {
+	return linuxerr.EPERM
+}
+
+// DecRef implements kernfs.Inode.DecRef.
+func (i *binfmtMiscDirInode) DecRef(ctx context.Context) {
+	i.binfmtMiscDirInodeRefs.DecRef(func() { i.Destroy(ctx) })
+}
+
+// binfmtMiscCheckWrite returns an error if the caller may not modify
+// binfmt_misc. Registered formats apply to every task in the sandbox, so they
+// can only be changed from the root user namespace.
+func binfmtMiscCheckWrite(ctx context.Context, k *kernel.Kernel) error {
+	if !auth.CredentialsFromContext(ctx).HasCapabilityIn(linux.CAP_SYS_ADMIN, k.RootUserNamespace()) {
+		return linuxerr.EPERM
+	}
+	return nil
+}
+
+// binfmtMiscCommand reads a command written to the status or an entry file:
+// "1" to enable, "0" to disable, or "-1" to remove. From
+// fs/binfmt_misc.c:parse_command().
+func binfmtMiscCommand(ctx context.Context, src usermem.IOSequence) (string, int64, error) {
+	if src.NumBytes() > 3 {
+		return "", 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return "", 0, err
+	}
+	cmd := string(bytes.TrimSuffix(buf[:n], []byte("\n")))
+	switch cmd {
+	case "0", "1", "-1":
+		return cmd, int64(n), nil
+	default:
+		return "", 0, linuxerr.EINVAL
+	}
+}
+
+// binfmtMiscRegisterData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/fs/binfmt_misc/register.
+//
+// +stateify savable
+type binfmtMiscRegisterData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*binfmtMiscRegisterData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *binfmtMiscRegisterData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	return linuxerr.EINVAL
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *binfmtMiscRegisterData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// Registrations must be written in a single write.
+		return 0, linuxerr.EINVAL
+	}
+	if err := binfmtMiscCheckWrite(ctx, d.k); err != nil {
+		return 0, err
+	}
+	if src.NumBytes() < 11 || src.NumBytes() > binfmtMiscRegisterMaxLen {
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return 0, linuxerr.EINVAL
+	}
+	root := t.FSContext().RootDirectory()
+	defer root.DecRef(ctx)
+	wd := t.FSContext().WorkingDirectory()
+	defer wd.DecRef(ctx)
+	if err := d.k.BinfmtMisc().Register(ctx, string(buf[:n]), root, wd); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// binfmtMiscStatusData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/fs/binfmt_misc/status.
+//
+// +stateify savable
+type binfmtMiscStatusData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*binfmtMiscStatusData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *binfmtMiscStatusData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if d.k.BinfmtMisc().Enabled() {
+		buf.WriteString("enabled\n")
+	} else {
+		buf.WriteString("disabled\n")
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *binfmtMiscStatusData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if err := binfmtMiscCheckWrite(ctx, d.k); err != nil {
+		return 0, err
+	}
+	cmd, n, err := binfmtMiscCommand(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	switch cmd {
+	case "0":
+		d.k.BinfmtMisc().SetEnabled(false)
+	case "1":
+		d.k.BinfmtMisc().SetEnabled(true)
+	case "-1":
+		d.k.BinfmtMisc().Clear(ctx)
+	}
+	return n, nil
+}
+
+// binfmtMiscEntryData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/fs/binfmt_misc/<name>.
+//
+// +stateify savable
+type binfmtMiscEntryData struct {
+	kernfs.DynamicBytesFile
+
+	k    *kernel.Kernel
+	name string
+}
+
+var _ vfs.WritableDynamicBytesSource = (*binfmtMiscEntryData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *binfmtMiscEntryData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	status, err := d.k.BinfmtMisc().Status(d.name)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(status)
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *binfmtMiscEntryData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if err := binfmtMiscCheckWrite(ctx, d.k); err != nil {
+		return 0, err
+	}
+	cmd, n, err := binfmtMiscCommand(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	switch cmd {
+	case "0":
+		err = d.k.BinfmtMisc().SetEntryEnabled(d.name, false)
+	case "1":
+		err = d.k.BinfmtMisc().SetEntryEnabled(d.name, true)
+	case "-1":
+		err = d.k.BinfmtMisc().Remove(ctx, d.name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Valid implements kernfs.Inode.Valid.
+func (d *binfmtMiscEntryData) Valid(ctx context.Context) bool {
+	return d.k.BinfmtMisc().Has(d.name)
+}
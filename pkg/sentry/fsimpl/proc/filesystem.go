@@ -18,6 +18,7 @@ package proc
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -52,6 +53,11 @@ type filesystem struct {
 	kernfs.Filesystem
 
 	devMinor uint32
+
+	// subsetPID is true if the filesystem was mounted with "subset=pid", in
+	// which case only process directories and the "self" and "thread-self"
+	// symlinks are visible in its root. It is immutable.
+	subsetPID bool
 }
 
 func (fs *filesystem) StatFSAt(ctx context.Context, rp *vfs.ResolvingPath) (linux.Statfs, error) {
@@ -89,19 +95,35 @@ func (ft FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualF
 		}
 	}
 
+	// See Linux's fs/proc/root.c:proc_parse_subset_param().
+	subsetPID := false
+	if str, ok := mopts["subset"]; ok {
+		delete(mopts, "subset")
+		if str != "pid" {
+			ctx.Warningf("proc.FilesystemType.GetFilesystem: unsupported subset: subset=%s", str)
+			return nil, nil, linuxerr.EINVAL
+		}
+		subsetPID = true
+	}
+
 	procfs := &filesystem{
-		devMinor: devMinor,
+		devMinor:  devMinor,
+		subsetPID: subsetPID,
 	}
 	procfs.MaxCachedDentries = maxCachedDentries
 	procfs.VFSFilesystem().Init(vfsObj, &ft, procfs)
 
-	var fakeCgroupControllers map[string]string
+	var (
+		fakeCgroupControllers map[string]string
+		driverFiles           map[string]string
+	)
 	if opts.InternalData != nil {
 		data := opts.InternalData.(*InternalData)
 		fakeCgroupControllers = data.Cgroups
+		driverFiles = data.DriverFiles
 	}
 
-	inode := procfs.newTasksInode(ctx, k, pidns, fakeCgroupControllers)
+	inode := procfs.newTasksInode(ctx, k, pidns, fakeCgroupControllers, driverFiles)
 	var dentry kernfs.Dentry
 	dentry.InitRoot(&procfs.Filesystem, inode)
 	return procfs.VFSFilesystem(), dentry.VFSDentry(), nil
@@ -115,7 +137,11 @@ func (fs *filesystem) Release(ctx context.Context) {
 
 // MountOptions implements vfs.FilesystemImpl.MountOptions.
 func (fs *filesystem) MountOptions() string {
-	return fmt.Sprintf("dentry_cache_limit=%d", fs.MaxCachedDentries)
+	opts := fmt.Sprintf("dentry_cache_limit=%d", fs.MaxCachedDentries)
+	if fs.subsetPID {
+		opts += ",subset=pid"
+	}
+	return opts
 }
 
 // dynamicInode is an overfitted interface for common Inodes with
@@ -152,12 +178,40 @@ func (fs *filesystem) newStaticDir(ctx context.Context, creds *auth.Credentials,
 	})
 }
 
+// newStaticTree returns the children of a directory containing the given
+// inodes, keyed by slash-separated paths relative to that directory.
+// Intermediate directories are created as static directories.
+func (fs *filesystem) newStaticTree(ctx context.Context, creds *auth.Credentials, inodes map[string]kernfs.Inode) map[string]kernfs.Inode {
+	children := make(map[string]kernfs.Inode)
+	subdirs := make(map[string]map[string]kernfs.Inode)
+	for path, inode := range inodes {
+		name, rest, ok := strings.Cut(path, "/")
+		if !ok {
+			children[name] = inode
+			continue
+		}
+		if subdirs[name] == nil {
+			subdirs[name] = make(map[string]kernfs.Inode)
+		}
+		subdirs[name][rest] = inode
+	}
+	for name, subdir := range subdirs {
+		children[name] = fs.newStaticDir(ctx, creds, fs.newStaticTree(ctx, creds, subdir))
+	}
+	return children
+}
+
 // InternalData contains internal data passed in to the procfs mount via
 // vfs.GetFilesystemOptions.InternalData.
 //
 // +stateify savable
 type InternalData struct {
 	Cgroups map[string]string
+
+	// DriverFiles maps paths relative to /proc/driver to the contents of
+	// read-only files that should exist at those paths, for example to
+	// emulate files exposed by host device drivers.
+	DriverFiles map[string]string
 }
 
 // +stateify savable
@@ -72,21 +72,28 @@ func (fs *filesystem) newTaskInode(ctx context.Context, task *kernel.Task, pidns
 		"mounts":    fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &mountsData{fs: fs, task: task}),
 		"net":       fs.newTaskNetDir(ctx, task),
 		"ns": fs.newTaskOwnedDir(ctx, task, fs.NextIno(), 0511, map[string]kernfs.Inode{
-			"net":  fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWNET),
-			"mnt":  fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWNS),
-			"pid":  fs.newPIDNamespaceSymlink(ctx, task, fs.NextIno()),
-			"user": fs.newFakeNamespaceSymlink(ctx, task, fs.NextIno(), "user"),
-			"ipc":  fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWIPC),
-			"uts":  fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWUTS),
+			"net":               fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWNET),
+			"mnt":               fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWNS),
+			"pid":               fs.newPIDNamespaceSymlink(ctx, task, fs.NextIno()),
+			"user":              fs.newFakeNamespaceSymlink(ctx, task, fs.NextIno(), "user"),
+			"ipc":               fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWIPC),
+			"uts":               fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWUTS),
+			"time":              fs.newNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWTIME),
+			"time_for_children": fs.newChildNamespaceSymlink(ctx, task, fs.NextIno(), linux.CLONE_NEWTIME),
 		}),
-		"oom_score":     fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, newStaticFile("0\n")),
-		"oom_score_adj": fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0644, &oomScoreAdj{task: task}),
-		"root":          fs.newRootSymlink(ctx, task, fs.NextIno()),
-		"smaps":         fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &smapsData{task: task}),
-		"stat":          fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &taskStatData{task: task, pidns: pidns, tgstats: isThreadGroup}),
-		"statm":         fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &statmData{task: task}),
-		"status":        fs.newStatusInode(ctx, task, pidns, fs.NextIno(), 0444),
-		"uid_map":       fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0644, &idMapData{task: task, gids: false}),
+		"oom_score":      fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, newStaticFile("0\n")),
+		"oom_score_adj":  fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0644, &oomScoreAdj{task: task}),
+		"pagemap":        fs.newPagemapInode(ctx, task, fs.NextIno(), 0400),
+		"root":           fs.newRootSymlink(ctx, task, fs.NextIno()),
+		"schedstat":      fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &schedstatData{task: task}),
+		"setgroups":      fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0644, &setgroupsData{task: task}),
+		"smaps":          fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &smapsData{task: task}),
+		"smaps_rollup":   fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &smapsRollupData{task: task}),
+		"stat":           fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &taskStatData{task: task, pidns: pidns, tgstats: isThreadGroup}),
+		"statm":          fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0444, &statmData{task: task}),
+		"status":         fs.newStatusInode(ctx, task, pidns, fs.NextIno(), 0444),
+		"timens_offsets": fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0644, &timensOffsetsData{task: task}),
+		"uid_map":        fs.newTaskOwnedInode(ctx, task, fs.NextIno(), 0644, &idMapData{task: task, gids: false}),
 	}
 	if isThreadGroup {
 		contents["task"] = fs.newSubtasks(ctx, task, pidns, fakeCgroupControllers)
@@ -21,6 +21,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -39,9 +40,10 @@ import (
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
-// "There is an (arbitrary) limit on the number of lines in the file. As at
-// Linux 3.18, the limit is five lines." - user_namespaces(7)
-const maxIDMapLines = 5
+// "There is a limit on the number of lines in the file. In Linux 4.14 and
+// earlier, this limit was (arbitrarily) set at 5 lines. Since Linux 4.15, the
+// limit is 340 lines." - user_namespaces(7)
+const maxIDMapLines = 340
 
 // getMM gets the kernel task's MemoryManager. No additional reference is taken on
 // mm here. This is safe because MemoryManager.destroy is required to leave the
@@ -340,10 +342,11 @@ var _ vfs.WritableDynamicBytesSource = (*idMapData)(nil)
 // Generate implements vfs.WritableDynamicBytesSource.Generate.
 func (d *idMapData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	var entries []auth.IDMapEntry
+	viewer := auth.CredentialsFromContext(ctx).UserNamespace
 	if d.gids {
-		entries = d.task.UserNamespace().GIDMap()
+		entries = d.task.UserNamespace().GIDMapIn(viewer)
 	} else {
-		entries = d.task.UserNamespace().UIDMap()
+		entries = d.task.UserNamespace().UIDMapIn(viewer)
 	}
 	for _, e := range entries {
 		fmt.Fprintf(buf, "%10d %10d %10d\n", e.FirstID, e.FirstParentID, e.Length)
@@ -405,6 +408,152 @@ func (d *idMapData) Write(ctx context.Context, _ *vfs.FileDescription, src userm
 	return int64(srclen), nil
 }
 
+// setgroupsData implements vfs.WritableDynamicBytesSource for
+// /proc/[pid]/setgroups.
+//
+// +stateify savable
+type setgroupsData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*setgroupsData)(nil)
+var _ vfs.WritableDynamicBytesSource = (*setgroupsData)(nil)
+
+// Generate implements vfs.WritableDynamicBytesSource.Generate.
+func (d *setgroupsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if d.task.UserNamespace().SetgroupsDenied() {
+		buf.WriteString("deny\n")
+	} else {
+		buf.WriteString("allow\n")
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *setgroupsData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	// Linux's kernel/user_namespace.c:proc_setgroups_write() only accepts
+	// small writes at the start of the file.
+	srclen := src.NumBytes()
+	if srclen >= 8 || offset != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	b := make([]byte, srclen)
+	if _, err := src.CopyIn(ctx, b); err != nil {
+		return 0, err
+	}
+	// Truncate from the first NULL byte.
+	if nul := bytes.IndexByte(b, 0); nul != -1 {
+		b = b[:nul]
+	}
+
+	var allow bool
+	switch strings.TrimRight(string(b), " \t\n\v\f\r") {
+	case "allow":
+		allow = true
+	case "deny":
+		allow = false
+	default:
+		return 0, linuxerr.EINVAL
+	}
+
+	// Linux checks this when the file is opened for writing.
+	ns := d.task.UserNamespace()
+	if !auth.CredentialsFromContext(ctx).HasCapabilityIn(linux.CAP_SYS_ADMIN, ns) {
+		return 0, linuxerr.EPERM
+	}
+	if err := ns.SetSetgroups(allow); err != nil {
+		return 0, err
+	}
+	return int64(srclen), nil
+}
+
+// timensOffsetsData implements vfs.WritableDynamicBytesSource for
+// /proc/[pid]/timens_offsets.
+//
+// +stateify savable
+type timensOffsetsData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*timensOffsetsData)(nil)
+var _ vfs.WritableDynamicBytesSource = (*timensOffsetsData)(nil)
+
+// Generate implements vfs.WritableDynamicBytesSource.Generate.
+func (d *timensOffsetsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// Like Linux, show the offsets of the namespace that children of the task
+	// will be created in.
+	timens := d.task.GetChildTimeNamespace()
+	if timens == nil {
+		return linuxerr.ESRCH
+	}
+	defer timens.DecRef(ctx)
+	monotonic, boottime := timens.Offsets()
+	fmt.Fprintf(buf, "monotonic %d %d\n", int64(monotonic/time.Second), int64(monotonic%time.Second))
+	fmt.Fprintf(buf, "boottime %d %d\n", int64(boottime/time.Second), int64(boottime%time.Second))
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *timensOffsetsData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	srclen := src.NumBytes()
+	if srclen >= hostarch.PageSize || offset != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	b := make([]byte, srclen)
+	if _, err := src.CopyIn(ctx, b); err != nil {
+		return 0, err
+	}
+
+	var offsets []kernel.TimeNamespaceOffset
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.Fields(l)
+		if len(fields) != 3 {
+			return 0, linuxerr.EINVAL
+		}
+		var o kernel.TimeNamespaceOffset
+		switch fields[0] {
+		case "monotonic":
+			o.ClockID = linux.CLOCK_MONOTONIC
+		case "boottime":
+			o.ClockID = linux.CLOCK_BOOTTIME
+		default:
+			id, err := strconv.ParseInt(fields[0], 10, 32)
+			if err != nil {
+				return 0, linuxerr.EINVAL
+			}
+			o.ClockID = int32(id)
+		}
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, linuxerr.EINVAL
+		}
+		nsecs, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || nsecs < 0 || nsecs >= int64(time.Second) {
+			return 0, linuxerr.EINVAL
+		}
+		o.Offset = time.Duration(secs)*time.Second + time.Duration(nsecs)
+		offsets = append(offsets, o)
+	}
+
+	timens := d.task.GetChildTimeNamespace()
+	if timens == nil {
+		return 0, linuxerr.ESRCH
+	}
+	defer timens.DecRef(ctx)
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapabilityIn(linux.CAP_SYS_TIME, timens.UserNamespace()) {
+		return 0, linuxerr.EPERM
+	}
+	if err := timens.SetOffsets(offsets); err != nil {
+		return 0, err
+	}
+	return int64(srclen), nil
+}
+
 var _ kernfs.Inode = (*memInode)(nil)
 
 // memInode implements kernfs.Inode for /proc/[pid]/mem.
@@ -553,6 +702,166 @@ func (fd *memFD) SetStat(context.Context, vfs.SetStatOptions) error {
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *memFD) Release(context.Context) {}
 
+var _ kernfs.Inode = (*pagemapInode)(nil)
+
+// pagemapInode implements kernfs.Inode for /proc/[pid]/pagemap.
+//
+// +stateify savable
+type pagemapInode struct {
+	kernfs.InodeAttrs
+	kernfs.InodeNoStatFS
+	kernfs.InodeNoopRefCount
+	kernfs.InodeNotAnonymous
+	kernfs.InodeNotDirectory
+	kernfs.InodeNotSymlink
+	kernfs.InodeWatches
+
+	task  *kernel.Task
+	locks vfs.FileLocks
+}
+
+func (fs *filesystem) newPagemapInode(ctx context.Context, task *kernel.Task, ino uint64, perm linux.FileMode) kernfs.Inode {
+	// Note: credentials are overridden by taskOwnedInode.
+	inode := &pagemapInode{task: task}
+	inode.InodeAttrs.Init(ctx, task.Credentials(), linux.UNNAMED_MAJOR, fs.devMinor, ino, linux.ModeRegular|perm)
+	return &taskOwnedInode{Inode: inode, owner: task}
+}
+
+// Open implements kernfs.Inode.Open.
+func (i *pagemapInode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	// Permission to read this file is governed by PTRACE_MODE_READ_FSCREDS.
+	// Since we dont implement setfsuid/setfsgid we can just use
+	// PTRACE_MODE_READ.
+	if !kernel.ContextCanTrace(ctx, i.task, false) {
+		return nil, linuxerr.EACCES
+	}
+	if err := checkTaskState(i.task); err != nil {
+		return nil, err
+	}
+	fd := &pagemapFD{inode: i}
+	fd.LockFD.Init(&i.locks)
+	if err := fd.vfsfd.Init(fd, opts.Flags, rp.Mount(), d.VFSDentry(), &vfs.FileDescriptionOptions{}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// SetStat implements kernfs.Inode.SetStat.
+func (*pagemapInode) SetStat(context.Context, *vfs.Filesystem, *auth.Credentials, vfs.SetStatOptions) error {
+	return linuxerr.EPERM
+}
+
+var _ vfs.FileDescriptionImpl = (*pagemapFD)(nil)
+
+// pagemapFD implements vfs.FileDescriptionImpl for /proc/[pid]/pagemap.
+//
+// +stateify savable
+type pagemapFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.LockFD
+
+	inode *pagemapInode
+
+	// mu guards the fields below.
+	mu     sync.Mutex `state:"nosave"`
+	offset int64
+}
+
+// pagemapReadEntries is the maximum number of entries generated at a time by
+// pagemapFD.PRead.
+const pagemapReadEntries = 512
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *pagemapFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	switch whence {
+	case linux.SEEK_SET:
+	case linux.SEEK_CUR:
+		offset += fd.offset
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	fd.offset = offset
+	return offset, nil
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *pagemapFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	// See Linux's fs/proc/task_mmu.c:pagemap_read().
+	if offset%mm.PagemapEntrySize != 0 || dst.NumBytes()%mm.PagemapEntrySize != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if dst.NumBytes() == 0 {
+		return 0, nil
+	}
+	m, err := getMMIncRef(fd.inode.task)
+	if err != nil {
+		return 0, err
+	}
+	defer m.DecUsers(ctx)
+
+	// The file holds one entry for each page below m.PagemapEnd().
+	index := uint64(offset) / mm.PagemapEntrySize
+	endIndex := uint64(m.PagemapEnd()) / hostarch.PageSize
+	if index >= endIndex {
+		return 0, nil
+	}
+	remaining := uint64(dst.NumBytes()) / mm.PagemapEntrySize
+	if remaining > endIndex-index {
+		remaining = endIndex - index
+	}
+	entries := make([]uint64, pagemapReadEntries)
+	buf := make([]byte, pagemapReadEntries*mm.PagemapEntrySize)
+	var total int64
+	for remaining > 0 {
+		n := uint64(len(entries))
+		if n > remaining {
+			n = remaining
+		}
+		m.ReadPagemapInto(ctx, hostarch.Addr(index*hostarch.PageSize), entries[:n])
+		for i, entry := range entries[:n] {
+			hostarch.ByteOrder.PutUint64(buf[i*mm.PagemapEntrySize:], entry)
+		}
+		copied, err := dst.CopyOut(ctx, buf[:n*mm.PagemapEntrySize])
+		total += int64(copied)
+		if err != nil {
+			return total, err
+		}
+		dst = dst.DropFirst(copied)
+		index += n
+		remaining -= n
+	}
+	return total, nil
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *pagemapFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.mu.Lock()
+	n, err := fd.PRead(ctx, dst, fd.offset, opts)
+	fd.offset += n
+	fd.mu.Unlock()
+	return n, err
+}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *pagemapFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	fs := fd.vfsfd.VirtualDentry().Mount().Filesystem()
+	return fd.inode.Stat(ctx, fs, opts)
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *pagemapFD) SetStat(context.Context, vfs.SetStatOptions) error {
+	return linuxerr.EPERM
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *pagemapFD) Release(context.Context) {}
+
 // limitsData implements vfs.DynamicBytesSource for /proc/[pid]/limits.
 //
 // +stateify savable
@@ -629,6 +938,26 @@ func (d *smapsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// smapsRollupData implements vfs.DynamicBytesSource for
+// /proc/[pid]/smaps_rollup.
+//
+// +stateify savable
+type smapsRollupData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*smapsRollupData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *smapsRollupData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if mm := getMM(d.task); mm != nil {
+		mm.ReadSmapsRollupDataInto(ctx, buf)
+	}
+	return nil
+}
+
 // +stateify savable
 type taskStatData struct {
 	kernfs.DynamicBytesFile
@@ -677,8 +1006,14 @@ func (s *taskStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	// maintained, and is hard coded as 0.
 	fmt.Fprintf(buf, "0 ")
 
-	// Start time is relative to boot time, expressed in clock ticks.
-	fmt.Fprintf(buf, "%d ", linux.ClockTFromDuration(s.task.StartTime().Sub(s.task.Kernel().Timekeeper().BootTime())))
+	// Start time is relative to boot time, expressed in clock ticks. Like
+	// CLOCK_BOOTTIME, it's offset by the reader's time namespace.
+	startTime := s.task.StartTime().Sub(s.task.Kernel().Timekeeper().BootTime())
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		_, boottime := t.TimeNamespace().Offsets()
+		startTime += boottime
+	}
+	fmt.Fprintf(buf, "%d ", linux.ClockTFromDuration(startTime))
 
 	var vss, rss uint64
 	if mm := getMM(s.task); mm != nil {
@@ -706,6 +1041,28 @@ func (s *taskStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// schedstatData implements vfs.DynamicBytesSource for /proc/[pid]/schedstat.
+//
+// +stateify savable
+type schedstatData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*schedstatData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (s *schedstatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// As in Linux, this reports the CPU time of the task (rather than its
+	// thread group) in nanoseconds. Time spent waiting to run is not
+	// tracked, and the number of voluntary switches approximates the number
+	// of times the task has been scheduled.
+	cputime := s.task.CPUStats()
+	fmt.Fprintf(buf, "%d 0 %d\n", (cputime.UserTime + cputime.SysTime).Nanoseconds(), cputime.VoluntarySwitches)
+	return nil
+}
+
 // statmData implements vfs.DynamicBytesSource for /proc/[pid]/statm.
 //
 // +stateify savable
@@ -880,13 +1237,27 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "CapEff:\t%016x\n", creds.EffectiveCaps)
 	fmt.Fprintf(buf, "CapBnd:\t%016x\n", creds.BoundingCaps)
 	fmt.Fprintf(buf, "Seccomp:\t%d\n", s.task.SeccompMode())
-	// We unconditionally report a single NUMA node. See
+	// Tasks may use all NUMA nodes. See
 	// pkg/sentry/syscalls/linux/sys_mempolicy.go.
-	fmt.Fprintf(buf, "Mems_allowed:\t1\n")
-	fmt.Fprintf(buf, "Mems_allowed_list:\t0\n")
+	topo := s.task.Kernel().CPUTopology()
+	fmt.Fprintf(buf, "Mems_allowed:\t%s\n", formatNodemask(topo.NodeMask(), topo.NUMANodes))
+	if topo.NUMANodes == 1 {
+		fmt.Fprintf(buf, "Mems_allowed_list:\t0\n")
+	} else {
+		fmt.Fprintf(buf, "Mems_allowed_list:\t0-%d\n", topo.NUMANodes-1)
+	}
 	return nil
 }
 
+// formatNodemask formats a mask of nodes NUMA nodes as Linux's "%*pb" format
+// specifier does: in hexadecimal, in comma-separated groups of 32 bits.
+func formatNodemask(mask uint64, nodes uint) string {
+	if nodes <= 32 {
+		return fmt.Sprintf("%0*x", (nodes+3)/4, mask)
+	}
+	return fmt.Sprintf("%0*x,%08x", (nodes-32+3)/4, mask>>32, uint32(mask))
+}
+
 // ioUsage is the /proc/[pid]/io and /proc/[pid]/task/[tid]/io data provider.
 type ioUsage interface {
 	// IOUsage returns the io usage data.
@@ -1234,6 +1605,10 @@ type namespaceSymlink struct {
 
 	task   *kernel.Task
 	nsType int
+
+	// children is true if the symlink refers to the namespace that children
+	// of the task will be created in, rather than the task's own.
+	children bool
 }
 
 func (fs *filesystem) newNamespaceSymlink(ctx context.Context, task *kernel.Task, ino uint64, nsType int) kernfs.Inode {
@@ -1246,6 +1621,16 @@ func (fs *filesystem) newNamespaceSymlink(ctx context.Context, task *kernel.Task
 	return taskInode
 }
 
+func (fs *filesystem) newChildNamespaceSymlink(ctx context.Context, task *kernel.Task, ino uint64, nsType int) kernfs.Inode {
+	inode := &namespaceSymlink{task: task, nsType: nsType, children: true}
+
+	// Note: credentials are overridden by taskOwnedInode.
+	inode.Init(ctx, task.Credentials(), linux.UNNAMED_MAJOR, fs.devMinor, ino, "")
+
+	taskInode := &taskOwnedInode{Inode: inode, owner: task}
+	return taskInode
+}
+
 func (fs *filesystem) newPIDNamespaceSymlink(ctx context.Context, task *kernel.Task, ino uint64) kernfs.Inode {
 	target := fmt.Sprintf("pid:[%d]", task.PIDNamespace().ID())
 
@@ -1289,6 +1674,17 @@ func (s *namespaceSymlink) getInode(t *kernel.Task) *nsfs.Inode {
 			return utsns.GetInode()
 		}
 		return nil
+	case linux.CLONE_NEWTIME:
+		var timens *kernel.TimeNamespace
+		if s.children {
+			timens = t.GetChildTimeNamespace()
+		} else {
+			timens = t.GetTimeNamespace()
+		}
+		if timens == nil {
+			return nil
+		}
+		return timens.GetInode()
 	case linux.CLONE_NEWNS:
 		mntns := t.GetMountNamespace()
 		if mntns == nil {
@@ -21,10 +21,12 @@ import (
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/cpuid"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
@@ -64,30 +66,50 @@ type tasksInode struct {
 
 var _ kernfs.Inode = (*tasksInode)(nil)
 
-func (fs *filesystem) newTasksInode(ctx context.Context, k *kernel.Kernel, pidns *kernel.PIDNamespace, fakeCgroupControllers map[string]string) *tasksInode {
+func (fs *filesystem) newTasksInode(ctx context.Context, k *kernel.Kernel, pidns *kernel.PIDNamespace, fakeCgroupControllers map[string]string, driverFiles map[string]string) *tasksInode {
 	root := auth.NewRootCredentials(pidns.UserNamespace())
-	contents := map[string]kernfs.Inode{
-		"cmdline":        fs.newInode(ctx, root, 0444, &cmdLineData{}),
-		"cpuinfo":        fs.newInode(ctx, root, 0444, newStaticFileSetStat(cpuInfoData(k))),
-		"filesystems":    fs.newInode(ctx, root, 0444, &filesystemsData{}),
-		"loadavg":        fs.newInode(ctx, root, 0444, &loadavgData{}),
-		"sys":            fs.newSysDir(ctx, root, k),
-		"bus":            fs.newStaticDir(ctx, root, map[string]kernfs.Inode{}),
-		"fs":             fs.newStaticDir(ctx, root, map[string]kernfs.Inode{}),
-		"irq":            fs.newStaticDir(ctx, root, map[string]kernfs.Inode{}),
-		"meminfo":        fs.newInode(ctx, root, 0444, &meminfoData{}),
-		"mounts":         kernfs.NewStaticSymlink(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "self/mounts"),
-		"net":            kernfs.NewStaticSymlink(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "self/net"),
-		"sentry-meminfo": fs.newInode(ctx, root, 0444, &sentryMeminfoData{}),
-		"stat":           fs.newInode(ctx, root, 0444, &statData{}),
-		"sysrq-trigger":  fs.newInode(ctx, root, 0200, newStaticFile("")),
-		"uptime":         fs.newInode(ctx, root, 0444, &uptimeData{}),
-		"version":        fs.newInode(ctx, root, 0444, &versionData{}),
-	}
-	// If fakeCgroupControllers are provided, don't create a cgroupfs backed
-	// /proc/cgroup as it will not match the fake controllers.
-	if len(fakeCgroupControllers) == 0 {
-		contents["cgroups"] = fs.newInode(ctx, root, 0444, &cgroupsData{})
+	// With "subset=pid", only process directories and the "self" and
+	// "thread-self" symlinks are visible.
+	var contents map[string]kernfs.Inode
+	if !fs.subsetPID {
+		contents = map[string]kernfs.Inode{
+			"cmdline":     fs.newInode(ctx, root, 0444, &cmdLineData{}),
+			"cpuinfo":     fs.newInode(ctx, root, 0444, newStaticFileSetStat(cpuInfoData(k))),
+			"filesystems": fs.newInode(ctx, root, 0444, &filesystemsData{}),
+			"loadavg":     fs.newInode(ctx, root, 0444, &loadavgData{}),
+			"sys":         fs.newSysDir(ctx, root, k),
+			"bus":         fs.newStaticDir(ctx, root, map[string]kernfs.Inode{}),
+			"fs":          fs.newStaticDir(ctx, root, map[string]kernfs.Inode{}),
+			"irq":         fs.newStaticDir(ctx, root, map[string]kernfs.Inode{}),
+			"meminfo":     fs.newInode(ctx, root, 0444, &meminfoData{}),
+			"mounts":      kernfs.NewStaticSymlink(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "self/mounts"),
+			"net":         kernfs.NewStaticSymlink(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "self/net"),
+			"pressure": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+				"cpu":    fs.newInode(ctx, root, 0444, &pressureData{res: kernel.PressureCPU}),
+				"io":     fs.newInode(ctx, root, 0444, &pressureData{res: kernel.PressureIO}),
+				"memory": fs.newInode(ctx, root, 0444, &pressureData{res: kernel.PressureMemory}),
+			}),
+			"sentry-meminfo": fs.newInode(ctx, root, 0444, &sentryMeminfoData{}),
+			"stat":           fs.newInode(ctx, root, 0444, &statData{}),
+			"sysrq-trigger":  fs.newInode(ctx, root, 0200, newStaticFile("")),
+			"uptime":         fs.newInode(ctx, root, 0444, &uptimeData{}),
+			"version":        fs.newInode(ctx, root, 0444, &versionData{}),
+		}
+		// If fakeCgroupControllers are provided, don't create a cgroupfs backed
+		// /proc/cgroup as it will not match the fake controllers.
+		if len(fakeCgroupControllers) == 0 {
+			contents["cgroups"] = fs.newInode(ctx, root, 0444, &cgroupsData{})
+		}
+		driverInodes := make(map[string]kernfs.Inode, len(driverFiles)+1)
+		for path, data := range driverFiles {
+			driverInodes[path] = fs.newInode(ctx, root, 0444, newStaticFile(data))
+		}
+		if usage.GPUMemoryAccounting.Enabled() {
+			driverInodes["nvidia/memory_usage"] = fs.newInode(ctx, root, 0444, &gpuMemoryUsageData{})
+		}
+		if len(driverInodes) != 0 {
+			contents["driver"] = fs.newStaticDir(ctx, root, fs.newStaticTree(ctx, root, driverInodes))
+		}
 	}
 
 	inode := &tasksInode{
@@ -264,9 +286,15 @@ func newStaticFileSetStat(data string) *staticFileSetStat {
 
 func cpuInfoData(k *kernel.Kernel) string {
 	features := k.FeatureSet()
+	topo := k.CPUTopology()
 	var buf bytes.Buffer
 	for i, max := uint(0), k.ApplicationCores(); i < max; i++ {
-		features.WriteCPUInfoTo(i, &buf)
+		features.WriteCPUInfoTo(i, cpuid.CPUInfoTopology{
+			PhysicalID: topo.SocketID(i),
+			Siblings:   topo.ThreadsPerCore * topo.CoresPerSocket,
+			CoreID:     topo.CoreID(i),
+			CPUCores:   topo.CoresPerSocket,
+		}, &buf)
 	}
 	return buf.String()
 }
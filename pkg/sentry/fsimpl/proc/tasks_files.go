@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"runtime"
+	"sort"
 	"strconv"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -271,7 +272,8 @@ func (*meminfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	_ = mf.UpdateUsage(0) // Best effort
 	snapshot, totalUsage := usage.MemoryAccounting.Copy()
 	totalSize := usage.TotalMemory(mf.TotalSize(), totalUsage)
-	anon := snapshot.Anonymous + snapshot.Tmpfs
+	shmem := snapshot.Tmpfs + snapshot.Shmem
+	anon := snapshot.Anonymous + snapshot.Stack + shmem
 	file := snapshot.PageCache + snapshot.Mapped
 	// We don't actually have active/inactive LRUs, so just make up numbers.
 	activeFile := (file / 2) &^ (hostarch.PageSize - 1)
@@ -289,7 +291,7 @@ func (*meminfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "MemFree:        %8d kB\n", memFree/1024)
 	fmt.Fprintf(buf, "MemAvailable:   %8d kB\n", memFree/1024)
 	fmt.Fprintf(buf, "Buffers:               0 kB\n") // memory usage by block devices
-	fmt.Fprintf(buf, "Cached:         %8d kB\n", (file+snapshot.Tmpfs)/1024)
+	fmt.Fprintf(buf, "Cached:         %8d kB\n", (file+shmem)/1024)
 	// Emulate a system with no swap, which disables inactivation of anon pages.
 	fmt.Fprintf(buf, "SwapCache:             0 kB\n")
 	fmt.Fprintf(buf, "Active:         %8d kB\n", (anon+activeFile)/1024)
@@ -306,7 +308,7 @@ func (*meminfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "Writeback:             0 kB\n")
 	fmt.Fprintf(buf, "AnonPages:      %8d kB\n", anon/1024)
 	fmt.Fprintf(buf, "Mapped:         %8d kB\n", file/1024) // doesn't count mapped tmpfs, which we don't know
-	fmt.Fprintf(buf, "Shmem:          %8d kB\n", snapshot.Tmpfs/1024)
+	fmt.Fprintf(buf, "Shmem:          %8d kB\n", shmem/1024)
 	return nil
 }
 
@@ -324,8 +326,15 @@ func (*uptimeData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	k := kernel.KernelFromContext(ctx)
 	now := time.NowFromContext(ctx)
 
+	uptime := now.Sub(k.Timekeeper().BootTime())
+	// Uptime is CLOCK_BOOTTIME, which is offset in non-root time namespaces.
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		_, boottime := t.TimeNamespace().Offsets()
+		uptime += boottime
+	}
+
 	// Pretend that we've spent zero time sleeping (second number).
-	fmt.Fprintf(buf, "%.2f 0.00\n", now.Sub(k.Timekeeper().BootTime()).Seconds())
+	fmt.Fprintf(buf, "%.2f 0.00\n", uptime.Seconds())
 	return nil
 }
 
@@ -449,3 +458,61 @@ func (*sentryMeminfoData) Generate(ctx context.Context, buf *bytes.Buffer) error
 	fmt.Fprintf(buf, "HeapObjects:    %8d\n", sentryMeminfo.HeapObjects)
 	return nil
 }
+
+// gpuMemoryUsageData implements vfs.DynamicBytesSource for
+// /proc/driver/nvidia/memory_usage.
+//
+// +stateify savable
+type gpuMemoryUsageData struct {
+	dynamicBytesFileSetAttr
+}
+
+var _ dynamicInode = (*gpuMemoryUsageData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*gpuMemoryUsageData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	stats := usage.GPUMemoryAccounting.Copy()
+	fmt.Fprintf(buf, "Total:          %8d kB\n", stats.Total/1024)
+	for _, device := range sortedGPUMemoryKeys(stats.Devices) {
+		fmt.Fprintf(buf, "Device %-8d %8d kB\n", device, stats.Devices[device]/1024)
+	}
+	for _, client := range sortedGPUMemoryKeys(stats.Clients) {
+		fmt.Fprintf(buf, "Client %#-8x %8d kB\n", client, stats.Clients[client]/1024)
+	}
+	return nil
+}
+
+// sortedGPUMemoryKeys returns the keys of m in increasing order.
+func sortedGPUMemoryKeys(m map[uint32]uint64) []uint32 {
+	keys := make([]uint32, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// pressureData implements vfs.DynamicBytesSource for /proc/pressure/{cpu,io,
+// memory}.
+//
+// +stateify savable
+type pressureData struct {
+	dynamicBytesFileSetAttr
+
+	res kernel.PressureResource
+}
+
+var _ dynamicInode = (*pressureData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *pressureData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	some, full := kernel.KernelFromContext(ctx).Pressure(d.res)
+	// See kernel/sched/psi.c:psi_show(). Totals are in microseconds.
+	for _, s := range []struct {
+		name  string
+		stall kernel.PressureStall
+	}{{"some", some}, {"full", full}} {
+		fmt.Fprintf(buf, "%s avg10=%.2f avg60=%.2f avg300=%.2f total=%d\n", s.name, s.stall.Avg10, s.stall.Avg60, s.stall.Avg300, s.stall.Total.Microseconds())
+	}
+	return nil
+}
@@ -46,11 +46,14 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 	return fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 		"kernel": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 			"cap_last_cap": fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\n", linux.CAP_LAST_CAP))),
-			"hostname":     fs.newInode(ctx, root, 0444, &hostnameData{}),
+			"core_pattern": fs.newInode(ctx, root, 0644, &corePatternData{k: k}),
+			"hostname":     fs.newInode(ctx, root, 0644, &hostnameData{}),
+			"pid_max":      fs.newInode(ctx, root, 0644, &pidMaxData{k: k}),
 			"sem":          fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\t%d\t%d\t%d\n", linux.SEMMSL, linux.SEMMNS, linux.SEMOPM, linux.SEMMNI))),
 			"shmall":       fs.newInode(ctx, root, 0444, ipcData(linux.SHMALL)),
 			"shmmax":       fs.newInode(ctx, root, 0444, ipcData(linux.SHMMAX)),
 			"shmmni":       fs.newInode(ctx, root, 0444, ipcData(linux.SHMMNI)),
+			"threads-max":  fs.newInode(ctx, root, 0644, &threadsMaxData{k: k}),
 			"msgmni":       fs.newInode(ctx, root, 0444, ipcData(linux.MSGMNI)),
 			"msgmax":       fs.newInode(ctx, root, 0444, ipcData(linux.MSGMAX)),
 			"msgmnb":       fs.newInode(ctx, root, 0444, ipcData(linux.MSGMNB)),
@@ -58,6 +61,9 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 				"ptrace_scope": fs.newYAMAPtraceScopeFile(ctx, k, root),
 			}),
 		}),
+		"fs": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"binfmt_misc": fs.newBinfmtMiscDir(ctx, root, k),
+		}),
 		"vm": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 			"max_map_count":     fs.newInode(ctx, root, 0444, newStaticFile("2147483647\n")),
 			"mmap_min_addr":     fs.newInode(ctx, root, 0444, &mmapMinAddrData{k: k}),
@@ -123,6 +129,17 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"tcp_syn_retries":           fs.newInode(ctx, root, 0444, newStaticFile("3")),
 				"tcp_timestamps":            fs.newInode(ctx, root, 0444, newStaticFile("1")),
 			}),
+			"ipv6": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+				"conf": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+					"all": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+						"seg6_enabled": fs.newInode(ctx, root, 0644, &seg6EnabledData{stack: stack}),
+					}),
+				}),
+				"max_dst_opts_length": fs.newInode(ctx, root, 0644, &ipv6ExtHdrLimitData{stack: stack, limit: maxDstOptsLength}),
+				"max_dst_opts_number": fs.newInode(ctx, root, 0644, &ipv6ExtHdrLimitData{stack: stack, limit: maxDstOptsNumber}),
+				"max_hbh_length":      fs.newInode(ctx, root, 0644, &ipv6ExtHdrLimitData{stack: stack, limit: maxHBHLength}),
+				"max_hbh_opts_number": fs.newInode(ctx, root, 0644, &ipv6ExtHdrLimitData{stack: stack, limit: maxHBHOptsNumber}),
+			}),
 			"core": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 				"default_qdisc": fs.newInode(ctx, root, 0444, newStaticFile("pfifo_fast")),
 				"message_burst": fs.newInode(ctx, root, 0444, newStaticFile("10")),
@@ -158,14 +175,16 @@ func (d *mmapMinAddrData) Generate(ctx context.Context, buf *bytes.Buffer) error
 	return nil
 }
 
-// hostnameData implements vfs.DynamicBytesSource for /proc/sys/kernel/hostname.
+// hostnameData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/kernel/hostname, which is the hostname of the caller's UTS
+// namespace.
 //
 // +stateify savable
 type hostnameData struct {
 	kernfs.DynamicBytesFile
 }
 
-var _ dynamicInode = (*hostnameData)(nil)
+var _ vfs.WritableDynamicBytesSource = (*hostnameData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (*hostnameData) Generate(ctx context.Context, buf *bytes.Buffer) error {
@@ -176,6 +195,203 @@ func (*hostnameData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (*hostnameData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	utsns := kernel.UTSNamespaceFromContext(ctx)
+	defer utsns.DecRef(ctx)
+	// Same as sethostname(2).
+	if !auth.CredentialsFromContext(ctx).HasCapabilityIn(linux.CAP_SYS_ADMIN, utsns.UserNamespace()) {
+		return 0, linuxerr.EPERM
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	// As in Linux's proc_dostring(), the hostname ends at the first newline
+	// or NUL, and is silently truncated.
+	name := buf[:n]
+	if i := bytes.IndexAny(name, "\n\x00"); i >= 0 {
+		name = name[:i]
+	}
+	if len(name) > linux.UTSLen {
+		name = name[:linux.UTSLen]
+	}
+	utsns.SetHostName(string(name))
+	return int64(n), nil
+}
+
+// pidMaxData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/kernel/pid_max, which is the limit of PIDs allocated in the
+// caller's PID namespace.
+//
+// +stateify savable
+type pidMaxData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*pidMaxData)(nil)
+
+// pidNamespace returns the PID namespace of the caller.
+func (d *pidMaxData) pidNamespace(ctx context.Context) *kernel.PIDNamespace {
+	if pidns := kernel.PIDNamespaceFromContext(ctx); pidns != nil {
+		return pidns
+	}
+	return d.k.RootPIDNamespace()
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *pidMaxData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	_, err := fmt.Fprintf(buf, "%d\n", d.pidNamespace(ctx).PIDMax())
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *pidMaxData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	pidns := d.pidNamespace(ctx)
+	if !auth.CredentialsFromContext(ctx).HasCapabilityIn(linux.CAP_SYS_ADMIN, pidns.UserNamespace()) {
+		return 0, linuxerr.EPERM
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := pidns.SetPIDMax(kernel.ThreadID(v)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// threadsMaxData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/kernel/threads-max, which is the limit of tasks in the sandbox.
+//
+// +stateify savable
+type threadsMaxData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*threadsMaxData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *threadsMaxData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	_, err := fmt.Fprintf(buf, "%d\n", d.k.TaskSet().ThreadsMax())
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *threadsMaxData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	// The limit is global, so it can only be changed from the root user
+	// namespace.
+	if !auth.CredentialsFromContext(ctx).HasCapabilityIn(linux.CAP_SYS_ADMIN, d.k.RootUserNamespace()) {
+		return 0, linuxerr.EPERM
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.k.TaskSet().SetThreadsMax(int(v)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// corePatternMaxLen is the maximum length of /proc/sys/kernel/core_pattern,
+// as in Linux's CORENAME_MAX_SIZE.
+const corePatternMaxLen = 127
+
+// corePatternData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/kernel/core_pattern, which is the template used to name core
+// dump files.
+//
+// +stateify savable
+type corePatternData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*corePatternData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *corePatternData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString(d.k.CorePattern())
+	buf.WriteString("\n")
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *corePatternData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	// The pattern is global, so it can only be changed from the root user
+	// namespace.
+	if !auth.CredentialsFromContext(ctx).HasCapabilityIn(linux.CAP_SYS_ADMIN, d.k.RootUserNamespace()) {
+		return 0, linuxerr.EPERM
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	// As in Linux's proc_dostring(), the pattern ends at the first newline
+	// or NUL, and is silently truncated.
+	pattern := buf[:n]
+	if i := bytes.IndexAny(pattern, "\n\x00"); i >= 0 {
+		pattern = pattern[:i]
+	}
+	if len(pattern) > corePatternMaxLen {
+		pattern = pattern[:corePatternMaxLen]
+	}
+	d.k.SetCorePattern(string(pattern))
+	return int64(n), nil
+}
+
 // tcpSackData implements vfs.WritableDynamicBytesSource for
 // /proc/sys/net/tcp_sack.
 //
@@ -370,6 +586,144 @@ func (d *tcpMemData) writeSizeLocked(size inet.TCPBufferSize) error {
 	}
 }
 
+// seg6EnabledData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv6/conf/all/seg6_enabled.
+//
+// +stateify savable
+type seg6EnabledData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*seg6EnabledData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *seg6EnabledData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	enabled, err := d.stack.IPv6SegmentRoutingEnabled()
+	if err != nil {
+		return err
+	}
+	val := "0\n"
+	if enabled {
+		val = "1\n"
+	}
+	_, err = buf.WriteString(val)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *seg6EnabledData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.stack.SetIPv6SegmentRoutingEnabled(v != 0); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ipv6ExtHdrLimit identifies one of the IPv6 extension header limits.
+type ipv6ExtHdrLimit int
+
+const (
+	maxHBHOptsNumber ipv6ExtHdrLimit = iota
+	maxHBHLength
+	maxDstOptsNumber
+	maxDstOptsLength
+)
+
+// ipv6ExtHdrLimitData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv6/max_{hbh,dst}_opts_number and
+// /proc/sys/net/ipv6/max_{hbh,dst_opts}_length.
+//
+// +stateify savable
+type ipv6ExtHdrLimitData struct {
+	kernfs.DynamicBytesFile
+
+	limit ipv6ExtHdrLimit
+	stack inet.Stack `state:"wait"`
+
+	// mu protects against concurrent reads/writes to FDs based on the dentry
+	// backing this byte source.
+	mu sync.Mutex `state:"nosave"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*ipv6ExtHdrLimitData)(nil)
+
+// field returns a pointer to the limit d represents in limits.
+func (d *ipv6ExtHdrLimitData) field(limits *inet.IPv6ExtensionHeaderLimits) *int32 {
+	switch d.limit {
+	case maxHBHOptsNumber:
+		return &limits.MaxHopByHopOptions
+	case maxHBHLength:
+		return &limits.MaxHopByHopLength
+	case maxDstOptsNumber:
+		return &limits.MaxDestinationOptions
+	case maxDstOptsLength:
+		return &limits.MaxDestinationLength
+	default:
+		panic(fmt.Sprintf("unknown ipv6ExtHdrLimit: %v", d.limit))
+	}
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *ipv6ExtHdrLimitData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	limits, err := d.stack.IPv6ExtensionHeaderLimits()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(buf, "%d\n", *d.field(&limits))
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *ipv6ExtHdrLimitData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	limits, err := d.stack.IPv6ExtensionHeaderLimits()
+	if err != nil {
+		return 0, err
+	}
+	*d.field(&limits) = v
+	if err := d.stack.SetIPv6ExtensionHeaderLimits(limits); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // ipForwarding implements vfs.WritableDynamicBytesSource for
 // /proc/sys/net/ipv4/ip_forward.
 //
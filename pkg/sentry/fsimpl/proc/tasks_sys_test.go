@@ -147,3 +147,87 @@ func TestConfigureIPForwarding(t *testing.T) {
 		})
 	}
 }
+
+// TestConfigureIPv6ExtHdrLimits tests the implementation of
+// /proc/sys/net/ipv6/max_{hbh,dst}_opts_number and
+// /proc/sys/net/ipv6/max_{hbh,dst_opts}_length.
+func TestConfigureIPv6ExtHdrLimits(t *testing.T) {
+	ctx := context.Background()
+	initial := inet.IPv6ExtensionHeaderLimits{
+		MaxHopByHopOptions:    8,
+		MaxHopByHopLength:     100,
+		MaxDestinationOptions: 8,
+		MaxDestinationLength:  200,
+	}
+
+	var cases = []struct {
+		comment string
+		limit   ipv6ExtHdrLimit
+		str     string
+		final   inet.IPv6ExtensionHeaderLimits
+	}{
+		{
+			comment: `Write 2 to max_hbh_opts_number`,
+			limit:   maxHBHOptsNumber,
+			str:     "2",
+			final: inet.IPv6ExtensionHeaderLimits{
+				MaxHopByHopOptions:    2,
+				MaxHopByHopLength:     100,
+				MaxDestinationOptions: 8,
+				MaxDestinationLength:  200,
+			},
+		},
+		{
+			comment: `Write 64 to max_hbh_length`,
+			limit:   maxHBHLength,
+			str:     "64",
+			final: inet.IPv6ExtensionHeaderLimits{
+				MaxHopByHopOptions:    8,
+				MaxHopByHopLength:     64,
+				MaxDestinationOptions: 8,
+				MaxDestinationLength:  200,
+			},
+		},
+		{
+			comment: `Write -4 to max_dst_opts_number`,
+			limit:   maxDstOptsNumber,
+			str:     "-4",
+			final: inet.IPv6ExtensionHeaderLimits{
+				MaxHopByHopOptions:    8,
+				MaxHopByHopLength:     100,
+				MaxDestinationOptions: -4,
+				MaxDestinationLength:  200,
+			},
+		},
+		{
+			comment: `Write 16 to max_dst_opts_length`,
+			limit:   maxDstOptsLength,
+			str:     "16",
+			final: inet.IPv6ExtensionHeaderLimits{
+				MaxHopByHopOptions:    8,
+				MaxHopByHopLength:     100,
+				MaxDestinationOptions: 8,
+				MaxDestinationLength:  16,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.comment, func(t *testing.T) {
+			s := inet.NewTestStack()
+			s.ExtHdrLimits = initial
+
+			file := &ipv6ExtHdrLimitData{stack: s, limit: c.limit}
+
+			// Write the values.
+			src := usermem.BytesIOSequence([]byte(c.str))
+			if n, err := file.Write(ctx, nil, src, 0); n != int64(len(c.str)) || err != nil {
+				t.Errorf("file.Write(ctx, nil, %q, 0) = (%d, %v); want (%d, nil)", c.str, n, err, len(c.str))
+			}
+
+			// Read the values from the stack and check them.
+			if got, want := s.ExtHdrLimits, c.final; got != want {
+				t.Errorf("s.ExtHdrLimits incorrect; got: %+v, want: %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secretmem implements the files returned by memfd_secret(2).
+//
+// Secret memory is backed by a host file, so that application mappings of it
+// are host mappings of that file. Unless the platform owns the application's
+// page tables, the sentry never maps secret memory into its own address
+// space: sentry accesses to it, e.g. read(2) into a buffer in secret memory,
+// fail with EFAULT as they do on Linux. In that case the host file is created
+// with memfd_secret(2) if the host supports it, which also removes its pages
+// from the host kernel's direct map.
+//
+// Platforms that own page tables (e.g. KVM) access application memory through
+// the sentry's address space, so on them secret memory is ordinary memory.
+//
+// Secret memory is not part of the MemoryFile, so it's accounted separately,
+// and the kernel can't be saved while secret memory files are open.
+package secretmem
+
+import (
+	"io"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// secretFD implements vfs.FileDescriptionImpl and memmap.Mappable for secret
+// memory files.
+//
+// +stateify savable
+type secretFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.NoLockFD
+
+	// hostFD is the host file backing the secret memory. It is owned by
+	// secretFD, and is immutable.
+	hostFD int
+
+	// sentryAccess is true if the sentry may map the file into its own
+	// address space. It is immutable.
+	sentryAccess bool
+
+	// uid and gid are the file's owner. They are immutable.
+	uid auth.KUID
+	gid auth.KGID
+
+	// k is the kernel that the file was created in. It is immutable.
+	k *kernel.Kernel
+
+	// memCgID is the memory cgroup that the file's memory is charged to. It
+	// is immutable.
+	memCgID uint32
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// size is the size of the file. Like Linux, we only allow it to be set
+	// once, so it never shrinks. Since mappings of the file are locked
+	// eagerly, all of it is accounted as used.
+	size uint64
+
+	// mappings tracks mappings of the file into memmap.MappingSpaces.
+	mappings memmap.MappingSet
+
+	// memmapFile implements memmap.File for hostFD.
+	memmapFile secretFile
+}
+
+var _ vfs.FileDescriptionImpl = (*secretFD)(nil)
+var _ memmap.Mappable = (*secretFD)(nil)
+
+// New returns a new secret memory file, as for memfd_secret(2). sentryAccess
+// must be true if the platform needs to map application memory into the
+// sentry's address space.
+func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, sentryAccess bool, flags uint32) (*vfs.FileDescription, error) {
+	hostFD, err := newHostFile(!sentryAccess)
+	if err != nil {
+		return nil, err
+	}
+	vd := vfsObj.NewAnonVirtualDentry("[secretmem]")
+	defer vd.DecRef(ctx)
+	creds := auth.CredentialsFromContext(ctx)
+	fd := &secretFD{
+		hostFD:       hostFD,
+		sentryAccess: sentryAccess,
+		uid:          creds.EffectiveKUID,
+		gid:          creds.EffectiveKGID,
+		k:            kernel.KernelFromContext(ctx),
+		memCgID:      pgalloc.MemoryCgroupIDFromContext(ctx),
+	}
+	fd.memmapFile.fd = fd
+	fd.memmapFile.fileMapper.Init()
+	if err := fd.vfsfd.Init(fd, linux.O_RDWR|flags, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		DenyPRead:    true,
+		DenyPWrite:   true,
+		DenySpliceIn: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	fd.k.SecretMemFileOpened()
+	return &fd.vfsfd, nil
+}
+
+// newHostFile returns a new host file to back secret memory. If secret is
+// true, it tries to create the file with memfd_secret(2) first.
+func newHostFile(secret bool) (int, error) {
+	if secret {
+		fd, _, errno := unix.RawSyscall(unix.SYS_MEMFD_SECRET, unix.O_CLOEXEC, 0, 0)
+		if errno == 0 {
+			return int(fd), nil
+		}
+		// memfd_secret(2) fails with ENOSYS if the host kernel was built
+		// without it or booted with secretmem.enable=0, and container
+		// runtimes' seccomp profiles commonly deny it. The sentry still does
+		// not map the file, so fall back to an ordinary memfd.
+		log.Infof("Host memfd_secret failed, falling back to memfd_create: %v", errno)
+	}
+	return unix.MemfdCreate("secretmem", unix.MFD_CLOEXEC)
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *secretFD) Release(context.Context) {
+	if fd.size != 0 {
+		usage.MemoryAccounting.Dec(fd.pageRoundedSize(), usage.Anonymous, fd.memCgID)
+	}
+	unix.Close(fd.hostFD)
+	fd.k.SecretMemFileReleased()
+}
+
+// pageRoundedSize returns fd.size rounded up to a page boundary.
+func (fd *secretFD) pageRoundedSize() uint64 {
+	size, _ := hostarch.PageRoundUp(fd.size)
+	return size
+}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *secretFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	fd.mu.Lock()
+	size := fd.size
+	fd.mu.Unlock()
+	// Compare Linux's mm/secretmem.c:secretmem_file_create().
+	return linux.Statx{
+		Mask:    linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_NLINK | linux.STATX_UID | linux.STATX_GID | linux.STATX_SIZE,
+		Blksize: hostarch.PageSize,
+		Nlink:   1,
+		UID:     uint32(fd.uid),
+		GID:     uint32(fd.gid),
+		Mode:    linux.S_IFREG | 0600,
+		Size:    size,
+	}, nil
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *secretFD) SetStat(ctx context.Context, opts vfs.SetStatOptions) error {
+	// As for anonfs, changes to metadata other than the size are silently
+	// ignored.
+	if opts.Stat.Mask&linux.STATX_SIZE == 0 {
+		return nil
+	}
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	// Compare Linux's mm/secretmem.c:secretmem_setattr().
+	if fd.size != 0 {
+		return linuxerr.EINVAL
+	}
+	if err := unix.Ftruncate(fd.hostFD, int64(opts.Stat.Size)); err != nil {
+		return err
+	}
+	fd.size = opts.Stat.Size
+	usage.MemoryAccounting.Inc(fd.pageRoundedSize(), usage.Anonymous, fd.memCgID)
+	return nil
+}
+
+// StatFS implements vfs.FileDescriptionImpl.StatFS.
+func (fd *secretFD) StatFS(ctx context.Context) (linux.Statfs, error) {
+	return linux.Statfs{
+		Type:      linux.SECRETMEM_MAGIC,
+		BlockSize: hostarch.PageSize,
+	}, nil
+}
+
+// Allocate implements vfs.FileDescriptionImpl.Allocate.
+func (fd *secretFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
+	return linuxerr.EOPNOTSUPP
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *secretFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	// Compare Linux's mm/secretmem.c:secretmem_mmap().
+	if opts.Private {
+		return linuxerr.EINVAL
+	}
+	opts.MLockMode = memmap.MLockEager
+	return vfs.GenericConfigureMMap(&fd.vfsfd, fd, opts)
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (fd *secretFD) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	for _, r := range fd.mappings.AddMapping(ms, ar, offset, writable) {
+		fd.memmapFile.fileMapper.IncRefOn(r)
+	}
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (fd *secretFD) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	for _, r := range fd.mappings.RemoveMapping(ms, ar, offset, writable) {
+		fd.memmapFile.fileMapper.DecRefOn(r)
+	}
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (fd *secretFD) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return fd.AddMapping(ctx, ms, dstAR, offset, writable)
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (fd *secretFD) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	fd.mu.Lock()
+	size := fd.size
+	fd.mu.Unlock()
+
+	// Compare Linux's mm/secretmem.c:secretmem_fault().
+	pgend, _ := hostarch.PageRoundUp(size)
+	var beyondEOF bool
+	if required.End > pgend {
+		if required.Start >= pgend {
+			return nil, &memmap.BusError{io.EOF}
+		}
+		beyondEOF = true
+		required.End = pgend
+	}
+	if optional.End > pgend {
+		optional.End = pgend
+	}
+	ts := []memmap.Translation{
+		{
+			Source: optional,
+			File:   &fd.memmapFile,
+			Offset: optional.Start,
+			Perms:  hostarch.AnyAccess,
+		},
+	}
+	if beyondEOF {
+		return ts, &memmap.BusError{io.EOF}
+	}
+	return ts, nil
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (fd *secretFD) InvalidateUnsavable(ctx context.Context) error {
+	return nil
+}
+
+// secretFile implements memmap.File for a secret memory file.
+//
+// +stateify savable
+type secretFile struct {
+	fd *secretFD
+
+	// fileMapper caches the sentry's mappings of fd.hostFD. It is only used
+	// if fd.sentryAccess is true.
+	fileMapper fsutil.HostFileMapper
+}
+
+var _ memmap.File = (*secretFile)(nil)
+
+// IncRef implements memmap.File.IncRef.
+func (f *secretFile) IncRef(memmap.FileRange, uint32) {
+}
+
+// DecRef implements memmap.File.DecRef.
+func (f *secretFile) DecRef(memmap.FileRange) {
+}
+
+// MapInternal implements memmap.File.MapInternal.
+func (f *secretFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (safemem.BlockSeq, error) {
+	if !f.fd.sentryAccess {
+		return safemem.BlockSeq{}, linuxerr.EFAULT
+	}
+	return f.fileMapper.MapInternal(fr, f.fd.hostFD, at.Write)
+}
+
+// FD implements memmap.File.FD.
+func (f *secretFile) FD() int {
+	return f.fd.hostFD
+}
@@ -0,0 +1,224 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+)
+
+// cacheInfo describes a CPU cache, as reported in
+// /sys/devices/system/cpu/cpuN/cache/indexM.
+type cacheInfo struct {
+	level      uint32
+	typ        string
+	size       uint32
+	lineSize   uint32
+	ways       uint32
+	sets       uint32
+	partitions uint32
+}
+
+// cpuTopologyDir returns /sys/devices/system/cpu/cpuN/topology.
+func (fs *filesystem) cpuTopologyDir(ctx context.Context, creds *auth.Credentials, topo *kernel.CPUTopology, cpu uint) kernfs.Inode {
+	threadFirst, threadLast := topo.ThreadSiblings(cpu)
+	coreFirst, coreLast := topo.CoreSiblings(cpu)
+	threadList := cpuList(threadFirst, threadLast)
+	coreList := cpuList(coreFirst, coreLast)
+	threadMap := cpuMap(topo.NumCPUs(), threadFirst, threadLast)
+	coreMap := cpuMap(topo.NumCPUs(), coreFirst, coreLast)
+	return fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+		"core_cpus":            fs.newStaticFile(ctx, creds, defaultSysMode, threadMap),
+		"core_cpus_list":       fs.newStaticFile(ctx, creds, defaultSysMode, threadList),
+		"core_id":              fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", topo.CoreID(cpu))),
+		"core_siblings":        fs.newStaticFile(ctx, creds, defaultSysMode, coreMap),
+		"core_siblings_list":   fs.newStaticFile(ctx, creds, defaultSysMode, coreList),
+		"die_id":               fs.newStaticFile(ctx, creds, defaultSysMode, "0\n"),
+		"package_cpus":         fs.newStaticFile(ctx, creds, defaultSysMode, coreMap),
+		"package_cpus_list":    fs.newStaticFile(ctx, creds, defaultSysMode, coreList),
+		"physical_package_id":  fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", topo.SocketID(cpu))),
+		"thread_siblings":      fs.newStaticFile(ctx, creds, defaultSysMode, threadMap),
+		"thread_siblings_list": fs.newStaticFile(ctx, creds, defaultSysMode, threadList),
+	})
+}
+
+// cpuCacheDir returns /sys/devices/system/cpu/cpuN/cache.
+//
+// L1 and L2 caches are shared by the threads of a core, and other caches by
+// the cores of a socket.
+func (fs *filesystem) cpuCacheDir(ctx context.Context, creds *auth.Credentials, topo *kernel.CPUTopology, caches []cacheInfo, cpu uint) kernfs.Inode {
+	children := make(map[string]kernfs.Inode)
+	for i, c := range caches {
+		first, last := topo.ThreadSiblings(cpu)
+		if c.level > 2 {
+			first, last = topo.CoreSiblings(cpu)
+		}
+		children[fmt.Sprintf("index%d", i)] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"coherency_line_size":     fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.lineSize)),
+			"level":                   fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.level)),
+			"number_of_sets":          fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.sets)),
+			"physical_line_partition": fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.partitions)),
+			"shared_cpu_list":         fs.newStaticFile(ctx, creds, defaultSysMode, cpuList(first, last)),
+			"shared_cpu_map":          fs.newStaticFile(ctx, creds, defaultSysMode, cpuMap(topo.NumCPUs(), first, last)),
+			"size":                    fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%dK\n", c.size/1024)),
+			"type":                    fs.newStaticFile(ctx, creds, defaultSysMode, c.typ+"\n"),
+			"ways_of_associativity":   fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.ways)),
+		})
+	}
+	return fs.newDir(ctx, creds, defaultSysDirMode, children)
+}
+
+// nodeDir returns /sys/devices/system/node.
+func (fs *filesystem) nodeDir(ctx context.Context, creds *auth.Credentials, topo *kernel.CPUTopology) kernfs.Inode {
+	nodes := cpuList(0, topo.NUMANodes-1)
+	children := map[string]kernfs.Inode{
+		"has_cpu":           fs.newStaticFile(ctx, creds, defaultSysMode, nodes),
+		"has_memory":        fs.newStaticFile(ctx, creds, defaultSysMode, nodes),
+		"has_normal_memory": fs.newStaticFile(ctx, creds, defaultSysMode, nodes),
+		"online":            fs.newStaticFile(ctx, creds, defaultSysMode, nodes),
+		"possible":          fs.newStaticFile(ctx, creds, defaultSysMode, nodes),
+	}
+	for node := uint(0); node < topo.NUMANodes; node++ {
+		first, last := topo.NodeCPUs(node)
+		// As in Linux's default SLIT, the distance from a node to itself is
+		// 10, and to any other node 20.
+		distances := make([]string, topo.NUMANodes)
+		for i := range distances {
+			distances[i] = "20"
+		}
+		distances[node] = "10"
+		nodeChildren := map[string]kernfs.Inode{
+			"cpulist":  fs.newStaticFile(ctx, creds, defaultSysMode, cpuList(first, last)),
+			"cpumap":   fs.newStaticFile(ctx, creds, defaultSysMode, cpuMap(topo.NumCPUs(), first, last)),
+			"distance": fs.newStaticFile(ctx, creds, defaultSysMode, strings.Join(distances, " ")+"\n"),
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			nodeChildren[fmt.Sprintf("cpu%d", cpu)] = kernfs.NewStaticSymlink(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), fmt.Sprintf("../../cpu/cpu%d", cpu))
+		}
+		children[fmt.Sprintf("node%d", node)] = fs.newDir(ctx, creds, defaultSysDirMode, nodeChildren)
+	}
+	return fs.newDir(ctx, creds, defaultSysDirMode, children)
+}
+
+// onlineCPUsFile implements kernfs.Inode for /sys/devices/system/cpu/online.
+//
+// +stateify savable
+type onlineCPUsFile struct {
+	implStatFS
+	kernfs.DynamicBytesFile
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*onlineCPUsFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString(cpuSetList(kernel.KernelFromContext(ctx).OnlineCPUs()))
+	return nil
+}
+
+func (fs *filesystem) newOnlineCPUsFile(ctx context.Context, creds *auth.Credentials) kernfs.Inode {
+	f := &onlineCPUsFile{}
+	f.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), f, defaultSysMode)
+	return f
+}
+
+// cpuOnlineFile implements kernfs.Inode for
+// /sys/devices/system/cpu/cpuN/online.
+//
+// +stateify savable
+type cpuOnlineFile struct {
+	implStatFS
+	kernfs.DynamicBytesFile
+
+	cpu uint
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (f *cpuOnlineFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if kernel.KernelFromContext(ctx).OnlineCPUs().IsSet(f.cpu) {
+		buf.WriteString("1\n")
+	} else {
+		buf.WriteString("0\n")
+	}
+	return nil
+}
+
+func (fs *filesystem) newCPUOnlineFile(ctx context.Context, creds *auth.Credentials, cpu uint) kernfs.Inode {
+	f := &cpuOnlineFile{cpu: cpu}
+	f.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), f, defaultSysMode)
+	return f
+}
+
+// cpuSetList returns the CPUs in set in the list format used by sysfs, e.g.
+// "0-3,6".
+func cpuSetList(set sched.CPUSet) string {
+	var ranges []string
+	addRange := func(first, last uint) {
+		ranges = append(ranges, strings.TrimSuffix(cpuList(first, last), "\n"))
+	}
+	var first, last uint
+	inRange := false
+	set.ForEachCPU(func(cpu uint) {
+		if inRange && cpu == last+1 {
+			last = cpu
+			return
+		}
+		if inRange {
+			addRange(first, last)
+		}
+		first, last, inRange = cpu, cpu, true
+	})
+	if inRange {
+		addRange(first, last)
+	}
+	return strings.Join(ranges, ",") + "\n"
+}
+
+// cpuList returns the range of CPUs or nodes [first, last] in the list format
+// used by sysfs, e.g. "0-3".
+func cpuList(first, last uint) string {
+	if first == last {
+		return fmt.Sprintf("%d\n", first)
+	}
+	return fmt.Sprintf("%d-%d\n", first, last)
+}
+
+// cpuMap returns the range of CPUs [first, last] out of numCPUs in the bitmap
+// format used by sysfs, e.g. "0000000f". As in Linux's bitmap_print_to_pagebuf,
+// the bitmap is printed in 32-bit words, most significant first, and the first
+// word is only as wide as needed for numCPUs bits.
+func cpuMap(numCPUs, first, last uint) string {
+	var words []string
+	for lo := uint(0); lo < numCPUs; lo += 32 {
+		var word uint32
+		for cpu := lo; cpu < lo+32 && cpu <= last; cpu++ {
+			if cpu >= first {
+				word |= 1 << (cpu - lo)
+			}
+		}
+		width := 8
+		if bits := numCPUs - lo; bits < 32 {
+			width = int(bits+3) / 4
+		}
+		words = append([]string{fmt.Sprintf("%0*x", width, word)}, words...)
+	}
+	return strings.Join(words, ",") + "\n"
+}
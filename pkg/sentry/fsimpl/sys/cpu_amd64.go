@@ -0,0 +1,49 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64
+// +build amd64
+
+package sys
+
+import (
+	"gvisor.dev/gvisor/pkg/cpuid"
+)
+
+// cpuCaches returns the caches described by fs.
+func cpuCaches(fs cpuid.FeatureSet) []cacheInfo {
+	var caches []cacheInfo
+	for _, c := range fs.Caches() {
+		info := cacheInfo{
+			level:      c.Level,
+			lineSize:   fs.CacheLine(),
+			ways:       c.Ways,
+			sets:       c.Sets,
+			partitions: c.Partitions,
+		}
+		switch c.Type {
+		case cpuid.CacheData:
+			info.typ = "Data"
+		case cpuid.CacheInstruction:
+			info.typ = "Instruction"
+		case cpuid.CacheUnified:
+			info.typ = "Unified"
+		default:
+			continue
+		}
+		info.size = info.lineSize * info.ways * info.sets * info.partitions
+		caches = append(caches, info)
+	}
+	return caches
+}
@@ -0,0 +1,28 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build arm64
+// +build arm64
+
+package sys
+
+import (
+	"gvisor.dev/gvisor/pkg/cpuid"
+)
+
+// cpuCaches returns the caches described by fs. Caches are not reported on
+// arm64.
+func cpuCaches(cpuid.FeatureSet) []cacheInfo {
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"path"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// infinibandClasses are the device classes from which rdma-core's libibverbs
+// discovers RDMA devices and their uverbs devices.
+var infinibandClasses = []string{"infiniband", "infiniband_verbs"}
+
+// addInfinibandClassDirs adds the contents of the host's infiniband device
+// classes to classSub. Classes that do not exist on the host are skipped.
+func (fs *filesystem) addInfinibandClassDirs(ctx context.Context, creds *auth.Credentials, classSub map[string]kernfs.Inode) error {
+	for _, class := range infinibandClasses {
+		sub, err := fs.mirrorHostDir(ctx, creds, path.Join("/sys/class", class))
+		if err == unix.ENOENT {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		classSub[class] = fs.newDir(ctx, creds, defaultSysDirMode, sub)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"path"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// kfdDevicePath is the sysfs directory of the amdkfd device.
+const kfdDevicePath = "/sys/devices/virtual/kfd/kfd"
+
+// newKFDDir returns the contents of devices/virtual/kfd/kfd. It mirrors the
+// host's KFD topology, from which ROCm discovers GPUs, their properties and
+// the render nodes used to access them.
+func (fs *filesystem) newKFDDir(ctx context.Context, creds *auth.Credentials) (map[string]kernfs.Inode, error) {
+	topologySub, err := fs.mirrorHostDir(ctx, creds, path.Join(kfdDevicePath, "topology"))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]kernfs.Inode{
+		"topology": fs.newDir(ctx, creds, defaultSysDirMode, topologySub),
+	}, nil
+}
+
+// mirrorHostDir recursively mirrors the directories and regular files in the
+// host directory dir. Symlinks and other file types are omitted.
+func (fs *filesystem) mirrorHostDir(ctx context.Context, creds *auth.Credentials, dir string) (map[string]kernfs.Inode, error) {
+	subs := map[string]kernfs.Inode{}
+	dents, err := hostDirEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dent := range dents {
+		if dent == "." || dent == ".." {
+			continue
+		}
+		dentPath := path.Join(dir, dent)
+		dentMode, err := hostFileMode(dentPath)
+		if err != nil {
+			return nil, err
+		}
+		switch dentMode {
+		case unix.S_IFDIR:
+			contents, err := fs.mirrorHostDir(ctx, creds, dentPath)
+			if err != nil {
+				return nil, err
+			}
+			subs[dent] = fs.newDir(ctx, creds, defaultSysDirMode, contents)
+		case unix.S_IFREG:
+			subs[dent] = fs.newHostFile(ctx, creds, defaultSysMode, dentPath)
+		}
+	}
+	return subs, nil
+}
@@ -138,6 +138,7 @@ func hostFileMode(path string) (uint32, error) {
 	if err != nil {
 		return 0, err
 	}
+	defer unix.Close(fd)
 	stat := unix.Stat_t{}
 	if err := unix.Fstat(fd, &stat); err != nil {
 		return 0, err
@@ -150,6 +151,7 @@ func hostDirEntries(path string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer unix.Close(fd)
 	var buf [hostFileBufSize]byte
 	n, err := unix.Getdents(fd, buf[:])
 	if err != nil {
@@ -55,6 +55,12 @@ type InternalData struct {
 	// EnableAccelSysfs is whether to populate sysfs paths used by hardware
 	// accelerators.
 	EnableAccelSysfs bool
+	// EnableKFDSysfs is whether to populate sysfs paths used by the AMD
+	// amdkfd driver.
+	EnableKFDSysfs bool
+	// EnableInfinibandSysfs is whether to populate sysfs paths used by
+	// RDMA user verbs.
+	EnableInfinibandSysfs bool
 }
 
 // filesystem implements vfs.FilesystemImpl.
@@ -116,12 +122,14 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	}
 	devicesSub := map[string]kernfs.Inode{
 		"system": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-			"cpu": cpuDir(ctx, fs, creds),
+			"cpu":  cpuDir(ctx, fs, creds),
+			"node": fs.nodeDir(ctx, creds, k.CPUTopology()),
 		}),
 	}
 
 	productName := ""
 	var busSub map[string]kernfs.Inode
+	virtualSub := map[string]kernfs.Inode{}
 	if opts.InternalData != nil {
 		idata := opts.InternalData.(*InternalData)
 		productName = idata.ProductName
@@ -148,6 +156,23 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 				}),
 			}
 		}
+		if idata.EnableKFDSysfs {
+			kfdSub, err := fs.newKFDDir(ctx, creds)
+			if err != nil {
+				return nil, nil, err
+			}
+			virtualSub["kfd"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+				"kfd": fs.newDir(ctx, creds, defaultSysDirMode, kfdSub),
+			})
+			classSub["kfd"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+				"kfd": kernfs.NewStaticSymlink(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "../../devices/virtual/kfd/kfd"),
+			})
+		}
+		if idata.EnableInfinibandSysfs {
+			if err := fs.addInfinibandClassDirs(ctx, creds, classSub); err != nil {
+				return nil, nil, err
+			}
+		}
 	}
 
 	if len(productName) > 0 {
@@ -155,14 +180,15 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		classSub["dmi"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
 			"id": kernfs.NewStaticSymlink(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "../../devices/virtual/dmi/id"),
 		})
-		devicesSub["virtual"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-			"dmi": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-				"id": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-					"product_name": fs.newStaticFile(ctx, creds, defaultSysMode, productName+"\n"),
-				}),
+		virtualSub["dmi"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"id": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+				"product_name": fs.newStaticFile(ctx, creds, defaultSysMode, productName+"\n"),
 			}),
 		})
 	}
+	if len(virtualSub) > 0 {
+		devicesSub["virtual"] = fs.newDir(ctx, creds, defaultSysDirMode, virtualSub)
+	}
 	root := fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
 		"block":    fs.newDir(ctx, creds, defaultSysDirMode, nil),
 		"bus":      fs.newDir(ctx, creds, defaultSysDirMode, busSub),
@@ -184,12 +210,20 @@ func cpuDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) kernfs
 	k := kernel.KernelFromContext(ctx)
 	maxCPUCores := k.ApplicationCores()
 	children := map[string]kernfs.Inode{
-		"online":   fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
+		"online":   fs.newOnlineCPUsFile(ctx, creds),
 		"possible": fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
 		"present":  fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
 	}
+	topo := k.CPUTopology()
+	caches := cpuCaches(k.FeatureSet())
 	for i := uint(0); i < maxCPUCores; i++ {
-		children[fmt.Sprintf("cpu%d", i)] = fs.newDir(ctx, creds, linux.FileMode(0555), nil)
+		node := topo.NodeID(i)
+		children[fmt.Sprintf("cpu%d", i)] = fs.newDir(ctx, creds, linux.FileMode(0555), map[string]kernfs.Inode{
+			"cache":                     fs.cpuCacheDir(ctx, creds, topo, caches, i),
+			"online":                    fs.newCPUOnlineFile(ctx, creds, i),
+			"topology":                  fs.cpuTopologyDir(ctx, creds, topo, i),
+			fmt.Sprintf("node%d", node): kernfs.NewStaticSymlink(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), fmt.Sprintf("../../node/node%d", node)),
+		})
 	}
 	return fs.newDir(ctx, creds, defaultSysDirMode, children)
 }
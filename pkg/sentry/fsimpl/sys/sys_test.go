@@ -24,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/testutil"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
@@ -99,3 +100,80 @@ func TestCgroupMountpointExists(t *testing.T) {
 	pop = s.PathOpAtRoot("/fs/cgroup")
 	s.AssertAllDirentTypes(s.ListDirents(pop), map[string]testutil.DirentType{ /*empty*/ })
 }
+
+func TestReadCPUTopologyFiles(t *testing.T) {
+	s := newTestSystem(t)
+	defer s.Destroy()
+	k := kernel.KernelFromContext(s.Ctx)
+	maxCPUCores := k.ApplicationCores()
+	allCPUs := "0\n"
+	if maxCPUCores > 1 {
+		allCPUs = fmt.Sprintf("0-%d\n", maxCPUCores-1)
+	}
+
+	for path, expected := range map[string]string{
+		"devices/system/node/online":                                   "0\n",
+		"devices/system/node/node0/cpulist":                            allCPUs,
+		"devices/system/node/node0/distance":                           "10\n",
+		"devices/system/cpu/cpu0/topology/core_id":                     "0\n",
+		"devices/system/cpu/cpu0/topology/physical_package_id":         "0\n",
+		"devices/system/cpu/cpu0/topology/thread_siblings_list":        "0\n",
+		"devices/system/cpu/cpu0/topology/core_siblings_list":          allCPUs,
+		"devices/system/cpu/cpu0/node0/cpu0/topology/core_id":          "0\n",
+		"devices/system/node/node0/cpu0/topology/thread_siblings_list": "0\n",
+	} {
+		pop := s.PathOpAtRoot(path)
+		fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, pop, &vfs.OpenOptions{})
+		if err != nil {
+			t.Fatalf("OpenAt(pop:%+v) = %+v failed: %v", pop, fd, err)
+		}
+		defer fd.DecRef(s.Ctx)
+		content, err := s.ReadToEnd(fd)
+		if err != nil {
+			t.Fatalf("Read %s failed: %v", path, err)
+		}
+		if diff := cmp.Diff(expected, content); diff != "" {
+			t.Errorf("Read %s returned unexpected data:\n--- want\n+++ got\n%v", path, diff)
+		}
+	}
+}
+
+func TestReadOnlineCPUFiles(t *testing.T) {
+	s := newTestSystem(t)
+	defer s.Destroy()
+	k := kernel.KernelFromContext(s.Ctx)
+	maxCPUCores := k.ApplicationCores()
+	if maxCPUCores < 3 {
+		t.Skipf("need at least 3 CPUs, have %d", maxCPUCores)
+	}
+
+	// Leave only CPUs 0 and 2 online.
+	online := sched.NewCPUSet(maxCPUCores)
+	online.Set(0)
+	online.Set(2)
+	if err := k.SetOnlineCPUs(online); err != nil {
+		t.Fatalf("SetOnlineCPUs failed: %v", err)
+	}
+
+	for path, expected := range map[string]string{
+		"devices/system/cpu/online":      "0,2\n",
+		"devices/system/cpu/possible":    fmt.Sprintf("0-%d\n", maxCPUCores-1),
+		"devices/system/cpu/cpu0/online": "1\n",
+		"devices/system/cpu/cpu1/online": "0\n",
+		"devices/system/cpu/cpu2/online": "1\n",
+	} {
+		pop := s.PathOpAtRoot(path)
+		fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, pop, &vfs.OpenOptions{})
+		if err != nil {
+			t.Fatalf("OpenAt(pop:%+v) = %+v failed: %v", pop, fd, err)
+		}
+		defer fd.DecRef(s.Ctx)
+		content, err := s.ReadToEnd(fd)
+		if err != nil {
+			t.Fatalf("Read %s failed: %v", path, err)
+		}
+		if diff := cmp.Diff(expected, content); diff != "" {
+			t.Errorf("Read %s returned unexpected data:\n--- want\n+++ got\n%v", path, diff)
+		}
+	}
+}
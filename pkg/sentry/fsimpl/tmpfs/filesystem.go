@@ -21,6 +21,7 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
@@ -289,6 +290,9 @@ func (fs *filesystem) LinkAt(ctx context.Context, rp *vfs.ResolvingPath, vd vfs.
 		if i.nlink.Load() == maxLinks {
 			return linuxerr.EMLINK
 		}
+		if err := parentDir.checkProjectInheritance(i); err != nil {
+			return err
+		}
 		i.incLinksLocked()
 		i.watches.Notify(ctx, "", linux.IN_ATTRIB, 0, vfs.InodeEvent, false /* unlinked */)
 		parentDir.insertChildLocked(fs.newDentry(i), name)
@@ -303,8 +307,12 @@ func (fs *filesystem) MkdirAt(ctx context.Context, rp *vfs.ResolvingPath, opts v
 		if parentDir.inode.nlink.Load() == maxLinks {
 			return linuxerr.EMLINK
 		}
-		parentDir.inode.incLinksLocked() // from child's ".."
 		childDir := fs.newDirectory(creds.EffectiveKUID, creds.EffectiveKGID, opts.Mode, parentDir)
+		if err := childDir.inode.initQuota(0 /* space */, fs.ignoresQuotaLimits(ctx)); err != nil {
+			childDir.inode.decRef(ctx)
+			return err
+		}
+		parentDir.inode.incLinksLocked() // from child's ".."
 		parentDir.insertChildLocked(&childDir.dentry, name)
 		return nil
 	})
@@ -329,6 +337,10 @@ func (fs *filesystem) MknodAt(ctx context.Context, rp *vfs.ResolvingPath, opts v
 		default:
 			return linuxerr.EINVAL
 		}
+		if err := childInode.initQuota(0 /* space */, fs.ignoresQuotaLimits(ctx)); err != nil {
+			childInode.decRef(ctx)
+			return err
+		}
 		child := fs.newDentry(childInode)
 		parentDir.insertChildLocked(child, name)
 		return nil
@@ -420,7 +432,12 @@ afterTrailingSymlink:
 		defer rp.Mount().EndWrite()
 		// Create and open the child.
 		creds := rp.Credentials()
-		child := fs.newDentry(fs.newRegularFile(creds.EffectiveKUID, creds.EffectiveKGID, opts.Mode, parentDir))
+		childInode := fs.newRegularFile(creds.EffectiveKUID, creds.EffectiveKGID, opts.Mode, parentDir)
+		if err := childInode.initQuota(0 /* space */, fs.ignoresQuotaLimits(ctx)); err != nil {
+			childInode.decRef(ctx)
+			return nil, err
+		}
+		child := fs.newDentry(childInode)
 		parentDir.insertChildLocked(child, name)
 		child.IncRef()
 		defer child.DecRef(ctx)
@@ -598,6 +615,9 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 	if err := newParentDir.inode.checkPermissions(rp.Credentials(), vfs.MayWrite|vfs.MayExec); err != nil {
 		return err
 	}
+	if err := newParentDir.checkProjectInheritance(renamed.inode); err != nil {
+		return err
+	}
 	replaced, ok := newParentDir.childMap[newName]
 	if ok {
 		if opts.Flags&linux.RENAME_NOREPLACE != 0 {
@@ -784,13 +804,21 @@ func (fs *filesystem) SymlinkAt(ctx context.Context, rp *vfs.ResolvingPath, targ
 		// Linux allocates a page to store symlink targets that have length larger
 		// than shortSymlinkLen. Targets are just stored as string here, but simulate
 		// the page accounting for it. See mm/shmem.c:shmem_symlink().
+		var space uint64
 		if len(target) >= shortSymlinkLen {
 			if !fs.accountPages(1) {
 				return linuxerr.ENOSPC
 			}
+			space = hostarch.PageSize
 		}
 		creds := rp.Credentials()
-		child := fs.newDentry(fs.newSymlink(creds.EffectiveKUID, creds.EffectiveKGID, 0777, target, parentDir))
+		childInode := fs.newSymlink(creds.EffectiveKUID, creds.EffectiveKGID, 0777, target, parentDir)
+		if err := childInode.initQuota(space, fs.ignoresQuotaLimits(ctx)); err != nil {
+			// This also releases the page accounted above.
+			childInode.decRef(ctx)
+			return err
+		}
+		child := fs.newDentry(childInode)
 		parentDir.insertChildLocked(child, name)
 		return nil
 	})
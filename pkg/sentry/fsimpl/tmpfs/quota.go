@@ -0,0 +1,738 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpfs
+
+import (
+	"math"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// Quota mount options. As in Linux, "quota" is equivalent to "usrquota".
+// Linux's tmpfs doesn't support project quotas; "prjquota" is taken from
+// ext4.
+const (
+	moptQuota                  = "quota"
+	moptUsrQuota               = "usrquota"
+	moptGrpQuota               = "grpquota"
+	moptPrjQuota               = "prjquota"
+	moptUsrQuotaBlockHardLimit = "usrquota_block_hardlimit"
+	moptUsrQuotaInodeHardLimit = "usrquota_inode_hardlimit"
+	moptGrpQuotaBlockHardLimit = "grpquota_block_hardlimit"
+	moptGrpQuotaInodeHardLimit = "grpquota_inode_hardlimit"
+)
+
+// quotaSet holds a filesystem's disk quotas of one type. It is the
+// equivalent of Linux's mm/shmem_quota.c, which keeps quotas in memory rather
+// than in quota files.
+//
+// +stateify savable
+type quotaSet struct {
+	// enforced is true if quota limits are enforced. Usage is accounted
+	// regardless of enforced.
+	enforced bool
+
+	// blockGrace and inodeGrace are the periods, in seconds, after which
+	// exceeded soft limits are enforced like hard limits.
+	blockGrace uint64
+	inodeGrace uint64
+
+	// defaults holds the limits of quota IDs that aren't in dquots.
+	defaults dquot
+
+	// dquots maps quota IDs to their quotas.
+	dquots map[uint32]*dquot
+}
+
+// dquot is the quota of a single ID.
+//
+// +stateify savable
+type dquot struct {
+	// blockHardLimit and blockSoftLimit are limits on space usage in bytes.
+	// inodeHardLimit and inodeSoftLimit are limits on the number of inodes.
+	// Zero limits are unlimited.
+	blockHardLimit uint64
+	blockSoftLimit uint64
+	inodeHardLimit uint64
+	inodeSoftLimit uint64
+
+	// space and inodes are the current usage.
+	space  uint64
+	inodes uint64
+
+	// blockTime and inodeTime are the times, in seconds since the epoch,
+	// after which the respective soft limits are enforced like hard limits.
+	// They are 0 if usage doesn't exceed the soft limits.
+	blockTime int64
+	inodeTime int64
+}
+
+// inodeQuota is the quota accounting state of an inode.
+//
+// +stateify savable
+type inodeQuota struct {
+	// charged is true if the inode is charged to the quota IDs in ids.
+	// Inodes that are created outside of the filesystem tree, such as
+	// memfds, are never charged.
+	charged bool
+
+	// ids are the inode's quota IDs, indexed by quota type. They are only
+	// updated along with the charges, so they may briefly lag behind the
+	// inode's owner and project ID.
+	ids [linux.MAXQUOTAS]uint32
+
+	// space is the space charged to the inode's quotas in bytes.
+	space uint64
+}
+
+// parseQuotaOptions removes the quota options from mopts, and returns the
+// corresponding quotas.
+func parseQuotaOptions(ctx context.Context, mopts map[string]string) ([linux.MAXQUOTAS]*quotaSet, error) {
+	var quotas [linux.MAXQUOTAS]*quotaSet
+	for _, opt := range []struct {
+		name  string
+		qtype int
+	}{
+		{moptQuota, linux.USRQUOTA},
+		{moptUsrQuota, linux.USRQUOTA},
+		{moptGrpQuota, linux.GRPQUOTA},
+		{moptPrjQuota, linux.PRJQUOTA},
+	} {
+		if _, ok := mopts[opt.name]; !ok {
+			continue
+		}
+		delete(mopts, opt.name)
+		if quotas[opt.qtype] == nil {
+			quotas[opt.qtype] = &quotaSet{
+				enforced:   true,
+				blockGrace: linux.MAX_DQ_TIME,
+				inodeGrace: linux.MAX_IQ_TIME,
+				dquots:     make(map[uint32]*dquot),
+			}
+		}
+	}
+	for _, opt := range []struct {
+		name  string
+		qtype int
+		limit func(dq *dquot) *uint64
+	}{
+		{moptUsrQuotaBlockHardLimit, linux.USRQUOTA, func(dq *dquot) *uint64 { return &dq.blockHardLimit }},
+		{moptUsrQuotaInodeHardLimit, linux.USRQUOTA, func(dq *dquot) *uint64 { return &dq.inodeHardLimit }},
+		{moptGrpQuotaBlockHardLimit, linux.GRPQUOTA, func(dq *dquot) *uint64 { return &dq.blockHardLimit }},
+		{moptGrpQuotaInodeHardLimit, linux.GRPQUOTA, func(dq *dquot) *uint64 { return &dq.inodeHardLimit }},
+	} {
+		str, ok := mopts[opt.name]
+		if !ok {
+			continue
+		}
+		delete(mopts, opt.name)
+		if quotas[opt.qtype] == nil {
+			ctx.Warningf("tmpfs.FilesystemType.GetFilesystem: %s requires the corresponding quota option", opt.name)
+			return quotas, linuxerr.EINVAL
+		}
+		limit, err := parseSize(str)
+		if err != nil || limit == 0 {
+			ctx.Warningf("tmpfs.FilesystemType.GetFilesystem: invalid %s: %q", opt.name, str)
+			return quotas, linuxerr.EINVAL
+		}
+		*opt.limit(&quotas[opt.qtype].defaults) = limit
+	}
+	return quotas, nil
+}
+
+// quotasEnabled returns true if any quota type is accounted in fs.
+func (fs *filesystem) quotasEnabled() bool {
+	return fs.quotas[linux.USRQUOTA] != nil || fs.quotas[linux.GRPQUOTA] != nil || fs.quotas[linux.PRJQUOTA] != nil
+}
+
+// ignoresQuotaLimits returns true if the task in ctx may exceed fs's quota
+// limits, as for Linux's fs/quota/dquot.c:ignore_hardlimit().
+func (fs *filesystem) ignoresQuotaLimits(ctx context.Context) bool {
+	if !fs.quotasEnabled() {
+		return false
+	}
+	creds := auth.CredentialsFromContext(ctx)
+	return creds.HasCapabilityIn(linux.CAP_SYS_RESOURCE, creds.UserNamespace.Root())
+}
+
+// quotaSet returns fs's quotas of type qtype, or ESRCH if they aren't
+// accounted.
+func (fs *filesystem) quotaSet(qtype int) (*quotaSet, error) {
+	if qtype < 0 || qtype >= linux.MAXQUOTAS {
+		return nil, linuxerr.EINVAL
+	}
+	if qs := fs.quotas[qtype]; qs != nil {
+		return qs, nil
+	}
+	return nil, linuxerr.ESRCH
+}
+
+// get returns the quota of id, creating it if necessary.
+//
+// Preconditions: filesystem.quotaMu must be locked.
+func (qs *quotaSet) get(id uint32) *dquot {
+	dq, ok := qs.dquots[id]
+	if !ok {
+		dq = &dquot{}
+		*dq = qs.defaults
+		qs.dquots[id] = dq
+	}
+	return dq
+}
+
+// lookup returns the quota of id, without creating it.
+//
+// Preconditions: filesystem.quotaMu must be locked.
+func (qs *quotaSet) lookup(id uint32) dquot {
+	if dq, ok := qs.dquots[id]; ok {
+		return *dq
+	}
+	return qs.defaults
+}
+
+// maybeForget removes the quota of id if it has no usage and the default
+// limits, so that quotas of IDs that are no longer used don't accumulate.
+//
+// Preconditions: filesystem.quotaMu must be locked.
+func (qs *quotaSet) maybeForget(id uint32) {
+	if dq, ok := qs.dquots[id]; ok && *dq == qs.defaults {
+		delete(qs.dquots, id)
+	}
+}
+
+// spaceRoom returns the space in bytes that can be charged to dq at time now
+// before its limits are exceeded.
+func (dq *dquot) spaceRoom(now int64) uint64 {
+	return limitRoom(dq.space, dq.blockHardLimit, dq.blockSoftLimit, dq.blockTime, now)
+}
+
+// inodeRoom returns the number of inodes that can be charged to dq at time
+// now before its limits are exceeded.
+func (dq *dquot) inodeRoom(now int64) uint64 {
+	return limitRoom(dq.inodes, dq.inodeHardLimit, dq.inodeSoftLimit, dq.inodeTime, now)
+}
+
+func limitRoom(usage, hardLimit, softLimit uint64, softTime, now int64) uint64 {
+	room := uint64(math.MaxUint64)
+	if hardLimit != 0 {
+		room = 0
+		if usage < hardLimit {
+			room = hardLimit - usage
+		}
+	}
+	if softLimit != 0 && softTime != 0 && now >= softTime {
+		if usage >= softLimit {
+			return 0
+		}
+		if softLimit-usage < room {
+			room = softLimit - usage
+		}
+	}
+	return room
+}
+
+// charge adds space and inodes to dq's usage. If the usage exceeds dq's soft
+// limits and qs is enforced, it starts the respective grace periods.
+func (dq *dquot) charge(qs *quotaSet, space, inodes uint64, now int64) {
+	dq.space += space
+	dq.inodes += inodes
+	if !qs.enforced {
+		return
+	}
+	if dq.blockSoftLimit != 0 && dq.space > dq.blockSoftLimit && dq.blockTime == 0 {
+		dq.blockTime = now + int64(qs.blockGrace)
+	}
+	if dq.inodeSoftLimit != 0 && dq.inodes > dq.inodeSoftLimit && dq.inodeTime == 0 {
+		dq.inodeTime = now + int64(qs.inodeGrace)
+	}
+}
+
+// release subtracts space and inodes from dq's usage. If the usage no longer
+// exceeds dq's soft limits, it stops the respective grace periods.
+func (dq *dquot) release(space, inodes uint64) {
+	if space > dq.space {
+		space = dq.space
+	}
+	if inodes > dq.inodes {
+		inodes = dq.inodes
+	}
+	dq.space -= space
+	dq.inodes -= inodes
+	if dq.blockSoftLimit == 0 || dq.space <= dq.blockSoftLimit {
+		dq.blockTime = 0
+	}
+	if dq.inodeSoftLimit == 0 || dq.inodes <= dq.inodeSoftLimit {
+		dq.inodeTime = 0
+	}
+}
+
+// quotaIDs returns i's current quota IDs.
+func (i *inode) quotaIDs() [linux.MAXQUOTAS]uint32 {
+	return [linux.MAXQUOTAS]uint32{
+		linux.USRQUOTA: i.uid.Load(),
+		linux.GRPQUOTA: i.gid.Load(),
+		linux.PRJQUOTA: i.projid.Load(),
+	}
+}
+
+// chargeQuotasLocked charges space bytes and inodes inodes to the quotas of
+// ids in quotas, at time now. If partial is true and space can't be charged
+// in full, it charges as many pages of it as possible instead. It returns the
+// space charged, or EDQUOT if nothing can be charged.
+//
+// Preconditions: filesystem.quotaMu must be locked.
+func chargeQuotasLocked(quotas *[linux.MAXQUOTAS]*quotaSet, ids [linux.MAXQUOTAS]uint32, space, inodes uint64, partial, ignoreLimits bool, now int64) (uint64, error) {
+	var dqs [linux.MAXQUOTAS]*dquot
+	for qtype, qs := range quotas {
+		if qs == nil {
+			continue
+		}
+		dq := qs.get(ids[qtype])
+		dqs[qtype] = dq
+		if !qs.enforced || ignoreLimits {
+			continue
+		}
+		exceeded := dq.inodeRoom(now) < inodes
+		if room := dq.spaceRoom(now); !exceeded && room < space {
+			if partial {
+				space = hostarch.PageRoundDown(room)
+			}
+			exceeded = !partial || space == 0
+		}
+		if exceeded {
+			for qtype, dq := range dqs {
+				if dq != nil {
+					quotas[qtype].maybeForget(ids[qtype])
+				}
+			}
+			return 0, linuxerr.EDQUOT
+		}
+	}
+	for qtype, dq := range dqs {
+		if dq != nil {
+			dq.charge(quotas[qtype], space, inodes, now)
+		}
+	}
+	return space, nil
+}
+
+// releaseQuotasLocked releases space bytes and inodes inodes from the quotas
+// of ids in quotas.
+//
+// Preconditions: filesystem.quotaMu must be locked.
+func releaseQuotasLocked(quotas *[linux.MAXQUOTAS]*quotaSet, ids [linux.MAXQUOTAS]uint32, space, inodes uint64) {
+	for qtype, qs := range quotas {
+		if qs == nil {
+			continue
+		}
+		if dq, ok := qs.dquots[ids[qtype]]; ok {
+			dq.release(space, inodes)
+			qs.maybeForget(ids[qtype])
+		}
+	}
+}
+
+// initQuota charges the newly-created inode i, and space bytes of its data,
+// to its quotas. If this fails, the caller must drop its reference on i.
+func (i *inode) initQuota(space uint64, ignoreLimits bool) error {
+	fs := i.fs
+	if !fs.quotasEnabled() {
+		return nil
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	ids := i.quotaIDs()
+	if _, err := chargeQuotasLocked(&fs.quotas, ids, space, 1, false /* partial */, ignoreLimits, fs.clock.Now().Seconds()); err != nil {
+		return err
+	}
+	i.quota = inodeQuota{
+		charged: true,
+		ids:     ids,
+		space:   space,
+	}
+	return nil
+}
+
+// releaseQuota releases everything charged to i's quotas. It is called when
+// i is destroyed.
+func (i *inode) releaseQuota() {
+	fs := i.fs
+	if !fs.quotasEnabled() {
+		return
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if i.quota.charged {
+		releaseQuotasLocked(&fs.quotas, i.quota.ids, i.quota.space, 1)
+		i.quota = inodeQuota{}
+	}
+}
+
+// chargeQuotaSpace charges space bytes of i's data to its quotas, or as many
+// pages of it as possible if partial is true. It returns the space charged.
+func (i *inode) chargeQuotaSpace(space uint64, partial, ignoreLimits bool) (uint64, error) {
+	fs := i.fs
+	if !fs.quotasEnabled() {
+		return space, nil
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if !i.quota.charged {
+		return space, nil
+	}
+	space, err := chargeQuotasLocked(&fs.quotas, i.quota.ids, space, 0, partial, ignoreLimits, fs.clock.Now().Seconds())
+	if err != nil {
+		return 0, err
+	}
+	i.quota.space += space
+	return space, nil
+}
+
+// releaseQuotaSpace releases space bytes of i's data from its quotas.
+func (i *inode) releaseQuotaSpace(space uint64) {
+	fs := i.fs
+	if !fs.quotasEnabled() {
+		return
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if !i.quota.charged {
+		return
+	}
+	if space > i.quota.space {
+		space = i.quota.space
+	}
+	releaseQuotasLocked(&fs.quotas, i.quota.ids, space, 0)
+	i.quota.space -= space
+}
+
+// transferQuota moves i's charges to the quotas of newIDs. Like Linux's
+// fs/quota/dquot.c:__dquot_transfer(), it fails with EDQUOT if this would
+// exceed the limits of newIDs.
+//
+// Preconditions: i.mu must be locked.
+func (i *inode) transferQuota(newIDs [linux.MAXQUOTAS]uint32, ignoreLimits bool) error {
+	fs := i.fs
+	if !fs.quotasEnabled() {
+		return nil
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if !i.quota.charged || newIDs == i.quota.ids {
+		return nil
+	}
+	// Only charge the quota types whose ID changes.
+	var quotas [linux.MAXQUOTAS]*quotaSet
+	for qtype, qs := range fs.quotas {
+		if newIDs[qtype] != i.quota.ids[qtype] {
+			quotas[qtype] = qs
+		}
+	}
+	if _, err := chargeQuotasLocked(&quotas, newIDs, i.quota.space, 1, false /* partial */, ignoreLimits, fs.clock.Now().Seconds()); err != nil {
+		return err
+	}
+	releaseQuotasLocked(&quotas, i.quota.ids, i.quota.space, 1)
+	i.quota.ids = newIDs
+	return nil
+}
+
+// accountPages is equivalent to i.fs.accountPages, but also charges the pages
+// to i's quotas. It returns ENOSPC or EDQUOT if the pages can't be accounted.
+func (i *inode) accountPages(pagesInc uint64, ignoreQuotaLimits bool) error {
+	if !i.fs.accountPages(pagesInc) {
+		return linuxerr.ENOSPC
+	}
+	if _, err := i.chargeQuotaSpace(pagesInc*hostarch.PageSize, false /* partial */, ignoreQuotaLimits); err != nil {
+		i.fs.unaccountPages(pagesInc)
+		return err
+	}
+	return nil
+}
+
+// accountPagesPartial is equivalent to i.fs.accountPagesPartial, but also
+// charges the pages to i's quotas. If no pages can be accounted, it returns
+// ENOSPC or EDQUOT.
+func (i *inode) accountPagesPartial(pagesInc uint64, ignoreQuotaLimits bool) (uint64, error) {
+	pagesReserved := i.fs.accountPagesPartial(pagesInc)
+	if pagesReserved == 0 {
+		return 0, linuxerr.ENOSPC
+	}
+	space, err := i.chargeQuotaSpace(pagesReserved*hostarch.PageSize, true /* partial */, ignoreQuotaLimits)
+	if err != nil {
+		i.fs.unaccountPages(pagesReserved)
+		return 0, err
+	}
+	pagesCharged := space / hostarch.PageSize
+	i.fs.unaccountPages(pagesReserved - pagesCharged)
+	return pagesCharged, nil
+}
+
+// unaccountPages is equivalent to i.fs.unaccountPages, but also releases the
+// pages from i's quotas.
+func (i *inode) unaccountPages(pagesDec uint64) {
+	i.fs.unaccountPages(pagesDec)
+	i.releaseQuotaSpace(pagesDec * hostarch.PageSize)
+}
+
+// adjustPageAcct is equivalent to i.fs.adjustPageAcct, but also adjusts i's
+// quotas.
+func (i *inode) adjustPageAcct(reserved, alloced uint64) {
+	i.fs.adjustPageAcct(reserved, alloced)
+	if reserved > alloced {
+		i.releaseQuotaSpace((reserved - alloced) * hostarch.PageSize)
+	}
+}
+
+// QuotaFormat implements vfs.QuotaFilesystemImpl.QuotaFormat.
+func (fs *filesystem) QuotaFormat(qtype int) (uint32, error) {
+	if _, err := fs.quotaSet(qtype); err != nil {
+		return 0, err
+	}
+	return linux.QFMT_SHMEM, nil
+}
+
+// QuotaOn implements vfs.QuotaFilesystemImpl.QuotaOn.
+//
+// As in Linux's tmpfs, usage is always accounted for the quota types that
+// were enabled at mount time; only the enforcement of limits can be turned
+// on and off.
+func (fs *filesystem) QuotaOn(ctx context.Context, qtype int) error {
+	qs, err := fs.quotaSet(qtype)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ESRCH, err) {
+			return linuxerr.EINVAL
+		}
+		return err
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if qs.enforced {
+		return linuxerr.EBUSY
+	}
+	qs.enforced = true
+	return nil
+}
+
+// QuotaOff implements vfs.QuotaFilesystemImpl.QuotaOff.
+func (fs *filesystem) QuotaOff(ctx context.Context, qtype int) error {
+	qs, err := fs.quotaSet(qtype)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ESRCH, err) {
+			return linuxerr.EINVAL
+		}
+		return err
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if !qs.enforced {
+		return linuxerr.EINVAL
+	}
+	qs.enforced = false
+	return nil
+}
+
+// GetQuotaInfo implements vfs.QuotaFilesystemImpl.GetQuotaInfo.
+func (fs *filesystem) GetQuotaInfo(ctx context.Context, qtype int) (linux.IfDqinfo, error) {
+	qs, err := fs.quotaSet(qtype)
+	if err != nil {
+		return linux.IfDqinfo{}, err
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	return linux.IfDqinfo{
+		BGrace: qs.blockGrace,
+		IGrace: qs.inodeGrace,
+		Flags:  linux.DQF_SYS_FILE,
+		Valid:  linux.IIF_ALL,
+	}, nil
+}
+
+// SetQuotaInfo implements vfs.QuotaFilesystemImpl.SetQuotaInfo.
+func (fs *filesystem) SetQuotaInfo(ctx context.Context, qtype int, info linux.IfDqinfo) error {
+	qs, err := fs.quotaSet(qtype)
+	if err != nil {
+		return err
+	}
+	if info.Valid&^linux.IIF_ALL != 0 {
+		return linuxerr.EINVAL
+	}
+	// Only the QFMT_VFS_OLD format supports DQF_ROOT_SQUASH, and other flags
+	// can't be set.
+	if info.Valid&linux.IIF_FLAGS != 0 && info.Flags != 0 {
+		return linuxerr.EINVAL
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if info.Valid&linux.IIF_BGRACE != 0 {
+		qs.blockGrace = info.BGrace
+	}
+	if info.Valid&linux.IIF_IGRACE != 0 {
+		qs.inodeGrace = info.IGrace
+	}
+	return nil
+}
+
+// GetQuota implements vfs.QuotaFilesystemImpl.GetQuota.
+func (fs *filesystem) GetQuota(ctx context.Context, qtype int, id uint32) (linux.IfDqblk, error) {
+	qs, err := fs.quotaSet(qtype)
+	if err != nil {
+		return linux.IfDqblk{}, err
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	return qs.lookup(id).toIfDqblk(), nil
+}
+
+// SetQuota implements vfs.QuotaFilesystemImpl.SetQuota.
+//
+// Usage is determined by the filesystem's contents, so changes to it
+// (QIF_SPACE and QIF_INODES) are ignored.
+func (fs *filesystem) SetQuota(ctx context.Context, qtype int, id uint32, dqb linux.IfDqblk) error {
+	qs, err := fs.quotaSet(qtype)
+	if err != nil {
+		return err
+	}
+	if dqb.Valid&^linux.QIF_ALL != 0 {
+		return linuxerr.EINVAL
+	}
+	var blockHardLimit, blockSoftLimit uint64
+	if dqb.Valid&linux.QIF_BLIMITS != 0 {
+		if dqb.BHardLimit > math.MaxUint64/linux.QIF_DQBLKSIZE || dqb.BSoftLimit > math.MaxUint64/linux.QIF_DQBLKSIZE {
+			return linuxerr.ERANGE
+		}
+		blockHardLimit = dqb.BHardLimit * linux.QIF_DQBLKSIZE
+		blockSoftLimit = dqb.BSoftLimit * linux.QIF_DQBLKSIZE
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	dq := qs.get(id)
+	defer qs.maybeForget(id)
+	if dqb.Valid&linux.QIF_BLIMITS != 0 {
+		dq.blockHardLimit = blockHardLimit
+		dq.blockSoftLimit = blockSoftLimit
+	}
+	if dqb.Valid&linux.QIF_ILIMITS != 0 {
+		dq.inodeHardLimit = dqb.IHardLimit
+		dq.inodeSoftLimit = dqb.ISoftLimit
+	}
+	if dqb.Valid&linux.QIF_BTIME != 0 {
+		dq.blockTime = int64(dqb.BTime)
+	}
+	if dqb.Valid&linux.QIF_ITIME != 0 {
+		dq.inodeTime = int64(dqb.ITime)
+	}
+	// Restart or stop the grace periods as for Linux's
+	// fs/quota/dquot.c:do_set_dqblk().
+	now := fs.clock.Now().Seconds()
+	if dqb.Valid&linux.QIF_BLIMITS != 0 {
+		if dq.blockSoftLimit == 0 || dq.space <= dq.blockSoftLimit {
+			dq.blockTime = 0
+		} else if dqb.Valid&linux.QIF_BTIME == 0 {
+			dq.blockTime = now + int64(qs.blockGrace)
+		}
+	}
+	if dqb.Valid&linux.QIF_ILIMITS != 0 {
+		if dq.inodeSoftLimit == 0 || dq.inodes <= dq.inodeSoftLimit {
+			dq.inodeTime = 0
+		} else if dqb.Valid&linux.QIF_ITIME == 0 {
+			dq.inodeTime = now + int64(qs.inodeGrace)
+		}
+	}
+	return nil
+}
+
+// GetNextQuota implements vfs.QuotaFilesystemImpl.GetNextQuota.
+func (fs *filesystem) GetNextQuota(ctx context.Context, qtype int, id uint32) (uint32, linux.IfDqblk, error) {
+	qs, err := fs.quotaSet(qtype)
+	if err != nil {
+		return 0, linux.IfDqblk{}, err
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	var (
+		next  uint32
+		found bool
+	)
+	for qid := range qs.dquots {
+		if qid >= id && (!found || qid < next) {
+			next = qid
+			found = true
+		}
+	}
+	if !found {
+		return 0, linux.IfDqblk{}, linuxerr.ENOENT
+	}
+	return next, qs.dquots[next].toIfDqblk(), nil
+}
+
+// toIfDqblk returns dq as a linux.IfDqblk.
+func (dq dquot) toIfDqblk() linux.IfDqblk {
+	return linux.IfDqblk{
+		BHardLimit: dq.blockHardLimit / linux.QIF_DQBLKSIZE,
+		BSoftLimit: dq.blockSoftLimit / linux.QIF_DQBLKSIZE,
+		CurSpace:   dq.space,
+		IHardLimit: dq.inodeHardLimit,
+		ISoftLimit: dq.inodeSoftLimit,
+		CurInodes:  dq.inodes,
+		BTime:      uint64(dq.blockTime),
+		ITime:      uint64(dq.inodeTime),
+		Valid:      linux.QIF_ALL,
+	}
+}
+
+// setProjectLocked changes i's project ID and FS_XFLAG_* flags, as for
+// FS_IOC_FSSETXATTR.
+//
+// Preconditions: i.mu must be locked.
+func (i *inode) setProjectLocked(ctx context.Context, creds *auth.Credentials, fsx *linux.Fsxattr) error {
+	if fsx.XFlags&^linux.FS_XFLAG_PROJINHERIT != 0 {
+		return linuxerr.EOPNOTSUPP
+	}
+	if !vfs.CanActAsOwner(creds, auth.KUID(i.uid.Load())) {
+		return linuxerr.EPERM
+	}
+	oldProjID := i.projid.Load()
+	oldXFlags := i.xflags.Load()
+	// "Project Quota ID state is only allowed to change from within the init
+	// namespace." - fs/ioctl.c:fileattr_set_prepare()
+	if creds.UserNamespace != creds.UserNamespace.Root() && (fsx.ProjID != oldProjID || (fsx.XFlags^oldXFlags)&linux.FS_XFLAG_PROJINHERIT != 0) {
+		return linuxerr.EINVAL
+	}
+	if fsx.ProjID != oldProjID {
+		ids := i.quotaIDs()
+		ids[linux.PRJQUOTA] = fsx.ProjID
+		if err := i.transferQuota(ids, i.fs.ignoresQuotaLimits(ctx)); err != nil {
+			return err
+		}
+		i.projid.Store(fsx.ProjID)
+	}
+	i.xflags.Store(fsx.XFlags)
+	i.ctime.Store(i.fs.clock.Now().Nanoseconds())
+	return nil
+}
+
+// checkProjectInheritance returns EXDEV if i can't be linked into dir because
+// they belong to different projects, as for ext4.
+func (dir *directory) checkProjectInheritance(i *inode) error {
+	if dir.inode.xflags.Load()&linux.FS_XFLAG_PROJINHERIT != 0 && dir.inode.projid.Load() != i.projid.Load() {
+		return linuxerr.EXDEV
+	}
+	return nil
+}
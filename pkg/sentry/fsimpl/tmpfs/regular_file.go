@@ -139,22 +139,29 @@ func NewZeroFile(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount,
 		return nil, err
 	}
 	rf := fd.inode().impl.(*regularFile)
-	rf.memoryUsageKind = usage.Anonymous
+	rf.memoryUsageKind = usage.Shmem
 	rf.size.Store(size)
 	return &fd.vfsfd, err
 }
 
 // NewMemfd creates a new regular file and file description as for
-// memfd_create.
+// memfd_create. If noExecSeal is true, the file is created non-executable
+// with F_SEAL_EXEC set, as for MFD_NOEXEC_SEAL; this implies allowSeals.
 //
 // Preconditions: mount must be a tmpfs mount.
-func NewMemfd(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount, allowSeals bool, name string) (*vfs.FileDescription, error) {
+func NewMemfd(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount, allowSeals, noExecSeal bool, name string) (*vfs.FileDescription, error) {
 	fd, err := newUnlinkedRegularFileDescription(ctx, creds, mount, name)
 	if err != nil {
 		return nil, err
 	}
-	if allowSeals {
-		fd.inode().impl.(*regularFile).seals = 0
+	rf := fd.inode().impl.(*regularFile)
+	switch {
+	case noExecSeal:
+		// Compare Linux's mm/memfd.c:memfd_create().
+		rf.inode.mode.Store(linux.S_IFREG | 0666)
+		rf.seals = linux.F_SEAL_EXEC
+	case allowSeals:
+		rf.seals = 0
 	}
 	return &fd.vfsfd, nil
 }
@@ -223,7 +230,7 @@ func (rf *regularFile) truncateLocked(newSize uint64) (bool, error) {
 	rf.dataMu.Lock()
 	decPages := rf.data.Truncate(newSize, rf.inode.fs.mf)
 	rf.dataMu.Unlock()
-	rf.inode.fs.unaccountPages(decPages)
+	rf.inode.unaccountPages(decPages)
 	return true, nil
 }
 
@@ -298,20 +305,21 @@ func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.
 		optional.End = pgend
 	}
 	pagesToFill := rf.data.PagesToFill(required, optional)
-	if !rf.inode.fs.accountPages(pagesToFill) {
+	ignoreQuotaLimits := rf.inode.fs.ignoresQuotaLimits(ctx)
+	if err := rf.inode.accountPages(pagesToFill, ignoreQuotaLimits); err != nil {
 		// If we can not accommodate pagesToFill pages, then retry with just
 		// the required range. Because optional may be larger than required.
 		// Only error out if even the required range can not be allocated for.
 		pagesToFill = rf.data.PagesToFill(required, required)
-		if !rf.inode.fs.accountPages(pagesToFill) {
-			return nil, &memmap.BusError{linuxerr.ENOSPC}
+		if err := rf.inode.accountPages(pagesToFill, ignoreQuotaLimits); err != nil {
+			return nil, &memmap.BusError{err}
 		}
 		optional = required
 	}
 	pagesAlloced, cerr := rf.data.Fill(ctx, required, optional, rf.size.RacyLoad(), rf.inode.fs.mf, rf.memoryUsageKind, pgalloc.AllocateOnly, nil /* r */)
 	// rf.data.Fill() may fail mid-way. We still want to account any pages that
 	// were allocated, irrespective of an error.
-	rf.inode.fs.adjustPageAcct(pagesToFill, pagesAlloced)
+	rf.inode.adjustPageAcct(pagesToFill, pagesAlloced)
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -412,8 +420,8 @@ func (rf *regularFile) allocateLocked(ctx context.Context, mode, newSize uint64,
 	// specified by offset and len are guaranteed not to fail because of
 	// lack of disk space."  - fallocate(2)
 	pagesToFill := rf.data.PagesToFill(required, required)
-	if !rf.inode.fs.accountPages(pagesToFill) {
-		return linuxerr.ENOSPC
+	if err := rf.inode.accountPages(pagesToFill, rf.inode.fs.ignoresQuotaLimits(ctx)); err != nil {
+		return err
 	}
 	// Given our definitions in pgalloc, fallocate(2) semantics imply that pages
 	// in the MemoryFile must be committed, in addition to being allocated.
@@ -430,7 +438,7 @@ func (rf *regularFile) allocateLocked(ctx context.Context, mode, newSize uint64,
 	pagesAlloced, err := rf.data.Fill(ctx, required, required, newSize, rf.inode.fs.mf, rf.memoryUsageKind, allocMode, nil /* r */)
 	// f.data.Fill() may fail mid-way. We still want to account any pages that
 	// were allocated, irrespective of an error.
-	rf.inode.fs.adjustPageAcct(pagesToFill, pagesAlloced)
+	rf.inode.adjustPageAcct(pagesToFill, pagesAlloced)
 	if err != nil && err != io.EOF {
 		return err
 	}
@@ -527,6 +535,7 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 	// Perform the write.
 	rw := getRegularFileReadWriter(f, offset, pgalloc.MemoryCgroupIDFromContext(ctx))
+	rw.ignoreQuotaLimits = f.inode.fs.ignoresQuotaLimits(ctx)
 	n, err := src.CopyInTo(ctx, rw)
 
 	f.inode.touchCMtimeLocked()
@@ -574,6 +583,20 @@ func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
 func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
 	file := fd.inode().impl.(*regularFile)
+	if !opts.Private {
+		// F_SEAL_FUTURE_WRITE only prevents new writable shared mappings;
+		// existing ones (including those copied by fork) are unaffected. See
+		// Linux's include/linux/mm.h:seal_check_write().
+		file.dataMu.RLock()
+		seals := file.seals
+		file.dataMu.RUnlock()
+		if seals&linux.F_SEAL_FUTURE_WRITE != 0 {
+			if opts.Perms.Write {
+				return linuxerr.EPERM
+			}
+			opts.MaxPerms.Write = false
+		}
+	}
 	opts.SentryOwnedContent = true
 	return vfs.GenericConfigureMMap(&fd.vfsfd, file, opts)
 }
@@ -600,6 +623,10 @@ type regularFileReadWriter struct {
 	// memCgID is the memory cgroup ID used for accounting the allocated
 	// pages.
 	memCgID uint32
+
+	// ignoreQuotaLimits is true if the allocated pages may exceed the quota
+	// limits of the file's owner.
+	ignoreQuotaLimits bool
 }
 
 var regularFileReadWriterPool = sync.Pool{
@@ -618,6 +645,7 @@ func getRegularFileReadWriter(file *regularFile, offset int64, memCgID uint32) *
 
 func putRegularFileReadWriter(rw *regularFileReadWriter) {
 	rw.file = nil
+	rw.ignoreQuotaLimits = false
 	regularFileReadWriterPool.Put(rw)
 }
 
@@ -695,7 +723,7 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 
 	// Check if seals prevent either file growth or all writes.
 	switch {
-	case rw.file.seals&linux.F_SEAL_WRITE != 0: // Write sealed
+	case rw.file.seals&(linux.F_SEAL_WRITE|linux.F_SEAL_FUTURE_WRITE) != 0: // Write sealed
 		return 0, linuxerr.EPERM
 	case end > rw.file.size.RacyLoad() && rw.file.seals&linux.F_SEAL_GROW != 0: // Grow sealed
 		// When growth is sealed, Linux effectively allows writes which would
@@ -752,10 +780,10 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 			// Allocate memory for the write.
 			gapMR := gap.Range().Intersect(pgMR)
 			pagesToFill := gapMR.Length() / hostarch.PageSize
-			pagesReserved := rw.file.inode.fs.accountPagesPartial(pagesToFill)
+			pagesReserved, err := rw.file.inode.accountPagesPartial(pagesToFill, rw.ignoreQuotaLimits)
 			if pagesReserved == 0 {
 				if done == 0 {
-					retErr = linuxerr.ENOSPC
+					retErr = err
 					goto exitLoop
 				}
 				retErr = nil
@@ -779,7 +807,7 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 			})
 			if err != nil {
 				retErr = err
-				rw.file.inode.fs.unaccountPages(pagesReserved)
+				rw.file.inode.unaccountPages(pagesReserved)
 				goto exitLoop
 			}
 
@@ -834,12 +862,18 @@ func GetSeals(fd *vfs.FileDescription) (uint32, error) {
 	return rf.seals, nil
 }
 
+// allSeals is the set of all supported file seals.
+const allSeals = linux.F_SEAL_SEAL | linux.F_SEAL_SHRINK | linux.F_SEAL_GROW | linux.F_SEAL_WRITE | linux.F_SEAL_FUTURE_WRITE | linux.F_SEAL_EXEC
+
 // AddSeals adds new file seals to a memfd inode.
 func AddSeals(fd *vfs.FileDescription, val uint32) error {
 	f, ok := fd.Impl().(*regularFileFD)
 	if !ok {
 		return linuxerr.EINVAL
 	}
+	if val&^allSeals != 0 {
+		return linuxerr.EINVAL
+	}
 	rf := f.inode().impl.(*regularFile)
 	rf.mapsMu.Lock()
 	defer rf.mapsMu.Unlock()
@@ -851,6 +885,14 @@ func AddSeals(fd *vfs.FileDescription, val uint32) error {
 		return linuxerr.EPERM
 	}
 
+	// Sealing an executable file against exec bit changes also seals it
+	// against writes, so that it is W^X from then on. Linux applies this
+	// after the F_SEAL_WRITE check below, which lets F_SEAL_EXEC add
+	// F_SEAL_WRITE despite active writable mappings; we don't.
+	if val&linux.F_SEAL_EXEC != 0 && rf.inode.mode.Load()&0111 != 0 {
+		val |= linux.F_SEAL_SHRINK | linux.F_SEAL_GROW | linux.F_SEAL_WRITE | linux.F_SEAL_FUTURE_WRITE
+	}
+
 	// F_SEAL_WRITE can only be added if there are no active writable maps.
 	if rf.seals&linux.F_SEAL_WRITE == 0 && val&linux.F_SEAL_WRITE != 0 {
 		if rf.writableMappingPages > 0 {
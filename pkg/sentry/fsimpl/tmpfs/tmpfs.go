@@ -25,6 +25,7 @@
 //		      *** "memmap.Mappable locks taken by Translate" below this point
 //		      regularFile.dataMu
 //		        fs.pagesUsedMu
+//		        fs.quotaMu
 //		  directory.iterMu
 package tmpfs
 
@@ -41,12 +42,14 @@ import (
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/fd"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sentry/vfs/memxattr"
+	"gvisor.dev/gvisor/pkg/usermem"
 )
 
 // Name is the default filesystem name.
@@ -105,9 +108,25 @@ type filesystem struct {
 	// pagesUsed is the number of pages used by this filesystem.
 	pagesUsed atomicbitops.Uint64
 
+	// userXattrSpace is the space used by extended attributes in the user.*
+	// namespace, which unprivileged users can set, as computed by
+	// memxattr.XattrSpace. Like file data, it is limited by maxSizeInPages,
+	// but it is accounted separately since extended attributes are much
+	// smaller than a page.
+	userXattrSpace atomicbitops.Uint64
+
 	// allowXattrPrefix is a set of xattr namespace prefixes that this
 	// tmpfs mount will allow. It is immutable.
 	allowXattrPrefix map[string]struct{}
+
+	// quotaMu protects the contents of quotas and inode.quota.
+	quotaMu quotaMutex `state:"nosave"`
+
+	// quotas holds the disk quotas of each type, indexed by linux.USRQUOTA,
+	// linux.GRPQUOTA and linux.PRJQUOTA. Quotas of a type are nil if they
+	// aren't accounted, which is determined at mount time. quotas is
+	// immutable, but the quotaSets it points to are not.
+	quotas [linux.MAXQUOTAS]*quotaSet
 }
 
 // Name implements vfs.FilesystemType.Name.
@@ -190,13 +209,12 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	disableDefaultSizeLimit := false
 	newFSType := vfs.FilesystemType(&fstype)
 
-	// By default we support only "trusted" and "user" namespaces. Linux
-	// also supports "security" and (if configured) POSIX ACL namespaces
+	// By default we support the "trusted", "user" and "security" namespaces.
+	// Linux also supports (if configured) POSIX ACL namespaces
 	// "system.posix_acl_access" and "system.posix_acl_default".
 	allowXattrPrefix := map[string]struct{}{
-		linux.XATTR_TRUSTED_PREFIX: struct{}{},
-		linux.XATTR_USER_PREFIX:    struct{}{},
-		// The "security" namespace is allowed, but it always returns an error.
+		linux.XATTR_TRUSTED_PREFIX:  struct{}{},
+		linux.XATTR_USER_PREFIX:     struct{}{},
 		linux.XATTR_SECURITY_PREFIX: struct{}{},
 	}
 
@@ -301,6 +319,11 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		}
 	}
 
+	quotas, err := parseQuotaOptions(ctx, mopts)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if len(mopts) != 0 {
 		ctx.Warningf("tmpfs.FilesystemType.GetFilesystem: unknown options: %v", mopts)
 		return nil, nil, linuxerr.EINVAL
@@ -326,6 +349,7 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		maxFilenameLen:   linux.NAME_MAX,
 		maxSizeInPages:   maxSizeInPages,
 		allowXattrPrefix: allowXattrPrefix,
+		quotas:           quotas,
 	}
 	fs.vfsfs.Init(vfsObj, newFSType, &fs)
 	if tmpfsOptsOk && tmpfsOpts.MaxFilenameLen > 0 {
@@ -344,6 +368,10 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		fs.vfsfs.DecRef(ctx)
 		return nil, nil, fmt.Errorf("invalid tmpfs root file type: %#o", rootFileType)
 	}
+	// Like Linux, charge the root inode to its owner regardless of limits.
+	if err := root.inode.initQuota(0 /* space */, true /* ignoreLimits */); err != nil {
+		panic(fmt.Sprintf("charging root inode to quotas: %v", err))
+	}
 	fs.root = root
 	return &fs.vfsfs, &root.vfsd, nil
 }
@@ -498,8 +526,6 @@ type inode struct {
 	refs inodeRefs
 
 	// xattrs implements extended attributes.
-	//
-	// TODO(b/148380782): Support xattrs other than user.*
 	xattrs memxattr.SimpleExtendedAttributes
 
 	// Inode metadata. Writing multiple fields atomically requires holding
@@ -511,6 +537,16 @@ type inode struct {
 	gid   atomicbitops.Uint32 // auth.KGID, but ...
 	ino   uint64              // immutable
 
+	// projid is the inode's project ID, and xflags its FS_XFLAG_* flags, as
+	// set by FS_IOC_FSSETXATTR. They are protected by mu, but may also be
+	// read using atomic operations.
+	projid atomicbitops.Uint32
+	xflags atomicbitops.Uint32
+
+	// quota is the inode's quota accounting state. It is protected by
+	// filesystem.quotaMu.
+	quota inodeQuota
+
 	// Linux's tmpfs has no concept of btime.
 	atime atomicbitops.Int64 // nanoseconds
 	ctime atomicbitops.Int64 // nanoseconds
@@ -538,6 +574,13 @@ func (i *inode) init(impl any, fs *filesystem, kuid auth.KUID, kgid auth.KGID, m
 			mode |= linux.S_ISGID
 		}
 	}
+	// Inherit the project ID as in ext4's fs/ext4/ialloc.c:__ext4_new_inode().
+	if parentDir != nil && parentDir.inode.xflags.Load()&linux.FS_XFLAG_PROJINHERIT != 0 {
+		i.projid = atomicbitops.FromUint32(parentDir.inode.projid.Load())
+		if mode.IsDir() {
+			i.xflags = atomicbitops.FromUint32(linux.FS_XFLAG_PROJINHERIT)
+		}
+	}
 
 	i.fs = fs
 	i.mode = atomicbitops.FromUint32(uint32(mode))
@@ -611,7 +654,10 @@ func (i *inode) decRef(ctx context.Context) {
 			pagesDec := impl.data.DropAll(i.fs.mf)
 			impl.inode.fs.unaccountPages(pagesDec)
 		}
-
+		if space := i.xattrs.SpaceUsed(linux.XATTR_USER_PREFIX); space != 0 {
+			i.fs.userXattrSpace.Add(^uint64(space - 1))
+		}
+		i.releaseQuota()
 	})
 }
 
@@ -686,6 +732,29 @@ func (i *inode) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs.
 	)
 	clearSID := false
 	mask := stat.Mask
+	if rf, ok := i.impl.(*regularFile); ok && mask&linux.STATX_MODE != 0 {
+		// F_SEAL_EXEC prevents changes to the file's exec bits.
+		rf.dataMu.RLock()
+		seals := rf.seals
+		rf.dataMu.RUnlock()
+		if seals&linux.F_SEAL_EXEC != 0 && (uint16(i.mode.Load())^stat.Mode)&0111 != 0 {
+			return linuxerr.EPERM
+		}
+	}
+	if mask&(linux.STATX_UID|linux.STATX_GID) != 0 {
+		// Move the inode's usage to its new owner's quotas first, since this
+		// may fail.
+		ids := i.quotaIDs()
+		if mask&linux.STATX_UID != 0 {
+			ids[linux.USRQUOTA] = stat.UID
+		}
+		if mask&linux.STATX_GID != 0 {
+			ids[linux.GRPQUOTA] = stat.GID
+		}
+		if err := i.transferQuota(ids, i.fs.ignoresQuotaLimits(ctx)); err != nil {
+			return err
+		}
+	}
 	if mask&linux.STATX_SIZE != 0 {
 		switch impl := i.impl.(type) {
 		case *regularFile:
@@ -881,8 +950,10 @@ func (i *inode) getXattr(creds *auth.Credentials, opts *vfs.GetXattrOptions) (st
 	mode := linux.FileMode(i.mode.Load())
 	kuid := auth.KUID(i.uid.Load())
 	kgid := auth.KGID(i.gid.Load())
-	if err := vfs.GenericCheckPermissions(creds, vfs.MayRead, mode, kuid, kgid); err != nil {
-		return "", err
+	if vfs.XattrNeedsInodePermissions(opts.Name) {
+		if err := vfs.GenericCheckPermissions(creds, vfs.MayRead, mode, kuid, kgid); err != nil {
+			return "", err
+		}
 	}
 	return i.xattrs.GetXattr(creds, mode, kuid, opts)
 }
@@ -894,10 +965,12 @@ func (i *inode) setXattr(creds *auth.Credentials, opts *vfs.SetXattrOptions) err
 	mode := linux.FileMode(i.mode.Load())
 	kuid := auth.KUID(i.uid.Load())
 	kgid := auth.KGID(i.gid.Load())
-	if err := vfs.GenericCheckPermissions(creds, vfs.MayWrite, mode, kuid, kgid); err != nil {
-		return err
+	if vfs.XattrNeedsInodePermissions(opts.Name) {
+		if err := vfs.GenericCheckPermissions(creds, vfs.MayWrite, mode, kuid, kgid); err != nil {
+			return err
+		}
 	}
-	return i.xattrs.SetXattr(creds, mode, kuid, opts)
+	return i.xattrs.SetXattr(creds, mode, kuid, opts, i.xattrCharge(opts.Name))
 }
 
 func (i *inode) removeXattr(creds *auth.Credentials, name string) error {
@@ -907,10 +980,45 @@ func (i *inode) removeXattr(creds *auth.Credentials, name string) error {
 	mode := linux.FileMode(i.mode.Load())
 	kuid := auth.KUID(i.uid.Load())
 	kgid := auth.KGID(i.gid.Load())
-	if err := vfs.GenericCheckPermissions(creds, vfs.MayWrite, mode, kuid, kgid); err != nil {
-		return err
+	if vfs.XattrNeedsInodePermissions(name) {
+		if err := vfs.GenericCheckPermissions(creds, vfs.MayWrite, mode, kuid, kgid); err != nil {
+			return err
+		}
+	}
+	return i.xattrs.RemoveXattr(creds, mode, kuid, name, i.xattrCharge(name))
+}
+
+// xattrCharge returns the function that accounts for the space used by the
+// extended attribute name, or nil if it isn't accounted. Only attributes in
+// the user.* namespace are accounted, since only privileged users can set
+// other attributes.
+func (i *inode) xattrCharge(name string) func(delta int64) error {
+	if !strings.HasPrefix(name, linux.XATTR_USER_PREFIX) {
+		return nil
+	}
+	return i.fs.chargeUserXattrSpace
+}
+
+// chargeUserXattrSpace changes fs.userXattrSpace by delta. It returns ENOSPC
+// if the filesystem's size limit would be exceeded.
+func (fs *filesystem) chargeUserXattrSpace(delta int64) error {
+	if delta <= 0 {
+		fs.userXattrSpace.Add(^uint64(-delta - 1))
+		return nil
+	}
+	limit := uint64(math.MaxUint64)
+	if fs.maxSizeInPages <= math.MaxUint64/hostarch.PageSize {
+		limit = fs.maxSizeInPages * hostarch.PageSize
+	}
+	for {
+		used := fs.userXattrSpace.Load()
+		if used > limit || limit-used < uint64(delta) {
+			return linuxerr.ENOSPC
+		}
+		if fs.userXattrSpace.CompareAndSwap(used, used+uint64(delta)) {
+			return nil
+		}
 	}
-	return i.xattrs.RemoveXattr(creds, mode, kuid, name)
 }
 
 // fileDescription is embedded by tmpfs implementations of
@@ -972,6 +1080,41 @@ func (fd *fileDescription) RemoveXattr(ctx context.Context, name string) error {
 	return fd.dentry().inode.removeXattr(auth.CredentialsFromContext(ctx), name)
 }
 
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *fileDescription) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	i := fd.inode()
+	switch args[1].Uint() {
+	case linux.FS_IOC_FSGETXATTR:
+		fsx := linux.Fsxattr{
+			XFlags: i.xflags.Load(),
+			ProjID: i.projid.Load(),
+		}
+		buf := make([]byte, fsx.SizeBytes())
+		fsx.MarshalBytes(buf)
+		_, err := uio.CopyOut(ctx, args[2].Pointer(), buf, usermem.IOOpts{})
+		return 0, err
+
+	case linux.FS_IOC_FSSETXATTR:
+		var fsx linux.Fsxattr
+		buf := make([]byte, fsx.SizeBytes())
+		if _, err := uio.CopyIn(ctx, args[2].Pointer(), buf, usermem.IOOpts{}); err != nil {
+			return 0, err
+		}
+		fsx.UnmarshalBytes(buf)
+		mnt := fd.vfsfd.Mount()
+		if err := mnt.CheckBeginWrite(); err != nil {
+			return 0, err
+		}
+		defer mnt.EndWrite()
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		return 0, i.setProjectLocked(ctx, auth.CredentialsFromContext(ctx), &fsx)
+
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
 // Sync implements vfs.FileDescriptionImpl.Sync. It does nothing because all
 // filesystem state is in-memory.
 func (*fileDescription) Sync(context.Context) error {
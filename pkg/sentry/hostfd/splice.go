@@ -0,0 +1,79 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostfd
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Spliceable is implemented by file descriptions that are backed by a host
+// file descriptor that may be passed directly to splice(2) and tee(2).
+type Spliceable interface {
+	// SpliceHostFD returns the host file descriptor that backs the file
+	// description, and whether it is a pipe. ok is false if the host file
+	// descriptor can't be used directly, e.g. because the file description
+	// buffers data in the sentry.
+	SpliceHostFD() (fd int32, isPipe bool, ok bool)
+}
+
+// Splice moves up to count bytes from the host file descriptor src to the
+// host file descriptor dst with splice(2). At least one of them must be a
+// pipe. Splice never blocks; it returns EAGAIN instead.
+func Splice(dst, src int32, count int64) (int64, error) {
+	for {
+		n, err := unix.Splice(int(src), nil, int(dst), nil, int(count), unix.SPLICE_F_NONBLOCK)
+		if err == unix.EINTR {
+			continue
+		}
+		return n, err
+	}
+}
+
+// Tee duplicates up to count bytes from the host pipe src to the host pipe
+// dst with tee(2). Tee never blocks; it returns EAGAIN instead.
+func Tee(dst, src int32, count int64) (int64, error) {
+	for {
+		n, err := unix.Tee(int(src), int(dst), int(count), unix.SPLICE_F_NONBLOCK)
+		if err == unix.EINTR {
+			continue
+		}
+		return n, err
+	}
+}
+
+// SendfileSource is implemented by regular file descriptions whose contents
+// may be read directly from a host file descriptor by sendfile(2).
+type SendfileSource interface {
+	// SendfileTo sends up to count bytes of the file, starting at offset, to
+	// the host file descriptor dst with Sendfile. ok is false if the file's
+	// contents can't be read directly from a host file descriptor, e.g.
+	// because they are cached in the sentry.
+	SendfileTo(dst int32, offset, count int64) (n int64, ok bool, err error)
+}
+
+// Sendfile copies up to count bytes starting at offset from the host file
+// descriptor src to the host file descriptor dst with sendfile(2). The offset
+// of src is not changed. Sendfile never blocks if dst is non-blocking; it
+// returns EAGAIN instead.
+func Sendfile(dst, src int32, offset, count int64) (int64, error) {
+	for {
+		off := offset
+		n, err := unix.Sendfile(int(dst), int(src), &off, int(count))
+		if err == unix.EINTR {
+			continue
+		}
+		return int64(n), err
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/eventfd"
 	"gvisor.dev/gvisor/pkg/log"
 )
@@ -94,3 +95,63 @@ func NotifyCurrentMemcgPressureCallback(f func(), level string) (func(), error)
 		<-stopCh
 	}, nil
 }
+
+// NotifyPressureTriggerCallback requests that f is called whenever the
+// pressure stall information (PSI) trigger registered on file fires, as
+// specified by Linux's Documentation/accounting/psi.rst. file must be a PSI
+// file, such as a cgroup v2 memory.pressure file, to which a trigger has
+// already been written; this allows the trigger to be set up by a process
+// that can see the host cgroupfs. Ownership of file is transferred to
+// NotifyPressureTriggerCallback.
+//
+// If NotifyPressureTriggerCallback succeeds, it returns a function that
+// terminates the requested notifications. This function may be called at most
+// once.
+func NotifyPressureTriggerCallback(file *os.File, f func()) (func(), error) {
+	eventFD, err := eventfd.Create()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	log.Debugf("Receiving pressure stall notifications from %s", file.Name())
+	stopCh := make(chan struct{})
+	go func() { // S/R-SAFE: f provides synchronization if necessary
+		defer close(stopCh)
+		defer eventFD.Close()
+		defer file.Close()
+		fds := []unix.PollFd{
+			{Fd: int32(file.Fd()), Events: unix.POLLPRI},
+			{Fd: int32(eventFD.FD()), Events: unix.POLLIN},
+		}
+		for {
+			fds[0].Revents, fds[1].Revents = 0, 0
+			if _, err := unix.Poll(fds, -1); err != nil {
+				if err == unix.EINTR {
+					continue
+				}
+				panic(fmt.Sprintf("failed to poll pressure stall trigger: %v", err))
+			}
+			if fds[1].Revents != 0 {
+				// The stop function below was called.
+				return
+			}
+			if fds[0].Revents&unix.POLLERR != 0 {
+				// The monitored cgroup has been removed. Wait for the stop
+				// function to be called.
+				log.Warningf("Pressure stall trigger on %s is no longer valid", file.Name())
+				if err := eventFD.Wait(); err != nil {
+					panic(fmt.Sprintf("failed to read from pressure stall eventfd: %v", err))
+				}
+				return
+			}
+			if fds[0].Revents&unix.POLLPRI != 0 {
+				f()
+			}
+		}
+	}()
+	return func() {
+		eventFD.Notify()
+		<-stopCh
+	}, nil
+}
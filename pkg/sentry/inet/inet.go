@@ -75,6 +75,22 @@ type Stack interface {
 	// SetTCPRecovery attempts to change TCP loss detection algorithm.
 	SetTCPRecovery(recovery TCPLossRecovery) error
 
+	// IPv6SegmentRoutingEnabled returns true if IPv6 Segment Routing Headers
+	// are processed.
+	IPv6SegmentRoutingEnabled() (bool, error)
+
+	// SetIPv6SegmentRoutingEnabled attempts to change IPv6 Segment Routing
+	// Header processing settings.
+	SetIPv6SegmentRoutingEnabled(enabled bool) error
+
+	// IPv6ExtensionHeaderLimits returns the limits on IPv6 options extension
+	// headers.
+	IPv6ExtensionHeaderLimits() (IPv6ExtensionHeaderLimits, error)
+
+	// SetIPv6ExtensionHeaderLimits attempts to change the limits on IPv6
+	// options extension headers.
+	SetIPv6ExtensionHeaderLimits(limits IPv6ExtensionHeaderLimits) error
+
 	// Statistics reports stack statistics.
 	Statistics(stat any, arg string) error
 
@@ -170,6 +186,26 @@ type TCPBufferSize struct {
 	Max int
 }
 
+// IPv6ExtensionHeaderLimits contains settings limiting the IPv6 Hop-by-Hop
+// and Destination Options extension headers accepted by the stack. A negative
+// number of options also disallows options unknown to the stack.
+//
+// +stateify savable
+type IPv6ExtensionHeaderLimits struct {
+	// MaxHopByHopOptions is the maximum number of Hop-by-Hop options.
+	MaxHopByHopOptions int32
+
+	// MaxHopByHopLength is the maximum length of a Hop-by-Hop Options header.
+	MaxHopByHopLength int32
+
+	// MaxDestinationOptions is the maximum number of Destination options.
+	MaxDestinationOptions int32
+
+	// MaxDestinationLength is the maximum length of a Destination Options
+	// header.
+	MaxDestinationLength int32
+}
+
 // StatDev describes one line of /proc/net/dev, i.e., stats for one network
 // interface.
 type StatDev [16]uint64
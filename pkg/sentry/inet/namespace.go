@@ -40,6 +40,11 @@ type Namespace struct {
 	isRoot bool
 
 	userNS *auth.UserNamespace
+
+	// abstractSockets tracks abstract unix sockets bound in this network
+	// namespace. Like Linux, abstract socket names are scoped to a network
+	// namespace.
+	abstractSockets *AbstractSocketNamespace
 }
 
 // NewRootNamespace creates the root network namespace, with creator
@@ -47,10 +52,11 @@ type Namespace struct {
 // networking will function if the network is namespaced.
 func NewRootNamespace(stack Stack, creator NetworkStackCreator, userNS *auth.UserNamespace) *Namespace {
 	n := &Namespace{
-		stack:   stack,
-		creator: creator,
-		isRoot:  true,
-		userNS:  userNS,
+		stack:           stack,
+		creator:         creator,
+		isRoot:          true,
+		userNS:          userNS,
+		abstractSockets: NewAbstractSocketNamespace(),
 	}
 	return n
 }
@@ -73,8 +79,9 @@ func (n *Namespace) GetInode() *nsfs.Inode {
 // NewNamespace creates a new network namespace from the root.
 func NewNamespace(root *Namespace, userNS *auth.UserNamespace) *Namespace {
 	n := &Namespace{
-		creator: root.creator,
-		userNS:  userNS,
+		creator:         root.creator,
+		userNS:          userNS,
+		abstractSockets: NewAbstractSocketNamespace(),
 	}
 	n.init()
 	return n
@@ -108,6 +115,11 @@ func (n *Namespace) Stack() Stack {
 	return n.stack
 }
 
+// AbstractSockets returns the abstract unix socket namespace of n.
+func (n *Namespace) AbstractSockets() *AbstractSocketNamespace {
+	return n.abstractSockets
+}
+
 // IsRoot returns whether n is the root network namespace.
 func (n *Namespace) IsRoot() bool {
 	return n.isRoot
@@ -34,6 +34,8 @@ type TestStack struct {
 	TCPSACKFlag       bool
 	Recovery          TCPLossRecovery
 	IPForwarding      bool
+	SegmentRouting    bool
+	ExtHdrLimits      IPv6ExtensionHeaderLimits
 }
 
 // NewTestStack returns a TestStack with no network interfaces. The value of
@@ -139,6 +141,28 @@ func (s *TestStack) SetTCPRecovery(recovery TCPLossRecovery) error {
 	return nil
 }
 
+// IPv6SegmentRoutingEnabled implements Stack.
+func (s *TestStack) IPv6SegmentRoutingEnabled() (bool, error) {
+	return s.SegmentRouting, nil
+}
+
+// SetIPv6SegmentRoutingEnabled implements Stack.
+func (s *TestStack) SetIPv6SegmentRoutingEnabled(enabled bool) error {
+	s.SegmentRouting = enabled
+	return nil
+}
+
+// IPv6ExtensionHeaderLimits implements Stack.
+func (s *TestStack) IPv6ExtensionHeaderLimits() (IPv6ExtensionHeaderLimits, error) {
+	return s.ExtHdrLimits, nil
+}
+
+// SetIPv6ExtensionHeaderLimits implements Stack.
+func (s *TestStack) SetIPv6ExtensionHeaderLimits(limits IPv6ExtensionHeaderLimits) error {
+	s.ExtHdrLimits = limits
+	return nil
+}
+
 // Statistics implements Stack.
 func (s *TestStack) Statistics(stat any, arg string) error {
 	return nil
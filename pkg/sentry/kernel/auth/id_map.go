@@ -223,9 +223,10 @@ func (ns *UserNamespace) SetGIDMap(ctx context.Context, entries []IDMapEntry) er
 		}
 		// "In the case of gid_map, use of the setgroups(2) system call must
 		// first be denied by writing "deny" to the /proc/[pid]/setgroups file
-		// (see below) before writing to gid_map." (This file isn't implemented
-		// in the version of Linux we're emulating; see comment in
-		// UserNamespace.)
+		// (see below) before writing to gid_map."
+		if !ns.setgroupsDenied {
+			return linuxerr.EPERM
+		}
 	}
 	if err := ns.trySetGIDMap(entries); err != nil {
 		ns.gidMapFromParent.RemoveAll()
@@ -270,6 +271,36 @@ func (ns *UserNamespace) GIDMap() []IDMapEntry {
 	return ns.getIDMap(&ns.gidMapToParent)
 }
 
+// UIDMapIn returns the user ID mappings configured for ns as shown to a reader
+// in user namespace viewer, consistent with Linux's
+// kernel/user_namespace.c:uid_m_show(). Unless viewer is ns or ns' parent,
+// each entry's FirstParentID is translated into viewer, or NoID if it has no
+// mapping there.
+func (ns *UserNamespace) UIDMapIn(viewer *UserNamespace) []IDMapEntry {
+	entries := ns.UIDMap()
+	if ns.parent == nil || viewer == ns || viewer == ns.parent {
+		return entries
+	}
+	for i := range entries {
+		kuid := ns.parent.MapToKUID(UID(entries[i].FirstParentID))
+		entries[i].FirstParentID = uint32(kuid.In(viewer))
+	}
+	return entries
+}
+
+// GIDMapIn is the equivalent of UIDMapIn for group IDs.
+func (ns *UserNamespace) GIDMapIn(viewer *UserNamespace) []IDMapEntry {
+	entries := ns.GIDMap()
+	if ns.parent == nil || viewer == ns || viewer == ns.parent {
+		return entries
+	}
+	for i := range entries {
+		kgid := ns.parent.MapToKGID(GID(entries[i].FirstParentID))
+		entries[i].FirstParentID = uint32(kgid.In(viewer))
+	}
+	return entries
+}
+
 func (ns *UserNamespace) getIDMap(m *idMapSet) []IDMapEntry {
 	ns.mu.Lock()
 	defer ns.mu.Unlock()
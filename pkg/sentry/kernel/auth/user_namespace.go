@@ -51,7 +51,10 @@ type UserNamespace struct {
 	gidMapFromParent idMapSet
 	gidMapToParent   idMapSet
 
-	// TODO(b/27454212): Support disabling setgroups(2).
+	// setgroupsDenied is true if setgroups(2) has been disabled in this
+	// namespace by writing "deny" to /proc/[pid]/setgroups. It is protected by
+	// mu.
+	setgroupsDenied bool
 }
 
 // NewRootUserNamespace returns a UserNamespace that is appropriate for a
@@ -130,5 +133,49 @@ func (c *Credentials) NewChildUserNamespace() (*UserNamespace, error) {
 		// "When a user namespace is created, it starts without a mapping of
 		// user IDs (group IDs) to the parent user namespace." -
 		// user_namespaces(7)
+		//
+		// "The setting in a child user namespace is inherited from the
+		// parent." - user_namespaces(7), about /proc/[pid]/setgroups.
+		setgroupsDenied: c.UserNamespace.SetgroupsDenied(),
 	}, nil
 }
+
+// SetgroupsAllowed returns true if setgroups(2) may be used in ns. This is
+// consistent with Linux's kernel/user_namespace.c:userns_may_setgroups().
+func (ns *UserNamespace) SetgroupsAllowed() bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	// "It is not permitted to use setgroups until the GID map has been
+	// established."
+	return !ns.gidMapToParent.IsEmpty() && !ns.setgroupsDenied
+}
+
+// SetgroupsDenied returns true if setgroups(2) has been disabled in ns.
+func (ns *UserNamespace) SetgroupsDenied() bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.setgroupsDenied
+}
+
+// SetSetgroups enables or disables setgroups(2) in ns, as for a write to
+// /proc/[pid]/setgroups.
+func (ns *UserNamespace) SetSetgroups(allow bool) error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if allow {
+		// "Once "deny" has been written to the file, it is no longer possible
+		// to write "allow"." Writing "allow" when setgroups is already
+		// allowed is a no-op.
+		if ns.setgroupsDenied {
+			return linuxerr.EPERM
+		}
+		return nil
+	}
+	// "It is not permitted to write "deny" once the GID map has been set,
+	// since the process may have already called setgroups(2)."
+	if !ns.gidMapFromParent.IsEmpty() {
+		return linuxerr.EPERM
+	}
+	ns.setgroupsDenied = true
+	return nil
+}
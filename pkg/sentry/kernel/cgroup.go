@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"sort"
 
@@ -266,6 +267,11 @@ type cgroupFS interface {
 	// RootCgroup returns the root cgroup of this instance. This returns the
 	// actual root, and ignores any overrides setting an effective root.
 	RootCgroup() Cgroup
+
+	// CreateCgroup creates the cgroup at path p, relative to the root of this
+	// instance, along with any missing ancestors. Existing cgroups are left
+	// untouched.
+	CreateCgroup(ctx context.Context, p fspath.Path) error
 }
 
 // CgroupRegistry tracks the active set of cgroup controllers on the system.
@@ -412,6 +418,51 @@ func (r *CgroupRegistry) FindCgroup(ctx context.Context, ctype CgroupControllerT
 	return rootCG.Walk(ctx, k.VFS(), p)
 }
 
+// ErrCgroupControllerInactive is returned by CreateCgroup if the controller
+// isn't attached to any hierarchy.
+var ErrCgroupControllerInactive = errors.New("controller not active")
+
+// CreateCgroup is like FindCgroup, but creates the cgroup and any missing
+// ancestors if they don't exist, as mkdir -p would. Unlike FindCgroup, the
+// hierarchy may have other controllers attached besides ctype. CreateCgroup
+// takes a reference on the returned cgroup, which is transferred to the
+// caller.
+func (r *CgroupRegistry) CreateCgroup(ctx context.Context, ctype CgroupControllerType, path string) (Cgroup, error) {
+	p := fspath.Parse(path)
+	if !p.Absolute {
+		return Cgroup{}, fmt.Errorf("path must be absolute")
+	}
+	vfsfs := r.hierarchyWithController(ctype)
+	if vfsfs == nil {
+		return Cgroup{}, ErrCgroupControllerInactive
+	}
+	defer vfsfs.DecRef(ctx)
+	cgfs := vfsfs.Impl().(cgroupFS)
+	if err := cgfs.CreateCgroup(ctx, p); err != nil {
+		return Cgroup{}, err
+	}
+	rootCG := cgfs.RootCgroup()
+	if !p.HasComponents() {
+		rootCG.IncRef()
+		return rootCG, nil
+	}
+	return rootCG.Walk(ctx, KernelFromContext(ctx).VFS(), p)
+}
+
+// hierarchyWithController returns the filesystem of the hierarchy ctype is
+// attached to, or nil if there is none. It takes a reference on the returned
+// filesystem, which is transferred to the caller.
+func (r *CgroupRegistry) hierarchyWithController(ctype CgroupControllerType) *vfs.Filesystem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, h := range r.hierarchies {
+		if _, ok := h.controllers[ctype]; ok && h.fs.TryIncRef() {
+			return h.fs
+		}
+	}
+	return nil
+}
+
 // Register registers the provided set of controllers with the registry as a new
 // hierarchy. If any controller is already registered, the function returns an
 // error without modifying the registry. Register sets the hierarchy ID for the
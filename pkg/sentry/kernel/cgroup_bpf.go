@@ -0,0 +1,305 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/ebpf"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// maxCgroupBPFPrograms is the maximum number of programs attached to a cgroup
+// for a single attach type, and is equal to Linux's BPF_CGROUP_MAX_PROGS.
+const maxCgroupBPFPrograms = 64
+
+// cgroupBPFKey identifies the programs attached to a cgroup for one attach
+// type.
+//
+// +stateify savable
+type cgroupBPFKey struct {
+	cgroupID   uint32
+	attachType uint32
+}
+
+// cgroupBPFPrograms are the programs attached to a cgroup for one attach
+// type.
+//
+// +stateify savable
+type cgroupBPFPrograms struct {
+	// flags are the linux.BPF_F_ALLOW_* flags that the programs were attached
+	// with.
+	flags uint32
+
+	// progs are the attached programs, in attachment order.
+	progs []*ebpf.Program
+}
+
+// cgroupBPF tracks the eBPF programs attached to cgroups with
+// BPF_PROG_ATTACH.
+//
+// Programs stay attached to a cgroup until they are detached, even after the
+// cgroup is removed. Since cgroup IDs are never reused, programs attached to
+// a removed cgroup never run again.
+//
+// +stateify savable
+type cgroupBPF struct {
+	// mu protects the fields below, except as noted.
+	mu sync.Mutex `state:"nosave"`
+
+	// lastProgramID is the ID of the last loaded program.
+	lastProgramID uint32
+
+	// attached maps cgroups and attach types to attached programs. Entries
+	// are never empty.
+	attached map[cgroupBPFKey]*cgroupBPFPrograms
+
+	// numAttached is len(attached). It can be read without holding mu, so
+	// that sockets can skip looking up cgroup programs when none are
+	// attached.
+	numAttached atomicbitops.Int32
+
+	// generation is incremented each time attached changes. It can be read
+	// without holding mu, so that sockets can cache their effective programs.
+	generation atomicbitops.Uint64
+}
+
+// NewBPFProgramID returns a new, unique eBPF program ID.
+func (k *Kernel) NewBPFProgramID() uint32 {
+	k.cgroupBPF.mu.Lock()
+	defer k.cgroupBPF.mu.Unlock()
+	k.cgroupBPF.lastProgramID++
+	return k.cgroupBPF.lastProgramID
+}
+
+// cgroupBPFChangedLocked must be called after k.cgroupBPF.attached changes.
+//
+// Preconditions: k.cgroupBPF.mu must be locked.
+func (k *Kernel) cgroupBPFChangedLocked() {
+	k.cgroupBPF.numAttached.Store(int32(len(k.cgroupBPF.attached)))
+	k.cgroupBPF.generation.Add(1)
+}
+
+// CgroupIDChain returns the IDs of c and its ancestors, starting with c and
+// ending with the root of its hierarchy.
+func CgroupIDChain(c Cgroup) []uint32 {
+	ids := []uint32{c.ID()}
+	for d := c.Dentry.Parent(); d != nil; d = d.Parent() {
+		cg, ok := d.Inode().(CgroupImpl)
+		if !ok {
+			break
+		}
+		ids = append(ids, cg.ID())
+	}
+	return ids
+}
+
+// CgroupIDChains returns the result of CgroupIDChain for each of t's cgroups.
+func (t *Task) CgroupIDChains() [][]uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	chains := make([][]uint32, 0, len(t.cgroups))
+	for c := range t.cgroups {
+		chains = append(chains, CgroupIDChain(c))
+	}
+	return chains
+}
+
+// AttachCgroupBPF attaches prog to cg for the given attach type. flags are
+// the linux.BPF_F_* flags of BPF_PROG_ATTACH. If flags includes
+// linux.BPF_F_REPLACE, replace is the program that prog replaces.
+func (k *Kernel) AttachCgroupBPF(cg Cgroup, attachType uint32, prog, replace *ebpf.Program, flags uint32) error {
+	if flags&^(linux.BPF_F_ALLOW_OVERRIDE|linux.BPF_F_ALLOW_MULTI|linux.BPF_F_REPLACE) != 0 {
+		return linuxerr.EINVAL
+	}
+	if flags&linux.BPF_F_ALLOW_OVERRIDE != 0 && flags&linux.BPF_F_ALLOW_MULTI != 0 {
+		return linuxerr.EINVAL
+	}
+	if (flags&linux.BPF_F_REPLACE != 0) != (replace != nil) || (replace != nil && flags&linux.BPF_F_ALLOW_MULTI == 0) {
+		return linuxerr.EINVAL
+	}
+	attachFlags := flags &^ linux.BPF_F_REPLACE
+	chain := CgroupIDChain(cg)
+
+	k.cgroupBPF.mu.Lock()
+	defer k.cgroupBPF.mu.Unlock()
+	// As in Linux's kernel/bpf/cgroup.c:hierarchy_allows_attach(), programs
+	// attached to an ancestor without flags can't be overridden.
+	for _, id := range chain[1:] {
+		if a, ok := k.cgroupBPF.attached[cgroupBPFKey{cgroupID: id, attachType: attachType}]; ok && a.flags == 0 {
+			return linuxerr.EPERM
+		}
+	}
+	if k.cgroupBPF.attached == nil {
+		k.cgroupBPF.attached = make(map[cgroupBPFKey]*cgroupBPFPrograms)
+	}
+	key := cgroupBPFKey{cgroupID: cg.ID(), attachType: attachType}
+	a, ok := k.cgroupBPF.attached[key]
+	if !ok {
+		k.cgroupBPF.attached[key] = &cgroupBPFPrograms{
+			flags: attachFlags,
+			progs: []*ebpf.Program{prog},
+		}
+		k.cgroupBPFChangedLocked()
+		return nil
+	}
+	// As in Linux's kernel/bpf/cgroup.c:__cgroup_bpf_attach(), programs
+	// attached with different flags can't be mixed.
+	if a.flags != attachFlags {
+		return linuxerr.EPERM
+	}
+	if attachFlags&linux.BPF_F_ALLOW_MULTI == 0 {
+		a.progs[0] = prog
+		k.cgroupBPFChangedLocked()
+		return nil
+	}
+	replaceIdx := -1
+	for i, p := range a.progs {
+		if p == prog {
+			return linuxerr.EEXIST
+		}
+		if p == replace {
+			replaceIdx = i
+		}
+	}
+	if replace != nil {
+		if replaceIdx < 0 {
+			return linuxerr.ENOENT
+		}
+		a.progs[replaceIdx] = prog
+		k.cgroupBPFChangedLocked()
+		return nil
+	}
+	if len(a.progs) >= maxCgroupBPFPrograms {
+		return linuxerr.E2BIG
+	}
+	a.progs = append(a.progs, prog)
+	k.cgroupBPFChangedLocked()
+	return nil
+}
+
+// DetachCgroupBPF detaches prog from cg for the given attach type. prog may be
+// nil if programs were attached without linux.BPF_F_ALLOW_MULTI, in which
+// case the attached program is detached.
+func (k *Kernel) DetachCgroupBPF(cg Cgroup, attachType uint32, prog *ebpf.Program) error {
+	k.cgroupBPF.mu.Lock()
+	defer k.cgroupBPF.mu.Unlock()
+	key := cgroupBPFKey{cgroupID: cg.ID(), attachType: attachType}
+	a, ok := k.cgroupBPF.attached[key]
+	if !ok {
+		return linuxerr.ENOENT
+	}
+	if a.flags&linux.BPF_F_ALLOW_MULTI == 0 {
+		if prog != nil && a.progs[0] != prog {
+			return linuxerr.ENOENT
+		}
+		delete(k.cgroupBPF.attached, key)
+		k.cgroupBPFChangedLocked()
+		return nil
+	}
+	if prog == nil {
+		return linuxerr.EINVAL
+	}
+	for i, p := range a.progs {
+		if p == prog {
+			// Don't modify a.progs in place, since it may be shared
+			// with callers of CgroupBPFPrograms.
+			a.progs = append(a.progs[:i:i], a.progs[i+1:]...)
+			if len(a.progs) == 0 {
+				delete(k.cgroupBPF.attached, key)
+			}
+			k.cgroupBPFChangedLocked()
+			return nil
+		}
+	}
+	return linuxerr.ENOENT
+}
+
+// CgroupBPFPrograms returns the programs attached to cg for the given attach
+// type, and the flags they were attached with.
+func (k *Kernel) CgroupBPFPrograms(cg Cgroup, attachType uint32) ([]*ebpf.Program, uint32) {
+	k.cgroupBPF.mu.Lock()
+	defer k.cgroupBPF.mu.Unlock()
+	a, ok := k.cgroupBPF.attached[cgroupBPFKey{cgroupID: cg.ID(), attachType: attachType}]
+	if !ok {
+		return nil, 0
+	}
+	return append([]*ebpf.Program(nil), a.progs...), a.flags
+}
+
+// CgroupBPFAttached returns true if any programs are attached to cgroups.
+func (k *Kernel) CgroupBPFAttached() bool {
+	return k.cgroupBPF.numAttached.Load() != 0
+}
+
+// CgroupBPFGeneration returns a value that changes each time programs are
+// attached to or detached from cgroups.
+func (k *Kernel) CgroupBPFGeneration() uint64 {
+	return k.cgroupBPF.generation.Load()
+}
+
+// EffectiveCgroupBPFPrograms returns the programs that run for the given
+// attach type on the traffic of sockets in the cgroups with the given ID
+// chains (see CgroupIDChain), in the order in which they run.
+//
+// As in Linux's kernel/bpf/cgroup.c:compute_effective_progs(), the programs
+// of each chain are collected from the cgroup up to the root. The programs of
+// an ancestor are only included if no programs were collected yet, or if
+// they were attached with linux.BPF_F_ALLOW_MULTI.
+func (k *Kernel) EffectiveCgroupBPFPrograms(chains [][]uint32, attachType uint32) []*ebpf.Program {
+	if !k.CgroupBPFAttached() {
+		return nil
+	}
+	k.cgroupBPF.mu.Lock()
+	defer k.cgroupBPF.mu.Unlock()
+	var progs []*ebpf.Program
+	for _, chain := range chains {
+		n := 0
+		for _, id := range chain {
+			a, ok := k.cgroupBPF.attached[cgroupBPFKey{cgroupID: id, attachType: attachType}]
+			if !ok || (n > 0 && a.flags&linux.BPF_F_ALLOW_MULTI == 0) {
+				continue
+			}
+			progs = append(progs, a.progs...)
+			n += len(a.progs)
+		}
+	}
+	return progs
+}
+
+// BPFEnv implements ebpf.Env for programs run by the kernel.
+type BPFEnv struct {
+	k *Kernel
+}
+
+// BPFEnv returns an ebpf.Env for programs run by k.
+func (k *Kernel) BPFEnv() BPFEnv {
+	return BPFEnv{k}
+}
+
+// MonotonicNanoseconds implements ebpf.Env.MonotonicNanoseconds.
+func (e BPFEnv) MonotonicNanoseconds() int64 {
+	return e.k.MonotonicClock().Now().Nanoseconds()
+}
+
+// RandomUint32 implements ebpf.Env.RandomUint32.
+func (e BPFEnv) RandomUint32() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return hostarch.ByteOrder.Uint32(b[:])
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/ebpf"
+)
+
+func TestEffectiveCgroupBPFPrograms(t *testing.T) {
+	var a, b, c, d, e, f ebpf.Program
+	const attachType = linux.BPF_CGROUP_INET_INGRESS
+	var k Kernel
+	if got := k.EffectiveCgroupBPFPrograms([][]uint32{{1}}, attachType); len(got) != 0 {
+		t.Errorf("EffectiveCgroupBPFPrograms with no attached programs = %v, want none", got)
+	}
+
+	// This is the example of BPF_F_ALLOW_MULTI in Linux's
+	// include/uapi/linux/bpf.h, where cgroup N+1 is a child of cgroup N.
+	k.cgroupBPF.attached = map[cgroupBPFKey]*cgroupBPFPrograms{
+		{cgroupID: 1, attachType: attachType}: {flags: linux.BPF_F_ALLOW_MULTI, progs: []*ebpf.Program{&a, &b}},
+		{cgroupID: 2, attachType: attachType}: {flags: linux.BPF_F_ALLOW_OVERRIDE, progs: []*ebpf.Program{&c}},
+		{cgroupID: 3, attachType: attachType}: {flags: linux.BPF_F_ALLOW_MULTI, progs: []*ebpf.Program{&d}},
+		{cgroupID: 4, attachType: attachType}: {flags: linux.BPF_F_ALLOW_OVERRIDE, progs: []*ebpf.Program{&e}},
+		{cgroupID: 5, attachType: attachType}: {progs: []*ebpf.Program{&f}},
+	}
+	k.cgroupBPFChangedLocked()
+
+	for _, test := range []struct {
+		name   string
+		chains [][]uint32
+		// attachType is linux.BPF_CGROUP_INET_INGRESS if unset.
+		attachType uint32
+		want       []*ebpf.Program
+	}{
+		{
+			name:   "root",
+			chains: [][]uint32{{1}},
+			want:   []*ebpf.Program{&a, &b},
+		},
+		{
+			name:   "override",
+			chains: [][]uint32{{2, 1}},
+			want:   []*ebpf.Program{&c, &a, &b},
+		},
+		{
+			name:   "leaf",
+			chains: [][]uint32{{5, 4, 3, 2, 1}},
+			want:   []*ebpf.Program{&f, &d, &a, &b},
+		},
+		{
+			name:   "no programs in cgroup",
+			chains: [][]uint32{{6, 4, 3, 2, 1}},
+			want:   []*ebpf.Program{&e, &d, &a, &b},
+		},
+		{
+			name:   "other hierarchy",
+			chains: [][]uint32{{8, 7}},
+		},
+		{
+			name:       "other attach type",
+			chains:     [][]uint32{{1}},
+			attachType: linux.BPF_CGROUP_INET_EGRESS,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := k.EffectiveCgroupBPFPrograms(test.chains, test.attachType)
+			if len(got) != len(test.want) {
+				t.Fatalf("EffectiveCgroupBPFPrograms(%v) returned %d programs, want %d", test.chains, len(got), len(test.want))
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("EffectiveCgroupBPFPrograms(%v)[%d] = %p, want %p", test.chains, i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,470 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Cgroup resource limits.
+//
+// The cpu and memory cgroup controllers are defined by cgroupfs, but their
+// limits are enforced by the kernel, on the tasks in their cgroups. Each
+// controller creates a limit object for its cgroup, and points the tasks that
+// enter the cgroup to it. Limit objects point to the limit objects of their
+// parent cgroup, since the limits of a cgroup also apply to its descendants.
+//
+// Limits start out unenforced, with the value they are created with reported
+// but not enforced. These values are usually the control values of the
+// sandbox's cgroup on the host, which the host already enforces on the whole
+// sandbox. A limit is enforced once it is set from within the sandbox.
+//
+// Tasks are also subject to the CPU bandwidth limit of their container (see
+// containerCPULimits), which is enforced in the same way as the limits of
+// their cpu cgroups.
+
+// CgroupCPUBandwidth is the CPU bandwidth limit of a cpu cgroup, analogous to
+// Linux's struct cfs_bandwidth: tasks in the cgroup may use at most quota of
+// CPU time in each period.
+//
+// CPU time is charged on every CPU clock tick to running tasks. Tasks whose
+// cgroup, or an ancestor cgroup, has used its quota for the current period
+// are throttled until the next period before they return to user space.
+//
+// +stateify savable
+type CgroupCPUBandwidth struct {
+	k      *Kernel
+	parent *CgroupCPUBandwidth
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// quota is the CPU time that tasks may use in each period, or a negative
+	// value if it is unlimited.
+	quota time.Duration
+
+	// period is the length of a period.
+	period time.Duration
+
+	// enforced is true if quota is enforced.
+	enforced bool
+
+	// periodStart is the start of the current period, in the application
+	// monotonic clock.
+	periodStart int64
+
+	// used is the CPU time used in the current period. It may exceed quota,
+	// in which case the excess is carried over to the following periods.
+	used time.Duration
+
+	// usage is the total CPU time used.
+	usage time.Duration
+
+	// throttled is true if tasks have been throttled in the current period,
+	// since throttledStart.
+	throttled      bool
+	throttledStart int64
+
+	// Statistics reported in cpu.stat.
+	nrPeriods     uint64
+	nrThrottled   uint64
+	throttledTime time.Duration
+}
+
+// NewCgroupCPUBandwidth returns a new unenforced CPU bandwidth limit for a
+// root cgroup, with the given quota and period.
+func (k *Kernel) NewCgroupCPUBandwidth(quota, period time.Duration) *CgroupCPUBandwidth {
+	return &CgroupCPUBandwidth{
+		k:      k,
+		quota:  quota,
+		period: period,
+	}
+}
+
+// NewChild returns a new unenforced CPU bandwidth limit for a child cgroup of
+// b's cgroup, with the same quota and period as b.
+func (b *CgroupCPUBandwidth) NewChild() *CgroupCPUBandwidth {
+	quota, period := b.Limit()
+	return &CgroupCPUBandwidth{
+		k:      b.k,
+		parent: b,
+		quota:  quota,
+		period: period,
+	}
+}
+
+// Limit returns the quota and period of b.
+func (b *CgroupCPUBandwidth) Limit() (quota, period time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.quota, b.period
+}
+
+// SetLimit sets and starts enforcing the quota and period of b. A negative
+// quota removes the limit.
+func (b *CgroupCPUBandwidth) SetLimit(quota, period time.Duration) error {
+	if period <= 0 {
+		return linuxerr.EINVAL
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasLimited := b.enforced && b.quota >= 0
+	b.quota = quota
+	b.period = period
+	b.enforced = true
+	if isLimited := b.quota >= 0; isLimited != wasLimited {
+		if isLimited {
+			b.k.cpuBandwidthLimits.Add(1)
+		} else {
+			b.k.cpuBandwidthLimits.Add(-1)
+		}
+	}
+	return nil
+}
+
+// Stats returns the CPU time used by tasks in b's cgroup, and the number of
+// periods, throttled periods and time throttled. CPU time is only accounted
+// while some CPU bandwidth limit is enforced.
+func (b *CgroupCPUBandwidth) Stats() (usage time.Duration, nrPeriods, nrThrottled uint64, throttledTime time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.usage, b.nrPeriods, b.nrThrottled, b.throttledTime
+}
+
+// exhaustedLocked returns true if b's quota is used up for the current
+// period.
+//
+// Preconditions: b.mu must be locked.
+func (b *CgroupCPUBandwidth) exhaustedLocked() bool {
+	return b.enforced && b.quota >= 0 && b.used >= b.quota
+}
+
+// refreshLocked starts a new period if the current one has ended by now.
+//
+// Preconditions: b.mu must be locked.
+func (b *CgroupCPUBandwidth) refreshLocked(now int64) {
+	periodEnd := b.periodStart + int64(b.period)
+	if now < periodEnd {
+		return
+	}
+	if b.throttled {
+		b.throttledTime += time.Duration(periodEnd - b.throttledStart)
+		b.throttled = false
+	}
+	n := (now - b.periodStart) / int64(b.period)
+	b.periodStart += n * int64(b.period)
+	b.nrPeriods++
+	if !b.enforced || b.quota < 0 || b.quota > time.Duration(math.MaxInt64/n) {
+		b.used = 0
+	} else if b.used -= time.Duration(n) * b.quota; b.used < 0 {
+		b.used = 0
+	}
+}
+
+// charge charges d of CPU time used at now to b and its ancestors. It
+// returns true if the quota of any of them is used up. b may be nil.
+func (b *CgroupCPUBandwidth) charge(now int64, d time.Duration) bool {
+	exhausted := false
+	for ; b != nil; b = b.parent {
+		b.mu.Lock()
+		b.refreshLocked(now)
+		b.used += d
+		b.usage += d
+		if b.exhaustedLocked() {
+			exhausted = true
+		}
+		b.mu.Unlock()
+	}
+	return exhausted
+}
+
+// throttledUntil returns the time at which tasks in b's cgroup may run again
+// if they are throttled at now. b may be nil.
+func (b *CgroupCPUBandwidth) throttledUntil(now int64) (int64, bool) {
+	var until int64
+	throttled := false
+	for ; b != nil; b = b.parent {
+		b.mu.Lock()
+		b.refreshLocked(now)
+		if b.exhaustedLocked() {
+			if !b.throttled {
+				b.throttled = true
+				b.throttledStart = now
+				b.nrThrottled++
+			}
+			if periodEnd := b.periodStart + int64(b.period); periodEnd > until {
+				until = periodEnd
+			}
+			throttled = true
+		}
+		b.mu.Unlock()
+	}
+	return until, throttled
+}
+
+// SetCgroupCPUBandwidth sets the CPU bandwidth limit that applies to t. b may
+// be nil if t isn't in a cpu cgroup.
+func (t *Task) SetCgroupCPUBandwidth(b *CgroupCPUBandwidth) {
+	t.cpuBandwidth.Store(b)
+}
+
+// chargeCPUBandwidth charges a CPU clock tick to the CPU bandwidth limits of
+// running tasks, and interrupts those that must be throttled. It is called by the CPU clock ticker on every tick.
+func (k *Kernel) chargeCPUBandwidth(tgs []*ThreadGroup) {
+	if k.cpuBandwidthLimits.Load() == 0 {
+		return
+	}
+	now := k.MonotonicClock().Now().Nanoseconds()
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	for _, tg := range tgs {
+		for t := tg.tasks.Front(); t != nil; t = t.Next() {
+			b, cb := t.cpuBandwidth.Load(), t.containerCPUBandwidth
+			if b == nil && cb == nil {
+				continue
+			}
+			state := t.TaskGoroutineSchedInfo().State
+			if state != TaskGoroutineRunningApp && state != TaskGoroutineRunningSys {
+				continue
+			}
+			// Charge both limits, even if the first is already used up.
+			exhausted := b.charge(now, linux.ClockTick)
+			exhausted = cb.charge(now, linux.ClockTick) || exhausted
+			// Tasks running in the sentry are throttled when they return to
+			// user space, so only interrupt tasks running application code.
+			if exhausted && state == TaskGoroutineRunningApp {
+				t.interrupt()
+			}
+		}
+	}
+}
+
+// cpuThrottledUntil returns the time at which t may run again if it is
+// throttled at now by the CPU bandwidth limits of its cgroup or container.
+func (t *Task) cpuThrottledUntil(now int64) (int64, bool) {
+	until, throttled := t.cpuBandwidth.Load().throttledUntil(now)
+	if cuntil, cthrottled := t.containerCPUBandwidth.throttledUntil(now); cthrottled {
+		if cuntil > until {
+			until = cuntil
+		}
+		throttled = true
+	}
+	return until, throttled
+}
+
+// CgroupMemoryUsage is implemented by memory cgroups.
+type CgroupMemoryUsage interface {
+	// ID returns the ID of the cgroup.
+	ID() uint32
+
+	// MemoryUsage returns the memory usage of the cgroup and its descendants,
+	// in bytes.
+	MemoryUsage() uint64
+}
+
+// Memory limit constants.
+const (
+	// CgroupMemoryUnlimited is the value of a memory limit that is unlimited.
+	CgroupMemoryUnlimited = math.MaxInt64
+
+	// memoryLimitCheckPeriod is the minimum interval between checks of the
+	// memory usage of a cgroup against its limits.
+	memoryLimitCheckPeriod = linux.ClockTick
+
+	// memoryHighMaxPenalty is the maximum time for which tasks are throttled
+	// when their cgroup is over its high memory limit, analogous to Linux's
+	// MEMCG_MAX_HIGH_DELAY_JIFFIES.
+	memoryHighMaxPenalty = 2 * time.Second
+)
+
+// CgroupMemoryLimit holds the memory limits of a memory cgroup.
+//
+// Memory usage is checked against the limits when tasks in the cgroup return
+// to user space, at most once every memoryLimitCheckPeriod. Exceeding the max
+// limit kills the thread group that detects it, as the Linux OOM killer would
+// kill a task in the cgroup. Exceeding the high limit throttles the task that
+// detects it, for a time that grows with the excess usage, as Linux does in
+// mem_cgroup_handle_over_high().
+//
+// +stateify savable
+type CgroupMemoryLimit struct {
+	parent *CgroupMemoryLimit
+	cg     CgroupMemoryUsage
+
+	// max and high are the memory limits in bytes. enforced is true if they
+	// are enforced.
+	max      atomicbitops.Int64
+	high     atomicbitops.Int64
+	enforced atomicbitops.Bool
+
+	// lastCheck is the time at which memory usage was last checked against
+	// the limits, in the application monotonic clock.
+	lastCheck atomicbitops.Int64
+
+	// Event counters reported in memory.events.
+	highEvents    atomicbitops.Uint64
+	maxEvents     atomicbitops.Uint64
+	oomEvents     atomicbitops.Uint64
+	oomKillEvents atomicbitops.Uint64
+}
+
+// NewCgroupMemoryLimit returns a new unenforced memory limit for cg with the
+// given parent and max limit. The high limit is unlimited.
+func NewCgroupMemoryLimit(parent *CgroupMemoryLimit, cg CgroupMemoryUsage, max int64) *CgroupMemoryLimit {
+	return &CgroupMemoryLimit{
+		parent: parent,
+		cg:     cg,
+		max:    atomicbitops.FromInt64(max),
+		high:   atomicbitops.FromInt64(CgroupMemoryUnlimited),
+	}
+}
+
+// Max returns the max memory limit in bytes.
+func (l *CgroupMemoryLimit) Max() int64 {
+	return l.max.Load()
+}
+
+// SetMax sets and starts enforcing the max memory limit.
+func (l *CgroupMemoryLimit) SetMax(max int64) {
+	l.max.Store(max)
+	l.enforced.Store(true)
+}
+
+// High returns the high memory limit in bytes.
+func (l *CgroupMemoryLimit) High() int64 {
+	return l.high.Load()
+}
+
+// SetHigh sets and starts enforcing the high memory limit.
+func (l *CgroupMemoryLimit) SetHigh(high int64) {
+	l.high.Store(high)
+	l.enforced.Store(true)
+}
+
+// Events returns the number of times the high and max limits were exceeded,
+// the number of times the OOM killer was invoked, and the number of thread
+// groups it killed.
+func (l *CgroupMemoryLimit) Events() (high, max, oom, oomKill uint64) {
+	return l.highEvents.Load(), l.maxEvents.Load(), l.oomEvents.Load(), l.oomKillEvents.Load()
+}
+
+// recordOOMKill records that a thread group in the cgroup of l was killed by
+// the OOM killer after the cgroup's memory usage reached its limit. As
+// memory.events is hierarchical, the kill is also recorded in the ancestors of
+// the cgroup.
+func (l *CgroupMemoryLimit) recordOOMKill() {
+	for ; l != nil; l = l.parent {
+		l.maxEvents.Add(1)
+		l.oomEvents.Add(1)
+		l.oomKillEvents.Add(1)
+	}
+}
+
+// SetCgroupMemoryLimit sets the memory limit that applies to t. l may be nil
+// if t isn't in a memory cgroup.
+func (t *Task) SetCgroupMemoryLimit(l *CgroupMemoryLimit) {
+	t.memoryLimit.Store(l)
+}
+
+// enforceCgroupLimits enforces the limits of t's cgroups and container, and
+// the sandbox's OOM limit, before t returns to user space. It returns false if
+// t was interrupted.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) enforceCgroupLimits() bool {
+	if t.k.cpuBandwidthLimits.Load() != 0 {
+		for {
+			until, throttled := t.cpuThrottledUntil(t.k.MonotonicClock().Now().Nanoseconds())
+			if !throttled {
+				break
+			}
+			if err := t.BlockWithDeadline(nil, true, ktime.FromNanoseconds(until)); err == linuxerr.ErrInterrupted {
+				return false
+			}
+		}
+	}
+	if limit := t.k.oom.limit.Load(); limit != 0 {
+		t.k.checkOOM(limit)
+	}
+	if l := t.memoryLimit.Load(); l != nil {
+		return t.enforceMemoryLimits(l)
+	}
+	return true
+}
+
+// enforceMemoryLimits enforces the memory limits of l and its ancestors on t.
+// It returns false if t was interrupted.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) enforceMemoryLimits(l *CgroupMemoryLimit) bool {
+	now := t.k.MonotonicClock().Now().Nanoseconds()
+	var penalty time.Duration
+	for ; l != nil; l = l.parent {
+		if !l.enforced.Load() {
+			continue
+		}
+		max, high := l.max.Load(), l.high.Load()
+		if max == CgroupMemoryUnlimited && high == CgroupMemoryUnlimited {
+			continue
+		}
+		last := l.lastCheck.Load()
+		if now-last < int64(memoryLimitCheckPeriod) || !l.lastCheck.CompareAndSwap(last, now) {
+			continue
+		}
+		t.k.MemoryFile().UpdateUsage(l.cg.ID())
+		usage := int64(l.cg.MemoryUsage())
+		if usage > max {
+			l.recordOOMKill()
+			t.Infof("Memory cgroup %d usage %d exceeds its limit %d, killing thread group", l.cg.ID(), usage, max)
+			t.tg.SendSignal(SignalInfoPriv(linux.SIGKILL))
+			return false
+		}
+		if usage > high {
+			l.highEvents.Add(1)
+			if p := memoryHighPenalty(usage, high); p > penalty {
+				penalty = p
+			}
+		}
+	}
+	if penalty < linux.ClockTick {
+		return true
+	}
+	_, err := t.BlockWithTimeout(nil, true, penalty)
+	return err != linuxerr.ErrInterrupted
+}
+
+// memoryHighPenalty returns the time for which a task is throttled when its
+// cgroup is using usage bytes of memory over its high limit. As in Linux's
+// calculate_high_delay(), the penalty grows with the square of the excess
+// relative to the limit, up to memoryHighMaxPenalty when the excess is about
+// 18% of the limit.
+func memoryHighPenalty(usage, high int64) time.Duration {
+	if high <= 0 {
+		return memoryHighMaxPenalty
+	}
+	excess := float64(usage-high) / float64(high)
+	penalty := excess * excess * float64(64*time.Second)
+	if penalty > float64(memoryHighMaxPenalty) {
+		return memoryHighMaxPenalty
+	}
+	return time.Duration(penalty)
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+)
+
+// containerCPUPeriod is the period of container CPU bandwidth limits until
+// one is set, the same as Linux's default CFS period.
+const containerCPUPeriod = 100 * time.Millisecond
+
+// containerCPULimits holds the CPU limits of a container, which the kernel
+// enforces on the container's tasks in addition to the limits of their
+// cgroups. They allow runsc to apply the container's CPU quota when the
+// container isn't confined to a cpu cgroup in the sandbox.
+//
+// +stateify savable
+type containerCPULimits struct {
+	// bandwidth limits the CPU time used by the container's tasks. It starts
+	// out unlimited and unenforced. bandwidth is immutable.
+	bandwidth *CgroupCPUBandwidth
+
+	// cpus is the number of CPUs that processes created in the container are
+	// allowed to run on, or 0 if they may run on all CPUs. cpus is protected
+	// by Kernel.containerCPUMu.
+	cpus uint
+}
+
+// containerCPULimitsFor returns the CPU limits of the container with ID
+// containerID, creating them if they don't exist yet. Tasks created in the
+// container point to the returned limits, so that limits set after the tasks
+// are created also apply to them.
+func (k *Kernel) containerCPULimitsFor(containerID string) *containerCPULimits {
+	k.containerCPUMu.Lock()
+	defer k.containerCPUMu.Unlock()
+	l, ok := k.containerCPU[containerID]
+	if !ok {
+		l = &containerCPULimits{
+			bandwidth: k.NewCgroupCPUBandwidth(-1, containerCPUPeriod),
+		}
+		if k.containerCPU == nil {
+			k.containerCPU = make(map[string]*containerCPULimits)
+		}
+		k.containerCPU[containerID] = l
+	}
+	return l
+}
+
+// SetContainerCPULimits limits the tasks of the container with ID containerID
+// to quota of CPU time in each period, and processes created in the container
+// from now on to its first cpus CPUs. A negative quota removes the bandwidth
+// limit, and a cpus of 0 allows all CPUs.
+//
+// Limiting the CPUs that a container's processes may run on keeps the number
+// of CPUs that they observe, e.g. with sched_getaffinity(2) as nproc does,
+// consistent with the CPU time that they can use.
+func (k *Kernel) SetContainerCPULimits(containerID string, quota, period time.Duration, cpus uint) error {
+	l := k.containerCPULimitsFor(containerID)
+	if err := l.bandwidth.SetLimit(quota, period); err != nil {
+		return err
+	}
+	k.containerCPUMu.Lock()
+	defer k.containerCPUMu.Unlock()
+	l.cpus = cpus
+	return nil
+}
+
+// RemoveContainerCPULimits removes the CPU limits of the container with ID
+// containerID. It is called when the container is destroyed.
+func (k *Kernel) RemoveContainerCPULimits(containerID string) {
+	k.containerCPUMu.Lock()
+	l, ok := k.containerCPU[containerID]
+	delete(k.containerCPU, containerID)
+	k.containerCPUMu.Unlock()
+	if !ok {
+		return
+	}
+	// Stop enforcing the limit, in case tasks outlive the container, and so
+	// that it no longer counts towards k.cpuBandwidthLimits.
+	_, period := l.bandwidth.Limit()
+	l.bandwidth.SetLimit(-1, period)
+}
+
+// ContainerCPUBandwidth returns the CPU bandwidth limit of the container with
+// ID containerID, or nil if the container has none.
+func (k *Kernel) ContainerCPUBandwidth(containerID string) *CgroupCPUBandwidth {
+	k.containerCPUMu.Lock()
+	defer k.containerCPUMu.Unlock()
+	if l, ok := k.containerCPU[containerID]; ok {
+		return l.bandwidth
+	}
+	return nil
+}
+
+// containerCPUMask returns the CPUs that processes created in the container
+// with ID containerID are allowed to run on: the first cpus online CPUs, or
+// all online CPUs.
+func (k *Kernel) containerCPUMask(containerID string) sched.CPUSet {
+	online := k.OnlineCPUs()
+	k.containerCPUMu.Lock()
+	l, ok := k.containerCPU[containerID]
+	var cpus uint
+	if ok {
+		cpus = l.cpus
+	}
+	k.containerCPUMu.Unlock()
+	return firstCPUs(online, cpus)
+}
+
+// containerCPUCounts returns the number of CPUs that processes created in
+// each container are allowed to run on, for containers that have such a
+// limit.
+func (k *Kernel) containerCPUCounts() map[string]uint {
+	k.containerCPUMu.Lock()
+	defer k.containerCPUMu.Unlock()
+	counts := make(map[string]uint)
+	for id, l := range k.containerCPU {
+		if l.cpus != 0 {
+			counts[id] = l.cpus
+		}
+	}
+	return counts
+}
+
+// firstCPUs returns a copy of set that contains only its first n CPUs, or all
+// of them if n is 0.
+func firstCPUs(set sched.CPUSet, n uint) sched.CPUSet {
+	if n == 0 || n >= set.NumCPUs() {
+		return set.Copy()
+	}
+	mask := make(sched.CPUSet, set.Size())
+	set.ForEachCPU(func(cpu uint) {
+		if n > 0 {
+			mask.Set(cpu)
+			n--
+		}
+	})
+	return mask
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+)
+
+// CPU hotplug.
+//
+// The number of CPUs visible to applications is fixed when the kernel is
+// initialized, but CPUs may be taken offline and back online, e.g. to follow
+// changes in the host CPUs that the sandbox may run on. As in Linux, offline
+// CPUs remain possible and present, but tasks are not allowed to run on them,
+// and device events are sent to NETLINK_KOBJECT_UEVENT sockets when CPUs go
+// offline or online.
+
+// OnlineCPUs returns the set of online CPUs.
+func (k *Kernel) OnlineCPUs() sched.CPUSet {
+	k.onlineCPUsMu.Lock()
+	defer k.onlineCPUsMu.Unlock()
+	return k.onlineCPUsLocked().Copy()
+}
+
+// onlineCPUsLocked returns the set of online CPUs. The returned set must not
+// be modified.
+//
+// Preconditions: k.onlineCPUsMu must be locked.
+func (k *Kernel) onlineCPUsLocked() sched.CPUSet {
+	if k.onlineCPUs == nil {
+		// All CPUs are online until SetOnlineCPUs is called.
+		k.onlineCPUs = sched.NewFullCPUSet(k.applicationCores)
+	}
+	return k.onlineCPUs
+}
+
+// SetOnlineCPUs takes the CPUs in online online, and all other CPUs offline.
+// Tasks that are allowed to run on all CPUs that were online are allowed to
+// run on all CPUs that are now online, as tasks in Linux's root cpuset are,
+// up to the CPU limit of their container (see SetContainerCPULimits); other
+// tasks are no longer allowed to run on offline CPUs. Tasks left with
+// no allowed CPU are allowed to run on all online CPUs, as in Linux's
+// select_fallback_rq().
+func (k *Kernel) SetOnlineCPUs(online sched.CPUSet) error {
+	if want := sched.CPUSetSize(k.applicationCores); online.Size() != want {
+		return fmt.Errorf("invalid CPU set size %d, want %d", online.Size(), want)
+	}
+	online = online.Copy()
+	online.ClearAbove(k.applicationCores)
+	if online.NumCPUs() == 0 {
+		return fmt.Errorf("at least one CPU must be online")
+	}
+
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+
+	k.tasks.mu.RLock()
+	tids := make(map[*Task]ThreadID, len(k.tasks.Root.tids))
+	for t, tid := range k.tasks.Root.tids {
+		tids[t] = tid
+	}
+	k.tasks.mu.RUnlock()
+	containerCPUs := k.containerCPUCounts()
+
+	k.onlineCPUsMu.Lock()
+	old := k.onlineCPUsLocked()
+	if bytes.Equal(old, online) {
+		k.onlineCPUsMu.Unlock()
+		return nil
+	}
+	k.onlineCPUs = online
+	if !k.useHostCores {
+		for t, tid := range tids {
+			t.updateCPUMaskForHotplug(old, online, containerCPUs[t.ContainerID()], tid)
+		}
+	}
+	k.onlineCPUsMu.Unlock()
+
+	log.Infof("%d of %d CPUs are online", online.NumCPUs(), k.applicationCores)
+	ctx := k.SupervisorContext()
+	for cpu := uint(0); cpu < k.applicationCores; cpu++ {
+		wasOnline, isOnline := old.IsSet(cpu), online.IsSet(cpu)
+		if wasOnline == isOnline {
+			continue
+		}
+		action := "offline"
+		if isOnline {
+			action = "online"
+		}
+		k.sendUevent(ctx, action, fmt.Sprintf("/devices/system/cpu/cpu%d", cpu), "cpu")
+	}
+	return nil
+}
+
+// updateCPUMaskForHotplug updates t's allowed CPU mask after the online CPUs
+// changed from old to online. cpus is the number of CPUs that t's container
+// allows, or 0 if it allows all CPUs. tid is t's ID in the root PID
+// namespace.
+//
+// Preconditions: t.k.onlineCPUsMu must be locked.
+func (t *Task) updateCPUMaskForHotplug(old, online sched.CPUSet, cpus uint, tid ThreadID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	mask := hotplugCPUMask(t.allowedCPUMask, old, online, cpus)
+	t.allowedCPUMask = mask
+	t.cpu.Store(assignCPU(mask, tid))
+}
+
+// hotplugCPUMask returns the CPU mask of a task that was allowed to run on
+// allowed after the online CPUs changed from old to online. cpus is the number
+// of CPUs that the task's container allows, or 0 if it allows all CPUs.
+func hotplugCPUMask(allowed, old, online sched.CPUSet, cpus uint) sched.CPUSet {
+	// Tasks that were allowed to run on all CPUs that their container allows
+	// keep doing so, without exceeding the container's limit.
+	if old.IsSubsetOf(allowed) || (cpus != 0 && firstCPUs(old, cpus).IsSubsetOf(allowed)) {
+		return firstCPUs(online, cpus)
+	}
+	mask := allowed.Copy()
+	mask.Intersect(online)
+	if mask.NumCPUs() == 0 {
+		return firstCPUs(online, cpus)
+	}
+	return mask
+}
+
+// sendUevent sends a device event to the members of the multicast group of
+// NETLINK_KOBJECT_UEVENT sockets, in the format of Linux's
+// kobject_uevent_env().
+func (k *Kernel) sendUevent(ctx context.Context, action, devpath, subsystem string) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s@%s\x00", action, devpath)
+	fmt.Fprintf(&buf, "ACTION=%s\x00", action)
+	fmt.Fprintf(&buf, "DEVPATH=%s\x00", devpath)
+	fmt.Fprintf(&buf, "SUBSYSTEM=%s\x00", subsystem)
+	fmt.Fprintf(&buf, "SEQNUM=%d\x00", k.ueventSeqnum.Add(1))
+	k.netlinkPorts.Multicast(ctx, linux.NETLINK_KOBJECT_UEVENT, 1, buf.Bytes())
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+)
+
+func cpuSet(cpus ...uint) sched.CPUSet {
+	set := sched.NewCPUSet(8)
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	return set
+}
+
+func TestHotplugCPUMask(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		allowed sched.CPUSet
+		old     sched.CPUSet
+		online  sched.CPUSet
+		cpus    uint
+		want    sched.CPUSet
+	}{
+		{
+			name:    "all CPUs widen",
+			allowed: cpuSet(0, 1, 2, 3),
+			old:     cpuSet(0, 1, 2, 3),
+			online:  cpuSet(0, 1, 2, 3, 4, 5),
+			want:    cpuSet(0, 1, 2, 3, 4, 5),
+		},
+		{
+			name:    "all CPUs narrow",
+			allowed: cpuSet(0, 1, 2, 3),
+			old:     cpuSet(0, 1, 2, 3),
+			online:  cpuSet(0, 1),
+			want:    cpuSet(0, 1),
+		},
+		{
+			name:    "container limit kept when widening",
+			allowed: cpuSet(0, 1),
+			old:     cpuSet(0, 1),
+			online:  cpuSet(0, 1, 2, 3, 4, 5),
+			cpus:    2,
+			want:    cpuSet(0, 1),
+		},
+		{
+			name:    "container limit regained after narrowing",
+			allowed: cpuSet(0),
+			old:     cpuSet(0),
+			online:  cpuSet(0, 1, 2, 3),
+			cpus:    2,
+			want:    cpuSet(0, 1),
+		},
+		{
+			name:    "container limit followed when narrowing",
+			allowed: cpuSet(0, 1, 2, 3),
+			old:     cpuSet(0, 1, 2, 3, 4, 5, 6, 7),
+			online:  cpuSet(0, 1),
+			cpus:    4,
+			want:    cpuSet(0, 1),
+		},
+		{
+			name:    "explicit mask not widened",
+			allowed: cpuSet(1, 2),
+			old:     cpuSet(0, 1, 2, 3),
+			online:  cpuSet(0, 1, 2, 3, 4, 5),
+			want:    cpuSet(1, 2),
+		},
+		{
+			name:    "explicit mask narrowed",
+			allowed: cpuSet(1, 2),
+			old:     cpuSet(0, 1, 2, 3),
+			online:  cpuSet(0, 1),
+			want:    cpuSet(1),
+		},
+		{
+			name:    "fallback to online CPUs",
+			allowed: cpuSet(3),
+			old:     cpuSet(0, 1, 2, 3),
+			online:  cpuSet(0, 1, 2),
+			want:    cpuSet(0, 1, 2),
+		},
+		{
+			name:    "fallback within container limit",
+			allowed: cpuSet(3),
+			old:     cpuSet(0, 1, 2, 3),
+			online:  cpuSet(0, 1, 2),
+			cpus:    2,
+			want:    cpuSet(0, 1),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := hotplugCPUMask(test.allowed, test.old, test.online, test.cpus)
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("hotplugCPUMask(%v, %v, %v, %d) = %v, want %v", test.allowed, test.old, test.online, test.cpus, got, test.want)
+			}
+		})
+	}
+}
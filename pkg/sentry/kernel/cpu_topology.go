@@ -0,0 +1,144 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+)
+
+// maxNUMANodes is the maximum number of NUMA nodes, such that NUMA nodemasks
+// fit in a uint64.
+const maxNUMANodes = 64
+
+// CPUTopology describes how the CPUs visible to sandboxed applications are
+// arranged into cores, sockets and NUMA nodes. It only affects how the
+// topology is reported to applications, e.g. in sysfs and /proc/cpuinfo; it
+// has no effect on scheduling.
+//
+// CPUs are numbered contiguously: CPU i is hardware thread i % ThreadsPerCore
+// of core (i / ThreadsPerCore) % CoresPerSocket of socket
+// i / (ThreadsPerCore * CoresPerSocket). Sockets are distributed evenly and
+// contiguously across NUMA nodes.
+//
+// +stateify savable
+type CPUTopology struct {
+	// ThreadsPerCore is the number of hardware threads in each core. If it is
+	// zero, each core has a single thread.
+	ThreadsPerCore uint
+
+	// CoresPerSocket is the number of cores in each socket. If it is zero,
+	// there is one socket per NUMA node.
+	CoresPerSocket uint
+
+	// NUMANodes is the number of NUMA nodes. If it is zero, there is a single
+	// node.
+	NUMANodes uint
+
+	// numCPUs is the number of CPUs. It is set by init.
+	numCPUs uint
+}
+
+// init validates t for numCPUs CPUs and fills in the defaults of unset
+// fields.
+func (t *CPUTopology) init(numCPUs uint) error {
+	if t.ThreadsPerCore == 0 {
+		t.ThreadsPerCore = 1
+	}
+	if t.NUMANodes == 0 {
+		t.NUMANodes = 1
+	}
+	if t.NUMANodes > maxNUMANodes {
+		return fmt.Errorf("%d NUMA nodes exceeds the maximum of %d", t.NUMANodes, maxNUMANodes)
+	}
+	if numCPUs%t.ThreadsPerCore != 0 {
+		return fmt.Errorf("%d CPUs can't be divided into cores of %d threads", numCPUs, t.ThreadsPerCore)
+	}
+	cores := numCPUs / t.ThreadsPerCore
+	if t.CoresPerSocket == 0 {
+		if cores%t.NUMANodes != 0 {
+			return fmt.Errorf("%d cores can't be divided into %d NUMA nodes", cores, t.NUMANodes)
+		}
+		t.CoresPerSocket = cores / t.NUMANodes
+	}
+	if cores%t.CoresPerSocket != 0 {
+		return fmt.Errorf("%d cores can't be divided into sockets of %d cores", cores, t.CoresPerSocket)
+	}
+	if sockets := cores / t.CoresPerSocket; sockets%t.NUMANodes != 0 {
+		return fmt.Errorf("%d sockets can't be divided into %d NUMA nodes", sockets, t.NUMANodes)
+	}
+	t.numCPUs = numCPUs
+	return nil
+}
+
+// NodeMask returns a bitmask of all NUMA nodes.
+func (t *CPUTopology) NodeMask() uint64 {
+	if t.NUMANodes == maxNUMANodes {
+		return ^uint64(0)
+	}
+	return (uint64(1) << t.NUMANodes) - 1
+}
+
+// NumCPUs returns the number of CPUs.
+func (t *CPUTopology) NumCPUs() uint {
+	return t.numCPUs
+}
+
+// Sockets returns the number of sockets.
+func (t *CPUTopology) Sockets() uint {
+	return t.numCPUs / t.cpusPerSocket()
+}
+
+func (t *CPUTopology) cpusPerSocket() uint {
+	return t.ThreadsPerCore * t.CoresPerSocket
+}
+
+func (t *CPUTopology) cpusPerNode() uint {
+	return t.numCPUs / t.NUMANodes
+}
+
+// CoreID returns the ID of the core of cpu within its socket.
+func (t *CPUTopology) CoreID(cpu uint) uint {
+	return (cpu / t.ThreadsPerCore) % t.CoresPerSocket
+}
+
+// SocketID returns the ID of the socket of cpu.
+func (t *CPUTopology) SocketID(cpu uint) uint {
+	return cpu / t.cpusPerSocket()
+}
+
+// NodeID returns the ID of the NUMA node of cpu.
+func (t *CPUTopology) NodeID(cpu uint) uint {
+	return cpu / t.cpusPerNode()
+}
+
+// ThreadSiblings returns the range of CPUs, inclusive, that are in the same
+// core as cpu.
+func (t *CPUTopology) ThreadSiblings(cpu uint) (first, last uint) {
+	first = cpu - cpu%t.ThreadsPerCore
+	return first, first + t.ThreadsPerCore - 1
+}
+
+// CoreSiblings returns the range of CPUs, inclusive, that are in the same
+// socket as cpu.
+func (t *CPUTopology) CoreSiblings(cpu uint) (first, last uint) {
+	first = cpu - cpu%t.cpusPerSocket()
+	return first, first + t.cpusPerSocket() - 1
+}
+
+// NodeCPUs returns the range of CPUs, inclusive, that are in NUMA node node.
+func (t *CPUTopology) NodeCPUs(node uint) (first, last uint) {
+	first = node * t.cpusPerNode()
+	return first, first + t.cpusPerNode() - 1
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+)
+
+func TestCPUTopology(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		numCPUs     uint
+		topo        CPUTopology
+		wantErr     bool
+		wantSockets uint
+		// The remaining fields are checked for CPU cpu.
+		cpu          uint
+		wantCore     uint
+		wantSocket   uint
+		wantNode     uint
+		wantSiblings [2]uint
+	}{
+		{
+			name:         "default",
+			numCPUs:      8,
+			wantSockets:  1,
+			cpu:          5,
+			wantCore:     5,
+			wantSocket:   0,
+			wantNode:     0,
+			wantSiblings: [2]uint{5, 5},
+		},
+		{
+			name:         "smt",
+			numCPUs:      16,
+			topo:         CPUTopology{ThreadsPerCore: 2, CoresPerSocket: 4},
+			wantSockets:  2,
+			cpu:          11,
+			wantCore:     1,
+			wantSocket:   1,
+			wantNode:     0,
+			wantSiblings: [2]uint{10, 11},
+		},
+		{
+			name:         "socket per node",
+			numCPUs:      16,
+			topo:         CPUTopology{ThreadsPerCore: 2, NUMANodes: 4},
+			wantSockets:  4,
+			cpu:          13,
+			wantCore:     0,
+			wantSocket:   3,
+			wantNode:     3,
+			wantSiblings: [2]uint{12, 13},
+		},
+		{
+			name:    "uneven threads",
+			numCPUs: 6,
+			topo:    CPUTopology{ThreadsPerCore: 4},
+			wantErr: true,
+		},
+		{
+			name:    "uneven nodes",
+			numCPUs: 8,
+			topo:    CPUTopology{CoresPerSocket: 4, NUMANodes: 3},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			topo := test.topo
+			err := topo.init(test.numCPUs)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("init(%d) succeeded, want error", test.numCPUs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("init(%d) failed: %v", test.numCPUs, err)
+			}
+			if got := topo.Sockets(); got != test.wantSockets {
+				t.Errorf("Sockets() = %d, want %d", got, test.wantSockets)
+			}
+			if got := topo.CoreID(test.cpu); got != test.wantCore {
+				t.Errorf("CoreID(%d) = %d, want %d", test.cpu, got, test.wantCore)
+			}
+			if got := topo.SocketID(test.cpu); got != test.wantSocket {
+				t.Errorf("SocketID(%d) = %d, want %d", test.cpu, got, test.wantSocket)
+			}
+			if got := topo.NodeID(test.cpu); got != test.wantNode {
+				t.Errorf("NodeID(%d) = %d, want %d", test.cpu, got, test.wantNode)
+			}
+			if first, last := topo.ThreadSiblings(test.cpu); [2]uint{first, last} != test.wantSiblings {
+				t.Errorf("ThreadSiblings(%d) = %d-%d, want %d-%d", test.cpu, first, last, test.wantSiblings[0], test.wantSiblings[1])
+			}
+		})
+	}
+}
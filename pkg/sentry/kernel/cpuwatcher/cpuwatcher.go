@@ -0,0 +1,146 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cpuwatcher implements the CPU watcher goroutine, which takes
+// application CPUs offline and back online to follow changes in the host CPUs
+// that the sandbox may run on, e.g. because of changes to its host cpuset or
+// host CPU hotplug.
+package cpuwatcher
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/seccomp"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Watcher periodically checks the host CPUs that the sandbox may run on, and
+// keeps as many application CPUs online as there are such host CPUs, up to
+// the number of application CPUs. Application CPUs don't correspond to host
+// CPUs, so the lowest-numbered application CPUs are the ones kept online.
+type Watcher struct {
+	k        cpuKernel
+	interval time.Duration
+
+	// hostCPUs returns the number of host CPUs that the sandbox may run on.
+	hostCPUs func() (uint, error)
+
+	// Writing to this channel indicates the watcher goroutine should stop.
+	stop chan struct{}
+
+	// done is used to signal when the watcher goroutine has exited.
+	done sync.WaitGroup
+
+	// online is the number of online CPUs. It is exclusive to the watcher
+	// goroutine.
+	online uint
+}
+
+// cpuKernel is the part of kernel.Kernel that the watcher uses.
+type cpuKernel interface {
+	ApplicationCores() uint
+	OnlineCPUs() sched.CPUSet
+	SetOnlineCPUs(online sched.CPUSet) error
+}
+
+// New creates a new Watcher that checks host CPUs every interval.
+func New(k *kernel.Kernel, interval time.Duration) *Watcher {
+	return newWatcher(k, interval, affinityCPUs)
+}
+
+func newWatcher(k cpuKernel, interval time.Duration, hostCPUs func() (uint, error)) *Watcher {
+	return &Watcher{
+		k:        k,
+		interval: interval,
+		hostCPUs: hostCPUs,
+		stop:     make(chan struct{}),
+		online:   k.OnlineCPUs().NumCPUs(),
+	}
+}
+
+// Start starts the watcher goroutine. Start must not be called concurrently
+// with Stop and may only be called once.
+func (w *Watcher) Start() {
+	w.done.Add(1)
+	go w.run() // S/R-SAFE: SetOnlineCPUs is serialized with save.
+}
+
+// Stop stops the watcher goroutine. Stop must not be called concurrently
+// with Start and may only be called once.
+func (w *Watcher) Stop() {
+	close(w.stop)
+	w.done.Wait()
+}
+
+func (w *Watcher) run() {
+	defer w.done.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.check()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check updates the online CPUs to match the host CPUs that the sandbox may
+// run on.
+func (w *Watcher) check() {
+	n, err := w.hostCPUs()
+	if err != nil {
+		log.Warningf("Failed to get host CPU affinity: %v", err)
+		return
+	}
+	if cores := w.k.ApplicationCores(); n > cores {
+		n = cores
+	}
+	if n == 0 || n == w.online {
+		return
+	}
+	online := sched.NewFullCPUSet(w.k.ApplicationCores())
+	online.ClearAbove(n)
+	if err := w.k.SetOnlineCPUs(online); err != nil {
+		log.Warningf("Failed to set online CPUs: %v", err)
+		return
+	}
+	w.online = n
+}
+
+// affinityCPUs returns the number of host CPUs in the sentry's CPU affinity
+// mask.
+func affinityCPUs() (uint, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return 0, err
+	}
+	return uint(set.Count()), nil
+}
+
+// Filters returns seccomp-bpf filters for the syscalls made by the watcher.
+func Filters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_SCHED_GETAFFINITY: seccomp.PerArg{
+			seccomp.EqualTo(0),
+		},
+	}
+}
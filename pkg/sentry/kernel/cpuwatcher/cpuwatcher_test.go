@@ -0,0 +1,149 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpuwatcher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// fakeKernel implements cpuKernel.
+type fakeKernel struct {
+	cores uint
+
+	mu     sync.Mutex
+	online sched.CPUSet
+	sets   int
+}
+
+func newFakeKernel(cores uint) *fakeKernel {
+	return &fakeKernel{
+		cores:  cores,
+		online: sched.NewFullCPUSet(cores),
+	}
+}
+
+func (k *fakeKernel) ApplicationCores() uint {
+	return k.cores
+}
+
+func (k *fakeKernel) OnlineCPUs() sched.CPUSet {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.online.Copy()
+}
+
+func (k *fakeKernel) SetOnlineCPUs(online sched.CPUSet) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.online = online.Copy()
+	k.sets++
+	return nil
+}
+
+func (k *fakeKernel) numSets() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.sets
+}
+
+func TestCheck(t *testing.T) {
+	k := newFakeKernel(4)
+	var host uint
+	var hostErr error
+	w := newWatcher(k, time.Second, func() (uint, error) {
+		return host, hostErr
+	})
+
+	for _, test := range []struct {
+		name       string
+		host       uint
+		hostErr    error
+		wantOnline uint
+		wantSets   int
+	}{
+		{
+			name:       "unchanged",
+			host:       4,
+			wantOnline: 4,
+			wantSets:   0,
+		},
+		{
+			name:       "fewer host CPUs",
+			host:       2,
+			wantOnline: 2,
+			wantSets:   1,
+		},
+		{
+			name:       "error",
+			host:       4,
+			hostErr:    errors.New("failed"),
+			wantOnline: 2,
+			wantSets:   1,
+		},
+		{
+			name:       "no host CPUs",
+			host:       0,
+			wantOnline: 2,
+			wantSets:   1,
+		},
+		{
+			name:       "more host CPUs than application CPUs",
+			host:       16,
+			wantOnline: 4,
+			wantSets:   2,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			host, hostErr = test.host, test.hostErr
+			w.check()
+			online := k.OnlineCPUs()
+			if got := online.NumCPUs(); got != test.wantOnline {
+				t.Errorf("got %d online CPUs, want %d", got, test.wantOnline)
+			}
+			for cpu := uint(0); cpu < test.wantOnline; cpu++ {
+				if !online.IsSet(cpu) {
+					t.Errorf("CPU %d is offline, want the first %d CPUs online", cpu, test.wantOnline)
+				}
+			}
+			if got := k.numSets(); got != test.wantSets {
+				t.Errorf("got %d calls to SetOnlineCPUs, want %d", got, test.wantSets)
+			}
+		})
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	k := newFakeKernel(4)
+	w := newWatcher(k, time.Millisecond, func() (uint, error) {
+		return 1, nil
+	})
+	w.Start()
+	deadline := time.Now().Add(10 * time.Second)
+	for k.OnlineCPUs().NumCPUs() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("CPUs weren't taken offline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	w.Stop()
+	if got := k.numSets(); got != 1 {
+		t.Errorf("got %d calls to SetOnlineCPUs, want 1", got)
+	}
+}
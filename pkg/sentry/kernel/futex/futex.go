@@ -232,6 +232,17 @@ type Waiter struct {
 
 	// tid is the thread ID for the waiter in case this is a PI mutex.
 	tid uint32
+
+	// requeuePI is true if the waiter is waiting in FUTEX_WAIT_REQUEUE_PI, in
+	// which case requeuePIKey is the key of the PI futex that it may be
+	// requeued to.
+	requeuePI    bool
+	requeuePIKey Key
+
+	// requeuedPI is true if the waiter has been requeued to requeuePIKey by
+	// FUTEX_CMP_REQUEUE_PI, after which it is waiting to acquire the PI
+	// futex.
+	requeuedPI bool
 }
 
 // NewWaiter returns a new unqueued Waiter.
@@ -241,6 +252,17 @@ func NewWaiter() *Waiter {
 	}
 }
 
+// NewWaiters returns n new unqueued Waiters that share the same C, for use
+// with WaitMultiplePrepare.
+func NewWaiters(n int) []*Waiter {
+	c := make(chan struct{}, 1)
+	ws := make([]*Waiter, n)
+	for i := range ws {
+		ws[i] = &Waiter{C: c}
+	}
+	return ws
+}
+
 // woken returns true if w has been woken since the last call to WaitPrepare.
 func (w *Waiter) woken() bool {
 	return len(w.C) != 0
@@ -279,9 +301,14 @@ func (b *bucket) wakeLocked(key *Key, bitmask uint32, n int) int {
 }
 
 func (b *bucket) wakeWaiterLocked(w *Waiter) {
-	// Remove from the bucket and wake the waiter.
+	// Remove from the bucket and wake the waiter. w.C may be shared with
+	// other Waiters (see NewWaiters), one of which may already have been
+	// woken.
 	b.waiters.Remove(w)
-	w.C <- struct{}{}
+	select {
+	case w.C <- struct{}{}:
+	default:
+	}
 
 	// NOTE: The above channel write establishes a write barrier according
 	// to the memory model, so nothing may be ordered around it. Since
@@ -486,15 +513,16 @@ func (m *Manager) Wake(t Target, addr hostarch.Addr, private bool, bitmask uint3
 	return r, nil
 }
 
-func (m *Manager) doRequeue(t Target, addr, naddr hostarch.Addr, private bool, checkval bool, val uint32, nwake int, nreq int) (int, error) {
+// doRequeue returns the number of waiters woken and requeued.
+func (m *Manager) doRequeue(t Target, addr hostarch.Addr, private bool, naddr hostarch.Addr, nprivate bool, checkval bool, val uint32, nwake int, nreq int) (int, int, error) {
 	k1, err := getKey(t, addr, private)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	defer k1.release(t)
-	k2, err := getKey(t, naddr, private)
+	k2, err := getKey(t, naddr, nprivate)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	defer k2.release(t)
 
@@ -503,7 +531,7 @@ func (m *Manager) doRequeue(t Target, addr, naddr hostarch.Addr, private bool, c
 
 	if checkval {
 		if err := check(t, addr, val); err != nil {
-			return 0, err
+			return 0, 0, err
 		}
 	}
 
@@ -511,22 +539,32 @@ func (m *Manager) doRequeue(t Target, addr, naddr hostarch.Addr, private bool, c
 	done := b1.wakeLocked(&k1, ^uint32(0), nwake)
 
 	// Requeue the number required.
-	b1.requeueLocked(t, b2, &k1, &k2, nreq)
+	requeued := b1.requeueLocked(t, b2, &k1, &k2, nreq)
 
-	return done, nil
+	return done, requeued, nil
 }
 
 // Requeue wakes up to nwake waiters on the given addr, and unconditionally
 // requeues up to nreq waiters on naddr.
 func (m *Manager) Requeue(t Target, addr, naddr hostarch.Addr, private bool, nwake int, nreq int) (int, error) {
-	return m.doRequeue(t, addr, naddr, private, false, 0, nwake, nreq)
+	done, _, err := m.doRequeue(t, addr, private, naddr, private, false, 0, nwake, nreq)
+	return done, err
 }
 
 // RequeueCmp atomically checks that the addr contains val (via the Target),
 // wakes up to nwake waiters on addr and then unconditionally requeues nreq
 // waiters on naddr.
 func (m *Manager) RequeueCmp(t Target, addr, naddr hostarch.Addr, private bool, val uint32, nwake int, nreq int) (int, error) {
-	return m.doRequeue(t, addr, naddr, private, true, val, nwake, nreq)
+	done, _, err := m.doRequeue(t, addr, private, naddr, private, true, val, nwake, nreq)
+	return done, err
+}
+
+// RequeueCmpMixed is like RequeueCmp, but addr and naddr may differ in
+// privacy, as allowed by futex_requeue(2). It returns the total number of
+// waiters woken and requeued.
+func (m *Manager) RequeueCmpMixed(t Target, addr hostarch.Addr, private bool, naddr hostarch.Addr, nprivate bool, val uint32, nwake int, nreq int) (int, error) {
+	done, requeued, err := m.doRequeue(t, addr, private, naddr, nprivate, true, val, nwake, nreq)
+	return done + requeued, err
 }
 
 // WakeOp atomically applies op to the memory address addr2, wakes up to nwake1
@@ -571,17 +609,21 @@ func (m *Manager) WakeOp(t Target, addr1, addr2 hostarch.Addr, private bool, nwa
 // Waiter must be subsequently removed by calling WaitComplete, whether or not
 // a wakeup is received on w.C.
 func (m *Manager) WaitPrepare(w *Waiter, t Target, addr hostarch.Addr, private bool, val uint32, bitmask uint32) error {
-	k, err := getKey(t, addr, private)
-	if err != nil {
-		return err
-	}
-	// Ownership of k is transferred to w below.
-
 	// Prepare the Waiter before taking the bucket lock.
 	select {
 	case <-w.C:
 	default:
 	}
+	return m.waitPrepareOne(w, t, addr, private, val, bitmask)
+}
+
+// waitPrepareOne implements WaitPrepare, except for draining w.C.
+func (m *Manager) waitPrepareOne(w *Waiter, t Target, addr hostarch.Addr, private bool, val uint32, bitmask uint32) error {
+	k, err := getKey(t, addr, private)
+	if err != nil {
+		return err
+	}
+	// Ownership of k is transferred to w below.
 	w.key = k
 	w.bitmask = bitmask
 
@@ -603,10 +645,71 @@ func (m *Manager) WaitPrepare(w *Waiter, t Target, addr hostarch.Addr, private b
 	return nil
 }
 
+// MultipleWaitFutex describes one of the futexes waited on by
+// WaitMultiplePrepare.
+type MultipleWaitFutex struct {
+	// Addr is the address of the futex.
+	Addr hostarch.Addr
+
+	// Private is true if the futex is private to the address space.
+	Private bool
+
+	// Val is the value the futex must contain for the wait to proceed.
+	Val uint32
+}
+
+// WaitMultiplePrepare is the equivalent of WaitPrepare for multiple futexes,
+// as in futex_waitv(2): for each futex in fs, it atomically checks that the
+// futex contains the expected value, then enqueues the corresponding Waiter in
+// ws, which must have been returned by NewWaiters(len(fs)).
+//
+// If all futexes contain their expected values, WaitMultiplePrepare returns
+// (-1, nil), and the Waiters must subsequently be removed by calling
+// WaitMultipleComplete, whether or not a wakeup is received on C. Otherwise,
+// WaitMultiplePrepare dequeues all Waiters before returning; if one of them
+// was already woken, it returns its index, otherwise it returns the error
+// that prevented waiting.
+func (m *Manager) WaitMultiplePrepare(ws []*Waiter, t Target, fs []MultipleWaitFutex) (int, error) {
+	// Waiters share a channel, so drain it once.
+	select {
+	case <-ws[0].C:
+	default:
+	}
+	for i := range fs {
+		if err := m.waitPrepareOne(ws[i], t, fs[i].Addr, fs[i].Private, fs[i].Val, ^uint32(0)); err != nil {
+			if woken := m.WaitMultipleComplete(ws[:i], t); woken >= 0 {
+				return woken, nil
+			}
+			return -1, err
+		}
+	}
+	return -1, nil
+}
+
+// WaitMultipleComplete must be called when Waiters previously added by
+// WaitMultiplePrepare are no longer eligible to be woken. It returns the index
+// of the last Waiter in ws that was woken, or -1 if none was.
+func (m *Manager) WaitMultipleComplete(ws []*Waiter, t Target) int {
+	woken := -1
+	for i, w := range ws {
+		if m.waitComplete(w, t) {
+			woken = i
+		}
+	}
+	return woken
+}
+
 // WaitComplete must be called when a Waiter previously added by WaitPrepare is
 // no longer eligible to be woken.
 func (m *Manager) WaitComplete(w *Waiter, t Target) {
+	m.waitComplete(w, t)
+}
+
+// waitComplete implements WaitComplete, and returns true if w was dequeued by
+// a wakeup rather than by waitComplete.
+func (m *Manager) waitComplete(w *Waiter, t Target) bool {
 	// Remove w from the bucket it's in.
+	woken := true
 	for {
 		b := w.bucket.Load()
 
@@ -633,11 +736,13 @@ func (m *Manager) WaitComplete(w *Waiter, t Target) {
 		b.waiters.Remove(w)
 		w.bucket.Store(nil)
 		b.mu.Unlock()
+		woken = false
 		break
 	}
 
 	// Release references held by the waiter.
 	w.key.release(t)
+	return woken
 }
 
 // LockPI attempts to lock the futex following the Priority-inheritance futex
@@ -645,9 +750,8 @@ func (m *Manager) WaitComplete(w *Waiter, t Target) {
 // calling task is set to 'addr' to indicate the futex is owned. It returns true
 // if the futex was successfully acquired.
 //
-// FUTEX_OWNER_DIED is only set by the Linux when robust lists are in use (see
-// exit_robust_list()). Given we don't support robust lists, although handled
-// below, it's never set.
+// FUTEX_OWNER_DIED is set when the owner of a futex on a robust list exits
+// (see Task.exitRobustList), and is preserved when the futex is acquired.
 func (m *Manager) LockPI(w *Waiter, t Target, addr hostarch.Addr, tid uint32, private, try bool) (bool, error) {
 	k, err := getKey(t, addr, private)
 	if err != nil {
@@ -765,21 +869,7 @@ func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bu
 		return linuxerr.EPERM
 	}
 
-	var next *Waiter  // Who's the next owner?
-	var next2 *Waiter // Who's the one after that?
-	for w := b.waiters.Front(); w != nil; w = w.Next() {
-		if !w.key.matches(key) {
-			continue
-		}
-
-		if next == nil {
-			next = w
-		} else {
-			next2 = w
-			break
-		}
-	}
-
+	next, next2 := b.nextPIWaitersLocked(key)
 	if next == nil {
 		// It's safe to set 0 because there are no waiters, no new owner, and the
 		// executing task is the current owner (no owner died bit).
@@ -813,3 +903,240 @@ func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bu
 	b.wakeWaiterLocked(next)
 	return nil
 }
+
+// nextPIWaitersLocked returns the next owner of the PI futex represented by
+// key, and the waiter after that, if any.
+//
+// Preconditions: b is locked.
+func (b *bucket) nextPIWaitersLocked(key *Key) (next, next2 *Waiter) {
+	for w := b.waiters.Front(); w != nil; w = w.Next() {
+		if !w.key.matches(key) {
+			continue
+		}
+
+		if next == nil {
+			next = w
+		} else {
+			next2 = w
+			break
+		}
+	}
+	return next, next2
+}
+
+// UnlockPIOwnerDied hands the PI futex at addr, whose owner has died and whose
+// TID has already been cleared, to the next waiter (FIFO) if there is one. As
+// in Linux, the new owner's TID is set with FUTEX_OWNER_DIED, so that user
+// mode can recover the state protected by the futex. It returns true if a
+// waiter was woken.
+func (m *Manager) UnlockPIOwnerDied(t Target, addr hostarch.Addr, private bool) (bool, error) {
+	k, err := getKey(t, addr, private)
+	if err != nil {
+		return false, err
+	}
+	b := m.lockBucket(&k)
+	defer func() {
+		k.release(t)
+		b.mu.Unlock()
+	}()
+
+	for {
+		cur, err := t.LoadUint32(addr)
+		if err != nil {
+			return false, err
+		}
+		if cur&linux.FUTEX_TID_MASK != 0 {
+			// Someone else acquired the futex in the meantime.
+			return false, nil
+		}
+
+		next, next2 := b.nextPIWaitersLocked(&k)
+		if next == nil {
+			return false, nil
+		}
+		val := next.tid | linux.FUTEX_OWNER_DIED
+		if next2 != nil {
+			val |= linux.FUTEX_WAITERS
+		}
+		prev, err := t.CompareAndSwapUint32(addr, cur, val)
+		if err != nil {
+			return false, err
+		}
+		if prev != cur {
+			continue
+		}
+		b.wakeWaiterLocked(next)
+		return true, nil
+	}
+}
+
+// WaitRequeuePIPrepare is the equivalent of WaitPrepare for
+// FUTEX_WAIT_REQUEUE_PI. It enqueues w on the non-PI futex at addr, from which
+// it may be requeued to the PI futex at naddr by CmpRequeuePI. tid is the
+// thread ID of the waiting task, which becomes the owner of naddr when w is
+// given the PI futex.
+//
+// If WaitRequeuePIPrepare succeeds, WaitRequeuePIComplete must be called to
+// remove w.
+func (m *Manager) WaitRequeuePIPrepare(w *Waiter, t Target, addr, naddr hostarch.Addr, private bool, val, tid uint32) error {
+	k, err := getKey(t, addr, private)
+	if err != nil {
+		return err
+	}
+	nk, err := getKey(t, naddr, private)
+	if err != nil {
+		k.release(t)
+		return err
+	}
+	same := k.matches(&nk)
+	k.release(t)
+	if same {
+		nk.release(t)
+		return linuxerr.EINVAL
+	}
+
+	// Prepare the Waiter before taking the bucket lock.
+	select {
+	case <-w.C:
+	default:
+	}
+	w.tid = tid
+	w.requeuePI = true
+	w.requeuePIKey = nk
+	w.requeuedPI = false
+	if err := m.waitPrepareOne(w, t, addr, private, val, ^uint32(0)); err != nil {
+		w.requeuePI = false
+		w.requeuePIKey.release(t)
+		return err
+	}
+	return nil
+}
+
+// WaitRequeuePIComplete must be called when a Waiter previously added by
+// WaitRequeuePIPrepare is no longer eligible to be woken. It returns true if
+// the waiter was requeued to the PI futex, and whether it acquired it.
+func (m *Manager) WaitRequeuePIComplete(w *Waiter, t Target) (requeued, acquired bool) {
+	woken := m.waitComplete(w, t)
+	requeued = w.requeuedPI
+	w.requeuePI = false
+	w.requeuePIKey.release(t)
+	w.requeuedPI = false
+	// Once requeued, a waiter is only woken when it is given the PI futex.
+	return requeued, requeued && woken
+}
+
+// CmpRequeuePI implements FUTEX_CMP_REQUEUE_PI. It atomically checks that addr
+// contains val, and then tries to acquire the PI futex at naddr on behalf of
+// the first waiter on addr, waking it if successful. Remaining waiters, up to
+// a total of nreq+1 waiters woken or requeued, are requeued to wait for naddr.
+// All waiters on addr must have been enqueued by WaitRequeuePIPrepare with
+// naddr.
+//
+// It returns the number of waiters woken and requeued.
+func (m *Manager) CmpRequeuePI(t Target, addr, naddr hostarch.Addr, private bool, val uint32, nreq int) (int, error) {
+	k1, err := getKey(t, addr, private)
+	if err != nil {
+		return 0, err
+	}
+	defer k1.release(t)
+	k2, err := getKey(t, naddr, private)
+	if err != nil {
+		return 0, err
+	}
+	defer k2.release(t)
+	if k1.matches(&k2) {
+		return 0, linuxerr.EINVAL
+	}
+
+	b1, b2, lockedFirst, lockedSecond := m.lockBuckets(&k1, &k2)
+	defer m.unlockBuckets(lockedFirst, lockedSecond)
+
+	if err := check(t, addr, val); err != nil {
+		return 0, err
+	}
+
+	var top *Waiter
+	for w := b1.waiters.Front(); w != nil; w = w.Next() {
+		if w.key.matches(&k1) {
+			top = w
+			break
+		}
+	}
+	if top == nil {
+		return 0, nil
+	}
+	if !top.requeuePI || !top.requeuePIKey.matches(&k2) {
+		return 0, linuxerr.EINVAL
+	}
+
+	// Try to acquire naddr for the top waiter. Whether or not this succeeds,
+	// FUTEX_WAITERS is set in naddr so that its owner will wake the requeued
+	// waiters with FUTEX_UNLOCK_PI.
+	acquired, err := proxyLockPI(t, naddr, top.tid)
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	if acquired {
+		top.key.release(t)
+		top.key = k2.clone()
+		top.requeuedPI = true
+		b1.wakeWaiterLocked(top)
+		done++
+	}
+
+	for w := b1.waiters.Front(); done < nreq+1 && w != nil; {
+		if !w.key.matches(&k1) {
+			w = w.Next()
+			continue
+		}
+		if !w.requeuePI || !w.requeuePIKey.matches(&k2) {
+			return 0, linuxerr.EINVAL
+		}
+
+		requeued := w
+		w = w.Next() // Next iteration.
+		b1.waiters.Remove(requeued)
+		requeued.key.release(t)
+		requeued.key = k2.clone()
+		requeued.requeuedPI = true
+		b2.waiters.PushBack(requeued)
+		requeued.bucket.Store(b2)
+		done++
+	}
+	return done, nil
+}
+
+// proxyLockPI attempts to acquire the PI futex at addr on behalf of the task
+// with the given TID, and otherwise sets FUTEX_WAITERS in it. It returns true if
+// the futex was acquired.
+func proxyLockPI(t Target, addr hostarch.Addr, tid uint32) (bool, error) {
+	for {
+		cur, err := t.LoadUint32(addr)
+		if err != nil {
+			return false, err
+		}
+		if (cur & linux.FUTEX_TID_MASK) == tid {
+			return false, linuxerr.EDEADLK
+		}
+
+		var val uint32
+		if (cur & linux.FUTEX_TID_MASK) == 0 {
+			// Set TID and preserve owner died status.
+			val = tid | (cur & linux.FUTEX_OWNER_DIED) | linux.FUTEX_WAITERS
+		} else if cur&linux.FUTEX_WAITERS == 0 {
+			val = cur | linux.FUTEX_WAITERS
+		} else {
+			return false, nil
+		}
+		prev, err := t.CompareAndSwapUint32(addr, cur, val)
+		if err != nil {
+			return false, err
+		}
+		if prev != cur {
+			// CAS failed, retry...
+			continue
+		}
+		return (cur & linux.FUTEX_TID_MASK) == 0, nil
+	}
+}
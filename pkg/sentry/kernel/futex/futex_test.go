@@ -20,6 +20,7 @@ import (
 	"testing"
 	"unsafe"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -200,6 +201,67 @@ func TestFutexWakeUnrelated(t *testing.T) {
 	}
 }
 
+func TestWaitMultiple(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(3 * sizeofInt32)
+
+			// Wait on three futexes at once.
+			fs := []MultipleWaitFutex{
+				{Addr: 0 * sizeofInt32, Private: private},
+				{Addr: 1 * sizeofInt32, Private: private},
+				{Addr: 2 * sizeofInt32, Private: private},
+			}
+			ws := NewWaiters(len(fs))
+			if woken, err := m.WaitMultiplePrepare(ws, d, fs); err != nil || woken != -1 {
+				t.Fatalf("WaitMultiplePrepare: got (%d, %v), wanted (-1, nil)", woken, err)
+			}
+
+			// Wake the second futex.
+			if n, err := m.Wake(d, 1*sizeofInt32, private, ^uint32(0), 1); err != nil || n != 1 {
+				t.Errorf("Wake: got (%d, %v), wanted (1, nil)", n, err)
+			}
+			if !ws[0].woken() {
+				t.Error("waiters not woken")
+			}
+
+			// Expect that the second waiter is reported, and that the
+			// others were dequeued.
+			if woken := m.WaitMultipleComplete(ws, d); woken != 1 {
+				t.Errorf("WaitMultipleComplete: got %d, wanted 1", woken)
+			}
+			if n, err := m.Wake(d, 0, private, ^uint32(0), 1); err != nil || n != 0 {
+				t.Errorf("Wake after WaitMultipleComplete: got (%d, %v), wanted (0, nil)", n, err)
+			}
+		})
+	}
+}
+
+func TestWaitMultipleValueMismatch(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(2 * sizeofInt32)
+			d.data[1*sizeofInt32] = 1
+
+			fs := []MultipleWaitFutex{
+				{Addr: 0 * sizeofInt32, Private: private},
+				{Addr: 1 * sizeofInt32, Private: private},
+			}
+			ws := NewWaiters(len(fs))
+			if woken, err := m.WaitMultiplePrepare(ws, d, fs); err != linuxerr.EAGAIN || woken != -1 {
+				t.Fatalf("WaitMultiplePrepare: got (%d, %v), wanted (-1, %v)", woken, err, linuxerr.EAGAIN)
+			}
+
+			// Expect that the first waiter was dequeued.
+			if n, err := m.Wake(d, 0, private, ^uint32(0), 1); err != nil || n != 0 {
+				t.Errorf("Wake: got (%d, %v), wanted (0, nil)", n, err)
+			}
+		})
+	}
+}
+
 func TestWakeOpEmpty(t *testing.T) {
 	for _, private := range []bool{false, true} {
 		t.Run(futexKind(private), func(t *testing.T) {
@@ -462,6 +524,97 @@ const (
 // futex manager in order to implement the sync.Locker interface.
 // Beyond being used as a Locker, this is a simple mechanism for
 // changing the underlying values for simpler tests.
+func TestCmpRequeuePI(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(2 * sizeofInt32)
+			const (
+				tid1 = 1
+				tid2 = 2
+			)
+
+			// Start two waiters waiting to be requeued from the first address
+			// to the second.
+			w1 := NewWaiter()
+			if err := m.WaitRequeuePIPrepare(w1, d, 0*sizeofInt32, 1*sizeofInt32, private, 0, tid1); err != nil {
+				t.Fatalf("WaitRequeuePIPrepare: got %v, wanted nil", err)
+			}
+			w2 := NewWaiter()
+			if err := m.WaitRequeuePIPrepare(w2, d, 0*sizeofInt32, 1*sizeofInt32, private, 0, tid2); err != nil {
+				t.Fatalf("WaitRequeuePIPrepare: got %v, wanted nil", err)
+			}
+
+			// The second address is unlocked, so the first waiter should
+			// acquire it and the second should be requeued.
+			if n, err := m.CmpRequeuePI(d, 0*sizeofInt32, 1*sizeofInt32, private, 0, 1); err != nil || n != 2 {
+				t.Errorf("CmpRequeuePI: got (%d, %v), wanted (2, nil)", n, err)
+			}
+			if !w1.woken() {
+				t.Error("w1 not woken")
+			}
+			if w2.woken() {
+				t.Error("w2 woken unexpectedly")
+			}
+			if got, _ := d.LoadUint32(1 * sizeofInt32); got != tid1|linux.FUTEX_WAITERS {
+				t.Errorf("PI futex: got %#x, wanted %#x", got, tid1|linux.FUTEX_WAITERS)
+			}
+			if requeued, acquired := m.WaitRequeuePIComplete(w1, d); !requeued || !acquired {
+				t.Errorf("WaitRequeuePIComplete(w1): got (%t, %t), wanted (true, true)", requeued, acquired)
+			}
+
+			// Unlocking the PI futex should hand it to the second waiter.
+			if err := m.UnlockPI(d, 1*sizeofInt32, tid1, private); err != nil {
+				t.Errorf("UnlockPI: got %v, wanted nil", err)
+			}
+			if !w2.woken() {
+				t.Error("w2 not woken")
+			}
+			if got, _ := d.LoadUint32(1 * sizeofInt32); got != tid2 {
+				t.Errorf("PI futex: got %#x, wanted %#x", got, tid2)
+			}
+			if requeued, acquired := m.WaitRequeuePIComplete(w2, d); !requeued || !acquired {
+				t.Errorf("WaitRequeuePIComplete(w2): got (%t, %t), wanted (true, true)", requeued, acquired)
+			}
+		})
+	}
+}
+
+func TestUnlockPIOwnerDied(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(sizeofInt32)
+			const (
+				tid1 = 1
+				tid2 = 2
+			)
+
+			// Lock the futex as tid1, then wait for it as tid2.
+			if locked, err := m.LockPI(NewWaiter(), d, 0, tid1, private, false); err != nil || !locked {
+				t.Fatalf("LockPI: got (%t, %v), wanted (true, nil)", locked, err)
+			}
+			w := NewWaiter()
+			if locked, err := m.LockPI(w, d, 0, tid2, private, false); err != nil || locked {
+				t.Fatalf("LockPI: got (%t, %v), wanted (false, nil)", locked, err)
+			}
+			defer m.WaitComplete(w, d)
+
+			// Simulate the death of tid1, as by the robust list.
+			d.SwapUint32(0, linux.FUTEX_WAITERS|linux.FUTEX_OWNER_DIED)
+			if woken, err := m.UnlockPIOwnerDied(d, 0, private); err != nil || !woken {
+				t.Errorf("UnlockPIOwnerDied: got (%t, %v), wanted (true, nil)", woken, err)
+			}
+			if !w.woken() {
+				t.Error("waiter not woken")
+			}
+			if got, _ := d.LoadUint32(0); got != tid2|linux.FUTEX_OWNER_DIED {
+				t.Errorf("PI futex: got %#x, wanted %#x", got, tid2|linux.FUTEX_OWNER_DIED)
+			}
+		})
+	}
+}
+
 type testMutex struct {
 	a hostarch.Addr
 	d testData
@@ -39,6 +39,7 @@ import (
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/bpf"
 	"gvisor.dev/gvisor/pkg/cleanup"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/cpuid"
@@ -139,18 +140,19 @@ type Kernel struct {
 	mf *pgalloc.MemoryFile `state:"nosave"`
 
 	// See InitKernelArgs for the meaning of these fields.
-	featureSet                  cpuid.FeatureSet
-	timekeeper                  *Timekeeper
-	tasks                       *TaskSet
-	rootUserNamespace           *auth.UserNamespace
-	rootNetworkNamespace        *inet.Namespace
-	applicationCores            uint
-	useHostCores                bool
-	extraAuxv                   []arch.AuxEntry
-	vdso                        *loader.VDSO
-	rootUTSNamespace            *UTSNamespace
-	rootIPCNamespace            *IPCNamespace
-	rootAbstractSocketNamespace *AbstractSocketNamespace
+	featureSet           cpuid.FeatureSet
+	timekeeper           *Timekeeper
+	tasks                *TaskSet
+	rootUserNamespace    *auth.UserNamespace
+	rootNetworkNamespace *inet.Namespace
+	applicationCores     uint
+	cpuTopology          CPUTopology
+	useHostCores         bool
+	extraAuxv            []arch.AuxEntry
+	vdso                 *loader.VDSO
+	rootUTSNamespace     *UTSNamespace
+	rootIPCNamespace     *IPCNamespace
+	rootTimeNamespace    *TimeNamespace
 
 	// futexes is the "root" futex.Manager, from which all others are forked.
 	// This is necessary to ensure that shared futexes are coherent across all
@@ -223,6 +225,24 @@ type Kernel struct {
 	// Invariant: cpuClockTickerStopCond.L == &runningTasksMu.
 	cpuClockTickerStopCond sync.Cond `state:"nosave"`
 
+	// memStalledTasks is the number of tasks handling application page
+	// faults, and ioStalledTasks is the number of tasks in
+	// TaskGoroutineBlockedUninterruptible. They are used for pressure stall
+	// information.
+	//
+	// memStalledTasks and ioStalledTasks must be accessed atomically.
+	memStalledTasks atomicbitops.Int64
+	ioStalledTasks  atomicbitops.Int64
+
+	// psi accumulates pressure stall information. It is not saved, so PSI
+	// restarts from zero after restore.
+	psi pressureStats `state:"nosave"`
+
+	// cpuBandwidthLimits is the number of enforced cgroup CPU bandwidth limits
+	// that aren't unlimited. While it is zero, the CPU clock ticker doesn't
+	// charge CPU time to cgroups.
+	cpuBandwidthLimits atomicbitops.Int64
+
 	// uniqueID is used to generate unique identifiers.
 	//
 	// uniqueID is mutable, and is accessed using atomic memory operations.
@@ -304,6 +324,16 @@ type Kernel struct {
 	// external wait so that the watchdog doesn't report the task stuck.
 	SleepForAddressSpaceActivation bool
 
+	// MemfdSecret is true if memfd_secret(2) is enabled. Secret memory files
+	// are backed by host files, which the seccomp filters only allow the
+	// sentry to create in that case.
+	MemfdSecret bool
+
+	// secretMemFiles is the number of open secret memory files. The contents
+	// of secret memory must not be written to a checkpoint, so the kernel
+	// can't be saved while any is open.
+	secretMemFiles atomicbitops.Int64 `state:"nosave"`
+
 	// Exceptions to YAMA ptrace restrictions. Each key-value pair represents a
 	// tracee-tracer relationship. The key is a process (technically, the thread
 	// group leader) that can be traced by any thread that is a descendant of the
@@ -316,14 +346,47 @@ type Kernel struct {
 	// YAMAPtraceScope is the current level of YAMA ptrace restrictions.
 	YAMAPtraceScope atomicbitops.Int32
 
+	// corePattern is the template used to name core dump files, as in Linux's
+	// /proc/sys/kernel/core_pattern. It is protected by corePatternMu.
+	corePattern   string
+	corePatternMu sync.Mutex `state:"nosave"`
+
+	// binfmtMisc contains the binary formats registered through
+	// /proc/sys/fs/binfmt_misc.
+	binfmtMisc loader.BinfmtMisc
+
+	// elfCache caches the parsed headers of executed ELFs. It isn't saved,
+	// since file identities may change across save/restore.
+	elfCache loader.ELFCache `state:"nosave"`
+
 	// cgroupRegistry contains the set of active cgroup controllers on the
 	// system. It is controller by cgroupfs. Nil if cgroupfs is unavailable on
 	// the system.
 	cgroupRegistry *CgroupRegistry
 
+	// cgroupBPF tracks the eBPF programs attached to cgroups.
+	cgroupBPF cgroupBPF
+
 	// userCountersMap maps auth.KUID into a set of user counters.
 	userCountersMap   map[auth.KUID]*userCounters
 	userCountersMapMu userCountersMutex `state:"nosave"`
+
+	// containerCPU maps container IDs to their CPU limits. It is protected by
+	// containerCPUMu.
+	containerCPU   map[string]*containerCPULimits
+	containerCPUMu sync.Mutex `state:"nosave"`
+
+	// onlineCPUs is the set of online CPUs, or nil if all CPUs are online. It
+	// is protected by onlineCPUsMu. See SetOnlineCPUs.
+	onlineCPUs   sched.CPUSet
+	onlineCPUsMu sync.Mutex `state:"nosave"`
+
+	// ueventSeqnum is the sequence number of the last device event, as in
+	// Linux's uevent_seqnum.
+	ueventSeqnum atomicbitops.Uint64
+
+	// oom is the sandbox OOM killer.
+	oom oomKiller
 }
 
 // InitKernelArgs holds arguments to Init.
@@ -353,6 +416,10 @@ type InitKernelArgs struct {
 	// will be overridden.
 	UseHostCores bool
 
+	// CPUTopology describes how the ApplicationCores CPUs are arranged into
+	// cores, sockets and NUMA nodes. Unset fields take default values.
+	CPUTopology CPUTopology
+
 	// ExtraAuxv contains additional auxiliary vector entries that are added to
 	// each process by the ELF loader.
 	ExtraAuxv []arch.AuxEntry
@@ -366,9 +433,6 @@ type InitKernelArgs struct {
 	// RootIPCNamespace is the root IPC namespace.
 	RootIPCNamespace *IPCNamespace
 
-	// RootAbstractSocketNamespace is the root Abstract Socket namespace.
-	RootAbstractSocketNamespace *AbstractSocketNamespace
-
 	// PIDNamespace is the root PID namespace.
 	PIDNamespace *PIDNamespace
 }
@@ -397,7 +461,7 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.rootUserNamespace = args.RootUserNamespace
 	k.rootUTSNamespace = args.RootUTSNamespace
 	k.rootIPCNamespace = args.RootIPCNamespace
-	k.rootAbstractSocketNamespace = args.RootAbstractSocketNamespace
+	k.rootTimeNamespace = NewTimeNamespace(args.RootUserNamespace)
 	k.rootNetworkNamespace = args.RootNetworkNamespace
 	if k.rootNetworkNamespace == nil {
 		k.rootNetworkNamespace = inet.NewRootNamespace(nil, nil, args.RootUserNamespace)
@@ -418,12 +482,17 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 			k.applicationCores = minAppCores
 		}
 	}
+	k.cpuTopology = args.CPUTopology
+	if err := k.cpuTopology.init(k.applicationCores); err != nil {
+		return fmt.Errorf("invalid CPU topology: %w", err)
+	}
 	k.extraAuxv = args.ExtraAuxv
 	k.vdso = args.Vdso
 	k.futexes = futex.NewManager()
 	k.netlinkPorts = port.New()
 	k.ptraceExceptions = make(map[*Task]*Task)
 	k.YAMAPtraceScope = atomicbitops.FromInt32(linux.YAMA_SCOPE_RELATIONAL)
+	k.corePattern = defaultCorePattern
 	k.userCountersMap = make(map[auth.KUID]*userCounters)
 
 	ctx := k.SupervisorContext()
@@ -453,6 +522,7 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.rootNetworkNamespace.SetInode(nsfs.NewInode(ctx, k.nsfsMount, k.rootNetworkNamespace))
 	k.rootIPCNamespace.SetInode(nsfs.NewInode(ctx, k.nsfsMount, k.rootIPCNamespace))
 	k.rootUTSNamespace.SetInode(nsfs.NewInode(ctx, k.nsfsMount, k.rootUTSNamespace))
+	k.rootTimeNamespace.SetInode(nsfs.NewInode(ctx, k.nsfsMount, k.rootTimeNamespace))
 
 	tmpfsOpts := vfs.GetFilesystemOptions{
 		InternalData: tmpfs.FilesystemOpts{
@@ -499,6 +569,10 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 	k.extMu.Lock()
 	defer k.extMu.Unlock()
 
+	if n := k.secretMemFiles.Load(); n != 0 {
+		return fmt.Errorf("%d memfd_secret files are open, and secret memory can't be saved", n)
+	}
+
 	// Stop time.
 	k.pauseTimeLocked(ctx)
 	defer k.resumeTimeLocked(ctx)
@@ -727,8 +801,9 @@ type CreateProcessArgs struct {
 	// PIDNamespace is the initial PID Namespace.
 	PIDNamespace *PIDNamespace
 
-	// AbstractSocketNamespace is the initial Abstract Socket namespace.
-	AbstractSocketNamespace *AbstractSocketNamespace
+	// NetworkNamespace is the initial network namespace. If nil, the root
+	// network namespace is used. CreateProcess takes its own reference.
+	NetworkNamespace *inet.Namespace
 
 	// MountNamespace optionally contains the mount namespace for this
 	// process. If nil, the init process's mount namespace is used.
@@ -742,6 +817,11 @@ type CreateProcessArgs struct {
 
 	// InitialCgroups are the cgroups the container is initialized to.
 	InitialCgroups map[Cgroup]struct{}
+
+	// SyscallFilters are seccomp-bpf filters installed on the process before
+	// it starts. Like filters installed by the process itself, they apply to
+	// all of its threads and children, and can't be removed.
+	SyscallFilters []bpf.Program
 }
 
 // NewContext returns a context.Context that represents the task that will be
@@ -793,6 +873,9 @@ func (ctx *createProcessContext) Value(key any) any {
 		mntns.IncRef()
 		return mntns
 	case inet.CtxStack:
+		if netns := ctx.args.NetworkNamespace; netns != nil {
+			return netns.Stack()
+		}
 		return ctx.kernel.RootNetworkNamespace().Stack()
 	case ktime.CtxRealtimeClock:
 		return ctx.kernel.RealtimeClock()
@@ -931,27 +1014,36 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 		return nil, 0, errors.New(se.String())
 	}
 
+	if syscallFiltersLength(args.SyscallFilters) > maxSyscallFilterInstructions {
+		return nil, 0, fmt.Errorf("syscall filters are too long")
+	}
+
 	// Take a reference on the FDTable, which will be transferred to
 	// TaskSet.NewTask().
 	args.FDTable.IncRef()
 
+	netns := args.NetworkNamespace
+	if netns == nil {
+		netns = k.RootNetworkNamespace()
+	}
+
 	// Create the task.
 	config := &TaskConfig{
-		Kernel:                  k,
-		ThreadGroup:             tg,
-		TaskImage:               image,
-		FSContext:               fsContext,
-		FDTable:                 args.FDTable,
-		Credentials:             args.Credentials,
-		NetworkNamespace:        k.RootNetworkNamespace(),
-		AllowedCPUMask:          sched.NewFullCPUSet(k.applicationCores),
-		UTSNamespace:            args.UTSNamespace,
-		IPCNamespace:            args.IPCNamespace,
-		AbstractSocketNamespace: args.AbstractSocketNamespace,
-		MountNamespace:          mntns,
-		ContainerID:             args.ContainerID,
-		InitialCgroups:          args.InitialCgroups,
-		UserCounters:            k.GetUserCounters(args.Credentials.RealKUID),
+		Kernel:           k,
+		ThreadGroup:      tg,
+		TaskImage:        image,
+		FSContext:        fsContext,
+		FDTable:          args.FDTable,
+		Credentials:      args.Credentials,
+		NetworkNamespace: netns,
+		AllowedCPUMask:   k.containerCPUMask(args.ContainerID),
+		UTSNamespace:     args.UTSNamespace,
+		IPCNamespace:     args.IPCNamespace,
+		TimeNamespace:    k.RootTimeNamespace(),
+		MountNamespace:   mntns,
+		ContainerID:      args.ContainerID,
+		InitialCgroups:   args.InitialCgroups,
+		UserCounters:     k.GetUserCounters(args.Credentials.RealKUID),
 		// A task with no parent starts out with no session keyring.
 		SessionKeyring: nil,
 	}
@@ -960,6 +1052,9 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 	if err != nil {
 		return nil, 0, err
 	}
+	if len(args.SyscallFilters) > 0 {
+		t.syscallFilters.Store(append([]bpf.Program(nil), args.SyscallFilters...))
+	}
 	t.traceExecEvent(image) // Simulate exec for tracing.
 
 	// Success.
@@ -1056,6 +1151,9 @@ func (k *Kernel) pauseTimeLocked(ctx context.Context) {
 			})
 		}
 	}
+	if timer := k.oomTimer(); timer != nil {
+		timer.Pause()
+	}
 	k.timekeeper.PauseUpdates()
 }
 
@@ -1071,6 +1169,9 @@ func (k *Kernel) resumeTimeLocked(ctx context.Context) {
 	// execution.
 
 	k.timekeeper.ResumeUpdates()
+	if timer := k.oomTimer(); timer != nil {
+		timer.Resume()
+	}
 	for t := range k.tasks.Root.tids {
 		if t == t.tg.leader {
 			t.tg.itimerRealTimer.Resume()
@@ -1302,6 +1403,32 @@ func (k *Kernel) TaskSet() *TaskSet {
 	return k.tasks
 }
 
+// MemoryManagers returns the MemoryManagers used by tasks in k. Each
+// MemoryManager is returned once, even if it is shared by multiple tasks, and
+// the caller must call DecUsers on each returned MemoryManager.
+func (k *Kernel) MemoryManagers() []*mm.MemoryManager {
+	seen := make(map[*mm.MemoryManager]struct{})
+	var mms []*mm.MemoryManager
+	for _, t := range k.tasks.Root.Tasks() {
+		var tmm *mm.MemoryManager
+		t.WithMuLocked(func(t *Task) {
+			tmm = t.MemoryManager()
+		})
+		if tmm == nil {
+			continue
+		}
+		if _, ok := seen[tmm]; ok {
+			continue
+		}
+		if !tmm.IncUsers() {
+			continue
+		}
+		seen[tmm] = struct{}{}
+		mms = append(mms, tmm)
+	}
+	return mms
+}
+
 // RootUserNamespace returns the root UserNamespace.
 func (k *Kernel) RootUserNamespace() *auth.UserNamespace {
 	return k.rootUserNamespace
@@ -1319,21 +1446,40 @@ func (k *Kernel) RootIPCNamespace() *IPCNamespace {
 	return k.rootIPCNamespace
 }
 
+// RootTimeNamespace takes a reference and returns the root TimeNamespace.
+func (k *Kernel) RootTimeNamespace() *TimeNamespace {
+	k.rootTimeNamespace.IncRef()
+	return k.rootTimeNamespace
+}
+
 // RootPIDNamespace returns the root PIDNamespace.
 func (k *Kernel) RootPIDNamespace() *PIDNamespace {
 	return k.tasks.Root
 }
 
-// RootAbstractSocketNamespace returns the root AbstractSocketNamespace.
-func (k *Kernel) RootAbstractSocketNamespace() *AbstractSocketNamespace {
-	return k.rootAbstractSocketNamespace
-}
-
 // RootNetworkNamespace returns the root network namespace, always non-nil.
 func (k *Kernel) RootNetworkNamespace() *inet.Namespace {
 	return k.rootNetworkNamespace
 }
 
+// NewIsolatedNamespaces creates UTS, IPC and network namespaces owned by the
+// root user namespace, as if by unshare(CLONE_NEWUTS | CLONE_NEWIPC |
+// CLONE_NEWNET) from the root namespaces. The new network namespace only has
+// a loopback device. The caller receives a reference on each namespace.
+func (k *Kernel) NewIsolatedNamespaces(ctx context.Context, hostName, domainName string) (*UTSNamespace, *IPCNamespace, *inet.Namespace, error) {
+	userns := k.rootUserNamespace
+	ipcns := NewIPCNamespace(userns)
+	if err := ipcns.InitPosixQueues(ctx, &k.vfs, auth.NewRootCredentials(userns)); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create mqfs filesystem: %v", err)
+	}
+	ipcns.SetInode(nsfs.NewInode(ctx, k.nsfsMount, ipcns))
+	utsns := NewUTSNamespace(hostName, domainName, userns)
+	utsns.SetInode(nsfs.NewInode(ctx, k.nsfsMount, utsns))
+	netns := inet.NewNamespace(k.rootNetworkNamespace, userns)
+	netns.SetInode(nsfs.NewInode(ctx, k.nsfsMount, netns))
+	return utsns, ipcns, netns, nil
+}
+
 // GlobalInit returns the thread group with ID 1 in the root PID namespace, or
 // nil if no such thread group exists. GlobalInit may return a thread group
 // containing no tasks if the thread group has already exited.
@@ -1354,6 +1500,32 @@ func (k *Kernel) ApplicationCores() uint {
 	return k.applicationCores
 }
 
+// CPUTopology returns the topology of the CPUs visible to sandboxed
+// applications.
+func (k *Kernel) CPUTopology() *CPUTopology {
+	return &k.cpuTopology
+}
+
+// CorePattern returns the template used to name core dump files.
+func (k *Kernel) CorePattern() string {
+	k.corePatternMu.Lock()
+	defer k.corePatternMu.Unlock()
+	return k.corePattern
+}
+
+// SetCorePattern sets the template used to name core dump files.
+func (k *Kernel) SetCorePattern(pattern string) {
+	k.corePatternMu.Lock()
+	defer k.corePatternMu.Unlock()
+	k.corePattern = pattern
+}
+
+// BinfmtMisc returns the binary formats registered through
+// /proc/sys/fs/binfmt_misc.
+func (k *Kernel) BinfmtMisc() *loader.BinfmtMisc {
+	return &k.binfmtMisc
+}
+
 // RealtimeClock returns the application CLOCK_REALTIME clock.
 func (k *Kernel) RealtimeClock() ktime.Clock {
 	return k.timekeeper.realtimeClock
@@ -1364,6 +1536,11 @@ func (k *Kernel) MonotonicClock() ktime.Clock {
 	return k.timekeeper.monotonicClock
 }
 
+// TAIClock returns the application CLOCK_TAI clock.
+func (k *Kernel) TAIClock() ktime.Clock {
+	return k.timekeeper.taiClock
+}
+
 // CPUClockNow returns the current value of k.cpuClock.
 func (k *Kernel) CPUClockNow() uint64 {
 	return k.cpuClock.Load()
@@ -1447,6 +1624,17 @@ func (k *Kernel) SetMemoryFile(mf *pgalloc.MemoryFile) {
 	k.mf = mf
 }
 
+// SecretMemFileOpened records that a secret memory file was created. It must
+// be balanced by a call to SecretMemFileReleased.
+func (k *Kernel) SecretMemFileOpened() {
+	k.secretMemFiles.Add(1)
+}
+
+// SecretMemFileReleased records that a secret memory file was released.
+func (k *Kernel) SecretMemFileReleased() {
+	k.secretMemFiles.Add(-1)
+}
+
 // MemoryFile implements pgalloc.MemoryFileProvider.MemoryFile.
 func (k *Kernel) MemoryFile() *pgalloc.MemoryFile {
 	return k.mf
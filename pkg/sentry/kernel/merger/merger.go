@@ -0,0 +1,114 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package merger implements the merger goroutine, which deduplicates
+// application memory by merging pages with identical contents.
+package merger
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Opts contains options to New.
+type Opts struct {
+	// All is true if all private memory may be merged, rather than only
+	// memory for which madvise(MADV_MERGEABLE) was called.
+	All bool
+
+	// Interval is the time between scans.
+	Interval time.Duration
+
+	// PagesPerScan is the number of pages scanned in each scan, across all
+	// MemoryManagers.
+	PagesPerScan uint64
+}
+
+// Merger periodically merges identical pages of application memory.
+type Merger struct {
+	k    *kernel.Kernel
+	opts Opts
+
+	// Writing to this channel indicates the merger goroutine should stop.
+	stop chan struct{}
+
+	// done is used to signal when the merger goroutine has exited.
+	done sync.WaitGroup
+}
+
+// New creates a new Merger.
+func New(k *kernel.Kernel, opts Opts) *Merger {
+	return &Merger{
+		k:    k,
+		opts: opts,
+		stop: make(chan struct{}),
+	}
+}
+
+// Start starts the merger goroutine. Start must not be called concurrently
+// with Stop and may only be called once.
+func (m *Merger) Start() {
+	m.done.Add(1)
+	go m.run() // S/R-SAFE: stopped before save by Stop.
+}
+
+// Stop stops the merger goroutine. Stop must not be called concurrently with
+// Start and may only be called once. Since the merger mutates
+// MemoryManagers, it must be stopped before the kernel is saved.
+func (m *Merger) Stop() {
+	close(m.stop)
+	m.done.Wait()
+}
+
+func (m *Merger) run() {
+	defer m.done.Done()
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.scan()
+		}
+	}
+}
+
+// scan scans up to m.opts.PagesPerScan pages, divided evenly between
+// MemoryManagers.
+func (m *Merger) scan() {
+	mms := m.k.MemoryManagers()
+	if len(mms) == 0 {
+		return
+	}
+	perMM := m.opts.PagesPerScan / uint64(len(mms))
+	if perMM == 0 {
+		perMM = 1
+	}
+	ctx := m.k.SupervisorContext()
+	var scanned, merged uint64
+	for _, tmm := range mms {
+		s, n := tmm.MergePages(ctx, m.opts.All, perMM)
+		scanned += s
+		merged += n
+		tmm.DecUsers(ctx)
+	}
+	if merged != 0 {
+		log.Debugf("Merged %d of %d scanned pages", merged, scanned)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/log"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// OOM killer.
+//
+// The host enforces the sandbox's memory limit by killing the whole sandbox
+// once it is exceeded. When the OOM killer is enabled with SetOOMLimit, the
+// sentry instead kills one process whenever sandbox memory usage exceeds a
+// limit set below the host's, so that the rest of the sandbox survives, as
+// Linux's OOM killer does when the system runs out of memory.
+//
+// The victim is chosen in two steps. First, the container with the highest
+// total badness is chosen, so that processes of a container using much more
+// memory than the others are killed first. Then, the thread group with the
+// highest badness in that container is killed. As in Linux's oom_badness(),
+// the badness of a thread group is its resident set size, adjusted by its
+// oom_score_adj in thousandths of the limit; thread groups with an
+// oom_score_adj of -1000 are never killed. The init process of the sandbox is
+// never killed either, since that would end the sandbox.
+//
+// Memory usage is checked when tasks return to user space, and periodically
+// by a timer, so that memory held by tasks blocked in the sentry, e.g. in
+// tmpfs files or pipe buffers, also triggers the OOM killer.
+
+const (
+	// oomCheckPeriod is the minimum interval between checks of sandbox
+	// memory usage against the OOM limit.
+	oomCheckPeriod = linux.ClockTick
+
+	// oomTimerPeriod is the interval at which the OOM timer checks sandbox
+	// memory usage, in case no task returns to user space.
+	oomTimerPeriod = 100 * time.Millisecond
+
+	// oomScoreAdjMin is the oom_score_adj value that disables OOM killing,
+	// analogous to Linux's OOM_SCORE_ADJ_MIN.
+	oomScoreAdjMin = -1000
+)
+
+// oomKiller holds the state of the OOM killer.
+//
+// +stateify savable
+type oomKiller struct {
+	// limit is the sandbox memory usage in bytes above which a thread group
+	// is killed. The OOM killer is disabled if limit is 0.
+	limit atomicbitops.Uint64
+
+	// lastCheck is the time at which memory usage was last checked against
+	// limit, in the application monotonic clock.
+	lastCheck atomicbitops.Int64
+
+	// timerMu protects timer. It isn't mu, since the timer takes mu while
+	// holding ktime.Timer.mu.
+	timerMu sync.Mutex `state:"nosave"`
+
+	// timer periodically checks memory usage while the OOM killer is
+	// enabled. timer is nil until the OOM killer is first enabled.
+	timer *ktime.Timer
+
+	// mu serializes victim selection and protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// victim is the last thread group killed. No other thread group is killed
+	// until its tasks have exited and released their memory.
+	victim *ThreadGroup
+
+	// kills counts the thread groups killed in each container.
+	kills map[string]uint64
+}
+
+// SetOOMLimit enables the OOM killer, which kills a thread group whenever
+// sandbox memory usage exceeds limit bytes. A limit of 0 disables it.
+func (k *Kernel) SetOOMLimit(limit uint64) {
+	o := &k.oom
+	o.timerMu.Lock()
+	defer o.timerMu.Unlock()
+	o.limit.Store(limit)
+	if limit == 0 {
+		if o.timer != nil {
+			o.timer.Swap(ktime.Setting{})
+		}
+		return
+	}
+	if o.timer == nil {
+		o.timer = ktime.NewTimer(k.MonotonicClock(), &oomTimerListener{k: k})
+	}
+	o.timer.Swap(ktime.Setting{
+		Enabled: true,
+		Next:    k.MonotonicClock().Now().Add(oomTimerPeriod),
+		Period:  oomTimerPeriod,
+	})
+}
+
+// oomTimer returns the OOM timer, or nil if the OOM killer was never enabled.
+func (k *Kernel) oomTimer() *ktime.Timer {
+	k.oom.timerMu.Lock()
+	defer k.oom.timerMu.Unlock()
+	return k.oom.timer
+}
+
+// oomTimerListener implements ktime.TimerListener for the OOM timer.
+//
+// +stateify savable
+type oomTimerListener struct {
+	k *Kernel
+}
+
+// NotifyTimer implements ktime.TimerListener.NotifyTimer.
+func (l *oomTimerListener) NotifyTimer(exp uint64, setting ktime.Setting) (ktime.Setting, bool) {
+	if limit := l.k.oom.limit.Load(); limit != 0 {
+		l.k.checkOOM(limit)
+	}
+	return ktime.Setting{}, false
+}
+
+// ContainerOOMKills returns the number of thread groups killed by the OOM
+// killer in container cid.
+func (k *Kernel) ContainerOOMKills(cid string) uint64 {
+	k.oom.mu.Lock()
+	defer k.oom.mu.Unlock()
+	return k.oom.kills[cid]
+}
+
+// checkOOM invokes the OOM killer if sandbox memory usage exceeds the OOM
+// limit. Usage is checked at most once every oomCheckPeriod.
+func (k *Kernel) checkOOM(limit uint64) {
+	o := &k.oom
+	now := k.MonotonicClock().Now().Nanoseconds()
+	last := o.lastCheck.Load()
+	if now-last < int64(oomCheckPeriod) || !o.lastCheck.CompareAndSwap(last, now) {
+		return
+	}
+	_ = k.MemoryFile().UpdateUsage(0)
+	if total := usage.MemoryAccounting.Total(); total > limit {
+		k.oomKill(total, limit)
+	}
+}
+
+// oomCandidate is a thread group that the OOM killer may kill.
+type oomCandidate struct {
+	tg          *ThreadGroup
+	cid         string
+	memoryLimit *CgroupMemoryLimit
+	badness     int64
+}
+
+// oomKill kills the thread group chosen as described above, unless the
+// previous victim is still exiting.
+func (k *Kernel) oomKill(total, limit uint64) {
+	o := &k.oom
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	k.tasks.mu.RLock()
+	if v := o.victim; v != nil && v.liveTasks > 0 {
+		k.tasks.mu.RUnlock()
+		return
+	}
+	o.victim = nil
+	var candidates []oomCandidate
+	k.tasks.forEachThreadGroupLocked(func(tg *ThreadGroup) {
+		if tg == k.globalInit || tg.leader == nil || tg.liveTasks == 0 {
+			return
+		}
+		adj := tg.oomScoreAdj.Load()
+		if adj == oomScoreAdjMin {
+			return
+		}
+		var rss uint64
+		tg.leader.WithMuLocked(func(t *Task) {
+			if mm := t.MemoryManager(); mm != nil {
+				rss = mm.ResidentSetSize()
+			}
+		})
+		candidates = append(candidates, oomCandidate{
+			tg:          tg,
+			cid:         tg.leader.ContainerID(),
+			memoryLimit: tg.leader.memoryLimit.Load(),
+			badness:     oomBadness(rss, adj, limit),
+		})
+	})
+	k.tasks.mu.RUnlock()
+
+	victim := selectOOMVictim(candidates)
+	if victim == nil {
+		log.Warningf("Sandbox memory usage %d exceeds OOM limit %d, but there is no process to kill", total, limit)
+		return
+	}
+
+	log.Warningf("Sandbox memory usage %d exceeds OOM limit %d, killing PID %d in container %q (badness %d)", total, limit, k.tasks.Root.IDOfThreadGroup(victim.tg), victim.cid, victim.badness)
+	victim.tg.SendSignal(SignalInfoPriv(linux.SIGKILL))
+	o.victim = victim.tg
+	if o.kills == nil {
+		o.kills = make(map[string]uint64)
+	}
+	o.kills[victim.cid]++
+	if victim.memoryLimit != nil {
+		victim.memoryLimit.recordOOMKill()
+	}
+}
+
+// oomBadness returns the badness of a thread group with resident set size rss
+// and OOM score adjustment adj, when the OOM limit is limit.
+func oomBadness(rss uint64, adj int32, limit uint64) int64 {
+	return int64(rss) + int64(adj)*int64(limit/1000)
+}
+
+// selectOOMVictim returns the candidate with the highest badness in the
+// container with the highest total badness, or nil if there are no
+// candidates.
+func selectOOMVictim(candidates []oomCandidate) *oomCandidate {
+	containerBadness := make(map[string]int64)
+	for _, c := range candidates {
+		containerBadness[c.cid] += c.badness
+	}
+	var victim *oomCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		if victim == nil {
+			victim = c
+			continue
+		}
+		if c.cid != victim.cid {
+			if containerBadness[c.cid] > containerBadness[victim.cid] {
+				victim = c
+			}
+			continue
+		}
+		if c.badness > victim.badness {
+			victim = c
+		}
+	}
+	return victim
+}
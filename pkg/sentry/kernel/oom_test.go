@@ -0,0 +1,127 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+)
+
+func TestOOMBadness(t *testing.T) {
+	for _, test := range []struct {
+		rss   uint64
+		adj   int32
+		limit uint64
+		want  int64
+	}{
+		{rss: 1000, adj: 0, limit: 1000000, want: 1000},
+		{rss: 1000, adj: 1, limit: 1000000, want: 2000},
+		{rss: 1000, adj: -1, limit: 1000000, want: 0},
+		{rss: 1000, adj: 1000, limit: 1000000, want: 1001000},
+		{rss: 1000, adj: -999, limit: 1000000, want: -998000},
+	} {
+		if got := oomBadness(test.rss, test.adj, test.limit); got != test.want {
+			t.Errorf("oomBadness(%d, %d, %d) = %d, want %d", test.rss, test.adj, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestSelectOOMVictim(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		candidates []oomCandidate
+		// want is the index of the victim in candidates, or -1 if there is
+		// none.
+		want int
+	}{
+		{
+			name: "none",
+			want: -1,
+		},
+		{
+			name: "highest badness",
+			candidates: []oomCandidate{
+				{cid: "a", badness: 10},
+				{cid: "a", badness: 30},
+				{cid: "a", badness: 20},
+			},
+			want: 1,
+		},
+		{
+			name: "container with highest total badness",
+			candidates: []oomCandidate{
+				{cid: "a", badness: 50},
+				{cid: "b", badness: 30},
+				{cid: "b", badness: 40},
+			},
+			want: 2,
+		},
+		{
+			name: "container seen after its biggest process",
+			candidates: []oomCandidate{
+				{cid: "b", badness: 40},
+				{cid: "a", badness: 50},
+				{cid: "b", badness: 30},
+			},
+			want: 0,
+		},
+		{
+			name: "negative badness",
+			candidates: []oomCandidate{
+				{cid: "a", badness: -100},
+				{cid: "b", badness: -10},
+			},
+			want: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := selectOOMVictim(test.candidates)
+			if test.want < 0 {
+				if got != nil {
+					t.Errorf("selectOOMVictim() = %+v, want nil", *got)
+				}
+				return
+			}
+			if got != &test.candidates[test.want] {
+				t.Errorf("selectOOMVictim() = %+v, want %+v", got, test.candidates[test.want])
+			}
+		})
+	}
+}
+
+func TestRecordOOMKill(t *testing.T) {
+	root := NewCgroupMemoryLimit(nil, nil, CgroupMemoryUnlimited)
+	parent := NewCgroupMemoryLimit(root, nil, CgroupMemoryUnlimited)
+	child := NewCgroupMemoryLimit(parent, nil, CgroupMemoryUnlimited)
+	sibling := NewCgroupMemoryLimit(parent, nil, CgroupMemoryUnlimited)
+
+	child.recordOOMKill()
+	sibling.recordOOMKill()
+
+	for _, test := range []struct {
+		name string
+		l    *CgroupMemoryLimit
+		want uint64
+	}{
+		{name: "root", l: root, want: 2},
+		{name: "parent", l: parent, want: 2},
+		{name: "child", l: child, want: 1},
+		{name: "sibling", l: sibling, want: 1},
+	} {
+		high, max, oom, oomKill := test.l.Events()
+		if high != 0 || max != test.want || oom != test.want || oomKill != test.want {
+			t.Errorf("%s: Events() = (high %d, max %d, oom %d, oom_kill %d), want (0, %d, %d, %d)", test.name, high, max, oom, oomKill, test.want, test.want, test.want)
+		}
+	}
+}
@@ -73,16 +73,23 @@ type pendingSignal struct {
 // enqueue enqueues the given signal. enqueue returns true on success and false
 // on failure (if the given signal's queue is full).
 //
+// Signals sent by interval timers are never subject to queue limits, since
+// each timer has at most one pending signal at a time; this is consistent
+// with Linux, where they use a sigqueue preallocated by timer_create(2)
+// (kernel/signal.c:send_sigqueue()).
+//
 // Preconditions: info represents a valid signal.
 func (p *pendingSignals) enqueue(info *linux.SignalInfo, timer *IntervalTimer) bool {
 	sig := linux.Signal(info.Signo)
 	q := &p.signals[sig.Index()]
-	if sig.IsStandard() {
-		if q.length >= stdSignalCap {
+	if timer == nil {
+		if sig.IsStandard() {
+			if q.length >= stdSignalCap {
+				return false
+			}
+		} else if q.length >= rtSignalCap {
 			return false
 		}
-	} else if q.length >= rtSignalCap {
-		return false
 	}
 	q.pendingSignalList.PushBack(&pendingSignal{SignalInfo: info, timer: timer})
 	q.length++
@@ -127,6 +134,32 @@ func (p *pendingSignals) dequeueSpecific(sig linux.Signal) *linux.SignalInfo {
 	return ps.SignalInfo
 }
 
+// peek returns copies of up to n pending signals, skipping the first off,
+// ordered by signal number and then by the order in which they were queued.
+func (p *pendingSignals) peek(off uint64, n int) []*linux.SignalInfo {
+	var infos []*linux.SignalInfo
+	for i := range p.signals {
+		for ps := p.signals[i].pendingSignalList.Front(); ps != nil && len(infos) < n; ps = ps.Next() {
+			if off > 0 {
+				off--
+				continue
+			}
+			info := *ps.SignalInfo
+			infos = append(infos, &info)
+		}
+	}
+	return infos
+}
+
+// discardAll causes all pending signals to be discarded.
+func (p *pendingSignals) discardAll() {
+	for i := range p.signals {
+		if p.signals[i].length != 0 {
+			p.discardSpecific(linux.Signal(i + 1))
+		}
+	}
+}
+
 // discardSpecific causes all pending signals with number sig to be discarded.
 func (p *pendingSignals) discardSpecific(sig linux.Signal) {
 	q := &p.signals[sig.Index()]
@@ -0,0 +1,245 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Pressure stall information (PSI).
+//
+// PSI reports the share of time in which tasks were delayed by contention for
+// a resource, as described in Linux's Documentation/accounting/psi.rst. Tasks
+// are considered stalled on:
+//
+//   - CPU while more tasks are running than there are application cores,
+//     since some of them must then be waiting to be scheduled.
+//
+//   - Memory while handling application page faults, which is where
+//     application threads wait for the sentry to allocate and populate memory.
+//
+//   - IO while in an uninterruptible sleep, which the sentry uses to wait for
+//     host and gofer I/O.
+//
+// "some" is the share of time in which at least one task was stalled on the
+// resource, and "full" is the share in which no task was running without
+// being stalled on it. As in Linux, "full" is always zero for CPU at the
+// system level.
+//
+// Stall states are sampled by the CPU clock ticker on every clock tick. While
+// the ticker is asleep, no tasks are running, so the only possible stall is
+// IO by tasks that were already in an uninterruptible sleep when the ticker
+// went to sleep. This time is accounted when the ticker wakes up, or when PSI
+// is read.
+
+// PressureResource is a resource for which PSI is reported.
+type PressureResource int
+
+// Resources for which PSI is reported.
+const (
+	PressureCPU PressureResource = iota
+	PressureMemory
+	PressureIO
+
+	numPressureResources
+)
+
+// Kinds of stalls, analogous to enum psi_states in Linux.
+const (
+	pressureSome = iota
+	pressureFull
+
+	numPressureKinds
+)
+
+// pressureAvgPeriod is the minimum interval between updates of PSI averages,
+// analogous to PSI_FREQ in Linux.
+const pressureAvgPeriod = 2 * time.Second
+
+// pressureAvgWindows are the windows over which PSI is averaged.
+var pressureAvgWindows = [...]time.Duration{10 * time.Second, 60 * time.Second, 300 * time.Second}
+
+// PressureStall is the PSI for one resource and kind of stall.
+type PressureStall struct {
+	// Avg10, Avg60 and Avg300 are the percentages of time stalled, as
+	// exponential moving averages over 10, 60 and 300 seconds respectively.
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+
+	// Total is the total time stalled.
+	Total time.Duration
+}
+
+// pressureStats accumulates PSI for a Kernel.
+type pressureStats struct {
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// total is the time stalled, in nanoseconds.
+	total [numPressureResources][numPressureKinds]uint64
+
+	// avgTotal is the value of total when avg was last updated.
+	avgTotal [numPressureResources][numPressureKinds]uint64
+
+	// avg are the averages of the share of time stalled over each of
+	// pressureAvgWindows, as fractions.
+	avg [numPressureResources][numPressureKinds][len(pressureAvgWindows)]float64
+
+	// avgUpdate is the time at which avg was last updated, or zero if it
+	// hasn't been yet.
+	avgUpdate time.Time
+
+	// idle is true while the CPU clock ticker is asleep.
+	idle bool
+
+	// idleSince is the start of the part of the current idle period that
+	// hasn't been accounted yet. It is only meaningful if idle is true.
+	idleSince time.Time
+
+	// idleIOStalled is true if any tasks were stalled on IO when the CPU clock
+	// ticker went to sleep. It is only meaningful if idle is true.
+	idleIOStalled bool
+}
+
+// addLocked adds d to the time stalled on res.
+//
+// Preconditions: p.mu must be locked.
+func (p *pressureStats) addLocked(res PressureResource, full bool, d uint64) {
+	p.total[res][pressureSome] += d
+	if full {
+		p.total[res][pressureFull] += d
+	}
+}
+
+// accountIdleLocked accounts the time since p.idleSince.
+//
+// Preconditions:
+//   - p.mu must be locked.
+//   - p.idle must be true.
+func (p *pressureStats) accountIdleLocked(now time.Time) {
+	if p.idleIOStalled && now.After(p.idleSince) {
+		// No tasks are running, so IO stalls are "full".
+		p.addLocked(PressureIO, true, uint64(now.Sub(p.idleSince)))
+	}
+	p.idleSince = now
+}
+
+// updateAvgsLocked updates p.avg if pressureAvgPeriod has elapsed since the
+// last update.
+//
+// Preconditions: p.mu must be locked.
+func (p *pressureStats) updateAvgsLocked(now time.Time) {
+	if p.avgUpdate.IsZero() {
+		p.avgUpdate = now
+		return
+	}
+	elapsed := now.Sub(p.avgUpdate)
+	if elapsed < pressureAvgPeriod {
+		return
+	}
+	// Unlike Linux, which updates averages in fixed periods and decays them
+	// for any periods it missed, update them for the whole elapsed time at
+	// once.
+	var decay [len(pressureAvgWindows)]float64
+	for i, w := range pressureAvgWindows {
+		decay[i] = math.Exp(-float64(elapsed) / float64(w))
+	}
+	for res := range p.total {
+		for kind := range p.total[res] {
+			delta := p.total[res][kind] - p.avgTotal[res][kind]
+			p.avgTotal[res][kind] = p.total[res][kind]
+			share := math.Min(float64(delta)/float64(elapsed), 1)
+			for i := range pressureAvgWindows {
+				avg := &p.avg[res][kind][i]
+				*avg = *avg*decay[i] + share*(1-decay[i])
+			}
+		}
+	}
+	p.avgUpdate = now
+}
+
+// samplePressure accounts the current stall states for a CPU clock tick. It
+// is called by the CPU clock ticker on every tick.
+func (k *Kernel) samplePressure() {
+	running := k.runningTasks.Load()
+	memStalled := k.memStalledTasks.Load()
+	ioStalled := k.ioStalledTasks.Load()
+	tick := uint64(linux.ClockTick)
+
+	p := &k.psi
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if running > int64(k.applicationCores) {
+		p.addLocked(PressureCPU, false, tick)
+	}
+	if memStalled > 0 {
+		// Tasks handling page faults are also counted as running.
+		p.addLocked(PressureMemory, memStalled >= running, tick)
+	}
+	if ioStalled > 0 {
+		p.addLocked(PressureIO, running == 0, tick)
+	}
+	p.updateAvgsLocked(time.Now())
+}
+
+// pressureIdle is called by the CPU clock ticker before it goes to sleep.
+//
+// Preconditions: k.runningTasks == 0.
+func (k *Kernel) pressureIdle() {
+	p := &k.psi
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle = true
+	p.idleSince = time.Now()
+	// Tasks can only start an uninterruptible sleep while running, so this
+	// can't change until the ticker wakes up.
+	p.idleIOStalled = k.ioStalledTasks.Load() > 0
+}
+
+// pressureResume is called by the CPU clock ticker after it wakes up.
+func (k *Kernel) pressureResume() {
+	p := &k.psi
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accountIdleLocked(time.Now())
+	p.idle = false
+}
+
+// Pressure returns the PSI for res.
+func (k *Kernel) Pressure(res PressureResource) (some, full PressureStall) {
+	now := time.Now()
+	p := &k.psi
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idle {
+		p.accountIdleLocked(now)
+	}
+	p.updateAvgsLocked(now)
+	stall := func(kind int) PressureStall {
+		avg := &p.avg[res][kind]
+		return PressureStall{
+			Avg10:  avg[0] * 100,
+			Avg60:  avg[1] * 100,
+			Avg300: avg[2] * 100,
+			Total:  time.Duration(p.total[res][kind]),
+		}
+	}
+	return stall(pressureSome), stall(pressureFull)
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPressureAvgs(t *testing.T) {
+	var p pressureStats
+	start := time.Now()
+	p.updateAvgsLocked(start)
+
+	// Stall on IO for half of a period, and on memory for a whole period.
+	p.addLocked(PressureIO, false, uint64(pressureAvgPeriod/2))
+	p.addLocked(PressureMemory, true, uint64(pressureAvgPeriod))
+
+	// Averages aren't updated before a period has elapsed.
+	p.updateAvgsLocked(start.Add(pressureAvgPeriod / 2))
+	if got := p.avg[PressureIO][pressureSome][0]; got != 0 {
+		t.Errorf("IO some avg10 before a period elapsed: got %v, want 0", got)
+	}
+
+	now := start.Add(pressureAvgPeriod)
+	p.updateAvgsLocked(now)
+	for _, test := range []struct {
+		name  string
+		res   PressureResource
+		kind  int
+		share float64
+	}{
+		{"cpu some", PressureCPU, pressureSome, 0},
+		{"memory some", PressureMemory, pressureSome, 1},
+		{"memory full", PressureMemory, pressureFull, 1},
+		{"io some", PressureIO, pressureSome, 0.5},
+		{"io full", PressureIO, pressureFull, 0},
+	} {
+		for i, w := range pressureAvgWindows {
+			want := test.share * (1 - math.Exp(-float64(pressureAvgPeriod)/float64(w)))
+			if got := p.avg[test.res][test.kind][i]; math.Abs(got-want) > 1e-9 {
+				t.Errorf("%s avg over %v: got %v, want %v", test.name, w, got, want)
+			}
+		}
+	}
+
+	// Averages decay while nothing is stalled.
+	before := p.avg[PressureMemory][pressureSome][0]
+	p.updateAvgsLocked(now.Add(10 * pressureAvgPeriod))
+	if got := p.avg[PressureMemory][pressureSome][0]; got >= before {
+		t.Errorf("memory some avg10 didn't decay: got %v, was %v", got, before)
+	}
+}
@@ -704,11 +704,11 @@ func (t *Task) ptraceSyscallEnter() (taskRunState, bool) {
 		return nil, false
 	case ptraceSyscallIntercept:
 		t.Debugf("Entering syscall-enter-stop from PTRACE_SYSCALL")
-		t.ptraceSyscallStopLocked()
+		t.ptraceSyscallStopLocked(linux.PTRACE_EVENTMSG_SYSCALL_ENTRY)
 		return (*runSyscallAfterSyscallEnterStop)(nil), true
 	case ptraceSyscallEmu:
 		t.Debugf("Entering syscall-enter-stop from PTRACE_SYSEMU")
-		t.ptraceSyscallStopLocked()
+		t.ptraceSyscallStopLocked(linux.PTRACE_EVENTMSG_SYSCALL_ENTRY)
 		return (*runSyscallAfterSysemuStop)(nil), true
 	}
 	panic(fmt.Sprintf("Unknown ptraceSyscallMode: %v", t.ptraceSyscallMode))
@@ -726,15 +726,21 @@ func (t *Task) ptraceSyscallExit() {
 		return
 	}
 	t.Debugf("Entering syscall-exit-stop")
-	t.ptraceSyscallStopLocked()
+	t.ptraceSyscallStopLocked(linux.PTRACE_EVENTMSG_SYSCALL_EXIT)
 }
 
+// ptraceSyscallStopLocked enters a syscall-stop. As in Linux, msg (one of
+// linux.PTRACE_EVENTMSG_SYSCALL_*) is returned by PTRACE_GETEVENTMSG, and
+// distinguishes syscall-enter-stops from syscall-exit-stops for
+// PTRACE_GET_SYSCALL_INFO.
+//
 // Preconditions: The TaskSet mutex must be locked.
-func (t *Task) ptraceSyscallStopLocked() {
+func (t *Task) ptraceSyscallStopLocked(msg uint64) {
 	code := int32(linux.SIGTRAP)
 	if t.ptraceOpts.SysGood {
 		code |= 0x80
 	}
+	t.ptraceEventMsg = msg
 	t.ptraceTrapLocked(code)
 }
 
@@ -1001,17 +1007,91 @@ func (t *Task) ptraceSetOptionsLocked(opts uintptr) error {
 	return nil
 }
 
+// maxErrno is the largest errno value. Syscall return values in [-maxErrno,
+// -1] indicate errors. See include/linux/err.h:MAX_ERRNO.
+const maxErrno = 4095
+
+// ptraceSyscallInfoLocked returns the result of
+// ptrace(PTRACE_GET_SYSCALL_INFO) for t, along with the number of valid bytes
+// at the start of the returned struct.
+//
+// Preconditions:
+//   - The TaskSet mutex must be locked.
+//   - t must be in a frozen ptrace-stop.
+func (t *Task) ptraceSyscallInfoLocked() (linux.PtraceSyscallInfo, int) {
+	info := linux.PtraceSyscallInfo{
+		Op:                 linux.PTRACE_SYSCALL_INFO_NONE,
+		Arch:               t.SyscallTable().AuditNumber,
+		InstructionPointer: uint64(t.Arch().IP()),
+		StackPointer:       uint64(t.Arch().Stack()),
+	}
+	if t.ptraceSiginfo == nil {
+		return info, linux.PtraceSyscallInfoNoneSize
+	}
+	// As in Linux, syscall-stops can only be identified if
+	// PTRACE_O_TRACESYSGOOD is set.
+	switch t.ptraceSiginfo.Code {
+	case int32(linux.SIGTRAP) | 0x80:
+		switch t.ptraceEventMsg {
+		case linux.PTRACE_EVENTMSG_SYSCALL_ENTRY:
+			info.Op = linux.PTRACE_SYSCALL_INFO_ENTRY
+			t.ptraceSyscallInfoEntry(&info)
+			return info, linux.PtraceSyscallInfoEntrySize
+		case linux.PTRACE_EVENTMSG_SYSCALL_EXIT:
+			info.Op = linux.PTRACE_SYSCALL_INFO_EXIT
+			rval := int64(t.Arch().Return())
+			info.Data[0] = uint64(rval)
+			if rval < 0 && rval >= -maxErrno {
+				info.Data[1] = 1
+			}
+			return info, linux.PtraceSyscallInfoExitSize
+		}
+	case int32(linux.SIGTRAP) | linux.PTRACE_EVENT_SECCOMP<<8:
+		info.Op = linux.PTRACE_SYSCALL_INFO_SECCOMP
+		t.ptraceSyscallInfoEntry(&info)
+		info.Data[7] = uint64(uint32(t.ptraceEventMsg))
+		return info, linux.PtraceSyscallInfoSeccompSize
+	}
+	return info, linux.PtraceSyscallInfoNoneSize
+}
+
+// ptraceSyscallInfoEntry fills in the syscall number and arguments of info
+// from t's registers.
+func (t *Task) ptraceSyscallInfoEntry(info *linux.PtraceSyscallInfo) {
+	info.Data[0] = uint64(t.Arch().SyscallNo())
+	for i, arg := range t.Arch().SyscallArgs() {
+		info.Data[1+i] = arg.Uint64()
+	}
+}
+
+// ptracePeekSigInfo returns up to n of t's pending signals, skipping the
+// first off. If shared is true, signals are taken from t's thread group's
+// queue rather than t's own.
+//
+// Unlike Linux, which keeps a single queue of pending signals, gVisor queues
+// signals by number, so signals are ordered by number and then by the order
+// in which they were sent.
+func (t *Task) ptracePeekSigInfo(off uint64, n int, shared bool) []*linux.SignalInfo {
+	t.tg.signalHandlers.mu.Lock()
+	defer t.tg.signalHandlers.mu.Unlock()
+	p := &t.pendingSignals
+	if shared {
+		p = &t.tg.pendingSignals
+	}
+	return p.peek(off, n)
+}
+
 // Ptrace implements the ptrace system call.
-func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
+func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) (uintptr, error) {
 	// PTRACE_TRACEME ignores all other arguments.
 	if req == linux.PTRACE_TRACEME {
-		return t.ptraceTraceme()
+		return 0, t.ptraceTraceme()
 	}
 	// All other ptrace requests operate on a current or future tracee
 	// specified by pid.
 	target := t.tg.pidns.TaskWithID(pid)
 	if target == nil {
-		return linuxerr.ESRCH
+		return 0, linuxerr.ESRCH
 	}
 
 	// PTRACE_ATTACH and PTRACE_SEIZE do not require that target is not already
@@ -1019,24 +1099,24 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 	if req == linux.PTRACE_ATTACH || req == linux.PTRACE_SEIZE {
 		seize := req == linux.PTRACE_SEIZE
 		if seize && addr != 0 {
-			return linuxerr.EIO
+			return 0, linuxerr.EIO
 		}
-		return t.ptraceAttach(target, seize, uintptr(data))
+		return 0, t.ptraceAttach(target, seize, uintptr(data))
 	}
 	// PTRACE_KILL and PTRACE_INTERRUPT require that the target is a tracee,
 	// but does not require that it is ptrace-stopped.
 	if req == linux.PTRACE_KILL {
-		return t.ptraceKill(target)
+		return 0, t.ptraceKill(target)
 	}
 	if req == linux.PTRACE_INTERRUPT {
-		return t.ptraceInterrupt(target)
+		return 0, t.ptraceInterrupt(target)
 	}
 	// All other ptrace requests require that the target is a ptrace-stopped
 	// tracee, and freeze the ptrace-stop so the tracee can be operated on.
 	t.tg.pidns.owner.mu.RLock()
 	if target.Tracer() != t {
 		t.tg.pidns.owner.mu.RUnlock()
-		return linuxerr.ESRCH
+		return 0, linuxerr.ESRCH
 	}
 	if !target.ptraceFreeze() {
 		t.tg.pidns.owner.mu.RUnlock()
@@ -1044,7 +1124,7 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 		// PTRACE_TRACEME, PTRACE_INTERRUPT, and PTRACE_KILL) require the
 		// tracee to be in a ptrace-stop, otherwise they fail with ESRCH." -
 		// ptrace(2)
-		return linuxerr.ESRCH
+		return 0, linuxerr.ESRCH
 	}
 	t.tg.pidns.owner.mu.RUnlock()
 	// Even if the target has a ptrace-stop active, the tracee's task goroutine
@@ -1066,56 +1146,56 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 	case linux.PTRACE_DETACH:
 		if err := t.ptraceDetach(target, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_CONT:
 		if err := target.ptraceUnstop(ptraceSyscallNone, false, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SYSCALL:
 		if err := target.ptraceUnstop(ptraceSyscallIntercept, false, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SINGLESTEP:
 		if err := target.ptraceUnstop(ptraceSyscallNone, true, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SYSEMU:
 		if err := target.ptraceUnstop(ptraceSyscallEmu, false, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SYSEMU_SINGLESTEP:
 		if err := target.ptraceUnstop(ptraceSyscallEmu, true, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_LISTEN:
 		t.tg.pidns.owner.mu.RLock()
 		defer t.tg.pidns.owner.mu.RUnlock()
 		if !target.ptraceSeized {
-			return linuxerr.EIO
+			return 0, linuxerr.EIO
 		}
 		if target.ptraceSiginfo == nil {
-			return linuxerr.EIO
+			return 0, linuxerr.EIO
 		}
 		if target.ptraceSiginfo.Code>>8 != linux.PTRACE_EVENT_STOP {
-			return linuxerr.EIO
+			return 0, linuxerr.EIO
 		}
 		target.tg.signalHandlers.mu.Lock()
 		defer target.tg.signalHandlers.mu.Unlock()
@@ -1125,7 +1205,7 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 			target.stop.(*ptraceStop).listen = true
 			target.ptraceUnfreezeLocked()
 		}
-		return nil
+		return 0, nil
 	}
 
 	// All other ptrace requests expect us to unfreeze the stop.
@@ -1139,15 +1219,15 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 		// is the error flag." - ptrace(2)
 		word := t.Arch().Native(0)
 		if _, err := word.CopyIn(target.CopyContext(t, usermem.IOOpts{IgnorePermissions: true}), addr); err != nil {
-			return err
+			return 0, err
 		}
 		_, err := word.CopyOut(t, data)
-		return err
+		return 0, err
 
 	case linux.PTRACE_POKETEXT, linux.PTRACE_POKEDATA:
 		word := t.Arch().Native(uintptr(data))
 		_, err := word.CopyOut(target.CopyContext(t, usermem.IOOpts{IgnorePermissions: true}), addr)
-		return err
+		return 0, err
 
 	case linux.PTRACE_GETREGSET:
 		// "Read the tracee's registers. addr specifies, in an
@@ -1157,7 +1237,7 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 		// to indicate the actual number of bytes returned." - ptrace(2)
 		ars, err := t.CopyInIovecs(data, 1)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		ar := ars.Head()
@@ -1170,7 +1250,7 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 			},
 		}, int(ar.Length()), target.Kernel().FeatureSet())
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		// Update iovecs to represent the range of the written register set.
@@ -1179,12 +1259,12 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 			panic(fmt.Sprintf("%#x + %#x overflows. Invalid reg size > %#x", ar.Start, n, ar.Length()))
 		}
 		ar.End = end
-		return t.CopyOutIovecs(data, hostarch.AddrRangeSeqOf(ar))
+		return 0, t.CopyOutIovecs(data, hostarch.AddrRangeSeqOf(ar))
 
 	case linux.PTRACE_SETREGSET:
 		ars, err := t.CopyInIovecs(data, 1)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		ar := ars.Head()
@@ -1197,68 +1277,108 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 			},
 		}, int(ar.Length()), target.Kernel().FeatureSet())
 		if err != nil {
-			return err
+			return 0, err
 		}
 		target.p.FullStateChanged()
 		ar.End -= hostarch.Addr(n)
-		return t.CopyOutIovecs(data, hostarch.AddrRangeSeqOf(ar))
+		return 0, t.CopyOutIovecs(data, hostarch.AddrRangeSeqOf(ar))
 
 	case linux.PTRACE_GETSIGINFO:
 		t.tg.pidns.owner.mu.RLock()
 		defer t.tg.pidns.owner.mu.RUnlock()
 		if target.ptraceSiginfo == nil {
-			return linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		_, err := target.ptraceSiginfo.CopyOut(t, data)
-		return err
+		return 0, err
 
 	case linux.PTRACE_SETSIGINFO:
 		var info linux.SignalInfo
 		if _, err := info.CopyIn(t, data); err != nil {
-			return err
+			return 0, err
 		}
 		t.tg.pidns.owner.mu.RLock()
 		defer t.tg.pidns.owner.mu.RUnlock()
 		if target.ptraceSiginfo == nil {
-			return linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		target.ptraceSiginfo = &info
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_GETSIGMASK:
 		if addr != linux.SignalSetSize {
-			return linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		mask := target.SignalMask()
 		_, err := mask.CopyOut(t, data)
-		return err
+		return 0, err
 
 	case linux.PTRACE_SETSIGMASK:
 		if addr != linux.SignalSetSize {
-			return linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		var mask linux.SignalSet
 		if _, err := mask.CopyIn(t, data); err != nil {
-			return err
+			return 0, err
 		}
 		// The target's task goroutine is stopped, so this is safe:
 		target.SetSignalMask(mask &^ UnblockableSignals)
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SETOPTIONS:
 		t.tg.pidns.owner.mu.Lock()
 		defer t.tg.pidns.owner.mu.Unlock()
-		return target.ptraceSetOptionsLocked(uintptr(data))
+		return 0, target.ptraceSetOptionsLocked(uintptr(data))
 
 	case linux.PTRACE_GETEVENTMSG:
 		t.tg.pidns.owner.mu.RLock()
 		defer t.tg.pidns.owner.mu.RUnlock()
 		_, err := primitive.CopyUint64Out(t, hostarch.Addr(data), target.ptraceEventMsg)
-		return err
+		return 0, err
+
+	case linux.PTRACE_PEEKSIGINFO:
+		var args linux.PtracePeekSigInfoArgs
+		if _, err := args.CopyIn(t, addr); err != nil {
+			return 0, err
+		}
+		if args.Flags&^linux.PTRACE_PEEKSIGINFO_SHARED != 0 || args.Nr < 0 {
+			return 0, linuxerr.EINVAL
+		}
+		infos := target.ptracePeekSigInfo(args.Off, int(args.Nr), args.Flags&linux.PTRACE_PEEKSIGINFO_SHARED != 0)
+		for i, info := range infos {
+			if _, err := info.CopyOut(t, data+hostarch.Addr(i*info.SizeBytes())); err != nil {
+				// "If an error occurs while copying a signal, the number of
+				// signals copied so far is returned, or the error if no
+				// signals were copied." - Linux's ptrace_peek_siginfo()
+				if i == 0 {
+					return 0, err
+				}
+				return uintptr(i), nil
+			}
+		}
+		return uintptr(len(infos)), nil
 
-	// PEEKSIGINFO is unimplemented but seems to have no users anywhere.
+	case linux.PTRACE_GET_SYSCALL_INFO:
+		t.tg.pidns.owner.mu.RLock()
+		info, size := target.ptraceSyscallInfoLocked()
+		t.tg.pidns.owner.mu.RUnlock()
+		// "addr: the size of the buffer pointed to by data ... If the size of
+		// the data to be written by the kernel exceeds the size specified by
+		// addr, the output data is truncated. The return value contains the
+		// number of bytes available to be written by the kernel." - ptrace(2)
+		buf := t.CopyScratchBuffer(info.SizeBytes())
+		info.MarshalUnsafe(buf)
+		if uintptr(addr) < uintptr(size) {
+			buf = buf[:addr]
+		} else {
+			buf = buf[:size]
+		}
+		if _, err := t.CopyOutBytes(data, buf); err != nil {
+			return 0, err
+		}
+		return uintptr(size), nil
 
 	default:
-		return t.ptraceArch(target, req, addr, data)
+		return 0, t.ptraceArch(target, req, addr, data)
 	}
 }
@@ -81,6 +81,31 @@ func (c *CPUSet) Set(cpu uint) {
 	(*c)[cpu/bitsPerByte] |= 1 << (cpu % bitsPerByte)
 }
 
+// IsSet returns true if the bit corresponding to cpu is set.
+func (c CPUSet) IsSet(cpu uint) bool {
+	i := cpu / bitsPerByte
+	return i < c.Size() && c[i]&(1<<(cpu%bitsPerByte)) != 0
+}
+
+// Intersect clears the bits that aren't set in other. c and other must have
+// the same size.
+func (c *CPUSet) Intersect(other CPUSet) {
+	for i := range *c {
+		(*c)[i] &= other[i]
+	}
+}
+
+// IsSubsetOf returns true if all cpus in c are also in other. c and other
+// must have the same size.
+func (c CPUSet) IsSubsetOf(other CPUSet) bool {
+	for i, b := range c {
+		if b&^other[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // ClearAbove clears bits corresponding to cpu and all higher cpus.
 func (c *CPUSet) ClearAbove(cpu uint) {
 	i := cpu / bitsPerByte
@@ -42,3 +42,28 @@ func TestClearAbove(t *testing.T) {
 		}
 	}
 }
+
+func TestIntersect(t *testing.T) {
+	const n = 100
+	evens := NewCPUSet(n)
+	for i := uint(0); i < n; i += 2 {
+		evens.Set(i)
+	}
+	c := NewFullCPUSet(n)
+	c.ClearAbove(50)
+	if c.IsSubsetOf(evens) {
+		t.Errorf("%v is a subset of %v", c, evens)
+	}
+	c.Intersect(evens)
+	if got, want := c.NumCPUs(), uint(25); got != want {
+		t.Errorf("got %d cpus, wanted %d", got, want)
+	}
+	if !c.IsSubsetOf(evens) {
+		t.Errorf("%v is not a subset of %v", c, evens)
+	}
+	for i := uint(0); i < n; i++ {
+		if want := i < 50 && i%2 == 0; c.IsSet(i) != want {
+			t.Errorf("IsSet(%d) = %t, want %t", i, c.IsSet(i), want)
+		}
+	}
+}
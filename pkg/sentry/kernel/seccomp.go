@@ -151,6 +151,20 @@ func (t *Task) evaluateSyscallFilters(sysno int32, args arch.SyscallArguments, i
 	return ret
 }
 
+// syscallFiltersLength returns the combined length of all syscall filters, plus
+// a penalty of 4 instructions per filter beyond the first. Linux caps it to
+// maxSyscallFilterInstructions.
+func syscallFiltersLength(filters []bpf.Program) int {
+	length := 0
+	for i, f := range filters {
+		length += f.Length()
+		if i > 0 {
+			length += 4
+		}
+	}
+	return length
+}
+
 // AppendSyscallFilter adds BPF program p as a system call filter.
 //
 // Preconditions: The caller must be running on the task goroutine.
@@ -161,25 +175,14 @@ func (t *Task) AppendSyscallFilter(p bpf.Program, syncAll bool) error {
 	t.tg.signalHandlers.mu.Lock()
 	defer t.tg.signalHandlers.mu.Unlock()
 
-	// Cap the combined length of all syscall filters (plus a penalty of 4
-	// instructions per filter beyond the first) to maxSyscallFilterInstructions.
-	// This restriction is inherited from Linux.
-	totalLength := p.Length()
 	var newFilters []bpf.Program
-
 	if sf := t.syscallFilters.Load(); sf != nil {
-		oldFilters := sf.([]bpf.Program)
-		for _, f := range oldFilters {
-			totalLength += f.Length() + 4
-		}
-		newFilters = append(newFilters, oldFilters...)
+		newFilters = append(newFilters, sf.([]bpf.Program)...)
 	}
-
-	if totalLength > maxSyscallFilterInstructions {
+	newFilters = append(newFilters, p)
+	if syscallFiltersLength(newFilters) > maxSyscallFilterInstructions {
 		return linuxerr.ENOMEM
 	}
-
-	newFilters = append(newFilters, p)
 	t.syscallFilters.Store(newFilters)
 
 	if syncAll {
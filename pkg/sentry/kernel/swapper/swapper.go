@@ -0,0 +1,118 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package swapper implements the swapper goroutine, which swaps out
+// application memory when the sandbox's memory usage exceeds a limit.
+package swapper
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/swap"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// period is how often the swapper checks memory usage.
+const period = time.Second
+
+// Opts contains options to New.
+type Opts struct {
+	// Pool stores swapped-out pages.
+	Pool *swap.Pool
+
+	// Limit is the memory file usage in bytes above which application memory
+	// is swapped out.
+	Limit uint64
+}
+
+// Swapper swaps out application memory when memory usage is high.
+type Swapper struct {
+	k    *kernel.Kernel
+	opts Opts
+
+	// Writing to this channel indicates the swapper goroutine should stop.
+	stop chan struct{}
+
+	// done is used to signal when the swapper goroutine has exited.
+	done sync.WaitGroup
+}
+
+// New creates a new Swapper.
+func New(k *kernel.Kernel, opts Opts) *Swapper {
+	return &Swapper{
+		k:    k,
+		opts: opts,
+		stop: make(chan struct{}),
+	}
+}
+
+// Start starts the swapper goroutine. Start must not be called concurrently
+// with Stop and may only be called once.
+func (s *Swapper) Start() {
+	s.done.Add(1)
+	go s.run() // S/R-SAFE: stopped before save by Stop.
+}
+
+// Stop stops the swapper goroutine. Stop must not be called concurrently with
+// Start and may only be called once. Since the swapper mutates
+// MemoryManagers, it must be stopped before the kernel is saved.
+func (s *Swapper) Stop() {
+	close(s.stop)
+	s.done.Wait()
+}
+
+func (s *Swapper) run() {
+	defer s.done.Done()
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.swapOut()
+		}
+	}
+}
+
+// swapOut swaps out enough memory to bring memory file usage below
+// s.opts.Limit, if possible.
+func (s *Swapper) swapOut() {
+	used, err := s.k.MemoryFile().TotalUsage()
+	if err != nil {
+		log.Warningf("Failed to fetch memory usage for swapper: %v", err)
+		return
+	}
+	if used <= s.opts.Limit {
+		return
+	}
+	target := used - s.opts.Limit
+
+	ctx := s.k.SupervisorContext()
+	var swapped uint64
+	for _, tmm := range s.k.MemoryManagers() {
+		if swapped < target {
+			swapped += tmm.SwapOut(ctx, s.opts.Pool, target-swapped)
+		}
+		tmm.DecUsers(ctx)
+	}
+	if swapped != 0 {
+		stats := s.opts.Pool.Stats()
+		log.Debugf("Swapped out %d bytes (usage %d, limit %d); pool holds %d compressed bytes, %d file bytes", swapped, used, s.opts.Limit, stats.CompressedBytes, stats.FileBytes)
+	}
+}
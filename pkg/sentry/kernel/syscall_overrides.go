@@ -0,0 +1,148 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// SyscallOverrideFn replaces the implementation of a syscall. next is the
+// implementation that would have been called without the override; it may be
+// called to wrap the syscall rather than replace it.
+type SyscallOverrideFn func(t *Task, sysno uintptr, args arch.SyscallArguments, next SyscallFn) (uintptr, *SyscallControl, error)
+
+// SyscallOverride replaces or wraps the implementation of a syscall, e.g. to
+// stub out a syscall that misbehaves for an application, or to inject
+// failures and latency for testing.
+type SyscallOverride struct {
+	// Fn is called instead of the syscall implementation.
+	Fn SyscallOverrideFn
+
+	// Description is a human-readable description of the override, used in
+	// logs.
+	Description string
+}
+
+// ErrnoOverride returns an override that fails the syscall with errno without
+// executing it.
+func ErrnoOverride(errno error) *SyscallOverride {
+	return &SyscallOverride{
+		Fn: func(*Task, uintptr, arch.SyscallArguments, SyscallFn) (uintptr, *SyscallControl, error) {
+			return 0, nil, errno
+		},
+		Description: fmt.Sprintf("errno:%d", ExtractErrno(errno, -1)),
+	}
+}
+
+// DelayOverride returns an override that executes the syscall after sleeping
+// for d. The sleep is interruptible by signals, in which case the syscall is
+// restarted as if it had been interrupted itself.
+func DelayOverride(d time.Duration) *SyscallOverride {
+	return &SyscallOverride{
+		Fn: func(t *Task, sysno uintptr, args arch.SyscallArguments, next SyscallFn) (uintptr, *SyscallControl, error) {
+			if _, err := t.BlockWithTimeout(nil, true, d); linuxerr.Equals(linuxerr.ErrInterrupted, err) {
+				return 0, nil, linuxerr.ERESTARTSYS
+			}
+			return next(t, sysno, args)
+		},
+		Description: fmt.Sprintf("delay:%v", d),
+	}
+}
+
+// syscallOverrides holds the overrides installed in a SyscallTable.
+type syscallOverrides struct {
+	// mu protects byContainer. Readers only take it for syscalls that have
+	// SyscallOverrideEnable set in FeatureEnable.
+	mu sync.RWMutex
+
+	// byContainer maps syscall numbers to overrides by container ID. The
+	// empty container ID applies to all containers that don't have their own
+	// override for the syscall.
+	byContainer map[uintptr]map[string]*SyscallOverride
+}
+
+// SetOverride installs o for sysno in the container with ID containerID, or in
+// all containers if containerID is empty. If o is nil, the override is
+// removed. Tasks that are already executing sysno are unaffected.
+//
+// Syscalls missing from the table cannot be overridden.
+func (s *SyscallTable) SetOverride(containerID string, sysno uintptr, o *SyscallOverride) error {
+	if s.Lookup(sysno) == nil {
+		return fmt.Errorf("syscall %d not found in the %s/%s syscall table", sysno, s.OS, s.Arch)
+	}
+
+	s.overrides.mu.Lock()
+	defer s.overrides.mu.Unlock()
+	if o == nil {
+		delete(s.overrides.byContainer[sysno], containerID)
+		if len(s.overrides.byContainer[sysno]) == 0 {
+			delete(s.overrides.byContainer, sysno)
+		}
+	} else {
+		if s.overrides.byContainer == nil {
+			s.overrides.byContainer = make(map[uintptr]map[string]*SyscallOverride)
+		}
+		if s.overrides.byContainer[sysno] == nil {
+			s.overrides.byContainer[sysno] = make(map[string]*SyscallOverride)
+		}
+		s.overrides.byContainer[sysno][containerID] = o
+	}
+	s.updateOverrideEnableLocked()
+	return nil
+}
+
+// ClearOverrides removes all overrides installed for the container with ID
+// containerID. If containerID is empty, only overrides that apply to all
+// containers are removed.
+func (s *SyscallTable) ClearOverrides(containerID string) {
+	s.overrides.mu.Lock()
+	defer s.overrides.mu.Unlock()
+	for sysno, byContainer := range s.overrides.byContainer {
+		delete(byContainer, containerID)
+		if len(byContainer) == 0 {
+			delete(s.overrides.byContainer, sysno)
+		}
+	}
+	s.updateOverrideEnableLocked()
+}
+
+// updateOverrideEnableLocked sets SyscallOverrideEnable for the syscalls that
+// have an override.
+//
+// Preconditions: s.overrides.mu is locked.
+func (s *SyscallTable) updateOverrideEnableLocked() {
+	enabled := make(map[uintptr]bool, len(s.overrides.byContainer))
+	for sysno := range s.overrides.byContainer {
+		enabled[sysno] = true
+	}
+	s.FeatureEnable.Enable(SyscallOverrideEnable, enabled, false)
+}
+
+// lookupOverride returns the override of sysno for the container with ID
+// containerID, or nil if there is none.
+func (s *SyscallTable) lookupOverride(containerID string, sysno uintptr) *SyscallOverride {
+	s.overrides.mu.RLock()
+	defer s.overrides.mu.RUnlock()
+	byContainer := s.overrides.byContainer[sysno]
+	if o, ok := byContainer[containerID]; ok {
+		return o
+	}
+	return byContainer[""]
+}
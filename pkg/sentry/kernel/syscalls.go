@@ -131,10 +131,17 @@ const (
 
 	// SecCheckRawExit represents raw/exit syscall seccheck event.
 	SecCheckRawExit
+
+	// StraceEnableJSON enables syscall tracing to the JSON output.
+	StraceEnableJSON
+
+	// SyscallOverrideEnable indicates that the syscall may have an override
+	// installed with SyscallTable.SetOverride.
+	SyscallOverrideEnable
 )
 
-// StraceEnableBits combines both strace log and event flags.
-const StraceEnableBits = StraceEnableLog | StraceEnableEvent
+// StraceEnableBits combines the strace log, event and JSON flags.
+const StraceEnableBits = StraceEnableLog | StraceEnableEvent | StraceEnableJSON
 
 // SyscallFlagsTable manages a set of enable/disable bit fields on a per-syscall
 // basis.
@@ -338,6 +345,9 @@ type SyscallTable struct {
 
 	// FeatureEnable stores the strace and one-shot enable bits.
 	FeatureEnable SyscallFlagsTable
+
+	// overrides holds syscall overrides installed with SetOverride.
+	overrides syscallOverrides
 }
 
 // MaxSysno returns the largest system call number.
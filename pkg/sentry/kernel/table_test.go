@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/abi"
+	"gvisor.dev/gvisor/pkg/bits"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 )
 
@@ -77,6 +79,57 @@ func TestTable(t *testing.T) {
 	}
 }
 
+func TestSyscallOverrides(t *testing.T) {
+	table := createSyscallTable()
+	defer func() {
+		// Cleanup registered tables to keep tests separate.
+		allSyscallTables = []*SyscallTable{}
+	}()
+
+	enabled := func(sysno uintptr) bool {
+		return bits.IsOn32(table.FeatureEnable.Word(sysno), SyscallOverrideEnable)
+	}
+
+	if err := table.SetOverride("", maxTestSyscall+1, ErrnoOverride(linuxerr.ENOSYS)); err == nil {
+		t.Errorf("SetOverride of missing syscall succeeded")
+	}
+
+	all := ErrnoOverride(linuxerr.ENOSYS)
+	cont := ErrnoOverride(linuxerr.EPERM)
+	if err := table.SetOverride("", 1, all); err != nil {
+		t.Fatalf("SetOverride failed: %v", err)
+	}
+	if err := table.SetOverride("cont", 1, cont); err != nil {
+		t.Fatalf("SetOverride failed: %v", err)
+	}
+	if !enabled(1) || enabled(2) {
+		t.Errorf("SyscallOverrideEnable got (%t, %t) for syscalls 1 and 2, want (true, false)", enabled(1), enabled(2))
+	}
+	if got := table.lookupOverride("cont", 1); got != cont {
+		t.Errorf("lookupOverride(cont, 1) = %v, want container override", got)
+	}
+	if got := table.lookupOverride("other", 1); got != all {
+		t.Errorf("lookupOverride(other, 1) = %v, want global override", got)
+	}
+	if _, _, err := cont.Fn(nil, 1, arch.SyscallArguments{}, table.Lookup(1)); err != linuxerr.EPERM {
+		t.Errorf("container override returned %v, want EPERM", err)
+	}
+
+	table.ClearOverrides("cont")
+	if got := table.lookupOverride("cont", 1); got != all {
+		t.Errorf("lookupOverride(cont, 1) after ClearOverrides = %v, want global override", got)
+	}
+	if err := table.SetOverride("", 1, nil); err != nil {
+		t.Fatalf("SetOverride failed: %v", err)
+	}
+	if got := table.lookupOverride("cont", 1); got != nil {
+		t.Errorf("lookupOverride(cont, 1) after removal = %v, want nil", got)
+	}
+	if enabled(1) {
+		t.Errorf("SyscallOverrideEnable set for syscall 1 without overrides")
+	}
+}
+
 func BenchmarkTableLookup(b *testing.B) {
 	table := createSyscallTable()
 
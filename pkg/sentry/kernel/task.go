@@ -111,6 +111,17 @@ type Task struct {
 	// owned by the task goroutine.
 	yieldCount atomicbitops.Uint64
 
+	// syscallNo, syscallIP and syscallSP are the syscall number and the
+	// application instruction and stack pointers at the task's most recent
+	// syscall entry. They allow the watchdog to report the application state
+	// of tasks that are stuck in a syscall.
+	//
+	// These fields are accessed using atomic memory operations. They are
+	// owned by the task goroutine.
+	syscallNo atomicbitops.Uint64 `state:"nosave"`
+	syscallIP atomicbitops.Uint64 `state:"nosave"`
+	syscallSP atomicbitops.Uint64 `state:"nosave"`
+
 	// pendingSignals is the set of pending signals that may be handled only by
 	// this task.
 	//
@@ -271,6 +282,12 @@ type Task struct {
 	// fdTable is protected by mu, and is owned by the task goroutine.
 	fdTable *FDTable
 
+	// ioRings are the io_uring files registered with io_uring_register(2)
+	// IORING_REGISTER_RING_FDS. Each non-nil file holds a reference.
+	//
+	// ioRings is exclusive to the task goroutine.
+	ioRings [linux.IO_RINGFD_REG_MAX]*vfs.FileDescription
+
 	// If vforkParent is not nil, it is the task that created this task with
 	// vfork() or clone(CLONE_VFORK), and should have its vforkStop ended when
 	// this TaskImage is released.
@@ -366,6 +383,15 @@ type Task struct {
 	// ptraceSinglestep is protected by the TaskSet mutex.
 	ptraceSinglestep bool
 
+	// If breakpointResume is true, a hardware breakpoint stopped the task at
+	// breakpointResumeIP, and doesn't stop it again when it resumes execution
+	// there. breakpointResume is analogous to the x86 resume flag (RF).
+	//
+	// breakpointResume and breakpointResumeIP are exclusive to the task
+	// goroutine.
+	breakpointResume   bool
+	breakpointResumeIP hostarch.Addr
+
 	// If t is ptrace-stopped, ptraceCode is a ptrace-defined value set at the
 	// time that t entered the ptrace stop, reset to 0 when the tracer
 	// acknowledges the stop with a wait*() syscall. Otherwise, it is the
@@ -441,10 +467,14 @@ type Task struct {
 	// ipcns is protected by mu. ipcns is owned by the task goroutine.
 	ipcns *IPCNamespace
 
-	// abstractSockets tracks abstract sockets that are in use.
+	// timens is the task's time namespace, and childTimens is the time
+	// namespace of its future children. They differ after
+	// unshare(CLONE_NEWTIME), until the task execs.
 	//
-	// abstractSockets is protected by mu.
-	abstractSockets *AbstractSocketNamespace
+	// timens and childTimens are protected by mu. They are owned by the task
+	// goroutine.
+	timens      *TimeNamespace
+	childTimens *TimeNamespace
 
 	// mountNamespace is the task's mount namespace.
 	//
@@ -593,6 +623,18 @@ type Task struct {
 	// memCgID is the memory cgroup id.
 	memCgID atomicbitops.Uint32
 
+	// cpuBandwidth is the CPU bandwidth limit of the task's cpu cgroup, or nil
+	// if the task isn't in a cpu cgroup.
+	cpuBandwidth atomic.Pointer[CgroupCPUBandwidth] `state:".(*CgroupCPUBandwidth)"`
+
+	// memoryLimit is the memory limit of the task's memory cgroup, or nil if
+	// the task isn't in a memory cgroup.
+	memoryLimit atomic.Pointer[CgroupMemoryLimit] `state:".(*CgroupMemoryLimit)"`
+
+	// containerCPUBandwidth is the CPU bandwidth limit of the task's
+	// container. containerCPUBandwidth is immutable.
+	containerCPUBandwidth *CgroupCPUBandwidth
+
 	// userCounters is a pointer to a set of user counters.
 	//
 	// The userCounters pointer is exclusive to the task goroutine, but the
@@ -638,6 +680,22 @@ func (t *Task) loadSyscallFilters(filters []bpf.Program) {
 	t.syscallFilters.Store(filters)
 }
 
+func (t *Task) saveCpuBandwidth() *CgroupCPUBandwidth {
+	return t.cpuBandwidth.Load()
+}
+
+func (t *Task) loadCpuBandwidth(b *CgroupCPUBandwidth) {
+	t.cpuBandwidth.Store(b)
+}
+
+func (t *Task) saveMemoryLimit() *CgroupMemoryLimit {
+	return t.memoryLimit.Load()
+}
+
+func (t *Task) loadMemoryLimit(l *CgroupMemoryLimit) {
+	t.memoryLimit.Store(l)
+}
+
 // afterLoad is invoked by stateify.
 func (t *Task) afterLoad() {
 	t.updateInfoLocked()
@@ -809,9 +867,10 @@ func (t *Task) GetMountNamespace() *vfs.MountNamespace {
 	return mntns
 }
 
-// AbstractSockets returns t's AbstractSocketNamespace.
-func (t *Task) AbstractSockets() *AbstractSocketNamespace {
-	return t.abstractSockets
+// AbstractSockets returns the AbstractSocketNamespace of t's network
+// namespace.
+func (t *Task) AbstractSockets() *inet.AbstractSocketNamespace {
+	return t.netns.AbstractSockets()
 }
 
 // ContainerID returns t's container ID.
@@ -213,12 +213,16 @@ func (t *Task) UninterruptibleSleepStart(deactivate bool) {
 	if deactivate {
 		t.Deactivate()
 	}
+	// Count t as stalled on IO before it stops counting as running, see
+	// Kernel.pressureIdle.
+	t.k.ioStalledTasks.Add(1)
 	t.accountTaskGoroutineEnter(TaskGoroutineBlockedUninterruptible)
 }
 
 // UninterruptibleSleepFinish implements context.Context.UninterruptibleSleepFinish.
 func (t *Task) UninterruptibleSleepFinish(activate bool) {
 	t.accountTaskGoroutineLeave(TaskGoroutineBlockedUninterruptible)
+	t.k.ioStalledTasks.Add(-1)
 	if activate {
 		t.Activate()
 	}
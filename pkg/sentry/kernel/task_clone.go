@@ -38,7 +38,7 @@ const SupportedCloneFlags = linux.CLONE_VM | linux.CLONE_FS | linux.CLONE_FILES
 	linux.CLONE_CHILD_CLEARTID | linux.CLONE_CHILD_SETTID | linux.CLONE_PARENT |
 	linux.CLONE_PARENT_SETTID | linux.CLONE_SETTLS | linux.CLONE_NEWUSER | linux.CLONE_NEWUTS |
 	linux.CLONE_NEWIPC | linux.CLONE_NEWNET | linux.CLONE_PTRACE | linux.CLONE_UNTRACED |
-	linux.CLONE_IO | linux.CLONE_VFORK | linux.CLONE_DETACHED | linux.CLONE_NEWNS
+	linux.CLONE_IO | linux.CLONE_VFORK | linux.CLONE_DETACHED | linux.CLONE_NEWNS | linux.CLONE_NEWTIME
 
 // Clone implements the clone(2) syscall and returns the thread ID of the new
 // task in t's PID namespace. Clone may return both a non-zero thread ID and a
@@ -116,7 +116,7 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 			return 0, nil, err
 		}
 	}
-	if args.Flags&(linux.CLONE_NEWPID|linux.CLONE_NEWNET|linux.CLONE_NEWUTS|linux.CLONE_NEWIPC) != 0 && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, userns) {
+	if args.Flags&(linux.CLONE_NEWPID|linux.CLONE_NEWNET|linux.CLONE_NEWUTS|linux.CLONE_NEWIPC|linux.CLONE_NEWTIME) != 0 && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, userns) {
 		return 0, nil, linuxerr.EPERM
 	}
 
@@ -148,6 +148,27 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		ipcns.DecRef(t)
 	})
 
+	childTimens := t.childTimens
+	if args.Flags&linux.CLONE_NEWTIME != 0 {
+		childTimens = childTimens.Clone(userns)
+		childTimens.SetInode(nsfs.NewInode(t, t.k.nsfsMount, childTimens))
+	} else {
+		childTimens.IncRef()
+	}
+	cu.Add(func() {
+		childTimens.DecRef(t)
+	})
+	// Unless it shares t's address space, the new task enters the time
+	// namespace of t's children. See Linux's kernel/nsproxy.c:copy_namespaces().
+	timens := childTimens
+	if args.Flags&linux.CLONE_VM != 0 {
+		timens = t.timens
+	}
+	timens.IncRef()
+	cu.Add(func() {
+		timens.DecRef(t)
+	})
+
 	netns := t.netns
 	if args.Flags&linux.CLONE_NEWNET != 0 {
 		netns = inet.NewNamespace(netns, userns)
@@ -174,6 +195,13 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	cu.Add(func() {
 		image.release(t)
 	})
+	if timens != t.timens {
+		// The forked address space maps the VDSO parameter page for t's time
+		// namespace. Compare Linux's kernel/time/namespace.c:timens_on_fork().
+		if err := t.k.setVDSOClockOffsets(t, image.MemoryManager, timens); err != nil {
+			return 0, nil, err
+		}
+	}
 
 	if args.Flags&linux.CLONE_NEWUSER != 0 {
 		// If the task is in a new user namespace, it cannot share keys.
@@ -247,26 +275,30 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		uc = t.k.GetUserCounters(creds.RealKUID)
 	}
 
+	numaPolicy, numaNodeMask := t.NumaPolicy()
 	cfg := &TaskConfig{
-		Kernel:                  t.k,
-		ThreadGroup:             tg,
-		SignalMask:              t.SignalMask(),
-		TaskImage:               image,
-		FSContext:               fsContext,
-		FDTable:                 fdTable,
-		Credentials:             creds,
-		Niceness:                t.Niceness(),
-		NetworkNamespace:        netns,
-		AllowedCPUMask:          t.CPUMask(),
-		UTSNamespace:            utsns,
-		IPCNamespace:            ipcns,
-		AbstractSocketNamespace: t.abstractSockets,
-		MountNamespace:          mntns,
-		RSeqAddr:                rseqAddr,
-		RSeqSignature:           rseqSignature,
-		ContainerID:             t.ContainerID(),
-		UserCounters:            uc,
-		SessionKeyring:          sessionKeyring,
+		Kernel:             t.k,
+		ThreadGroup:        tg,
+		SignalMask:         t.SignalMask(),
+		TaskImage:          image,
+		FSContext:          fsContext,
+		FDTable:            fdTable,
+		Credentials:        creds,
+		Niceness:           t.Niceness(),
+		NumaPolicy:         numaPolicy,
+		NumaNodeMask:       numaNodeMask,
+		NetworkNamespace:   netns,
+		AllowedCPUMask:     t.CPUMask(),
+		UTSNamespace:       utsns,
+		IPCNamespace:       ipcns,
+		TimeNamespace:      timens,
+		ChildTimeNamespace: childTimens,
+		MountNamespace:     mntns,
+		RSeqAddr:           rseqAddr,
+		RSeqSignature:      rseqSignature,
+		ContainerID:        t.ContainerID(),
+		UserCounters:       uc,
+		SessionKeyring:     sessionKeyring,
 	}
 	if args.Flags&linux.CLONE_THREAD == 0 {
 		cfg.Parent = t
@@ -539,6 +571,35 @@ func (t *Task) Setns(fd *vfs.FileDescription, flags int32) error {
 		t.mu.Unlock()
 		oldNS.DecRef(t)
 		return nil
+	case *TimeNamespace:
+		if flags != 0 && flags != linux.CLONE_NEWTIME {
+			return linuxerr.EINVAL
+		}
+		// Tasks sharing an address space must be in the same time namespace.
+		t.tg.signalHandlers.mu.Lock()
+		singleThreaded := t.tg.tasksCount == 1
+		t.tg.signalHandlers.mu.Unlock()
+		if !singleThreaded {
+			return linuxerr.EUSERS
+		}
+		if !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, ns.UserNamespace()) ||
+			!t.Credentials().HasCapability(linux.CAP_SYS_ADMIN) {
+			return linuxerr.EPERM
+		}
+		// Compare Linux's kernel/time/namespace.c:timens_commit().
+		if err := t.k.setVDSOClockOffsets(t, t.MemoryManager(), ns); err != nil {
+			return err
+		}
+		ns.IncRef()
+		ns.IncRef()
+		t.mu.Lock()
+		oldNS, oldChildNS := t.timens, t.childTimens
+		t.timens, t.childTimens = ns, ns
+		t.mu.Unlock()
+		ns.enter()
+		oldNS.DecRef(t)
+		oldChildNS.DecRef(t)
+		return nil
 	default:
 		return linuxerr.EINVAL
 	}
@@ -649,6 +710,19 @@ func (t *Task) Unshare(flags int32) error {
 		t.ipcns.SetInode(nsfs.NewInode(t, t.k.nsfsMount, t.ipcns))
 		cu.Add(func() { oldIPCNS.DecRef(t) })
 	}
+	if flags&linux.CLONE_NEWTIME != 0 {
+		if !haveCapSysAdmin {
+			return linuxerr.EPERM
+		}
+		// "Unshare the time namespace, so that the calling process has a new
+		// time namespace for its children which is not shared with any
+		// previously existing process." - unshare(2). The calling process
+		// enters it when it execs.
+		oldChildTimeNS := t.childTimens
+		t.childTimens = oldChildTimeNS.Clone(creds.UserNamespace)
+		t.childTimens.SetInode(nsfs.NewInode(t, t.k.nsfsMount, t.childTimens))
+		cu.Add(func() { oldChildTimeNS.DecRef(t) })
+	}
 	if flags&linux.CLONE_FILES != 0 {
 		oldFDTable := t.fdTable
 		t.fdTable = oldFDTable.Fork(t, MaxFdLimit)
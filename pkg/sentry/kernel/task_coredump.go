@@ -0,0 +1,574 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// defaultCorePattern is the initial value of /proc/sys/kernel/core_pattern.
+const defaultCorePattern = "core"
+
+// Note types used in core files. See include/uapi/linux/elf.h.
+const (
+	ntPRStatus = 1
+	ntPRPSInfo = 3
+	ntAuxv     = 6
+)
+
+// Layout of struct elf_prstatus and struct elf_prpsinfo on 64-bit
+// architectures. See include/linux/elfcore.h.
+const (
+	prstatusRegsOffset   = 112
+	prpsinfoSize         = 136
+	prpsinfoFnameOffset  = 40
+	prpsinfoPsargsOffset = 56
+)
+
+const (
+	elf64HeaderSize     = 64
+	elf64ProgHeaderSize = 56
+
+	// coreNoteName is the owner name of notes in core files.
+	coreNoteName  = "CORE\x00"
+	coreNoteAlign = 4
+
+	// coreCopyChunkSize is the amount of memory copied to the core file at a
+	// time.
+	coreCopyChunkSize = 16 * hostarch.PageSize
+)
+
+// errCoreLimit is returned when a core file is truncated by RLIMIT_CORE.
+var errCoreLimit = errors.New("core file truncated by RLIMIT_CORE")
+
+// coreNote is a note in the PT_NOTE segment of a core file.
+type coreNote struct {
+	typ  uint32
+	desc []byte
+}
+
+// coreSegment is a memory mapping described by a PT_LOAD segment of a core
+// file.
+type coreSegment struct {
+	start hostarch.Addr
+	end   hostarch.Addr
+	perms hostarch.AccessType
+
+	// dumpSize is the number of bytes at the start of the mapping whose
+	// contents are included in the core file.
+	dumpSize uint64
+
+	// maybeELF is true if the mapping starts at offset 0 of a readable file,
+	// and thus may begin with an ELF header.
+	maybeELF bool
+}
+
+// prepareGroupExitForCoreDump is equivalent to PrepareGroupExit for a group
+// exit caused by the core-dumping signal described by info, except that if t
+// initiates the group exit, it also writes a core file for its thread group.
+//
+// prepareGroupExitForCoreDump is analogous to the part of Linux's
+// get_signal() that calls do_coredump() and do_group_exit().
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) prepareGroupExitForCoreDump(info *linux.SignalInfo) {
+	t.tg.signalHandlers.mu.Lock()
+	initiated := !t.tg.exiting && t.tg.execing == nil
+	t.prepareGroupExitLocked(linux.WaitStatusTerminationSignal(linux.Signal(info.Signo)))
+	t.tg.signalHandlers.mu.Unlock()
+	if !initiated {
+		return
+	}
+
+	// Unlike Linux, we do not wait for killed siblings to stop before dumping
+	// memory, so memory modified by them concurrently may be inconsistent in
+	// the core file.
+	path, err := t.dumpCore(info)
+	if err != nil {
+		t.Infof("Failed to write core file: %v", err)
+		return
+	}
+	if path == "" {
+		return
+	}
+	t.Infof("Wrote core file %q", path)
+
+	// As in Linux's coredump_finish(), this is the only change made to the
+	// thread group's exit status after the group exit begins; it happens
+	// before t exits, and thus before the exit status may be observed by
+	// wait().
+	t.tg.signalHandlers.mu.Lock()
+	t.tg.exitStatus = t.tg.exitStatus.WithCoreDump()
+	t.exitStatus = t.tg.exitStatus
+	t.tg.signalHandlers.mu.Unlock()
+}
+
+// dumpCore writes an ELF core file for t's thread group, which is being
+// killed by the signal described by info. It returns the path of the core
+// file, or an empty string if core dumps are disabled for t.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) dumpCore(info *linux.SignalInfo) (string, error) {
+	limit := t.tg.Limits().Get(limits.Core).Cur
+	if limit == 0 {
+		return "", nil
+	}
+	m := t.MemoryManager()
+	if m == nil || m.Dumpability() != mm.UserDumpable {
+		// Linux's suid_dumpable=2 mode, which allows RootDumpable processes
+		// to dump core as root, is not supported.
+		return "", nil
+	}
+	pattern := t.k.CorePattern()
+	if strings.HasPrefix(pattern, "|") {
+		return "", fmt.Errorf("piping core dumps to a program is not supported (core_pattern %q)", pattern)
+	}
+	path := expandCorePattern(pattern, t.corePatternSpecifiers(linux.Signal(info.Signo)))
+	if path == "" {
+		return "", fmt.Errorf("core_pattern %q expands to an empty path", pattern)
+	}
+
+	machine, err := coreMachine(t.Arch().Arch())
+	if err != nil {
+		return "", err
+	}
+	prstatus, err := t.corePRStatus(info)
+	if err != nil {
+		return "", err
+	}
+	notes := []coreNote{
+		{typ: ntPRStatus, desc: prstatus},
+		{typ: ntPRPSInfo, desc: t.corePRPSInfo()},
+		{typ: ntAuxv, desc: coreAuxv(m.Auxv())},
+	}
+	segs := t.coreSegments()
+
+	fd, err := t.openCoreFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.DecRef(t)
+	w := &coreFileWriter{ctx: t, fd: fd, remaining: limit}
+	if err := writeCore(w, machine, notes, segs, t.readCoreMemory); err != nil {
+		return "", fmt.Errorf("writing core file %q: %w", path, err)
+	}
+	return path, nil
+}
+
+// corePatternSpecifiers returns the values of the core_pattern specifiers
+// for a core dump of t's thread group caused by sig.
+func (t *Task) corePatternSpecifiers(sig linux.Signal) map[byte]string {
+	pidns := t.PIDNamespace()
+	root := t.k.tasks.Root
+	creds := t.Credentials()
+	return map[byte]string{
+		'p': strconv.Itoa(int(pidns.IDOfThreadGroup(t.tg))),
+		'P': strconv.Itoa(int(root.IDOfThreadGroup(t.tg))),
+		'i': strconv.Itoa(int(pidns.IDOfTask(t))),
+		'I': strconv.Itoa(int(root.IDOfTask(t))),
+		'u': strconv.FormatUint(uint64(creds.RealKUID), 10),
+		'g': strconv.FormatUint(uint64(creds.RealKGID), 10),
+		's': strconv.Itoa(int(sig)),
+		't': strconv.FormatInt(t.k.RealtimeClock().Now().Seconds(), 10),
+		'h': strings.ReplaceAll(t.UTSNamespace().HostName(), "/", "!"),
+		'e': strings.ReplaceAll(t.Name(), "/", "!"),
+	}
+}
+
+// expandCorePattern expands the specifiers in pattern, which has the syntax
+// of /proc/sys/kernel/core_pattern, using the given specifier values. As in
+// Linux's format_corename(), unknown specifiers and a trailing '%' expand to
+// nothing.
+func expandCorePattern(pattern string, specifiers map[byte]string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		if i == len(pattern) {
+			break
+		}
+		if pattern[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		b.WriteString(specifiers[pattern[i]])
+	}
+	return b.String()
+}
+
+// coreMachine returns the ELF machine type for core files of the given
+// architecture.
+func coreMachine(a arch.Arch) (elf.Machine, error) {
+	switch a {
+	case arch.AMD64:
+		return elf.EM_X86_64, nil
+	case arch.ARM64:
+		return elf.EM_AARCH64, nil
+	default:
+		return 0, fmt.Errorf("core dumps are not supported on architecture %v", a)
+	}
+}
+
+// coreIDs returns the parent thread group ID, process group ID and session
+// ID of t in its PID namespace.
+func (t *Task) coreIDs() (ppid ThreadID, pgid ProcessGroupID, sid SessionID) {
+	pidns := t.PIDNamespace()
+	if parent := t.Parent(); parent != nil {
+		ppid = pidns.IDOfThreadGroup(parent.tg)
+	}
+	if pg := t.tg.ProcessGroup(); pg != nil {
+		pgid = pidns.IDOfProcessGroup(pg)
+		sid = pidns.IDOfSession(pg.Session())
+	}
+	return
+}
+
+// corePRStatus returns the contents of t's NT_PRSTATUS note, a struct
+// elf_prstatus.
+func (t *Task) corePRStatus(info *linux.SignalInfo) ([]byte, error) {
+	var regs bytes.Buffer
+	if _, err := t.Arch().PtraceGetRegs(&regs); err != nil {
+		return nil, fmt.Errorf("getting registers: %w", err)
+	}
+	// The registers are followed by pr_fpvalid and padding.
+	b := make([]byte, prstatusRegsOffset+regs.Len()+8)
+	order := hostarch.ByteOrder
+	order.PutUint32(b[0:], uint32(info.Signo))
+	order.PutUint32(b[4:], uint32(info.Code))
+	order.PutUint32(b[8:], uint32(info.Errno))
+	order.PutUint16(b[12:], uint16(info.Signo))
+	order.PutUint64(b[16:], uint64(t.PendingSignals()))
+	order.PutUint64(b[24:], uint64(t.SignalMask()))
+	ppid, pgid, sid := t.coreIDs()
+	order.PutUint32(b[32:], uint32(t.PIDNamespace().IDOfTask(t)))
+	order.PutUint32(b[36:], uint32(ppid))
+	order.PutUint32(b[40:], uint32(pgid))
+	order.PutUint32(b[44:], uint32(sid))
+	stats := t.CPUStats()
+	childStats := t.tg.JoinedChildCPUStats()
+	for i, d := range []time.Duration{stats.UserTime, stats.SysTime, childStats.UserTime, childStats.SysTime} {
+		tv := linux.DurationToTimeval(d)
+		order.PutUint64(b[48+16*i:], uint64(tv.Sec))
+		order.PutUint64(b[56+16*i:], uint64(tv.Usec))
+	}
+	copy(b[prstatusRegsOffset:], regs.Bytes())
+	return b, nil
+}
+
+// corePRPSInfo returns the contents of t's NT_PRPSINFO note, a struct
+// elf_prpsinfo.
+func (t *Task) corePRPSInfo() []byte {
+	b := make([]byte, prpsinfoSize)
+	// pr_sname: the task is running.
+	b[1] = 'R'
+	order := hostarch.ByteOrder
+	creds := t.Credentials()
+	order.PutUint32(b[16:], uint32(creds.UserNamespace.MapFromKUID(creds.RealKUID).OrOverflow()))
+	order.PutUint32(b[20:], uint32(creds.UserNamespace.MapFromKGID(creds.RealKGID).OrOverflow()))
+	ppid, pgid, sid := t.coreIDs()
+	order.PutUint32(b[24:], uint32(t.PIDNamespace().IDOfThreadGroup(t.tg)))
+	order.PutUint32(b[28:], uint32(ppid))
+	order.PutUint32(b[32:], uint32(pgid))
+	order.PutUint32(b[36:], uint32(sid))
+	// pr_fname and pr_psargs are NUL-terminated.
+	copy(b[prpsinfoFnameOffset:prpsinfoPsargsOffset-1], t.Name())
+	copy(b[prpsinfoPsargsOffset:prpsinfoSize-1], t.coreArgs(prpsinfoSize-prpsinfoPsargsOffset-1))
+	return b
+}
+
+// coreArgs returns up to max bytes of t's command line, with arguments
+// separated by spaces.
+func (t *Task) coreArgs(max int) []byte {
+	m := t.MemoryManager()
+	start, end := m.ArgvStart(), m.ArgvEnd()
+	if end <= start {
+		return nil
+	}
+	size := int(end - start)
+	if size > max {
+		size = max
+	}
+	buf := make([]byte, size)
+	n, _ := m.CopyIn(t, start, buf, usermem.IOOpts{IgnorePermissions: true})
+	buf = bytes.TrimRight(buf[:n], "\x00")
+	return bytes.ReplaceAll(buf, []byte{0}, []byte{' '})
+}
+
+// coreAuxv returns the contents of an NT_AUXV note for auxv.
+func coreAuxv(auxv arch.Auxv) []byte {
+	// The auxiliary vector is terminated by an AT_NULL entry.
+	b := make([]byte, 16*(len(auxv)+1))
+	for i, e := range auxv {
+		hostarch.ByteOrder.PutUint64(b[16*i:], e.Key)
+		hostarch.ByteOrder.PutUint64(b[16*i+8:], uint64(e.Value))
+	}
+	return b
+}
+
+// coreSegments returns the memory mappings of t's address space to be
+// described by the core file.
+func (t *Task) coreSegments() []coreSegment {
+	var segs []coreSegment
+	m := t.MemoryManager()
+	m.ReadMapsDataInto(t, func(start, end hostarch.Addr, perms hostarch.AccessType, private string, offset uint64, devMajor, devMinor uint32, inode uint64, path string) {
+		if path == "[vsyscall]" {
+			// Not part of the address space; Linux omits it as well.
+			return
+		}
+		seg := coreSegment{
+			start: start,
+			end:   end,
+			perms: perms,
+		}
+		switch {
+		case !perms.Any():
+			// Inaccessible mappings are reservations or guard pages.
+		case inode == 0 || (private == "p" && perms.Write):
+			// As with Linux's default coredump_filter, dump anonymous
+			// mappings and private file mappings that may have been
+			// written to.
+			seg.dumpSize = uint64(end - start)
+		default:
+			seg.maybeELF = offset == 0 && perms.Read
+		}
+		segs = append(segs, seg)
+	})
+
+	// Include the ELF header of mapped files so that debuggers can identify
+	// them. This can't be done in the callback above, which is called with
+	// the MemoryManager's mapping lock held.
+	for i := range segs {
+		if !segs[i].maybeELF {
+			continue
+		}
+		var magic [len(elf.ELFMAG)]byte
+		if _, err := m.CopyIn(t, segs[i].start, magic[:], usermem.IOOpts{IgnorePermissions: true}); err == nil && string(magic[:]) == elf.ELFMAG {
+			segs[i].dumpSize = hostarch.PageSize
+		}
+	}
+	return segs
+}
+
+// readCoreMemory reads application memory at addr into dst. Memory that
+// can't be read is zero-filled.
+func (t *Task) readCoreMemory(addr hostarch.Addr, dst []byte) {
+	n, _ := t.MemoryManager().CopyIn(t, addr, dst, usermem.IOOpts{IgnorePermissions: true})
+	rest := dst[n:]
+	for i := range rest {
+		rest[i] = 0
+	}
+}
+
+// openCoreFile creates the core file at path, which is resolved relative to
+// t's working directory.
+func (t *Task) openCoreFile(path string) (*vfs.FileDescription, error) {
+	root := t.FSContext().RootDirectory()
+	defer root.DecRef(t)
+	cwd := t.FSContext().WorkingDirectory()
+	defer cwd.DecRef(t)
+	creds := t.Credentials()
+	fd, err := t.k.VFS().OpenAt(t, creds, &vfs.PathOperation{
+		Root:  root,
+		Start: cwd,
+		Path:  fspath.Parse(path),
+	}, &vfs.OpenOptions{
+		Flags: linux.O_WRONLY | linux.O_CREAT | linux.O_NOFOLLOW | linux.O_LARGEFILE,
+		Mode:  0600,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening core file %q: %w", path, err)
+	}
+
+	// As in Linux's do_coredump(), refuse to overwrite anything other than
+	// a regular file with a single link owned by the dumping user, and only
+	// truncate it once this has been checked.
+	stat, err := fd.Stat(t, vfs.StatOptions{Mask: linux.STATX_TYPE | linux.STATX_NLINK | linux.STATX_UID})
+	if err != nil {
+		fd.DecRef(t)
+		return nil, err
+	}
+	if stat.Mode&linux.FileTypeMask != linux.ModeRegular || stat.Nlink != 1 || stat.UID != uint32(creds.UserNamespace.MapFromKUID(creds.EffectiveKUID)) {
+		fd.DecRef(t)
+		return nil, fmt.Errorf("refusing to overwrite core file %q: not a regular file owned by the dumping user", path)
+	}
+	if err := fd.SetStat(t, vfs.SetStatOptions{Stat: linux.Statx{Mask: linux.STATX_SIZE}}); err != nil {
+		fd.DecRef(t)
+		return nil, fmt.Errorf("truncating core file %q: %w", path, err)
+	}
+	return fd, nil
+}
+
+// coreFileWriter is an io.Writer that writes to a core file, stopping at
+// RLIMIT_CORE.
+type coreFileWriter struct {
+	ctx context.Context
+	fd  *vfs.FileDescription
+
+	// remaining is the number of bytes that may be written before
+	// RLIMIT_CORE is reached.
+	remaining uint64
+}
+
+// Write implements io.Writer.Write.
+func (w *coreFileWriter) Write(src []byte) (int, error) {
+	truncated := false
+	if uint64(len(src)) > w.remaining {
+		src = src[:w.remaining]
+		truncated = true
+	}
+	done := 0
+	for done < len(src) {
+		n, err := w.fd.Write(w.ctx, usermem.BytesIOSequence(src[done:]), vfs.WriteOptions{})
+		done += int(n)
+		if err != nil {
+			w.remaining -= uint64(done)
+			return done, err
+		}
+	}
+	w.remaining -= uint64(done)
+	if truncated {
+		return done, errCoreLimit
+	}
+	return done, nil
+}
+
+// writeCore writes an ELF core file to w. The file contains a PT_NOTE segment
+// with the given notes, followed by a PT_LOAD segment for each of the given
+// memory mappings, whose contents are obtained by calling readMemory.
+func writeCore(w io.Writer, machine elf.Machine, notes []coreNote, segs []coreSegment, readMemory func(addr hostarch.Addr, dst []byte)) error {
+	phnum := 1 + len(segs)
+	// Larger values of e_phnum require the PN_XNUM extension.
+	if phnum >= 0xffff {
+		return fmt.Errorf("too many memory mappings (%d)", len(segs))
+	}
+	order := hostarch.ByteOrder
+
+	var noteData bytes.Buffer
+	for _, n := range notes {
+		var nhdr [12]byte
+		order.PutUint32(nhdr[0:], uint32(len(coreNoteName)))
+		order.PutUint32(nhdr[4:], uint32(len(n.desc)))
+		order.PutUint32(nhdr[8:], n.typ)
+		noteData.Write(nhdr[:])
+		writeCoreNotePadded(&noteData, []byte(coreNoteName))
+		writeCoreNotePadded(&noteData, n.desc)
+	}
+	noteOffset := uint64(elf64HeaderSize + phnum*elf64ProgHeaderSize)
+	dataOffset, _ := hostarch.PageRoundUp(noteOffset + uint64(noteData.Len()))
+
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     elf64HeaderSize,
+		Ehsize:    elf64HeaderSize,
+		Phentsize: elf64ProgHeaderSize,
+		Phnum:     uint16(phnum),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	hdr.Ident[elf.EI_OSABI] = byte(elf.ELFOSABI_NONE)
+
+	progs := make([]elf.Prog64, 0, phnum)
+	progs = append(progs, elf.Prog64{
+		Type:   uint32(elf.PT_NOTE),
+		Off:    noteOffset,
+		Filesz: uint64(noteData.Len()),
+		Align:  coreNoteAlign,
+	})
+	offset := dataOffset
+	for _, seg := range segs {
+		var flags elf.ProgFlag
+		if seg.perms.Read {
+			flags |= elf.PF_R
+		}
+		if seg.perms.Write {
+			flags |= elf.PF_W
+		}
+		if seg.perms.Execute {
+			flags |= elf.PF_X
+		}
+		progs = append(progs, elf.Prog64{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(flags),
+			Off:    offset,
+			Vaddr:  uint64(seg.start),
+			Filesz: seg.dumpSize,
+			Memsz:  uint64(seg.end - seg.start),
+			Align:  hostarch.PageSize,
+		})
+		offset += seg.dumpSize
+	}
+
+	if err := binary.Write(w, order, &hdr); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, progs); err != nil {
+		return err
+	}
+	if _, err := w.Write(noteData.Bytes()); err != nil {
+		return err
+	}
+	if _, err := w.Write(make([]byte, dataOffset-noteOffset-uint64(noteData.Len()))); err != nil {
+		return err
+	}
+	buf := make([]byte, coreCopyChunkSize)
+	for _, seg := range segs {
+		for done := uint64(0); done < seg.dumpSize; {
+			chunk := buf
+			if rem := seg.dumpSize - done; rem < uint64(len(chunk)) {
+				chunk = chunk[:rem]
+			}
+			readMemory(seg.start+hostarch.Addr(done), chunk)
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+			done += uint64(len(chunk))
+		}
+	}
+	return nil
+}
+
+// writeCoreNotePadded writes b to buf, followed by zero padding to
+// coreNoteAlign.
+func writeCoreNotePadded(buf *bytes.Buffer, b []byte) {
+	buf.Write(b)
+	if rem := len(b) % coreNoteAlign; rem != 0 {
+		buf.Write(make([]byte, coreNoteAlign-rem))
+	}
+}
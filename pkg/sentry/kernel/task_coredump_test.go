@@ -0,0 +1,135 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"debug/elf"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+func TestExpandCorePattern(t *testing.T) {
+	specifiers := map[byte]string{
+		'p': "42",
+		'e': "a!b",
+		's': "11",
+	}
+	for _, test := range []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "core", want: "core"},
+		{pattern: "core.%p", want: "core.42"},
+		{pattern: "/tmp/%e-%s-%p.core", want: "/tmp/a!b-11-42.core"},
+		{pattern: "100%%", want: "100%"},
+		{pattern: "core%z", want: "core"},
+		{pattern: "core%", want: "core"},
+	} {
+		if got := expandCorePattern(test.pattern, specifiers); got != test.want {
+			t.Errorf("expandCorePattern(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestWriteCore(t *testing.T) {
+	notes := []coreNote{
+		{typ: ntPRStatus, desc: []byte{1, 2, 3, 4, 5}},
+		{typ: ntAuxv, desc: coreAuxv(nil)},
+	}
+	segs := []coreSegment{
+		{
+			start:    0x10000,
+			end:      0x10000 + 2*hostarch.PageSize,
+			perms:    hostarch.ReadWrite,
+			dumpSize: 2 * hostarch.PageSize,
+		},
+		{
+			start: 0x20000,
+			end:   0x20000 + hostarch.PageSize,
+			perms: hostarch.NoAccess,
+		},
+	}
+	readMemory := func(addr hostarch.Addr, dst []byte) {
+		for i := range dst {
+			dst[i] = byte(addr + hostarch.Addr(i))
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeCore(&buf, elf.EM_X86_64, notes, segs, readMemory); err != nil {
+		t.Fatalf("writeCore failed: %v", err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to parse core file: %v", err)
+	}
+	if f.Type != elf.ET_CORE || f.Machine != elf.EM_X86_64 {
+		t.Errorf("got type %v machine %v, want %v %v", f.Type, f.Machine, elf.ET_CORE, elf.EM_X86_64)
+	}
+	if len(f.Progs) != 1+len(segs) {
+		t.Fatalf("got %d program headers, want %d", len(f.Progs), 1+len(segs))
+	}
+
+	note := f.Progs[0]
+	if note.Type != elf.PT_NOTE {
+		t.Fatalf("first program header has type %v, want %v", note.Type, elf.PT_NOTE)
+	}
+	data := make([]byte, note.Filesz)
+	if _, err := note.ReadAt(data, 0); err != nil {
+		t.Fatalf("failed to read notes: %v", err)
+	}
+	for _, n := range notes {
+		order := hostarch.ByteOrder
+		if got := order.Uint32(data[8:]); got != n.typ {
+			t.Errorf("got note type %d, want %d", got, n.typ)
+		}
+		descSize := int(order.Uint32(data[4:]))
+		if name := string(data[12 : 12+len(coreNoteName)]); name != coreNoteName {
+			t.Errorf("got note name %q, want %q", name, coreNoteName)
+		}
+		desc := data[20 : 20+descSize]
+		if !bytes.Equal(desc, n.desc) {
+			t.Errorf("got note %d contents %v, want %v", n.typ, desc, n.desc)
+		}
+		data = data[20+(descSize+coreNoteAlign-1)/coreNoteAlign*coreNoteAlign:]
+	}
+
+	for i, seg := range segs {
+		p := f.Progs[1+i]
+		if p.Type != elf.PT_LOAD || p.Vaddr != uint64(seg.start) || p.Memsz != uint64(seg.end-seg.start) || p.Filesz != seg.dumpSize {
+			t.Errorf("segment %d: got %+v, want PT_LOAD of %#x-%#x with %d bytes of data", i, p.ProgHeader, seg.start, seg.end, seg.dumpSize)
+		}
+		if p.Off%hostarch.PageSize != 0 {
+			t.Errorf("segment %d: file offset %#x is not page-aligned", i, p.Off)
+		}
+		if p.Filesz == 0 {
+			continue
+		}
+		got := make([]byte, p.Filesz)
+		if _, err := p.ReadAt(got, 0); err != nil {
+			t.Fatalf("segment %d: failed to read contents: %v", i, err)
+		}
+		want := make([]byte, seg.dumpSize)
+		readMemory(seg.start, want)
+		if !bytes.Equal(got, want) {
+			t.Errorf("segment %d: contents differ", i)
+		}
+	}
+	if f.Progs[1].Flags != elf.PF_R|elf.PF_W {
+		t.Errorf("got flags %v, want %v", f.Progs[1].Flags, elf.PF_R|elf.PF_W)
+	}
+}
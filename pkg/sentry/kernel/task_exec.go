@@ -226,6 +226,10 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 		return flags.CloseOnExec
 	})
 
+	// Registered io_uring files are released, as in Linux's
+	// fs/exec.c:begin_new_exec() => io_uring_task_cancel().
+	t.unregisterIOUrings()
+
 	// Handle the robust futex list.
 	t.exitRobustList()
 
@@ -243,7 +247,20 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 	t.updateCredsForExecLocked()
 	oldImage := t.image
 	t.image = *r.image
+	// The task enters the time namespace of its children, if it differs
+	// after unshare(CLONE_NEWTIME). See Linux's
+	// kernel/nsproxy.c:exec_task_namespaces().
+	var oldTimens *TimeNamespace
+	if t.timens != t.childTimens {
+		oldTimens = t.timens
+		t.childTimens.IncRef()
+		t.timens = t.childTimens
+	}
 	t.mu.Unlock()
+	if oldTimens != nil {
+		t.timens.enter()
+		oldTimens.DecRef(t)
+	}
 
 	// Don't hold t.mu while calling t.image.release(), that may
 	// attempt to acquire TaskImage.MemoryManager.mappingMu, a lock order
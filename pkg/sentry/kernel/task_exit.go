@@ -277,6 +277,7 @@ func (*runExitMain) execute(t *Task) taskRunState {
 	// Releasing the MM unblocks a blocked CLONE_VFORK parent.
 	t.unstopVforkParent()
 
+	t.unregisterIOUrings()
 	t.fsContext.DecRef(t)
 	t.fdTable.DecRef(t)
 
@@ -291,12 +292,18 @@ func (*runExitMain) execute(t *Task) taskRunState {
 	t.utsns = nil
 	ipcns := t.ipcns
 	t.ipcns = nil
+	timens := t.timens
+	t.timens = nil
+	childTimens := t.childTimens
+	t.childTimens = nil
 	netns := t.netns
 	t.netns = nil
 	t.mu.Unlock()
 	mntns.DecRef(t)
 	utsns.DecRef(t)
 	ipcns.DecRef(t)
+	timens.DecRef(t)
+	childTimens.DecRef(t)
 	netns.DecRef(t)
 
 	// If this is the last task to exit from the thread group, release the
@@ -729,6 +736,11 @@ func (t *Task) exitNotifyLocked(fromPtraceDetach bool) {
 		t.tg.exitedCPUStats.Accumulate(t.CPUStats())
 		t.tg.ioUsage.Accumulate(t.ioUsage)
 		t.tg.signalHandlers.mu.Lock()
+		// Signals directed to t can no longer be dequeued. Discard them so
+		// that interval timers targeting t count later expirations as
+		// overruns, as in Linux's kernel/exit.c:__exit_signal() =>
+		// flush_sigqueue().
+		t.pendingSignals.discardAll()
 		t.tg.tasks.Remove(t)
 		t.tg.tasksCount--
 		tc := t.tg.tasksCount
@@ -110,7 +110,7 @@ func (t *Task) exitRobustList() {
 
 		// Wakeup the current futex if it's not pending.
 		if thisLockAddr != pendingLockAddr {
-			t.wakeRobustListOne(thisLockAddr)
+			t.wakeRobustListOne(thisLockAddr, false /* pending */)
 		}
 
 		// If there was an error copying the next futex, we must bail.
@@ -129,16 +129,23 @@ func (t *Task) exitRobustList() {
 
 	// Is there a pending entry to wake?
 	if pendingLockAddr != 0 {
-		t.wakeRobustListOne(pendingLockAddr)
+		t.wakeRobustListOne(pendingLockAddr, true /* pending */)
 	}
 }
 
-// wakeRobustListOne wakes a single futex from the robust list.
-func (t *Task) wakeRobustListOne(addr hostarch.Addr) {
+// wakeRobustListOne wakes a single futex from the robust list. It corresponds
+// to Linux's handle_futex_death(). pending is true if addr is the robust list's
+// list_op_pending entry.
+func (t *Task) wakeRobustListOne(addr hostarch.Addr, pending bool) {
 	// Bit 0 in address signals PI futex.
 	pi := addr&1 == 1
 	addr = addr &^ 1
 
+	// Futex words must be aligned.
+	if addr%4 != 0 {
+		return
+	}
+
 	// Load the futex.
 	f, err := t.LoadUint32(addr)
 	if err != nil {
@@ -147,6 +154,14 @@ func (t *Task) wakeRobustListOne(addr hostarch.Addr) {
 		return
 	}
 
+	// If the task died between acquiring the futex (in user mode) and setting
+	// the futex word, the futex is unowned but a waiter may have been woken
+	// on its behalf, so wake another to avoid losing the wakeup.
+	if pending && !pi && f == 0 {
+		t.wakeRobustFutex(addr)
+		return
+	}
+
 	tid := uint32(t.ThreadID())
 	for {
 		// Is this held by someone else?
@@ -167,15 +182,38 @@ func (t *Task) wakeRobustListOne(addr hostarch.Addr) {
 
 		// Wake waiters if there are any.
 		if f&linux.FUTEX_WAITERS != 0 {
-			private := f&linux.FUTEX_PRIVATE_FLAG != 0
 			if pi {
-				t.Futex().UnlockPI(t, addr, tid, private)
-				return
+				t.wakeRobustPIFutex(addr)
+			} else {
+				t.wakeRobustFutex(addr)
 			}
-			t.Futex().Wake(t, addr, private, linux.FUTEX_BITSET_MATCH_ANY, 1)
 		}
 
 		// Done.
 		return
 	}
 }
+
+// wakeRobustFutex wakes one waiter on a robust futex.
+//
+// Linux always wakes robust futexes with a shared key, which also matches
+// waiters on private futexes in private mappings. Since private and shared keys
+// never match in the futex manager, try both.
+func (t *Task) wakeRobustFutex(addr hostarch.Addr) {
+	for _, private := range []bool{false, true} {
+		if n, err := t.Futex().Wake(t, addr, private, linux.FUTEX_BITSET_MATCH_ANY, 1); err == nil && n != 0 {
+			return
+		}
+	}
+}
+
+// wakeRobustPIFutex hands a robust PI futex whose owner has died to its next
+// waiter, if any. As for wakeRobustFutex, both shared and private waiters are
+// considered.
+func (t *Task) wakeRobustPIFutex(addr hostarch.Addr) {
+	for _, private := range []bool{false, true} {
+		if woken, err := t.Futex().UnlockPIOwnerDied(t, addr, private); err != nil || woken {
+			return
+		}
+	}
+}
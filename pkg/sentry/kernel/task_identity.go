@@ -342,7 +342,7 @@ func (t *Task) SetExtraGIDs(gids []auth.GID) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	creds := t.Credentials()
-	if !creds.HasCapability(linux.CAP_SETGID) {
+	if !creds.HasCapability(linux.CAP_SETGID) || !creds.UserNamespace.SetgroupsAllowed() {
 		return linuxerr.EPERM
 	}
 	kgids := make([]auth.KGID, len(gids))
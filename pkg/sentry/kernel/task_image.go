@@ -90,6 +90,12 @@ func (image *TaskImage) Fork(ctx context.Context, k *Kernel, shareAddressSpace b
 		if err != nil {
 			return nil, err
 		}
+		// The new address space contains copies of the original's
+		// vgetrandom states, which must not be used by both.
+		if err := k.timekeeper.ReseedVDSORNG(); err != nil {
+			newMM.DecUsers(ctx)
+			return nil, err
+		}
 		newImage.MemoryManager = newMM
 		newImage.fu = k.futexes.Fork()
 	}
@@ -141,6 +147,8 @@ func (k *Kernel) LoadTaskImage(ctx context.Context, args loader.LoadArgs) (*Task
 	m := mm.NewMemoryManager(k, k, k.SleepForAddressSpaceActivation)
 	defer m.DecUsers(ctx)
 	args.MemoryManager = m
+	args.BinfmtMisc = &k.binfmtMisc
+	args.ELFCache = &k.elfCache
 
 	os, ac, name, err := loader.Load(ctx, args, k.extraAuxv, k.vdso)
 	if err != nil {
@@ -0,0 +1,77 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// RegisteredIOUring returns the io_uring file registered at index with
+// RegisterIOUring, or nil if there is none. If a file is returned, the caller
+// must release the reference.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) RegisteredIOUring(index uint32) *vfs.FileDescription {
+	if index >= linux.IO_RINGFD_REG_MAX {
+		return nil
+	}
+	file := t.ioRings[index]
+	if file != nil {
+		file.IncRef()
+	}
+	return file
+}
+
+// RegisterIOUring registers file at the first unused index in [start, end),
+// and returns that index. It returns false if all indices in the range are in
+// use. This is analogous to Linux's
+// io_uring/register.c:io_ring_add_registered_file().
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - start < end <= linux.IO_RINGFD_REG_MAX.
+func (t *Task) RegisterIOUring(file *vfs.FileDescription, start, end uint32) (uint32, bool) {
+	for i := start; i < end; i++ {
+		if t.ioRings[i] == nil {
+			file.IncRef()
+			t.ioRings[i] = file
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// UnregisterIOUring removes the io_uring file registered at index, if any.
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - index < linux.IO_RINGFD_REG_MAX.
+func (t *Task) UnregisterIOUring(index uint32) {
+	if file := t.ioRings[index]; file != nil {
+		t.ioRings[index] = nil
+		file.DecRef(t)
+	}
+}
+
+// unregisterIOUrings removes all registered io_uring files. Like Linux, this
+// happens on execve(2) and on exit.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) unregisterIOUrings() {
+	for i := range t.ioRings {
+		t.UnregisterIOUring(uint32(i))
+	}
+}
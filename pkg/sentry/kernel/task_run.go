@@ -28,6 +28,8 @@ import (
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/seccheck"
+	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
 )
 
 // A taskRunState is a reified state in the task state machine. See README.md
@@ -165,6 +167,12 @@ func (app *runApp) execute(t *Task) taskRunState {
 		}
 	}
 
+	// Enforce cgroup limits before returning to user space, which may throttle
+	// the task.
+	if !t.enforceCgroupLimits() {
+		return (*runInterrupt)(nil)
+	}
+
 	// We're about to switch to the application again. If there's still an
 	// unhandled SyscallRestartErrno that wasn't translated to an EINTR,
 	// restart the syscall that was interrupted. If there's a saved signal
@@ -247,6 +255,16 @@ func (app *runApp) execute(t *Task) taskRunState {
 		t.tg.pidns.owner.mu.RUnlock()
 	}
 
+	// Emulate the hardware breakpoints and watchpoints set by a tracer.
+	ws, ok := t.startWatchpointStep()
+	if !ok {
+		// Re-enter the task run loop for signal delivery.
+		return (*runApp)(nil)
+	}
+	if ws != nil && ws.forced {
+		clearSinglestep = true
+	}
+
 	region := trace.StartRegion(t.traceContext, runRegion)
 	t.accountTaskGoroutineEnter(TaskGoroutineRunningApp)
 	info, at, err := t.p.Switch(t, t.MemoryManager(), t.Arch(), t.rseqCPU)
@@ -266,6 +284,7 @@ func (app *runApp) execute(t *Task) taskRunState {
 	switch err {
 	case nil:
 		// Handle application system call.
+		t.breakpointResume = false
 		return t.doSyscall()
 
 	case platform.ErrContextInterrupt:
@@ -279,6 +298,11 @@ func (app *runApp) execute(t *Task) taskRunState {
 		// thread that received it.
 		sig := linux.Signal(info.Signo)
 
+		// Was it the single-step trap of watchpoint emulation?
+		if ws != nil && sig == linux.SIGTRAP && !at.Any() && !ws.finish(t) {
+			return (*runApp)(nil)
+		}
+
 		// Was it a fault that we should handle internally? If so, this wasn't
 		// an application-generated signal and we should continue execution
 		// normally.
@@ -287,8 +311,13 @@ func (app *runApp) execute(t *Task) taskRunState {
 
 			region := trace.StartRegion(t.traceContext, faultRegion)
 			addr := hostarch.Addr(info.Addr())
+			t.k.memStalledTasks.Add(1)
 			err := t.MemoryManager().HandleUserFault(t, addr, at, hostarch.Addr(t.Arch().Stack()))
+			t.k.memStalledTasks.Add(-1)
 			region.End()
+			if seccheck.Global.Enabled(seccheck.PointPageFault) {
+				t.pageFaultPoint(addr, at, err == nil)
+			}
 			if err == nil {
 				// The fault was handled appropriately.
 				// We can resume running the application.
@@ -393,3 +422,22 @@ func (t *Task) Yield() {
 	t.yieldCount.Add(1)
 	runtime.Gosched()
 }
+
+// pageFaultPoint sends the application fault at addr to seccheck sinks.
+// handled is false if the fault is delivered to the application as a signal.
+func (t *Task) pageFaultPoint(addr hostarch.Addr, at hostarch.AccessType, handled bool) {
+	info := &pb.PageFault{
+		Address: uint64(addr),
+		Ip:      uint64(t.Arch().IP()),
+		Access:  at.String(),
+		Handled: handled,
+	}
+	fields := seccheck.Global.GetFieldSet(seccheck.PointPageFault)
+	if !fields.Context.Empty() {
+		info.ContextData = &pb.ContextData{}
+		LoadSeccheckData(t, fields.Context, info.ContextData)
+	}
+	seccheck.Global.SentToSinks(func(c seccheck.Sink) error {
+		return c.PageFault(t, fields, info)
+	})
+}
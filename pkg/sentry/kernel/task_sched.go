@@ -23,6 +23,7 @@ import (
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/gohacks"
 	"gvisor.dev/gvisor/pkg/sentry/hostcpu"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
@@ -74,55 +75,72 @@ type TaskGoroutineSchedInfo struct {
 	// TaskGoroutineSchedInfo was last updated.
 	Timestamp uint64
 
+	// Nanotime was the value of gohacks.Nanotime() when this
+	// TaskGoroutineSchedInfo was last updated. Nanotime is not saved since it
+	// is only meaningful within a single sentry process; it is reset when the
+	// task goroutine is started after restore.
+	Nanotime int64 `state:"nosave"`
+
 	// State is the current state of the task goroutine.
 	State TaskGoroutineState
 
-	// UserTicks is the amount of time the task goroutine has spent executing
-	// its associated Task's application code, in units of linux.ClockTick.
-	UserTicks uint64
+	// UserTime is the amount of time the task goroutine has spent executing
+	// its associated Task's application code, as of Nanotime.
+	UserTime time.Duration
+
+	// SysTime is the amount of time the task goroutine has spent executing in
+	// the sentry, as of Nanotime.
+	SysTime time.Duration
+}
 
-	// SysTicks is the amount of time the task goroutine has spent executing in
-	// the sentry, in units of linux.ClockTick.
-	SysTicks uint64
+// sinceNanotime returns the time elapsed between ts.Nanotime and now, which
+// must be a value of gohacks.Nanotime().
+func (ts *TaskGoroutineSchedInfo) sinceNanotime(now int64) time.Duration {
+	if ts.Nanotime >= now {
+		// ts was updated after now was read.
+		return 0
+	}
+	return time.Duration(now - ts.Nanotime)
 }
 
-// userTicksAt returns the extrapolated value of ts.UserTicks after
-// Kernel.CPUClockNow() indicates a time of now.
+// userTimeAt returns the extrapolated value of ts.UserTime at the time
+// gohacks.Nanotime() returned now.
 //
-// Preconditions: now <= Kernel.CPUClockNow(). (Since Kernel.cpuClock is
-// monotonic, this is satisfied if now is the result of a previous call to
-// Kernel.CPUClockNow().) This requirement exists because otherwise a racing
-// change to t.gosched can cause userTicksAt to adjust stats by too much,
-// making the observed stats non-monotonic.
-func (ts *TaskGoroutineSchedInfo) userTicksAt(now uint64) uint64 {
-	if ts.Timestamp < now && ts.State == TaskGoroutineRunningApp {
+// Preconditions: now was returned by gohacks.Nanotime() no earlier than ts
+// was loaded. This requirement exists because otherwise a racing change to
+// t.gosched can cause userTimeAt to adjust stats by too much, making the
+// observed stats non-monotonic.
+func (ts *TaskGoroutineSchedInfo) userTimeAt(now int64) time.Duration {
+	if ts.State == TaskGoroutineRunningApp {
 		// Update stats to reflect execution since the last update.
-		return ts.UserTicks + (now - ts.Timestamp)
+		return ts.UserTime + ts.sinceNanotime(now)
 	}
-	return ts.UserTicks
+	return ts.UserTime
 }
 
-// sysTicksAt returns the extrapolated value of ts.SysTicks after
-// Kernel.CPUClockNow() indicates a time of now.
+// sysTimeAt returns the extrapolated value of ts.SysTime at the time
+// gohacks.Nanotime() returned now.
 //
-// Preconditions: As for userTicksAt.
-func (ts *TaskGoroutineSchedInfo) sysTicksAt(now uint64) uint64 {
-	if ts.Timestamp < now && ts.State == TaskGoroutineRunningSys {
-		return ts.SysTicks + (now - ts.Timestamp)
+// Preconditions: As for userTimeAt.
+func (ts *TaskGoroutineSchedInfo) sysTimeAt(now int64) time.Duration {
+	if ts.State == TaskGoroutineRunningSys {
+		return ts.SysTime + ts.sinceNanotime(now)
 	}
-	return ts.SysTicks
+	return ts.SysTime
 }
 
 // Preconditions: The caller must be running on the task goroutine.
 func (t *Task) accountTaskGoroutineEnter(state TaskGoroutineState) {
 	now := t.k.CPUClockNow()
+	nanotime := gohacks.Nanotime()
 	if t.gosched.State != TaskGoroutineRunningSys {
 		panic(fmt.Sprintf("Task goroutine switching from state %v (expected %v) to %v", t.gosched.State, TaskGoroutineRunningSys, state))
 	}
 	t.goschedSeq.BeginWrite()
 	// This function is very hot; avoid defer.
-	t.gosched.SysTicks += now - t.gosched.Timestamp
+	t.gosched.SysTime += t.gosched.sinceNanotime(nanotime)
 	t.gosched.Timestamp = now
+	t.gosched.Nanotime = nanotime
 	t.gosched.State = state
 	t.goschedSeq.EndWrite()
 
@@ -143,15 +161,17 @@ func (t *Task) accountTaskGoroutineLeave(state TaskGoroutineState) {
 	}
 
 	now := t.k.CPUClockNow()
+	nanotime := gohacks.Nanotime()
 	if t.gosched.State != state {
 		panic(fmt.Sprintf("Task goroutine switching from state %v (expected %v) to %v", t.gosched.State, state, TaskGoroutineRunningSys))
 	}
 	t.goschedSeq.BeginWrite()
 	// This function is very hot; avoid defer.
 	if state == TaskGoroutineRunningApp {
-		t.gosched.UserTicks += now - t.gosched.Timestamp
+		t.gosched.UserTime += t.gosched.sinceNanotime(nanotime)
 	}
 	t.gosched.Timestamp = now
+	t.gosched.Nanotime = nanotime
 	t.gosched.State = TaskGoroutineRunningSys
 	t.goschedSeq.EndWrite()
 }
@@ -159,12 +179,14 @@ func (t *Task) accountTaskGoroutineLeave(state TaskGoroutineState) {
 // Preconditions: The caller must be running on the task goroutine.
 func (t *Task) accountTaskGoroutineRunning() {
 	now := t.k.CPUClockNow()
+	nanotime := gohacks.Nanotime()
 	if t.gosched.State != TaskGoroutineRunningSys {
 		panic(fmt.Sprintf("Task goroutine in state %v (expected %v)", t.gosched.State, TaskGoroutineRunningSys))
 	}
 	t.goschedSeq.BeginWrite()
-	t.gosched.SysTicks += now - t.gosched.Timestamp
+	t.gosched.SysTime += t.gosched.sinceNanotime(nanotime)
 	t.gosched.Timestamp = now
+	t.gosched.Nanotime = nanotime
 	t.goschedSeq.EndWrite()
 }
 
@@ -176,15 +198,11 @@ func (t *Task) TaskGoroutineSchedInfo() TaskGoroutineSchedInfo {
 
 // CPUStats returns the CPU usage statistics of t.
 func (t *Task) CPUStats() usage.CPUStats {
-	return t.cpuStatsAt(t.k.CPUClockNow())
-}
-
-// Preconditions: As for TaskGoroutineSchedInfo.userTicksAt.
-func (t *Task) cpuStatsAt(now uint64) usage.CPUStats {
 	tsched := t.TaskGoroutineSchedInfo()
+	now := gohacks.Nanotime()
 	return usage.CPUStats{
-		UserTime:          time.Duration(tsched.userTicksAt(now) * uint64(linux.ClockTick)),
-		SysTime:           time.Duration(tsched.sysTicksAt(now) * uint64(linux.ClockTick)),
+		UserTime:          tsched.userTimeAt(now),
+		SysTime:           tsched.sysTimeAt(now),
 		VoluntarySwitches: t.yieldCount.Load(),
 	}
 }
@@ -194,22 +212,15 @@ func (t *Task) cpuStatsAt(now uint64) usage.CPUStats {
 func (tg *ThreadGroup) CPUStats() usage.CPUStats {
 	tg.pidns.owner.mu.RLock()
 	defer tg.pidns.owner.mu.RUnlock()
-	// Hack to get a pointer to the Kernel.
-	if tg.leader == nil {
-		// Per comment on tg.leader, this is only possible if nothing in the
-		// ThreadGroup has ever executed anyway.
-		return usage.CPUStats{}
-	}
-	return tg.cpuStatsAtLocked(tg.leader.k.CPUClockNow())
+	return tg.cpuStatsLocked()
 }
 
-// Preconditions: Same as TaskGoroutineSchedInfo.userTicksAt, plus:
-//   - The TaskSet mutex must be locked.
-func (tg *ThreadGroup) cpuStatsAtLocked(now uint64) usage.CPUStats {
+// Preconditions: The TaskSet mutex must be locked.
+func (tg *ThreadGroup) cpuStatsLocked() usage.CPUStats {
 	stats := tg.exitedCPUStats
 	// Account for live tasks.
 	for t := tg.tasks.Front(); t != nil; t = t.Next() {
-		stats.Accumulate(t.cpuStatsAt(now))
+		stats.Accumulate(t.CPUStats())
 	}
 	return stats
 }
@@ -317,8 +328,8 @@ func (tgc *tgClock) WallTimeUntil(t, now ktime.Time) time.Duration {
 	// This is a lower bound on the amount of time that can elapse before an
 	// associated timer expires, so returning this value tends to result in a
 	// sequence of closely-spaced ticks just before timer expiry. To avoid
-	// this, round up to the nearest ClockTick; CPU usage measurements are
-	// limited to this resolution anyway.
+	// this, round up to the nearest ClockTick; as in Linux, where CPU timers
+	// are checked on scheduler ticks, this is the resolution of CPU timers.
 	remaining := time.Duration(t.Sub(now).Nanoseconds()/int64(n)) * time.Nanosecond
 	return ((remaining + (linux.ClockTick - time.Nanosecond)) / linux.ClockTick) * linux.ClockTick
 }
@@ -346,7 +357,9 @@ func (k *Kernel) runCPUClockTicker() {
 			if k.runningTasks.Load() == 0 {
 				k.cpuClockTickerRunning = false
 				k.cpuClockTickerStopCond.Broadcast()
+				k.pressureIdle()
 				k.runningTasksCond.Wait()
+				k.pressureResume()
 				// k.cpuClockTickerRunning was set to true by our waker
 				// (Kernel.incRunningTasks()). For reasons described there, we must
 				// process at least one CPU clock tick between calls to
@@ -366,7 +379,7 @@ func (k *Kernel) runCPUClockTicker() {
 		// Advance the CPU clock, and timers based on the CPU clock, atomically
 		// under cpuClockMu.
 		k.cpuClockMu.Lock()
-		now := k.cpuClock.Add(1)
+		k.cpuClock.Add(1)
 
 		// Check thread group CPU timers.
 		tgs = k.tasks.Root.ThreadGroupsAppend(tgs)
@@ -391,8 +404,9 @@ func (k *Kernel) runCPUClockTicker() {
 			tgSysTime := tg.exitedCPUStats.SysTime
 			for t := tg.tasks.Front(); t != nil; t = t.Next() {
 				tsched := t.TaskGoroutineSchedInfo()
-				tgUserTime += time.Duration(tsched.userTicksAt(now) * uint64(linux.ClockTick))
-				tgSysTime += time.Duration(tsched.sysTicksAt(now) * uint64(linux.ClockTick))
+				nanotime := gohacks.Nanotime()
+				tgUserTime += tsched.userTimeAt(nanotime)
+				tgSysTime += tsched.sysTimeAt(nanotime)
 				switch tsched.State {
 				case TaskGoroutineRunningApp:
 					// Considered by ITIMER_VIRT, ITIMER_PROF, and RLIMIT_CPU
@@ -452,6 +466,9 @@ func (k *Kernel) runCPUClockTicker() {
 
 		k.cpuClockMu.Unlock()
 
+		k.samplePressure()
+		k.chargeCPUBandwidth(tgs)
+
 		// Retain tgs between calls to Notify to reduce allocations.
 		for i := range tgs {
 			tgs[i] = nil
@@ -497,7 +514,7 @@ func (t *Task) NotifyRlimitCPUUpdated() {
 	}
 	if rlimitCPU.Max != limits.Infinity {
 		// Check if tg is already over the hard limit.
-		tgcpu := t.tg.cpuStatsAtLocked(t.k.CPUClockNow())
+		tgcpu := t.tg.cpuStatsLocked()
 		tgProfNow := ktime.FromNanoseconds((tgcpu.UserTime + tgcpu.SysTime).Nanoseconds())
 		if !tgProfNow.Before(ktime.FromSeconds(int64(rlimitCPU.Max))) {
 			t.sendSignalLocked(SignalInfoPriv(linux.SIGKILL), true)
@@ -583,13 +600,11 @@ func (t *Task) SetCPUMask(mask sched.CPUSet) error {
 	// Remove CPUs in mask above Kernel.applicationCores.
 	mask.ClearAbove(t.k.applicationCores)
 
-	// Ensure that at least 1 CPU is still allowed.
-	if mask.NumCPUs() == 0 {
-		return linuxerr.EINVAL
-	}
-
 	if t.k.useHostCores {
 		// No-op; pretend the mask was immediately changed back.
+		if mask.NumCPUs() == 0 {
+			return linuxerr.EINVAL
+		}
 		return nil
 	}
 
@@ -597,6 +612,17 @@ func (t *Task) SetCPUMask(mask sched.CPUSet) error {
 	rootTID := t.tg.pidns.owner.Root.tids[t]
 	t.tg.pidns.owner.mu.RUnlock()
 
+	// Remove offline CPUs. Hold onlineCPUsMu until the mask is set, so that
+	// CPUs taken offline concurrently are also removed.
+	t.k.onlineCPUsMu.Lock()
+	defer t.k.onlineCPUsMu.Unlock()
+	mask.Intersect(t.k.onlineCPUsLocked())
+
+	// Ensure that at least 1 CPU is still allowed.
+	if mask.NumCPUs() == 0 {
+		return linuxerr.EINVAL
+	}
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.allowedCPUMask = mask
@@ -656,6 +682,14 @@ func (t *Task) NumaPolicy() (policy linux.NumaPolicy, nodeMask uint64) {
 	return t.numaPolicy, t.numaNodeMask
 }
 
+// NUMANode returns the NUMA node of the CPU that t is running on.
+func (t *Task) NUMANode() uint32 {
+	topo := t.k.CPUTopology()
+	// With host CPU numbering, CPU numbers may exceed the number of CPUs in
+	// the topology.
+	return uint32(topo.NodeID(uint(t.CPU()) % topo.NumCPUs()))
+}
+
 // SetNumaPolicy sets t's numa policy.
 func (t *Task) SetNumaPolicy(policy linux.NumaPolicy, nodeMask uint64) {
 	t.mu.Lock()
@@ -204,7 +204,11 @@ func (t *Task) deliverSignal(info *linux.SignalInfo, act linux.SigAction) taskRu
 		t.Debugf("Signal %d, PID: %d, TID: %d, fault addr: %#x: terminating thread group", ucs.Pid, ucs.Tid, ucs.FaultAddr, info.Signo)
 		eventchannel.Emit(ucs)
 
-		t.PrepareGroupExit(linux.WaitStatusTerminationSignal(sig))
+		if sigact == SignalActionCore {
+			t.prepareGroupExitForCoreDump(info)
+		} else {
+			t.PrepareGroupExit(linux.WaitStatusTerminationSignal(sig))
+		}
 		return (*runExit)(nil)
 
 	case SignalActionStop:
@@ -69,6 +69,10 @@ type TaskConfig struct {
 	// Niceness is the niceness of the new task.
 	Niceness int
 
+	// NumaPolicy and NumaNodeMask are the NUMA policy of the new task.
+	NumaPolicy   linux.NumaPolicy
+	NumaNodeMask uint64
+
 	// NetworkNamespace is the network namespace to be used for the new task.
 	NetworkNamespace *inet.Namespace
 
@@ -81,8 +85,12 @@ type TaskConfig struct {
 	// IPCNamespace is the IPCNamespace of the new task.
 	IPCNamespace *IPCNamespace
 
-	// AbstractSocketNamespace is the AbstractSocketNamespace of the new task.
-	AbstractSocketNamespace *AbstractSocketNamespace
+	// TimeNamespace is the TimeNamespace of the new task.
+	TimeNamespace *TimeNamespace
+
+	// ChildTimeNamespace is the TimeNamespace of the new task's children. If
+	// nil, it is TimeNamespace.
+	ChildTimeNamespace *TimeNamespace
 
 	// MountNamespace is the MountNamespace of the new task.
 	MountNamespace *vfs.MountNamespace
@@ -116,12 +124,18 @@ type TaskConfig struct {
 // Otherwise, NewTask releases them.
 func (ts *TaskSet) NewTask(ctx context.Context, cfg *TaskConfig) (*Task, error) {
 	var err error
+	if cfg.ChildTimeNamespace == nil {
+		cfg.TimeNamespace.IncRef()
+		cfg.ChildTimeNamespace = cfg.TimeNamespace
+	}
 	cleanup := func() {
 		cfg.TaskImage.release(ctx)
 		cfg.FSContext.DecRef(ctx)
 		cfg.FDTable.DecRef(ctx)
 		cfg.UTSNamespace.DecRef(ctx)
 		cfg.IPCNamespace.DecRef(ctx)
+		cfg.TimeNamespace.DecRef(ctx)
+		cfg.ChildTimeNamespace.DecRef(ctx)
 		cfg.NetworkNamespace.DecRef(ctx)
 		if cfg.MountNamespace != nil {
 			cfg.MountNamespace.DecRef(ctx)
@@ -152,32 +166,36 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 			parent:   cfg.Parent,
 			children: make(map[*Task]struct{}),
 		},
-		runState:        (*runApp)(nil),
-		interruptChan:   make(chan struct{}, 1),
-		signalMask:      atomicbitops.FromUint64(uint64(cfg.SignalMask)),
-		signalStack:     linux.SignalStack{Flags: linux.SS_DISABLE},
-		image:           *image,
-		fsContext:       cfg.FSContext,
-		fdTable:         cfg.FDTable,
-		k:               cfg.Kernel,
-		ptraceTracees:   make(map[*Task]struct{}),
-		allowedCPUMask:  cfg.AllowedCPUMask.Copy(),
-		ioUsage:         &usage.IO{},
-		niceness:        cfg.Niceness,
-		utsns:           cfg.UTSNamespace,
-		ipcns:           cfg.IPCNamespace,
-		abstractSockets: cfg.AbstractSocketNamespace,
-		mountNamespace:  cfg.MountNamespace,
-		rseqCPU:         -1,
-		rseqAddr:        cfg.RSeqAddr,
-		rseqSignature:   cfg.RSeqSignature,
-		futexWaiter:     futex.NewWaiter(),
-		containerID:     cfg.ContainerID,
-		cgroups:         make(map[Cgroup]struct{}),
-		userCounters:    cfg.UserCounters,
-		sessionKeyring:  cfg.SessionKeyring,
+		runState:       (*runApp)(nil),
+		interruptChan:  make(chan struct{}, 1),
+		signalMask:     atomicbitops.FromUint64(uint64(cfg.SignalMask)),
+		signalStack:    linux.SignalStack{Flags: linux.SS_DISABLE},
+		image:          *image,
+		fsContext:      cfg.FSContext,
+		fdTable:        cfg.FDTable,
+		k:              cfg.Kernel,
+		ptraceTracees:  make(map[*Task]struct{}),
+		allowedCPUMask: cfg.AllowedCPUMask.Copy(),
+		ioUsage:        &usage.IO{},
+		niceness:       cfg.Niceness,
+		numaPolicy:     cfg.NumaPolicy,
+		numaNodeMask:   cfg.NumaNodeMask,
+		utsns:          cfg.UTSNamespace,
+		ipcns:          cfg.IPCNamespace,
+		timens:         cfg.TimeNamespace,
+		childTimens:    cfg.ChildTimeNamespace,
+		mountNamespace: cfg.MountNamespace,
+		rseqCPU:        -1,
+		rseqAddr:       cfg.RSeqAddr,
+		rseqSignature:  cfg.RSeqSignature,
+		futexWaiter:    futex.NewWaiter(),
+		containerID:    cfg.ContainerID,
+		cgroups:        make(map[Cgroup]struct{}),
+		userCounters:   cfg.UserCounters,
+		sessionKeyring: cfg.SessionKeyring,
 	}
 	t.netns = cfg.NetworkNamespace
+	t.containerCPUBandwidth = cfg.Kernel.containerCPULimitsFor(cfg.ContainerID).bandwidth
 	t.creds.Store(cfg.Credentials)
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.ptraceTracer.Store((*Task)(nil))
@@ -286,6 +304,9 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 
 	t.startTime = t.k.RealtimeClock().Now()
 
+	// The time namespace's offsets are frozen once a task is in it.
+	t.timens.enter()
+
 	// As a final step, initialize the platform context. This may require
 	// other pieces to be initialized as the task is used the context.
 	t.p = cfg.Kernel.Platform.NewContext(t.AsyncContext())
@@ -298,6 +319,10 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 //
 // Preconditions: ts.mu must be locked for writing.
 func (ts *TaskSet) assignTIDsLocked(t *Task) error {
+	// Compare kernel/fork.c:copy_process().
+	if len(ts.Root.tids) >= ts.threadsMax {
+		return linuxerr.EAGAIN
+	}
 	type allocatedTID struct {
 		ns  *PIDNamespace
 		tid ThreadID
@@ -338,10 +363,11 @@ func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
 		return 0, linuxerr.ENOMEM
 	}
 	tid := ns.last
-	for {
+	// Try each ThreadID below pidMax at most once.
+	for i := ThreadID(0); i < ns.pidMax; i++ {
 		// Next.
 		tid++
-		if tid > TasksLimit {
+		if tid >= ns.pidMax {
 			tid = initTID + 1
 		}
 
@@ -363,13 +389,9 @@ func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
 			ns.last = tid
 			return tid, nil
 		}
-
-		// Did we do a full cycle?
-		if tid == ns.last {
-			// No tid available.
-			return 0, linuxerr.EAGAIN
-		}
 	}
+	// No tid available.
+	return 0, linuxerr.EAGAIN
 }
 
 // Start starts the task goroutine. Start must be called exactly once for each
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 	"runtime/trace"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -33,6 +34,12 @@ import (
 	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
 )
 
+// syscallLatency records the duration of syscall implementations, including
+// time spent blocked. It is only recorded when hot path timers are enabled.
+var syscallLatency = metric.MustCreateNewTimerMetric("/syscalls/latency",
+	metric.NewDurationBucketer(20, time.Microsecond, 10*time.Second),
+	"Duration of syscall implementations, including time spent blocked.")
+
 // SyscallRestartBlock represents the restart block for a syscall restartable
 // with a custom function. It encapsulates the state required to restart a
 // syscall across a S/R.
@@ -80,6 +87,14 @@ func (t *Task) invokeExternal() {
 	}()
 }
 
+// syscallOverride returns the override of sysno for t's container, if any.
+func (t *Task) syscallOverride(s *SyscallTable, fe uint32, sysno uintptr) *SyscallOverride {
+	if !bits.IsOn32(fe, SyscallOverrideEnable) {
+		return nil
+	}
+	return s.lookupOverride(t.ContainerID(), sysno)
+}
+
 func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval uintptr, ctrl *SyscallControl, err error) {
 	s := t.SyscallTable()
 
@@ -137,13 +152,17 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		if trace.IsEnabled() {
 			region = trace.StartRegion(t.traceContext, s.LookupName(sysno))
 		}
-		if fn != nil {
+		latency := syscallLatency.StartHotPath()
+		if o := t.syscallOverride(s, fe, sysno); o != nil {
+			rval, ctrl, err = o.Fn(t, sysno, args, fn)
+		} else if fn != nil {
 			// Call our syscall implementation.
 			rval, ctrl, err = fn(t, sysno, args)
 		} else {
 			// Use the missing function if not found.
 			rval, err = t.SyscallTable().Missing(t, sysno, args)
 		}
+		latency.Finish()
 		if region != nil {
 			region.End()
 		}
@@ -205,6 +224,15 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 	return
 }
 
+// LastSyscall returns the syscall number, and the application instruction and
+// stack pointers, at t's most recent syscall entry.
+//
+// LastSyscall may be called from any goroutine. The returned values are only
+// consistent while t remains in the same syscall.
+func (t *Task) LastSyscall() (sysno uintptr, ip, sp hostarch.Addr) {
+	return uintptr(t.syscallNo.Load()), hostarch.Addr(t.syscallIP.Load()), hostarch.Addr(t.syscallSP.Load())
+}
+
 // doSyscall is the entry point for an invocation of a system call specified by
 // the current state of t's registers.
 //
@@ -225,6 +253,9 @@ func (t *Task) doSyscall() taskRunState {
 
 	sysno := t.Arch().SyscallNo()
 	args := t.Arch().SyscallArgs()
+	t.syscallNo.Store(uint64(sysno))
+	t.syscallIP.Store(uint64(t.Arch().IP()))
+	t.syscallSP.Store(uint64(t.Arch().Stack()))
 
 	// Tracers expect to see this between when the task traps into the kernel
 	// to perform a syscall and when the syscall is actually invoked.
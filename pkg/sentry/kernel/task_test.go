@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
 )
@@ -67,3 +68,58 @@ func TestTaskCPU(t *testing.T) {
 	}
 
 }
+
+func TestTaskGoroutineSchedInfoExtrapolation(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		state    TaskGoroutineState
+		now      int64
+		wantUser time.Duration
+		wantSys  time.Duration
+	}{
+		{
+			name:     "running app",
+			state:    TaskGoroutineRunningApp,
+			now:      1500,
+			wantUser: 10500,
+			wantSys:  20000,
+		},
+		{
+			name:     "running sys",
+			state:    TaskGoroutineRunningSys,
+			now:      1500,
+			wantUser: 10000,
+			wantSys:  20500,
+		},
+		{
+			name:     "blocked",
+			state:    TaskGoroutineBlockedInterruptible,
+			now:      1500,
+			wantUser: 10000,
+			wantSys:  20000,
+		},
+		{
+			// The snapshot was updated after now was read.
+			name:     "racing update",
+			state:    TaskGoroutineRunningApp,
+			now:      500,
+			wantUser: 10000,
+			wantSys:  20000,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ts := TaskGoroutineSchedInfo{
+				Nanotime: 1000,
+				State:    test.state,
+				UserTime: 10000,
+				SysTime:  20000,
+			}
+			if got := ts.userTimeAt(test.now); got != test.wantUser {
+				t.Errorf("userTimeAt(%d) = %v, want %v", test.now, got, test.wantUser)
+			}
+			if got := ts.sysTimeAt(test.now); got != test.wantSys {
+				t.Errorf("sysTimeAt(%d) = %v, want %v", test.now, got, test.wantSys)
+			}
+		})
+	}
+}
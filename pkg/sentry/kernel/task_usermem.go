@@ -186,7 +186,7 @@ func copyInIovec(ctx marshal.CopyContext, t *Task, addr hostarch.Addr) (hostarch
 		return hostarch.AddrRangeSeq{}, err
 	}
 	b := ctx.CopyScratchBuffer(iovecLength)
-	ar, err := makeIovec(ctx, t, addr, b)
+	ar, err := makeIovec(ctx, t.MemoryManager(), addr, b)
 	if err != nil {
 		return hostarch.AddrRangeSeq{}, err
 	}
@@ -216,6 +216,12 @@ func copyInIovecs(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, numIovec
 	if err := checkArch(t); err != nil {
 		return nil, err
 	}
+	return copyInIovecsFrom(ctx, t.MemoryManager(), addr, numIovecs)
+}
+
+// copyInIovecsFrom is equivalent to copyInIovecs, but checks the resulting
+// AddrRanges against m.
+func copyInIovecsFrom(ctx marshal.CopyContext, m *mm.MemoryManager, addr hostarch.Addr, numIovecs int) ([]hostarch.AddrRange, error) {
 	if numIovecs == 0 {
 		return nil, nil
 	}
@@ -231,7 +237,7 @@ func copyInIovecs(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, numIovec
 
 	b := ctx.CopyScratchBuffer(iovecLength)
 	for i := 0; i < numIovecs; i++ {
-		ar, err := makeIovec(ctx, t, addr, b)
+		ar, err := makeIovec(ctx, m, addr, b)
 		if err != nil {
 			return []hostarch.AddrRange{}, err
 		}
@@ -260,7 +266,7 @@ func checkArch(t *Task) error {
 	return nil
 }
 
-func makeIovec(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, b []byte) (hostarch.AddrRange, error) {
+func makeIovec(ctx marshal.CopyContext, m *mm.MemoryManager, addr hostarch.Addr, b []byte) (hostarch.AddrRange, error) {
 	if _, err := ctx.CopyInBytes(addr, b); err != nil {
 		return hostarch.AddrRange{}, err
 	}
@@ -270,7 +276,7 @@ func makeIovec(ctx marshal.CopyContext, t *Task, addr hostarch.Addr, b []byte) (
 	if length > math.MaxInt64 {
 		return hostarch.AddrRange{}, linuxerr.EINVAL
 	}
-	ar, ok := t.MemoryManager().CheckIORange(base, int64(length))
+	ar, ok := m.CheckIORange(base, int64(length))
 	if !ok {
 		return hostarch.AddrRange{}, linuxerr.EFAULT
 	}
@@ -324,6 +330,31 @@ func (t *Task) IovecsIOSequence(addr hostarch.Addr, iovcnt int, opts usermem.IOO
 	}, nil
 }
 
+// IovecsIOSequenceIn returns a usermem.IOSequence representing the array of
+// iovcnt struct iovecs at addr in m. opts applies to both the reading of the
+// struct iovec array and the returned IOSequence.
+//
+// Unlike Task.IovecsIOSequence, IovecsIOSequenceIn may be called from any
+// goroutine, so it can be used for I/O performed on behalf of a task by other
+// goroutines.
+//
+// Preconditions: The caller must hold a user reference on m (see
+// mm.MemoryManager.IncUsers).
+func IovecsIOSequenceIn(ctx context.Context, m *mm.MemoryManager, addr hostarch.Addr, iovcnt int, opts usermem.IOOpts) (usermem.IOSequence, error) {
+	if iovcnt < 0 || iovcnt > linux.UIO_MAXIOV {
+		return usermem.IOSequence{}, linuxerr.EINVAL
+	}
+	ars, err := copyInIovecsFrom(&usermem.IOCopyContext{Ctx: ctx, IO: m, Opts: opts}, m, addr, iovcnt)
+	if err != nil {
+		return usermem.IOSequence{}, err
+	}
+	return usermem.IOSequence{
+		IO:    m,
+		Addrs: hostarch.AddrRangeSeqFromSlice(ars),
+		Opts:  opts,
+	}, nil
+}
+
 type taskCopyContext struct {
 	ctx  context.Context
 	t    *Task
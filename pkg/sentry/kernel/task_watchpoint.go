@@ -0,0 +1,159 @@
+// Copyright 2026 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+)
+
+// Hardware breakpoints and watchpoints set by a tracer in the task's debug
+// registers are emulated, since platforms don't load the debug registers of
+// the application. While any are enabled, the task runs one instruction at a
+// time:
+//
+//   - Before executing an instruction, the task stops if a breakpoint is set
+//     at its address.
+//
+//   - After executing an instruction, the task stops if it changed the
+//     contents of a write watchpoint. As on x86, writes that don't change the
+//     watched bytes are missed, as are writes by system calls.
+
+// int3 is the x86 breakpoint instruction.
+const int3 = 0xcc
+
+// watchpointStep is the state of the emulation of watchpoints across the
+// execution of a single instruction.
+type watchpointStep struct {
+	// wps are the enabled watchpoints.
+	wps []arch.Watchpoint
+
+	// values are the contents of write watchpoints before the instruction, or
+	// nil if they couldn't be read.
+	values [][]byte
+
+	// ip is the address of the instruction.
+	ip hostarch.Addr
+
+	// breakpoint is true if the instruction is int3.
+	breakpoint bool
+
+	// forced is true if single-stepping was enabled to emulate watchpoints,
+	// rather than by the tracer.
+	forced bool
+}
+
+// startWatchpointStep prepares t to execute a single instruction while
+// watchpoints are enabled. It returns nil if no watchpoint is enabled. If t
+// is about to execute a breakpoint, startWatchpointStep stops t and returns
+// ok false.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) startWatchpointStep() (ws *watchpointStep, ok bool) {
+	wps := t.Arch().Watchpoints()
+	if len(wps) == 0 {
+		t.breakpointResume = false
+		return nil, true
+	}
+	ip := hostarch.Addr(t.Arch().IP())
+
+	// As with the x86 resume flag, a breakpoint doesn't stop the task again
+	// when it resumes execution at the same instruction.
+	if !t.breakpointResume || t.breakpointResumeIP != ip {
+		t.breakpointResume = false
+		var hits uint32
+		for _, wp := range wps {
+			if wp.Execute && wp.Addr == ip {
+				hits |= 1 << wp.Index
+			}
+		}
+		if hits != 0 {
+			t.breakpointResume = true
+			t.breakpointResumeIP = ip
+			t.sendWatchpointTrap(hits)
+			return nil, false
+		}
+	}
+
+	ws = &watchpointStep{
+		wps:    wps,
+		values: make([][]byte, len(wps)),
+		ip:     ip,
+	}
+	for i, wp := range wps {
+		if wp.Execute {
+			continue
+		}
+		buf := make([]byte, wp.Len)
+		if _, err := t.CopyInBytes(wp.Addr, buf); err == nil {
+			ws.values[i] = buf
+		}
+	}
+	var insn [1]byte
+	if _, err := t.CopyInBytes(ip, insn[:]); err == nil {
+		ws.breakpoint = insn[0] == int3
+	}
+	if !t.Arch().SingleStep() {
+		t.Arch().SetSingleStep()
+		ws.forced = true
+	}
+	return ws, true
+}
+
+// finish is called after t took a SIGTRAP while executing the instruction. If
+// the instruction changed the contents of a write watchpoint, finish stops t.
+// It returns false if the SIGTRAP was caused by the emulation and must not be
+// delivered to t.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (ws *watchpointStep) finish(t *Task) bool {
+	// The instruction completed.
+	t.breakpointResume = false
+
+	var hits uint32
+	for i, wp := range ws.wps {
+		if ws.values[i] == nil {
+			continue
+		}
+		buf := make([]byte, wp.Len)
+		if _, err := t.CopyInBytes(wp.Addr, buf); err == nil && !bytes.Equal(buf, ws.values[i]) {
+			hits |= 1 << wp.Index
+		}
+	}
+	if hits != 0 {
+		// The watchpoint trap replaces the single-step trap, as both are
+		// reported by the same debug exception on x86.
+		t.sendWatchpointTrap(hits)
+		return false
+	}
+	// Platforms can't tell the traps of int3 and single-stepping apart.
+	return !ws.forced || ws.breakpoint
+}
+
+// sendWatchpointTrap sends the SIGTRAP of the watchpoints whose Index bits are
+// set in hits to t.
+func (t *Task) sendWatchpointTrap(hits uint32) {
+	t.Arch().SetWatchpointsHit(hits)
+	info := &linux.SignalInfo{
+		Signo: int32(linux.SIGTRAP),
+		Code:  linux.TRAP_HWBKPT,
+	}
+	info.SetAddr(uint64(t.Arch().IP()))
+	t.forceSignal(linux.SIGTRAP, false /* unconditional */)
+	t.SendSignal(info)
+}
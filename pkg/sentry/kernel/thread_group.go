@@ -142,7 +142,10 @@ type ThreadGroup struct {
 	// exitStatus is the thread group's exit status.
 	//
 	// While exiting is false, exitStatus is protected by the signal mutex.
-	// When exiting becomes true, exitStatus becomes immutable.
+	// When exiting becomes true, exitStatus becomes immutable, except that
+	// the task that initiated a group exit with a core dump may mark it as
+	// having dumped core before it exits (see
+	// Task.prepareGroupExitForCoreDump).
 	exitStatus linux.WaitStatus
 
 	// terminationSignal is the signal that this thread group's leader will
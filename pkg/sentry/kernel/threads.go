@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -36,6 +37,19 @@ import (
 // (kernel/fork.c:MAX_THREADS).
 const TasksLimit = (1 << 16)
 
+// Limits of /proc/sys/kernel/pid_max. The default allows all thread IDs up to
+// TasksLimit. Compare Linux's include/linux/threads.h.
+const (
+	PIDMaxMin     = 301
+	PIDMaxDefault = TasksLimit + 1
+)
+
+// Limits of /proc/sys/kernel/threads-max, from Linux's kernel/fork.c.
+const (
+	ThreadsMaxMin = 20
+	ThreadsMaxMax = 1<<30 - 1
+)
+
 // ThreadID is a generic thread identifier.
 //
 // +marshal
@@ -97,15 +111,41 @@ type TaskSet struct {
 	// aioGoroutines is not saved but is required to be zero at the time of
 	// save.
 	aioGoroutines sync.WaitGroup `state:"nosave"`
+
+	// threadsMax is the maximum number of tasks in the TaskSet, set by
+	// /proc/sys/kernel/threads-max. threadsMax is protected by mu.
+	threadsMax int
 }
 
 // newTaskSet returns a new, empty TaskSet.
 func newTaskSet(pidns *PIDNamespace) *TaskSet {
-	ts := &TaskSet{Root: pidns}
+	ts := &TaskSet{
+		Root:       pidns,
+		threadsMax: TasksLimit,
+	}
 	pidns.owner = ts
 	return ts
 }
 
+// ThreadsMax returns the maximum number of tasks in ts.
+func (ts *TaskSet) ThreadsMax() int {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.threadsMax
+}
+
+// SetThreadsMax sets the maximum number of tasks in ts. It does not affect
+// existing tasks.
+func (ts *TaskSet) SetThreadsMax(threadsMax int) error {
+	if threadsMax < ThreadsMaxMin || threadsMax > ThreadsMaxMax {
+		return linuxerr.EINVAL
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.threadsMax = threadsMax
+	return nil
+}
+
 // forEachThreadGroupLocked applies f to each thread group in ts.
 //
 // Preconditions: ts.mu must be locked (for reading or writing).
@@ -157,6 +197,11 @@ type PIDNamespace struct {
 	// last is the last ThreadID to be allocated in this namespace.
 	last ThreadID
 
+	// pidMax is the upper bound (exclusive) of ThreadIDs allocated in this
+	// namespace, set by /proc/sys/kernel/pid_max. As in Linux, it is
+	// inherited from the parent namespace when the namespace is created.
+	pidMax ThreadID
+
 	// tasks is a mapping from ThreadIDs in this namespace to tasks visible in
 	// the namespace.
 	tasks map[ThreadID]*Task
@@ -197,11 +242,16 @@ type PIDNamespace struct {
 }
 
 func newPIDNamespace(ts *TaskSet, parent *PIDNamespace, userns *auth.UserNamespace) *PIDNamespace {
+	pidMax := ThreadID(PIDMaxDefault)
+	if parent != nil {
+		pidMax = parent.PIDMax()
+	}
 	return &PIDNamespace{
 		owner:         ts,
 		parent:        parent,
 		userns:        userns,
 		id:            lastPIDNSID.Add(1),
+		pidMax:        pidMax,
 		tasks:         make(map[ThreadID]*Task),
 		tids:          make(map[*Task]ThreadID),
 		tgids:         make(map[*ThreadGroup]ThreadID),
@@ -232,6 +282,29 @@ func (ns *PIDNamespace) NewChild(userns *auth.UserNamespace) *PIDNamespace {
 	return newPIDNamespace(ns.owner, ns, userns)
 }
 
+// PIDMax returns the upper bound (exclusive) of thread IDs allocated in ns.
+func (ns *PIDNamespace) PIDMax() ThreadID {
+	if ns.owner == nil {
+		// The root PID namespace before the TaskSet is created.
+		return ns.pidMax
+	}
+	ns.owner.mu.RLock()
+	defer ns.owner.mu.RUnlock()
+	return ns.pidMax
+}
+
+// SetPIDMax sets the upper bound (exclusive) of thread IDs allocated in ns.
+// It does not affect existing thread IDs.
+func (ns *PIDNamespace) SetPIDMax(pidMax ThreadID) error {
+	if pidMax < PIDMaxMin || pidMax > PIDMaxDefault {
+		return linuxerr.EINVAL
+	}
+	ns.owner.mu.Lock()
+	defer ns.owner.mu.Unlock()
+	ns.pidMax = pidMax
+	return nil
+}
+
 // TaskWithID returns the task with thread ID tid in PID namespace ns. If no
 // task has that TID, TaskWithID returns nil.
 func (ns *PIDNamespace) TaskWithID(tid ThreadID) *Task {
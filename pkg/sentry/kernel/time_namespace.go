@@ -0,0 +1,254 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/nsfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// TimeNamespace represents a time namespace, which offsets the
+// CLOCK_MONOTONIC and CLOCK_BOOTTIME clocks observed by the tasks in it.
+//
+// As in Linux, a task's time namespace only changes when it execs (after
+// unshare(CLONE_NEWTIME)), forks, or calls setns(2). Until then, new time
+// namespaces are only used by the task's children, and their offsets can be
+// set via /proc/[pid]/timens_offsets.
+//
+// +stateify savable
+type TimeNamespace struct {
+	// mu protects all fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// monotonicOffset and boottimeOffset are added to CLOCK_MONOTONIC and
+	// CLOCK_BOOTTIME respectively.
+	monotonicOffset time.Duration
+	boottimeOffset  time.Duration
+
+	// entered is set once a task has entered the namespace, after which its
+	// offsets can no longer be changed.
+	entered bool
+
+	// userns is the user namespace associated with the TimeNamespace.
+	// Changing offsets requires CAP_SYS_TIME in userns.
+	//
+	// userns is immutable.
+	userns *auth.UserNamespace
+
+	inode *nsfs.Inode
+}
+
+// NewTimeNamespace creates a new time namespace with no offsets.
+func NewTimeNamespace(userns *auth.UserNamespace) *TimeNamespace {
+	return &TimeNamespace{
+		userns: userns,
+	}
+}
+
+// TimeNamespace returns the task's time namespace.
+func (t *Task) TimeNamespace() *TimeNamespace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timens
+}
+
+// GetTimeNamespace takes a reference on the task time namespace and returns
+// it. It will return nil if the task isn't alive.
+func (t *Task) GetTimeNamespace() *TimeNamespace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timens != nil {
+		t.timens.IncRef()
+	}
+	return t.timens
+}
+
+// GetChildTimeNamespace takes a reference on the time namespace of the task's
+// future children and returns it. It will return nil if the task isn't alive.
+func (t *Task) GetChildTimeNamespace() *TimeNamespace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.childTimens != nil {
+		t.childTimens.IncRef()
+	}
+	return t.childTimens
+}
+
+// ChildTimeNamespaceIsRoot returns true if the task's future children, and the
+// task itself after its next execve, are in the root time namespace.
+func (t *Task) ChildTimeNamespaceIsRoot() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.childTimens == t.k.rootTimeNamespace
+}
+
+// MonotonicClock returns the CLOCK_MONOTONIC clock in t's time namespace.
+func (t *Task) MonotonicClock() ktime.Clock {
+	monotonic, _ := t.TimeNamespace().Offsets()
+	return t.k.offsetMonotonicClock(monotonic)
+}
+
+// BoottimeClock returns the CLOCK_BOOTTIME clock in t's time namespace.
+func (t *Task) BoottimeClock() ktime.Clock {
+	_, boottime := t.TimeNamespace().Offsets()
+	return t.k.offsetMonotonicClock(boottime)
+}
+
+// setVDSOClockOffsets maps the VDSO parameter page for timens into m, which
+// was set up for another time namespace. See loader.LoadArgs.ClockOffsets.
+func (k *Kernel) setVDSOClockOffsets(ctx context.Context, m *mm.MemoryManager, timens *TimeNamespace) error {
+	if k.vdso == nil || m == nil {
+		return nil
+	}
+	return k.vdso.SetClockOffsets(ctx, m, timens != k.rootTimeNamespace)
+}
+
+// offsetMonotonicClock returns the kernel's monotonic clock, offset by offset.
+func (k *Kernel) offsetMonotonicClock(offset time.Duration) ktime.Clock {
+	if offset == 0 {
+		// Return the kernel clock itself, so that callers can keep comparing
+		// against Kernel.MonotonicClock.
+		return k.MonotonicClock()
+	}
+	return &timeNamespaceClock{
+		Clock:  k.MonotonicClock(),
+		offset: offset,
+	}
+}
+
+// timeNamespaceClock is a ktime.Clock that reads time from another clock,
+// offset by a time namespace offset.
+//
+// +stateify savable
+type timeNamespaceClock struct {
+	ktime.Clock
+
+	offset time.Duration
+}
+
+// Now implements ktime.Clock.Now.
+func (c *timeNamespaceClock) Now() ktime.Time {
+	return c.Clock.Now().Add(c.offset)
+}
+
+// Offsets returns the CLOCK_MONOTONIC and CLOCK_BOOTTIME offsets of this time
+// namespace.
+func (ns *TimeNamespace) Offsets() (monotonic, boottime time.Duration) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.monotonicOffset, ns.boottimeOffset
+}
+
+// TimeNamespaceOffset is the offset of a clock in a time namespace.
+type TimeNamespaceOffset struct {
+	// ClockID is CLOCK_MONOTONIC or CLOCK_BOOTTIME.
+	ClockID int32
+
+	// Offset is added to the clock.
+	Offset time.Duration
+}
+
+// SetOffsets atomically sets the given clock offsets. It fails with EACCES if
+// a task has already entered the namespace.
+func (ns *TimeNamespace) SetOffsets(offsets []TimeNamespaceOffset) error {
+	for _, o := range offsets {
+		if o.ClockID != linux.CLOCK_MONOTONIC && o.ClockID != linux.CLOCK_BOOTTIME {
+			return linuxerr.EINVAL
+		}
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.entered {
+		return linuxerr.EACCES
+	}
+	for _, o := range offsets {
+		switch o.ClockID {
+		case linux.CLOCK_MONOTONIC:
+			ns.monotonicOffset = o.Offset
+		case linux.CLOCK_BOOTTIME:
+			ns.boottimeOffset = o.Offset
+		}
+	}
+	return nil
+}
+
+// enter marks the namespace as entered, freezing its offsets.
+func (ns *TimeNamespace) enter() {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.entered = true
+}
+
+// UserNamespace returns the user namespace associated with this time
+// namespace.
+func (ns *TimeNamespace) UserNamespace() *auth.UserNamespace {
+	return ns.userns
+}
+
+// Type implements nsfs.Namespace.Type.
+func (ns *TimeNamespace) Type() string {
+	return "time"
+}
+
+// Destroy implements nsfs.Namespace.Destroy.
+func (ns *TimeNamespace) Destroy(ctx context.Context) {}
+
+// SetInode sets the nsfs `inode` to the time namespace.
+func (ns *TimeNamespace) SetInode(inode *nsfs.Inode) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.inode = inode
+}
+
+// GetInode returns the nsfs inode associated with the time namespace.
+func (ns *TimeNamespace) GetInode() *nsfs.Inode {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.inode
+}
+
+// IncRef increments the Namespace's refcount.
+func (ns *TimeNamespace) IncRef() {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.inode.IncRef()
+}
+
+// DecRef decrements the namespace's refcount.
+func (ns *TimeNamespace) DecRef(ctx context.Context) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.inode.DecRef(ctx)
+}
+
+// Clone makes a copy of this time namespace, with the same offsets,
+// associating the given user namespace.
+func (ns *TimeNamespace) Clone(userns *auth.UserNamespace) *TimeNamespace {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return &TimeNamespace{
+		monotonicOffset: ns.monotonicOffset,
+		boottimeOffset:  ns.boottimeOffset,
+		userns:          userns,
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"time"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/log"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
@@ -46,6 +47,14 @@ type Timekeeper struct {
 	// monotonicClock is a ktime.Clock based on timekeeper's Monotonic.
 	monotonicClock *timekeeperClock
 
+	// taiClock is a ktime.Clock for CLOCK_TAI.
+	taiClock *taiClock
+
+	// ntp is the clock synchronization state reported to applications.
+	//
+	// It is set only once, by SetNTPState, before the Timekeeper is used.
+	ntp NTPState
+
 	// bootTime is the realtime when the system "booted". i.e., when
 	// SetClocks was called in the initial (not restored) run.
 	bootTime ktime.Time
@@ -100,9 +109,17 @@ type Timekeeper struct {
 func NewTimekeeper(mfp pgalloc.MemoryFileProvider, paramPage memmap.FileRange) *Timekeeper {
 	t := Timekeeper{
 		params: NewVDSOParamPage(mfp, paramPage),
+		// As in Linux, the clock is unsynchronized and CLOCK_TAI is equal
+		// to CLOCK_REALTIME until told otherwise.
+		ntp: NTPState{
+			Status:   linux.STA_UNSYNC,
+			MaxError: ntpPhaseLimit,
+			EstError: ntpPhaseLimit,
+		},
 	}
 	t.realtimeClock = &timekeeperClock{tk: &t, c: sentrytime.Realtime}
 	t.monotonicClock = &timekeeperClock{tk: &t, c: sentrytime.Monotonic}
+	t.taiClock = &taiClock{tk: &t}
 	return &t
 }
 
@@ -128,6 +145,13 @@ func (t *Timekeeper) SetClocks(c sentrytime.Clocks) {
 		panic("SetClocks called on previously-initialized Timekeeper")
 	}
 
+	// Allow the VDSO to generate random numbers. After restore, existing
+	// vgetrandom states may be shared with other sandboxes restored from the
+	// same image, so they must be reseeded.
+	if err := t.params.IncRNGGeneration(); err != nil {
+		panic("unable to update VDSO RNG generation: " + err.Error())
+	}
+
 	t.clocks = c
 
 	// Compute the offset of the monotonic clock from the base Clocks.
@@ -327,11 +351,53 @@ func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 	return now, err
 }
 
+// ReseedVDSORNG causes every vgetrandom state to be reseeded before it is next
+// used by the VDSO. It must be called when application memory is duplicated,
+// since vgetrandom states are not wiped on fork.
+func (t *Timekeeper) ReseedVDSORNG() error {
+	return t.params.IncRNGGeneration()
+}
+
 // BootTime returns the system boot real time.
 func (t *Timekeeper) BootTime() ktime.Time {
 	return t.bootTime
 }
 
+// ntpPhaseLimit is the maximum and estimated error, in microseconds, of an
+// unsynchronized clock, from include/linux/timex.h:NTP_PHASE_LIMIT.
+const ntpPhaseLimit = 16000000
+
+// NTPState is the clock synchronization state reported by adjtimex(2).
+//
+// +stateify savable
+type NTPState struct {
+	// TAIOffset is the offset of CLOCK_TAI from CLOCK_REALTIME in seconds.
+	TAIOffset int32
+
+	// Status is the NTP status (linux.STA_*).
+	Status int32
+
+	// MaxError is the maximum error in microseconds.
+	MaxError int64
+
+	// EstError is the estimated error in microseconds.
+	EstError int64
+}
+
+// SetNTPState sets the clock synchronization state reported to applications.
+// Since CLOCK_REALTIME follows the host's, this is usually a snapshot of the
+// host's adjtimex(2) state.
+//
+// SetNTPState must be called before the Timekeeper is used.
+func (t *Timekeeper) SetNTPState(s NTPState) {
+	t.ntp = s
+}
+
+// NTPState returns the clock synchronization state reported to applications.
+func (t *Timekeeper) NTPState() NTPState {
+	return t.ntp
+}
+
 // timekeeperClock is a ktime.Clock that reads time from a
 // kernel.Timekeeper-managed clock.
 //
@@ -356,3 +422,22 @@ func (tc *timekeeperClock) Now() ktime.Time {
 	}
 	return ktime.FromNanoseconds(now)
 }
+
+// taiClock is a ktime.Clock for CLOCK_TAI, which is CLOCK_REALTIME offset by
+// the TAI offset.
+//
+// +stateify savable
+type taiClock struct {
+	tk *Timekeeper
+
+	// Implements ktime.Clock.WallTimeUntil.
+	ktime.WallRateClock `state:"nosave"`
+
+	// Implements waiter.Waitable.
+	ktime.NoClockEvents `state:"nosave"`
+}
+
+// Now implements ktime.Clock.Now.
+func (tc *taiClock) Now() ktime.Time {
+	return tc.tk.realtimeClock.Now().Add(time.Duration(tc.tk.ntp.TAIOffset) * time.Second)
+}
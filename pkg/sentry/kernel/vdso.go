@@ -21,6 +21,7 @@ import (
 	"gvisor.dev/gvisor/pkg/safemem"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
 // vdsoParams are the parameters exposed to the VDSO.
@@ -46,14 +47,16 @@ type vdsoParams struct {
 // Its memory layout looks like:
 //
 //	type page struct {
-//		// seq is a sequence counter that protects the fields below.
+//		// seq is a sequence counter that protects vdsoParams.
 //		seq uint64
 //		vdsoParams
+//		// rngGeneration is the generation of vgetrandom states.
+//		rngGeneration uint64
 //	}
 //
 // Everything in the struct is 8 bytes for easy alignment.
 //
-// It must be kept in sync with params in vdso/vdso_time.cc.
+// It must be kept in sync with params in vdso/params.h.
 //
 // +stateify savable
 type VDSOParamPage struct {
@@ -76,6 +79,16 @@ type VDSOParamPage struct {
 	// the sentry, so reusing this buffer is a good tradeoff between memory
 	// usage and the cost of allocation.
 	copyScratchBuffer []byte
+
+	// rngMu serializes updates to rngGeneration.
+	rngMu sync.Mutex `state:"nosave"`
+
+	// rngGeneration is the generation of vgetrandom states written to the
+	// page. The VDSO reseeds a state when its generation differs, and falls
+	// back to getrandom(2) while it is 0.
+	//
+	// rngGeneration is protected by rngMu.
+	rngGeneration uint64
 }
 
 // NewVDSOParamPage returns a VDSOParamPage.
@@ -122,6 +135,22 @@ func (v *VDSOParamPage) incrementSeq(paramPage safemem.Block) error {
 	return nil
 }
 
+// IncRNGGeneration increments the generation of vgetrandom states, causing
+// each state to be reseeded from getrandom(2) before it is next used.
+func (v *VDSOParamPage) IncRNGGeneration() error {
+	paramPage, err := v.access()
+	if err != nil {
+		return err
+	}
+
+	v.rngMu.Lock()
+	defer v.rngMu.Unlock()
+	v.rngGeneration++
+	// Skip the sequence counter and vdsoParams.
+	_, err = safemem.SwapUint64(paramPage.DropFirst(8+(*vdsoParams)(nil).SizeBytes()), v.rngGeneration)
+	return err
+}
+
 // Write updates the VDSO parameters.
 //
 // Write starts a write block, calls f to get the new parameters, writes
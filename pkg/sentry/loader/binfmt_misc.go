@@ -0,0 +1,426 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+const (
+	// binprmBufSize is the number of bytes at the start of an executable
+	// that are examined to determine its format, including by binfmt_misc
+	// magic entries. It is Linux's BINPRM_BUF_SIZE.
+	binprmBufSize = 256
+
+	// binfmtMiscMaxRegisterLength is the maximum length of a binfmt_misc
+	// registration string. It is Linux's MAX_REGISTER_LENGTH.
+	binfmtMiscMaxRegisterLength = 1920
+)
+
+// binfmtMiscEntry is a binary format registered with binfmt_misc. See Linux's
+// Documentation/admin-guide/binfmt-misc.rst.
+//
+// All fields except enabled are immutable after registration.
+//
+// +stateify savable
+type binfmtMiscEntry struct {
+	name string
+
+	// enabled is true if the entry can be matched. It is protected by
+	// BinfmtMisc.mu.
+	enabled bool
+
+	// extension is true if the entry matches executables by the extension
+	// of their filename (type 'E'), rather than by magic bytes in their
+	// contents (type 'M').
+	extension bool
+
+	// offset is the offset of magic in the executable, for type 'M'.
+	offset int
+
+	// magic is the magic bytes for type 'M', or the extension for type 'E'.
+	magic []byte
+
+	// mask, if not nil, is the mask applied to the executable before
+	// comparing it with magic, for type 'M'.
+	mask []byte
+
+	// interpreter is the path to the interpreter.
+	interpreter string
+
+	// preserveArgv0 ('P') passes the original argv[0] to the interpreter.
+	preserveArgv0 bool
+
+	// openBinary ('O') and credentials ('C') are accepted, but the binary is
+	// passed to the interpreter by path rather than by AT_EXECFD, and
+	// credentials are never computed from the binary, since set-user-ID
+	// executables aren't supported.
+	openBinary  bool
+	credentials bool
+
+	// fixBinary ('F') opens the interpreter at registration time, so that
+	// it is found regardless of the mount namespace and root of the
+	// executing task. interpreterFile is the opened interpreter.
+	fixBinary       bool
+	interpreterFile *vfs.FileDescription
+}
+
+// BinfmtMisc is a registry of binary formats that are executed by
+// user-specified interpreters, as configured through /proc/sys/fs/binfmt_misc.
+// It corresponds to Linux's fs/binfmt_misc.c.
+//
+// The zero value is an enabled registry with no entries.
+//
+// +stateify savable
+type BinfmtMisc struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// disabled is true if no entry can be matched.
+	disabled bool
+
+	// entries are the registered formats, most recently registered first,
+	// which is the order in which they are matched.
+	entries []*binfmtMiscEntry
+}
+
+// Enabled returns true if binfmt_misc entries can be matched.
+func (b *BinfmtMisc) Enabled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.disabled
+}
+
+// SetEnabled sets whether binfmt_misc entries can be matched.
+func (b *BinfmtMisc) SetEnabled(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.disabled = !enabled
+}
+
+// Names returns the names of all registered entries, in sorted order.
+func (b *BinfmtMisc) Names() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := make([]string, 0, len(b.entries))
+	for _, e := range b.entries {
+		names = append(names, e.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has returns true if an entry with the given name is registered.
+func (b *BinfmtMisc) Has(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.findLocked(name) >= 0
+}
+
+// Preconditions: b.mu must be locked.
+func (b *BinfmtMisc) findLocked(name string) int {
+	for i, e := range b.entries {
+		if e.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Register parses spec, a string of the form
+// ":name:type:offset:magic:mask:interpreter:flags" written to
+// /proc/sys/fs/binfmt_misc/register, and registers the described format. If
+// the 'F' flag is set, the interpreter is opened immediately, relative to root
+// and wd.
+func (b *BinfmtMisc) Register(ctx context.Context, spec string, root, wd vfs.VirtualDentry) error {
+	e, err := parseBinfmtMiscEntry(spec)
+	if err != nil {
+		return err
+	}
+	if e.fixBinary {
+		fd, err := openPath(ctx, LoadArgs{
+			Root:         root,
+			WorkingDir:   wd,
+			Filename:     e.interpreter,
+			ResolveFinal: true,
+		})
+		if err != nil {
+			return err
+		}
+		e.interpreterFile = fd
+	}
+
+	b.mu.Lock()
+	if b.findLocked(e.name) >= 0 {
+		b.mu.Unlock()
+		e.release(ctx)
+		return linuxerr.EEXIST
+	}
+	b.entries = append([]*binfmtMiscEntry{e}, b.entries...)
+	b.mu.Unlock()
+	return nil
+}
+
+// parseBinfmtMiscEntry parses a binfmt_misc registration string.
+func parseBinfmtMiscEntry(spec string) (*binfmtMiscEntry, error) {
+	if len(spec) < 11 || len(spec) > binfmtMiscMaxRegisterLength {
+		return nil, linuxerr.EINVAL
+	}
+	// The first character is the field delimiter.
+	fields := strings.Split(spec[1:], spec[:1])
+	if len(fields) != 7 {
+		return nil, linuxerr.EINVAL
+	}
+	name, typ, offset, magic, mask, interpreter, flags := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return nil, linuxerr.EINVAL
+	}
+	e := &binfmtMiscEntry{
+		name:        name,
+		enabled:     true,
+		interpreter: interpreter,
+	}
+
+	switch typ {
+	case "E":
+		// The offset and mask fields are ignored.
+		if magic == "" || strings.Contains(magic, "/") {
+			return nil, linuxerr.EINVAL
+		}
+		e.extension = true
+		e.magic = []byte(magic)
+	case "M":
+		if offset != "" {
+			off, err := strconv.ParseUint(offset, 10, 31)
+			if err != nil {
+				return nil, linuxerr.EINVAL
+			}
+			e.offset = int(off)
+		}
+		e.magic = unescapeBinfmtMisc(magic)
+		if len(e.magic) == 0 {
+			return nil, linuxerr.EINVAL
+		}
+		if mask != "" {
+			e.mask = unescapeBinfmtMisc(mask)
+			if len(e.mask) != len(e.magic) {
+				return nil, linuxerr.EINVAL
+			}
+		}
+		if len(e.magic) > binprmBufSize || binprmBufSize-len(e.magic) < e.offset {
+			return nil, linuxerr.EINVAL
+		}
+	default:
+		return nil, linuxerr.EINVAL
+	}
+
+	if e.interpreter == "" {
+		return nil, linuxerr.EINVAL
+	}
+
+	for _, f := range strings.TrimSuffix(flags, "\n") {
+		switch f {
+		case 'P':
+			e.preserveArgv0 = true
+		case 'O':
+			e.openBinary = true
+		case 'C':
+			// Credentials imply open binary.
+			e.credentials = true
+			e.openBinary = true
+		case 'F':
+			e.fixBinary = true
+		default:
+			return nil, linuxerr.EINVAL
+		}
+	}
+	return e, nil
+}
+
+// unescapeBinfmtMisc replaces "\xHH" escape sequences in s with the bytes they
+// represent, as in Linux's string_unescape_inplace(UNESCAPE_HEX).
+func unescapeBinfmtMisc(s string) []byte {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+2 < len(s) && s[i+1] == 'x' && isHexDigit(s[i+2]) {
+			j := i + 3
+			if j < len(s) && isHexDigit(s[j]) {
+				j++
+			}
+			v, _ := strconv.ParseUint(s[i+2:j], 16, 8)
+			out = append(out, byte(v))
+			i = j - 1
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return out
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// Status returns the contents of /proc/sys/fs/binfmt_misc/<name>.
+func (b *BinfmtMisc) Status(name string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := b.findLocked(name)
+	if i < 0 {
+		return "", linuxerr.ENOENT
+	}
+	e := b.entries[i]
+
+	var buf bytes.Buffer
+	if e.enabled {
+		buf.WriteString("enabled\n")
+	} else {
+		buf.WriteString("disabled\n")
+	}
+	fmt.Fprintf(&buf, "interpreter %s\n", e.interpreter)
+	buf.WriteString("flags: ")
+	if e.preserveArgv0 {
+		buf.WriteByte('P')
+	}
+	if e.openBinary {
+		buf.WriteByte('O')
+	}
+	if e.credentials {
+		buf.WriteByte('C')
+	}
+	if e.fixBinary {
+		buf.WriteByte('F')
+	}
+	buf.WriteByte('\n')
+	if e.extension {
+		fmt.Fprintf(&buf, "extension .%s\n", e.magic)
+	} else {
+		fmt.Fprintf(&buf, "offset %d\nmagic %s\n", e.offset, hex.EncodeToString(e.magic))
+		if e.mask != nil {
+			fmt.Fprintf(&buf, "mask %s\n", hex.EncodeToString(e.mask))
+		}
+	}
+	return buf.String(), nil
+}
+
+// SetEntryEnabled sets whether the named entry can be matched.
+func (b *BinfmtMisc) SetEntryEnabled(name string, enabled bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := b.findLocked(name)
+	if i < 0 {
+		return linuxerr.ENOENT
+	}
+	b.entries[i].enabled = enabled
+	return nil
+}
+
+// Remove unregisters the named entry.
+func (b *BinfmtMisc) Remove(ctx context.Context, name string) error {
+	b.mu.Lock()
+	i := b.findLocked(name)
+	if i < 0 {
+		b.mu.Unlock()
+		return linuxerr.ENOENT
+	}
+	e := b.entries[i]
+	b.entries = append(b.entries[:i], b.entries[i+1:]...)
+	b.mu.Unlock()
+
+	e.release(ctx)
+	return nil
+}
+
+// Clear unregisters all entries.
+func (b *BinfmtMisc) Clear(ctx context.Context) {
+	b.mu.Lock()
+	entries := b.entries
+	b.entries = nil
+	b.mu.Unlock()
+
+	for _, e := range entries {
+		e.release(ctx)
+	}
+}
+
+func (e *binfmtMiscEntry) release(ctx context.Context) {
+	if e.interpreterFile != nil {
+		e.interpreterFile.DecRef(ctx)
+	}
+}
+
+// match returns the first enabled entry that matches the executable at
+// filename, whose first bytes are hdr. If the entry has an interpreterFile,
+// the caller receives a reference on it.
+func (b *BinfmtMisc) match(hdr []byte, filename string) *binfmtMiscEntry {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.disabled {
+		return nil
+	}
+	for _, e := range b.entries {
+		if e.enabled && e.matches(hdr, filename) {
+			if e.interpreterFile != nil {
+				e.interpreterFile.IncRef()
+			}
+			return e
+		}
+	}
+	return nil
+}
+
+func (e *binfmtMiscEntry) matches(hdr []byte, filename string) bool {
+	if e.extension {
+		i := strings.LastIndexByte(filename, '.')
+		return i >= 0 && filename[i+1:] == string(e.magic)
+	}
+	if e.offset+len(e.magic) > len(hdr) {
+		return false
+	}
+	s := hdr[e.offset:]
+	for i, m := range e.magic {
+		c := s[i] ^ m
+		if e.mask != nil {
+			c &= e.mask[i]
+		}
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// argv returns the arguments with which the interpreter is executed for the
+// executable at filename, originally executed with argv.
+func (e *binfmtMiscEntry) argv(filename string, argv []string) []string {
+	newargv := []string{e.interpreter, filename}
+	if !e.preserveArgv0 && len(argv) > 0 {
+		argv = argv[1:]
+	}
+	return append(newargv, argv...)
+}
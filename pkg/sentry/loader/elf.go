@@ -392,14 +392,25 @@ type loadedELF struct {
 	auxv arch.Auxv
 }
 
-// loadParsedELF loads f into mm.
-//
-// info is the parsed elfInfo from the header.
-//
-// It does not load the ELF interpreter, or return any auxv entries.
+// elfLayout describes the validated PT_LOAD and PT_INTERP program headers of
+// an ELF, before it is loaded.
+type elfLayout struct {
+	// start is the vaddr of the first PT_LOAD segment.
+	start hostarch.Addr
+
+	// end is the end of the last PT_LOAD segment.
+	end hostarch.Addr
+
+	// interpreter is the path to the ELF interpreter, or empty if there is
+	// none.
+	interpreter string
+}
+
+// layoutELF validates the program headers in info, and reads the interpreter
+// path from f.
 //
 // Preconditions: f is an ELF file.
-func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescription, info elfInfo, sharedLoadOffset hostarch.Addr) (loadedELF, error) {
+func layoutELF(ctx context.Context, f fullReader, info elfInfo) (elfLayout, error) {
 	first := true
 	var start, end hostarch.Addr
 	var interpreter string
@@ -415,40 +426,40 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 				// NOTE(b/37474556): Linux allows out-of-order
 				// segments, in violation of the spec.
 				ctx.Infof("PT_LOAD headers out-of-order. %#x < %#x", vaddr, end)
-				return loadedELF{}, linuxerr.ENOEXEC
+				return elfLayout{}, linuxerr.ENOEXEC
 			}
 			var ok bool
 			end, ok = vaddr.AddLength(phdr.Memsz)
 			if !ok {
 				ctx.Infof("PT_LOAD header size overflows. %#x + %#x", vaddr, phdr.Memsz)
-				return loadedELF{}, linuxerr.ENOEXEC
+				return elfLayout{}, linuxerr.ENOEXEC
 			}
 
 		case elf.PT_INTERP:
 			if phdr.Filesz < 2 {
 				ctx.Infof("PT_INTERP path too small: %v", phdr.Filesz)
-				return loadedELF{}, linuxerr.ENOEXEC
+				return elfLayout{}, linuxerr.ENOEXEC
 			}
 			if phdr.Filesz > linux.PATH_MAX {
 				ctx.Infof("PT_INTERP path too big: %v", phdr.Filesz)
-				return loadedELF{}, linuxerr.ENOEXEC
+				return elfLayout{}, linuxerr.ENOEXEC
 			}
 			if int64(phdr.Off) < 0 || int64(phdr.Off+phdr.Filesz) < 0 {
 				ctx.Infof("Unsupported PT_INTERP offset %d", phdr.Off)
-				return loadedELF{}, linuxerr.ENOEXEC
+				return elfLayout{}, linuxerr.ENOEXEC
 			}
 
 			path := make([]byte, phdr.Filesz)
-			_, err := fd.ReadFull(ctx, usermem.BytesIOSequence(path), int64(phdr.Off))
+			_, err := f.ReadFull(ctx, usermem.BytesIOSequence(path), int64(phdr.Off))
 			if err != nil {
 				// If an interpreter was specified, it should exist.
 				ctx.Infof("Error reading PT_INTERP path: %v", err)
-				return loadedELF{}, linuxerr.ENOEXEC
+				return elfLayout{}, linuxerr.ENOEXEC
 			}
 
 			if path[len(path)-1] != 0 {
 				ctx.Infof("PT_INTERP path not NUL-terminated: %v", path)
-				return loadedELF{}, linuxerr.ENOEXEC
+				return elfLayout{}, linuxerr.ENOEXEC
 			}
 
 			// Strip NUL-terminator and everything beyond from
@@ -469,11 +480,29 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 				// the open path would return a different
 				// error.
 				ctx.Infof("PT_INTERP path is empty: %v", path)
-				return loadedELF{}, linuxerr.EACCES
+				return elfLayout{}, linuxerr.EACCES
 			}
 		}
 	}
 
+	return elfLayout{
+		start:       start,
+		end:         end,
+		interpreter: interpreter,
+	}, nil
+}
+
+// loadParsedELF loads f into mm.
+//
+// info and layout are the parsed elfInfo from the header, and its validated
+// elfLayout.
+//
+// It does not load the ELF interpreter, or return any auxv entries.
+//
+// Preconditions: f is an ELF file.
+func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescription, info elfInfo, layout elfLayout, sharedLoadOffset hostarch.Addr) (loadedELF, error) {
+	start, end := layout.start, layout.end
+
 	// Shared objects don't have fixed load addresses. We need to pick a
 	// base address big enough to fit all segments, so we first create a
 	// mapping for the total size just to find a region that is big enough.
@@ -558,7 +587,7 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 		entry:       info.entry,
 		start:       start,
 		end:         end,
-		interpreter: interpreter,
+		interpreter: layout.interpreter,
 		phdrAddr:    phdrAddr,
 		phdrSize:    info.phdrSize,
 		phdrNum:     len(info.phdrs),
@@ -571,15 +600,27 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 //
 // It does not load the ELF interpreter, or return any auxv entries.
 //
+// If cache is not nil, the parsed ELF headers are looked up in and added to
+// cache.
+//
 // Preconditions:
 //   - f is an ELF file.
 //   - f is the first ELF loaded into m.
-func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSet, fd *vfs.FileDescription) (loadedELF, *arch.Context64, error) {
-	info, err := parseHeader(ctx, fd)
-	if err != nil {
-		ctx.Infof("Failed to parse initial ELF: %v", err)
-		return loadedELF{}, nil, err
+func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSet, fd *vfs.FileDescription, cache *ELFCache) (loadedELF, *arch.Context64, error) {
+	key, e := cache.lookup(ctx, fd)
+	if e == nil {
+		info, err := parseHeader(ctx, fd)
+		if err != nil {
+			ctx.Infof("Failed to parse initial ELF: %v", err)
+			return loadedELF{}, nil, err
+		}
+		layout, err := layoutELF(ctx, fd, info)
+		if err != nil {
+			return loadedELF{}, nil, err
+		}
+		e = cache.insert(key, info, layout)
 	}
+	info := e.info
 
 	// Check Image Compatibility.
 	if arch.Host != info.arch {
@@ -600,7 +641,7 @@ func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSe
 	// PIELoadAddress tries to move the ELF out of the way of the default
 	// mmap base to ensure that the initial brk has sufficient space to
 	// grow.
-	le, err := loadParsedELF(ctx, m, fd, info, ac.PIELoadAddress(l))
+	le, err := loadParsedELF(ctx, m, fd, info, e.layout, ac.PIELoadAddress(l))
 	return le, ac, err
 }
 
@@ -610,16 +651,28 @@ func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSe
 //
 // It does not return any auxv entries.
 //
+// If cache is not nil, the parsed ELF headers are looked up in and added to
+// cache.
+//
 // Preconditions: f is an ELF file.
-func loadInterpreterELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescription, initial loadedELF) (loadedELF, error) {
-	info, err := parseHeader(ctx, fd)
-	if err != nil {
-		if linuxerr.Equals(linuxerr.ENOEXEC, err) {
-			// Bad interpreter.
-			err = linuxerr.ELIBBAD
+func loadInterpreterELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescription, initial loadedELF, cache *ELFCache) (loadedELF, error) {
+	key, e := cache.lookup(ctx, fd)
+	if e == nil {
+		info, err := parseHeader(ctx, fd)
+		if err != nil {
+			if linuxerr.Equals(linuxerr.ENOEXEC, err) {
+				// Bad interpreter.
+				err = linuxerr.ELIBBAD
+			}
+			return loadedELF{}, err
+		}
+		layout, err := layoutELF(ctx, fd, info)
+		if err != nil {
+			return loadedELF{}, err
 		}
-		return loadedELF{}, err
+		e = cache.insert(key, info, layout)
 	}
+	info := e.info
 
 	if info.os != initial.os {
 		ctx.Infof("Initial ELF OS %v and interpreter ELF OS %v differ", initial.os, info.os)
@@ -632,7 +685,7 @@ func loadInterpreterELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDe
 
 	// The interpreter is not given a load offset, as its location does not
 	// affect brk.
-	return loadParsedELF(ctx, m, fd, info, 0)
+	return loadParsedELF(ctx, m, fd, info, e.layout, 0)
 }
 
 // loadELF loads args.File into the Task address space.
@@ -642,7 +695,7 @@ func loadInterpreterELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDe
 //
 // Preconditions: args.File is an ELF file.
 func loadELF(ctx context.Context, args LoadArgs) (loadedELF, *arch.Context64, error) {
-	bin, ac, err := loadInitialELF(ctx, args.MemoryManager, args.Features, args.File)
+	bin, ac, err := loadInitialELF(ctx, args.MemoryManager, args.Features, args.File, args.ELFCache)
 	if err != nil {
 		ctx.Infof("Error loading binary: %v", err)
 		return loadedELF{}, nil, err
@@ -664,7 +717,7 @@ func loadELF(ctx context.Context, args LoadArgs) (loadedELF, *arch.Context64, er
 		}
 		defer intFile.DecRef(ctx)
 
-		interp, err = loadInterpreterELF(ctx, args.MemoryManager, intFile, bin)
+		interp, err = loadInterpreterELF(ctx, args.MemoryManager, intFile, bin, args.ELFCache)
 		if err != nil {
 			ctx.Infof("Error loading interpreter: %v", err)
 			return loadedELF{}, nil, err
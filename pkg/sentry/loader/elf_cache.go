@@ -0,0 +1,166 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// maxELFCacheEntries is the maximum number of ELFs in an ELFCache.
+const maxELFCacheEntries = 256
+
+// elfCacheStatMask is the set of fields that identify a cached ELF file and
+// detect changes to its contents.
+const elfCacheStatMask = linux.STATX_INO | linux.STATX_SIZE | linux.STATX_MTIME | linux.STATX_CTIME
+
+var (
+	elfCacheHits   = metric.MustCreateNewUint64Metric("/exec/elf_cache_hits", false /* sync */, "Number of execs that found the headers of an ELF in the ELF cache.")
+	elfCacheMisses = metric.MustCreateNewUint64Metric("/exec/elf_cache_misses", false /* sync */, "Number of execs that had to parse the headers of a cacheable ELF.")
+)
+
+// ELFCache caches the parsed and validated headers of ELF executables and
+// interpreters, so that repeatedly executing the same binaries (e.g. from a
+// shell script) doesn't need to read and validate them each time.
+//
+// Entries are keyed by file identity, and are only used if the file's size,
+// modification and change times are unchanged since it was parsed.
+//
+// The zero value of ELFCache is an empty cache.
+type ELFCache struct {
+	mu sync.Mutex
+
+	// entries maps file identities to their cached headers. It is protected
+	// by mu.
+	entries map[elfCacheKey]*elfCacheEntry
+
+	// clock is incremented on each lookup, and used to find the least
+	// recently used entry. It is protected by mu.
+	clock uint64
+}
+
+// elfCacheKey identifies a file in an ELFCache.
+type elfCacheKey struct {
+	devMajor uint32
+	devMinor uint32
+	ino      uint64
+}
+
+// elfCacheEntry is an immutable cached ELF, except for lastUsed.
+type elfCacheEntry struct {
+	// size, mtime and ctime are the file attributes when info and layout
+	// were read.
+	size  uint64
+	mtime linux.StatxTimestamp
+	ctime linux.StatxTimestamp
+
+	info   elfInfo
+	layout elfLayout
+
+	// lastUsed is the ELFCache.clock at the last lookup of this entry. It
+	// is protected by ELFCache.mu.
+	lastUsed uint64
+}
+
+// elfCacheLookupKey is returned by ELFCache.lookup, and identifies where the
+// ELF should be inserted if it wasn't found.
+type elfCacheLookupKey struct {
+	key elfCacheKey
+	// entry holds the validators for the file, or is nil if the file can't
+	// be cached.
+	entry *elfCacheEntry
+}
+
+// lookup returns the cached entry for fd, or nil if there is none. c may be
+// nil.
+func (c *ELFCache) lookup(ctx context.Context, fd *vfs.FileDescription) (elfCacheLookupKey, *elfCacheEntry) {
+	if c == nil {
+		return elfCacheLookupKey{}, nil
+	}
+	stat, err := fd.Stat(ctx, vfs.StatOptions{Mask: elfCacheStatMask})
+	if err != nil || stat.Mask&elfCacheStatMask != elfCacheStatMask {
+		// Without a stable identity, the file can't be cached.
+		return elfCacheLookupKey{}, nil
+	}
+	key := elfCacheLookupKey{
+		key: elfCacheKey{
+			devMajor: stat.DevMajor,
+			devMinor: stat.DevMinor,
+			ino:      stat.Ino,
+		},
+		entry: &elfCacheEntry{
+			size:  stat.Size,
+			mtime: stat.Mtime,
+			ctime: stat.Ctime,
+		},
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock++
+	e, ok := c.entries[key.key]
+	if !ok || e.size != stat.Size || e.mtime != stat.Mtime || e.ctime != stat.Ctime {
+		elfCacheMisses.Increment()
+		return key, nil
+	}
+	e.lastUsed = c.clock
+	elfCacheHits.Increment()
+	return key, e
+}
+
+// insert returns an entry containing info and layout, and adds it to the
+// cache if key was returned by a lookup of a cacheable file. c may be nil.
+func (c *ELFCache) insert(key elfCacheLookupKey, info elfInfo, layout elfLayout) *elfCacheEntry {
+	e := key.entry
+	if c == nil || e == nil {
+		return &elfCacheEntry{
+			info:   info,
+			layout: layout,
+		}
+	}
+	e.info = info
+	e.layout = layout
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[elfCacheKey]*elfCacheEntry)
+	}
+	if _, ok := c.entries[key.key]; !ok && len(c.entries) >= maxELFCacheEntries {
+		c.evictLocked()
+	}
+	e.lastUsed = c.clock
+	c.entries[key.key] = e
+	return e
+}
+
+// evictLocked removes the least recently used entry.
+//
+// Preconditions: c.mu must be locked.
+func (c *ELFCache) evictLocked() {
+	var (
+		oldestKey elfCacheKey
+		oldest    *elfCacheEntry
+	)
+	for k, e := range c.entries {
+		if oldest == nil || e.lastUsed < oldest.lastUsed {
+			oldestKey, oldest = k, e
+		}
+	}
+	delete(c.entries, oldestKey)
+}
@@ -24,21 +24,15 @@ import (
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
-const (
-	// interpreterScriptMagic identifies an interpreter script.
-	interpreterScriptMagic = "#!"
-
-	// interpMaxLineLength is the maximum length for the first line of an
-	// interpreter script.
-	//
-	// From execve(2): "A maximum line length of 127 characters is allowed
-	// for the first line in a #! executable shell script."
-	interpMaxLineLength = 127
-)
+// interpreterScriptMagic identifies an interpreter script.
+const interpreterScriptMagic = "#!"
 
 // parseInterpreterScript returns the interpreter path and argv.
+//
+// As in Linux (since 5.1), the first binprmBufSize bytes of the script are
+// examined, so the first line may be up to binprmBufSize-1 bytes long.
 func parseInterpreterScript(ctx context.Context, filename string, fd *vfs.FileDescription, argv []string) (newpath string, newargv []string, err error) {
-	line := make([]byte, interpMaxLineLength)
+	line := make([]byte, binprmBufSize)
 	n, err := fd.ReadFull(ctx, usermem.BytesIOSequence(line), 0)
 	// Short read is OK.
 	if err != nil && err != io.ErrUnexpectedEOF {
@@ -56,15 +50,28 @@ func parseInterpreterScript(ctx context.Context, filename string, fd *vfs.FileDe
 	line = line[2:]
 
 	// Ignore everything after newline.
-	// Linux silently truncates the remainder of the line if it exceeds
-	// interpMaxLineLength.
 	i := bytes.IndexByte(line, '\n')
 	if i >= 0 {
 		line = line[:i]
+	} else if n == binprmBufSize {
+		// The line doesn't fit in the buffer. As in Linux, the interpreter
+		// argument is silently truncated, but the script is rejected if the
+		// interpreter path itself may have been truncated, i.e. if it isn't
+		// followed by a terminator.
+		if bytes.IndexAny(bytes.TrimLeft(line, " \t"), " \t\x00") < 0 {
+			ctx.Infof("Interpreter script has a truncated interpreter path")
+			return "", []string{}, linuxerr.ENOEXEC
+		}
+		// The last byte of the buffer is reserved for the terminator.
+		line = line[:len(line)-1]
 	}
 
-	// Skip any whitespace before the interpeter.
-	line = bytes.TrimLeft(line, " \t")
+	// As in Linux, the line ends at a NUL, and whitespace around the
+	// interpreter and its argument is ignored.
+	if i := bytes.IndexByte(line, 0); i >= 0 {
+		line = line[:i]
+	}
+	line = bytes.Trim(line, " \t")
 
 	// Linux only looks for spaces or tabs delimiting the interpreter and
 	// arg.
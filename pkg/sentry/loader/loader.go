@@ -86,6 +86,18 @@ type LoadArgs struct {
 
 	// Features specifies the CPU feature set for the executable.
 	Features cpuid.FeatureSet
+
+	// ClockOffsets indicates that the executable runs in a non-root time
+	// namespace, where CLOCK_MONOTONIC and CLOCK_BOOTTIME may be offset. The
+	// VDSO then falls back to syscalls for timekeeping.
+	ClockOffsets bool
+
+	// BinfmtMisc, if not nil, contains binary formats that are executed by
+	// interpreters, which take precedence over built-in formats.
+	BinfmtMisc *BinfmtMisc
+
+	// ELFCache, if not nil, caches the parsed headers of loaded ELFs.
+	ELFCache *ELFCache
 }
 
 // openPath opens args.Filename and checks that it is valid for loading.
@@ -164,8 +176,8 @@ const (
 // caller is responsible for checking that the user can execute this file.
 // If nil, the path args.Filename is resolved and loaded (check that the user
 // can execute this file is done here in this case). If the executable is an
-// interpreter script rather than an ELF, the binary of the corresponding
-// interpreter will be loaded.
+// interpreter script or matches a binfmt_misc entry rather than an ELF, the
+// binary of the corresponding interpreter will be loaded.
 //
 // It returns:
 //   - loadedELF, description of the loaded binary
@@ -173,6 +185,7 @@ const (
 //   - fs.Dirent of the binary file
 //   - Possibly updated args.Argv
 func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Context64, *vfs.FileDescription, []string, error) {
+	var atFlags uint64
 	for i := 0; i < maxLoaderAttempts; i++ {
 		if args.File == nil {
 			var err error
@@ -189,8 +202,9 @@ func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Contex
 			}
 		}
 
-		// Check the header. Is this an ELF or interpreter script?
-		var hdr [4]uint8
+		// Check the header. Is this an ELF, interpreter script or
+		// binfmt_misc format? Bytes beyond the end of the file are zero.
+		var hdr [binprmBufSize]uint8
 		// N.B. We assume that reading from a regular file cannot block.
 		_, err := args.File.ReadFull(ctx, usermem.BytesIOSequence(hdr[:]), 0)
 		// Allow unexpected EOF, as a valid executable could be only three bytes
@@ -202,13 +216,37 @@ func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Contex
 			return loadedELF{}, nil, nil, nil, err
 		}
 
+		var binfmt *binfmtMiscEntry
+		if binfmt = args.BinfmtMisc.match(hdr[:], args.Filename); binfmt != nil && binfmt.interpreterFile != nil {
+			defer binfmt.interpreterFile.DecRef(ctx)
+		}
+
 		switch {
-		case bytes.Equal(hdr[:], []byte(elfMagic)):
+		case binfmt != nil:
+			// The interpreter is given the path to the executable, so it
+			// must be accessible. Linux allows inaccessible executables
+			// with the 'O' flag by passing them as AT_EXECFD instead,
+			// which isn't supported.
+			if args.CloseOnExec {
+				return loadedELF{}, nil, nil, nil, linuxerr.ENOENT
+			}
+			args.Argv = binfmt.argv(args.Filename, args.Argv)
+			args.Filename = binfmt.interpreter
+			if binfmt.preserveArgv0 {
+				atFlags |= linux.AT_FLAGS_PRESERVE_ARGV0
+			}
+			// Refresh the traversal limit for the interpreter.
+			*args.RemainingTraversals = linux.MaxSymlinkTraversals
+
+		case bytes.Equal(hdr[:len(elfMagic)], []byte(elfMagic)):
 			loaded, ac, err := loadELF(ctx, args)
 			if err != nil {
 				ctx.Infof("Error loading ELF: %v", err)
 				return loadedELF{}, nil, nil, nil, err
 			}
+			if atFlags != 0 {
+				loaded.auxv = append(loaded.auxv, arch.AuxEntry{linux.AT_FLAGS, hostarch.Addr(atFlags)})
+			}
 			// An ELF is always terminal. Hold on to file.
 			args.File.IncRef()
 			return loaded, ac, args.File, args.Argv, err
@@ -231,6 +269,10 @@ func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Contex
 		}
 		// Set to nil in case we loop on a Interpreter Script.
 		args.File = nil
+		if binfmt != nil && binfmt.interpreterFile != nil {
+			// The interpreter was opened when binfmt was registered.
+			args.File = binfmt.interpreterFile
+		}
 	}
 
 	return loadedELF{}, nil, nil, nil, linuxerr.ELOOP
@@ -254,7 +296,7 @@ func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *V
 	defer file.DecRef(ctx)
 
 	// Load the VDSO.
-	vdsoAddr, err := loadVDSO(ctx, args.MemoryManager, vdso, loaded)
+	vdsoAddr, err := loadVDSO(ctx, args.MemoryManager, vdso, loaded, args.ClockOffsets)
 	if err != nil {
 		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("error loading VDSO: %v", err), syserr.FromError(err).ToLinux())
 	}
@@ -307,6 +349,7 @@ func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *V
 		arch.AuxEntry{linux.AT_PAGESZ, hostarch.PageSize},
 		arch.AuxEntry{linux.AT_SYSINFO_EHDR, vdsoAddr},
 	}...)
+	auxv = append(auxv, arch.HWCapAuxv()...)
 	auxv = append(auxv, extraAuxv...)
 
 	sl, err := stack.Load(newArgv, args.Envv, auxv)
@@ -164,6 +164,10 @@ type VDSO struct {
 	// inform the VDSO for timekeeping data.
 	ParamPage *mm.SpecialMappable
 
+	// fallbackParamPage is a parameter page that is never updated. Its
+	// clocks are never ready, so the VDSO always falls back to syscalls.
+	fallbackParamPage *mm.SpecialMappable
+
 	// vdso is the VDSO ELF itself.
 	vdso *mm.SpecialMappable
 
@@ -219,9 +223,16 @@ func PrepareVDSO(mfp pgalloc.MemoryFileProvider) (*VDSO, error) {
 		mf.DecRef(vdso)
 		return nil, fmt.Errorf("unable to allocate VDSO param page: %v", err)
 	}
+	fallbackParamPage, err := mf.Allocate(hostarch.PageSize, pgalloc.AllocOpts{Kind: usage.System})
+	if err != nil {
+		mf.DecRef(vdso)
+		mf.DecRef(paramPage)
+		return nil, fmt.Errorf("unable to allocate VDSO fallback param page: %v", err)
+	}
 
 	return &VDSO{
-		ParamPage: mm.NewSpecialMappable("[vvar]", mfp, paramPage),
+		ParamPage:         mm.NewSpecialMappable("[vvar]", mfp, paramPage),
+		fallbackParamPage: mm.NewSpecialMappable("[vvar]", mfp, fallbackParamPage),
 		// TODO(gvisor.dev/issue/157): Don't advertise the VDSO, as
 		// some applications may not be able to handle multiple [vdso]
 		// hints.
@@ -245,8 +256,12 @@ func PrepareVDSO(mfp pgalloc.MemoryFileProvider) (*VDSO, error) {
 // depend on parts of the ELF that would normally not be mapped.  To maintain
 // compatibility with such binaries, we load the VDSO much like Linux.
 //
+// If clockOffsets is true, the VDSO is loaded with a parameter page that
+// makes it fall back to syscalls for timekeeping, so that time namespace
+// offsets are applied. See LoadArgs.ClockOffsets.
+//
 // loadVDSO takes a reference on the VDSO and parameter page FrameRegions.
-func loadVDSO(ctx context.Context, m *mm.MemoryManager, v *VDSO, bin loadedELF) (hostarch.Addr, error) {
+func loadVDSO(ctx context.Context, m *mm.MemoryManager, v *VDSO, bin loadedELF, clockOffsets bool) (hostarch.Addr, error) {
 	if v.os != bin.os {
 		ctx.Warningf("Binary ELF OS %v and VDSO ELF OS %v differ", bin.os, v.os)
 		return 0, linuxerr.ENOEXEC
@@ -269,10 +284,14 @@ func loadVDSO(ctx context.Context, m *mm.MemoryManager, v *VDSO, bin loadedELF)
 	}
 
 	// Now map the param page.
+	paramPage := v.ParamPage
+	if clockOffsets {
+		paramPage = v.fallbackParamPage
+	}
 	_, err = m.MMap(ctx, memmap.MMapOpts{
-		Length:          v.ParamPage.Length(),
-		MappingIdentity: v.ParamPage,
-		Mappable:        v.ParamPage,
+		Length:          paramPage.Length(),
+		MappingIdentity: paramPage,
+		Mappable:        paramPage,
 		Addr:            addr,
 		Fixed:           true,
 		Unmap:           true,
@@ -362,9 +381,21 @@ func loadVDSO(ctx context.Context, m *mm.MemoryManager, v *VDSO, bin loadedELF)
 	return vdsoAddr, nil
 }
 
+// SetClockOffsets replaces the parameter page mapped into m by loadVDSO with
+// the one it would map for clockOffsets. It is used when a task enters a time
+// namespace without exec, which doesn't load the VDSO again.
+func (v *VDSO) SetClockOffsets(ctx context.Context, m *mm.MemoryManager, clockOffsets bool) error {
+	old, new := v.fallbackParamPage, v.ParamPage
+	if clockOffsets {
+		old, new = new, old
+	}
+	return m.ReplaceSpecialMappable(ctx, old, new)
+}
+
 // Release drops references on mappings held by v.
 func (v *VDSO) Release(ctx context.Context) {
 	v.ParamPage.DecRef(ctx)
+	v.fallbackParamPage.DecRef(ctx)
 	v.vdso.DecRef(ctx)
 }
 
@@ -218,6 +218,11 @@ func (mm *MemoryManager) mapASLocked(pseg pmaIterator, ar hostarch.AddrRange, pr
 //
 // Preconditions: mm.activeMu must be locked.
 func (mm *MemoryManager) unmapASLocked(ar hostarch.AddrRange) {
+	// Every change to the memory mapped by application addresses removes
+	// AddressSpace mappings of the previous memory, so this is also where
+	// mirrors of that memory are invalidated.
+	mm.notifyMMUNotifiersLocked(ar)
+
 	if mm.as == nil {
 		// No AddressSpace? Force all mappings to be unmapped on the next
 		// Activate.
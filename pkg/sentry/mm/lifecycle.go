@@ -207,6 +207,8 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 	if unmapAR.Length() != 0 {
 		mm.unmapASLocked(unmapAR)
 	}
+	// Swapped pages are shared with mm2 like private pmas.
+	mm.forkSwapLocked(mm2)
 
 	// Between when we call memmap.Mappable.AddMapping while copying vmas and
 	// when we lock mm2.activeMu to copy pmas, calls to mm2.Invalidate() are
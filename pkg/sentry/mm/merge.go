@@ -0,0 +1,396 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"bytes"
+	"hash/maphash"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+var (
+	pagesScanned = metric.MustCreateNewUint64Metric("/memory/merge_pages_scanned", false /* sync */, "Number of pages scanned for merging.")
+	pagesMerged  = metric.MustCreateNewUint64Metric("/memory/merge_pages_merged", false /* sync */, "Number of pages merged into an identical page.")
+)
+
+// mergeTable indexes private pages in a MemoryFile by a hash of their
+// contents, so that pages with identical contents can be found and merged,
+// including pages owned by unrelated MemoryManagers.
+//
+// Pages in a mergeTable are always stable: every pma that maps them is
+// copy-on-write, so they can't be modified. Pages are removed from the table
+// when a privateRefs releases its last reference on them, or when a pma takes
+// exclusive ownership of them in MemoryManager.isPMACopyOnWriteLocked,
+// allowing them to be written.
+type mergeTable struct {
+	mu mergeTableMutex
+
+	seed maphash.Seed
+
+	// byHash maps page content hashes to the pages in the MemoryFile. byOff
+	// maps page offsets to their hash in byHash.
+	byHash map[uint64]mergeEntry
+	byOff  map[uint64]uint64
+}
+
+// mergeEntry is a page in a mergeTable.
+type mergeEntry struct {
+	// off is the offset of the page in the MemoryFile.
+	off uint64
+
+	// owner is the privateRefs that inserted the page. owner holds a
+	// reference on the page while it is in the table.
+	owner *privateRefs
+}
+
+var (
+	// mergeTablesMu protects mergeTables.
+	mergeTablesMu sync.Mutex
+
+	// mergeTables maps each MemoryFile to its mergeTable. mergeTables are
+	// never removed, since privateRefs may refer to them and MemoryFiles
+	// usually live as long as the sandbox.
+	mergeTables map[*pgalloc.MemoryFile]*mergeTable
+)
+
+// mergeTableFor returns the mergeTable for mf.
+func mergeTableFor(mf *pgalloc.MemoryFile) *mergeTable {
+	mergeTablesMu.Lock()
+	defer mergeTablesMu.Unlock()
+	t, ok := mergeTables[mf]
+	if !ok {
+		if mergeTables == nil {
+			mergeTables = make(map[*pgalloc.MemoryFile]*mergeTable)
+		}
+		t = &mergeTable{}
+		mergeTables[mf] = t
+	}
+	return t
+}
+
+// mergeTableLocked returns the mergeTable for mm.mfp.MemoryFile(). If create
+// is false and mm's pages can't have been merged, it returns nil.
+//
+// Preconditions: mm.privateRefs.mu must be locked.
+func (mm *MemoryManager) mergeTableLocked(create bool) *mergeTable {
+	r := mm.privateRefs
+	if r.table == nil && (create || !r.shared.IsEmpty()) {
+		r.table = mergeTableFor(mm.mfp.MemoryFile())
+	}
+	return r.table
+}
+
+// Preconditions: t.mu must be locked.
+func (t *mergeTable) hash(b []byte) uint64 {
+	if t.byHash == nil {
+		t.seed = maphash.MakeSeed()
+		t.byHash = make(map[uint64]mergeEntry)
+		t.byOff = make(map[uint64]uint64)
+	}
+	return maphash.Bytes(t.seed, b)
+}
+
+// insert records that the page at off, which is owned by owner, has contents
+// with hash h, replacing any existing page with the same hash.
+//
+// Preconditions: t.mu must be locked.
+func (t *mergeTable) insert(h, off uint64, owner *privateRefs) {
+	if old, ok := t.byHash[h]; ok {
+		delete(t.byOff, old.off)
+	}
+	if oldH, ok := t.byOff[off]; ok {
+		delete(t.byHash, oldH)
+	}
+	t.byHash[h] = mergeEntry{off, owner}
+	t.byOff[off] = h
+}
+
+// removeRange removes all pages in fr from the table.
+//
+// Preconditions: t.mu must be locked.
+func (t *mergeTable) removeRange(fr memmap.FileRange) {
+	if len(t.byOff) == 0 {
+		return
+	}
+	if fr.Length()/hostarch.PageSize < uint64(len(t.byOff)) {
+		for off := fr.Start; off < fr.End; off += hostarch.PageSize {
+			if h, ok := t.byOff[off]; ok {
+				delete(t.byOff, off)
+				delete(t.byHash, h)
+			}
+		}
+		return
+	}
+	for off, h := range t.byOff {
+		if fr.Contains(off) {
+			delete(t.byOff, off)
+			delete(t.byHash, h)
+		}
+	}
+}
+
+// MergePages scans up to maxPages pages of mm's private memory, resuming
+// where the previous call to MergePages stopped, and merges each page whose
+// contents are identical to another page into that page. Merged pages are
+// shared copy-on-write, as after fork(2). If all is false, only memory in
+// vmas for which madvise(MADV_MERGEABLE) was called is scanned. MergePages
+// returns the number of pages scanned and merged.
+//
+// Pages can be merged with pages of any MemoryManager that uses the same
+// MemoryFile. Pages merged between MemoryManagers that aren't related by
+// fork(2) are always copied before they are written, since their privateRefs
+// don't count each other's references.
+func (mm *MemoryManager) MergePages(ctx context.Context, all bool, maxPages uint64) (scanned, merged uint64) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	var bufs [2][]byte
+	start := mm.mergeCursor
+	addr := start
+	wrapped := false
+	for scanned < maxPages {
+		pseg := mm.pmas.LowerBoundSegment(addr)
+		if !pseg.Ok() {
+			if wrapped {
+				break
+			}
+			wrapped = true
+			addr = 0
+			continue
+		}
+		if pseg.Start() > addr {
+			addr = pseg.Start()
+		}
+		if wrapped && addr >= start {
+			break
+		}
+		if !mm.canMergeLocked(pseg, all) {
+			addr = pseg.End()
+			continue
+		}
+		if pma := pseg.ValuePtr(); !pma.needCOW {
+			// Make the pma copy-on-write, so that its pages can't change
+			// while they are compared or after they are merged into. As in
+			// fork(2), if mm has the only reference on the pma's pages, the
+			// next write to it takes ownership of them again without
+			// copying.
+			pma.needCOW = true
+			if pma.effectivePerms.Write {
+				mm.unmapASLocked(pseg.Range())
+				pma.effectivePerms.Write = false
+			}
+			pma.maxPerms.Write = false
+		}
+		if bufs[0] == nil {
+			bufs[0] = make([]byte, hostarch.PageSize)
+			bufs[1] = make([]byte, hostarch.PageSize)
+		}
+		ok, err := mm.mergePageLocked(ctx, pseg, addr, bufs[0], bufs[1])
+		if err != nil {
+			log.Warningf("Failed to merge page at %#x: %v", addr, err)
+			break
+		}
+		scanned++
+		if ok {
+			merged++
+		}
+		addr += hostarch.PageSize
+	}
+	mm.mergeCursor = addr
+	pagesScanned.IncrementBy(scanned)
+	pagesMerged.IncrementBy(merged)
+	return scanned, merged
+}
+
+// canMergeLocked returns true if pages mapped by pseg may be merged.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked.
+//   - mm.activeMu must be locked.
+func (mm *MemoryManager) canMergeLocked(pseg pmaIterator, all bool) bool {
+	pma := pseg.ValuePtr()
+	if !pma.private || pma.file != mm.mfp.MemoryFile() {
+		return false
+	}
+	vseg := mm.vmas.FindSegment(pseg.Start())
+	if !vseg.Ok() || !vseg.Range().IsSupersetOf(pseg.Range()) {
+		return false
+	}
+	vma := vseg.ValuePtr()
+	return vma.private && (all || vma.mergeable)
+}
+
+// mergePageLocked merges the page at addr, which is mapped by pseg, into
+// another page with identical contents if one is known, and otherwise records
+// it as a candidate for other pages to be merged into. It returns true if the
+// page was merged. buf and cmpBuf are scratch buffers of hostarch.PageSize
+// bytes.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked.
+//   - mm.activeMu must be locked for writing.
+//   - pseg.ValuePtr().needCOW == true.
+//   - mm.canMergeLocked(pseg, all) == true.
+func (mm *MemoryManager) mergePageLocked(ctx context.Context, pseg pmaIterator, addr hostarch.Addr, buf, cmpBuf []byte) (bool, error) {
+	mf := mm.mfp.MemoryFile()
+	off := pseg.fileRangeOf(hostarch.AddrRange{addr, addr + hostarch.PageSize}).Start
+	if err := readPage(mf, off, buf); err != nil {
+		return false, err
+	}
+
+	mm.privateRefs.mu.Lock()
+	t := mm.mergeTableLocked(true /* create */)
+	t.mu.Lock()
+	h := t.hash(buf)
+	target, ok := t.byHash[h]
+	if !ok || target.off == off {
+		t.insert(h, off, mm.privateRefs)
+		t.mu.Unlock()
+		mm.privateRefs.mu.Unlock()
+		return false, nil
+	}
+	// Since target is in t, it is still allocated and can't be modified.
+	// Check that its contents match, rather than just its hash.
+	if err := readPage(mf, target.off, cmpBuf); err != nil {
+		t.mu.Unlock()
+		mm.privateRefs.mu.Unlock()
+		return false, err
+	}
+	if !bytes.Equal(buf, cmpBuf) {
+		t.insert(h, off, mm.privateRefs)
+		t.mu.Unlock()
+		mm.privateRefs.mu.Unlock()
+		return false, nil
+	}
+
+	// Replace the page with target. AddressSpace mappings must be removed
+	// before mm.decPrivateRefLocked().
+	ar := hostarch.AddrRange{addr, addr + hostarch.PageSize}
+	pseg = mm.pmas.Isolate(pseg, ar)
+	mm.unmapASLocked(ar)
+	fr := memmap.FileRange{off, off + hostarch.PageSize}
+	targetFR := memmap.FileRange{target.off, target.off + hostarch.PageSize}
+	memCgID := pgalloc.MemoryCgroupIDFromContext(ctx)
+	if target.owner != mm.privateRefs {
+		// Neither privateRefs counts the other's references on target, so
+		// neither may take ownership of it.
+		target.owner.markSharedLocked(targetFR)
+		if !mm.privateRefs.refs.FindSegment(target.off).Ok() {
+			// mm.privateRefs needs its own reference on target. It must
+			// be taken before t.mu is unlocked, since target.owner may
+			// then release its reference.
+			mf.IncRef(targetFR, memCgID)
+		}
+		mm.privateRefs.markSharedLocked(targetFR)
+	}
+	// Take the pma's reference on target for the same reason.
+	mf.IncRef(targetFR, memCgID)
+	t.mu.Unlock()
+	mm.incPrivateRefLocked(targetFR)
+	freed := mm.decPrivateRefLocked(fr)
+	mm.privateRefs.mu.Unlock()
+	for _, fr := range freed {
+		mf.DecRef(fr)
+	}
+	pma := pseg.ValuePtr()
+	pma.file.DecRef(fr)
+	pma.off = target.off
+	pma.internalMappings = safemem.BlockSeq{}
+	return true, nil
+}
+
+// markSharedLocked records that pages in fr, which r holds references on, are
+// shared with another privateRefs.
+//
+// Preconditions: r.table.mu must be locked.
+func (r *privateRefs) markSharedLocked(fr memmap.FileRange) {
+	if r.shared.IsEmptyRange(fr) {
+		r.shared.Add(fr, 1)
+	}
+}
+
+// isSharedLocked returns true if any pages in fr are shared with a
+// MemoryManager that uses another privateRefs.
+//
+// Preconditions: mm.privateRefs.mu must be locked.
+func (mm *MemoryManager) isSharedLocked(fr memmap.FileRange) bool {
+	t := mm.mergeTableLocked(false /* create */)
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !mm.privateRefs.shared.IsEmptyRange(fr)
+}
+
+// takeOwnershipLocked removes pages in fr, on which mm.privateRefs holds the
+// only reference, from the merge table so that they may be written. It
+// returns false, leaving the pages in the table, if they are shared with
+// another privateRefs.
+//
+// Preconditions: mm.privateRefs.mu must be locked.
+func (mm *MemoryManager) takeOwnershipLocked(fr memmap.FileRange) bool {
+	t := mm.mergeTableLocked(false /* create */)
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !mm.privateRefs.shared.IsEmptyRange(fr) {
+		return false
+	}
+	t.removeRange(fr)
+	return true
+}
+
+// forgetPagesLocked removes pages in freed, on which mm.privateRefs no longer
+// holds references, from the merge table.
+//
+// Preconditions: mm.privateRefs.mu must be locked.
+func (mm *MemoryManager) forgetPagesLocked(freed []memmap.FileRange) {
+	if len(freed) == 0 {
+		return
+	}
+	t := mm.mergeTableLocked(false /* create */)
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, fr := range freed {
+		t.removeRange(fr)
+		mm.privateRefs.shared.RemoveRange(fr)
+	}
+}
+
+// readPage copies the page at off in mf into buf.
+func readPage(mf *pgalloc.MemoryFile, off uint64, buf []byte) error {
+	ims, err := mf.MapInternal(memmap.FileRange{off, off + hostarch.PageSize}, hostarch.Read)
+	if err != nil {
+		return err
+	}
+	_, err = safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf)), ims)
+	return err
+}
@@ -26,6 +26,8 @@
 //						mm.MemoryManager.activeMu
 //							Locks taken by memmap.Mappable.Translate
 //								mm.privateRefs.mu
+//									mm.mergeTable.mu
+//								mm.MemoryManager.mmuNotifiersMu
 //									platform.AddressSpace locks
 //										memmap.File locks
 //					mm.aioManager.mu
@@ -48,6 +50,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
 // MapsCallbackFunc has all the parameters required for populating an entry of /proc/[pid]/maps.
@@ -162,6 +165,29 @@ type MemoryManager struct {
 	// maxRSS is protected by activeMu.
 	maxRSS uint64
 
+	// swapped stores pages of private anonymous memory that have been swapped
+	// out by SwapOut. An address may have a pma or a swapped page, but not
+	// both; a pma for a swapped address is created by swapping the page back
+	// in.
+	//
+	// Invariants: If a swapped page exists for a given address, a vma with no
+	// memmap.Mappable must also exist for that address.
+	//
+	// swapped is protected by activeMu.
+	swapped swapSet
+
+	// swapCursor is the address at which the next call to SwapOut resumes
+	// scanning pmas.
+	//
+	// swapCursor is protected by activeMu.
+	swapCursor hostarch.Addr
+
+	// mergeCursor is the address at which the next call to MergePages
+	// resumes scanning pmas.
+	//
+	// mergeCursor is protected by activeMu.
+	mergeCursor hostarch.Addr
+
 	// as is the platform.AddressSpace that pmas are mapped into. active is the
 	// number of contexts that require as to be non-nil; if active == 0, as may
 	// be nil.
@@ -196,6 +222,12 @@ type MemoryManager struct {
 	captureInvalidations  bool             `state:"zerovalue"`
 	capturedInvalidations []invalidateArgs `state:"nosave"`
 
+	// mmuNotifiers maps registered MMUNotifiers to the address ranges they
+	// were registered for. Since MMUNotifiers are used by devices that
+	// don't support save/restore, mmuNotifiers isn't saved.
+	mmuNotifiersMu sync.Mutex                         `state:"nosave"`
+	mmuNotifiers   map[MMUNotifier]hostarch.AddrRange `state:"nosave"`
+
 	// dumpability describes if and how this MemoryManager may be dumped to
 	// userspace. This is read under kernel.TaskSet.mu, so it can't be protected
 	// by metadataMu.
@@ -301,6 +333,10 @@ type vma struct {
 	// dontfork is the MADV_DONTFORK setting for this vma configured by madvise().
 	dontfork bool
 
+	// mergeable is the MADV_MERGEABLE setting for this vma configured by
+	// madvise().
+	mergeable bool
+
 	mlockMode memmap.MLockMode
 
 	// numaPolicy is the NUMA policy for this vma set by mbind().
@@ -423,6 +459,7 @@ func (v *vma) copy() vma {
 		private:        v.private,
 		growsDown:      v.growsDown,
 		dontfork:       v.dontfork,
+		mergeable:      v.mergeable,
 		mlockMode:      v.mlockMode,
 		numaPolicy:     v.numaPolicy,
 		numaNodemask:   v.numaNodemask,
@@ -478,6 +515,17 @@ type pma struct {
 	// corresponding vma's memmap.Mappable.Translate.
 	private bool
 
+	// If moved is true, node is the NUMA node that the pma's memory was moved
+	// to by move_pages(2). Otherwise, the pma's memory is placed according to
+	// the NUMA policy of its vma; see MemoryManager.nodeOfLocked.
+	moved bool
+	node  uint32
+
+	// referenced is true if the pma has been accessed through
+	// MemoryManager.getPMAsLocked since the last call to
+	// MemoryManager.SwapOut that examined it.
+	referenced bool
+
 	// If internalMappings is not empty, it is the cached return value of
 	// file.MapInternal for the memmap.FileRange mapped by this pma.
 	internalMappings safemem.BlockSeq `state:"nosave"`
@@ -491,6 +539,20 @@ type privateRefs struct {
 	// pmas (or, equivalently, MemoryManagers) that share ownership of the
 	// memory at that offset.
 	refs fileRefcountSet
+
+	// shared contains offsets of pages in refs that MemoryManager.MergePages
+	// has shared with MemoryManagers that use another privateRefs. Such pages
+	// are referenced by pmas that refs doesn't count, so they must be copied
+	// before they are written even if refs holds the only reference on them.
+	// Values in shared are always 1.
+	//
+	// shared is protected by table.mu. If table is nil, shared is only
+	// modified while holding mu.
+	shared fileRefcountSet
+
+	// table is the mergeTable for MemoryManager.mfp.MemoryFile(), or nil if
+	// it hasn't been looked up yet. table is protected by mu.
+	table *mergeTable `state:"nosave"`
 }
 
 type invalidateArgs struct {
@@ -273,3 +273,167 @@ func TestAIOLookupAfterDestroy(t *testing.T) {
 		t.Errorf("AIOContext found even after AIOContext manager is destroyed")
 	}
 }
+
+// TestMergePages tests that identical pages are merged, and are copied again
+// when written to.
+func TestMergePages(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.ReadWrite,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	for _, a := range []hostarch.Addr{addr, addr + hostarch.PageSize} {
+		if _, err := mm.CopyOut(ctx, a, []byte("hello"), usermem.IOOpts{}); err != nil {
+			t.Fatalf("CopyOut got err %v want nil", err)
+		}
+	}
+
+	// The memory is not marked mergeable.
+	if scanned, merged := mm.MergePages(ctx, false /* all */, 2); scanned != 0 || merged != 0 {
+		t.Errorf("MergePages(all=false) got (%d, %d) want (0, 0)", scanned, merged)
+	}
+	if err := mm.SetMergeable(addr, 2*hostarch.PageSize, true); err != nil {
+		t.Fatalf("SetMergeable got err %v want nil", err)
+	}
+	if scanned, merged := mm.MergePages(ctx, false /* all */, 2); scanned != 2 || merged != 1 {
+		t.Errorf("MergePages got (%d, %d) want (2, 1)", scanned, merged)
+	}
+
+	// Writing to one page must not affect the other.
+	if _, err := mm.CopyOut(ctx, addr+hostarch.PageSize, []byte("world"), usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut got err %v want nil", err)
+	}
+	for _, tc := range []struct {
+		addr hostarch.Addr
+		want string
+	}{
+		{addr, "hello"},
+		{addr + hostarch.PageSize, "world"},
+	} {
+		b := make([]byte, 5)
+		if _, err := mm.CopyIn(ctx, tc.addr, b, usermem.IOOpts{}); err != nil {
+			t.Fatalf("CopyIn got err %v want nil", err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("CopyIn(%#x) got %q want %q", tc.addr, b, tc.want)
+		}
+	}
+}
+
+// TestMergePagesAcrossMemoryManagers tests that identical pages of
+// MemoryManagers that aren't related by fork(2) are merged, and are copied
+// again when written to by either of them.
+func TestMergePagesAcrossMemoryManagers(t *testing.T) {
+	ctx := contexttest.Context(t)
+	var (
+		mms   [2]*MemoryManager
+		addrs [2]hostarch.Addr
+	)
+	for i := range mms {
+		mm := testMemoryManager(ctx)
+		defer mm.DecUsers(ctx)
+		addr, err := mm.MMap(ctx, memmap.MMapOpts{
+			Length:   hostarch.PageSize,
+			Private:  true,
+			Perms:    hostarch.ReadWrite,
+			MaxPerms: hostarch.AnyAccess,
+		})
+		if err != nil {
+			t.Fatalf("MMap got err %v want nil", err)
+		}
+		if _, err := mm.CopyOut(ctx, addr, []byte("hello"), usermem.IOOpts{}); err != nil {
+			t.Fatalf("CopyOut got err %v want nil", err)
+		}
+		mms[i], addrs[i] = mm, addr
+	}
+
+	if scanned, merged := mms[0].MergePages(ctx, true /* all */, 1); scanned != 1 || merged != 0 {
+		t.Errorf("MergePages(mm0) got (%d, %d) want (1, 0)", scanned, merged)
+	}
+	if scanned, merged := mms[1].MergePages(ctx, true /* all */, 1); scanned != 1 || merged != 1 {
+		t.Errorf("MergePages(mm1) got (%d, %d) want (1, 1)", scanned, merged)
+	}
+
+	// Each MemoryManager holds the only reference on the page in its own
+	// privateRefs, but must still copy it before writing to it.
+	if _, err := mms[0].CopyOut(ctx, addrs[0], []byte("world"), usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut got err %v want nil", err)
+	}
+	for i, want := range []string{"world", "hello"} {
+		b := make([]byte, 5)
+		if _, err := mms[i].CopyIn(ctx, addrs[i], b, usermem.IOOpts{}); err != nil {
+			t.Fatalf("CopyIn got err %v want nil", err)
+		}
+		if string(b) != want {
+			t.Errorf("mm%d: CopyIn(%#x) got %q want %q", i, addrs[i], b, want)
+		}
+	}
+}
+
+// testMMUNotifier records the ranges it is notified of.
+type testMMUNotifier struct {
+	invalidated []hostarch.AddrRange
+}
+
+// InvalidateRange implements MMUNotifier.InvalidateRange.
+func (n *testMMUNotifier) InvalidateRange(ar hostarch.AddrRange) {
+	n.invalidated = append(n.invalidated, ar)
+}
+
+func TestMMUNotifier(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.ReadWrite,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	ar := hostarch.AddrRange{addr, addr + 2*hostarch.PageSize}
+	prs, err := mm.Pin(ctx, ar, hostarch.ReadWrite, false /* ignorePermissions */)
+	if err != nil {
+		t.Fatalf("Pin got err %v want nil", err)
+	}
+	defer Unpin(prs)
+
+	n := &testMMUNotifier{}
+	mm.RegisterMMUNotifier(ar, n)
+	if err := mm.MUnmap(ctx, addr, hostarch.PageSize); err != nil {
+		t.Fatalf("MUnmap got err %v want nil", err)
+	}
+	first := hostarch.AddrRange{addr, addr + hostarch.PageSize}
+	found := false
+	for _, iar := range n.invalidated {
+		if !ar.IsSupersetOf(iar) {
+			t.Errorf("notified of %v, outside of registered range %v", iar, ar)
+		}
+		if iar.IsSupersetOf(first) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("not notified of unmapping %v: got %v", first, n.invalidated)
+	}
+
+	mm.UnregisterMMUNotifier(n)
+	n.invalidated = nil
+	if err := mm.MUnmap(ctx, addr+hostarch.PageSize, hostarch.PageSize); err != nil {
+		t.Fatalf("MUnmap got err %v want nil", err)
+	}
+	if len(n.invalidated) != 0 {
+		t.Errorf("notified of %v after unregistration", n.invalidated)
+	}
+}
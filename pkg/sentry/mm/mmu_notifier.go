@@ -0,0 +1,68 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+// An MMUNotifier is notified when the memory mapped by application addresses
+// may change, analogous to Linux's struct mmu_notifier. It allows users of
+// Pin that mirror application memory elsewhere, e.g. in a device's page
+// tables, to keep the mirror consistent with the application's mappings.
+type MMUNotifier interface {
+	// InvalidateRange is called when the memory mapped by addresses in ar,
+	// which intersects the range that the MMUNotifier was registered for,
+	// may have changed, e.g. due to munmap(), mremap(), madvise() or
+	// copy-on-write. Memory that was pinned for these addresses remains
+	// pinned, but may no longer be mapped by them.
+	//
+	// InvalidateRange is called with mm.activeMu locked, so it must not call
+	// MemoryManager methods.
+	InvalidateRange(ar hostarch.AddrRange)
+}
+
+// RegisterMMUNotifier registers n to be notified of changes to the memory
+// mapped by addresses in ar, until n is unregistered.
+func (mm *MemoryManager) RegisterMMUNotifier(ar hostarch.AddrRange, n MMUNotifier) {
+	mm.mmuNotifiersMu.Lock()
+	defer mm.mmuNotifiersMu.Unlock()
+	if mm.mmuNotifiers == nil {
+		mm.mmuNotifiers = make(map[MMUNotifier]hostarch.AddrRange)
+	}
+	mm.mmuNotifiers[n] = ar
+}
+
+// UnregisterMMUNotifier unregisters n. After UnregisterMMUNotifier returns,
+// n.InvalidateRange is not running and will not be called.
+func (mm *MemoryManager) UnregisterMMUNotifier(n MMUNotifier) {
+	mm.mmuNotifiersMu.Lock()
+	defer mm.mmuNotifiersMu.Unlock()
+	delete(mm.mmuNotifiers, n)
+}
+
+// notifyMMUNotifiersLocked notifies registered MMUNotifiers that the memory
+// mapped by addresses in ar may have changed.
+//
+// Preconditions: mm.activeMu must be locked.
+func (mm *MemoryManager) notifyMMUNotifiersLocked(ar hostarch.AddrRange) {
+	mm.mmuNotifiersMu.Lock()
+	defer mm.mmuNotifiersMu.Unlock()
+	for n, nar := range mm.mmuNotifiers {
+		if iar := ar.Intersect(nar); iar.Length() != 0 {
+			n.InvalidateRange(iar)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"math/bits"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+// NUMAContext is the NUMA state of the task on whose behalf NUMA node
+// placement is queried or changed. It determines the placement of memory in
+// vmas that have no NUMA policy of their own.
+//
+// The sentry does not place memory on host NUMA nodes. Instead, each page is
+// considered to be placed on a NUMA node chosen by the applicable NUMA policy
+// (or moved there by move_pages(2)), so that placement reported to
+// applications is consistent with the policies they set.
+type NUMAContext struct {
+	// Policy and Nodemask are the task's NUMA policy, as set by
+	// set_mempolicy(2).
+	Policy   linux.NumaPolicy
+	Nodemask uint64
+
+	// LocalNode is the NUMA node of the CPU the task is running on.
+	LocalNode uint32
+}
+
+// policyNode returns the NUMA node on which the page at addr is placed under
+// the given policy, or false if policy is MPOL_DEFAULT.
+func policyNode(policy linux.NumaPolicy, nodemask uint64, addr hostarch.Addr, local uint32) (uint32, bool) {
+	switch policy &^ linux.MPOL_MODE_FLAGS {
+	case linux.MPOL_DEFAULT:
+		return 0, false
+	case linux.MPOL_PREFERRED, linux.MPOL_BIND:
+		if nodemask == 0 {
+			return local, true
+		}
+		return uint32(bits.TrailingZeros64(nodemask)), true
+	case linux.MPOL_INTERLEAVE:
+		if nodemask == 0 {
+			return local, true
+		}
+		// Interleave pages across nodes in the nodemask by page index, as in
+		// Linux's mm/mempolicy.c:interleave_nid().
+		n := uint64(addr/hostarch.PageSize) % uint64(bits.OnesCount64(nodemask))
+		for ; n > 0; n-- {
+			nodemask &= nodemask - 1
+		}
+		return uint32(bits.TrailingZeros64(nodemask)), true
+	default:
+		// MPOL_LOCAL.
+		return local, true
+	}
+}
+
+// nodeOfLocked returns the NUMA node on which the page at addr, which must be
+// mapped by vseg and pseg, is placed.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked.
+//   - mm.activeMu must be locked.
+func (mm *MemoryManager) nodeOfLocked(vseg vmaIterator, pseg pmaIterator, addr hostarch.Addr, nc NUMAContext) uint32 {
+	if pma := pseg.ValuePtr(); pma.moved {
+		return pma.node
+	}
+	vma := vseg.ValuePtr()
+	if node, ok := policyNode(vma.numaPolicy, vma.numaNodemask, addr, nc.LocalNode); ok {
+		return node
+	}
+	if node, ok := policyNode(nc.Policy, nc.Nodemask, addr, nc.LocalNode); ok {
+		return node
+	}
+	return nc.LocalNode
+}
+
+// PageNode returns the NUMA node on which the page containing addr is placed.
+// It returns ENOENT if no memory is mapped at addr, which can be resolved by
+// faulting it in.
+func (mm *MemoryManager) PageNode(addr hostarch.Addr, nc NUMAContext) (uint32, error) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	vseg := mm.vmas.FindSegment(addr)
+	if !vseg.Ok() {
+		return 0, linuxerr.EFAULT
+	}
+	pseg := mm.pmas.FindSegment(addr)
+	if !pseg.Ok() {
+		return 0, linuxerr.ENOENT
+	}
+	return mm.nodeOfLocked(vseg, pseg, addr, nc), nil
+}
+
+// MovePages implements the semantics of Linux's move_pages(2) for the pages
+// containing addrs. If nodes is nil, MovePages stores the NUMA node of each
+// page in status; otherwise, it moves each page addrs[i] to nodes[i], and
+// stores the node to which the page was moved in status. If a page can't be
+// queried or moved, the corresponding status is a negated errno. moveAll
+// corresponds to MPOL_MF_MOVE_ALL.
+//
+// Preconditions:
+//   - len(status) == len(addrs).
+//   - If nodes is not nil, len(nodes) == len(addrs).
+func (mm *MemoryManager) MovePages(addrs []hostarch.Addr, nodes []uint32, moveAll bool, nc NUMAContext, status []int32) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	for i, addr := range addrs {
+		addr = addr.RoundDown()
+		vseg := mm.vmas.FindSegment(addr)
+		if !vseg.Ok() {
+			status[i] = -int32(linuxerr.EFAULT.Errno())
+			continue
+		}
+		pseg := mm.pmas.FindSegment(addr)
+		if !pseg.Ok() {
+			status[i] = -int32(linuxerr.ENOENT.Errno())
+			continue
+		}
+		if nodes == nil {
+			status[i] = int32(mm.nodeOfLocked(vseg, pseg, addr, nc))
+			continue
+		}
+		// "EACCES: The page is mapped by multiple processes and can be moved
+		// only if MPOL_MF_MOVE_ALL is specified." - move_pages(2)
+		if !pseg.ValuePtr().private && !moveAll {
+			status[i] = -int32(linuxerr.EACCES.Errno())
+			continue
+		}
+		ar := hostarch.AddrRange{addr, addr + hostarch.PageSize}
+		pseg = mm.pmas.Isolate(pseg, ar)
+		pma := pseg.ValuePtr()
+		pma.moved = true
+		pma.node = nodes[i]
+		mm.pmas.MergeAdjacent(ar)
+		status[i] = int32(nodes[i])
+	}
+}
+
+// resetNodesLocked places all memory in ar according to NUMA policy, undoing
+// the effect of previous calls to MovePages.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked.
+//   - mm.activeMu must be locked for writing.
+func (mm *MemoryManager) resetNodesLocked(ar hostarch.AddrRange) {
+	for pseg := mm.pmas.LowerBoundSegment(ar.Start); pseg.Ok() && pseg.Start() < ar.End; pseg = pseg.NextSegment() {
+		if pseg.ValuePtr().moved {
+			pseg = mm.pmas.Isolate(pseg, ar)
+			pseg.ValuePtr().moved = false
+		}
+	}
+	mm.pmas.MergeRange(ar)
+	mm.pmas.MergeAdjacent(ar)
+}
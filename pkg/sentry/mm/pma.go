@@ -131,6 +131,10 @@ func (mm *MemoryManager) getPMAsLocked(ctx context.Context, vseg vmaIterator, ar
 	if !pstart.Ok() {
 		pstart = mm.findOrSeekPrevUpperBoundPMA(ar.Start, pend)
 	}
+	// Inform SwapOut that the pmas have been used.
+	for pseg := pstart; pseg.Ok() && pseg.Start() < ar.End; pseg = pseg.NextSegment() {
+		pseg.ValuePtr().referenced = true
+	}
 	if perr != nil {
 		return pstart, pend, perr
 	}
@@ -241,6 +245,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 				if vma.mappable == nil {
 					// Private anonymous mappings get pmas by allocating.
 					allocAR := optAR.Intersect(maskAR)
+					opts.Kind = vma.privateMemoryKind()
 					fr, err := mf.Allocate(uint64(allocAR.Length()), opts)
 					if err != nil {
 						return pstart, pgap, err
@@ -250,6 +255,11 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 							panic(fmt.Sprintf("Allocate(%v) returned invalid FileRange %v", allocAR.Length(), fr))
 						}
 					}
+					// Restore any pages in allocAR that were swapped out.
+					if err := mm.swapInLocked(allocAR, fr); err != nil {
+						mf.DecRef(fr)
+						return pstart, pgap, err
+					}
 					mm.addRSSLocked(allocAR)
 					mm.incPrivateRef(fr)
 					mf.IncRef(fr, memCgID)
@@ -375,7 +385,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 					}
 					// Copy contents.
 					fr, err := mf.Allocate(uint64(copyAR.Length()), pgalloc.AllocOpts{
-						Kind:    usage.Anonymous,
+						Kind:    vma.privateMemoryKind(),
 						Mode:    pgalloc.AllocateAndWritePopulate,
 						MemCgID: memCgID,
 						Reader:  &safemem.BlockSeqReader{mm.internalMappingsLocked(pseg, copyAR)},
@@ -418,6 +428,8 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 					oldpma.maxPerms = vma.maxPerms
 					oldpma.needCOW = false
 					oldpma.private = true
+					// The copy is placed according to NUMA policy.
+					oldpma.moved = false
 					oldpma.internalMappings = safemem.BlockSeq{}
 					// Try to merge the pma with its neighbors.
 					if prev := pseg.PrevSegment(); prev.Ok() {
@@ -538,6 +550,15 @@ const (
 	privateAllocMask = privateAllocUnit - 1
 )
 
+// privateMemoryKind returns the memory accounting category for private
+// anonymous memory allocated for vma.
+func (vma *vma) privateMemoryKind() usage.MemoryKind {
+	if vma.growsDown {
+		return usage.Stack
+	}
+	return usage.Anonymous
+}
+
 func privateAligned(ar hostarch.AddrRange) hostarch.AddrRange {
 	aligned := hostarch.AddrRange{ar.Start &^ privateAllocMask, ar.End}
 	if end := (ar.End + privateAllocMask) &^ privateAllocMask; end >= ar.End {
@@ -573,13 +594,17 @@ func (mm *MemoryManager) isPMACopyOnWriteLocked(vseg vmaIterator, pseg pmaIterat
 	// If we have the only reference on private memory to be copied, just take
 	// ownership of it instead of copying. If we do hold the only reference,
 	// additional references can only be taken by mm.Fork(), which is excluded
-	// by mm.activeMu, so this isn't racy.
+	// by mm.activeMu, or by MergePages in another MemoryManager, which is
+	// excluded by mm.takeOwnershipLocked(), so this isn't racy.
 	mm.privateRefs.mu.Lock()
 	defer mm.privateRefs.mu.Unlock()
 	fr := pseg.fileRange()
 	// This check relies on mm.privateRefs.refs being kept fully merged.
 	rseg := mm.privateRefs.refs.FindSegment(fr.Start)
-	if rseg.Ok() && rseg.Value() == 1 && fr.End <= rseg.End() {
+	// The memory may be shared with other MemoryManagers by MergePages, in
+	// which case it isn't ours to take; otherwise it may now be written, so it
+	// can no longer be merged into.
+	if rseg.Ok() && rseg.Value() == 1 && fr.End <= rseg.End() && mm.takeOwnershipLocked(fr) {
 		pma.needCOW = false
 		// pma.private => pma.translatePerms == hostarch.AnyAccess
 		vma := vseg.ValuePtr()
@@ -621,6 +646,10 @@ func (mm *MemoryManager) invalidateLocked(ar hostarch.AddrRange, invalidatePriva
 		}
 	}
 
+	if invalidatePrivate {
+		mm.discardSwapLocked(ar)
+	}
+
 	var didUnmapAS bool
 	pseg := mm.pmas.LowerBoundSegment(ar.Start)
 	for pseg.Ok() && pseg.Start() < ar.End {
@@ -808,6 +837,7 @@ func (mm *MemoryManager) movePMAsLocked(oldAR, newAR hostarch.AddrRange) {
 		pmaNewAR := hostarch.AddrRange{mpma.oldAR.Start + off, mpma.oldAR.End + off}
 		pgap = mm.pmas.Insert(pgap, pmaNewAR, mpma.pma).NextGap()
 	}
+	mm.moveSwapLocked(oldAR, newAR)
 
 	mm.unmapASLocked(oldAR)
 }
@@ -938,6 +968,13 @@ func (mm *MemoryManager) vecInternalMappingsLocked(ars hostarch.AddrRangeSeq) sa
 func (mm *MemoryManager) incPrivateRef(fr memmap.FileRange) {
 	mm.privateRefs.mu.Lock()
 	defer mm.privateRefs.mu.Unlock()
+	mm.incPrivateRefLocked(fr)
+}
+
+// incPrivateRefLocked acquires a reference on private pages in fr.
+//
+// Preconditions: mm.privateRefs.mu must be locked.
+func (mm *MemoryManager) incPrivateRefLocked(fr memmap.FileRange) {
 	refSet := &mm.privateRefs.refs
 	seg, gap := refSet.Find(fr.Start)
 	for {
@@ -957,9 +994,24 @@ func (mm *MemoryManager) incPrivateRef(fr memmap.FileRange) {
 
 // decPrivateRef releases a reference on private pages in fr.
 func (mm *MemoryManager) decPrivateRef(fr memmap.FileRange) {
-	var freed []memmap.FileRange
-
 	mm.privateRefs.mu.Lock()
+	freed := mm.decPrivateRefLocked(fr)
+	mm.privateRefs.mu.Unlock()
+
+	mf := mm.mfp.MemoryFile()
+	for _, fr := range freed {
+		mf.DecRef(fr)
+	}
+}
+
+// decPrivateRefLocked releases a reference on private pages in fr. It returns
+// the ranges of pages on which it released the last reference; the caller
+// must release the corresponding references on mm.mfp.MemoryFile() after
+// unlocking mm.privateRefs.mu.
+//
+// Preconditions: mm.privateRefs.mu must be locked.
+func (mm *MemoryManager) decPrivateRefLocked(fr memmap.FileRange) []memmap.FileRange {
+	var freed []memmap.FileRange
 	refSet := &mm.privateRefs.refs
 	seg := refSet.LowerBoundSegment(fr.Start)
 	for seg.Ok() && seg.Start() < fr.End {
@@ -973,12 +1025,8 @@ func (mm *MemoryManager) decPrivateRef(fr memmap.FileRange) {
 		}
 	}
 	refSet.MergeAdjacent(fr)
-	mm.privateRefs.mu.Unlock()
-
-	mf := mm.mfp.MemoryFile()
-	for _, fr := range freed {
-		mf.DecRef(fr)
-	}
+	mm.forgetPagesLocked(freed)
+	return freed
 }
 
 // addRSSLocked updates the current and maximum resident set size of a
@@ -1023,10 +1071,15 @@ func (pmaSetFunctions) Merge(ar1 hostarch.AddrRange, pma1 pma, ar2 hostarch.Addr
 		pma1.effectivePerms != pma2.effectivePerms ||
 		pma1.maxPerms != pma2.maxPerms ||
 		pma1.needCOW != pma2.needCOW ||
-		pma1.private != pma2.private {
+		pma1.private != pma2.private ||
+		pma1.moved != pma2.moved ||
+		pma1.node != pma2.node {
 		return pma{}, false
 	}
 
+	// The merged pma has been referenced if either of its parts has.
+	pma1.referenced = pma1.referenced || pma2.referenced
+
 	// Discard internal mappings instead of trying to merge them, since merging
 	// them requires an allocation and getting them again from the
 	// memmap.File might not.
@@ -181,40 +181,21 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 	// requiring it to be locked as a precondition, to reduce the latency
 	// impact of reading /proc/[pid]/smaps on concurrent performance-sensitive
 	// operations requiring activeMu for writing like faults.
+	var stats smapsStats
 	mm.activeMu.RLock()
-	var rss uint64
-	var anon uint64
-	vsegAR := vseg.Range()
-	for pseg := mm.pmas.LowerBoundSegment(vsegAR.Start); pseg.Ok() && pseg.Start() < vsegAR.End; pseg = pseg.NextSegment() {
-		psegAR := pseg.Range().Intersect(vsegAR)
-		size := uint64(psegAR.Length())
-		rss += size
-		if pseg.ValuePtr().private {
-			anon += size
-		}
-	}
+	mm.vmaSmapsStatsLocked(vseg, &stats)
 	mm.activeMu.RUnlock()
 
 	fmt.Fprintf(b, "Size:           %8d kB\n", vseg.Range().Length()/1024)
-	fmt.Fprintf(b, "Rss:            %8d kB\n", rss/1024)
-	// Currently we report PSS = RSS, i.e. we pretend each page mapped by a pma
-	// is only mapped by that pma. This avoids having to query memmap.Mappables
-	// for reference count information on each page. As a corollary, all pages
-	// are accounted as "private" whether or not the vma is private; compare
-	// Linux's fs/proc/task_mmu.c:smaps_account().
-	fmt.Fprintf(b, "Pss:            %8d kB\n", rss/1024)
-	fmt.Fprintf(b, "Shared_Clean:   %8d kB\n", 0)
-	fmt.Fprintf(b, "Shared_Dirty:   %8d kB\n", 0)
-	// Pretend that all pages are dirty if the vma is writable, and clean otherwise.
-	clean := rss
-	if vma.effectivePerms.Write {
-		clean = 0
-	}
-	fmt.Fprintf(b, "Private_Clean:  %8d kB\n", clean/1024)
-	fmt.Fprintf(b, "Private_Dirty:  %8d kB\n", (rss-clean)/1024)
+	fmt.Fprintf(b, "Rss:            %8d kB\n", stats.rss/1024)
+	fmt.Fprintf(b, "Pss:            %8d kB\n", stats.pss>>pssShift/1024)
+	fmt.Fprintf(b, "Shared_Clean:   %8d kB\n", stats.sharedClean/1024)
+	fmt.Fprintf(b, "Shared_Dirty:   %8d kB\n", stats.sharedDirty/1024)
+	fmt.Fprintf(b, "Private_Clean:  %8d kB\n", stats.privateClean/1024)
+	fmt.Fprintf(b, "Private_Dirty:  %8d kB\n", stats.privateDirty/1024)
 	// Pretend that all pages are "referenced" (recently touched).
-	fmt.Fprintf(b, "Referenced:     %8d kB\n", rss/1024)
-	fmt.Fprintf(b, "Anonymous:      %8d kB\n", anon/1024)
+	fmt.Fprintf(b, "Referenced:     %8d kB\n", stats.rss/1024)
+	fmt.Fprintf(b, "Anonymous:      %8d kB\n", stats.anonymous/1024)
 	// Hugepages (hugetlb and THP) are not implemented.
 	fmt.Fprintf(b, "AnonHugePages:  %8d kB\n", 0)
 	fmt.Fprintf(b, "Shared_Hugetlb: %8d kB\n", 0)
@@ -224,11 +205,7 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 	fmt.Fprintf(b, "SwapPss:        %8d kB\n", 0)
 	fmt.Fprintf(b, "KernelPageSize: %8d kB\n", hostarch.PageSize/1024)
 	fmt.Fprintf(b, "MMUPageSize:    %8d kB\n", hostarch.PageSize/1024)
-	locked := rss
-	if vma.mlockMode == memmap.MLockNone {
-		locked = 0
-	}
-	fmt.Fprintf(b, "Locked:         %8d kB\n", locked/1024)
+	fmt.Fprintf(b, "Locked:         %8d kB\n", stats.locked>>pssShift/1024)
 
 	b.WriteString("VmFlags: ")
 	if vma.realPerms.Read {
@@ -267,5 +244,265 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 	if vma.private && vma.effectivePerms.Write { // VM_ACCOUNT
 		b.WriteString("ac ")
 	}
+	if vma.mergeable {
+		b.WriteString("mg ")
+	}
 	b.WriteString("\n")
 }
+
+// pssShift is the number of fractional bits in proportional set sizes, as in
+// Linux's fs/proc/task_mmu.c:PSS_SHIFT.
+const pssShift = 12
+
+// smapsStats holds the memory usage statistics reported by
+// /proc/[pid]/smaps and /proc/[pid]/smaps_rollup. Sizes are in bytes;
+// proportional sizes, including locked, are shifted left by pssShift.
+type smapsStats struct {
+	rss          uint64
+	pss          uint64
+	pssDirty     uint64
+	pssAnon      uint64
+	pssFile      uint64
+	pssShmem     uint64
+	sharedClean  uint64
+	sharedDirty  uint64
+	privateClean uint64
+	privateDirty uint64
+	anonymous    uint64
+	locked       uint64
+}
+
+// add accumulates other into s.
+func (s *smapsStats) add(other *smapsStats) {
+	s.rss += other.rss
+	s.pss += other.pss
+	s.pssDirty += other.pssDirty
+	s.pssAnon += other.pssAnon
+	s.pssFile += other.pssFile
+	s.pssShmem += other.pssShmem
+	s.sharedClean += other.sharedClean
+	s.sharedDirty += other.sharedDirty
+	s.privateClean += other.privateClean
+	s.privateDirty += other.privateDirty
+	s.anonymous += other.anonymous
+	s.locked += other.locked
+}
+
+// vmaSmapsStatsLocked accumulates statistics for the resident pages of the
+// vma iterated by vseg into stats. This is analogous to Linux's
+// fs/proc/task_mmu.c:smaps_account().
+//
+// Private memory shared with other MemoryManagers after fork, as tracked by
+// mm.privateRefs, is accounted as shared and divided between them in PSS.
+// Other memory is accounted as private, since the sharing of pages of
+// memmap.Mappables is not tracked. Private memory is always dirty; other
+// memory is assumed to be dirty if the vma is writable, and clean otherwise.
+//
+// Preconditions: mm.mappingMu must be locked. mm.activeMu must be locked.
+func (mm *MemoryManager) vmaSmapsStatsLocked(vseg vmaIterator, stats *smapsStats) {
+	vma := vseg.ValuePtr()
+	mf := mm.mfp.MemoryFile()
+	vsegAR := vseg.Range()
+	for pseg := mm.pmas.LowerBoundSegment(vsegAR.Start); pseg.Ok() && pseg.Start() < vsegAR.End; pseg = pseg.NextSegment() {
+		pma := pseg.ValuePtr()
+		shmem := !pma.private && pma.file == mf
+		dirty := pma.private || vma.effectivePerms.Write
+		mm.forEachResidentRangeLocked(pseg, pseg.Range().Intersect(vsegAR), func(_ hostarch.AddrRange, size uint64, mapcount int32) {
+			stats.rss += size
+			pss := size << pssShift
+			if mapcount > 1 {
+				pss /= uint64(mapcount)
+				if dirty {
+					stats.sharedDirty += size
+				} else {
+					stats.sharedClean += size
+				}
+			} else {
+				if dirty {
+					stats.privateDirty += size
+				} else {
+					stats.privateClean += size
+				}
+			}
+			stats.pss += pss
+			if dirty {
+				stats.pssDirty += pss
+			}
+			switch {
+			case pma.private:
+				stats.anonymous += size
+				stats.pssAnon += pss
+			case shmem:
+				stats.pssShmem += pss
+			default:
+				stats.pssFile += pss
+			}
+			if vma.mlockMode != memmap.MLockNone {
+				stats.locked += pss
+			}
+		})
+	}
+}
+
+// forEachResidentRangeLocked invokes fn on each subrange of ar, which must be
+// in the pma iterated by pseg, that is resident in memory. size is the length
+// of the subrange in bytes. If the pma is private, mapcount is the number of
+// MemoryManagers that share the memory; otherwise it is 0, indicating that
+// the number of mappings is unknown.
+//
+// Memory from files other than the MemoryFile, e.g. host files, is assumed to
+// be resident whenever a pma maps it.
+//
+// Preconditions: mm.activeMu must be locked.
+func (mm *MemoryManager) forEachResidentRangeLocked(pseg pmaIterator, ar hostarch.AddrRange, fn func(ar hostarch.AddrRange, size uint64, mapcount int32)) {
+	pma := pseg.ValuePtr()
+	addrOf := func(fr memmap.FileRange) hostarch.AddrRange {
+		start := pseg.Start() + hostarch.Addr(fr.Start-pma.off)
+		return hostarch.AddrRange{start, start + hostarch.Addr(fr.Length())}
+	}
+	visit := func(fr memmap.FileRange) {
+		if !pma.private {
+			fn(addrOf(fr), fr.Length(), 0)
+			return
+		}
+		mm.privateRefs.mu.Lock()
+		for rseg := mm.privateRefs.refs.LowerBoundSegment(fr.Start); rseg.Ok() && rseg.Start() < fr.End; rseg = rseg.NextSegment() {
+			rfr := rseg.Range().Intersect(fr)
+			fn(addrOf(rfr), rfr.Length(), rseg.Value())
+		}
+		mm.privateRefs.mu.Unlock()
+	}
+
+	fr := pseg.fileRangeOf(ar)
+	mf := mm.mfp.MemoryFile()
+	if pma.file != mf {
+		visit(fr)
+		return
+	}
+	if err := mf.ForEachResidentRange(fr, visit); err != nil {
+		log.Warningf("Failed to determine residency of %v: %v", fr, err)
+	}
+}
+
+// ReadSmapsRollupDataInto is called by fsimpl/proc.smapsRollupData.Generate to
+// implement /proc/[pid]/smaps_rollup.
+func (mm *MemoryManager) ReadSmapsRollupDataInto(ctx context.Context, buf *bytes.Buffer) {
+	// FIXME(b/235153601): Need to replace RLockBypass with RLockBypass
+	// after fixing b/235153601.
+	mm.mappingMu.RLockBypass()
+	defer mm.mappingMu.RUnlockBypass()
+
+	vseg := mm.vmas.FirstSegment()
+	if !vseg.Ok() {
+		// Linux's fs/proc/task_mmu.c:show_smaps_rollup() prints nothing for
+		// an empty address space.
+		return
+	}
+	start := vseg.Start()
+	var (
+		stats smapsStats
+		end   hostarch.Addr
+	)
+	for ; vseg.Ok(); vseg = vseg.NextSegment() {
+		var vmaStats smapsStats
+		mm.activeMu.RLock()
+		mm.vmaSmapsStatsLocked(vseg, &vmaStats)
+		mm.activeMu.RUnlock()
+		stats.add(&vmaStats)
+		end = vseg.End()
+	}
+
+	mm.MapsCallbackFuncForBuffer(buf)(start, end, hostarch.NoAccess, "p", 0, 0, 0, 0, "[rollup]")
+	fmt.Fprintf(buf, "Rss:            %8d kB\n", stats.rss/1024)
+	fmt.Fprintf(buf, "Pss:            %8d kB\n", stats.pss>>pssShift/1024)
+	fmt.Fprintf(buf, "Pss_Dirty:      %8d kB\n", stats.pssDirty>>pssShift/1024)
+	fmt.Fprintf(buf, "Pss_Anon:       %8d kB\n", stats.pssAnon>>pssShift/1024)
+	fmt.Fprintf(buf, "Pss_File:       %8d kB\n", stats.pssFile>>pssShift/1024)
+	fmt.Fprintf(buf, "Pss_Shmem:      %8d kB\n", stats.pssShmem>>pssShift/1024)
+	fmt.Fprintf(buf, "Shared_Clean:   %8d kB\n", stats.sharedClean/1024)
+	fmt.Fprintf(buf, "Shared_Dirty:   %8d kB\n", stats.sharedDirty/1024)
+	fmt.Fprintf(buf, "Private_Clean:  %8d kB\n", stats.privateClean/1024)
+	fmt.Fprintf(buf, "Private_Dirty:  %8d kB\n", stats.privateDirty/1024)
+	// Pretend that all pages are "referenced" (recently touched).
+	fmt.Fprintf(buf, "Referenced:     %8d kB\n", stats.rss/1024)
+	fmt.Fprintf(buf, "Anonymous:      %8d kB\n", stats.anonymous/1024)
+	fmt.Fprintf(buf, "LazyFree:       %8d kB\n", 0)
+	// Hugepages (hugetlb and THP) are not implemented.
+	fmt.Fprintf(buf, "AnonHugePages:  %8d kB\n", 0)
+	fmt.Fprintf(buf, "ShmemPmdMapped: %8d kB\n", 0)
+	fmt.Fprintf(buf, "FilePmdMapped:  %8d kB\n", 0)
+	fmt.Fprintf(buf, "Shared_Hugetlb: %8d kB\n", 0)
+	fmt.Fprintf(buf, "Private_Hugetlb: %7d kB\n", 0)
+	// Swap is not implemented.
+	fmt.Fprintf(buf, "Swap:           %8d kB\n", 0)
+	fmt.Fprintf(buf, "SwapPss:        %8d kB\n", 0)
+	fmt.Fprintf(buf, "Locked:         %8d kB\n", stats.locked>>pssShift/1024)
+}
+
+// Bits in /proc/[pid]/pagemap entries, from Linux's fs/proc/task_mmu.c.
+const (
+	// PagemapEntrySize is the size of a /proc/[pid]/pagemap entry in bytes.
+	PagemapEntrySize = 8
+
+	pagemapSoftDirty     = 1 << 55
+	pagemapMMapExclusive = 1 << 56
+	pagemapFile          = 1 << 61
+	pagemapPresent       = 1 << 63
+)
+
+// PagemapEnd returns the address at which the entries of
+// /proc/[pid]/pagemap end.
+func (mm *MemoryManager) PagemapEnd() hostarch.Addr {
+	return mm.layout.MaxAddr
+}
+
+// ReadPagemapInto is called by fsimpl/proc.pagemapFD.PRead to implement
+// /proc/[pid]/pagemap. It sets entries[i] to the pagemap entry for the page at
+// start + i*hostarch.PageSize.
+//
+// Page frame numbers are never reported, as if the reader lacked
+// CAP_SYS_ADMIN in Linux, so entries only carry flags. Pages are present if
+// they are mapped by a pma and resident in memory. Since soft-dirty bits
+// can't be cleared via /proc/[pid]/clear_refs, all pages in vmas are
+// soft-dirty, as in Linux for vmas with VM_SOFTDIRTY.
+//
+// Preconditions: start must be page-aligned. start + len(entries) *
+// hostarch.PageSize must not exceed mm.PagemapEnd().
+func (mm *MemoryManager) ReadPagemapInto(ctx context.Context, start hostarch.Addr, entries []uint64) {
+	for i := range entries {
+		entries[i] = 0
+	}
+	ar := hostarch.AddrRange{start, start + hostarch.Addr(len(entries))*hostarch.PageSize}
+	index := func(addr hostarch.Addr) int {
+		return int((addr - start) / hostarch.PageSize)
+	}
+
+	// FIXME(b/235153601): Need to replace RLockBypass with RLockBypass
+	// after fixing b/235153601.
+	mm.mappingMu.RLockBypass()
+	defer mm.mappingMu.RUnlockBypass()
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vsegAR := vseg.Range().Intersect(ar)
+		for i, end := index(vsegAR.Start), index(vsegAR.End); i < end; i++ {
+			entries[i] = pagemapSoftDirty
+		}
+		for pseg := mm.pmas.LowerBoundSegment(vsegAR.Start); pseg.Ok() && pseg.Start() < vsegAR.End; pseg = pseg.NextSegment() {
+			flags := uint64(pagemapPresent)
+			if !pseg.ValuePtr().private {
+				// File pages and shared anonymous pages.
+				flags |= pagemapFile
+			}
+			mm.forEachResidentRangeLocked(pseg, pseg.Range().Intersect(vsegAR), func(rar hostarch.AddrRange, _ uint64, mapcount int32) {
+				entryFlags := flags
+				if mapcount == 1 {
+					entryFlags |= pagemapMMapExclusive
+				}
+				for i, end := index(rar.Start), index(rar.End); i < end; i++ {
+					entries[i] |= entryFlags
+				}
+			})
+		}
+	}
+}
@@ -131,3 +131,35 @@ func (m *SpecialMappable) FileRange() memmap.FileRange {
 func (m *SpecialMappable) Length() uint64 {
 	return m.fr.Length()
 }
+
+// ReplaceSpecialMappable replaces all mappings of old in mm with mappings of
+// new at the same addresses, with the same offsets and permissions.
+func (mm *MemoryManager) ReplaceSpecialMappable(ctx context.Context, old, new *SpecialMappable) error {
+	var opts []memmap.MMapOpts
+	mm.mappingMu.RLock()
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		if vma.mappable != old {
+			continue
+		}
+		opts = append(opts, memmap.MMapOpts{
+			Length:          uint64(vseg.Range().Length()),
+			MappingIdentity: new,
+			Mappable:        new,
+			Offset:          vma.off,
+			Addr:            vseg.Start(),
+			Fixed:           true,
+			Unmap:           true,
+			Private:         vma.private,
+			Perms:           vma.realPerms,
+			MaxPerms:        vma.maxPerms,
+		})
+	}
+	mm.mappingMu.RUnlock()
+	for _, o := range opts {
+		if _, err := mm.MMap(ctx, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/swap"
+)
+
+// swapEntries is the value type of swapSet. It holds one swap.Entry for each
+// page in the segment, on which it holds a reference.
+//
+// +stateify savable
+type swapEntries struct {
+	entries []*swap.Entry
+}
+
+// swapSetFunctions implements segment.Functions for swapSet.
+type swapSetFunctions struct{}
+
+func (swapSetFunctions) MinKey() hostarch.Addr {
+	return 0
+}
+
+func (swapSetFunctions) MaxKey() hostarch.Addr {
+	return ^hostarch.Addr(0)
+}
+
+func (swapSetFunctions) ClearValue(se *swapEntries) {
+	se.entries = nil
+}
+
+func (swapSetFunctions) Merge(ar1 hostarch.AddrRange, se1 swapEntries, ar2 hostarch.AddrRange, se2 swapEntries) (swapEntries, bool) {
+	// Limit the capacity of se1.entries so that append copies it rather than
+	// overwriting entries that may still be referenced by another segment.
+	n := len(se1.entries)
+	return swapEntries{append(se1.entries[:n:n], se2.entries...)}, true
+}
+
+func (swapSetFunctions) Split(ar hostarch.AddrRange, se swapEntries, split hostarch.Addr) (swapEntries, swapEntries) {
+	n := int((split - ar.Start) / hostarch.PageSize)
+	return swapEntries{se.entries[:n:n]}, swapEntries{se.entries[n:]}
+}
+
+// SwapOut moves up to target bytes of mm's private anonymous memory into pool,
+// and returns the number of bytes moved.
+//
+// Pages are selected by a clock (second chance) algorithm over pmas: a pma
+// that has been referenced since it was last examined is unmapped from the
+// AddressSpace, so that the next application access to it faults and marks
+// it referenced again, and is skipped; otherwise its pages are swapped out.
+// Pages are swapped in again when they are next accessed.
+//
+// SwapOut skips memory that is mlocked or shared with other MemoryManagers
+// after fork.
+func (mm *MemoryManager) SwapOut(ctx context.Context, pool *swap.Pool, target uint64) uint64 {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	var done uint64
+	start := mm.swapCursor
+	wrapped := false
+	pseg := mm.pmas.LowerBoundSegment(start)
+	for done < target {
+		if !pseg.Ok() || (wrapped && pseg.Start() >= start) {
+			if wrapped {
+				break
+			}
+			wrapped = true
+			pseg = mm.pmas.FirstSegment()
+			continue
+		}
+		mm.swapCursor = pseg.End()
+		if !mm.canSwapOutLocked(pseg) {
+			pseg = pseg.NextSegment()
+			continue
+		}
+		if pma := pseg.ValuePtr(); pma.referenced {
+			pma.referenced = false
+			mm.unmapASLocked(pseg.Range())
+			pseg = pseg.NextSegment()
+			continue
+		}
+
+		ar := pseg.Range()
+		if remaining := hostarch.Addr(target - done); ar.Length() > remaining {
+			// target - done is less than the pma's length, so rounding it up
+			// can't overflow.
+			ar.End = ar.Start + remaining.MustRoundUp()
+		}
+		pseg = mm.pmas.Isolate(pseg, ar)
+		// Prevent the application from modifying the pages while they are
+		// copied.
+		mm.unmapASLocked(ar)
+		entries, err := mm.swapOutPagesLocked(pseg, pool)
+		if len(entries) != 0 {
+			swappedAR := hostarch.AddrRange{ar.Start, ar.Start + hostarch.Addr(len(entries))*hostarch.PageSize}
+			pseg = mm.pmas.Isolate(pseg, swappedAR)
+			mm.decPrivateRef(pseg.fileRange())
+			pseg.ValuePtr().file.DecRef(pseg.fileRange())
+			mm.removeRSSLocked(swappedAR)
+			pseg = mm.pmas.Remove(pseg).NextSegment()
+			mm.swapped.Add(swappedAR, swapEntries{entries})
+			done += uint64(swappedAR.Length())
+		} else {
+			pseg = pseg.NextSegment()
+		}
+		if err != nil {
+			if err != swap.ErrFull {
+				log.Warningf("Failed to swap out %v: %v", ar, err)
+			}
+			break
+		}
+	}
+	return done
+}
+
+// canSwapOutLocked returns true if the memory mapped by pseg may be swapped
+// out.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked.
+//   - mm.activeMu must be locked.
+func (mm *MemoryManager) canSwapOutLocked(pseg pmaIterator) bool {
+	pma := pseg.ValuePtr()
+	if !pma.private || pma.file != mm.mfp.MemoryFile() {
+		return false
+	}
+	vseg := mm.vmas.FindSegment(pseg.Start())
+	if !vseg.Ok() || !vseg.Range().IsSupersetOf(pseg.Range()) {
+		return false
+	}
+	if vma := vseg.ValuePtr(); vma.mappable != nil || vma.mlockMode != memmap.MLockNone {
+		return false
+	}
+	// Swapping out memory that is shared with another MemoryManager wouldn't
+	// free it.
+	fr := pseg.fileRange()
+	mm.privateRefs.mu.Lock()
+	defer mm.privateRefs.mu.Unlock()
+	for seg := mm.privateRefs.refs.LowerBoundSegment(fr.Start); seg.Ok() && seg.Start() < fr.End; seg = seg.NextSegment() {
+		if seg.Value() != 1 {
+			return false
+		}
+	}
+	return !mm.isSharedLocked(fr)
+}
+
+// swapOutPagesLocked stores the pages mapped by pseg in pool, stopping at the
+// first page that can't be stored. It returns entries for the stored pages,
+// and a non-nil error if not all pages were stored.
+//
+// Preconditions:
+//   - mm.activeMu must be locked for writing.
+//   - AddressSpace mappings of pseg must have been removed.
+func (mm *MemoryManager) swapOutPagesLocked(pseg pmaIterator, pool *swap.Pool) ([]*swap.Entry, error) {
+	mf := mm.mfp.MemoryFile()
+	fr := pseg.fileRange()
+	entries := make([]*swap.Entry, 0, fr.Length()/hostarch.PageSize)
+	buf := make([]byte, hostarch.PageSize)
+	for off := fr.Start; off < fr.End; off += hostarch.PageSize {
+		ims, err := mf.MapInternal(memmap.FileRange{off, off + hostarch.PageSize}, hostarch.Read)
+		if err != nil {
+			return entries, err
+		}
+		if _, err := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf)), ims); err != nil {
+			return entries, err
+		}
+		e, err := pool.Store(buf)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// swapInLocked copies swapped pages in ar into the newly-allocated memory at
+// fr, and discards them.
+//
+// Preconditions:
+//   - mm.activeMu must be locked for writing.
+//   - fr.Length() == ar.Length().
+func (mm *MemoryManager) swapInLocked(ar hostarch.AddrRange, fr memmap.FileRange) error {
+	if mm.swapped.IsEmpty() {
+		return nil
+	}
+	mf := mm.mfp.MemoryFile()
+	var buf []byte
+	for sseg := mm.swapped.LowerBoundSegment(ar.Start); sseg.Ok() && sseg.Start() < ar.End; sseg = sseg.NextSegment() {
+		sar := sseg.Range().Intersect(ar)
+		entries := sseg.ValuePtr().entries[(sar.Start-sseg.Start())/hostarch.PageSize:]
+		for addr := sar.Start; addr < sar.End; addr += hostarch.PageSize {
+			if buf == nil {
+				buf = make([]byte, hostarch.PageSize)
+			}
+			if err := entries[0].Load(buf); err != nil {
+				return err
+			}
+			entries = entries[1:]
+			off := fr.Start + uint64(addr-ar.Start)
+			ims, err := mf.MapInternal(memmap.FileRange{off, off + hostarch.PageSize}, hostarch.Write)
+			if err != nil {
+				return err
+			}
+			if _, err := safemem.CopySeq(ims, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf))); err != nil {
+				return err
+			}
+		}
+	}
+	mm.discardSwapLocked(ar)
+	return nil
+}
+
+// discardSwapLocked discards swapped pages in ar.
+//
+// Preconditions:
+//   - mm.activeMu must be locked for writing.
+//   - ar must be page-aligned.
+func (mm *MemoryManager) discardSwapLocked(ar hostarch.AddrRange) {
+	sseg := mm.swapped.LowerBoundSegment(ar.Start)
+	for sseg.Ok() && sseg.Start() < ar.End {
+		sseg = mm.swapped.Isolate(sseg, ar)
+		for _, e := range sseg.ValuePtr().entries {
+			e.DecRef()
+		}
+		sseg = mm.swapped.Remove(sseg).NextSegment()
+	}
+}
+
+// moveSwapLocked moves all swapped pages in oldAR to newAR.
+//
+// Preconditions: Same as movePMAsLocked.
+func (mm *MemoryManager) moveSwapLocked(oldAR, newAR hostarch.AddrRange) {
+	type movedSwap struct {
+		oldAR hostarch.AddrRange
+		se    swapEntries
+	}
+	var moved []movedSwap
+	sseg := mm.swapped.LowerBoundSegment(oldAR.Start)
+	for sseg.Ok() && sseg.Start() < oldAR.End {
+		sseg = mm.swapped.Isolate(sseg, oldAR)
+		moved = append(moved, movedSwap{
+			oldAR: sseg.Range(),
+			se:    sseg.Value(),
+		})
+		sseg = mm.swapped.Remove(sseg).NextSegment()
+	}
+	off := newAR.Start - oldAR.Start
+	for _, m := range moved {
+		mm.swapped.Add(hostarch.AddrRange{m.oldAR.Start + off, m.oldAR.End + off}, m.se)
+	}
+}
+
+// forkSwapLocked copies swapped pages in mm to mm2, for addresses at which
+// mm2 has vmas.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked.
+//   - mm.activeMu and mm2.activeMu must be locked for writing.
+func (mm *MemoryManager) forkSwapLocked(mm2 *MemoryManager) {
+	for sseg := mm.swapped.FirstSegment(); sseg.Ok(); sseg = sseg.NextSegment() {
+		for vseg := mm2.vmas.LowerBoundSegment(sseg.Start()); vseg.Ok() && vseg.Start() < sseg.End(); vseg = vseg.NextSegment() {
+			ar := vseg.Range().Intersect(sseg.Range())
+			first := (ar.Start - sseg.Start()) / hostarch.PageSize
+			entries := append([]*swap.Entry(nil), sseg.ValuePtr().entries[first:first+ar.Length()/hostarch.PageSize]...)
+			for _, e := range entries {
+				e.IncRef()
+			}
+			mm2.swapped.Add(ar, swapEntries{entries})
+		}
+	}
+}
@@ -1016,8 +1016,9 @@ func (mm *MemoryManager) NumaPolicy(addr hostarch.Addr) (linux.NumaPolicy, uint6
 	return vma.numaPolicy, vma.numaNodemask, nil
 }
 
-// SetNumaPolicy implements the semantics of Linux's mbind().
-func (mm *MemoryManager) SetNumaPolicy(addr hostarch.Addr, length uint64, policy linux.NumaPolicy, nodemask uint64) error {
+// SetNumaPolicy implements the semantics of Linux's mbind(). If move is true,
+// existing memory in the range is moved to conform to the new policy.
+func (mm *MemoryManager) SetNumaPolicy(addr hostarch.Addr, length uint64, policy linux.NumaPolicy, nodemask uint64, move bool) error {
 	if !addr.IsPageAligned() {
 		return linuxerr.EINVAL
 	}
@@ -1051,6 +1052,11 @@ func (mm *MemoryManager) SetNumaPolicy(addr hostarch.Addr, length uint64, policy
 		vma.numaNodemask = nodemask
 		lastEnd = vseg.End()
 		if ar.End <= lastEnd {
+			if move {
+				mm.activeMu.Lock()
+				mm.resetNodesLocked(ar)
+				mm.activeMu.Unlock()
+			}
 			return nil
 		}
 		vseg, _ = vseg.NextNonEmpty()
@@ -1083,6 +1089,36 @@ func (mm *MemoryManager) SetDontFork(addr hostarch.Addr, length uint64, dontfork
 	return nil
 }
 
+// SetMergeable implements the semantics of madvise MADV_MERGEABLE and
+// MADV_UNMERGEABLE.
+//
+// Unlike Linux, MADV_UNMERGEABLE does not eagerly unmerge pages that have
+// already been merged; they are copied when they are next written to.
+func (mm *MemoryManager) SetMergeable(addr hostarch.Addr, length uint64, mergeable bool) error {
+	ar, ok := addr.ToRange(length)
+	if !ok {
+		return linuxerr.EINVAL
+	}
+
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+	defer func() {
+		mm.vmas.MergeRange(ar)
+		mm.vmas.MergeAdjacent(ar)
+	}()
+
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vseg = mm.vmas.Isolate(vseg, ar)
+		vma := vseg.ValuePtr()
+		vma.mergeable = mergeable
+	}
+
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return linuxerr.ENOMEM
+	}
+	return nil
+}
+
 // Decommit implements the semantics of Linux's madvise(MADV_DONTNEED).
 func (mm *MemoryManager) Decommit(addr hostarch.Addr, length uint64) error {
 	ar, ok := addr.ToRange(length)
@@ -1106,6 +1142,7 @@ func (mm *MemoryManager) Decommit(addr hostarch.Addr, length uint64) error {
 			return linuxerr.EINVAL
 		}
 		vsegAR := vseg.Range().Intersect(ar)
+		mm.discardSwapLocked(vsegAR)
 		// pseg should already correspond to either this vma or a later one,
 		// since there can't be a pma without a corresponding vma.
 		if checkInvariants {
@@ -0,0 +1,219 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"os"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/hostmm"
+)
+
+// A CleanEvictableMemoryUser is an EvictableMemoryUser that can evict only
+// memory that does not need to be written back before it is deallocated.
+// The cache reclaimer evicts clean memory from all such users before evicting
+// memory that must be written back.
+type CleanEvictableMemoryUser interface {
+	EvictableMemoryUser
+
+	// EvictClean is equivalent to Evict, except that it only deallocates
+	// memory in er that does not need to be written back. Ranges in er that
+	// are not evicted must be marked evictable again by calling
+	// MemoryFile.MarkEvictable; EvictClean may do so with the locks that
+	// usually protect calls to MarkEvictable held.
+	EvictClean(ctx context.Context, er EvictableRange)
+}
+
+// evictableLength returns the total length of the ranges in ranges.
+func evictableLength(ranges *evictableRangeSet) uint64 {
+	var total uint64
+	for seg := ranges.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		total += seg.Range().Length()
+	}
+	return total
+}
+
+// SetCacheReclaimWatermarks configures f to evict evictable allocations
+// (typically file page cache) whenever their total size exceeds high, until
+// it is at most low. Allocations are evicted from the least recently used
+// EvictableMemoryUser first, and clean memory is evicted before memory that
+// must be written back. If high is 0, the cache reclaimer is disabled, and
+// evictions are delayed as specified by MemoryFileOpts.DelayedEviction.
+//
+// SetCacheReclaimWatermarks has no effect unless MemoryFileOpts.DelayedEviction
+// is DelayedEvictionEnabled.
+//
+// Preconditions: low < high, unless high is 0.
+func (f *MemoryFile) SetCacheReclaimWatermarks(low, high uint64) {
+	if f.opts.DelayedEviction != DelayedEvictionEnabled {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cacheReclaimLow.Store(low)
+	f.cacheReclaimHigh.Store(high)
+	f.maybeStartCacheReclaimLocked()
+}
+
+// NotifyHostMemoryPressure requests that f reclaims cache each time the host
+// pressure stall information trigger registered on file fires; see
+// hostmm.NotifyPressureTriggerCallback. If the cache reclaimer is enabled,
+// evictable allocations are evicted down to the low watermark; otherwise, all
+// evictable allocations are evicted. Ownership of file is transferred to f.
+//
+// NotifyHostMemoryPressure may be called at most once.
+func (f *MemoryFile) NotifyHostMemoryPressure(file *os.File) error {
+	stop, err := hostmm.NotifyPressureTriggerCallback(file, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.cacheReclaimHigh.RacyLoad() != 0 {
+			if f.evictableBytes > f.cacheReclaimLow.RacyLoad() {
+				log.Debugf("pgalloc.MemoryFile reclaiming cache due to host memory pressure")
+				f.startCacheReclaimLocked()
+			}
+		} else if f.startEvictionsLocked() {
+			log.Debugf("pgalloc.MemoryFile performing evictions due to host memory pressure")
+		}
+	})
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.stopNotifyHostPressure = stop
+	f.mu.Unlock()
+	return nil
+}
+
+// maybeStartCacheReclaimLocked starts the cache reclaimer goroutine if
+// evictable allocations exceed the high watermark.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) maybeStartCacheReclaimLocked() {
+	if high := f.cacheReclaimHigh.RacyLoad(); high != 0 && f.evictableBytes > high {
+		f.startCacheReclaimLocked()
+	}
+}
+
+// startCacheReclaimLocked starts the cache reclaimer goroutine, unless it is
+// already running.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) startCacheReclaimLocked() {
+	if f.cacheReclaiming || f.destroyed {
+		return
+	}
+	f.cacheReclaiming = true
+	f.evictionWG.Add(1)
+	go f.runCacheReclaim() // S/R-SAFE: f.evictionWG
+}
+
+// runCacheReclaim implements the cache reclaimer goroutine, which evicts
+// evictable allocations until their total size is at most the low watermark.
+//
+// Eviction proceeds in two passes. First, each EvictableMemoryUser that
+// implements CleanEvictableMemoryUser is asked to evict the clean part of
+// all of its evictable ranges, least recently used first. Then, ranges are
+// evicted in full, again from the least recently used user first.
+func (f *MemoryFile) runCacheReclaim() {
+	defer f.evictionWG.Done()
+	ctx := context.Background()
+	// cleaned contains the users whose clean memory has already been evicted
+	// in this run.
+	cleaned := make(map[EvictableMemoryUser]struct{})
+	for {
+		f.mu.Lock()
+		if f.destroyed || f.evictableBytes <= f.cacheReclaimLow.RacyLoad() {
+			f.cacheReclaiming = false
+			f.mu.Unlock()
+			return
+		}
+		user, info, clean := f.cacheReclaimVictimLocked(cleaned)
+		if user == nil {
+			// The remaining evictable ranges are being evicted by eviction
+			// goroutines.
+			f.cacheReclaiming = false
+			f.mu.Unlock()
+			return
+		}
+		var ers []EvictableRange
+		if clean {
+			cleaned[user] = struct{}{}
+			for seg := info.ranges.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+				ers = append(ers, seg.Range())
+			}
+			f.evictableBytes -= evictableLength(&info.ranges)
+			info.ranges.RemoveAll()
+		} else {
+			// As in startEvictionGoroutineLocked, evict from the end of
+			// info.ranges.
+			seg := info.ranges.LastSegment()
+			ers = append(ers, seg.Range())
+			f.evictableBytes -= seg.Range().Length()
+			info.ranges.Remove(seg)
+		}
+		// user.Evict() and user.EvictClean() must be called without holding
+		// f.mu to avoid circular lock ordering.
+		f.mu.Unlock()
+		for _, er := range ers {
+			if clean {
+				user.(CleanEvictableMemoryUser).EvictClean(ctx, er)
+			} else {
+				user.Evict(ctx, er)
+			}
+		}
+		f.mu.Lock()
+		// info may have been removed from f.evictable, and replaced, while
+		// f.mu was unlocked.
+		if f.evictable[user] == info && !info.evicting && info.ranges.IsEmpty() {
+			delete(f.evictable, user)
+		}
+		f.mu.Unlock()
+	}
+}
+
+// cacheReclaimVictimLocked returns the least recently used
+// EvictableMemoryUser with evictable ranges that aren't already being evicted
+// by an eviction goroutine, preferring users that implement
+// CleanEvictableMemoryUser and are not in cleaned. clean is true if the
+// returned user's clean memory should be evicted. If there is no such user,
+// cacheReclaimVictimLocked returns a nil user.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) cacheReclaimVictimLocked(cleaned map[EvictableMemoryUser]struct{}) (user EvictableMemoryUser, info *evictableMemoryUserInfo, clean bool) {
+	var cleanUser, dirtyUser EvictableMemoryUser
+	var cleanInfo, dirtyInfo *evictableMemoryUserInfo
+	for u, i := range f.evictable {
+		if i.evicting || i.ranges.IsEmpty() {
+			continue
+		}
+		if dirtyInfo == nil || i.lastUsed < dirtyInfo.lastUsed {
+			dirtyUser, dirtyInfo = u, i
+		}
+		if _, ok := u.(CleanEvictableMemoryUser); !ok {
+			continue
+		}
+		if _, ok := cleaned[u]; ok {
+			continue
+		}
+		if cleanInfo == nil || i.lastUsed < cleanInfo.lastUsed {
+			cleanUser, cleanInfo = u, i
+		}
+	}
+	if cleanUser != nil {
+		return cleanUser, cleanInfo, true
+	}
+	return dirtyUser, dirtyInfo, false
+}
@@ -30,6 +30,10 @@ const (
 
 	// CtxMemoryCgroupID is the memory cgroup id which the task belongs to.
 	CtxMemoryCgroupID
+
+	// CtxChunkStore is a Context.Value key for the *chunkstore.Store that
+	// MemoryFile.SaveTo and MemoryFile.LoadFrom store page contents in.
+	CtxChunkStore
 )
 
 // MemoryFileFromContext returns the MemoryFile used by ctx, or nil if no such
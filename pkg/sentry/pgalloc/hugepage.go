@@ -0,0 +1,197 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+var (
+	hugepageCollapses        = metric.MustCreateNewUint64Metric("/memory/hugepage_collapses", false /* sync */, "Number of hugepage-sized regions of the memory file that were collapsed into host transparent hugepages.")
+	hugepageCollapseFailures = metric.MustCreateNewUint64Metric("/memory/hugepage_collapse_failures", false /* sync */, "Number of failed attempts to collapse hugepage-sized regions of the memory file into host transparent hugepages.")
+)
+
+// maxHugepageCollapsesPerScan is the maximum number of hugepage-sized regions
+// that the hugepage collapser goroutine attempts to collapse per scan, which
+// bounds the time spent in each scan (cf. khugepaged's pages_to_scan).
+const maxHugepageCollapsesPerScan = 64
+
+// HugepageMode is the type of MemoryFileOpts.Hugepages.
+type HugepageMode int
+
+const (
+	// HugepagesDefault leaves the use of host transparent hugepages to the
+	// host's defaults (/sys/kernel/mm/transparent_hugepage/shmem_enabled).
+	HugepagesDefault HugepageMode = iota
+
+	// HugepagesAdvise marks the MemoryFile's mappings with MADV_HUGEPAGE, so
+	// that the host backs hugepage-aligned allocations with transparent
+	// hugepages when shmem_enabled is "advise" or "within_size".
+	HugepagesAdvise
+
+	// HugepagesCollapse behaves like HugepagesAdvise, and additionally starts
+	// a goroutine that periodically collapses hugepage-sized regions that are
+	// entirely allocated and committed, but backed by small pages, into
+	// transparent hugepages (MADV_COLLAPSE).
+	HugepagesCollapse
+)
+
+// String implements fmt.Stringer.String.
+func (m HugepageMode) String() string {
+	switch m {
+	case HugepagesDefault:
+		return "default"
+	case HugepagesAdvise:
+		return "advise"
+	case HugepagesCollapse:
+		return "collapse"
+	default:
+		return fmt.Sprintf("HugepageMode(%d)", int(m))
+	}
+}
+
+// adviseHugepages applies MADV_HUGEPAGE to the chunk mapping at m, if
+// requested by f.opts.Hugepages.
+func (f *MemoryFile) adviseHugepages(m uintptr) {
+	if f.opts.Hugepages == HugepagesDefault {
+		return
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_MADVISE, m, chunkSize, unix.MADV_HUGEPAGE); errno != 0 {
+		// This is only a performance hint; e.g. the host may have been built
+		// without CONFIG_TRANSPARENT_HUGEPAGE.
+		log.Warningf("Failed to madvise(MADV_HUGEPAGE) MemoryFile mapping %#x: %v", m, errno)
+	}
+}
+
+// runHugepageCollapse implements the hugepage collapser goroutine, which
+// periodically collapses hugepage-sized regions of f that are entirely
+// allocated and known to be committed into host transparent hugepages.
+//
+// Regions are only known to be committed after f.UpdateUsage has observed
+// them to be resident, so this only targets memory that is both densely
+// allocated and in use. This is analogous to what khugepaged does for
+// application memory on Linux; it reduces TLB misses for workloads with large
+// working sets, since app mappings of a collapsed region may be mapped by
+// PMDs, and on the KVM platform the sentry's mappings of f are the guest's
+// physical memory.
+func (f *MemoryFile) runHugepageCollapse() {
+	ticker := time.NewTicker(f.opts.HugepageCollapseInterval)
+	defer ticker.Stop()
+	var cursor uint64
+	for range ticker.C {
+		f.mu.Lock()
+		if f.destroyed {
+			f.mu.Unlock()
+			return
+		}
+		frs := f.findCollapsibleLocked(cursor, maxHugepageCollapsesPerScan)
+		if len(frs) == 0 {
+			cursor = 0
+		} else {
+			cursor = frs[len(frs)-1].End
+		}
+		f.mu.Unlock()
+
+		for _, fr := range frs {
+			var err error
+			if ferr := f.forEachMappingSlice(fr, func(bs []byte) {
+				if err == nil {
+					err = unix.Madvise(bs, unix.MADV_COLLAPSE)
+				}
+			}); ferr != nil {
+				err = ferr
+			}
+			if err == unix.EINVAL {
+				// MADV_COLLAPSE requires Linux 6.1, and is not supported for
+				// shmem on some configurations.
+				log.Infof("Hugepage collapse is not supported, stopping: %v", err)
+				return
+			}
+			if err != nil {
+				// The host may have failed to allocate a hugepage (EAGAIN,
+				// ENOMEM); the region will be retried on a later scan.
+				log.Debugf("Failed to collapse %v into a hugepage: %v", fr, err)
+				hugepageCollapseFailures.Increment()
+				continue
+			}
+			hugepageCollapses.Increment()
+			f.mu.Lock()
+			f.collapsed[fr.Start] = struct{}{}
+			f.mu.Unlock()
+		}
+	}
+}
+
+// findCollapsibleLocked returns up to max hugepage-sized ranges, starting at
+// or after offset start, that are entirely allocated and known to be
+// committed, and have not already been collapsed.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) findCollapsibleLocked(start uint64, max int) []memmap.FileRange {
+	var frs []memmap.FileRange
+	// [runStart, runEnd) is the current range of contiguous segments that are
+	// allocated and known to be committed.
+	var runStart, runEnd uint64
+	for seg := f.usage.LowerBoundSegment(start); seg.Ok() && len(frs) < max; seg = seg.NextSegment() {
+		val := seg.ValuePtr()
+		if val.refs == 0 || !val.knownCommitted {
+			runStart, runEnd = 0, 0
+			continue
+		}
+		if seg.Start() != runEnd || runEnd == 0 {
+			runStart = seg.Start()
+		}
+		runEnd = seg.End()
+		hStart, ok := hostarch.Addr(runStart).HugeRoundUp()
+		if !ok {
+			continue
+		}
+		for h := uint64(hStart); h+hostarch.HugePageSize <= runEnd && len(frs) < max; h += hostarch.HugePageSize {
+			if h < start {
+				continue
+			}
+			if _, ok := f.collapsed[h]; ok {
+				continue
+			}
+			frs = append(frs, memmap.FileRange{h, h + hostarch.HugePageSize})
+		}
+		// Don't consider hugepages in this run again for the next segment.
+		if end := hostarch.Addr(runEnd).HugeRoundDown(); uint64(end) > runStart {
+			runStart = uint64(end)
+		}
+	}
+	return frs
+}
+
+// forgetCollapsedLocked records that hugepage-sized regions overlapping fr may
+// no longer be backed by hugepages.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) forgetCollapsedLocked(fr memmap.FileRange) {
+	if len(f.collapsed) == 0 {
+		return
+	}
+	start := uint64(hostarch.Addr(fr.Start).HugeRoundDown())
+	for h := start; h < fr.End; h += hostarch.HugePageSize {
+		delete(f.collapsed, h)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+// IdleReclaimLevel is the type of MemoryFileOpts.IdleReclaim.
+type IdleReclaimLevel int
+
+const (
+	// IdleReclaimDisabled disables the idle reclaimer goroutine. Freed pages
+	// are still decommitted by the reclaimer goroutine, and evictable
+	// allocations are still evicted according to
+	// MemoryFileOpts.DelayedEviction.
+	IdleReclaimDisabled IdleReclaimLevel = iota
+
+	// IdleReclaimCold requests that, while the MemoryFile is idle, allocated
+	// pages are marked as cold (MADV_COLD) so that the host reclaims them
+	// first under memory pressure, and a small fraction of evictable
+	// allocations is evicted on each interval.
+	IdleReclaimCold
+
+	// IdleReclaimPageOut requests that, while the MemoryFile is idle,
+	// allocated pages are paged out (MADV_PAGEOUT) immediately, and a large
+	// fraction of evictable allocations is evicted on each interval.
+	IdleReclaimPageOut
+)
+
+// String implements fmt.Stringer.String.
+func (l IdleReclaimLevel) String() string {
+	switch l {
+	case IdleReclaimDisabled:
+		return "off"
+	case IdleReclaimCold:
+		return "cold"
+	case IdleReclaimPageOut:
+		return "pageout"
+	default:
+		return fmt.Sprintf("IdleReclaimLevel(%d)", int(l))
+	}
+}
+
+// advice returns the madvise(2) advice applied to allocated pages at level l.
+func (l IdleReclaimLevel) advice() int {
+	if l == IdleReclaimPageOut {
+		return unix.MADV_PAGEOUT
+	}
+	return unix.MADV_COLD
+}
+
+// evictPercent returns the percentage of each EvictableMemoryUser's evictable
+// ranges that is evicted per idle interval at level l.
+func (l IdleReclaimLevel) evictPercent() uint64 {
+	if l == IdleReclaimPageOut {
+		return 50
+	}
+	return 10
+}
+
+// runIdleReclaim implements the idle reclaimer goroutine, which reduces the
+// host memory usage of a MemoryFile that has not allocated memory for at
+// least f.opts.IdleReclaimInterval.
+//
+// Pages that are freed by the application are already decommitted by the
+// reclaimer goroutine (see runReclaim); the idle reclaimer instead targets
+// pages that are still allocated, but are unlikely to be used soon because the
+// sandbox is idle:
+//
+//   - Allocated pages are passed to madvise(2) once per idle period. The host
+//     kernel skips pages that are also mapped by other processes (e.g. by
+//     application address spaces on the systrap and ptrace platforms), so this
+//     is most effective on the KVM platform and for memory that the
+//     application has not touched recently.
+//
+//   - Part of each user's evictable allocations (e.g. clean page cache) is
+//     evicted on every interval while the MemoryFile remains idle, so that
+//     caches shrink gradually rather than all at once.
+//
+// Allocated pages are never moved within the file: MemoryFile does not track
+// the mappings of its pages, so it cannot update them to refer to new
+// offsets.
+func (f *MemoryFile) runIdleReclaim() {
+	ticker := time.NewTicker(f.opts.IdleReclaimInterval)
+	defer ticker.Stop()
+	advice := f.opts.IdleReclaim.advice()
+	lastAllocations := uint64(0)
+	advised := false
+	for range ticker.C {
+		f.mu.Lock()
+		if f.destroyed {
+			f.mu.Unlock()
+			return
+		}
+		if f.allocations != lastAllocations {
+			// Not idle; wait for another interval.
+			lastAllocations = f.allocations
+			advised = false
+			f.mu.Unlock()
+			continue
+		}
+		if f.opts.DelayedEviction != DelayedEvictionManual {
+			f.startIdleEvictionsLocked()
+		}
+		var frs []memmap.FileRange
+		if !advised && advice >= 0 {
+			frs = f.allocatedRangesLocked()
+			advised = true
+		}
+		f.mu.Unlock()
+
+		// madvise(2) may be slow for large ranges, so it is called without
+		// holding f.mu. If the MemoryFile is destroyed concurrently, this may
+		// advise on mappings that have been unmapped, which is harmless.
+		if err := f.adviseRanges(frs, advice); err == unix.EINVAL {
+			// The host kernel does not support advice (MADV_COLD and
+			// MADV_PAGEOUT require Linux 5.4).
+			log.Infof("Idle reclaim: madvise(%d) is not supported, disabling it: %v", advice, err)
+			advice = -1
+		}
+	}
+}
+
+// ReclaimAllocated immediately applies the madvise(2) advice of level to all
+// allocated pages, whether or not f is idle. This allows memory to be
+// reclaimed on demand, e.g. when the host is under memory pressure.
+func (f *MemoryFile) ReclaimAllocated(level IdleReclaimLevel) error {
+	if level == IdleReclaimDisabled {
+		return nil
+	}
+	f.mu.Lock()
+	frs := f.allocatedRangesLocked()
+	f.mu.Unlock()
+	// See runIdleReclaim for why f.mu isn't held.
+	return f.adviseRanges(frs, level.advice())
+}
+
+// adviseRanges calls madvise(2) with the given advice on the mappings of frs.
+// It stops and returns unix.EINVAL if the host does not support advice, and
+// otherwise returns the first error encountered.
+func (f *MemoryFile) adviseRanges(frs []memmap.FileRange, advice int) error {
+	var firstErr error
+	for _, fr := range frs {
+		var err error
+		if ferr := f.forEachMappingSlice(fr, func(bs []byte) {
+			if err == nil {
+				err = unix.Madvise(bs, advice)
+			}
+		}); ferr != nil {
+			err = ferr
+		}
+		if err == unix.EINVAL {
+			return err
+		}
+		if err != nil {
+			log.Warningf("Failed to madvise(%d) %v: %v", advice, fr, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// allocatedRangesLocked returns the allocated ranges in f, with adjacent
+// ranges merged.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) allocatedRangesLocked() []memmap.FileRange {
+	var frs []memmap.FileRange
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.ValuePtr().refs == 0 {
+			// Waiting to be reclaimed.
+			continue
+		}
+		fr := seg.Range()
+		if n := len(frs); n != 0 && frs[n-1].End == fr.Start {
+			frs[n-1].End = fr.End
+		} else {
+			frs = append(frs, fr)
+		}
+	}
+	return frs
+}
+
+// startIdleEvictionsLocked starts evicting a fraction of each evictable user's
+// evictable ranges, as determined by f.opts.IdleReclaim.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) startIdleEvictionsLocked() {
+	percent := f.opts.IdleReclaim.evictPercent()
+	for user, info := range f.evictable {
+		if info.evicting {
+			continue
+		}
+		var total uint64
+		for seg := info.ranges.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+			total += seg.Range().Length()
+		}
+		if total == 0 {
+			continue
+		}
+		// Evict at least one range so that small caches also shrink.
+		limit := total * percent / 100
+		if limit == 0 {
+			limit = 1
+		}
+		f.startEvictionGoroutineLocked(user, info, limit)
+	}
+}
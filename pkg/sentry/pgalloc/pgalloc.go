@@ -171,18 +171,53 @@ type MemoryFile struct {
 	// transitions from false to true.
 	reclaimCond sync.Cond
 
+	// allocations is the number of successful calls to allocate. It is used
+	// by the idle reclaimer goroutine to detect idleness. allocations is
+	// protected by mu.
+	allocations uint64
+
+	// collapsed contains the offsets of hugepage-sized regions that the
+	// hugepage collapser goroutine has collapsed into host hugepages, and
+	// that have not been decommitted since. collapsed is protected by mu.
+	collapsed map[uint64]struct{}
+
 	// evictable maps EvictableMemoryUsers to eviction state.
 	//
 	// evictable is protected by mu.
 	evictable map[EvictableMemoryUser]*evictableMemoryUserInfo
 
+	// evictableBytes is the total length of the ranges in evictable.
+	//
+	// evictableBytes is protected by mu.
+	evictableBytes uint64
+
+	// evictableSeq is incremented by each call to MarkEvictable, and orders
+	// EvictableMemoryUsers by how recently they used their evictable
+	// allocations. evictableSeq is protected by mu.
+	evictableSeq uint64
+
 	// evictionWG counts the number of goroutines currently performing evictions.
 	evictionWG sync.WaitGroup
 
+	// cacheReclaimLow and cacheReclaimHigh are the watermarks set by
+	// SetCacheReclaimWatermarks. They are accessed using atomic memory
+	// operations, and are only modified with mu locked.
+	cacheReclaimLow  atomicbitops.Uint64
+	cacheReclaimHigh atomicbitops.Uint64
+
+	// cacheReclaiming is true if the cache reclaimer goroutine is running.
+	// cacheReclaiming is protected by mu.
+	cacheReclaiming bool
+
 	// stopNotifyPressure stops memory cgroup pressure level
 	// notifications used to drive eviction. stopNotifyPressure is
 	// immutable.
 	stopNotifyPressure func()
+
+	// stopNotifyHostPressure stops the host pressure stall notifications
+	// requested by NotifyHostMemoryPressure. stopNotifyHostPressure is
+	// protected by mu.
+	stopNotifyHostPressure func()
 }
 
 // MemoryFileOpts provides options to NewMemoryFile.
@@ -212,6 +247,25 @@ type MemoryFileOpts struct {
 
 	// DiskBackedFile indicates that the MemoryFile is backed by a file on disk.
 	DiskBackedFile bool
+
+	// IdleReclaim controls how aggressively the idle reclaimer goroutine
+	// releases host memory while the MemoryFile is idle.
+	IdleReclaim IdleReclaimLevel
+
+	// IdleReclaimInterval is the period without allocations after which the
+	// MemoryFile is considered idle, and the interval at which the idle
+	// reclaimer runs while it remains idle. IdleReclaimInterval must be
+	// positive unless IdleReclaim is IdleReclaimDisabled.
+	IdleReclaimInterval time.Duration
+
+	// Hugepages controls the use of host transparent hugepages to back the
+	// MemoryFile.
+	Hugepages HugepageMode
+
+	// HugepageCollapseInterval is the interval at which the hugepage
+	// collapser goroutine scans the MemoryFile. HugepageCollapseInterval
+	// must be positive if Hugepages is HugepagesCollapse.
+	HugepageCollapseInterval time.Duration
 }
 
 // DelayedEvictionType is the type of MemoryFileOpts.DelayedEviction.
@@ -309,9 +363,18 @@ type evictableMemoryUserInfo struct {
 	// ranges tracks all evictable ranges for the given user.
 	ranges evictableRangeSet
 
-	// If evicting is true, there is a goroutine currently evicting all
+	// If evicting is true, there is a goroutine currently evicting
 	// evictable ranges for this user.
 	evicting bool
+
+	// evictLimit is the length of ranges that the eviction goroutine may
+	// still evict, or math.MaxUint64 if it should evict all of them.
+	evictLimit uint64
+
+	// lastUsed is the value of MemoryFile.evictableSeq when ranges were last
+	// marked evictable, used by the cache reclaimer to evict the least
+	// recently used allocations first.
+	lastUsed uint64
 }
 
 const (
@@ -337,6 +400,24 @@ func NewMemoryFile(file *os.File, opts MemoryFileOpts) (*MemoryFile, error) {
 	default:
 		return nil, fmt.Errorf("invalid MemoryFileOpts.DelayedEviction: %v", opts.DelayedEviction)
 	}
+	switch opts.IdleReclaim {
+	case IdleReclaimDisabled:
+	case IdleReclaimCold, IdleReclaimPageOut:
+		if opts.IdleReclaimInterval <= 0 {
+			return nil, fmt.Errorf("invalid MemoryFileOpts.IdleReclaimInterval: %v", opts.IdleReclaimInterval)
+		}
+	default:
+		return nil, fmt.Errorf("invalid MemoryFileOpts.IdleReclaim: %v", opts.IdleReclaim)
+	}
+	switch opts.Hugepages {
+	case HugepagesDefault, HugepagesAdvise:
+	case HugepagesCollapse:
+		if opts.HugepageCollapseInterval <= 0 {
+			return nil, fmt.Errorf("invalid MemoryFileOpts.HugepageCollapseInterval: %v", opts.HugepageCollapseInterval)
+		}
+	default:
+		return nil, fmt.Errorf("invalid MemoryFileOpts.Hugepages: %v", opts.Hugepages)
+	}
 
 	// Truncate the file to 0 bytes first to ensure that it's empty.
 	if err := file.Truncate(0); err != nil {
@@ -346,6 +427,7 @@ func NewMemoryFile(file *os.File, opts MemoryFileOpts) (*MemoryFile, error) {
 		opts:      opts,
 		file:      file,
 		evictable: make(map[EvictableMemoryUser]*evictableMemoryUserInfo),
+		collapsed: make(map[uint64]struct{}),
 	}
 	f.mappings.Store(make([]uintptr, 0))
 	f.reclaimCond.L = &f.mu
@@ -366,6 +448,12 @@ func NewMemoryFile(file *os.File, opts MemoryFileOpts) (*MemoryFile, error) {
 	}
 
 	go f.runReclaim() // S/R-SAFE: f.mu
+	if opts.IdleReclaim != IdleReclaimDisabled {
+		go f.runIdleReclaim() // S/R-SAFE: f.mu
+	}
+	if opts.Hugepages == HugepagesCollapse {
+		go f.runHugepageCollapse() // S/R-SAFE: f.mu
+	}
 
 	if !opts.DisableIMAWorkAround {
 		IMAWorkAroundForMemFile(file.Fd())
@@ -583,6 +671,7 @@ func (f *MemoryFile) allocate(length uint64, opts *AllocOpts) (memmap.FileRange,
 	}) {
 		panic(fmt.Sprintf("allocating %v: failed to insert into usage set:\n%v", fr, &f.usage))
 	}
+	f.allocations++
 
 	return fr, nil
 }
@@ -864,6 +953,7 @@ func (f *MemoryFile) markDecommitted(fr memmap.FileRange) {
 		panic(fmt.Sprintf("Decommit(%v): attempted to decommit unallocated pages %v:\n%v", fr, gap.Range(), &f.usage))
 	}
 	f.usage.MergeRange(fr)
+	f.forgetCollapsedLocked(fr)
 }
 
 // IncRef implements memmap.File.IncRef.
@@ -947,6 +1037,66 @@ func (f *MemoryFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (s
 	return safemem.BlockSeqFromSlice(blocks), err
 }
 
+// ForEachResidentRange invokes fn on each maximal subrange of fr whose pages
+// are resident in host memory, as reported by mincore(2). Pages that have never
+// been touched, or that have been decommitted or swapped out, are not
+// resident.
+//
+// Preconditions: fr must be page-aligned.
+func (f *MemoryFile) ForEachResidentRange(fr memmap.FileRange, fn func(fr memmap.FileRange)) error {
+	if !fr.WellFormed() || fr.Length() == 0 || !hostarch.Addr(fr.Start).IsPageAligned() || !hostarch.Addr(fr.End).IsPageAligned() {
+		panic(fmt.Sprintf("invalid range: %v", fr))
+	}
+
+	var (
+		// Reused mincore buffer, one byte per page.
+		buf      []byte
+		checkErr error
+		// resident is the resident range that has not yet been passed to
+		// fn, since it may continue into the next mapping slice.
+		resident memmap.FileRange
+		off      = fr.Start
+	)
+	err := f.forEachMappingSlice(fr, func(s []byte) {
+		if checkErr != nil {
+			return
+		}
+		bufLen := len(s) / hostarch.PageSize
+		if len(buf) < bufLen {
+			buf = make([]byte, bufLen)
+		}
+		if err := mincore(s, buf[:bufLen]); err != nil {
+			checkErr = err
+			return
+		}
+		for i := 0; i < bufLen; i++ {
+			if buf[i]&0x1 == 0 {
+				continue
+			}
+			pageStart := off + uint64(i*hostarch.PageSize)
+			if resident.Length() != 0 && resident.End == pageStart {
+				resident.End += hostarch.PageSize
+				continue
+			}
+			if resident.Length() != 0 {
+				fn(resident)
+			}
+			resident = memmap.FileRange{pageStart, pageStart + hostarch.PageSize}
+		}
+		off += uint64(len(s))
+	})
+	if checkErr != nil {
+		return checkErr
+	}
+	if err != nil {
+		return err
+	}
+	if resident.Length() != 0 {
+		fn(resident)
+	}
+	return nil
+}
+
 // forEachMappingSlice invokes fn on a sequence of byte slices that
 // collectively map all bytes in fr.
 func (f *MemoryFile) forEachMappingSlice(fr memmap.FileRange, fn func([]byte)) error {
@@ -995,6 +1145,7 @@ func (f *MemoryFile) getChunkMapping(chunk int) ([]uintptr, uintptr, error) {
 	if errno != 0 {
 		return nil, 0, errno
 	}
+	f.adviseHugepages(m)
 	atomic.StoreUintptr(&mappings[chunk], m)
 	return mappings, m, nil
 }
@@ -1019,14 +1170,20 @@ func (f *MemoryFile) MarkEvictable(user EvictableMemoryUser, er EvictableRange)
 			continue
 		}
 		gap = info.ranges.Insert(gap, gapER, evictableRangeSetValue{}).NextGap()
+		f.evictableBytes += gapER.Length()
 	}
+	f.evictableSeq++
+	info.lastUsed = f.evictableSeq
 	if !info.evicting {
 		switch f.opts.DelayedEviction {
 		case DelayedEvictionDisabled:
 			// Kick off eviction immediately.
-			f.startEvictionGoroutineLocked(user, info)
+			f.startEvictionGoroutineLocked(user, info, math.MaxUint64)
 		case DelayedEvictionEnabled:
-			if !f.opts.UseHostMemcgPressure {
+			if f.cacheReclaimHigh.RacyLoad() != 0 {
+				// Evictions are driven by the cache reclaimer.
+				f.maybeStartCacheReclaimLocked()
+			} else if !f.opts.UseHostMemcgPressure {
 				// Ensure that the reclaimer goroutine is running, so that it
 				// can start eviction when necessary.
 				f.reclaimCond.Signal()
@@ -1053,6 +1210,7 @@ func (f *MemoryFile) MarkUnevictable(user EvictableMemoryUser, er EvictableRange
 	seg := info.ranges.LowerBoundSegment(er.Start)
 	for seg.Ok() && seg.Start() < er.End {
 		seg = info.ranges.Isolate(seg, er)
+		f.evictableBytes -= seg.Range().Length()
 		seg = info.ranges.Remove(seg).NextSegment()
 	}
 	// We can only remove info if there's no eviction goroutine running on its
@@ -1071,6 +1229,7 @@ func (f *MemoryFile) MarkAllUnevictable(user EvictableMemoryUser) {
 	if !ok {
 		return
 	}
+	f.evictableBytes -= evictableLength(&info.ranges)
 	info.ranges.RemoveAll()
 	// We can only remove info if there's no eviction goroutine running on its
 	// behalf.
@@ -1084,7 +1243,7 @@ func (f *MemoryFile) MarkAllUnevictable(user EvictableMemoryUser) {
 // evictable memory. The value returned by ShouldCacheEvictable may change
 // between calls.
 func (f *MemoryFile) ShouldCacheEvictable() bool {
-	return f.opts.DelayedEviction == DelayedEvictionManual || f.opts.UseHostMemcgPressure
+	return f.opts.DelayedEviction == DelayedEvictionManual || f.opts.UseHostMemcgPressure || f.cacheReclaimHigh.RacyLoad() != 0
 }
 
 // UpdateUsage ensures that the memory usage statistics in
@@ -1399,6 +1558,13 @@ func (f *MemoryFile) runReclaim() {
 	if f.stopNotifyPressure != nil {
 		f.stopNotifyPressure()
 	}
+	f.mu.Lock()
+	stopNotifyHostPressure := f.stopNotifyHostPressure
+	f.stopNotifyHostPressure = nil
+	f.mu.Unlock()
+	if stopNotifyHostPressure != nil {
+		stopNotifyHostPressure()
+	}
 }
 
 // findReclaimable finds memory that has been marked for reclaim.
@@ -1416,7 +1582,7 @@ func (f *MemoryFile) findReclaimable() (memmap.FileRange, bool) {
 			if f.reclaimable {
 				break
 			}
-			if f.opts.DelayedEviction == DelayedEvictionEnabled && !f.opts.UseHostMemcgPressure {
+			if f.opts.DelayedEviction == DelayedEvictionEnabled && !f.opts.UseHostMemcgPressure && f.cacheReclaimHigh.RacyLoad() == 0 {
 				// No work to do. Evict any pending evictable allocations to
 				// get more reclaimable pages before going to sleep.
 				f.startEvictionsLocked()
@@ -1475,21 +1641,27 @@ func (f *MemoryFile) startEvictionsLocked() bool {
 	startedAny := false
 	for user, info := range f.evictable {
 		// Don't start multiple goroutines to evict the same user's
-		// allocations.
+		// allocations; if one is already running, let it evict all of them.
 		if !info.evicting {
-			f.startEvictionGoroutineLocked(user, info)
+			f.startEvictionGoroutineLocked(user, info, math.MaxUint64)
 			startedAny = true
+		} else {
+			info.evictLimit = math.MaxUint64
 		}
 	}
 	return startedAny
 }
 
+// startEvictionGoroutineLocked starts a goroutine that evicts up to limit
+// (rounded up to a whole range) of user's evictable ranges.
+//
 // Preconditions:
 //   - info == f.evictable[user].
 //   - !info.evicting.
 //   - f.mu must be locked.
-func (f *MemoryFile) startEvictionGoroutineLocked(user EvictableMemoryUser, info *evictableMemoryUserInfo) {
+func (f *MemoryFile) startEvictionGoroutineLocked(user EvictableMemoryUser, info *evictableMemoryUserInfo, limit uint64) {
 	info.evicting = true
+	info.evictLimit = limit
 	f.evictionWG.Add(1)
 	go func() { // S/R-SAFE: f.evictionWG
 		defer f.evictionWG.Done()
@@ -1507,6 +1679,11 @@ func (f *MemoryFile) startEvictionGoroutineLocked(user EvictableMemoryUser, info
 				f.mu.Unlock()
 				return
 			}
+			if info.evictLimit == 0 {
+				info.evicting = false
+				f.mu.Unlock()
+				return
+			}
 			// Evict from the end of info.ranges, under the assumption that
 			// if ranges in user start being used again (and are
 			// consequently marked unevictable), such uses are more likely
@@ -1514,6 +1691,12 @@ func (f *MemoryFile) startEvictionGoroutineLocked(user EvictableMemoryUser, info
 			seg := info.ranges.LastSegment()
 			er := seg.Range()
 			info.ranges.Remove(seg)
+			f.evictableBytes -= er.Length()
+			if er.Length() < info.evictLimit {
+				info.evictLimit -= er.Length()
+			} else {
+				info.evictLimit = 0
+			}
 			// user.Evict() must be called without holding f.mu to avoid
 			// circular lock ordering.
 			f.mu.Unlock()
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
 )
 
@@ -378,3 +379,162 @@ func TestFindUnallocatedRange(t *testing.T) {
 		})
 	}
 }
+
+func TestFindCollapsible(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		usage     *usageSegmentDataSlices
+		collapsed []uint64
+		start     uint64
+		max       int
+		want      []uint64
+	}{
+		{
+			name: "Single committed hugepage",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{0},
+				End:    []uint64{hugepage},
+				Values: []usageInfo{{refs: 1, knownCommitted: true}},
+			},
+			max:  10,
+			want: []uint64{0},
+		},
+		{
+			name: "Uncommitted hugepage",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{0},
+				End:    []uint64{hugepage},
+				Values: []usageInfo{{refs: 1}},
+			},
+			max: 10,
+		},
+		{
+			name: "Unaligned range",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{page},
+				End:    []uint64{hugepage + page},
+				Values: []usageInfo{{refs: 1, knownCommitted: true}},
+			},
+			max: 10,
+		},
+		{
+			name: "Contiguous segments",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{page, hugepage + page},
+				End:    []uint64{hugepage + page, 3 * hugepage},
+				Values: []usageInfo{{refs: 1, knownCommitted: true}, {refs: 2, knownCommitted: true}},
+			},
+			max:  10,
+			want: []uint64{hugepage, 2 * hugepage},
+		},
+		{
+			name: "Hole in committed range",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{0, hugepage + 2*page},
+				End:    []uint64{hugepage + page, 3 * hugepage},
+				Values: []usageInfo{{refs: 1, knownCommitted: true}, {refs: 1, knownCommitted: true}},
+			},
+			max:  10,
+			want: []uint64{0, 2 * hugepage},
+		},
+		{
+			name: "Waiting for reclaim",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{0, hugepage},
+				End:    []uint64{hugepage, 2 * hugepage},
+				Values: []usageInfo{{refs: 0, knownCommitted: true}, {refs: 1, knownCommitted: true}},
+			},
+			max:  10,
+			want: []uint64{hugepage},
+		},
+		{
+			name: "Already collapsed",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{0},
+				End:    []uint64{3 * hugepage},
+				Values: []usageInfo{{refs: 1, knownCommitted: true}},
+			},
+			collapsed: []uint64{hugepage},
+			max:       10,
+			want:      []uint64{0, 2 * hugepage},
+		},
+		{
+			name: "Start and max",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{0},
+				End:    []uint64{4 * hugepage},
+				Values: []usageInfo{{refs: 1, knownCommitted: true}},
+			},
+			start: hugepage,
+			max:   2,
+			want:  []uint64{hugepage, 2 * hugepage},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := MemoryFile{collapsed: make(map[uint64]struct{})}
+			if err := f.usage.ImportSortedSlices(test.usage); err != nil {
+				t.Fatalf("Failed to initialize usage from %v: %v", test.usage, err)
+			}
+			for _, h := range test.collapsed {
+				f.collapsed[h] = struct{}{}
+			}
+			frs := f.findCollapsibleLocked(test.start, test.max)
+			var got []uint64
+			for _, fr := range frs {
+				if fr.Length() != hugepage {
+					t.Errorf("findCollapsibleLocked(%x, %d): got range %v, want length %x", test.start, test.max, fr, uint64(hugepage))
+				}
+				got = append(got, fr.Start)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("findCollapsibleLocked(%x, %d): got %x, want %x", test.start, test.max, got, test.want)
+			}
+		})
+	}
+}
+
+type testEvictableUser struct {
+	name string
+}
+
+// Evict implements EvictableMemoryUser.Evict.
+func (*testEvictableUser) Evict(context.Context, EvictableRange) {}
+
+type testCleanEvictableUser struct {
+	testEvictableUser
+}
+
+// EvictClean implements CleanEvictableMemoryUser.EvictClean.
+func (*testCleanEvictableUser) EvictClean(context.Context, EvictableRange) {}
+
+func TestCacheReclaimVictim(t *testing.T) {
+	dirtyOld := &testEvictableUser{"dirtyOld"}
+	cleanOld := &testCleanEvictableUser{testEvictableUser{"cleanOld"}}
+	cleanNew := &testCleanEvictableUser{testEvictableUser{"cleanNew"}}
+	cleanEvicting := &testCleanEvictableUser{testEvictableUser{"cleanEvicting"}}
+	f := MemoryFile{evictable: make(map[EvictableMemoryUser]*evictableMemoryUserInfo)}
+	for i, user := range []EvictableMemoryUser{cleanEvicting, dirtyOld, cleanOld, cleanNew} {
+		info := &evictableMemoryUserInfo{lastUsed: uint64(i), evicting: user == cleanEvicting}
+		info.ranges.Add(EvictableRange{0, page}, evictableRangeSetValue{})
+		f.evictable[user] = info
+	}
+
+	cleaned := make(map[EvictableMemoryUser]struct{})
+	for _, want := range []struct {
+		user  EvictableMemoryUser
+		clean bool
+	}{
+		{cleanOld, true},
+		{cleanNew, true},
+		{dirtyOld, false},
+	} {
+		user, info, clean := f.cacheReclaimVictimLocked(cleaned)
+		if user != want.user || clean != want.clean {
+			t.Fatalf("cacheReclaimVictimLocked: got (%v, clean=%t), want (%v, clean=%t)", user, clean, want.user, want.clean)
+		}
+		if info != f.evictable[user] {
+			t.Errorf("cacheReclaimVictimLocked: got info %p, want %p", info, f.evictable[user])
+		}
+		cleaned[user] = struct{}{}
+	}
+}
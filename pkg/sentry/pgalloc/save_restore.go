@@ -25,11 +25,50 @@ import (
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/state"
+	"gvisor.dev/gvisor/pkg/state/chunkstore"
 	"gvisor.dev/gvisor/pkg/state/wire"
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
+// storeChunkSize is the size of the chunks that memory contents are split
+// into when they are saved to a chunkstore.Store. Chunks are aligned to
+// multiples of storeChunkSize in the file, so that a chunk whose contents
+// haven't changed between checkpoints hashes identically and is stored once.
+const storeChunkSize = 64 << 10
+
+// chunkStoreFromContext returns the chunk store that memory contents should
+// be saved to or loaded from, or nil if they are stored inline in the state
+// file.
+func chunkStoreFromContext(ctx context.Context) *chunkstore.Store {
+	if v := ctx.Value(CtxChunkStore); v != nil {
+		return v.(*chunkstore.Store)
+	}
+	return nil
+}
+
+// forEachStoreChunk calls fn for each storeChunkSize-aligned subrange of fr.
+func forEachStoreChunk(fr memmap.FileRange, fn func(cr memmap.FileRange) error) error {
+	for start := fr.Start; start < fr.End; {
+		end := (start + storeChunkSize) &^ (storeChunkSize - 1)
+		if end > fr.End {
+			end = fr.End
+		}
+		if err := fn(memmap.FileRange{start, end}); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// storeChunks returns the number of chunks forEachStoreChunk splits fr into.
+func storeChunks(fr memmap.FileRange) uint64 {
+	return (fr.End+storeChunkSize-1)/storeChunkSize - fr.Start/storeChunkSize
+}
+
 // SaveTo writes f's state to the given stream.
 func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 	// Wait for reclaim.
@@ -49,30 +88,8 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 
 	// Ensure that all pages that contain data have knownCommitted set, since
 	// we only store knownCommitted pages below.
-	zeroPage := make([]byte, hostarch.PageSize)
 	err := f.updateUsageLocked(0, 0, func(bs []byte, committed []byte) error {
-		for pgoff := 0; pgoff < len(bs); pgoff += hostarch.PageSize {
-			i := pgoff / hostarch.PageSize
-			pg := bs[pgoff : pgoff+hostarch.PageSize]
-			if !bytes.Equal(pg, zeroPage) {
-				committed[i] = 1
-				continue
-			}
-			committed[i] = 0
-			// Reading the page caused it to be committed; decommit it to
-			// reduce memory usage.
-			//
-			// "MADV_REMOVE [...] Free up a given range of pages and its
-			// associated backing store. This is equivalent to punching a hole
-			// in the corresponding byte range of the backing store (see
-			// fallocate(2))." - madvise(2)
-			if err := unix.Madvise(pg, unix.MADV_REMOVE); err != nil {
-				// This doesn't impact the correctness of saved memory, it
-				// just means that we're incrementally more likely to OOM.
-				// Complain, but don't abort saving.
-				log.Warningf("Decommitting page %p while saving failed: %v", pg, err)
-			}
-		}
+		scanPagesParallel(bs, committed)
 		return nil
 	})
 	if err != nil {
@@ -86,12 +103,23 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 	if _, err := state.Save(ctx, w, &f.usage); err != nil {
 		return err
 	}
+	store := chunkStoreFromContext(ctx)
+	chunked := store != nil
+	if _, err := state.Save(ctx, w, &chunked); err != nil {
+		return err
+	}
 
 	// Dump out committed pages.
 	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
 		if !seg.Value().knownCommitted {
 			continue
 		}
+		if chunked {
+			if err := f.saveChunksLocked(seg.Range(), store, w); err != nil {
+				return err
+			}
+			continue
+		}
 		// Write a header to distinguish from objects.
 		if err := state.WriteHeader(w, uint64(seg.Range().Length()), false); err != nil {
 			return err
@@ -115,6 +143,109 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 	return nil
 }
 
+// scanPageBatch is the minimum number of pages that scanPagesParallel hands to
+// each goroutine.
+const scanPageBatch = 1024
+
+// zeroPage is compared against by scanPages. It must not be modified.
+var zeroPage [hostarch.PageSize]byte
+
+// scanPagesParallel sets committed[i] to 1 if the ith page in bs contains
+// non-zero bytes, and to 0 otherwise. Zero pages are decommitted. Large ranges
+// are split across goroutines, since reading every page of a large memory
+// file otherwise dominates save time.
+func scanPagesParallel(bs []byte, committed []byte) {
+	pages := len(bs) / hostarch.PageSize
+	batch := (pages + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0)
+	if batch < scanPageBatch {
+		batch = scanPageBatch
+	}
+	var wg sync.WaitGroup
+	for first := 0; first < pages; first += batch {
+		last := first + batch
+		if last > pages {
+			last = pages
+		}
+		wg.Add(1)
+		go func(first, last int) { // S/R-SAFE: Save path only; waited for below.
+			defer wg.Done()
+			scanPages(bs[first*hostarch.PageSize:last*hostarch.PageSize], committed[first:last])
+		}(first, last)
+	}
+	wg.Wait()
+}
+
+// scanPages is the per-goroutine implementation of scanPagesParallel.
+func scanPages(bs []byte, committed []byte) {
+	for pgoff := 0; pgoff < len(bs); pgoff += hostarch.PageSize {
+		i := pgoff / hostarch.PageSize
+		pg := bs[pgoff : pgoff+hostarch.PageSize]
+		if !bytes.Equal(pg, zeroPage[:]) {
+			committed[i] = 1
+			continue
+		}
+		committed[i] = 0
+		// Reading the page caused it to be committed; decommit it to
+		// reduce memory usage.
+		//
+		// "MADV_REMOVE [...] Free up a given range of pages and its
+		// associated backing store. This is equivalent to punching a hole
+		// in the corresponding byte range of the backing store (see
+		// fallocate(2))." - madvise(2)
+		if err := unix.Madvise(pg, unix.MADV_REMOVE); err != nil {
+			// This doesn't impact the correctness of saved memory, it
+			// just means that we're incrementally more likely to OOM.
+			// Complain, but don't abort saving.
+			log.Warningf("Decommitting page %p while saving failed: %v", pg, err)
+		}
+	}
+}
+
+// saveChunksLocked stores the contents of fr in store, and writes the hashes
+// of the stored chunks to w.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) saveChunksLocked(fr memmap.FileRange, store *chunkstore.Store, w wire.Writer) error {
+	if err := state.WriteHeader(w, storeChunks(fr)*chunkstore.HashSize, false); err != nil {
+		return err
+	}
+	buf := make([]byte, 0, storeChunkSize)
+	return forEachStoreChunk(fr, func(cr memmap.FileRange) error {
+		buf = buf[:0]
+		if err := f.forEachMappingSlice(cr, func(s []byte) {
+			buf = append(buf, s...)
+		}); err != nil {
+			return err
+		}
+		h, err := store.Put(buf)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(h[:])
+		return err
+	})
+}
+
+// loadChunks reads the hashes of the chunks making up fr from r, and loads
+// their contents from store.
+func (f *MemoryFile) loadChunks(fr memmap.FileRange, store *chunkstore.Store, r wire.Reader) error {
+	buf := make([]byte, storeChunkSize)
+	return forEachStoreChunk(fr, func(cr memmap.FileRange) error {
+		var h chunkstore.Hash
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return err
+		}
+		data := buf[:cr.Length()]
+		if err := store.Get(h, data); err != nil {
+			return err
+		}
+		return f.forEachMappingSlice(cr, func(s []byte) {
+			n := copy(s, data)
+			data = data[n:]
+		})
+	})
+}
+
 // LoadFrom loads MemoryFile state from the given stream.
 func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 	// Load metadata.
@@ -129,6 +260,14 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 	if _, err := state.Load(ctx, r, &f.usage); err != nil {
 		return err
 	}
+	var chunked bool
+	if _, err := state.Load(ctx, r, &chunked); err != nil {
+		return err
+	}
+	store := chunkStoreFromContext(ctx)
+	if chunked && store == nil {
+		return fmt.Errorf("memory contents were saved to a chunk store, but no chunk store was provided")
+	}
 
 	// Try to map committed chunks concurrently: For any given chunk, either
 	// this loop or the following one will mmap the chunk first and cache it in
@@ -167,23 +306,33 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 			// Not expected.
 			return fmt.Errorf("unexpected object")
 		}
-		if expected := uint64(seg.Range().Length()); length != expected {
+		expected := uint64(seg.Range().Length())
+		if chunked {
+			expected = storeChunks(seg.Range()) * chunkstore.HashSize
+		}
+		if length != expected {
 			// Size mismatch.
 			return fmt.Errorf("mismatched segment: expected %d, got %d", expected, length)
 		}
-		// Read data.
-		var ioErr error
-		err = f.forEachMappingSlice(seg.Range(), func(s []byte) {
+		if chunked {
+			if err := f.loadChunks(seg.Range(), store, r); err != nil {
+				return err
+			}
+		} else {
+			// Read data.
+			var ioErr error
+			err = f.forEachMappingSlice(seg.Range(), func(s []byte) {
+				if ioErr != nil {
+					return
+				}
+				_, ioErr = io.ReadFull(r, s)
+			})
 			if ioErr != nil {
-				return
+				return ioErr
+			}
+			if err != nil {
+				return err
 			}
-			_, ioErr = io.ReadFull(r, s)
-		})
-		if ioErr != nil {
-			return ioErr
-		}
-		if err != nil {
-			return err
 		}
 
 		// Update accounting for restored pages. We need to do this here since
@@ -76,6 +76,7 @@ restart:
 		Flush:              localAS.Touch(cpu),
 		FullRestore:        ac.FullRestore(),
 	}
+	setArchSwitchOpts(&switchOpts, ac)
 
 	// Take the blue pill.
 	at, err := cpu.SwitchToUser(switchOpts, &c.info)
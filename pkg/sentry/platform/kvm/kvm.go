@@ -182,6 +182,14 @@ func (k *KVM) NewContext(pkgcontext.Context) platform.Context {
 	}
 }
 
+// SetCPULimit implements platform.Platform.SetCPULimit.
+//
+// vCPUs are created when the machine is created, so the number of usable
+// vCPUs can only grow back up to the number supported by the machine.
+func (k *KVM) SetCPULimit(cpus int) {
+	k.machine.setVCPULimit(vCPUsPerCPU * cpus)
+}
+
 type constructor struct{}
 
 func (*constructor) New(f *os.File) (platform.Platform, error) {
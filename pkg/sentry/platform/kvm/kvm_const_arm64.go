@@ -61,6 +61,13 @@ const (
 	_SCTLR_UCT         = 1 << 15
 	_SCTLR_UCI         = 1 << 26
 	_SCTLR_EL1_DEFAULT = _SCTLR_M | _SCTLR_C | _SCTLR_I | _SCTLR_UCT | _SCTLR_UCI | _SCTLR_DZE
+
+	// Pointer authentication enables.
+	_SCTLR_EnDB = 1 << 13
+	_SCTLR_EnDA = 1 << 27
+	_SCTLR_EnIB = 1 << 30
+	_SCTLR_EnIA = 1 << 31
+	_SCTLR_PAC  = _SCTLR_EnIA | _SCTLR_EnIB | _SCTLR_EnDA | _SCTLR_EnDB
 )
 
 // Arm64: Counter-timer Kernel Control Register el1.
@@ -138,6 +145,9 @@ const (
 const (
 	_KVM_ARM_VCPU_POWER_OFF = 0 // CPU is started in OFF state
 	_KVM_ARM_VCPU_PSCI_0_2  = 2 // CPU uses PSCI v0.2
+
+	_KVM_ARM_VCPU_PTRAUTH_ADDRESS = 5 // CPU uses address authentication
+	_KVM_ARM_VCPU_PTRAUTH_GENERIC = 6 // CPU uses generic authentication
 )
 
 // Arm64: Exception Syndrome Register EL1.
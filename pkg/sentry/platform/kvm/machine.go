@@ -77,6 +77,15 @@ type machine struct {
 	// maxVCPUs is the maximum number of vCPUs supported by the machine.
 	maxVCPUs int
 
+	// vCPULimit is the number of vCPUs that may currently be used, at most
+	// maxVCPUs. Only vCPUs with an ID below vCPULimit are handed out by Get;
+	// see setVCPULimit.
+	vCPULimit int
+
+	// idleVCPUs are previously used vCPUs that are not bound to any thread.
+	// They were released because their ID was above vCPULimit.
+	idleVCPUs []*vCPU
+
 	// maxSlots is the maximum number of memory slots supported by the machine.
 	maxSlots int
 
@@ -248,6 +257,7 @@ func newMachine(vm int) (*machine, error) {
 	// Pull the maximum vCPUs.
 	m.getMaxVCPU()
 	log.Debugf("The maximum number of vCPUs is %d.", m.maxVCPUs)
+	m.vCPULimit = m.maxVCPUs
 	m.vCPUsByTID = make(map[uint64]*vCPU)
 	m.vCPUsByID = make([]*vCPU, m.maxVCPUs)
 	m.kernel.Init(m.maxVCPUs)
@@ -458,7 +468,7 @@ func (m *machine) Get() *vCPU {
 	tid := hosttid.Current()
 
 	// Check for an exact match.
-	if c := m.vCPUsByTID[tid]; c != nil {
+	if c := m.vCPUsByTID[tid]; c != nil && c.id < m.vCPULimit {
 		c.lock()
 		m.mu.RUnlock()
 		getVCPUCounter.Increment(&getVCPUAcquisitionFastReused)
@@ -479,17 +489,23 @@ func (m *machine) Get() *vCPU {
 
 	// Recheck for an exact match.
 	if c := m.vCPUsByTID[tid]; c != nil {
-		c.lock()
-		m.mu.Unlock()
-		getVCPUCounter.Increment(&getVCPUAcquisitionReused)
-		return c
+		// If the vCPU is above the limit, release it, unless this thread
+		// is currently running in guest mode on it; in that case it must
+		// keep using it, and it is released on a later call.
+		if c.id < m.vCPULimit || !c.state.CompareAndSwap(vCPUReady, vCPUUser) {
+			c.lock()
+			m.mu.Unlock()
+			getVCPUCounter.Increment(&getVCPUAcquisitionReused)
+			return c
+		}
+		delete(m.vCPUsByTID, tid)
+		m.idleVCPUs = append(m.idleVCPUs, c)
+		c.state.Store(vCPUReady)
 	}
 
 	for {
-		// Get vCPU from the m.vCPUsByID pool.
-		if m.usedVCPUs < m.maxVCPUs {
-			c := m.vCPUsByID[m.usedVCPUs]
-			m.usedVCPUs++
+		// Get a vCPU that is not bound to any thread.
+		if c := m.unusedVCPU(); c != nil {
 			c.lock()
 			m.vCPUsByTID[tid] = c
 			m.mu.Unlock()
@@ -500,6 +516,9 @@ func (m *machine) Get() *vCPU {
 
 		// Scan for an available vCPU.
 		for origTID, c := range m.vCPUsByTID {
+			if c.id >= m.vCPULimit {
+				continue
+			}
 			if c.state.CompareAndSwap(vCPUReady, vCPUUser) {
 				delete(m.vCPUsByTID, origTID)
 				m.vCPUsByTID[tid] = c
@@ -512,7 +531,7 @@ func (m *machine) Get() *vCPU {
 
 		// Scan for something not in user mode.
 		for origTID, c := range m.vCPUsByTID {
-			if !c.state.CompareAndSwap(vCPUGuest, vCPUGuest|vCPUWaiter) {
+			if c.id >= m.vCPULimit || !c.state.CompareAndSwap(vCPUGuest, vCPUGuest|vCPUWaiter) {
 				continue
 			}
 
@@ -545,6 +564,47 @@ func (m *machine) Get() *vCPU {
 	}
 }
 
+// unusedVCPU returns a vCPU below the limit that is not bound to any thread,
+// or nil if there is none.
+//
+// Precondition: mu must be held for writing.
+func (m *machine) unusedVCPU() *vCPU {
+	for i, c := range m.idleVCPUs {
+		if c.id < m.vCPULimit {
+			m.idleVCPUs = append(m.idleVCPUs[:i], m.idleVCPUs[i+1:]...)
+			return c
+		}
+	}
+	if m.usedVCPUs < m.vCPULimit {
+		c := m.vCPUsByID[m.usedVCPUs]
+		m.usedVCPUs++
+		return c
+	}
+	return nil
+}
+
+// setVCPULimit sets the number of vCPUs that may be used to n, clamped to
+// [1, maxVCPUs].
+//
+// Lowering the limit takes effect lazily: a thread bound to a vCPU above the
+// limit releases it the next time it calls Get outside of guest mode.
+func (m *machine) setVCPULimit(n int) {
+	if n > m.maxVCPUs {
+		n = m.maxVCPUs
+	}
+	if n < 1 {
+		n = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	log.Debugf("Setting the vCPU limit to %d (was %d).", n, m.vCPULimit)
+	if n > m.vCPULimit {
+		// Waiters may be able to use the new vCPUs.
+		m.available.Broadcast()
+	}
+	m.vCPULimit = n
+}
+
 // Put puts the current vCPU.
 func (m *machine) Put(c *vCPU) {
 	c.unlock()
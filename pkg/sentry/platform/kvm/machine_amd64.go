@@ -30,6 +30,7 @@ import (
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/ring0"
 	"gvisor.dev/gvisor/pkg/ring0/pagetables"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	ktime "gvisor.dev/gvisor/pkg/sentry/time"
 )
@@ -484,6 +485,9 @@ func (m *machine) mapUpperHalf(pageTable *pagetables.PageTables) {
 	}
 }
 
+// vCPUsPerCPU is the number of vCPUs used per host CPU; see getMaxVCPU.
+const vCPUsPerCPU = 3
+
 // getMaxVCPU get max vCPU number
 func (m *machine) getMaxVCPU() {
 	maxVCPUs, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(m.fd), KVM_CHECK_EXTENSION, _KVM_CAP_MAX_VCPUS)
@@ -499,11 +503,15 @@ func (m *machine) getMaxVCPU() {
 	// vCPU for each goruntime processor (P) and two sets of vCPUs to run
 	// user code.
 	rCPUs := runtime.GOMAXPROCS(0)
-	if 3*rCPUs < m.maxVCPUs {
-		m.maxVCPUs = 3 * rCPUs
+	if vCPUsPerCPU*rCPUs < m.maxVCPUs {
+		m.maxVCPUs = vCPUsPerCPU * rCPUs
 	}
 }
 
 func archPhysicalRegions(physicalRegions []physicalRegion) []physicalRegion {
 	return physicalRegions
 }
+
+// setArchSwitchOpts sets the architecture-specific options for switching to
+// the application context ac.
+func setArchSwitchOpts(switchOpts *ring0.SwitchOpts, ac *arch.Context64) {}
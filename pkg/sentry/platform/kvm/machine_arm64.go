@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/ring0"
 	"gvisor.dev/gvisor/pkg/ring0/pagetables"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 )
 
@@ -135,6 +136,14 @@ func archPhysicalRegions(physicalRegions []physicalRegion) []physicalRegion {
 	return regions
 }
 
+// setArchSwitchOpts sets the architecture-specific options for switching to
+// the application context ac.
+func setArchSwitchOpts(switchOpts *ring0.SwitchOpts, ac *arch.Context64) {
+	if hasPAC {
+		switchOpts.PACKeys = &ac.StateData().PACKeys
+	}
+}
+
 // nonCanonical generates a canonical address return.
 //
 //go:nosplit
@@ -205,6 +214,9 @@ func (c *vCPU) fault(signal int32, info *linux.SignalInfo) (hostarch.AccessType,
 	return accessType, platform.ErrContextSignal
 }
 
+// vCPUsPerCPU is the number of vCPUs used per host CPU.
+const vCPUsPerCPU = 1
+
 // getMaxVCPU get max vCPU number
 func (m *machine) getMaxVCPU() {
 	rmaxVCPUs := runtime.NumCPU()
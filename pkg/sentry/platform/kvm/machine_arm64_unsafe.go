@@ -27,6 +27,7 @@ import (
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/ring0"
 	"gvisor.dev/gvisor/pkg/ring0/pagetables"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	ktime "gvisor.dev/gvisor/pkg/sentry/time"
 )
@@ -38,6 +39,9 @@ type kvmVcpuInit struct {
 
 var vcpuInit kvmVcpuInit
 
+// hasPAC indicates that pointer authentication is enabled for applications.
+var hasPAC bool
+
 // initArchState initializes architecture-specific state.
 func (m *machine) initArchState() error {
 	if _, _, errno := unix.RawSyscall(
@@ -48,6 +52,28 @@ func (m *machine) initArchState() error {
 		panic(fmt.Sprintf("error setting KVM_ARM_PREFERRED_TARGET failed: %v", errno))
 	}
 
+	// Enable pointer authentication if the host supports it. KVM requires
+	// address and generic authentication to be enabled together. Each
+	// application has its own keys, which are loaded on every switch to
+	// the application (see ring0.CPU.SwitchToUser).
+	//
+	// The Memory Tagging Extension is not exposed: KVM requires all memory
+	// slots of a VM with KVM_CAP_ARM_MTE enabled to be backed by memory
+	// that can hold allocation tags, but the sentry's address space, which
+	// is mapped into the VM, includes file mappings that can't. So
+	// HWCAP2_MTE is never advertised, and tag check registers (TCO,
+	// GCR_EL1, RGSR_EL1) need not be switched. See
+	// g3doc/architecture_guide/platforms.md.
+	hasAddressAuth, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(m.fd), KVM_CHECK_EXTENSION, _KVM_CAP_ARM_PTRAUTH_ADDRESS)
+	if errno == 0 && hasAddressAuth != 0 {
+		hasGenericAuth, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(m.fd), KVM_CHECK_EXTENSION, _KVM_CAP_ARM_PTRAUTH_GENERIC)
+		hasPAC = errno == 0 && hasGenericAuth != 0
+	}
+	if hasPAC {
+		vcpuInit.features[0] |= (1 << _KVM_ARM_VCPU_PTRAUTH_ADDRESS) | (1 << _KVM_ARM_VCPU_PTRAUTH_GENERIC)
+		arch.SetHWCap(linux.HWCAP_PACA | linux.HWCAP_PACG)
+	}
+
 	// Initialize all vCPUs on ARM64, while this does not happen on x86_64.
 	// The reason for the difference is that ARM64 and x86_64 have different KVM timer mechanisms.
 	// If we create vCPU dynamically on ARM64, the timer for vCPU would mess up for a short time.
@@ -129,6 +155,9 @@ func (c *vCPU) initArchState() error {
 
 	// sctlr_el1
 	data = _SCTLR_EL1_DEFAULT
+	if hasPAC {
+		data |= _SCTLR_PAC
+	}
 	reg.id = _KVM_ARM64_REGS_SCTLR_EL1
 	if err := c.setOneRegister(&reg); err != nil {
 		return err
@@ -122,6 +122,15 @@ type Platform interface {
 
 	// SyscallFilters returns syscalls made exclusively by this platform.
 	SyscallFilters() seccomp.SyscallRules
+
+	// SetCPULimit informs the Platform that application code is expected to
+	// run on at most cpus host CPUs concurrently, e.g. because the sandbox's
+	// CPU limit has changed. Platforms may use this to scale the resources
+	// used to run Contexts (vCPUs, stub threads, etc.) It does not change the
+	// number of CPUs visible to applications, and may be called at any time.
+	//
+	// Precondition: cpus > 0.
+	SetCPULimit(cpus int)
 }
 
 // NoCPUPreemptionDetection implements Platform.DetectsCPUPreemption and
@@ -175,6 +184,13 @@ func (UseHostProcessMemoryBarrier) GlobalMemoryBarrier() error {
 	return hostmm.GlobalMemoryBarrier()
 }
 
+// NoCPULimit implements Platform.SetCPULimit for Platforms that do not scale
+// with the CPU limit.
+type NoCPULimit struct{}
+
+// SetCPULimit implements Platform.SetCPULimit.
+func (NoCPULimit) SetCPULimit(int) {}
+
 // DoesOwnPageTables implements Platform.OwnsPageTables in the positive.
 type DoesOwnPageTables struct{}
 
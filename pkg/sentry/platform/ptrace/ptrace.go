@@ -208,6 +208,7 @@ type PTrace struct {
 	platform.NoCPUPreemptionDetection
 	platform.UseHostGlobalMemoryBarrier
 	platform.DoesNotOwnPageTables
+	platform.NoCPULimit
 }
 
 // New returns a new ptrace-based implementation of the platform interface.
@@ -77,6 +77,17 @@ func (p *Systrap) SyscallFilters() seccomp.SyscallRules {
 			seccomp.AnyValue{},
 			seccomp.EqualTo(sysmsgThreadPriority),
 		},
+		unix.SYS_SCHED_SETAFFINITY: seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(cpuSetSize),
+		},
+		unix.SYS_GET_MEMPOLICY: seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(0),
+			seccomp.EqualTo(0),
+			seccomp.AnyValue{},
+			seccomp.EqualTo(linux.MPOL_F_NODE | linux.MPOL_F_ADDR),
+		},
 	}
 	r.Merge(p.archSyscallFilters())
 	return r
@@ -0,0 +1,117 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systrap
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// numaNodeCPUs maps each NUMA node of the host to the CPUs of that node that
+// the sentry may run on. It is nil if the sentry may only use a single node,
+// in which case stub threads are not pinned.
+//
+// numaNodeCPUs is initialized by initNUMA and immutable thereafter.
+var numaNodeCPUs map[int]*unix.CPUSet
+
+// initNUMA initializes numaNodeCPUs.
+//
+// The NUMA topology is discovered by running the calling thread on each CPU
+// that the sentry may run on and asking getcpu(2) for the node of that CPU,
+// since the sentry runs in a chroot without sysfs.
+func initNUMA() {
+	if !multipleMemoryNodes() {
+		return
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var allowed unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &allowed); err != nil {
+		log.Warningf("Unable to get the CPU affinity: %v", err)
+		return
+	}
+	defer func() {
+		if err := unix.SchedSetaffinity(0, &allowed); err != nil {
+			panic("unable to restore the CPU affinity: " + err.Error())
+		}
+	}()
+
+	nodes := make(map[int]*unix.CPUSet)
+	for cpu := 0; cpu < len(allowed)*64; cpu++ {
+		if !allowed.IsSet(cpu) {
+			continue
+		}
+		var set unix.CPUSet
+		set.Set(cpu)
+		if err := unix.SchedSetaffinity(0, &set); err != nil {
+			// The CPU may have been taken offline.
+			continue
+		}
+		node, err := currentNode()
+		if err != nil {
+			log.Warningf("Unable to get the NUMA node of CPU %d: %v", cpu, err)
+			return
+		}
+		if nodes[node] == nil {
+			nodes[node] = &unix.CPUSet{}
+		}
+		nodes[node].Set(cpu)
+	}
+	if len(nodes) > 1 {
+		numaNodeCPUs = nodes
+		log.Infof("systrap: pinning stub threads to the NUMA nodes of their memory (%d nodes)", len(nodes))
+	}
+}
+
+// multipleMemoryNodes returns true if the sentry may allocate memory on more
+// than one NUMA node.
+func multipleMemoryNodes() bool {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v, ok := strings.CutPrefix(s.Text(), "Mems_allowed_list:"); ok {
+			return strings.ContainsAny(v, ",-")
+		}
+	}
+	return false
+}
+
+// numaCPUs returns the CPUs of the NUMA node that holds the memory shared
+// between the sentry and the stub threads of s, which they access on every
+// switch to and from the application. ok is false if stub threads should not
+// be pinned.
+func (s *subprocess) numaCPUs() (cpus *unix.CPUSet, ok bool) {
+	if numaNodeCPUs == nil {
+		return nil, false
+	}
+	node, err := memoryNode(s.threadContextRegion)
+	if err != nil {
+		log.Warningf("Unable to get the NUMA node of the thread context region: %v", err)
+		return nil, false
+	}
+	cpus, ok = numaNodeCPUs[node]
+	return cpus, ok
+}
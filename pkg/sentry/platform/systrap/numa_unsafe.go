@@ -0,0 +1,45 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systrap
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// cpuSetSize is the size of the CPU mask passed to sched_setaffinity(2).
+const cpuSetSize = unsafe.Sizeof(unix.CPUSet{})
+
+// currentNode returns the NUMA node of the CPU that the calling thread is
+// running on.
+func currentNode() (int, error) {
+	var cpu, node uint32
+	if _, _, errno := unix.RawSyscall(unix.SYS_GETCPU, uintptr(unsafe.Pointer(&cpu)), uintptr(unsafe.Pointer(&node)), 0); errno != 0 {
+		return 0, errno
+	}
+	return int(node), nil
+}
+
+// memoryNode returns the NUMA node of the page containing addr, allocating
+// it if necessary.
+func memoryNode(addr uintptr) (int, error) {
+	var node int32
+	if _, _, errno := unix.RawSyscall6(unix.SYS_GET_MEMPOLICY, uintptr(unsafe.Pointer(&node)), 0, 0, addr, linux.MPOL_F_NODE|linux.MPOL_F_ADDR, 0); errno != 0 {
+		return 0, errno
+	}
+	return int(node), nil
+}
@@ -103,6 +103,20 @@ type requestStub struct {
 // TODO(b/268366549): Replace maxSystemThreads below.
 var maxSysmsgThreads = runtime.GOMAXPROCS(0)
 
+// sysmsgThreadLimit is the maximum number of sysmsg threads that a subprocess
+// may keep awake, as set by Systrap.SetCPULimit. Zero means
+// maxSysmsgThreads.
+var sysmsgThreadLimit atomic.Uint32
+
+// awakeSysmsgThreadLimit returns the maximum number of sysmsg threads that a
+// subprocess may keep awake.
+func awakeSysmsgThreadLimit() uint32 {
+	if n := sysmsgThreadLimit.Load(); n != 0 {
+		return n
+	}
+	return uint32(maxSysmsgThreads)
+}
+
 const (
 	// maxSystemThreads specifies the maximum number of system threads that a
 	// subprocess may create in order to process the contexts.
@@ -169,6 +183,9 @@ type subprocess struct {
 	// contextQueue is a queue of all contexts that are ready to switch back to
 	// user mode.
 	contextQueue *contextQueue
+
+	// threadScaler determines how many spare sysmsg threads are kept awake.
+	threadScaler sysmsgThreadScaler
 }
 
 func (s *subprocess) initSyscallThread(ptraceThread *thread) error {
@@ -794,6 +811,7 @@ func (s *subprocess) waitOnState(ctx *sharedContext, stubFastPathEnabled bool) {
 	slowPath := false
 	start := cputicks()
 	ctx.startWaitingTS = start
+	s.threadScaler.recordSwitch(start)
 	if !stubFastPathEnabled || atomic.LoadUint32(&s.contextQueue.numActiveThreads) == 0 {
 		ctx.kicked = s.kickSysmsgThread()
 	}
@@ -848,12 +866,17 @@ func (s *subprocess) canKickSysmsgThread() (bool, uint32) {
 	nrActiveContexts := atomic.LoadUint32(&s.contextQueue.numActiveContexts)
 
 	nrActiveThreads += nrThreadsToWakeup + 1
-	if nrActiveThreads > nrActiveContexts {
+	if nrActiveThreads > nrActiveContexts+s.threadScaler.spare.Load() {
 		// This can happen when one or more stub threads are
 		// waiting for cpu time. The host probably has more
 		// running tasks than a number of cpu-s.
 		return false, nrActiveThreads
 	}
+	if nrActiveThreads > awakeSysmsgThreadLimit() {
+		// Contexts will be picked up by awake threads as they become
+		// available.
+		return false, nrActiveThreads
+	}
 	return true, nrActiveThreads
 }
 
@@ -1053,6 +1076,11 @@ func (s *subprocess) createSysmsgThread() error {
 	if err := unix.Setpriority(unix.PRIO_PROCESS, int(p.tid), sysmsgThreadPriority); err != nil {
 		log.Warningf("Unable to change priority of a stub thread: %s", err)
 	}
+	if cpus, ok := s.numaCPUs(); ok {
+		if err := unix.SchedSetaffinity(int(p.tid), cpus); err != nil {
+			log.Warningf("Unable to change CPU affinity of a stub thread: %s", err)
+		}
+	}
 
 	// Install a pre-compiled seccomp rules for the BPF process.
 	_, err = p.syscallIgnoreInterrupt(&p.initRegs, unix.SYS_PRCTL,
@@ -0,0 +1,79 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systrap
+
+import (
+	"sync/atomic"
+)
+
+const (
+	// threadScalerWindow is the period over which the rate of switches to
+	// the application is measured.
+	threadScalerWindow = int64(20 * 1000 * 1000) // 10ms for 2GHz.
+
+	// switchesPerSpareThread is the number of switches per
+	// threadScalerWindow for which one spare sysmsg thread is kept awake.
+	switchesPerSpareThread = 1000
+)
+
+// sysmsgThreadScaler determines how many spare sysmsg threads a subprocess
+// keeps awake, in addition to one per active context, based on the rate at
+// which its contexts switch to the application (i.e. the rate of system
+// calls and faults).
+//
+// When the switch rate is high, contexts return to the stub shortly after
+// leaving it, and a spare thread that is already polling the context queue
+// picks them up without a futex wake-up. When the switch rate is low, spare
+// threads only waste CPU time, so none are kept.
+type sysmsgThreadScaler struct {
+	// switches is the number of switches in the current window.
+	switches atomic.Uint64
+
+	// windowStart is the cputicks() timestamp at which the current window
+	// started.
+	windowStart atomic.Int64
+
+	// spare is the number of spare threads, as of the end of the last
+	// window.
+	spare atomic.Uint32
+}
+
+// recordSwitch records a switch to the application at time now, as returned
+// by cputicks().
+func (ts *sysmsgThreadScaler) recordSwitch(now int64) {
+	n := ts.switches.Add(1)
+	start := ts.windowStart.Load()
+	elapsed := now - start
+	if elapsed < threadScalerWindow || !ts.windowStart.CompareAndSwap(start, now) {
+		return
+	}
+	// Switches recorded by other goroutines between the load and the store
+	// are lost, which is fine for an estimate.
+	ts.switches.Store(0)
+	ts.spare.Store(spareSysmsgThreads(n, elapsed))
+}
+
+// spareSysmsgThreads returns the number of spare threads for n switches over
+// elapsed cputicks, where elapsed >= threadScalerWindow.
+func spareSysmsgThreads(n uint64, elapsed int64) uint32 {
+	// Windows end on the first switch after threadScalerWindow, so they
+	// may be longer if the subprocess was idle.
+	spare := n * uint64(threadScalerWindow) / uint64(elapsed) / switchesPerSpareThread
+	// Leave most threads for active contexts.
+	if max := uint64(awakeSysmsgThreadLimit() / 4); spare > max {
+		spare = max
+	}
+	return uint32(spare)
+}
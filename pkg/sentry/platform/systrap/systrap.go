@@ -335,6 +335,7 @@ func New() (*Systrap, error) {
 		globalPool.source = source
 
 		initSysmsgThreadPriority()
+		initNUMA()
 	})
 
 	return &Systrap{memoryFile: mf}, nil
@@ -377,6 +378,18 @@ func (*Systrap) NewContext(ctx pkgcontext.Context) platform.Context {
 	}
 }
 
+// SetCPULimit implements platform.Platform.SetCPULimit.
+//
+// It limits the number of sysmsg threads that each subprocess keeps awake.
+// Threads are created on demand, so the limit can grow up to
+// maxSysmsgThreads.
+func (*Systrap) SetCPULimit(cpus int) {
+	if cpus > maxSysmsgThreads {
+		cpus = maxSysmsgThreads
+	}
+	sysmsgThreadLimit.Store(uint32(cpus))
+}
+
 type constructor struct{}
 
 func (*constructor) New(_ *os.File) (platform.Platform, error) {
@@ -30,6 +30,8 @@ const (
 	PointExecve
 	PointExitNotifyParent
 	PointTaskExit
+	PointPageFault
+	PointSocketClose
 
 	// Add new Points above this line.
 	pointLengthBeforeSyscalls
@@ -286,6 +288,18 @@ func genericInit() {
 		Name:          "sentry/task_exit",
 		ContextFields: defaultContextFields,
 	})
+	registerPoint(PointDesc{
+		ID:            PointPageFault,
+		Name:          "sentry/page_fault",
+		ContextFields: defaultContextFields,
+	})
+
+	// Points from the netstack namespace.
+	registerPoint(PointDesc{
+		ID:            PointSocketClose,
+		Name:          "netstack/socket_close",
+		ContextFields: defaultContextFields,
+	})
 }
 
 var initOnce sync.Once
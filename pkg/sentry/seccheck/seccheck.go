@@ -108,6 +108,9 @@ type Sink interface {
 	Execve(ctx context.Context, fields FieldSet, info *pb.ExecveInfo) error
 	ExitNotifyParent(ctx context.Context, fields FieldSet, info *pb.ExitNotifyParentInfo) error
 	TaskExit(context.Context, FieldSet, *pb.TaskExit) error
+	PageFault(context.Context, FieldSet, *pb.PageFault) error
+
+	SocketClose(context.Context, FieldSet, *pb.SocketClose) error
 
 	ContainerStart(context.Context, FieldSet, *pb.Start) error
 
@@ -169,6 +172,16 @@ func (SinkDefaults) TaskExit(context.Context, FieldSet, *pb.TaskExit) error {
 	return nil
 }
 
+// PageFault implements Sink.PageFault.
+func (SinkDefaults) PageFault(context.Context, FieldSet, *pb.PageFault) error {
+	return nil
+}
+
+// SocketClose implements Sink.SocketClose.
+func (SinkDefaults) SocketClose(context.Context, FieldSet, *pb.SocketClose) error {
+	return nil
+}
+
 // RawSyscall implements Sink.RawSyscall.
 func (SinkDefaults) RawSyscall(context.Context, FieldSet, *pb.Syscall) error {
 	return nil
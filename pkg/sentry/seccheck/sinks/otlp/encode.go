@@ -0,0 +1,313 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gvisor.dev/gvisor/pkg/rand"
+	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
+)
+
+// The types below mirror the JSON encoding of the OTLP trace protocol
+// (opentelemetry/proto/collector/trace/v1/trace_service.proto). 64-bit
+// integers are encoded as strings, as required by the protobuf JSON mapping.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            *status    `json:"status,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string     `json:"stringValue,omitempty"`
+	BoolValue   *bool       `json:"boolValue,omitempty"`
+	IntValue    *string     `json:"intValue,omitempty"`
+	DoubleValue *float64    `json:"doubleValue,omitempty"`
+	BytesValue  []byte      `json:"bytesValue,omitempty"`
+	ArrayValue  *arrayValue `json:"arrayValue,omitempty"`
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+const (
+	// scopeName is the instrumentation scope reported for all spans.
+	scopeName = "gvisor.dev/gvisor/pkg/sentry/seccheck"
+
+	// spanKindInternal is SPAN_KIND_INTERNAL.
+	spanKindInternal = 1
+	// statusCodeError is STATUS_CODE_ERROR.
+	statusCodeError = 2
+)
+
+func stringAttr(key, v string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &v}}
+}
+
+func intAttr(key string, v int64) keyValue {
+	s := strconv.FormatInt(v, 10)
+	return keyValue{Key: key, Value: anyValue{IntValue: &s}}
+}
+
+// encoder converts points into OTLP spans. It's not thread-safe.
+type encoder struct {
+	// nextSpanID is used to generate unique span IDs. It's initialized with
+	// a random value so that IDs from different sandboxes don't collide.
+	nextSpanID uint64
+}
+
+func newEncoder() *encoder {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return &encoder{nextSpanID: binary.LittleEndian.Uint64(b[:])}
+}
+
+// encode converts batch into an export request. Spans are grouped by
+// container, with the container ID added to the common resource attributes.
+func (e *encoder) encode(common []keyValue, batch []point) *exportRequest {
+	req := &exportRequest{}
+	byContainer := make(map[string]int)
+	for _, p := range batch {
+		id := containerID(p.msg)
+		i, ok := byContainer[id]
+		if !ok {
+			attrs := append([]keyValue(nil), common...)
+			if len(id) > 0 {
+				attrs = append(attrs, stringAttr("container.id", id))
+			}
+			i = len(req.ResourceSpans)
+			byContainer[id] = i
+			req.ResourceSpans = append(req.ResourceSpans, resourceSpans{
+				Resource:   resource{Attributes: attrs},
+				ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}}},
+			})
+		}
+		ss := &req.ResourceSpans[i].ScopeSpans[0]
+		ss.Spans = append(ss.Spans, e.span(id, p))
+	}
+	return req
+}
+
+// contextData returns the context data in msg, or nil if it has none.
+func contextData(msg proto.Message) *pb.ContextData {
+	if m, ok := msg.(interface{ GetContextData() *pb.ContextData }); ok {
+		return m.GetContextData()
+	}
+	return nil
+}
+
+// containerID returns the ID of the container where msg was generated, or
+// the empty string if the container.id context field was not collected.
+func containerID(msg proto.Message) string {
+	if start, ok := msg.(*pb.Start); ok {
+		return start.GetId()
+	}
+	return contextData(msg).GetContainerId()
+}
+
+// spanName returns the span name for msgType, which matches the name of the
+// point that generated it, e.g. "syscall/open" or "sentry/clone".
+func spanName(msgType pb.MessageType) string {
+	n := strings.ToLower(strings.TrimPrefix(msgType.String(), "MESSAGE_"))
+	return strings.Replace(n, "_", "/", 1)
+}
+
+// traceID returns the trace ID for points generated by the given process.
+// All points from a process belong to the same trace.
+func traceID(container string, cd *pb.ContextData) string {
+	h := sha256.New()
+	h.Write([]byte(container))
+	var b [12]byte
+	binary.LittleEndian.PutUint32(b[:4], uint32(cd.GetThreadGroupId()))
+	binary.LittleEndian.PutUint64(b[4:], uint64(cd.GetThreadGroupStartTimeNs()))
+	h.Write(b[:])
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func (e *encoder) span(container string, p point) span {
+	e.nextSpanID++
+	if e.nextSpanID == 0 {
+		// Zero is an invalid span ID.
+		e.nextSpanID++
+	}
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], e.nextSpanID)
+
+	cd := contextData(p.msg)
+	ts := strconv.FormatInt(p.timeNs, 10)
+	s := span{
+		TraceID:           traceID(container, cd),
+		SpanID:            hex.EncodeToString(id[:]),
+		Name:              spanName(p.msgType),
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: ts,
+		EndTimeUnixNano:   ts,
+	}
+	if cd != nil {
+		s.Attributes = contextAttributes(cd)
+	}
+	s.Attributes = appendAttributes(s.Attributes, "gvisor.", p.msg.ProtoReflect())
+
+	if m, ok := p.msg.(interface{ GetExit() *pb.Exit }); ok {
+		if errno := m.GetExit().GetErrorno(); errno != 0 {
+			s.Status = &status{
+				Code:    statusCodeError,
+				Message: "errno " + strconv.FormatInt(errno, 10),
+			}
+		}
+	}
+	if pf, ok := p.msg.(*pb.PageFault); ok && !pf.GetHandled() {
+		s.Status = &status{
+			Code:    statusCodeError,
+			Message: "unhandled fault",
+		}
+	}
+	return s
+}
+
+// contextAttributes converts cd into span attributes, using semantic
+// convention names where one exists.
+func contextAttributes(cd *pb.ContextData) []keyValue {
+	var attrs []keyValue
+	if cd.GetThreadGroupId() != 0 {
+		attrs = append(attrs, intAttr("process.pid", int64(cd.GetThreadGroupId())))
+	}
+	if cd.GetThreadId() != 0 {
+		attrs = append(attrs, intAttr("thread.id", int64(cd.GetThreadId())))
+	}
+	if len(cd.GetProcessName()) > 0 {
+		attrs = append(attrs, stringAttr("process.executable.name", cd.GetProcessName()))
+	}
+	if len(cd.GetCwd()) > 0 {
+		attrs = append(attrs, stringAttr("gvisor.cwd", cd.GetCwd()))
+	}
+	if creds := cd.GetCredentials(); creds != nil {
+		attrs = appendAttributes(attrs, "gvisor.credentials.", creds.ProtoReflect())
+	}
+	return attrs
+}
+
+// appendAttributes appends the populated fields of m to attrs, with nested
+// messages flattened into dotted keys. Context data is skipped because it's
+// handled by contextAttributes.
+func appendAttributes(attrs []keyValue, prefix string, m protoreflect.Message) []keyValue {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		key := prefix + string(fd.Name())
+		switch {
+		case fd.IsMap():
+			// Not used by any point.
+		case fd.IsList():
+			l := v.List()
+			arr := &arrayValue{}
+			for i := 0; i < l.Len(); i++ {
+				if av, ok := scalarValue(fd, l.Get(i)); ok {
+					arr.Values = append(arr.Values, av)
+				}
+			}
+			if len(arr.Values) > 0 {
+				attrs = append(attrs, keyValue{Key: key, Value: anyValue{ArrayValue: arr}})
+			}
+		case fd.Kind() == protoreflect.MessageKind:
+			if fd.Name() != "context_data" {
+				attrs = appendAttributes(attrs, key+".", v.Message())
+			}
+		default:
+			if av, ok := scalarValue(fd, v); ok {
+				attrs = append(attrs, keyValue{Key: key, Value: av})
+			}
+		}
+		return true
+	})
+	return attrs
+}
+
+// scalarValue converts a non-message value of field fd into an attribute
+// value.
+func scalarValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) (anyValue, bool) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b := v.Bool()
+		return anyValue{BoolValue: &b}, true
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		s := strconv.FormatInt(v.Int(), 10)
+		return anyValue{IntValue: &s}, true
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// OTLP integers are signed; values above MaxInt64 wrap around.
+		s := strconv.FormatInt(int64(v.Uint()), 10)
+		return anyValue{IntValue: &s}, true
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		f := v.Float()
+		return anyValue{DoubleValue: &f}, true
+	case protoreflect.StringKind:
+		s := v.String()
+		return anyValue{StringValue: &s}, true
+	case protoreflect.BytesKind:
+		return anyValue{BytesValue: v.Bytes()}, true
+	case protoreflect.EnumKind:
+		s := strconv.Itoa(int(v.Enum()))
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			s = string(ev.Name())
+		}
+		return anyValue{StringValue: &s}, true
+	}
+	return anyValue{}, false
+}
@@ -0,0 +1,532 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlp defines a seccheck.Sink that exports points as OpenTelemetry
+// spans using the OTLP/HTTP JSON protocol. Points are exported asynchronously
+// in batches, and dropped if the collector can't keep up.
+package otlp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"google.golang.org/protobuf/proto"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/cleanup"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fd"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/seccheck"
+	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
+)
+
+const name = "otlp"
+
+const (
+	defaultPath          = "/v1/traces"
+	defaultServiceName   = "gvisor"
+	defaultBatchSize     = 512
+	defaultQueueSize     = 4096
+	defaultFlushInterval = time.Second
+	defaultTimeout       = 10 * time.Second
+)
+
+func init() {
+	seccheck.RegisterSink(seccheck.SinkDesc{
+		Name:  name,
+		Setup: setupSink,
+		New:   new,
+	})
+}
+
+// point is a trace point waiting to be exported.
+type point struct {
+	msgType pb.MessageType
+	msg     proto.Message
+	// timeNs is the time the point was generated.
+	timeNs int64
+}
+
+// otlp converts points into spans and sends them to an OpenTelemetry
+// collector over a connection established by setupSink. The sandbox cannot
+// reconnect, so the collector must keep the connection alive.
+type otlp struct {
+	endpoint *fd.FD
+	// resp buffers responses read from endpoint.
+	resp *bufio.Reader
+
+	// host is the value of the HTTP Host header.
+	host string
+	// path is the HTTP path that spans are posted to.
+	path string
+
+	// resource holds the resource attributes common to all containers.
+	resource []keyValue
+
+	batchSize     int
+	flushInterval time.Duration
+
+	queue chan point
+
+	// broken is set when a request to the collector fails mid-way, leaving
+	// the connection in an unknown state. All following points are dropped.
+	// It's only accessed by the exporter goroutine.
+	broken bool
+
+	droppedCount atomicbitops.Uint64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var _ seccheck.Sink = (*otlp)(nil)
+
+// setupSink connects to the collector and returns a file that can be used to
+// communicate with it. The caller is responsible to close the file.
+func setupSink(config map[string]any) (*os.File, error) {
+	addr, err := parseString(config, "endpoint", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(addr) == 0 {
+		return nil, fmt.Errorf("endpoint not present in configuration")
+	}
+	timeout, err := parseDuration(config, "timeout", defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return setup(addr, timeout)
+}
+
+// setup connects to addr, which is either an absolute path to a Unix-domain
+// socket or a TCP "host:port" address.
+func setup(addr string, timeout time.Duration) (*os.File, error) {
+	log.Debugf("OTLP sink connecting to %q", addr)
+	var (
+		domain int
+		sa     unix.Sockaddr
+	)
+	if filepath.IsAbs(addr) {
+		domain = unix.AF_UNIX
+		sa = &unix.SockaddrUnix{Name: addr}
+	} else {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %q: %w", addr, err)
+		}
+		if ip4 := tcpAddr.IP.To4(); ip4 != nil {
+			domain = unix.AF_INET
+			sa4 := &unix.SockaddrInet4{Port: tcpAddr.Port}
+			copy(sa4.Addr[:], ip4)
+			sa = sa4
+		} else {
+			domain = unix.AF_INET6
+			sa6 := &unix.SockaddrInet6{Port: tcpAddr.Port}
+			copy(sa6.Addr[:], tcpAddr.IP.To16())
+			sa = sa6
+		}
+	}
+
+	socket, err := unix.Socket(domain, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("socket(%d, SOCK_STREAM, 0): %w", domain, err)
+	}
+	f := os.NewFile(uintptr(socket), addr)
+	cu := cleanup.Make(func() {
+		_ = f.Close()
+	})
+	defer cu.Clean()
+
+	if err := unix.Connect(socket, sa); err != nil {
+		return nil, fmt.Errorf("connect(%q): %w", addr, err)
+	}
+	// Bound the time the exporter can be blocked by an unresponsive
+	// collector. Timeouts are set here because they cannot be changed once
+	// inside the sandbox.
+	tv := unix.NsecToTimeval(timeout.Nanoseconds())
+	for _, opt := range []int{unix.SO_RCVTIMEO, unix.SO_SNDTIMEO} {
+		if err := unix.SetsockoptTimeval(socket, unix.SOL_SOCKET, opt, &tv); err != nil {
+			return nil, fmt.Errorf("setsockopt(%d): %w", opt, err)
+		}
+	}
+
+	cu.Release()
+	return f, nil
+}
+
+func parseString(config map[string]any, name, def string) (string, error) {
+	opaque, ok := config[name]
+	if !ok {
+		return def, nil
+	}
+	rv, ok := opaque.(string)
+	if !ok {
+		return "", fmt.Errorf("%s %v is not a string", name, opaque)
+	}
+	return rv, nil
+}
+
+func parseInt(config map[string]any, name string, def int) (int, error) {
+	opaque, ok := config[name]
+	if !ok {
+		return def, nil
+	}
+	f, ok := opaque.(float64)
+	if !ok || float64(int(f)) != f || f <= 0 {
+		return 0, fmt.Errorf("%s %v is not a positive int", name, opaque)
+	}
+	return int(f), nil
+}
+
+func parseDuration(config map[string]any, name string, def time.Duration) (time.Duration, error) {
+	opaque, ok := config[name]
+	if !ok {
+		return def, nil
+	}
+	duration, ok := opaque.(string)
+	if !ok {
+		return 0, fmt.Errorf("%s %v is not a string", name, opaque)
+	}
+	rv, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, err
+	}
+	if rv <= 0 {
+		return 0, fmt.Errorf("%s %v must be positive", name, opaque)
+	}
+	return rv, nil
+}
+
+// new creates a new OTLP sink.
+func new(config map[string]any, endpoint *fd.FD) (seccheck.Sink, error) {
+	if endpoint == nil {
+		return nil, fmt.Errorf("otlp sink requires an endpoint")
+	}
+	addr, err := parseString(config, "endpoint", "")
+	if err != nil {
+		return nil, err
+	}
+	o := &otlp{
+		endpoint: endpoint,
+		resp:     bufio.NewReader(fd.NewReadWriter(endpoint.FD())),
+		host:     addr,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if len(o.host) == 0 || filepath.IsAbs(o.host) {
+		o.host = "localhost"
+	}
+	if o.path, err = parseString(config, "path", defaultPath); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(o.path, "/") {
+		return nil, fmt.Errorf("path %q must be absolute", o.path)
+	}
+	serviceName, err := parseString(config, "service_name", defaultServiceName)
+	if err != nil {
+		return nil, err
+	}
+	o.resource = append(o.resource, stringAttr("service.name", serviceName))
+	if opaque, ok := config["resource_attributes"]; ok {
+		attrs, ok := opaque.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("resource_attributes %v is not an object", opaque)
+		}
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s, ok := attrs[k].(string)
+			if !ok {
+				return nil, fmt.Errorf("resource attribute %q value %v is not a string", k, attrs[k])
+			}
+			o.resource = append(o.resource, stringAttr(k, s))
+		}
+	}
+	if o.batchSize, err = parseInt(config, "batch_size", defaultBatchSize); err != nil {
+		return nil, err
+	}
+	queueSize, err := parseInt(config, "queue_size", defaultQueueSize)
+	if err != nil {
+		return nil, err
+	}
+	o.queue = make(chan point, queueSize)
+	if o.flushInterval, err = parseDuration(config, "flush_interval", defaultFlushInterval); err != nil {
+		return nil, err
+	}
+
+	log.Debugf("OTLP sink created, endpoint FD: %d, host: %q, path: %q", o.endpoint.FD(), o.host, o.path)
+	go o.run() // S/R-SAFE: sinks are not saved.
+	return o, nil
+}
+
+// Name implements seccheck.Sink.
+func (*otlp) Name() string {
+	return name
+}
+
+// Status implements seccheck.Sink.
+func (o *otlp) Status() seccheck.SinkStatus {
+	return seccheck.SinkStatus{
+		DroppedCount: o.droppedCount.Load(),
+	}
+}
+
+// Stop implements seccheck.Sink. Points still queued are flushed before the
+// connection is closed.
+func (o *otlp) Stop() {
+	o.stopOnce.Do(func() {
+		close(o.stop)
+		<-o.done
+		o.endpoint.Close()
+	})
+}
+
+// enqueue queues msg for export, dropping it if the queue is full. Messages
+// are converted to spans by the exporter goroutine to keep the cost on the
+// application's path low.
+func (o *otlp) enqueue(msgType pb.MessageType, msg proto.Message) {
+	// Spans need a timestamp, but the time context field may not have been
+	// collected.
+	timeNs := contextData(msg).GetTimeNs()
+	if timeNs == 0 {
+		timeNs = time.Now().UnixNano()
+	}
+	select {
+	case o.queue <- point{msgType: msgType, msg: msg, timeNs: timeNs}:
+	default:
+		o.droppedCount.Add(1)
+	}
+}
+
+// Clone implements seccheck.Sink.
+func (o *otlp) Clone(_ context.Context, _ seccheck.FieldSet, info *pb.CloneInfo) error {
+	o.enqueue(pb.MessageType_MESSAGE_SENTRY_CLONE, info)
+	return nil
+}
+
+// Execve implements seccheck.Sink.
+func (o *otlp) Execve(_ context.Context, _ seccheck.FieldSet, info *pb.ExecveInfo) error {
+	o.enqueue(pb.MessageType_MESSAGE_SENTRY_EXEC, info)
+	return nil
+}
+
+// ExitNotifyParent implements seccheck.Sink.
+func (o *otlp) ExitNotifyParent(_ context.Context, _ seccheck.FieldSet, info *pb.ExitNotifyParentInfo) error {
+	o.enqueue(pb.MessageType_MESSAGE_SENTRY_EXIT_NOTIFY_PARENT, info)
+	return nil
+}
+
+// TaskExit implements seccheck.Sink.
+func (o *otlp) TaskExit(_ context.Context, _ seccheck.FieldSet, info *pb.TaskExit) error {
+	o.enqueue(pb.MessageType_MESSAGE_SENTRY_TASK_EXIT, info)
+	return nil
+}
+
+// PageFault implements seccheck.Sink.
+func (o *otlp) PageFault(_ context.Context, _ seccheck.FieldSet, info *pb.PageFault) error {
+	o.enqueue(pb.MessageType_MESSAGE_SENTRY_PAGE_FAULT, info)
+	return nil
+}
+
+// SocketClose implements seccheck.Sink.
+func (o *otlp) SocketClose(_ context.Context, _ seccheck.FieldSet, info *pb.SocketClose) error {
+	o.enqueue(pb.MessageType_MESSAGE_NETSTACK_SOCKET_CLOSE, info)
+	return nil
+}
+
+// ContainerStart implements seccheck.Sink.
+func (o *otlp) ContainerStart(_ context.Context, _ seccheck.FieldSet, info *pb.Start) error {
+	o.enqueue(pb.MessageType_MESSAGE_CONTAINER_START, info)
+	return nil
+}
+
+// RawSyscall implements seccheck.Sink.
+func (o *otlp) RawSyscall(_ context.Context, _ seccheck.FieldSet, info *pb.Syscall) error {
+	o.enqueue(pb.MessageType_MESSAGE_SYSCALL_RAW, info)
+	return nil
+}
+
+// Syscall implements seccheck.Sink.
+func (o *otlp) Syscall(_ context.Context, _ seccheck.FieldSet, _ *pb.ContextData, msgType pb.MessageType, msg proto.Message) error {
+	o.enqueue(msgType, msg)
+	return nil
+}
+
+// run exports queued points until the sink is stopped.
+func (o *otlp) run() {
+	defer close(o.done)
+
+	enc := newEncoder()
+	ticker := time.NewTicker(o.flushInterval)
+	defer ticker.Stop()
+	var batch []point
+	for {
+		select {
+		case p := <-o.queue:
+			batch = append(batch, p)
+			if len(batch) >= o.batchSize {
+				o.export(enc, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				o.export(enc, batch)
+				batch = batch[:0]
+			}
+		case <-o.stop:
+			// Flush points queued before Stop was called. This is the only
+			// receiver, so the length can't shrink concurrently.
+			for len(o.queue) > 0 {
+				batch = append(batch, <-o.queue)
+			}
+			if len(batch) > 0 {
+				o.export(enc, batch)
+			}
+			return
+		}
+	}
+}
+
+// export sends batch to the collector. Points are dropped if the request
+// fails.
+func (o *otlp) export(enc *encoder, batch []point) {
+	if o.broken {
+		o.droppedCount.Add(uint64(len(batch)))
+		return
+	}
+	body, err := json.Marshal(enc.encode(o.resource, batch))
+	if err != nil {
+		log.Debugf("OTLP marshal failed, dropping %d points: %v", len(batch), err)
+		o.droppedCount.Add(uint64(len(batch)))
+		return
+	}
+	if err := o.post(body); err != nil {
+		log.Debugf("OTLP export failed, dropping %d points: %v", len(batch), err)
+		o.droppedCount.Add(uint64(len(batch)))
+	}
+}
+
+// post sends body in an HTTP/1.1 POST request and waits for the response.
+func (o *otlp) post(body []byte) error {
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "POST %s HTTP/1.1\r\n", o.path)
+	fmt.Fprintf(&req, "Host: %s\r\n", o.host)
+	fmt.Fprintf(&req, "Content-Type: application/json\r\n")
+	fmt.Fprintf(&req, "Content-Length: %d\r\n\r\n", len(body))
+	req.Write(body)
+
+	if _, err := fd.NewReadWriter(o.endpoint.FD()).Write(req.Bytes()); err != nil {
+		o.setBroken(err)
+		return fmt.Errorf("writing request: %w", err)
+	}
+	code, status, err := readResponse(o.resp)
+	if err != nil {
+		o.setBroken(err)
+		return err
+	}
+	if code < 200 || code > 299 {
+		return fmt.Errorf("collector returned %q", status)
+	}
+	return nil
+}
+
+func (o *otlp) setBroken(err error) {
+	log.Warningf("OTLP sink connection failed, dropping all further points: %v", err)
+	o.broken = true
+}
+
+// readResponse reads an HTTP/1.1 response from r, discarding its body so the
+// connection can be reused. It returns the status code and status line.
+func readResponse(r *bufio.Reader) (int, string, error) {
+	tp := textproto.NewReader(r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return 0, "", fmt.Errorf("reading status line: %w", err)
+	}
+	// Status line is "HTTP/1.1 200 OK".
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+		return 0, "", fmt.Errorf("malformed status line %q", line)
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed status line %q", line)
+	}
+	hdr, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return 0, "", fmt.Errorf("reading headers: %w", err)
+	}
+
+	if strings.EqualFold(hdr.Get("Transfer-Encoding"), "chunked") {
+		if err := discardChunked(r); err != nil {
+			return 0, "", err
+		}
+	} else if cl := hdr.Get("Content-Length"); len(cl) > 0 {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n < 0 {
+			return 0, "", fmt.Errorf("malformed Content-Length %q", cl)
+		}
+		if _, err := r.Discard(int(n)); err != nil {
+			return 0, "", fmt.Errorf("reading body: %w", err)
+		}
+	}
+	return code, line, nil
+}
+
+// discardChunked discards a body with chunked transfer encoding from r.
+func discardChunked(r *bufio.Reader) error {
+	tp := textproto.NewReader(r)
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return fmt.Errorf("reading chunk size: %w", err)
+		}
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		size, err := strconv.ParseUint(strings.TrimSpace(line), 16, 31)
+		if err != nil {
+			return fmt.Errorf("malformed chunk size %q", line)
+		}
+		if size == 0 {
+			// Skip trailers.
+			if _, err := tp.ReadMIMEHeader(); err != nil {
+				return fmt.Errorf("reading trailers: %w", err)
+			}
+			return nil
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return fmt.Errorf("reading chunk: %w", err)
+		}
+		if _, err := tp.ReadLine(); err != nil {
+			return fmt.Errorf("reading chunk: %w", err)
+		}
+	}
+}
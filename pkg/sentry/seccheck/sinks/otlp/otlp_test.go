@@ -0,0 +1,328 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/fd"
+	"gvisor.dev/gvisor/pkg/sentry/seccheck"
+	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
+)
+
+// collector reads a single export request from f, replies with resp and
+// sends the decoded request to ch.
+func collector(t *testing.T, f *os.File, resp string, ch chan<- *exportRequest) {
+	req, err := http.ReadRequest(bufio.NewReader(f))
+	if err != nil {
+		t.Errorf("ReadRequest: %v", err)
+		close(ch)
+		return
+	}
+	if req.Method != "POST" || req.URL.Path != "/v1/traces" || req.Host != "collector:4318" {
+		t.Errorf("unexpected request: %s %s, host: %q", req.Method, req.URL, req.Host)
+	}
+	if got := req.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type: got %q, want application/json", got)
+	}
+	export := &exportRequest{}
+	if err := json.NewDecoder(req.Body).Decode(export); err != nil {
+		t.Errorf("decoding request: %v", err)
+	}
+	if _, err := f.Write([]byte(resp)); err != nil {
+		t.Errorf("writing response: %v", err)
+	}
+	ch <- export
+}
+
+func newTestSink(t *testing.T, config map[string]any) (*otlp, *os.File) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("socketpair: %v", err)
+	}
+	config["endpoint"] = "collector:4318"
+	sink, err := new(config, fd.New(fds[0]))
+	if err != nil {
+		t.Fatalf("new(): %v", err)
+	}
+	return sink.(*otlp), os.NewFile(uintptr(fds[1]), "collector")
+}
+
+func findAttr(attrs []keyValue, key string) *anyValue {
+	for i := range attrs {
+		if attrs[i].Key == key {
+			return &attrs[i].Value
+		}
+	}
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	sink, peer := newTestSink(t, map[string]any{
+		"resource_attributes": map[string]any{"k8s.pod.name": "pod"},
+	})
+	defer peer.Close()
+
+	ch := make(chan *exportRequest, 1)
+	go collector(t, peer, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\n{}", ch)
+
+	ctxData := &pb.ContextData{
+		TimeNs:        1000,
+		ThreadId:      2,
+		ThreadGroupId: 1,
+		ContainerId:   "abc",
+		ProcessName:   "cat",
+	}
+	open := &pb.Open{
+		ContextData: ctxData,
+		Exit:        &pb.Exit{Result: -2, Errorno: 2},
+		Pathname:    "/foo",
+	}
+	if err := sink.Syscall(nil, seccheck.FieldSet{}, ctxData, pb.MessageType_MESSAGE_SYSCALL_OPEN, open); err != nil {
+		t.Fatalf("Syscall(): %v", err)
+	}
+	if err := sink.ContainerStart(nil, seccheck.FieldSet{}, &pb.Start{Id: "def"}); err != nil {
+		t.Fatalf("ContainerStart(): %v", err)
+	}
+	// Stop flushes queued points.
+	sink.Stop()
+
+	export := <-ch
+	if export == nil {
+		t.FailNow()
+	}
+	if got := len(export.ResourceSpans); got != 2 {
+		t.Fatalf("got %d resource spans, want 2", got)
+	}
+	for i, want := range []struct {
+		container string
+		span      string
+	}{
+		{container: "abc", span: "syscall/open"},
+		{container: "def", span: "container/start"},
+	} {
+		rs := export.ResourceSpans[i]
+		if v := findAttr(rs.Resource.Attributes, "container.id"); v == nil || v.StringValue == nil || *v.StringValue != want.container {
+			t.Errorf("resource %d: container.id: got %+v, want %q", i, v, want.container)
+		}
+		if v := findAttr(rs.Resource.Attributes, "service.name"); v == nil || v.StringValue == nil || *v.StringValue != defaultServiceName {
+			t.Errorf("resource %d: service.name: got %+v, want %q", i, v, defaultServiceName)
+		}
+		if v := findAttr(rs.Resource.Attributes, "k8s.pod.name"); v == nil || v.StringValue == nil || *v.StringValue != "pod" {
+			t.Errorf("resource %d: k8s.pod.name: got %+v, want %q", i, v, "pod")
+		}
+		if len(rs.ScopeSpans) != 1 || len(rs.ScopeSpans[0].Spans) != 1 {
+			t.Fatalf("resource %d: unexpected spans: %+v", i, rs.ScopeSpans)
+		}
+		if got := rs.ScopeSpans[0].Spans[0].Name; got != want.span {
+			t.Errorf("resource %d: span name: got %q, want %q", i, got, want.span)
+		}
+	}
+
+	span := export.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.StartTimeUnixNano != "1000" || span.EndTimeUnixNano != "1000" {
+		t.Errorf("span time: got [%s, %s], want [1000, 1000]", span.StartTimeUnixNano, span.EndTimeUnixNano)
+	}
+	if len(span.TraceID) != 32 || len(span.SpanID) != 16 {
+		t.Errorf("invalid IDs, trace: %q, span: %q", span.TraceID, span.SpanID)
+	}
+	if span.Status == nil || span.Status.Code != statusCodeError {
+		t.Errorf("status: got %+v, want error", span.Status)
+	}
+	for key, want := range map[string]string{
+		"gvisor.pathname":         "/foo",
+		"process.executable.name": "cat",
+	} {
+		if v := findAttr(span.Attributes, key); v == nil || v.StringValue == nil || *v.StringValue != want {
+			t.Errorf("attribute %q: got %+v, want %q", key, v, want)
+		}
+	}
+	for key, want := range map[string]string{
+		"gvisor.exit.errorno": "2",
+		"process.pid":         "1",
+		"thread.id":           "2",
+	} {
+		if v := findAttr(span.Attributes, key); v == nil || v.IntValue == nil || *v.IntValue != want {
+			t.Errorf("attribute %q: got %+v, want %q", key, v, want)
+		}
+	}
+	if v := findAttr(span.Attributes, "gvisor.context_data.time_ns"); v != nil {
+		t.Errorf("context data should not be flattened into attributes")
+	}
+}
+
+func TestSentryPoints(t *testing.T) {
+	sink, peer := newTestSink(t, map[string]any{})
+	defer peer.Close()
+
+	ch := make(chan *exportRequest, 1)
+	go collector(t, peer, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\n{}", ch)
+
+	ctxData := &pb.ContextData{TimeNs: 1000, ContainerId: "abc"}
+	fault := &pb.PageFault{
+		ContextData: ctxData,
+		Address:     0x1000,
+		Access:      "-w-",
+	}
+	if err := sink.PageFault(nil, seccheck.FieldSet{}, fault); err != nil {
+		t.Fatalf("PageFault(): %v", err)
+	}
+	closed := &pb.SocketClose{
+		ContextData:   ctxData,
+		Domain:        unix.AF_INET,
+		Type:          unix.SOCK_STREAM,
+		RemoteAddress: "10.0.0.1:80",
+		State:         "ESTABLISHED",
+		PacketsSent:   3,
+	}
+	if err := sink.SocketClose(nil, seccheck.FieldSet{}, closed); err != nil {
+		t.Fatalf("SocketClose(): %v", err)
+	}
+	sink.Stop()
+
+	export := <-ch
+	if export == nil {
+		t.FailNow()
+	}
+	if len(export.ResourceSpans) != 1 || len(export.ResourceSpans[0].ScopeSpans[0].Spans) != 2 {
+		t.Fatalf("unexpected spans: %+v", export.ResourceSpans)
+	}
+	spans := export.ResourceSpans[0].ScopeSpans[0].Spans
+
+	if got, want := spans[0].Name, "sentry/page_fault"; got != want {
+		t.Errorf("span name: got %q, want %q", got, want)
+	}
+	if spans[0].Status == nil || spans[0].Status.Code != statusCodeError {
+		t.Errorf("unhandled fault status: got %+v, want error", spans[0].Status)
+	}
+	if v := findAttr(spans[0].Attributes, "gvisor.address"); v == nil || v.IntValue == nil || *v.IntValue != "4096" {
+		t.Errorf("attribute gvisor.address: got %+v, want 4096", v)
+	}
+
+	if got, want := spans[1].Name, "netstack/socket_close"; got != want {
+		t.Errorf("span name: got %q, want %q", got, want)
+	}
+	if spans[1].Status != nil {
+		t.Errorf("status: got %+v, want nil", spans[1].Status)
+	}
+	for key, want := range map[string]string{
+		"gvisor.remote_address": "10.0.0.1:80",
+		"gvisor.state":          "ESTABLISHED",
+	} {
+		if v := findAttr(spans[1].Attributes, key); v == nil || v.StringValue == nil || *v.StringValue != want {
+			t.Errorf("attribute %q: got %+v, want %q", key, v, want)
+		}
+	}
+	if v := findAttr(spans[1].Attributes, "gvisor.packets_sent"); v == nil || v.IntValue == nil || *v.IntValue != "3" {
+		t.Errorf("attribute gvisor.packets_sent: got %+v, want 3", v)
+	}
+}
+
+func TestExportFailure(t *testing.T) {
+	sink, peer := newTestSink(t, map[string]any{})
+	defer peer.Close()
+
+	ch := make(chan *exportRequest, 1)
+	go collector(t, peer, "HTTP/1.1 400 Bad Request\r\nContent-Length: 3\r\n\r\nbad", ch)
+	if err := sink.RawSyscall(nil, seccheck.FieldSet{}, &pb.Syscall{Sysno: 1}); err != nil {
+		t.Fatalf("RawSyscall(): %v", err)
+	}
+	sink.Stop()
+	<-ch
+
+	if got := sink.Status().DroppedCount; got != 1 {
+		t.Errorf("DroppedCount: got %d, want 1", got)
+	}
+	if sink.broken {
+		t.Errorf("connection should be reusable after an error response")
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		resp     string
+		wantCode int
+		wantErr  bool
+	}{
+		{
+			name:     "content-length",
+			resp:     "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\n{}",
+			wantCode: 200,
+		},
+		{
+			name:     "chunked",
+			resp:     "HTTP/1.1 202 Accepted\r\nTransfer-Encoding: chunked\r\n\r\n2\r\n{}\r\n1;ext\r\n \r\n0\r\n\r\n",
+			wantCode: 202,
+		},
+		{
+			name:     "no body",
+			resp:     "HTTP/1.1 503 Service Unavailable\r\n\r\n",
+			wantCode: 503,
+		},
+		{
+			name:    "malformed status",
+			resp:    "garbage\r\n\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "truncated body",
+			resp:    "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n{}",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Append a sentinel to check that the body is fully consumed.
+			r := bufio.NewReader(strings.NewReader(tc.resp + "next"))
+			code, _, err := readResponse(r)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("readResponse() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readResponse(): %v", err)
+			}
+			if code != tc.wantCode {
+				t.Errorf("code: got %d, want %d", code, tc.wantCode)
+			}
+			if rest, _ := r.ReadString(0); rest != "next" {
+				t.Errorf("unread data: got %q, want %q", rest, "next")
+			}
+		})
+	}
+}
+
+func TestSpanName(t *testing.T) {
+	for msgType, want := range map[pb.MessageType]string{
+		pb.MessageType_MESSAGE_SYSCALL_OPEN:              "syscall/open",
+		pb.MessageType_MESSAGE_SYSCALL_TIMERFD_CREATE:    "syscall/timerfd_create",
+		pb.MessageType_MESSAGE_SENTRY_EXIT_NOTIFY_PARENT: "sentry/exit_notify_parent",
+		pb.MessageType_MESSAGE_CONTAINER_START:           "container/start",
+		pb.MessageType_MESSAGE_SENTRY_PAGE_FAULT:         "sentry/page_fault",
+		pb.MessageType_MESSAGE_NETSTACK_SOCKET_CLOSE:     "netstack/socket_close",
+	} {
+		if got := spanName(msgType); got != want {
+			t.Errorf("spanName(%v): got %q, want %q", msgType, got, want)
+		}
+	}
+}
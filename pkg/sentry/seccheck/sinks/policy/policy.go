@@ -0,0 +1,309 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy defines a seccheck.Sink that evaluates user-defined rules
+// against trace points inside the sentry. Matching points generate structured
+// alerts and, optionally, kill the offending process.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fd"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/seccheck"
+	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+const name = "policy"
+
+func init() {
+	seccheck.RegisterSink(seccheck.SinkDesc{
+		Name:  name,
+		Setup: setupSink,
+		New:   new,
+	})
+}
+
+// policy evaluates rules against points. Rules are evaluated synchronously by
+// the task that raised the point, so that enforcement happens before the task
+// returns to the application.
+type policy struct {
+	// rules maps point names to the rules that apply to them.
+	rules map[string][]*rule
+
+	// pointNames maps the points that have rules to their names. It's used to
+	// find the point that a syscall message was raised for.
+	pointNames map[seccheck.Point]string
+
+	// endpoint is the file that alerts are written to. If nil, alerts are
+	// logged instead.
+	endpoint *fd.FD
+
+	// mu serializes writes to endpoint.
+	mu sync.Mutex
+
+	droppedCount atomicbitops.Uint64
+}
+
+var _ seccheck.Sink = (*policy)(nil)
+
+// alert is the JSON representation of an alert.
+type alert struct {
+	Time   string `json:"time"`
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Point  string `json:"point"`
+	// The fields below describe the process that raised the point. They are
+	// omitted if the point wasn't raised by a task.
+	ContainerID string `json:"container_id,omitempty"`
+	PID         int32  `json:"pid,omitempty"`
+	ProcessName string `json:"process_name,omitempty"`
+	// Event is the point that matched the rule.
+	Event json.RawMessage `json:"event"`
+}
+
+// setupSink opens the alert file, if configured. The caller is responsible to
+// close the file.
+func setupSink(config map[string]any) (*os.File, error) {
+	path, err := parseString(config, "alert_file", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, unix.O_WRONLY|unix.O_APPEND|unix.O_CREAT|unix.O_CLOEXEC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening alert file: %w", err)
+	}
+	return f, nil
+}
+
+func parseString(config map[string]any, name, def string) (string, error) {
+	opaque, ok := config[name]
+	if !ok {
+		return def, nil
+	}
+	rv, ok := opaque.(string)
+	if !ok {
+		return "", fmt.Errorf("%s %v is not a string", name, opaque)
+	}
+	return rv, nil
+}
+
+// new creates a new policy sink.
+func new(config map[string]any, endpoint *fd.FD) (seccheck.Sink, error) {
+	opaque, ok := config["rules"]
+	if !ok {
+		return nil, fmt.Errorf("rules not present in configuration")
+	}
+	rules, err := parseRules(opaque)
+	if err != nil {
+		return nil, err
+	}
+	p := &policy{
+		rules:      make(map[string][]*rule),
+		pointNames: make(map[seccheck.Point]string),
+		endpoint:   endpoint,
+	}
+	for _, r := range rules {
+		p.rules[r.point] = append(p.rules[r.point], r)
+	}
+	for _, desc := range seccheck.Points {
+		if _, ok := p.rules[desc.Name]; ok {
+			p.pointNames[desc.ID] = desc.Name
+		}
+	}
+	log.Debugf("Policy sink created with %d rules", len(rules))
+	return p, nil
+}
+
+// Name implements seccheck.Sink.
+func (*policy) Name() string {
+	return name
+}
+
+// Status implements seccheck.Sink.
+func (p *policy) Status() seccheck.SinkStatus {
+	return seccheck.SinkStatus{
+		DroppedCount: p.droppedCount.Load(),
+	}
+}
+
+// Stop implements seccheck.Sink.
+func (p *policy) Stop() {
+	if p.endpoint != nil {
+		p.endpoint.Close()
+	}
+}
+
+// Clone implements seccheck.Sink.
+func (p *policy) Clone(ctx context.Context, _ seccheck.FieldSet, info *pb.CloneInfo) error {
+	p.check(ctx, "sentry/clone", info)
+	return nil
+}
+
+// Execve implements seccheck.Sink.
+func (p *policy) Execve(ctx context.Context, _ seccheck.FieldSet, info *pb.ExecveInfo) error {
+	p.check(ctx, "sentry/execve", info)
+	return nil
+}
+
+// ExitNotifyParent implements seccheck.Sink.
+func (p *policy) ExitNotifyParent(ctx context.Context, _ seccheck.FieldSet, info *pb.ExitNotifyParentInfo) error {
+	p.check(ctx, "sentry/exit_notify_parent", info)
+	return nil
+}
+
+// TaskExit implements seccheck.Sink.
+func (p *policy) TaskExit(ctx context.Context, _ seccheck.FieldSet, info *pb.TaskExit) error {
+	p.check(ctx, "sentry/task_exit", info)
+	return nil
+}
+
+// PageFault implements seccheck.Sink.
+func (p *policy) PageFault(ctx context.Context, _ seccheck.FieldSet, info *pb.PageFault) error {
+	p.check(ctx, "sentry/page_fault", info)
+	return nil
+}
+
+// SocketClose implements seccheck.Sink.
+func (p *policy) SocketClose(ctx context.Context, _ seccheck.FieldSet, info *pb.SocketClose) error {
+	p.check(ctx, "netstack/socket_close", info)
+	return nil
+}
+
+// ContainerStart implements seccheck.Sink.
+func (p *policy) ContainerStart(ctx context.Context, _ seccheck.FieldSet, info *pb.Start) error {
+	p.check(ctx, "container/start", info)
+	return nil
+}
+
+// RawSyscall implements seccheck.Sink.
+func (p *policy) RawSyscall(ctx context.Context, _ seccheck.FieldSet, info *pb.Syscall) error {
+	typ := seccheck.SyscallRawEnter
+	if info.Exit != nil {
+		typ = seccheck.SyscallRawExit
+	}
+	if point, ok := p.pointNames[seccheck.GetPointForSyscall(typ, uintptr(info.Sysno))]; ok {
+		p.check(ctx, point, info)
+	}
+	return nil
+}
+
+// Syscall implements seccheck.Sink.
+func (p *policy) Syscall(ctx context.Context, _ seccheck.FieldSet, _ *pb.ContextData, _ pb.MessageType, msg proto.Message) error {
+	// All schematized syscall messages have sysno and exit fields.
+	m := msg.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	sysnoField := fields.ByName("sysno")
+	exitField := fields.ByName("exit")
+	if sysnoField == nil || exitField == nil {
+		return nil
+	}
+	typ := seccheck.SyscallEnter
+	if m.Has(exitField) {
+		typ = seccheck.SyscallExit
+	}
+	if point, ok := p.pointNames[seccheck.GetPointForSyscall(typ, uintptr(m.Get(sysnoField).Uint()))]; ok {
+		p.check(ctx, point, msg)
+	}
+	return nil
+}
+
+// check evaluates the rules for point against msg, and acts on the ones that
+// match.
+func (p *policy) check(ctx context.Context, point string, msg proto.Message) {
+	rules := p.rules[point]
+	if len(rules) == 0 {
+		return
+	}
+	m := msg.ProtoReflect()
+	for _, r := range rules {
+		matched, err := r.matches(m)
+		if err != nil {
+			log.Warningf("Policy rule %q cannot be evaluated for point %q: %v", r.name, point, err)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		t := kernel.TaskFromContext(ctx)
+		p.alert(t, r, point, m)
+		if r.action == actionKill {
+			if t == nil {
+				log.Warningf("Policy rule %q matched point %q outside of a task, nothing to kill", r.name, point)
+				continue
+			}
+			if err := t.ThreadGroup().SendSignal(&linux.SignalInfo{
+				Signo: int32(linux.SIGKILL),
+				Code:  linux.SI_KERNEL,
+			}); err != nil {
+				log.Warningf("Policy rule %q failed to kill process: %v", r.name, err)
+			}
+		}
+	}
+}
+
+// alert emits an alert for rule r matching msg.
+func (p *policy) alert(t *kernel.Task, r *rule, point string, msg protoreflect.Message) {
+	event, err := protojson.Marshal(msg.Interface())
+	if err != nil {
+		log.Warningf("Policy rule %q matched point %q, but it cannot be encoded: %v", r.name, point, err)
+		p.droppedCount.Add(1)
+		return
+	}
+	a := alert{
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Rule:   r.name,
+		Action: r.action.String(),
+		Point:  point,
+		Event:  event,
+	}
+	if t != nil {
+		a.ContainerID = t.ContainerID()
+		a.PID = int32(t.Kernel().TaskSet().Root.IDOfThreadGroup(t.ThreadGroup()))
+		a.ProcessName = t.Name()
+	}
+	out, err := json.Marshal(&a)
+	if err != nil {
+		log.Warningf("Policy rule %q matched point %q, but the alert cannot be encoded: %v", r.name, point, err)
+		p.droppedCount.Add(1)
+		return
+	}
+	if p.endpoint == nil {
+		log.Warningf("Policy alert: %s", out)
+		return
+	}
+	out = append(out, '\n')
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.endpoint.Write(out); err != nil {
+		log.Warningf("Failed to write policy alert: %v", err)
+		p.droppedCount.Add(1)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fd"
+	"gvisor.dev/gvisor/pkg/sentry/seccheck"
+	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
+)
+
+func init() {
+	seccheck.Initialize()
+}
+
+// decodeConfig decodes a JSON sink configuration, like runsc does.
+func decodeConfig(t *testing.T, config string) map[string]any {
+	var rv map[string]any
+	if err := json.Unmarshal([]byte(config), &rv); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", config, err)
+	}
+	return rv
+}
+
+func TestParseRulesError(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name:   "no rules",
+			config: `{}`,
+			err:    "rules not present",
+		},
+		{
+			name:   "no name",
+			config: `{"rules": [{"point": "sentry/execve"}]}`,
+			err:    "name not present",
+		},
+		{
+			name:   "duplicate name",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve"}, {"name": "a", "point": "sentry/clone"}]}`,
+			err:    "duplicate name",
+		},
+		{
+			name:   "unknown point",
+			config: `{"rules": [{"name": "a", "point": "sentry/foo"}]}`,
+			err:    "not found",
+		},
+		{
+			name:   "unknown property",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve", "when": "always"}]}`,
+			err:    "unknown property",
+		},
+		{
+			name:   "invalid action",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve", "action": "ignore"}]}`,
+			err:    "invalid action",
+		},
+		{
+			name:   "kill not supported",
+			config: `{"rules": [{"name": "a", "point": "sentry/task_exit", "action": "kill"}]}`,
+			err:    "not supported",
+		},
+		{
+			name:   "invalid op",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve", "conditions": [{"field": "binary_path", "op": "like", "value": "a"}]}]}`,
+			err:    "invalid op",
+		},
+		{
+			name:   "invalid field",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve", "conditions": [{"field": "context_data..cwd", "value": "a"}]}]}`,
+			err:    "invalid field",
+		},
+		{
+			name:   "no value",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve", "conditions": [{"field": "binary_path"}]}]}`,
+			err:    "value not present",
+		},
+		{
+			name:   "list for eq",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve", "conditions": [{"field": "binary_path", "value": ["a", "b"]}]}]}`,
+			err:    "requires a single value",
+		},
+		{
+			name:   "prefix of integer",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve", "conditions": [{"field": "binary_path", "op": "prefix", "value": 1}]}]}`,
+			err:    "requires string values",
+		},
+		{
+			name:   "fractional value",
+			config: `{"rules": [{"name": "a", "point": "sentry/execve", "conditions": [{"field": "binary_mode", "value": 1.5}]}]}`,
+			err:    "not an integer",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := new(decodeConfig(t, tc.config), nil)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("new() got error: %v, want error containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	execve := &pb.ExecveInfo{
+		ContextData: &pb.ContextData{ContainerId: "cont"},
+		BinaryPath:  "/tmp/evil",
+		Argv:        []string{"evil", "--flag"},
+		BinaryMode:  0o104755,
+	}
+	for _, tc := range []struct {
+		name       string
+		conditions string
+		want       bool
+	}{
+		{
+			name:       "no conditions",
+			conditions: `[]`,
+			want:       true,
+		},
+		{
+			name:       "not prefix",
+			conditions: `[{"field": "binary_path", "op": "not_prefix", "value": ["/usr/bin/", "/bin/"]}]`,
+			want:       true,
+		},
+		{
+			name:       "prefix",
+			conditions: `[{"field": "binary_path", "op": "prefix", "value": "/usr/bin/"}]`,
+			want:       false,
+		},
+		{
+			name:       "nested field",
+			conditions: `[{"field": "context_data.container_id", "value": "cont"}]`,
+			want:       true,
+		},
+		{
+			name:       "repeated field",
+			conditions: `[{"field": "argv", "op": "in", "value": ["--flag"]}]`,
+			want:       true,
+		},
+		{
+			name:       "repeated field negated",
+			conditions: `[{"field": "argv", "op": "not_in", "value": ["--flag"]}]`,
+			want:       false,
+		},
+		{
+			name:       "mask",
+			conditions: `[{"field": "binary_mode", "op": "mask", "value": 2048}]`,
+			want:       true,
+		},
+		{
+			name:       "all conditions must match",
+			conditions: `[{"field": "binary_path", "value": "/tmp/evil"}, {"field": "binary_mode", "op": "not_mask", "value": 2048}]`,
+			want:       false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := decodeConfig(t, `{"rules": [{"name": "a", "point": "sentry/execve", "conditions": `+tc.conditions+`}]}`)
+			sink, err := new(config, nil)
+			if err != nil {
+				t.Fatalf("new(): %v", err)
+			}
+			r := sink.(*policy).rules["sentry/execve"][0]
+			got, err := r.matches(execve.ProtoReflect())
+			if err != nil {
+				t.Fatalf("matches(): %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("matches() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchesUnknownField(t *testing.T) {
+	config := decodeConfig(t, `{"rules": [{"name": "a", "point": "sentry/execve", "conditions": [{"field": "fd_path", "op": "ne", "value": "a"}]}]}`)
+	sink, err := new(config, nil)
+	if err != nil {
+		t.Fatalf("new(): %v", err)
+	}
+	r := sink.(*policy).rules["sentry/execve"][0]
+	if _, err := r.matches((&pb.ExecveInfo{}).ProtoReflect()); err == nil {
+		t.Errorf("matches() succeeded for unknown field")
+	}
+}
+
+func TestAlert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	config := decodeConfig(t, `{
+		"alert_file": "`+path+`",
+		"rules": [
+			{
+				"name": "ptrace-attach",
+				"point": "syscall/sysno/101/enter",
+				"conditions": [{"field": "arg1", "op": "in", "value": [16, 16902]}]
+			}
+		]
+	}`)
+	f, err := setupSink(config)
+	if err != nil {
+		t.Fatalf("setupSink(): %v", err)
+	}
+	endpoint, err := fd.NewFromFile(f)
+	if err != nil {
+		t.Fatalf("NewFromFile(): %v", err)
+	}
+	_ = f.Close()
+	sink, err := new(config, endpoint)
+	if err != nil {
+		t.Fatalf("new(): %v", err)
+	}
+	defer sink.Stop()
+
+	ctx := context.Background()
+	// Not a ptrace attach.
+	if err := sink.RawSyscall(ctx, seccheck.FieldSet{}, &pb.Syscall{Sysno: 101, Arg1: 0}); err != nil {
+		t.Fatalf("RawSyscall(): %v", err)
+	}
+	// Exit of a ptrace attach.
+	if err := sink.RawSyscall(ctx, seccheck.FieldSet{}, &pb.Syscall{Sysno: 101, Arg1: 16, Exit: &pb.Exit{}}); err != nil {
+		t.Fatalf("RawSyscall(): %v", err)
+	}
+	// Not ptrace.
+	if err := sink.RawSyscall(ctx, seccheck.FieldSet{}, &pb.Syscall{Sysno: 102, Arg1: 16}); err != nil {
+		t.Fatalf("RawSyscall(): %v", err)
+	}
+	if err := sink.RawSyscall(ctx, seccheck.FieldSet{}, &pb.Syscall{Sysno: 101, Arg1: 16902}); err != nil {
+		t.Fatalf("RawSyscall(): %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile(): %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d alerts, want 1: %q", len(lines), data)
+	}
+	var got alert
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", lines[0], err)
+	}
+	if got.Rule != "ptrace-attach" || got.Action != "alert" || got.Point != "syscall/sysno/101/enter" {
+		t.Errorf("unexpected alert: %+v", got)
+	}
+	if !strings.Contains(string(got.Event), `"arg1":"16902"`) {
+		t.Errorf("alert event %s doesn't contain the point", got.Event)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gvisor.dev/gvisor/pkg/sentry/seccheck"
+)
+
+// action is what happens when a rule matches.
+type action int
+
+const (
+	// actionAlert emits an alert.
+	actionAlert action = iota
+	// actionKill emits an alert and kills the process that triggered the rule.
+	actionKill
+)
+
+// String implements fmt.Stringer.
+func (a action) String() string {
+	switch a {
+	case actionAlert:
+		return "alert"
+	case actionKill:
+		return "kill"
+	default:
+		panic(fmt.Sprintf("invalid action %d", int(a)))
+	}
+}
+
+// op is a condition operator. Each operator has a negated form, e.g. "ne" for
+// "eq", which matches when the operator doesn't.
+type op int
+
+const (
+	// opIn matches if the field is equal to any of the values.
+	opIn op = iota
+	// opPrefix matches if the field starts with any of the values.
+	opPrefix
+	// opMask matches if the field has any of the bits in the value set.
+	opMask
+)
+
+// ops maps operator names to operators, and whether they are negated.
+var ops = map[string]struct {
+	op     op
+	negate bool
+}{
+	"eq":         {opIn, false},
+	"ne":         {opIn, true},
+	"in":         {opIn, false},
+	"not_in":     {opIn, true},
+	"prefix":     {opPrefix, false},
+	"not_prefix": {opPrefix, true},
+	"mask":       {opMask, false},
+	"not_mask":   {opMask, true},
+}
+
+// rule is a compiled policy rule.
+type rule struct {
+	name       string
+	point      string
+	conditions []condition
+	action     action
+}
+
+// condition is a predicate on a single field of a point. Values are
+// normalized such that integers (including enums) are int64, and strings and
+// bytes are string.
+type condition struct {
+	// path is the list of field names leading to the field, e.g.
+	// [context_data, container_id].
+	path   []protoreflect.Name
+	op     op
+	negate bool
+	values []any
+}
+
+// parseRules parses the "rules" configuration of the sink.
+func parseRules(opaque any) ([]*rule, error) {
+	list, ok := opaque.([]any)
+	if !ok {
+		return nil, fmt.Errorf("rules %v is not a list", opaque)
+	}
+	rules := make([]*rule, 0, len(list))
+	names := make(map[string]struct{}, len(list))
+	for i, elem := range list {
+		r, err := parseRule(elem)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if _, ok := names[r.name]; ok {
+			return nil, fmt.Errorf("rule %d: duplicate name %q", i, r.name)
+		}
+		names[r.name] = struct{}{}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func parseRule(opaque any) (*rule, error) {
+	config, ok := opaque.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%v is not an object", opaque)
+	}
+	for k := range config {
+		switch k {
+		case "name", "point", "conditions", "action":
+		default:
+			return nil, fmt.Errorf("unknown property %q", k)
+		}
+	}
+	r := &rule{}
+	var err error
+	if r.name, err = parseString(config, "name", ""); err != nil {
+		return nil, err
+	}
+	if len(r.name) == 0 {
+		return nil, fmt.Errorf("name not present")
+	}
+	if r.point, err = parseString(config, "point", ""); err != nil {
+		return nil, err
+	}
+	if _, ok := seccheck.Points[r.point]; !ok {
+		return nil, fmt.Errorf("point %q not found", r.point)
+	}
+	actionName, err := parseString(config, "action", actionAlert.String())
+	if err != nil {
+		return nil, err
+	}
+	switch actionName {
+	case actionAlert.String():
+		r.action = actionAlert
+	case actionKill.String():
+		// Other points are raised with kernel locks held, or outside of the
+		// task that caused them.
+		if !strings.HasPrefix(r.point, "syscall/") && r.point != "sentry/clone" && r.point != "sentry/execve" {
+			return nil, fmt.Errorf("action %q is not supported for point %q", actionName, r.point)
+		}
+		r.action = actionKill
+	default:
+		return nil, fmt.Errorf("invalid action %q", actionName)
+	}
+	if opaque, ok := config["conditions"]; ok {
+		list, ok := opaque.([]any)
+		if !ok {
+			return nil, fmt.Errorf("conditions %v is not a list", opaque)
+		}
+		for i, elem := range list {
+			c, err := parseCondition(elem)
+			if err != nil {
+				return nil, fmt.Errorf("condition %d: %w", i, err)
+			}
+			r.conditions = append(r.conditions, c)
+		}
+	}
+	return r, nil
+}
+
+func parseCondition(opaque any) (condition, error) {
+	config, ok := opaque.(map[string]any)
+	if !ok {
+		return condition{}, fmt.Errorf("%v is not an object", opaque)
+	}
+	for k := range config {
+		switch k {
+		case "field", "op", "value":
+		default:
+			return condition{}, fmt.Errorf("unknown property %q", k)
+		}
+	}
+	field, err := parseString(config, "field", "")
+	if err != nil {
+		return condition{}, err
+	}
+	if len(field) == 0 {
+		return condition{}, fmt.Errorf("field not present")
+	}
+	var c condition
+	for _, name := range strings.Split(field, ".") {
+		if !protoreflect.Name(name).IsValid() {
+			return condition{}, fmt.Errorf("invalid field %q", field)
+		}
+		c.path = append(c.path, protoreflect.Name(name))
+	}
+	opName, err := parseString(config, "op", "eq")
+	if err != nil {
+		return condition{}, err
+	}
+	o, ok := ops[opName]
+	if !ok {
+		return condition{}, fmt.Errorf("invalid op %q", opName)
+	}
+	c.op = o.op
+	c.negate = o.negate
+
+	opaqueValue, ok := config["value"]
+	if !ok {
+		return condition{}, fmt.Errorf("value not present")
+	}
+	values := []any{opaqueValue}
+	if list, ok := opaqueValue.([]any); ok {
+		if opName == "eq" || opName == "ne" || opName == "mask" || opName == "not_mask" {
+			return condition{}, fmt.Errorf("op %q requires a single value", opName)
+		}
+		values = list
+	}
+	if len(values) == 0 {
+		return condition{}, fmt.Errorf("value is empty")
+	}
+	for _, v := range values {
+		nv, err := normalizeValue(v)
+		if err != nil {
+			return condition{}, err
+		}
+		switch c.op {
+		case opPrefix:
+			if _, ok := nv.(string); !ok {
+				return condition{}, fmt.Errorf("op %q requires string values, got %v", opName, v)
+			}
+		case opMask:
+			if _, ok := nv.(int64); !ok {
+				return condition{}, fmt.Errorf("op %q requires an integer value, got %v", opName, v)
+			}
+		}
+		c.values = append(c.values, nv)
+	}
+	return c, nil
+}
+
+// normalizeValue converts a JSON value from the configuration.
+func normalizeValue(v any) (any, error) {
+	switch v := v.(type) {
+	case string, bool:
+		return v, nil
+	case float64:
+		// Allow values up to MaxUint64, e.g. for masks. They are compared with
+		// the bit pattern of the field.
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxUint64 {
+			return nil, fmt.Errorf("%v is not an integer", v)
+		}
+		if v >= math.MaxInt64 {
+			return int64(uint64(v)), nil
+		}
+		return int64(v), nil
+	default:
+		return nil, fmt.Errorf("%v is not a string, integer or boolean", v)
+	}
+}
+
+// matches returns whether all conditions of the rule match msg.
+func (r *rule) matches(msg protoreflect.Message) (bool, error) {
+	for i := range r.conditions {
+		ok, err := r.conditions[i].matches(msg)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matches returns whether the condition matches msg. For repeated fields, the
+// positive form of the operator matches if any element matches.
+func (c *condition) matches(msg protoreflect.Message) (bool, error) {
+	for _, name := range c.path[:len(c.path)-1] {
+		fd := msg.Descriptor().Fields().ByName(name)
+		if fd == nil || fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return false, fmt.Errorf("%s has no message field %q", msg.Descriptor().FullName(), name)
+		}
+		msg = msg.Get(fd).Message()
+	}
+	name := c.path[len(c.path)-1]
+	fd := msg.Descriptor().Fields().ByName(name)
+	if fd == nil || fd.IsMap() || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		return false, fmt.Errorf("%s has no scalar field %q", msg.Descriptor().FullName(), name)
+	}
+	v := msg.Get(fd)
+	matched := false
+	if fd.IsList() {
+		list := v.List()
+		for i := 0; i < list.Len() && !matched; i++ {
+			matched = c.matchesValue(scalarValue(fd, list.Get(i)))
+		}
+	} else {
+		matched = c.matchesValue(scalarValue(fd, v))
+	}
+	return matched != c.negate, nil
+}
+
+func (c *condition) matchesValue(v any) bool {
+	for _, want := range c.values {
+		switch c.op {
+		case opIn:
+			if v == want {
+				return true
+			}
+		case opPrefix:
+			if s, ok := v.(string); ok && strings.HasPrefix(s, want.(string)) {
+				return true
+			}
+		case opMask:
+			if i, ok := v.(int64); ok && i&want.(int64) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scalarValue normalizes a field value the same way as normalizeValue.
+func scalarValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return int64(v.Uint())
+	case protoreflect.EnumKind:
+		return int64(v.Enum())
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.BytesKind:
+		return string(v.Bytes())
+	default:
+		// Floats are not used by points.
+		return nil
+	}
+}
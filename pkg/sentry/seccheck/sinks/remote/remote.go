@@ -265,6 +265,18 @@ func (r *remote) TaskExit(_ context.Context, _ seccheck.FieldSet, info *pb.TaskE
 	return nil
 }
 
+// PageFault implements seccheck.Sink.
+func (r *remote) PageFault(_ context.Context, _ seccheck.FieldSet, info *pb.PageFault) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_PAGE_FAULT)
+	return nil
+}
+
+// SocketClose implements seccheck.Sink.
+func (r *remote) SocketClose(_ context.Context, _ seccheck.FieldSet, info *pb.SocketClose) error {
+	r.write(info, pb.MessageType_MESSAGE_NETSTACK_SOCKET_CLOSE)
+	return nil
+}
+
 // ContainerStart implements seccheck.Sink.
 func (r *remote) ContainerStart(_ context.Context, _ seccheck.FieldSet, info *pb.Start) error {
 	r.write(info, pb.MessageType_MESSAGE_CONTAINER_START)
@@ -47,7 +47,10 @@ type SCMCredentials interface {
 //
 // +stateify savable
 type scmCredentials struct {
-	t    *kernel.Task
+	// tg is the sender's thread group. Like Linux, SCM_CREDENTIALS reports
+	// the sender's thread group ID, translated into the receiver's PID
+	// namespace.
+	tg   *kernel.ThreadGroup
 	kuid auth.KUID
 	kgid auth.KGID
 }
@@ -64,10 +67,19 @@ func NewSCMCredentials(t *kernel.Task, cred linux.ControlMessageCredentials) (SC
 	if err != nil {
 		return nil, err
 	}
-	if kernel.ThreadID(cred.PID) != t.ThreadGroup().ID() && !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.PIDNamespace().UserNamespace()) {
-		return nil, linuxerr.EPERM
+	tg := t.ThreadGroup()
+	if pid := kernel.ThreadID(cred.PID); pid != t.PIDNamespace().IDOfThreadGroup(tg) {
+		if !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.PIDNamespace().UserNamespace()) {
+			return nil, linuxerr.EPERM
+		}
+		// A privileged sender may specify any process in its PID
+		// namespace.
+		tg = t.PIDNamespace().ThreadGroupWithID(pid)
+		if tg == nil {
+			return nil, linuxerr.ESRCH
+		}
 	}
-	return &scmCredentials{t, kuid, kgid}, nil
+	return &scmCredentials{tg, kuid, kgid}, nil
 }
 
 // Equals implements transport.CredentialsControlMessage.Equals.
@@ -159,7 +171,7 @@ func (c *scmCredentials) Credentials(t *kernel.Task) (kernel.ThreadID, auth.UID,
 	// of SCM_CREDENTIALS in unix(7)), they are translated into the
 	// corresponding values as per the receiving process's user and group ID
 	// mappings." - user_namespaces(7)
-	pid := t.PIDNamespace().IDOfTask(c.t)
+	pid := t.PIDNamespace().IDOfThreadGroup(c.tg)
 	uid := c.kuid.In(t.UserNamespace()).OrOverflow()
 	gid := c.kgid.In(t.UserNamespace()).OrOverflow()
 
@@ -313,6 +325,17 @@ func PackSockExtendedErr(t *kernel.Task, sockErr linux.SockErrCMsg, buf []byte)
 	)
 }
 
+// PackTLSRecordType packs a TLS_GET_RECORD_TYPE socket control message.
+func PackTLSRecordType(t *kernel.Task, recordType uint8, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_TLS,
+		linux.TLS_GET_RECORD_TYPE,
+		t.Arch().Width(),
+		primitive.AllocateUint8(recordType),
+	)
+}
+
 // PackControlMessages packs control messages into the given buffer.
 //
 // We skip control messages specific to Unix domain sockets.
@@ -361,6 +384,10 @@ func PackControlMessages(t *kernel.Task, cmsgs socket.ControlMessages, buf []byt
 		buf = PackSockExtendedErr(t, cmsgs.IP.SockErr, buf)
 	}
 
+	if cmsgs.IP.HasTLSRecordType {
+		buf = PackTLSRecordType(t, cmsgs.IP.TLSRecordType, buf)
+	}
+
 	return buf
 }
 
@@ -414,6 +441,10 @@ func CmsgsSpace(t *kernel.Task, cmsgs socket.ControlMessages) int {
 		space += cmsgSpace(t, cmsgs.IP.SockErr.SizeBytes())
 	}
 
+	if cmsgs.IP.HasTLSRecordType {
+		space += cmsgSpace(t, linux.SizeOfControlMessageTLSRecordType)
+	}
+
 	return space
 }
 
@@ -589,6 +620,20 @@ func Parse(t *kernel.Task, socketOrEndpoint any, buf []byte, width uint) (socket
 				errCmsg.UnmarshalBytes(buf)
 				cmsgs.IP.SockErr = &errCmsg
 
+			default:
+				return socket.ControlMessages{}, linuxerr.EINVAL
+			}
+		case linux.SOL_TLS:
+			switch h.Type {
+			case linux.TLS_SET_RECORD_TYPE:
+				if length < linux.SizeOfControlMessageTLSRecordType {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				var recordType primitive.Uint8
+				recordType.UnmarshalUnsafe(buf)
+				cmsgs.IP.HasTLSRecordType = true
+				cmsgs.IP.TLSRecordType = uint8(recordType)
+
 			default:
 				return socket.ControlMessages{}, linuxerr.EINVAL
 			}
@@ -633,7 +678,7 @@ func MakeCreds(t *kernel.Task) SCMCredentials {
 		return nil
 	}
 	tcred := t.Credentials()
-	return &scmCredentials{t, tcred.EffectiveKUID, tcred.EffectiveKGID}
+	return &scmCredentials{t.ThreadGroup(), tcred.EffectiveKUID, tcred.EffectiveKGID}
 }
 
 // New creates default control messages if needed.
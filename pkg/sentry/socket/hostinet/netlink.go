@@ -66,6 +66,13 @@ func getInterfaces() (map[int32]inet.Interface, error) {
 				inetIF.Addr = attr.Value
 			case unix.IFLA_IFNAME:
 				inetIF.Name = string(attr.Value[:len(attr.Value)-1])
+			case unix.IFLA_MTU:
+				if len(attr.Value) != 4 {
+					return nil, fmt.Errorf("RTM_GETLINK returned RTM_NEWLINK message with invalid IFLA_MTU length (%d bytes, expected 4 bytes)", len(attr.Value))
+				}
+				var mtu primitive.Uint32
+				mtu.UnmarshalUnsafe(attr.Value)
+				inetIF.MTU = uint32(mtu)
 			}
 		}
 		ifs[ifinfo.Index] = inetIF
@@ -103,8 +110,14 @@ func getInterfaceAddrs() (map[int32][]inet.InterfaceAddr, error) {
 		}
 		for _, attr := range attrs {
 			switch attr.Attr.Type {
-			case unix.IFA_ADDRESS:
+			case unix.IFA_LOCAL:
+				// IFA_LOCAL is the local address; IFA_ADDRESS is the peer
+				// address of point-to-point interfaces.
 				inetAddr.Addr = attr.Value
+			case unix.IFA_ADDRESS:
+				if inetAddr.Addr == nil {
+					inetAddr.Addr = attr.Value
+				}
 			}
 		}
 		addrs[int32(ifaddr.Index)] = append(addrs[int32(ifaddr.Index)], inetAddr)
@@ -16,6 +16,7 @@ package hostinet
 
 import (
 	"fmt"
+	"io"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -127,6 +128,8 @@ type Socket struct {
 }
 
 var _ = socket.Socket(&Socket{})
+var _ = socket.FileSender(&Socket{})
+var _ = socket.QueueSizer(&Socket{})
 
 func newSocket(t *kernel.Task, family int, stype linux.SockType, protocol int, fd int, flags uint32) (*vfs.FileDescription, *syserr.Error) {
 	mnt := t.Kernel().SocketMount()
@@ -191,6 +194,14 @@ func (s *Socket) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.Read
 	return int64(n), err
 }
 
+// SpliceHostFD implements hostfd.Spliceable.SpliceHostFD.
+func (s *Socket) SpliceHostFD() (int32, bool, bool) {
+	if s.stype != linux.SOCK_STREAM {
+		return 0, false, false
+	}
+	return int32(s.fd), false, true
+}
+
 // PWrite implements vfs.FileDescriptionImpl.
 func (s *Socket) PWrite(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
 	return 0, linuxerr.ESPIPE
@@ -215,6 +226,25 @@ func (s *Socket) Write(ctx context.Context, src usermem.IOSequence, opts vfs.Wri
 	return int64(n), err
 }
 
+// SendFile implements socket.FileSender.SendFile.
+func (s *Socket) SendFile(ctx context.Context, in *vfs.FileDescription, off, count int64) (int64, bool, error) {
+	if s.stype != linux.SOCK_STREAM {
+		return 0, false, nil
+	}
+	src, ok := in.Impl().(hostfd.SendfileSource)
+	if !ok {
+		return 0, false, nil
+	}
+	n, ok, err := src.SendfileTo(int32(s.fd), off, count)
+	if !ok {
+		return 0, false, nil
+	}
+	if n == 0 && err == nil {
+		return 0, true, io.EOF
+	}
+	return n, true, err
+}
+
 type socketProvider struct {
 	family int
 }
@@ -668,6 +698,15 @@ func parseUnixControlMessages(unixControlMessages []unix.SocketControlMessage) s
 				inq.UnmarshalUnsafe(unixCmsg.Data)
 				controlMessages.IP.Inq = int32(inq)
 			}
+
+		case linux.SOL_TLS:
+			switch unixCmsg.Header.Type {
+			case linux.TLS_GET_RECORD_TYPE:
+				controlMessages.IP.HasTLSRecordType = true
+				var recordType primitive.Uint8
+				recordType.UnmarshalUnsafe(unixCmsg.Data)
+				controlMessages.IP.TLSRecordType = uint8(recordType)
+			}
 		}
 	}
 	return controlMessages
@@ -814,6 +853,17 @@ func (s *Socket) Type() (family int, skType linux.SockType, protocol int) {
 	return s.family, s.stype, s.protocol
 }
 
+// QueueSizes implements socket.QueueSizer.QueueSizes.
+func (s *Socket) QueueSizes() (rqueue, wqueue int) {
+	if v, err := unix.IoctlGetInt(s.fd, unix.TIOCINQ); err == nil {
+		rqueue = v
+	}
+	if v, err := unix.IoctlGetInt(s.fd, unix.TIOCOUTQ); err == nil {
+		wqueue = v
+	}
+	return rqueue, wqueue
+}
+
 func init() {
 	// Register all families in AllowedSocketTypes and AllowedRawSocket
 	// types. If we don't allow raw sockets, they will be rejected in the
@@ -31,6 +31,10 @@ import (
 const (
 	sizeofInt16 = 2
 	sizeofInt32 = 4
+
+	// maxVariableSockOptLen is the largest buffer passed to the host for
+	// options with variable size.
+	maxVariableSockOptLen = hostarch.PageSize
 )
 
 // SockOpt is used to generate get/setsockopt handlers and filters.
@@ -46,6 +50,11 @@ type SockOpt struct {
 	AllowGet bool
 	// Support setsockopt on this option.
 	AllowSet bool
+	// AllowTruncate allows getsockopt with a buffer smaller than Size. To
+	// keep the syscall filters simple and restrictive, the host is always
+	// called with a buffer of Size bytes, and the result is truncated
+	// before it is returned to the application.
+	AllowTruncate bool
 }
 
 // SockOpts are the socket options supported by hostinet by making syscalls to the host.
@@ -57,65 +66,91 @@ type SockOpt struct {
 //   - SO_SNDTIMEOU, SO_RCVTIMEO are handled internally by setting the embedded
 //     socket.SendReceiveTimeout.
 var SockOpts = []SockOpt{
-	{linux.SOL_IP, linux.IP_ADD_MEMBERSHIP, 0, false, true},
-	{linux.SOL_IP, linux.IP_DROP_MEMBERSHIP, 0, false, true},
-	{linux.SOL_IP, linux.IP_HDRINCL, sizeofInt32, true, true},
-	{linux.SOL_IP, linux.IP_MULTICAST_IF, uint64(linux.SizeOfInetAddr), true, true},
-	{linux.SOL_IP, linux.IP_MULTICAST_LOOP, 0 /* can be 32-bit int or 8-bit uint */, true, true},
-	{linux.SOL_IP, linux.IP_MULTICAST_TTL, 0 /* can be 32-bit int or 8-bit uint */, true, true},
-	{linux.SOL_IP, linux.IP_PKTINFO, sizeofInt32, true, true},
-	{linux.SOL_IP, linux.IP_RECVERR, sizeofInt32, true, true},
-	{linux.SOL_IP, linux.IP_RECVORIGDSTADDR, sizeofInt32, true, true},
-	{linux.SOL_IP, linux.IP_RECVTOS, sizeofInt32, true, true},
-	{linux.SOL_IP, linux.IP_RECVTTL, sizeofInt32, true, true},
-	{linux.SOL_IP, linux.IP_TOS, 0 /* Can be 32, 16, or 8 bits */, true, true},
-	{linux.SOL_IP, linux.IP_TTL, sizeofInt32, true, true},
+	{linux.SOL_IP, linux.IP_ADD_MEMBERSHIP, 0, false, true, false},
+	{linux.SOL_IP, linux.IP_BIND_ADDRESS_NO_PORT, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_DROP_MEMBERSHIP, 0, false, true, false},
+	{linux.SOL_IP, linux.IP_FREEBIND, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_HDRINCL, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_MTU, sizeofInt32, true, false, false},
+	{linux.SOL_IP, linux.IP_MTU_DISCOVER, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_MULTICAST_IF, uint64(linux.SizeOfInetAddr), true, true, false},
+	{linux.SOL_IP, linux.IP_MULTICAST_LOOP, 0 /* can be 32-bit int or 8-bit uint */, true, true, false},
+	{linux.SOL_IP, linux.IP_MULTICAST_TTL, 0 /* can be 32-bit int or 8-bit uint */, true, true, false},
+	{linux.SOL_IP, linux.IP_PKTINFO, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_RECVERR, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_RECVORIGDSTADDR, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_RECVTOS, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_RECVTTL, sizeofInt32, true, true, false},
+	{linux.SOL_IP, linux.IP_TOS, 0 /* Can be 32, 16, or 8 bits */, true, true, false},
+	{linux.SOL_IP, linux.IP_TTL, sizeofInt32, true, true, true},
+
+	{linux.SOL_IPV6, linux.IPV6_CHECKSUM, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_FREEBIND, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_MTU_DISCOVER, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_MULTICAST_HOPS, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_RECVERR, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_RECVHOPLIMIT, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_RECVORIGDSTADDR, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_RECVPKTINFO, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_RECVTCLASS, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_TCLASS, sizeofInt32, true, true, true},
+	{linux.SOL_IPV6, linux.IPV6_UNICAST_HOPS, sizeofInt32, true, true, false},
+	{linux.SOL_IPV6, linux.IPV6_V6ONLY, sizeofInt32, true, true, false},
 
-	{linux.SOL_IPV6, linux.IPV6_CHECKSUM, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_MULTICAST_HOPS, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_RECVERR, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_RECVHOPLIMIT, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_RECVORIGDSTADDR, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_RECVPKTINFO, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_RECVTCLASS, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_TCLASS, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_UNICAST_HOPS, sizeofInt32, true, true},
-	{linux.SOL_IPV6, linux.IPV6_V6ONLY, sizeofInt32, true, true},
+	{linux.SOL_SOCKET, linux.SO_ACCEPTCONN, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_BINDTODEVICE, 0, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_BROADCAST, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_ERROR, sizeofInt32, true, false, false},
+	{linux.SOL_SOCKET, linux.SO_INCOMING_CPU, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_KEEPALIVE, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_LINGER, linux.SizeOfLinger, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_NO_CHECK, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_OOBINLINE, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_PASSCRED, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_RCVBUF, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_RCVBUFFORCE, sizeofInt32, false, true, false},
+	{linux.SOL_SOCKET, linux.SO_RCVLOWAT, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_REUSEADDR, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_REUSEPORT, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_SNDBUF, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_TIMESTAMP, sizeofInt32, true, true, false},
+	{linux.SOL_SOCKET, linux.SO_ZEROCOPY, sizeofInt32, true, true, false},
 
-	{linux.SOL_SOCKET, linux.SO_ACCEPTCONN, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_BINDTODEVICE, 0, true, true},
-	{linux.SOL_SOCKET, linux.SO_BROADCAST, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_ERROR, sizeofInt32, true, false},
-	{linux.SOL_SOCKET, linux.SO_KEEPALIVE, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_LINGER, linux.SizeOfLinger, true, true},
-	{linux.SOL_SOCKET, linux.SO_NO_CHECK, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_OOBINLINE, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_PASSCRED, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_RCVBUF, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_RCVBUFFORCE, sizeofInt32, false, true},
-	{linux.SOL_SOCKET, linux.SO_RCVLOWAT, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_REUSEADDR, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_REUSEPORT, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_SNDBUF, sizeofInt32, true, true},
-	{linux.SOL_SOCKET, linux.SO_TIMESTAMP, sizeofInt32, true, true},
+	{linux.SOL_TCP, linux.TCP_CONGESTION, 0 /* string */, true, true, false},
+	{linux.SOL_TCP, linux.TCP_CORK, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_DEFER_ACCEPT, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_FASTOPEN, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_FASTOPEN_CONNECT, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_INFO, uint64(linux.SizeOfTCPInfo), true, false, true},
+	{linux.SOL_TCP, linux.TCP_INQ, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_KEEPCNT, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_KEEPIDLE, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_KEEPINTVL, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_LINGER2, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_MAXSEG, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_NODELAY, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_NOTSENT_LOWAT, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_QUICKACK, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_SYNCNT, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_THIN_LINEAR_TIMEOUTS, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_USER_TIMEOUT, sizeofInt32, true, true, false},
+	{linux.SOL_TCP, linux.TCP_WINDOW_CLAMP, sizeofInt32, true, true, false},
 
-	{linux.SOL_TCP, linux.TCP_CONGESTION, 0 /* string */, true, true},
-	{linux.SOL_TCP, linux.TCP_CORK, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_DEFER_ACCEPT, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_INFO, uint64(linux.SizeOfTCPInfo), true, false},
-	{linux.SOL_TCP, linux.TCP_INQ, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_KEEPCNT, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_KEEPIDLE, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_KEEPINTVL, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_LINGER2, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_MAXSEG, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_NODELAY, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_QUICKACK, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_SYNCNT, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_USER_TIMEOUT, sizeofInt32, true, true},
-	{linux.SOL_TCP, linux.TCP_WINDOW_CLAMP, sizeofInt32, true, true},
+	{linux.SOL_UDP, linux.UDP_CORK, sizeofInt32, true, true, false},
+	{linux.SOL_UDP, linux.UDP_SEGMENT, sizeofInt32, true, true, false},
+
+	{linux.SOL_ICMPV6, linux.ICMPV6_FILTER, uint64(linux.SizeOfICMP6Filter), true, true, true},
+}
 
-	{linux.SOL_ICMPV6, linux.ICMPV6_FILTER, uint64(linux.SizeOfICMP6Filter), true, true},
+// KTLSSockOpts are the kernel TLS socket options supported by hostinet by
+// making syscalls to the host. They are only allowed if the stack was
+// configured to allow kernel TLS.
+var KTLSSockOpts = []SockOpt{
+	{linux.SOL_TCP, linux.TCP_ULP, 0 /* string */, true, true, false},
+	{linux.SOL_TLS, linux.TLS_TX, 0 /* depends on cipher */, true, true, false},
+	{linux.SOL_TLS, linux.TLS_RX, 0 /* depends on cipher */, true, true, false},
+	{linux.SOL_TLS, linux.TLS_TX_ZEROCOPY_RO, sizeofInt32, true, true, false},
+	{linux.SOL_TLS, linux.TLS_RX_EXPECT_NO_PAD, sizeofInt32, true, true, false},
 }
 
 // sockOptMap is a map of {level, name} -> SockOpts. It is an optimization for
@@ -131,8 +166,20 @@ type levelName struct {
 	name  uint64
 }
 
+// isKTLSSockOpt returns true if {level, name} is one of KTLSSockOpts.
+func isKTLSSockOpt(level, name int) bool {
+	return level == linux.SOL_TLS || (level == linux.SOL_TCP && name == linux.TCP_ULP)
+}
+
+// allowKTLS returns true if t's network stack passes KTLSSockOpts to the host.
+func allowKTLS(t *kernel.Task) bool {
+	stack, ok := t.NetworkContext().(*Stack)
+	return ok && stack.allowKTLS
+}
+
 func initSockOptMap(t *kernel.Task) {
-	opts := append(SockOpts, extraSockOpts(t)...)
+	opts := append(SockOpts, KTLSSockOpts...)
+	opts = append(opts, extraSockOpts(t)...)
 	sockOptMap = make(map[levelName]SockOpt, len(opts))
 	for _, opt := range opts {
 		ln := levelName{opt.Level, opt.Name}
@@ -163,6 +210,9 @@ func (s *Socket) GetSockOpt(t *kernel.Task, level, name int, optValAddr hostarch
 		}
 	}
 
+	if isKTLSSockOpt(level, name) && !allowKTLS(t) {
+		return nil, syserr.ErrProtocolNotAvailable
+	}
 	sockOpt, ok := sockOptMap[levelName{uint64(level), uint64(name)}]
 	if !ok {
 		return nil, syserr.ErrProtocolNotAvailable
@@ -173,29 +223,17 @@ func (s *Socket) GetSockOpt(t *kernel.Task, level, name int, optValAddr hostarch
 	var opt []byte
 	if sockOpt.Size > 0 {
 		// Validate size of input buffer.
-		if uint64(optLen) < sockOpt.Size {
-			// Special case for options that allow smaller buffers.
-			//
-			// To keep the syscall filters simple and restrictive,
-			// we use the full buffer size when calling the host,
-			// but truncate before returning to the application.
-			switch {
-			case level == linux.SOL_TCP && name == linux.TCP_INFO:
-				// Allow smaller buffer.
-			case level == linux.SOL_ICMPV6 && name == linux.ICMPV6_FILTER:
-				// Allow smaller buffer.
-			case level == linux.SOL_IP && name == linux.IP_TTL:
-				// Allow smaller buffer.
-			case level == linux.SOL_IPV6 && name == linux.IPV6_TCLASS:
-				// Allow smaller buffer.
-			default:
-				return nil, syserr.ErrInvalidArgument
-			}
+		if uint64(optLen) < sockOpt.Size && !sockOpt.AllowTruncate {
+			return nil, syserr.ErrInvalidArgument
 		}
 		opt = make([]byte, sockOpt.Size)
 	} else {
 		// No size checking. This is probably a string. Use the size
-		// they gave us.
+		// they gave us, up to a sane limit; the host returns the actual
+		// length of the option.
+		if optLen > maxVariableSockOptLen {
+			optLen = maxVariableSockOptLen
+		}
 		opt = make([]byte, optLen)
 	}
 	if err := preGetSockOpt(t, level, name, optValAddr, opt); err != nil {
@@ -242,6 +280,11 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level, name int, opt []byte) *syserr
 			return nil
 		}
 	}
+	if isKTLSSockOpt(level, name) && !allowKTLS(t) {
+		// Don't pretend to accept these, since the application would
+		// then send plaintext that it expects to be encrypted.
+		return syserr.ErrProtocolNotAvailable
+	}
 	sockOpt, ok := sockOptMap[levelName{uint64(level), uint64(name)}]
 	if !ok {
 		// Pretend to accept socket options we don't understand. This
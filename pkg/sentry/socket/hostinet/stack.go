@@ -58,6 +58,8 @@ type Stack struct {
 	netSNMPFile    *os.File
 	// allowedSocketTypes is the list of allowed socket types
 	allowedSocketTypes []AllowedSocketType
+	// allowKTLS indicates whether KTLSSockOpts are passed to the host.
+	allowKTLS bool
 }
 
 // Destroy implements inet.Stack.Destroy.
@@ -70,7 +72,7 @@ func NewStack() *Stack {
 }
 
 // Configure sets up the stack using the current state of the host network.
-func (s *Stack) Configure(allowRawSockets bool) error {
+func (s *Stack) Configure(allowRawSockets, allowKTLS bool) error {
 	if _, err := os.Stat("/proc/net/if_inet6"); err == nil {
 		s.supportsIPv6 = true
 	}
@@ -114,6 +116,7 @@ func (s *Stack) Configure(allowRawSockets bool) error {
 	if allowRawSockets {
 		s.allowedSocketTypes = append(s.allowedSocketTypes, AllowedRawSocketTypes...)
 	}
+	s.allowKTLS = allowKTLS
 
 	return nil
 }
@@ -221,6 +224,28 @@ func (*Stack) SetTCPRecovery(inet.TCPLossRecovery) error {
 	return linuxerr.EACCES
 }
 
+// IPv6SegmentRoutingEnabled implements inet.Stack.IPv6SegmentRoutingEnabled.
+func (*Stack) IPv6SegmentRoutingEnabled() (bool, error) {
+	return false, linuxerr.EOPNOTSUPP
+}
+
+// SetIPv6SegmentRoutingEnabled implements
+// inet.Stack.SetIPv6SegmentRoutingEnabled.
+func (*Stack) SetIPv6SegmentRoutingEnabled(bool) error {
+	return linuxerr.EACCES
+}
+
+// IPv6ExtensionHeaderLimits implements inet.Stack.IPv6ExtensionHeaderLimits.
+func (*Stack) IPv6ExtensionHeaderLimits() (inet.IPv6ExtensionHeaderLimits, error) {
+	return inet.IPv6ExtensionHeaderLimits{}, linuxerr.EOPNOTSUPP
+}
+
+// SetIPv6ExtensionHeaderLimits implements
+// inet.Stack.SetIPv6ExtensionHeaderLimits.
+func (*Stack) SetIPv6ExtensionHeaderLimits(inet.IPv6ExtensionHeaderLimits) error {
+	return linuxerr.EACCES
+}
+
 // getLine reads one line from proc file, with specified prefix.
 // The last argument, withHeader, specifies if it contains line header.
 func getLine(f *os.File, prefix string, withHeader bool) string {
@@ -12,7 +12,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package port provides port ID allocation for netlink sockets.
+// Package port provides port ID allocation and multicast group membership for
+// netlink sockets.
 //
 // A netlink port is any int32 value. Positive ports are typically equivalent
 // to the PID of the binding process. If that port is unavailable, negative
@@ -25,6 +26,7 @@ import (
 	"math"
 	"math/rand"
 
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/sync"
 )
 
@@ -32,7 +34,15 @@ import (
 // protocol.
 const maxPorts = 10000
 
-// Manager allocates netlink port IDs.
+// Subscriber is a netlink socket that may be a member of multicast groups.
+type Subscriber interface {
+	// DeliverMulticast delivers buf, a message sent to the multicast groups
+	// in the bitmask groups. It must not block.
+	DeliverMulticast(ctx context.Context, groups uint32, buf []byte)
+}
+
+// Manager allocates netlink port IDs, and tracks the members of multicast
+// groups.
 //
 // +stateify savable
 type Manager struct {
@@ -41,12 +51,17 @@ type Manager struct {
 
 	// ports contains a map of allocated ports for each protocol.
 	ports map[int]map[int32]struct{}
+
+	// subscribers maps each protocol to the subscribers that are members of
+	// any of its multicast groups, and the bitmask of those groups.
+	subscribers map[int]map[Subscriber]uint32
 }
 
 // New creates a new Manager.
 func New() *Manager {
 	return &Manager{
-		ports: make(map[int]map[int32]struct{}),
+		ports:       make(map[int]map[int32]struct{}),
+		subscribers: make(map[int]map[Subscriber]uint32),
 	}
 }
 
@@ -115,3 +130,46 @@ func (m *Manager) Release(protocol int, port int32) {
 
 	delete(proto, port)
 }
+
+// SetGroups sets the multicast groups of protocol that s is a member of to
+// the bitmask groups.
+func (m *Manager) SetGroups(protocol int, s Subscriber, groups uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if groups == 0 {
+		delete(m.subscribers[protocol], s)
+		return
+	}
+	if m.subscribers == nil {
+		m.subscribers = make(map[int]map[Subscriber]uint32)
+	}
+	proto, ok := m.subscribers[protocol]
+	if !ok {
+		proto = make(map[Subscriber]uint32)
+		m.subscribers[protocol] = proto
+	}
+	proto[s] = groups
+}
+
+// Multicast delivers buf to the members of the multicast group of protocol
+// with the given number. Groups are numbered from 1.
+func (m *Manager) Multicast(ctx context.Context, protocol int, group uint, buf []byte) {
+	if group == 0 || group > 32 {
+		panic(fmt.Sprintf("Invalid multicast group %d", group))
+	}
+	mask := uint32(1) << (group - 1)
+
+	m.mu.Lock()
+	var members []Subscriber
+	for s, groups := range m.subscribers[protocol] {
+		if groups&mask != 0 {
+			members = append(members, s)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range members {
+		s.DeliverMulticast(ctx, mask, buf)
+	}
+}
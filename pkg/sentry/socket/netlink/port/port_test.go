@@ -16,6 +16,8 @@ package port
 
 import (
 	"testing"
+
+	"gvisor.dev/gvisor/pkg/context"
 )
 
 func TestAllocateHint(t *testing.T) {
@@ -80,3 +82,35 @@ func TestAllocateExhausted(t *testing.T) {
 		t.Errorf("m.Allocate got %d, ok want !ok", p)
 	}
 }
+
+type testSubscriber struct {
+	received []uint32
+}
+
+func (s *testSubscriber) DeliverMulticast(ctx context.Context, groups uint32, buf []byte) {
+	s.received = append(s.received, groups)
+}
+
+func TestMulticast(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	var a, b testSubscriber
+	m.SetGroups(0, &a, 0b01)
+	m.SetGroups(0, &b, 0b11)
+	m.Multicast(ctx, 0, 1, nil)
+	m.Multicast(ctx, 0, 2, nil)
+	// Groups of a different protocol.
+	m.Multicast(ctx, 1, 1, nil)
+
+	// Leaving all groups stops delivery.
+	m.SetGroups(0, &b, 0)
+	m.Multicast(ctx, 0, 2, nil)
+
+	if len(a.received) != 1 || a.received[0] != 0b01 {
+		t.Errorf("a received %v, want [1]", a.received)
+	}
+	if len(b.received) != 2 || b.received[0] != 0b01 || b.received[1] != 0b10 {
+		t.Errorf("b received %v, want [1 2]", b.received)
+	}
+}
@@ -46,6 +46,15 @@ type Protocol interface {
 	ProcessMessage(ctx context.Context, msg *Message, ms *MessageSet) *syserr.Error
 }
 
+// MulticastProtocol is implemented by protocols whose sockets may join
+// multicast groups, to receive messages that the kernel sends to the groups.
+type MulticastProtocol interface {
+	Protocol
+
+	// MulticastGroups returns the number of multicast groups.
+	MulticastGroups() uint
+}
+
 // Provider is a function that creates a new Protocol for a specific netlink
 // protocol.
 //
@@ -17,6 +17,8 @@ package route
 
 import (
 	"bytes"
+	"net"
+	"sort"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -93,13 +95,37 @@ func (p *Protocol) dumpLinks(ctx context.Context, msg *netlink.Message, ms *netl
 		return nil
 	}
 
-	for idx, i := range stack.Interfaces() {
-		addNewLinkMessage(ms, idx, i)
+	ifs := stack.Interfaces()
+	for _, idx := range sortedIndices(ifs) {
+		addNewLinkMessage(ms, idx, ifs[idx])
 	}
 
 	return nil
 }
 
+// sortedIndices returns the interface indices in m in ascending order, which
+// is the order in which Linux dumps interfaces.
+func sortedIndices[T any](m map[int32]T) []int32 {
+	idxs := make([]int32, 0, len(m))
+	for idx := range m {
+		idxs = append(idxs, idx)
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+	return idxs
+}
+
+// requestFamily returns the address family of a dump request. All
+// NETLINK_ROUTE requests start with a 1 byte protocol family, whether they
+// contain a struct rtgenmsg or a larger header. AF_UNSPEC is returned if the
+// request is empty.
+func requestFamily(msg *netlink.Message) uint8 {
+	var family primitive.Uint8
+	if _, ok := msg.GetData(&family); !ok {
+		return linux.AF_UNSPEC
+	}
+	return uint8(family)
+}
+
 // getLinks handles RTM_GETLINK requests.
 func (p *Protocol) getLink(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
 	stack := inet.StackFromContext(ctx)
@@ -236,8 +262,7 @@ func (p *Protocol) dumpAddrs(ctx context.Context, msg *netlink.Message, ms *netl
 	// RTM_GETADDR dump requests need not contain anything more than the
 	// netlink header and 1 byte protocol family common to all
 	// NETLINK_ROUTE requests.
-	//
-	// TODO(b/68878065): Filter output by passed protocol family.
+	family := requestFamily(msg)
 
 	// The RTM_GETADDR dump response is a set of RTM_NEWADDR messages each
 	// containing an InterfaceAddrMessage followed by a set of netlink
@@ -252,8 +277,13 @@ func (p *Protocol) dumpAddrs(ctx context.Context, msg *netlink.Message, ms *netl
 		return nil
 	}
 
-	for id, as := range stack.InterfaceAddrs() {
-		for _, a := range as {
+	ifs := stack.Interfaces()
+	addrs := stack.InterfaceAddrs()
+	for _, id := range sortedIndices(addrs) {
+		for _, a := range addrs[id] {
+			if family != linux.AF_UNSPEC && a.Family != family {
+				continue
+			}
 			m := ms.AddMessage(linux.NetlinkMessageHeader{
 				Type: linux.RTM_NEWADDR,
 			})
@@ -261,12 +291,18 @@ func (p *Protocol) dumpAddrs(ctx context.Context, msg *netlink.Message, ms *netl
 			m.Put(&linux.InterfaceAddrMessage{
 				Family:    a.Family,
 				PrefixLen: a.PrefixLen,
+				Flags:     a.Flags,
+				Scope:     addrScope(a),
 				Index:     uint32(id),
 			})
 
 			addr := primitive.ByteSlice([]byte(a.Addr))
 			m.PutAttr(linux.IFA_LOCAL, &addr)
 			m.PutAttr(linux.IFA_ADDRESS, &addr)
+			if i, ok := ifs[id]; ok && a.Family == linux.AF_INET {
+				// Linux only labels IPv4 addresses.
+				m.PutAttrString(linux.IFA_LABEL, i.Name)
+			}
 
 			// TODO(gvisor.dev/issue/578): There are many more attributes.
 		}
@@ -275,6 +311,23 @@ func (p *Protocol) dumpAddrs(ctx context.Context, msg *netlink.Message, ms *netl
 	return nil
 }
 
+// addrScope returns the scope of a, as Linux assigns it to addresses added
+// without an explicit scope.
+func addrScope(a inet.InterfaceAddr) uint8 {
+	switch {
+	case a.Family == linux.AF_INET && len(a.Addr) == 4 && a.Addr[0] == 127:
+		return linux.RT_SCOPE_HOST
+	case a.Family == linux.AF_INET6 && len(a.Addr) == 16:
+		if bytes.Equal(a.Addr, net.IPv6loopback) {
+			return linux.RT_SCOPE_HOST
+		}
+		if a.Addr[0] == 0xfe && a.Addr[1]&0xc0 == 0x80 {
+			return linux.RT_SCOPE_LINK
+		}
+	}
+	return linux.RT_SCOPE_UNIVERSE
+}
+
 // commonPrefixLen reports the length of the longest IP address prefix.
 // This is a simplied version from Golang's src/net/addrselect.go.
 func commonPrefixLen(a, b []byte) (cpl int) {
@@ -399,6 +452,16 @@ func (p *Protocol) dumpRoutes(ctx context.Context, msg *netlink.Message, ms *net
 	} else if hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
 		// We always send back an NLMSG_DONE.
 		ms.Multi = true
+
+		if family := requestFamily(msg); family != linux.AF_UNSPEC {
+			var filtered []inet.Route
+			for _, rt := range routeTables {
+				if rt.Family == family {
+					filtered = append(filtered, rt)
+				}
+			}
+			routeTables = filtered
+		}
 	} else {
 		// TODO(b/68878065): Only above cases are supported.
 		return syserr.ErrNotSupported
@@ -409,15 +472,19 @@ func (p *Protocol) dumpRoutes(ctx context.Context, msg *netlink.Message, ms *net
 			Type: linux.RTM_NEWROUTE,
 		})
 
+		// Stacks that don't have multiple routing tables leave the table
+		// unset; report their routes in the main table.
+		table := rt.Table
+		if table == linux.RT_TABLE_UNSPEC {
+			table = linux.RT_TABLE_MAIN
+		}
 		m.Put(&linux.RouteMessage{
 			Family: rt.Family,
 			DstLen: rt.DstLen,
 			SrcLen: rt.SrcLen,
 			TOS:    rt.TOS,
 
-			// Always return the main table since we don't have multiple
-			// routing tables.
-			Table:    linux.RT_TABLE_MAIN,
+			Table:    table,
 			Protocol: rt.Protocol,
 			Scope:    rt.Scope,
 			Type:     rt.Type,
@@ -438,6 +505,7 @@ func (p *Protocol) dumpRoutes(ctx context.Context, msg *netlink.Message, ms *net
 		if len(rt.GatewayAddr) > 0 {
 			m.PutAttr(linux.RTA_GATEWAY, primitive.AsByteSlice(rt.GatewayAddr))
 		}
+		m.PutAttr(linux.RTA_TABLE, primitive.AllocateUint32(uint32(table)))
 
 		// TODO(gvisor.dev/issue/578): There are many more attributes.
 	}
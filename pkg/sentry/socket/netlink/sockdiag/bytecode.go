@@ -0,0 +1,227 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+// bcOp is a decoded linux.InetDiagBCOp.
+type bcOp struct {
+	code uint8
+	yes  int
+	no   int
+}
+
+func decodeBCOp(b []byte) bcOp {
+	return bcOp{
+		code: b[0],
+		yes:  int(b[1]),
+		no:   int(hostarch.ByteOrder.Uint16(b[2:])),
+	}
+}
+
+// hostCond is a decoded linux.InetDiagHostCond along with its address.
+type hostCond struct {
+	family    uint8
+	prefixLen int
+	port      int32
+	addr      []byte
+}
+
+func decodeHostCond(b []byte) hostCond {
+	return hostCond{
+		family:    b[0],
+		prefixLen: int(b[1]),
+		port:      int32(hostarch.ByteOrder.Uint32(b[4:])),
+		addr:      b[linux.SizeOfInetDiagHostCond:],
+	}
+}
+
+// validJump returns true if the jump target at offset target of bc is the
+// start of an instruction or the end of the program. See Linux's
+// net/ipv4/inet_diag.c:valid_cc.
+func validJump(bc []byte, target int) bool {
+	off := 0
+	for off+linux.SizeOfInetDiagBCOp <= len(bc) {
+		if target < off {
+			return false
+		}
+		if target == off {
+			return true
+		}
+		op := decodeBCOp(bc[off:])
+		if op.yes < linux.SizeOfInetDiagBCOp || op.yes%4 != 0 {
+			return false
+		}
+		off += op.yes
+	}
+	return target == off
+}
+
+// validBytecode audits an INET_DIAG_REQ_BYTECODE program. Every jump must land
+// on an instruction boundary or the end of the program, and every instruction
+// must be followed by its operands. See Linux's
+// net/ipv4/inet_diag.c:inet_diag_bc_audit.
+func validBytecode(bc []byte) bool {
+	off := 0
+	for off < len(bc) {
+		rem := len(bc) - off
+		if rem < linux.SizeOfInetDiagBCOp {
+			return false
+		}
+		op := decodeBCOp(bc[off:])
+		minLen := linux.SizeOfInetDiagBCOp
+		switch op.code {
+		case linux.INET_DIAG_BC_S_COND, linux.INET_DIAG_BC_D_COND:
+			minLen += linux.SizeOfInetDiagHostCond
+			if rem < minLen {
+				return false
+			}
+			cond := decodeHostCond(bc[off+linux.SizeOfInetDiagBCOp:])
+			addrLen := 0
+			switch cond.family {
+			case linux.AF_UNSPEC:
+			case linux.AF_INET:
+				addrLen = 4
+			case linux.AF_INET6:
+				addrLen = 16
+			default:
+				return false
+			}
+			if cond.prefixLen > 8*addrLen {
+				return false
+			}
+			minLen += addrLen
+		case linux.INET_DIAG_BC_DEV_COND:
+			minLen += 4
+		case linux.INET_DIAG_BC_S_GE, linux.INET_DIAG_BC_S_LE, linux.INET_DIAG_BC_S_EQ,
+			linux.INET_DIAG_BC_D_GE, linux.INET_DIAG_BC_D_LE, linux.INET_DIAG_BC_D_EQ:
+			minLen += linux.SizeOfInetDiagBCOp
+		case linux.INET_DIAG_BC_AUTO, linux.INET_DIAG_BC_JMP, linux.INET_DIAG_BC_NOP:
+		default:
+			// Socket marks and cgroups are not supported.
+			return false
+		}
+		if rem < minLen {
+			return false
+		}
+		if op.code != linux.INET_DIAG_BC_NOP {
+			if op.no < minLen || op.no > rem+4 || op.no%4 != 0 {
+				return false
+			}
+			if op.no < rem && !validJump(bc, off+op.no) {
+				return false
+			}
+		}
+		if op.yes < minLen || op.yes > rem+4 || op.yes%4 != 0 {
+			return false
+		}
+		off += op.yes
+	}
+	return off == len(bc)
+}
+
+// prefixMatch returns true if the first bits bits of a and b are equal.
+func prefixMatch(a, b []byte, bits int) bool {
+	n := bits / 8
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	if r := bits % 8; r != 0 {
+		mask := byte(0xff) << (8 - r)
+		if (a[n]^b[n])&mask != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// condMatches evaluates an INET_DIAG_BC_S_COND or INET_DIAG_BC_D_COND
+// condition against a socket's port and address.
+func condMatches(cond hostCond, family int, port uint16, addr [16]byte) bool {
+	if cond.port != -1 && cond.port != int32(port) {
+		return false
+	}
+	if cond.family != linux.AF_UNSPEC && int(cond.family) != family {
+		// IPv4 conditions match IPv4-mapped addresses of IPv6 sockets.
+		if family == linux.AF_INET6 && cond.family == linux.AF_INET {
+			for i := 0; i < 10; i++ {
+				if addr[i] != 0 {
+					return false
+				}
+			}
+			if addr[10] != 0xff || addr[11] != 0xff {
+				return false
+			}
+			return prefixMatch(addr[12:], cond.addr, cond.prefixLen)
+		}
+		return false
+	}
+	if cond.prefixLen == 0 {
+		return true
+	}
+	return prefixMatch(addr[:], cond.addr, cond.prefixLen)
+}
+
+// runBytecode runs an audited INET_DIAG_REQ_BYTECODE program against is and
+// returns true if the socket should be reported. See Linux's
+// net/ipv4/inet_diag.c:inet_diag_bc_run.
+func runBytecode(bc []byte, is *inetSocket) bool {
+	off := 0
+	for off < len(bc) {
+		op := decodeBCOp(bc[off:])
+		yes := true
+		switch op.code {
+		case linux.INET_DIAG_BC_NOP:
+		case linux.INET_DIAG_BC_JMP:
+			yes = false
+		case linux.INET_DIAG_BC_S_EQ:
+			yes = is.sport == uint16(decodeBCOp(bc[off+linux.SizeOfInetDiagBCOp:]).no)
+		case linux.INET_DIAG_BC_S_GE:
+			yes = is.sport >= uint16(decodeBCOp(bc[off+linux.SizeOfInetDiagBCOp:]).no)
+		case linux.INET_DIAG_BC_S_LE:
+			yes = is.sport <= uint16(decodeBCOp(bc[off+linux.SizeOfInetDiagBCOp:]).no)
+		case linux.INET_DIAG_BC_D_EQ:
+			yes = is.dport == uint16(decodeBCOp(bc[off+linux.SizeOfInetDiagBCOp:]).no)
+		case linux.INET_DIAG_BC_D_GE:
+			yes = is.dport >= uint16(decodeBCOp(bc[off+linux.SizeOfInetDiagBCOp:]).no)
+		case linux.INET_DIAG_BC_D_LE:
+			yes = is.dport <= uint16(decodeBCOp(bc[off+linux.SizeOfInetDiagBCOp:]).no)
+		case linux.INET_DIAG_BC_AUTO:
+			// We don't track whether the port was chosen automatically,
+			// so treat every socket as explicitly bound.
+			yes = false
+		case linux.INET_DIAG_BC_S_COND:
+			cond := decodeHostCond(bc[off+linux.SizeOfInetDiagBCOp:])
+			yes = condMatches(cond, is.family, is.sport, is.src)
+		case linux.INET_DIAG_BC_D_COND:
+			cond := decodeHostCond(bc[off+linux.SizeOfInetDiagBCOp:])
+			yes = condMatches(cond, is.family, is.dport, is.dst)
+		case linux.INET_DIAG_BC_DEV_COND:
+			// Sockets are reported as not bound to a device.
+			yes = hostarch.ByteOrder.Uint32(bc[off+linux.SizeOfInetDiagBCOp:]) == 0
+		}
+		if yes {
+			off += op.yes
+		} else {
+			off += op.no
+		}
+	}
+	return off == len(bc)
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+func op(code uint8, yes uint8, no uint16) []byte {
+	b := []byte{code, yes, 0, 0}
+	hostarch.ByteOrder.PutUint16(b[2:], no)
+	return b
+}
+
+func cond(family, prefixLen uint8, port int32, addr ...byte) []byte {
+	b := []byte{family, prefixLen, 0, 0, 0, 0, 0, 0}
+	hostarch.ByteOrder.PutUint32(b[4:], uint32(port))
+	return append(b, addr...)
+}
+
+func concat(bs ...[]byte) []byte {
+	var out []byte
+	for _, b := range bs {
+		out = append(out, b...)
+	}
+	return out
+}
+
+func TestBytecode(t *testing.T) {
+	v4 := &inetSocket{
+		family: linux.AF_INET,
+		sport:  80,
+		dport:  40000,
+		src:    [16]byte{10, 0, 0, 1},
+		dst:    [16]byte{10, 0, 0, 2},
+	}
+	v6 := &inetSocket{
+		family: linux.AF_INET6,
+		sport:  80,
+		dport:  40000,
+		src:    [16]byte{10: 0xff, 11: 0xff, 12: 10, 13: 0, 14: 0, 15: 1},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		bc    []byte
+		valid bool
+		v4    bool
+		v6    bool
+	}{
+		{
+			name:  "empty",
+			bc:    nil,
+			valid: true,
+			v4:    true,
+			v6:    true,
+		},
+		{
+			name:  "sport eq",
+			bc:    concat(op(linux.INET_DIAG_BC_S_EQ, 8, 12), op(0, 0, 80)),
+			valid: true,
+			v4:    true,
+			v6:    true,
+		},
+		{
+			name:  "sport ne",
+			bc:    concat(op(linux.INET_DIAG_BC_S_EQ, 8, 12), op(0, 0, 22)),
+			valid: true,
+		},
+		{
+			name: "dport range",
+			bc: concat(
+				op(linux.INET_DIAG_BC_D_GE, 8, 20), op(0, 0, 30000),
+				op(linux.INET_DIAG_BC_D_LE, 8, 12), op(0, 0, 50000)),
+			valid: true,
+			v4:    true,
+			v6:    true,
+		},
+		{
+			name:  "src prefix",
+			bc:    concat(op(linux.INET_DIAG_BC_S_COND, 16, 20), cond(linux.AF_INET, 24, -1, 10, 0, 0, 0)),
+			valid: true,
+			v4:    true,
+			// IPv4 conditions match IPv4-mapped addresses.
+			v6: true,
+		},
+		{
+			name:  "dst prefix",
+			bc:    concat(op(linux.INET_DIAG_BC_D_COND, 16, 20), cond(linux.AF_INET, 32, -1, 10, 0, 0, 3)),
+			valid: true,
+		},
+		{
+			name:  "jump past end",
+			bc:    concat(op(linux.INET_DIAG_BC_S_EQ, 8, 16), op(0, 0, 80)),
+			valid: false,
+		},
+		{
+			name:  "jump into operand",
+			bc:    concat(op(linux.INET_DIAG_BC_JMP, 4, 8), op(linux.INET_DIAG_BC_S_EQ, 8, 12), op(0, 0, 80)),
+			valid: false,
+		},
+		{
+			name:  "missing operand",
+			bc:    op(linux.INET_DIAG_BC_S_EQ, 4, 8),
+			valid: false,
+		},
+		{
+			name:  "bad prefix",
+			bc:    concat(op(linux.INET_DIAG_BC_S_COND, 16, 20), cond(linux.AF_INET, 33, -1, 10, 0, 0, 0)),
+			valid: false,
+		},
+		{
+			name:  "unsupported op",
+			bc:    concat(op(linux.INET_DIAG_BC_MARK_COND, 12, 16), make([]byte, 8)),
+			valid: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validBytecode(tc.bc); got != tc.valid {
+				t.Fatalf("validBytecode() = %t, want %t", got, tc.valid)
+			}
+			if !tc.valid {
+				return
+			}
+			if got := runBytecode(tc.bc, v4); got != tc.v4 {
+				t.Errorf("runBytecode(v4) = %t, want %t", got, tc.v4)
+			}
+			if got := runBytecode(tc.bc, v6); got != tc.v6 {
+				t.Errorf("runBytecode(v6) = %t, want %t", got, tc.v6)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// inetSocket is an AF_INET or AF_INET6 socket being reported.
+type inetSocket struct {
+	id     uint64
+	fd     *vfs.FileDescription
+	s      socket.Socket
+	family int
+	state  uint32
+
+	// sport and dport are the local and remote ports, in host byte order.
+	sport uint16
+	dport uint16
+
+	// src and dst are the local and remote addresses. IPv4 addresses only
+	// use the first 4 bytes.
+	src [16]byte
+	dst [16]byte
+}
+
+func newInetSocket(t *kernel.Task, id uint64, fd *vfs.FileDescription, s socket.Socket) *inetSocket {
+	family, _, _ := s.Type()
+	is := &inetSocket{
+		id:     id,
+		fd:     fd,
+		s:      s,
+		family: family,
+		state:  s.State(),
+	}
+	if local, _, err := s.GetSockName(t); err == nil {
+		is.sport, is.src = inetAddr(local)
+	}
+	if remote, _, err := s.GetPeerName(t); err == nil {
+		is.dport, is.dst = inetAddr(remote)
+	}
+	return is
+}
+
+// inetAddr returns the port, in host byte order, and address of an AF_INET or
+// AF_INET6 socket address.
+func inetAddr(sa linux.SockAddr) (uint16, [16]byte) {
+	var port [2]byte
+	var addr [16]byte
+	switch sa := sa.(type) {
+	case *linux.SockAddrInet:
+		// Port is in network byte order.
+		hostarch.ByteOrder.PutUint16(port[:], sa.Port)
+		copy(addr[:], sa.Addr[:])
+	case *linux.SockAddrInet6:
+		hostarch.ByteOrder.PutUint16(port[:], sa.Port)
+		addr = sa.Addr
+	}
+	return binary.BigEndian.Uint16(port[:]), addr
+}
+
+// sockID returns the inet_diag_sockid of the socket.
+func (is *inetSocket) sockID() linux.InetDiagSockID {
+	id := linux.InetDiagSockID{
+		Src:    is.src,
+		Dst:    is.dst,
+		Cookie: socketCookie(is.id),
+	}
+	binary.BigEndian.PutUint16(id.SPort[:], is.sport)
+	binary.BigEndian.PutUint16(id.DPort[:], is.dport)
+	return id
+}
+
+// inetDiag handles SOCK_DIAG_BY_FAMILY requests for AF_INET and AF_INET6. See
+// net/ipv4/inet_diag.c.
+func inetDiag(t *kernel.Task, msg *netlink.Message, ms *netlink.MessageSet, dump bool) *syserr.Error {
+	var req linux.InetDiagReqV2
+	attrs, ok := msg.GetData(&req)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var match func(s socket.Socket) bool
+	switch req.Protocol {
+	case linux.IPPROTO_TCP:
+		match = socket.IsTCP
+	case linux.IPPROTO_UDP:
+		match = socket.IsUDP
+	default:
+		return syserr.ErrNoFileOrDir
+	}
+
+	var bc []byte
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+		if ahdr.Type == linux.INET_DIAG_REQ_BYTECODE {
+			if !validBytecode(value) {
+				return syserr.ErrInvalidArgument
+			}
+			bc = value
+		}
+	}
+
+	if dump {
+		ms.Multi = true
+		forEachSocket(t, int(req.Family), func(id uint64, fd *vfs.FileDescription, s socket.Socket) bool {
+			if !match(s) {
+				return true
+			}
+			is := newInetSocket(t, id, fd, s)
+			if is.sport == 0 {
+				// Unbound sockets aren't in Linux's lookup tables, so
+				// they aren't reported.
+				return true
+			}
+			if req.States&(1<<is.state) == 0 {
+				return true
+			}
+			if bc != nil && !runBytecode(bc, is) {
+				return true
+			}
+			addInetDiagMessage(t, ms, is, req.Ext)
+			return true
+		})
+		return nil
+	}
+
+	// Look up a single socket by address, like inet_diag_find_one_icsk.
+	found := false
+	forEachSocket(t, int(req.Family), func(id uint64, fd *vfs.FileDescription, s socket.Socket) bool {
+		if !match(s) {
+			return true
+		}
+		is := newInetSocket(t, id, fd, s)
+		if is.sport == 0 {
+			return true
+		}
+		sid := is.sockID()
+		if sid.SPort != req.ID.SPort || sid.DPort != req.ID.DPort || sid.Src != req.ID.Src || sid.Dst != req.ID.Dst {
+			return true
+		}
+		if !cookieMatches(req.ID.Cookie, id) {
+			return true
+		}
+		addInetDiagMessage(t, ms, is, req.Ext)
+		found = true
+		return false
+	})
+	if !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// addInetDiagMessage adds an inet_diag_msg describing is to ms, followed by
+// the attributes selected by ext.
+func addInetDiagMessage(t *kernel.Task, ms *netlink.MessageSet, is *inetSocket, ext uint8) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.SOCK_DIAG_BY_FAMILY,
+	})
+	rqueue, wqueue := queueSizes(is.s)
+	ino, uid := inodeAndUID(t, is.fd)
+	m.Put(&linux.InetDiagMsg{
+		Family: uint8(is.family),
+		State:  uint8(is.state),
+		ID:     is.sockID(),
+		RQueue: rqueue,
+		WQueue: wqueue,
+		UID:    uid,
+		Inode:  ino,
+	})
+
+	want := func(attr int) bool {
+		return ext&(1<<(attr-1)) != 0
+	}
+	if want(linux.INET_DIAG_MEMINFO) {
+		m.PutAttr(linux.INET_DIAG_MEMINFO, &linux.InetDiagMemInfo{
+			RMem: rqueue,
+			WMem: wqueue,
+			TMem: wqueue,
+		})
+	}
+	if want(linux.INET_DIAG_SKMEMINFO) {
+		m.PutAttr(linux.INET_DIAG_SKMEMINFO, skMemInfo(t, is.s, rqueue, wqueue))
+	}
+	// Like Linux, report the TOS of IPv6 sockets too, since dual-stack
+	// sockets use it for IPv4 traffic.
+	if want(linux.INET_DIAG_TOS) {
+		if v, ok := getSockOptInt(t, is.s, linux.SOL_IP, linux.IP_TOS); ok {
+			m.PutAttr(linux.INET_DIAG_TOS, primitive.AllocateUint8(uint8(v)))
+		}
+	}
+	if is.family == linux.AF_INET6 {
+		if want(linux.INET_DIAG_TCLASS) {
+			if v, ok := getSockOptInt(t, is.s, linux.SOL_IPV6, linux.IPV6_TCLASS); ok {
+				m.PutAttr(linux.INET_DIAG_TCLASS, primitive.AllocateUint8(uint8(v)))
+			}
+		}
+		if is.state == linux.TCP_LISTEN || is.state == linux.TCP_CLOSE {
+			if v, ok := getSockOptInt(t, is.s, linux.SOL_IPV6, linux.IPV6_V6ONLY); ok {
+				m.PutAttr(linux.INET_DIAG_SKV6ONLY, primitive.AllocateUint8(uint8(v)))
+			}
+		}
+	}
+	if !socket.IsTCP(is.s) {
+		return
+	}
+	if want(linux.INET_DIAG_INFO) {
+		if b := getSockOpt(t, is.s, linux.SOL_TCP, linux.TCP_INFO, linux.SizeOfTCPInfo); b != nil {
+			m.PutAttr(linux.INET_DIAG_INFO, primitive.AsByteSlice(b))
+		}
+	}
+	if want(linux.INET_DIAG_CONG) {
+		// This is Linux's net/tcp.h TCP_CA_NAME_MAX.
+		const tcpCANameMax = 16
+		if b := getSockOpt(t, is.s, linux.SOL_TCP, linux.TCP_CONGESTION, tcpCANameMax); b != nil {
+			if i := bytes.IndexByte(b, 0); i >= 0 {
+				b = b[:i]
+			}
+			m.PutAttrString(linux.INET_DIAG_CONG, string(b))
+		}
+	}
+}
+
+// skMemInfo returns the SK_MEMINFO_VARS array describing the memory used by s.
+func skMemInfo(t *kernel.Task, s socket.Socket, rqueue, wqueue uint32) *primitive.ByteSlice {
+	var info [linux.SK_MEMINFO_VARS]uint32
+	info[linux.SK_MEMINFO_RMEM_ALLOC] = rqueue
+	info[linux.SK_MEMINFO_WMEM_ALLOC] = wqueue
+	info[linux.SK_MEMINFO_WMEM_QUEUED] = wqueue
+	if v, ok := getSockOptInt(t, s, linux.SOL_SOCKET, linux.SO_RCVBUF); ok {
+		info[linux.SK_MEMINFO_RCVBUF] = uint32(v)
+	}
+	if v, ok := getSockOptInt(t, s, linux.SOL_SOCKET, linux.SO_SNDBUF); ok {
+		info[linux.SK_MEMINFO_SNDBUF] = uint32(v)
+	}
+	b := make(primitive.ByteSlice, 4*len(info))
+	for i, v := range info {
+		hostarch.ByteOrder.PutUint32(b[4*i:], v)
+	}
+	return &b
+}
+
+// getSockOpt returns the value of a socket option, or nil if it can't be
+// retrieved.
+func getSockOpt(t *kernel.Task, s socket.Socket, level, name, size int) []byte {
+	v, err := s.GetSockOpt(t, level, name, 0, size)
+	if err != nil || v == nil {
+		return nil
+	}
+	b := make([]byte, v.SizeBytes())
+	v.MarshalBytes(b)
+	return b
+}
+
+// getSockOptInt returns the value of an integer socket option.
+func getSockOptInt(t *kernel.Task, s socket.Socket, level, name int) (int32, bool) {
+	b := getSockOpt(t, s, level, name, 4)
+	if len(b) < 4 {
+		return 0, false
+	}
+	return int32(hostarch.ByteOrder.Uint32(b)), true
+}
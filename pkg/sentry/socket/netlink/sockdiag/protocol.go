@@ -0,0 +1,195 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sockdiag provides a NETLINK_SOCK_DIAG socket protocol.
+//
+// NETLINK_SOCK_DIAG sockets report the state of the sandbox's sockets, as used
+// by ss(8) and connection monitoring agents. Only SOCK_DIAG_BY_FAMILY requests
+// for AF_INET and AF_INET6 TCP and UDP sockets (inet_diag) and for AF_UNIX
+// sockets (unix_diag) are supported.
+package sockdiag
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_SOCK_DIAG netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_SOCK_DIAG
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	hdr := msg.Header()
+	switch hdr.Type {
+	case linux.SOCK_DIAG_BY_FAMILY:
+	case linux.SOCK_DESTROY:
+		// Like Linux without CONFIG_INET_DIAG_DESTROY.
+		return syserr.ErrNotSupported
+	default:
+		return syserr.ErrInvalidArgument
+	}
+
+	var req linux.SockDiagReq
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return syserr.ErrInvalidArgument
+	}
+
+	dump := hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	switch req.Family {
+	case linux.AF_INET, linux.AF_INET6:
+		return inetDiag(t, msg, ms, dump)
+	case linux.AF_UNIX:
+		return unixDiag(t, msg, ms, dump)
+	default:
+		// No handler for this family, see
+		// net/core/sock_diag.c:__sock_diag_cmd.
+		return syserr.ErrNoFileOrDir
+	}
+}
+
+// namespacedSocket is implemented by sockets that belong to a network
+// namespace.
+type namespacedSocket interface {
+	// NetworkNamespace returns the socket's network namespace, or nil if it
+	// belongs to the root network namespace.
+	NetworkNamespace() *inet.Namespace
+}
+
+// socketNetworkNamespace returns the network namespace of s. Sockets that
+// don't track their namespace, e.g. host sockets, belong to the root network
+// namespace.
+func socketNetworkNamespace(t *kernel.Task, s socket.Socket) *inet.Namespace {
+	if ns, ok := s.(namespacedSocket); ok {
+		if netns := ns.NetworkNamespace(); netns != nil {
+			return netns
+		}
+	}
+	return t.Kernel().RootNetworkNamespace()
+}
+
+// forEachSocket calls fn for each socket of the given family in t's network
+// namespace, in socket table order, until fn returns false. id is the socket
+// table entry number of the socket, which is used as its cookie.
+func forEachSocket(t *kernel.Task, family int, fn func(id uint64, fd *vfs.FileDescription, s socket.Socket) bool) {
+	netns := t.NetworkNamespace()
+	recs := t.Kernel().ListSockets()
+	sort.Slice(recs, func(i, j int) bool { return recs[i].ID < recs[j].ID })
+	for _, se := range recs {
+		fd := se.Sock
+		if !fd.TryIncRef() {
+			// Racing with socket destruction, this is ok.
+			continue
+		}
+		s, ok := fd.Impl().(socket.Socket)
+		if !ok {
+			fd.DecRef(t)
+			continue
+		}
+		if f, _, _ := s.Type(); f != family {
+			fd.DecRef(t)
+			continue
+		}
+		// As in Linux, only sockets in the caller's network namespace are
+		// visible.
+		if socketNetworkNamespace(t, s) != netns {
+			fd.DecRef(t)
+			continue
+		}
+		more := fn(se.ID, fd, s)
+		fd.DecRef(t)
+		if !more {
+			return
+		}
+	}
+}
+
+// socketCookie returns the cookie identifying the socket with the given socket
+// table entry number.
+func socketCookie(id uint64) [2]uint32 {
+	return [2]uint32{uint32(id), uint32(id >> 32)}
+}
+
+// cookieMatches returns true if a request cookie selects the socket with the
+// given socket table entry number.
+func cookieMatches(cookie [2]uint32, id uint64) bool {
+	if cookie == [2]uint32{linux.InetDiagNoCookie, linux.InetDiagNoCookie} {
+		return true
+	}
+	return cookie == socketCookie(id)
+}
+
+// inodeAndUID returns the inode number of a socket and the UID of its owner in
+// the user namespace of t.
+func inodeAndUID(t *kernel.Task, fd *vfs.FileDescription) (ino, uid uint32) {
+	stat, err := fd.Stat(t, vfs.StatOptions{Mask: linux.STATX_UID | linux.STATX_INO})
+	if err != nil {
+		log.Warningf("Failed to stat socket file: %v", err)
+		return 0, 0
+	}
+	if stat.Mask&linux.STATX_INO != 0 {
+		ino = uint32(stat.Ino)
+	}
+	if stat.Mask&linux.STATX_UID != 0 {
+		uid = uint32(auth.KUID(stat.UID).In(t.UserNamespace()).OrOverflow())
+	}
+	return ino, uid
+}
+
+// queueSizes returns the queue sizes of s, if it reports them.
+func queueSizes(s socket.Socket) (rqueue, wqueue uint32) {
+	qs, ok := s.(socket.QueueSizer)
+	if !ok {
+		return 0, 0
+	}
+	r, w := qs.QueueSizes()
+	return uint32(r), uint32(w)
+}
+
+// init registers the NETLINK_SOCK_DIAG provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_SOCK_DIAG, NewProtocol)
+}
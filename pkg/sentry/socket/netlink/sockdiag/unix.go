@@ -0,0 +1,127 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// unixState returns the TCP-like state that Linux reports for a unix domain
+// socket.
+func unixState(ep transport.Endpoint) uint32 {
+	if ce, ok := ep.(transport.ConnectingEndpoint); ok {
+		ce.Lock()
+		listening := ce.ListeningLocked()
+		ce.Unlock()
+		if listening {
+			return linux.TCP_LISTEN
+		}
+	}
+	if _, err := ep.GetRemoteAddress(); err == nil {
+		return linux.TCP_ESTABLISHED
+	}
+	return linux.TCP_CLOSE
+}
+
+// unixDiag handles SOCK_DIAG_BY_FAMILY requests for AF_UNIX. See
+// net/unix/diag.c.
+func unixDiag(t *kernel.Task, msg *netlink.Message, ms *netlink.MessageSet, dump bool) *syserr.Error {
+	var req linux.UnixDiagReq
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	if dump {
+		ms.Multi = true
+		forEachSocket(t, linux.AF_UNIX, func(id uint64, fd *vfs.FileDescription, s socket.Socket) bool {
+			us, ok := s.(*unix.Socket)
+			if !ok {
+				return true
+			}
+			state := unixState(us.Endpoint())
+			if req.States&(1<<state) == 0 {
+				return true
+			}
+			addUnixDiagMessage(t, ms, id, fd, us, state, req.Show)
+			return true
+		})
+		return nil
+	}
+
+	found := false
+	forEachSocket(t, linux.AF_UNIX, func(id uint64, fd *vfs.FileDescription, s socket.Socket) bool {
+		us, ok := s.(*unix.Socket)
+		if !ok {
+			return true
+		}
+		if ino, _ := inodeAndUID(t, fd); ino != req.Ino || !cookieMatches(req.Cookie, id) {
+			return true
+		}
+		addUnixDiagMessage(t, ms, id, fd, us, unixState(us.Endpoint()), req.Show)
+		found = true
+		return false
+	})
+	if !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// addUnixDiagMessage adds a unix_diag_msg describing us to ms, followed by the
+// attributes selected by show.
+//
+// UDIAG_SHOW_PEER is not supported, since endpoints don't know the inode of
+// their peer's file.
+func addUnixDiagMessage(t *kernel.Task, ms *netlink.MessageSet, id uint64, fd *vfs.FileDescription, us *unix.Socket, state, show uint32) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.SOCK_DIAG_BY_FAMILY,
+	})
+	_, stype, _ := us.Type()
+	ino, uid := inodeAndUID(t, fd)
+	m.Put(&linux.UnixDiagMsg{
+		Family: linux.AF_UNIX,
+		Type:   uint8(stype),
+		State:  uint8(state),
+		Ino:    ino,
+		Cookie: socketCookie(id),
+	})
+
+	if show&linux.UDIAG_SHOW_NAME != 0 {
+		if addr, err := us.Endpoint().GetLocalAddress(); err == nil && addr.Addr != "" {
+			m.PutAttr(linux.UNIX_DIAG_NAME, primitive.AsByteSlice([]byte(addr.Addr)))
+		}
+	}
+	rqueue, wqueue := queueSizes(us)
+	if show&linux.UDIAG_SHOW_RQLEN != 0 {
+		m.PutAttr(linux.UNIX_DIAG_RQLEN, &linux.UnixDiagRQLen{
+			RQueue: rqueue,
+			WQueue: wqueue,
+		})
+	}
+	if show&linux.UDIAG_SHOW_MEMINFO != 0 {
+		m.PutAttr(linux.UNIX_DIAG_MEMINFO, skMemInfo(t, us, rqueue, wqueue))
+	}
+	if show&linux.UDIAG_SHOW_UID != 0 {
+		m.PutAttr(linux.UNIX_DIAG_UID, primitive.AllocateUint32(uid))
+	}
+}
@@ -18,6 +18,7 @@ package netlink
 import (
 	"io"
 	"math"
+	"strconv"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -99,6 +100,10 @@ type Socket struct {
 	// portID is the port ID allocated for this socket.
 	portID int32
 
+	// groups is the bitmask of multicast groups that this socket is a member
+	// of.
+	groups uint32
+
 	// sendBufferSize is the send buffer "size". We don't actually have a
 	// fixed buffer but only consume this many bytes.
 	sendBufferSize uint32
@@ -112,6 +117,7 @@ type Socket struct {
 
 var _ socket.Socket = (*Socket)(nil)
 var _ transport.Credentialer = (*Socket)(nil)
+var _ port.Subscriber = (*Socket)(nil)
 
 // New creates a new Socket.
 func New(t *kernel.Task, skType linux.SockType, protocol Protocol) (*Socket, *syserr.Error) {
@@ -154,6 +160,9 @@ func (s *Socket) Release(ctx context.Context) {
 	if s.bound {
 		s.ports.Release(s.protocol.Protocol(), s.portID)
 	}
+	if s.groups != 0 {
+		s.ports.SetGroups(s.protocol.Protocol(), s, 0)
+	}
 }
 
 // Epollable implements FileDescriptionImpl.Epollable.
@@ -299,15 +308,30 @@ func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
-	if a.Groups != 0 {
-		return syserr.ErrPermissionDenied
+	groups := a.Groups
+	if groups != 0 {
+		mp, ok := s.protocol.(MulticastProtocol)
+		if !ok {
+			// No support for multicast groups in this protocol.
+			return syserr.ErrPermissionDenied
+		}
+		if n := mp.MulticastGroups(); n < 32 {
+			groups &= (1 << n) - 1
+		}
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+	// As in Linux, binding replaces the socket's multicast groups.
+	if groups != s.groups {
+		s.groups = groups
+		s.ports.SetGroups(s.protocol.Protocol(), s, groups)
+	}
+	return nil
 }
 
 // Connect implements socket.Socket.Connect.
@@ -541,6 +565,7 @@ func (s *Socket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Er
 	sa := &linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: s.groups,
 	}
 	return sa, uint32(sa.SizeBytes()), nil
 }
@@ -566,10 +591,12 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 
 	trunc := flags&linux.MSG_TRUNC != 0
 
+	var addr transport.Address
 	r := unix.EndpointReader{
 		Ctx:      t,
 		Endpoint: s.ep,
 		Peek:     flags&linux.MSG_PEEK != 0,
+		From:     &addr,
 	}
 
 	doRead := func() (int64, error) {
@@ -597,6 +624,7 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 		if trunc {
 			n = int64(r.MsgSize)
 		}
+		from.Groups = multicastGroups(addr)
 		return int(n), mflags, from, fromLen, socket.ControlMessages{}, syserr.FromError(err)
 	}
 
@@ -617,6 +645,7 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 			if trunc {
 				n = int64(r.MsgSize)
 			}
+			from.Groups = multicastGroups(addr)
 			return int(n), mflags, from, fromLen, socket.ControlMessages{}, syserr.FromError(err)
 		}
 
@@ -649,6 +678,35 @@ func (kernelSCM) Credentials(*kernel.Task) (kernel.ThreadID, auth.UID, auth.GID)
 // kernelCreds is the concrete version of kernelSCM used in all creds.
 var kernelCreds = &kernelSCM{}
 
+// multicastAddress returns the address with which a message sent to the
+// multicast groups in the bitmask groups is queued on a socket's endpoint.
+// Messages sent to the socket alone are queued with the empty address.
+func multicastAddress(groups uint32) transport.Address {
+	return transport.Address{Addr: strconv.FormatUint(uint64(groups), 10)}
+}
+
+// multicastGroups returns the bitmask of multicast groups to which a message
+// queued with addr was sent, or 0 if it was sent to the socket alone.
+func multicastGroups(addr transport.Address) uint32 {
+	groups, err := strconv.ParseUint(addr.Addr, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(groups)
+}
+
+// DeliverMulticast implements port.Subscriber.DeliverMulticast.
+func (s *Socket) DeliverMulticast(ctx context.Context, groups uint32, buf []byte) {
+	cms := transport.ControlMessages{
+		Credentials: kernelCreds,
+	}
+	// If the buffer is full, the message is dropped, as in Linux.
+	_, notify, err := s.connection.Send(ctx, [][]byte{buf}, cms, multicastAddress(groups))
+	if err == nil && notify {
+		s.connection.SendNotify()
+	}
+}
+
 // sendResponse sends the response messages in ms back to userspace.
 func (s *Socket) sendResponse(ctx context.Context, ms *MessageSet) *syserr.Error {
 	// Linux combines multiple netlink messages into a single datagram.
@@ -14,8 +14,9 @@
 
 // Package uevent provides a NETLINK_KOBJECT_UEVENT socket protocol.
 //
-// NETLINK_KOBJECT_UEVENT sockets send udev-style device events. gVisor does
-// not support any device events, so these sockets never send any messages.
+// NETLINK_KOBJECT_UEVENT sockets send udev-style device events to the members
+// of their only multicast group. The only device events that gVisor sends are
+// CPU hotplug events (see kernel.Kernel.SetOnlineCPUs).
 package uevent
 
 import (
@@ -31,7 +32,7 @@ import (
 // +stateify savable
 type Protocol struct{}
 
-var _ netlink.Protocol = (*Protocol)(nil)
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
 
 // NewProtocol creates a NETLINK_KOBJECT_UEVENT netlink.Protocol.
 func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
@@ -45,9 +46,17 @@ func (p *Protocol) Protocol() int {
 
 // CanSend implements netlink.Protocol.CanSend.
 func (p *Protocol) CanSend() bool {
+	// Device events are rare, and udev attaches socket filters to uevent
+	// sockets, so advertise support for filters even though they aren't
+	// applied to device events.
 	return false
 }
 
+// MulticastGroups implements netlink.MulticastProtocol.MulticastGroups.
+func (p *Protocol) MulticastGroups() uint {
+	return 1
+}
+
 // ProcessMessage implements netlink.Protocol.ProcessMessage.
 func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
 	// Silently ignore all messages.
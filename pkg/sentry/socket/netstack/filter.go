@@ -0,0 +1,189 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/ebpf"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// packetFilter runs the eBPF programs that apply to a socket on the packets
+// it sends and receives: the program attached to the socket with
+// SO_ATTACH_BPF, and the BPF_PROG_TYPE_CGROUP_SKB programs attached to the
+// cgroups of the task that created the socket.
+//
+// packetFilter is also the socket's tcpip.PacketOwner, which is how netstack
+// finds the filter of sent packets.
+//
+// +stateify savable
+type packetFilter struct {
+	// t is the task that created the socket. It is immutable.
+	t *kernel.Task
+
+	// family is the socket's address family. It is immutable.
+	family int
+
+	// cgroups are the ID chains of the cgroups of t when the socket was
+	// created (see kernel.CgroupIDChain). As in Linux, cgroup programs only
+	// apply to AF_INET and AF_INET6 sockets, so cgroups is nil for other
+	// sockets. It is immutable.
+	cgroups [][]uint32
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// prog is the program attached with SO_ATTACH_BPF, or nil.
+	prog *ebpf.Program
+
+	// generation is the value of Kernel.CgroupBPFGeneration for which
+	// ingress and egress were computed. cached is false if they were never
+	// computed.
+	generation uint64
+	cached     bool
+
+	// ingress and egress are the effective cgroup programs for received and
+	// sent packets.
+	ingress []*ebpf.Program
+	egress  []*ebpf.Program
+}
+
+// newPacketFilter returns the packetFilter of a socket created by t.
+func newPacketFilter(t *kernel.Task, family int) *packetFilter {
+	f := &packetFilter{
+		t:      t,
+		family: family,
+	}
+	if family == linux.AF_INET || family == linux.AF_INET6 {
+		f.cgroups = t.CgroupIDChains()
+	}
+	return f
+}
+
+// KUID implements tcpip.PacketOwner.KUID.
+func (f *packetFilter) KUID() uint32 {
+	return f.t.KUID()
+}
+
+// KGID implements tcpip.PacketOwner.KGID.
+func (f *packetFilter) KGID() uint32 {
+	return f.t.KGID()
+}
+
+// setProgram sets the program attached with SO_ATTACH_BPF. prog may be nil to
+// detach the program.
+func (f *packetFilter) setProgram(prog *ebpf.Program) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prog = prog
+}
+
+// programs returns the program attached with SO_ATTACH_BPF and the effective
+// cgroup programs for received and sent packets.
+func (f *packetFilter) programs() (prog *ebpf.Program, ingress, egress []*ebpf.Program) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cgroups != nil {
+		k := f.t.Kernel()
+		if gen := k.CgroupBPFGeneration(); !f.cached || f.generation != gen {
+			f.ingress = k.EffectiveCgroupBPFPrograms(f.cgroups, linux.BPF_CGROUP_INET_INGRESS)
+			f.egress = k.EffectiveCgroupBPFPrograms(f.cgroups, linux.BPF_CGROUP_INET_EGRESS)
+			f.generation = gen
+			f.cached = true
+		}
+	}
+	return f.prog, f.ingress, f.egress
+}
+
+// cgroupProgramsAttached returns true if cgroup programs may apply to the
+// socket.
+func (f *packetFilter) cgroupProgramsAttached() bool {
+	return f.cgroups != nil && f.t.Kernel().CgroupBPFAttached()
+}
+
+// FiltersIngress implements tcpip.PacketFilter.FiltersIngress.
+func (f *packetFilter) FiltersIngress() bool {
+	if f.cgroupProgramsAttached() {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.prog != nil
+}
+
+// FilterIngress implements tcpip.PacketFilter.FilterIngress.
+//
+// As in Linux's net/core/filter.c:sk_filter_trim_cap(), the cgroup programs
+// run first and see the packet from the network header. The socket's program
+// then sees the packet from pkt.DataOffset, and its return value is the
+// number of bytes to keep.
+func (f *packetFilter) FilterIngress(pkt *tcpip.FilteredPacket) (int, bool) {
+	prog, ingress, _ := f.programs()
+	env := f.t.Kernel().BPFEnv()
+	if !runCgroupPrograms(ingress, f.skb(pkt, pkt.Bytes[pkt.NetworkOffset:]), env) {
+		return 0, false
+	}
+	n := len(pkt.Bytes) - pkt.DataOffset
+	if prog == nil {
+		return n, true
+	}
+	skb := f.skb(pkt, pkt.Bytes[pkt.DataOffset:])
+	ret, err := ebpf.Exec(prog, &skb, env)
+	if err != nil || ret == 0 {
+		return 0, false
+	}
+	if ret < uint64(n) {
+		n = int(ret)
+	}
+	return n, true
+}
+
+// FiltersEgress implements tcpip.PacketFilter.FiltersEgress.
+func (f *packetFilter) FiltersEgress() bool {
+	return f.cgroupProgramsAttached()
+}
+
+// FilterEgress implements tcpip.PacketFilter.FilterEgress.
+func (f *packetFilter) FilterEgress(pkt *tcpip.FilteredPacket) bool {
+	_, _, egress := f.programs()
+	return runCgroupPrograms(egress, f.skb(pkt, pkt.Bytes[pkt.NetworkOffset:]), f.t.Kernel().BPFEnv())
+}
+
+// skb returns the input of a program that sees pkt starting at data.
+func (f *packetFilter) skb(pkt *tcpip.FilteredPacket, data []byte) ebpf.SKB {
+	return ebpf.SKB{
+		Data:     data,
+		Protocol: socket.Htons(uint16(pkt.NetProto)),
+		PktType:  uint32(toLinuxPacketType(pkt.PktType)),
+		Ifindex:  uint32(pkt.NICID),
+		Family:   uint32(f.family),
+	}
+}
+
+// runCgroupPrograms runs progs on skb, and returns false if any of them
+// rejects the packet. As in Linux, a program rejects the packet if bit 0 of
+// its return value is clear. Programs that fail also reject the packet.
+func runCgroupPrograms(progs []*ebpf.Program, skb ebpf.SKB, env ebpf.Env) bool {
+	for _, p := range progs {
+		ret, err := ebpf.Exec(p, &skb, env)
+		if err != nil || ret&1 == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -31,13 +31,17 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"net"
 	"reflect"
+	"strconv"
 	"time"
 
 	"golang.org/x/sys/unix"
 	"google.golang.org/protobuf/proto"
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/abi/linux/errno"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/eventchannel"
@@ -47,11 +51,14 @@ import (
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/metric"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/bpffd"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/sockfs"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/seccheck"
+	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
 	"gvisor.dev/gvisor/pkg/sentry/socket"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netfilter"
 	epb "gvisor.dev/gvisor/pkg/sentry/socket/netstack/events_go_proto"
@@ -90,6 +97,19 @@ func mustCreateGauge(name, description string) *tcpip.StatCounter {
 	return &cm
 }
 
+// Fields for operationLatency.
+var (
+	operationLatencyRead  = metric.FieldValue{"read"}
+	operationLatencyWrite = metric.FieldValue{"write"}
+)
+
+// operationLatency records the duration of non-blocking reads and writes on
+// netstack endpoints. It is only recorded when hot path timers are enabled.
+var operationLatency = metric.MustCreateNewTimerMetric("/netstack/operation_latency",
+	metric.NewDurationBucketer(20, time.Microsecond, time.Second),
+	"Duration of non-blocking reads and writes on netstack endpoints.",
+	metric.NewField("operation", &operationLatencyRead, &operationLatencyWrite))
+
 // Metrics contains metrics exported by netstack.
 var Metrics = tcpip.Stats{
 	DroppedPackets: mustCreateMetric("/netstack/dropped_packets", "Number of packets dropped at the transport layer."),
@@ -384,9 +404,31 @@ type sock struct {
 	// TODO(b/153685824): Move this to SocketOptions.
 	// sockOptInq corresponds to TCP_INQ.
 	sockOptInq bool
+
+	// tlsMu protects the kernel TLS transmit state in ktls. tlsMu is
+	// ordered before readMu.
+	tlsMu sync.Mutex `state:"nosave"`
+
+	// ktls is the kernel TLS state, for TCP sockets that enabled the TLS
+	// upper layer protocol.
+	ktls tlsState
+
+	// ktlsTx and ktlsRx are set once kernel TLS transmission and reception
+	// are enabled respectively, and are never reset.
+	ktlsTx atomicbitops.Bool
+	ktlsRx atomicbitops.Bool
+
+	// ktlsRxReady is true if ktls holds unread decrypted data.
+	ktlsRxReady atomicbitops.Bool
+
+	// ktlsTxFlushScheduled is true if a goroutine has been started to send
+	// pending kernel TLS records.
+	ktlsTxFlushScheduled atomicbitops.Bool `state:"nosave"`
 }
 
 var _ = socket.Socket(&sock{})
+var _ = socket.FileSender(&sock{})
+var _ = socket.QueueSizer(&sock{})
 
 // New creates a new endpoint socket.
 func New(t *kernel.Task, family int, skType linux.SockType, protocol int, queue *waiter.Queue, endpoint tcpip.Endpoint) (*vfs.FileDescription, *syserr.Error) {
@@ -394,6 +436,15 @@ func New(t *kernel.Task, family int, skType linux.SockType, protocol int, queue
 		endpoint.SocketOptions().SetDelayOption(true)
 	}
 
+	// Accepted endpoints inherit the packet filter of the listening socket.
+	if _, ok := endpoint.SocketOptions().GetPacketFilter().(*packetFilter); !ok {
+		f := newPacketFilter(t, family)
+		endpoint.SocketOptions().SetPacketFilter(f)
+		// The filter is also the packet owner, which iptables uses to get
+		// the UID and GID for owner matching.
+		endpoint.SetOwner(f)
+	}
+
 	mnt := t.Kernel().SocketMount()
 	d := sockfs.NewDentry(t, mnt)
 	defer d.DecRef(t)
@@ -423,11 +474,18 @@ func New(t *kernel.Task, family int, skType linux.SockType, protocol int, queue
 // Release implements vfs.FileDescriptionImpl.Release.
 func (s *sock) Release(ctx context.Context) {
 	kernel.KernelFromContext(ctx).DeleteSocket(&s.vfsfd)
+	if seccheck.Global.Enabled(seccheck.PointSocketClose) {
+		s.socketClosePoint(ctx)
+	}
 	e, ch := waiter.NewChannelEntry(waiter.EventHUp | waiter.EventErr)
 	s.EventRegister(&e)
 	defer s.EventUnregister(&e)
 
-	s.Endpoint.Close()
+	// If kernel TLS records are still being sent, the endpoint is closed
+	// once they are sent.
+	if !s.tlsDeferClose(true /* release */) {
+		s.Endpoint.Close()
+	}
 
 	// SO_LINGER option is valid only for TCP. For other socket types
 	// return after endpoint close.
@@ -448,6 +506,49 @@ func (s *sock) Release(ctx context.Context) {
 	s.namespace.DecRef(ctx)
 }
 
+// socketClosePoint sends a summary of the socket's connection to seccheck
+// sinks. It must be called before the endpoint is closed.
+func (s *sock) socketClosePoint(ctx context.Context) {
+	family, skType, protocol := s.Type()
+	info := &pb.SocketClose{
+		Domain:   int32(family),
+		Type:     int32(skType),
+		Protocol: int32(protocol),
+	}
+	if addr, err := s.Endpoint.GetLocalAddress(); err == nil {
+		info.LocalAddress = formatAddress(addr)
+	}
+	if addr, err := s.Endpoint.GetRemoteAddress(); err == nil {
+		info.RemoteAddress = formatAddress(addr)
+	}
+	switch stats := s.Endpoint.Stats().(type) {
+	case *tcp.Stats:
+		info.State = tcp.EndpointState(s.Endpoint.State()).String()
+		info.PacketsSent = stats.SegmentsSent.Value()
+		info.PacketsReceived = stats.SegmentsReceived.Value()
+	case *tcpip.TransportEndpointStats:
+		info.PacketsSent = stats.PacketsSent.Value()
+		info.PacketsReceived = stats.PacketsReceived.Value()
+	}
+	fields := seccheck.Global.GetFieldSet(seccheck.PointSocketClose)
+	if t := kernel.TaskFromContext(ctx); t != nil && !fields.Context.Empty() {
+		info.ContextData = &pb.ContextData{}
+		kernel.LoadSeccheckData(t, fields.Context, info.ContextData)
+	}
+	seccheck.Global.SentToSinks(func(c seccheck.Sink) error {
+		return c.SocketClose(ctx, fields, info)
+	})
+}
+
+// formatAddress returns addr as an "address:port" string, or the empty string
+// if addr is unspecified.
+func formatAddress(addr tcpip.FullAddress) string {
+	if addr.Addr.Len() == 0 && addr.Port == 0 {
+		return ""
+	}
+	return net.JoinHostPort(addr.Addr.String(), strconv.Itoa(int(addr.Port)))
+}
+
 // Epollable implements FileDescriptionImpl.Epollable.
 func (s *sock) Epollable() bool {
 	return true
@@ -464,7 +565,16 @@ func (s *sock) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOp
 	if dst.NumBytes() == 0 {
 		return 0, nil
 	}
-	n, _, _, _, _, err := s.nonBlockingRead(ctx, dst, false, false, false)
+	var (
+		n   int
+		err *syserr.Error
+	)
+	if s.ktlsRx.Load() {
+		// read(2) can't return records other than data records.
+		n, _, err = s.tlsRead(ctx, dst, false /* peek */, false /* wantType */)
+	} else {
+		n, _, _, _, _, err = s.nonBlockingRead(ctx, dst, false, false, false)
+	}
 	if err == syserr.ErrWouldBlock {
 		return int64(n), linuxerr.ErrWouldBlock
 	}
@@ -483,7 +593,9 @@ func (s *sock) Write(ctx context.Context, src usermem.IOSequence, opts vfs.Write
 	}
 
 	r := src.Reader(ctx)
-	n, err := s.Endpoint.Write(r, tcpip.WriteOptions{})
+	latency := operationLatency.StartHotPath(&operationLatencyWrite)
+	n, err := s.writeEndpoint(r, tcpip.WriteOptions{}, linux.TLS_RECORD_TYPE_DATA)
+	latency.Finish()
 	if _, ok := err.(*tcpip.ErrWouldBlock); ok {
 		return 0, linuxerr.ErrWouldBlock
 	}
@@ -498,6 +610,74 @@ func (s *sock) Write(ctx context.Context, src usermem.IOSequence, opts vfs.Write
 	return n, nil
 }
 
+// fileReader is an io.Reader that reads from a file at a given offset.
+type fileReader struct {
+	ctx context.Context
+	fd  *vfs.FileDescription
+	off int64
+
+	// err is the last error other than io.EOF returned by a read from fd.
+	err error
+}
+
+// Read implements io.Reader.Read.
+func (r *fileReader) Read(dst []byte) (int, error) {
+	n, err := r.fd.PRead(r.ctx, usermem.BytesIOSequence(dst), r.off, vfs.ReadOptions{})
+	r.off += n
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return int(n), err
+}
+
+// SendFile implements socket.FileSender.SendFile.
+func (s *sock) SendFile(ctx context.Context, in *vfs.FileDescription, off, count int64) (int64, bool, error) {
+	// Other socket types would send the whole payload as a single message.
+	if s.skType != linux.SOCK_STREAM {
+		return 0, false, nil
+	}
+	// Don't read the file only to discard its contents.
+	if s.Endpoint.Readiness(waiter.WritableEvents) == 0 {
+		return 0, true, linuxerr.ErrWouldBlock
+	}
+
+	// The file is read before calling into the endpoint rather than by a
+	// payloader, so that no endpoint locks are held while reading, which may
+	// block on the gofer or on a FUSE server in the sandbox. Reading more than
+	// the send buffer can hold would be wasted.
+	if sndBuf := s.Endpoint.SocketOptions().GetSendBufferSize(); count > sndBuf {
+		count = sndBuf
+	}
+	r := fileReader{
+		ctx: ctx,
+		fd:  in,
+		off: off,
+	}
+	var buf buffer.Buffer
+	// If some data was read before an error, the data is sent and the error
+	// is returned by the next call.
+	_, _ = buf.WriteFromReader(&r, count)
+	br := buf.AsBufferReader()
+	defer br.Close()
+	if br.Len() == 0 {
+		if r.err != nil {
+			return 0, true, r.err
+		}
+		return 0, true, io.EOF
+	}
+
+	latency := operationLatency.StartHotPath(&operationLatencyWrite)
+	n, err := s.Endpoint.Write(&br, tcpip.WriteOptions{})
+	latency.Finish()
+	if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+		return 0, true, linuxerr.ErrWouldBlock
+	}
+	if err != nil {
+		return 0, true, syserr.TranslateNetstackError(err).ToError()
+	}
+	return n, true, nil
+}
+
 // Accept implements the linux syscall accept(2) for sockets backed by
 // tcpip.Endpoint.
 func (s *sock) Accept(t *kernel.Task, peerRequested bool, flags int, blocking bool) (int32, linux.SockAddr, uint32, *syserr.Error) {
@@ -577,6 +757,9 @@ func (s *sock) GetSockOpt(t *kernel.Task, level, name int, outPtr hostarch.Addr,
 		}
 		return &val, nil
 	}
+	if (level == linux.SOL_TLS || level == linux.SOL_TCP && name == linux.TCP_ULP) && socket.IsTCP(s) {
+		return s.tlsGetSockOpt(level, name, outLen)
+	}
 
 	return GetSockOpt(t, s, s.Endpoint, s.family, s.skType, level, name, outPtr, outLen)
 }
@@ -607,6 +790,9 @@ func (s *sock) SetSockOpt(t *kernel.Task, level int, name int, optVal []byte) *s
 		s.sockOptInq = hostarch.ByteOrder.Uint32(optVal) != 0
 		return nil
 	}
+	if (level == linux.SOL_TLS || level == linux.SOL_TCP && name == linux.TCP_ULP) && socket.IsTCP(s) {
+		return s.tlsSetSockOpt(level, name, optVal)
+	}
 
 	return SetSockOpt(t, s, s.Endpoint, level, name, optVal)
 }
@@ -642,7 +828,11 @@ func (s *sock) isPacketBased() bool {
 
 // Readiness returns a mask of ready events for socket s.
 func (s *sock) Readiness(mask waiter.EventMask) waiter.EventMask {
-	return s.Endpoint.Readiness(mask)
+	ready := s.Endpoint.Readiness(mask)
+	if s.ktlsRxReady.Load() {
+		ready |= mask & waiter.ReadableEvents
+	}
+	return ready
 }
 
 // checkFamily returns true iff the specified address family may be used with
@@ -861,6 +1051,15 @@ func (s *sock) Shutdown(_ *kernel.Task, how int) *syserr.Error {
 		return err
 	}
 
+	// If kernel TLS records are still being sent, shut down the write side
+	// once they are sent.
+	if f&tcpip.ShutdownWrite != 0 && s.tlsDeferClose(false /* release */) {
+		f &^= tcpip.ShutdownWrite
+		if f == 0 {
+			return nil
+		}
+	}
+
 	// Issue shutdown request.
 	return syserr.TranslateNetstackError(s.Endpoint.Shutdown(f))
 }
@@ -920,26 +1119,31 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 		return &optP, nil
 
 	case linux.SO_PEERCRED:
-		if family != linux.AF_UNIX || outLen < unix.SizeofUcred {
+		// Only unix sockets have peer credentials; they handle this
+		// option before calling GetSockOpt.
+		return nil, syserr.ErrInvalidArgument
+
+	case linux.SO_PASSCRED:
+		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
 		}
 
-		tcred := t.Credentials()
-		creds := linux.ControlMessageCredentials{
-			PID: int32(t.ThreadGroup().ID()),
-			UID: uint32(tcred.EffectiveKUID.In(tcred.UserNamespace).OrOverflow()),
-			GID: uint32(tcred.EffectiveKGID.In(tcred.UserNamespace).OrOverflow()),
-		}
-		return &creds, nil
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetPassCred()))
+		return &v, nil
 
-	case linux.SO_PASSCRED:
+	case linux.SO_PASSSEC:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
 		}
 
-		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetPassCred()))
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetPassSec()))
 		return &v, nil
 
+	case linux.SO_PEERSEC:
+		// There is no LSM, so sockets never have a security label. This
+		// is what Linux returns when no LSM provides one.
+		return nil, syserr.ErrProtocolNotAvailable
+
 	case linux.SO_SNDBUF:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1462,6 +1666,19 @@ func getSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetIPv6RecvError()))
 		return &v, nil
 
+	case linux.IPV6_RTHDR:
+		if skType == linux.SOCK_STREAM {
+			return nil, syserr.ErrUnknownProtocolOption
+		}
+
+		// Linux truncates the header to outLen.
+		b := ep.SocketOptions().GetIPv6RoutingHeader()
+		if len(b) > outLen {
+			b = b[:outLen]
+		}
+		bP := primitive.ByteSlice(append([]byte(nil), b...))
+		return &bP, nil
+
 	case linux.IPV6_RECVORIGDSTADDR:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1908,6 +2125,15 @@ func setSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		ep.SocketOptions().SetPassCred(v != 0)
 		return nil
 
+	case linux.SO_PASSSEC:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := hostarch.ByteOrder.Uint32(optVal)
+		ep.SocketOptions().SetPassSec(v != 0)
+		return nil
+
 	case linux.SO_KEEPALIVE:
 		if len(optVal) < sizeOfInt32 {
 			return syserr.ErrInvalidArgument
@@ -1975,8 +2201,34 @@ func setSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		})
 		return nil
 
+	case linux.SO_ATTACH_BPF:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		fd := int32(hostarch.ByteOrder.Uint32(optVal))
+		file := t.GetFile(fd)
+		if file == nil {
+			return syserr.ErrBadFD
+		}
+		defer file.DecRef(t)
+		p := bpffd.ProgramFromFD(file)
+		if p == nil || p.Type() != linux.BPF_PROG_TYPE_SOCKET_FILTER {
+			return syserr.ErrInvalidArgument
+		}
+		// Only netstack sockets run programs on received packets.
+		f, ok := ep.SocketOptions().GetPacketFilter().(*packetFilter)
+		if !ok {
+			return syserr.ErrNotSupported
+		}
+		f.setProgram(p)
+		return nil
+
 	case linux.SO_DETACH_FILTER:
-		// optval is ignored.
+		// optval is ignored. SO_DETACH_BPF is the same option.
+		if f, ok := ep.SocketOptions().GetPacketFilter().(*packetFilter); ok {
+			f.setProgram(nil)
+		}
 		var v tcpip.SocketDetachFilterOption
 		return syserr.TranslateNetstackError(ep.SetSockOpt(&v))
 
@@ -2185,9 +2437,13 @@ func setSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 			return syserr.ErrInvalidArgument
 		}
 
+		// As in Linux, the option can't be changed once the socket has a local
+		// port, which raw sockets always have.
 		if socket.IsTCP(s) && tcp.EndpointState(ep.State()) != tcp.StateInitial {
 			return syserr.ErrInvalidEndpointState
-		} else if socket.IsUDP(s) && transport.DatagramEndpointState(ep.State()) != transport.DatagramEndpointStateInitial {
+		} else if (socket.IsUDP(s) || socket.IsICMP(s)) && transport.DatagramEndpointState(ep.State()) != transport.DatagramEndpointStateInitial {
+			return syserr.ErrInvalidEndpointState
+		} else if socket.IsRaw(s) {
 			return syserr.ErrInvalidEndpointState
 		}
 
@@ -2301,6 +2557,21 @@ func setSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		ep.SocketOptions().SetIPv6RecvError(v != 0)
 		return nil
 
+	case linux.IPV6_RTHDR:
+		// Only Segment Routing Headers on datagram sockets are supported.
+		if _, skType, _ := s.Type(); skType == linux.SOCK_STREAM {
+			return syserr.ErrUnknownProtocolOption
+		}
+		if len(optVal) == 0 {
+			ep.SocketOptions().SetIPv6RoutingHeader(nil)
+			return nil
+		}
+		if srh := header.IPv6SegmentRoutingExtHdr(optVal); !srh.IsValid() {
+			return syserr.ErrInvalidArgument
+		}
+		ep.SocketOptions().SetIPv6RoutingHeader(append([]byte(nil), optVal...))
+		return nil
+
 	case linux.IP6T_SO_SET_REPLACE:
 		if len(optVal) < linux.SizeOfIP6TReplace {
 			return syserr.ErrInvalidArgument
@@ -2687,7 +2958,9 @@ func (s *sock) nonBlockingRead(ctx context.Context, dst usermem.IOSequence, peek
 	s.readMu.Lock()
 	defer s.readMu.Unlock()
 
+	latency := operationLatency.StartHotPath(&operationLatencyRead)
 	res, err := s.Endpoint.Read(w, readOptions)
+	latency.Finish()
 	if _, ok := err.(*tcpip.ErrBadBuffer); ok && dst.NumBytes() == 0 {
 		err = nil
 	}
@@ -2852,10 +3125,13 @@ func (s *sock) recvErr(t *kernel.Task, dst usermem.IOSequence) (int, int, linux.
 
 // RecvMsg implements the linux syscall recvmsg(2) for sockets backed by
 // tcpip.Endpoint.
-func (s *sock) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, senderRequested bool, _ uint64) (n int, msgFlags int, senderAddr linux.SockAddr, senderAddrLen uint32, controlMessages socket.ControlMessages, err *syserr.Error) {
+func (s *sock) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, senderRequested bool, controlDataLen uint64) (n int, msgFlags int, senderAddr linux.SockAddr, senderAddrLen uint32, controlMessages socket.ControlMessages, err *syserr.Error) {
 	if flags&linux.MSG_ERRQUEUE != 0 {
 		return s.recvErr(t, dst)
 	}
+	if s.ktlsRx.Load() {
+		return s.tlsRecvMsg(t, dst, flags, haveDeadline, deadline, controlDataLen)
+	}
 
 	trunc := flags&linux.MSG_TRUNC != 0
 	peek := flags&linux.MSG_PEEK != 0
@@ -2950,6 +3226,10 @@ func (s *sock) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags
 		EndOfRecord:     flags&linux.MSG_EOR != 0,
 		ControlMessages: s.linuxToNetstackControlMessages(controlMessages),
 	}
+	recordType := uint8(linux.TLS_RECORD_TYPE_DATA)
+	if controlMessages.IP.HasTLSRecordType {
+		recordType = controlMessages.IP.TLSRecordType
+	}
 
 	r := src.Reader(t)
 	var (
@@ -2958,7 +3238,9 @@ func (s *sock) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags
 		ch    <-chan struct{}
 	)
 	for {
-		n, err := s.Endpoint.Write(r, opts)
+		latency := operationLatency.StartHotPath(&operationLatencyWrite)
+		n, err := s.writeEndpoint(r, opts, recordType)
+		latency.Finish()
 		total += n
 		if flags&linux.MSG_DONTWAIT != 0 {
 			return int(total), syserr.TranslateNetstackError(err)
@@ -3401,11 +3683,28 @@ func (s *sock) State() uint32 {
 	return 0
 }
 
+// NetworkNamespace returns the network namespace that the socket was created
+// in.
+func (s *sock) NetworkNamespace() *inet.Namespace {
+	return s.namespace
+}
+
 // Type implements socket.Socket.Type.
 func (s *sock) Type() (family int, skType linux.SockType, protocol int) {
 	return s.family, s.skType, s.protocol
 }
 
+// QueueSizes implements socket.QueueSizer.QueueSizes.
+func (s *sock) QueueSizes() (rqueue, wqueue int) {
+	if v, err := s.Endpoint.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err == nil {
+		rqueue = v
+	}
+	if v, err := s.Endpoint.GetSockOptInt(tcpip.SendQueueSizeOption); err == nil {
+		wqueue = v
+	}
+	return rqueue, wqueue
+}
+
 // EventRegister implements waiter.Waitable.
 func (s *sock) EventRegister(e *waiter.Entry) error {
 	s.Queue.EventRegister(e)
@@ -298,6 +298,36 @@ func (s *Stack) SetTCPRecovery(recovery inet.TCPLossRecovery) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
 }
 
+// IPv6SegmentRoutingEnabled implements inet.Stack.IPv6SegmentRoutingEnabled.
+func (s *Stack) IPv6SegmentRoutingEnabled() (bool, error) {
+	var enabled tcpip.IPv6SegmentRoutingOption
+	err := s.Stack.NetworkProtocolOption(ipv6.ProtocolNumber, &enabled)
+	return bool(enabled), syserr.TranslateNetstackError(err).ToError()
+}
+
+// SetIPv6SegmentRoutingEnabled implements
+// inet.Stack.SetIPv6SegmentRoutingEnabled.
+func (s *Stack) SetIPv6SegmentRoutingEnabled(enabled bool) error {
+	opt := tcpip.IPv6SegmentRoutingOption(enabled)
+	return syserr.TranslateNetstackError(s.Stack.SetNetworkProtocolOption(ipv6.ProtocolNumber, &opt)).ToError()
+}
+
+// IPv6ExtensionHeaderLimits implements inet.Stack.IPv6ExtensionHeaderLimits.
+func (s *Stack) IPv6ExtensionHeaderLimits() (inet.IPv6ExtensionHeaderLimits, error) {
+	var limits tcpip.IPv6ExtensionHeaderLimitsOption
+	if err := s.Stack.NetworkProtocolOption(ipv6.ProtocolNumber, &limits); err != nil {
+		return inet.IPv6ExtensionHeaderLimits{}, syserr.TranslateNetstackError(err).ToError()
+	}
+	return inet.IPv6ExtensionHeaderLimits(limits), nil
+}
+
+// SetIPv6ExtensionHeaderLimits implements
+// inet.Stack.SetIPv6ExtensionHeaderLimits.
+func (s *Stack) SetIPv6ExtensionHeaderLimits(limits inet.IPv6ExtensionHeaderLimits) error {
+	opt := tcpip.IPv6ExtensionHeaderLimitsOption(limits)
+	return syserr.TranslateNetstackError(s.Stack.SetNetworkProtocolOption(ipv6.ProtocolNumber, &opt)).ToError()
+}
+
 // Statistics implements inet.Stack.Statistics.
 func (s *Stack) Statistics(stat any, arg string) error {
 	switch stats := stat.(type) {
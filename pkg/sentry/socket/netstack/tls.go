@@ -0,0 +1,704 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// tlsULPName is the name of the kernel TLS upper layer protocol, as passed to
+// setsockopt(TCP_ULP).
+const tlsULPName = "tls"
+
+// tlsULPNameMax is Linux's include/net/tcp.h:TCP_ULP_NAME_MAX.
+const tlsULPNameMax = 16
+
+// tlsCipherState is the state of one direction of a kernel TLS connection. It
+// emulates Linux's software kTLS implementation (net/tls/tls_sw.c).
+//
+// +stateify savable
+type tlsCipherState struct {
+	version    uint16
+	cipherType uint16
+	key        []byte
+	salt       []byte
+
+	// iv is the explicit nonce of the next record. It is only used by TLS
+	// 1.2; TLS 1.3 derives the nonce from salt, iv and seq.
+	iv []byte
+
+	// seq is the sequence number of the next record.
+	seq uint64
+
+	// aead is derived from key. It is rebuilt lazily after restore.
+	aead cipher.AEAD `state:"nosave"`
+}
+
+// newTLSCipherState parses optVal, which must contain one of the supported
+// tls12_crypto_info_* structures.
+func newTLSCipherState(optVal []byte) (*tlsCipherState, *syserr.Error) {
+	if len(optVal) < linux.SizeOfTLSCryptoInfo {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var info linux.TLSCryptoInfo
+	info.UnmarshalUnsafe(optVal)
+	if info.Version != linux.TLS_1_2_VERSION && info.Version != linux.TLS_1_3_VERSION {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	c := &tlsCipherState{
+		version:    info.Version,
+		cipherType: info.CipherType,
+	}
+	var recSeq []byte
+	switch info.CipherType {
+	case linux.TLS_CIPHER_AES_GCM_128:
+		if len(optVal) != linux.SizeOfTLS12CryptoInfoAESGCM128 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var ci linux.TLS12CryptoInfoAESGCM128
+		ci.UnmarshalUnsafe(optVal)
+		c.key = append([]byte(nil), ci.Key[:]...)
+		c.salt = append([]byte(nil), ci.Salt[:]...)
+		c.iv = append([]byte(nil), ci.IV[:]...)
+		recSeq = ci.RecSeq[:]
+	case linux.TLS_CIPHER_AES_GCM_256:
+		if len(optVal) != linux.SizeOfTLS12CryptoInfoAESGCM256 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var ci linux.TLS12CryptoInfoAESGCM256
+		ci.UnmarshalUnsafe(optVal)
+		c.key = append([]byte(nil), ci.Key[:]...)
+		c.salt = append([]byte(nil), ci.Salt[:]...)
+		c.iv = append([]byte(nil), ci.IV[:]...)
+		recSeq = ci.RecSeq[:]
+	default:
+		return nil, syserr.ErrInvalidArgument
+	}
+	c.seq = binary.BigEndian.Uint64(recSeq)
+	return c, nil
+}
+
+// cryptoInfo returns the tls12_crypto_info_* structure describing c's
+// current state, as returned by getsockopt(SOL_TLS).
+func (c *tlsCipherState) cryptoInfo() marshal.Marshallable {
+	info := linux.TLSCryptoInfo{
+		Version:    c.version,
+		CipherType: c.cipherType,
+	}
+	switch c.cipherType {
+	case linux.TLS_CIPHER_AES_GCM_128:
+		ci := linux.TLS12CryptoInfoAESGCM128{Info: info}
+		copy(ci.Key[:], c.key)
+		copy(ci.Salt[:], c.salt)
+		copy(ci.IV[:], c.iv)
+		binary.BigEndian.PutUint64(ci.RecSeq[:], c.seq)
+		return &ci
+	case linux.TLS_CIPHER_AES_GCM_256:
+		ci := linux.TLS12CryptoInfoAESGCM256{Info: info}
+		copy(ci.Key[:], c.key)
+		copy(ci.Salt[:], c.salt)
+		copy(ci.IV[:], c.iv)
+		binary.BigEndian.PutUint64(ci.RecSeq[:], c.seq)
+		return &ci
+	default:
+		panic(fmt.Sprintf("unknown TLS cipher %d", c.cipherType))
+	}
+}
+
+func (c *tlsCipherState) cipher() cipher.AEAD {
+	if c.aead == nil {
+		block, err := aes.NewCipher(c.key)
+		if err != nil {
+			panic(fmt.Sprintf("aes.NewCipher failed with validated key: %v", err))
+		}
+		if c.aead, err = cipher.NewGCM(block); err != nil {
+			panic(fmt.Sprintf("cipher.NewGCM failed: %v", err))
+		}
+	}
+	return c.aead
+}
+
+// explicitNonceSize returns the size of the nonce sent with each record.
+func (c *tlsCipherState) explicitNonceSize() int {
+	if c.version == linux.TLS_1_2_VERSION {
+		return len(c.iv)
+	}
+	return 0
+}
+
+// maxRecordSize returns the maximum size of a record's ciphertext, excluding
+// the header.
+func (c *tlsCipherState) maxRecordSize() int {
+	size := linux.TLS_MAX_PAYLOAD_SIZE + c.explicitNonceSize() + c.cipher().Overhead()
+	if c.version == linux.TLS_1_3_VERSION {
+		// Inner content type.
+		size++
+	}
+	return size
+}
+
+// nonce returns the AEAD nonce for the current record. For TLS 1.2, explicit
+// is the explicit nonce sent with the record.
+func (c *tlsCipherState) nonce(explicit []byte) []byte {
+	nonce := make([]byte, 0, len(c.salt)+len(c.iv))
+	nonce = append(nonce, c.salt...)
+	if c.version == linux.TLS_1_2_VERSION {
+		return append(nonce, explicit...)
+	}
+	nonce = append(nonce, c.iv...)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], c.seq)
+	for i := range seq {
+		nonce[len(nonce)-len(seq)+i] ^= seq[i]
+	}
+	return nonce
+}
+
+// additionalData returns the AEAD additional data for the current record.
+func (c *tlsCipherState) additionalData(header []byte, recordType uint8, plaintextLen int) []byte {
+	if c.version == linux.TLS_1_3_VERSION {
+		return header
+	}
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, c.seq)
+	ad[8] = recordType
+	binary.BigEndian.PutUint16(ad[9:], linux.TLS_1_2_VERSION)
+	binary.BigEndian.PutUint16(ad[11:], uint16(plaintextLen))
+	return ad
+}
+
+// advance moves c to the next record.
+func (c *tlsCipherState) advance() {
+	c.seq++
+	if c.version == linux.TLS_1_2_VERSION {
+		binary.BigEndian.PutUint64(c.iv, binary.BigEndian.Uint64(c.iv)+1)
+	}
+}
+
+// seal returns a record of type recordType containing plaintext, including
+// its header.
+func (c *tlsCipherState) seal(recordType uint8, plaintext []byte) []byte {
+	aead := c.cipher()
+	outerType := recordType
+	payloadLen := len(plaintext)
+	if c.version == linux.TLS_1_3_VERSION {
+		// TLS 1.3 records always appear to carry application data; the
+		// real type is encrypted after the plaintext.
+		plaintext = append(plaintext, recordType)
+		outerType = linux.TLS_RECORD_TYPE_DATA
+	}
+	recordLen := c.explicitNonceSize() + len(plaintext) + aead.Overhead()
+	record := make([]byte, linux.TLS_HEADER_SIZE, linux.TLS_HEADER_SIZE+recordLen)
+	record[0] = outerType
+	binary.BigEndian.PutUint16(record[1:], linux.TLS_1_2_VERSION)
+	binary.BigEndian.PutUint16(record[3:], uint16(recordLen))
+	explicit := c.iv[:c.explicitNonceSize()]
+	record = append(record, explicit...)
+	record = aead.Seal(record, c.nonce(explicit), plaintext, c.additionalData(record[:linux.TLS_HEADER_SIZE], recordType, payloadLen))
+	c.advance()
+	return record
+}
+
+// open decrypts record, which includes its header, and returns its type and
+// plaintext.
+func (c *tlsCipherState) open(record []byte) (uint8, []byte, *syserr.Error) {
+	aead := c.cipher()
+	header := record[:linux.TLS_HEADER_SIZE]
+	payload := record[linux.TLS_HEADER_SIZE:]
+	recordType := header[0]
+	ens := c.explicitNonceSize()
+	if len(payload) < ens+aead.Overhead() {
+		return 0, nil, syserr.ErrInvalidDataMessage
+	}
+	explicit := payload[:ens]
+	ciphertext := payload[ens:]
+	plaintext, err := aead.Open(nil, c.nonce(explicit), ciphertext, c.additionalData(header, recordType, len(ciphertext)-aead.Overhead()))
+	if err != nil {
+		return 0, nil, syserr.ErrInvalidDataMessage
+	}
+	if c.version == linux.TLS_1_3_VERSION {
+		// Strip padding and recover the real record type.
+		i := len(plaintext) - 1
+		for i >= 0 && plaintext[i] == 0 {
+			i--
+		}
+		if i < 0 {
+			return 0, nil, syserr.ErrInvalidDataMessage
+		}
+		recordType = plaintext[i]
+		plaintext = plaintext[:i]
+	}
+	c.advance()
+	return recordType, plaintext, nil
+}
+
+// tlsState is the kernel TLS state of a TCP socket.
+//
+// +stateify savable
+type tlsState struct {
+	// ulp is true if the TLS upper layer protocol was installed with
+	// setsockopt(TCP_ULP). It is protected by sock.tlsMu.
+	ulp bool
+
+	// tx is the transmit cipher state, or nil if TLS_TX has not been set.
+	// It is protected by sock.tlsMu.
+	tx *tlsCipherState
+
+	// txPending holds the unsent part of the last record. It is protected
+	// by sock.tlsMu.
+	txPending []byte
+
+	// txWaiter is registered with the socket's queue while txPending can't
+	// be sent, and sends it once the endpoint becomes writable. txWaiting is
+	// true while txWaiter is registered. They are protected by sock.tlsMu.
+	txWaiter  waiter.Entry `state:"nosave"`
+	txWaiting bool         `state:"nosave"`
+
+	// txShutdown and txClose are set if shutdown(SHUT_WR) or close was
+	// requested while txPending couldn't be sent, in which case they are
+	// performed once it is sent. They are protected by sock.tlsMu.
+	txShutdown bool
+	txClose    bool
+
+	// rx is the receive cipher state, or nil if TLS_RX has not been set. It
+	// is protected by sock.readMu.
+	rx *tlsCipherState
+
+	// rxRaw holds the received part of the next record. It is protected by
+	// sock.readMu.
+	rxRaw []byte
+
+	// rxType and rxData are the type and unread plaintext of the current
+	// record, if rxRecord is true. They are protected by sock.readMu.
+	rxType   uint8
+	rxData   []byte
+	rxRecord bool
+}
+
+// tlsGetSockOpt implements getsockopt(2) for TCP_ULP and SOL_TLS options.
+func (s *sock) tlsGetSockOpt(level, name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	s.tlsMu.Lock()
+	defer s.tlsMu.Unlock()
+
+	if level == linux.SOL_TCP {
+		// name == linux.TCP_ULP.
+		if !s.ktls.ulp {
+			v := primitive.ByteSlice{}
+			return &v, nil
+		}
+		n := tlsULPNameMax
+		if outLen < n {
+			n = outLen
+		}
+		v := make(primitive.ByteSlice, n)
+		copy(v, tlsULPName)
+		return &v, nil
+	}
+
+	if !s.ktls.ulp {
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+	var c *tlsCipherState
+	switch name {
+	case linux.TLS_TX:
+		c = s.ktls.tx
+	case linux.TLS_RX:
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		c = s.ktls.rx
+	default:
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+	if outLen < linux.SizeOfTLSCryptoInfo {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if c == nil {
+		return nil, syserr.ErrBusy
+	}
+	info := c.cryptoInfo()
+	if outLen == linux.SizeOfTLSCryptoInfo {
+		return &linux.TLSCryptoInfo{Version: c.version, CipherType: c.cipherType}, nil
+	}
+	if outLen < info.SizeBytes() {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return info, nil
+}
+
+// tlsSetSockOpt implements setsockopt(2) for TCP_ULP and SOL_TLS options.
+func (s *sock) tlsSetSockOpt(level, name int, optVal []byte) *syserr.Error {
+	s.tlsMu.Lock()
+	defer s.tlsMu.Unlock()
+
+	if level == linux.SOL_TCP {
+		// name == linux.TCP_ULP.
+		if len(optVal) > tlsULPNameMax {
+			optVal = optVal[:tlsULPNameMax]
+		}
+		if i := bytes.IndexByte(optVal, 0); i >= 0 {
+			optVal = optVal[:i]
+		}
+		if string(optVal) != tlsULPName {
+			return syserr.ErrNoFileOrDir
+		}
+		if s.ktls.ulp {
+			return syserr.ErrExists
+		}
+		if s.State() != linux.TCP_ESTABLISHED {
+			return syserr.ErrNotConnected
+		}
+		s.ktls.ulp = true
+		return nil
+	}
+
+	if !s.ktls.ulp {
+		return syserr.ErrProtocolNotAvailable
+	}
+	switch name {
+	case linux.TLS_TX:
+		if s.ktls.tx != nil {
+			return syserr.ErrBusy
+		}
+		c, err := newTLSCipherState(optVal)
+		if err != nil {
+			return err
+		}
+		s.ktls.tx = c
+		s.ktlsTx.Store(true)
+		return nil
+	case linux.TLS_RX:
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		if s.ktls.rx != nil {
+			return syserr.ErrBusy
+		}
+		c, err := newTLSCipherState(optVal)
+		if err != nil {
+			return err
+		}
+		s.ktls.rx = c
+		s.ktlsRx.Store(true)
+		return nil
+	case linux.TLS_TX_ZEROCOPY_RO, linux.TLS_RX_EXPECT_NO_PAD:
+		// These are performance hints that don't affect the emulation.
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		return nil
+	default:
+		return syserr.ErrProtocolNotAvailable
+	}
+}
+
+// writeEndpoint writes data from r to s.Endpoint. If kernel TLS transmission
+// is enabled, the data is sent as TLS records of type recordType.
+func (s *sock) writeEndpoint(r tcpip.Payloader, opts tcpip.WriteOptions, recordType uint8) (int64, tcpip.Error) {
+	if !s.ktlsTx.Load() {
+		return s.Endpoint.Write(r, opts)
+	}
+
+	s.tlsMu.Lock()
+	defer s.tlsMu.Unlock()
+
+	if s.ktls.txShutdown || s.ktls.txClose {
+		return 0, &tcpip.ErrClosedForSend{}
+	}
+	// Finish sending the last record before starting a new one.
+	if err := s.tlsFlushLocked(); err != nil {
+		return 0, err
+	}
+	var total int64
+	for r.Len() > 0 {
+		size := r.Len()
+		if size > linux.TLS_MAX_PAYLOAD_SIZE {
+			size = linux.TLS_MAX_PAYLOAD_SIZE
+		}
+		plaintext := make([]byte, size)
+		if _, err := io.ReadFull(r, plaintext); err != nil {
+			if total > 0 {
+				return total, nil
+			}
+			return 0, &tcpip.ErrBadBuffer{}
+		}
+		s.ktls.txPending = s.ktls.tx.seal(recordType, plaintext)
+		if err := s.tlsFlushLocked(); err != nil {
+			if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+				// The record has been consumed and will be sent
+				// once the endpoint becomes writable.
+				return total + int64(size), nil
+			}
+			s.ktls.txPending = nil
+			if total > 0 {
+				return total, nil
+			}
+			return 0, err
+		}
+		total += int64(size)
+	}
+	return total, nil
+}
+
+// tlsFlushLocked sends s.ktls.txPending. It returns ErrWouldBlock if it could
+// not be sent completely, in which case the rest is sent once the endpoint
+// becomes writable.
+//
+// Preconditions: s.tlsMu must be locked.
+func (s *sock) tlsFlushLocked() tcpip.Error {
+	for len(s.ktls.txPending) > 0 {
+		n, err := s.Endpoint.Write(bytes.NewReader(s.ktls.txPending), tcpip.WriteOptions{})
+		s.ktls.txPending = s.ktls.txPending[n:]
+		if err == nil && n == 0 {
+			err = &tcpip.ErrWouldBlock{}
+		}
+		if err != nil {
+			if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+				s.tlsWaitWritableLocked()
+			}
+			return err
+		}
+	}
+	s.ktls.txPending = nil
+	return nil
+}
+
+// tlsWaitWritableLocked arranges for s.ktls.txPending to be sent once the
+// endpoint becomes writable.
+//
+// Preconditions: s.tlsMu must be locked.
+func (s *sock) tlsWaitWritableLocked() {
+	if s.ktls.txWaiting {
+		return
+	}
+	s.ktls.txWaiting = true
+	s.ktls.txWaiter = waiter.NewFunctionEntry(waiter.WritableEvents|waiter.EventHUp|waiter.EventErr, func(waiter.EventMask) {
+		// Notifications may be delivered with endpoint locks held, so
+		// the endpoint can't be written here.
+		if s.ktlsTxFlushScheduled.CompareAndSwap(false, true) {
+			go s.tlsWriteSpace() // S/R-SAFE: txPending is saved and sent by the next write.
+		}
+	})
+	s.EventRegister(&s.ktls.txWaiter)
+	// Don't miss the endpoint becoming writable before the registration.
+	if s.Endpoint.Readiness(waiter.WritableEvents|waiter.EventHUp|waiter.EventErr) != 0 {
+		if s.ktlsTxFlushScheduled.CompareAndSwap(false, true) {
+			go s.tlsWriteSpace() // S/R-SAFE: as above.
+		}
+	}
+}
+
+// tlsWriteSpace sends s.ktls.txPending after the endpoint became writable,
+// and then performs any shutdown or close that was deferred until it was
+// sent. As in Linux, pending data is discarded if the endpoint fails.
+func (s *sock) tlsWriteSpace() {
+	s.tlsMu.Lock()
+	defer s.tlsMu.Unlock()
+	s.ktlsTxFlushScheduled.Store(false)
+	if !s.ktls.txWaiting {
+		return
+	}
+	s.ktls.txWaiting = false
+	err := s.tlsFlushLocked()
+	if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+		// tlsFlushLocked registered txWaiter again.
+		return
+	}
+	s.EventUnregister(&s.ktls.txWaiter)
+	if err != nil {
+		s.ktls.txPending = nil
+	}
+	if s.ktls.txClose {
+		s.Endpoint.Close()
+		return
+	}
+	if s.ktls.txShutdown {
+		s.Endpoint.Shutdown(tcpip.ShutdownWrite)
+	}
+}
+
+// tlsDeferClose returns true if records are still being sent, in which case
+// the endpoint is closed (if release is true) or shut down for writing
+// (if release is false) once they are sent.
+func (s *sock) tlsDeferClose(release bool) bool {
+	if !s.ktlsTx.Load() {
+		return false
+	}
+	s.tlsMu.Lock()
+	defer s.tlsMu.Unlock()
+	if !s.ktls.txWaiting {
+		return false
+	}
+	if release {
+		s.ktls.txClose = true
+	} else {
+		s.ktls.txShutdown = true
+	}
+	return true
+}
+
+// tlsRecvRecordLocked reads and decrypts the next record from s.Endpoint
+// unless a record is already pending.
+//
+// Preconditions: s.readMu must be locked.
+func (s *sock) tlsRecvRecordLocked() *syserr.Error {
+	rx := s.ktls.rx
+	for !s.ktls.rxRecord {
+		need := linux.TLS_HEADER_SIZE
+		if len(s.ktls.rxRaw) >= linux.TLS_HEADER_SIZE {
+			recordLen := int(binary.BigEndian.Uint16(s.ktls.rxRaw[3:]))
+			if recordLen > rx.maxRecordSize() {
+				return syserr.ErrMessageTooLong
+			}
+			need += recordLen
+		}
+		if len(s.ktls.rxRaw) < need {
+			// Read exactly the missing bytes, so that any following
+			// records remain in the endpoint and keep it readable.
+			have := len(s.ktls.rxRaw)
+			if cap(s.ktls.rxRaw) < need {
+				raw := make([]byte, have, need)
+				copy(raw, s.ktls.rxRaw)
+				s.ktls.rxRaw = raw
+			}
+			w := tcpip.SliceWriter(s.ktls.rxRaw[have:need])
+			res, err := s.Endpoint.Read(&tcpip.LimitedWriter{W: &w, N: int64(need - have)}, tcpip.ReadOptions{})
+			if err != nil {
+				return syserr.TranslateNetstackError(err)
+			}
+			if res.Count == 0 {
+				return syserr.ErrWouldBlock
+			}
+			s.ktls.rxRaw = s.ktls.rxRaw[:have+res.Count]
+			s.Endpoint.ModerateRecvBuf(res.Count)
+			continue
+		}
+
+		recordType, data, err := rx.open(s.ktls.rxRaw[:need])
+		if err != nil {
+			return err
+		}
+		s.ktls.rxRaw = s.ktls.rxRaw[:0]
+		if recordType == linux.TLS_RECORD_TYPE_DATA && len(data) == 0 {
+			continue
+		}
+		s.ktls.rxType = recordType
+		s.ktls.rxData = data
+		s.ktls.rxRecord = true
+		s.ktlsRxReady.Store(true)
+	}
+	return nil
+}
+
+// tlsRead reads decrypted data from s without blocking. Consecutive data
+// records may be returned together, but other record types are always
+// returned by themselves and are only returned if wantType is true, in which
+// case the record type is returned in a TLS_GET_RECORD_TYPE control message.
+func (s *sock) tlsRead(ctx context.Context, dst usermem.IOSequence, peek, wantType bool) (int, socket.ControlMessages, *syserr.Error) {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+
+	var (
+		n    int
+		cmsg socket.ControlMessages
+	)
+	for {
+		if err := s.tlsRecvRecordLocked(); err != nil {
+			if n > 0 {
+				break
+			}
+			return 0, cmsg, err
+		}
+		recordType := s.ktls.rxType
+		if recordType != linux.TLS_RECORD_TYPE_DATA {
+			if n > 0 {
+				break
+			}
+			if !wantType {
+				return 0, cmsg, syserr.ErrIO
+			}
+		}
+		if wantType {
+			cmsg.IP.HasTLSRecordType = true
+			cmsg.IP.TLSRecordType = recordType
+		}
+
+		copied, err := dst.CopyOut(ctx, s.ktls.rxData)
+		n += copied
+		if err != nil {
+			if n > 0 {
+				break
+			}
+			return 0, cmsg, syserr.FromError(err)
+		}
+		if peek {
+			break
+		}
+		s.ktls.rxData = s.ktls.rxData[copied:]
+		if len(s.ktls.rxData) == 0 {
+			s.ktls.rxData = nil
+			s.ktls.rxRecord = false
+			s.ktlsRxReady.Store(false)
+		}
+		dst = dst.DropFirst(copied)
+		if recordType != linux.TLS_RECORD_TYPE_DATA || dst.NumBytes() == 0 {
+			break
+		}
+	}
+	return n, cmsg, nil
+}
+
+// tlsRecvMsg implements recvmsg(2) when kernel TLS reception is enabled.
+func (s *sock) tlsRecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, controlDataLen uint64) (int, int, linux.SockAddr, uint32, socket.ControlMessages, *syserr.Error) {
+	peek := flags&linux.MSG_PEEK != 0
+	wantType := controlDataLen > 0
+	n, cmsg, err := s.tlsRead(t, dst, peek, wantType)
+	if err != syserr.ErrWouldBlock || flags&linux.MSG_DONTWAIT != 0 {
+		return n, 0, nil, 0, cmsg, err
+	}
+
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	s.EventRegister(&e)
+	defer s.EventUnregister(&e)
+	for {
+		n, cmsg, err = s.tlsRead(t, dst, peek, wantType)
+		if err != syserr.ErrWouldBlock {
+			return n, 0, nil, 0, cmsg, err
+		}
+		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
+			if linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
+				return 0, 0, nil, 0, socket.ControlMessages{}, syserr.ErrTryAgain
+			}
+			return 0, 0, nil, 0, socket.ControlMessages{}, syserr.FromError(err)
+		}
+	}
+}
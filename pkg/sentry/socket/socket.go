@@ -210,6 +210,12 @@ type IPControlMessages struct {
 
 	// SockErr is the dequeued socket error on recvmsg(MSG_ERRQUEUE).
 	SockErr linux.SockErrCMsg
+
+	// HasTLSRecordType indicates whether TLSRecordType is valid/set.
+	HasTLSRecordType bool
+
+	// TLSRecordType is the content type of a kernel TLS record.
+	TLSRecordType uint8
 }
 
 // Release releases Unix domain socket credentials and rights.
@@ -300,6 +306,32 @@ type Socket interface {
 	Type() (family int, skType linux.SockType, protocol int)
 }
 
+// FileSender is implemented by sockets that can send the contents of a file
+// without first copying it into an intermediate sentry buffer. It is used by
+// sendfile(2).
+type FileSender interface {
+	// SendFile sends up to count bytes read from in at offset off, which is
+	// always non-negative; in's file offset is not used or modified. It
+	// returns the number of bytes sent, which are always read from the start
+	// of the requested range and may be fewer than count. SendFile never
+	// blocks; it returns linuxerr.ErrWouldBlock if no bytes could be sent
+	// because the socket's send buffer is full, and io.EOF if no bytes were
+	// sent because off is at or past the end of in.
+	//
+	// ok is false if the socket can't send from in directly, in which case
+	// the caller must fall back to reading from in and writing to the socket.
+	SendFile(ctx context.Context, in *vfs.FileDescription, off, count int64) (n int64, ok bool, err error)
+}
+
+// QueueSizer is implemented by sockets that can report how much data is
+// queued on them. It is used by the sock_diag netlink family.
+type QueueSizer interface {
+	// QueueSizes returns the number of bytes waiting to be read from the
+	// socket and waiting to be sent by it. Sizes that aren't known, e.g.
+	// because the socket is not connected, are returned as 0.
+	QueueSizes() (rqueue, wqueue int)
+}
+
 // Provider is the interface implemented by providers of sockets for
 // specific address families (e.g., AF_INET).
 type Provider interface {
@@ -69,6 +69,14 @@ type ConnectingEndpoint interface {
 
 	// WaiterQueue returns a pointer to the endpoint's waiter queue.
 	WaiterQueue() *waiter.Queue
+
+	// CredentialsLocked returns the credentials that the
+	// ConnectingEndpoint reports to its peer.
+	CredentialsLocked() CredentialsControlMessage
+
+	// SetPeerCredentialsLocked records the credentials of the endpoint
+	// that the ConnectingEndpoint is connected to.
+	SetPeerCredentialsLocked(creds CredentialsControlMessage)
 }
 
 // connectionedEndpoint is a Unix-domain connected or connectable endpoint and implements
@@ -145,9 +153,13 @@ func newConnectioned(ctx context.Context, stype linux.SockType, uid uniqueid.Pro
 }
 
 // NewPair allocates a new pair of connected unix-domain connectionedEndpoints.
-func NewPair(ctx context.Context, stype linux.SockType, uid uniqueid.Provider) (Endpoint, Endpoint) {
+// creds are reported by both endpoints as their own and their peer's
+// credentials.
+func NewPair(ctx context.Context, stype linux.SockType, uid uniqueid.Provider, creds CredentialsControlMessage) (Endpoint, Endpoint) {
 	a := newConnectioned(ctx, stype, uid)
 	b := newConnectioned(ctx, stype, uid)
+	a.creds, a.peerCreds = creds, creds
+	b.creds, b.peerCreds = creds, creds
 
 	q1 := &queue{ReaderQueue: a.Queue, WriterQueue: b.Queue, limit: defaultBufferSize}
 	q1.InitRefs()
@@ -316,8 +328,10 @@ func (e *connectionedEndpoint) BidirectionalConnect(ctx context.Context, ce Conn
 	// Create a newly bound connectionedEndpoint.
 	ne := &connectionedEndpoint{
 		baseEndpoint: baseEndpoint{
-			path:  e.path,
-			Queue: &waiter.Queue{},
+			path:      e.path,
+			Queue:     &waiter.Queue{},
+			creds:     e.peerCreds,
+			peerCreds: ce.CredentialsLocked(),
 		},
 		id:          e.idGenerator.UniqueID(),
 		idGenerator: e.idGenerator,
@@ -353,6 +367,7 @@ func (e *connectionedEndpoint) BidirectionalConnect(ctx context.Context, ce Conn
 			writeQueue: writeQueue,
 		}
 		readQueue.IncRef()
+		ce.SetPeerCredentialsLocked(e.peerCreds)
 		if e.stype == linux.SOCK_STREAM {
 			returnConnect(&streamQueueReceiver{queueReceiver: queueReceiver{readQueue: readQueue}}, connected)
 		} else {
@@ -420,6 +435,7 @@ func (e *connectionedEndpoint) Listen(ctx context.Context, backlog int) *syserr.
 				return syserr.FromError(err)
 			}
 		}
+		e.peerCreds = e.creds
 		return nil
 	}
 	if !e.isBound() {
@@ -434,6 +450,9 @@ func (e *connectionedEndpoint) Listen(ctx context.Context, backlog int) *syserr.
 		}
 	}
 
+	// Like Linux, a listening socket reports its own credentials as its
+	// peer's, and they are also reported to sockets that connect to it.
+	e.peerCreds = e.creds
 	return nil
 }
 
@@ -207,6 +207,16 @@ type Endpoint interface {
 	// SocketOptions returns the structure which contains all the socket
 	// level options.
 	SocketOptions() *tcpip.SocketOptions
+
+	// SetCredentials sets the credentials that the endpoint reports to its
+	// peers, i.e. the credentials of the task calling listen(2) or
+	// connect(2). They take effect when a connection is next established.
+	SetCredentials(creds CredentialsControlMessage)
+
+	// PeerCredentials returns the credentials of the endpoint's peer,
+	// recorded when the connection was established, for SO_PEERCRED. It
+	// returns nil if there are none.
+	PeerCredentials() CredentialsControlMessage
 }
 
 // A Credentialer is a socket or endpoint that supports the SO_PASSCRED socket
@@ -821,6 +831,14 @@ type baseEndpoint struct {
 
 	// ops is used to get socket level options.
 	ops tcpip.SocketOptions
+
+	// creds are the credentials reported to the endpoint's peers. See
+	// Endpoint.SetCredentials.
+	creds CredentialsControlMessage
+
+	// peerCreds are the credentials of the endpoint's peer. See
+	// Endpoint.PeerCredentials.
+	peerCreds CredentialsControlMessage
 }
 
 // EventRegister implements waiter.Waitable.EventRegister.
@@ -860,6 +878,35 @@ func (e *baseEndpoint) ConnectedPasscred() bool {
 	return e.connected != nil && e.connected.Passcred()
 }
 
+// SetCredentials implements Endpoint.SetCredentials.
+func (e *baseEndpoint) SetCredentials(creds CredentialsControlMessage) {
+	e.Lock()
+	defer e.Unlock()
+	e.creds = creds
+}
+
+// PeerCredentials implements Endpoint.PeerCredentials.
+func (e *baseEndpoint) PeerCredentials() CredentialsControlMessage {
+	e.Lock()
+	defer e.Unlock()
+	return e.peerCreds
+}
+
+// CredentialsLocked implements ConnectingEndpoint.CredentialsLocked.
+//
+// Preconditions: e.mu must be held.
+func (e *baseEndpoint) CredentialsLocked() CredentialsControlMessage {
+	return e.creds
+}
+
+// SetPeerCredentialsLocked implements
+// ConnectingEndpoint.SetPeerCredentialsLocked.
+//
+// Preconditions: e.mu must be held.
+func (e *baseEndpoint) SetPeerCredentialsLocked(creds CredentialsControlMessage) {
+	e.peerCreds = creds
+}
+
 // Connected implements ConnectingEndpoint.Connected.
 //
 // Preconditions: e.mu must be held.
@@ -30,7 +30,9 @@ import (
 	"gvisor.dev/gvisor/pkg/marshal"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/sockfs"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/socket"
 	"gvisor.dev/gvisor/pkg/sentry/socket/control"
@@ -38,6 +40,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/usermem"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
@@ -61,10 +64,17 @@ type Socket struct {
 	// socket if it is bound to an abstract socket namespace. Once the socket is
 	// bound, they cannot be modified.
 	abstractName      string
-	abstractNamespace *kernel.AbstractSocketNamespace
+	abstractNamespace *inet.AbstractSocketNamespace
+
+	// netns is the network namespace that the socket was created in. It is
+	// only used to identify the namespace, and doesn't hold a reference on
+	// it. It is nil for host sockets, which belong to the root network
+	// namespace. It is immutable.
+	netns *inet.Namespace
 }
 
 var _ = socket.Socket(&Socket{})
+var _ = socket.QueueSizer(&Socket{})
 
 // NewSockfsFile creates a new socket file in the global sockfs mount and
 // returns a corresponding file description.
@@ -77,9 +87,16 @@ func NewSockfsFile(t *kernel.Task, ep transport.Endpoint, stype linux.SockType)
 	if err != nil {
 		return nil, syserr.FromError(err)
 	}
+	fd.Impl().(*Socket).netns = t.NetworkNamespace()
 	return fd, nil
 }
 
+// NetworkNamespace returns the network namespace that the socket was created
+// in, or nil for host sockets.
+func (s *Socket) NetworkNamespace() *inet.Namespace {
+	return s.netns
+}
+
 // NewFileDescription creates and returns a socket file description
 // corresponding to the given mount and dentry.
 func NewFileDescription(ep transport.Endpoint, stype linux.SockType, flags uint32, mnt *vfs.Mount, d *vfs.Dentry, locks *vfs.FileLocks) (*vfs.FileDescription, error) {
@@ -127,9 +144,32 @@ func (s *Socket) Release(ctx context.Context) {
 // GetSockOpt implements the linux syscall getsockopt(2) for sockets backed by
 // a transport.Endpoint.
 func (s *Socket) GetSockOpt(t *kernel.Task, level, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if level == linux.SOL_SOCKET && name == linux.SO_PEERCRED {
+		if outLen < linux.SizeOfControlMessageCredentials {
+			return nil, syserr.ErrInvalidArgument
+		}
+		return s.peerCred(t), nil
+	}
 	return netstack.GetSockOpt(t, s, s.ep, linux.AF_UNIX, s.ep.Type(), level, name, outPtr, outLen)
 }
 
+// peerCred returns the value of the SO_PEERCRED socket option: the credentials
+// of the peer as of connect(2), listen(2) or socketpair(2), translated into
+// t's PID and user namespaces.
+func (s *Socket) peerCred(t *kernel.Task) *linux.ControlMessageCredentials {
+	var pid kernel.ThreadID
+	uid := auth.OverflowUID
+	gid := auth.OverflowGID
+	if creds, ok := s.ep.PeerCredentials().(control.SCMCredentials); ok {
+		pid, uid, gid = creds.Credentials(t)
+	}
+	return &linux.ControlMessageCredentials{
+		PID: int32(pid),
+		UID: uint32(uid),
+		GID: uint32(gid),
+	}
+}
+
 // blockingAccept implements a blocking version of accept(2), that is, if no
 // connections are ready to be accept, it will block until one becomes ready.
 func (s *Socket) blockingAccept(t *kernel.Task, peerAddr *transport.Address) (transport.Endpoint, *syserr.Error) {
@@ -176,6 +216,8 @@ func (s *Socket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking
 		return 0, nil, 0, err
 	}
 	defer ns.DecRef(t)
+	// As in Linux, the accepted socket is in the listener's namespace.
+	ns.Impl().(*Socket).netns = s.netns
 
 	if flags&linux.SOCK_NONBLOCK != 0 {
 		ns.SetStatusFlags(t, t.Credentials(), linux.SOCK_NONBLOCK)
@@ -213,9 +255,6 @@ func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 
 	if p[0] == 0 {
 		// Abstract socket. See net/unix/af_unix.c:unix_bind_abstract().
-		if t.IsNetworkNamespaced() {
-			return syserr.ErrInvalidEndpointState
-		}
 		asn := t.AbstractSockets()
 		name := p[1:]
 		if err := asn.Bind(t, name, bep, s); err != nil {
@@ -400,7 +439,7 @@ func (*provider) Pair(t *kernel.Task, stype linux.SockType, protocol int) (*vfs.
 	}
 
 	// Create the endpoints and sockets.
-	ep1, ep2 := transport.NewPair(t, stype, t.Kernel())
+	ep1, ep2 := transport.NewPair(t, stype, t.Kernel(), control.MakeCreds(t))
 	s1, err := NewSockfsFile(t, ep1, stype)
 	if err != nil {
 		ep1.Close(t)
@@ -515,6 +554,7 @@ func (s *Socket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Er
 // Listen implements the linux syscall listen(2) for sockets backed by
 // a transport.Endpoint.
 func (s *Socket) Listen(t *kernel.Task, backlog int) *syserr.Error {
+	s.ep.SetCredentials(control.MakeCreds(t))
 	return s.ep.Listen(t, backlog)
 }
 
@@ -529,10 +569,6 @@ func extractEndpoint(t *kernel.Task, sockaddr []byte) (transport.BoundEndpoint,
 
 	// Is it abstract?
 	if path[0] == 0 {
-		if t.IsNetworkNamespaced() {
-			return nil, syserr.ErrInvalidArgument
-		}
-
 		ep := t.AbstractSockets().BoundEndpoint(path[1:])
 		if ep == nil {
 			// No socket found.
@@ -575,6 +611,7 @@ func (s *Socket) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr
 	defer ep.Release(t)
 
 	// Connect the server endpoint.
+	s.ep.SetCredentials(control.MakeCreds(t))
 	err = s.ep.Connect(t, ep)
 
 	if err == syserr.ErrWrongProtocolForSocket {
@@ -853,6 +890,17 @@ func (s *Socket) Type() (family int, skType linux.SockType, protocol int) {
 	return linux.AF_UNIX, s.stype, 0
 }
 
+// QueueSizes implements socket.QueueSizer.QueueSizes.
+func (s *Socket) QueueSizes() (rqueue, wqueue int) {
+	if v, err := s.ep.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err == nil {
+		rqueue = v
+	}
+	if v, err := s.ep.GetSockOptInt(tcpip.SendQueueSizeOption); err == nil {
+		wqueue = v
+	}
+	return rqueue, wqueue
+}
+
 func convertAddress(addr transport.Address) (linux.SockAddr, uint32) {
 	var out linux.SockAddrUnix
 	out.Family = linux.AF_UNIX
@@ -24,9 +24,11 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/state/chunkstore"
 	"gvisor.dev/gvisor/pkg/state/statefile"
 )
 
@@ -54,6 +56,10 @@ type SaveOpts struct {
 	// Metadata is save metadata.
 	Metadata map[string]string
 
+	// ChunkStore, if not nil, is the store that memory contents are saved to.
+	// The state file then records only the hashes of the stored chunks.
+	ChunkStore *chunkstore.Store
+
 	// Callback is called prior to unpause, with any save error.
 	Callback func(err error)
 }
@@ -83,6 +89,9 @@ func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Wat
 		err = ErrStateFile{err}
 	} else {
 		// Save the kernel.
+		if opts.ChunkStore != nil {
+			ctx = context.WithValue(ctx, pgalloc.CtxChunkStore, opts.ChunkStore)
+		}
 		err = k.SaveTo(ctx, wc)
 
 		// ENOSPC is a state file error. This error can only come from
@@ -107,6 +116,10 @@ type LoadOpts struct {
 
 	// Key is used for state integrity check.
 	Key []byte
+
+	// ChunkStore, if not nil, is the store that memory contents are loaded
+	// from. It must be provided if the state file was saved with one.
+	ChunkStore *chunkstore.Store
 }
 
 // Load loads the given kernel, setting the provided platform and stack.
@@ -120,5 +133,8 @@ func (opts LoadOpts) Load(ctx context.Context, k *kernel.Kernel, timeReady chan
 	previousMetadata = m
 
 	// Restore the Kernel object graph.
+	if opts.ChunkStore != nil {
+		ctx = context.WithValue(ctx, pgalloc.CtxChunkStore, opts.ChunkStore)
+	}
 	return k.LoadFrom(ctx, r, timeReady, n, clocks, vfsOpts)
 }
@@ -34,6 +34,7 @@ var FutexCmd = abi.ValueSet{
 	linux.FUTEX_WAKE_BITSET:     "FUTEX_WAKE_BITSET",
 	linux.FUTEX_WAIT_REQUEUE_PI: "FUTEX_WAIT_REQUEUE_PI",
 	linux.FUTEX_CMP_REQUEUE_PI:  "FUTEX_CMP_REQUEUE_PI",
+	linux.FUTEX_LOCK_PI2:        "FUTEX_LOCK_PI2",
 }
 
 func futex(op uint64) string {
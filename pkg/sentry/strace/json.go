@@ -0,0 +1,135 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package strace
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// jsonOutput is the destination of SinkTypeJSON records.
+var jsonOutput struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+// SetJSONOutput sets the destination of SinkTypeJSON records, closing the
+// previous one, if any. Records are written as one JSON object per line. If w
+// is nil, records are discarded.
+func SetJSONOutput(w io.WriteCloser) {
+	jsonOutput.mu.Lock()
+	defer jsonOutput.mu.Unlock()
+	if jsonOutput.w != nil {
+		if err := jsonOutput.w.Close(); err != nil {
+			log.Warningf("Error closing strace JSON output: %v", err)
+		}
+	}
+	jsonOutput.w = w
+}
+
+// jsonArg is a syscall argument in a JSON record.
+type jsonArg struct {
+	// Raw is the raw argument value, in hexadecimal.
+	Raw string `json:"raw"`
+
+	// Value is the decoded argument, as it would appear in the strace log.
+	Value string `json:"value"`
+
+	// Path is the file referred to by FD arguments.
+	Path string `json:"path,omitempty"`
+}
+
+// jsonRecord is a single syscall in the JSON output.
+type jsonRecord struct {
+	Time       time.Time `json:"time"`
+	PID        int32     `json:"pid"`
+	TID        int32     `json:"tid"`
+	Process    string    `json:"process"`
+	Syscall    string    `json:"syscall"`
+	Sysno      uintptr   `json:"sysno"`
+	Args       []jsonArg `json:"args"`
+	Return     uint64    `json:"return"`
+	Errno      int       `json:"errno,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationNS int64     `json:"duration_ns"`
+
+	// output is the decoded arguments, which are completed after the syscall
+	// returns.
+	output []string
+}
+
+// jsonEnter decodes the syscall arguments into a new JSON record. Arguments
+// are decoded at entry because they may be invalidated by the syscall, e.g.
+// FDs closed by close(2).
+func (i *SyscallInfo) jsonEnter(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) *jsonRecord {
+	r := &jsonRecord{
+		PID:     int32(t.PIDNamespace().IDOfThreadGroup(t.ThreadGroup())),
+		TID:     int32(t.PIDNamespace().IDOfTask(t)),
+		Process: t.Name(),
+		Syscall: i.name,
+		Sysno:   sysno,
+		output:  i.pre(t, args, LogMaximumSize),
+	}
+	r.Args = make([]jsonArg, len(r.output))
+	for n := range r.output {
+		r.Args[n].Raw = hexArg(args[n])
+		if i.format[n] == FD {
+			if name, ok := fdPathname(t, args[n].Int()); ok {
+				r.Args[n].Path = name
+			}
+		}
+	}
+	return r
+}
+
+// jsonExit completes r with the syscall result and writes it to the JSON
+// output.
+func (i *SyscallInfo) jsonExit(t *kernel.Task, start time.Time, elapsed time.Duration, r *jsonRecord, args arch.SyscallArguments, rval uintptr, err error, errno int) {
+	if err == nil {
+		// Fill in the output after successful execution.
+		i.post(t, args, rval, r.output, LogMaximumSize)
+	} else {
+		r.Errno = errno
+		r.Error = err.Error()
+	}
+	for n, value := range r.output {
+		r.Args[n].Value = value
+	}
+	r.Time = start
+	r.Return = uint64(rval)
+	r.DurationNS = elapsed.Nanoseconds()
+
+	buf, jerr := json.Marshal(r)
+	if jerr != nil {
+		t.Warningf("Error encoding strace JSON record: %v", jerr)
+		return
+	}
+	buf = append(buf, '\n')
+
+	jsonOutput.mu.Lock()
+	defer jsonOutput.mu.Unlock()
+	if jsonOutput.w == nil {
+		return
+	}
+	if _, werr := jsonOutput.w.Write(buf); werr != nil {
+		t.Debugf("Error writing strace JSON record: %v", werr)
+	}
+}
@@ -204,7 +204,7 @@ var linuxAMD64 = SyscallMap{
 	176: makeSyscallInfo("delete_module", Hex, Hex),
 	177: makeSyscallInfo("get_kernel_syms", Hex),
 	// 178: query_module (only present in Linux < 2.6)
-	179: makeSyscallInfo("quotactl", Hex, Hex, Hex, Hex),
+	179: makeSyscallInfo("quotactl", Hex, Path, Hex, Hex),
 	180: makeSyscallInfo("nfsservctl", Hex, Hex, Hex),
 	// 181: getpmsg (not implemented in the Linux kernel)
 	// 182: putpmsg (not implemented in the Linux kernel)
@@ -374,6 +374,11 @@ var linuxAMD64 = SyscallMap{
 	435: makeSyscallInfo("clone3", Hex, Hex),
 	436: makeSyscallInfo("close_range", FD, FD, CloseRangeFlags),
 	441: makeSyscallInfo("epoll_pwait2", FD, EpollEvents, Hex, Timespec, SigSet),
+	443: makeSyscallInfo("quotactl_fd", FD, Hex, Hex, Hex),
+	449: makeSyscallInfo("futex_waitv", Hex, Hex, Hex, Timespec, Hex),
+	454: makeSyscallInfo("futex_wake", Hex, Hex, Hex, Hex),
+	455: makeSyscallInfo("futex_wait", Hex, Hex, Hex, Hex, Timespec, Hex),
+	456: makeSyscallInfo("futex_requeue", Hex, Hex, Hex, Hex),
 }
 
 func init() {
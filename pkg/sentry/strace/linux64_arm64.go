@@ -85,7 +85,7 @@ var linuxARM64 = SyscallMap{
 	57:  makeSyscallInfo("close", FD),
 	58:  makeSyscallInfo("vhangup"),
 	59:  makeSyscallInfo("pipe2", PipeFDs, Hex),
-	60:  makeSyscallInfo("quotactl", Hex, Hex, Hex, Hex),
+	60:  makeSyscallInfo("quotactl", Hex, Path, Hex, Hex),
 	61:  makeSyscallInfo("getdents64", FD, Hex, Hex),
 	62:  makeSyscallInfo("lseek", Hex, Hex, Hex),
 	63:  makeSyscallInfo("read", FD, ReadBuffer, Hex),
@@ -315,6 +315,11 @@ var linuxARM64 = SyscallMap{
 	435: makeSyscallInfo("clone3", Hex, Hex),
 	436: makeSyscallInfo("close_range", FD, FD, CloseRangeFlags),
 	441: makeSyscallInfo("epoll_pwait2", FD, EpollEvents, Hex, Timespec, SigSet),
+	443: makeSyscallInfo("quotactl_fd", FD, Hex, Hex, Hex),
+	449: makeSyscallInfo("futex_waitv", Hex, Hex, Hex, Timespec, Hex),
+	454: makeSyscallInfo("futex_wake", Hex, Hex, Hex, Hex),
+	455: makeSyscallInfo("futex_wait", Hex, Hex, Hex, Hex, Timespec, Hex),
+	456: makeSyscallInfo("futex_requeue", Hex, Hex, Hex, Hex),
 }
 
 func init() {
@@ -46,6 +46,7 @@ var PtraceRequestSet = abi.ValueSet{
 	linux.PTRACE_PEEKSIGINFO:       "PTRACE_PEEKSIGINFO",
 	linux.PTRACE_GETSIGMASK:        "PTRACE_GETSIGMASK",
 	linux.PTRACE_SETSIGMASK:        "PTRACE_SETSIGMASK",
+	linux.PTRACE_GET_SYSCALL_INFO:  "PTRACE_GET_SYSCALL_INFO",
 	linux.PTRACE_GETREGS:           "PTRACE_GETREGS",
 	linux.PTRACE_SETREGS:           "PTRACE_SETREGS",
 	linux.PTRACE_GETFPREGS:         "PTRACE_GETFPREGS",
@@ -477,6 +477,7 @@ var sockOptLevels = abi.ValueSet{
 	linux.SOL_RAW:     "SOL_RAW",
 	linux.SOL_PACKET:  "SOL_PACKET",
 	linux.SOL_NETLINK: "SOL_NETLINK",
+	linux.SOL_TLS:     "SOL_TLS",
 }
 
 var sockOptNames = map[uint64]abi.ValueSet{
@@ -651,4 +652,10 @@ var sockOptNames = map[uint64]abi.ValueSet{
 		linux.NETLINK_NO_ENOBUFS:       "NETLINK_NO_ENOBUFS",
 		linux.NETLINK_PKTINFO:          "NETLINK_PKTINFO",
 	},
+	linux.SOL_TLS: {
+		linux.TLS_TX:               "TLS_TX",
+		linux.TLS_RX:               "TLS_RX",
+		linux.TLS_TX_ZEROCOPY_RO:   "TLS_TX_ZEROCOPY_RO",
+		linux.TLS_RX_EXPECT_NO_PAD: "TLS_RX_EXPECT_NO_PAD",
+	},
 }
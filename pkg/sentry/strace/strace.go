@@ -151,6 +151,22 @@ func path(t *kernel.Task, addr hostarch.Addr) string {
 }
 
 func fd(t *kernel.Task, fd int32) string {
+	name, ok := fdPathname(t, fd)
+	switch {
+	case fd == linux.AT_FDCWD:
+		return fmt.Sprintf("AT_FDCWD %s", name)
+	case !ok:
+		// Cast FD to uint64 to avoid printing negative hex.
+		return fmt.Sprintf("%#x (bad FD)", uint64(fd))
+	default:
+		return fmt.Sprintf("%#x %s", fd, name)
+	}
+}
+
+// fdPathname returns the path of the file referred to by fd, or of the
+// working directory if fd is AT_FDCWD. It returns false if fd is not a valid
+// file descriptor.
+func fdPathname(t *kernel.Task, fd int32) (string, bool) {
 	root := t.FSContext().RootDirectory()
 	defer root.DecRef(t)
 
@@ -160,18 +176,17 @@ func fd(t *kernel.Task, fd int32) string {
 		defer wd.DecRef(t)
 
 		name, _ := vfsObj.PathnameWithDeleted(t, root, wd)
-		return fmt.Sprintf("AT_FDCWD %s", name)
+		return name, true
 	}
 
 	file := t.GetFile(fd)
 	if file == nil {
-		// Cast FD to uint64 to avoid printing negative hex.
-		return fmt.Sprintf("%#x (bad FD)", uint64(fd))
+		return "", false
 	}
 	defer file.DecRef(t)
 
 	name, _ := vfsObj.PathnameWithDeleted(t, root, file.VirtualDentry())
-	return fmt.Sprintf("%#x %s", fd, name)
+	return name, true
 }
 
 func fdpair(t *kernel.Task, addr hostarch.Addr) string {
@@ -667,6 +682,7 @@ type syscallContext struct {
 	start       time.Time
 	logOutput   []string
 	eventOutput []string
+	jsonRecord  *jsonRecord
 	flags       uint32
 }
 
@@ -688,6 +704,10 @@ func (s SyscallMap) SyscallEnter(t *kernel.Task, sysno uintptr, args arch.Syscal
 	if bits.IsOn32(flags, kernel.StraceEnableEvent) {
 		eventOutput = info.sendEnter(t, args)
 	}
+	var record *jsonRecord
+	if bits.IsOn32(flags, kernel.StraceEnableJSON) {
+		record = info.jsonEnter(t, sysno, args)
+	}
 
 	return &syscallContext{
 		info:        info,
@@ -695,6 +715,7 @@ func (s SyscallMap) SyscallEnter(t *kernel.Task, sysno uintptr, args arch.Syscal
 		start:       time.Now(),
 		logOutput:   output,
 		eventOutput: eventOutput,
+		jsonRecord:  record,
 		flags:       flags,
 	}
 }
@@ -712,6 +733,9 @@ func (s SyscallMap) SyscallExit(context any, t *kernel.Task, sysno, rval uintptr
 	if bits.IsOn32(c.flags, kernel.StraceEnableEvent) {
 		c.info.sendExit(t, elapsed, c.eventOutput, c.args, rval, err, errno)
 	}
+	if bits.IsOn32(c.flags, kernel.StraceEnableJSON) {
+		c.info.jsonExit(t, c.start, elapsed, c.jsonRecord, c.args, rval, err, errno)
+	}
 }
 
 // ConvertToSysnoMap converts the names to a map keyed on the syscall number
@@ -782,6 +806,9 @@ const (
 
 	// SinkTypeEvent sends strace to event log
 	SinkTypeEvent
+
+	// SinkTypeJSON sends strace to the JSON output set by SetJSONOutput.
+	SinkTypeJSON
 )
 
 func convertToSyscallFlag(sinks SinkType) uint32 {
@@ -792,6 +819,9 @@ func convertToSyscallFlag(sinks SinkType) uint32 {
 	if bits.IsOn32(uint32(sinks), uint32(SinkTypeEvent)) {
 		ret |= kernel.StraceEnableEvent
 	}
+	if bits.IsOn32(uint32(sinks), uint32(SinkTypeJSON)) {
+		ret |= kernel.StraceEnableJSON
+	}
 	return ret
 }
 
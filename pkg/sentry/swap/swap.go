@@ -0,0 +1,305 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package swap implements storage for pages of anonymous memory that have
+// been swapped out of the sentry's memory file.
+//
+// Pages are stored in a Pool, which holds them compressed in memory (similar
+// to Linux's zswap) and, optionally, uncompressed in a host file for pages
+// that do not compress well or that do not fit in the compressed pool.
+package swap
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+var (
+	swapOuts = metric.MustCreateNewUint64Metric("/memory/swap_outs", false /* sync */, "Number of pages swapped out.")
+	swapIns  = metric.MustCreateNewUint64Metric("/memory/swap_ins", false /* sync */, "Number of pages swapped in.")
+)
+
+// ErrFull is returned by Pool.Store when the pool has no space for the page.
+var ErrFull = errors.New("swap pool is full")
+
+// maxCompressedPageSize is the largest compressed size at which a page is
+// stored compressed. Pages that compress worse than this are stored in the
+// host file, if any, where they cost less than their compressed form would in
+// memory.
+const maxCompressedPageSize = 3 * hostarch.PageSize / 4
+
+// PoolOpts contains options to NewPool.
+type PoolOpts struct {
+	// MaxCompressedBytes is the maximum total size of compressed pages held
+	// in memory.
+	MaxCompressedBytes uint64
+
+	// File, if not nil, is a host file used to store pages that are not
+	// stored compressed. The Pool takes ownership of File.
+	File *os.File
+
+	// MaxFileBytes is the maximum size of File.
+	MaxFileBytes uint64
+}
+
+// Pool stores swapped-out pages.
+//
+// +stateify savable
+type Pool struct {
+	// maxCompressedBytes and maxFileBytes are immutable.
+	maxCompressedBytes uint64
+	maxFileBytes       uint64
+
+	// file is the host file used to store uncompressed pages. file is
+	// immutable. Pages stored in file are read back into memory when the
+	// Pool is saved, so file is nil after restore.
+	file *os.File `state:"nosave"`
+
+	mu sync.Mutex `state:"nosave"`
+
+	// compressedBytes is the total size of compressed pages held in memory.
+	// compressedBytes is protected by mu.
+	compressedBytes uint64
+
+	// fileSize is the size of file. freeSlots contains the offsets of unused
+	// page-sized slots below fileSize. fileSize and freeSlots are protected
+	// by mu.
+	fileSize  uint64
+	freeSlots []uint64
+}
+
+// NewPool returns a new Pool.
+func NewPool(opts PoolOpts) *Pool {
+	return &Pool{
+		maxCompressedBytes: opts.MaxCompressedBytes,
+		maxFileBytes:       opts.MaxFileBytes,
+		file:               opts.File,
+	}
+}
+
+// Stats contains Pool usage statistics.
+type Stats struct {
+	// CompressedBytes is the total size of compressed pages held in memory.
+	CompressedBytes uint64
+
+	// FileBytes is the total size of pages stored in the host file.
+	FileBytes uint64
+}
+
+// Stats returns usage statistics for p.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{
+		CompressedBytes: p.compressedBytes,
+		FileBytes:       p.fileSize - uint64(len(p.freeSlots))*hostarch.PageSize,
+	}
+}
+
+// An Entry is a swapped-out page stored in a Pool. Entries are immutable
+// after creation (except for their reference count), so they may be shared
+// between MemoryManagers after fork.
+//
+// +stateify savable
+type Entry struct {
+	pool *Pool
+
+	// refs is the reference count. refs is protected by pool.mu.
+	refs int64
+
+	// If zero is true, the page contains only zeroes, and no other fields
+	// are used.
+	zero bool
+
+	// If data is not nil, it is the page's contents compressed with flate.
+	data []byte
+
+	// charged is the number of bytes of data that are included in
+	// pool.compressedBytes.
+	charged uint64
+
+	// If inFile is true, the page is stored at offset slot in pool.file.
+	inFile bool
+	slot   uint64
+}
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, err := flate.NewWriter(nil, flate.BestSpeed)
+		if err != nil {
+			panic(fmt.Sprintf("flate.NewWriter failed: %v", err))
+		}
+		return w
+	},
+}
+
+// Store stores a copy of src, which must be exactly one page long, in p, and
+// returns an Entry with a single reference that refers to it. If p does not
+// have space for the page, Store returns ErrFull.
+func (p *Pool) Store(src []byte) (*Entry, error) {
+	if len(src) != hostarch.PageSize {
+		panic(fmt.Sprintf("invalid page length %d", len(src)))
+	}
+	if isZero(src) {
+		swapOuts.Increment()
+		return &Entry{pool: p, refs: 1, zero: true}, nil
+	}
+
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	if _, err := w.Write(src); err != nil {
+		flateWriters.Put(w)
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		flateWriters.Put(w)
+		return nil, err
+	}
+	flateWriters.Put(w)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if buf.Len() <= maxCompressedPageSize && p.compressedBytes+uint64(buf.Len()) <= p.maxCompressedBytes {
+		// Copy the compressed page so that the Entry doesn't retain buf's
+		// excess capacity.
+		data := append([]byte(nil), buf.Bytes()...)
+		p.compressedBytes += uint64(len(data))
+		swapOuts.Increment()
+		return &Entry{pool: p, refs: 1, data: data, charged: uint64(len(data))}, nil
+	}
+	if p.file == nil {
+		return nil, ErrFull
+	}
+	var slot uint64
+	if n := len(p.freeSlots); n != 0 {
+		slot = p.freeSlots[n-1]
+		p.freeSlots = p.freeSlots[:n-1]
+	} else if p.fileSize+hostarch.PageSize <= p.maxFileBytes {
+		slot = p.fileSize
+		p.fileSize += hostarch.PageSize
+	} else {
+		return nil, ErrFull
+	}
+	if _, err := p.file.WriteAt(src, int64(slot)); err != nil {
+		p.freeSlots = append(p.freeSlots, slot)
+		return nil, err
+	}
+	swapOuts.Increment()
+	return &Entry{pool: p, refs: 1, inFile: true, slot: slot}, nil
+}
+
+// Load copies the page referred to by e into dst, which must be exactly one
+// page long.
+func (e *Entry) Load(dst []byte) error {
+	if len(dst) != hostarch.PageSize {
+		panic(fmt.Sprintf("invalid page length %d", len(dst)))
+	}
+	switch {
+	case e.zero:
+		for i := range dst {
+			dst[i] = 0
+		}
+	case e.data != nil:
+		r := flate.NewReader(bytes.NewReader(e.data))
+		defer r.Close()
+		if _, err := io.ReadFull(r, dst); err != nil {
+			return fmt.Errorf("failed to decompress swapped page: %w", err)
+		}
+	default:
+		if _, err := e.pool.file.ReadAt(dst, int64(e.slot)); err != nil {
+			return fmt.Errorf("failed to read swapped page from host file: %w", err)
+		}
+	}
+	swapIns.Increment()
+	return nil
+}
+
+// IncRef increments e's reference count.
+func (e *Entry) IncRef() {
+	e.pool.mu.Lock()
+	defer e.pool.mu.Unlock()
+	if e.refs <= 0 {
+		panic(fmt.Sprintf("Entry.IncRef: invalid reference count %d", e.refs))
+	}
+	e.refs++
+}
+
+// DecRef decrements e's reference count, releasing its storage if the
+// reference count reaches zero.
+func (e *Entry) DecRef() {
+	p := e.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.refs--
+	switch {
+	case e.refs > 0:
+		return
+	case e.refs < 0:
+		panic(fmt.Sprintf("Entry.DecRef: invalid reference count %d", e.refs))
+	}
+	p.compressedBytes -= e.charged
+	e.charged = 0
+	e.data = nil
+	if e.inFile && p.file != nil {
+		p.freeSlots = append(p.freeSlots, e.slot)
+	}
+}
+
+// beforeSave is invoked by stateify.
+func (e *Entry) beforeSave() {
+	if !e.inFile || e.data != nil || e.refs == 0 {
+		return
+	}
+	// The host file is not saved, so store the page in memory instead. It
+	// isn't worth compressing, so store it uncompressed as a stored flate
+	// block. This isn't charged to the pool, whose limit only applies to
+	// pages that are swapped out while the sandbox is running; e.inFile
+	// remains set so that the slot is freed by DecRef if the sandbox keeps
+	// running after the save.
+	page := make([]byte, hostarch.PageSize)
+	if _, err := e.pool.file.ReadAt(page, int64(e.slot)); err != nil {
+		panic(fmt.Sprintf("failed to read swapped page from host file: %v", err))
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.NoCompression)
+	if err != nil {
+		panic(fmt.Sprintf("flate.NewWriter failed: %v", err))
+	}
+	if _, err := w.Write(page); err != nil {
+		panic(fmt.Sprintf("failed to encode swapped page: %v", err))
+	}
+	if err := w.Close(); err != nil {
+		panic(fmt.Sprintf("failed to encode swapped page: %v", err))
+	}
+	e.data = buf.Bytes()
+}
+
+// isZero returns true if bs contains only zeroes.
+func isZero(bs []byte) bool {
+	for _, b := range bs {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
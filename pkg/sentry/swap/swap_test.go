@@ -0,0 +1,123 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swap
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+func compressiblePage() []byte {
+	return bytes.Repeat([]byte("gVisor"), hostarch.PageSize/6+1)[:hostarch.PageSize]
+}
+
+func randomPage() []byte {
+	page := make([]byte, hostarch.PageSize)
+	rand.Read(page)
+	return page
+}
+
+func TestStoreLoad(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "swap")
+	if err != nil {
+		t.Fatalf("CreateTemp failed: %v", err)
+	}
+	p := NewPool(PoolOpts{
+		MaxCompressedBytes: 1 << 20,
+		File:               f,
+		MaxFileBytes:       1 << 20,
+	})
+	for _, test := range []struct {
+		name     string
+		page     []byte
+		wantFile bool
+	}{
+		{
+			name: "zero",
+			page: make([]byte, hostarch.PageSize),
+		},
+		{
+			name: "compressible",
+			page: compressiblePage(),
+		},
+		{
+			name:     "incompressible",
+			page:     randomPage(),
+			wantFile: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := p.Store(test.page)
+			if err != nil {
+				t.Fatalf("Store failed: %v", err)
+			}
+			if e.inFile != test.wantFile {
+				t.Errorf("Store: got inFile %t, want %t", e.inFile, test.wantFile)
+			}
+			got := randomPage()
+			if err := e.Load(got); err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if !bytes.Equal(got, test.page) {
+				t.Errorf("Load returned different contents than were stored")
+			}
+			e.DecRef()
+			if stats := p.Stats(); stats != (Stats{}) {
+				t.Errorf("Stats after DecRef: got %+v, want zero", stats)
+			}
+		})
+	}
+}
+
+func TestStoreFull(t *testing.T) {
+	p := NewPool(PoolOpts{MaxCompressedBytes: 1})
+	if _, err := p.Store(randomPage()); err != ErrFull {
+		t.Errorf("Store(incompressible) without file: got error %v, want %v", err, ErrFull)
+	}
+	if _, err := p.Store(compressiblePage()); err != ErrFull {
+		t.Errorf("Store(compressible) with full pool: got error %v, want %v", err, ErrFull)
+	}
+	// Zero pages don't require space.
+	e, err := p.Store(make([]byte, hostarch.PageSize))
+	if err != nil {
+		t.Fatalf("Store(zero) failed: %v", err)
+	}
+	e.DecRef()
+}
+
+func TestFileSlotReuse(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "swap")
+	if err != nil {
+		t.Fatalf("CreateTemp failed: %v", err)
+	}
+	p := NewPool(PoolOpts{File: f, MaxFileBytes: hostarch.PageSize})
+	e, err := p.Store(randomPage())
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if _, err := p.Store(randomPage()); err != ErrFull {
+		t.Errorf("Store with full file: got error %v, want %v", err, ErrFull)
+	}
+	e.DecRef()
+	e, err = p.Store(randomPage())
+	if err != nil {
+		t.Fatalf("Store after DecRef failed: %v", err)
+	}
+	e.DecRef()
+}
@@ -108,7 +108,7 @@ var AMD64 = &kernel.SyscallTable{
 		53:  syscalls.SupportedPoint("socketpair", SocketPair, PointSocketpair),
 		54:  syscalls.Supported("setsockopt", SetSockOpt),
 		55:  syscalls.Supported("getsockopt", GetSockOpt),
-		56:  syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_PARENT, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, and CLONE_SYSVSEM not supported.", nil),
+		56:  syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_PARENT, CLONE_CLEAR_SIGHAND, and CLONE_SYSVSEM not supported.", nil),
 		57:  syscalls.SupportedPoint("fork", Fork, PointFork),
 		58:  syscalls.SupportedPoint("vfork", Vfork, PointVfork),
 		59:  syscalls.SupportedPoint("execve", Execve, PointExecve),
@@ -211,7 +211,7 @@ var AMD64 = &kernel.SyscallTable{
 		156: syscalls.Error("sysctl", linuxerr.EPERM, "Deprecated. Use /proc/sys instead.", nil),
 		157: syscalls.PartiallySupported("prctl", Prctl, "Not all options are supported.", nil),
 		158: syscalls.PartiallySupported("arch_prctl", ArchPrctl, "Options ARCH_GET_GS, ARCH_SET_GS not supported.", nil),
-		159: syscalls.CapError("adjtimex", linux.CAP_SYS_TIME, "", nil),
+		159: syscalls.PartiallySupported("adjtimex", Adjtimex, "Only reading the clock state is supported.", nil),
 		160: syscalls.PartiallySupported("setrlimit", Setrlimit, "Not all rlimits are enforced.", nil),
 		161: syscalls.SupportedPoint("chroot", Chroot, PointChroot),
 		162: syscalls.Supported("sync", Sync),
@@ -231,7 +231,7 @@ var AMD64 = &kernel.SyscallTable{
 		176: syscalls.CapError("delete_module", linux.CAP_SYS_MODULE, "", nil),
 		177: syscalls.Error("get_kernel_syms", linuxerr.ENOSYS, "Not supported in Linux > 2.6.", nil),
 		178: syscalls.Error("query_module", linuxerr.ENOSYS, "Not supported in Linux > 2.6.", nil),
-		179: syscalls.CapError("quotactl", linux.CAP_SYS_ADMIN, "", nil), // requires cap_sys_admin for most operations
+		179: syscalls.PartiallySupported("quotactl", Quotactl, "Only supported on tmpfs mounted with quota options, and overlay mounts whose upper layer is such a tmpfs. special may name any file on the filesystem. XFS quota commands are not supported.", nil),
 		180: syscalls.Error("nfsservctl", linuxerr.ENOSYS, "Removed after Linux 3.1.", nil),
 		181: syscalls.Error("getpmsg", linuxerr.ENOSYS, "Not implemented in Linux.", nil),
 		182: syscalls.Error("putpmsg", linuxerr.ENOSYS, "Not implemented in Linux.", nil),
@@ -254,7 +254,7 @@ var AMD64 = &kernel.SyscallTable{
 		199: syscalls.Supported("fremovexattr", Fremovexattr),
 		200: syscalls.Supported("tkill", Tkill),
 		201: syscalls.Supported("time", Time),
-		202: syscalls.PartiallySupported("futex", Futex, "Robust futexes not supported.", nil),
+		202: syscalls.PartiallySupported("futex", Futex, "FUTEX_FD is not supported. PI futexes held by an exiting task are only recovered if they are on its robust list.", nil),
 		203: syscalls.PartiallySupported("sched_setaffinity", SchedSetaffinity, "Stub implementation.", nil),
 		204: syscalls.PartiallySupported("sched_getaffinity", SchedGetaffinity, "Stub implementation.", nil),
 		205: syscalls.Error("set_thread_area", linuxerr.ENOSYS, "Expected to return ENOSYS on 64-bit", nil),
@@ -289,9 +289,9 @@ var AMD64 = &kernel.SyscallTable{
 		234: syscalls.Supported("tgkill", Tgkill),
 		235: syscalls.Supported("utimes", Utimes),
 		236: syscalls.Error("vserver", linuxerr.ENOSYS, "Not implemented by Linux", nil),
-		237: syscalls.PartiallySupported("mbind", Mbind, "Stub implementation. Only a single NUMA node is advertised, and mempolicy is ignored accordingly, but mbind() will succeed and has effects reflected by get_mempolicy.", []string{"gvisor.dev/issue/262"}),
-		238: syscalls.PartiallySupported("set_mempolicy", SetMempolicy, "Stub implementation.", nil),
-		239: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "Stub implementation.", nil),
+		237: syscalls.PartiallySupported("mbind", Mbind, "NUMA nodes are those configured with --numa-nodes. Memory is not placed on host NUMA nodes; placement reported by get_mempolicy and move_pages follows the NUMA policy.", []string{"gvisor.dev/issue/262"}),
+		238: syscalls.PartiallySupported("set_mempolicy", SetMempolicy, "NUMA nodes are those configured with --numa-nodes. Memory is not placed on host NUMA nodes; placement reported by get_mempolicy and move_pages follows the NUMA policy.", nil),
+		239: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "NUMA nodes are those configured with --numa-nodes. Memory is not placed on host NUMA nodes; placement reported by get_mempolicy and move_pages follows the NUMA policy.", nil),
 		240: syscalls.Supported("mq_open", MqOpen),
 		241: syscalls.Supported("mq_unlink", MqUnlink),
 		242: syscalls.ErrorWithEvent("mq_timedsend", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),    // TODO(b/29354921)
@@ -331,7 +331,7 @@ var AMD64 = &kernel.SyscallTable{
 		276: syscalls.Supported("tee", Tee),
 		277: syscalls.Supported("sync_file_range", SyncFileRange),
 		278: syscalls.ErrorWithEvent("vmsplice", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/138"}), // TODO(b/29354098)
-		279: syscalls.CapError("move_pages", linux.CAP_SYS_NICE, "", nil),                               // requires cap_sys_nice (mostly)
+		279: syscalls.PartiallySupported("move_pages", MovePages, "NUMA nodes are those configured with --numa-nodes. Memory is not placed on host NUMA nodes; placement reported by get_mempolicy and move_pages follows the NUMA policy.", nil),
 		280: syscalls.Supported("utimensat", Utimensat),
 		281: syscalls.Supported("epoll_pwait", EpollPwait),
 		282: syscalls.SupportedPoint("signalfd", Signalfd, PointSignalfd),
@@ -357,7 +357,7 @@ var AMD64 = &kernel.SyscallTable{
 		302: syscalls.SupportedPoint("prlimit64", Prlimit64, PointPrlimit64),
 		303: syscalls.Error("name_to_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
 		304: syscalls.Error("open_by_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
-		305: syscalls.CapError("clock_adjtime", linux.CAP_SYS_TIME, "", nil),
+		305: syscalls.PartiallySupported("clock_adjtime", ClockAdjtime, "Only reading the clock state is supported.", nil),
 		306: syscalls.Supported("syncfs", Syncfs),
 		307: syscalls.Supported("sendmmsg", SendMMsg),
 		308: syscalls.Supported("setns", Setns),
@@ -373,7 +373,7 @@ var AMD64 = &kernel.SyscallTable{
 		318: syscalls.Supported("getrandom", GetRandom),
 		319: syscalls.Supported("memfd_create", MemfdCreate),
 		320: syscalls.CapError("kexec_file_load", linux.CAP_SYS_BOOT, "", nil),
-		321: syscalls.CapError("bpf", linux.CAP_SYS_ADMIN, "", nil),
+		321: syscalls.PartiallySupported("bpf", Bpf, "Only BPF_MAP_TYPE_HASH/ARRAY maps and BPF_PROG_TYPE_SOCKET_FILTER/CGROUP_SKB programs are supported. CGROUP_SKB programs can only be attached to BPF_CGROUP_INET_INGRESS/EGRESS.", nil),
 		322: syscalls.SupportedPoint("execveat", Execveat, PointExecveat),
 		323: syscalls.ErrorWithEvent("userfaultfd", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/266"}), // TODO(b/118906345)
 		324: syscalls.PartiallySupported("membarrier", Membarrier, "Not supported on all platforms.", nil),
@@ -395,18 +395,24 @@ var AMD64 = &kernel.SyscallTable{
 		424: syscalls.ErrorWithEvent("pidfd_send_signal", linuxerr.ENOSYS, "", nil),
 		425: syscalls.PartiallySupported("io_uring_setup", IOUringSetup, "Not all flags and functionality supported.", nil),
 		426: syscalls.PartiallySupported("io_uring_enter", IOUringEnter, "Not all flags and functionality supported.", nil),
-		427: syscalls.ErrorWithEvent("io_uring_register", linuxerr.ENOSYS, "", nil),
-		428: syscalls.ErrorWithEvent("open_tree", linuxerr.ENOSYS, "", nil),
-		429: syscalls.ErrorWithEvent("move_mount", linuxerr.ENOSYS, "", nil),
-		430: syscalls.ErrorWithEvent("fsopen", linuxerr.ENOSYS, "", nil),
-		431: syscalls.ErrorWithEvent("fsconfig", linuxerr.ENOSYS, "", nil),
-		432: syscalls.ErrorWithEvent("fsmount", linuxerr.ENOSYS, "", nil),
+		427: syscalls.PartiallySupported("io_uring_register", IOUringRegister, "Only IORING_REGISTER_RING_FDS and IORING_UNREGISTER_RING_FDS are supported.", nil),
+		428: syscalls.PartiallySupported("open_tree", OpenTree, "Clones are not in the peer group of the source mount.", nil),
+		429: syscalls.PartiallySupported("move_mount", MoveMount, "Only detached mounts created by fsmount(2) and open_tree(2) can be moved. MOVE_MOUNT_SET_GROUP and MOVE_MOUNT_BENEATH are not supported.", nil),
+		430: syscalls.Supported("fsopen", Fsopen),
+		431: syscalls.PartiallySupported("fsconfig", Fsconfig, "Binary, path and file descriptor parameters and FSCONFIG_CMD_RECONFIGURE are not supported.", nil),
+		432: syscalls.PartiallySupported("fsmount", Fsmount, "MOUNT_ATTR_IDMAP and MOUNT_ATTR_NOSYMFOLLOW are not supported.", nil),
 		433: syscalls.ErrorWithEvent("fspick", linuxerr.ENOSYS, "", nil),
 		434: syscalls.ErrorWithEvent("pidfd_open", linuxerr.ENOSYS, "", nil),
-		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT, CLONE_SYSVSEM and, SetTid are not supported.", nil),
+		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_CLEAR_SIGHAND, CLONE_PARENT, CLONE_SYSVSEM and, SetTid are not supported.", nil),
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
+		443: syscalls.PartiallySupported("quotactl_fd", QuotactlFd, "Only supported on tmpfs mounted with quota options, and overlay mounts whose upper layer is such a tmpfs. XFS quota commands are not supported.", nil),
+		447: syscalls.PartiallySupported("memfd_secret", MemfdSecret, "Requires --memfd-secret. Secret memory is accessible to the sentry on platforms that own page tables, such as KVM.", nil),
+		449: syscalls.PartiallySupported("futex_waitv", FutexWaitv, "Only 32-bit futexes are supported.", nil),
+		454: syscalls.PartiallySupported("futex_wake", FutexWake, "Only 32-bit futexes are supported.", nil),
+		455: syscalls.PartiallySupported("futex_wait", FutexWait, "Only 32-bit futexes are supported.", nil),
+		456: syscalls.PartiallySupported("futex_requeue", FutexRequeue, "Only 32-bit futexes are supported.", nil),
 	},
 	Emulate: map[hostarch.Addr]uintptr{
 		0xffffffffff600000: 96,  // vsyscall gettimeofday(2)
@@ -491,7 +497,7 @@ var ARM64 = &kernel.SyscallTable{
 		57:  syscalls.SupportedPoint("close", Close, PointClose),
 		58:  syscalls.CapError("vhangup", linux.CAP_SYS_TTY_CONFIG, "", nil),
 		59:  syscalls.SupportedPoint("pipe2", Pipe2, PointPipe2),
-		60:  syscalls.CapError("quotactl", linux.CAP_SYS_ADMIN, "", nil), // requires cap_sys_admin for most operations
+		60:  syscalls.PartiallySupported("quotactl", Quotactl, "Only supported on tmpfs mounted with quota options, and overlay mounts whose upper layer is such a tmpfs. special may name any file on the filesystem. XFS quota commands are not supported.", nil),
 		61:  syscalls.Supported("getdents64", Getdents64),
 		62:  syscalls.Supported("lseek", Lseek),
 		63:  syscalls.SupportedPoint("read", Read, PointRead),
@@ -529,7 +535,7 @@ var ARM64 = &kernel.SyscallTable{
 		95:  syscalls.Supported("waitid", Waitid),
 		96:  syscalls.Supported("set_tid_address", SetTidAddress),
 		97:  syscalls.PartiallySupported("unshare", Unshare, "Mount, cgroup namespaces not supported. Network namespaces supported but must be empty.", nil),
-		98:  syscalls.PartiallySupported("futex", Futex, "Robust futexes not supported.", nil),
+		98:  syscalls.PartiallySupported("futex", Futex, "FUTEX_FD is not supported. PI futexes held by an exiting task are only recovered if they are on its robust list.", nil),
 		99:  syscalls.Supported("set_robust_list", SetRobustList),
 		100: syscalls.Supported("get_robust_list", GetRobustList),
 		101: syscalls.Supported("nanosleep", Nanosleep),
@@ -602,7 +608,7 @@ var ARM64 = &kernel.SyscallTable{
 		168: syscalls.Supported("getcpu", Getcpu),
 		169: syscalls.Supported("gettimeofday", Gettimeofday),
 		170: syscalls.CapError("settimeofday", linux.CAP_SYS_TIME, "", nil),
-		171: syscalls.CapError("adjtimex", linux.CAP_SYS_TIME, "", nil),
+		171: syscalls.PartiallySupported("adjtimex", Adjtimex, "Only reading the clock state is supported.", nil),
 		172: syscalls.Supported("getpid", Getpid),
 		173: syscalls.Supported("getppid", Getppid),
 		174: syscalls.Supported("getuid", Getuid),
@@ -651,7 +657,7 @@ var ARM64 = &kernel.SyscallTable{
 		217: syscalls.Error("add_key", linuxerr.EACCES, "Not available to user.", nil),
 		218: syscalls.Error("request_key", linuxerr.EACCES, "Not available to user.", nil),
 		219: syscalls.PartiallySupported("keyctl", Keyctl, "Only supports session keyrings with zero keys in them.", nil),
-		220: syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_PARENT, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, and CLONE_SYSVSEM not supported.", nil),
+		220: syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_PARENT, CLONE_CLEAR_SIGHAND, and CLONE_SYSVSEM not supported.", nil),
 		221: syscalls.SupportedPoint("execve", Execve, PointExecve),
 		222: syscalls.Supported("mmap", Mmap),
 		223: syscalls.PartiallySupported("fadvise64", Fadvise64, "Not all options are supported.", nil),
@@ -666,11 +672,11 @@ var ARM64 = &kernel.SyscallTable{
 		232: syscalls.PartiallySupported("mincore", Mincore, "Stub implementation. The sandbox does not have access to this information. Reports all mapped pages are resident.", nil),
 		233: syscalls.PartiallySupported("madvise", Madvise, "Options MADV_DONTNEED, MADV_DONTFORK are supported. Other advice is ignored.", nil),
 		234: syscalls.ErrorWithEvent("remap_file_pages", linuxerr.ENOSYS, "Deprecated since Linux 3.16.", nil),
-		235: syscalls.PartiallySupported("mbind", Mbind, "Stub implementation. Only a single NUMA node is advertised, and mempolicy is ignored accordingly, but mbind() will succeed and has effects reflected by get_mempolicy.", []string{"gvisor.dev/issue/262"}),
-		236: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "Stub implementation.", nil),
-		237: syscalls.PartiallySupported("set_mempolicy", SetMempolicy, "Stub implementation.", nil),
+		235: syscalls.PartiallySupported("mbind", Mbind, "NUMA nodes are those configured with --numa-nodes. Memory is not placed on host NUMA nodes; placement reported by get_mempolicy and move_pages follows the NUMA policy.", []string{"gvisor.dev/issue/262"}),
+		236: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "NUMA nodes are those configured with --numa-nodes. Memory is not placed on host NUMA nodes; placement reported by get_mempolicy and move_pages follows the NUMA policy.", nil),
+		237: syscalls.PartiallySupported("set_mempolicy", SetMempolicy, "NUMA nodes are those configured with --numa-nodes. Memory is not placed on host NUMA nodes; placement reported by get_mempolicy and move_pages follows the NUMA policy.", nil),
 		238: syscalls.CapError("migrate_pages", linux.CAP_SYS_NICE, "", nil),
-		239: syscalls.CapError("move_pages", linux.CAP_SYS_NICE, "", nil), // requires cap_sys_nice (mostly)
+		239: syscalls.PartiallySupported("move_pages", MovePages, "NUMA nodes are those configured with --numa-nodes. Memory is not placed on host NUMA nodes; placement reported by get_mempolicy and move_pages follows the NUMA policy.", nil),
 		240: syscalls.Supported("rt_tgsigqueueinfo", RtTgsigqueueinfo),
 		241: syscalls.ErrorWithEvent("perf_event_open", linuxerr.ENODEV, "No support for perf counters", nil),
 		242: syscalls.SupportedPoint("accept4", Accept4, PointAccept4),
@@ -681,7 +687,7 @@ var ARM64 = &kernel.SyscallTable{
 		263: syscalls.ErrorWithEvent("fanotify_mark", linuxerr.ENOSYS, "Needs CONFIG_FANOTIFY", nil),
 		264: syscalls.Error("name_to_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
 		265: syscalls.Error("open_by_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
-		266: syscalls.CapError("clock_adjtime", linux.CAP_SYS_TIME, "", nil),
+		266: syscalls.PartiallySupported("clock_adjtime", ClockAdjtime, "Only reading the clock state is supported.", nil),
 		267: syscalls.Supported("syncfs", Syncfs),
 		268: syscalls.Supported("setns", Setns),
 		269: syscalls.Supported("sendmmsg", SendMMsg),
@@ -695,7 +701,7 @@ var ARM64 = &kernel.SyscallTable{
 		277: syscalls.Supported("seccomp", Seccomp),
 		278: syscalls.Supported("getrandom", GetRandom),
 		279: syscalls.Supported("memfd_create", MemfdCreate),
-		280: syscalls.CapError("bpf", linux.CAP_SYS_ADMIN, "", nil),
+		280: syscalls.PartiallySupported("bpf", Bpf, "Only BPF_MAP_TYPE_HASH/ARRAY maps and BPF_PROG_TYPE_SOCKET_FILTER/CGROUP_SKB programs are supported. CGROUP_SKB programs can only be attached to BPF_CGROUP_INET_INGRESS/EGRESS.", nil),
 		281: syscalls.SupportedPoint("execveat", Execveat, PointExecveat),
 		282: syscalls.ErrorWithEvent("userfaultfd", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/266"}), // TODO(b/118906345)
 		283: syscalls.PartiallySupported("membarrier", Membarrier, "Not supported on all platforms.", nil),
@@ -716,18 +722,24 @@ var ARM64 = &kernel.SyscallTable{
 		424: syscalls.ErrorWithEvent("pidfd_send_signal", linuxerr.ENOSYS, "", nil),
 		425: syscalls.PartiallySupported("io_uring_setup", IOUringSetup, "Not all flags and functionality supported.", nil),
 		426: syscalls.PartiallySupported("io_uring_enter", IOUringEnter, "Not all flags and functionality supported.", nil),
-		427: syscalls.ErrorWithEvent("io_uring_register", linuxerr.ENOSYS, "", nil),
-		428: syscalls.ErrorWithEvent("open_tree", linuxerr.ENOSYS, "", nil),
-		429: syscalls.ErrorWithEvent("move_mount", linuxerr.ENOSYS, "", nil),
-		430: syscalls.ErrorWithEvent("fsopen", linuxerr.ENOSYS, "", nil),
-		431: syscalls.ErrorWithEvent("fsconfig", linuxerr.ENOSYS, "", nil),
-		432: syscalls.ErrorWithEvent("fsmount", linuxerr.ENOSYS, "", nil),
+		427: syscalls.PartiallySupported("io_uring_register", IOUringRegister, "Only IORING_REGISTER_RING_FDS and IORING_UNREGISTER_RING_FDS are supported.", nil),
+		428: syscalls.PartiallySupported("open_tree", OpenTree, "Clones are not in the peer group of the source mount.", nil),
+		429: syscalls.PartiallySupported("move_mount", MoveMount, "Only detached mounts created by fsmount(2) and open_tree(2) can be moved. MOVE_MOUNT_SET_GROUP and MOVE_MOUNT_BENEATH are not supported.", nil),
+		430: syscalls.Supported("fsopen", Fsopen),
+		431: syscalls.PartiallySupported("fsconfig", Fsconfig, "Binary, path and file descriptor parameters and FSCONFIG_CMD_RECONFIGURE are not supported.", nil),
+		432: syscalls.PartiallySupported("fsmount", Fsmount, "MOUNT_ATTR_IDMAP and MOUNT_ATTR_NOSYMFOLLOW are not supported.", nil),
 		433: syscalls.ErrorWithEvent("fspick", linuxerr.ENOSYS, "", nil),
 		434: syscalls.ErrorWithEvent("pidfd_open", linuxerr.ENOSYS, "", nil),
-		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT, CLONE_SYSVSEM and clone_args.set_tid are not supported.", nil),
+		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_CLEAR_SIGHAND, CLONE_PARENT, CLONE_SYSVSEM and clone_args.set_tid are not supported.", nil),
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
+		443: syscalls.PartiallySupported("quotactl_fd", QuotactlFd, "Only supported on tmpfs mounted with quota options, and overlay mounts whose upper layer is such a tmpfs. XFS quota commands are not supported.", nil),
+		447: syscalls.PartiallySupported("memfd_secret", MemfdSecret, "Requires --memfd-secret. Secret memory is accessible to the sentry on platforms that own page tables, such as KVM.", nil),
+		449: syscalls.PartiallySupported("futex_waitv", FutexWaitv, "Only 32-bit futexes are supported.", nil),
+		454: syscalls.PartiallySupported("futex_wake", FutexWake, "Only 32-bit futexes are supported.", nil),
+		455: syscalls.PartiallySupported("futex_wait", FutexWait, "Only 32-bit futexes are supported.", nil),
+		456: syscalls.PartiallySupported("futex_requeue", FutexRequeue, "Only 32-bit futexes are supported.", nil),
 	},
 	Emulate: map[hostarch.Addr]uintptr{},
 	Missing: func(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
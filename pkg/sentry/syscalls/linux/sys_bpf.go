@@ -0,0 +1,513 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/ebpf"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/bpffd"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// Offsets of fields of union bpf_attr that bpf(2) writes back.
+const (
+	bpfQueryAttachFlagsOffset   = 12
+	bpfQueryProgCntOffset       = 24
+	bpfTestRunRetvalOffset      = 4
+	bpfTestRunDataSizeOutOffset = 12
+	bpfTestRunDurationOffset    = 36
+)
+
+// ethHeaderLen is the length of an Ethernet header, Linux's ETH_HLEN.
+const ethHeaderLen = 14
+
+// Bpf implements Linux syscall bpf(2).
+func Bpf(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	cmd := args[0].Int()
+	addr := args[1].Pointer()
+	size := args[2].Uint()
+
+	// Like Linux with kernel.unprivileged_bpf_disabled set, require
+	// CAP_BPF or CAP_SYS_ADMIN in the root user namespace.
+	root := t.Kernel().RootUserNamespace()
+	if !t.HasCapabilityIn(linux.CAP_BPF, root) && !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, root) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	switch cmd {
+	case linux.BPF_MAP_CREATE:
+		var attr linux.BPFMapCreateAttr
+		if err := copyInBPFAttr(t, addr, size, &attr); err != nil {
+			return 0, nil, err
+		}
+		return bpfMapCreate(t, &attr)
+	case linux.BPF_MAP_LOOKUP_ELEM, linux.BPF_MAP_UPDATE_ELEM, linux.BPF_MAP_DELETE_ELEM, linux.BPF_MAP_GET_NEXT_KEY:
+		var attr linux.BPFMapElemAttr
+		if err := copyInBPFAttr(t, addr, size, &attr); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, bpfMapElem(t, cmd, &attr)
+	case linux.BPF_PROG_LOAD:
+		var attr linux.BPFProgLoadAttr
+		if err := copyInBPFAttr(t, addr, size, &attr); err != nil {
+			return 0, nil, err
+		}
+		return bpfProgLoad(t, &attr)
+	case linux.BPF_PROG_ATTACH, linux.BPF_PROG_DETACH:
+		var attr linux.BPFProgAttachAttr
+		if err := copyInBPFAttr(t, addr, size, &attr); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, bpfProgAttach(t, cmd == linux.BPF_PROG_ATTACH, &attr)
+	case linux.BPF_PROG_QUERY:
+		var attr linux.BPFProgQueryAttr
+		if err := copyInBPFAttr(t, addr, size, &attr); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, bpfProgQuery(t, addr, &attr)
+	case linux.BPF_PROG_TEST_RUN:
+		var attr linux.BPFProgTestRunAttr
+		if err := copyInBPFAttr(t, addr, size, &attr); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, bpfProgTestRun(t, addr, &attr)
+	default:
+		t.Kernel().EmitUnimplementedEvent(t, sysno)
+		return 0, nil, linuxerr.EINVAL
+	}
+}
+
+// copyInBPFAttr copies in the first size bytes of the union bpf_attr at addr
+// into attr. Like Linux's bpf_check_uarg_tail_zero(), it accepts attributes
+// that are larger than attr if the extra bytes are zero.
+func copyInBPFAttr(t *kernel.Task, addr hostarch.Addr, size uint32, attr marshal.Marshallable) error {
+	if size > hostarch.PageSize {
+		return linuxerr.E2BIG
+	}
+	n := attr.SizeBytes()
+	buf := make([]byte, n)
+	if int(size) > n {
+		buf = make([]byte, size)
+	}
+	if _, err := t.CopyInBytes(addr, buf[:size]); err != nil {
+		return err
+	}
+	for _, b := range buf[n:] {
+		if b != 0 {
+			return linuxerr.E2BIG
+		}
+	}
+	attr.UnmarshalBytes(buf[:n])
+	return nil
+}
+
+// bpfObjName returns the map or program name in b, which must be
+// NUL-terminated and consist of alphanumeric characters, '_' and '.'.
+func bpfObjName(b []byte) (string, error) {
+	for i, c := range b {
+		switch {
+		case c == 0:
+			return string(b[:i]), nil
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.':
+		default:
+			return "", linuxerr.EINVAL
+		}
+	}
+	return "", linuxerr.EINVAL
+}
+
+func bpfMapCreate(t *kernel.Task, attr *linux.BPFMapCreateAttr) (uintptr, *kernel.SyscallControl, error) {
+	name, err := bpfObjName(attr.MapName[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	if attr.InnerMapFD != 0 || attr.MapIfindex != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	m, err := ebpf.NewMap(ebpf.MapSpec{
+		Type:       attr.MapType,
+		KeySize:    attr.KeySize,
+		ValueSize:  attr.ValueSize,
+		MaxEntries: attr.MaxEntries,
+		Flags:      attr.MapFlags,
+		Name:       name,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	// BPF_F_RDONLY and BPF_F_WRONLY restrict access through the file
+	// descriptor, but not by programs.
+	flags := uint32(linux.O_RDWR)
+	if attr.MapFlags&linux.BPF_F_RDONLY != 0 {
+		flags = linux.O_RDONLY
+	} else if attr.MapFlags&linux.BPF_F_WRONLY != 0 {
+		flags = linux.O_WRONLY
+	}
+	file, err := bpffd.NewMap(t, t.Kernel().VFS(), m, flags)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+	fd, err := t.NewFDFrom(0, file, kernel.FDFlags{CloseOnExec: true})
+	if err != nil {
+		return 0, nil, err
+	}
+	return uintptr(fd), nil, nil
+}
+
+// getBPFMap returns the map and file description for fd. The caller must
+// release the file description.
+func getBPFMap(t *kernel.Task, fd int32) (ebpf.Map, *vfs.FileDescription, error) {
+	file := t.GetFile(fd)
+	if file == nil {
+		return nil, nil, linuxerr.EBADF
+	}
+	m := bpffd.MapFromFD(file)
+	if m == nil {
+		file.DecRef(t)
+		return nil, nil, linuxerr.EINVAL
+	}
+	return m, file, nil
+}
+
+// getBPFProgram returns the program for fd.
+func getBPFProgram(t *kernel.Task, fd int32) (*ebpf.Program, error) {
+	file := t.GetFile(fd)
+	if file == nil {
+		return nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	p := bpffd.ProgramFromFD(file)
+	if p == nil {
+		return nil, linuxerr.EINVAL
+	}
+	return p, nil
+}
+
+func bpfMapElem(t *kernel.Task, cmd int32, attr *linux.BPFMapElemAttr) error {
+	m, file, err := getBPFMap(t, int32(attr.MapFD))
+	if err != nil {
+		return err
+	}
+	defer file.DecRef(t)
+	spec := m.Spec()
+
+	var key []byte
+	if cmd != linux.BPF_MAP_GET_NEXT_KEY || attr.Key != 0 {
+		key = make([]byte, spec.KeySize)
+		if _, err := t.CopyInBytes(hostarch.Addr(attr.Key), key); err != nil {
+			return err
+		}
+	}
+
+	switch cmd {
+	case linux.BPF_MAP_LOOKUP_ELEM:
+		if !file.IsReadable() {
+			return linuxerr.EPERM
+		}
+		if attr.Flags != 0 {
+			return linuxerr.EINVAL
+		}
+		v := m.Lookup(key)
+		if v == nil {
+			return linuxerr.ENOENT
+		}
+		_, err := t.CopyOutBytes(hostarch.Addr(attr.Value), v)
+		return err
+	case linux.BPF_MAP_UPDATE_ELEM:
+		if !file.IsWritable() {
+			return linuxerr.EPERM
+		}
+		value := make([]byte, spec.ValueSize)
+		if _, err := t.CopyInBytes(hostarch.Addr(attr.Value), value); err != nil {
+			return err
+		}
+		return m.Update(key, value, attr.Flags)
+	case linux.BPF_MAP_DELETE_ELEM:
+		if !file.IsWritable() {
+			return linuxerr.EPERM
+		}
+		return m.Delete(key)
+	default: // linux.BPF_MAP_GET_NEXT_KEY
+		if !file.IsReadable() {
+			return linuxerr.EPERM
+		}
+		next, err := m.NextKey(key)
+		if err != nil {
+			return err
+		}
+		_, err = t.CopyOutBytes(hostarch.Addr(attr.Value), next)
+		return err
+	}
+}
+
+func bpfProgLoad(t *kernel.Task, attr *linux.BPFProgLoadAttr) (uintptr, *kernel.SyscallControl, error) {
+	if attr.InsnCnt == 0 || attr.InsnCnt > ebpf.MaxInstructions {
+		return 0, nil, linuxerr.E2BIG
+	}
+	if attr.ProgFlags != 0 || attr.ProgIfindex != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if !ebpf.SupportedProgramType(attr.ProgType) {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if attr.ProgType == linux.BPF_PROG_TYPE_CGROUP_SKB {
+		switch attr.ExpectedAttachType {
+		case linux.BPF_CGROUP_INET_INGRESS, linux.BPF_CGROUP_INET_EGRESS:
+		default:
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+	// As in Linux's kernel/bpf/verifier.c:bpf_vlog_init(), the log must be
+	// either fully specified or not at all.
+	logged := attr.LogLevel != 0 || attr.LogBuf != 0 || attr.LogSize != 0
+	if logged && (attr.LogLevel == 0 || attr.LogBuf == 0 || attr.LogSize < 128) {
+		return 0, nil, linuxerr.EINVAL
+	}
+	name, err := bpfObjName(attr.ProgName[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	insns := make([]linux.EBPFInstruction, attr.InsnCnt)
+	if _, err := linux.CopyEBPFInstructionSliceIn(t, hostarch.Addr(attr.Insns), insns); err != nil {
+		return 0, nil, err
+	}
+
+	p, err := ebpf.Load(ebpf.ProgramSpec{
+		Type:         attr.ProgType,
+		Name:         name,
+		ID:           t.Kernel().NewBPFProgramID(),
+		Instructions: insns,
+	}, func(fd int32) (ebpf.Map, error) {
+		m, file, err := getBPFMap(t, fd)
+		if err != nil {
+			return nil, err
+		}
+		file.DecRef(t)
+		return m, nil
+	})
+	if err != nil {
+		verr, ok := err.(ebpf.Error)
+		if !ok {
+			return 0, nil, err
+		}
+		if logged {
+			msg := []byte(verr.Error() + "\n")
+			if len(msg) >= int(attr.LogSize) {
+				msg = msg[:attr.LogSize-1]
+			}
+			msg = append(msg, 0)
+			if _, err := t.CopyOutBytes(hostarch.Addr(attr.LogBuf), msg); err != nil {
+				return 0, nil, err
+			}
+		}
+		if verr.Code == ebpf.UninitializedRegister {
+			return 0, nil, linuxerr.EACCES
+		}
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	file, err := bpffd.NewProgram(t, t.Kernel().VFS(), p, linux.O_RDWR)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+	fd, err := t.NewFDFrom(0, file, kernel.FDFlags{CloseOnExec: true})
+	if err != nil {
+		return 0, nil, err
+	}
+	return uintptr(fd), nil, nil
+}
+
+// getCgroup returns the cgroup for a cgroupfs directory file descriptor.
+func getCgroup(t *kernel.Task, fd int32) (kernel.Cgroup, error) {
+	file := t.GetFile(fd)
+	if file == nil {
+		return kernel.Cgroup{}, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	d, ok := file.Dentry().Impl().(*kernfs.Dentry)
+	if !ok {
+		return kernel.Cgroup{}, linuxerr.EBADF
+	}
+	cg, ok := d.Inode().(kernel.CgroupImpl)
+	if !ok {
+		return kernel.Cgroup{}, linuxerr.EBADF
+	}
+	return kernel.Cgroup{Dentry: d, CgroupImpl: cg}, nil
+}
+
+func bpfProgAttach(t *kernel.Task, attach bool, attr *linux.BPFProgAttachAttr) error {
+	switch attr.AttachType {
+	case linux.BPF_CGROUP_INET_INGRESS, linux.BPF_CGROUP_INET_EGRESS:
+	default:
+		return linuxerr.EINVAL
+	}
+	cg, err := getCgroup(t, int32(attr.TargetFD))
+	if err != nil {
+		return err
+	}
+
+	if !attach {
+		// Like Linux, ignore an invalid program when detaching.
+		p, err := getBPFProgram(t, int32(attr.AttachBPFFD))
+		if err != nil || p.Type() != linux.BPF_PROG_TYPE_CGROUP_SKB {
+			p = nil
+		}
+		return t.Kernel().DetachCgroupBPF(cg, attr.AttachType, p)
+	}
+
+	p, err := getBPFProgram(t, int32(attr.AttachBPFFD))
+	if err != nil {
+		return err
+	}
+	if p.Type() != linux.BPF_PROG_TYPE_CGROUP_SKB {
+		return linuxerr.EINVAL
+	}
+	var replace *ebpf.Program
+	if attr.AttachFlags&linux.BPF_F_REPLACE != 0 {
+		replace, err = getBPFProgram(t, int32(attr.ReplaceBPFFD))
+		if err != nil {
+			return err
+		}
+	}
+	return t.Kernel().AttachCgroupBPF(cg, attr.AttachType, p, replace, attr.AttachFlags)
+}
+
+func bpfProgQuery(t *kernel.Task, addr hostarch.Addr, attr *linux.BPFProgQueryAttr) error {
+	if attr.QueryFlags&^linux.BPF_F_QUERY_EFFECTIVE != 0 {
+		return linuxerr.EINVAL
+	}
+	switch attr.AttachType {
+	case linux.BPF_CGROUP_INET_INGRESS, linux.BPF_CGROUP_INET_EGRESS:
+	default:
+		return linuxerr.EINVAL
+	}
+	cg, err := getCgroup(t, int32(attr.TargetFD))
+	if err != nil {
+		return err
+	}
+
+	var (
+		progs []*ebpf.Program
+		flags uint32
+	)
+	if attr.QueryFlags&linux.BPF_F_QUERY_EFFECTIVE != 0 {
+		progs = t.Kernel().EffectiveCgroupBPFPrograms([][]uint32{kernel.CgroupIDChain(cg)}, attr.AttachType)
+	} else {
+		progs, flags = t.Kernel().CgroupBPFPrograms(cg, attr.AttachType)
+	}
+	if _, err := primitive.CopyUint32Out(t, addr+bpfQueryAttachFlagsOffset, flags); err != nil {
+		return err
+	}
+	if _, err := primitive.CopyUint32Out(t, addr+bpfQueryProgCntOffset, uint32(len(progs))); err != nil {
+		return err
+	}
+	if attr.ProgIDs == 0 || attr.ProgCnt == 0 || len(progs) == 0 {
+		return nil
+	}
+	n := len(progs)
+	if int(attr.ProgCnt) < n {
+		n = int(attr.ProgCnt)
+	}
+	ids := make([]uint32, n)
+	for i := range ids {
+		ids[i] = progs[i].ID()
+	}
+	if _, err := primitive.CopyUint32SliceOut(t, hostarch.Addr(attr.ProgIDs), ids); err != nil {
+		return err
+	}
+	if n < len(progs) {
+		return linuxerr.ENOSPC
+	}
+	return nil
+}
+
+func bpfProgTestRun(t *kernel.Task, addr hostarch.Addr, attr *linux.BPFProgTestRunAttr) error {
+	p, err := getBPFProgram(t, int32(attr.ProgFD))
+	if err != nil {
+		return err
+	}
+	if attr.CtxSizeIn != 0 || attr.CtxIn != 0 || attr.CtxSizeOut != 0 || attr.CtxOut != 0 {
+		return linuxerr.EINVAL
+	}
+	// As in Linux's net/bpf/test_run.c:bpf_prog_test_run_skb(), the input is
+	// an Ethernet frame, and the program sees the packet starting at the
+	// network header.
+	if attr.DataSizeIn < ethHeaderLen || attr.DataSizeIn > hostarch.PageSize {
+		return linuxerr.EINVAL
+	}
+	data := make([]byte, attr.DataSizeIn)
+	if _, err := t.CopyInBytes(hostarch.Addr(attr.DataIn), data); err != nil {
+		return err
+	}
+	repeat := attr.Repeat
+	if repeat == 0 {
+		repeat = 1
+	}
+
+	env := t.Kernel().BPFEnv()
+	start := env.MonotonicNanoseconds()
+	var retval uint64
+	for i := uint32(0); i < repeat; i++ {
+		if i%1024 == 1023 && t.Interrupted() {
+			return linuxerr.EINTR
+		}
+		skb := ebpf.SKB{
+			Data:     data[ethHeaderLen:],
+			Protocol: hostarch.ByteOrder.Uint16(data[12:ethHeaderLen]),
+			PktType:  linux.PACKET_HOST,
+		}
+		retval, err = ebpf.Exec(p, &skb, env)
+		if err != nil {
+			// The program did something that Linux's verifier would have
+			// rejected; treat it as dropping the packet.
+			retval = 0
+		}
+	}
+	duration := uint32((env.MonotonicNanoseconds() - start) / int64(repeat))
+
+	if _, err := primitive.CopyUint32Out(t, addr+bpfTestRunRetvalOffset, uint32(retval)); err != nil {
+		return err
+	}
+	if _, err := primitive.CopyUint32Out(t, addr+bpfTestRunDurationOffset, duration); err != nil {
+		return err
+	}
+	if attr.DataOut == 0 {
+		return nil
+	}
+	// Programs can't modify the packet, so the output is the input.
+	out := data
+	if attr.DataSizeOut != 0 && uint32(len(out)) > attr.DataSizeOut {
+		out = out[:attr.DataSizeOut]
+	}
+	if _, err := t.CopyOutBytes(hostarch.Addr(attr.DataOut), out); err != nil {
+		return err
+	}
+	if _, err := primitive.CopyUint32Out(t, addr+bpfTestRunDataSizeOutOffset, uint32(len(data))); err != nil {
+		return err
+	}
+	if len(out) < len(data) {
+		return linuxerr.ENOSPC
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/lock"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/secretmem"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
@@ -1664,7 +1665,7 @@ func Flock(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 const (
 	memfdPrefix     = "memfd:"
 	memfdMaxNameLen = linux.NAME_MAX - len(memfdPrefix)
-	memfdAllFlags   = uint32(linux.MFD_CLOEXEC | linux.MFD_ALLOW_SEALING)
+	memfdAllFlags   = uint32(linux.MFD_CLOEXEC | linux.MFD_ALLOW_SEALING | linux.MFD_NOEXEC_SEAL | linux.MFD_EXEC)
 )
 
 // MemfdCreate implements the linux syscall memfd_create(2).
@@ -1677,7 +1678,12 @@ func MemfdCreate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 		return 0, nil, linuxerr.EINVAL
 	}
 
+	if flags&linux.MFD_EXEC != 0 && flags&linux.MFD_NOEXEC_SEAL != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+
 	allowSeals := flags&linux.MFD_ALLOW_SEALING != 0
+	noExecSeal := flags&linux.MFD_NOEXEC_SEAL != 0
 	cloExec := flags&linux.MFD_CLOEXEC != 0
 
 	name, err := t.CopyInString(addr, memfdMaxNameLen)
@@ -1686,7 +1692,7 @@ func MemfdCreate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	}
 
 	shmMount := t.Kernel().ShmMount()
-	file, err := tmpfs.NewMemfd(t, t.Credentials(), shmMount, allowSeals, memfdPrefix+name)
+	file, err := tmpfs.NewMemfd(t, t.Credentials(), shmMount, allowSeals, noExecSeal, memfdPrefix+name)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -1701,3 +1707,32 @@ func MemfdCreate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 
 	return uintptr(fd), nil, nil
 }
+
+// MemfdSecret implements the linux syscall memfd_secret(2).
+func MemfdSecret(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	flags := args[0].Uint()
+
+	k := t.Kernel()
+	if !k.MemfdSecret {
+		// As if secretmem is disabled.
+		return 0, nil, linuxerr.ENOSYS
+	}
+	if flags&^linux.O_CLOEXEC != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	file, err := secretmem.New(t, k.VFS(), k.Platform.OwnsPageTables(), 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	fd, err := t.NewFDFrom(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.O_CLOEXEC != 0,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return uintptr(fd), nil, nil
+}
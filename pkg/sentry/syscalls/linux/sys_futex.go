@@ -22,6 +22,7 @@ import (
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/futex"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 )
 
@@ -58,23 +59,29 @@ func futexWaitAbsolute(t *kernel.Task, clockRealtime bool, ts linux.Timespec, fo
 		return 0, err
 	}
 
+	err = futexBlockAbsolute(t, w.C, clockRealtime, ts, forever)
+	t.Futex().WaitComplete(w, t)
+	return 0, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+}
+
+// futexBlockAbsolute blocks until C receives a wakeup, forever if forever is
+// true and otherwise until ts on CLOCK_REALTIME or CLOCK_MONOTONIC.
+func futexBlockAbsolute(t *kernel.Task, C <-chan struct{}, clockRealtime bool, ts linux.Timespec, forever bool) error {
 	if forever {
-		err = t.Block(w.C)
-	} else if clockRealtime {
+		return t.Block(C)
+	}
+	if clockRealtime {
 		notifier, tchan := ktime.NewChannelNotifier()
 		timer := ktime.NewTimer(t.Kernel().RealtimeClock(), notifier)
 		timer.Swap(ktime.Setting{
 			Enabled: true,
 			Next:    ktime.FromTimespec(ts),
 		})
-		err = t.BlockWithTimer(w.C, tchan)
+		err := t.BlockWithTimer(C, tchan)
 		timer.Destroy()
-	} else {
-		err = t.BlockWithDeadline(w.C, true, ktime.FromTimespec(ts))
+		return err
 	}
-
-	t.Futex().WaitComplete(w, t)
-	return 0, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+	return t.BlockWithDeadline(C, true, ktime.FromTimespec(ts))
 }
 
 // futexWaitDuration performs a FUTEX_WAIT, blocking until the wait is
@@ -124,7 +131,7 @@ func futexWaitDuration(t *kernel.Task, duration time.Duration, forever bool, add
 	return 0, linuxerr.ERESTART_RESTARTBLOCK
 }
 
-func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr hostarch.Addr, private bool) error {
+func futexLockPI(t *kernel.Task, clockRealtime bool, ts linux.Timespec, forever bool, addr hostarch.Addr, private bool) error {
 	w := t.FutexWaiter()
 	locked, err := t.Futex().LockPI(w, t, addr, uint32(t.ThreadID()), private, false)
 	if err != nil {
@@ -135,23 +142,38 @@ func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr hostarch.
 		return nil
 	}
 
-	if forever {
-		err = t.Block(w.C)
-	} else {
-		notifier, tchan := ktime.NewChannelNotifier()
-		timer := ktime.NewTimer(t.Kernel().RealtimeClock(), notifier)
-		timer.Swap(ktime.Setting{
-			Enabled: true,
-			Next:    ktime.FromTimespec(ts),
-		})
-		err = t.BlockWithTimer(w.C, tchan)
-		timer.Destroy()
-	}
-
+	err = futexBlockAbsolute(t, w.C, clockRealtime, ts, forever)
 	t.Futex().WaitComplete(w, t)
 	return linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
 }
 
+// futexWaitRequeuePI performs a FUTEX_WAIT_REQUEUE_PI, blocking until the
+// calling task is given the PI futex at naddr, or the wait fails.
+func futexWaitRequeuePI(t *kernel.Task, clockRealtime bool, ts linux.Timespec, forever bool, addr, naddr hostarch.Addr, private bool, val uint32) error {
+	w := t.FutexWaiter()
+	if err := t.Futex().WaitRequeuePIPrepare(w, t, addr, naddr, private, val, uint32(t.ThreadID())); err != nil {
+		return err
+	}
+
+	err := futexBlockAbsolute(t, w.C, clockRealtime, ts, forever)
+	requeued, acquired := t.Futex().WaitRequeuePIComplete(w, t)
+	switch {
+	case acquired:
+		return nil
+	case err == nil:
+		// Woken by a wakeup on addr rather than by FUTEX_CMP_REQUEUE_PI.
+		return linuxerr.EWOULDBLOCK
+	case err == linuxerr.ErrInterrupted && requeued:
+		// As in Linux, don't restart once requeued: the restarted wait would
+		// find that addr has changed anyway.
+		return linuxerr.EWOULDBLOCK
+	case err == linuxerr.ErrInterrupted:
+		return linuxerr.ERESTARTNOINTR
+	default:
+		return err
+	}
+}
+
 func tryLockPI(t *kernel.Task, addr hostarch.Addr, private bool) error {
 	w := t.FutexWaiter()
 	locked, err := t.Futex().LockPI(w, t, addr, uint32(t.ThreadID()), private, true)
@@ -255,7 +277,7 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		n, err := t.Futex().WakeOp(t, addr, naddr, private, val, nreq, op)
 		return uintptr(n), nil, err
 
-	case linux.FUTEX_LOCK_PI:
+	case linux.FUTEX_LOCK_PI, linux.FUTEX_LOCK_PI2:
 		forever := (timeout == 0)
 
 		var timespec linux.Timespec
@@ -266,7 +288,13 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 				return 0, nil, err
 			}
 		}
-		err := futexLockPI(t, timespec, forever, addr, private)
+		// LOCK_PI always measures its absolute timeout with CLOCK_REALTIME,
+		// while LOCK_PI2 uses CLOCK_MONOTONIC unless FUTEX_CLOCK_REALTIME is
+		// set.
+		if cmd == linux.FUTEX_LOCK_PI {
+			clockRealtime = true
+		}
+		err := futexLockPI(t, clockRealtime, timespec, forever, addr, private)
 		return 0, nil, err
 
 	case linux.FUTEX_TRYLOCK_PI:
@@ -277,9 +305,30 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		err := t.Futex().UnlockPI(t, addr, uint32(t.ThreadID()), private)
 		return 0, nil, err
 
-	case linux.FUTEX_WAIT_REQUEUE_PI, linux.FUTEX_CMP_REQUEUE_PI:
-		t.Kernel().EmitUnimplementedEvent(t, sysno)
-		return 0, nil, linuxerr.ENOSYS
+	case linux.FUTEX_WAIT_REQUEUE_PI:
+		// WAIT_REQUEUE_PI uses an absolute timeout which is either
+		// CLOCK_MONOTONIC or CLOCK_REALTIME.
+		forever := (timeout == 0)
+
+		var timespec linux.Timespec
+		if !forever {
+			var err error
+			timespec, err = copyTimespecIn(t, timeout)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		err := futexWaitRequeuePI(t, clockRealtime, timespec, forever, addr, naddr, private, uint32(val))
+		return 0, nil, err
+
+	case linux.FUTEX_CMP_REQUEUE_PI:
+		// 'val3' contains the value to be checked at 'addr'. Only the first
+		// waiter may be woken, by acquiring 'naddr' on its behalf.
+		if val != 1 || nreq < 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		n, err := t.Futex().CmpRequeuePI(t, addr, naddr, private, uint32(val3), nreq)
+		return uintptr(n), nil, err
 
 	default:
 		// We don't even know about this command.
@@ -287,6 +336,178 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	}
 }
 
+// futex2Private validates futex2 flags and a value to compare against a futex
+// with those flags, and returns true if the futex is private.
+//
+// Only 32-bit futexes are supported, as in Linux.
+func futex2Private(flags uint32, val uint64) (bool, error) {
+	if flags&^(linux.FUTEX2_SIZE_MASK|linux.FUTEX2_NUMA|linux.FUTEX2_PRIVATE) != 0 {
+		return false, linuxerr.EINVAL
+	}
+	if flags&linux.FUTEX2_SIZE_MASK != linux.FUTEX2_SIZE_U32 || flags&linux.FUTEX2_NUMA != 0 {
+		return false, linuxerr.EINVAL
+	}
+	if val > uint64(^uint32(0)) {
+		return false, linuxerr.EINVAL
+	}
+	return flags&linux.FUTEX2_PRIVATE != 0, nil
+}
+
+// futex2Timeout copies in the absolute timeout of a futex2 syscall, measured
+// by clockid. If addr is nil, it returns forever == true.
+func futex2Timeout(t *kernel.Task, addr hostarch.Addr, clockid int32) (ts linux.Timespec, clockRealtime, forever bool, err error) {
+	if addr == 0 {
+		return linux.Timespec{}, false, true, nil
+	}
+	switch clockid {
+	case linux.CLOCK_REALTIME:
+		clockRealtime = true
+	case linux.CLOCK_MONOTONIC:
+	default:
+		return linux.Timespec{}, false, false, linuxerr.EINVAL
+	}
+	ts, err = copyTimespecIn(t, addr)
+	if err != nil {
+		return linux.Timespec{}, false, false, err
+	}
+	if !ts.Valid() {
+		return linux.Timespec{}, false, false, linuxerr.EINVAL
+	}
+	return ts, clockRealtime, false, nil
+}
+
+// copyFutexWaitvIn copies in and validates n struct futex_waitv.
+func copyFutexWaitvIn(t *kernel.Task, addr hostarch.Addr, n int) ([]futex.MultipleWaitFutex, error) {
+	waiters := make([]linux.FutexWaitv, n)
+	if _, err := linux.CopyFutexWaitvSliceIn(t, addr, waiters); err != nil {
+		return nil, err
+	}
+	fs := make([]futex.MultipleWaitFutex, n)
+	for i, w := range waiters {
+		if w.Reserved != 0 {
+			return nil, linuxerr.EINVAL
+		}
+		private, err := futex2Private(w.Flags, w.Val)
+		if err != nil {
+			return nil, err
+		}
+		fs[i] = futex.MultipleWaitFutex{
+			Addr:    hostarch.Addr(w.Uaddr),
+			Private: private,
+			Val:     uint32(w.Val),
+		}
+	}
+	return fs, nil
+}
+
+// FutexWaitv implements linux syscall futex_waitv(2).
+func FutexWaitv(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	waitersAddr := args[0].Pointer()
+	nrFutexes := args[1].Uint()
+	flags := args[2].Uint()
+	timeout := args[3].Pointer()
+	clockid := args[4].Int()
+
+	if flags != 0 || nrFutexes == 0 || nrFutexes > linux.FUTEX_WAITV_MAX || waitersAddr == 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	ts, clockRealtime, forever, err := futex2Timeout(t, timeout, clockid)
+	if err != nil {
+		return 0, nil, err
+	}
+	fs, err := copyFutexWaitvIn(t, waitersAddr, int(nrFutexes))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	ws := futex.NewWaiters(len(fs))
+	woken, err := t.Futex().WaitMultiplePrepare(ws, t, fs)
+	if err != nil {
+		return 0, nil, err
+	}
+	if woken >= 0 {
+		return uintptr(woken), nil, nil
+	}
+
+	err = futexBlockAbsolute(t, ws[0].C, clockRealtime, ts, forever)
+	if woken := t.Futex().WaitMultipleComplete(ws, t); woken >= 0 {
+		// A wakeup takes priority over a timeout or signal.
+		return uintptr(woken), nil, nil
+	}
+	return 0, nil, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+}
+
+// FutexWake implements linux syscall futex_wake(2).
+func FutexWake(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	mask := args[1].Uint64()
+	nr := args[2].Int()
+	flags := args[3].Uint()
+
+	private, err := futex2Private(flags, mask)
+	if err != nil {
+		return 0, nil, err
+	}
+	if mask == 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Unlike futex(FUTEX_WAKE), futex_wake(2) doesn't wake a waiter if nr is
+	// 0, and rejects negative values of nr.
+	if nr < 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if nr == 0 {
+		return 0, nil, nil
+	}
+	n, err := t.Futex().Wake(t, addr, private, uint32(mask), int(nr))
+	return uintptr(n), nil, err
+}
+
+// FutexWait implements linux syscall futex_wait(2).
+func FutexWait(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	val := args[1].Uint64()
+	mask := args[2].Uint64()
+	flags := args[3].Uint()
+	timeout := args[4].Pointer()
+	clockid := args[5].Int()
+
+	private, err := futex2Private(flags, val)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := futex2Private(flags, mask); err != nil {
+		return 0, nil, err
+	}
+	if mask == 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	ts, clockRealtime, forever, err := futex2Timeout(t, timeout, clockid)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := futexWaitAbsolute(t, clockRealtime, ts, forever, addr, private, uint32(val), uint32(mask))
+	return n, nil, err
+}
+
+// FutexRequeue implements linux syscall futex_requeue(2).
+func FutexRequeue(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	waitersAddr := args[0].Pointer()
+	flags := args[1].Uint()
+	nrWake := args[2].Int()
+	nrRequeue := args[3].Int()
+
+	if flags != 0 || nrWake < 0 || nrRequeue < 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	fs, err := copyFutexWaitvIn(t, waitersAddr, 2)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := t.Futex().RequeueCmpMixed(t, fs[0].Addr, fs[0].Private, fs[1].Addr, fs[1].Private, fs[0].Val, int(nrWake), int(nrRequeue))
+	return uintptr(n), nil, err
+}
+
 // SetRobustList implements linux syscall set_robust_list(2).
 func SetRobustList(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	// Despite the syscall using the name 'pid' for this variable, it is
@@ -15,12 +15,15 @@
 package linux
 
 import (
+	"math"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/iouringfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
 // IOUringSetup implements linux syscall io_uring_setup(2).
@@ -47,13 +50,21 @@ func IOUringSetup(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 	}
 
 	// List of currently supported flags in our IO_URING implementation.
-	const supportedFlags = 0 // Currently support none
+	const supportedFlags = linux.IORING_SETUP_SQPOLL | linux.IORING_SETUP_SQ_AFF
 
 	// Since we don't implement everything, we fail explicitly on flags that are unimplemented.
 	if params.Flags|supportedFlags != supportedFlags {
 		return 0, nil, linuxerr.EINVAL
 	}
 
+	// The submission queue poller isn't bound to a CPU, but the CPU is
+	// validated as in Linux's io_uring/sqpoll.c:io_sq_offload_create().
+	if params.Flags&linux.IORING_SETUP_SQ_AFF != 0 {
+		if params.Flags&linux.IORING_SETUP_SQPOLL == 0 || uint(params.SqThreadCPU) >= t.Kernel().ApplicationCores() {
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+
 	vfsObj := t.Kernel().VFS()
 	iouringfd, err := iouringfs.New(t, vfsObj, entries, &params)
 
@@ -94,7 +105,7 @@ func IOUringEnter(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 	ret := -1
 
 	// List of currently supported flags for io_uring_enter(2).
-	const supportedFlags = linux.IORING_ENTER_GETEVENTS
+	const supportedFlags = linux.IORING_ENTER_GETEVENTS | linux.IORING_ENTER_SQ_WAKEUP | linux.IORING_ENTER_REGISTERED_RING
 
 	// Since we don't implement everything, we fail explicitly on flags that are unimplemented.
 	if flags|supportedFlags != supportedFlags {
@@ -106,12 +117,17 @@ func IOUringEnter(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 		return uintptr(ret), nil, linuxerr.EFAULT
 	}
 
-	// If a user requested to submit zero SQEs, then we don't process any and return right away.
-	if toSubmit == 0 {
-		return uintptr(ret), nil, nil
+	var file *vfs.FileDescription
+	if flags&linux.IORING_ENTER_REGISTERED_RING != 0 {
+		// fd is an index into the rings registered with
+		// IORING_REGISTER_RING_FDS, which skips the file table lookup.
+		if uint32(fd) >= linux.IO_RINGFD_REG_MAX {
+			return uintptr(ret), nil, linuxerr.EINVAL
+		}
+		file = t.RegisteredIOUring(uint32(fd))
+	} else {
+		file = t.GetFile(fd)
 	}
-
-	file := t.GetFile(fd)
 	if file == nil {
 		return uintptr(ret), nil, linuxerr.EBADF
 	}
@@ -120,6 +136,29 @@ func IOUringEnter(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 	if !ok {
 		return uintptr(ret), nil, linuxerr.EBADF
 	}
+
+	// In SQPOLL mode, the poller consumes the submission queue; submitters
+	// only need to wake it up if it went to sleep. See Linux's
+	// io_uring/io_uring.c:io_uring_enter().
+	if iouringfd.SQPoll() {
+		if flags&linux.IORING_ENTER_SQ_WAKEUP != 0 {
+			iouringfd.WakeSQPoll()
+		} else if toSubmit != 0 {
+			iouringfd.PokeSQPoll()
+		}
+		if flags&linux.IORING_ENTER_GETEVENTS != 0 && minComplete != 0 {
+			if err := iouringfd.WaitCompletions(t, minComplete); err != nil {
+				return uintptr(ret), nil, err
+			}
+		}
+		return uintptr(toSubmit), nil, nil
+	}
+
+	// If a user requested to submit zero SQEs, then we don't process any and return right away.
+	if toSubmit == 0 {
+		return uintptr(ret), nil, nil
+	}
+
 	ret, err := iouringfd.ProcessSubmissions(t, toSubmit, minComplete, flags)
 	if err != nil {
 		return uintptr(ret), nil, err
@@ -127,3 +166,122 @@ func IOUringEnter(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 
 	return uintptr(ret), nil, nil
 }
+
+// IOUringRegister implements linux syscall io_uring_register(2).
+func IOUringRegister(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	if !kernel.IOUringEnabled {
+		return 0, nil, linuxerr.ENOSYS
+	}
+
+	fd := args[0].Int()
+	opcode := args[1].Uint()
+	arg := args[2].Pointer()
+	nrArgs := args[3].Uint()
+
+	file := t.GetFile(fd)
+	if file == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	if _, ok := file.Impl().(*iouringfs.FileDescription); !ok {
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+
+	switch opcode {
+	case linux.IORING_REGISTER_RING_FDS:
+		n, err := iouringRegisterRingFDs(t, arg, nrArgs)
+		return uintptr(n), nil, err
+	case linux.IORING_UNREGISTER_RING_FDS:
+		n, err := iouringUnregisterRingFDs(t, arg, nrArgs)
+		return uintptr(n), nil, err
+	default:
+		t.Kernel().EmitUnimplementedEvent(t, sysno)
+		return 0, nil, linuxerr.EINVAL
+	}
+}
+
+// iouringRegisterRingFDs implements IORING_REGISTER_RING_FDS. Like Linux's
+// io_uring/register.c:io_ringfd_register(), it returns the number of rings
+// registered, or an error if none were.
+func iouringRegisterRingFDs(t *kernel.Task, arg hostarch.Addr, nrArgs uint32) (int, error) {
+	if nrArgs == 0 || nrArgs > linux.IO_RINGFD_REG_MAX {
+		return 0, linuxerr.EINVAL
+	}
+	updates := make([]linux.IOUringRsrcUpdate, nrArgs)
+	if _, err := linux.CopyIOUringRsrcUpdateSliceIn(t, arg, updates); err != nil {
+		return 0, err
+	}
+	var (
+		i   int
+		err error
+	)
+	for i = range updates {
+		if err = iouringRegisterRingFD(t, &updates[i]); err != nil {
+			break
+		}
+		addr := arg + hostarch.Addr(i*updates[i].SizeBytes())
+		if _, err = updates[i].CopyOut(t, addr); err != nil {
+			t.UnregisterIOUring(updates[i].Offset)
+			break
+		}
+	}
+	if err == nil {
+		i = len(updates)
+	}
+	if i > 0 {
+		return i, nil
+	}
+	return 0, err
+}
+
+// iouringRegisterRingFD registers the ring in update.Data, and sets
+// update.Offset to the index it is registered at.
+func iouringRegisterRingFD(t *kernel.Task, update *linux.IOUringRsrcUpdate) error {
+	if update.Resv != 0 {
+		return linuxerr.EINVAL
+	}
+	start, end := uint32(0), uint32(linux.IO_RINGFD_REG_MAX)
+	if update.Offset != math.MaxUint32 {
+		if update.Offset >= linux.IO_RINGFD_REG_MAX {
+			return linuxerr.EINVAL
+		}
+		start, end = update.Offset, update.Offset+1
+	}
+	file := t.GetFile(int32(update.Data))
+	if file == nil {
+		return linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	if _, ok := file.Impl().(*iouringfs.FileDescription); !ok {
+		return linuxerr.EOPNOTSUPP
+	}
+	index, ok := t.RegisterIOUring(file, start, end)
+	if !ok {
+		return linuxerr.EBUSY
+	}
+	update.Offset = index
+	return nil
+}
+
+// iouringUnregisterRingFDs implements IORING_UNREGISTER_RING_FDS. Like Linux's
+// io_uring/register.c:io_ringfd_unregister(), it returns the number of
+// entries processed, or an error if none were.
+func iouringUnregisterRingFDs(t *kernel.Task, arg hostarch.Addr, nrArgs uint32) (int, error) {
+	if nrArgs == 0 || nrArgs > linux.IO_RINGFD_REG_MAX {
+		return 0, linuxerr.EINVAL
+	}
+	updates := make([]linux.IOUringRsrcUpdate, nrArgs)
+	if _, err := linux.CopyIOUringRsrcUpdateSliceIn(t, arg, updates); err != nil {
+		return 0, err
+	}
+	for i, update := range updates {
+		if update.Resv != 0 || update.Data != 0 || update.Offset >= linux.IO_RINGFD_REG_MAX {
+			if i > 0 {
+				return i, nil
+			}
+			return 0, linuxerr.EINVAL
+		}
+		t.UnregisterIOUring(update.Offset)
+	}
+	return len(updates), nil
+}
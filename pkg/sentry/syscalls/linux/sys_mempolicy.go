@@ -16,21 +16,35 @@ package linux
 
 import (
 	"fmt"
+	"math/bits"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
-// We unconditionally report a single NUMA node. This also means that our
-// "nodemask_t" is a single unsigned long (uint64).
-const (
-	maxNodes        = 1
-	allowedNodemask = (1 << maxNodes) - 1
-)
+// NUMA nodes are those of the kernel's CPU topology, of which there are at
+// most 64. This means that our "nodemask_t" is a single unsigned long
+// (uint64).
+
+// allowedNodemask returns the mask of NUMA nodes that t may use.
+func allowedNodemask(t *kernel.Task) uint64 {
+	return t.Kernel().CPUTopology().NodeMask()
+}
+
+// numaContext returns the NUMA state of t used to place memory.
+func numaContext(t *kernel.Task) mm.NUMAContext {
+	policy, nodemask := t.NumaPolicy()
+	return mm.NUMAContext{
+		Policy:    policy,
+		Nodemask:  nodemask,
+		LocalNode: t.NUMANode(),
+	}
+}
 
 func copyInNodemask(t *kernel.Task, addr hostarch.Addr, maxnode uint32) (uint64, error) {
 	// "nodemask points to a bit mask of node IDs that contains up to maxnode
@@ -57,7 +71,7 @@ func copyInNodemask(t *kernel.Task, addr hostarch.Addr, maxnode uint32) (uint64,
 	val := hostarch.ByteOrder.Uint64(buf)
 	// Check that only allowed bits in the first unsigned long in the nodemask
 	// are set.
-	if val&^allowedNodemask != 0 {
+	if val&^allowedNodemask(t) != 0 {
 		return 0, linuxerr.EINVAL
 	}
 	// Check that all remaining bits in the nodemask are 0.
@@ -118,7 +132,7 @@ func GetMempolicy(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 
 	// "EINVAL: The value specified by maxnode is less than the number of node
 	// IDs supported by the system." - get_mempolicy(2)
-	if nodemask != 0 && maxnode < maxNodes {
+	if nodemask != 0 && uint(maxnode) < t.Kernel().CPUTopology().NUMANodes {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -132,7 +146,7 @@ func GetMempolicy(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 		if nodeFlag || addrFlag {
 			return 0, nil, linuxerr.EINVAL
 		}
-		if err := copyOutNodemask(t, nodemask, maxnode, allowedNodemask); err != nil {
+		if err := copyOutNodemask(t, nodemask, maxnode, allowedNodemask(t)); err != nil {
 			return 0, nil, err
 		}
 		return 0, nil, nil
@@ -158,12 +172,18 @@ func GetMempolicy(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 			// get_mempolicy() will allocate a page as if the thread had
 			// performed a read (load) access to that address, and return the
 			// ID of the node where that page was allocated."
-			buf := t.CopyScratchBuffer(1)
-			_, err := t.CopyInBytes(addr, buf)
+			node, err := t.MemoryManager().PageNode(addr, numaContext(t))
+			if linuxerr.Equals(linuxerr.ENOENT, err) {
+				buf := t.CopyScratchBuffer(1)
+				if _, err := t.CopyInBytes(addr, buf); err != nil {
+					return 0, nil, err
+				}
+				node, err = t.MemoryManager().PageNode(addr, numaContext(t))
+			}
 			if err != nil {
 				return 0, nil, err
 			}
-			policy = linux.MPOL_DEFAULT // maxNodes == 1
+			policy = linux.NumaPolicy(node)
 		}
 		if mode != 0 {
 			if _, err := policy.CopyOut(t, mode); err != nil {
@@ -200,7 +220,9 @@ func GetMempolicy(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 		if policy&^linux.MPOL_MODE_FLAGS != linux.MPOL_INTERLEAVE {
 			return 0, nil, linuxerr.EINVAL
 		}
-		policy = linux.MPOL_DEFAULT // maxNodes == 1
+		// Memory is not allocated on behalf of the thread outside of its
+		// address space, so report the first node of the interleave set.
+		policy = linux.NumaPolicy(bits.TrailingZeros64(nodemaskVal))
 	}
 	if mode != 0 {
 		if _, err := policy.CopyOut(t, mode); err != nil {
@@ -253,12 +275,122 @@ func Mbind(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		return 0, nil, err
 	}
 
-	// Since we claim to have only a single node, all flags can be ignored
-	// (since all pages must already be on that single node).
-	err = t.MemoryManager().SetNumaPolicy(addr, length, mode, nodemaskVal)
+	// Memory is not placed on host NUMA nodes, so moving it can't fail and
+	// MPOL_MF_STRICT is always satisfied if a move is requested. Otherwise,
+	// pages moved by move_pages(2) may violate the new policy, which we
+	// ignore as Linux does when MPOL_MF_STRICT is not specified.
+	move := flags&(linux.MPOL_MF_MOVE|linux.MPOL_MF_MOVE_ALL) != 0
+	err = t.MemoryManager().SetNumaPolicy(addr, length, mode, nodemaskVal, move)
 	return 0, nil, err
 }
 
+// movePagesBatch is the maximum number of pages that MovePages queries or
+// moves at a time, as in Linux's mm/migrate.c:do_pages_stat().
+const movePagesBatch = 16
+
+// MovePages implements the syscall move_pages(2).
+func MovePages(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pid := kernel.ThreadID(args[0].Int())
+	count := args[1].Uint64()
+	pages := args[2].Pointer()
+	nodes := args[3].Pointer()
+	status := args[4].Pointer()
+	flags := args[5].Int()
+
+	if flags&^(linux.MPOL_MF_MOVE|linux.MPOL_MF_MOVE_ALL) != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	moveAll := flags&linux.MPOL_MF_MOVE_ALL != 0
+	if moveAll && !t.HasCapability(linux.CAP_SYS_NICE) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	target := t
+	if pid != 0 {
+		target = t.PIDNamespace().TaskWithID(pid)
+		if target == nil {
+			return 0, nil, linuxerr.ESRCH
+		}
+		// "Moving pages of another process requires the following privileges:
+		// ... the caller must have PTRACE_MODE_READ_REALCREDS access to the
+		// target process." - move_pages(2)
+		if !t.CanTrace(target, false /* attach */) {
+			return 0, nil, linuxerr.EPERM
+		}
+	}
+	var tmm *mm.MemoryManager
+	target.WithMuLocked(func(target *kernel.Task) {
+		if tmm = target.MemoryManager(); tmm != nil && !tmm.IncUsers() {
+			tmm = nil
+		}
+	})
+	if tmm == nil {
+		return 0, nil, linuxerr.EINVAL
+	}
+	defer tmm.DecUsers(t)
+	nc := numaContext(target)
+	numNodes := t.Kernel().CPUTopology().NUMANodes
+
+	addrs := make([]hostarch.Addr, movePagesBatch)
+	var nodeVals []uint32
+	if nodes != 0 {
+		nodeVals = make([]uint32, movePagesBatch)
+	}
+	statusVals := make([]int32, movePagesBatch)
+	for done := uint64(0); done < count; {
+		n := count - done
+		if n > movePagesBatch {
+			n = movePagesBatch
+		}
+		pagesAddr, ok := pages.AddLength(done * 8)
+		if !ok {
+			return 0, nil, linuxerr.EFAULT
+		}
+		buf := t.CopyScratchBuffer(int(n) * 8)
+		if _, err := t.CopyInBytes(pagesAddr, buf); err != nil {
+			return 0, nil, err
+		}
+		for i := uint64(0); i < n; i++ {
+			addrs[i] = hostarch.Addr(hostarch.ByteOrder.Uint64(buf[i*8:]))
+		}
+		var batchNodes []uint32
+		if nodes != 0 {
+			nodesAddr, ok := nodes.AddLength(done * 4)
+			if !ok {
+				return 0, nil, linuxerr.EFAULT
+			}
+			buf = t.CopyScratchBuffer(int(n) * 4)
+			if _, err := t.CopyInBytes(nodesAddr, buf); err != nil {
+				return 0, nil, err
+			}
+			for i := uint64(0); i < n; i++ {
+				node := int32(hostarch.ByteOrder.Uint32(buf[i*4:]))
+				// "ENODEV: One of the target nodes is not online." -
+				// move_pages(2)
+				if node < 0 || uint(node) >= numNodes {
+					return 0, nil, linuxerr.ENODEV
+				}
+				nodeVals[i] = uint32(node)
+			}
+			batchNodes = nodeVals[:n]
+		}
+		tmm.MovePages(addrs[:n], batchNodes, moveAll, nc, statusVals[:n])
+		statusAddr, ok := status.AddLength(done * 4)
+		if !ok {
+			return 0, nil, linuxerr.EFAULT
+		}
+		buf = t.CopyScratchBuffer(int(n) * 4)
+		for i := uint64(0); i < n; i++ {
+			hostarch.ByteOrder.PutUint32(buf[i*4:], uint32(statusVals[i]))
+		}
+		if _, err := t.CopyOutBytes(statusAddr, buf); err != nil {
+			return 0, nil, err
+		}
+		done += n
+	}
+	return 0, nil, nil
+}
+
 func copyInMempolicyNodemask(t *kernel.Task, modeWithFlags linux.NumaPolicy, nodemask hostarch.Addr, maxnode uint32) (linux.NumaPolicy, uint64, error) {
 	flags := linux.NumaPolicy(modeWithFlags & linux.MPOL_MODE_FLAGS)
 	mode := linux.NumaPolicy(modeWithFlags &^ linux.MPOL_MODE_FLAGS)
@@ -194,10 +194,12 @@ func Madvise(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr
 		return 0, nil, t.MemoryManager().SetDontFork(addr, length, false)
 	case linux.MADV_DONTFORK:
 		return 0, nil, t.MemoryManager().SetDontFork(addr, length, true)
+	case linux.MADV_MERGEABLE:
+		return 0, nil, t.MemoryManager().SetMergeable(addr, length, true)
+	case linux.MADV_UNMERGEABLE:
+		return 0, nil, t.MemoryManager().SetMergeable(addr, length, false)
 	case linux.MADV_HUGEPAGE, linux.MADV_NOHUGEPAGE:
 		fallthrough
-	case linux.MADV_MERGEABLE, linux.MADV_UNMERGEABLE:
-		fallthrough
 	case linux.MADV_DONTDUMP, linux.MADV_DODUMP:
 		// TODO(b/72045799): Core dumping isn't implemented, so these are
 		// no-ops.
@@ -161,3 +161,233 @@ func Umount2(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr
 
 	return 0, nil, t.Kernel().VFS().UmountAt(t, creds, &tpop.pop, &opts)
 }
+
+// Fsopen implements Linux syscall fsopen(2).
+func Fsopen(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	nameAddr := args[0].Pointer()
+	flags := args[1].Uint()
+
+	if flags&^linux.FSOPEN_CLOEXEC != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	creds := t.Credentials()
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespace().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+	fsType, err := t.CopyInString(nameAddr, hostarch.PageSize)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	file, err := vfs.NewFilesystemContextFD(t, t.Kernel().VFS(), fsType, linux.O_RDWR)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	fd, err := t.NewFDFrom(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.FSOPEN_CLOEXEC != 0,
+	})
+	return uintptr(fd), nil, err
+}
+
+// fdToFilesystemContext resolves fd to a filesystem context. If successful,
+// the file has an extra reference that the caller must release.
+func fdToFilesystemContext(t *kernel.Task, fd int32) (*vfs.FilesystemContext, *vfs.FileDescription, error) {
+	f := t.GetFile(fd)
+	if f == nil {
+		return nil, nil, linuxerr.EBADF
+	}
+	fc, ok := f.Impl().(*vfs.FilesystemContext)
+	if !ok {
+		f.DecRef(t)
+		return nil, nil, linuxerr.EINVAL
+	}
+	return fc, f, nil
+}
+
+// Fsconfig implements Linux syscall fsconfig(2).
+func Fsconfig(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	cmd := args[1].Uint()
+	keyAddr := args[2].Pointer()
+	valueAddr := args[3].Pointer()
+	aux := args[4].Int()
+
+	fc, file, err := fdToFilesystemContext(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	// See fs/fsopen.c:SYSCALL_DEFINE5(fsconfig, ...).
+	switch cmd {
+	case linux.FSCONFIG_SET_FLAG:
+		if keyAddr == 0 || valueAddr != 0 || aux != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	case linux.FSCONFIG_SET_STRING:
+		if keyAddr == 0 || valueAddr == 0 || aux != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	case linux.FSCONFIG_SET_BINARY, linux.FSCONFIG_SET_PATH, linux.FSCONFIG_SET_PATH_EMPTY, linux.FSCONFIG_SET_FD:
+		// None of the filesystems implemented by gVisor take binary, path or
+		// file descriptor parameters.
+		return 0, nil, linuxerr.EOPNOTSUPP
+	case linux.FSCONFIG_CMD_CREATE, linux.FSCONFIG_CMD_CREATE_EXCL:
+		if keyAddr != 0 || valueAddr != 0 || aux != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		// A new filesystem is always created, so FSCONFIG_CMD_CREATE_EXCL can't
+		// fail because of an existing superblock.
+		return 0, nil, fc.Create(t, t.Credentials())
+	case linux.FSCONFIG_CMD_RECONFIGURE:
+		// Contexts for reconfiguration are created by fspick(2), which is not
+		// supported.
+		return 0, nil, linuxerr.EOPNOTSUPP
+	default:
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+
+	key, err := t.CopyInString(keyAddr, 256)
+	if err != nil {
+		return 0, nil, err
+	}
+	if cmd == linux.FSCONFIG_SET_FLAG {
+		return 0, nil, fc.SetFlag(key)
+	}
+	value, err := t.CopyInString(valueAddr, hostarch.PageSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	return 0, nil, fc.SetString(key, value)
+}
+
+// Fsmount implements Linux syscall fsmount(2).
+func Fsmount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fsfd := args[0].Int()
+	flags := args[1].Uint()
+	attr := args[2].Uint()
+
+	if flags&^linux.FSMOUNT_CLOEXEC != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	opts, err := vfs.ParseMountAttr(attr)
+	if err != nil {
+		return 0, nil, err
+	}
+	creds := t.Credentials()
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespace().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	fc, file, err := fdToFilesystemContext(t, fsfd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	mntFile, err := fc.Mount(t, &opts, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer mntFile.DecRef(t)
+
+	fd, err := t.NewFDFrom(0, mntFile, kernel.FDFlags{
+		CloseOnExec: flags&linux.FSMOUNT_CLOEXEC != 0,
+	})
+	return uintptr(fd), nil, err
+}
+
+// OpenTree implements Linux syscall open_tree(2).
+func OpenTree(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	dirfd := args[0].Int()
+	pathAddr := args[1].Pointer()
+	flags := args[2].Uint()
+
+	const allowedFlags = linux.OPEN_TREE_CLONE | linux.OPEN_TREE_CLOEXEC | linux.AT_EMPTY_PATH |
+		linux.AT_NO_AUTOMOUNT | linux.AT_RECURSIVE | linux.AT_SYMLINK_NOFOLLOW
+	if flags&^allowedFlags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	clone := flags&linux.OPEN_TREE_CLONE != 0
+	recursive := flags&linux.AT_RECURSIVE != 0
+	if recursive && !clone {
+		return 0, nil, linuxerr.EINVAL
+	}
+	creds := t.Credentials()
+	if clone && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespace().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	path, err := copyInPath(t, pathAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	tpop, err := getTaskPathOperation(t, dirfd, path, shouldAllowEmptyPath(flags&linux.AT_EMPTY_PATH != 0), shouldFollowFinalSymlink(flags&linux.AT_SYMLINK_NOFOLLOW == 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tpop.Release(t)
+
+	var file *vfs.FileDescription
+	if clone {
+		file, err = t.Kernel().VFS().OpenTreeAt(t, creds, &tpop.pop, recursive, 0)
+	} else {
+		// Without OPEN_TREE_CLONE, open_tree(2) is equivalent to open(2) with
+		// O_PATH.
+		file, err = t.Kernel().VFS().OpenAt(t, creds, &tpop.pop, &vfs.OpenOptions{
+			Flags: linux.O_PATH,
+		})
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	fd, err := t.NewFDFrom(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.OPEN_TREE_CLOEXEC != 0,
+	})
+	return uintptr(fd), nil, err
+}
+
+// MoveMount implements Linux syscall move_mount(2).
+func MoveMount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fromDirfd := args[0].Int()
+	fromPathAddr := args[1].Pointer()
+	toDirfd := args[2].Int()
+	toPathAddr := args[3].Pointer()
+	flags := args[4].Uint()
+
+	// MOVE_MOUNT_SET_GROUP and MOVE_MOUNT_BENEATH are not supported.
+	const allowedFlags = linux.MOVE_MOUNT_F_SYMLINKS | linux.MOVE_MOUNT_F_AUTOMOUNTS | linux.MOVE_MOUNT_F_EMPTY_PATH |
+		linux.MOVE_MOUNT_T_SYMLINKS | linux.MOVE_MOUNT_T_AUTOMOUNTS | linux.MOVE_MOUNT_T_EMPTY_PATH
+	if flags&^allowedFlags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	creds := t.Credentials()
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespace().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	fromPath, err := copyInPath(t, fromPathAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	from, err := getTaskPathOperation(t, fromDirfd, fromPath, shouldAllowEmptyPath(flags&linux.MOVE_MOUNT_F_EMPTY_PATH != 0), shouldFollowFinalSymlink(flags&linux.MOVE_MOUNT_F_SYMLINKS != 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer from.Release(t)
+	toPath, err := copyInPath(t, toPathAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	to, err := getTaskPathOperation(t, toDirfd, toPath, shouldAllowEmptyPath(flags&linux.MOVE_MOUNT_T_EMPTY_PATH != 0), shouldFollowFinalSymlink(flags&linux.MOVE_MOUNT_T_SYMLINKS != 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer to.Release(t)
+
+	return 0, nil, t.Kernel().VFS().MoveMountAt(t, creds, &from.pop, &to.pop)
+}
@@ -237,6 +237,12 @@ func Prctl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		_, err := primitive.CopyInt32Out(t, args[1].Pointer(), isSubreaper)
 		return 0, nil, err
 
+	case linux.PR_PAC_RESET_KEYS:
+		if args[2].Uint64() != 0 || args[3].Uint64() != 0 || args[4].Uint64() != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		return 0, nil, t.Arch().ResetPACKeys(args[1].Uint64())
+
 	case linux.PR_GET_TIMING,
 		linux.PR_SET_TIMING,
 		linux.PR_GET_TSC,
@@ -0,0 +1,265 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// Quotactl implements Linux syscall quotactl(2).
+//
+// gVisor has no block devices, so special may name any file on the
+// filesystem whose quotas are managed, rather than its block device.
+func Quotactl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	cmd := args[0].Uint()
+	specialAddr := args[1].Pointer()
+	id := args[2].Uint()
+	addr := args[3].Pointer()
+
+	subcmd := cmd >> linux.SUBCMDSHIFT
+	qtype := int(cmd & linux.SUBCMDMASK)
+	if qtype >= linux.MAXQUOTAS {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Q_SYNC with no special file syncs all filesystems, and quotas are
+	// never written back to storage.
+	if subcmd == linux.Q_SYNC && specialAddr == 0 {
+		return 0, nil, nil
+	}
+
+	path, err := copyInPath(t, specialAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	tpop, err := getTaskPathOperation(t, linux.AT_FDCWD, path, disallowEmptyPath, followFinalSymlink)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tpop.Release(t)
+	vd, err := t.Kernel().VFS().GetDentryAt(t, t.Credentials(), &tpop.pop, &vfs.GetDentryOptions{})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer vd.DecRef(t)
+	return 0, nil, quotactl(t, vd.Mount().Filesystem(), subcmd, qtype, id, addr)
+}
+
+// QuotactlFd implements Linux syscall quotactl_fd(2).
+func QuotactlFd(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	cmd := args[1].Uint()
+	id := args[2].Uint()
+	addr := args[3].Pointer()
+
+	subcmd := cmd >> linux.SUBCMDSHIFT
+	qtype := int(cmd & linux.SUBCMDMASK)
+	if qtype >= linux.MAXQUOTAS {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	file := t.GetFile(fd)
+	if file == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	return 0, nil, quotactl(t, file.Mount().Filesystem(), subcmd, qtype, id, addr)
+}
+
+// quotactl performs the quotactl(2) subcommand subcmd for quotas of type
+// qtype on fs. Compare Linux's fs/quota/quota.c:do_quotactl().
+func quotactl(t *kernel.Task, fs *vfs.Filesystem, subcmd uint32, qtype int, id uint32, addr hostarch.Addr) error {
+	impl, ok := fs.Impl().(vfs.QuotaFilesystemImpl)
+	if !ok {
+		return linuxerr.ENOSYS
+	}
+	if err := checkQuotactlPermission(t, subcmd, qtype, id); err != nil {
+		return err
+	}
+
+	switch subcmd {
+	case linux.Q_SYNC:
+		// Quotas are never written back to storage.
+		return nil
+
+	case linux.Q_QUOTAON:
+		// id and addr are the quota format and file, which are determined by
+		// the filesystem.
+		return impl.QuotaOn(t, qtype)
+
+	case linux.Q_QUOTAOFF:
+		return impl.QuotaOff(t, qtype)
+
+	case linux.Q_GETFMT:
+		format, err := impl.QuotaFormat(qtype)
+		if err != nil {
+			return err
+		}
+		_, err = primitive.CopyUint32Out(t, addr, format)
+		return err
+
+	case linux.Q_GETINFO:
+		info, err := impl.GetQuotaInfo(t, qtype)
+		if err != nil {
+			return err
+		}
+		_, err = info.CopyOut(t, addr)
+		return err
+
+	case linux.Q_SETINFO:
+		var info linux.IfDqinfo
+		if _, err := info.CopyIn(t, addr); err != nil {
+			return err
+		}
+		return impl.SetQuotaInfo(t, qtype, info)
+
+	case linux.Q_GETQUOTA:
+		kid, err := quotaKID(t, qtype, id)
+		if err != nil {
+			return err
+		}
+		dqb, err := impl.GetQuota(t, qtype, kid)
+		if err != nil {
+			return err
+		}
+		_, err = dqb.CopyOut(t, addr)
+		return err
+
+	case linux.Q_SETQUOTA:
+		kid, err := quotaKID(t, qtype, id)
+		if err != nil {
+			return err
+		}
+		var dqb linux.IfDqblk
+		if _, err := dqb.CopyIn(t, addr); err != nil {
+			return err
+		}
+		return impl.SetQuota(t, qtype, kid, dqb)
+
+	case linux.Q_GETNEXTQUOTA:
+		kid, err := quotaKID(t, qtype, id)
+		if err != nil {
+			return err
+		}
+		for {
+			nextKID, dqb, err := impl.GetNextQuota(t, qtype, kid)
+			if err != nil {
+				return err
+			}
+			// Skip IDs that aren't visible to t.
+			nextID, ok := quotaID(t, qtype, nextKID)
+			if !ok {
+				if nextKID == auth.NoID {
+					return linuxerr.ENOENT
+				}
+				kid = nextKID + 1
+				continue
+			}
+			next := linux.IfNextDqblk{
+				BHardLimit: dqb.BHardLimit,
+				BSoftLimit: dqb.BSoftLimit,
+				CurSpace:   dqb.CurSpace,
+				IHardLimit: dqb.IHardLimit,
+				ISoftLimit: dqb.ISoftLimit,
+				CurInodes:  dqb.CurInodes,
+				BTime:      dqb.BTime,
+				ITime:      dqb.ITime,
+				Valid:      dqb.Valid,
+				ID:         nextID,
+			}
+			_, err = next.CopyOut(t, addr)
+			return err
+		}
+
+	default:
+		return linuxerr.EINVAL
+	}
+}
+
+// checkQuotactlPermission checks that t may perform the quotactl(2)
+// subcommand subcmd. Compare Linux's
+// fs/quota/quota.c:check_quotactl_permission().
+func checkQuotactlPermission(t *kernel.Task, subcmd uint32, qtype int, id uint32) error {
+	creds := t.Credentials()
+	switch subcmd {
+	case linux.Q_GETFMT, linux.Q_SYNC, linux.Q_GETINFO:
+		return nil
+	case linux.Q_GETQUOTA:
+		// Users may query their own quotas.
+		switch qtype {
+		case linux.USRQUOTA:
+			if creds.EffectiveKUID == creds.UserNamespace.MapToKUID(auth.UID(id)) {
+				return nil
+			}
+		case linux.GRPQUOTA:
+			if creds.InGroup(creds.UserNamespace.MapToKGID(auth.GID(id))) {
+				return nil
+			}
+		}
+	}
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, creds.UserNamespace.Root()) {
+		return linuxerr.EPERM
+	}
+	return nil
+}
+
+// quotaKID translates the quota ID id of type qtype from t's user namespace
+// to the root user namespace.
+func quotaKID(t *kernel.Task, qtype int, id uint32) (uint32, error) {
+	ns := t.Credentials().UserNamespace
+	switch qtype {
+	case linux.USRQUOTA:
+		kuid := ns.MapToKUID(auth.UID(id))
+		if !kuid.Ok() {
+			return 0, linuxerr.EINVAL
+		}
+		return uint32(kuid), nil
+	case linux.GRPQUOTA:
+		kgid := ns.MapToKGID(auth.GID(id))
+		if !kgid.Ok() {
+			return 0, linuxerr.EINVAL
+		}
+		return uint32(kgid), nil
+	default:
+		// Project IDs can't be mapped into user namespaces, so they can only
+		// be used from the root user namespace.
+		if ns != ns.Root() {
+			return 0, linuxerr.EINVAL
+		}
+		return id, nil
+	}
+}
+
+// quotaID is the inverse of quotaKID. It returns false if kid has no mapping
+// in t's user namespace.
+func quotaID(t *kernel.Task, qtype int, kid uint32) (uint32, bool) {
+	ns := t.Credentials().UserNamespace
+	switch qtype {
+	case linux.USRQUOTA:
+		uid := ns.MapFromKUID(auth.KUID(kid))
+		return uint32(uid), uid.Ok()
+	case linux.GRPQUOTA:
+		gid := ns.MapFromKGID(auth.KGID(kid))
+		return uint32(gid), gid.Ok()
+	default:
+		return kid, ns == ns.Root()
+	}
+}
@@ -22,8 +22,10 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/hostfd"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/pipe"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/usermem"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -80,10 +82,14 @@ func Splice(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	// underspecified and vary between versions of Linux itself.
 	nonBlock := ((inFile.StatusFlags()|outFile.StatusFlags())&linux.O_NONBLOCK != 0) || (flags&linux.SPLICE_F_NONBLOCK != 0)
 
-	// At least one file description must represent a pipe.
+	// At least one file description must represent a pipe. If both are
+	// backed by host file descriptors and at least one of them is a host
+	// pipe, splice on the host rather than copying through the sentry.
 	inPipeFD, inIsPipe := inFile.Impl().(*pipe.VFSPipeFD)
 	outPipeFD, outIsPipe := outFile.Impl().(*pipe.VFSPipeFD)
-	if !inIsPipe && !outIsPipe {
+	inHostFD, outHostFD, inIsHostPipe, outIsHostPipe, hostOK := hostSpliceFDs(inFile, outFile)
+	hostSplice := hostOK && (inIsHostPipe || outIsHostPipe) && inOffsetPtr == 0 && outOffsetPtr == 0
+	if !inIsPipe && !outIsPipe && !hostSplice {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -136,6 +142,11 @@ func Splice(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		// locks by passing the pipe FD as usermem.IO to the non-pipe
 		// end.
 		switch {
+		case hostSplice:
+			n, err = hostfd.Splice(outHostFD, inHostFD, count)
+			if err != nil {
+				n = 0
+			}
 		case inIsPipe && outIsPipe:
 			n, err = pipe.Splice(t, outPipeFD, inPipeFD, count)
 		case inIsPipe:
@@ -177,6 +188,20 @@ func Splice(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	return uintptr(n), nil, HandleIOError(t, n != 0, err, linuxerr.ERESTARTSYS, "splice", outFile)
 }
 
+// hostSpliceFDs returns the host file descriptors backing inFile and outFile,
+// and whether each of them is a host pipe. ok is false if either file
+// description can't be used with host splice(2) and tee(2).
+func hostSpliceFDs(inFile, outFile *vfs.FileDescription) (inFD, outFD int32, inIsPipe, outIsPipe, ok bool) {
+	in, inOK := inFile.Impl().(hostfd.Spliceable)
+	out, outOK := outFile.Impl().(hostfd.Spliceable)
+	if !inOK || !outOK {
+		return 0, 0, false, false, false
+	}
+	inFD, inIsPipe, inOK = in.SpliceHostFD()
+	outFD, outIsPipe, outOK = out.SpliceHostFD()
+	return inFD, outFD, inIsPipe, outIsPipe, inOK && outOK
+}
+
 // Tee implements Linux syscall tee(2).
 func Tee(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	inFD := args[0].Int()
@@ -226,10 +251,13 @@ func Tee(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *k
 	// underspecified and vary between versions of Linux itself.
 	nonBlock := ((inFile.StatusFlags()|outFile.StatusFlags())&linux.O_NONBLOCK != 0) || (flags&linux.SPLICE_F_NONBLOCK != 0)
 
-	// Both file descriptions must represent pipes.
+	// Both file descriptions must represent pipes, either both in the sentry
+	// or both on the host.
 	inPipeFD, inIsPipe := inFile.Impl().(*pipe.VFSPipeFD)
 	outPipeFD, outIsPipe := outFile.Impl().(*pipe.VFSPipeFD)
-	if !inIsPipe || !outIsPipe {
+	inHostFD, outHostFD, inIsHostPipe, outIsHostPipe, hostOK := hostSpliceFDs(inFile, outFile)
+	hostTee := hostOK && inIsHostPipe && outIsHostPipe
+	if (!inIsPipe || !outIsPipe) && !hostTee {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -244,7 +272,14 @@ func Tee(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *k
 	}
 	defer dw.destroy()
 	for {
-		n, err = pipe.Tee(t, outPipeFD, inPipeFD, count)
+		if hostTee {
+			n, err = hostfd.Tee(outHostFD, inHostFD, count)
+			if err != nil {
+				n = 0
+			}
+		} else {
+			n, err = pipe.Tee(t, outPipeFD, inPipeFD, count)
+		}
 		if n != 0 || !linuxerr.Equals(linuxerr.ErrWouldBlock, err) || nonBlock {
 			break
 		}
@@ -355,7 +390,11 @@ func Sendfile(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 	// block device. We only need to check if writing to the output file
 	// can block.
 	nonBlock := outFile.StatusFlags()&linux.O_NONBLOCK != 0
-	if outIsPipe {
+	sent := false
+	if sender, ok := outFile.Impl().(socket.FileSender); ok {
+		total, offset, sent, err = sendfileToSocket(t, &dw, sender, inFile, offset, count, nonBlock)
+	}
+	if !sent && outIsPipe {
 		for {
 			var n int64
 			n, err = outPipeFD.SpliceFromNonPipe(t, inFile, offset, count-total)
@@ -377,7 +416,7 @@ func Sendfile(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 				break
 			}
 		}
-	} else {
+	} else if !sent {
 		// Read inFile to buffer, then write the contents to outFile.
 		//
 		// The buffer size has to be limited to avoid large memory
@@ -471,6 +510,63 @@ func Sendfile(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 	return uintptr(total), nil, HandleIOError(t, total != 0, err, linuxerr.ERESTARTSYS, "sendfile", inFile)
 }
 
+// sendfileToSocket implements sendfile(2) to a socket that can read file
+// contents directly into its send buffer. It returns the number of bytes sent
+// and the updated offset. ok is false if sender can't send from inFile, in
+// which case nothing was sent.
+func sendfileToSocket(t *kernel.Task, dw *dualWaiter, sender socket.FileSender, inFile *vfs.FileDescription, offset, count int64, nonBlock bool) (total, newOffset int64, ok bool, err error) {
+	// sender always reads at an explicit offset. If no offset was given, use
+	// and then update the file offset, as in Linux's fs/read_write.c:do_sendfile().
+	pos := offset
+	if offset == -1 {
+		if inFile.Options().DenyPRead {
+			return 0, offset, false, nil
+		}
+		if pos, err = inFile.Seek(t, 0, linux.SEEK_CUR); err != nil {
+			return 0, offset, false, nil
+		}
+	}
+
+	for {
+		var n int64
+		n, ok, err = sender.SendFile(t, inFile, pos, count-total)
+		if !ok {
+			if total == 0 {
+				return 0, offset, false, nil
+			}
+			err = nil
+			break
+		}
+		pos += n
+		total += n
+		if total == count {
+			break
+		}
+		if err == nil && t.Interrupted() {
+			err = linuxerr.ErrInterrupted
+			break
+		}
+		if linuxerr.Equals(linuxerr.ErrWouldBlock, err) && !nonBlock {
+			err = dw.waitForOut(t)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if offset != -1 {
+		return total, pos, true, err
+	}
+	if total != 0 {
+		if _, seekErr := inFile.Seek(t, pos, linux.SEEK_SET); seekErr != nil {
+			// Log the error but don't return it, since the data has already
+			// been sent.
+			log.Warningf("failed to update input file offset: %v", seekErr)
+		}
+	}
+	return total, offset, true, err
+}
+
 // dualWaiter is used to wait on one or both vfs.FileDescriptions. It is not
 // thread-safe, and does not take a reference on the vfs.FileDescriptions.
 //
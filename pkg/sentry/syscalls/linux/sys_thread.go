@@ -164,6 +164,7 @@ func execveat(t *kernel.Task, dirfd int32, pathnameAddr, argvAddr, envvAddr host
 		Argv:                argv,
 		Envv:                envv,
 		Features:            t.Kernel().FeatureSet(),
+		ClockOffsets:        !t.ChildTimeNamespaceIsRoot(),
 	}
 	if seccheck.Global.Enabled(seccheck.PointExecve) {
 		// Retain the first executable file that is opened (which may open
@@ -775,5 +776,6 @@ func Ptrace(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	addr := args[2].Pointer()
 	data := args[3].Pointer()
 
-	return 0, nil, t.Ptrace(req, pid, addr, data)
+	n, err := t.Ptrace(req, pid, addr, data)
+	return n, nil, err
 }
@@ -44,6 +44,12 @@ func isCPUClockPerThread(c int32) bool {
 	return c&linux.CPUCLOCK_PERTHREAD_MASK != 0
 }
 
+// isFDClock returns true if the clock id refers to a dynamic clock provided by
+// a file descriptor, as returned by FD_TO_CLOCKID.
+func isFDClock(c int32) bool {
+	return c < 0 && c&linux.CLOCKFD_MASK == linux.CLOCKFD
+}
+
 // isValidCPUClock returns checks that the cpu clock id is valid.
 func isValidCPUClock(c int32) bool {
 	// Bits 0, 1, and 2 cannot all be set.
@@ -56,13 +62,31 @@ func isValidCPUClock(c int32) bool {
 	return true
 }
 
-// targetTask returns the kernel.Task for the given clock id.
-func targetTask(t *kernel.Task, c int32) *kernel.Task {
+// cpuClockTarget returns the task or thread group whose CPU clock is
+// identified by the given clock id, or nil if there is none that t may use.
+// Thread CPU clocks are limited to t's thread group, and process CPU clocks
+// must be identified by the ID of a thread group leader, except when the
+// clock is read (forTimer is false) and the ID is t's thread ID. This is
+// consistent with Linux's kernel/time/posix-cpu-timers.c:pid_for_clock().
+func cpuClockTarget(t *kernel.Task, c int32, forTimer bool) cpuClocker {
 	pid := pidOfClockID(c)
-	if pid == 0 {
-		return t
+	if isCPUClockPerThread(c) {
+		if pid == 0 {
+			return t
+		}
+		target := t.PIDNamespace().TaskWithID(pid)
+		if target == nil || target.ThreadGroup() != t.ThreadGroup() {
+			return nil
+		}
+		return target
+	}
+	if pid == 0 || (!forTimer && pid == t.ThreadID()) {
+		return t.ThreadGroup()
+	}
+	if tg := t.PIDNamespace().ThreadGroupWithID(pid); tg != nil {
+		return tg
 	}
-	return t.PIDNamespace().TaskWithID(pid)
+	return nil
 }
 
 // ClockGetres implements linux syscall clock_getres(2).
@@ -74,7 +98,7 @@ func ClockGetres(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 		Nsec: 1,
 	}
 
-	if _, err := getClock(t, clockID); err != nil {
+	if _, err := getClock(t, clockID, false /* forTimer */); err != nil {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -91,24 +115,45 @@ type cpuClocker interface {
 	CPUClock() ktime.Clock
 }
 
-func getClock(t *kernel.Task, clockID int32) (ktime.Clock, error) {
+// clockFile is implemented by file descriptions that provide a dynamic clock,
+// such as PTP hardware clock devices.
+type clockFile interface {
+	// Clock returns the clock read by clock_gettime(FD_TO_CLOCKID(fd)).
+	Clock() ktime.Clock
+}
+
+// getFDClock returns the clock provided by the file descriptor encoded in
+// clockID.
+func getFDClock(t *kernel.Task, clockID int32) (ktime.Clock, error) {
+	// The file descriptor is encoded as the pid of CPU clocks are.
+	file := t.GetFile(int32(pidOfClockID(clockID)))
+	if file == nil {
+		return nil, linuxerr.EINVAL
+	}
+	defer file.DecRef(t)
+	cf, ok := file.Impl().(clockFile)
+	if !ok {
+		return nil, linuxerr.EINVAL
+	}
+	return cf.Clock(), nil
+}
+
+// getClock returns the clock identified by clockID. forTimer is true if the
+// clock will be used to arm a timer rather than only be read.
+func getClock(t *kernel.Task, clockID int32, forTimer bool) (ktime.Clock, error) {
+	if isFDClock(clockID) {
+		return getFDClock(t, clockID)
+	}
 	if clockID < 0 {
 		if !isValidCPUClock(clockID) {
 			return nil, linuxerr.EINVAL
 		}
 
-		targetTask := targetTask(t, clockID)
-		if targetTask == nil {
+		target := cpuClockTarget(t, clockID, forTimer)
+		if target == nil {
 			return nil, linuxerr.EINVAL
 		}
 
-		var target cpuClocker
-		if isCPUClockPerThread(clockID) {
-			target = targetTask
-		} else {
-			target = targetTask.ThreadGroup()
-		}
-
 		switch whichCPUClock(clockID) {
 		case linux.CPUCLOCK_VIRT:
 			return target.UserCPUClock(), nil
@@ -124,15 +169,20 @@ func getClock(t *kernel.Task, clockID int32) (ktime.Clock, error) {
 	case linux.CLOCK_REALTIME, linux.CLOCK_REALTIME_COARSE:
 		return t.Kernel().RealtimeClock(), nil
 	case linux.CLOCK_MONOTONIC, linux.CLOCK_MONOTONIC_COARSE,
-		linux.CLOCK_MONOTONIC_RAW, linux.CLOCK_BOOTTIME:
+		linux.CLOCK_MONOTONIC_RAW:
 		// CLOCK_MONOTONIC approximates CLOCK_MONOTONIC_RAW.
-		// CLOCK_BOOTTIME is internally mapped to CLOCK_MONOTONIC, as:
+		return t.MonotonicClock(), nil
+	case linux.CLOCK_BOOTTIME:
+		// CLOCK_BOOTTIME is internally mapped to CLOCK_MONOTONIC, offset by
+		// the task's time namespace, as:
 		//	- CLOCK_BOOTTIME should behave as CLOCK_MONOTONIC while also
 		//		including suspend time.
 		//	- gVisor has no concept of suspend/resume.
 		//	- CLOCK_MONOTONIC already includes save/restore time, which is
 		//		the closest to suspend time.
-		return t.Kernel().MonotonicClock(), nil
+		return t.BoottimeClock(), nil
+	case linux.CLOCK_TAI:
+		return t.Kernel().TAIClock(), nil
 	case linux.CLOCK_PROCESS_CPUTIME_ID:
 		return t.ThreadGroup().CPUClock(), nil
 	case linux.CLOCK_THREAD_CPUTIME_ID:
@@ -147,7 +197,7 @@ func ClockGettime(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 	clockID := int32(args[0].Int())
 	addr := args[1].Pointer()
 
-	c, err := getClock(t, clockID)
+	c, err := getClock(t, clockID, false /* forTimer */)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -160,6 +210,92 @@ func ClockSettime(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 	return 0, nil, linuxerr.EPERM
 }
 
+// Adjtimex implements linux syscall adjtimex(2).
+func Adjtimex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	return adjtimex(t, args[0].Pointer())
+}
+
+// ClockAdjtime implements linux syscall clock_adjtime(2).
+func ClockAdjtime(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	clockID := int32(args[0].Int())
+	addr := args[1].Pointer()
+
+	if _, err := getClock(t, clockID, false /* forTimer */); err != nil {
+		return 0, nil, linuxerr.EINVAL
+	}
+	switch {
+	case clockID == linux.CLOCK_REALTIME:
+		return adjtimex(t, addr)
+	case isFDClock(clockID):
+		// Dynamic clocks can't be adjusted, and only report their frequency
+		// offset, which is always 0. Compare
+		// drivers/ptp/ptp_clock.c:ptp_clock_adjtime().
+		var tx linux.Timex
+		if _, err := tx.CopyIn(t, addr); err != nil {
+			return 0, nil, err
+		}
+		if tx.Modes != 0 {
+			return 0, nil, linuxerr.EPERM
+		}
+		tx.Freq = 0
+		_, err := tx.CopyOut(t, addr)
+		return 0, nil, err
+	default:
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+}
+
+// adjtimex implements adjtimex(2) and clock_adjtime(2) for CLOCK_REALTIME.
+//
+// The sandbox can't adjust the host's clock, so only reading the clock's
+// synchronization state is supported.
+func adjtimex(t *kernel.Task, addr hostarch.Addr) (uintptr, *kernel.SyscallControl, error) {
+	var tx linux.Timex
+	if _, err := tx.CopyIn(t, addr); err != nil {
+		return 0, nil, err
+	}
+	if tx.Modes != 0 && tx.Modes != linux.ADJ_OFFSET_SS_READ {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	// Compare kernel/time/ntp.c:__do_adjtimex(). No offset adjustment is
+	// ever in progress.
+	ntp := t.Kernel().Timekeeper().NTPState()
+	now := t.Kernel().RealtimeClock().Now()
+	tx = linux.Timex{
+		Modes:     tx.Modes,
+		MaxError:  ntp.MaxError,
+		EstError:  ntp.EstError,
+		Status:    ntp.Status,
+		Precision: 1,
+		Tolerance: 500 << 16, // MAXFREQ_SCALED / PPM_SCALE
+		Tick:      int64(linux.ClockTick / time.Microsecond),
+		TAI:       ntp.TAIOffset,
+	}
+	sec, nsec := now.Unix()
+	tx.Time.Sec = sec
+	if ntp.Status&linux.STA_NANO != 0 {
+		// tv_usec holds nanoseconds in this case.
+		tx.Time.Usec = nsec
+	} else {
+		tx.Time.Usec = nsec / int64(time.Microsecond)
+	}
+	if _, err := tx.CopyOut(t, addr); err != nil {
+		return 0, nil, err
+	}
+
+	switch {
+	case ntp.Status&(linux.STA_UNSYNC|linux.STA_CLOCKERR) != 0:
+		return linux.TIME_ERROR, nil, nil
+	case ntp.Status&linux.STA_INS != 0:
+		return linux.TIME_INS, nil, nil
+	case ntp.Status&linux.STA_DEL != 0:
+		return linux.TIME_DEL, nil, nil
+	default:
+		return linux.TIME_OK, nil, nil
+	}
+}
+
 // Time implements linux syscall time(2).
 func Time(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
@@ -212,18 +348,22 @@ func ClockNanosleep(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (
 		return 0, nil, linuxerr.EINVAL
 	}
 
-	// Only allow clock constants also allowed by Linux. (CLOCK_TAI is
-	// unimplemented.)
+	// Only allow clock constants also allowed by Linux.
 	if clockID > 0 {
 		if clockID != linux.CLOCK_REALTIME &&
 			clockID != linux.CLOCK_MONOTONIC &&
 			clockID != linux.CLOCK_BOOTTIME &&
+			clockID != linux.CLOCK_TAI &&
 			clockID != linux.CLOCK_PROCESS_CPUTIME_ID {
 			return 0, nil, linuxerr.EINVAL
 		}
 	}
+	// As in Linux, dynamic clocks do not support sleeping.
+	if isFDClock(clockID) {
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
 
-	c, err := getClock(t, clockID)
+	c, err := getClock(t, clockID, true /* forTimer */)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -105,7 +105,11 @@ func TimerCreate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	sevp := args[1].Pointer()
 	timerIDp := args[2].Pointer()
 
-	c, err := getClock(t, clockID)
+	// As in Linux, dynamic clocks do not support timers.
+	if isFDClock(clockID) {
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+	c, err := getClock(t, clockID, true /* forTimer */)
 	if err != nil {
 		return 0, nil, err
 	}
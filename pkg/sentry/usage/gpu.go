@@ -0,0 +1,118 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+// GPUMemoryLocked tracks device memory allocated by the application on GPUs
+// proxied by the sentry. It is safe for concurrent use.
+type GPUMemoryLocked struct {
+	mu gpuMemoryMutex
+	// enabled is true if GPU proxying is enabled in this sandbox.
+	enabled bool
+	// devices maps GPU device instances to the number of bytes allocated on
+	// them.
+	devices map[uint32]uint64
+	// clients maps driver client handles to the number of bytes allocated by
+	// them.
+	clients map[uint32]uint64
+}
+
+// GPUMemoryStats is a snapshot of GPUMemoryLocked.
+type GPUMemoryStats struct {
+	// Total is the number of bytes allocated on all devices.
+	Total uint64
+
+	// Devices maps GPU device instances to the number of bytes allocated on
+	// them. Devices with no allocations are omitted.
+	Devices map[uint32]uint64
+
+	// Clients maps driver client handles to the number of bytes allocated by
+	// them. Clients with no allocations are omitted.
+	Clients map[uint32]uint64
+}
+
+// Enable marks GPU memory accounting as enabled, indicating that the
+// application may allocate GPU memory.
+func (g *GPUMemoryLocked) Enable() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.enabled = true
+}
+
+// Enabled returns true if Enable has been called.
+func (g *GPUMemoryLocked) Enabled() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.enabled
+}
+
+// Inc adds an allocation of val bytes on device by client.
+func (g *GPUMemoryLocked) Inc(device, client uint32, val uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.devices == nil {
+		g.devices = make(map[uint32]uint64)
+		g.clients = make(map[uint32]uint64)
+	}
+	g.devices[device] += val
+	g.clients[client] += val
+}
+
+// Dec removes an allocation of val bytes on device by client, which must have
+// previously been added by Inc.
+func (g *GPUMemoryLocked) Dec(device, client uint32, val uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.devices[device] -= val; g.devices[device] == 0 {
+		delete(g.devices, device)
+	}
+	if g.clients[client] -= val; g.clients[client] == 0 {
+		delete(g.clients, client)
+	}
+}
+
+// Total returns the number of bytes allocated on all devices.
+func (g *GPUMemoryLocked) Total() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var total uint64
+	for _, val := range g.devices {
+		total += val
+	}
+	return total
+}
+
+// Copy returns a snapshot of g.
+func (g *GPUMemoryLocked) Copy() GPUMemoryStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := GPUMemoryStats{
+		Devices: make(map[uint32]uint64, len(g.devices)),
+		Clients: make(map[uint32]uint64, len(g.clients)),
+	}
+	for device, val := range g.devices {
+		stats.Devices[device] = val
+		stats.Total += val
+	}
+	for client, val := range g.clients {
+		stats.Clients[client] = val
+	}
+	return stats
+}
+
+// GPUMemoryAccounting is the global GPU memory stats.
+//
+// There is no need to save or restore GPU memory accounting, since GPU state
+// is not saved.
+var GPUMemoryAccounting GPUMemoryLocked
@@ -73,6 +73,18 @@ const (
 	//
 	// This memory kind is backed by the host pagecache, via host mmaps.
 	Mapped
+
+	// Shmem represents shared anonymous application memory: System V shared
+	// memory segments and MAP_SHARED|MAP_ANONYMOUS mappings.
+	//
+	// This memory kind is backed by platform memory.
+	Shmem
+
+	// Stack represents private anonymous application memory in mappings that
+	// grow down, i.e. thread stacks.
+	//
+	// This memory kind is backed by platform memory.
+	Stack
 )
 
 // memoryStats tracks application memory usage in bytes. All fields correspond to the
@@ -86,6 +98,8 @@ type memoryStats struct {
 	Tmpfs     atomicbitops.Uint64
 	Mapped    atomicbitops.Uint64
 	Ramdiskfs atomicbitops.Uint64
+	Shmem     atomicbitops.Uint64
+	Stack     atomicbitops.Uint64
 }
 
 // incLocked adds a usage of 'val' bytes from memory category 'kind'.
@@ -105,6 +119,10 @@ func (ms *memoryStats) incLocked(val uint64, kind MemoryKind) {
 		ms.Tmpfs.Add(val)
 	case Ramdiskfs:
 		ms.Ramdiskfs.Add(val)
+	case Shmem:
+		ms.Shmem.Add(val)
+	case Stack:
+		ms.Stack.Add(val)
 	default:
 		panic(fmt.Sprintf("invalid memory kind: %v", kind))
 	}
@@ -127,6 +145,10 @@ func (ms *memoryStats) decLocked(val uint64, kind MemoryKind) {
 		ms.Tmpfs.Add(^(val - 1))
 	case Ramdiskfs:
 		ms.Ramdiskfs.Add(^(val - 1))
+	case Shmem:
+		ms.Shmem.Add(^(val - 1))
+	case Stack:
+		ms.Stack.Add(^(val - 1))
 	default:
 		panic(fmt.Sprintf("invalid memory kind: %v", kind))
 	}
@@ -142,6 +164,8 @@ func (ms *memoryStats) totalLocked() (total uint64) {
 	total += ms.Mapped.RacyLoad()
 	total += ms.Tmpfs.RacyLoad()
 	total += ms.Ramdiskfs.RacyLoad()
+	total += ms.Shmem.RacyLoad()
+	total += ms.Stack.RacyLoad()
 	return
 }
 
@@ -156,6 +180,8 @@ func (ms *memoryStats) copyLocked() MemoryStats {
 		Tmpfs:     ms.Tmpfs.RacyLoad(),
 		Mapped:    ms.Mapped.RacyLoad(),
 		Ramdiskfs: ms.Ramdiskfs.RacyLoad(),
+		Shmem:     ms.Shmem.RacyLoad(),
+		Stack:     ms.Stack.RacyLoad(),
 	}
 }
 
@@ -168,6 +194,32 @@ type MemoryStats struct {
 	Tmpfs     uint64
 	Mapped    uint64
 	Ramdiskfs uint64
+	Shmem     uint64
+	Stack     uint64
+}
+
+// Add adds the usage in other to ms.
+func (ms *MemoryStats) Add(other MemoryStats) {
+	ms.System += other.System
+	ms.Anonymous += other.Anonymous
+	ms.PageCache += other.PageCache
+	ms.Tmpfs += other.Tmpfs
+	ms.Mapped += other.Mapped
+	ms.Ramdiskfs += other.Ramdiskfs
+	ms.Shmem += other.Shmem
+	ms.Stack += other.Stack
+}
+
+// Cache returns the usage that Linux reports as page cache: memory backing
+// files, including tmpfs and shared anonymous memory.
+func (ms *MemoryStats) Cache() uint64 {
+	return ms.PageCache + ms.Mapped + ms.Tmpfs + ms.Shmem
+}
+
+// RSS returns the usage that Linux reports as anonymous memory, excluding
+// shared memory.
+func (ms *MemoryStats) RSS() uint64 {
+	return ms.Anonymous + ms.Stack
 }
 
 // RTMemoryStats contains the memory usage values that need to be directly
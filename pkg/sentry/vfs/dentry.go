@@ -140,6 +140,21 @@ type DentryImpl interface {
 	OnZeroWatches(ctx context.Context)
 }
 
+// OnFirstWatchDentryImpl is an optional interface that DentryImpls can
+// implement to be notified when a dentry gains its first inotify watch, e.g.
+// to start watching the file for changes made outside of the sandbox.
+type OnFirstWatchDentryImpl interface {
+	// OnFirstWatch is called after the number of watches on a dentry becomes
+	// non-zero. The caller holds a reference on the dentry, and no inotify
+	// locks.
+	//
+	// OnFirstWatch and OnZeroWatches are called after the fact, and may run
+	// concurrently with each other and with later changes to the dentry's
+	// watches. Implementations should act on the current number of watches
+	// rather than on the transition that triggered the call.
+	OnFirstWatch(ctx context.Context)
+}
+
 // IncRef increments d's reference count.
 func (d *Dentry) IncRef() {
 	d.impl.IncRef()
@@ -193,6 +208,14 @@ func (d *Dentry) Watches() *Watches {
 	return d.impl.Watches()
 }
 
+// OnFirstWatch notifies d's implementation, if it implements
+// OnFirstWatchDentryImpl, that d gained its first watch.
+func (d *Dentry) OnFirstWatch(ctx context.Context) {
+	if impl, ok := d.impl.(OnFirstWatchDentryImpl); ok {
+		impl.OnFirstWatch(ctx)
+	}
+}
+
 // OnZeroWatches performs cleanup tasks whenever the number of watches on a
 // dentry drops to zero.
 func (d *Dentry) OnZeroWatches(ctx context.Context) {
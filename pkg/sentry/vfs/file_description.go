@@ -698,7 +698,7 @@ func (fd *FileDescription) Seek(ctx context.Context, offset int64, whence int32)
 
 // Sync has the semantics of fsync(2).
 func (fd *FileDescription) Sync(ctx context.Context) error {
-	return fd.impl.Sync(ctx)
+	return fd.vd.mount.sync(ctx, fd)
 }
 
 // ConfigureMMap mutates opts to implement mmap(2) for the file represented by
@@ -805,7 +805,7 @@ func (fd *FileDescription) RemoveXattr(ctx context.Context, name string) error {
 // SyncFS instructs the filesystem containing fd to execute the semantics of
 // syncfs(2).
 func (fd *FileDescription) SyncFS(ctx context.Context) error {
-	return fd.vd.mount.fs.impl.Sync(ctx)
+	return fd.vd.mount.sync(ctx, nil /* fd */)
 }
 
 // MappedName implements memmap.MappingIdentity.MappedName.
@@ -0,0 +1,239 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Phases of a FilesystemContext, analogous to enum fs_context_phase in Linux.
+const (
+	// fsContextAwaitingCreate is the initial phase, in which parameters are
+	// set with fsconfig(2).
+	fsContextAwaitingCreate = iota
+
+	// fsContextAwaitingMount is the phase after FSCONFIG_CMD_CREATE, in which
+	// the filesystem can be mounted with fsmount(2).
+	fsContextAwaitingMount
+
+	// fsContextMounted is the phase after fsmount(2).
+	fsContextMounted
+
+	// fsContextFailed is the phase after FSCONFIG_CMD_CREATE failed.
+	fsContextFailed
+)
+
+// FilesystemContext is the file description returned by fsopen(2). It
+// accumulates the parameters of a new filesystem, creates it and mounts it.
+// FilesystemContext implements FileDescriptionImpl.
+//
+// FilesystemContext is analogous to Linux's struct fs_context.
+//
+// +stateify savable
+type FilesystemContext struct {
+	vfsfd FileDescription
+	FileDescriptionDefaultImpl
+	DentryMetadataFileDescriptionImpl
+	NoLockFD
+
+	// fsTypeName is the name of the filesystem type. It is immutable.
+	fsTypeName string
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// phase is the current phase of the context.
+	phase int
+
+	// source is the "source" parameter.
+	source string
+
+	// data holds the filesystem-specific parameters, in the format passed to
+	// mount(2).
+	data []string
+
+	// readOnly is true if the "ro" flag was set. The filesystem is then
+	// mounted read-only.
+	readOnly bool
+
+	// fs and root are the created filesystem and its root. They are set in
+	// fsContextAwaitingMount and later phases, and references are held on
+	// them.
+	fs   *Filesystem
+	root *Dentry
+}
+
+// NewFilesystemContextFD returns a FilesystemContext for a new filesystem of
+// the given type.
+func NewFilesystemContextFD(ctx context.Context, vfsObj *VirtualFilesystem, fsTypeName string, flags uint32) (*FileDescription, error) {
+	rft := vfsObj.getFilesystemType(fsTypeName)
+	if rft == nil || !rft.opts.AllowUserMount {
+		return nil, linuxerr.ENODEV
+	}
+	vd := vfsObj.NewAnonVirtualDentry("[fscontext]")
+	defer vd.DecRef(ctx)
+	fd := &FilesystemContext{fsTypeName: fsTypeName}
+	if err := fd.vfsfd.Init(fd, flags, vd.Mount(), vd.Dentry(), &FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// Release implements FileDescriptionImpl.Release.
+func (fc *FilesystemContext) Release(ctx context.Context) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.fs != nil {
+		fc.root.DecRef(ctx)
+		fc.fs.DecRef(ctx)
+		fc.fs = nil
+		fc.root = nil
+	}
+}
+
+// Read implements FileDescriptionImpl.Read. Linux queues error messages that
+// are read from the context, while gVisor only returns errnos.
+func (fc *FilesystemContext) Read(ctx context.Context, dst usermem.IOSequence, opts ReadOptions) (int64, error) {
+	return 0, linuxerr.ENODATA
+}
+
+// SetFlag implements fsconfig(FSCONFIG_SET_FLAG).
+func (fc *FilesystemContext) SetFlag(key string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.phase != fsContextAwaitingCreate {
+		return linuxerr.EBUSY
+	}
+	switch key {
+	case "":
+		return linuxerr.EINVAL
+	case "source":
+		// "source" requires a value.
+		return linuxerr.EINVAL
+	case "ro":
+		fc.readOnly = true
+	case "rw":
+		fc.readOnly = false
+	default:
+		fc.data = append(fc.data, key)
+	}
+	return nil
+}
+
+// SetString implements fsconfig(FSCONFIG_SET_STRING).
+func (fc *FilesystemContext) SetString(key, value string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.phase != fsContextAwaitingCreate {
+		return linuxerr.EBUSY
+	}
+	switch key {
+	case "":
+		return linuxerr.EINVAL
+	case "source":
+		// See fs/fs_context.c:vfs_parse_fs_param_source().
+		if fc.source != "" {
+			return linuxerr.EINVAL
+		}
+		fc.source = value
+	default:
+		// The data format passed to mount(2) can't represent values that
+		// contain commas.
+		if strings.ContainsRune(key, ',') || strings.ContainsRune(value, ',') {
+			return linuxerr.EINVAL
+		}
+		fc.data = append(fc.data, key+"="+value)
+	}
+	return nil
+}
+
+// Create implements fsconfig(FSCONFIG_CMD_CREATE).
+func (fc *FilesystemContext) Create(ctx context.Context, creds *auth.Credentials) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.phase != fsContextAwaitingCreate {
+		return linuxerr.EBUSY
+	}
+	vfsObj := fc.vfsfd.vd.mount.vfs
+	fs, root, err := vfsObj.NewFilesystem(ctx, creds, fc.source, fc.fsTypeName, &MountOptions{
+		GetFilesystemOptions: GetFilesystemOptions{
+			Data: strings.Join(fc.data, ","),
+		},
+	})
+	if err != nil {
+		fc.phase = fsContextFailed
+		return err
+	}
+	fc.fs = fs
+	fc.root = root
+	fc.phase = fsContextAwaitingMount
+	return nil
+}
+
+// Mount implements fsmount(2). It returns an O_PATH file description for the
+// root of a new detached mount of the created filesystem.
+func (fc *FilesystemContext) Mount(ctx context.Context, opts *MountOptions, flags uint32) (*FileDescription, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.phase != fsContextAwaitingMount {
+		return nil, linuxerr.EBUSY
+	}
+	if fc.readOnly {
+		opts.ReadOnly = true
+	}
+	vfsObj := fc.vfsfd.vd.mount.vfs
+	mnt := vfsObj.NewDisconnectedMount(fc.fs, fc.root, opts)
+	defer mnt.DecRef(ctx)
+	fd, err := vfsObj.newDetachedMountFD(ctx, mnt, flags)
+	if err != nil {
+		return nil, err
+	}
+	fc.phase = fsContextMounted
+	return fd, nil
+}
+
+// ParseMountAttr converts MOUNT_ATTR_* flags, as passed to fsmount(2), to
+// MountOptions.
+func ParseMountAttr(attr uint32) (MountOptions, error) {
+	const supported = linux.MOUNT_ATTR_RDONLY | linux.MOUNT_ATTR_NOSUID | linux.MOUNT_ATTR_NODEV |
+		linux.MOUNT_ATTR_NOEXEC | linux.MOUNT_ATTR__ATIME | linux.MOUNT_ATTR_NODIRATIME
+	var opts MountOptions
+	if attr&^supported != 0 {
+		return opts, linuxerr.EINVAL
+	}
+	switch attr & linux.MOUNT_ATTR__ATIME {
+	case linux.MOUNT_ATTR_RELATIME, linux.MOUNT_ATTR_STRICTATIME:
+	case linux.MOUNT_ATTR_NOATIME:
+		opts.Flags.NoATime = true
+	default:
+		return opts, linuxerr.EINVAL
+	}
+	opts.ReadOnly = attr&linux.MOUNT_ATTR_RDONLY != 0
+	opts.Flags.NoSUID = attr&linux.MOUNT_ATTR_NOSUID != 0
+	opts.Flags.NoDev = attr&linux.MOUNT_ATTR_NODEV != 0
+	opts.Flags.NoExec = attr&linux.MOUNT_ATTR_NOEXEC != 0
+	return opts, nil
+}
@@ -72,6 +72,18 @@ func (fl *FileLocks) UnlockPOSIX(ctx context.Context, uid fslock.UniqueID, r fsl
 	return nil
 }
 
+// HeldPOSIX returns the POSIX-style locks that uid holds within r, which can
+// later be restored with RestorePOSIX.
+func (fl *FileLocks) HeldPOSIX(uid fslock.UniqueID, r fslock.LockRange) []fslock.LockedRegion {
+	return fl.posix.HeldRegions(uid, r)
+}
+
+// RestorePOSIX replaces the POSIX-style locks that uid holds within r with
+// held, as returned by HeldPOSIX.
+func (fl *FileLocks) RestorePOSIX(uid fslock.UniqueID, r fslock.LockRange, held []fslock.LockedRegion) {
+	fl.posix.RestoreRegion(uid, r, held)
+}
+
 // TestPOSIX returns information about whether the specified lock can be held, in the style of the F_GETLK fcntl.
 func (fl *FileLocks) TestPOSIX(ctx context.Context, uid fslock.UniqueID, t fslock.LockType, r fslock.LockRange) (linux.Flock, error) {
 	_, ofd := uid.(*FileDescription)
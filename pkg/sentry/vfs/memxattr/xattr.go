@@ -26,6 +26,17 @@ import (
 	"gvisor.dev/gvisor/pkg/sync"
 )
 
+// xattrOverhead is the space charged for each extended attribute in addition
+// to its name and value. It is the size of Linux's struct simple_xattr.
+const xattrOverhead = 40
+
+// XattrSpace returns the space charged for an extended attribute with the
+// given name and value size. This is analogous to Linux's
+// fs/xattr.c:simple_xattr_space().
+func XattrSpace(name string, size int) int64 {
+	return xattrOverhead + int64(len(name)) + 1 + int64(size)
+}
+
 // SimpleExtendedAttributes implements extended attributes using a map of
 // names to values.
 //
@@ -59,8 +70,11 @@ func (x *SimpleExtendedAttributes) GetXattr(creds *auth.Credentials, mode linux.
 	return value, nil
 }
 
-// SetXattr sets 'value' at 'name'.
-func (x *SimpleExtendedAttributes) SetXattr(creds *auth.Credentials, mode linux.FileMode, kuid auth.KUID, opts *vfs.SetXattrOptions) error {
+// SetXattr sets 'value' at 'name'. If charge is not nil, it is called with the
+// change in the space used by the attribute, as computed by XattrSpace, before
+// the attribute is changed; if charge returns an error, the attribute is left
+// unchanged.
+func (x *SimpleExtendedAttributes) SetXattr(creds *auth.Credentials, mode linux.FileMode, kuid auth.KUID, opts *vfs.SetXattrOptions, charge func(delta int64) error) error {
 	if err := vfs.CheckXattrPermissions(creds, vfs.MayWrite, mode, kuid, opts.Name); err != nil {
 		return err
 	}
@@ -74,7 +88,7 @@ func (x *SimpleExtendedAttributes) SetXattr(creds *auth.Credentials, mode linux.
 		x.xattrs = make(map[string]string)
 	}
 
-	_, ok := x.xattrs[opts.Name]
+	old, ok := x.xattrs[opts.Name]
 	if ok && opts.Flags&linux.XATTR_CREATE != 0 {
 		return linuxerr.EEXIST
 	}
@@ -82,6 +96,15 @@ func (x *SimpleExtendedAttributes) SetXattr(creds *auth.Credentials, mode linux.
 		return linuxerr.ENODATA
 	}
 
+	if charge != nil {
+		delta := XattrSpace(opts.Name, len(opts.Value))
+		if ok {
+			delta -= XattrSpace(opts.Name, len(old))
+		}
+		if err := charge(delta); err != nil {
+			return err
+		}
+	}
 	x.xattrs[opts.Name] = opts.Value
 	return nil
 }
@@ -111,17 +134,38 @@ func (x *SimpleExtendedAttributes) ListXattr(creds *auth.Credentials, size uint6
 	return names, nil
 }
 
-// RemoveXattr removes the xattr at 'name'.
-func (x *SimpleExtendedAttributes) RemoveXattr(creds *auth.Credentials, mode linux.FileMode, kuid auth.KUID, name string) error {
+// RemoveXattr removes the xattr at 'name'. If charge is not nil, it is called
+// with the (negative) change in the space used by the attribute.
+func (x *SimpleExtendedAttributes) RemoveXattr(creds *auth.Credentials, mode linux.FileMode, kuid auth.KUID, name string, charge func(delta int64) error) error {
 	if err := vfs.CheckXattrPermissions(creds, vfs.MayWrite, mode, kuid, name); err != nil {
 		return err
 	}
 
 	x.mu.Lock()
 	defer x.mu.Unlock()
-	if _, ok := x.xattrs[name]; !ok {
+	value, ok := x.xattrs[name]
+	if !ok {
 		return linuxerr.ENODATA
 	}
+	if charge != nil {
+		if err := charge(-XattrSpace(name, len(value))); err != nil {
+			return err
+		}
+	}
 	delete(x.xattrs, name)
 	return nil
 }
+
+// SpaceUsed returns the space used by the extended attributes whose names
+// start with prefix, as computed by XattrSpace.
+func (x *SimpleExtendedAttributes) SpaceUsed(prefix string) int64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var space int64
+	for name, value := range x.xattrs {
+		if strings.HasPrefix(name, prefix) {
+			space += XattrSpace(name, len(value))
+		}
+	}
+	return space
+}
@@ -113,6 +113,18 @@ type Mount struct {
 	// umounted is true. umounted is protected by VirtualFilesystem.mountMu.
 	umounted bool
 
+	// syncPolicy determines how files on this Mount are synced. It is
+	// immutable.
+	syncPolicy SyncPolicy
+
+	// syncBatcher collects syncs if syncPolicy.Mode is SyncBatch.
+	syncBatcher syncBatcher `state:"nosave"`
+
+	// detached is true if this Mount is the root of a mount tree created by
+	// fsmount(2) or open_tree(2) that has not been attached to a mount
+	// namespace. detached is protected by VirtualFilesystem.mountMu.
+	detached bool
+
 	// The lower 63 bits of writers is the number of calls to
 	// Mount.CheckBeginWrite() that have not yet been paired with a call to
 	// Mount.EndWrite(). The MSB of writers is set if MS_RDONLY is in effect.
@@ -122,14 +134,15 @@ type Mount struct {
 
 func newMount(vfs *VirtualFilesystem, fs *Filesystem, root *Dentry, mntns *MountNamespace, opts *MountOptions) *Mount {
 	mnt := &Mount{
-		ID:       vfs.lastMountID.Add(1),
-		Flags:    opts.Flags,
-		vfs:      vfs,
-		fs:       fs,
-		root:     root,
-		ns:       mntns,
-		isShared: false,
-		refs:     atomicbitops.FromInt64(1),
+		ID:         vfs.lastMountID.Add(1),
+		Flags:      opts.Flags,
+		syncPolicy: opts.SyncPolicy,
+		vfs:        vfs,
+		fs:         fs,
+		root:       root,
+		ns:         mntns,
+		isShared:   false,
+		refs:       atomicbitops.FromInt64(1),
 	}
 	if opts.ReadOnly {
 		mnt.setReadOnlyLocked(true)
@@ -144,8 +157,9 @@ func (mnt *Mount) Options() MountOptions {
 	mnt.vfs.lockMounts()
 	defer mnt.vfs.unlockMounts(context.Background())
 	return MountOptions{
-		Flags:    mnt.Flags,
-		ReadOnly: mnt.ReadOnly(),
+		Flags:      mnt.Flags,
+		ReadOnly:   mnt.ReadOnly(),
+		SyncPolicy: mnt.syncPolicy,
 	}
 }
 
@@ -400,8 +414,9 @@ func (vfs *VirtualFilesystem) cloneMount(mnt *Mount, root *Dentry, mopts *MountO
 	opts := mopts
 	if opts == nil {
 		opts = &MountOptions{
-			Flags:    mnt.Flags,
-			ReadOnly: mnt.ReadOnly(),
+			Flags:      mnt.Flags,
+			ReadOnly:   mnt.ReadOnly(),
+			SyncPolicy: mnt.syncPolicy,
 		}
 	}
 	clone := vfs.NewDisconnectedMount(mnt.fs, root, opts)
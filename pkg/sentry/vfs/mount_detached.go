@@ -0,0 +1,137 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// Detached mounts.
+//
+// fsmount(2) and open_tree(2) with OPEN_TREE_CLONE return an O_PATH file
+// description for the root of a mount tree that isn't attached to any mount
+// namespace. The tree can be attached with move_mount(2). If the last
+// reference on the file description is dropped before then, the tree is
+// dissolved.
+//
+// Unlike in Linux, the submounts of a detached tree are only reachable by
+// path resolution once the tree is attached, and clones are never in the peer
+// group of the mount they are cloned from.
+
+// detachedMountFD is the O_PATH file description for the root of a detached
+// mount tree.
+//
+// +stateify savable
+type detachedMountFD struct {
+	opathFD
+}
+
+// Release implements FileDescriptionImpl.Release.
+func (fd *detachedMountFD) Release(ctx context.Context) {
+	mnt := fd.vfsfd.vd.mount
+	vfs := mnt.vfs
+	vfs.lockMounts()
+	defer vfs.unlockMounts(ctx)
+	if mnt.detached {
+		// The tree was never attached. This is analogous to
+		// fs/namespace.c:dissolve_on_fput() in Linux.
+		mnt.detached = false
+		vfs.abortUncomittedChildren(ctx, mnt)
+	}
+}
+
+// newDetachedMountFD returns a file description for the root of mnt, which
+// becomes the root of a detached mount tree. It takes a reference on mnt.
+//
+// Preconditions: mnt must be disconnected.
+func (vfs *VirtualFilesystem) newDetachedMountFD(ctx context.Context, mnt *Mount, flags uint32) (*FileDescription, error) {
+	vfs.lockMounts()
+	mnt.detached = true
+	vfs.unlockMounts(ctx)
+
+	fd := &detachedMountFD{}
+	if err := fd.vfsfd.Init(fd, flags|linux.O_PATH, mnt, mnt.root, &FileDescriptionOptions{}); err != nil {
+		vfs.lockMounts()
+		mnt.detached = false
+		vfs.abortUncomittedChildren(ctx, mnt)
+		vfs.unlockMounts(ctx)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// OpenTreeAt implements open_tree(2) with OPEN_TREE_CLONE. It returns an
+// O_PATH file description for the root of a detached clone of the mount at
+// pop, which includes the submounts of the mount if recursive is true.
+func (vfs *VirtualFilesystem) OpenTreeAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, recursive bool, flags uint32) (*FileDescription, error) {
+	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer vd.DecRef(ctx)
+
+	vfs.lockMounts()
+	// Internal mounts, e.g. for pipes and sockets, can't be cloned. Neither
+	// can detached trees, which can be attached and cloned instead.
+	if vd.mount.neverConnected() || vd.mount.umounted {
+		vfs.unlockMounts(ctx)
+		return nil, linuxerr.EINVAL
+	}
+	var clone *Mount
+	if recursive {
+		clone, err = vfs.cloneMountTree(ctx, vd.mount, vd.dentry, makePrivateClone, nil)
+	} else {
+		clone, err = vfs.cloneMount(vd.mount, vd.dentry, nil, makePrivateClone)
+	}
+	vfs.unlockMounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer clone.DecRef(ctx)
+	return vfs.newDetachedMountFD(ctx, clone, flags)
+}
+
+// MoveMountAt implements move_mount(2). It attaches the detached mount tree
+// whose root is at source to target.
+func (vfs *VirtualFilesystem) MoveMountAt(ctx context.Context, creds *auth.Credentials, source, target *PathOperation) error {
+	sourceVd, err := vfs.GetDentryAt(ctx, creds, source, &GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+	defer sourceVd.DecRef(ctx)
+	targetVd, err := vfs.GetDentryAt(ctx, creds, target, &GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+
+	vfs.lockMounts()
+	defer vfs.unlockMounts(ctx)
+	mnt := sourceVd.mount
+	if sourceVd.dentry != mnt.root || !mnt.detached {
+		// Moving attached mounts, as with mount(2) and MS_MOVE, is not
+		// supported.
+		vfs.delayDecRef(targetVd)
+		return linuxerr.EINVAL
+	}
+	// attachTreeLocked consumes the reference on targetVd.
+	if err := vfs.attachTreeLocked(ctx, mnt, targetVd); err != nil {
+		return err
+	}
+	mnt.detached = false
+	return nil
+}
@@ -110,6 +110,9 @@ type MountOptions struct {
 	// ReadOnly is equivalent to MS_RDONLY.
 	ReadOnly bool
 
+	// SyncPolicy determines how files on the mount are synced.
+	SyncPolicy SyncPolicy
+
 	// GetFilesystemOptions contains options to FilesystemType.GetFilesystem().
 	GetFilesystemOptions GetFilesystemOptions
 
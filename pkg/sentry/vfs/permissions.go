@@ -297,6 +297,10 @@ func CheckLimit(ctx context.Context, offset, size int64) (int64, error) {
 //     must be returned by filesystem implementations.
 //   - Does not do inode permission checks. Filesystem implementations should
 //     handle inode permission checks as they may differ across implementations.
+//     As in Linux, they are only needed if XattrNeedsInodePermissions(name).
+//
+// It also makes the checks that Linux's commoncap LSM makes for the security
+// namespace, see security/commoncap.c:cap_inode_setxattr().
 func CheckXattrPermissions(creds *auth.Credentials, ats AccessTypes, mode linux.FileMode, kuid auth.KUID, name string) error {
 	switch {
 	case strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX):
@@ -324,14 +328,35 @@ func CheckXattrPermissions(creds *auth.Credentials, ats AccessTypes, mode linux.
 			return linuxerr.EPERM
 		}
 	case strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX):
-		if ats.MayRead() {
-			return linuxerr.ENODATA
+		// Anyone can read attributes in the security.* namespace, but only
+		// privileged users can change them. File capabilities require
+		// CAP_SETFCAP instead of CAP_SYS_ADMIN.
+		if !ats.MayWrite() {
+			return nil
+		}
+		if name == linux.XATTR_NAME_CAPS {
+			if !creds.HasCapability(linux.CAP_SETFCAP) {
+				return linuxerr.EPERM
+			}
+			return nil
+		}
+		if !creds.HasCapability(linux.CAP_SYS_ADMIN) {
+			return linuxerr.EPERM
 		}
-		return linuxerr.EOPNOTSUPP
 	}
 	return nil
 }
 
+// XattrNeedsInodePermissions returns true if access to the extended attribute
+// name is subject to inode permission checks, in addition to
+// CheckXattrPermissions. As in Linux, access to the security.*, system.* and
+// trusted.* namespaces only depends on capabilities.
+func XattrNeedsInodePermissions(name string) bool {
+	return !strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX) &&
+		!strings.HasPrefix(name, linux.XATTR_SYSTEM_PREFIX) &&
+		!strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX)
+}
+
 // ClearSUIDAndSGID clears the setuid and/or setgid bits after a chown or write.
 // Depending on the mode, neither bit, only the setuid bit, or both are cleared.
 func ClearSUIDAndSGID(mode uint32) uint32 {
@@ -0,0 +1,57 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+)
+
+// QuotaFilesystemImpl is an optional interface implemented by FilesystemImpls
+// that support disk quotas, as managed by quotactl(2).
+//
+// qtype is one of linux.USRQUOTA, linux.GRPQUOTA or linux.PRJQUOTA. Quota IDs
+// are KUIDs for linux.USRQUOTA, KGIDs for linux.GRPQUOTA, and project IDs for
+// linux.PRJQUOTA. Permission checks are the caller's responsibility.
+type QuotaFilesystemImpl interface {
+	// QuotaFormat returns the format of quotas of type qtype, as returned by
+	// Q_GETFMT. It returns ESRCH if quotas of this type are not accounted.
+	QuotaFormat(qtype int) (uint32, error)
+
+	// QuotaOn starts enforcing quota limits of type qtype.
+	QuotaOn(ctx context.Context, qtype int) error
+
+	// QuotaOff stops enforcing quota limits of type qtype.
+	QuotaOff(ctx context.Context, qtype int) error
+
+	// GetQuotaInfo returns information about quotas of type qtype.
+	GetQuotaInfo(ctx context.Context, qtype int) (linux.IfDqinfo, error)
+
+	// SetQuotaInfo changes information about quotas of type qtype, as
+	// selected by info.Valid.
+	SetQuotaInfo(ctx context.Context, qtype int, info linux.IfDqinfo) error
+
+	// GetQuota returns the limits and usage of quota ID id of type qtype.
+	GetQuota(ctx context.Context, qtype int, id uint32) (linux.IfDqblk, error)
+
+	// SetQuota changes the limits of quota ID id of type qtype, as selected
+	// by dq.Valid.
+	SetQuota(ctx context.Context, qtype int, id uint32, dq linux.IfDqblk) error
+
+	// GetNextQuota is equivalent to GetQuota for the smallest quota ID >= id
+	// that has any usage or limits, and also returns that ID. It returns
+	// ENOENT if there is no such ID.
+	GetNextQuota(ctx context.Context, qtype int, id uint32) (uint32, linux.IfDqblk, error)
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// SyncMode determines how file syncs are handled on a mount.
+type SyncMode uint8
+
+const (
+	// SyncPassthrough syncs files when requested. This is the default.
+	SyncPassthrough SyncMode = iota
+
+	// SyncBatch delays syncs by up to SyncPolicy.MaxDelay, so that syncs
+	// requested in the meantime are performed together. Syncs still don't
+	// return until the data is durable.
+	SyncBatch
+)
+
+// DefaultSyncBatchDelay is the default SyncPolicy.MaxDelay for SyncBatch.
+const DefaultSyncBatchDelay = 5 * time.Millisecond
+
+// String implements fmt.Stringer.String.
+func (m SyncMode) String() string {
+	switch m {
+	case SyncPassthrough:
+		return "passthrough"
+	case SyncBatch:
+		return "batch"
+	default:
+		return fmt.Sprintf("SyncMode(%d)", m)
+	}
+}
+
+// ParseSyncMode parses the name of a SyncMode.
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch s {
+	case "passthrough":
+		return SyncPassthrough, nil
+	case "batch":
+		return SyncBatch, nil
+	default:
+		return 0, fmt.Errorf("invalid sync mode %q, must be one of: passthrough, batch", s)
+	}
+}
+
+// SyncPolicy determines how fsync(2), fdatasync(2), sync_file_range(2) and
+// syncfs(2) are handled for files on a mount. sync(2) always syncs all
+// filesystems.
+//
+// +stateify savable
+type SyncPolicy struct {
+	// Mode is the sync mode.
+	Mode SyncMode
+
+	// MaxDelay is the maximum time by which syncs are delayed with SyncBatch.
+	// If it is zero, DefaultSyncBatchDelay is used.
+	MaxDelay time.Duration
+}
+
+// BatchSyncFilesystemImpl is an optional interface implemented by
+// FilesystemImpls that can sync several files more efficiently together than
+// one at a time.
+type BatchSyncFilesystemImpl interface {
+	// SyncFiles syncs the files represented by fds, which all belong to the
+	// filesystem. It returns the first error encountered, but attempts to sync
+	// all files.
+	SyncFiles(ctx context.Context, fds []*FileDescription) error
+}
+
+// syncBatch is a set of syncs that are performed together.
+type syncBatch struct {
+	// fds are the file descriptions to sync. A reference is held on each.
+	fds map[*FileDescription]struct{}
+
+	// syncFS is true if the whole filesystem is synced, in which case fds
+	// don't need to be synced individually.
+	syncFS bool
+
+	// done is closed when the batch has been synced.
+	done chan struct{}
+
+	// err is the result of the batch. It is only valid after done is closed.
+	err error
+}
+
+// syncBatcher collects syncs on a mount into batches.
+type syncBatcher struct {
+	mu sync.Mutex
+
+	// next is the batch that new syncs join, or nil if no batch is pending.
+	next *syncBatch
+}
+
+// sync syncs fd, or the whole filesystem if fd is nil, according to
+// mnt.syncPolicy.
+func (mnt *Mount) sync(ctx context.Context, fd *FileDescription) error {
+	switch mnt.syncPolicy.Mode {
+	case SyncBatch:
+		return mnt.syncBatched(ctx, fd)
+	default:
+		if fd == nil {
+			return mnt.fs.impl.Sync(ctx)
+		}
+		return fd.impl.Sync(ctx)
+	}
+}
+
+// syncBatched adds fd, or the whole filesystem if fd is nil, to the pending
+// batch and waits for the batch to be synced. The first caller to join a
+// batch waits for mnt.syncPolicy.MaxDelay and then syncs the batch on behalf
+// of all callers.
+func (mnt *Mount) syncBatched(ctx context.Context, fd *FileDescription) error {
+	b := &mnt.syncBatcher
+	b.mu.Lock()
+	batch := b.next
+	leader := batch == nil
+	if leader {
+		batch = &syncBatch{
+			fds:  make(map[*FileDescription]struct{}),
+			done: make(chan struct{}),
+		}
+		b.next = batch
+	}
+	if fd == nil {
+		batch.syncFS = true
+	} else if _, ok := batch.fds[fd]; !ok {
+		fd.IncRef()
+		batch.fds[fd] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	if !leader {
+		ctx.UninterruptibleSleepStart(false)
+		<-batch.done
+		ctx.UninterruptibleSleepFinish(false)
+		return batch.err
+	}
+
+	delay := mnt.syncPolicy.MaxDelay
+	if delay == 0 {
+		delay = DefaultSyncBatchDelay
+	}
+	// If the wait is interrupted, sync the batch early rather than failing
+	// syncs that joined it.
+	expired := make(chan struct{})
+	timer := time.AfterFunc(delay, func() { close(expired) })
+	_ = ctx.Block(expired)
+	timer.Stop()
+	b.mu.Lock()
+	b.next = nil
+	b.mu.Unlock()
+
+	batch.err = mnt.syncBatch(ctx, batch)
+	close(batch.done)
+	return batch.err
+}
+
+// syncBatch syncs the files in batch and releases the references held on
+// them.
+func (mnt *Mount) syncBatch(ctx context.Context, batch *syncBatch) error {
+	fds := make([]*FileDescription, 0, len(batch.fds))
+	for fd := range batch.fds {
+		fds = append(fds, fd)
+	}
+	defer func() {
+		for _, fd := range fds {
+			fd.DecRef(ctx)
+		}
+	}()
+
+	if batch.syncFS {
+		return mnt.fs.impl.Sync(ctx)
+	}
+	if bfs, ok := mnt.fs.impl.(BatchSyncFilesystemImpl); ok && len(fds) > 1 {
+		return bfs.SyncFiles(ctx, fds)
+	}
+	var retErr error
+	for _, fd := range fds {
+		if err := fd.impl.Sync(ctx); err != nil && retErr == nil {
+			retErr = err
+		}
+	}
+	return retErr
+}
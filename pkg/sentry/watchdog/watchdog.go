@@ -26,19 +26,36 @@
 //     If a tasks continues to be stuck, the message will repeat every minute, unless
 //     a new stuck task is detected
 //  2. Panic: same as above, followed by panic()
+//  3. KillTask: same as LogWarning, followed by sending SIGKILL to the process
+//     of each newly stuck task.
+//  4. KillContainer: same as LogWarning, followed by sending SIGKILL to all
+//     processes in the container of each newly stuck task.
+//
+// The warning message for newly stuck tasks includes the stack of their task
+// goroutines, and the syscall number, instruction pointer and top of the stack
+// of the application at syscall entry.
+//
+// Note that SIGKILL only terminates a stuck task once it returns from the
+// syscall or blocks interruptibly. The kill actions therefore recover from
+// tasks that are slow or blocked in the sentry, but not from tasks that never
+// leave the sentry.
 package watchdog
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/metric"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
 )
 
 // Opts configures the watchdog.
@@ -79,6 +96,14 @@ const descheduleThreshold = 1 * time.Second
 // Amount of time to wait before dumping the stack to the log again when the same task(s) remains stuck.
 var stackDumpSameTaskPeriod = time.Minute
 
+// diagnosticsTimeout is the amount of time to wait for the application state
+// of a stuck task. The stuck task may be holding locks needed to read it.
+const diagnosticsTimeout = 5 * time.Second
+
+// userStackSize is the number of bytes at the top of the application stack to
+// include in the report of a stuck task.
+const userStackSize = 256
+
 // Action defines what action to take when a stuck task is detected.
 type Action int
 
@@ -88,6 +113,14 @@ const (
 
 	// Panic will do the same logging as LogWarning and panic().
 	Panic
+
+	// KillTask will do the same logging as LogWarning and kill the process of
+	// each newly stuck task.
+	KillTask
+
+	// KillContainer will do the same logging as LogWarning and kill all
+	// processes in the container of each newly stuck task.
+	KillContainer
 )
 
 // Set implements flag.Value.
@@ -97,6 +130,10 @@ func (a *Action) Set(v string) error {
 		*a = LogWarning
 	case "panic":
 		*a = Panic
+	case "kill-task":
+		*a = KillTask
+	case "kill-container":
+		*a = KillContainer
 	default:
 		return fmt.Errorf("invalid watchdog action %q", v)
 	}
@@ -115,6 +152,10 @@ func (a Action) String() string {
 		return "logWarning"
 	case Panic:
 		return "panic"
+	case KillTask:
+		return "kill-task"
+	case KillContainer:
+		return "kill-container"
 	default:
 		panic(fmt.Sprintf("Invalid watchdog action: %d", a))
 	}
@@ -279,7 +320,7 @@ func (w *Watchdog) runTurn() {
 	}
 
 	newOffenders := make(map[*kernel.Task]*offender)
-	newTaskFound := false
+	var newTasks []*kernel.Task
 	now := ktime.FromNanoseconds(int64(w.k.CPUClockNow() * uint64(linux.ClockTick)))
 
 	// The process may be running with low CPU limit making tasks appear stuck because
@@ -310,32 +351,154 @@ func (w *Watchdog) runTurn() {
 					// Task.UninterruptibleSleepStart/Finish.
 					tc = &offender{lastUpdateTime: lastUpdateTime}
 					metric.WeirdnessMetric.Increment(&metric.WeirdnessTypeWatchdogStuckTasks)
-					newTaskFound = true
+					newTasks = append(newTasks, t)
 				}
 				newOffenders[t] = tc
 			}
 		}
 	}
 	if len(newOffenders) > 0 {
-		w.report(newOffenders, newTaskFound, now)
+		w.report(newOffenders, newTasks, now)
 	}
 
 	// Remember which tasks have been reported.
 	w.offenders = newOffenders
 }
 
-// report takes appropriate action when a stuck task is detected.
-func (w *Watchdog) report(offenders map[*kernel.Task]*offender, newTaskFound bool, now ktime.Time) {
+// report takes appropriate action when a stuck task is detected. newTasks are
+// the offenders that were not stuck in the previous turn.
+func (w *Watchdog) report(offenders map[*kernel.Task]*offender, newTasks []*kernel.Task, now ktime.Time) {
 	var buf bytes.Buffer
 	buf.WriteString(fmt.Sprintf("Sentry detected %d stuck task(s):\n", len(offenders)))
 	for t, o := range offenders {
 		tid := w.k.TaskSet().Root.IDOfTask(t)
 		buf.WriteString(fmt.Sprintf("\tTask tid: %v (goroutine %d), entered RunSys state %v ago.\n", tid, t.GoroutineID(), now.Sub(o.lastUpdateTime)))
 	}
+	if len(newTasks) > 0 {
+		stacks := log.Stacks(true)
+		for _, t := range newTasks {
+			w.describeTask(&buf, t, stacks)
+		}
+	}
 	buf.WriteString("Search for 'goroutine <id>' in the stack dump to find the offending goroutine(s)")
 
 	// Force stack dump only if a new task is detected.
-	w.doAction(w.TaskTimeoutAction, newTaskFound, &buf)
+	w.doAction(w.TaskTimeoutAction, len(newTasks) > 0, &buf)
+
+	switch w.TaskTimeoutAction {
+	case KillTask:
+		for _, t := range newTasks {
+			w.killTask(t)
+		}
+	case KillContainer:
+		killed := make(map[string]struct{})
+		for _, t := range newTasks {
+			cid := t.ContainerID()
+			if _, ok := killed[cid]; ok {
+				continue
+			}
+			killed[cid] = struct{}{}
+			w.killContainer(cid)
+		}
+	}
+}
+
+// describeTask writes the task goroutine stack and the application state of
+// the stuck task t to buf. stacks is the stack dump of all goroutines.
+func (w *Watchdog) describeTask(buf *bytes.Buffer, t *kernel.Task, stacks []byte) {
+	tid := w.k.TaskSet().Root.IDOfTask(t)
+	sysno, ip, sp := t.LastSyscall()
+	buf.WriteString(fmt.Sprintf("Task tid: %v (%s), container %q, syscall %d, application IP: %#x, SP: %#x\n", tid, t.Name(), t.ContainerID(), sysno, ip, sp))
+
+	// Reading application memory may block if the stuck task holds the
+	// MemoryManager's locks, so don't wait for it indefinitely.
+	stack := make(chan string, 1)
+	go func() { // S/R-SAFE: watchdog is stopped during save and restarted after restore.
+		stack <- w.userStack(t, sp)
+	}()
+	select {
+	case s := <-stack:
+		buf.WriteString(s)
+	case <-time.After(diagnosticsTimeout):
+		buf.WriteString("\tApplication stack: timed out\n")
+	}
+
+	if g := goroutineStack(stacks, t.GoroutineID()); g != nil {
+		buf.Write(g)
+		buf.WriteString("\n")
+	} else {
+		buf.WriteString(fmt.Sprintf("\tgoroutine %d not found\n", t.GoroutineID()))
+	}
+}
+
+// userStack returns the top of t's application stack at sp, as words.
+func (w *Watchdog) userStack(t *kernel.Task, sp hostarch.Addr) string {
+	var m *mm.MemoryManager
+	t.WithMuLocked(func(t *kernel.Task) {
+		m = t.MemoryManager()
+	})
+	if m == nil || !m.IncUsers() {
+		return "\tApplication stack: no address space\n"
+	}
+	ctx := w.k.SupervisorContext()
+	defer m.DecUsers(ctx)
+
+	data := make([]byte, userStackSize)
+	n, err := m.CopyIn(ctx, sp, data, usermem.IOOpts{})
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("\tApplication stack (%d bytes):", n))
+	for i := 0; i+8 <= n; i += 8 {
+		if i%32 == 0 {
+			buf.WriteString(fmt.Sprintf("\n\t\t%#x:", sp+hostarch.Addr(i)))
+		}
+		buf.WriteString(fmt.Sprintf(" %016x", binary.LittleEndian.Uint64(data[i:])))
+	}
+	if err != nil {
+		buf.WriteString(fmt.Sprintf("\n\t\t(error: %v)", err))
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// goroutineStack returns the stack of goroutine goid in stacks, which is in
+// the format returned by runtime.Stack, or nil if it is not found.
+func goroutineStack(stacks []byte, goid int64) []byte {
+	prefix := []byte(fmt.Sprintf("goroutine %d [", goid))
+	for _, s := range bytes.Split(stacks, []byte("\n\n")) {
+		if bytes.HasPrefix(s, prefix) {
+			return s
+		}
+	}
+	return nil
+}
+
+// killTask sends SIGKILL to t's process.
+func (w *Watchdog) killTask(t *kernel.Task) {
+	tid := w.k.TaskSet().Root.IDOfTask(t)
+	log.Warningf("Watchdog killing process of stuck task tid: %v", tid)
+	// Don't block the watchdog if the signal mutex is held by a stuck task.
+	go func() { // S/R-SAFE: watchdog is stopped during save and restarted after restore.
+		if err := w.k.SendExternalSignalThreadGroup(t.ThreadGroup(), &linux.SignalInfo{
+			Signo: int32(linux.SIGKILL),
+			Code:  linux.SI_KERNEL,
+		}); err != nil {
+			log.Warningf("Watchdog failed to kill process of stuck task tid %v: %v", tid, err)
+		}
+	}()
+}
+
+// killContainer sends SIGKILL to all processes in container cid.
+func (w *Watchdog) killContainer(cid string) {
+	log.Warningf("Watchdog killing container %q with stuck task(s)", cid)
+	// Don't block the watchdog if the signal mutex is held by a stuck task.
+	go func() { // S/R-SAFE: watchdog is stopped during save and restarted after restore.
+		if err := w.k.SendContainerSignal(cid, &linux.SignalInfo{
+			Signo: int32(linux.SIGKILL),
+			Code:  linux.SI_KERNEL,
+		}); err != nil {
+			log.Warningf("Watchdog failed to kill container %q: %v", cid, err)
+		}
+	}()
 }
 
 func (w *Watchdog) reportStuckWatchdog() {
@@ -347,9 +510,12 @@ func (w *Watchdog) reportStuckWatchdog() {
 // doAction will take the given action. If the action is LogWarning, the stack
 // is not always dumped to the log to prevent log flooding. "forceStack"
 // guarantees that the stack will be dumped regardless.
+//
+// KillTask and KillContainer only log here; killing is done by the caller,
+// since it requires the stuck tasks.
 func (w *Watchdog) doAction(action Action, forceStack bool, msg *bytes.Buffer) {
 	switch action {
-	case LogWarning:
+	case LogWarning, KillTask, KillContainer:
 		// Dump stack only if forced or sometime has passed since the last time a
 		// stack dump was generated.
 		if !forceStack && time.Since(w.lastStackDump) < stackDumpSameTaskPeriod {
@@ -0,0 +1,336 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chunkstore implements a content-addressed store for checkpoint
+// image data.
+//
+// Memory is split into chunks that are stored once, keyed by their SHA-256
+// hash, so that successive checkpoints of the same sandbox only write chunks
+// that changed, and identical chunks are only stored once.
+//
+// A store consists of two files: a pack file holding chunk data, and an index
+// file. The index starts with a magic number, followed by fixed-size records
+// mapping each chunk hash to its location in the pack file. Both files are
+// append-only; chunk data is written before the index record that refers to
+// it, so an interrupted write at worst leaves unreferenced data in the pack
+// file. Unreferenced chunks are removed by Compact.
+package chunkstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// HashSize is the size of a chunk hash.
+const HashSize = sha256.Size
+
+// Hash is the hash of a chunk's contents.
+type Hash [HashSize]byte
+
+// String implements fmt.Stringer.
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// magic identifies index files, including the format version.
+var magic = [8]byte{'G', 'V', 'C', 'H', 'U', 'N', 'K', 1}
+
+// recordSize is the size of an index record: hash, offset (8 bytes), length
+// (4 bytes) and 4 reserved bytes.
+const recordSize = HashSize + 16
+
+// MaxChunkSize is the maximum size of a chunk.
+const MaxChunkSize = 1 << 30
+
+// File is the interface required of index and pack files. It's implemented
+// by *os.File.
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	Stat() (os.FileInfo, error)
+}
+
+// location is the location of a chunk in the pack file.
+type location struct {
+	offset uint64
+	length uint32
+}
+
+// Store is a content-addressed chunk store.
+type Store struct {
+	index File
+	pack  File
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// chunks maps chunk hashes to their location.
+	chunks map[Hash]location
+
+	// indexEnd and packEnd are the offsets where the next index record and
+	// chunk are written.
+	indexEnd int64
+	packEnd  int64
+
+	// used is the set of chunks that were stored or found by Put since the
+	// store was opened.
+	used map[Hash]struct{}
+
+	// written is the number of bytes of chunk data written by Put.
+	written uint64
+}
+
+// Open opens the store backed by the given index and pack files. If the
+// index is empty, a new store is initialized.
+func Open(index, pack File) (*Store, error) {
+	s := &Store{
+		index:  index,
+		pack:   pack,
+		chunks: make(map[Hash]location),
+		used:   make(map[Hash]struct{}),
+	}
+	info, err := index.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		if _, err := index.WriteAt(magic[:], 0); err != nil {
+			return nil, fmt.Errorf("initializing index: %w", err)
+		}
+		s.indexEnd = int64(len(magic))
+	} else if err := s.loadIndex(info.Size()); err != nil {
+		return nil, err
+	}
+
+	info, err = pack.Stat()
+	if err != nil {
+		return nil, err
+	}
+	s.packEnd = info.Size()
+	for h, loc := range s.chunks {
+		if end := int64(loc.offset) + int64(loc.length); end > s.packEnd {
+			return nil, fmt.Errorf("chunk %v at [%d, %d) is past the end of the pack file (%d bytes)", h, loc.offset, end, s.packEnd)
+		}
+	}
+	return s, nil
+}
+
+// loadIndex reads all index records.
+func (s *Store) loadIndex(size int64) error {
+	r := io.NewSectionReader(s.index, 0, size)
+	var hdr [len(magic)]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return fmt.Errorf("reading index header: %w", err)
+	}
+	if hdr != magic {
+		return fmt.Errorf("invalid index header %x", hdr)
+	}
+	s.indexEnd = int64(len(magic))
+	var rec [recordSize]byte
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				// A truncated record is the result of an interrupted write,
+				// and its chunk is not referenced by any image. It will be
+				// overwritten by the next record.
+				return nil
+			}
+			return fmt.Errorf("reading index: %w", err)
+		}
+		var h Hash
+		copy(h[:], rec[:HashSize])
+		s.chunks[h] = location{
+			offset: binary.LittleEndian.Uint64(rec[HashSize:]),
+			length: binary.LittleEndian.Uint32(rec[HashSize+8:]),
+		}
+		s.indexEnd += recordSize
+	}
+}
+
+// Put stores data, if no chunk with the same contents is already stored, and
+// returns its hash.
+func (s *Store) Put(data []byte) (Hash, error) {
+	if len(data) > MaxChunkSize {
+		return Hash{}, fmt.Errorf("chunk too large: %d bytes", len(data))
+	}
+	h := Hash(sha256.Sum256(data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used[h] = struct{}{}
+	if _, ok := s.chunks[h]; ok {
+		return h, nil
+	}
+	loc := location{offset: uint64(s.packEnd), length: uint32(len(data))}
+	if _, err := s.pack.WriteAt(data, s.packEnd); err != nil {
+		return Hash{}, fmt.Errorf("writing chunk: %w", err)
+	}
+	s.packEnd += int64(len(data))
+	if err := s.appendRecordLocked(h, loc); err != nil {
+		return Hash{}, err
+	}
+	s.written += uint64(len(data))
+	return h, nil
+}
+
+// appendRecordLocked adds a record for a chunk to the index.
+//
+// Preconditions: s.mu is locked.
+func (s *Store) appendRecordLocked(h Hash, loc location) error {
+	var rec [recordSize]byte
+	copy(rec[:], h[:])
+	binary.LittleEndian.PutUint64(rec[HashSize:], loc.offset)
+	binary.LittleEndian.PutUint32(rec[HashSize+8:], loc.length)
+	if _, err := s.index.WriteAt(rec[:], s.indexEnd); err != nil {
+		return fmt.Errorf("writing index: %w", err)
+	}
+	s.indexEnd += recordSize
+	s.chunks[h] = loc
+	return nil
+}
+
+// Get reads the chunk with hash h into dst, which must be exactly as large
+// as the chunk. The contents are verified against the hash.
+func (s *Store) Get(h Hash, dst []byte) error {
+	s.mu.Lock()
+	loc, ok := s.chunks[h]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("chunk %v not found", h)
+	}
+	if int(loc.length) != len(dst) {
+		return fmt.Errorf("chunk %v has %d bytes, want %d", h, loc.length, len(dst))
+	}
+	if _, err := s.pack.ReadAt(dst, int64(loc.offset)); err != nil {
+		return fmt.Errorf("reading chunk %v: %w", h, err)
+	}
+	if Hash(sha256.Sum256(dst)) != h {
+		return fmt.Errorf("chunk %v is corrupted", h)
+	}
+	return nil
+}
+
+// Len returns the number of chunks in the store.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.chunks)
+}
+
+// Size returns the total size of the chunks in the store.
+func (s *Store) Size() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var size uint64
+	for _, loc := range s.chunks {
+		size += uint64(loc.length)
+	}
+	return size
+}
+
+// Written returns the number of bytes of chunk data written by Put.
+func (s *Store) Written() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.written
+}
+
+// Used returns the hashes of all chunks passed to Put since the store was
+// opened, in sorted order.
+func (s *Store) Used() []Hash {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hashes := make([]Hash, 0, len(s.used))
+	for h := range s.used {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	return hashes
+}
+
+// Compact copies the chunks in s for which live returns true to dst, which
+// is usually a new, empty store.
+func (s *Store) Compact(dst *Store, live func(Hash) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Copy chunks in pack file order to read s.pack sequentially.
+	type chunk struct {
+		h   Hash
+		loc location
+	}
+	var chunks []chunk
+	for h, loc := range s.chunks {
+		if live(h) {
+			chunks = append(chunks, chunk{h, loc})
+		}
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].loc.offset < chunks[j].loc.offset
+	})
+	var buf []byte
+	for _, c := range chunks {
+		if cap(buf) < int(c.loc.length) {
+			buf = make([]byte, c.loc.length)
+		}
+		buf = buf[:c.loc.length]
+		if _, err := s.pack.ReadAt(buf, int64(c.loc.offset)); err != nil {
+			return fmt.Errorf("reading chunk %v: %w", c.h, err)
+		}
+		if Hash(sha256.Sum256(buf)) != c.h {
+			return fmt.Errorf("chunk %v is corrupted", c.h)
+		}
+		if _, err := dst.Put(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteRefs writes a list of chunk hashes, as returned by Store.Used, to w.
+// Images record the chunks they reference this way, so that Compact can
+// determine which chunks are live.
+func WriteRefs(w io.Writer, hashes []Hash) error {
+	for _, h := range hashes {
+		if _, err := w.Write(h[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRefs reads a list of chunk hashes written by WriteRefs from r, and
+// adds them to refs.
+func ReadRefs(r io.Reader, refs map[Hash]struct{}) error {
+	var h Hash
+	for {
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("reading chunk references: %w", err)
+		}
+		refs[h] = struct{}{}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chunkstore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempFiles(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+	dir := t.TempDir()
+	index, err := os.OpenFile(filepath.Join(dir, "index"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("creating index: %v", err)
+	}
+	t.Cleanup(func() { index.Close() })
+	pack, err := os.OpenFile(filepath.Join(dir, "pack"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("creating pack: %v", err)
+	}
+	t.Cleanup(func() { pack.Close() })
+	return index, pack
+}
+
+func mustOpen(t *testing.T, index, pack File) *Store {
+	t.Helper()
+	s, err := Open(index, pack)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return s
+}
+
+func mustPut(t *testing.T, s *Store, data []byte) Hash {
+	t.Helper()
+	h, err := s.Put(data)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	return h
+}
+
+func checkGet(t *testing.T, s *Store, h Hash, want []byte) {
+	t.Helper()
+	got := make([]byte, len(want))
+	if err := s.Get(h, got); err != nil {
+		t.Fatalf("Get(%v): %v", h, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Get(%v): got %q, want %q", h, got, want)
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	index, pack := tempFiles(t)
+	s := mustOpen(t, index, pack)
+
+	a := []byte("aaaa")
+	b := []byte("bbbbbbbb")
+	ha := mustPut(t, s, a)
+	hb := mustPut(t, s, b)
+	if ha == hb {
+		t.Fatalf("different chunks have the same hash")
+	}
+	if got := mustPut(t, s, a); got != ha {
+		t.Errorf("Put returned %v for the same data, want %v", got, ha)
+	}
+	if got, want := s.Len(), 2; got != want {
+		t.Errorf("Len: got %d, want %d", got, want)
+	}
+	if got, want := s.Written(), uint64(len(a)+len(b)); got != want {
+		t.Errorf("Written: got %d, want %d", got, want)
+	}
+	checkGet(t, s, ha, a)
+	checkGet(t, s, hb, b)
+
+	if err := s.Get(hb, make([]byte, 1)); err == nil {
+		t.Errorf("Get with wrong size succeeded")
+	}
+	if err := s.Get(Hash{}, nil); err == nil {
+		t.Errorf("Get of missing chunk succeeded")
+	}
+
+	// Reopen the store. Previously stored chunks are not written again.
+	s = mustOpen(t, index, pack)
+	if got := mustPut(t, s, a); got != ha {
+		t.Errorf("Put after reopen returned %v, want %v", got, ha)
+	}
+	if got := s.Written(); got != 0 {
+		t.Errorf("Written after reopen: got %d, want 0", got)
+	}
+	if got, want := s.Used(), []Hash{ha}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("Used: got %v, want %v", got, want)
+	}
+	checkGet(t, s, hb, b)
+}
+
+func TestTruncatedIndex(t *testing.T) {
+	index, pack := tempFiles(t)
+	s := mustOpen(t, index, pack)
+	a := []byte("aaaa")
+	ha := mustPut(t, s, a)
+	mustPut(t, s, []byte("bbbb"))
+
+	// Simulate a write of the last index record being interrupted.
+	info, err := index.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if err := index.Truncate(info.Size() - 1); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	s = mustOpen(t, index, pack)
+	if got, want := s.Len(), 1; got != want {
+		t.Fatalf("Len: got %d, want %d", got, want)
+	}
+	checkGet(t, s, ha, a)
+	c := []byte("cccc")
+	hc := mustPut(t, s, c)
+
+	s = mustOpen(t, index, pack)
+	checkGet(t, s, ha, a)
+	checkGet(t, s, hc, c)
+}
+
+func TestCorruption(t *testing.T) {
+	index, pack := tempFiles(t)
+	s := mustOpen(t, index, pack)
+	a := []byte("aaaa")
+	ha := mustPut(t, s, a)
+	if _, err := pack.WriteAt([]byte("x"), 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if err := s.Get(ha, make([]byte, len(a))); err == nil {
+		t.Errorf("Get of corrupted chunk succeeded")
+	}
+	if _, err := index.WriteAt([]byte("x"), 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if _, err := Open(index, pack); err == nil {
+		t.Errorf("Open with invalid index succeeded")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	index, pack := tempFiles(t)
+	s := mustOpen(t, index, pack)
+	a := []byte("aaaa")
+	b := []byte("bbbbbbbb")
+	ha := mustPut(t, s, a)
+	hb := mustPut(t, s, b)
+
+	// Compact using the references written for an image using only a.
+	var refs bytes.Buffer
+	if err := WriteRefs(&refs, []Hash{ha}); err != nil {
+		t.Fatalf("WriteRefs: %v", err)
+	}
+	live := make(map[Hash]struct{})
+	if err := ReadRefs(&refs, live); err != nil {
+		t.Fatalf("ReadRefs: %v", err)
+	}
+	newIndex, newPack := tempFiles(t)
+	dst := mustOpen(t, newIndex, newPack)
+	if err := s.Compact(dst, func(h Hash) bool {
+		_, ok := live[h]
+		return ok
+	}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	dst = mustOpen(t, newIndex, newPack)
+	if got, want := dst.Len(), 1; got != want {
+		t.Errorf("Len: got %d, want %d", got, want)
+	}
+	if got, want := dst.Size(), uint64(len(a)); got != want {
+		t.Errorf("Size: got %d, want %d", got, want)
+	}
+	checkGet(t, dst, ha, a)
+	if err := dst.Get(hb, make([]byte, len(b))); err == nil {
+		t.Errorf("Get of compacted chunk succeeded")
+	}
+}
@@ -341,7 +341,21 @@ func (od *objectDecoder) load(slot int, objPtr reflect.Value, wait bool, fn func
 	// is in terms of the local type, where the fields in the encoded
 	// object are in terms of the wire object's type, which might be in a
 	// different order (but will have the same fields).
-	v := *od.encoded.Field(od.rte.FieldOrder[slot])
+	i := od.rte.FieldOrder[slot]
+	if i < 0 {
+		// The field was added by a migration, and isn't in the encoded
+		// object. Leave it as the zero value.
+		if fn != nil {
+			fn()
+		}
+		return
+	}
+	od.loadEncoded(i, objPtr, wait, fn)
+}
+
+// loadEncoded loads the ith field of the encoded object.
+func (od *objectDecoder) loadEncoded(i int, objPtr reflect.Value, wait bool, fn func()) {
+	v := *od.encoded.Field(i)
 	od.ds.decodeObject(od.ods, objPtr.Elem(), v)
 	if wait {
 		// Mark this individual object a blocker.
@@ -387,6 +401,11 @@ func (ds *decodeState) decodeStruct(ods *objectDecodeState, obj reflect.Value, e
 		// implement the saver/loader interfaces.
 		sl.StateLoad(Source{internal: od})
 	}
+	for _, m := range rte.Migrations {
+		if m.Load != nil {
+			m.Load(obj.Addr().Interface(), MigrationSource{internal: od, removed: m.removed})
+		}
+	}
 }
 
 // decodeMap decodes a map value.
@@ -113,7 +113,11 @@ func (p *printer) format(graph uint64, depth int, encoded wire.Object) (string,
 	case *wire.Type:
 		tabs := "\n" + strings.Repeat("\t", depth)
 		items := make([]string, 0, len(x.Fields)+2)
-		items = append(items, fmt.Sprintf("type %s {", x.Name))
+		if x.Version != 0 {
+			items = append(items, fmt.Sprintf("type %s (version %d) {", x.Name, x.Version))
+		} else {
+			items = append(items, fmt.Sprintf("type %s {", x.Name))
+		}
 		for i := 0; i < len(x.Fields); i++ {
 			items = append(items, fmt.Sprintf("\t%d: %s,", i, x.Fields[i]))
 		}
@@ -0,0 +1,258 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pretty
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+
+	"gvisor.dev/gvisor/pkg/state"
+	"gvisor.dev/gvisor/pkg/state/wire"
+)
+
+// TypeSummary is the number and total encoded size of the objects of a single
+// type in a state stream.
+type TypeSummary struct {
+	// Name is the name of the type. Structs use the name they were registered
+	// with, other objects are named after their kind, e.g. "[]T" for the
+	// backing array of a slice of T.
+	Name string
+
+	// Objects is the number of objects of the type.
+	Objects uint64
+
+	// Bytes is the encoded size of the objects of the type, including values
+	// embedded in them, but not objects they refer to.
+	Bytes uint64
+}
+
+// Summary describes the contents of a state stream.
+type Summary struct {
+	// Graphs is the number of object graphs in the stream.
+	Graphs uint64
+
+	// Objects is the total number of objects in all graphs.
+	Objects uint64
+
+	// ObjectBytes is the total encoded size of all objects.
+	ObjectBytes uint64
+
+	// TypeBytes is the total encoded size of type definitions.
+	TypeBytes uint64
+
+	// NonObjectBytes is the total size of non-object data, e.g. memory
+	// contents.
+	NonObjectBytes uint64
+
+	// Types summarizes objects by type, ordered by decreasing size.
+	Types []TypeSummary
+}
+
+// countingReader is a wire.Reader that counts the bytes read.
+type countingReader struct {
+	r wire.Reader
+	n uint64
+}
+
+// Read implements io.Reader.Read.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+// ReadByte implements io.ByteReader.ReadByte.
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// summarizer accumulates a Summary.
+type summarizer struct {
+	summary Summary
+
+	// types maps type names to indices in summary.Types.
+	types map[string]int
+
+	// typeSpecs are the types defined in the current graph, indexed by type
+	// ID minus one.
+	typeSpecs []*wire.Type
+}
+
+// typeName returns the name of the type of obj.
+func (s *summarizer) typeName(obj wire.Object) string {
+	switch x := obj.(type) {
+	case *wire.Struct:
+		if x.TypeID == 0 || int(x.TypeID) > len(s.typeSpecs) {
+			return fmt.Sprintf("!missing-type-spec(%d)", x.TypeID)
+		}
+		return s.typeSpecs[x.TypeID-1].Name
+	case *wire.Array:
+		if len(x.Contents) == 0 {
+			return "[]"
+		}
+		return "[]" + s.typeName(x.Contents[0])
+	case *wire.Map:
+		if len(x.Keys) == 0 {
+			return "map"
+		}
+		return fmt.Sprintf("map[%s]%s", s.typeName(x.Keys[0]), s.typeName(x.Values[0]))
+	case *wire.Interface:
+		return "interface"
+	case *wire.Slice:
+		return "slice"
+	case *wire.Ref:
+		return "pointer"
+	case *wire.String:
+		return "string"
+	case wire.Nil:
+		return "nil"
+	case wire.Bool:
+		return "bool"
+	case wire.Int:
+		return "int"
+	case wire.Uint:
+		return "uint"
+	case wire.Float32:
+		return "float32"
+	case wire.Float64:
+		return "float64"
+	case *wire.Complex64:
+		return "complex64"
+	case *wire.Complex128:
+		return "complex128"
+	default:
+		return fmt.Sprintf("%T", obj)
+	}
+}
+
+// add records an object of the given encoded size.
+func (s *summarizer) add(obj wire.Object, size uint64) {
+	name := s.typeName(obj)
+	i, ok := s.types[name]
+	if !ok {
+		i = len(s.summary.Types)
+		s.types[name] = i
+		s.summary.Types = append(s.summary.Types, TypeSummary{Name: name})
+	}
+	ts := &s.summary.Types[i]
+	ts.Objects++
+	ts.Bytes += size
+	s.summary.Objects++
+	s.summary.ObjectBytes += size
+}
+
+// summarizeStream walks the stream. The loop matches printStream.
+func (s *summarizer) summarizeStream(r wire.Reader) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rErr, ok := r.(error); ok {
+				err = rErr // Override return.
+				return
+			}
+			panic(r) // Propagate.
+		}
+	}()
+
+	cr := &countingReader{r: r}
+	for {
+		length, object, err := state.ReadHeader(cr)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if !object {
+			if length > 0 {
+				n, err := io.Copy(ioutil.Discard, &io.LimitedReader{
+					R: cr,
+					N: int64(length),
+				})
+				s.summary.NonObjectBytes += uint64(n)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		s.summary.Graphs++
+		s.typeSpecs = s.typeSpecs[:0]
+		for i := uint64(0); i < length; {
+			start := cr.n
+			encoded := wire.Load(cr)
+			switch we := encoded.(type) {
+			case *wire.Type:
+				s.typeSpecs = append(s.typeSpecs, we)
+				s.summary.TypeBytes += cr.n - start
+			case wire.Uint:
+				start = cr.n
+				obj := wire.Load(cr)
+				s.add(obj, cr.n-start)
+				i++
+			default:
+				return fmt.Errorf("wanted type or object ID, got %#v", encoded)
+			}
+		}
+	}
+
+	sort.Slice(s.summary.Types, func(i, j int) bool {
+		ti, tj := &s.summary.Types[i], &s.summary.Types[j]
+		if ti.Bytes != tj.Bytes {
+			return ti.Bytes > tj.Bytes
+		}
+		return ti.Name < tj.Name
+	})
+	return nil
+}
+
+// Summarize reads the stream from r and returns a summary of its contents.
+func Summarize(r wire.Reader) (*Summary, error) {
+	s := summarizer{types: make(map[string]int)}
+	if err := s.summarizeStream(r); err != nil {
+		return nil, err
+	}
+	return &s.summary, nil
+}
+
+// Print prints the summary as a table to w. If limit is positive, only the
+// limit largest types are listed.
+func (s *Summary) Print(w io.Writer, limit int) error {
+	fmt.Fprintf(w, "Graphs:           %d\n", s.Graphs)
+	fmt.Fprintf(w, "Objects:          %d (%d bytes)\n", s.Objects, s.ObjectBytes)
+	fmt.Fprintf(w, "Type definitions: %d bytes\n", s.TypeBytes)
+	fmt.Fprintf(w, "Non-object data:  %d bytes\n\n", s.NonObjectBytes)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "BYTES\tOBJECTS\tAVG\tPERCENT\tTYPE\n")
+	for i, ts := range s.Types {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(tw, "\t\t\t\t... (%d more types)\n", len(s.Types)-limit)
+			break
+		}
+		var pct float64
+		if s.ObjectBytes > 0 {
+			pct = 100 * float64(ts.Bytes) / float64(s.ObjectBytes)
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%.1f%%\t%s\n", ts.Bytes, ts.Objects, ts.Bytes/ts.Objects, pct, ts.Name)
+	}
+	return tw.Flush()
+}
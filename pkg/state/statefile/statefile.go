@@ -99,12 +99,19 @@ const (
 	CompressionLevelFlateBestSpeed = CompressionLevel("flate-best-speed")
 	// CompressionLevelNone represents the absence of any compression on an image.
 	CompressionLevelNone = CompressionLevel("none")
+	// CompressionLevelLZ4 represents the LZ4 algorithm. It produces larger
+	// images than flate, but is considerably faster to save and restore.
+	CompressionLevelLZ4 = CompressionLevel("lz4")
 )
 
 // Options is statefile options.
 type Options struct {
 	// Compression is an image compression type/level.
 	Compression CompressionLevel
+
+	// Resume indicates that the sandbox keeps running after it's saved,
+	// instead of exiting. Resume is not recorded in the image.
+	Resume bool
 }
 
 // WriteToMetadata save options to the metadata storage.  Method returns the
@@ -121,6 +128,8 @@ func CompressionLevelFromString(val string) (CompressionLevel, error) {
 		return CompressionLevelFlateBestSpeed, nil
 	case string(CompressionLevelNone):
 		return CompressionLevelNone, nil
+	case string(CompressionLevelLZ4):
+		return CompressionLevelLZ4, nil
 	default:
 		return CompressionLevelNone, ErrInvalidFlags
 	}
@@ -224,8 +233,11 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser
 	// only a little gain in file size reduction, which translate to even smaller
 	// gain in restore latency reduction, while inccuring much more CPU usage at
 	// save time.
-	if compression == CompressionLevelFlateBestSpeed {
+	switch compression {
+	case CompressionLevelFlateBestSpeed:
 		return compressio.NewWriter(w, key, compressionChunkSize, flate.BestSpeed)
+	case CompressionLevelLZ4:
+		return compressio.NewWriterWithCodec(w, key, compressionChunkSize, compressio.LZ4)
 	}
 
 	return compressio.NewSimpleWriter(w, key)
@@ -330,6 +342,8 @@ func NewReader(r io.Reader, key []byte) (wire.Reader, map[string]string, error)
 
 	if compression == CompressionLevelFlateBestSpeed {
 		cr, err = compressio.NewReader(r, key)
+	} else if compression == CompressionLevelLZ4 {
+		cr, err = compressio.NewReaderWithCodec(r, key, compressio.LZ4)
 	} else if compression == CompressionLevelNone {
 		cr, err = compressio.NewSimpleReader(r, key)
 	} else {
@@ -49,6 +49,7 @@ func TestStatefile(t *testing.T) {
 	compression := map[string]CompressionLevel{
 		"none":       CompressionLevelNone,
 		"compressed": CompressionLevelFlateBestSpeed,
+		"lz4":        CompressionLevelLZ4,
 	}
 
 	cases := []testCase{
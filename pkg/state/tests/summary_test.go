@@ -0,0 +1,74 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/state"
+	"gvisor.dev/gvisor/pkg/state/pretty"
+)
+
+func TestSummarize(t *testing.T) {
+	root := &outerSlice{inner: []inner{{v: 1}, {v: 2}, {v: 3}}}
+	var buf bytes.Buffer
+	if _, err := state.Save(context.Background(), &buf, root); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	s, err := pretty.Summarize(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	var b strings.Builder
+	if err := s.Print(&b, 0); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	t.Logf("Summary:\n%s", b.String())
+
+	if s.Graphs != 1 {
+		t.Errorf("got %d graphs, want 1", s.Graphs)
+	}
+	var objects, size uint64
+	for i, ts := range s.Types {
+		objects += ts.Objects
+		size += ts.Bytes
+		if i > 0 && ts.Bytes > s.Types[i-1].Bytes {
+			t.Errorf("types are not ordered by size: %+v", s.Types)
+		}
+	}
+	if objects != s.Objects || size != s.ObjectBytes {
+		t.Errorf("types add up to %d objects and %d bytes, want %d and %d", objects, size, s.Objects, s.ObjectBytes)
+	}
+	if s.ObjectBytes+s.TypeBytes > uint64(buf.Len()) {
+		t.Errorf("objects and types are %d bytes, more than the stream's %d bytes", s.ObjectBytes+s.TypeBytes, buf.Len())
+	}
+
+	// The slice's backing array is a separate object of three structs.
+	found := false
+	for _, ts := range s.Types {
+		if strings.HasPrefix(ts.Name, "[]") && strings.HasSuffix(ts.Name, ".inner") {
+			found = true
+			if ts.Objects != 1 {
+				t.Errorf("got %d objects of type %s, want 1", ts.Objects, ts.Name)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no backing array for []inner in %+v", s.Types)
+	}
+}
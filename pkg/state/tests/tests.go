@@ -109,6 +109,12 @@ func runTestCases(t *testing.T, shouldFail bool, prefix string, objects []any) {
 					t.Errorf("PrettyPrint(html=true) failed unexpected: %v", err)
 				}
 			}
+			if _, err := pretty.Summarize(bytes.NewReader(saveBuffer.Bytes())); err != nil {
+				// See above.
+				if !shouldFail {
+					t.Errorf("Summarize failed unexpectedly: %v", err)
+				}
+			}
 			t.Logf("Encoded state:\n%s", ppBuf.String())
 			t.Logf("Save stats:\n%s", saveStats.String())
 
@@ -0,0 +1,235 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/state"
+)
+
+// Two versions of the same type can't be registered in one binary, so the
+// types below stand in for successive versions of a single type. State saved
+// with one is loaded as another by rewriting the type name in the stream,
+// which is why all of the names have the same length.
+//
+// Version 0 has fields a, b and c. Version 1 renames b to bee, and replaces c
+// with d, which is c doubled. Version 2 adds e.
+
+type versionedV0 struct {
+	a int64
+	b string
+	c int64
+}
+
+func (*versionedV0) StateTypeName() string { return "tests.versionedV0" }
+
+func (*versionedV0) StateFields() []string { return []string{"a", "b", "c"} }
+
+func (v *versionedV0) StateSave(m state.Sink) {
+	m.Save(0, &v.a)
+	m.Save(1, &v.b)
+	m.Save(2, &v.c)
+}
+
+func (v *versionedV0) StateLoad(m state.Source) {
+	m.Load(0, &v.a)
+	m.Load(1, &v.b)
+	m.Load(2, &v.c)
+}
+
+type versionedV1 struct {
+	a   int64
+	bee string
+	d   int64
+}
+
+func (*versionedV1) StateTypeName() string { return "tests.versionedV1" }
+
+func (*versionedV1) StateFields() []string { return []string{"d", "bee", "a"} }
+
+func (*versionedV1) StateVersion() uint64 { return 1 }
+
+func (v *versionedV1) StateSave(m state.Sink) {
+	m.Save(0, &v.d)
+	m.Save(1, &v.bee)
+	m.Save(2, &v.a)
+}
+
+func (v *versionedV1) StateLoad(m state.Source) {
+	m.Load(0, &v.d)
+	m.Load(1, &v.bee)
+	m.Load(2, &v.a)
+}
+
+type versionedV2 struct {
+	a   int64
+	bee string
+	d   int64
+	e   *int64
+}
+
+func (*versionedV2) StateTypeName() string { return "tests.versionedV2" }
+
+func (*versionedV2) StateFields() []string { return []string{"a", "bee", "d", "e"} }
+
+func (*versionedV2) StateVersion() uint64 { return 2 }
+
+func (v *versionedV2) StateSave(m state.Sink) {
+	m.Save(0, &v.a)
+	m.Save(1, &v.bee)
+	m.Save(2, &v.d)
+	m.Save(3, &v.e)
+}
+
+func (v *versionedV2) StateLoad(m state.Source) {
+	m.Load(0, &v.a)
+	m.Load(1, &v.bee)
+	m.Load(2, &v.d)
+	m.Load(3, &v.e)
+}
+
+// versionedV9 has a version, but no migrations.
+type versionedV9 struct {
+	versionedV0
+}
+
+func (*versionedV9) StateTypeName() string { return "tests.versionedV9" }
+
+func (*versionedV9) StateFields() []string { return []string{"a", "b", "c"} }
+
+func (*versionedV9) StateVersion() uint64 { return 1 }
+
+func init() {
+	state.Register((*versionedV0)(nil))
+	state.Register((*versionedV1)(nil))
+	state.Register((*versionedV2)(nil))
+	state.Register((*versionedV9)(nil))
+
+	for _, name := range []string{"tests.versionedV1", "tests.versionedV2"} {
+		state.RegisterMigration(name, state.Migration{
+			From:    0,
+			Removed: []string{"c"},
+			Renamed: map[string]string{"b": "bee"},
+			Added:   []string{"d"},
+			Load: func(obj any, m state.MigrationSource) {
+				var c int64
+				m.Load("c", &c)
+				switch v := obj.(type) {
+				case *versionedV1:
+					v.d = 2 * c
+				case *versionedV2:
+					v.d = 2 * c
+				}
+			},
+		})
+	}
+	state.RegisterMigration("tests.versionedV2", state.Migration{
+		From:  1,
+		Added: []string{"e"},
+	})
+}
+
+// saveAs saves obj, and renames its type to name in the saved state.
+func saveAs(t *testing.T, obj any, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := state.Save(context.Background(), &buf, obj); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	old := obj.(state.Type).StateTypeName()
+	if len(old) != len(name) {
+		t.Fatalf("type names %q and %q have different lengths", old, name)
+	}
+	return bytes.ReplaceAll(buf.Bytes(), []byte(old), []byte(name))
+}
+
+func TestVersionRoundTrip(t *testing.T) {
+	e := int64(5)
+	runTestCases(t, false, "versioned", []any{
+		versionedV1{a: 1, bee: "bee", d: 4},
+		&versionedV2{a: 1, bee: "bee", d: 4, e: &e},
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	v0 := &versionedV0{a: 1, b: "bee", c: 2}
+
+	var v1 versionedV1
+	if _, err := state.Load(context.Background(), bytes.NewReader(saveAs(t, v0, "tests.versionedV1")), &v1); err != nil {
+		t.Fatalf("Load from version 0 to 1 failed: %v", err)
+	}
+	if want := (versionedV1{a: 1, bee: "bee", d: 4}); v1 != want {
+		t.Errorf("Load from version 0 to 1 got %+v, want %+v", v1, want)
+	}
+
+	var v2 versionedV2
+	if _, err := state.Load(context.Background(), bytes.NewReader(saveAs(t, v0, "tests.versionedV2")), &v2); err != nil {
+		t.Fatalf("Load from version 0 to 2 failed: %v", err)
+	}
+	if want := (versionedV2{a: 1, bee: "bee", d: 4}); v2 != want {
+		t.Errorf("Load from version 0 to 2 got %+v, want %+v", v2, want)
+	}
+
+	v2 = versionedV2{}
+	if _, err := state.Load(context.Background(), bytes.NewReader(saveAs(t, &v1, "tests.versionedV2")), &v2); err != nil {
+		t.Fatalf("Load from version 1 to 2 failed: %v", err)
+	}
+	if want := (versionedV2{a: 1, bee: "bee", d: 4}); v2 != want {
+		t.Errorf("Load from version 1 to 2 got %+v, want %+v", v2, want)
+	}
+}
+
+func TestMigrateFails(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		obj     any
+		as      string
+		load    any
+		wantErr string
+	}{
+		{
+			name:    "newer version",
+			obj:     &versionedV2{},
+			as:      "tests.versionedV1",
+			load:    &versionedV1{},
+			wantErr: "only versions up to 1",
+		},
+		{
+			name:    "newer than unversioned",
+			obj:     &versionedV1{},
+			as:      "tests.versionedV0",
+			load:    &versionedV0{},
+			wantErr: "only versions up to 0",
+		},
+		{
+			name:    "missing migration",
+			obj:     &versionedV0{},
+			as:      "tests.versionedV9",
+			load:    &versionedV9{},
+			wantErr: "no migration from version 0",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := state.Load(context.Background(), bytes.NewReader(saveAs(t, tc.obj, tc.as)), tc.load)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Load got error %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -54,6 +54,11 @@ type reconciledTypeEntry struct {
 	wire.Type
 	LocalType  reflect.Type
 	FieldOrder []int
+
+	// Migrations are the migrations applied to the encoded type, if its
+	// version differs from the local version. FieldOrder contains -1 for
+	// fields added by these migrations.
+	Migrations []appliedMigration
 }
 
 // typeEncodeDatabase is an internal TypeInfo database for encoding.
@@ -144,8 +149,9 @@ func (tdb *typeEncodeDatabase) Lookup(typ reflect.Type) (*typeEntry, bool) {
 		te = &typeEntry{
 			ID: tdb.lastID,
 			Type: wire.Type{
-				Name:   name,
-				Fields: fields,
+				Name:    name,
+				Fields:  fields,
+				Version: typeVersion(typ),
 			},
 		}
 
@@ -235,11 +241,18 @@ func (tbd *typeDecodeDatabase) Lookup(id typeID, typ reflect.Type) *reconciledTy
 	}
 	rte := &reconciledTypeEntry{
 		Type: wire.Type{
-			Name:   name,
-			Fields: fields,
+			Name:    name,
+			Fields:  fields,
+			Version: typeVersion(typ),
 		},
 		LocalType: typ,
 	}
+	if rte.Version != pending.Version {
+		// The fields may differ; see Versioned.
+		reconcileVersions(rte, pending, rte.Version)
+		tbd.byID[id-1] = rte
+		return rte
+	}
 	// If there are zero or one fields, then we skip allocating the field
 	// slice. There is special handling for decoding in this case. If the
 	// field name does not match, it will be caught in the general purpose
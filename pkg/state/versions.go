@@ -0,0 +1,213 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"reflect"
+
+	"gvisor.dev/gvisor/pkg/state/wire"
+)
+
+// Versioned may be implemented by a Type whose fields have changed between
+// releases, so that state saved by an older release can still be loaded.
+//
+// Types that don't implement Versioned have version zero. Each time the
+// fields of a type are added, removed or renamed, its version should be
+// incremented and a Migration from the previous version registered with
+// RegisterMigration. Reordering fields doesn't require a new version.
+type Versioned interface {
+	// StateVersion returns the version of the type's state.
+	//
+	// This is called on nil pointers, and must not dereference the
+	// receiver.
+	StateVersion() uint64
+}
+
+// Migration describes how the fields of a type changed from version From to
+// version From+1.
+//
+// Migrations are applied to the encoded field list in order: Removed, then
+// Renamed, then Added. The resulting list must match the fields of the local
+// type, ignoring order.
+type Migration struct {
+	// From is the version this migration applies to.
+	From uint64
+
+	// Removed lists fields that no longer exist. Their saved values are
+	// ignored unless loaded by Load.
+	Removed []string
+
+	// Renamed maps old field names to new field names.
+	Renamed map[string]string
+
+	// Added lists new fields. They are left with their zero value when
+	// loading older state, unless set by Load.
+	Added []string
+
+	// Load, if not nil, is called after the object's StateLoad method with
+	// a pointer to the object. It may use m to load the values of fields in
+	// Removed, for example to compute the values of fields in Added.
+	Load func(obj any, m MigrationSource)
+}
+
+// MigrationSource is used by Migration.Load.
+type MigrationSource struct {
+	internal objectDecoder
+
+	// removed maps the fields removed by the migration to their indices in
+	// the encoded object.
+	removed map[string]int
+}
+
+// Load loads the value of the removed field name into objPtr.
+//
+// As with Source.Load, objects referred to by the value may not be fully
+// loaded until AfterLoad callbacks run.
+func (m MigrationSource) Load(name string, objPtr any) {
+	i, ok := m.removed[name]
+	if !ok {
+		Failf("field %q of type %q was not removed by this migration", name, m.internal.rte.Name)
+	}
+	m.internal.loadEncoded(i, reflect.ValueOf(objPtr), false, nil)
+}
+
+// AfterLoad is equivalent to Source.AfterLoad.
+func (m MigrationSource) AfterLoad(fn func()) {
+	m.internal.afterLoad(fn)
+}
+
+// Context returns the context object provided at load time.
+func (m MigrationSource) Context() context.Context {
+	return m.internal.ds.ctx
+}
+
+// migrations maps type names and versions to registered migrations.
+var migrations = map[string]map[uint64]*Migration{}
+
+// RegisterMigration registers a migration for the type with the given name.
+//
+// This must be called on init, and at most once for each version of a type.
+func RegisterMigration(name string, m Migration) {
+	byVersion, ok := migrations[name]
+	if !ok {
+		byVersion = make(map[uint64]*Migration)
+		migrations[name] = byVersion
+	}
+	if _, ok := byVersion[m.From]; ok {
+		Failf("conflicting migrations from version %d of type %q", m.From, name)
+	}
+	byVersion[m.From] = &m
+}
+
+// appliedMigration is a migration applied while reconciling a type.
+type appliedMigration struct {
+	*Migration
+
+	// removed is as in MigrationSource.
+	removed map[string]int
+}
+
+// typeVersion returns the version of typ.
+func typeVersion(typ reflect.Type) uint64 {
+	if v, ok := reflect.Zero(reflect.PtrTo(typ)).Interface().(Versioned); ok {
+		return v.StateVersion()
+	}
+	return 0
+}
+
+// reconcileVersions sets rte.FieldOrder and rte.Migrations for a type whose
+// encoded version, described by pending, differs from the local version.
+func reconcileVersions(rte *reconciledTypeEntry, pending *wire.Type, version uint64) {
+	name := rte.Name
+	if pending.Version > version {
+		Failf("type %q was saved with version %d, but only versions up to %d are supported", name, pending.Version, version)
+	}
+
+	// names[i] is the current name of encoded field i, or "" if it has been
+	// removed. added contains fields that aren't encoded.
+	names := append([]string(nil), pending.Fields...)
+	added := make(map[string]bool)
+	indexOf := func(field string) int {
+		for i, n := range names {
+			if n == field {
+				return i
+			}
+		}
+		return -1
+	}
+	for v := pending.Version; v < version; v++ {
+		m, ok := migrations[name][v]
+		if !ok {
+			Failf("type %q has no migration from version %d", name, v)
+		}
+		am := appliedMigration{Migration: m}
+		for _, field := range m.Removed {
+			if i := indexOf(field); i >= 0 {
+				if am.removed == nil {
+					am.removed = make(map[string]int)
+				}
+				am.removed[field] = i
+				names[i] = ""
+			} else if added[field] {
+				delete(added, field)
+			} else {
+				Failf("migration from version %d of type %q removes unknown field %q", v, name, field)
+			}
+		}
+		for from, to := range m.Renamed {
+			if indexOf(to) >= 0 || added[to] {
+				Failf("migration from version %d of type %q renames %q to existing field %q", v, name, from, to)
+			}
+			if i := indexOf(from); i >= 0 {
+				names[i] = to
+			} else if added[from] {
+				delete(added, from)
+				added[to] = true
+			} else {
+				Failf("migration from version %d of type %q renames unknown field %q", v, name, from)
+			}
+		}
+		for _, field := range m.Added {
+			if indexOf(field) >= 0 || added[field] {
+				Failf("migration from version %d of type %q adds existing field %q", v, name, field)
+			}
+			added[field] = true
+		}
+		rte.Migrations = append(rte.Migrations, am)
+	}
+
+	// Match the migrated fields to the local ones.
+	rte.FieldOrder = make([]int, len(rte.Fields))
+	matched := 0
+	for i, field := range rte.Fields {
+		if j := indexOf(field); j >= 0 {
+			rte.FieldOrder[i] = j
+			matched++
+		} else if added[field] {
+			rte.FieldOrder[i] = -1
+		} else {
+			Failf("type %q has field %q, which is missing from version %d and not added by a migration", name, field, pending.Version)
+		}
+	}
+	for _, field := range names {
+		if field != "" {
+			matched--
+		}
+	}
+	if matched != 0 {
+		Failf("type %q has fields %v, which don't match migrated fields %v from version %d", name, rte.Fields, names, pending.Version)
+	}
+}
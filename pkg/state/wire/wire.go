@@ -666,6 +666,11 @@ func (*Interface) load(r Reader) Object {
 type Type struct {
 	Name   string
 	Fields []string
+
+	// Version is the version of the type's saved state. Types with version
+	// zero are encoded exactly as they were before versions existed, so
+	// that older decoders can still read them.
+	Version uint64
 }
 
 // loadType loads an object of type Type.
@@ -700,6 +705,20 @@ func (*Type) load(r Reader) Object {
 	return &t
 }
 
+// saveVersioned saves a Type followed by its version.
+func (t *Type) saveVersioned(w Writer) {
+	t.save(w)
+	v := Uint(t.Version)
+	v.save(w)
+}
+
+// loadVersioned loads an object saved by saveVersioned.
+func (*Type) loadVersioned(r Reader) Object {
+	t := loadType(r)
+	t.Version = uint64(loadUint(r))
+	return &t
+}
+
 // multipleObjects is a special type for serializing multiple objects.
 type multipleObjects []Object
 
@@ -838,6 +857,7 @@ const (
 	typeComplex64
 	typeComplex128
 	typeType
+	typeVersionedType
 )
 
 // Save saves the given object.
@@ -893,8 +913,13 @@ func Save(w Writer, obj Object) {
 		typeInterface.save(w)
 		x.save(w)
 	case *Type:
-		typeType.save(w)
-		x.save(w)
+		if x.Version != 0 {
+			typeVersionedType.save(w)
+			x.saveVersioned(w)
+		} else {
+			typeType.save(w)
+			x.save(w)
+		}
 	case *Complex64:
 		typeComplex64.save(w)
 		x.save(w)
@@ -949,6 +974,8 @@ func Load(r Reader) Object {
 		return ((*Complex128)(nil)).load(r) // Escapes.
 	case typeType:
 		return ((*Type)(nil)).load(r) // Escapes.
+	case typeVersionedType:
+		return ((*Type)(nil)).loadVersioned(r) // Escapes.
 	default:
 		// This is not a valid stream?
 		panic(fmt.Errorf("unknown header: %d", hdr))
@@ -64,6 +64,10 @@ const (
 	// from the action value for an unrecognized option identifier.
 	ipv6UnknownExtHdrOptionActionShift = 6
 
+	// ipv6RoutingExtHdrRoutingTypeIdx is the index to the Routing Type field
+	// within an IPv6RoutingExtHdr.
+	ipv6RoutingExtHdrRoutingTypeIdx = 0
+
 	// ipv6RoutingExtHdrSegmentsLeftIdx is the index to the Segments Left field
 	// within an IPv6RoutingExtHdr.
 	ipv6RoutingExtHdrSegmentsLeftIdx = 1
@@ -186,6 +190,12 @@ func (i ipv6OptionsExtHdr) Release() {
 	}
 }
 
+// Length returns the length of the extension header in bytes, including the
+// Next Header and Hdr Ext Len fields.
+func (i ipv6OptionsExtHdr) Length() int {
+	return int(i.buf.Size()) + ipv6ExtHdrLenBytesPerUnit - ipv6ExtHdrLenBytesExcluded
+}
+
 // Iter returns an iterator over the IPv6 extension header options held in b.
 func (i ipv6OptionsExtHdr) Iter() IPv6OptionsExtHdrOptionsIterator {
 	it := IPv6OptionsExtHdrOptionsIterator{}
@@ -427,6 +437,11 @@ func (b IPv6RoutingExtHdr) Release() {
 	b.Buf.Release()
 }
 
+// RoutingType returns the Routing Type field.
+func (b IPv6RoutingExtHdr) RoutingType() uint8 {
+	return b.Buf.AsSlice()[ipv6RoutingExtHdrRoutingTypeIdx]
+}
+
 // SegmentsLeft returns the Segments Left field.
 func (b IPv6RoutingExtHdr) SegmentsLeft() uint8 {
 	return b.Buf.AsSlice()[ipv6RoutingExtHdrSegmentsLeftIdx]
@@ -0,0 +1,183 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// IPv6SegmentRoutingType is the Routing Type of a Segment Routing Header, as
+// per RFC 8754 section 2.
+const IPv6SegmentRoutingType = 4
+
+const (
+	ipv6SRHNextHeaderOffset   = 0
+	ipv6SRHHdrExtLenOffset    = 1
+	ipv6SRHRoutingTypeOffset  = 2
+	ipv6SRHSegmentsLeftOffset = 3
+	ipv6SRHLastEntryOffset    = 4
+	ipv6SRHFlagsOffset        = 5
+	ipv6SRHTagOffset          = 6
+
+	// IPv6SegmentRoutingExtHdrMinimumSize is the size of a Segment Routing
+	// Header without any segments.
+	IPv6SegmentRoutingExtHdrMinimumSize = 8
+)
+
+// IPv6SegmentRoutingExtHdr is a Segment Routing Header (SRH) as defined in
+// RFC 8754 section 2. Unlike IPv6RoutingExtHdr, it holds the whole header,
+// including the Next Header and Hdr Ext Len fields.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	| Next Header   |  Hdr Ext Len  | Routing Type  | Segments Left |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|  Last Entry   |     Flags     |              Tag              |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|            Segment List[0] (128-bit IPv6 address)             |
+//	|                              ...                              |
+//	|            Segment List[n] (128-bit IPv6 address)             |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	//         Optional Type Length Value objects (variable)       //
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// Segment List[0] is the last segment of the path.
+type IPv6SegmentRoutingExtHdr []byte
+
+// NewIPv6SegmentRoutingExtHdr returns a Segment Routing Header for a packet
+// that visits segments in order. Segment List[0] holds the last segment, and
+// Segments Left points to the first one.
+func NewIPv6SegmentRoutingExtHdr(segments []tcpip.Address) IPv6SegmentRoutingExtHdr {
+	n := len(segments)
+	b := IPv6SegmentRoutingExtHdr(make([]byte, IPv6SegmentRoutingExtHdrMinimumSize+n*IPv6AddressSize))
+	b[ipv6SRHHdrExtLenOffset] = uint8(2 * n)
+	b[ipv6SRHRoutingTypeOffset] = IPv6SegmentRoutingType
+	b[ipv6SRHSegmentsLeftOffset] = uint8(n - 1)
+	b[ipv6SRHLastEntryOffset] = uint8(n - 1)
+	for i, addr := range segments {
+		b.SetSegment(n-1-i, addr)
+	}
+	return b
+}
+
+// NextHeader returns the Next Header field.
+func (b IPv6SegmentRoutingExtHdr) NextHeader() uint8 {
+	return b[ipv6SRHNextHeaderOffset]
+}
+
+// Length returns the length of the header in bytes, as indicated by the Hdr
+// Ext Len field.
+func (b IPv6SegmentRoutingExtHdr) Length() int {
+	return (int(b[ipv6SRHHdrExtLenOffset]) + 1) * ipv6ExtHdrLenBytesPerUnit
+}
+
+// RoutingType returns the Routing Type field.
+func (b IPv6SegmentRoutingExtHdr) RoutingType() uint8 {
+	return b[ipv6SRHRoutingTypeOffset]
+}
+
+// SegmentsLeft returns the Segments Left field.
+func (b IPv6SegmentRoutingExtHdr) SegmentsLeft() uint8 {
+	return b[ipv6SRHSegmentsLeftOffset]
+}
+
+// SetSegmentsLeft sets the Segments Left field.
+func (b IPv6SegmentRoutingExtHdr) SetSegmentsLeft(v uint8) {
+	b[ipv6SRHSegmentsLeftOffset] = v
+}
+
+// LastEntry returns the Last Entry field, the index of the last element of
+// the Segment List.
+func (b IPv6SegmentRoutingExtHdr) LastEntry() uint8 {
+	return b[ipv6SRHLastEntryOffset]
+}
+
+// Flags returns the Flags field.
+func (b IPv6SegmentRoutingExtHdr) Flags() uint8 {
+	return b[ipv6SRHFlagsOffset]
+}
+
+// Tag returns the Tag field.
+func (b IPv6SegmentRoutingExtHdr) Tag() uint16 {
+	return binary.BigEndian.Uint16(b[ipv6SRHTagOffset:])
+}
+
+// SetTag sets the Tag field.
+func (b IPv6SegmentRoutingExtHdr) SetTag(v uint16) {
+	binary.BigEndian.PutUint16(b[ipv6SRHTagOffset:], v)
+}
+
+// SegmentsLeftOffset returns the offset of the Segments Left field.
+func (IPv6SegmentRoutingExtHdr) SegmentsLeftOffset() uint32 {
+	return ipv6SRHSegmentsLeftOffset
+}
+
+// LastEntryOffset returns the offset of the Last Entry field.
+func (IPv6SegmentRoutingExtHdr) LastEntryOffset() uint32 {
+	return ipv6SRHLastEntryOffset
+}
+
+// Segment returns Segment List[i].
+func (b IPv6SegmentRoutingExtHdr) Segment(i int) tcpip.Address {
+	off := IPv6SegmentRoutingExtHdrMinimumSize + i*IPv6AddressSize
+	return tcpip.AddrFrom16Slice(b[off:][:IPv6AddressSize])
+}
+
+// SetSegment sets Segment List[i].
+func (b IPv6SegmentRoutingExtHdr) SetSegment(i int, addr tcpip.Address) {
+	off := IPv6SegmentRoutingExtHdrMinimumSize + i*IPv6AddressSize
+	copy(b[off:][:IPv6AddressSize], addr.AsSlice())
+}
+
+// IsValid returns true if b is a well formed Segment Routing Header whose
+// Segment List fits in the header and whose Segments Left field points into
+// the Segment List. See Linux's net/ipv6/seg6.c:seg6_validate_srh.
+//
+// Optional TLVs following the Segment List are not validated.
+func (b IPv6SegmentRoutingExtHdr) IsValid() bool {
+	if len(b) < IPv6SegmentRoutingExtHdrMinimumSize || b.Length() != len(b) {
+		return false
+	}
+	if b.RoutingType() != IPv6SegmentRoutingType {
+		return false
+	}
+	maxLastEntry := int(b[ipv6SRHHdrExtLenOffset])/2 - 1
+	if int(b.LastEntry()) > maxLastEntry {
+		return false
+	}
+	return b.SegmentsLeft() <= b.LastEntry()
+}
+
+var _ IPv6SerializableExtHdr = (*IPv6SegmentRoutingExtHdr)(nil)
+
+// identifier implements IPv6SerializableExtHdr.
+func (IPv6SegmentRoutingExtHdr) identifier() IPv6ExtensionHeaderIdentifier {
+	return IPv6RoutingExtHdrIdentifier
+}
+
+// length implements IPv6SerializableExtHdr.
+func (b IPv6SegmentRoutingExtHdr) length() int {
+	return len(b)
+}
+
+// serializeInto implements IPv6SerializableExtHdr.
+func (b IPv6SegmentRoutingExtHdr) serializeInto(nextHeader uint8, dst []byte) int {
+	n := copy(dst, b)
+	dst[ipv6SRHNextHeaderOffset] = nextHeader
+	return n
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/testutil"
+)
+
+func TestIPv6SegmentRoutingExtHdr(t *testing.T) {
+	segments := []tcpip.Address{
+		testutil.MustParse6("fc00::1"),
+		testutil.MustParse6("fc00::2"),
+		testutil.MustParse6("fc00::3"),
+	}
+	srh := header.NewIPv6SegmentRoutingExtHdr(segments)
+	if !srh.IsValid() {
+		t.Fatalf("got srh.IsValid() = false for %x", []byte(srh))
+	}
+	if got, want := srh.Length(), header.IPv6SegmentRoutingExtHdrMinimumSize+3*header.IPv6AddressSize; got != want {
+		t.Errorf("got srh.Length() = %d, want = %d", got, want)
+	}
+	if got := srh.RoutingType(); got != header.IPv6SegmentRoutingType {
+		t.Errorf("got srh.RoutingType() = %d, want = %d", got, header.IPv6SegmentRoutingType)
+	}
+	if got := srh.LastEntry(); got != 2 {
+		t.Errorf("got srh.LastEntry() = %d, want = 2", got)
+	}
+	if got := srh.SegmentsLeft(); got != 2 {
+		t.Errorf("got srh.SegmentsLeft() = %d, want = 2", got)
+	}
+	// The Segment List is in reverse order.
+	for i, want := range segments {
+		if got := srh.Segment(len(segments) - 1 - i); got != want {
+			t.Errorf("got srh.Segment(%d) = %s, want = %s", len(segments)-1-i, got, want)
+		}
+	}
+
+	s := header.IPv6ExtHdrSerializer{srh}
+	b := make([]byte, s.Length())
+	nextHeader, n := s.Serialize(header.UDPProtocolNumber, b)
+	if nextHeader != uint8(header.IPv6RoutingExtHdrIdentifier) {
+		t.Errorf("got nextHeader = %d, want = %d", nextHeader, header.IPv6RoutingExtHdrIdentifier)
+	}
+	if n != len(srh) {
+		t.Errorf("got n = %d, want = %d", n, len(srh))
+	}
+	if got := header.IPv6SegmentRoutingExtHdr(b).NextHeader(); got != uint8(header.UDPProtocolNumber) {
+		t.Errorf("got serialized NextHeader() = %d, want = %d", got, header.UDPProtocolNumber)
+	}
+}
+
+func TestIPv6SegmentRoutingExtHdrIsValid(t *testing.T) {
+	valid := func() header.IPv6SegmentRoutingExtHdr {
+		return header.NewIPv6SegmentRoutingExtHdr([]tcpip.Address{
+			testutil.MustParse6("fc00::1"),
+			testutil.MustParse6("fc00::2"),
+		})
+	}
+	tests := []struct {
+		name   string
+		mutate func(header.IPv6SegmentRoutingExtHdr) header.IPv6SegmentRoutingExtHdr
+	}{
+		{
+			name: "truncated",
+			mutate: func(b header.IPv6SegmentRoutingExtHdr) header.IPv6SegmentRoutingExtHdr {
+				return b[:len(b)-8]
+			},
+		},
+		{
+			name: "wrong routing type",
+			mutate: func(b header.IPv6SegmentRoutingExtHdr) header.IPv6SegmentRoutingExtHdr {
+				b[2] = 0
+				return b
+			},
+		},
+		{
+			name: "last entry out of range",
+			mutate: func(b header.IPv6SegmentRoutingExtHdr) header.IPv6SegmentRoutingExtHdr {
+				b[4] = 2
+				return b
+			},
+		},
+		{
+			name: "segments left out of range",
+			mutate: func(b header.IPv6SegmentRoutingExtHdr) header.IPv6SegmentRoutingExtHdr {
+				b.SetSegmentsLeft(2)
+				return b
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if b := test.mutate(valid()); b.IsValid() {
+				t.Errorf("got IsValid() = true for %x", []byte(b))
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sniffer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// pcapng block types. See
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html.
+const (
+	// PCAPNGSectionHeaderBlock is the type of the block starting a pcapng
+	// section.
+	PCAPNGSectionHeaderBlock = 0x0a0d0d0a
+
+	// PCAPNGInterfaceDescriptionBlock is the type of the block describing an
+	// interface that packets were captured on.
+	PCAPNGInterfaceDescriptionBlock = 0x00000001
+
+	pcapngInterfaceStatisticsBlock = 0x00000005
+	pcapngEnhancedPacketBlock      = 0x00000006
+)
+
+// pcapng options.
+const (
+	pcapngOptEndOfOpt        = 0
+	pcapngOptSHBUserAppl     = 4
+	pcapngOptIfName          = 2
+	pcapngOptIfTSResol       = 9
+	pcapngOptEPBFlags        = 2
+	pcapngOptISBStartTime    = 2
+	pcapngOptISBEndTime      = 3
+	pcapngOptISBFilterAccept = 6
+	pcapngOptISBOSDrop       = 7
+)
+
+const (
+	// pcapngByteOrderMagic is used by readers to detect the byte order of a
+	// section.
+	pcapngByteOrderMagic = 0x1a2b3c4d
+
+	// pcapngEPBFlagsInbound and pcapngEPBFlagsOutbound are the packet
+	// direction bits of the epb_flags option.
+	pcapngEPBFlagsInbound  = 1
+	pcapngEPBFlagsOutbound = 2
+
+	// pcapngEPBHeaderSize is the size of the block header and fixed fields of
+	// an enhanced packet block.
+	pcapngEPBHeaderSize = 28
+
+	// linkTypeRaw is LINKTYPE_RAW: packets begin with an IPv4 or IPv6 header.
+	linkTypeRaw = 101
+)
+
+// DefaultSnapLen is the snapshot length used by captures that don't specify
+// one. It is large enough to hold any packet in full.
+const DefaultSnapLen = 262144
+
+// defaultCaptureBacklog is the number of packets that may be queued for
+// writing before further packets are dropped.
+const defaultCaptureBacklog = 4096
+
+// CaptureOptions configures a packet capture started with StartCapture.
+type CaptureOptions struct {
+	// Name is the interface name recorded in the capture.
+	Name string
+
+	// Filter is a classic BPF program run over each packet, starting at its
+	// network header. Packets for which it returns 0 are not captured;
+	// otherwise at most the returned number of bytes is captured. If Filter
+	// is empty, all packets are captured.
+	Filter []bpf.Instruction
+
+	// SnapLen is the maximum number of bytes captured from each packet. If
+	// zero, DefaultSnapLen is used.
+	SnapLen uint32
+
+	// Backlog is the number of packets that may be waiting to be written to
+	// the output. Packets arriving while the backlog is full are dropped
+	// rather than stalling the network stack. If zero, a default is used.
+	Backlog int
+}
+
+// CaptureStats are statistics of a packet capture.
+type CaptureStats struct {
+	// Captured is the number of packets written to the output.
+	Captured uint64
+
+	// Filtered is the number of packets rejected by the filter.
+	Filtered uint64
+
+	// Dropped is the number of packets that passed the filter but were not
+	// written, because the output could not keep up or failed.
+	Dropped uint64
+}
+
+// capture is a pcapng packet capture attached to a sniffer endpoint.
+type capture struct {
+	filter  *bpf.Program
+	snapLen uint32
+	start   time.Time
+	output  io.WriteCloser
+
+	captured atomicbitops.Uint64
+	filtered atomicbitops.Uint64
+	dropped  atomicbitops.Uint64
+
+	// failed is set once writing to output fails.
+	failed atomicbitops.Bool
+
+	// done is closed once all queued packets have been written and output is
+	// closed.
+	done chan struct{}
+
+	// err is the error that output failed with. It may only be accessed
+	// after done is closed.
+	err error
+
+	// mu protects the fields below.
+	mu sync.RWMutex
+
+	// records holds marshalled packets waiting to be written. It is closed
+	// when the capture is stopped.
+	records chan []byte
+
+	// stopped is set when the capture is stopped.
+	stopped bool
+}
+
+// StartCapture starts a packet capture on ep, which must be a sniffer
+// endpoint. Packets are written to output in pcapng format until StopCapture
+// is called; output is closed once the capture has stopped. If StartCapture
+// fails, output is left open.
+//
+// Packets are written asynchronously, so a slow output never delays packet
+// processing.
+func StartCapture(ep stack.LinkEndpoint, output io.WriteCloser, opts CaptureOptions) error {
+	e, ok := ep.(*endpoint)
+	if !ok {
+		return fmt.Errorf("link endpoint does not support packet capture")
+	}
+	c := &capture{
+		snapLen: opts.SnapLen,
+		start:   time.Now(),
+		output:  output,
+		done:    make(chan struct{}),
+	}
+	if c.snapLen == 0 {
+		c.snapLen = DefaultSnapLen
+	}
+	if len(opts.Filter) > 0 {
+		p, err := bpf.Compile(opts.Filter)
+		if err != nil {
+			return fmt.Errorf("invalid capture filter: %w", err)
+		}
+		c.filter = &p
+	}
+	backlog := opts.Backlog
+	if backlog == 0 {
+		backlog = defaultCaptureBacklog
+	}
+	c.records = make(chan []byte, backlog+1)
+	// Queue the headers before any packet can be queued.
+	c.records <- pcapngHeader(opts.Name, c.snapLen)
+
+	if !e.capture.CompareAndSwap(nil, c) {
+		return fmt.Errorf("a packet capture is already running on this endpoint")
+	}
+	go c.run() // S/R-SAFE: captures are not saved.
+	return nil
+}
+
+// StopCapture stops the packet capture running on ep, waits for all captured
+// packets to be written, and returns the capture's statistics.
+func StopCapture(ep stack.LinkEndpoint) (CaptureStats, error) {
+	e, ok := ep.(*endpoint)
+	if !ok {
+		return CaptureStats{}, fmt.Errorf("link endpoint does not support packet capture")
+	}
+	c := e.capture.Swap(nil)
+	if c == nil {
+		return CaptureStats{}, fmt.Errorf("no packet capture is running on this endpoint")
+	}
+
+	c.mu.Lock()
+	c.stopped = true
+	close(c.records)
+	c.mu.Unlock()
+
+	<-c.done
+	return c.stats(), c.err
+}
+
+func (c *capture) stats() CaptureStats {
+	return CaptureStats{
+		Captured: c.captured.Load(),
+		Filtered: c.filtered.Load(),
+		Dropped:  c.dropped.Load(),
+	}
+}
+
+// run writes queued records to the output until the capture is stopped.
+func (c *capture) run() {
+	defer close(c.done)
+
+	first := true
+	for b := range c.records {
+		if c.failed.Load() {
+			c.dropped.Add(1)
+			continue
+		}
+		if _, err := c.output.Write(b); err != nil {
+			log.Warningf("Packet capture stopped writing: %v", err)
+			c.err = err
+			c.failed.Store(true)
+			if !first {
+				c.dropped.Add(1)
+			}
+			continue
+		}
+		if !first {
+			c.captured.Add(1)
+		}
+		first = false
+	}
+
+	if !c.failed.Load() {
+		if _, err := c.output.Write(c.statisticsBlock()); err != nil {
+			c.err = err
+		}
+	}
+	if err := c.output.Close(); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// capturePacket queues pkt for writing if it passes the filter.
+func (c *capture) capturePacket(dir Direction, pkt stack.PacketBufferPtr) {
+	if c.failed.Load() {
+		c.dropped.Add(1)
+		return
+	}
+	now := time.Now()
+
+	pkt = trimmedClone(pkt)
+	defer pkt.DecRef()
+	size := pkt.Size()
+
+	// Flatten the whole packet right after the block header, so that the
+	// filter can inspect any part of it.
+	b := make([]byte, pcapngEPBHeaderSize, pcapngEPBHeaderSize+size+3+16)
+	for _, v := range pkt.AsSlices() {
+		b = append(b, v...)
+	}
+
+	captureLen := uint32(size)
+	if c.filter != nil {
+		n, err := bpf.Exec(*c.filter, bpf.InputBytes{Data: b[pcapngEPBHeaderSize:], Order: binary.BigEndian})
+		if err != nil || n == 0 {
+			// Like Linux, a filter that fails at runtime rejects the packet.
+			c.filtered.Add(1)
+			return
+		}
+		if n < captureLen {
+			captureLen = n
+		}
+	}
+	if c.snapLen < captureLen {
+		captureLen = c.snapLen
+	}
+
+	b = b[:pcapngEPBHeaderSize+int(captureLen)]
+	b = appendPadding(b)
+	flags := uint32(pcapngEPBFlagsInbound)
+	if dir == DirectionSend {
+		flags = pcapngEPBFlagsOutbound
+	}
+	b = appendOption(b, pcapngOptEPBFlags, binary.LittleEndian.AppendUint32(nil, flags))
+	b = appendOption(b, pcapngOptEndOfOpt, nil)
+
+	ts := uint64(now.UnixNano())
+	binary.LittleEndian.PutUint32(b[0:], pcapngEnhancedPacketBlock)
+	binary.LittleEndian.PutUint32(b[8:], 0) // Interface ID.
+	binary.LittleEndian.PutUint32(b[12:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(b[16:], uint32(ts))
+	binary.LittleEndian.PutUint32(b[20:], captureLen)
+	binary.LittleEndian.PutUint32(b[24:], uint32(size))
+	b = endBlock(b, 0)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.stopped {
+		return
+	}
+	select {
+	case c.records <- b:
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+// statisticsBlock returns an interface statistics block summarizing the
+// capture.
+func (c *capture) statisticsBlock() []byte {
+	end := uint64(time.Now().UnixNano())
+	stats := c.stats()
+
+	b := beginBlock(nil, pcapngInterfaceStatisticsBlock)
+	b = binary.LittleEndian.AppendUint32(b, 0) // Interface ID.
+	b = binary.LittleEndian.AppendUint32(b, uint32(end>>32))
+	b = binary.LittleEndian.AppendUint32(b, uint32(end))
+	b = appendOption(b, pcapngOptISBStartTime, timestamp(uint64(c.start.UnixNano())))
+	b = appendOption(b, pcapngOptISBEndTime, timestamp(end))
+	b = appendOption(b, pcapngOptISBFilterAccept, binary.LittleEndian.AppendUint64(nil, stats.Captured+stats.Dropped))
+	b = appendOption(b, pcapngOptISBOSDrop, binary.LittleEndian.AppendUint64(nil, stats.Dropped))
+	b = appendOption(b, pcapngOptEndOfOpt, nil)
+	return endBlock(b, 0)
+}
+
+// pcapngHeader returns the section header and interface description blocks
+// that start a capture.
+func pcapngHeader(name string, snapLen uint32) []byte {
+	b := beginBlock(nil, PCAPNGSectionHeaderBlock)
+	b = binary.LittleEndian.AppendUint32(b, pcapngByteOrderMagic)
+	b = binary.LittleEndian.AppendUint16(b, 1) // Major version.
+	b = binary.LittleEndian.AppendUint16(b, 0) // Minor version.
+	// The section length is unknown.
+	b = binary.LittleEndian.AppendUint64(b, ^uint64(0))
+	b = appendOption(b, pcapngOptSHBUserAppl, []byte("gVisor"))
+	b = appendOption(b, pcapngOptEndOfOpt, nil)
+	b = endBlock(b, 0)
+
+	start := len(b)
+	b = beginBlock(b, PCAPNGInterfaceDescriptionBlock)
+	b = binary.LittleEndian.AppendUint16(b, linkTypeRaw)
+	b = binary.LittleEndian.AppendUint16(b, 0) // Reserved.
+	b = binary.LittleEndian.AppendUint32(b, snapLen)
+	if name != "" {
+		b = appendOption(b, pcapngOptIfName, []byte(name))
+	}
+	// Timestamps are in nanoseconds.
+	b = appendOption(b, pcapngOptIfTSResol, []byte{9})
+	b = appendOption(b, pcapngOptEndOfOpt, nil)
+	return endBlock(b, start)
+}
+
+// timestamp encodes a pcapng timestamp option value.
+func timestamp(ts uint64) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(ts>>32))
+	return binary.LittleEndian.AppendUint32(b, uint32(ts))
+}
+
+// beginBlock appends the header of a block of the given type to b. The block
+// length is filled in by endBlock.
+func beginBlock(b []byte, blockType uint32) []byte {
+	b = binary.LittleEndian.AppendUint32(b, blockType)
+	return binary.LittleEndian.AppendUint32(b, 0)
+}
+
+// endBlock completes the block starting at b[start:] by filling in its length.
+func endBlock(b []byte, start int) []byte {
+	length := uint32(len(b) - start + 4)
+	binary.LittleEndian.PutUint32(b[start+4:], length)
+	return binary.LittleEndian.AppendUint32(b, length)
+}
+
+// appendOption appends a pcapng option to b, which must be 32-bit aligned.
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return appendPadding(b)
+}
+
+// appendPadding pads b to a multiple of 32 bits.
+func appendPadding(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
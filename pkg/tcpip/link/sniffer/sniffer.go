@@ -24,6 +24,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/atomicbitops"
@@ -49,6 +50,9 @@ type endpoint struct {
 	writer     io.Writer
 	maxPCAPLen uint32
 	logPrefix  string
+
+	// capture is the packet capture started by StartCapture, if any.
+	capture atomic.Pointer[capture]
 }
 
 var _ stack.GSOEndpoint = (*endpoint)(nil)
@@ -139,6 +143,9 @@ func (e *endpoint) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pk
 }
 
 func (e *endpoint) dumpPacket(dir Direction, protocol tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) {
+	if c := e.capture.Load(); c != nil {
+		c.capturePacket(dir, pkt)
+	}
 	writer := e.writer
 	if writer == nil && LogPackets.Load() == 1 {
 		LogPacket(e.logPrefix, dir, protocol, pkt)
@@ -20,6 +20,7 @@ import (
 	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -36,6 +37,9 @@ const (
 	// Queue length for outbound packet, arriving at fd side for read. Overflow
 	// causes packet drops. gVisor implementation-specific.
 	defaultDevOutQueueLen = 1024
+
+	// include/linux/if_tap.h:MAX_TAP_QUEUES
+	maxQueues = 256
 )
 
 var zeroMAC [6]byte
@@ -46,8 +50,16 @@ var zeroMAC [6]byte
 type Device struct {
 	waiter.Queue
 
-	mu           sync.RWMutex `state:"nosave"`
-	endpoint     *tunEndpoint
+	mu       sync.RWMutex `state:"nosave"`
+	endpoint *tunEndpoint
+
+	// queue is the outbound packet queue that d reads from. For multiqueue
+	// devices, each Device has its own queue; otherwise, it is endpoint's.
+	queue *channel.Endpoint
+
+	// detached is true if queue was detached from endpoint by TUNSETQUEUE.
+	detached bool
+
 	notifyHandle *channel.NotificationHandle
 	flags        Flags
 }
@@ -57,6 +69,7 @@ type Flags struct {
 	TUN          bool
 	TAP          bool
 	NoPacketInfo bool
+	MultiQueue   bool
 }
 
 // beforeSave is invoked by stateify.
@@ -77,15 +90,22 @@ func (d *Device) Release(ctx context.Context) {
 
 	// Decrease refcount if there is an endpoint associated with this file.
 	if d.endpoint != nil {
-		d.endpoint.Drain()
-		d.endpoint.RemoveNotify(d.notifyHandle)
+		d.queue.Drain()
+		d.queue.RemoveNotify(d.notifyHandle)
+		if d.flags.MultiQueue {
+			if !d.detached {
+				d.endpoint.detachQueue(d.queue)
+			}
+			d.queue.Close()
+		}
+		d.queue = nil
 		d.endpoint.DecRef(ctx)
 		d.endpoint = nil
 	}
 }
 
 // SetIff services TUNSETIFF ioctl(2) request.
-func (d *Device) SetIff(s *stack.Stack, name string, flags Flags) error {
+func (d *Device) SetIff(ctx context.Context, s *stack.Stack, name string, flags Flags) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -108,18 +128,68 @@ func (d *Device) SetIff(s *stack.Stack, name string, flags Flags) error {
 		linkCaps |= stack.CapabilityResolutionRequired
 	}
 
-	endpoint, err := attachOrCreateNIC(s, name, prefix, linkCaps)
+	endpoint, err := attachOrCreateNIC(ctx, s, name, prefix, linkCaps, flags.MultiQueue)
 	if err != nil {
 		return linuxerr.EINVAL
 	}
 
+	queue := endpoint.Endpoint
+	if flags.MultiQueue {
+		queue = channel.New(defaultDevOutQueueLen, endpoint.MTU(), "")
+		if err := endpoint.attachQueue(queue); err != nil {
+			endpoint.DecRef(ctx)
+			return err
+		}
+	}
+
 	d.endpoint = endpoint
-	d.notifyHandle = d.endpoint.AddNotify(d)
+	d.queue = queue
+	d.notifyHandle = d.queue.AddNotify(d)
 	d.flags = flags
 	return nil
 }
 
-func attachOrCreateNIC(s *stack.Stack, name, prefix string, linkCaps stack.LinkEndpointCapabilities) (*tunEndpoint, error) {
+// SetQueue services TUNSETQUEUE ioctl(2) request, which attaches or detaches
+// the queue of a multiqueue device.
+func (d *Device) SetQueue(attach bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.endpoint == nil || !d.flags.MultiQueue {
+		return linuxerr.EINVAL
+	}
+	if attach {
+		if !d.detached {
+			return linuxerr.EINVAL
+		}
+		if err := d.endpoint.attachQueue(d.queue); err != nil {
+			return err
+		}
+		d.detached = false
+		return nil
+	}
+	if d.detached {
+		return linuxerr.EINVAL
+	}
+	d.endpoint.detachQueue(d.queue)
+	d.queue.Drain()
+	d.detached = true
+	return nil
+}
+
+// randomLinkAddress returns a random locally administered unicast link
+// address, as done by include/linux/etherdevice.h:eth_random_addr().
+func randomLinkAddress() tcpip.LinkAddress {
+	var addr [header.EthernetAddressSize]byte
+	if _, err := rand.Read(addr[:]); err != nil {
+		panic(fmt.Sprintf("rand.Read: %v", err))
+	}
+	addr[0] &^= 0x01 // Clear multicast bit.
+	addr[0] |= 0x02  // Set local assignment bit.
+	return tcpip.LinkAddress(addr[:])
+}
+
+func attachOrCreateNIC(ctx context.Context, s *stack.Stack, name, prefix string, linkCaps stack.LinkEndpointCapabilities, multiQueue bool) (*tunEndpoint, error) {
 	for {
 		// 1. Try to attach to an existing NIC.
 		if name != "" {
@@ -133,18 +203,29 @@ func attachOrCreateNIC(s *stack.Stack, name, prefix string, linkCaps stack.LinkE
 					// Race detected: NIC got deleted in between.
 					continue
 				}
+				if endpoint.isTap != (prefix == "tap") || endpoint.multiQueue != multiQueue {
+					// The NIC was created with a different type or
+					// queueing mode.
+					endpoint.DecRef(ctx)
+					return nil, linuxerr.EINVAL
+				}
 				return endpoint, nil
 			}
 		}
 
 		// 2. Creating a new NIC.
 		id := tcpip.NICID(s.UniqueID())
+		var linkAddr tcpip.LinkAddress
+		if prefix == "tap" {
+			linkAddr = randomLinkAddress()
+		}
 		endpoint := &tunEndpoint{
-			Endpoint: channel.New(defaultDevOutQueueLen, defaultDevMtu, ""),
-			stack:    s,
-			nicID:    id,
-			name:     name,
-			isTap:    prefix == "tap",
+			Endpoint:   channel.New(defaultDevOutQueueLen, defaultDevMtu, linkAddr),
+			stack:      s,
+			nicID:      id,
+			name:       name,
+			isTap:      prefix == "tap",
+			multiQueue: multiQueue,
 		}
 		endpoint.InitRefs()
 		endpoint.Endpoint.LinkEPCapabilities = linkCaps
@@ -180,12 +261,33 @@ func (d *Device) MTU() (uint32, error) {
 	return endpoint.MTU(), nil
 }
 
+// MaxWriteSize returns the maximum size of a packet written to d, including
+// its packet information and link headers.
+func (d *Device) MaxWriteSize() (int64, error) {
+	mtu, err := d.MTU()
+	if err != nil {
+		return 0, err
+	}
+	d.mu.RLock()
+	flags := d.flags
+	d.mu.RUnlock()
+	size := int64(mtu)
+	if !flags.NoPacketInfo {
+		size += PacketInfoHeaderSize
+	}
+	if flags.TAP {
+		size += header.EthernetMinimumSize
+	}
+	return size, nil
+}
+
 // Write inject one inbound packet to the network interface.
 func (d *Device) Write(data *buffer.View) (int64, error) {
 	d.mu.RLock()
 	endpoint := d.endpoint
+	detached := d.detached
 	d.mu.RUnlock()
-	if endpoint == nil {
+	if endpoint == nil || detached {
 		return 0, linuxerr.EBADFD
 	}
 	if !endpoint.IsAttached() {
@@ -253,13 +355,14 @@ func (d *Device) Write(data *buffer.View) (int64, error) {
 // Read reads one outgoing packet from the network interface.
 func (d *Device) Read() (*buffer.View, error) {
 	d.mu.RLock()
-	endpoint := d.endpoint
+	queue := d.queue
+	detached := d.detached
 	d.mu.RUnlock()
-	if endpoint == nil {
+	if queue == nil || detached {
 		return nil, linuxerr.EBADFD
 	}
 
-	pkt := endpoint.Read()
+	pkt := queue.Read()
 	if pkt.IsNil() {
 		return nil, linuxerr.ErrWouldBlock
 	}
@@ -312,9 +415,9 @@ func (d *Device) Flags() Flags {
 func (d *Device) Readiness(mask waiter.EventMask) waiter.EventMask {
 	if mask&waiter.ReadableEvents != 0 {
 		d.mu.RLock()
-		endpoint := d.endpoint
+		queue := d.queue
 		d.mu.RUnlock()
-		if endpoint != nil && endpoint.NumQueued() == 0 {
+		if queue != nil && queue.NumQueued() == 0 {
 			mask &= ^waiter.ReadableEvents
 		}
 	}
@@ -334,10 +437,72 @@ type tunEndpoint struct {
 	tunEndpointRefs
 	*channel.Endpoint
 
-	stack *stack.Stack
-	nicID tcpip.NICID
-	name  string
-	isTap bool
+	stack      *stack.Stack
+	nicID      tcpip.NICID
+	name       string
+	isTap      bool
+	multiQueue bool
+
+	// queues are the outbound packet queues of the Devices attached to a
+	// multiqueue NIC. Outbound packets are steered to them by flow.
+	queuesMu sync.RWMutex
+	queues   []*channel.Endpoint
+}
+
+// attachQueue adds q to the queues that outbound packets are steered to.
+func (e *tunEndpoint) attachQueue(q *channel.Endpoint) error {
+	e.queuesMu.Lock()
+	defer e.queuesMu.Unlock()
+	if len(e.queues) >= maxQueues {
+		return linuxerr.E2BIG
+	}
+	e.queues = append(e.queues, q)
+	return nil
+}
+
+// detachQueue removes q from the queues that outbound packets are steered to.
+func (e *tunEndpoint) detachQueue(q *channel.Endpoint) {
+	e.queuesMu.Lock()
+	defer e.queuesMu.Unlock()
+	for i, eq := range e.queues {
+		if eq == q {
+			e.queues = append(e.queues[:i], e.queues[i+1:]...)
+			return
+		}
+	}
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+func (e *tunEndpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	if !e.multiQueue {
+		return e.Endpoint.WritePackets(pkts)
+	}
+	e.queuesMu.RLock()
+	defer e.queuesMu.RUnlock()
+	if len(e.queues) == 0 {
+		// Like Linux, drop packets if no queue is attached.
+		return pkts.Len(), nil
+	}
+	n := 0
+	for _, pkt := range pkts.AsSlice() {
+		// Packets of the same flow are steered to the same queue. Packets
+		// without a transport layer hash all go to the first queue.
+		q := e.queues[pkt.Hash%uint32(len(e.queues))]
+		var l stack.PacketBufferList
+		l.PushBack(pkt)
+		written, err := q.WritePackets(l)
+		if err != nil {
+			if n == 0 {
+				return 0, err
+			}
+			break
+		}
+		if written == 0 {
+			break
+		}
+		n++
+	}
+	return n, nil
 }
 
 // DecRef decrements refcount of e, removing NIC if it reaches 0.
@@ -804,6 +804,46 @@ func TestDADARPRequestPacket(t *testing.T) {
 	}
 }
 
+func TestAnnounceLinkAddress(t *testing.T) {
+	c := makeTestContext(t, 0, 1)
+	defer c.cleanup()
+
+	if err := c.s.AnnounceLinkAddress(nicID, ipv4.ProtocolNumber); err != nil {
+		t.Fatalf("c.s.AnnounceLinkAddress(%d, %d): %s", nicID, ipv4.ProtocolNumber, err)
+	}
+
+	pkt := c.linkEP.Read()
+	if pkt.IsNil() {
+		t.Fatal("expected to send an ARP request")
+	}
+	if pkt.EgressRoute.RemoteLinkAddress != header.EthernetBroadcastAddress {
+		t.Errorf("got pkt.EgressRoute.RemoteLinkAddress = %s, want = %s", pkt.EgressRoute.RemoteLinkAddress, header.EthernetBroadcastAddress)
+	}
+	payload := stack.PayloadSince(pkt.NetworkHeader())
+	defer payload.Release()
+	req := header.ARP(payload.AsSlice())
+	pkt.DecRef()
+	if !req.IsValid() {
+		t.Errorf("got req.IsValid() = false, want = true")
+	}
+	if got := req.Op(); got != header.ARPRequest {
+		t.Errorf("got req.Op() = %d, want = %d", got, header.ARPRequest)
+	}
+	if got := tcpip.LinkAddress(req.HardwareAddressSender()); got != stackLinkAddr {
+		t.Errorf("got req.HardwareAddressSender() = %s, want = %s", got, stackLinkAddr)
+	}
+	if got := tcpip.AddrFromSlice(req.ProtocolAddressSender()); got != stackAddr {
+		t.Errorf("got req.ProtocolAddressSender() = %s, want = %s", got, stackAddr)
+	}
+	if got := tcpip.AddrFromSlice(req.ProtocolAddressTarget()); got != stackAddr {
+		t.Errorf("got req.ProtocolAddressTarget() = %s, want = %s", got, stackAddr)
+	}
+
+	if err := c.s.AnnounceLinkAddress(nicID+1, ipv4.ProtocolNumber); err == nil {
+		t.Errorf("c.s.AnnounceLinkAddress(%d, %d) succeeded for an unknown NIC", nicID+1, ipv4.ProtocolNumber)
+	}
+}
+
 func TestMain(m *testing.M) {
 	refs.SetLeakMode(refs.LeaksPanic)
 	code := m.Run()
@@ -539,6 +539,13 @@ func (e *endpoint) writePacket(r *stack.Route, pkt stack.PacketBufferPtr) tcpip.
 }
 
 func (e *endpoint) writePacketPostRouting(r *stack.Route, pkt stack.PacketBufferPtr, headerIncluded bool) tcpip.Error {
+	// Like Linux's cgroup egress programs, the packet filter of the sending
+	// endpoint also sees packets that are looped back, and the sender gets
+	// EPERM for packets it drops.
+	if !stack.FilterEgress(pkt, e.nic.ID()) {
+		e.stats.ip.OutgoingPacketErrors.Increment()
+		return &tcpip.ErrNotPermitted{}
+	}
 	if r.Loop()&stack.PacketLoop != 0 {
 		// If the packet was generated by the stack (not a raw/packet endpoint
 		// where a packet may be written with the header included), then we can
@@ -60,6 +60,11 @@ const (
 	// Netstack.
 	DefaultTTL = 64
 
+	// DefaultMaxExtensionHeaderOptions is the default maximum number of
+	// options, not counting padding, in a Hop-by-Hop or Destination Options
+	// header. It matches Linux's IP6_DEFAULT_MAX_{HBH,DST}_OPTS_CNT.
+	DefaultMaxExtensionHeaderOptions = 8
+
 	// buckets for fragment identifiers
 	buckets = 2048
 )
@@ -796,6 +801,10 @@ func (e *endpoint) handleFragments(r *stack.Route, networkMTU uint32, pkt stack.
 
 // WritePacket writes a packet to the given destination address and protocol.
 func (e *endpoint) WritePacket(r *stack.Route, params stack.NetworkHeaderParams, pkt stack.PacketBufferPtr) tcpip.Error {
+	if len(params.SegmentRoutingHeader) != 0 {
+		return e.writeSegmentRoutedPacket(r, params, pkt)
+	}
+
 	dstAddr := r.RemoteAddress()
 	if err := addIPHeader(r.LocalAddress(), dstAddr, pkt, params, nil /* extensionHeaders */); err != nil {
 		return err
@@ -830,6 +839,13 @@ func (e *endpoint) WritePacket(r *stack.Route, params stack.NetworkHeaderParams,
 }
 
 func (e *endpoint) writePacket(r *stack.Route, pkt stack.PacketBufferPtr, protocol tcpip.TransportProtocolNumber, headerIncluded bool) tcpip.Error {
+	// Like Linux's cgroup egress programs, the packet filter of the sending
+	// endpoint also sees packets that are looped back, and the sender gets
+	// EPERM for packets it drops.
+	if !stack.FilterEgress(pkt, e.nic.ID()) {
+		e.stats.ip.OutgoingPacketErrors.Increment()
+		return &tcpip.ErrNotPermitted{}
+	}
 	if r.Loop()&stack.PacketLoop != 0 {
 		// If the packet was generated by the stack (not a raw/packet endpoint
 		// where a packet may be written with the header included), then we can
@@ -1417,7 +1433,7 @@ func (e *endpoint) processExtensionHeader(it *header.IPv6PayloadIterator, pkt *s
 			return true, err
 		}
 	case header.IPv6RoutingExtHdr:
-		if err := e.processIPv6RoutingExtHeader(&extHdr, it, *pkt); err != nil {
+		if done, err := e.processIPv6RoutingExtHeader(&extHdr, it, *pkt); err != nil || done {
 			return true, err
 		}
 	case header.IPv6FragmentExtHdr:
@@ -1573,7 +1589,10 @@ func (e *endpoint) processIPv6RawPayloadHeader(extHdr *header.IPv6RawPayloadHead
 	}
 }
 
-func (e *endpoint) processIPv6RoutingExtHeader(extHdr *header.IPv6RoutingExtHdr, it *header.IPv6PayloadIterator, pkt stack.PacketBufferPtr) error {
+// processIPv6RoutingExtHeader processes a Routing extension header. It returns
+// true if the packet was resubmitted to a new destination and should not be
+// processed further.
+func (e *endpoint) processIPv6RoutingExtHeader(extHdr *header.IPv6RoutingExtHdr, it *header.IPv6PayloadIterator, pkt stack.PacketBufferPtr) (bool, error) {
 	// As per RFC 8200 section 4.4, if a node encounters a routing header with
 	// an unrecognized routing type value, with a non-zero Segments Left
 	// value, the node must discard the packet and send an ICMP Parameter
@@ -1583,21 +1602,41 @@ func (e *endpoint) processIPv6RoutingExtHeader(extHdr *header.IPv6RoutingExtHdr,
 	// If the Segments Left is 0, the node must ignore the Routing extension
 	// header and process the next header in the packet.
 	//
-	// Note, the stack does not yet handle any type of routing extension
-	// header, so we just make sure Segments Left is zero before processing
-	// the next extension header.
+	// Note, the stack only handles Segment Routing Headers, and only when
+	// enabled, so we otherwise just make sure Segments Left is zero before
+	// processing the next extension header.
 	if extHdr.SegmentsLeft() == 0 {
-		return nil
+		return false, nil
+	}
+	if extHdr.RoutingType() == header.IPv6SegmentRoutingType && e.protocol.segmentRoutingEnabled() {
+		return true, e.processSegmentRoutingHeader(it.HeaderOffset(), pkt)
 	}
 	_ = e.protocol.returnError(&icmpReasonParameterProblem{
 		code:    header.ICMPv6ErroneousHeader,
 		pointer: it.ParseOffset(),
 	}, pkt, true /* deliveredLocally */)
-	return fmt.Errorf("found unrecognized routing type with non-zero segments left in header = %#v", extHdr)
+	return false, fmt.Errorf("found unrecognized routing type with non-zero segments left in header = %#v", extHdr)
+}
+
+// optionsLimit returns the maximum number of options in an options extension
+// header and whether options unknown to the stack are allowed, given a limit
+// from tcpip.IPv6ExtensionHeaderLimitsOption.
+func optionsLimit(limit int32) (int, bool) {
+	if limit < 0 {
+		return -int(limit), false
+	}
+	return int(limit), true
 }
 
 func (e *endpoint) processIPv6DestinationOptionsExtHdr(extHdr *header.IPv6DestinationOptionsExtHdr, it *header.IPv6PayloadIterator, pkt stack.PacketBufferPtr, dstAddr tcpip.Address) error {
 	stats := e.stats.ip
+	if extHdr.Length() > int(e.protocol.maxDestinationLength.Load()) {
+		stats.MalformedPacketsReceived.Increment()
+		return fmt.Errorf("found Destination Options header with length %d over the limit", extHdr.Length())
+	}
+	maxOpts, allowUnknown := optionsLimit(e.protocol.maxDestinationOptions.Load())
+	numOpts := 0
+
 	optsIt := extHdr.Iter()
 	var uopt *header.IPv6UnknownExtHdrOption
 	defer func() {
@@ -1618,9 +1657,18 @@ func (e *endpoint) processIPv6DestinationOptionsExtHdr(extHdr *header.IPv6Destin
 		if done {
 			break
 		}
+		numOpts++
+		if numOpts > maxOpts {
+			stats.MalformedPacketsReceived.Increment()
+			return fmt.Errorf("found more than %d Destination Options header options", maxOpts)
+		}
 
 		// We currently do not support any IPv6 Destination extension header
 		// options.
+		if !allowUnknown {
+			stats.MalformedPacketsReceived.Increment()
+			return fmt.Errorf("found unknown destination header option = %#v", opt)
+		}
 		switch opt.UnknownAction() {
 		case header.IPv6OptionUnknownActionSkip:
 		case header.IPv6OptionUnknownActionDiscard:
@@ -1671,6 +1719,13 @@ func (e *endpoint) processIPv6HopByHopOptionsExtHdr(extHdr *header.IPv6HopByHopO
 		return fmt.Errorf("found Hop-by-Hop header = %#v with non-zero previous header offset = %d", extHdr, previousHeaderStart)
 	}
 
+	if extHdr.Length() > int(e.protocol.maxHopByHopLength.Load()) {
+		stats.MalformedPacketsReceived.Increment()
+		return fmt.Errorf("found Hop-by-Hop header with length %d over the limit", extHdr.Length())
+	}
+	maxOpts, allowUnknown := optionsLimit(e.protocol.maxHopByHopOptions.Load())
+	numOpts := 0
+
 	optsIt := extHdr.Iter()
 	var uopt *header.IPv6UnknownExtHdrOption
 	defer func() {
@@ -1691,6 +1746,11 @@ func (e *endpoint) processIPv6HopByHopOptionsExtHdr(extHdr *header.IPv6HopByHopO
 		if done {
 			break
 		}
+		numOpts++
+		if numOpts > maxOpts {
+			stats.MalformedPacketsReceived.Increment()
+			return fmt.Errorf("found more than %d Hop-by-Hop header options", maxOpts)
+		}
 
 		switch opt := opt.(type) {
 		case *header.IPv6RouterAlertOption:
@@ -1706,6 +1766,10 @@ func (e *endpoint) processIPv6HopByHopOptionsExtHdr(extHdr *header.IPv6HopByHopO
 			*routerAlert = opt
 			stats.OptionRouterAlertReceived.Increment()
 		default:
+			if !allowUnknown {
+				stats.MalformedPacketsReceived.Increment()
+				return fmt.Errorf("found unknown Hop-by-Hop header option = %#v", opt)
+			}
 			switch opt.UnknownAction() {
 			case header.IPv6OptionUnknownActionSkip:
 			case header.IPv6OptionUnknownActionDiscard:
@@ -2295,6 +2359,17 @@ type protocol struct {
 	// uint8 portion of it is meaningful.
 	defaultTTL atomicbitops.Uint32
 
+	// segmentRouting is 1 if Segment Routing Headers in packets addressed to
+	// the stack are processed.
+	segmentRouting atomicbitops.Uint32
+
+	// The limits on Hop-by-Hop and Destination Options headers. See
+	// tcpip.IPv6ExtensionHeaderLimitsOption.
+	maxHopByHopOptions    atomicbitops.Int32
+	maxHopByHopLength     atomicbitops.Int32
+	maxDestinationOptions atomicbitops.Int32
+	maxDestinationLength  atomicbitops.Int32
+
 	fragmentation   *fragmentation.Fragmentation
 	icmpRateLimiter *stack.ICMPRateLimiter
 
@@ -2401,6 +2476,19 @@ func (p *protocol) SetOption(option tcpip.SettableNetworkProtocolOption) tcpip.E
 	case *tcpip.DefaultTTLOption:
 		p.SetDefaultTTL(uint8(*v))
 		return nil
+	case *tcpip.IPv6SegmentRoutingOption:
+		var enabled uint32
+		if *v {
+			enabled = 1
+		}
+		p.segmentRouting.Store(enabled)
+		return nil
+	case *tcpip.IPv6ExtensionHeaderLimitsOption:
+		if v.MaxHopByHopLength < 0 || v.MaxDestinationLength < 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.setExtensionHeaderLimits(*v)
+		return nil
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
@@ -2412,6 +2500,17 @@ func (p *protocol) Option(option tcpip.GettableNetworkProtocolOption) tcpip.Erro
 	case *tcpip.DefaultTTLOption:
 		*v = tcpip.DefaultTTLOption(p.DefaultTTL())
 		return nil
+	case *tcpip.IPv6SegmentRoutingOption:
+		*v = tcpip.IPv6SegmentRoutingOption(p.segmentRoutingEnabled())
+		return nil
+	case *tcpip.IPv6ExtensionHeaderLimitsOption:
+		*v = tcpip.IPv6ExtensionHeaderLimitsOption{
+			MaxHopByHopOptions:    p.maxHopByHopOptions.Load(),
+			MaxHopByHopLength:     p.maxHopByHopLength.Load(),
+			MaxDestinationOptions: p.maxDestinationOptions.Load(),
+			MaxDestinationLength:  p.maxDestinationLength.Load(),
+		}
+		return nil
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
@@ -2427,6 +2526,17 @@ func (p *protocol) DefaultTTL() uint8 {
 	return uint8(p.defaultTTL.Load())
 }
 
+func (p *protocol) segmentRoutingEnabled() bool {
+	return p.segmentRouting.Load() == 1
+}
+
+func (p *protocol) setExtensionHeaderLimits(limits tcpip.IPv6ExtensionHeaderLimitsOption) {
+	p.maxHopByHopOptions.Store(limits.MaxHopByHopOptions)
+	p.maxHopByHopLength.Store(limits.MaxHopByHopLength)
+	p.maxDestinationOptions.Store(limits.MaxDestinationOptions)
+	p.maxDestinationLength.Store(limits.MaxDestinationLength)
+}
+
 // emitMulticastEvent emits a multicast forwarding event using the provided
 // generator if a valid event dispatcher exists.
 func (e *endpoint) emitMulticastEvent(eventGenerator func(stack.MulticastForwardingEventDispatcher)) {
@@ -2768,6 +2878,12 @@ func NewProtocolWithOptions(opts Options) stack.NetworkProtocolFactory {
 		p.fragmentation = fragmentation.NewFragmentation(header.IPv6FragmentExtHdrFragmentOffsetBytesPerUnit, fragmentation.HighFragThreshold, fragmentation.LowFragThreshold, ReassembleTimeout, s.Clock(), p)
 		p.mu.eps = make(map[tcpip.NICID]*endpoint)
 		p.SetDefaultTTL(DefaultTTL)
+		p.setExtensionHeaderLimits(tcpip.IPv6ExtensionHeaderLimitsOption{
+			MaxHopByHopOptions:    DefaultMaxExtensionHeaderOptions,
+			MaxHopByHopLength:     math.MaxInt32,
+			MaxDestinationOptions: DefaultMaxExtensionHeaderOptions,
+			MaxDestinationLength:  math.MaxInt32,
+		})
 		// Set default ICMP rate limiting to Linux defaults.
 		//
 		// Default: 0-1,3-127 (rate limit ICMPv6 errors except Packet Too Big)
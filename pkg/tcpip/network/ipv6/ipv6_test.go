@@ -431,6 +431,9 @@ func TestReceiveIPv6ExtHdrs(t *testing.T) {
 		ICMPCode   header.ICMPv6Code
 		pointer    uint32
 		multicast  bool
+		// Network protocol options to set before receiving the packet.
+		segmentRouting bool
+		extHdrLimits   *tcpip.IPv6ExtensionHeaderLimitsOption
 	}{
 		{
 			name:         "None",
@@ -918,6 +921,70 @@ func TestReceiveIPv6ExtHdrs(t *testing.T) {
 			shouldAccept: false,
 			expectICMP:   false,
 		},
+		{
+			name: "segment routing header with segment routing enabled",
+			extHdr: func(nextHdr uint8) ([]byte, uint8) {
+				srh := header.NewIPv6SegmentRoutingExtHdr([]tcpip.Address{addr2, addr2})
+				srh[0] = nextHdr
+				return srh, routingExtHdrID
+			},
+			segmentRouting: true,
+			shouldAccept:   true,
+		},
+		{
+			name: "segment routing header with segments left over last entry",
+			extHdr: func(nextHdr uint8) ([]byte, uint8) {
+				return append([]byte{
+					nextHdr, 2, 4, 2, 0, 0, 0, 0,
+				}, addr2.AsSlice()...), routingExtHdrID
+			},
+			segmentRouting: true,
+			shouldAccept:   false,
+			countersToBeIncremented: func(stats *tcpip.Stats) []*tcpip.StatCounter {
+				return []*tcpip.StatCounter{stats.IP.MalformedPacketsReceived}
+			},
+			expectICMP: true,
+			ICMPType:   header.ICMPv6ParamProblem,
+			ICMPCode:   header.ICMPv6ErroneousHeader,
+			pointer:    header.IPv6FixedHeaderSize + 3,
+		},
+		{
+			name: "destination with skippable unknown option over the length limit",
+			extHdr: func(nextHdr uint8) ([]byte, uint8) {
+				return []byte{
+					nextHdr, 1,
+
+					// Skippable unknown.
+					62, 12, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+				}, destinationExtHdrID
+			},
+			extHdrLimits: &tcpip.IPv6ExtensionHeaderLimitsOption{
+				MaxHopByHopOptions:    DefaultMaxExtensionHeaderOptions,
+				MaxHopByHopLength:     math.MaxInt32,
+				MaxDestinationOptions: DefaultMaxExtensionHeaderOptions,
+				MaxDestinationLength:  8,
+			},
+			shouldAccept: false,
+			countersToBeIncremented: func(stats *tcpip.Stats) []*tcpip.StatCounter {
+				return []*tcpip.StatCounter{stats.IP.MalformedPacketsReceived}
+			},
+		},
+		{
+			name: "destination with skippable unknown option and unknown options disallowed",
+			extHdr: func(nextHdr uint8) ([]byte, uint8) {
+				return []byte{nextHdr, 0, 62, 4, 1, 2, 3, 4}, destinationExtHdrID
+			},
+			extHdrLimits: &tcpip.IPv6ExtensionHeaderLimitsOption{
+				MaxHopByHopOptions:    DefaultMaxExtensionHeaderOptions,
+				MaxHopByHopLength:     math.MaxInt32,
+				MaxDestinationOptions: -DefaultMaxExtensionHeaderOptions,
+				MaxDestinationLength:  math.MaxInt32,
+			},
+			shouldAccept: false,
+			countersToBeIncremented: func(stats *tcpip.Stats) []*tcpip.StatCounter {
+				return []*tcpip.StatCounter{stats.IP.MalformedPacketsReceived}
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -947,6 +1014,18 @@ func TestReceiveIPv6ExtHdrs(t *testing.T) {
 				},
 			})
 
+			if test.segmentRouting {
+				opt := tcpip.IPv6SegmentRoutingOption(true)
+				if err := s.SetNetworkProtocolOption(ProtocolNumber, &opt); err != nil {
+					t.Fatalf("SetNetworkProtocolOption(%d, &%T(%t)): %s", ProtocolNumber, opt, opt, err)
+				}
+			}
+			if test.extHdrLimits != nil {
+				if err := s.SetNetworkProtocolOption(ProtocolNumber, test.extHdrLimits); err != nil {
+					t.Fatalf("SetNetworkProtocolOption(%d, %#v): %s", ProtocolNumber, test.extHdrLimits, err)
+				}
+			}
+
 			wq := waiter.Queue{}
 			we, ch := waiter.NewChannelEntry(waiter.WritableEvents)
 			wq.EventRegister(&we)
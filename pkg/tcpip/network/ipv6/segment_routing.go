@@ -0,0 +1,208 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipv6
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// processSegmentRoutingHeader processes a Segment Routing Header with a
+// non-zero Segments Left field that starts at offset off from the start of
+// pkt's network header.
+//
+// As per RFC 8754 section 4.3.1.1, the packet is updated to be sent to the
+// next segment in the Segment List, and is then either processed again
+// locally or forwarded. pkt itself is never delivered further, so callers must
+// stop processing it once this method returns.
+func (e *endpoint) processSegmentRoutingHeader(off uint32, pkt stack.PacketBufferPtr) error {
+	stats := e.stats.ip
+
+	payload := stack.BufferSince(pkt.NetworkHeader())
+	b := payload.Flatten()
+	payload.Release()
+
+	h := header.IPv6(b)
+	srh := header.IPv6SegmentRoutingExtHdr(b[off:])
+	srh = srh[:srh.Length()]
+
+	// As per RFC 8754 section 4.3.1.1:
+	//
+	//   S01. When an SRH is processed {
+	//   S02.   If Segments Left is equal to zero {
+	//   S03.     Proceed to process the next header in the packet,
+	//            whose type is identified by the Next Header field in
+	//            the Routing header.
+	//   S04.   }
+	//   S05.   Else {
+	//   S06.     If local configuration requires any TLV processing {
+	//   S07.       Perform TLV processing (see TLV Processing)
+	//   S08.     }
+	//   S09.     max_LE = (Hdr Ext Len / 2) - 1
+	//   S10.     If ((Last Entry > max_LE) or (Segments Left > Last Entry+1)) {
+	//   S11.       Send an ICMP Parameter Problem, Code 0, message to
+	//              the Source Address, pointing to the Segments Left
+	//              field, and discard the packet.
+	//   S12.     }
+	//   S13.     Else {
+	//   S14.       Decrement Segments Left by 1.
+	//   S15.       Copy Segment List[Segments Left] from the SRH to the
+	//              destination address of the IPv6 header.
+	//   S16.       If the IPv6 Hop Limit is less than or equal to 1 {
+	//   S17.         Send an ICMP Time Exceeded -- Hop Limit Exceeded in
+	//                Transit message to the Source Address and discard
+	//                the packet.
+	//   S18.       }
+	//   S19.       Else {
+	//   S20.         Decrement the Hop Limit by 1
+	//   S21.         Resubmit the packet to the IPv6 module for transmission
+	//                to the new destination.
+	//   S22.       }
+	//   S23.     }
+	//   S24.   }
+	//   S25. }
+	//
+	// Like Linux, we point to the Last Entry field when it is the field in
+	// error.
+	maxLastEntry := (srh.Length()-header.IPv6SegmentRoutingExtHdrMinimumSize)/header.IPv6AddressSize - 1
+	if int(srh.LastEntry()) > maxLastEntry {
+		stats.MalformedPacketsReceived.Increment()
+		_ = e.protocol.returnError(&icmpReasonParameterProblem{
+			code:    header.ICMPv6ErroneousHeader,
+			pointer: off + srh.LastEntryOffset(),
+		}, pkt, true /* deliveredLocally */)
+		return fmt.Errorf("found Segment Routing Header with last entry %d over %d", srh.LastEntry(), maxLastEntry)
+	}
+	if srh.SegmentsLeft() > srh.LastEntry()+1 {
+		stats.MalformedPacketsReceived.Increment()
+		_ = e.protocol.returnError(&icmpReasonParameterProblem{
+			code:    header.ICMPv6ErroneousHeader,
+			pointer: off + srh.SegmentsLeftOffset(),
+		}, pkt, true /* deliveredLocally */)
+		return fmt.Errorf("found Segment Routing Header with segments left %d over last entry %d", srh.SegmentsLeft(), srh.LastEntry())
+	}
+
+	// As per RFC 4291 section 2.7, multicast addresses must not appear in any
+	// Routing header.
+	sl := srh.SegmentsLeft() - 1
+	dstAddr := srh.Segment(int(sl))
+	if header.IsV6MulticastAddress(dstAddr) {
+		stats.InvalidDestinationAddressesReceived.Increment()
+		return fmt.Errorf("found multicast address %s in Segment Routing Header", dstAddr)
+	}
+	srh.SetSegmentsLeft(sl)
+	h.SetDestinationAddress(dstAddr)
+
+	ep := e.protocol.findEndpointWithAddress(dstAddr)
+	if ep == nil && !e.Forwarding() {
+		stats.InvalidDestinationAddressesReceived.Increment()
+		return fmt.Errorf("found non-local next segment %s with forwarding disabled", dstAddr)
+	}
+	if ep != nil {
+		// Packets forwarded by the stack have their Hop Limit checked and
+		// decremented when forwarded, so only do it here when the next segment
+		// is local.
+		if h.HopLimit() <= 1 {
+			_ = e.protocol.returnError(&icmpReasonHopLimitExceeded{}, pkt, false /* deliveredLocally */)
+			return fmt.Errorf("found Segment Routing Header with hop limit %d", h.HopLimit())
+		}
+		h.SetHopLimit(h.HopLimit() - 1)
+	}
+
+	newPkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(b),
+	})
+	defer newPkt.DecRef()
+	newPkt.NICID = pkt.NICID
+	newPkt.PktType = pkt.PktType
+	newPkt.RXChecksumValidated = pkt.RXChecksumValidated
+
+	hView, ok := e.protocol.parseAndValidate(newPkt)
+	if !ok {
+		stats.MalformedPacketsReceived.Increment()
+		return fmt.Errorf("failed to parse packet with updated Segment Routing Header")
+	}
+	defer hView.Release()
+
+	if ep != nil {
+		return ep.processExtensionHeaders(hView.AsSlice(), newPkt, false /* forwarding */)
+	}
+	e.handleForwardingError(e.forwardUnicastPacket(newPkt))
+	return nil
+}
+
+// writeSegmentRoutedPacket writes a locally generated packet with the Segment
+// Routing Header in params.
+//
+// As in Linux, the header is copied with Segment List[0] set to the route's
+// remote address, and the packet is sent to Segment List[Segments Left]
+// through the route to that segment.
+func (e *endpoint) writeSegmentRoutedPacket(r *stack.Route, params stack.NetworkHeaderParams, pkt stack.PacketBufferPtr) tcpip.Error {
+	if !params.SegmentRoutingHeader.IsValid() {
+		return &tcpip.ErrMalformedHeader{}
+	}
+	srh := append(header.IPv6SegmentRoutingExtHdr(nil), params.SegmentRoutingHeader...)
+	srh.SetSegment(0, r.RemoteAddress())
+	dstAddr := srh.Segment(int(srh.SegmentsLeft()))
+
+	stk := e.protocol.stack
+	hopRoute, err := stk.FindRoute(0 /* id */, r.LocalAddress(), dstAddr, ProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		return err
+	}
+	defer hopRoute.Release()
+	ep, ok := e.protocol.getEndpointForNIC(hopRoute.NICID())
+	if !ok {
+		return &tcpip.ErrHostUnreachable{}
+	}
+
+	// The transport layer only reserved enough space for the headers of its
+	// own route, so make room for the Segment Routing Header if needed.
+	if reserve := int(hopRoute.MaxHeaderLength()) + srh.Length(); pkt.AvailableHeaderBytes() < reserve {
+		payload := stack.BufferSince(pkt.TransportHeader())
+		newPkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			ReserveHeaderBytes: reserve,
+			Payload:            payload,
+		})
+		defer newPkt.DecRef()
+		newPkt.TransportProtocolNumber = pkt.TransportProtocolNumber
+		newPkt.Owner = pkt.Owner
+		if n := len(pkt.TransportHeader().Slice()); n != 0 {
+			if _, ok := newPkt.TransportHeader().Consume(n); !ok {
+				return &tcpip.ErrMalformedHeader{}
+			}
+		}
+		pkt = newPkt
+	}
+
+	if err := addIPHeader(r.LocalAddress(), dstAddr, pkt, params, header.IPv6ExtHdrSerializer{srh}); err != nil {
+		return err
+	}
+
+	// iptables filtering. All packets that reach here are locally
+	// generated.
+	outNicName := stk.FindNICNameFromID(ep.nic.ID())
+	if ok := stk.IPTables().CheckOutput(pkt, hopRoute, outNicName); !ok {
+		// iptables is telling us to drop the packet.
+		ep.stats.ip.IPTablesOutputDropped.Increment()
+		return nil
+	}
+
+	return ep.writePacket(hopRoute, pkt, params.Protocol, false /* headerIncluded */)
+}
@@ -143,6 +143,10 @@ type SocketOptions struct {
 	// messages are enabled.
 	passCredEnabled atomicbitops.Uint32
 
+	// passSecEnabled determines whether SCM_SECURITY socket control
+	// messages are enabled.
+	passSecEnabled atomicbitops.Uint32
+
 	// noChecksumEnabled determines whether UDP checksum is disabled while
 	// transmitting for this socket.
 	noChecksumEnabled atomicbitops.Uint32
@@ -251,9 +255,18 @@ type SocketOptions struct {
 	// close. We currently implement this option for TCP socket only.
 	linger LingerOption
 
+	// ipv6RoutingHeader is the IPv6 Routing Header added to packets sent by
+	// the socket, as set by IPV6_RTHDR. We currently implement this option
+	// for Segment Routing Headers on datagram sockets only.
+	ipv6RoutingHeader []byte
+
 	// rcvlowat specifies the minimum number of bytes which should be
 	// received to indicate the socket as readable.
 	rcvlowat atomicbitops.Int32
+
+	// packetFilter filters the packets received by the socket. It is nil if
+	// received packets aren't filtered.
+	packetFilter PacketFilter
 }
 
 // InitHandler initializes the handler. This must be called before using the
@@ -298,6 +311,16 @@ func (so *SocketOptions) SetPassCred(v bool) {
 	storeAtomicBool(&so.passCredEnabled, v)
 }
 
+// GetPassSec gets value for SO_PASSSEC option.
+func (so *SocketOptions) GetPassSec() bool {
+	return so.passSecEnabled.Load() != 0
+}
+
+// SetPassSec sets value for SO_PASSSEC option.
+func (so *SocketOptions) SetPassSec(v bool) {
+	storeAtomicBool(&so.passSecEnabled, v)
+}
+
 // GetNoChecksum gets value for SO_NO_CHECK option.
 func (so *SocketOptions) GetNoChecksum() bool {
 	return so.noChecksumEnabled.Load() != 0
@@ -530,6 +553,39 @@ func (so *SocketOptions) SetLinger(linger LingerOption) {
 	so.mu.Unlock()
 }
 
+// GetPacketFilter returns the filter of received packets, or nil if received
+// packets aren't filtered.
+func (so *SocketOptions) GetPacketFilter() PacketFilter {
+	so.mu.Lock()
+	f := so.packetFilter
+	so.mu.Unlock()
+	return f
+}
+
+// SetPacketFilter sets the filter of received packets.
+func (so *SocketOptions) SetPacketFilter(f PacketFilter) {
+	so.mu.Lock()
+	so.packetFilter = f
+	so.mu.Unlock()
+}
+
+// GetIPv6RoutingHeader gets value for IPV6_RTHDR option. The returned slice
+// must not be modified.
+func (so *SocketOptions) GetIPv6RoutingHeader() []byte {
+	so.mu.Lock()
+	hdr := so.ipv6RoutingHeader
+	so.mu.Unlock()
+	return hdr
+}
+
+// SetIPv6RoutingHeader sets value for IPV6_RTHDR option. hdr must not be
+// modified after the call.
+func (so *SocketOptions) SetIPv6RoutingHeader(hdr []byte) {
+	so.mu.Lock()
+	so.ipv6RoutingHeader = hdr
+	so.mu.Unlock()
+}
+
 // SockErrOrigin represents the constants for error origin.
 type SockErrOrigin uint8
 
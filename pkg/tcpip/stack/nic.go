@@ -650,6 +650,24 @@ func (n *nic) removeNeighbor(protocol tcpip.NetworkProtocolNumber, addr tcpip.Ad
 	return &tcpip.ErrNotSupported{}
 }
 
+func (n *nic) announceLinkAddress(protocol tcpip.NetworkProtocolNumber) tcpip.Error {
+	linkRes, ok := n.linkAddrResolvers[protocol]
+	if !ok {
+		return &tcpip.ErrNotSupported{}
+	}
+
+	for _, addr := range n.allPermanentAddresses() {
+		if addr.Protocol != protocol {
+			continue
+		}
+		a := addr.AddressWithPrefix.Address
+		if err := linkRes.resolver.LinkAddressRequest(a, a, "" /* remoteLinkAddr */); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (n *nic) clearNeighbors(protocol tcpip.NetworkProtocolNumber) tcpip.Error {
 	if linkRes, ok := n.linkAddrResolvers[protocol]; ok {
 		linkRes.neigh.clear()
@@ -0,0 +1,89 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// FilterView is the header at which an endpoint's socket filter sees received
+// packets start.
+type FilterView int
+
+const (
+	// FilterFromLink is used by packet endpoints that aren't cooked.
+	FilterFromLink FilterView = iota
+
+	// FilterFromNetwork is used by raw and cooked packet endpoints.
+	FilterFromNetwork
+
+	// FilterFromTransport is used by TCP, UDP and ICMP endpoints.
+	FilterFromTransport
+)
+
+// FilterIngress runs f on pkt, which was received by an endpoint whose socket
+// filter sees packets starting at view. It returns false if the packet must be
+// dropped. Otherwise, it returns the maximum number of bytes of the packet,
+// starting at view, to deliver.
+//
+// Callers should only call FilterIngress if f.FiltersIngress() is true, since
+// it copies the packet.
+func FilterIngress(f tcpip.PacketFilter, pkt PacketBufferPtr, view FilterView) (int, bool) {
+	link := pkt.LinkHeader().Slice()
+	network := pkt.NetworkHeader().Slice()
+	transport := pkt.TransportHeader().Slice()
+	data := pkt.Data().AsRange()
+
+	fp := tcpip.FilteredPacket{
+		NetProto: pkt.NetworkProtocolNumber,
+		PktType:  pkt.PktType,
+		NICID:    pkt.NICID,
+	}
+	b := make([]byte, 0, len(link)+len(network)+len(transport)+data.Size())
+	if view == FilterFromLink {
+		b = append(b, link...)
+		fp.NetworkOffset = len(b)
+	}
+	b = append(b, network...)
+	if view == FilterFromTransport {
+		fp.DataOffset = len(b)
+	}
+	b = append(b, transport...)
+	fp.Bytes = append(b, data.ToSlice()...)
+	return f.FilterIngress(&fp)
+}
+
+// FilterEgress returns false if pkt, which is about to be sent on nicID, must
+// be dropped by the packet filter of the endpoint that sent it. The packet
+// filter of an endpoint is its PacketOwner, if the owner implements
+// tcpip.PacketFilter.
+func FilterEgress(pkt PacketBufferPtr, nicID tcpip.NICID) bool {
+	f, ok := pkt.Owner.(tcpip.PacketFilter)
+	if !ok || !f.FiltersEgress() {
+		return true
+	}
+	network := pkt.NetworkHeader().Slice()
+	transport := pkt.TransportHeader().Slice()
+	data := pkt.Data().AsRange()
+	b := make([]byte, 0, len(network)+len(transport)+data.Size())
+	b = append(b, network...)
+	b = append(b, transport...)
+	return f.FilterEgress(&tcpip.FilteredPacket{
+		Bytes:    append(b, data.ToSlice()...),
+		NetProto: pkt.NetworkProtocolNumber,
+		PktType:  tcpip.PacketOutgoing,
+		NICID:    nicID,
+	})
+}
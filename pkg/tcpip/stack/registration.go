@@ -319,6 +319,10 @@ type NetworkHeaderParams struct {
 
 	// TOS refers to TypeOfService or TrafficClass field of the IP-header.
 	TOS uint8
+
+	// SegmentRoutingHeader, if set, is an IPv6 Segment Routing Header to
+	// route the packet through. It is ignored by IPv4.
+	SegmentRoutingHeader header.IPv6SegmentRoutingExtHdr
 }
 
 // GroupAddressableEndpoint is an endpoint that supports group addressing.
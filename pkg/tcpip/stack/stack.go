@@ -306,8 +306,9 @@ func (t *TransportEndpointInfo) AddrNetProtoLocked(addr tcpip.FullAddress, v6onl
 	switch {
 	case netProto == t.NetProto:
 	case netProto == header.IPv4ProtocolNumber && t.NetProto == header.IPv6ProtocolNumber:
+		// As in Linux, IPv4 peers are unreachable from IPv6 only endpoints.
 		if v6only {
-			return tcpip.FullAddress{}, 0, &tcpip.ErrHostUnreachable{}
+			return tcpip.FullAddress{}, 0, &tcpip.ErrNetworkUnreachable{}
 		}
 	default:
 		return tcpip.FullAddress{}, 0, &tcpip.ErrInvalidEndpointState{}
@@ -1612,6 +1613,22 @@ func (s *Stack) RemoveNeighbor(nicID tcpip.NICID, protocol tcpip.NetworkProtocol
 	return nic.removeNeighbor(protocol, addr)
 }
 
+// AnnounceLinkAddress broadcasts the NIC's link address for each of its
+// addresses of the given protocol, e.g. with gratuitous ARP requests for IPv4.
+// This lets neighbors update stale entries after the NIC has moved, such as
+// when a sandbox is restored on a different host.
+func (s *Stack) AnnounceLinkAddress(nicID tcpip.NICID, protocol tcpip.NetworkProtocolNumber) tcpip.Error {
+	s.mu.RLock()
+	nic, ok := s.nics[nicID]
+	s.mu.RUnlock()
+
+	if !ok {
+		return &tcpip.ErrUnknownNICID{}
+	}
+
+	return nic.announceLinkAddress(protocol)
+}
+
 // ClearNeighbors removes all IP to MAC address associations.
 func (s *Stack) ClearNeighbors(nicID tcpip.NICID, protocol tcpip.NetworkProtocolNumber) tcpip.Error {
 	s.mu.RLock()
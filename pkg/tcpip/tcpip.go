@@ -673,6 +673,56 @@ type PacketOwner interface {
 	KGID() uint32
 }
 
+// FilteredPacket is a packet passed to a PacketFilter.
+type FilteredPacket struct {
+	// Bytes is a copy of the packet. It starts at the link header for
+	// packets received by packet endpoints that aren't cooked, and at the
+	// network header otherwise.
+	Bytes []byte
+
+	// NetworkOffset is the offset of the network header in Bytes.
+	NetworkOffset int
+
+	// DataOffset is the offset in Bytes at which the endpoint's socket
+	// filter sees the packet start: the transport header for TCP, UDP and
+	// ICMP endpoints, and the start of Bytes otherwise.
+	DataOffset int
+
+	// NetProto is the packet's network protocol.
+	NetProto NetworkProtocolNumber
+
+	// PktType is the packet's type.
+	PktType PacketType
+
+	// NICID is the NIC that the packet was received on or will be sent on.
+	NICID NICID
+}
+
+// PacketFilter filters the packets that an endpoint sends and receives, e.g.
+// with eBPF programs attached to its socket or to its owner's cgroup. A
+// PacketFilter is installed with SocketOptions.SetPacketFilter for received
+// packets, and is the PacketOwner of the endpoint for sent packets.
+type PacketFilter interface {
+	// FiltersIngress returns true if FilterIngress may drop or truncate
+	// received packets. It is called for every packet, so it must be cheap.
+	FiltersIngress() bool
+
+	// FilterIngress is called for each packet received by the endpoint,
+	// before it is queued. It returns false if the packet must be dropped.
+	// Otherwise, it returns the maximum number of bytes of
+	// pkt.Bytes[pkt.DataOffset:] to deliver.
+	FilterIngress(pkt *FilteredPacket) (int, bool)
+
+	// FiltersEgress returns true if FilterEgress may drop sent packets. It
+	// is called for every packet, so it must be cheap.
+	FiltersEgress() bool
+
+	// FilterEgress is called for each packet sent by the endpoint, once its
+	// network header has been written. It returns false if the packet must be
+	// dropped.
+	FilterEgress(pkt *FilteredPacket) bool
+}
+
 // ReadOptions contains options for Endpoint.Read.
 type ReadOptions struct {
 	// Peek indicates whether this read is a peek.
@@ -1021,6 +1071,47 @@ func (*DefaultTTLOption) isGettableNetworkProtocolOption() {}
 
 func (*DefaultTTLOption) isSettableNetworkProtocolOption() {}
 
+// IPv6SegmentRoutingOption is used by stack.(*Stack).NetworkProtocolOption to
+// enable or disable processing of IPv6 Segment Routing Headers in packets
+// addressed to the stack. It is the equivalent of Linux's
+// net.ipv6.conf.all.seg6_enabled sysctl.
+type IPv6SegmentRoutingOption bool
+
+func (*IPv6SegmentRoutingOption) isGettableNetworkProtocolOption() {}
+
+func (*IPv6SegmentRoutingOption) isSettableNetworkProtocolOption() {}
+
+// IPv6ExtensionHeaderLimitsOption is used by
+// stack.(*Stack).NetworkProtocolOption to limit the size of the IPv6
+// Hop-by-Hop and Destination Options extension headers that are accepted.
+// Packets with headers exceeding the limits are dropped. It is the equivalent
+// of Linux's net.ipv6.max_{hbh,dst}_opts_{number,length} sysctls.
+type IPv6ExtensionHeaderLimitsOption struct {
+	// MaxHopByHopOptions is the maximum number of options, not counting
+	// padding, in a Hop-by-Hop Options header. If it is negative, options
+	// unknown to the stack are not allowed and the maximum is its absolute
+	// value.
+	MaxHopByHopOptions int32
+
+	// MaxHopByHopLength is the maximum length in bytes of a Hop-by-Hop
+	// Options header.
+	MaxHopByHopLength int32
+
+	// MaxDestinationOptions is the maximum number of options, not counting
+	// padding, in a Destination Options header. If it is negative, options
+	// unknown to the stack are not allowed and the maximum is its absolute
+	// value.
+	MaxDestinationOptions int32
+
+	// MaxDestinationLength is the maximum length in bytes of a Destination
+	// Options header.
+	MaxDestinationLength int32
+}
+
+func (*IPv6ExtensionHeaderLimitsOption) isGettableNetworkProtocolOption() {}
+
+func (*IPv6ExtensionHeaderLimitsOption) isSettableNetworkProtocolOption() {}
+
 // GettableTransportProtocolOption is a marker interface for transport protocol
 // options that may be queried.
 type GettableTransportProtocolOption interface {
@@ -311,6 +311,10 @@ func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 }
 
 func (e *endpoint) prepareForWrite(opts tcpip.WriteOptions) (network.WriteContext, uint16, tcpip.Error) {
+	if opts.To != nil && e.isV4MappedOnV6(opts.To.Addr) {
+		return network.WriteContext{}, 0, &tcpip.ErrInvalidOptionValue{}
+	}
+
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
@@ -501,6 +505,10 @@ func (*endpoint) Disconnect() tcpip.Error {
 
 // Connect connects the endpoint to its peer. Specifying a NIC is optional.
 func (e *endpoint) Connect(addr tcpip.FullAddress) tcpip.Error {
+	if e.isV4MappedOnV6(addr.Addr) {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -631,6 +639,13 @@ func (e *endpoint) bindLocked(addr tcpip.FullAddress) tcpip.Error {
 	return nil
 }
 
+// isV4MappedOnV6 returns true if e is an ICMPv6 endpoint and addr is an
+// IPv4-mapped address. ICMPv6 messages can't be sent over IPv4 so, as in Linux,
+// such addresses are invalid for ICMPv6 endpoints.
+func (e *endpoint) isV4MappedOnV6(addr tcpip.Address) bool {
+	return e.net.NetProto() == header.IPv6ProtocolNumber && header.IsV4MappedAddress(addr)
+}
+
 func (e *endpoint) isBroadcastOrMulticast(nicID tcpip.NICID, addr tcpip.Address) bool {
 	return addr == header.IPv4Broadcast ||
 		header.IsV4MulticastAddress(addr) ||
@@ -644,6 +659,9 @@ func (e *endpoint) Bind(addr tcpip.FullAddress) tcpip.Error {
 	if addr.Addr.BitLen() != 0 && e.isBroadcastOrMulticast(addr.NIC, addr.Addr) {
 		return &tcpip.ErrBadLocalAddress{}
 	}
+	if e.isV4MappedOnV6(addr.Addr) {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
 
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -715,6 +733,18 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt stack.PacketBu
 		}
 	}
 
+	// The filter sees the packet starting at the ICMP header, like the data
+	// delivered to the socket.
+	filterLen := -1
+	if f := e.ops.GetPacketFilter(); f != nil && f.FiltersIngress() {
+		n, ok := stack.FilterIngress(f, pkt, stack.FilterFromTransport)
+		if !ok {
+			e.stack.Stats().DroppedPackets.Increment()
+			return
+		}
+		filterLen = n
+	}
+
 	e.rcvMu.Lock()
 
 	// Drop the packet if our buffer is currently full.
@@ -768,6 +798,9 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt stack.PacketBu
 	// headers from the front of the packet.
 	pktBuf := pkt.ToBuffer()
 	pktBuf.TrimFront(int64(pkt.HeaderSize() - len(pkt.TransportHeader().Slice())))
+	if filterLen >= 0 && int64(filterLen) < pktBuf.Size() {
+		pktBuf.Truncate(int64(filterLen))
+	}
 	packet.data = stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: pktBuf})
 
 	e.rcvList.PushBack(packet)
@@ -27,6 +27,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/testutil"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
@@ -41,6 +42,8 @@ var (
 	localV4Addr1 = testutil.MustParse4("10.0.0.1")
 	localV4Addr2 = testutil.MustParse4("10.0.0.2")
 	remoteV4Addr = testutil.MustParse4("10.0.0.3")
+
+	remoteV4MappedAddr = testutil.MustParse6("::ffff:10.0.0.3")
 )
 
 const (
@@ -251,6 +254,44 @@ func TestWriteUnboundWithBindToDevice(t *testing.T) {
 	}
 }
 
+func isInvalidOptionValue(err tcpip.Error) bool {
+	_, ok := err.(*tcpip.ErrInvalidOptionValue)
+	return ok
+}
+
+// TestV4MappedOnV6Endpoint checks that ICMPv6 endpoints reject IPv4-mapped
+// addresses.
+func TestV4MappedOnV6Endpoint(t *testing.T) {
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{icmp.NewProtocol4, icmp.NewProtocol6},
+	})
+	defer s.Destroy()
+	addNICWithDefaultRoute(t, s, 1, "nic1", localV4Addr1)
+
+	socket, err := s.NewEndpoint(icmp.ProtocolNumber6, ipv6.ProtocolNumber, &waiter.Queue{})
+	if err != nil {
+		t.Fatalf("s.NewEndpoint(%d, %d, _) = %s", icmp.ProtocolNumber6, ipv6.ProtocolNumber, err)
+	}
+	defer socket.Close()
+
+	addr := tcpip.FullAddress{Addr: remoteV4MappedAddr}
+	if err := socket.Bind(addr); !isInvalidOptionValue(err) {
+		t.Errorf("socket.Bind(%#v) = %s, want = %s", addr, err, &tcpip.ErrInvalidOptionValue{})
+	}
+	if err := socket.Connect(addr); !isInvalidOptionValue(err) {
+		t.Errorf("socket.Connect(%#v) = %s, want = %s", addr, err, &tcpip.ErrInvalidOptionValue{})
+	}
+
+	buf := make([]byte, header.ICMPv6EchoMinimumSize)
+	header.ICMPv6(buf).SetType(header.ICMPv6EchoRequest)
+	var r bytes.Reader
+	r.Reset(buf)
+	if _, err := socket.Write(&r, tcpip.WriteOptions{To: &addr}); !isInvalidOptionValue(err) {
+		t.Errorf("socket.Write(_, {To:%s}) = %s, want = %s", addr.Addr, err, &tcpip.ErrInvalidOptionValue{})
+	}
+}
+
 func buildV4EchoReplyPacket(payload []byte, h context.Header4Tuple) ([]byte, []byte) {
 	// Allocate a buffer for data and headers.
 	buf := make([]byte, header.IPv4MinimumSize+header.ICMPv4MinimumSize+len(payload))
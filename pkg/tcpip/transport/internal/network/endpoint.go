@@ -229,6 +229,7 @@ type WriteContext struct {
 	route *stack.Route
 	ttl   uint8
 	tos   uint8
+	srh   header.IPv6SegmentRoutingExtHdr
 }
 
 func (c *WriteContext) MTU() uint32 {
@@ -321,6 +322,8 @@ func (c *WriteContext) WritePacket(pkt stack.PacketBufferPtr, headerIncluded boo
 		Protocol: c.e.transProto,
 		TTL:      c.ttl,
 		TOS:      c.tos,
+
+		SegmentRoutingHeader: c.srh,
 	}, pkt)
 
 	if _, ok := err.(*tcpip.ErrNoBufferSpace); ok {
@@ -507,6 +510,7 @@ func (e *Endpoint) AcquireContextForWrite(opts tcpip.WriteOptions) (WriteContext
 
 	var tos uint8
 	var ttl uint8
+	var srh header.IPv6SegmentRoutingExtHdr
 	switch netProto := route.NetProto(); netProto {
 	case header.IPv4ProtocolNumber:
 		tos = e.ipv4TOS
@@ -517,6 +521,7 @@ func (e *Endpoint) AcquireContextForWrite(opts tcpip.WriteOptions) (WriteContext
 		}
 	case header.IPv6ProtocolNumber:
 		tos = e.ipv6TClass
+		srh = e.ops.GetIPv6RoutingHeader()
 		if opts.ControlMessages.HasHopLimit {
 			ttl = opts.ControlMessages.HopLimit
 		} else {
@@ -531,6 +536,7 @@ func (e *Endpoint) AcquireContextForWrite(opts tcpip.WriteOptions) (WriteContext
 		route: route,
 		ttl:   ttl,
 		tos:   tos,
+		srh:   srh,
 	}, nil
 }
 
@@ -720,6 +726,12 @@ func (e *Endpoint) BindAndThen(addr tcpip.FullAddress, f func(tcpip.NetworkProto
 		return &tcpip.ErrInvalidEndpointState{}
 	}
 
+	// As in Linux, IPv6 only endpoints may not be bound to IPv4-mapped
+	// addresses.
+	if e.ops.GetV6Only() && header.IsV4MappedAddress(addr.Addr) {
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+
 	addr, netProto, err := e.checkV4Mapped(addr)
 	if err != nil {
 		return err
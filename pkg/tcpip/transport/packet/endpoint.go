@@ -418,6 +418,22 @@ func (ep *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 
 // HandlePacket implements stack.PacketEndpoint.HandlePacket.
 func (ep *endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) {
+	// The filter sees the packet starting where the data delivered to the
+	// socket starts.
+	filterLen := -1
+	if f := ep.ops.GetPacketFilter(); f != nil && f.FiltersIngress() {
+		view := stack.FilterFromLink
+		if ep.cooked {
+			view = stack.FilterFromNetwork
+		}
+		n, ok := stack.FilterIngress(f, pkt, view)
+		if !ok {
+			ep.stack.Stats().DroppedPackets.Increment()
+			return
+		}
+		filterLen = n
+	}
+
 	ep.rcvMu.Lock()
 
 	// Drop the packet if our buffer is currently full.
@@ -461,6 +477,15 @@ func (ep *endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtoc
 		// packets.
 		pktBuf.TrimFront(int64(len(pkt.LinkHeader().Slice()) + len(pkt.VirtioNetHeader().Slice())))
 	}
+	if filterLen >= 0 {
+		if !ep.cooked {
+			// The filter doesn't see the virtio-net header.
+			filterLen += len(pkt.VirtioNetHeader().Slice())
+		}
+		if int64(filterLen) < pktBuf.Size() {
+			pktBuf.Truncate(int64(filterLen))
+		}
+	}
 	rcvdPkt.data = stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: pktBuf})
 
 	ep.rcvList.PushBack(&rcvdPkt)
@@ -315,6 +315,12 @@ func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 		if netProto == header.IPv6ProtocolNumber && opts.To.Addr.BitLen() != header.IPv6AddressSizeBits {
 			return 0, &tcpip.ErrInvalidOptionValue{}
 		}
+
+		// IPv6 raw sockets can't reach IPv4 peers through IPv4-mapped
+		// addresses.
+		if netProto == header.IPv6ProtocolNumber && header.IsV4MappedAddress(opts.To.Addr) {
+			return 0, &tcpip.ErrNetworkUnreachable{}
+		}
 	}
 
 	n, err := e.write(p, opts)
@@ -402,6 +408,9 @@ func (e *endpoint) Connect(addr tcpip.FullAddress) tcpip.Error {
 	if netProto == header.IPv6ProtocolNumber && addr.Addr.BitLen() != header.IPv6AddressSizeBits {
 		return &tcpip.ErrAddressFamilyNotSupported{}
 	}
+	if netProto == header.IPv6ProtocolNumber && header.IsV4MappedAddress(addr.Addr) {
+		return &tcpip.ErrNetworkUnreachable{}
+	}
 
 	return e.net.ConnectAndThen(addr, func(_ tcpip.NetworkProtocolNumber, _, _ stack.TransportEndpointID) tcpip.Error {
 		if e.associated {
@@ -436,6 +445,11 @@ func (*endpoint) Accept(*tcpip.FullAddress) (tcpip.Endpoint, *waiter.Queue, tcpi
 
 // Bind implements tcpip.Endpoint.Bind.
 func (e *endpoint) Bind(addr tcpip.FullAddress) tcpip.Error {
+	// As in Linux, IPv6 raw sockets are IPv6 only.
+	if e.net.NetProto() == header.IPv6ProtocolNumber && header.IsV4MappedAddress(addr.Addr) {
+		return &tcpip.ErrBadLocalAddress{}
+	}
+
 	return e.net.BindAndThen(addr, func(netProto tcpip.NetworkProtocolNumber, _ tcpip.Address) tcpip.Error {
 		if !e.associated {
 			return nil
@@ -587,6 +601,17 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 
 // HandlePacket implements stack.RawTransportEndpoint.HandlePacket.
 func (e *endpoint) HandlePacket(pkt stack.PacketBufferPtr) {
+	// The filter sees the packet starting at the network header.
+	filterLen := -1
+	if f := e.ops.GetPacketFilter(); f != nil && f.FiltersIngress() {
+		n, ok := stack.FilterIngress(f, pkt, stack.FilterFromNetwork)
+		if !ok {
+			e.stack.Stats().DroppedPackets.Increment()
+			return
+		}
+		filterLen = n
+	}
+
 	notifyReadableEvents := func() bool {
 		e.mu.RLock()
 		defer e.mu.RUnlock()
@@ -724,6 +749,17 @@ func (e *endpoint) HandlePacket(pkt stack.PacketBufferPtr) {
 			panic(fmt.Sprintf("unrecognized protocol number = %d", info.NetProto))
 		}
 
+		if filterLen >= 0 {
+			// IPv6 endpoints don't return the IP header, which the filter
+			// saw.
+			if info.NetProto == header.IPv6ProtocolNumber {
+				filterLen = max(filterLen-len(pkt.NetworkHeader().Slice()), 0)
+			}
+			if int64(filterLen) < combinedBuf.Size() {
+				combinedBuf.Truncate(int64(filterLen))
+			}
+		}
+
 		packet.data = stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: combinedBuf.Clone()})
 		packet.receivedAt = e.stack.Clock().Now()
 
@@ -363,6 +363,10 @@ func (e *endpoint) propagateInheritableOptionsLocked(n *endpoint) {
 	n.boundBindToDevice = e.boundBindToDevice
 	n.boundPortFlags = e.boundPortFlags
 	n.userMSS = e.userMSS
+	// As in Linux, accepted sockets inherit the packet filters of the
+	// listening socket.
+	n.owner = e.owner
+	n.ops.SetPacketFilter(e.ops.GetPacketFilter())
 }
 
 // reserveTupleLocked reserves an accepted endpoint's tuple.
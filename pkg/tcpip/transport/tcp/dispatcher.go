@@ -434,6 +434,15 @@ func (d *dispatcher) queuePacket(stackEP stack.TransportEndpoint, id stack.Trans
 		return
 	}
 
+	// As in Linux's tcp_filter(), segments dropped by the filter are handled
+	// like lost segments. Unlike Linux, segments are never truncated.
+	if f := ep.ops.GetPacketFilter(); f != nil && f.FiltersIngress() {
+		if _, ok := stack.FilterIngress(f, pkt, stack.FilterFromTransport); !ok {
+			ep.stack.Stats().DroppedPackets.Increment()
+			return
+		}
+	}
+
 	ep.stack.Stats().TCP.ValidSegmentsReceived.Increment()
 	ep.stats.SegmentsReceived.Increment()
 	if (s.flags & header.TCPFlagRst) != 0 {
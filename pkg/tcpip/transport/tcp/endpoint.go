@@ -419,6 +419,18 @@ type endpoint struct {
 	// state.
 	origEndpointState uint32 `state:"nosave"`
 
+	// savedTSVal is the value of the timestamp option when the endpoint was
+	// saved. The stack's monotonic clock may restart after restore, so
+	// TSOffset is adjusted for timestamps to continue from this value rather
+	// than go backwards, which the peer would reject (RFC 7323, section 5).
+	savedTSVal uint32
+
+	// listenSeq is the order in which the endpoint was registered as a
+	// listener, relative to other listeners. It is used on restore to
+	// re-register listeners in their original order, so that SO_REUSEPORT
+	// groups distribute connections as before.
+	listenSeq uint64
+
 	isPortReserved    bool `state:"manual"`
 	isRegistered      bool `state:"manual"`
 	boundNICID        tcpip.NICID
@@ -2669,6 +2681,7 @@ func (e *endpoint) listen(backlog int) tcpip.Error {
 	}
 
 	e.isRegistered = true
+	e.listenSeq = lastListenSeq.Add(1)
 
 	// The queue may be non-zero when we're restoring the endpoint, and it
 	// may be pre-populated with some previously accepted (but not Accepted)
@@ -2738,6 +2751,12 @@ func (e *endpoint) bindLocked(addr tcpip.FullAddress) (err tcpip.Error) {
 		return &tcpip.ErrAlreadyBound{}
 	}
 
+	// As in Linux, IPv6 only endpoints may not be bound to IPv4-mapped
+	// addresses.
+	if e.ops.GetV6Only() && header.IsV4MappedAddress(addr.Addr) {
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+
 	e.BindAddr = addr.Addr
 	addr, netProto, err := e.checkV4MappedLocked(addr)
 	if err != nil {
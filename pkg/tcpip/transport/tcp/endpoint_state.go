@@ -16,13 +16,17 @@ package tcp
 
 import (
 	"fmt"
+	"sort"
 
 	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/internal/tcp"
 	"gvisor.dev/gvisor/pkg/tcpip/ports"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // beforeSave is invoked by stateify.
@@ -47,6 +51,8 @@ func (e *endpoint) beforeSave() {
 			e.mu.Unlock()
 			e.Close()
 			e.mu.Lock()
+		} else if epState.connected() {
+			e.savedTSVal = e.tsValNow()
 		}
 		fallthrough
 	case epState == StateListen:
@@ -88,6 +94,24 @@ var connectingLoading sync.WaitGroup
 
 // Bound endpoint loading happens last.
 
+// lastListenSeq is the endpoint.listenSeq of the last registered listener.
+var lastListenSeq atomicbitops.Uint64
+
+// Listening endpoints are re-registered together once all of them have been
+// resumed, in their original order, so that SO_REUSEPORT groups are
+// reconstructed with the same membership order.
+var (
+	restoredListenersMu sync.Mutex
+
+	// restoredListeners are the listening endpoints resumed so far. It is
+	// protected by restoredListenersMu.
+	restoredListeners []*endpoint
+
+	// pendingListeners is the number of loaded listening endpoints that have
+	// not been resumed yet. It is protected by restoredListenersMu.
+	pendingListeners int
+)
+
 // loadState is invoked by stateify.
 func (e *endpoint) loadState(epState EndpointState) {
 	// This is to ensure that the loading wait groups include all applicable
@@ -99,6 +123,9 @@ func (e *endpoint) loadState(epState EndpointState) {
 	switch {
 	case epState == StateListen:
 		listenLoading.Add(1)
+		restoredListenersMu.Lock()
+		pendingListeners++
+		restoredListenersMu.Unlock()
 	case epState.connecting():
 		connectingLoading.Add(1)
 	}
@@ -133,30 +160,7 @@ func (e *endpoint) Resume(s *stack.Stack) {
 	e.ops.InitHandler(e, e.stack, GetTCPSendBufferLimits, GetTCPReceiveBufferLimits)
 	e.segmentQueue.thaw()
 
-	bind := func() {
-		e.mu.Lock()
-		defer e.mu.Unlock()
-		addr, _, err := e.checkV4MappedLocked(tcpip.FullAddress{Addr: e.BindAddr, Port: e.TransportEndpointInfo.ID.LocalPort})
-		if err != nil {
-			panic("unable to parse BindAddr: " + err.String())
-		}
-		portRes := ports.Reservation{
-			Networks:     e.effectiveNetProtos,
-			Transport:    ProtocolNumber,
-			Addr:         addr.Addr,
-			Port:         addr.Port,
-			Flags:        e.boundPortFlags,
-			BindToDevice: e.boundBindToDevice,
-			Dest:         e.boundDest,
-		}
-		if ok := e.stack.ReserveTuple(portRes); !ok {
-			panic(fmt.Sprintf("unable to re-reserve tuple (%v, %q, %d, %+v, %d, %v)", e.effectiveNetProtos, addr.Addr, addr.Port, e.boundPortFlags, e.boundBindToDevice, e.boundDest))
-		}
-		e.isPortReserved = true
-
-		// Mark endpoint as bound.
-		e.setEndpointState(StateBound)
-	}
+	bind := e.restoreBind
 
 	epState := EndpointState(e.origEndpointState)
 	switch {
@@ -184,6 +188,9 @@ func (e *endpoint) Resume(s *stack.Stack) {
 			panic("endpoint connecting failed: " + err.String())
 		}
 		e.state.Store(e.origEndpointState)
+		// Continue timestamps from their value at save time. See savedTSVal.
+		nowMS := uint32(e.stack.Clock().NowMonotonic().Sub(tcpip.MonotonicTime{}).Milliseconds())
+		e.TSOffset = tcp.NewTSOffset(e.savedTSVal - nowMS)
 		// For FIN-WAIT-2 and TIME-WAIT we need to start the appropriate timers so
 		// that the socket is closed correctly.
 		switch epState {
@@ -192,28 +199,26 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		case StateTimeWait:
 			e.timeWaitTimer = e.stack.Clock().AfterFunc(e.getTimeWaitDuration(), e.timeWaitTimerExpired)
 		}
+		if epState != StateTimeWait {
+			e.resumeConnectedLocked()
+		}
 
 		e.mu.Unlock()
 		connectedLoading.Done()
 	case epState == StateListen:
 		tcpip.AsyncLoading.Add(1)
-		go func() {
-			connectedLoading.Wait()
-			bind()
-			e.acceptMu.Lock()
-			backlog := e.acceptQueue.capacity
-			e.acceptMu.Unlock()
-			if err := e.Listen(backlog); err != nil {
-				panic("endpoint listening failed: " + err.String())
-			}
-			e.LockUser()
-			if e.shutdownFlags != 0 {
-				e.shutdownLocked(e.shutdownFlags)
-			}
-			e.UnlockUser()
-			listenLoading.Done()
-			tcpip.AsyncLoading.Done()
-		}()
+		restoredListenersMu.Lock()
+		restoredListeners = append(restoredListeners, e)
+		pendingListeners--
+		var eps []*endpoint
+		if pendingListeners == 0 {
+			eps = restoredListeners
+			restoredListeners = nil
+		}
+		restoredListenersMu.Unlock()
+		if eps != nil {
+			go restoreListeners(eps)
+		}
 	case epState == StateConnecting:
 		// Initial SYN hasn't been sent yet so initiate a connect.
 		tcpip.AsyncLoading.Add(1)
@@ -269,3 +274,92 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		tcpip.DeleteDanglingEndpoint(e)
 	}
 }
+
+// resumeConnectedLocked restarts the timers of a restored connected endpoint,
+// and sends an ACK to resynchronize with the peer. Segments exchanged while
+// the sandbox was saved are lost, and neither side may otherwise retransmit.
+// The ACK also triggers link address resolution of the next hop, which may
+// have changed if the sandbox was restored on a different host.
+//
+// +checklocks:e.mu
+func (e *endpoint) resumeConnectedLocked() {
+	if e.snd.SndUna != e.snd.SndNxt {
+		e.snd.resendTimer.enable(e.snd.RTO)
+	}
+	e.resetKeepaliveTimer(false /* receivedData */)
+	e.snd.sendAck()
+}
+
+// restoreBind re-reserves the port that the endpoint was bound to before save,
+// and returns the address and network protocol it is bound to.
+func (e *endpoint) restoreBind() (tcpip.FullAddress, tcpip.NetworkProtocolNumber) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	addr, netProto, err := e.checkV4MappedLocked(tcpip.FullAddress{Addr: e.BindAddr, Port: e.TransportEndpointInfo.ID.LocalPort})
+	if err != nil {
+		panic("unable to parse BindAddr: " + err.String())
+	}
+	portRes := ports.Reservation{
+		Networks:     e.effectiveNetProtos,
+		Transport:    ProtocolNumber,
+		Addr:         addr.Addr,
+		Port:         addr.Port,
+		Flags:        e.boundPortFlags,
+		BindToDevice: e.boundBindToDevice,
+		Dest:         e.boundDest,
+	}
+	if ok := e.stack.ReserveTuple(portRes); !ok {
+		panic(fmt.Sprintf("unable to re-reserve tuple (%v, %q, %d, %+v, %d, %v)", e.effectiveNetProtos, addr.Addr, addr.Port, e.boundPortFlags, e.boundBindToDevice, e.boundDest))
+	}
+	e.isPortReserved = true
+
+	// Mark endpoint as bound.
+	e.setEndpointState(StateBound)
+	return addr, netProto
+}
+
+// restoreListeners re-registers the restored listening endpoints eps in the
+// order in which they were originally registered.
+func restoreListeners(eps []*endpoint) {
+	connectedLoading.Wait()
+	sort.Slice(eps, func(i, j int) bool {
+		return eps[i].listenSeq < eps[j].listenSeq
+	})
+	for _, e := range eps {
+		e.restoreListen()
+		listenLoading.Done()
+		tcpip.AsyncLoading.Done()
+	}
+}
+
+// restoreListen moves the restored endpoint back to the listen state, with its
+// accept queue intact.
+func (e *endpoint) restoreListen() {
+	addr, netProto := e.restoreBind()
+	if addr.Addr.BitLen() != 0 && !addr.Addr.Unspecified() && e.stack.CheckLocalAddress(e.boundNICID, netProto, addr.Addr) == 0 {
+		// The network configuration may differ after restore. The listener
+		// is registered anyway, so that it accepts connections once the
+		// address is assigned again.
+		log.Warningf("restored TCP listener on %s:%d, which is not a local address", addr.Addr, addr.Port)
+	}
+	e.acceptMu.Lock()
+	backlog := e.acceptQueue.capacity
+	e.acceptMu.Unlock()
+	if err := e.Listen(backlog); err != nil {
+		panic("endpoint listening failed: " + err.String())
+	}
+	e.LockUser()
+	if e.shutdownFlags != 0 {
+		e.shutdownLocked(e.shutdownFlags)
+	}
+	e.UnlockUser()
+
+	// Wake up waiters for connections that were accepted by netstack, but
+	// not yet by the application, before save.
+	e.acceptMu.Lock()
+	queued := e.acceptQueue.endpoints.Len()
+	e.acceptMu.Unlock()
+	if queued != 0 {
+		e.waiterQueue.Notify(waiter.ReadableEvents)
+	}
+}
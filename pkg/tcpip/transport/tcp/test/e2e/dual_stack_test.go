@@ -41,11 +41,23 @@ func TestV4MappedConnectOnV6Only(t *testing.T) {
 
 	// Start connection attempt, it must fail.
 	err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestV4MappedAddr, Port: context.TestPort})
-	if d := cmp.Diff(&tcpip.ErrHostUnreachable{}, err); d != "" {
+	if d := cmp.Diff(&tcpip.ErrNetworkUnreachable{}, err); d != "" {
 		t.Fatalf("c.EP.Connect(...) mismatch (-want +got):\n%s", d)
 	}
 }
 
+func TestV4MappedBindOnV6Only(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.CreateV6Endpoint(true)
+
+	err := c.EP.Bind(tcpip.FullAddress{Addr: context.StackV4MappedAddr})
+	if d := cmp.Diff(&tcpip.ErrInvalidEndpointState{}, err); d != "" {
+		t.Fatalf("c.EP.Bind(...) mismatch (-want +got):\n%s", d)
+	}
+}
+
 func TestV4MappedConnect(t *testing.T) {
 	c := context.New(t, e2e.DefaultMTU)
 	defer c.Cleanup()
@@ -936,6 +936,21 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt stack.PacketBu
 	e.stack.Stats().UDP.PacketsReceived.Increment()
 	e.stats.PacketsReceived.Increment()
 
+	if f := e.ops.GetPacketFilter(); f != nil && f.FiltersIngress() {
+		n, ok := stack.FilterIngress(f, pkt, stack.FilterFromTransport)
+		if !ok {
+			e.stack.Stats().DroppedPackets.Increment()
+			return
+		}
+		// As in Linux's udp_queue_rcv_one_skb(), the filter can truncate the
+		// payload but not the UDP header.
+		if n -= header.UDPMinimumSize; n < pkt.Data().Size() {
+			pkt = pkt.Clone()
+			defer pkt.DecRef()
+			pkt.Data().CapLength(max(n, 0))
+		}
+	}
+
 	e.rcvMu.Lock()
 	// Drop the packet if our buffer is not ready to receive packets.
 	if !e.rcvReady || e.rcvClosed {
@@ -763,7 +763,7 @@ func TestV4WriteOnV6Only(t *testing.T) {
 			c.CreateEndpointForFlow(context.UnicastV6Only, udp.ProtocolNumber)
 
 			// Write to V4 mapped address.
-			testWriteOpSequenceFails(c, context.UnicastV4in6, writeOpSequence, &tcpip.ErrHostUnreachable{})
+			testWriteOpSequenceFails(c, context.UnicastV4in6, writeOpSequence, &tcpip.ErrNetworkUnreachable{})
 		})
 	}
 }
@@ -2282,6 +2282,110 @@ func TestWritePayloadSizeTooBig(t *testing.T) {
 	}
 }
 
+// testPacketFilter is a tcpip.PacketFilter that drops or truncates packets.
+type testPacketFilter struct {
+	// dropIngress and dropEgress make the filter drop all packets.
+	dropIngress bool
+	dropEgress  bool
+
+	// ingressLen is the number of bytes of received packets to deliver.
+	ingressLen int
+}
+
+// KUID implements tcpip.PacketOwner.KUID.
+func (*testPacketFilter) KUID() uint32 { return 0 }
+
+// KGID implements tcpip.PacketOwner.KGID.
+func (*testPacketFilter) KGID() uint32 { return 0 }
+
+// FiltersIngress implements tcpip.PacketFilter.FiltersIngress.
+func (*testPacketFilter) FiltersIngress() bool { return true }
+
+// FilterIngress implements tcpip.PacketFilter.FilterIngress.
+func (f *testPacketFilter) FilterIngress(pkt *tcpip.FilteredPacket) (int, bool) {
+	if got := header.IPv4(pkt.Bytes[pkt.NetworkOffset:]).Protocol(); got != uint8(udp.ProtocolNumber) {
+		panic(fmt.Sprintf("got packet of protocol %d, want UDP", got))
+	}
+	return f.ingressLen, !f.dropIngress
+}
+
+// FiltersEgress implements tcpip.PacketFilter.FiltersEgress.
+func (*testPacketFilter) FiltersEgress() bool { return true }
+
+// FilterEgress implements tcpip.PacketFilter.FilterEgress.
+func (f *testPacketFilter) FilterEgress(*tcpip.FilteredPacket) bool {
+	return !f.dropEgress
+}
+
+func TestPacketFilter(t *testing.T) {
+	const truncatedLen = 4
+	for _, test := range []struct {
+		name   string
+		filter testPacketFilter
+		// wantPayloadLen is the length of the payload read from the
+		// endpoint, or -1 if no packet is received.
+		wantPayloadLen int
+		wantWriteErr   tcpip.Error
+	}{
+		{
+			name:           "accept",
+			filter:         testPacketFilter{ingressLen: math.MaxInt32},
+			wantPayloadLen: arbitraryPayloadSize,
+		},
+		{
+			name:           "truncate",
+			filter:         testPacketFilter{ingressLen: header.UDPMinimumSize + truncatedLen},
+			wantPayloadLen: truncatedLen,
+		},
+		{
+			name:           "truncate header",
+			filter:         testPacketFilter{ingressLen: 1},
+			wantPayloadLen: 0,
+		},
+		{
+			name:           "drop ingress",
+			filter:         testPacketFilter{dropIngress: true},
+			wantPayloadLen: -1,
+		},
+		{
+			name:           "drop egress",
+			filter:         testPacketFilter{ingressLen: math.MaxInt32, dropEgress: true},
+			wantPayloadLen: arbitraryPayloadSize,
+			wantWriteErr:   &tcpip.ErrNotPermitted{},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+			defer c.Cleanup()
+
+			c.CreateEndpointForFlow(context.UnicastV4, udp.ProtocolNumber)
+			if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+				c.T.Fatalf("Bind failed: %s", err)
+			}
+			f := test.filter
+			c.EP.SocketOptions().SetPacketFilter(&f)
+			c.EP.SetOwner(&f)
+
+			payload := newRandomPayload(arbitraryPayloadSize)
+			c.InjectPacket(header.IPv4ProtocolNumber, context.BuildUDPPacket(payload, context.UnicastV4, context.Incoming, testTOS, testTTL, false))
+			if test.wantPayloadLen < 0 {
+				c.ReadFromEndpointExpectNoPacket()
+				if got := c.Stack.Stats().DroppedPackets.Value(); got != 1 {
+					t.Errorf("got DroppedPackets = %d, want 1", got)
+				}
+			} else {
+				c.ReadFromEndpointExpectSuccess(payload[:test.wantPayloadLen], context.UnicastV4)
+			}
+
+			if test.wantWriteErr != nil {
+				testWriteFails(c, context.UnicastV4, arbitraryPayloadSize, test.wantWriteErr)
+			} else {
+				testWriteSucceedsAndGetReceivedSrcPort(c, context.UnicastV4)
+			}
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	refs.SetLeakMode(refs.LeaksPanic)
 	code := m.Run()
@@ -0,0 +1,83 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vhostuser
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+// fsBackendMsgEntries is the number of ranges in a VhostUserFSBackendMsg.
+const fsBackendMsgEntries = 8
+
+// fsBackendMsgSize is the size of a VhostUserFSBackendMsg.
+const fsBackendMsgSize = 4 * 8 * fsBackendMsgEntries
+
+// Flags of FSMapping.
+const (
+	// FSMapFlagRead allows reading the mapping.
+	FSMapFlagRead = 1 << 0
+
+	// FSMapFlagWrite allows writing to the mapping.
+	FSMapFlagWrite = 1 << 1
+)
+
+// FSMapping is a range of the DAX window of a virtio-fs device in a
+// BackendFSMap or BackendFSUnmap request.
+type FSMapping struct {
+	// FDOffset is the offset in the file that is mapped.
+	FDOffset uint64
+
+	// CacheOffset is the offset in the DAX window.
+	CacheOffset uint64
+
+	// Len is the length of the range in bytes.
+	Len uint64
+
+	// Flags are FSMapFlag* flags.
+	Flags uint64
+}
+
+// ParseFSBackendMsg parses the payload of a BackendFSMap or BackendFSUnmap
+// request, a VhostUserFSBackendMsg, and returns its non-empty ranges.
+func ParseFSBackendMsg(payload []byte) ([]FSMapping, error) {
+	// struct VhostUserFSBackendMsg {
+	//	uint64 fd_offset[8];
+	//	uint64 c_offset[8];
+	//	uint64 len[8];
+	//	uint64 flags[8];
+	// };
+	if len(payload) != fsBackendMsgSize {
+		return nil, fmt.Errorf("virtio-fs back-end message has %d bytes, want %d", len(payload), fsBackendMsgSize)
+	}
+	field := func(f, i int) uint64 {
+		return hostarch.ByteOrder.Uint64(payload[8*(f*fsBackendMsgEntries+i):])
+	}
+	var ms []FSMapping
+	for i := 0; i < fsBackendMsgEntries; i++ {
+		m := FSMapping{
+			FDOffset:    field(0, i),
+			CacheOffset: field(1, i),
+			Len:         field(2, i),
+			Flags:       field(3, i),
+		}
+		if m.Len == 0 {
+			continue
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
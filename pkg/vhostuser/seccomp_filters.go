@@ -0,0 +1,37 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vhostuser
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// Filters returns seccomp-bpf filters for setting up vhost-user devices. The
+// sockets and eventfds of set up devices only need syscalls that are always
+// allowed.
+func Filters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_MEMFD_CREATE: seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(unix.MFD_CLOEXEC),
+		},
+		unix.SYS_SOCKETPAIR: seccomp.PerArg{
+			seccomp.EqualTo(unix.AF_UNIX),
+			seccomp.EqualTo(unix.SOCK_STREAM | unix.SOCK_CLOEXEC),
+			seccomp.EqualTo(0),
+		},
+	}
+}
@@ -0,0 +1,620 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vhostuser implements the front-end of the vhost-user protocol.
+//
+// vhost-user offloads the data plane of a virtio device to a back-end process,
+// such as virtiofsd, which accesses the device's virtqueues directly in memory
+// shared with the front-end. The front-end only uses the vhost-user socket to
+// set up the device, and exchanges buffers with the back-end through the
+// virtqueues, which are signaled with eventfds.
+//
+// The front-end implemented here shares a single memory region with the
+// back-end, which contains the split virtqueues and the buffers that the
+// caller places in them. It doesn't support dirty page logging, inflight
+// tracking, indirect descriptors or event index notification suppression.
+//
+// See https://qemu-project.gitlab.io/qemu/interop/vhost-user.html for the
+// protocol specification.
+package vhostuser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/memutil"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/unet"
+)
+
+// Front-end message types.
+const (
+	reqGetFeatures         = 1
+	reqSetFeatures         = 2
+	reqSetOwner            = 3
+	reqSetMemTable         = 5
+	reqSetVringNum         = 8
+	reqSetVringAddr        = 9
+	reqSetVringBase        = 10
+	reqSetVringKick        = 12
+	reqSetVringCall        = 13
+	reqGetProtocolFeatures = 15
+	reqSetProtocolFeatures = 16
+	reqSetVringEnable      = 18
+	reqSetBackendReqFD     = 21
+)
+
+// Back-end message types, sent by the back-end on the channel set up with
+// VHOST_USER_SET_BACKEND_REQ_FD.
+const (
+	// BackendFSMap asks the front-end to map ranges of a file into the DAX
+	// window of a virtio-fs device. The payload is an FSBackendMsg, and the
+	// file is passed as the only FD.
+	BackendFSMap = 6
+
+	// BackendFSUnmap asks the front-end to unmap ranges of the DAX window of
+	// a virtio-fs device. The payload is an FSBackendMsg.
+	BackendFSUnmap = 7
+)
+
+// Message header flags.
+const (
+	flagVersion   = 0x1
+	flagReply     = 0x4
+	flagNeedReply = 0x8
+)
+
+// headerSize is the size of the header of each message.
+const headerSize = 12
+
+// maxPayloadSize is the size of the largest message payload accepted from the
+// back-end.
+const maxPayloadSize = 4096
+
+// maxFDs is the maximum number of FDs accepted with a message.
+const maxFDs = 8
+
+// Feature bits.
+const (
+	// FeatureVersion1 is VIRTIO_F_VERSION_1.
+	FeatureVersion1 = 1 << 32
+
+	// featureProtocolFeatures is VHOST_USER_F_PROTOCOL_FEATURES.
+	featureProtocolFeatures = 1 << 30
+)
+
+// Protocol feature bits.
+const (
+	// ProtocolFeatureReplyAck is VHOST_USER_PROTOCOL_F_REPLY_ACK.
+	ProtocolFeatureReplyAck = 1 << 3
+
+	// ProtocolFeatureBackendReq is VHOST_USER_PROTOCOL_F_BACKEND_REQ.
+	ProtocolFeatureBackendReq = 1 << 5
+
+	// ProtocolFeatureBackendSendFD is VHOST_USER_PROTOCOL_F_BACKEND_SEND_FD.
+	ProtocolFeatureBackendSendFD = 1 << 10
+)
+
+// header is the header of a vhost-user message.
+type header struct {
+	request uint32
+	flags   uint32
+	size    uint32
+}
+
+func (h *header) marshal(b []byte) {
+	hostarch.ByteOrder.PutUint32(b[0:], h.request)
+	hostarch.ByteOrder.PutUint32(b[4:], h.flags)
+	hostarch.ByteOrder.PutUint32(b[8:], h.size)
+}
+
+func (h *header) unmarshal(b []byte) {
+	h.request = hostarch.ByteOrder.Uint32(b[0:])
+	h.flags = hostarch.ByteOrder.Uint32(b[4:])
+	h.size = hostarch.ByteOrder.Uint32(b[8:])
+}
+
+// sendMessage sends a message, and the given FDs, on sock.
+func sendMessage(sock *unet.Socket, hdr header, payload []byte, fds []int) error {
+	var hdrBuf [headerSize]byte
+	hdr.size = uint32(len(payload))
+	hdr.marshal(hdrBuf[:])
+	bufs := [][]byte{hdrBuf[:], payload}
+	w := sock.Writer(true /* blocking */)
+	if len(fds) != 0 {
+		w.PackFDs(fds...)
+	}
+	for len(bufs[0]) != 0 || len(bufs[1]) != 0 {
+		n, err := w.WriteVec(bufs)
+		if err != nil {
+			return err
+		}
+		// FDs are only sent with the first part of the message.
+		w.UnpackFDs()
+		for i := range bufs {
+			m := n
+			if m > len(bufs[i]) {
+				m = len(bufs[i])
+			}
+			bufs[i] = bufs[i][m:]
+			n -= m
+		}
+	}
+	return nil
+}
+
+// recvMessage receives a message from sock. It returns the header, the
+// payload, and the FDs that were passed with the message, which the caller
+// owns.
+func recvMessage(sock *unet.Socket) (header, []byte, []int, error) {
+	var (
+		hdr    header
+		hdrBuf [headerSize]byte
+	)
+	r := sock.Reader(true /* blocking */)
+	r.EnableFDs(maxFDs)
+	if err := readFull(&r, hdrBuf[:]); err != nil {
+		r.CloseFDs()
+		return hdr, nil, nil, err
+	}
+	fds, err := r.ExtractFDs()
+	if err != nil {
+		r.CloseFDs()
+		return hdr, nil, nil, err
+	}
+	hdr.unmarshal(hdrBuf[:])
+	if hdr.flags&0x3 != flagVersion {
+		closeFDs(fds)
+		return hdr, nil, nil, fmt.Errorf("unsupported message version in flags %#x", hdr.flags)
+	}
+	if hdr.size > maxPayloadSize {
+		closeFDs(fds)
+		return hdr, nil, nil, fmt.Errorf("message payload too large: %d bytes", hdr.size)
+	}
+	payload := make([]byte, hdr.size)
+	r.UnpackFDs()
+	if err := readFull(&r, payload); err != nil {
+		closeFDs(fds)
+		return hdr, nil, nil, err
+	}
+	return hdr, payload, fds, nil
+}
+
+// readFull reads exactly len(buf) bytes into buf.
+func readFull(r *unet.SocketReader, buf []byte) error {
+	for len(buf) != 0 {
+		n, err := r.ReadVec([][]byte{buf})
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+}
+
+// Config configures a Device.
+type Config struct {
+	// NumQueues is the number of virtqueues of the device.
+	NumQueues int
+
+	// QueueSize is the number of descriptors in each virtqueue. It must be a
+	// power of 2 no larger than 32768.
+	QueueSize uint16
+
+	// BufferSize is the size of the memory available for buffers, returned
+	// by Device.Buffers.
+	BufferSize uint64
+
+	// ProtocolFeatures are the protocol features that the device requires,
+	// beyond those used by this package.
+	ProtocolFeatures uint64
+
+	// HandleBackendRequest, if not nil, is called for every request that the
+	// back-end sends on the back-end channel. It takes ownership of fds, and
+	// returns the result that is sent back to the back-end, which is zero on
+	// success. HandleBackendRequest requires ProtocolFeatureBackendReq.
+	HandleBackendRequest func(request uint32, payload []byte, fds []int) uint64
+}
+
+// Device is the front-end of a vhost-user device.
+type Device struct {
+	// sock is the vhost-user socket. sock is immutable.
+	sock *unet.Socket
+
+	// features are the negotiated virtio features. features is immutable.
+	features uint64
+
+	// protocolFeatures are the negotiated protocol features. protocolFeatures
+	// is immutable.
+	protocolFeatures uint64
+
+	// memFD is the memory file shared with the back-end. memFD is immutable.
+	memFD int
+
+	// mem is the mapping of memFD. mem is immutable.
+	mem []byte
+
+	// buffersOff is the offset in mem of the memory returned by Buffers.
+	// buffersOff is immutable.
+	buffersOff uint64
+
+	// queues are the device's virtqueues. queues is immutable.
+	queues []*Virtqueue
+
+	// backendSock is the front-end side of the back-end channel. It is nil if
+	// the back-end channel isn't used. backendSock is immutable.
+	backendSock *unet.Socket
+
+	// backendWG tracks the goroutine serving back-end requests.
+	backendWG sync.WaitGroup
+
+	// closeOnce ensures that Close only runs once.
+	closeOnce sync.Once
+}
+
+// ErrUnsupported is returned by Connect if the back-end doesn't support a
+// feature required by Config.
+var ErrUnsupported = errors.New("vhost-user back-end doesn't support a required feature")
+
+// Connect sets up the vhost-user device whose back-end is connected to fd. If
+// it succeeds, the Device takes ownership of fd.
+func Connect(fd int, cfg Config) (*Device, error) {
+	if cfg.NumQueues <= 0 || cfg.QueueSize == 0 || cfg.QueueSize > 32768 || cfg.QueueSize&(cfg.QueueSize-1) != 0 {
+		return nil, fmt.Errorf("invalid vhost-user configuration: %d queues of size %d", cfg.NumQueues, cfg.QueueSize)
+	}
+	if cfg.HandleBackendRequest != nil {
+		cfg.ProtocolFeatures |= ProtocolFeatureBackendReq
+	}
+	sock, err := unet.NewSocket(fd)
+	if err != nil {
+		return nil, err
+	}
+	d := &Device{
+		sock:  sock,
+		memFD: -1,
+	}
+	if err := d.init(&cfg); err != nil {
+		d.release()
+		// The caller still owns fd.
+		_, _ = sock.Release()
+		return nil, err
+	}
+	return d, nil
+}
+
+// init negotiates features with the back-end and sets up the device's memory
+// and virtqueues.
+func (d *Device) init(cfg *Config) error {
+	features, err := d.getU64(reqGetFeatures)
+	if err != nil {
+		return fmt.Errorf("getting features: %w", err)
+	}
+	d.features = features & (FeatureVersion1 | featureProtocolFeatures)
+	if d.features&featureProtocolFeatures != 0 {
+		protocolFeatures, err := d.getU64(reqGetProtocolFeatures)
+		if err != nil {
+			return fmt.Errorf("getting protocol features: %w", err)
+		}
+		d.protocolFeatures = protocolFeatures & (ProtocolFeatureReplyAck | cfg.ProtocolFeatures)
+		if err := d.setU64(reqSetProtocolFeatures, d.protocolFeatures); err != nil {
+			return fmt.Errorf("setting protocol features: %w", err)
+		}
+	}
+	if d.protocolFeatures&cfg.ProtocolFeatures != cfg.ProtocolFeatures {
+		return fmt.Errorf("%w: got protocol features %#x, want %#x", ErrUnsupported, d.protocolFeatures, cfg.ProtocolFeatures)
+	}
+	if err := d.request(reqSetOwner, nil, nil); err != nil {
+		return fmt.Errorf("setting owner: %w", err)
+	}
+	if cfg.HandleBackendRequest != nil {
+		if err := d.startBackendChannel(cfg.HandleBackendRequest); err != nil {
+			return fmt.Errorf("setting up back-end channel: %w", err)
+		}
+	}
+	if err := d.setU64(reqSetFeatures, d.features); err != nil {
+		return fmt.Errorf("setting features: %w", err)
+	}
+
+	// Lay out the shared memory: the virtqueues, each starting on a page
+	// boundary, followed by the buffers.
+	queueLen := uint64(vringSize(cfg.QueueSize))
+	queueLen, _ = hostarch.PageRoundUp(queueLen)
+	bufferLen, ok := hostarch.PageRoundUp(cfg.BufferSize)
+	if !ok {
+		return fmt.Errorf("buffer size %d overflows", cfg.BufferSize)
+	}
+	d.buffersOff = uint64(cfg.NumQueues) * queueLen
+	memLen := d.buffersOff + bufferLen
+	memFD, err := memutil.CreateMemFD("vhost-user", unix.MFD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("creating shared memory file: %w", err)
+	}
+	d.memFD = memFD
+	if err := unix.Ftruncate(memFD, int64(memLen)); err != nil {
+		return fmt.Errorf("sizing shared memory file: %w", err)
+	}
+	d.mem, err = memutil.MapSlice(0, uintptr(memLen), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED, uintptr(memFD), 0)
+	if err != nil {
+		return fmt.Errorf("mapping shared memory file: %w", err)
+	}
+	if err := d.setMemTable(); err != nil {
+		return fmt.Errorf("setting memory table: %w", err)
+	}
+
+	for i := 0; i < cfg.NumQueues; i++ {
+		off := uint64(i) * queueLen
+		q, err := newVirtqueue(d, i, cfg.QueueSize, d.mem[off:off+queueLen], d.base()+off)
+		if err != nil {
+			return err
+		}
+		d.queues = append(d.queues, q)
+		if err := d.setUpVirtqueue(q); err != nil {
+			return fmt.Errorf("setting up virtqueue %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// base returns the address of the shared memory. The shared memory is
+// described to the back-end as being at the same address in guest physical
+// and front-end virtual address spaces, so it is used for both.
+func (d *Device) base() uint64 {
+	return uint64(sliceAddr(d.mem))
+}
+
+// setMemTable sends VHOST_USER_SET_MEM_TABLE with the shared memory as the
+// only region.
+func (d *Device) setMemTable() error {
+	// struct VhostUserMemory {
+	//	uint32 nregions;
+	//	uint32 padding;
+	//	struct VhostUserMemoryRegion {
+	//		uint64 guest_phys_addr;
+	//		uint64 memory_size;
+	//		uint64 userspace_addr;
+	//		uint64 mmap_offset;
+	//	} regions[nregions];
+	// };
+	payload := make([]byte, 8+32)
+	hostarch.ByteOrder.PutUint32(payload[0:], 1)
+	hostarch.ByteOrder.PutUint64(payload[8:], d.base())
+	hostarch.ByteOrder.PutUint64(payload[16:], uint64(len(d.mem)))
+	hostarch.ByteOrder.PutUint64(payload[24:], d.base())
+	hostarch.ByteOrder.PutUint64(payload[32:], 0)
+	return d.request(reqSetMemTable, payload, []int{d.memFD})
+}
+
+// setUpVirtqueue describes q to the back-end and enables it.
+func (d *Device) setUpVirtqueue(q *Virtqueue) error {
+	if err := d.setVringState(reqSetVringNum, q.index, uint32(q.size)); err != nil {
+		return err
+	}
+	if err := d.setVringState(reqSetVringBase, q.index, 0); err != nil {
+		return err
+	}
+	// struct vhost_vring_addr {
+	//	uint32 index;
+	//	uint32 flags;
+	//	uint64 desc_user_addr;
+	//	uint64 used_user_addr;
+	//	uint64 avail_user_addr;
+	//	uint64 log_guest_addr;
+	// };
+	addr := make([]byte, 40)
+	hostarch.ByteOrder.PutUint32(addr[0:], uint32(q.index))
+	hostarch.ByteOrder.PutUint64(addr[8:], q.descAddr)
+	hostarch.ByteOrder.PutUint64(addr[16:], q.usedAddr)
+	hostarch.ByteOrder.PutUint64(addr[24:], q.availAddr)
+	if err := d.request(reqSetVringAddr, addr, nil); err != nil {
+		return err
+	}
+	if err := d.setVringFD(reqSetVringCall, q.index, q.call.FD()); err != nil {
+		return err
+	}
+	// The back-end starts processing the virtqueue once it gets the kick FD.
+	if err := d.setVringFD(reqSetVringKick, q.index, q.kick.FD()); err != nil {
+		return err
+	}
+	// Without VHOST_USER_F_PROTOCOL_FEATURES, virtqueues are enabled as soon
+	// as they're started.
+	if d.features&featureProtocolFeatures != 0 {
+		if err := d.setVringState(reqSetVringEnable, q.index, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startBackendChannel creates the back-end channel, passes it to the back-end,
+// and starts serving requests from it.
+func (d *Device) startBackendChannel(handle func(request uint32, payload []byte, fds []int) uint64) error {
+	ours, theirs, err := unet.SocketPair(false /* packet */)
+	if err != nil {
+		return err
+	}
+	theirFD, err := theirs.Release()
+	if err != nil {
+		ours.Close()
+		return err
+	}
+	err = d.request(reqSetBackendReqFD, nil, []int{theirFD})
+	_ = unix.Close(theirFD)
+	if err != nil {
+		ours.Close()
+		return err
+	}
+	d.backendSock = ours
+	d.backendWG.Add(1)
+	go d.serveBackendRequests(handle) // S/R-SAFE: Devices can't be saved.
+	return nil
+}
+
+// serveBackendRequests serves requests from the back-end channel until it's
+// closed.
+func (d *Device) serveBackendRequests(handle func(request uint32, payload []byte, fds []int) uint64) {
+	defer d.backendWG.Done()
+	for {
+		hdr, payload, fds, err := recvMessage(d.backendSock)
+		if err != nil {
+			if err != unix.EBADF && err != io.ErrUnexpectedEOF {
+				log.Warningf("vhost-user: reading back-end request failed: %v", err)
+			}
+			return
+		}
+		result := handle(hdr.request, payload, fds)
+		if hdr.flags&flagNeedReply == 0 {
+			continue
+		}
+		var buf [8]byte
+		hostarch.ByteOrder.PutUint64(buf[:], result)
+		reply := header{request: hdr.request, flags: flagVersion | flagReply}
+		if err := sendMessage(d.backendSock, reply, buf[:], nil); err != nil {
+			log.Warningf("vhost-user: replying to back-end request %d failed: %v", hdr.request, err)
+			return
+		}
+	}
+}
+
+// request sends a front-end request that has no reply. If the back-end
+// supports VHOST_USER_PROTOCOL_F_REPLY_ACK, request waits for the back-end to
+// acknowledge it.
+func (d *Device) request(request uint32, payload []byte, fds []int) error {
+	hdr := header{request: request, flags: flagVersion}
+	needReply := d.protocolFeatures&ProtocolFeatureReplyAck != 0
+	if needReply {
+		hdr.flags |= flagNeedReply
+	}
+	if err := sendMessage(d.sock, hdr, payload, fds); err != nil {
+		return err
+	}
+	if !needReply {
+		return nil
+	}
+	result, err := d.recvReplyU64(request)
+	if err != nil {
+		return err
+	}
+	if result != 0 {
+		return fmt.Errorf("request %d failed with status %d", request, result)
+	}
+	return nil
+}
+
+// getU64 sends a front-end request that has a u64 reply.
+func (d *Device) getU64(request uint32) (uint64, error) {
+	if err := sendMessage(d.sock, header{request: request, flags: flagVersion}, nil, nil); err != nil {
+		return 0, err
+	}
+	return d.recvReplyU64(request)
+}
+
+// setU64 sends a front-end request with a u64 payload.
+func (d *Device) setU64(request uint32, val uint64) error {
+	var buf [8]byte
+	hostarch.ByteOrder.PutUint64(buf[:], val)
+	return d.request(request, buf[:], nil)
+}
+
+// setVringState sends a front-end request with a struct vhost_vring_state
+// payload.
+func (d *Device) setVringState(request uint32, index int, num uint32) error {
+	var buf [8]byte
+	hostarch.ByteOrder.PutUint32(buf[0:], uint32(index))
+	hostarch.ByteOrder.PutUint32(buf[4:], num)
+	return d.request(request, buf[:], nil)
+}
+
+// setVringFD sends VHOST_USER_SET_VRING_KICK or VHOST_USER_SET_VRING_CALL.
+func (d *Device) setVringFD(request uint32, index int, fd int) error {
+	var buf [8]byte
+	hostarch.ByteOrder.PutUint64(buf[:], uint64(index))
+	return d.request(request, buf[:], []int{fd})
+}
+
+// recvReplyU64 receives the reply to request, which must have a u64 payload.
+func (d *Device) recvReplyU64(request uint32) (uint64, error) {
+	hdr, payload, fds, err := recvMessage(d.sock)
+	if err != nil {
+		return 0, err
+	}
+	closeFDs(fds)
+	if hdr.request != request || hdr.flags&flagReply == 0 {
+		return 0, fmt.Errorf("got message %d (flags %#x) while waiting for reply to request %d", hdr.request, hdr.flags, request)
+	}
+	if len(payload) != 8 {
+		return 0, fmt.Errorf("reply to request %d has %d bytes, want 8", request, len(payload))
+	}
+	return hostarch.ByteOrder.Uint64(payload), nil
+}
+
+// Features returns the negotiated virtio features.
+func (d *Device) Features() uint64 {
+	return d.features
+}
+
+// NumQueues returns the number of virtqueues of the device.
+func (d *Device) NumQueues() int {
+	return len(d.queues)
+}
+
+// Queue returns the virtqueue with the given index.
+func (d *Device) Queue(index int) *Virtqueue {
+	return d.queues[index]
+}
+
+// Buffers returns the shared memory available for buffers. Buffers placed in
+// virtqueues are specified by their offset in it.
+func (d *Device) Buffers() []byte {
+	return d.mem[d.buffersOff:]
+}
+
+// Close disconnects from the back-end and releases the device's resources. The
+// caller must ensure that the device's virtqueues are no longer in use.
+func (d *Device) Close() {
+	d.closeOnce.Do(func() {
+		d.release()
+		d.sock.Close()
+	})
+}
+
+// release releases all resources of the device other than the vhost-user
+// socket.
+func (d *Device) release() {
+	if d.backendSock != nil {
+		d.backendSock.Close()
+		d.backendWG.Wait()
+	}
+	for _, q := range d.queues {
+		q.close()
+	}
+	if d.mem != nil {
+		_ = memutil.UnmapSlice(d.mem)
+	}
+	if d.memFD >= 0 {
+		_ = unix.Close(d.memFD)
+	}
+}
@@ -0,0 +1,425 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vhostuser
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/eventfd"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/memutil"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/unet"
+)
+
+// testQueue is the back-end's view of a virtqueue.
+type testQueue struct {
+	size      uint32
+	desc      uint64
+	avail     uint64
+	used      uint64
+	kick      eventfd.Eventfd
+	call      eventfd.Eventfd
+	lastAvail uint16
+	usedIdx   uint16
+}
+
+// testBackend is a minimal vhost-user back-end.
+type testBackend struct {
+	t                *testing.T
+	sock             *unet.Socket
+	protocolFeatures uint64
+
+	// mu protects the following fields, which are set up by the front-end.
+	mu          sync.Mutex
+	mem         []byte
+	memBase     uint64
+	queues      map[uint32]*testQueue
+	backendSock *unet.Socket
+
+	// done is closed when serve returns.
+	done chan struct{}
+}
+
+func newTestBackend(t *testing.T, protocolFeatures uint64) (*testBackend, int) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("Socketpair: %v", err)
+	}
+	sock, err := unet.NewSocket(fds[1])
+	if err != nil {
+		t.Fatalf("NewSocket: %v", err)
+	}
+	b := &testBackend{
+		t:                t,
+		sock:             sock,
+		protocolFeatures: protocolFeatures,
+		queues:           make(map[uint32]*testQueue),
+		done:             make(chan struct{}),
+	}
+	go b.serve()
+	return b, fds[0]
+}
+
+func (b *testBackend) close() {
+	b.sock.Close()
+	<-b.done
+	if b.backendSock != nil {
+		b.backendSock.Close()
+	}
+	if b.mem != nil {
+		memutil.UnmapSlice(b.mem)
+	}
+	for _, q := range b.queues {
+		q.kick.Close()
+		q.call.Close()
+	}
+}
+
+func (b *testBackend) queue(index uint32) *testQueue {
+	q, ok := b.queues[index]
+	if !ok {
+		q = &testQueue{}
+		b.queues[index] = q
+	}
+	return q
+}
+
+// serve handles front-end requests until the front-end disconnects.
+func (b *testBackend) serve() {
+	defer close(b.done)
+	for {
+		hdr, payload, fds, err := recvMessage(b.sock)
+		if err != nil {
+			return
+		}
+		reply, ok := b.handle(hdr, payload, fds)
+		if !ok {
+			return
+		}
+		if reply == nil && hdr.flags&flagNeedReply != 0 {
+			reply = u64Bytes(0)
+		}
+		if reply != nil {
+			if err := sendMessage(b.sock, header{request: hdr.request, flags: flagVersion | flagReply}, reply, nil); err != nil {
+				b.t.Errorf("sending reply: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// handle handles a front-end request, and returns the payload of its reply,
+// if any.
+func (b *testBackend) handle(hdr header, payload []byte, fds []int) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var (
+		reply []byte
+		err   error
+	)
+	switch hdr.request {
+	case reqGetFeatures:
+		reply = u64Bytes(FeatureVersion1 | featureProtocolFeatures)
+	case reqGetProtocolFeatures:
+		reply = u64Bytes(b.protocolFeatures)
+	case reqSetMemTable:
+		size := hostarch.ByteOrder.Uint64(payload[16:])
+		b.memBase = hostarch.ByteOrder.Uint64(payload[8:])
+		b.mem, err = memutil.MapSlice(0, uintptr(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED, uintptr(fds[0]), uintptr(hostarch.ByteOrder.Uint64(payload[32:])))
+		if err != nil {
+			b.t.Errorf("mapping shared memory: %v", err)
+			return nil, false
+		}
+		unix.Close(fds[0])
+	case reqSetVringNum:
+		b.queue(hostarch.ByteOrder.Uint32(payload[0:])).size = hostarch.ByteOrder.Uint32(payload[4:])
+	case reqSetVringAddr:
+		q := b.queue(hostarch.ByteOrder.Uint32(payload[0:]))
+		q.desc = hostarch.ByteOrder.Uint64(payload[8:])
+		q.used = hostarch.ByteOrder.Uint64(payload[16:])
+		q.avail = hostarch.ByteOrder.Uint64(payload[24:])
+	case reqSetVringKick:
+		b.queue(uint32(hostarch.ByteOrder.Uint64(payload))).kick = eventfd.Wrap(fds[0])
+	case reqSetVringCall:
+		b.queue(uint32(hostarch.ByteOrder.Uint64(payload))).call = eventfd.Wrap(fds[0])
+	case reqSetBackendReqFD:
+		b.backendSock, err = unet.NewSocket(fds[0])
+		if err != nil {
+			b.t.Errorf("NewSocket: %v", err)
+			return nil, false
+		}
+	default:
+		closeFDs(fds)
+	}
+	return reply, true
+}
+
+// getBackendSock returns the back-end channel, or nil if it wasn't set up.
+func (b *testBackend) getBackendSock() *unet.Socket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.backendSock
+}
+
+// slice returns the back-end's mapping of [addr, addr+n).
+//
+// +checklocks:b.mu
+func (b *testBackend) slice(addr uint64, n uint32) []byte {
+	off := addr - b.memBase
+	return b.mem[off : off+uint64(n)]
+}
+
+// process waits for the front-end to kick the virtqueue, and then processes
+// each available descriptor chain by passing the contents of its readable
+// buffers to fn and writing fn's result to its writable buffers.
+func (b *testBackend) process(index uint32, fn func(in []byte) []byte) {
+	b.mu.Lock()
+	q := b.queues[index]
+	b.mu.Unlock()
+	if err := q.kick.Wait(); err != nil {
+		b.t.Errorf("waiting for kick: %v", err)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	availIdx := hostarch.ByteOrder.Uint16(b.slice(q.avail+2, 2))
+	for ; q.lastAvail != availIdx; q.lastAvail++ {
+		head := hostarch.ByteOrder.Uint16(b.slice(q.avail+4+2*uint64(uint32(q.lastAvail)%q.size), 2))
+		var (
+			in  []byte
+			out [][]byte
+		)
+		for desc := head; ; {
+			d := b.slice(q.desc+descSize*uint64(desc), descSize)
+			buf := b.slice(hostarch.ByteOrder.Uint64(d[0:]), hostarch.ByteOrder.Uint32(d[8:]))
+			flags := hostarch.ByteOrder.Uint16(d[12:])
+			if flags&descFlagWrite != 0 {
+				out = append(out, buf)
+			} else {
+				in = append(in, buf...)
+			}
+			if flags&descFlagNext == 0 {
+				break
+			}
+			desc = hostarch.ByteOrder.Uint16(d[14:])
+		}
+		reply := fn(in)
+		written := 0
+		for _, buf := range out {
+			written += copy(buf, reply[written:])
+		}
+		b.addUsed(q, uint32(head), uint32(written))
+	}
+	q.call.Notify()
+}
+
+// +checklocks:b.mu
+func (b *testBackend) addUsed(q *testQueue, id, written uint32) {
+	elem := b.slice(q.used+4+usedElemSize*uint64(uint32(q.usedIdx)%q.size), usedElemSize)
+	hostarch.ByteOrder.PutUint32(elem[0:], id)
+	hostarch.ByteOrder.PutUint32(elem[4:], written)
+	q.usedIdx++
+	hostarch.ByteOrder.PutUint16(b.slice(q.used+2, 2), q.usedIdx)
+}
+
+func u64Bytes(v uint64) []byte {
+	var buf [8]byte
+	hostarch.ByteOrder.PutUint64(buf[:], v)
+	return buf[:]
+}
+
+func TestVirtqueue(t *testing.T) {
+	b, fd := newTestBackend(t, ProtocolFeatureReplyAck)
+	defer b.close()
+	d, err := Connect(fd, Config{NumQueues: 2, QueueSize: 4, BufferSize: hostarch.PageSize})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer d.Close()
+	if got, want := d.Features(), uint64(FeatureVersion1|featureProtocolFeatures); got != want {
+		t.Errorf("Features() = %#x, want %#x", got, want)
+	}
+
+	q := d.Queue(1)
+	bufs := d.Buffers()
+	copy(bufs, "hello")
+	head, err := q.Add([]Buffer{
+		{Offset: 0, Len: 5},
+		{Offset: 512, Len: 2, Writable: true},
+		{Offset: 1024, Len: 16, Writable: true},
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := q.Kick(); err != nil {
+		t.Fatalf("Kick: %v", err)
+	}
+	b.process(1, bytes.ToUpper)
+	if err := q.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	gotHead, written, ok, err := q.Used()
+	if err != nil || !ok {
+		t.Fatalf("Used() = %d, %d, %t, %v, want a used chain", gotHead, written, ok, err)
+	}
+	if gotHead != head || written != 5 {
+		t.Errorf("Used() = head %d, written %d, want head %d, written 5", gotHead, written, head)
+	}
+	if got := string(bufs[512:514]) + string(bufs[1024:1027]); got != "HELLO" {
+		t.Errorf("reply = %q, want %q", got, "HELLO")
+	}
+	if _, _, ok, err := q.Used(); ok || err != nil {
+		t.Errorf("Used() = %t, %v after consuming all used chains, want false, nil", ok, err)
+	}
+
+	// All descriptors were freed, so the virtqueue can be filled again.
+	for i := uint16(0); i < q.Size(); i++ {
+		if _, err := q.Add([]Buffer{{Offset: 0, Len: 1}}); err != nil {
+			t.Fatalf("Add #%d: %v", i, err)
+		}
+	}
+	if _, err := q.Add([]Buffer{{Offset: 0, Len: 1}}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Add to full virtqueue = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestAddInvalid(t *testing.T) {
+	b, fd := newTestBackend(t, 0)
+	defer b.close()
+	d, err := Connect(fd, Config{NumQueues: 1, QueueSize: 4, BufferSize: hostarch.PageSize})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer d.Close()
+	q := d.Queue(0)
+	for _, bufs := range [][]Buffer{
+		nil,
+		{{Offset: hostarch.PageSize - 1, Len: 2}},
+		{{Offset: 0, Len: 1, Writable: true}, {Offset: 1, Len: 1}},
+		{{Offset: 0, Len: 1}, {Offset: 1, Len: 1}, {Offset: 2, Len: 1}, {Offset: 3, Len: 1}, {Offset: 4, Len: 1}},
+	} {
+		if _, err := q.Add(bufs); err == nil {
+			t.Errorf("Add(%+v) succeeded, want error", bufs)
+		}
+	}
+}
+
+func TestUsedUnownedDescriptor(t *testing.T) {
+	b, fd := newTestBackend(t, ProtocolFeatureReplyAck)
+	defer b.close()
+	d, err := Connect(fd, Config{NumQueues: 1, QueueSize: 4, BufferSize: hostarch.PageSize})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer d.Close()
+	b.mu.Lock()
+	b.addUsed(b.queues[0], 2, 0)
+	b.mu.Unlock()
+	if _, _, _, err := d.Queue(0).Used(); err == nil {
+		t.Errorf("Used() succeeded for a descriptor that the device doesn't own")
+	}
+}
+
+func TestBackendRequest(t *testing.T) {
+	b, fd := newTestBackend(t, ProtocolFeatureReplyAck|ProtocolFeatureBackendReq|ProtocolFeatureBackendSendFD)
+	defer b.close()
+	type request struct {
+		request uint32
+		payload []byte
+		numFDs  int
+	}
+	requests := make(chan request, 1)
+	d, err := Connect(fd, Config{
+		NumQueues:        1,
+		QueueSize:        4,
+		BufferSize:       hostarch.PageSize,
+		ProtocolFeatures: ProtocolFeatureBackendSendFD,
+		HandleBackendRequest: func(req uint32, payload []byte, fds []int) uint64 {
+			closeFDs(fds)
+			requests <- request{req, payload, len(fds)}
+			return 7
+		},
+	})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer d.Close()
+	backendSock := b.getBackendSock()
+	if backendSock == nil {
+		t.Fatalf("back-end channel wasn't set up")
+	}
+
+	var pipe [2]int
+	if err := unix.Pipe2(pipe[:], unix.O_CLOEXEC); err != nil {
+		t.Fatalf("Pipe2: %v", err)
+	}
+	defer unix.Close(pipe[0])
+	defer unix.Close(pipe[1])
+	payload := make([]byte, fsBackendMsgSize)
+	hostarch.ByteOrder.PutUint64(payload[8*0:], 0x1000)                            // fd_offset[0]
+	hostarch.ByteOrder.PutUint64(payload[8*fsBackendMsgEntries:], 0x200000)        // c_offset[0]
+	hostarch.ByteOrder.PutUint64(payload[8*2*fsBackendMsgEntries:], 0x2000)        // len[0]
+	hostarch.ByteOrder.PutUint64(payload[8*3*fsBackendMsgEntries:], FSMapFlagRead) // flags[0]
+	if err := sendMessage(backendSock, header{request: BackendFSMap, flags: flagVersion | flagNeedReply}, payload, []int{pipe[0]}); err != nil {
+		t.Fatalf("sending back-end request: %v", err)
+	}
+	hdr, reply, fds, err := recvMessage(backendSock)
+	if err != nil {
+		t.Fatalf("receiving reply: %v", err)
+	}
+	closeFDs(fds)
+	if hdr.request != BackendFSMap || hdr.flags&flagReply == 0 || hostarch.ByteOrder.Uint64(reply) != 7 {
+		t.Errorf("got reply %+v with payload %v, want reply to request %d with result 7", hdr, reply, BackendFSMap)
+	}
+
+	req := <-requests
+	if req.request != BackendFSMap || req.numFDs != 1 {
+		t.Errorf("handler got request %d with %d FDs, want request %d with 1 FD", req.request, req.numFDs, BackendFSMap)
+	}
+	ms, err := ParseFSBackendMsg(req.payload)
+	if err != nil {
+		t.Fatalf("ParseFSBackendMsg: %v", err)
+	}
+	want := []FSMapping{{FDOffset: 0x1000, CacheOffset: 0x200000, Len: 0x2000, Flags: FSMapFlagRead}}
+	if len(ms) != 1 || ms[0] != want[0] {
+		t.Errorf("ParseFSBackendMsg() = %+v, want %+v", ms, want)
+	}
+	if _, err := ParseFSBackendMsg(req.payload[1:]); err == nil {
+		t.Errorf("ParseFSBackendMsg succeeded on a truncated message")
+	}
+}
+
+func TestConnectUnsupported(t *testing.T) {
+	b, fd := newTestBackend(t, ProtocolFeatureReplyAck)
+	defer b.close()
+	_, err := Connect(fd, Config{
+		NumQueues:  1,
+		QueueSize:  4,
+		BufferSize: hostarch.PageSize,
+		HandleBackendRequest: func(uint32, []byte, []int) uint64 {
+			return 0
+		},
+	})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Connect() = %v, want %v", err, ErrUnsupported)
+	}
+	// The caller still owns fd.
+	unix.Close(fd)
+}
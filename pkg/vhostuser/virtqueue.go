@@ -0,0 +1,265 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vhostuser
+
+import (
+	"errors"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/eventfd"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Split virtqueue layout, from the virtio specification, section 2.7.
+const (
+	// descSize is the size of struct virtq_desc.
+	descSize = 16
+
+	// descFlagNext marks a descriptor as continuing via the next field.
+	descFlagNext = 1
+
+	// descFlagWrite marks a descriptor as device write-only.
+	descFlagWrite = 2
+
+	// ringHeaderSize is the size of the flags and idx fields that precede
+	// the available and used rings.
+	ringHeaderSize = 4
+
+	// usedElemSize is the size of struct virtq_used_elem.
+	usedElemSize = 8
+)
+
+// availOffset returns the offset of the available ring in a virtqueue with
+// size descriptors.
+func availOffset(size uint16) int {
+	return int(size) * descSize
+}
+
+// usedOffset returns the offset of the used ring in a virtqueue with size
+// descriptors. The used ring must be 4-byte aligned.
+func usedOffset(size uint16) int {
+	// The available ring ends with the used_event field.
+	availEnd := availOffset(size) + ringHeaderSize + 2*int(size) + 2
+	return (availEnd + 3) &^ 3
+}
+
+// vringSize returns the size of a virtqueue with size descriptors.
+func vringSize(size uint16) int {
+	// The used ring ends with the avail_event field.
+	return usedOffset(size) + ringHeaderSize + usedElemSize*int(size) + 2
+}
+
+// ErrQueueFull is returned by Virtqueue.Add if the virtqueue doesn't have
+// enough free descriptors.
+var ErrQueueFull = errors.New("virtqueue is full")
+
+// Buffer is a buffer in a descriptor chain.
+type Buffer struct {
+	// Offset is the offset of the buffer in Device.Buffers.
+	Offset uint64
+
+	// Len is the length of the buffer in bytes.
+	Len uint32
+
+	// Writable is true if the device writes to the buffer rather than reading
+	// from it.
+	Writable bool
+}
+
+// Virtqueue is a split virtqueue shared with a vhost-user back-end.
+type Virtqueue struct {
+	// dev is the device that the virtqueue belongs to. dev is immutable.
+	dev *Device
+
+	// index is the index of the virtqueue in the device. index is immutable.
+	index int
+
+	// size is the number of descriptors in the virtqueue. size is immutable.
+	size uint16
+
+	// ring is the shared memory containing the virtqueue. ring is immutable.
+	ring []byte
+
+	// descAddr, availAddr and usedAddr are the addresses of the descriptor
+	// table, available ring and used ring. They are immutable.
+	descAddr  uint64
+	availAddr uint64
+	usedAddr  uint64
+
+	// kick is signaled by the front-end when it adds buffers. kick is
+	// immutable.
+	kick eventfd.Eventfd
+
+	// call is signaled by the back-end when it uses buffers. call is
+	// immutable.
+	call eventfd.Eventfd
+
+	mu sync.Mutex
+
+	// free contains the indices of free descriptors.
+	//
+	// +checklocks:mu
+	free []uint16
+
+	// chains maps the index of each descriptor at the head of a chain that is
+	// owned by the device to the indices of the descriptors in the chain. It
+	// is nil for other descriptors. The chains are tracked here rather than
+	// read back from the descriptor table, which the device can write to.
+	//
+	// +checklocks:mu
+	chains [][]uint16
+
+	// availIdx is the index of the next available ring entry.
+	//
+	// +checklocks:mu
+	availIdx uint16
+
+	// lastUsedIdx is the index of the next used ring entry to be consumed.
+	//
+	// +checklocks:mu
+	lastUsedIdx uint16
+}
+
+func newVirtqueue(d *Device, index int, size uint16, ring []byte, addr uint64) (*Virtqueue, error) {
+	kick, err := eventfd.Create()
+	if err != nil {
+		return nil, err
+	}
+	call, err := eventfd.Create()
+	if err != nil {
+		kick.Close()
+		return nil, err
+	}
+	q := &Virtqueue{
+		dev:       d,
+		index:     index,
+		size:      size,
+		ring:      ring,
+		descAddr:  addr,
+		availAddr: addr + uint64(availOffset(size)),
+		usedAddr:  addr + uint64(usedOffset(size)),
+		kick:      kick,
+		call:      call,
+		free:      make([]uint16, size),
+		chains:    make([][]uint16, size),
+	}
+	for i := range q.free {
+		q.free[i] = size - 1 - uint16(i)
+	}
+	return q, nil
+}
+
+func (q *Virtqueue) close() {
+	q.kick.Close()
+	q.call.Close()
+}
+
+// Size returns the number of descriptors in the virtqueue.
+func (q *Virtqueue) Size() uint16 {
+	return q.size
+}
+
+// Add makes a chain of buffers available to the device, and returns the index
+// of the chain's head descriptor. The device-readable buffers must precede the
+// device-writable ones. Add doesn't notify the device; see Kick.
+func (q *Virtqueue) Add(bufs []Buffer) (uint16, error) {
+	if len(bufs) == 0 {
+		return 0, fmt.Errorf("empty descriptor chain")
+	}
+	buffersLen := uint64(len(q.dev.Buffers()))
+	for i, buf := range bufs {
+		if buf.Offset > buffersLen || uint64(buf.Len) > buffersLen-buf.Offset {
+			return 0, fmt.Errorf("buffer [%#x, %#x) is out of bounds", buf.Offset, buf.Offset+uint64(buf.Len))
+		}
+		if i > 0 && bufs[i-1].Writable && !buf.Writable {
+			return 0, fmt.Errorf("device-readable buffer follows device-writable buffer")
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(bufs) > len(q.free) {
+		return 0, ErrQueueFull
+	}
+	buffersAddr := q.dev.base() + q.dev.buffersOff
+	descs := append([]uint16(nil), q.free[len(q.free)-len(bufs):]...)
+	q.free = q.free[:len(q.free)-len(bufs)]
+	for i, buf := range bufs {
+		d := q.ring[int(descs[i])*descSize:][:descSize]
+		var flags, next uint16
+		if i+1 < len(bufs) {
+			flags |= descFlagNext
+			next = descs[i+1]
+		}
+		if buf.Writable {
+			flags |= descFlagWrite
+		}
+		hostarch.ByteOrder.PutUint64(d[0:], buffersAddr+buf.Offset)
+		hostarch.ByteOrder.PutUint32(d[8:], buf.Len)
+		hostarch.ByteOrder.PutUint16(d[12:], flags)
+		hostarch.ByteOrder.PutUint16(d[14:], next)
+	}
+	head := descs[0]
+	q.chains[head] = descs
+
+	avail := q.ring[availOffset(q.size):]
+	hostarch.ByteOrder.PutUint16(avail[ringHeaderSize+2*int(q.availIdx%q.size):], head)
+	q.availIdx++
+	// Publish the ring entry, and the descriptors, to the device.
+	q.storeAvailIdx(q.availIdx)
+	return head, nil
+}
+
+// Kick notifies the device that buffers were added to the virtqueue.
+func (q *Virtqueue) Kick() error {
+	return q.kick.Notify()
+}
+
+// Used returns the next descriptor chain that the device has finished using:
+// the index of its head descriptor, and the number of bytes that the device
+// wrote to its device-writable buffers. ok is false if there is no such chain.
+//
+// The descriptors are free to be reused once Used returns them.
+func (q *Virtqueue) Used() (head uint16, written uint32, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.loadUsedIdx() == q.lastUsedIdx {
+		return 0, 0, false, nil
+	}
+	elem := q.ring[usedOffset(q.size)+ringHeaderSize+usedElemSize*int(q.lastUsedIdx%q.size):]
+	id := hostarch.ByteOrder.Uint32(elem[0:])
+	written = hostarch.ByteOrder.Uint32(elem[4:])
+	if id >= uint32(q.size) || q.chains[id] == nil {
+		return 0, 0, false, fmt.Errorf("device used descriptor %d, which it doesn't own", id)
+	}
+	q.lastUsedIdx++
+	head = uint16(id)
+	q.free = append(q.free, q.chains[head]...)
+	q.chains[head] = nil
+	return head, written, true, nil
+}
+
+// Wait blocks until the device signals that it used buffers, or until
+// Interrupt is called.
+func (q *Virtqueue) Wait() error {
+	_, err := q.call.Read()
+	return err
+}
+
+// Interrupt wakes up a call to Wait.
+func (q *Virtqueue) Interrupt() {
+	q.call.Notify()
+}
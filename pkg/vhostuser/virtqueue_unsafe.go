@@ -0,0 +1,46 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vhostuser
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// sliceAddr returns the address of the first byte of b.
+func sliceAddr(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(&b[0]))
+}
+
+// The flags and idx fields of the available and used rings are both 16 bits
+// wide, and flags precedes idx. Since there are no 16-bit atomic operations,
+// both are accessed as a single 32-bit word, in which idx is the upper half
+// on little-endian hosts.
+
+// storeAvailIdx publishes idx as the available ring's idx, with all earlier
+// writes to the virtqueue visible to the device. The available ring's flags
+// are always zero, since the front-end always wants to be notified of used
+// buffers.
+//
+// +checklocks:q.mu
+func (q *Virtqueue) storeAvailIdx(idx uint16) {
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(&q.ring[availOffset(q.size)])), uint32(idx)<<16)
+}
+
+// loadUsedIdx returns the used ring's idx. Used ring entries before idx are
+// visible once loadUsedIdx returns.
+func (q *Virtqueue) loadUsedIdx() uint16 {
+	return uint16(atomic.LoadUint32((*uint32)(unsafe.Pointer(&q.ring[usedOffset(q.size)]))) >> 16)
+}
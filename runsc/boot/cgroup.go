@@ -0,0 +1,216 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+// containerCgroupControllers are the controllers for which each container
+// gets its own cgroup, if they are attached to a mounted hierarchy.
+var containerCgroupControllers = []kernel.CgroupControllerType{
+	kernel.CgroupControllerCPU,
+	kernel.CgroupControllerCPUAcct,
+	kernel.CgroupControllerMemory,
+	kernel.CgroupControllerPIDs,
+}
+
+// containerCgroups returns the cgroups at path, creating them if they don't
+// exist yet. Each container is placed in the cgroup /<cid> of every mounted
+// hierarchy, so that the sentry accounts and limits the CPU and memory used by
+// containers in the same sandbox separately, and each container sees its own
+// usage and limits in cgroupfs. The containers of a pod that joined the
+// sandbox are placed in /<pod ID>/<cid> instead (see
+// Loader.containerCgroupPathLocked).
+//
+// The returned map is keyed by controller, and a cgroup appears once per
+// controller attached to its hierarchy. The caller must release the returned
+// cgroups with decRefCgroups.
+func containerCgroups(ctx context.Context, k *kernel.Kernel, path string) (map[kernel.CgroupControllerType]kernel.Cgroup, error) {
+	r := k.CgroupRegistry()
+	cgs := make(map[kernel.CgroupControllerType]kernel.Cgroup)
+	for _, ctype := range containerCgroupControllers {
+		cg, err := r.CreateCgroup(ctx, ctype, path)
+		if errors.Is(err, kernel.ErrCgroupControllerInactive) {
+			continue
+		}
+		if err != nil {
+			decRefCgroups(ctx, cgs)
+			return nil, fmt.Errorf("creating %s cgroup %q: %w", ctype, path, err)
+		}
+		cgs[ctype] = cg
+	}
+	return cgs, nil
+}
+
+// decRefCgroups releases the cgroups returned by containerCgroups.
+func decRefCgroups(ctx context.Context, cgs map[kernel.CgroupControllerType]kernel.Cgroup) {
+	for _, cg := range cgs {
+		cg.DecRef(ctx)
+	}
+}
+
+// initialCgroups converts cgs to the set of cgroups used for
+// kernel.CreateProcessArgs.InitialCgroups.
+func initialCgroups(cgs map[kernel.CgroupControllerType]kernel.Cgroup) map[kernel.Cgroup]struct{} {
+	set := make(map[kernel.Cgroup]struct{}, len(cgs))
+	for _, cg := range cgs {
+		set[cg] = struct{}{}
+	}
+	return set
+}
+
+// setContainerCgroupLimits applies the CPU, memory and PID limits in res to
+// the cgroups of a container. Limits for controllers that aren't mounted are
+// ignored.
+func setContainerCgroupLimits(ctx context.Context, cgs map[kernel.CgroupControllerType]kernel.Cgroup, res *specs.LinuxResources) error {
+	if res == nil {
+		return nil
+	}
+	write := func(ctype kernel.CgroupControllerType, name, val string) error {
+		cg, ok := cgs[ctype]
+		if !ok {
+			log.Infof("Ignoring %s=%s, %s controller is not mounted", name, val, ctype)
+			return nil
+		}
+		if err := cg.WriteControl(ctx, name, val); err != nil {
+			return fmt.Errorf("setting %s=%s: %w", name, val, err)
+		}
+		return nil
+	}
+	if mem := res.Memory; mem != nil && mem.Limit != nil && *mem.Limit > 0 {
+		if err := write(kernel.CgroupControllerMemory, "memory.limit_in_bytes", strconv.FormatInt(*mem.Limit, 10)); err != nil {
+			return err
+		}
+	}
+	if cpu := res.CPU; cpu != nil {
+		if cpu.Quota != nil || cpu.Period != nil {
+			quota := "max"
+			if cpu.Quota != nil && *cpu.Quota > 0 {
+				quota = strconv.FormatInt(*cpu.Quota, 10)
+			}
+			val := quota
+			if cpu.Period != nil && *cpu.Period > 0 {
+				val += " " + strconv.FormatUint(*cpu.Period, 10)
+			}
+			if err := write(kernel.CgroupControllerCPU, "cpu.max", val); err != nil {
+				return err
+			}
+		}
+		if cpu.Shares != nil && *cpu.Shares > 0 {
+			if err := write(kernel.CgroupControllerCPU, "cpu.shares", strconv.FormatUint(*cpu.Shares, 10)); err != nil {
+				return err
+			}
+		}
+	}
+	if pids := res.Pids; pids != nil && pids.Limit > 0 {
+		if err := write(kernel.CgroupControllerPIDs, "pids.max", strconv.FormatInt(pids.Limit, 10)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultCPUPeriod is the CFS period used when the spec sets a CPU quota
+// without a period, as in Linux.
+const defaultCPUPeriod = 100 * time.Millisecond
+
+// minContainerCPUs is the minimum number of CPUs that containers are limited
+// to with --cpu-num-from-quota. As for the sandbox, dropping below 2 CPUs can
+// make applications disable locks, leading to hard to debug errors.
+const minContainerCPUs = 2
+
+// setContainerCPULimits applies the CPU quota in res to the tasks of
+// container cid in the sentry. Without --cgroupfs, containers share the
+// sandbox's host cgroup, so this is the only way that a subcontainer's quota
+// is enforced. With --cpu-num-from-quota, processes created in the container
+// are also limited to as many CPUs as the quota allows, so that
+// applications that size thread pools by the number of CPUs don't spin on
+// more CPUs than they can use.
+func setContainerCPULimits(k *kernel.Kernel, conf *config.Config, cid string, res *specs.LinuxResources) error {
+	if res == nil || res.CPU == nil || (res.CPU.Quota == nil && res.CPU.Period == nil) {
+		return nil
+	}
+	period := defaultCPUPeriod
+	if p := res.CPU.Period; p != nil && *p > 0 {
+		period = time.Duration(*p) * time.Microsecond
+	}
+	quota := time.Duration(-1)
+	if q := res.CPU.Quota; q != nil && *q > 0 {
+		quota = time.Duration(*q) * time.Microsecond
+	}
+	var cpus uint
+	if conf.CPUNumFromQuota && quota > 0 {
+		cpus = uint((quota + period - 1) / period)
+		if cpus < minContainerCPUs {
+			cpus = minContainerCPUs
+		}
+	}
+	if conf.Cgroupfs {
+		// The container's cpu cgroup enforces the quota.
+		quota = -1
+	}
+	if err := k.SetContainerCPULimits(cid, quota, period, cpus); err != nil {
+		return fmt.Errorf("setting CPU limits for container %q: %w", cid, err)
+	}
+	return nil
+}
+
+// containerMemoryStats returns the memory usage of container cid and the
+// breakdown of its usage in memory.stat, read from the container's memory
+// cgroup at path. It returns false if the container doesn't have its own
+// memory cgroup, i.e. if --cgroupfs isn't set.
+func containerMemoryStats(ctx context.Context, k *kernel.Kernel, cid, path string) (uint64, map[string]uint64, bool) {
+	cg, err := k.CgroupRegistry().FindCgroup(ctx, kernel.CgroupControllerMemory, path)
+	if err != nil {
+		return 0, nil, false
+	}
+	val, err := cg.ReadControl(ctx, "memory.usage_in_bytes")
+	if err != nil {
+		log.Warningf("Reading memory.usage_in_bytes for container %q: %v", cid, err)
+		return 0, nil, false
+	}
+	total, err := strconv.ParseUint(strings.TrimSpace(val), 10, 64)
+	if err != nil {
+		log.Warningf("Parsing memory.usage_in_bytes %q for container %q: %v", val, cid, err)
+		return 0, nil, false
+	}
+	val, err = cg.ReadControl(ctx, "memory.stat")
+	if err != nil {
+		log.Warningf("Reading memory.stat for container %q: %v", cid, err)
+		return total, nil, true
+	}
+	stats := make(map[string]uint64)
+	for _, line := range strings.Split(val, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			stats[fields[0]] = n
+		}
+	}
+	return total, stats, true
+}
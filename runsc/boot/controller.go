@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"runtime"
 	gtime "time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -32,12 +33,14 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/erofs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/swapper"
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
 	"gvisor.dev/gvisor/pkg/sentry/state"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/state/chunkstore"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/boot/pprof"
@@ -63,6 +66,16 @@ const (
 	// ContMgrExecuteAsync executes a command in a container.
 	ContMgrExecuteAsync = "containerManager.ExecuteAsync"
 
+	// ContMgrCreateExecSession makes the terminal of an exec'd process
+	// persistent, so that clients can detach from and reattach to it.
+	ContMgrCreateExecSession = "containerManager.CreateExecSession"
+
+	// ContMgrAttachExecSession attaches a client to an exec session.
+	ContMgrAttachExecSession = "containerManager.AttachExecSession"
+
+	// ContMgrResizeExecSession changes the window size of an exec session.
+	ContMgrResizeExecSession = "containerManager.ResizeExecSession"
+
 	// ContMgrPortForward starts port forwarding with the sandbox.
 	ContMgrPortForward = "containerManager.PortForward"
 
@@ -72,6 +85,14 @@ const (
 	// ContMgrRestore restores a container from a statefile.
 	ContMgrRestore = "containerManager.Restore"
 
+	// ContMgrSetCPULimit changes the number of CPUs used to run application
+	// code in the sandbox.
+	ContMgrSetCPULimit = "containerManager.SetCPULimit"
+
+	// ContMgrUpdateResources changes the resource limits of the cgroups of a
+	// container in the sandbox.
+	ContMgrUpdateResources = "containerManager.UpdateResources"
+
 	// ContMgrSignal sends a signal to a container.
 	ContMgrSignal = "containerManager.Signal"
 
@@ -103,12 +124,24 @@ const (
 
 	// ContMgrMount mounts a filesystem in a container.
 	ContMgrMount = "containerManager.Mount"
+
+	// ContMgrMountInfo returns the mount table of a container.
+	ContMgrMountInfo = "containerManager.MountInfo"
+
+	// ContMgrSetSyscallOverrides overrides syscalls in a container.
+	ContMgrSetSyscallOverrides = "containerManager.SetSyscallOverrides"
 )
 
 const (
 	// NetworkCreateLinksAndRoutes creates links and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
 
+	// NetworkStartPacketCapture starts capturing packets on a NIC.
+	NetworkStartPacketCapture = "Network.StartPacketCapture"
+
+	// NetworkStopPacketCapture stops capturing packets on a NIC.
+	NetworkStopPacketCapture = "Network.StopPacketCapture"
+
 	// DebugStacks collects sandbox stacks for debugging.
 	DebugStacks = "debug.Stacks"
 )
@@ -136,6 +169,7 @@ const (
 // Usage related commands (see usage.go for more details).
 const (
 	UsageCollect = "Usage.Collect"
+	UsageReduce  = "Usage.Reduce"
 	UsageUsageFD = "Usage.UsageFD"
 )
 
@@ -188,7 +222,7 @@ func newController(fd int, l *Loader) (*controller, error) {
 	ctrl.srv.Register(&debug{})
 
 	if eps, ok := l.k.RootNetworkNamespace().Stack().(*netstack.Stack); ok {
-		ctrl.srv.Register(&Network{Stack: eps.Stack})
+		ctrl.srv.Register(&Network{Stack: eps.Stack, podStack: l.podNetworkStack})
 	}
 	if l.root.conf.ProfileEnable {
 		ctrl.srv.Register(control.NewProfile(l.k))
@@ -277,6 +311,14 @@ type StartArgs struct {
 	// Optionally configured with the overlay2 flag.
 	NumOverlayFilestoreFDs int
 
+	// NumVirtiofsFDs is the number of FDs connected to virtio-fs servers
+	// donated, one for each virtiofs mount in Spec.Mounts.
+	NumVirtiofsFDs int
+
+	// NumNFSFDs is the number of FDs connected to NFS servers donated, one for
+	// each NFS mount in Spec.Mounts.
+	NumNFSFDs int
+
 	// OverlayMediums contains information about how the gofer mounts have been
 	// overlaid. The first entry is for rootfs and the following entries are for
 	// bind mounts in Spec.Mounts (in the same order).
@@ -285,6 +327,8 @@ type StartArgs struct {
 	// FilePayload contains, in order:
 	//   * stdin, stdout, and stderr (optional: if terminal is disabled).
 	//   * file descriptors to overlay-backing host files (optional: for overlay2).
+	//   * file descriptors to virtio-fs servers (optional: for virtiofs mounts).
+	//   * file descriptors to NFS servers (optional: for NFS mounts).
 	//   * file descriptors to connect to gofer to serve the root filesystem.
 	urpc.FilePayload
 }
@@ -307,6 +351,8 @@ func (cm *containerManager) StartSubcontainer(args *StartArgs, _ *struct{}) erro
 	}
 	expectedFDs := 1 // At least one FD for the root filesystem.
 	expectedFDs += args.NumOverlayFilestoreFDs
+	expectedFDs += args.NumVirtiofsFDs
+	expectedFDs += args.NumNFSFDs
 	if !args.Spec.Process.Terminal {
 		expectedFDs += 3
 	}
@@ -345,6 +391,26 @@ func (cm *containerManager) StartSubcontainer(args *StartArgs, _ *struct{}) erro
 	}
 	goferFiles = goferFiles[args.NumOverlayFilestoreFDs:]
 
+	var virtiofsFDs []*fd.FD
+	for i := 0; i < args.NumVirtiofsFDs; i++ {
+		virtiofsFD, err := fd.NewFromFile(goferFiles[i])
+		if err != nil {
+			return fmt.Errorf("error dup'ing virtiofs file: %w", err)
+		}
+		virtiofsFDs = append(virtiofsFDs, virtiofsFD)
+	}
+	goferFiles = goferFiles[args.NumVirtiofsFDs:]
+
+	var nfsFDs []*fd.FD
+	for i := 0; i < args.NumNFSFDs; i++ {
+		nfsFD, err := fd.NewFromFile(goferFiles[i])
+		if err != nil {
+			return fmt.Errorf("error dup'ing NFS file: %w", err)
+		}
+		nfsFDs = append(nfsFDs, nfsFD)
+	}
+	goferFiles = goferFiles[args.NumNFSFDs:]
+
 	goferFDs, err := fd.NewFromFiles(goferFiles)
 	if err != nil {
 		return fmt.Errorf("error dup'ing gofer files: %w", err)
@@ -355,7 +421,7 @@ func (cm *containerManager) StartSubcontainer(args *StartArgs, _ *struct{}) erro
 		}
 	}()
 
-	if err := cm.l.startSubcontainer(args.Spec, args.Conf, args.CID, stdios, goferFDs, overlayFilestoreFDs, args.OverlayMediums); err != nil {
+	if err := cm.l.startSubcontainer(args.Spec, args.Conf, args.CID, stdios, goferFDs, overlayFilestoreFDs, virtiofsFDs, nfsFDs, args.OverlayMediums); err != nil {
 		log.Debugf("containerManager.StartSubcontainer failed, cid: %s, args: %+v, err: %v", args.CID, args, err)
 		return err
 	}
@@ -383,6 +449,70 @@ func (cm *containerManager) ExecuteAsync(args *control.ExecArgs, pid *int32) err
 	return nil
 }
 
+// ExecSessionArgs are arguments to the CreateExecSession and
+// AttachExecSession methods.
+type ExecSessionArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the PID of the exec'd process, as returned by ExecuteAsync.
+	PID int32
+
+	// FilePayload contains the pty master for CreateExecSession, or the
+	// client's end of a connected socket for AttachExecSession.
+	urpc.FilePayload
+}
+
+func (args *ExecSessionArgs) file() (*fd.FD, error) {
+	if len(args.Files) != 1 {
+		return nil, fmt.Errorf("exec session arguments must have exactly 1 file, got %d", len(args.Files))
+	}
+	return fd.NewFromFile(args.Files[0])
+}
+
+// CreateExecSession makes the terminal of an exec'd process persistent. The
+// process must have been started with StdioIsPty, with the replica of the
+// given pty master as its stdio.
+func (cm *containerManager) CreateExecSession(args *ExecSessionArgs, _ *struct{}) error {
+	log.Debugf("containerManager.CreateExecSession, cid: %s, pid: %d", args.CID, args.PID)
+	master, err := args.file()
+	if err != nil {
+		return err
+	}
+	return cm.l.createExecSession(args.CID, kernel.ThreadID(args.PID), master)
+}
+
+// AttachExecSession attaches a client to an exec session. Terminal output is
+// written to the client connection and input read from it is written to the
+// terminal until the client shuts it down, which detaches it.
+func (cm *containerManager) AttachExecSession(args *ExecSessionArgs, _ *struct{}) error {
+	log.Debugf("containerManager.AttachExecSession, cid: %s, pid: %d", args.CID, args.PID)
+	client, err := args.file()
+	if err != nil {
+		return err
+	}
+	return cm.l.attachExecSession(args.CID, kernel.ThreadID(args.PID), client)
+}
+
+// ResizeExecSessionArgs are arguments to the ResizeExecSession method.
+type ResizeExecSessionArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the PID of the exec'd process, as returned by ExecuteAsync.
+	PID int32
+
+	// Rows and Cols are the new window size.
+	Rows uint16
+	Cols uint16
+}
+
+// ResizeExecSession changes the window size of an exec session.
+func (cm *containerManager) ResizeExecSession(args *ResizeExecSessionArgs, _ *struct{}) error {
+	log.Debugf("containerManager.ResizeExecSession, cid: %s, pid: %d, rows: %d, cols: %d", args.CID, args.PID, args.Rows, args.Cols)
+	return cm.l.resizeExecSession(args.CID, kernel.ThreadID(args.PID), args.Rows, args.Cols)
+}
+
 // Checkpoint pauses a sandbox and saves its state.
 func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Checkpoint")
@@ -391,11 +521,33 @@ func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 		return errors.New("checkpoint not supported when using hostinet")
 	}
 
+	// The swapper and merger mutate MemoryManagers, which must not change
+	// while the kernel is saved. Unless the sandbox is resumed, it exits
+	// after checkpoint, so they are not restarted.
+	if cm.l.swapper != nil {
+		cm.l.swapper.Stop()
+		cm.l.swapper = nil
+	}
+	if cm.l.merger != nil {
+		cm.l.merger.Stop()
+		cm.l.merger = nil
+	}
+
 	state := control.State{
 		Kernel:   cm.l.k,
 		Watchdog: cm.l.watchdog,
 	}
-	return state.Save(o, nil)
+	err := state.Save(o, nil)
+	if o.Resume {
+		if cm.l.swapperOpts != nil {
+			cm.l.swapper = swapper.New(cm.l.k, *cm.l.swapperOpts)
+			cm.l.swapper.Start()
+		}
+		if cm.l.merger = createMerger(cm.l.k, cm.l.root.conf); cm.l.merger != nil {
+			cm.l.merger.Start()
+		}
+	}
+	return err
 }
 
 // PortForwardOpts contains options for port forwarding to a port in a
@@ -424,11 +576,16 @@ func (cm *containerManager) PortForward(opts *PortForwardOpts, _ *struct{}) erro
 // RestoreOpts contains options related to restoring a container's file system.
 type RestoreOpts struct {
 	// FilePayload contains the state file to be restored, followed by the
-	// platform device file if necessary.
+	// chunk store's index and pack files if ChunkStore is set, followed by
+	// the platform device file if necessary.
 	urpc.FilePayload
 
 	// SandboxID contains the ID of the sandbox.
 	SandboxID string
+
+	// ChunkStore indicates that memory contents are loaded from a chunk
+	// store. See chunkstore.Store.
+	ChunkStore bool
 }
 
 // Restore loads a container from a statefile.
@@ -438,19 +595,32 @@ type RestoreOpts struct {
 func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Restore")
 
+	files := o.Files
+	var store *chunkstore.Store
+	if o.ChunkStore {
+		if len(files) < 3 {
+			return fmt.Errorf("the state file and chunk store index and pack files must be passed to Restore")
+		}
+		var err error
+		if store, err = chunkstore.Open(files[1], files[2]); err != nil {
+			return fmt.Errorf("opening chunk store: %w", err)
+		}
+		files = append([]*os.File{files[0]}, files[3:]...)
+	}
+
 	var specFile, deviceFile *os.File
-	switch numFiles := len(o.Files); numFiles {
+	switch numFiles := len(files); numFiles {
 	case 2:
 		// The device file is donated to the platform.
 		// Can't take ownership away from os.File. dup them to get a new FD.
-		fd, err := unix.Dup(int(o.Files[1].Fd()))
+		fd, err := unix.Dup(int(files[1].Fd()))
 		if err != nil {
 			return fmt.Errorf("failed to dup file: %v", err)
 		}
 		deviceFile = os.NewFile(uintptr(fd), "platform device")
 		fallthrough
 	case 1:
-		specFile = o.Files[0]
+		specFile = files[0]
 	case 0:
 		return fmt.Errorf("at least one file must be passed to Restore")
 	default:
@@ -464,10 +634,11 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	if err != nil {
 		return fmt.Errorf("creating platform: %v", err)
 	}
+	p.SetCPULimit(runtime.GOMAXPROCS(0))
 	k := &kernel.Kernel{
 		Platform: p,
 	}
-	mf, err := createMemoryFile()
+	mf, err := createMemoryFile(cm.l.root.conf)
 	if err != nil {
 		return fmt.Errorf("creating memory file: %v", err)
 	}
@@ -492,7 +663,9 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	if err != nil {
 		return err
 	}
-	if info.Size() == 0 {
+	// The state may also be streamed through a pipe or socket, e.g. during
+	// migration, whose size is unknown.
+	if info.Mode().IsRegular() && info.Size() == 0 {
 		return fmt.Errorf("file cannot be empty")
 	}
 
@@ -508,16 +681,25 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	}
 
 	// Load the state.
-	loadOpts := state.LoadOpts{Source: specFile}
+	loadOpts := state.LoadOpts{Source: specFile, ChunkStore: store}
 	if err := loadOpts.Load(ctx, k, nil, networkStack, time.NewCalibratedClocks(), &vfs.CompleteRestoreOptions{}); err != nil {
 		return err
 	}
+	if eps, ok := networkStack.(*netstack.Stack); ok && cm.l.root.conf.NetSaveConnections {
+		announceLinkAddresses(eps.Stack)
+	}
 
 	// Since we have a new kernel we also must make a new watchdog.
 	dogOpts := watchdog.DefaultOpts
 	dogOpts.TaskTimeoutAction = cm.l.root.conf.WatchdogAction
 	dog := watchdog.New(k, dogOpts)
 
+	// The swapper and merger must also operate on the new kernel.
+	if cm.l.swapperOpts != nil {
+		cm.l.swapper = swapper.New(k, *cm.l.swapperOpts)
+	}
+	cm.l.merger = createMerger(k, cm.l.root.conf)
+
 	// Change the loader fields to reflect the changes made when restoring.
 	cm.l.k = k
 	cm.l.watchdog = dog
@@ -545,6 +727,34 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	return nil
 }
 
+// SetCPULimit changes the number of CPUs used to run application code in the
+// sandbox. The number of CPUs visible to applications is unchanged.
+func (cm *containerManager) SetCPULimit(cpus *int, _ *struct{}) error {
+	log.Debugf("containerManager.SetCPULimit, cpus: %d", *cpus)
+	if *cpus <= 0 {
+		return fmt.Errorf("invalid CPU limit %d", *cpus)
+	}
+	runtime.GOMAXPROCS(*cpus)
+	cm.l.k.Platform.SetCPULimit(*cpus)
+	return nil
+}
+
+// UpdateResourcesArgs are arguments to the UpdateResources method.
+type UpdateResourcesArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Resources are the new resource limits. Unset limits are unchanged.
+	Resources *specs.LinuxResources
+}
+
+// UpdateResources applies new resource limits to the cgroups of a container
+// in the sandbox.
+func (cm *containerManager) UpdateResources(args *UpdateResourcesArgs, _ *struct{}) error {
+	log.Debugf("containerManager.UpdateResources, cid: %s", args.CID)
+	return cm.l.updateContainerResources(args.CID, args.Resources)
+}
+
 // Wait waits for the init process in the given container.
 func (cm *containerManager) Wait(cid *string, waitStatus *uint32) error {
 	log.Debugf("containerManager.Wait, cid: %s", *cid)
@@ -702,6 +912,18 @@ type MountArgs struct {
 
 const initTID kernel.ThreadID = 1
 
+// MountInfo returns the mount table of the container's init process, in the
+// format of /proc/[pid]/mountinfo.
+func (cm *containerManager) MountInfo(cid *string, out *string) error {
+	log.Debugf("containerManager.MountInfo, cid: %s", *cid)
+	info, err := cm.l.mountInfo(*cid)
+	if err != nil {
+		return err
+	}
+	*out = info
+	return nil
+}
+
 // Mount mounts a filesystem in a container.
 func (cm *containerManager) Mount(args *MountArgs, _ *struct{}) error {
 	log.Debugf("containerManager.Mount, cid: %s, args: %+v", args.ContainerID, args)
@@ -773,3 +995,25 @@ func (cm *containerManager) Mount(args *MountArgs, _ *struct{}) error {
 	cu.Release()
 	return nil
 }
+
+// SyscallOverridesArgs contains arguments to the SetSyscallOverrides method.
+type SyscallOverridesArgs struct {
+	// ContainerID is the container whose syscalls are overridden.
+	ContainerID string
+
+	// Overrides is a comma-separated list of syscall overrides, in the format
+	// of the --syscall-overrides flag.
+	Overrides string
+}
+
+// SetSyscallOverrides installs or removes syscall overrides in a container.
+func (cm *containerManager) SetSyscallOverrides(args *SyscallOverridesArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetSyscallOverrides, cid: %s, overrides: %q", args.ContainerID, args.Overrides)
+
+	cm.l.mu.Lock()
+	defer cm.l.mu.Unlock()
+	if _, ok := cm.l.processes[execID{cid: args.ContainerID}]; !ok {
+		return fmt.Errorf("container %v is deleted", args.ContainerID)
+	}
+	return setSyscallOverrides(args.ContainerID, args.Overrides)
+}
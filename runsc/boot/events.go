@@ -43,6 +43,15 @@ type Stats struct {
 	CPU    CPU    `json:"cpu"`
 	Memory Memory `json:"memory"`
 	Pids   Pids   `json:"pids"`
+	GPU    *GPU   `json:"gpu,omitempty"`
+}
+
+// GPU contains stats on GPU memory allocated through nvproxy. These are
+// reported for the whole sandbox, not per container.
+type GPU struct {
+	Usage   uint64            `json:"usage"`
+	Devices map[uint32]uint64 `json:"devices,omitempty"`
+	Clients map[uint32]uint64 `json:"clients,omitempty"`
 }
 
 // Pids contains stats on processes.
@@ -71,7 +80,16 @@ type Memory struct {
 
 // CPU contains stats on the CPU.
 type CPU struct {
-	Usage CPUUsage `json:"usage"`
+	Usage      CPUUsage      `json:"usage"`
+	Throttling CPUThrottling `json:"throttling,omitempty"`
+}
+
+// CPUThrottling contains stats on CPU throttling by the sentry, for
+// containers with a CPU quota.
+type CPUThrottling struct {
+	Periods          uint64 `json:"periods,omitempty"`
+	ThrottledPeriods uint64 `json:"throttled_periods,omitempty"`
+	ThrottledTime    uint64 `json:"throttled_time,omitempty"`
 }
 
 // CPUUsage contains stats on CPU usage.
@@ -101,32 +119,75 @@ func (cm *containerManager) Event(cid *string, out *EventOut) error {
 	// Memory usage.
 	mem := cm.l.k.MemoryFile()
 	_ = mem.UpdateUsage(0) // best effort to update.
-	_, totalUsage := usage.MemoryAccounting.Copy()
-	switch containers := cm.l.containerCount(); containers {
-	case 0:
-		return errors.New("no container was found")
-
-	case 1:
-		// There is a single container, so total usage can only come from it.
-
-	default:
-		// In the multi-container case, reports 0 for the root (pause) container,
-		// since it's small and idle. Then equally split the usage to the other
-		// containers. At least the sum of all containers will correctly account
-		// for the memory used by the sandbox.
-		//
-		// TODO(gvisor.dev/issue/172): Proper per-container accounting.
-		if *cid == cm.l.sandboxID {
-			totalUsage = 0
-		} else {
-			totalUsage /= uint64(containers - 1)
+	if totalUsage, stats, ok := containerMemoryStats(cm.l.k.SupervisorContext(), cm.l.k, *cid, cm.l.containerCgroupPath(*cid)); ok {
+		// The container has its own memory cgroup, which accounts for the
+		// memory charged to it.
+		out.Event.Data.Memory.Usage.Usage = totalUsage
+		out.Event.Data.Memory.Cache = stats["total_cache"]
+		out.Event.Data.Memory.Raw = stats
+	} else {
+		snapshot, totalUsage := usage.MemoryAccounting.Copy()
+		switch containers := cm.l.containerCount(); containers {
+		case 0:
+			return errors.New("no container was found")
+
+		case 1:
+			// There is a single container, so total usage and its breakdown
+			// can only come from it.
+			out.Event.Data.Memory.Cache = snapshot.Cache()
+			out.Event.Data.Memory.Raw = map[string]uint64{
+				"cache":       snapshot.Cache(),
+				"rss":         snapshot.RSS(),
+				"shmem":       snapshot.Tmpfs + snapshot.Shmem,
+				"mapped_file": snapshot.Mapped,
+				"stack":       snapshot.Stack,
+			}
+
+		default:
+			// In the multi-container case without per-container memory
+			// cgroups, reports 0 for the root (pause) container, since it's
+			// small and idle. Then equally split the usage to the other
+			// containers. At least the sum of all containers will correctly
+			// account for the memory used by the sandbox.
+			//
+			// TODO(gvisor.dev/issue/172): Proper per-container accounting.
+			if *cid == cm.l.sandboxID {
+				totalUsage = 0
+			} else {
+				totalUsage /= uint64(containers - 1)
+			}
+		}
+		out.Event.Data.Memory.Usage.Usage = totalUsage
+	}
+	if kills := cm.l.k.ContainerOOMKills(*cid); kills != 0 {
+		if out.Event.Data.Memory.Raw == nil {
+			out.Event.Data.Memory.Raw = make(map[string]uint64)
 		}
+		out.Event.Data.Memory.Raw["oom_kill"] = kills
 	}
 
-	out.Event.Data.Memory.Usage.Usage = totalUsage
+	// GPU memory usage.
+	if usage.GPUMemoryAccounting.Enabled() {
+		gpu := usage.GPUMemoryAccounting.Copy()
+		out.Event.Data.GPU = &GPU{
+			Usage:   gpu.Total,
+			Devices: gpu.Devices,
+			Clients: gpu.Clients,
+		}
+	}
 
 	// CPU usage by container.
 	out.ContainerUsage = control.ContainerUsage(cm.l.k)
 
+	// CPU throttling.
+	if b := cm.l.k.ContainerCPUBandwidth(*cid); b != nil {
+		_, periods, throttled, throttledTime := b.Stats()
+		out.Event.Data.CPU.Throttling = CPUThrottling{
+			Periods:          periods,
+			ThrottledPeriods: throttled,
+			ThrottledTime:    uint64(throttledTime.Nanoseconds()),
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,300 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/fd"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// execSessionBufferSize is the maximum amount of terminal output retained
+// while no client is attached to an exec session. Older output is dropped.
+const execSessionBufferSize = 64 << 10
+
+// execSession is a terminal for an exec'd process that outlives the client
+// that started it. The sandbox holds the master end of the process's pty and
+// buffers its output while no client is attached, so that clients can detach
+// and reattach without losing output or the terminal.
+//
+// Output is never written to the client while holding mu: it's queued in buf
+// and written by a goroutine dedicated to the client, so that a client that
+// stops reading can't stall the process, resizing or attaching. Output that a
+// client doesn't keep up with is dropped like output produced while no client
+// is attached.
+type execSession struct {
+	// master is the master end of the process's pty. It is owned by the
+	// session and closed once the process side of the pty is closed.
+	master *fd.FD
+
+	// signal sends a signal to the foreground process group of the
+	// terminal.
+	signal func(linux.Signal)
+
+	// done is closed once no more output can be read from master.
+	done chan struct{}
+
+	// clients tracks goroutines serving attached clients.
+	clients sync.WaitGroup
+
+	// mu protects the fields below. It also prevents master from being
+	// closed while resize uses it.
+	mu sync.Mutex
+
+	// buf holds output that hasn't been written to a client yet.
+	buf []byte
+
+	// client is the connection to the attached client, or nil if no client
+	// is attached. It is owned by the goroutine that serves it.
+	client *fd.FD
+
+	// wake is signaled when output is added to buf or client is detached. It
+	// is nil if no client is attached.
+	wake chan struct{}
+}
+
+// newExecSession creates a session for the pty master and starts copying the
+// process's output.
+func newExecSession(master *fd.FD, signal func(linux.Signal)) *execSession {
+	s := &execSession{
+		master: master,
+		signal: signal,
+		done:   make(chan struct{}),
+	}
+	go s.copyOutput()
+	return s
+}
+
+// copyOutput copies output from master to buf until the process side of the
+// pty is closed.
+func (s *execSession) copyOutput() {
+	b := make([]byte, 4096)
+	for {
+		n, err := s.master.Read(b)
+		if n > 0 {
+			s.output(b[:n])
+		}
+		if err != nil {
+			// Reading the master returns EIO once all process FDs
+			// referring to the replica are closed.
+			log.Debugf("Exec session terminal closed: %v", err)
+			break
+		}
+	}
+
+	// The attached client, if any, sees EOF once it has received the
+	// remaining output.
+	s.mu.Lock()
+	close(s.done)
+	s.mu.Unlock()
+	s.clients.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.master.Close()
+}
+
+func (s *execSession) output(b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = append(s.buf, b...)
+	if over := len(s.buf) - execSessionBufferSize; over > 0 {
+		s.buf = s.buf[over:]
+	}
+	s.wakeLocked()
+}
+
+// wakeLocked signals the goroutine writing output to the attached client.
+//
+// Preconditions: s.mu is locked.
+func (s *execSession) wakeLocked() {
+	if s.wake == nil {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// detach detaches client if it's still attached.
+func (s *execSession) detach(client *fd.FD) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == client {
+		s.wakeLocked()
+		s.client = nil
+		s.wake = nil
+	}
+}
+
+// attach attaches client to the session. Output buffered since the last
+// client detached is written to client first. The session takes ownership of
+// client; it is detached when it reaches EOF.
+func (s *execSession) attach(client *fd.FD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		client.Close()
+		return fmt.Errorf("exec session already has a client attached")
+	}
+	select {
+	case <-s.done:
+		// The process is gone, there is nothing more to attach to. Hand
+		// over the remaining output.
+		b := s.buf
+		s.buf = nil
+		go func() {
+			if _, err := client.Write(b); err != nil {
+				log.Debugf("Exec session client write failed: %v", err)
+			}
+			client.Close()
+		}()
+		return nil
+	default:
+	}
+	s.client = client
+	s.wake = make(chan struct{}, 1)
+	s.clients.Add(1)
+	go s.serve(client, s.wake)
+	return nil
+}
+
+// serve copies input from client to master, and output from buf to client,
+// until client detaches or the process side of the pty is closed.
+func (s *execSession) serve(client *fd.FD, wake chan struct{}) {
+	defer s.clients.Done()
+	var output sync.WaitGroup
+	output.Add(1)
+	go func() {
+		defer output.Done()
+		s.copyOutputTo(client, wake)
+	}()
+
+	s.copyInput(client)
+	s.detach(client)
+	// Interrupt any write to client in progress.
+	_ = unix.Shutdown(client.FD(), unix.SHUT_RDWR)
+	output.Wait()
+	client.Close()
+}
+
+// copyInput copies input from client to master until client reaches EOF.
+func (s *execSession) copyInput(client *fd.FD) {
+	b := make([]byte, 4096)
+	for {
+		n, err := client.Read(b)
+		if n > 0 {
+			s.signalForInput(b[:n])
+			if _, err := s.master.Write(b[:n]); err != nil {
+				log.Debugf("Exec session terminal write failed: %v", err)
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// copyOutputTo writes output from buf to client while it's attached. Once the
+// process side of the pty is closed and all output is written, it shuts
+// client down so that the client sees EOF.
+func (s *execSession) copyOutputTo(client *fd.FD, wake <-chan struct{}) {
+	for {
+		s.mu.Lock()
+		if s.client != client {
+			s.mu.Unlock()
+			return
+		}
+		b := s.buf
+		s.buf = nil
+		s.mu.Unlock()
+
+		if len(b) == 0 {
+			select {
+			case <-wake:
+				continue
+			case <-s.done:
+			}
+			// Output may have been added before done was closed.
+			s.mu.Lock()
+			empty := len(s.buf) == 0
+			s.mu.Unlock()
+			if !empty {
+				continue
+			}
+			_ = unix.Shutdown(client.FD(), unix.SHUT_RDWR)
+			return
+		}
+
+		if n, err := client.Write(b); err != nil {
+			// The client went away without detaching. Keep the output
+			// for the next one.
+			log.Debugf("Exec session client write failed, detaching: %v", err)
+			s.mu.Lock()
+			s.buf = append(b[n:], s.buf...)
+			if over := len(s.buf) - execSessionBufferSize; over > 0 {
+				s.buf = s.buf[over:]
+			}
+			s.mu.Unlock()
+			s.detach(client)
+			_ = unix.Shutdown(client.FD(), unix.SHUT_RDWR)
+			return
+		}
+	}
+}
+
+// signalForInput sends the signals generated by special characters in
+// input, if the terminal has ISIG set.
+//
+// The host generates these signals for the host foreground process group of
+// the pty, which does not exist: the sandboxed processes are only in the
+// foreground inside the sandbox.
+func (s *execSession) signalForInput(input []byte) {
+	// TCGETS on a pty master returns the replica's termios.
+	termios, err := unix.IoctlGetTermios(s.master.FD(), unix.TCGETS)
+	if err != nil || termios.Lflag&unix.ISIG == 0 {
+		return
+	}
+	for _, c := range input {
+		switch c {
+		case 0:
+			// _POSIX_VDISABLE.
+		case termios.Cc[unix.VINTR]:
+			s.signal(linux.SIGINT)
+		case termios.Cc[unix.VQUIT]:
+			s.signal(linux.SIGQUIT)
+		case termios.Cc[unix.VSUSP]:
+			s.signal(linux.SIGTSTP)
+		}
+	}
+}
+
+// resize sets the window size of the terminal.
+func (s *execSession) resize(rows, cols uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return fmt.Errorf("exec session terminal is closed")
+	default:
+	}
+	return unix.IoctlSetWinsize(s.master.FD(), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/fd"
+)
+
+// socketPair returns a connected pair of stream sockets.
+func socketPair(t *testing.T) (*fd.FD, *fd.FD) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("socketpair: %v", err)
+	}
+	return fd.New(fds[0]), fd.New(fds[1])
+}
+
+// newTestExecSession returns an exec session whose pty master is a socket,
+// and the other end of the socket, which stands in for the process side of
+// the pty.
+func newTestExecSession(t *testing.T) (*execSession, *fd.FD) {
+	t.Helper()
+	master, replica := socketPair(t)
+	s := newExecSession(master, func(linux.Signal) {})
+	t.Cleanup(func() { replica.Close() })
+	return s, replica
+}
+
+// readN reads exactly n bytes from f, or fails the test after a timeout.
+func readN(t *testing.T, f *fd.FD, n int) []byte {
+	t.Helper()
+	got := make(chan []byte, 1)
+	go func() {
+		b := make([]byte, n)
+		m, _ := io.ReadFull(f, b)
+		got <- b[:m]
+	}()
+	select {
+	case b := <-got:
+		return b
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out reading %d bytes", n)
+		return nil
+	}
+}
+
+func TestExecSessionBuffersOutput(t *testing.T) {
+	s, replica := newTestExecSession(t)
+	if _, err := replica.Write([]byte("before attach")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// Wait for the output to be buffered.
+	for {
+		s.mu.Lock()
+		n := len(s.buf)
+		s.mu.Unlock()
+		if n == len("before attach") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client, peer := socketPair(t)
+	defer peer.Close()
+	if err := s.attach(client); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if got, want := string(readN(t, peer, len("before attach"))), "before attach"; got != want {
+		t.Errorf("got buffered output %q, want %q", got, want)
+	}
+	if _, err := replica.Write([]byte("after attach")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got, want := string(readN(t, peer, len("after attach"))), "after attach"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+
+	// Input goes to the process.
+	if _, err := peer.Write([]byte("input")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got, want := string(readN(t, replica, len("input"))), "input"; got != want {
+		t.Errorf("got input %q, want %q", got, want)
+	}
+
+	// A second client can't attach.
+	other, otherPeer := socketPair(t)
+	defer otherPeer.Close()
+	if err := s.attach(other); err == nil {
+		t.Errorf("second attach succeeded, want error")
+	}
+
+	// Once the process side is closed, the client sees EOF.
+	replica.Close()
+	if n, err := peer.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read after process exit = (%d, %v), want EOF", n, err)
+	}
+}
+
+func TestExecSessionStalledClient(t *testing.T) {
+	s, replica := newTestExecSession(t)
+
+	// Attach a client that never reads its output.
+	client, peer := socketPair(t)
+	defer peer.Close()
+	if err := unix.SetsockoptInt(client.FD(), unix.SOL_SOCKET, unix.SO_SNDBUF, 4096); err != nil {
+		t.Fatalf("setsockopt: %v", err)
+	}
+	if err := s.attach(client); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+
+	// The process isn't blocked by the client.
+	wrote := make(chan error, 1)
+	go func() {
+		_, err := replica.Write(bytes.Repeat([]byte("x"), 16*execSessionBufferSize))
+		wrote <- err
+	}()
+	select {
+	case err := <-wrote:
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("process output blocked by stalled client")
+	}
+
+	// Nor is resizing the terminal. The master isn't a terminal here, so
+	// resizing fails, but it must not block.
+	resized := make(chan struct{})
+	go func() {
+		_ = s.resize(24, 80)
+		close(resized)
+	}()
+	select {
+	case <-resized:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("resize blocked by stalled client")
+	}
+
+	// Once the client detaches, the next one gets the most recent output.
+	peer.Close()
+	for {
+		s.mu.Lock()
+		detached := s.client == nil
+		s.mu.Unlock()
+		if detached {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	next, nextPeer := socketPair(t)
+	defer nextPeer.Close()
+	if err := s.attach(next); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if _, err := replica.Write([]byte("end")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	replica.Close()
+	out, err := io.ReadAll(nextPeer)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(out) > 2*execSessionBufferSize {
+		t.Errorf("got %d bytes of output, want at most %d", len(out), 2*execSessionBufferSize)
+	}
+	if !bytes.HasSuffix(out, []byte("end")) {
+		t.Errorf("output doesn't end with the latest output")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// instructionSize is the size of an encoded BPF instruction.
+var instructionSize = binary.Size(bpf.Instruction{})
+
+// DirProgramCache is a seccomp.ProgramCache that stores each program in a
+// file of a host directory, named after the program's key. The directory is
+// accessed through a file descriptor, so that it can be used after the
+// sandbox process has been chrooted.
+type DirProgramCache struct {
+	// dirFD is the file descriptor of the directory. It is owned by the
+	// caller of NewDirProgramCache.
+	dirFD int
+}
+
+// NewDirProgramCache returns a cache that stores programs in the directory
+// with the given file descriptor.
+func NewDirProgramCache(dirFD int) *DirProgramCache {
+	return &DirProgramCache{dirFD: dirFD}
+}
+
+// Load implements seccomp.ProgramCache.Load.
+func (c *DirProgramCache) Load(key string) ([]bpf.Instruction, bool) {
+	fd, err := unix.Openat(c.dirFD, key, unix.O_RDONLY|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		if !errors.Is(err, unix.ENOENT) {
+			log.Warningf("Opening cached seccomp program %s: %v", key, err)
+		}
+		return nil, false
+	}
+	f := os.NewFile(uintptr(fd), key)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		log.Warningf("Reading cached seccomp program %s: %v", key, err)
+		return nil, false
+	}
+	if len(data) == 0 || len(data)%instructionSize != 0 {
+		log.Warningf("Cached seccomp program %s has invalid size %d", key, len(data))
+		return nil, false
+	}
+	instrs := make([]bpf.Instruction, len(data)/instructionSize)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, instrs); err != nil {
+		log.Warningf("Decoding cached seccomp program %s: %v", key, err)
+		return nil, false
+	}
+	return instrs, true
+}
+
+// Store implements seccomp.ProgramCache.Store.
+//
+// The program is written to a temporary file that is then renamed, so that
+// concurrent sandboxes never load a partially written program.
+func (c *DirProgramCache) Store(key string, program []bpf.Instruction) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, program); err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.tmp.%d", key, os.Getpid())
+	fd, err := unix.Openat(c.dirFD, tmp, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0600)
+	if err != nil {
+		return fmt.Errorf("creating %q: %w", tmp, err)
+	}
+	f := os.NewFile(uintptr(fd), tmp)
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = unix.Renameat(c.dirFD, tmp, c.dirFD, key)
+	}
+	if err != nil {
+		_ = unix.Unlinkat(c.dirFD, tmp, 0)
+		return fmt.Errorf("writing %q: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+func TestDirProgramCache(t *testing.T) {
+	dir := t.TempDir()
+	dirFD, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY, 0)
+	if err != nil {
+		t.Fatalf("opening %q: %v", dir, err)
+	}
+	defer unix.Close(dirFD)
+	cache := NewDirProgramCache(dirFD)
+
+	rules := seccomp.SyscallRules{
+		unix.SYS_GETPID: seccomp.MatchAll{},
+	}
+	key := seccomp.ProgramKey(rules, seccomp.NewSyscallRules(), linux.SECCOMP_RET_KILL_PROCESS)
+	if other := seccomp.ProgramKey(seccomp.NewSyscallRules(), rules, linux.SECCOMP_RET_KILL_PROCESS); other == key {
+		t.Errorf("allowed and denied rules have the same program key %q", key)
+	}
+	if _, ok := cache.Load(key); ok {
+		t.Fatalf("Load(%q) found a program in an empty cache", key)
+	}
+
+	program := []bpf.Instruction{
+		bpf.Stmt(bpf.Ld|bpf.Abs|bpf.W, 0),
+		bpf.Jump(bpf.Jmp|bpf.Jeq|bpf.K, unix.SYS_GETPID, 0, 1),
+		bpf.Stmt(bpf.Ret|bpf.K, uint32(linux.SECCOMP_RET_ALLOW)),
+		bpf.Stmt(bpf.Ret|bpf.K, uint32(linux.SECCOMP_RET_KILL_PROCESS)),
+	}
+	if err := cache.Store(key, program); err != nil {
+		t.Fatalf("Store(%q): %v", key, err)
+	}
+	got, ok := cache.Load(key)
+	if !ok {
+		t.Fatalf("Load(%q) didn't find the stored program", key)
+	}
+	if !reflect.DeepEqual(got, program) {
+		t.Errorf("Load(%q) = %v, want %v", key, got, program)
+	}
+
+	// Storing doesn't leave temporary files behind.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading %q: %v", dir, err)
+	}
+	if len(entries) != 1 || entries[0].Name() != key {
+		t.Errorf("cache directory has entries %v, want only %q", entries, key)
+	}
+
+	// Truncated programs are ignored.
+	if err := os.WriteFile(filepath.Join(dir, key), []byte{1, 2, 3}, 0600); err != nil {
+		t.Fatalf("truncating cached program: %v", err)
+	}
+	if _, ok := cache.Load(key); ok {
+		t.Errorf("Load(%q) returned a truncated program", key)
+	}
+}
@@ -278,13 +278,22 @@ var allowedSyscalls = seccomp.SyscallRules{
 		// Used by unet to shutdown connections.
 		seccomp.PerArg{seccomp.AnyValue{}, seccomp.EqualTo(unix.SHUT_RDWR)},
 	},
-	unix.SYS_SIGALTSTACK:     seccomp.MatchAll{},
+	unix.SYS_SIGALTSTACK: seccomp.MatchAll{},
+	// Used by hostfd.Splice to splice between host file descriptors.
+	unix.SYS_SPLICE: seccomp.PerArg{
+		seccomp.AnyValue{},                      /* fd_in */
+		seccomp.EqualTo(0),                      /* off_in */
+		seccomp.AnyValue{},                      /* fd_out */
+		seccomp.EqualTo(0),                      /* off_out */
+		seccomp.AnyValue{},                      /* len */
+		seccomp.EqualTo(unix.SPLICE_F_NONBLOCK), /* flags */
+	},
 	unix.SYS_STATX:           seccomp.MatchAll{},
 	unix.SYS_SYNC_FILE_RANGE: seccomp.MatchAll{},
 	unix.SYS_TEE: seccomp.PerArg{
 		seccomp.AnyValue{},
 		seccomp.AnyValue{},
-		seccomp.EqualTo(1),                      /* len */
+		seccomp.AnyValue{},                      /* len */
 		seccomp.EqualTo(unix.SPLICE_F_NONBLOCK), /* flags */
 	},
 	unix.SYS_TIMER_CREATE: seccomp.PerArg{
@@ -415,6 +424,35 @@ func hostFilesystemFilters() seccomp.SyscallRules {
 			validFDCheck,
 			seccomp.AnyValue{},
 		},
+		unix.SYS_RENAMEAT2: seccomp.PerArg{
+			validFDCheck,
+			seccomp.AnyValue{},
+			validFDCheck,
+			seccomp.AnyValue{},
+			seccomp.EqualTo(linux.RENAME_NOREPLACE),
+		},
+		unix.SYS_FGETXATTR: seccomp.PerArg{
+			validFDCheck,
+			seccomp.AnyValue{},
+			seccomp.AnyValue{},
+			seccomp.AnyValue{},
+		},
+		unix.SYS_FSETXATTR: seccomp.PerArg{
+			validFDCheck,
+			seccomp.AnyValue{},
+			seccomp.AnyValue{},
+			seccomp.AnyValue{},
+			seccomp.AnyValue{},
+		},
+		unix.SYS_FLISTXATTR: seccomp.PerArg{
+			validFDCheck,
+			seccomp.AnyValue{},
+			seccomp.AnyValue{},
+		},
+		unix.SYS_FREMOVEXATTR: seccomp.PerArg{
+			validFDCheck,
+			seccomp.AnyValue{},
+		},
 		archFstatAtSysNo(): seccomp.PerArg{
 			validFDCheck,
 			seccomp.AnyValue{},
@@ -22,7 +22,7 @@ import (
 )
 
 // hostInetFilters contains syscalls that are needed by sentry/socket/hostinet.
-func hostInetFilters(allowRawSockets bool) seccomp.SyscallRules {
+func hostInetFilters(allowRawSockets, allowKTLS bool) seccomp.SyscallRules {
 	rules := seccomp.SyscallRules{
 		unix.SYS_ACCEPT4: seccomp.PerArg{
 			seccomp.AnyValue{},
@@ -80,8 +80,17 @@ func hostInetFilters(allowRawSockets bool) seccomp.SyscallRules {
 		unix.SYS_READV:    seccomp.MatchAll{},
 		unix.SYS_RECVFROM: seccomp.MatchAll{},
 		unix.SYS_RECVMSG:  seccomp.MatchAll{},
-		unix.SYS_SENDMSG:  seccomp.MatchAll{},
-		unix.SYS_SENDTO:   seccomp.MatchAll{},
+		// Used by hostfd.Sendfile to send file contents to host sockets. An
+		// offset is always passed, so that the file offset of the host file
+		// descriptor is neither used nor changed.
+		unix.SYS_SENDFILE: seccomp.PerArg{
+			seccomp.AnyValue{},  /* out_fd */
+			seccomp.AnyValue{},  /* in_fd */
+			seccomp.NotEqual(0), /* offset */
+			seccomp.AnyValue{},  /* count */
+		},
+		unix.SYS_SENDMSG: seccomp.MatchAll{},
+		unix.SYS_SENDTO:  seccomp.MatchAll{},
 		unix.SYS_SHUTDOWN: seccomp.Or{
 			seccomp.PerArg{
 				seccomp.AnyValue{},
@@ -143,7 +152,11 @@ func hostInetFilters(allowRawSockets bool) seccomp.SyscallRules {
 
 	// Generate rules for socket options based on hostinet's supported
 	// socket options.
-	for _, opt := range hostinet.SockOpts {
+	sockOpts := hostinet.SockOpts
+	if allowKTLS {
+		sockOpts = append(append([]hostinet.SockOpt(nil), sockOpts...), hostinet.KTLSSockOpts...)
+	}
+	for _, opt := range sockOpts {
 		if opt.AllowGet {
 			rules.AddRule(unix.SYS_GETSOCKOPT, seccomp.PerArg{
 				seccomp.AnyValue{},
@@ -21,8 +21,17 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/seccomp"
 	"gvisor.dev/gvisor/pkg/sentry/devices/accel"
+	"gvisor.dev/gvisor/pkg/sentry/devices/amdproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/hostdev"
+	"gvisor.dev/gvisor/pkg/sentry/devices/kvmdev"
 	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/rdmaproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/tpmdev"
+	"gvisor.dev/gvisor/pkg/sentry/devices/vfiodev"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/secretmem"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/cpuwatcher"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/vhostuser"
 )
 
 // Options are seccomp filter related options.
@@ -30,21 +39,42 @@ type Options struct {
 	Platform              platform.Platform
 	HostNetwork           bool
 	HostNetworkRawSockets bool
+	HostNetworkKTLS       bool
 	HostFilesystem        bool
 	ProfileEnable         bool
 	NVProxy               bool
 	TPUProxy              bool
+	AMDProxy              bool
+	HostDevices           []hostdev.Spec
+	TPMProxy              bool
+	NestedKVM             bool
+	VFIO                  bool
+	RDMAProxy             bool
+	MemfdSecret           bool
+	CPUHotplug            bool
+	Virtiofs              bool
 	ControllerFD          int
+
+	// DenyRules are additional syscalls that the sentry may not make, from
+	// the syscall filter profile. They take precedence over all other rules.
+	DenyRules seccomp.SyscallRules
+
+	// ProgramCache caches the program built from the rules, or is nil. It
+	// doesn't affect the rules.
+	ProgramCache seccomp.ProgramCache
 }
 
 // Rules returns the seccomp (rules, denyRules) to use for the Sentry.
+//
+// Rules are annotated with the subsystem that requires them, so that
+// violations and program dumps can be attributed to it.
 func Rules(opt Options) (seccomp.SyscallRules, seccomp.SyscallRules) {
-	s := allowedSyscalls
-	s.Merge(controlServerFilters(opt.ControllerFD))
+	s := allowedSyscalls.Annotate("sentry", "core syscalls")
+	s.Merge(controlServerFilters(opt.ControllerFD).Annotate("control", "control server"))
 
 	// Set of additional filters used by -race and -msan. Returns empty
 	// when not enabled.
-	s.Merge(instrumentationFilters())
+	s.Merge(instrumentationFilters().Annotate("instrumentation", "race or memory sanitizer"))
 
 	if opt.HostNetwork {
 		if opt.HostNetworkRawSockets {
@@ -52,34 +82,78 @@ func Rules(opt Options) (seccomp.SyscallRules, seccomp.SyscallRules) {
 		} else {
 			Report("host networking enabled: syscall filters less restrictive!")
 		}
-		s.Merge(hostInetFilters(opt.HostNetworkRawSockets))
+		if opt.HostNetworkKTLS {
+			Report("host kernel TLS enabled: syscall filters less restrictive!")
+		}
+		s.Merge(hostInetFilters(opt.HostNetworkRawSockets, opt.HostNetworkKTLS).Annotate("hostinet", "host networking"))
 	}
 	if opt.ProfileEnable {
 		Report("profile enabled: syscall filters less restrictive!")
-		s.Merge(profileFilters())
+		s.Merge(profileFilters().Annotate("profile", "profiling"))
 	}
 	if opt.HostFilesystem {
 		Report("host filesystem enabled: syscall filters less restrictive!")
-		s.Merge(hostFilesystemFilters())
+		s.Merge(hostFilesystemFilters().Annotate("hostfs", "direct host filesystem access"))
 	}
 	if opt.NVProxy {
 		Report("Nvidia GPU driver proxy enabled: syscall filters less restrictive!")
-		s.Merge(nvproxy.Filters())
+		s.Merge(nvproxy.Filters().Annotate("nvproxy", "Nvidia GPU driver proxy"))
 	}
 	if opt.TPUProxy {
 		Report("TPU device proxy enabled: syscall filters less restrictive!")
-		s.Merge(accel.Filters())
+		s.Merge(accel.Filters().Annotate("tpuproxy", "TPU device proxy"))
+	}
+	if opt.AMDProxy {
+		Report("AMD GPU driver proxy enabled: syscall filters less restrictive!")
+		s.Merge(amdproxy.Filters().Annotate("amdproxy", "AMD GPU driver proxy"))
+	}
+	if len(opt.HostDevices) > 0 {
+		Report("host device passthrough enabled: syscall filters less restrictive!")
+		s.Merge(hostdev.Filters(opt.HostDevices).Annotate("hostdev", "host device passthrough"))
+	}
+	if opt.TPMProxy {
+		Report("host TPM proxy enabled: syscall filters less restrictive!")
+		s.Merge(tpmdev.Filters().Annotate("tpmdev", "host TPM proxy"))
+	}
+	if opt.NestedKVM {
+		Report("KVM passthrough enabled: syscall filters less restrictive!")
+		s.Merge(kvmdev.Filters().Annotate("kvmdev", "KVM passthrough"))
+	}
+	if opt.VFIO {
+		Report("VFIO passthrough enabled: syscall filters less restrictive!")
+		s.Merge(vfiodev.Filters().Annotate("vfiodev", "VFIO passthrough"))
+	}
+	if opt.RDMAProxy {
+		Report("RDMA device proxy enabled: syscall filters less restrictive!")
+		s.Merge(rdmaproxy.Filters().Annotate("rdmaproxy", "RDMA device proxy"))
+	}
+	if opt.MemfdSecret {
+		Report("memfd_secret enabled: syscall filters less restrictive!")
+		s.Merge(secretmem.Filters().Annotate("secretmem", "memfd_secret"))
+	}
+	if opt.CPUHotplug {
+		Report("CPU hotplug enabled: syscall filters less restrictive!")
+		s.Merge(cpuwatcher.Filters().Annotate("cpuwatcher", "CPU hotplug"))
+	}
+	if opt.Virtiofs {
+		Report("virtio-fs enabled: syscall filters less restrictive!")
+		s.Merge(vhostuser.Filters().Annotate("vhostuser", "virtio-fs"))
 	}
 
-	s.Merge(opt.Platform.SyscallFilters())
+	s.Merge(opt.Platform.SyscallFilters().Annotate("platform", "platform"))
 
-	return s, seccomp.DenyNewExecMappings
+	denyRules := seccomp.DenyNewExecMappings.Annotate("sentry", "deny new executable mappings")
+	if len(opt.DenyRules) > 0 {
+		Report("syscall filter profile enabled: syscall filters more restrictive")
+		denyRules.Merge(opt.DenyRules.Annotate("filter-profile", "syscall filter profile"))
+	}
+	return s, denyRules
 }
 
 // Install seccomp filters based on the given platform.
 func Install(opt Options) error {
 	rules, denyRules := Rules(opt)
-	return seccomp.Install(rules, denyRules)
+	return seccomp.InstallCached(rules, denyRules, opt.ProgramCache)
 }
 
 // Report writes a warning message to the log.
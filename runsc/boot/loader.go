@@ -16,6 +16,7 @@
 package boot
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	mrand "math/rand"
@@ -38,6 +39,7 @@ import (
 	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/sentry/devices/amdproxy"
 	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
 	"gvisor.dev/gvisor/pkg/sentry/fdimport"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/host"
@@ -46,12 +48,16 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/cpuwatcher"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/merger"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/swapper"
 	"gvisor.dev/gvisor/pkg/sentry/loader"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netfilter"
+	"gvisor.dev/gvisor/pkg/sentry/swap"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
@@ -87,6 +93,7 @@ import (
 	// Include other supported socket providers.
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/route"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/sockdiag"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/uevent"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/unix"
 )
@@ -116,6 +123,14 @@ type containerInfo struct {
 	// tmpfs upper mount in the overlay mounts.
 	overlayFilestoreFDs []*fd.FD
 
+	// virtiofsFDs are the FDs connected to the virtio-fs servers for virtiofs
+	// mounts, in the same order as mounts appear in spec.Mounts.
+	virtiofsFDs []*fd.FD
+
+	// nfsFDs are the FDs connected to the servers of NFS mounts, in the same
+	// order as mounts appear in spec.Mounts.
+	nfsFDs []*fd.FD
+
 	// overlayMediums contains information about how the gofer mounts have been
 	// overlaid. The first entry is for rootfs and the following entries are for
 	// bind mounts in spec.Mounts (in the same order).
@@ -123,6 +138,10 @@ type containerInfo struct {
 
 	// nvidiaUVMDevMajor is the device major number used for nvidia-uvm.
 	nvidiaUVMDevMajor uint32
+
+	// procDriverFiles contains files to create in /proc/driver; see
+	// proc.InternalData.DriverFiles.
+	procDriverFiles map[string]string
 }
 
 // Loader keeps state needed to start the kernel and run the container.
@@ -138,6 +157,21 @@ type Loader struct {
 
 	watchdog *watchdog.Watchdog
 
+	// swapperOpts configures swapper. It is nil if swapping is disabled.
+	swapperOpts *swapper.Opts
+
+	// swapper swaps out application memory. It is nil if swapping is
+	// disabled.
+	swapper *swapper.Swapper
+
+	// merger merges identical pages of application memory. It is nil if page
+	// merging is disabled.
+	merger *merger.Merger
+
+	// cpuWatcher takes application CPUs offline and online as host CPUs
+	// change. It is nil unless --cpu-hotplug is set.
+	cpuWatcher *cpuwatcher.Watcher
+
 	// stopSignalForwarding disables forwarding of signals to the sandboxed
 	// container. It should be called when a sandbox is destroyed.
 	stopSignalForwarding func()
@@ -170,7 +204,20 @@ type Loader struct {
 	// nvidiaUVMDevMajor is the device major number used for nvidia-uvm.
 	nvidiaUVMDevMajor uint32
 
-	// mu guards processes and porForwardProxies.
+	// procDriverFiles contains files to create in /proc/driver; see
+	// proc.InternalData.DriverFiles.
+	procDriverFiles map[string]string
+
+	// filterProfile is the syscall filter profile passed in the
+	// --syscall-filter-profile flag, or nil.
+	filterProfile *seccomp.Profile
+
+	// seccompCacheFD is the file descriptor of the directory where the
+	// sentry's seccomp program is cached, or -1. It's closed once filters are
+	// installed.
+	seccompCacheFD int
+
+	// mu guards processes, pods and porForwardProxies.
 	mu sync.Mutex
 
 	// processes maps containers init process and invocation of exec. Root
@@ -180,6 +227,12 @@ type Loader struct {
 	// processes is guarded by mu.
 	processes map[execID]*execProcess
 
+	// pods maps the IDs of pods that joined the sandbox through a sandbox
+	// group to their namespaces and containers.
+	//
+	// pods is guarded by mu.
+	pods map[string]*podNamespaces
+
 	// portForwardProxies is a list of active port forwarding connections.
 	//
 	// portForwardProxies is guarded by mu.
@@ -207,6 +260,10 @@ type execProcess struct {
 	// TTY file is passed during container create and must be saved until
 	// container start.
 	hostTTY *fd.FD
+
+	// session is the exec session holding the master end of the process's
+	// terminal. It is nil unless one was created with createExecSession.
+	session *execSession
 }
 
 // fdMapping maps guest to host file descriptors. Guest file descriptors are
@@ -257,6 +314,12 @@ type Args struct {
 	// OverlayFilestoreFDs are the FDs to the regular files that will back the
 	// tmpfs upper mount in the overlay mounts.
 	OverlayFilestoreFDs []int
+	// VirtiofsFDs are the FDs connected to the virtio-fs servers for virtiofs
+	// mounts. The Loader takes ownership of these FDs.
+	VirtiofsFDs []int
+	// NFSFDs are the FDs connected to the servers of NFS mounts. The Loader
+	// takes ownership of these FDs.
+	NFSFDs []int
 	// OverlayMediums contains information about how the gofer mounts have been
 	// overlaid. The first entry is for rootfs and the following entries are for
 	// bind mounts in Spec.Mounts (in the same order).
@@ -270,12 +333,27 @@ type Args struct {
 	TotalHostMem uint64
 	// UserLogFD is the file descriptor to write user logs to.
 	UserLogFD int
+	// StraceJSONFD is the file descriptor to write JSON strace records to, or
+	// -1.
+	StraceJSONFD int
+	// SwapFileFD is the file descriptor of the host file used to store
+	// swapped pages, or -1.
+	SwapFileFD int
+	// MemoryPressureFD is the file descriptor of the sandbox cgroup's
+	// memory.pressure file with a pressure trigger set, or -1.
+	MemoryPressureFD int
 	// ProductName is the value to show in
 	// /sys/devices/virtual/dmi/id/product_name.
 	ProductName string
 	// PodInitConfigFD is the file descriptor to a file passed in the
 	//	--pod-init-config flag
 	PodInitConfigFD int
+	// SyscallFilterProfileFD is the file descriptor to the syscall filter
+	// profile passed in the --syscall-filter-profile flag, or -1.
+	SyscallFilterProfileFD int
+	// SeccompCacheFD is the file descriptor of the directory where the
+	// sentry's seccomp program is cached with --seccomp-cache, or -1.
+	SeccompCacheFD int
 	// SinkFDs is an ordered array of file descriptors to be used by seccheck
 	// sinks configured from the --pod-init-config file.
 	SinkFDs []int
@@ -308,6 +386,9 @@ func New(args Args) (*Loader, error) {
 	if args.Conf.NVProxy {
 		nvproxy.Init()
 	}
+	if args.Conf.AMDProxy {
+		amdproxy.Init()
+	}
 
 	kernel.IOUringEnabled = args.Conf.IOUring
 
@@ -345,6 +426,12 @@ func New(args Args) (*Loader, error) {
 	for _, overlayFD := range args.OverlayFilestoreFDs {
 		info.overlayFilestoreFDs = append(info.overlayFilestoreFDs, fd.New(overlayFD))
 	}
+	for _, virtiofsFD := range args.VirtiofsFDs {
+		info.virtiofsFDs = append(info.virtiofsFDs, fd.New(virtiofsFD))
+	}
+	for _, nfsFD := range args.NFSFDs {
+		info.nfsFDs = append(info.nfsFDs, fd.New(nfsFD))
+	}
 
 	if args.ExecFD >= 0 {
 		info.execFD = fd.New(args.ExecFD)
@@ -365,12 +452,18 @@ func New(args Args) (*Loader, error) {
 	if args.Conf.NVProxy && p.OwnsPageTables() {
 		return nil, fmt.Errorf("--nvproxy is incompatible with platform %s: owns page tables", args.Conf.Platform)
 	}
+	if args.Conf.AMDProxy && !p.OwnsPageTables() {
+		// amdkfd only allows /dev/kfd to be mapped by the process that opened
+		// it, so application mappings must be backed by sentry mappings.
+		return nil, fmt.Errorf("--amdproxy is incompatible with platform %s: does not own page tables", args.Conf.Platform)
+	}
 	k := &kernel.Kernel{
-		Platform: p,
+		Platform:    p,
+		MemfdSecret: args.Conf.MemfdSecret,
 	}
 
 	// Create memory file.
-	mf, err := createMemoryFile()
+	mf, err := createMemoryFile(args.Conf)
 	if err != nil {
 		return nil, fmt.Errorf("creating memory file: %w", err)
 	}
@@ -387,10 +480,26 @@ func New(args Args) (*Loader, error) {
 	// Create timekeeper.
 	tk := kernel.NewTimekeeper(k, vdso.ParamPage.FileRange())
 	tk.SetClocks(time.NewCalibratedClocks())
+	// CLOCK_REALTIME follows the host's, so report the host's
+	// synchronization state and TAI offset.
+	var tx unix.Timex
+	if _, err := unix.Adjtimex(&tx); err != nil {
+		log.Warningf("Failed to read host clock synchronization state: %v", err)
+	} else {
+		tk.SetNTPState(kernel.NTPState{
+			TAIOffset: tx.Tai,
+			Status:    tx.Status,
+			MaxError:  tx.Maxerror,
+			EstError:  tx.Esterror,
+		})
+	}
 
-	if err := enableStrace(args.Conf); err != nil {
+	if err := enableStrace(args.Conf, args.StraceJSONFD); err != nil {
 		return nil, fmt.Errorf("enabling strace: %w", err)
 	}
+	if err := setSyscallOverrides("", args.Conf.SyscallOverrides); err != nil {
+		return nil, fmt.Errorf("setting syscall overrides: %w", err)
+	}
 
 	// Create capabilities.
 	caps, err := specutils.Capabilities(args.Conf.EnableRaw, args.Spec.Process.Capabilities)
@@ -423,6 +532,7 @@ func New(args Args) (*Loader, error) {
 	}
 	log.Infof("CPUs: %d", args.NumCPU)
 	runtime.GOMAXPROCS(args.NumCPU)
+	p.SetCPULimit(args.NumCPU)
 
 	if args.TotalHostMem > 0 {
 		// As per tmpfs(5), the default size limit is 50% of total physical RAM.
@@ -430,6 +540,12 @@ func New(args Args) (*Loader, error) {
 		tmpfs.SetDefaultSizeLimit(args.TotalHostMem / 2)
 	}
 
+	host.SetAsyncWriteOptions(host.AsyncWriteOptions{
+		SlowThreshold: args.Conf.HostFDAsyncWriteThreshold,
+		BufferSize:    args.Conf.HostFDAsyncWriteBuffer,
+		Drop:          args.Conf.HostFDAsyncWriteDrop,
+	})
+
 	if args.TotalMem > 0 {
 		// Adjust the total memory returned by the Sentry so that applications that
 		// use /proc/meminfo can make allocations based on this limit.
@@ -438,19 +554,28 @@ func New(args Args) (*Loader, error) {
 		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
 	}
 
+	featureSet, err := createFeatureSet(args.Conf)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initiate the Kernel object, which is required by the Context passed
 	// to createVFS in order to mount (among other things) procfs.
 	if err = k.Init(kernel.InitKernelArgs{
-		FeatureSet:                  cpuid.HostFeatureSet().Fixed(),
-		Timekeeper:                  tk,
-		RootUserNamespace:           creds.UserNamespace,
-		RootNetworkNamespace:        netns,
-		ApplicationCores:            uint(args.NumCPU),
-		Vdso:                        vdso,
-		RootUTSNamespace:            kernel.NewUTSNamespace(args.Spec.Hostname, args.Spec.Hostname, creds.UserNamespace),
-		RootIPCNamespace:            kernel.NewIPCNamespace(creds.UserNamespace),
-		RootAbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
-		PIDNamespace:                kernel.NewRootPIDNamespace(creds.UserNamespace),
+		FeatureSet:           featureSet,
+		Timekeeper:           tk,
+		RootUserNamespace:    creds.UserNamespace,
+		RootNetworkNamespace: netns,
+		ApplicationCores:     uint(args.NumCPU),
+		Vdso:                 vdso,
+		RootUTSNamespace:     kernel.NewUTSNamespace(args.Spec.Hostname, args.Spec.Hostname, creds.UserNamespace),
+		RootIPCNamespace:     kernel.NewIPCNamespace(creds.UserNamespace),
+		PIDNamespace:         kernel.NewRootPIDNamespace(creds.UserNamespace),
+		CPUTopology: kernel.CPUTopology{
+			ThreadsPerCore: args.Conf.CPUThreadsPerCore,
+			CoresPerSocket: args.Conf.CPUCoresPerSocket,
+			NUMANodes:      args.Conf.NUMANodes,
+		},
 	}); err != nil {
 		return nil, fmt.Errorf("initializing kernel: %w", err)
 	}
@@ -473,6 +598,40 @@ func New(args Args) (*Loader, error) {
 	dogOpts.TaskTimeoutAction = args.Conf.WatchdogAction
 	dog := watchdog.New(k, dogOpts)
 
+	swapOpts, err := createSwapperOpts(args.Conf, args.TotalMem, args.SwapFileFD)
+	if err != nil {
+		return nil, fmt.Errorf("creating swap pool: %w", err)
+	}
+	var swp *swapper.Swapper
+	if swapOpts != nil {
+		swp = swapper.New(k, *swapOpts)
+	}
+
+	pageMerger := createMerger(k, args.Conf)
+
+	var cpuWatcher *cpuwatcher.Watcher
+	if args.Conf.CPUHotplug {
+		cpuWatcher = cpuwatcher.New(k, cpuWatcherInterval)
+	}
+
+	if args.Conf.OOMKillThreshold != 0 && args.TotalMem != 0 {
+		limit := args.TotalMem / 100 * uint64(args.Conf.OOMKillThreshold)
+		log.Infof("OOM killer enabled, limit %d bytes", limit)
+		k.SetOOMLimit(limit)
+	}
+
+	if args.Conf.PageCacheHighWatermark != 0 && args.TotalMem != 0 {
+		low := args.TotalMem / 100 * uint64(args.Conf.PageCacheLowWatermark)
+		high := args.TotalMem / 100 * uint64(args.Conf.PageCacheHighWatermark)
+		log.Infof("Page cache reclaim enabled, watermarks %d-%d bytes", low, high)
+		mf.SetCacheReclaimWatermarks(low, high)
+	}
+	if args.MemoryPressureFD >= 0 {
+		if err := mf.NotifyHostMemoryPressure(os.NewFile(uintptr(args.MemoryPressureFD), "memory.pressure")); err != nil {
+			return nil, fmt.Errorf("watching host memory pressure: %w", err)
+		}
+	}
+
 	procArgs, err := createProcessArgs(args.ID, args.Spec, creds, k, k.RootPIDNamespace())
 	if err != nil {
 		return nil, fmt.Errorf("creating init process for root container: %w", err)
@@ -502,17 +661,35 @@ func New(args Args) (*Loader, error) {
 		}
 	}
 
+	var filterProfile *seccomp.Profile
+	if args.SyscallFilterProfileFD >= 0 {
+		profileFile := fd.New(args.SyscallFilterProfileFD)
+		filterProfile, err = seccomp.LoadProfile(profileFile)
+		profileFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("loading syscall filter profile: %w", err)
+		}
+	}
+
 	eid := execID{cid: args.ID}
 	l := &Loader{
 		k:                 k,
 		watchdog:          dog,
+		swapperOpts:       swapOpts,
+		swapper:           swp,
+		merger:            pageMerger,
+		cpuWatcher:        cpuWatcher,
 		sandboxID:         args.ID,
 		processes:         map[execID]*execProcess{eid: {}},
+		pods:              make(map[string]*podNamespaces),
 		mountHints:        mountHints,
 		root:              info,
 		stopProfiling:     stopProfiling,
 		productName:       args.ProductName,
 		nvidiaUVMDevMajor: info.nvidiaUVMDevMajor,
+		procDriverFiles:   info.procDriverFiles,
+		filterProfile:     filterProfile,
+		seccompCacheFD:    args.SeccompCacheFD,
 	}
 
 	// We don't care about child signals; some platforms can generate a
@@ -559,18 +736,17 @@ func createProcessArgs(id string, spec *specs.Spec, creds *auth.Credentials, k *
 
 	// Create the process arguments.
 	procArgs := kernel.CreateProcessArgs{
-		Argv:                    spec.Process.Args,
-		Envv:                    env,
-		WorkingDirectory:        wd,
-		Credentials:             creds,
-		Umask:                   0022,
-		Limits:                  ls,
-		MaxSymlinkTraversals:    linux.MaxSymlinkTraversals,
-		UTSNamespace:            k.RootUTSNamespace(),
-		IPCNamespace:            k.RootIPCNamespace(),
-		AbstractSocketNamespace: k.RootAbstractSocketNamespace(),
-		ContainerID:             id,
-		PIDNamespace:            pidns,
+		Argv:                 spec.Process.Args,
+		Envv:                 env,
+		WorkingDirectory:     wd,
+		Credentials:          creds,
+		Umask:                0022,
+		Limits:               ls,
+		MaxSymlinkTraversals: linux.MaxSymlinkTraversals,
+		UTSNamespace:         k.RootUTSNamespace(),
+		IPCNamespace:         k.RootIPCNamespace(),
+		ContainerID:          id,
+		PIDNamespace:         pidns,
 	}
 
 	return procArgs, nil
@@ -586,6 +762,15 @@ func (l *Loader) Destroy() {
 		l.stopSignalForwarding()
 	}
 	l.watchdog.Stop()
+	if l.swapper != nil {
+		l.swapper.Stop()
+	}
+	if l.merger != nil {
+		l.merger.Stop()
+	}
+	if l.cpuWatcher != nil {
+		l.cpuWatcher.Stop()
+	}
 
 	// Stop the control server. This will indirectly stop any
 	// long-running control operations that are in flight, e.g.
@@ -624,7 +809,30 @@ func createPlatform(conf *config.Config, deviceFile *os.File) (platform.Platform
 	return p.New(deviceFile)
 }
 
-func createMemoryFile() (*pgalloc.MemoryFile, error) {
+// createFeatureSet returns the CPU features exposed to applications, which
+// are the host's features changed according to the CPU feature policy in
+// conf.
+func createFeatureSet(conf *config.Config) (cpuid.FeatureSet, error) {
+	mask, err := cpuid.ParseFeatures(conf.CPUFeaturesMask)
+	if err != nil {
+		return cpuid.FeatureSet{}, fmt.Errorf("invalid --cpu-features-mask: %w", err)
+	}
+	policy := cpuid.Policy{
+		MaskFeatures:   mask,
+		MicroarchLevel: conf.CPUMicroarchLevel,
+		BrandString:    conf.CPUBrand,
+	}
+	fs, err := cpuid.HostFeatureSet().Fixed().ApplyPolicy(policy)
+	if err != nil {
+		return cpuid.FeatureSet{}, fmt.Errorf("applying CPU feature policy: %w", err)
+	}
+	if !policy.IsEmpty() {
+		log.Infof("CPU features after applying policy %+v: %s", policy, fs.FlagString())
+	}
+	return fs, nil
+}
+
+func createMemoryFile(conf *config.Config) (*pgalloc.MemoryFile, error) {
 	const memfileName = "runsc-memory"
 	memfd, err := memutil.CreateMemFD(memfileName, 0)
 	if err != nil {
@@ -634,7 +842,23 @@ func createMemoryFile() (*pgalloc.MemoryFile, error) {
 	// We can't enable pgalloc.MemoryFileOpts.UseHostMemcgPressure even if
 	// there are memory cgroups specified, because at this point we're already
 	// in a mount namespace in which the relevant cgroupfs is not visible.
-	mf, err := pgalloc.NewMemoryFile(memfile, pgalloc.MemoryFileOpts{})
+	opts := pgalloc.MemoryFileOpts{
+		IdleReclaimInterval:      conf.IdleMemoryReclaimInterval,
+		HugepageCollapseInterval: conf.HugepageCollapseInterval,
+	}
+	switch conf.IdleMemoryReclaim {
+	case config.IdleMemoryReclaimCold:
+		opts.IdleReclaim = pgalloc.IdleReclaimCold
+	case config.IdleMemoryReclaimPageOut:
+		opts.IdleReclaim = pgalloc.IdleReclaimPageOut
+	}
+	switch conf.Hugepages {
+	case config.HugepagesAdvise:
+		opts.Hugepages = pgalloc.HugepagesAdvise
+	case config.HugepagesCollapse:
+		opts.Hugepages = pgalloc.HugepagesCollapse
+	}
+	mf, err := pgalloc.NewMemoryFile(memfile, opts)
 	if err != nil {
 		_ = memfile.Close()
 		return nil, fmt.Errorf("error creating pgalloc.MemoryFile: %w", err)
@@ -642,11 +866,67 @@ func createMemoryFile() (*pgalloc.MemoryFile, error) {
 	return mf, nil
 }
 
+// createSwapperOpts returns options for the swapper, or nil if swapping is
+// disabled.
+func createSwapperOpts(conf *config.Config, totalMem uint64, swapFileFD int) (*swapper.Opts, error) {
+	if conf.Swap == config.SwapOff {
+		return nil, nil
+	}
+	if totalMem == 0 {
+		log.Warningf("Swap is disabled because the sandbox has no memory limit")
+		return nil, nil
+	}
+	// Compressed pages are stored in the sentry's memory, which is also
+	// accounted against the sandbox's memory limit; bound it so that swapping
+	// always makes progress towards the limit.
+	poolOpts := swap.PoolOpts{
+		MaxCompressedBytes: totalMem / 4,
+	}
+	if conf.Swap == config.SwapFile {
+		if swapFileFD < 0 {
+			return nil, fmt.Errorf("--swap=file requires a swap file FD")
+		}
+		poolOpts.File = os.NewFile(uintptr(swapFileFD), "swap file")
+		poolOpts.MaxFileBytes = conf.SwapFileSize
+	}
+	limit := totalMem / 100 * uint64(conf.SwapThreshold)
+	log.Infof("Swapping enabled (%s), limit %d bytes", conf.Swap, limit)
+	return &swapper.Opts{
+		Pool:  swap.NewPool(poolOpts),
+		Limit: limit,
+	}, nil
+}
+
+// cpuWatcherInterval is the interval at which host CPUs are checked with
+// --cpu-hotplug.
+const cpuWatcherInterval = gtime.Second
+
+// createMerger returns a page merger for k, or nil if page merging is
+// disabled.
+func createMerger(k *kernel.Kernel, conf *config.Config) *merger.Merger {
+	if conf.PageMerging == config.PageMergingOff {
+		return nil
+	}
+	return merger.New(k, merger.Opts{
+		All:          conf.PageMerging == config.PageMergingAll,
+		Interval:     conf.PageMergingInterval,
+		PagesPerScan: conf.PageMergingPages,
+	})
+}
+
 // installSeccompFilters installs sandbox seccomp filters with the host.
 func (l *Loader) installSeccompFilters() error {
 	if l.PreSeccompCallback != nil {
 		l.PreSeccompCallback()
 	}
+	if l.seccompCacheFD >= 0 {
+		// The cache is only written before filters are installed, so that
+		// the sandbox can't tamper with the programs of other sandboxes.
+		defer func() {
+			_ = unix.Close(l.seccompCacheFD)
+			l.seccompCacheFD = -1
+		}()
+	}
 	if l.root.conf.DisableSeccomp {
 		filter.Report("syscall filter is DISABLED. Running in less secure mode.")
 	} else {
@@ -655,12 +935,31 @@ func (l *Loader) installSeccompFilters() error {
 			Platform:              l.k.Platform,
 			HostNetwork:           hostnet,
 			HostNetworkRawSockets: hostnet && l.root.conf.EnableRaw,
+			HostNetworkKTLS:       hostnet && l.root.conf.HostKTLS,
 			HostFilesystem:        l.root.conf.DirectFS,
 			ProfileEnable:         l.root.conf.ProfileEnable,
 			NVProxy:               l.root.conf.NVProxy,
 			TPUProxy:              l.root.conf.TPUProxy,
+			AMDProxy:              l.root.conf.AMDProxy,
+			HostDevices:           hostDeviceSpecs(l.root.conf),
+			TPMProxy:              l.root.conf.TPM == config.TPMHost,
+			NestedKVM:             l.root.conf.NestedKVM,
+			VFIO:                  len(l.root.conf.VFIOGroups) > 0,
+			RDMAProxy:             l.root.conf.RDMAProxy,
+			MemfdSecret:           l.root.conf.MemfdSecret,
+			CPUHotplug:            l.root.conf.CPUHotplug,
+			Virtiofs:              l.root.conf.Virtiofs,
 			ControllerFD:          l.ctrl.srv.FD(),
 		}
+		if l.filterProfile != nil {
+			var err error
+			if opts.DenyRules, err = l.filterProfile.SentryDenyRules(); err != nil {
+				return fmt.Errorf("building syscall filter profile rules: %w", err)
+			}
+		}
+		if l.seccompCacheFD >= 0 {
+			opts.ProgramCache = filter.NewDirProgramCache(l.seccompCacheFD)
+		}
 		if err := filter.Install(opts); err != nil {
 			return fmt.Errorf("installing seccomp filters: %w", err)
 		}
@@ -689,7 +988,7 @@ func (l *Loader) run() error {
 		// is configured after the loader is created and before Run() is called.
 		log.Debugf("Configuring host network")
 		s := l.k.RootNetworkNamespace().Stack().(*hostinet.Stack)
-		if err := s.Configure(l.root.conf.EnableRaw); err != nil {
+		if err := s.Configure(l.root.conf.EnableRaw, l.root.conf.HostKTLS); err != nil {
 			return err
 		}
 	}
@@ -777,6 +1076,15 @@ func (l *Loader) run() error {
 
 	log.Infof("Process should have started...")
 	l.watchdog.Start()
+	if l.swapper != nil {
+		l.swapper.Start()
+	}
+	if l.merger != nil {
+		l.merger.Start()
+	}
+	if l.cpuWatcher != nil {
+		l.cpuWatcher.Start()
+	}
 	return l.k.Start()
 }
 
@@ -796,7 +1104,7 @@ func (l *Loader) createSubcontainer(cid string, tty *fd.FD) error {
 // startSubcontainer starts a child container. It returns the thread group ID of
 // the newly created process. Used FDs are either closed or released. It's safe
 // for the caller to close any remaining files upon return.
-func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid string, stdioFDs, goferFDs, overlayFilestoreFDs []*fd.FD, overlayMediums []OverlayMedium) error {
+func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid string, stdioFDs, goferFDs, overlayFilestoreFDs, virtiofsFDs, nfsFDs []*fd.FD, overlayMediums []OverlayMedium) error {
 	// Create capabilities.
 	caps, err := specutils.Capabilities(conf.EnableRaw, spec.Process.Capabilities)
 	if err != nil {
@@ -853,13 +1161,23 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 		spec:                spec,
 		goferFDs:            goferFDs,
 		overlayFilestoreFDs: overlayFilestoreFDs,
+		virtiofsFDs:         virtiofsFDs,
+		nfsFDs:              nfsFDs,
 		overlayMediums:      overlayMediums,
 		nvidiaUVMDevMajor:   l.nvidiaUVMDevMajor,
+		procDriverFiles:     l.procDriverFiles,
 	}
 	info.procArgs, err = createProcessArgs(cid, spec, creds, l.k, pidns)
 	if err != nil {
 		return fmt.Errorf("creating new process: %w", err)
 	}
+	pod, err := l.podNamespacesLocked(spec, cid)
+	if err != nil {
+		return err
+	}
+	if pod != nil {
+		pod.apply(l.k.SupervisorContext(), &info.procArgs)
+	}
 
 	// Use stdios or TTY depending on the spec configuration.
 	if spec.Process.Terminal {
@@ -904,6 +1222,19 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 	return nil
 }
 
+// profileSyscallFilters returns the syscall filters that the syscall filter
+// profile installs on all container processes.
+func (l *Loader) profileSyscallFilters() ([]bpf.Program, error) {
+	if l.filterProfile == nil || l.filterProfile.Guest == nil {
+		return nil, nil
+	}
+	program, err := l.filterProfile.GuestProgram()
+	if err != nil {
+		return nil, fmt.Errorf("building syscall filter profile program: %w", err)
+	}
+	return []bpf.Program{program}, nil
+}
+
 func (l *Loader) createContainerProcess(root bool, cid string, info *containerInfo) (*kernel.ThreadGroup, *host.TTYFileDescription, error) {
 	// Create the FD map, which will set stdin, stdout, and stderr.
 	ctx := info.procArgs.NewContext(l.k)
@@ -958,6 +1289,29 @@ func (l *Loader) createContainerProcess(root bool, cid string, info *containerIn
 		return nil, nil, err
 	}
 
+	if info.conf.Cgroupfs {
+		cgs, err := containerCgroups(ctx, l.k, l.containerCgroupPathLocked(cid))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer decRefCgroups(ctx, cgs)
+		if info.spec.Linux != nil {
+			if err := setContainerCgroupLimits(ctx, cgs, info.spec.Linux.Resources); err != nil {
+				return nil, nil, fmt.Errorf("setting cgroup limits for container %q: %w", cid, err)
+			}
+		}
+		info.procArgs.InitialCgroups = initialCgroups(cgs)
+	}
+	if info.spec.Linux != nil {
+		if err := setContainerCPULimits(l.k, info.conf, cid, info.spec.Linux.Resources); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if info.procArgs.SyscallFilters, err = l.profileSyscallFilters(); err != nil {
+		return nil, nil, err
+	}
+
 	// Create and start the new process.
 	tg, _, err := l.k.CreateProcess(info.procArgs)
 	if err != nil {
@@ -1073,6 +1427,15 @@ func (l *Loader) destroySubcontainer(cid string) error {
 			delete(l.processes, key)
 		}
 	}
+	if pod, ok := l.pods[cid]; ok {
+		pod.release(l.k.SupervisorContext())
+		delete(l.pods, cid)
+	}
+	for _, pod := range l.pods {
+		delete(pod.containers, cid)
+	}
+	clearSyscallOverrides(cid)
+	l.k.RemoveContainerCPULimits(cid)
 
 	log.Debugf("Container destroyed, cid: %s", cid)
 	return nil
@@ -1117,11 +1480,48 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 	}
 	args.PIDNamespace = tg.PIDNamespace()
 
+	// Exec'd processes join the namespaces of the container, which differ from
+	// the root namespaces for pods that joined the sandbox.
+	leader := tg.Leader()
+	args.UTSNamespace = leader.GetUTSNamespace()
+	args.IPCNamespace = leader.GetIPCNamespace()
+	args.NetworkNamespace = leader.GetNetworkNamespace()
+	defer func() {
+		if args.UTSNamespace != nil {
+			args.UTSNamespace.DecRef(ctx)
+		}
+		if args.IPCNamespace != nil {
+			args.IPCNamespace.DecRef(ctx)
+		}
+		if args.NetworkNamespace != nil {
+			args.NetworkNamespace.DecRef(ctx)
+		}
+	}()
+	if args.UTSNamespace == nil || args.IPCNamespace == nil || args.NetworkNamespace == nil {
+		return 0, fmt.Errorf("container %q has stopped", args.ContainerID)
+	}
+
 	args.Limits, err = createLimitSet(l.root.spec)
 	if err != nil {
 		return 0, fmt.Errorf("creating limits: %w", err)
 	}
 
+	// Exec'd processes are accounted to the container they run in.
+	if l.root.conf.Cgroupfs {
+		cgs, err := containerCgroups(ctx, l.k, l.containerCgroupPathLocked(args.ContainerID))
+		if err != nil {
+			return 0, err
+		}
+		defer decRefCgroups(ctx, cgs)
+		args.InitialCgroups = initialCgroups(cgs)
+	}
+
+	// Exec'd processes don't descend from the container's init process, so
+	// they don't inherit its syscall filters.
+	if args.SyscallFilters, err = l.profileSyscallFilters(); err != nil {
+		return 0, err
+	}
+
 	// Start the process.
 	proc := control.Proc{Kernel: l.k}
 	newTG, tgid, ttyFile, err := control.ExecAsync(&proc, args)
@@ -1139,6 +1539,40 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 	return tgid, nil
 }
 
+// updateContainerResources applies the limits in res to the cgroups of
+// container cid. Without --cgroupfs, only the CPU quota is applied.
+func (l *Loader) updateContainerResources(cid string, res *specs.LinuxResources) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tg, err := l.tryThreadGroupFromIDLocked(execID{cid: cid})
+	if err != nil {
+		return err
+	}
+	if tg == nil {
+		return fmt.Errorf("container %q not started", cid)
+	}
+
+	if err := setContainerCPULimits(l.k, l.root.conf, cid, res); err != nil {
+		return err
+	}
+	if !l.root.conf.Cgroupfs {
+		if res != nil && (res.Memory != nil || res.Pids != nil) {
+			log.Warningf("Ignoring memory and PID limits of container %q, which require --cgroupfs", cid)
+		}
+		return nil
+	}
+	ctx := l.k.SupervisorContext()
+	cgs, err := containerCgroups(ctx, l.k, l.containerCgroupPathLocked(cid))
+	if err != nil {
+		return err
+	}
+	defer decRefCgroups(ctx, cgs)
+	if err := setContainerCgroupLimits(ctx, cgs, res); err != nil {
+		return fmt.Errorf("setting cgroup limits for container %q: %w", cid, err)
+	}
+	return nil
+}
+
 // waitContainer waits for the init process of a container to exit.
 func (l *Loader) waitContainer(cid string, waitStatus *uint32) error {
 	// Don't defer unlock, as doing so would make it impossible for
@@ -1241,6 +1675,12 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, uniqueID st
 		return inet.NewRootNamespace(hostinet.NewStack(), nil, userns), nil
 
 	case config.NetworkNone, config.NetworkSandbox:
+		if conf.Network == config.NetworkNone && conf.MinimalBoot {
+			// Don't create a network stack at all. Only Unix domain sockets
+			// are available, and new network namespaces don't get a stack
+			// either.
+			return inet.NewRootNamespace(nil, nil, userns), nil
+		}
 		s, err := newEmptySandboxNetworkStack(clock, uniqueID, conf.AllowPacketEndpointWrite)
 		if err != nil {
 			return nil, err
@@ -1448,6 +1888,35 @@ func (l *Loader) signalAllProcesses(cid string, signo int32) error {
 	return l.k.SendContainerSignal(cid, &linux.SignalInfo{Signo: signo})
 }
 
+// mountInfo returns the mount table of the init process of container cid, in
+// the format of /proc/[pid]/mountinfo.
+func (l *Loader) mountInfo(cid string) (string, error) {
+	tg, err := l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		return "", err
+	}
+	t := tg.Leader()
+	if t == nil {
+		return "", fmt.Errorf("container %q has exited", cid)
+	}
+	var fsctx *kernel.FSContext
+	t.WithMuLocked(func(t *kernel.Task) {
+		fsctx = t.FSContext()
+	})
+	if fsctx == nil {
+		return "", fmt.Errorf("container %q has exited", cid)
+	}
+	ctx := l.k.SupervisorContext()
+	root := fsctx.RootDirectory()
+	if !root.Ok() {
+		return "", fmt.Errorf("container %q has exited", cid)
+	}
+	defer root.DecRef(ctx)
+	var buf bytes.Buffer
+	l.k.VFS().GenerateProcMountInfo(ctx, root, &buf)
+	return buf.String(), nil
+}
+
 // threadGroupFromID is similar to tryThreadGroupFromIDLocked except that it
 // acquires mutex before calling it and fails in case container hasn't started
 // yet.
@@ -1476,6 +1945,71 @@ func (l *Loader) tryThreadGroupFromIDLocked(key execID) (*kernel.ThreadGroup, er
 	return ep.tg, nil
 }
 
+// createExecSession makes the terminal of process "tgid" in container "cid"
+// persistent. master is the master end of the pty whose replica is the
+// process's TTY; the session takes ownership of it.
+func (l *Loader) createExecSession(cid string, tgid kernel.ThreadID, master *fd.FD) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ep := l.processes[execID{cid: cid, pid: tgid}]
+	if ep == nil || ep.tg == nil {
+		master.Close()
+		return fmt.Errorf("process %d not found in container %q", tgid, cid)
+	}
+	if ep.tty == nil {
+		master.Close()
+		return fmt.Errorf("process %d is not attached to a terminal", tgid)
+	}
+	if ep.session != nil {
+		master.Close()
+		return fmt.Errorf("process %d already has an exec session", tgid)
+	}
+	ep.session = newExecSession(master, func(sig linux.Signal) {
+		if err := l.signalForegrondProcessGroup(cid, tgid, int32(sig)); err != nil {
+			log.Warningf("Failed to send %v to exec session of PID %d in container %q: %v", sig, tgid, cid, err)
+		}
+	})
+	return nil
+}
+
+// execSessionFromID returns the exec session of process "tgid" in container
+// "cid".
+func (l *Loader) execSessionFromID(cid string, tgid kernel.ThreadID) (*execSession, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ep := l.processes[execID{cid: cid, pid: tgid}]
+	if ep == nil || ep.session == nil {
+		return nil, fmt.Errorf("no exec session for process %d in container %q", tgid, cid)
+	}
+	return ep.session, nil
+}
+
+// attachExecSession attaches client to the exec session of process "tgid" in
+// container "cid". The session takes ownership of client.
+func (l *Loader) attachExecSession(cid string, tgid kernel.ThreadID, client *fd.FD) error {
+	s, err := l.execSessionFromID(cid, tgid)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	return s.attach(client)
+}
+
+// resizeExecSession sets the window size of the exec session's terminal and
+// notifies the foreground process group of the change.
+func (l *Loader) resizeExecSession(cid string, tgid kernel.ThreadID, rows, cols uint16) error {
+	s, err := l.execSessionFromID(cid, tgid)
+	if err != nil {
+		return err
+	}
+	if err := s.resize(rows, cols); err != nil {
+		return fmt.Errorf("setting window size: %w", err)
+	}
+	// The host only signals the pty's host foreground process group, which
+	// does not exist. Deliver SIGWINCH inside the sandbox instead.
+	return l.signalForegrondProcessGroup(cid, tgid, int32(linux.SIGWINCH))
+}
+
 // ttyFromIDLocked returns the TTY files for the given execution ID. It may
 // return nil in case the container has not started yet. Returns error if
 // execution ID is invalid or if the container cannot be found (maybe it has
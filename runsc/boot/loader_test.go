@@ -134,15 +134,18 @@ func createLoader(conf *config.Config, spec *specs.Spec) (*Loader, func(), error
 	}
 
 	args := Args{
-		ID:              "foo",
-		Spec:            spec,
-		Conf:            conf,
-		ControllerFD:    fd,
-		GoferFDs:        []int{sandEnd},
-		StdioFDs:        stdio,
-		OverlayMediums:  []OverlayMedium{NoOverlay},
-		PodInitConfigFD: -1,
-		ExecFD:          -1,
+		ID:                     "foo",
+		Spec:                   spec,
+		Conf:                   conf,
+		ControllerFD:           fd,
+		GoferFDs:               []int{sandEnd},
+		StdioFDs:               stdio,
+		OverlayMediums:         []OverlayMedium{NoOverlay},
+		PodInitConfigFD:        -1,
+		SyscallFilterProfileFD: -1,
+		SeccompCacheFD:         -1,
+		ExecFD:                 -1,
+		StraceJSONFD:           -1,
 	}
 	l, err := New(args)
 	if err != nil {
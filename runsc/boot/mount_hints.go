@@ -245,6 +245,9 @@ func (m *MountHint) checkCompatible(replica *specs.Mount) error {
 	if masterOpts.Flags.NoATime && !replicaOpts.Flags.NoATime {
 		return fmt.Errorf("cannot mount atime enabled shared mount because master is noatime, mount: %+v", replica)
 	}
+	if masterOpts.SyncPolicy != replicaOpts.SyncPolicy {
+		return fmt.Errorf("cannot mount shared mount with fsync policy %q because master uses %q, mount: %+v", replicaOpts.SyncPolicy.Mode, masterOpts.SyncPolicy.Mode, replica)
+	}
 	return nil
 }
 
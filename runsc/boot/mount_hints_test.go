@@ -231,6 +231,17 @@ func TestHintsCheckCompatible(t *testing.T) {
 			replicaOpts: []string{"exec"},
 			err:         "noexec",
 		},
+		{
+			name:        "same-fsync",
+			masterOpts:  []string{"fsync=batch", "fsync_delay=10ms"},
+			replicaOpts: []string{"fsync=batch", "fsync_delay=10ms"},
+		},
+		{
+			name:        "incompatible-fsync",
+			masterOpts:  []string{"fsync=batch"},
+			replicaOpts: []string{"fsync=passthrough"},
+			err:         "fsync",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			master := MountHint{Mount: specs.Mount{Options: tc.masterOpts}}
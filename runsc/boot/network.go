@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/bpf"
 	"gvisor.dev/gvisor/pkg/hostos"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -69,6 +70,10 @@ var (
 // Network exposes methods that can be used to configure a network stack.
 type Network struct {
 	Stack *stack.Stack
+
+	// podStack returns the network stack of a pod that joined the sandbox
+	// through a sandbox group. It may be nil if pods can't join the sandbox.
+	podStack func(podID string) (*stack.Stack, error)
 }
 
 // Route represents a route in the network stack.
@@ -107,6 +112,10 @@ type FDBasedLink struct {
 	// NumChannels controls how many underlying FDs are to be used to
 	// create this endpoint.
 	NumChannels int
+
+	// SaveRestore indicates that connected endpoints using this link may be
+	// saved and restored.
+	SaveRestore bool
 }
 
 // XDPLink configures an XDP link.
@@ -126,6 +135,10 @@ type XDPLink struct {
 	// NumChannels controls how many underlying FDs are to be used to
 	// create this endpoint.
 	NumChannels int
+
+	// SaveRestore indicates that connected endpoints using this link may be
+	// saved and restored.
+	SaveRestore bool
 }
 
 // LoopbackLink configures a loopback link.
@@ -152,6 +165,11 @@ type CreateLinksAndRoutesArgs struct {
 
 	// PCAP indicates that FilePayload also contains a PCAP log file.
 	PCAP bool
+
+	// PodID is the ID of a pod that joined the sandbox through a sandbox
+	// group. If set, links and routes are created in the pod's network
+	// namespace instead of the sandbox's.
+	PodID string
 }
 
 // IPWithPrefix is an address with its subnet prefix length.
@@ -185,8 +203,18 @@ func (r *Route) toTcpipRoute(id tcpip.NICID) (tcpip.Route, error) {
 }
 
 // CreateLinksAndRoutes creates links and routes in a network stack.  It should
-// only be called once.
+// only be called once for the sandbox, and once for each pod that joins it.
 func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct{}) error {
+	if args.PodID != "" {
+		if n.podStack == nil {
+			return fmt.Errorf("pod %q can't have a network of its own in this sandbox", args.PodID)
+		}
+		s, err := n.podStack(args.PodID)
+		if err != nil {
+			return err
+		}
+		n = &Network{Stack: s}
+	}
 	if len(args.FDBasedLinks) > 0 && len(args.XDPLinks) > 0 {
 		return fmt.Errorf("received both fdbased and XDP links, but only one can be used at a time")
 	}
@@ -204,7 +232,12 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		return fmt.Errorf("args.FilePayload.Files has %d FDs but we need %d entries based on FDBasedLinks, XDPLinks, and PCAP", got, wantFDs)
 	}
 
+	// Links are numbered after the ones that the stack already has, like the
+	// loopback link of a pod's network namespace.
 	var nicID tcpip.NICID
+	for id := range n.Stack.NICInfo() {
+		nicID = max(nicID, id)
+	}
 	nicids := make(map[string]tcpip.NICID)
 
 	// Collect routes from all links.
@@ -280,6 +313,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 				GvisorGSOEnabled:   link.GvisorGSOEnabled,
 				TXChecksumOffload:  link.TXChecksumOffload,
 				RXChecksumOffload:  link.RXChecksumOffload,
+				SaveRestore:        link.SaveRestore,
 			})
 			if err != nil {
 				return err
@@ -356,6 +390,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			TXChecksumOffload: link.TXChecksumOffload,
 			RXChecksumOffload: link.RXChecksumOffload,
 			InterfaceIndex:    link.InterfaceIndex,
+			SaveRestore:       link.SaveRestore,
 		})
 		if err != nil {
 			return err
@@ -436,7 +471,89 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	}
 
 	log.Infof("Setting routes %+v", routes)
-	n.Stack.SetRouteTable(routes)
+	n.Stack.SetRouteTable(append(n.Stack.GetRouteTable(), routes...))
+	return nil
+}
+
+// announceLinkAddresses sends gratuitous ARP requests for the IPv4 addresses
+// of all NICs, so that neighbors learn the link addresses of a sandbox that
+// was restored, possibly on a different host. Failures are only logged, since
+// neighbors eventually refresh their caches anyway.
+func announceLinkAddresses(s *stack.Stack) {
+	for id, info := range s.NICInfo() {
+		if info.Flags.Loopback {
+			continue
+		}
+		if err := s.AnnounceLinkAddress(id, ipv4.ProtocolNumber); err != nil {
+			if _, ok := err.(*tcpip.ErrNotSupported); !ok {
+				log.Warningf("Announcing link address of NIC %q: %s", info.Name, err)
+			}
+		}
+	}
+}
+
+// StartPacketCaptureArgs are arguments to StartPacketCapture.
+type StartPacketCaptureArgs struct {
+	// NIC is the name of the interface to capture packets on.
+	NIC string
+
+	// Filter is a classic BPF program selecting the packets to capture. It
+	// runs over packets starting at their network header. If empty, all
+	// packets are captured.
+	Filter []bpf.Instruction
+
+	// SnapLen is the maximum number of bytes captured from each packet. If
+	// zero, packets are captured in full.
+	SnapLen uint32
+
+	// FilePayload contains the host file that packets are written to in
+	// pcapng format.
+	urpc.FilePayload
+}
+
+// StartPacketCapture starts capturing packets on a NIC. Only interfaces
+// backed by a host link can be captured on.
+func (n *Network) StartPacketCapture(args *StartPacketCaptureArgs, _ *struct{}) error {
+	if got := len(args.FilePayload.Files); got != 1 {
+		return fmt.Errorf("args.FilePayload.Files has %d FDs but we need exactly 1", got)
+	}
+	ep := n.Stack.GetLinkEndpointByName(args.NIC)
+	if ep == nil {
+		return fmt.Errorf("no interface named %q", args.NIC)
+	}
+
+	// The payload is closed once the call returns.
+	newFD, err := unix.Dup(int(args.FilePayload.Files[0].Fd()))
+	if err != nil {
+		return fmt.Errorf("failed to dup packet capture FD: %v", err)
+	}
+	output := os.NewFile(uintptr(newFD), "pcapng-"+args.NIC)
+	opts := sniffer.CaptureOptions{
+		Name:    args.NIC,
+		Filter:  args.Filter,
+		SnapLen: args.SnapLen,
+	}
+	if err := sniffer.StartCapture(ep, output, opts); err != nil {
+		_ = output.Close()
+		return fmt.Errorf("starting packet capture on %q: %w", args.NIC, err)
+	}
+	log.Infof("Started packet capture on %q with %d filter instructions", args.NIC, len(args.Filter))
+	return nil
+}
+
+// StopPacketCapture stops the packet capture on the named NIC, once all
+// captured packets are written out.
+func (n *Network) StopPacketCapture(nic *string, stats *sniffer.CaptureStats) error {
+	ep := n.Stack.GetLinkEndpointByName(*nic)
+	if ep == nil {
+		return fmt.Errorf("no interface named %q", *nic)
+	}
+	s, err := sniffer.StopCapture(ep)
+	if err != nil {
+		return fmt.Errorf("stopping packet capture on %q: %w", *nic, err)
+	}
+	log.Infof("Stopped packet capture on %q: %+v", *nic, s)
+	*stats = s
 	return nil
 }
 
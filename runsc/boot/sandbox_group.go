@@ -0,0 +1,170 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// podNamespaces are the namespaces of a pod that joined a sandbox started by
+// another pod of its sandbox group (see --sandbox-groups). The containers of
+// the pod, and processes exec'd in them, run in these namespaces so that pods
+// sharing the sandbox can't see each other's hostname, IPC objects or
+// network. The new network namespace starts with a loopback device only; with
+// --network=sandbox, runsc then moves the interfaces of the pod's own network
+// namespace on the host to it (see Network.CreateLinksAndRoutes).
+//
+// With --cgroupfs, the containers of the pod are also placed under a cgroup
+// of the pod, which enforces the pod's limits (see
+// Loader.containerCgroupPathLocked).
+type podNamespaces struct {
+	uts *kernel.UTSNamespace
+	ipc *kernel.IPCNamespace
+	net *inet.Namespace
+
+	// containers is the set of IDs of the pod's containers, including its
+	// sandbox container.
+	containers map[string]struct{}
+}
+
+// podNamespacesLocked returns the namespaces that container cid must run in,
+// or nil if it runs in the root namespaces. It creates them if cid is the
+// sandbox container of a pod that joined the sandbox.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) podNamespacesLocked(spec *specs.Spec, cid string) (*podNamespaces, error) {
+	if specutils.SpecContainerType(spec) != specutils.ContainerTypeSandbox {
+		podID, ok := specutils.SandboxID(spec)
+		if !ok {
+			return nil, nil
+		}
+		ns, ok := l.pods[podID]
+		if !ok {
+			return nil, nil
+		}
+		ns.containers[cid] = struct{}{}
+		return ns, nil
+	}
+	// A pod's sandbox container only runs as a subcontainer when the pod joins
+	// a sandbox started by another pod of its sandbox group.
+	if ns, ok := l.pods[cid]; ok {
+		return ns, nil
+	}
+	if l.root.conf.Cgroupfs {
+		if err := l.setPodCgroupLimits(spec, cid); err != nil {
+			return nil, err
+		}
+	}
+	uts, ipc, net, err := l.k.NewIsolatedNamespaces(l.k.SupervisorContext(), spec.Hostname, spec.Hostname)
+	if err != nil {
+		return nil, fmt.Errorf("creating namespaces for pod %q: %w", cid, err)
+	}
+	log.Infof("Pod %q joined the sandbox, running in new UTS, IPC and network namespaces", cid)
+	ns := &podNamespaces{
+		uts:        uts,
+		ipc:        ipc,
+		net:        net,
+		containers: map[string]struct{}{cid: {}},
+	}
+	l.pods[cid] = ns
+	return ns, nil
+}
+
+// setPodCgroupLimits creates the cgroups of the pod with the given ID, under
+// which the cgroups of its containers are created, and applies the pod's
+// limits to them.
+func (l *Loader) setPodCgroupLimits(spec *specs.Spec, podID string) error {
+	res, err := specutils.PodResources(spec)
+	if err != nil {
+		return fmt.Errorf("pod %q: %w", podID, err)
+	}
+	ctx := l.k.SupervisorContext()
+	cgs, err := containerCgroups(ctx, l.k, "/"+podID)
+	if err != nil {
+		return err
+	}
+	defer decRefCgroups(ctx, cgs)
+	if err := setContainerCgroupLimits(ctx, cgs, res); err != nil {
+		return fmt.Errorf("setting cgroup limits for pod %q: %w", podID, err)
+	}
+	return nil
+}
+
+// containerCgroupPathLocked returns the path of the cgroups of container cid
+// (see containerCgroups). The containers of a pod that joined the sandbox are
+// placed under the cgroup of the pod, so that the pod's limits apply to all
+// of them together.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) containerCgroupPathLocked(cid string) string {
+	for podID, ns := range l.pods {
+		if _, ok := ns.containers[cid]; ok {
+			return "/" + podID + "/" + cid
+		}
+	}
+	return "/" + cid
+}
+
+// containerCgroupPath is like containerCgroupPathLocked, but locks l.mu.
+func (l *Loader) containerCgroupPath(cid string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.containerCgroupPathLocked(cid)
+}
+
+// podNetworkStack returns the network stack of the pod with the given ID,
+// which joined the sandbox through a sandbox group.
+func (l *Loader) podNetworkStack(podID string) (*stack.Stack, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ns, ok := l.pods[podID]
+	if !ok {
+		return nil, fmt.Errorf("pod %q didn't join the sandbox", podID)
+	}
+	s, ok := ns.net.Stack().(*netstack.Stack)
+	if !ok {
+		return nil, fmt.Errorf("network namespace of pod %q doesn't use netstack", podID)
+	}
+	return s.Stack, nil
+}
+
+// apply makes args create a process in ns.
+func (ns *podNamespaces) apply(ctx context.Context, args *kernel.CreateProcessArgs) {
+	// args holds references on its UTS and IPC namespaces.
+	args.UTSNamespace.DecRef(ctx)
+	ns.uts.IncRef()
+	args.UTSNamespace = ns.uts
+	args.IPCNamespace.DecRef(ctx)
+	ns.ipc.IncRef()
+	args.IPCNamespace = ns.ipc
+	args.NetworkNamespace = ns.net
+}
+
+// release drops the loader's references on ns. Processes still running in
+// the pod hold their own.
+func (ns *podNamespaces) release(ctx context.Context) {
+	ns.uts.DecRef(ctx)
+	ns.ipc.DecRef(ctx)
+	ns.net.DecRef(ctx)
+}
@@ -24,6 +24,8 @@ import (
 
 	// Register supported of sinks.
 	_ "gvisor.dev/gvisor/pkg/sentry/seccheck/sinks/null"
+	_ "gvisor.dev/gvisor/pkg/sentry/seccheck/sinks/otlp"
+	_ "gvisor.dev/gvisor/pkg/sentry/seccheck/sinks/policy"
 	_ "gvisor.dev/gvisor/pkg/sentry/seccheck/sinks/remote"
 )
 
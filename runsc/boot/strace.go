@@ -15,16 +15,29 @@
 package boot
 
 import (
+	"os"
 	"strings"
 
 	"gvisor.dev/gvisor/pkg/sentry/strace"
 	"gvisor.dev/gvisor/runsc/config"
 )
 
-func enableStrace(conf *config.Config) error {
+func enableStrace(conf *config.Config, jsonFD int) error {
 	// We must initialize even if strace is not enabled.
 	strace.Initialize()
 
+	var allowlist []string
+	if len(conf.StraceSyscalls) > 0 {
+		allowlist = strings.Split(conf.StraceSyscalls, ",")
+	}
+
+	if jsonFD >= 0 {
+		strace.SetJSONOutput(os.NewFile(uintptr(jsonFD), "strace-json"))
+		if err := enableSink(allowlist, strace.SinkTypeJSON); err != nil {
+			return err
+		}
+	}
+
 	if !conf.Strace {
 		return nil
 	}
@@ -42,10 +55,15 @@ func enableStrace(conf *config.Config) error {
 	if conf.StraceEvent {
 		sink = strace.SinkTypeEvent
 	}
+	return enableSink(allowlist, sink)
+}
 
-	if len(conf.StraceSyscalls) == 0 {
+// enableSink enables the syscalls in allowlist, or all syscalls if allowlist
+// is empty, for sink.
+func enableSink(allowlist []string, sink strace.SinkType) error {
+	if len(allowlist) == 0 {
 		strace.EnableAll(sink)
 		return nil
 	}
-	return strace.Enable(strings.Split(conf.StraceSyscalls, ","), sink)
+	return strace.Enable(allowlist, sink)
 }
@@ -0,0 +1,143 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// maxErrno is the highest errno that can be returned by a syscall.
+const maxErrno = 4095
+
+// parseSyscallOverrides parses a comma-separated list of syscall overrides,
+// each of the form "<syscall>=<action>". The action is one of:
+//
+//   - "errno:<errno>": fail the syscall with errno, given by name (e.g.
+//     ENOSYS) or number, without executing it.
+//   - "delay:<duration>": sleep for duration (e.g. 10ms) before executing the
+//     syscall.
+//   - "default": remove the override of the syscall.
+//
+// It returns the overrides by syscall name. Removed overrides are nil.
+func parseSyscallOverrides(spec string) (map[string]*kernel.SyscallOverride, error) {
+	overrides := make(map[string]*kernel.SyscallOverride)
+	if spec == "" {
+		return overrides, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		name, action, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid syscall override %q, must be <syscall>=<action>", entry)
+		}
+		o, err := parseSyscallOverride(action)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syscall override %q: %w", entry, err)
+		}
+		overrides[name] = o
+	}
+	return overrides, nil
+}
+
+// parseSyscallOverride parses a single override action. See
+// parseSyscallOverrides.
+func parseSyscallOverride(action string) (*kernel.SyscallOverride, error) {
+	if action == "default" {
+		return nil, nil
+	}
+	kind, arg, _ := strings.Cut(action, ":")
+	switch kind {
+	case "errno":
+		errno, err := parseErrno(arg)
+		if err != nil {
+			return nil, err
+		}
+		return kernel.ErrnoOverride(linuxerr.ErrorFromUnix(errno)), nil
+	case "delay":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("delay must be positive, got %v", d)
+		}
+		return kernel.DelayOverride(d), nil
+	default:
+		return nil, fmt.Errorf("unknown action %q, must be one of errno:<errno>, delay:<duration> or default", action)
+	}
+}
+
+// parseErrno parses an errno given by name or number.
+func parseErrno(s string) (unix.Errno, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		if n == 0 || n > maxErrno || unix.ErrnoName(unix.Errno(n)) == "" {
+			return 0, fmt.Errorf("invalid errno %d", n)
+		}
+		return unix.Errno(n), nil
+	}
+	for n := unix.Errno(1); n <= maxErrno; n++ {
+		if unix.ErrnoName(n) == s {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown errno %q", s)
+}
+
+// setSyscallOverrides installs the overrides in spec (see
+// parseSyscallOverrides) in all syscall tables, for the container with ID cid
+// or for all containers if cid is empty.
+func setSyscallOverrides(cid, spec string) error {
+	overrides, err := parseSyscallOverrides(spec)
+	if err != nil {
+		return err
+	}
+	for name, o := range overrides {
+		found := false
+		for _, table := range kernel.SyscallTables() {
+			sysno, err := table.LookupNo(name)
+			if err != nil {
+				continue
+			}
+			if err := table.SetOverride(cid, sysno, o); err != nil {
+				return err
+			}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("syscall %q not found", name)
+		}
+		if o == nil {
+			log.Infof("Removed override of syscall %q, cid: %q", name, cid)
+		} else {
+			log.Infof("Overriding syscall %q with %s, cid: %q", name, o.Description, cid)
+		}
+	}
+	return nil
+}
+
+// clearSyscallOverrides removes the overrides installed for the container with
+// ID cid.
+func clearSyscallOverrides(cid string) {
+	for _, table := range kernel.SyscallTables() {
+		table.ClearOverrides(cid)
+	}
+}
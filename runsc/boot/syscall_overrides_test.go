@@ -0,0 +1,103 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+)
+
+func TestParseSyscallOverrides(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		spec    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			spec: "",
+			want: map[string]string{},
+		},
+		{
+			name: "errno name",
+			spec: "ptrace=errno:ENOSYS",
+			want: map[string]string{"ptrace": "errno:38"},
+		},
+		{
+			name: "errno number",
+			spec: "ptrace=errno:1",
+			want: map[string]string{"ptrace": "errno:1"},
+		},
+		{
+			name: "multiple",
+			spec: "read=delay:10ms,write=default",
+			want: map[string]string{"read": "delay:10ms", "write": ""},
+		},
+		{
+			name:    "missing action",
+			spec:    "read",
+			wantErr: true,
+		},
+		{
+			name:    "unknown action",
+			spec:    "read=panic",
+			wantErr: true,
+		},
+		{
+			name:    "unknown errno",
+			spec:    "read=errno:EFOO",
+			wantErr: true,
+		},
+		{
+			name:    "invalid errno",
+			spec:    "read=errno:0",
+			wantErr: true,
+		},
+		{
+			name:    "negative delay",
+			spec:    "read=delay:-1s",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSyscallOverrides(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseSyscallOverrides(%q) succeeded, want error", tc.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSyscallOverrides(%q) failed: %v", tc.spec, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("parseSyscallOverrides(%q) got %d overrides, want %d", tc.spec, len(got), len(tc.want))
+			}
+			for name, want := range tc.want {
+				o, ok := got[name]
+				if !ok {
+					t.Fatalf("parseSyscallOverrides(%q) missing override for %q", tc.spec, name)
+				}
+				var desc string
+				if o != nil {
+					desc = o.Description
+				}
+				if desc != want {
+					t.Errorf("parseSyscallOverrides(%q)[%q] = %q, want %q", tc.spec, name, desc, want)
+				}
+			}
+		})
+	}
+}
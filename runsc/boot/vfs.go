@@ -22,9 +22,11 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/abi/nvgpu"
 	"gvisor.dev/gvisor/pkg/cleanup"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -32,10 +34,19 @@ import (
 	"gvisor.dev/gvisor/pkg/fspath"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/devices/accel"
+	"gvisor.dev/gvisor/pkg/sentry/devices/amdproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/ashmem"
+	"gvisor.dev/gvisor/pkg/sentry/devices/binder"
+	"gvisor.dev/gvisor/pkg/sentry/devices/hostdev"
+	"gvisor.dev/gvisor/pkg/sentry/devices/kvmdev"
 	"gvisor.dev/gvisor/pkg/sentry/devices/memdev"
 	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/ptpdev"
+	"gvisor.dev/gvisor/pkg/sentry/devices/rdmaproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/tpmdev"
 	"gvisor.dev/gvisor/pkg/sentry/devices/ttydev"
 	"gvisor.dev/gvisor/pkg/sentry/devices/tundev"
+	"gvisor.dev/gvisor/pkg/sentry/devices/vfiodev"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/cgroupfs"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devpts"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
@@ -43,6 +54,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/fuse"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/gofer"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/mqfs"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/nfs"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/overlay"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/proc"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/sys"
@@ -83,6 +95,19 @@ func selfOverlayFilestoreName(sandboxID string) string {
 // tmpfs has some extra supported options that we must pass through.
 var tmpfsAllowedData = []string{"mode", "size", "uid", "gid"}
 
+// virtiofsAllowedData is the set of virtiofs mount options that are passed to
+// the filesystem.
+var virtiofsAllowedData = []string{"max_read", "dax"}
+
+// nfsAllowedData is the set of NFS mount options that are passed to the
+// filesystem. Options that only affect how the server is reached, like addr
+// and port, are applied by runsc when it connects to the server.
+var nfsAllowedData = []string{"vers", "nfsvers", "minorversion", "rsize", "wsize", "actimeo", "noac", "lock", "nolock"}
+
+// goferAllowedData is the set of gofer mount options that are passed to the
+// filesystem. They tune its page cache on a per-mount basis.
+var goferAllowedData = []string{"readahead", "writeback_interval", "close_to_open"}
+
 func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 	ctx := k.SupervisorContext()
 	creds := auth.NewRootCredentials(k.RootUserNamespace())
@@ -109,9 +134,15 @@ func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 		AllowUserMount: true,
 		AllowUserList:  true,
 	})
+	vfsObj.MustRegisterFilesystemType(fuse.VirtiofsName, &fuse.VirtiofsFilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserList: true,
+	})
 	vfsObj.MustRegisterFilesystemType(gofer.Name, &gofer.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserList: true,
 	})
+	vfsObj.MustRegisterFilesystemType(nfs.Name, &nfs.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserList: true,
+	})
 	vfsObj.MustRegisterFilesystemType(overlay.Name, &overlay.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserMount: true,
 		AllowUserList:  true,
@@ -183,6 +214,38 @@ func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 		return err
 	}
 
+	if err := amdProxyRegisterDevicesAndCreateFiles(ctx, info, vfsObj, a); err != nil {
+		return err
+	}
+
+	if err := hostDevicesRegisterAndCreateFiles(ctx, info, vfsObj, a); err != nil {
+		return err
+	}
+
+	if err := androidDevicesRegisterAndCreateFiles(ctx, info, vfsObj, a); err != nil {
+		return err
+	}
+
+	if err := tpmRegisterAndCreateFile(ctx, info, vfsObj, a); err != nil {
+		return err
+	}
+
+	if err := kvmRegisterAndCreateFile(ctx, info, vfsObj, a); err != nil {
+		return err
+	}
+
+	if err := vfioRegisterAndCreateFiles(ctx, info, vfsObj, a); err != nil {
+		return err
+	}
+
+	if err := rdmaProxyRegisterAndCreateFiles(ctx, info, vfsObj, a); err != nil {
+		return err
+	}
+
+	if err := ptpRegisterAndCreateFile(ctx, info, vfsObj, a); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -316,6 +379,11 @@ func goferMountData(fd int, fa config.FileAccessType, conf *config.Config) []str
 	}
 	if fa == config.FileAccessShared {
 		opts = append(opts, "cache=remote_revalidating")
+		if conf.HostFileLocks {
+			opts = append(opts, "host_locks")
+		}
+	} else if conf.HostDelegations {
+		opts = append(opts, "delegations")
 	}
 	if conf.DirectFS {
 		opts = append(opts, "directfs")
@@ -385,6 +453,14 @@ type containerMounter struct {
 	// tmpfs upper mount in the overlay mounts.
 	overlayFilestoreFDs fdDispenser
 
+	// virtiofsFDs are the FDs connected to the virtio-fs servers for virtiofs
+	// mounts, in the same order as the mounts.
+	virtiofsFDs fdDispenser
+
+	// nfsFDs are the FDs connected to the servers of NFS mounts, in the same
+	// order as the mounts.
+	nfsFDs fdDispenser
+
 	// overlayMediums contains information about how the gofer mounts have been
 	// overlaid. The first entry is for rootfs and the following entries are for
 	// bind mounts in `mounts` slice above (in the same order).
@@ -403,6 +479,10 @@ type containerMounter struct {
 	// /sys/devices/virtual/dmi/id/product_name.
 	productName string
 
+	// procDriverFiles contains files to create in /proc/driver; see
+	// proc.InternalData.DriverFiles.
+	procDriverFiles map[string]string
+
 	// sandboxID is the ID for the whole sandbox.
 	sandboxID string
 }
@@ -413,11 +493,14 @@ func newContainerMounter(info *containerInfo, k *kernel.Kernel, hints *PodMountH
 		mounts:              compileMounts(info.spec, info.conf),
 		fds:                 fdDispenser{fds: info.goferFDs},
 		overlayFilestoreFDs: fdDispenser{fds: info.overlayFilestoreFDs},
+		virtiofsFDs:         fdDispenser{fds: info.virtiofsFDs},
+		nfsFDs:              fdDispenser{fds: info.nfsFDs},
 		overlayMediums:      info.overlayMediums,
 		k:                   k,
 		hints:               hints,
 		sharedMounts:        sharedMounts,
 		productName:         productName,
+		procDriverFiles:     info.procDriverFiles,
 		sandboxID:           sandboxID,
 	}
 }
@@ -426,6 +509,12 @@ func (c *containerMounter) checkDispenser() error {
 	if !c.fds.empty() {
 		return fmt.Errorf("not all gofer FDs were consumed, remaining: %v", c.fds)
 	}
+	if !c.virtiofsFDs.empty() {
+		return fmt.Errorf("not all virtiofs FDs were consumed, remaining: %v", c.virtiofsFDs)
+	}
+	if !c.nfsFDs.empty() {
+		return fmt.Errorf("not all NFS FDs were consumed, remaining: %v", c.nfsFDs)
+	}
 	return nil
 }
 
@@ -735,7 +824,7 @@ func (c *containerMounter) prepareMounts() ([]mountInfo, error) {
 		m := &c.mounts[i]
 		specutils.MaybeConvertToBindMount(m)
 
-		// Only bind mounts use host FDs; see
+		// Only bind, virtiofs and NFS mounts use host FDs; see
 		// containerMounter.getMountNameAndOptions.
 		info := mountInfo{
 			mount:         m,
@@ -750,6 +839,10 @@ func (c *containerMounter) prepareMounts() ([]mountInfo, error) {
 				info.overlayFilestoreFD = c.overlayFilestoreFDs.removeAsFD()
 			}
 			goferMntIdx++
+		} else if specutils.IsVirtiofsMount(*m) {
+			info.fd = c.virtiofsFDs.remove()
+		} else if specutils.IsNFSMount(*m) {
+			info.fd = c.nfsFDs.remove()
 		}
 		mounts = append(mounts, info)
 	}
@@ -766,7 +859,7 @@ func (c *containerMounter) prepareMounts() ([]mountInfo, error) {
 }
 
 func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Config, mns *vfs.MountNamespace, creds *auth.Credentials, submount *mountInfo) (*vfs.Mount, error) {
-	fsName, opts, err := getMountNameAndOptions(conf, submount, c.productName)
+	fsName, opts, err := getMountNameAndOptions(conf, submount, c.productName, c.procDriverFiles)
 	if err != nil {
 		return nil, fmt.Errorf("mountOptions failed: %w", err)
 	}
@@ -797,7 +890,13 @@ func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Confi
 		Start: root,
 		Path:  fspath.Parse(submount.mount.Destination),
 	}
-	mnt, err := c.k.VFS().MountAt(ctx, creds, "", target, fsName, opts)
+	// NFS filesystems are the only ones that need to know the mount source,
+	// which contains the path of the export.
+	source := ""
+	if fsName == nfs.Name {
+		source = submount.mount.Source
+	}
+	mnt, err := c.k.VFS().MountAt(ctx, creds, source, target, fsName, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to mount %q (type: %s): %w, opts: %v", submount.mount.Destination, submount.mount.Type, err, opts)
 	}
@@ -807,7 +906,7 @@ func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Confi
 
 // getMountNameAndOptions retrieves the fsName, opts, and useOverlay values
 // used for mounts.
-func getMountNameAndOptions(conf *config.Config, m *mountInfo, productName string) (string, *vfs.MountOptions, error) {
+func getMountNameAndOptions(conf *config.Config, m *mountInfo, productName string, procDriverFiles map[string]string) (string, *vfs.MountOptions, error) {
 	fsName := m.mount.Type
 	var (
 		data         []string
@@ -816,14 +915,26 @@ func getMountNameAndOptions(conf *config.Config, m *mountInfo, productName strin
 
 	// Find filesystem name and FS specific data field.
 	switch m.mount.Type {
-	case devpts.Name, devtmpfs.Name, proc.Name:
+	case devpts.Name, devtmpfs.Name:
 		// Nothing to do.
 
+	case proc.Name:
+		if conf.MinimalBoot {
+			data = append(data, "subset=pid")
+		}
+		if len(procDriverFiles) != 0 {
+			internalData = &proc.InternalData{DriverFiles: procDriverFiles}
+		}
+
 	case Nonefs:
 		fsName = sys.Name
 
 	case sys.Name:
-		sysData := &sys.InternalData{EnableAccelSysfs: conf.TPUProxy}
+		sysData := &sys.InternalData{
+			EnableAccelSysfs:      conf.TPUProxy,
+			EnableKFDSysfs:        conf.AMDProxy,
+			EnableInfinibandSysfs: conf.RDMAProxy,
+		}
 		if len(productName) > 0 {
 			sysData.ProductName = productName
 		}
@@ -843,6 +954,11 @@ func getMountNameAndOptions(conf *config.Config, m *mountInfo, productName strin
 			return "", nil, fmt.Errorf("gofer mount requires a connection FD")
 		}
 		data = goferMountData(m.fd, getMountAccessType(conf, m.mount, m.hint), conf)
+		cacheData, err := parseAndFilterOptions(m.mount.Options, goferAllowedData...)
+		if err != nil {
+			return "", nil, err
+		}
+		data = append(data, cacheData...)
 		internalData = gofer.InternalFilesystemOptions{
 			UniqueID: m.mount.Destination,
 		}
@@ -854,6 +970,29 @@ func getMountNameAndOptions(conf *config.Config, m *mountInfo, productName strin
 			return "", nil, err
 		}
 
+	case fuse.VirtiofsName:
+		if m.fd < 0 {
+			return "", nil, fmt.Errorf("virtiofs mount requires a connection FD")
+		}
+		var err error
+		data, err = parseAndFilterOptions(m.mount.Options, virtiofsAllowedData...)
+		if err != nil {
+			return "", nil, err
+		}
+		internalData = &fuse.VirtiofsInternalData{FD: m.fd}
+
+	case nfs.Name, "nfs4":
+		if m.fd < 0 {
+			return "", nil, fmt.Errorf("NFS mount requires a connection FD")
+		}
+		fsName = nfs.Name
+		var err error
+		data, err = parseAndFilterOptions(m.mount.Options, nfsAllowedData...)
+		if err != nil {
+			return "", nil, err
+		}
+		internalData = &nfs.InternalData{FD: m.fd}
+
 	default:
 		log.Warningf("ignoring unknown filesystem type %q", m.mount.Type)
 		return "", nil, nil
@@ -887,12 +1026,43 @@ func ParseMountOptions(opts []string) *vfs.MountOptions {
 		case "bind", "rbind":
 			// These are the same as a mount with type="bind".
 		default:
-			log.Warningf("ignoring unknown mount option %q", o)
+			if !parseSyncMountOption(o, &mountOpts.SyncPolicy) {
+				log.Warningf("ignoring unknown mount option %q", o)
+			}
 		}
 	}
 	return mountOpts
 }
 
+// parseSyncMountOption parses the "fsync" and "fsync_delay" mount options,
+// which set the sync policy of the mount, into policy. It returns false if o
+// is not one of these options.
+func parseSyncMountOption(o string, policy *vfs.SyncPolicy) bool {
+	k, v, ok := parseKeyValue(o)
+	if !ok {
+		return false
+	}
+	switch k {
+	case "fsync":
+		mode, err := vfs.ParseSyncMode(v)
+		if err != nil {
+			log.Warningf("ignoring mount option %q: %v", o, err)
+			return true
+		}
+		policy.Mode = mode
+	case "fsync_delay":
+		delay, err := time.ParseDuration(v)
+		if err != nil || delay < 0 {
+			log.Warningf("ignoring mount option %q: invalid duration", o)
+			return true
+		}
+		policy.MaxDelay = delay
+	default:
+		return false
+	}
+	return true
+}
+
 func parseKeyValue(s string) (string, string, bool) {
 	tokens := strings.SplitN(s, "=", 2)
 	if len(tokens) < 2 {
@@ -1007,7 +1177,7 @@ func (l *Loader) mountSharedMaster(ctx context.Context, conf *config.Config, hin
 	// Map mount type to filesystem name, and parse out the options that we are
 	// capable of dealing with.
 	mntInfo := newNonGoferMountInfo(&hint.Mount)
-	fsName, opts, err := getMountNameAndOptions(conf, mntInfo, l.productName)
+	fsName, opts, err := getMountNameAndOptions(conf, mntInfo, l.productName, l.procDriverFiles)
 	if err != nil {
 		return nil, err
 	}
@@ -1026,7 +1196,7 @@ func (c *containerMounter) mountSharedSubmount(ctx context.Context, conf *config
 
 	// Ignore data and useOverlay because these were already applied to
 	// the master mount.
-	_, opts, err := getMountNameAndOptions(conf, newNonGoferMountInfo(mount), c.productName)
+	_, opts, err := getMountNameAndOptions(conf, newNonGoferMountInfo(mount), c.productName, c.procDriverFiles)
 	if err != nil {
 		return nil, err
 	}
@@ -1183,6 +1353,187 @@ func tpuProxyRegisterDevicesAndCreateFiles(ctx context.Context, info *containerI
 	return nil
 }
 
+func amdProxyRegisterDevicesAndCreateFiles(ctx context.Context, info *containerInfo, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
+	if !info.conf.AMDProxy {
+		return nil
+	}
+	// Only expose the GPUs assigned to the container, whose render nodes are
+	// the only ones mounted into the sandbox chroot.
+	renderMinors := specutils.AMDRenderNodeMinors(info.spec)
+	kfdDevMajor, err := vfsObj.GetDynamicCharDevMajor()
+	if err != nil {
+		return fmt.Errorf("reserving device major number for /dev/kfd: %w", err)
+	}
+	if err := amdproxy.Register(vfsObj, kfdDevMajor, renderMinors); err != nil {
+		return fmt.Errorf("registering amdproxy driver: %w", err)
+	}
+	if err := amdproxy.CreateDevtmpfsFiles(ctx, a, kfdDevMajor, renderMinors); err != nil {
+		return fmt.Errorf("creating amdproxy devtmpfs files: %w", err)
+	}
+	return nil
+}
+
+// hostDeviceSpecs returns the host devices to expose to the sandbox, as
+// configured in conf.
+func hostDeviceSpecs(conf *config.Config) []hostdev.Spec {
+	devs := make([]hostdev.Spec, 0, len(conf.HostDevices))
+	for _, dev := range conf.HostDevices {
+		spec := hostdev.Spec{Path: dev.Path}
+		for _, ioctl := range dev.Ioctls {
+			spec.Ioctls = append(spec.Ioctls, hostdev.Ioctl{Request: ioctl.Request, Size: ioctl.Size})
+		}
+		devs = append(devs, spec)
+	}
+	return devs
+}
+
+func hostDevicesRegisterAndCreateFiles(ctx context.Context, info *containerInfo, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
+	// The host devices have been bind mounted into the sandbox chroot at the
+	// same paths.
+	for _, spec := range hostDeviceSpecs(info.conf) {
+		if err := hostdev.Register(vfsObj, spec); err != nil {
+			return fmt.Errorf("registering host device %q: %w", spec.Path, err)
+		}
+		if err := hostdev.CreateDevtmpfsFile(ctx, a, spec); err != nil {
+			return fmt.Errorf("creating host device file %q: %w", spec.Path, err)
+		}
+	}
+	return nil
+}
+
+func androidDevicesRegisterAndCreateFiles(ctx context.Context, info *containerInfo, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
+	if !info.conf.AndroidDevices {
+		return nil
+	}
+	binderDevMajor, err := vfsObj.GetDynamicCharDevMajor()
+	if err != nil {
+		return fmt.Errorf("reserving device major number for binder: %w", err)
+	}
+	if err := binder.Register(vfsObj, binderDevMajor); err != nil {
+		return fmt.Errorf("registering binder devices: %w", err)
+	}
+	if err := binder.CreateDevtmpfsFiles(ctx, a, binderDevMajor); err != nil {
+		return fmt.Errorf("creating binder devtmpfs files: %w", err)
+	}
+	ashmemDevMajor, err := vfsObj.GetDynamicCharDevMajor()
+	if err != nil {
+		return fmt.Errorf("reserving device major number for ashmem: %w", err)
+	}
+	if err := ashmem.Register(vfsObj, ashmemDevMajor); err != nil {
+		return fmt.Errorf("registering ashmem device: %w", err)
+	}
+	if err := ashmem.CreateDevtmpfsFiles(ctx, a, ashmemDevMajor); err != nil {
+		return fmt.Errorf("creating ashmem devtmpfs files: %w", err)
+	}
+	return nil
+}
+
+func tpmRegisterAndCreateFile(ctx context.Context, info *containerInfo, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
+	if info.conf.TPM == config.TPMNone {
+		return nil
+	}
+	major, err := vfsObj.GetDynamicCharDevMajor()
+	if err != nil {
+		return fmt.Errorf("reserving device major number for tpmrm: %w", err)
+	}
+	if err := tpmdev.Register(vfsObj, major, info.conf.TPM == config.TPMEmulated); err != nil {
+		return fmt.Errorf("registering tpmrm device: %w", err)
+	}
+	if err := tpmdev.CreateDevtmpfsFile(ctx, a, major); err != nil {
+		return fmt.Errorf("creating tpmrm devtmpfs file: %w", err)
+	}
+	return nil
+}
+
+func kvmRegisterAndCreateFile(ctx context.Context, info *containerInfo, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
+	if !info.conf.NestedKVM {
+		return nil
+	}
+	if err := kvmdev.Register(vfsObj); err != nil {
+		return fmt.Errorf("registering kvm device: %w", err)
+	}
+	if err := kvmdev.CreateDevtmpfsFile(ctx, a); err != nil {
+		return fmt.Errorf("creating kvm devtmpfs file: %w", err)
+	}
+	return nil
+}
+
+func vfioRegisterAndCreateFiles(ctx context.Context, info *containerInfo, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
+	if len(info.conf.VFIOGroups) == 0 {
+		return nil
+	}
+	groups := make([]vfiodev.GroupOptions, 0, len(info.conf.VFIOGroups))
+	for _, group := range info.conf.VFIOGroups {
+		groups = append(groups, vfiodev.GroupOptions{
+			Group:          group.Group,
+			MmapAllRegions: group.MmapAllRegions,
+			MmapRegions:    group.MmapRegions,
+		})
+	}
+	major, err := vfsObj.GetDynamicCharDevMajor()
+	if err != nil {
+		return fmt.Errorf("reserving device major number for vfio groups: %w", err)
+	}
+	if err := vfiodev.Register(vfsObj, major, groups); err != nil {
+		return fmt.Errorf("registering vfio devices: %w", err)
+	}
+	if err := vfiodev.CreateDevtmpfsFiles(ctx, a, major, groups); err != nil {
+		return fmt.Errorf("creating vfio devtmpfs files: %w", err)
+	}
+	return nil
+}
+
+func rdmaProxyRegisterAndCreateFiles(ctx context.Context, info *containerInfo, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
+	if !info.conf.RDMAProxy {
+		return nil
+	}
+	// At this point /dev/infiniband just contains the uverbs devices that
+	// have been mounted into the sandbox chroot.
+	devs, err := rdmaproxy.HostDevices()
+	if err != nil {
+		return fmt.Errorf("enumerating uverbs devices: %w", err)
+	}
+	if err := rdmaproxy.Register(vfsObj, devs); err != nil {
+		return fmt.Errorf("registering uverbs devices: %w", err)
+	}
+	if err := rdmaproxy.CreateDevtmpfsFiles(ctx, a, devs); err != nil {
+		return fmt.Errorf("creating uverbs devtmpfs files: %w", err)
+	}
+	return nil
+}
+
+func ptpRegisterAndCreateFile(ctx context.Context, info *containerInfo, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
+	if !info.conf.PTP {
+		return nil
+	}
+	major, err := vfsObj.GetDynamicCharDevMajor()
+	if err != nil {
+		return fmt.Errorf("reserving device major number for ptp: %w", err)
+	}
+	if err := ptpdev.Register(vfsObj, major); err != nil {
+		return fmt.Errorf("registering ptp device: %w", err)
+	}
+	if err := ptpdev.CreateDevtmpfsFile(ctx, a, major); err != nil {
+		return fmt.Errorf("creating ptp devtmpfs file: %w", err)
+	}
+	return nil
+}
+
+// nvproxyGPUMinorsFromSpec returns the device minor numbers of the Nvidia
+// GPUs in the spec's device list.
+func nvproxyGPUMinorsFromSpec(spec *specs.Spec) []uint32 {
+	if spec.Linux == nil {
+		return nil
+	}
+	var minors []uint32
+	for _, dev := range spec.Linux.Devices {
+		if dev.Major == nvgpu.NV_MAJOR_DEVICE_NUMBER && dev.Minor != nvgpu.NV_CONTROL_DEVICE_MINOR {
+			minors = append(minors, uint32(dev.Minor))
+		}
+	}
+	return minors
+}
+
 func nvproxyRegisterDevicesAndCreateFiles(ctx context.Context, info *containerInfo, k *kernel.Kernel, vfsObj *vfs.VirtualFilesystem, a *devtmpfs.Accessor) error {
 	if !specutils.GPUFunctionalityRequested(info.spec, info.conf) {
 		return nil
@@ -1191,18 +1542,33 @@ func nvproxyRegisterDevicesAndCreateFiles(ctx context.Context, info *containerIn
 	if err != nil {
 		return fmt.Errorf("reserving device major number for nvidia-uvm: %w", err)
 	}
+	var minors []uint32
+	if specutils.NVProxyDockerMode(info.spec, info.conf) {
+		minors, err = specutils.FindAllGPUDevices("/")
+		if err != nil {
+			return fmt.Errorf("getting nvidia devices: %w", err)
+		}
+	} else {
+		minors = nvproxyGPUMinorsFromSpec(info.spec)
+	}
+	// Log the report before registering the driver, so that it is available
+	// if the driver version is not supported.
+	log.Infof("nvproxy: GPU attach report: %s", nvproxy.NewAttachReport(minors))
 	if err := nvproxy.Register(vfsObj, uvmDevMajor); err != nil {
 		return fmt.Errorf("registering nvproxy driver: %w", err)
 	}
 	info.nvidiaUVMDevMajor = uvmDevMajor
-	if info.conf.NVProxyDocker {
+	// /proc/driver/nvidia is only informational, so don't fail if it can't
+	// be synthesized.
+	if files, err := nvproxy.ProcDriverFiles(minors); err != nil {
+		log.Warningf("nvproxy: failed to synthesize /proc/driver/nvidia: %v", err)
+	} else {
+		info.procDriverFiles = files
+	}
+	if specutils.NVProxyDockerMode(info.spec, info.conf) {
 		// In Docker mode, create all the device files now.
 		// In non-Docker mode, these are instead created as part of
 		// `createDeviceFiles`, using the spec's Device list.
-		minors, err := specutils.FindAllGPUDevices("/")
-		if err != nil {
-			return fmt.Errorf("getting nvidia devices: %w", err)
-		}
 		if err := nvproxy.CreateDriverDevtmpfsFiles(ctx, a, uvmDevMajor); err != nil {
 			return fmt.Errorf("creating nvproxy devtmpfs files: %w", err)
 		}
@@ -317,12 +317,16 @@ func loadPathsHelper(cgroup, mountinfo io.Reader, unified bool) (map[string]stri
 // Cgroup represents a cgroup configuration.
 type Cgroup interface {
 	Install(res *specs.LinuxResources) error
+	Update(res *specs.LinuxResources) error
 	Uninstall() error
 	Join() (func(), error)
 	CPUQuota() (float64, error)
 	CPUUsage() (uint64, error)
 	NumCPU() (int, error)
 	MemoryLimit() (uint64, error)
+	Pressure(resource PressureResource) (*Pressure, error)
+	WatchPressure(ctx context.Context, trigger PressureTrigger, fn func()) error
+	OpenPressureTrigger(trigger PressureTrigger) (*os.File, error)
 	MakePath(controllerName string) string
 }
 
@@ -525,6 +529,23 @@ func (c *cgroupV1) Install(res *specs.LinuxResources) error {
 	return nil
 }
 
+// Update applies the limits set in res to all existing controllers. Limits
+// that are not set in res are left unchanged.
+func (c *cgroupV1) Update(res *specs.LinuxResources) error {
+	log.Debugf("Updating cgroup path %q", c.Name)
+	for key, ctrlr := range controllers {
+		path := c.MakePath(key)
+		if _, err := os.Stat(path); err != nil {
+			// The controller was skipped by Install.
+			continue
+		}
+		if err := ctrlr.set(res, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // createController creates the controller directory, checking that the
 // controller is enabled in the system. It returns a boolean indicating whether
 // the controller should be skipped (e.g. controller is disabled). In case it
@@ -673,6 +694,28 @@ func (c *cgroupV1) MemoryLimit() (uint64, error) {
 	return strconv.ParseUint(strings.TrimSpace(limStr), 10, 64)
 }
 
+// errPressureV1 is returned by cgroupV1 for pressure stall information, which
+// is only available in cgroup v2.
+var errPressureV1 = errors.New("pressure stall information requires cgroup v2")
+
+// Pressure returns the pressure stall information for resource. It is not
+// supported for cgroup v1.
+func (*cgroupV1) Pressure(PressureResource) (*Pressure, error) {
+	return nil, errPressureV1
+}
+
+// WatchPressure watches pressure stall information. It is not supported for
+// cgroup v1.
+func (*cgroupV1) WatchPressure(context.Context, PressureTrigger, func()) error {
+	return errPressureV1
+}
+
+// OpenPressureTrigger sets a pressure trigger. It is not supported for cgroup
+// v1.
+func (*cgroupV1) OpenPressureTrigger(PressureTrigger) (*os.File, error) {
+	return nil, errPressureV1
+}
+
 // MakePath builds a path to the given controller.
 func (c *cgroupV1) MakePath(controllerName string) string {
 	path := c.Name
@@ -168,6 +168,22 @@ func (c *cgroupV2) Install(res *specs.LinuxResources) error {
 	return nil
 }
 
+// Update applies the limits set in res to all controllers available to the
+// cgroup. Limits that are not set in res are left unchanged.
+func (c *cgroupV2) Update(res *specs.LinuxResources) error {
+	log.Debugf("Updating cgroup path %q", c.MakePath(""))
+	for _, controllerName := range c.Controllers {
+		ctrlr, ok := controllers2[controllerName]
+		if !ok {
+			continue
+		}
+		if err := ctrlr.set(res, c.MakePath("")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Uninstall removes the settings done in Install(). If cgroup path already
 // existed when Install() was called, Uninstall is a noop.
 func (c *cgroupV2) Uninstall() error {
@@ -311,6 +327,23 @@ func (c *cgroupV2) MemoryLimit() (uint64, error) {
 	return strconv.ParseUint(limStr, 10, 64)
 }
 
+// Pressure returns the pressure stall information for resource.
+func (c *cgroupV2) Pressure(resource PressureResource) (*Pressure, error) {
+	return readPressure(c.MakePath(""), resource)
+}
+
+// WatchPressure calls fn each time the pressure trigger fires, until ctx is
+// done or the cgroup is removed.
+func (c *cgroupV2) WatchPressure(ctx context.Context, trigger PressureTrigger, fn func()) error {
+	return watchPressure(ctx, c.MakePath(""), trigger, fn)
+}
+
+// OpenPressureTrigger returns the pressure file of the cgroup with trigger
+// set on it, which can be polled for POLLPRI.
+func (c *cgroupV2) OpenPressureTrigger(trigger PressureTrigger) (*os.File, error) {
+	return openPressureTrigger(c.MakePath(""), trigger)
+}
+
 // MakePath builds a path to the given controller.
 func (c *cgroupV2) MakePath(controllerName string) string {
 	return filepath.Join(c.Mountpoint, c.Path)
@@ -21,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"gvisor.dev/gvisor/pkg/test/testutil"
@@ -356,3 +357,111 @@ func TestParseCPUQuota(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePressure(t *testing.T) {
+	cases := []struct {
+		data     string
+		expected Pressure
+		expErr   bool
+	}{
+		{
+			data: "some avg10=1.50 avg60=0.25 avg300=0.00 total=12345\nfull avg10=0.50 avg60=0.10 avg300=0.00 total=678\n",
+			expected: Pressure{
+				Some: PressureStats{Avg10: 1.5, Avg60: 0.25, Total: 12345},
+				Full: PressureStats{Avg10: 0.5, Avg60: 0.1, Total: 678},
+			},
+		},
+		{
+			// cpu.pressure only has a "some" line on older kernels.
+			data: "some avg10=0.00 avg60=0.00 avg300=3.00 total=1\n",
+			expected: Pressure{
+				Some: PressureStats{Avg300: 3, Total: 1},
+			},
+		},
+		{
+			data:   "most avg10=0.00",
+			expErr: true,
+		},
+		{
+			data:   "some avg10=x",
+			expErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		res, err := parsePressure(c.data)
+		if c.expErr {
+			if err == nil {
+				t.Errorf("data: %q, expected error, got %+v, nil", c.data, res)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("data: %q, expected success, got error %s", c.data, err)
+			continue
+		}
+		if *res != c.expected {
+			t.Errorf("data: %q, expected %+v, got %+v", c.data, c.expected, *res)
+		}
+	}
+}
+
+func TestPressureTrigger(t *testing.T) {
+	trigger := PressureTrigger{
+		Resource: PressureMemory,
+		Stall:    150 * time.Millisecond,
+		Window:   2 * time.Second,
+	}
+	if err := trigger.Validate(); err != nil {
+		t.Errorf("Validate(%+v) failed: %v", trigger, err)
+	}
+	if got, want := trigger.String(), "some 150000 2000000"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, bad := range []PressureTrigger{
+		{Resource: "disk", Stall: time.Second, Window: 2 * time.Second},
+		{Resource: PressureCPU, Stall: time.Second, Window: 100 * time.Millisecond},
+		{Resource: PressureCPU, Stall: 3 * time.Second, Window: 2 * time.Second},
+		{Resource: PressureIO, Window: 2 * time.Second},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestUpdateCgroupv2(t *testing.T) {
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "cgroup")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := createDir(dir, map[string]string{"cpu.max": "", "cpu.weight": "", "memory.max": ""}); err != nil {
+		t.Fatalf("createDir(): %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cpuset.cpus"), []byte("0-3"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cg := &cgroupV2{
+		Mountpoint:  dir,
+		Controllers: []string{"cpu", "cpuset", "memory"},
+	}
+	res := &specs.LinuxResources{
+		CPU: &specs.LinuxCPU{
+			Quota:  int64Ptr(200000),
+			Period: uint64Ptr(100000),
+		},
+	}
+	if err := cg.Update(res); err != nil {
+		t.Fatalf("Update(): %v", err)
+	}
+	// Limits not set in res must be left unchanged.
+	checkDir(t, dir, map[string]string{
+		"cpu.max":     "200000 100000",
+		"cpu.weight":  "",
+		"cpuset.cpus": "0-3",
+		"memory.max":  "",
+	})
+}
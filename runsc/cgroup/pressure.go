@@ -0,0 +1,228 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// PressureResource is a resource for which the kernel reports pressure stall
+// information (PSI).
+type PressureResource string
+
+// Resources with pressure stall information.
+const (
+	PressureCPU    PressureResource = "cpu"
+	PressureMemory PressureResource = "memory"
+	PressureIO     PressureResource = "io"
+)
+
+// ParsePressureResource parses a PressureResource.
+func ParsePressureResource(s string) (PressureResource, error) {
+	switch r := PressureResource(s); r {
+	case PressureCPU, PressureMemory, PressureIO:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown pressure resource %q, must be one of cpu, memory or io", s)
+	}
+}
+
+// fileName returns the name of the cgroup file reporting pressure for r.
+func (r PressureResource) fileName() string {
+	return string(r) + ".pressure"
+}
+
+// PressureStats are the statistics for one line of a pressure file. Averages
+// are the percentage of wall time in which tasks were stalled.
+type PressureStats struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+
+	// Total is the total stall time, in microseconds.
+	Total uint64 `json:"total"`
+}
+
+// Pressure is the pressure stall information for a resource. See
+// Documentation/accounting/psi.rst in the Linux kernel.
+type Pressure struct {
+	// Some is the share of time in which at least some tasks were stalled.
+	Some PressureStats `json:"some"`
+
+	// Full is the share of time in which all non-idle tasks were stalled
+	// simultaneously.
+	Full PressureStats `json:"full"`
+}
+
+// parsePressure parses the contents of a pressure file.
+func parsePressure(data string) (*Pressure, error) {
+	var p Pressure
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var stats *PressureStats
+		switch fields[0] {
+		case "some":
+			stats = &p.Some
+		case "full":
+			stats = &p.Full
+		default:
+			return nil, fmt.Errorf("invalid pressure line %q", line)
+		}
+		for _, field := range fields[1:] {
+			key, val, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid pressure line %q", line)
+			}
+			var err error
+			switch key {
+			case "avg10":
+				stats.Avg10, err = strconv.ParseFloat(val, 64)
+			case "avg60":
+				stats.Avg60, err = strconv.ParseFloat(val, 64)
+			case "avg300":
+				stats.Avg300, err = strconv.ParseFloat(val, 64)
+			case "total":
+				stats.Total, err = strconv.ParseUint(val, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid pressure line %q: %w", line, err)
+			}
+		}
+	}
+	return &p, nil
+}
+
+// readPressure reads the pressure of resource for the cgroup at path.
+func readPressure(path string, resource PressureResource) (*Pressure, error) {
+	data, err := getValue(path, resource.fileName())
+	if err != nil {
+		return nil, err
+	}
+	return parsePressure(data)
+}
+
+// PressureTrigger configures WatchPressure.
+type PressureTrigger struct {
+	// Resource is the resource to watch.
+	Resource PressureResource
+
+	// Full watches for stalls of all tasks, rather than some tasks.
+	Full bool
+
+	// Stall is the stall time within Window that fires the trigger.
+	Stall time.Duration
+
+	// Window is the time window over which stalls are measured. The kernel
+	// accepts windows between 500ms and 10s; unprivileged users may only
+	// use multiples of 2s.
+	Window time.Duration
+}
+
+// String returns the trigger in the format written to pressure files.
+func (t PressureTrigger) String() string {
+	kind := "some"
+	if t.Full {
+		kind = "full"
+	}
+	return fmt.Sprintf("%s %d %d", kind, t.Stall.Microseconds(), t.Window.Microseconds())
+}
+
+// Validate checks that t is accepted by the kernel.
+func (t PressureTrigger) Validate() error {
+	if _, err := ParsePressureResource(string(t.Resource)); err != nil {
+		return err
+	}
+	if t.Window < 500*time.Millisecond || t.Window > 10*time.Second {
+		return fmt.Errorf("pressure window %v must be between 500ms and 10s", t.Window)
+	}
+	if t.Stall <= 0 || t.Stall > t.Window {
+		return fmt.Errorf("pressure stall %v must be positive and at most the window %v", t.Stall, t.Window)
+	}
+	return nil
+}
+
+// pressurePollInterval is how often watchPressure checks whether its context
+// is done.
+const pressurePollInterval = 250 * time.Millisecond
+
+// openPressureTrigger opens the pressure file of the cgroup at path and sets
+// trigger t on it. The trigger stays active as long as the file is open.
+func openPressureTrigger(path string, t PressureTrigger) (*os.File, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	name := filepath.Join(path, t.Resource.fileName())
+	f, err := os.OpenFile(name, os.O_RDWR|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write([]byte(t.String())); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("setting pressure trigger %q on %q: %w", t, name, err)
+	}
+	return f, nil
+}
+
+// watchPressure implements Cgroup.WatchPressure for the cgroup at path, using
+// the kernel's PSI trigger interface.
+func watchPressure(ctx context.Context, path string, t PressureTrigger, fn func()) error {
+	f, err := openPressureTrigger(path, t)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	name := f.Name()
+
+	// Don't use f.Fd(), which makes the file blocking.
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		var (
+			revents int16
+			pollErr error
+		)
+		if err := rc.Control(func(fd uintptr) {
+			fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLPRI}}
+			_, pollErr = unix.Poll(fds, int(pressurePollInterval.Milliseconds()))
+			revents = fds[0].Revents
+		}); err != nil {
+			return err
+		}
+		switch {
+		case pollErr == unix.EINTR:
+		case pollErr != nil:
+			return fmt.Errorf("polling %q: %w", name, pollErr)
+		case revents&unix.POLLERR != 0:
+			// The cgroup has been removed.
+			return fmt.Errorf("pressure trigger on %q is no longer valid", name)
+		case revents&unix.POLLPRI != 0:
+			fn()
+		}
+	}
+	return ctx.Err()
+}
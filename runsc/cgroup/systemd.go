@@ -138,6 +138,36 @@ func (c *cgroupSystemd) Install(res *specs.LinuxResources) error {
 	return nil
 }
 
+// Update implements Cgroup.Update. The limits are set both on the scope unit,
+// so that systemd does not revert them, and directly in the cgroup.
+func (c *cgroupSystemd) Update(res *specs.LinuxResources) error {
+	log.Debugf("Updating systemd cgroup %v", c.unitName())
+	var props []systemdDbus.Property
+	for _, controllerName := range c.Controllers {
+		ctrlr, ok := controllers2[controllerName]
+		if !ok {
+			continue
+		}
+		ctrlrProps, err := ctrlr.generateProperties(res)
+		if err != nil {
+			return err
+		}
+		props = append(props, ctrlrProps...)
+	}
+	if len(props) > 0 {
+		ctx := context.Background()
+		conn, err := systemdDbus.NewWithContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if err := conn.SetUnitPropertiesContext(ctx, c.unitName(), true /* runtime */, props...); err != nil {
+			return fmt.Errorf("systemd error: %v", err)
+		}
+	}
+	return c.cgroupV2.Update(res)
+}
+
 func (c *cgroupSystemd) unitName() string {
 	return fmt.Sprintf("%s-%s.scope", c.ScopePrefix, c.Name)
 }
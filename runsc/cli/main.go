@@ -243,6 +243,7 @@ func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 	cb(subcommands.FlagsCommand(), "")
 
 	// Register OCI user-facing runsc commands.
+	cb(new(cmd.Attach), "")
 	cb(new(cmd.Checkpoint), "")
 	cb(new(cmd.Create), "")
 	cb(new(cmd.Delete), "")
@@ -260,17 +261,23 @@ func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 	cb(new(cmd.Spec), "")
 	cb(new(cmd.Start), "")
 	cb(new(cmd.State), "")
+	cb(new(cmd.Update), "")
 	cb(new(cmd.Wait), "")
 
 	// Helpers.
 	const helperGroup = "helpers"
+	cb(new(cmd.ControlServer), helperGroup)
 	cb(new(cmd.Install), helperGroup)
 	cb(new(cmd.Mitigate), helperGroup)
 	cb(new(cmd.Uninstall), helperGroup)
 	cb(new(trace.Trace), helperGroup)
 
 	const debugGroup = "debug"
+	cb(new(cmd.Bisect), debugGroup)
 	cb(new(cmd.Debug), debugGroup)
+	cb(new(cmd.DebugFS), debugGroup)
+	cb(new(cmd.NetworkBench), debugGroup)
+	cb(new(cmd.PCAP), debugGroup)
 	cb(new(cmd.Statefile), debugGroup)
 	cb(new(cmd.Symbolize), debugGroup)
 	cb(new(cmd.Usage), debugGroup)
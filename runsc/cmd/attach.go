@@ -0,0 +1,236 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/console"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// detachKeys is the input sequence that detaches from an exec session:
+// Ctrl-P Ctrl-Q.
+var detachKeys = []byte{0x10, 0x11}
+
+// Attach implements subcommands.Command for the "attach" command.
+type Attach struct{}
+
+// Name implements subcommands.Command.Name.
+func (*Attach) Name() string {
+	return "attach"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Attach) Synopsis() string {
+	return "attach to the terminal of a process started with exec --session"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Attach) Usage() string {
+	return `attach <container-id> <pid> - attach to an exec session.
+
+Attaches the current terminal to the terminal of a process started with
+"runsc exec --session". Output produced while no client was attached is
+written first, and the window size of the current terminal is propagated to
+the session.
+
+Type Ctrl-P Ctrl-Q to detach. The process keeps running and can be attached
+to again. If the process exits while attached, attach exits with its status.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*Attach) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.Execute.
+func (*Attach) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	conf := args[0].(*config.Config)
+	waitStatus := args[1].(*unix.WaitStatus)
+
+	id := f.Arg(0)
+	pid, err := strconv.Atoi(f.Arg(1))
+	if err != nil {
+		util.Fatalf("invalid PID %q: %v", f.Arg(1), err)
+	}
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	return waitSession(c, int32(pid), waitStatus)
+}
+
+// waitSession attaches to the exec session of process pid until the user
+// detaches or the process exits. In the latter case, waitStatus is set to the
+// process's exit status.
+func waitSession(c *container.Container, pid int32, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
+	detached, err := attachSession(c, pid)
+	if err != nil {
+		return util.Errorf("attaching to exec session: %v", err)
+	}
+	if detached {
+		*waitStatus = 0
+		return subcommands.ExitSuccess
+	}
+	ws, err := c.WaitPID(pid)
+	if err != nil {
+		return util.Errorf("waiting on pid %d: %v", pid, err)
+	}
+	*waitStatus = ws
+	return subcommands.ExitSuccess
+}
+
+// attachSession connects the stdio of this process to the exec session of
+// process pid, until the user detaches or the session's terminal is closed.
+// It returns true if the user detached.
+func attachSession(c *container.Container, pid int32) (bool, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return false, fmt.Errorf("creating socket pair: %w", err)
+	}
+	conn := os.NewFile(uintptr(fds[0]), "exec-session-client")
+	defer conn.Close()
+	remote := os.NewFile(uintptr(fds[1]), "exec-session")
+	err = c.AttachExecSession(pid, remote)
+	remote.Close()
+	if err != nil {
+		return false, err
+	}
+
+	if console.IsPty(os.Stdin.Fd()) {
+		// Special characters are handled by the session's terminal.
+		restore, err := console.MakeRaw(os.Stdin.Fd())
+		if err != nil {
+			return false, fmt.Errorf("setting terminal to raw mode: %w", err)
+		}
+		defer restore()
+		stop := forwardWindowSize(c, pid)
+		defer stop()
+	}
+
+	detached := make(chan struct{})
+	go func() {
+		var d detachFilter
+		b := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(b)
+			in, detach := d.filter(b[:n])
+			if len(in) > 0 {
+				if _, err := conn.Write(in); err != nil {
+					return
+				}
+			}
+			if detach || err != nil {
+				break
+			}
+		}
+		// Once it sees EOF, the sandbox detaches the connection and closes
+		// its end, which ends the output copy below.
+		close(detached)
+		_ = unix.Shutdown(int(conn.Fd()), unix.SHUT_WR)
+	}()
+
+	if _, err := io.Copy(os.Stdout, conn); err != nil {
+		return false, fmt.Errorf("copying output: %w", err)
+	}
+	select {
+	case <-detached:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// forwardWindowSize sets the window size of the exec session of process pid
+// to that of the terminal on stdin, now and whenever it changes. It returns a
+// function that stops forwarding.
+func forwardWindowSize(c *container.Container, pid int32) func() {
+	resize := func() {
+		rows, cols, err := console.WindowSize(os.Stdin.Fd())
+		if err != nil {
+			log.Warningf("Getting window size: %v", err)
+			return
+		}
+		if err := c.ResizeExecSession(pid, rows, cols); err != nil {
+			log.Warningf("Resizing exec session: %v", err)
+		}
+	}
+	resize()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, unix.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				resize()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// detachFilter finds detachKeys in terminal input.
+type detachFilter struct {
+	// matched is the number of bytes of detachKeys at the end of the input
+	// seen so far. They are held back until it is known whether they are
+	// part of detachKeys.
+	matched int
+}
+
+// filter returns the part of b to write to the session, and whether b
+// completes detachKeys. Input after detachKeys is dropped.
+func (d *detachFilter) filter(b []byte) ([]byte, bool) {
+	out := make([]byte, 0, d.matched+len(b))
+	for _, c := range b {
+		if c == detachKeys[d.matched] {
+			d.matched++
+			if d.matched == len(detachKeys) {
+				return out, true
+			}
+			continue
+		}
+		out = append(out, detachKeys[:d.matched]...)
+		d.matched = 0
+		if c == detachKeys[0] {
+			d.matched = 1
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, false
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetachFilter(t *testing.T) {
+	const (
+		ctrlP = 0x10
+		ctrlQ = 0x11
+	)
+	for _, tc := range []struct {
+		name       string
+		input      [][]byte
+		wantOut    []byte
+		wantDetach bool
+	}{
+		{
+			name:    "plain",
+			input:   [][]byte{[]byte("ls\r")},
+			wantOut: []byte("ls\r"),
+		},
+		{
+			name:       "detach",
+			input:      [][]byte{{'a', ctrlP, ctrlQ, 'b'}},
+			wantOut:    []byte("a"),
+			wantDetach: true,
+		},
+		{
+			name:       "split detach",
+			input:      [][]byte{{'a', ctrlP}, {ctrlQ}},
+			wantOut:    []byte("a"),
+			wantDetach: true,
+		},
+		{
+			name:    "ctrl-p alone",
+			input:   [][]byte{{ctrlP, 'a'}, {ctrlP}, {'b'}},
+			wantOut: []byte{ctrlP, 'a', ctrlP, 'b'},
+		},
+		{
+			name:       "repeated ctrl-p",
+			input:      [][]byte{{ctrlP, ctrlP, ctrlQ}},
+			wantOut:    []byte{ctrlP},
+			wantDetach: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var d detachFilter
+			var out []byte
+			detach := false
+			for _, in := range tc.input {
+				b, done := d.filter(in)
+				out = append(out, b...)
+				if done {
+					detach = true
+					break
+				}
+			}
+			if !bytes.Equal(out, tc.wantOut) || detach != tc.wantDetach {
+				t.Errorf("filter got (%q, %t), want (%q, %t)", out, detach, tc.wantOut, tc.wantDetach)
+			}
+		})
+	}
+}
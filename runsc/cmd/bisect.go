@@ -0,0 +1,467 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// bisectSkipExitCode is the exit code of repro scripts that cannot test a
+// candidate, as for "git bisect run".
+const bisectSkipExitCode = 125
+
+// Bisect implements subcommands.Command for the "bisect" command.
+type Bisect struct {
+	script      string
+	runs        int
+	timeout     time.Duration
+	sandbox     bool
+	runscFlags  string
+	workDir     string
+	repo        string
+	good        string
+	bad         string
+	buildCmd    string
+	buildOutput string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Bisect) Name() string {
+	return "bisect"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Bisect) Synopsis() string {
+	return "Find the runsc build that introduced a compatibility regression. It's to be used for development only."
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Bisect) Usage() string {
+	return `bisect [flags] -script <repro> <good-runsc> [<runsc>...] <bad-runsc>
+bisect [flags] -script <repro> -repo <dir> -good <commit> -bad <commit>
+
+Bisects a list of runsc builds, ordered from oldest to newest, to find the
+first one for which the repro script fails. Builds are either given on the
+command line, or built from the first-parent history of a gVisor git
+repository between the good and bad commits, using -build-cmd.
+
+The repro script is run with the runsc build being tested in the RUNSC
+environment variable. By default, the script is run inside a sandbox created
+by "$RUNSC do", using a fresh state directory that is torn down after each
+run. With -sandbox=false, the script runs on the host and is responsible for
+invoking $RUNSC itself, e.g. through docker.
+
+As for "git bisect run", the script exits with status 0 if the build is
+good, 125 if the build cannot be tested, and any other status if the build is
+bad. Runs that time out are considered bad. The output of each run is saved
+in the work directory.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (b *Bisect) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&b.script, "script", "", "repro script: exits with 0 if the build is good, 125 if it cannot be tested, and any other status if it is bad")
+	f.IntVar(&b.runs, "runs", 1, "number of times the script is run for each build; a build is bad if any run is bad, which helps with flaky regressions")
+	f.DurationVar(&b.timeout, "timeout", 5*time.Minute, "timeout for each run of the script, after which the build is considered bad")
+	f.BoolVar(&b.sandbox, "sandbox", true, `run the script inside a sandbox with "$RUNSC do"`)
+	f.StringVar(&b.runscFlags, "runsc-flags", "", `space-separated flags passed to "$RUNSC" before "do", e.g. "--rootless --network=none"`)
+	f.StringVar(&b.workDir, "work-dir", "", "directory for builds and run outputs; defaults to a new temporary directory")
+	f.StringVar(&b.repo, "repo", "", "gVisor git repository to build candidates from")
+	f.StringVar(&b.good, "good", "", "known good commit in -repo")
+	f.StringVar(&b.bad, "bad", "", "known bad commit in -repo")
+	f.StringVar(&b.buildCmd, "build-cmd", "bazel build //runsc", "shell command that builds runsc in -repo")
+	f.StringVar(&b.buildOutput, "build-output", "bazel-bin/runsc/runsc_/runsc", "path of the runsc binary built by -build-cmd, relative to -repo")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (b *Bisect) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	gitMode := b.repo != ""
+	if b.script == "" || b.runs < 1 || (gitMode && (b.good == "" || b.bad == "" || f.NArg() != 0)) || (!gitMode && f.NArg() < 2) {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	script, err := filepath.Abs(b.script)
+	if err != nil {
+		return util.Errorf("resolving script path: %v", err)
+	}
+	b.script = script
+	if b.workDir == "" {
+		if b.workDir, err = os.MkdirTemp("", "runsc-bisect-"); err != nil {
+			return util.Errorf("creating work directory: %v", err)
+		}
+	} else if err := os.MkdirAll(b.workDir, 0755); err != nil {
+		return util.Errorf("creating work directory: %v", err)
+	}
+	util.Infof("Work directory: %s", b.workDir)
+
+	var cs bisectCandidates
+	if gitMode {
+		gc, err := newGitCandidates(ctx, b)
+		if err != nil {
+			return util.Errorf("listing commits: %v", err)
+		}
+		defer gc.cleanup()
+		cs = gc
+	} else {
+		var binaries []string
+		for _, arg := range f.Args() {
+			binary, err := filepath.Abs(arg)
+			if err != nil {
+				return util.Errorf("resolving path of %q: %v", arg, err)
+			}
+			binaries = append(binaries, binary)
+		}
+		cs = binaryCandidates(binaries)
+	}
+
+	n := cs.len()
+	util.Infof("Bisecting %d candidates between %s and %s", n, cs.name(0), cs.name(n-1))
+	test := func(i int) (bisectVerdict, error) {
+		v, err := b.test(ctx, cs, i)
+		if err != nil {
+			return v, err
+		}
+		util.Infof("%s: %v", cs.name(i), v)
+		return v, nil
+	}
+	// Check the endpoints first, as "git bisect" does, since a wrong
+	// assumption about them makes the result meaningless.
+	if v, err := test(0); err != nil {
+		return util.Errorf("testing %s: %v", cs.name(0), err)
+	} else if v != bisectGood {
+		return util.Errorf("good candidate %s is %v", cs.name(0), v)
+	}
+	if v, err := test(n - 1); err != nil {
+		return util.Errorf("testing %s: %v", cs.name(n-1), err)
+	} else if v != bisectBad {
+		return util.Errorf("bad candidate %s is %v", cs.name(n-1), v)
+	}
+
+	lastGood, firstBad, err := bisect(n, test)
+	if err != nil {
+		return util.Errorf("bisecting: %v", err)
+	}
+	if firstBad-lastGood == 1 {
+		util.Infof("First bad candidate: %s (last good: %s)", cs.name(firstBad), cs.name(lastGood))
+		return subcommands.ExitSuccess
+	}
+	util.Infof("Could not test all candidates. The first bad candidate is one of:")
+	for i := lastGood + 1; i <= firstBad; i++ {
+		util.Infof("  %s", cs.name(i))
+	}
+	return subcommands.ExitSuccess
+}
+
+// test runs the repro script against candidate i, up to b.runs times.
+func (b *Bisect) test(ctx context.Context, cs bisectCandidates, i int) (bisectVerdict, error) {
+	binary, err := cs.binary(ctx, i)
+	if err != nil {
+		// A build failure makes the candidate untestable, but shouldn't end
+		// the bisection.
+		util.Infof("%s: cannot be built: %v", cs.name(i), err)
+		return bisectSkip, nil
+	}
+	verdict := bisectSkip
+	for run := 0; run < b.runs; run++ {
+		logPath := filepath.Join(b.workDir, fmt.Sprintf("%s.run%d.log", sanitizeCandidateName(cs.name(i)), run))
+		v, err := b.runScript(ctx, binary, logPath)
+		if err != nil {
+			return bisectSkip, err
+		}
+		switch v {
+		case bisectBad:
+			util.Infof("%s: run %d failed, see %s", cs.name(i), run, logPath)
+			return bisectBad, nil
+		case bisectGood:
+			verdict = bisectGood
+		}
+	}
+	return verdict, nil
+}
+
+// runScript runs the repro script once with the given runsc binary, writing
+// its output to logPath, and classifies the result.
+func (b *Bisect) runScript(ctx context.Context, binary, logPath string) (bisectVerdict, error) {
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return bisectSkip, err
+	}
+	defer logFile.Close()
+
+	stateDir, err := os.MkdirTemp(b.workDir, "state-")
+	if err != nil {
+		return bisectSkip, err
+	}
+	defer os.RemoveAll(stateDir)
+	runscArgs := append([]string{"--root=" + stateDir}, strings.Fields(b.runscFlags)...)
+	defer b.teardown(binary, runscArgs)
+
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if b.sandbox {
+		cmd = exec.CommandContext(ctx, binary, append(runscArgs[:len(runscArgs):len(runscArgs)], "do", b.script)...)
+	} else {
+		cmd = exec.CommandContext(ctx, b.script)
+	}
+	cmd.Env = append(os.Environ(), "RUNSC="+binary)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// Kill the whole process group on timeout, since the script may have
+	// started other processes.
+	cmd.SysProcAttr = &unix.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return unix.Kill(-cmd.Process.Pid, unix.SIGKILL)
+	}
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		fmt.Fprintf(logFile, "\nrunsc bisect: timed out after %v\n", b.timeout)
+		return bisectBad, nil
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return bisectGood, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == bisectSkipExitCode:
+		return bisectSkip, nil
+	case errors.As(err, &exitErr):
+		return bisectBad, nil
+	default:
+		return bisectSkip, err
+	}
+}
+
+// teardown destroys sandboxes left behind by a run of the repro script.
+func (b *Bisect) teardown(binary string, runscArgs []string) {
+	out, err := exec.Command(binary, append(runscArgs, "list", "-quiet")...).Output()
+	if err != nil {
+		log.Warningf("Listing leftover containers: %v", err)
+		return
+	}
+	for _, id := range strings.Fields(string(out)) {
+		if err := exec.Command(binary, append(runscArgs, "delete", "-force", id)...).Run(); err != nil {
+			log.Warningf("Deleting leftover container %q: %v", id, err)
+		}
+	}
+}
+
+// sanitizeCandidateName returns name, usable as a file name.
+func sanitizeCandidateName(name string) string {
+	return strings.NewReplacer("/", "_", " ", "_").Replace(strings.TrimPrefix(name, "/"))
+}
+
+// bisectVerdict is the result of testing a candidate.
+type bisectVerdict int
+
+const (
+	bisectGood bisectVerdict = iota
+	bisectBad
+	bisectSkip
+)
+
+// String implements fmt.Stringer.String.
+func (v bisectVerdict) String() string {
+	switch v {
+	case bisectGood:
+		return "good"
+	case bisectBad:
+		return "bad"
+	case bisectSkip:
+		return "skipped"
+	default:
+		return fmt.Sprintf("bisectVerdict(%d)", int(v))
+	}
+}
+
+// bisect finds the first bad candidate among n candidates, given that
+// candidate 0 is good and candidate n-1 is bad. test is called to classify
+// candidates in between. It returns the last known good candidate and the
+// first known bad candidate; they are only adjacent if no candidate between
+// them had to be skipped.
+func bisect(n int, test func(i int) (bisectVerdict, error)) (lastGood, firstBad int, err error) {
+	lastGood, firstBad = 0, n-1
+	skipped := make(map[int]bool)
+	for {
+		i, ok := nextBisectCandidate(lastGood, firstBad, skipped)
+		if !ok {
+			return lastGood, firstBad, nil
+		}
+		v, err := test(i)
+		if err != nil {
+			return lastGood, firstBad, err
+		}
+		switch v {
+		case bisectGood:
+			lastGood = i
+		case bisectBad:
+			firstBad = i
+		default:
+			skipped[i] = true
+		}
+	}
+}
+
+// nextBisectCandidate returns the untested candidate strictly between
+// lastGood and firstBad that is closest to their midpoint, if any.
+func nextBisectCandidate(lastGood, firstBad int, skipped map[int]bool) (int, bool) {
+	mid := lastGood + (firstBad-lastGood)/2
+	for d := 0; mid-d > lastGood || mid+d < firstBad; d++ {
+		for _, i := range []int{mid - d, mid + d} {
+			if i > lastGood && i < firstBad && !skipped[i] {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// bisectCandidates is an ordered list of runsc builds.
+type bisectCandidates interface {
+	// len returns the number of candidates.
+	len() int
+
+	// name returns a human-readable name for candidate i.
+	name(i int) string
+
+	// binary returns the path of the runsc binary of candidate i, building
+	// it if needed.
+	binary(ctx context.Context, i int) (string, error)
+}
+
+// binaryCandidates are prebuilt runsc binaries.
+type binaryCandidates []string
+
+func (bc binaryCandidates) len() int {
+	return len(bc)
+}
+
+func (bc binaryCandidates) name(i int) string {
+	return bc[i]
+}
+
+func (bc binaryCandidates) binary(_ context.Context, i int) (string, error) {
+	if _, err := os.Stat(bc[i]); err != nil {
+		return "", err
+	}
+	return bc[i], nil
+}
+
+// gitCandidates are runsc binaries built from commits of a git repository,
+// in a dedicated worktree so that the repository itself is left untouched.
+type gitCandidates struct {
+	b        *Bisect
+	commits  []string
+	worktree string
+	built    map[int]string
+}
+
+func newGitCandidates(ctx context.Context, b *Bisect) (*gitCandidates, error) {
+	good, err := gitOutput(ctx, b.repo, "rev-parse", "--verify", b.good+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	bad, err := gitOutput(ctx, b.repo, "rev-parse", "--verify", b.bad+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	revs, err := gitOutput(ctx, b.repo, "rev-list", "--reverse", "--first-parent", good+".."+bad)
+	if err != nil {
+		return nil, err
+	}
+	commits := append([]string{good}, strings.Fields(revs)...)
+	if len(commits) < 2 || commits[len(commits)-1] != bad {
+		return nil, fmt.Errorf("%s is not a first-parent ancestor of %s", b.good, b.bad)
+	}
+	worktree := filepath.Join(b.workDir, "worktree")
+	if _, err := gitOutput(ctx, b.repo, "worktree", "add", "--detach", worktree, good); err != nil {
+		return nil, err
+	}
+	return &gitCandidates{
+		b:        b,
+		commits:  commits,
+		worktree: worktree,
+		built:    make(map[int]string),
+	}, nil
+}
+
+func (gc *gitCandidates) len() int {
+	return len(gc.commits)
+}
+
+func (gc *gitCandidates) name(i int) string {
+	return gc.commits[i]
+}
+
+func (gc *gitCandidates) binary(ctx context.Context, i int) (string, error) {
+	if binary, ok := gc.built[i]; ok {
+		return binary, nil
+	}
+	if _, err := gitOutput(ctx, gc.worktree, "checkout", "--quiet", "--detach", gc.commits[i]); err != nil {
+		return "", err
+	}
+	util.Infof("Building %s", gc.commits[i])
+	build := exec.CommandContext(ctx, "/bin/sh", "-c", gc.b.buildCmd)
+	build.Dir = gc.worktree
+	if out, err := build.CombinedOutput(); err != nil {
+		logPath := filepath.Join(gc.b.workDir, gc.commits[i]+".build.log")
+		if err := os.WriteFile(logPath, out, 0644); err != nil {
+			log.Warningf("Writing build log: %v", err)
+		}
+		return "", fmt.Errorf("%q failed: %v, see %s", gc.b.buildCmd, err, logPath)
+	}
+	// Copy the binary, since the next build overwrites it.
+	data, err := os.ReadFile(filepath.Join(gc.worktree, gc.b.buildOutput))
+	if err != nil {
+		return "", err
+	}
+	binary := filepath.Join(gc.b.workDir, "runsc-"+gc.commits[i])
+	if err := os.WriteFile(binary, data, 0755); err != nil {
+		return "", err
+	}
+	gc.built[i] = binary
+	return binary, nil
+}
+
+// cleanup removes the worktree.
+func (gc *gitCandidates) cleanup() {
+	if _, err := gitOutput(context.Background(), gc.b.repo, "worktree", "remove", "--force", gc.worktree); err != nil {
+		log.Warningf("Removing worktree %q: %v", gc.worktree, err)
+	}
+}
+
+// gitOutput runs git in dir and returns its trimmed output.
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestBisect(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		n            int
+		firstBad     int
+		skipped      []int
+		wantLastGood int
+		wantFirstBad int
+	}{
+		{
+			name:         "adjacent",
+			n:            2,
+			firstBad:     1,
+			wantLastGood: 0,
+			wantFirstBad: 1,
+		},
+		{
+			name:         "first",
+			n:            100,
+			firstBad:     1,
+			wantLastGood: 0,
+			wantFirstBad: 1,
+		},
+		{
+			name:         "last",
+			n:            100,
+			firstBad:     99,
+			wantLastGood: 98,
+			wantFirstBad: 99,
+		},
+		{
+			name:         "middle",
+			n:            37,
+			firstBad:     20,
+			wantLastGood: 19,
+			wantFirstBad: 20,
+		},
+		{
+			name:         "skipped neighbors",
+			n:            50,
+			firstBad:     20,
+			skipped:      []int{18, 22, 25},
+			wantLastGood: 19,
+			wantFirstBad: 20,
+		},
+		{
+			name:         "skipped first bad",
+			n:            50,
+			firstBad:     20,
+			skipped:      []int{19, 20},
+			wantLastGood: 18,
+			wantFirstBad: 21,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			skipped := make(map[int]bool)
+			for _, i := range tc.skipped {
+				skipped[i] = true
+			}
+			tested := make(map[int]bool)
+			lastGood, firstBad, err := bisect(tc.n, func(i int) (bisectVerdict, error) {
+				if i <= 0 || i >= tc.n-1 {
+					t.Errorf("endpoint %d tested", i)
+				}
+				if tested[i] {
+					t.Errorf("candidate %d tested twice", i)
+				}
+				tested[i] = true
+				switch {
+				case skipped[i]:
+					return bisectSkip, nil
+				case i < tc.firstBad:
+					return bisectGood, nil
+				default:
+					return bisectBad, nil
+				}
+			})
+			if err != nil {
+				t.Fatalf("bisect failed: %v", err)
+			}
+			if lastGood != tc.wantLastGood || firstBad != tc.wantFirstBad {
+				t.Errorf("bisect got (%d, %d), want (%d, %d)", lastGood, firstBad, tc.wantLastGood, tc.wantFirstBad)
+			}
+		})
+	}
+}
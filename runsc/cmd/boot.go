@@ -85,6 +85,14 @@ type Boot struct {
 	// upper mount in the overlay mounts.
 	overlayFilestoreFDs intFlags
 
+	// virtiofsFDs are FDs connected to the virtio-fs servers for virtiofs
+	// mounts, in the same order as mounts appear in the spec.
+	virtiofsFDs intFlags
+
+	// nfsFDs are FDs connected to the servers of NFS mounts, in the order
+	// they are defined in the spec.
+	nfsFDs intFlags
+
 	// overlayMediums contains information about how the gofer mounts have been
 	// overlaid. The first entry is for rootfs and the following entries are for
 	// bind mounts in Spec.Mounts (in the same order).
@@ -120,6 +128,17 @@ type Boot struct {
 	// userLogFD is the file descriptor to write user logs to.
 	userLogFD int
 
+	// straceJSONFD is the file descriptor to write JSON strace records to.
+	straceJSONFD int
+
+	// swapFileFD is the file descriptor of the host file used to store
+	// swapped pages.
+	swapFileFD int
+
+	// memoryPressureFD is the file descriptor of the sandbox cgroup's
+	// memory.pressure file, with a pressure trigger set.
+	memoryPressureFD int
+
 	// startSyncFD is the file descriptor to synchronize runsc and sandbox.
 	startSyncFD int
 
@@ -130,6 +149,14 @@ type Boot struct {
 
 	podInitConfigFD int
 
+	// syscallFilterProfileFD is the file descriptor to the syscall filter
+	// profile passed in the --syscall-filter-profile flag, or -1.
+	syscallFilterProfileFD int
+
+	// seccompCacheFD is the file descriptor of the directory where the
+	// sentry's seccomp program is cached with --seccomp-cache, or -1.
+	seccompCacheFD int
+
 	sinkFDs intFlags
 
 	// pidns is set if the sandbox is in its own pid namespace.
@@ -200,10 +227,17 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&b.execFD, "exec-fd", -1, "host file descriptor used for program execution.")
 	f.Var(&b.overlayFilestoreFDs, "overlay-filestore-fds", "FDs to the regular files that will back the tmpfs upper mount in the overlay mounts.")
 	f.Var(&b.overlayMediums, "overlay-mediums", "information about how the gofer mounts have been overlaid.")
+	f.Var(&b.virtiofsFDs, "virtiofs-fds", "list of FDs connected to virtio-fs servers for virtiofs mounts, in the order they are defined in the spec.")
+	f.Var(&b.nfsFDs, "nfs-fds", "list of FDs connected to the servers of NFS mounts, in the order they are defined in the spec.")
 	f.IntVar(&b.userLogFD, "user-log-fd", 0, "file descriptor to write user logs to. 0 means no logging.")
+	f.IntVar(&b.straceJSONFD, "strace-json-fd", -1, "file descriptor to write JSON strace records to. -1 disables JSON strace.")
+	f.IntVar(&b.swapFileFD, "swap-file-fd", -1, "file descriptor of the host file used to store swapped pages with --swap=file.")
+	f.IntVar(&b.memoryPressureFD, "memory-pressure-fd", -1, "file descriptor of the sandbox cgroup's memory.pressure file, with a trigger set, used to evict cached file data under memory pressure.")
 	f.IntVar(&b.startSyncFD, "start-sync-fd", -1, "required FD to used to synchronize sandbox startup")
 	f.IntVar(&b.mountsFD, "mounts-fd", -1, "mountsFD is the file descriptor to read list of mounts after they have been resolved (direct paths, no symlinks).")
 	f.IntVar(&b.podInitConfigFD, "pod-init-config-fd", -1, "file descriptor to the pod init configuration file.")
+	f.IntVar(&b.syscallFilterProfileFD, "syscall-filter-profile-fd", -1, "file descriptor to the syscall filter profile.")
+	f.IntVar(&b.seccompCacheFD, "seccomp-cache-fd", -1, "file descriptor of the directory where the seccomp program is cached.")
 	f.Var(&b.sinkFDs, "sink-fds", "ordered list of file descriptors to be used by the sinks defined in --pod-init-config.")
 	f.Var(&b.nvidiaDevMinors, "nvidia-dev-minors", "list of device minors for Nvidia GPU devices exposed to the sandbox.")
 
@@ -414,25 +448,32 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 
 	// Create the loader.
 	bootArgs := boot.Args{
-		ID:                  f.Arg(0),
-		Spec:                spec,
-		Conf:                conf,
-		ControllerFD:        b.controllerFD,
-		Device:              os.NewFile(uintptr(b.deviceFD), "platform device"),
-		GoferFDs:            b.ioFDs.GetArray(),
-		StdioFDs:            b.stdioFDs.GetArray(),
-		PassFDs:             b.passFDs.GetArray(),
-		ExecFD:              b.execFD,
-		OverlayFilestoreFDs: b.overlayFilestoreFDs.GetArray(),
-		OverlayMediums:      b.overlayMediums.GetArray(),
-		NumCPU:              b.cpuNum,
-		TotalMem:            b.totalMem,
-		TotalHostMem:        b.totalHostMem,
-		UserLogFD:           b.userLogFD,
-		ProductName:         b.productName,
-		PodInitConfigFD:     b.podInitConfigFD,
-		SinkFDs:             b.sinkFDs.GetArray(),
-		ProfileOpts:         b.profileFDs.ToOpts(),
+		ID:                     f.Arg(0),
+		Spec:                   spec,
+		Conf:                   conf,
+		ControllerFD:           b.controllerFD,
+		Device:                 os.NewFile(uintptr(b.deviceFD), "platform device"),
+		GoferFDs:               b.ioFDs.GetArray(),
+		StdioFDs:               b.stdioFDs.GetArray(),
+		PassFDs:                b.passFDs.GetArray(),
+		ExecFD:                 b.execFD,
+		OverlayFilestoreFDs:    b.overlayFilestoreFDs.GetArray(),
+		OverlayMediums:         b.overlayMediums.GetArray(),
+		VirtiofsFDs:            b.virtiofsFDs.GetArray(),
+		NFSFDs:                 b.nfsFDs.GetArray(),
+		NumCPU:                 b.cpuNum,
+		TotalMem:               b.totalMem,
+		TotalHostMem:           b.totalHostMem,
+		UserLogFD:              b.userLogFD,
+		StraceJSONFD:           b.straceJSONFD,
+		SwapFileFD:             b.swapFileFD,
+		MemoryPressureFD:       b.memoryPressureFD,
+		ProductName:            b.productName,
+		PodInitConfigFD:        b.podInitConfigFD,
+		SyscallFilterProfileFD: b.syscallFilterProfileFD,
+		SeccompCacheFD:         b.seccompCacheFD,
+		SinkFDs:                b.sinkFDs.GetArray(),
+		ProfileOpts:            b.profileFDs.ToOpts(),
 	}
 	l, err := boot.New(bootArgs)
 	if err != nil {
@@ -455,6 +496,11 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 	// This needs to happen after the kernel is initialized (such that all metrics are registered)
 	// but before the start-sync file is notified, as the parent process needs to query for
 	// registered metrics prior to sending the start signal.
+	if conf.MetricServer != "" {
+		// Latency histograms on hot paths are only worth their cost when
+		// something will export them.
+		metric.EnableHotPathTimers()
+	}
 	metric.Initialize()
 	if metric.ProfilingMetricWriter != nil {
 		if err := metric.StartProfilingMetrics(conf.ProfilingMetrics, time.Duration(conf.ProfilingMetricsRate)*time.Microsecond); err != nil {
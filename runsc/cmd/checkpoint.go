@@ -39,6 +39,10 @@ type Checkpoint struct {
 	imagePath    string
 	leaveRunning bool
 	compression  CheckpointCompression
+	migrateTo    string
+	migrate      migrateFlags
+	precopy      bool
+	chunkStore   string
 }
 
 // Name implements subcommands.Command.Name.
@@ -54,6 +58,12 @@ func (*Checkpoint) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Checkpoint) Usage() string {
 	return `checkpoint [flags] <container id> - save current state of container.
+checkpoint inspect [flags] <image path> - show the contents of a saved image.
+	-detail: report object counts and sizes per type.
+	-key: the integrity key for the image.
+	-limit: maximum number of types to report with -detail, 0 for all.
+checkpoint compact -chunk-store=<dir> [<image path>...] - remove chunks not
+	referenced by any of the given images from a chunk store.
 `
 }
 
@@ -61,7 +71,11 @@ func (*Checkpoint) Usage() string {
 func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.imagePath, "image-path", "", "directory path to saved container image")
 	f.BoolVar(&c.leaveRunning, "leave-running", false, "restart the container after checkpointing")
-	f.Var(newCheckpointCompressionValue(statefile.CompressionLevelFlateBestSpeed, &c.compression), "compression", "compress checkpoint image on disk. Values: none|flate-best-speed.")
+	f.Var(newCheckpointCompressionValue(statefile.CompressionLevelFlateBestSpeed, &c.compression), "compression", "compress checkpoint image on disk. Values: none|flate-best-speed|lz4.")
+	f.StringVar(&c.migrateTo, "migrate-to", "", "stream the checkpoint image to \"runsc restore -migrate-from\" listening on this host:port, instead of saving it to -image-path")
+	c.migrate.setFlags(f)
+	f.BoolVar(&c.precopy, "migrate-precopy", false, "with -migrate-to, copy memory to the destination while the container keeps running, and only copy memory that changed since once it's paused")
+	f.StringVar(&c.chunkStore, "chunk-store", "", "directory of a chunk store to save memory contents to. Memory that is already in the store, e.g. from an earlier checkpoint, is not written again")
 
 	// Unimplemented flags necessary for compatibility with docker.
 	var wp string
@@ -70,6 +84,12 @@ func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
 
 // Execute implements subcommands.Command.Execute.
 func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() > 0 && f.Arg(0) == checkpointInspectCmd {
+		return new(checkpointInspect).execute(f.Args()[1:])
+	}
+	if f.NArg() > 0 && f.Arg(0) == checkpointCompactCmd {
+		return new(checkpointCompact).execute(f.Args()[1:])
+	}
 	if f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
@@ -84,6 +104,25 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) su
 		util.Fatalf("loading container: %v", err)
 	}
 
+	if c.migrateTo != "" {
+		if c.imagePath != "" || c.leaveRunning || c.chunkStore != "" {
+			util.Fatalf("migrate-to cannot be used with image-path, leave-running or chunk-store")
+		}
+		conn, err := c.migrate.dial(c.migrateTo)
+		if err != nil {
+			util.Fatalf("connecting to migration destination: %v", err)
+		}
+		defer conn.Close()
+		if err := c.migrate.send(conn, cont, statefile.Options{Compression: c.compression.Level()}, c.precopy); err != nil {
+			util.Fatalf("migration failed: %v", err)
+		}
+		// The container now runs on the destination.
+		if err := cont.Destroy(); err != nil {
+			util.Fatalf("destroying container: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
 	if c.imagePath == "" {
 		util.Fatalf("image-path flag must be provided")
 	}
@@ -101,7 +140,23 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) su
 	}
 	defer file.Close()
 
-	if err := cont.Checkpoint(file, statefile.Options{Compression: c.compression.Level()}); err != nil {
+	if c.chunkStore != "" {
+		chunks, release, err := openChunkStore(c.chunkStore, true)
+		if err != nil {
+			util.Fatalf("opening chunk store: %v", err)
+		}
+		refsPath := filepath.Join(c.imagePath, checkpointChunksFileName)
+		chunks.Refs, err = os.OpenFile(refsPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			util.Fatalf("os.OpenFile(%q) failed: %v", refsPath, err)
+		}
+		err = cont.CheckpointToChunkStore(file, chunks, statefile.Options{Compression: c.compression.Level()})
+		chunks.Refs.Close()
+		release()
+		if err != nil {
+			util.Fatalf("checkpoint failed: %v", err)
+		}
+	} else if err := cont.Checkpoint(file, statefile.Options{Compression: c.compression.Level()}); err != nil {
 		util.Fatalf("checkpoint failed: %v", err)
 	}
 
@@ -148,7 +203,7 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) su
 	}
 	defer cont.Destroy()
 
-	if err := cont.Restore(conf, fullImagePath); err != nil {
+	if err := restoreImage(conf, cont, fullImagePath, c.chunkStore); err != nil {
 		util.Fatalf("starting container: %v", err)
 	}
 
@@ -0,0 +1,223 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/state/chunkstore"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/sandbox"
+)
+
+const (
+	// checkpointCompactCmd is the name of the checkpoint mode that removes
+	// unreferenced chunks from a chunk store.
+	checkpointCompactCmd = "compact"
+
+	// chunkStoreIndexName and chunkStorePackName are the names of the files
+	// making up a chunk store within its directory.
+	chunkStoreIndexName = "chunks.idx"
+	chunkStorePackName  = "chunks.pack"
+
+	// checkpointChunksFileName is the file within an image-path directory
+	// listing the chunks that the image references.
+	checkpointChunksFileName = "checkpoint.chunks"
+)
+
+// openChunkStore opens the chunk store in dir. If write is true, the store is
+// created if necessary and locked exclusively; otherwise it's opened read-only
+// and locked shared. The returned function closes the files, releasing the
+// lock.
+func openChunkStore(dir string, write bool) (*sandbox.ChunkStoreFiles, func(), error) {
+	flags, how := os.O_RDONLY, unix.LOCK_SH
+	if write {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, err
+		}
+		flags, how = os.O_RDWR|os.O_CREATE, unix.LOCK_EX
+	}
+	indexPath := filepath.Join(dir, chunkStoreIndexName)
+	for {
+		index, err := os.OpenFile(indexPath, flags, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := unix.Flock(int(index.Fd()), how); err != nil {
+			index.Close()
+			return nil, nil, fmt.Errorf("locking %q: %w", indexPath, err)
+		}
+		// Compaction replaces the store's files while holding the lock. If
+		// that happened while we were waiting for it, retry with the new
+		// files.
+		if replaced, err := fileReplaced(index, indexPath); err != nil {
+			index.Close()
+			return nil, nil, err
+		} else if replaced {
+			index.Close()
+			continue
+		}
+		pack, err := os.OpenFile(filepath.Join(dir, chunkStorePackName), flags, 0644)
+		if err != nil {
+			index.Close()
+			return nil, nil, err
+		}
+		return &sandbox.ChunkStoreFiles{Index: index, Pack: pack}, func() {
+			pack.Close()
+			index.Close()
+		}, nil
+	}
+}
+
+// fileReplaced returns true if path no longer refers to f.
+func fileReplaced(f *os.File, path string) (bool, error) {
+	var fst, pst unix.Stat_t
+	if err := unix.Fstat(int(f.Fd()), &fst); err != nil {
+		return false, err
+	}
+	if err := unix.Stat(path, &pst); err != nil {
+		if err == unix.ENOENT {
+			return true, nil
+		}
+		return false, err
+	}
+	return fst.Dev != pst.Dev || fst.Ino != pst.Ino, nil
+}
+
+// checkpointCompact implements "checkpoint compact".
+type checkpointCompact struct {
+	chunkStore string
+}
+
+func (c *checkpointCompact) setFlags(f *flag.FlagSet) {
+	f.StringVar(&c.chunkStore, "chunk-store", "", "directory of the chunk store to compact.")
+}
+
+// execute removes chunks that aren't referenced by any of the images given in
+// args from the chunk store. Each image is either an image-path directory or
+// the chunk list within it.
+func (c *checkpointCompact) execute(args []string) subcommands.ExitStatus {
+	f := flag.NewFlagSet(checkpointCompactCmd, flag.ContinueOnError)
+	c.setFlags(f)
+	if err := f.Parse(args); err != nil {
+		return subcommands.ExitUsageError
+	}
+	if c.chunkStore == "" {
+		fmt.Fprintf(os.Stderr, "Usage: checkpoint compact -chunk-store=<dir> [<image path>...]\n")
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+
+	// Read the references first: an image that can't be read would otherwise
+	// lose all of its chunks.
+	live := make(map[chunkstore.Hash]struct{})
+	for _, path := range f.Args() {
+		if fi, err := os.Stat(path); err != nil {
+			util.Fatalf("stat image: %v", err)
+		} else if fi.IsDir() {
+			path = filepath.Join(path, checkpointChunksFileName)
+		}
+		refs, err := os.Open(path)
+		if err != nil {
+			util.Fatalf("error opening chunk list: %v", err)
+		}
+		err = chunkstore.ReadRefs(refs, live)
+		refs.Close()
+		if err != nil {
+			util.Fatalf("error reading chunk list %q: %v", path, err)
+		}
+	}
+
+	files, release, err := openChunkStore(c.chunkStore, true)
+	if err != nil {
+		util.Fatalf("opening chunk store: %v", err)
+	}
+	defer release()
+	src, err := chunkstore.Open(files.Index, files.Pack)
+	if err != nil {
+		util.Fatalf("opening chunk store: %v", err)
+	}
+
+	newIndex, err := os.CreateTemp(c.chunkStore, chunkStoreIndexName+".*")
+	if err != nil {
+		util.Fatalf("creating index: %v", err)
+	}
+	defer os.Remove(newIndex.Name())
+	defer newIndex.Close()
+	newPack, err := os.CreateTemp(c.chunkStore, chunkStorePackName+".*")
+	if err != nil {
+		util.Fatalf("creating pack: %v", err)
+	}
+	defer os.Remove(newPack.Name())
+	defer newPack.Close()
+
+	dst, err := chunkstore.Open(newIndex, newPack)
+	if err != nil {
+		util.Fatalf("creating chunk store: %v", err)
+	}
+	if err := src.Compact(dst, func(h chunkstore.Hash) bool {
+		_, ok := live[h]
+		return ok
+	}); err != nil {
+		util.Fatalf("compacting chunk store: %v", err)
+	}
+	if err := newPack.Sync(); err != nil {
+		util.Fatalf("syncing pack: %v", err)
+	}
+	if err := newIndex.Sync(); err != nil {
+		util.Fatalf("syncing index: %v", err)
+	}
+
+	// Replace the pack before the index. If interrupted in between, the old
+	// index refers to chunks that are no longer at the recorded offsets;
+	// this is detected by the hash check when loading them.
+	if err := os.Rename(newPack.Name(), filepath.Join(c.chunkStore, chunkStorePackName)); err != nil {
+		util.Fatalf("replacing pack: %v", err)
+	}
+	if err := os.Rename(newIndex.Name(), filepath.Join(c.chunkStore, chunkStoreIndexName)); err != nil {
+		util.Fatalf("replacing index: %v", err)
+	}
+
+	fmt.Printf("Chunks: %d -> %d\n", src.Len(), dst.Len())
+	fmt.Printf("Size:   %d -> %d bytes (%d bytes reclaimed)\n", src.Size(), dst.Size(), src.Size()-dst.Size())
+	return subcommands.ExitSuccess
+}
+
+// restoreImage restores cont from the image file at path. If chunkStore is
+// not empty, memory contents are loaded from the chunk store in that
+// directory.
+func restoreImage(conf *config.Config, cont *container.Container, path, chunkStore string) error {
+	if chunkStore == "" {
+		return cont.Restore(conf, path)
+	}
+	chunks, release, err := openChunkStore(chunkStore, false)
+	if err != nil {
+		return fmt.Errorf("opening chunk store: %w", err)
+	}
+	defer release()
+	rf, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening restore file %q failed: %v", path, err)
+	}
+	defer rf.Close()
+	return cont.RestoreFromChunkStore(conf, rf, chunks)
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/state/pretty"
+	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// checkpointInspectCmd is the name of the checkpoint mode that inspects a
+// saved image instead of checkpointing a container.
+const checkpointInspectCmd = "inspect"
+
+// checkpointInspect implements "checkpoint inspect".
+type checkpointInspect struct {
+	detail bool
+	key    string
+	limit  int
+}
+
+func (c *checkpointInspect) setFlags(f *flag.FlagSet) {
+	f.BoolVar(&c.detail, "detail", false, "walk the object graph and report object counts and sizes per type. This decodes the whole image and may be slow.")
+	f.StringVar(&c.key, "key", "", "the integrity key for the image.")
+	f.IntVar(&c.limit, "limit", 50, "maximum number of types to report with -detail, 0 for all.")
+}
+
+// execute inspects the image at the path given in args, which is either an
+// image file or a directory passed to "checkpoint -image-path".
+func (c *checkpointInspect) execute(args []string) subcommands.ExitStatus {
+	f := flag.NewFlagSet(checkpointInspectCmd, flag.ContinueOnError)
+	c.setFlags(f)
+	if err := f.Parse(args); err != nil {
+		return subcommands.ExitUsageError
+	}
+	if f.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: checkpoint inspect [flags] <image path>\n")
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+
+	path := f.Arg(0)
+	if fi, err := os.Stat(path); err != nil {
+		util.Fatalf("stat image: %v", err)
+	} else if fi.IsDir() {
+		path = filepath.Join(path, checkpointFileName)
+	}
+	input, err := os.Open(path)
+	if err != nil {
+		util.Fatalf("error opening image: %v", err)
+	}
+	defer input.Close()
+	fi, err := input.Stat()
+	if err != nil {
+		util.Fatalf("stat image: %v", err)
+	}
+
+	var key []byte
+	if c.key != "" {
+		key = []byte(c.key)
+	}
+	r, metadata, err := statefile.NewReader(input, key)
+	if err != nil {
+		util.Fatalf("error parsing image: %v", err)
+	}
+
+	fmt.Printf("Image:     %s\n", path)
+	fmt.Printf("File size: %d bytes\n", fi.Size())
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Printf("Metadata:\n")
+	for _, k := range keys {
+		fmt.Printf("  %s: %s\n", k, metadata[k])
+	}
+	if !c.detail {
+		return subcommands.ExitSuccess
+	}
+
+	summary, err := pretty.Summarize(r)
+	if err != nil {
+		util.Fatalf("error reading image: %v", err)
+	}
+	fmt.Printf("\n")
+	if err := summary.Print(os.Stdout, c.limit); err != nil {
+		util.Fatalf("error printing summary: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
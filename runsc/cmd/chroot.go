@@ -21,6 +21,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -126,6 +127,24 @@ func setUpChroot(pidns bool, spec *specs.Spec, conf *config.Config, nvidiaDevMin
 	if err := tpuProxyUpdateChroot(chroot, conf); err != nil {
 		return fmt.Errorf("error configuring chroot for TPU devices: %w", err)
 	}
+	if err := amdProxyUpdateChroot(chroot, spec, conf); err != nil {
+		return fmt.Errorf("error configuring chroot for AMD GPUs: %w", err)
+	}
+	if err := hostDevicesUpdateChroot(chroot, conf); err != nil {
+		return fmt.Errorf("error configuring chroot for host devices: %w", err)
+	}
+	if err := tpmUpdateChroot(chroot, conf); err != nil {
+		return fmt.Errorf("error configuring chroot for the host TPM: %w", err)
+	}
+	if err := kvmUpdateChroot(chroot, conf); err != nil {
+		return fmt.Errorf("error configuring chroot for KVM passthrough: %w", err)
+	}
+	if err := vfioUpdateChroot(chroot, conf); err != nil {
+		return fmt.Errorf("error configuring chroot for VFIO passthrough: %w", err)
+	}
+	if err := rdmaProxyUpdateChroot(chroot, conf); err != nil {
+		return fmt.Errorf("error configuring chroot for RDMA devices: %w", err)
+	}
 
 	if err := specutils.SafeMount("", chroot, "", unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_BIND, "", "/proc"); err != nil {
 		return fmt.Errorf("error remounting chroot in read-only: %v", err)
@@ -183,6 +202,205 @@ func tpuProxyUpdateChroot(chroot string, conf *config.Config) error {
 	return nil
 }
 
+func amdProxyUpdateChroot(chroot string, spec *specs.Spec, conf *config.Config) error {
+	if !conf.AMDProxy {
+		return nil
+	}
+	// Only the render nodes of the GPUs assigned to the container are
+	// mounted, since amdkfd only allows the sandbox to use GPUs whose render
+	// node it can open.
+	devPaths := []string{"/dev/kfd"}
+	for _, minor := range specutils.AMDRenderNodeMinors(spec) {
+		devPaths = append(devPaths, fmt.Sprintf("/dev/dri/renderD%d", minor))
+	}
+	for _, devPath := range devPaths {
+		if err := mountInChroot(chroot, devPath, devPath, "bind", unix.MS_BIND); err != nil {
+			return fmt.Errorf("error mounting %q in chroot: %v", devPath, err)
+		}
+		finfo, err := os.Stat(path.Join(chroot, devPath))
+		if err != nil {
+			return fmt.Errorf("error statting %q: %v", devPath, err)
+		}
+		// Ensure the file mounted in was a char device file.
+		if finfo.Mode()&os.ModeType != os.ModeCharDevice|os.ModeDevice {
+			return fmt.Errorf("unexpected file type for %q, want %s, got %s", path.Join(chroot, devPath), os.ModeCharDevice|os.ModeDevice, finfo.Mode()&os.ModeType)
+		}
+	}
+	// The sandbox mirrors the KFD topology from the host into its own sysfs.
+	const sysKFDPath = "/sys/devices/virtual/kfd"
+	if err := mountInChroot(chroot, sysKFDPath, sysKFDPath, "bind", unix.MS_BIND|unix.MS_RDONLY); err != nil {
+		return fmt.Errorf("error mounting %q in chroot: %v", sysKFDPath, err)
+	}
+	return nil
+}
+
+func hostDevicesUpdateChroot(chroot string, conf *config.Config) error {
+	for _, dev := range conf.HostDevices {
+		if err := mountInChroot(chroot, dev.Path, dev.Path, "bind", unix.MS_BIND); err != nil {
+			return fmt.Errorf("error mounting %q in chroot: %v", dev.Path, err)
+		}
+		finfo, err := os.Stat(path.Join(chroot, dev.Path))
+		if err != nil {
+			return fmt.Errorf("error statting %q: %v", dev.Path, err)
+		}
+		// Ensure the file mounted in was a char device file.
+		if finfo.Mode()&os.ModeType != os.ModeCharDevice|os.ModeDevice {
+			return fmt.Errorf("unexpected file type for %q, want %s, got %s", path.Join(chroot, dev.Path), os.ModeCharDevice|os.ModeDevice, finfo.Mode()&os.ModeType)
+		}
+	}
+	return nil
+}
+
+func tpmUpdateChroot(chroot string, conf *config.Config) error {
+	if conf.TPM != config.TPMHost {
+		return nil
+	}
+	const devPath = "/dev/tpmrm0"
+	if err := mountInChroot(chroot, devPath, devPath, "bind", unix.MS_BIND); err != nil {
+		return fmt.Errorf("error mounting %q in chroot: %v", devPath, err)
+	}
+	finfo, err := os.Stat(path.Join(chroot, devPath))
+	if err != nil {
+		return fmt.Errorf("error statting %q: %v", devPath, err)
+	}
+	// Ensure the file mounted in was a char device file.
+	if finfo.Mode()&os.ModeType != os.ModeCharDevice|os.ModeDevice {
+		return fmt.Errorf("unexpected file type for %q, want %s, got %s", path.Join(chroot, devPath), os.ModeCharDevice|os.ModeDevice, finfo.Mode()&os.ModeType)
+	}
+	return nil
+}
+
+func kvmUpdateChroot(chroot string, conf *config.Config) error {
+	if !conf.NestedKVM {
+		return nil
+	}
+	const devPath = "/dev/kvm"
+	if err := mountInChroot(chroot, devPath, devPath, "bind", unix.MS_BIND); err != nil {
+		return fmt.Errorf("error mounting %q in chroot: %v", devPath, err)
+	}
+	finfo, err := os.Stat(path.Join(chroot, devPath))
+	if err != nil {
+		return fmt.Errorf("error statting %q: %v", devPath, err)
+	}
+	// Ensure the file mounted in was a char device file.
+	if finfo.Mode()&os.ModeType != os.ModeCharDevice|os.ModeDevice {
+		return fmt.Errorf("unexpected file type for %q, want %s, got %s", path.Join(chroot, devPath), os.ModeCharDevice|os.ModeDevice, finfo.Mode()&os.ModeType)
+	}
+	return nil
+}
+
+func vfioUpdateChroot(chroot string, conf *config.Config) error {
+	if len(conf.VFIOGroups) == 0 {
+		return nil
+	}
+	devPaths := []string{"/dev/vfio/vfio"}
+	for _, group := range conf.VFIOGroups {
+		devPaths = append(devPaths, fmt.Sprintf("/dev/vfio/%d", group.Group))
+	}
+	for _, devPath := range devPaths {
+		if err := mountInChroot(chroot, devPath, devPath, "bind", unix.MS_BIND); err != nil {
+			return fmt.Errorf("error mounting %q in chroot: %v", devPath, err)
+		}
+		finfo, err := os.Stat(path.Join(chroot, devPath))
+		if err != nil {
+			return fmt.Errorf("error statting %q: %v", devPath, err)
+		}
+		// Ensure the file mounted in was a char device file.
+		if finfo.Mode()&os.ModeType != os.ModeCharDevice|os.ModeDevice {
+			return fmt.Errorf("unexpected file type for %q, want %s, got %s", path.Join(chroot, devPath), os.ModeCharDevice|os.ModeDevice, finfo.Mode()&os.ModeType)
+		}
+	}
+	return nil
+}
+
+func rdmaProxyUpdateChroot(chroot string, conf *config.Config) error {
+	if !conf.RDMAProxy {
+		return nil
+	}
+	devPaths, err := filepath.Glob("/dev/infiniband/uverbs*")
+	if err != nil {
+		return fmt.Errorf("enumerating uverbs device files: %w", err)
+	}
+	if len(devPaths) == 0 {
+		return nil
+	}
+	// The sandbox mirrors the sysfs attributes from which libibverbs
+	// discovers RDMA devices, and from which the sentry determines their
+	// drivers. /sys/class/infiniband_verbs/uverbs<N> is a symlink on the
+	// host, so the attributes that are needed are mounted individually into
+	// a directory at the same path.
+	const uverbsSysfsPath = "/sys/class/infiniband_verbs"
+	abiVersionPath := path.Join(uverbsSysfsPath, "abi_version")
+	if err := mountInChroot(chroot, abiVersionPath, abiVersionPath, "bind", unix.MS_BIND|unix.MS_RDONLY); err != nil {
+		return fmt.Errorf("error mounting %q in chroot: %v", abiVersionPath, err)
+	}
+	for _, devPath := range devPaths {
+		if err := mountInChroot(chroot, devPath, devPath, "bind", unix.MS_BIND); err != nil {
+			return fmt.Errorf("error mounting %q in chroot: %v", devPath, err)
+		}
+		finfo, err := os.Stat(path.Join(chroot, devPath))
+		if err != nil {
+			return fmt.Errorf("error statting %q: %v", devPath, err)
+		}
+		// Ensure the file mounted in was a char device file.
+		if finfo.Mode()&os.ModeType != os.ModeCharDevice|os.ModeDevice {
+			return fmt.Errorf("unexpected file type for %q, want %s, got %s", path.Join(chroot, devPath), os.ModeCharDevice|os.ModeDevice, finfo.Mode()&os.ModeType)
+		}
+
+		uverbsPath := path.Join(uverbsSysfsPath, path.Base(devPath))
+		uverbsDir, err := filepath.EvalSymlinks(uverbsPath)
+		if err != nil {
+			return fmt.Errorf("error resolving %q: %v", uverbsPath, err)
+		}
+		for _, attr := range []string{"abi_version", "dev", "ibdev"} {
+			if err := mountInChroot(chroot, path.Join(uverbsDir, attr), path.Join(uverbsPath, attr), "bind", unix.MS_BIND|unix.MS_RDONLY); err != nil {
+				return fmt.Errorf("error mounting %q in chroot: %v", path.Join(uverbsPath, attr), err)
+			}
+		}
+		deviceDir, err := filepath.EvalSymlinks(path.Join(uverbsDir, "device"))
+		if err != nil {
+			return fmt.Errorf("error resolving %q: %v", path.Join(uverbsPath, "device"), err)
+		}
+		chrootDeviceDir := path.Join(chroot, uverbsPath, "device")
+		if err := os.MkdirAll(chrootDeviceDir, 0755); err != nil {
+			return fmt.Errorf("error creating %q: %v", chrootDeviceDir, err)
+		}
+		// libibverbs matches devices to providers by these attributes.
+		for _, attr := range []string{"device", "modalias", "numa_node", "vendor"} {
+			src := path.Join(deviceDir, attr)
+			if _, err := os.Stat(src); err != nil {
+				continue
+			}
+			if err := mountInChroot(chroot, src, path.Join(uverbsPath, "device", attr), "bind", unix.MS_BIND|unix.MS_RDONLY); err != nil {
+				return fmt.Errorf("error mounting %q in chroot: %v", src, err)
+			}
+		}
+		// Virtual devices underlying software RDMA devices may not have a
+		// driver.
+		if driver, err := os.Readlink(path.Join(deviceDir, "driver")); err == nil {
+			if err := os.Symlink(driver, path.Join(chrootDeviceDir, "driver")); err != nil {
+				return fmt.Errorf("error creating driver symlink for %q: %v", uverbsPath, err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error reading driver symlink for %q: %v", uverbsPath, err)
+		}
+
+		ibdev, err := os.ReadFile(path.Join(uverbsDir, "ibdev"))
+		if err != nil {
+			return fmt.Errorf("error reading %q: %v", path.Join(uverbsPath, "ibdev"), err)
+		}
+		ibdevPath := path.Join("/sys/class/infiniband", strings.TrimSpace(string(ibdev)))
+		ibdevDir, err := filepath.EvalSymlinks(ibdevPath)
+		if err != nil {
+			return fmt.Errorf("error resolving %q: %v", ibdevPath, err)
+		}
+		if err := mountInChroot(chroot, ibdevDir, ibdevPath, "bind", unix.MS_BIND|unix.MS_RDONLY); err != nil {
+			return fmt.Errorf("error mounting %q in chroot: %v", ibdevPath, err)
+		}
+	}
+	return nil
+}
+
 func nvproxyUpdateChroot(chroot string, spec *specs.Spec, conf *config.Config, devMinors []uint32) error {
 	if !specutils.GPUFunctionalityRequested(spec, conf) {
 		return nil
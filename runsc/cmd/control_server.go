@@ -0,0 +1,91 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/controlserver"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// ControlServer implements subcommands.Command for the "control-server"
+// command.
+type ControlServer struct {
+	server controlserver.Server
+}
+
+// Name implements subcommands.Command.Name.
+func (*ControlServer) Name() string {
+	return "control-server"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*ControlServer) Synopsis() string {
+	return "serves an HTTP API to control all sandboxes under the root directory"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*ControlServer) Usage() string {
+	return `-root=<root dir> control-server -address=<addr> [-token-file=<path>] [-tls-cert=<path> -tls-key=<path> [-tls-client-ca=<path>]] [-allow-checkpoint]
+
+The address is either a Unix domain socket path, or a TCP address. Clients
+authenticate with an "Authorization: Bearer <token>" header containing the
+contents of the token file, which is required for TCP addresses. TCP addresses
+other than loopback addresses also require TLS. Endpoints:
+
+  GET  /v1/containers                    list containers
+  GET  /v1/containers/<id>               container state
+  GET  /v1/containers/<id>/events        resource usage, as in "runsc events"
+  GET  /v1/containers/<id>/ps            processes, as in "runsc ps"
+  GET  /v1/containers/<id>/stacks        sandbox stack traces
+  GET  /v1/containers/<id>/usage         sandbox memory usage
+  POST /v1/containers/<id>/signal        {"signal": "TERM", "all": false, "pid": 0}
+  POST /v1/containers/<id>/pause
+  POST /v1/containers/<id>/resume
+  POST /v1/containers/<id>/checkpoint    {"image_path": "/path", "compression": "none"}
+  GET  /v1/containers/<id>/pressure      cgroup pressure stall information (PSI)
+  GET  /v1/containers/<id>/pressure?watch=memory&stall=100ms&window=2s
+                                         stream an event each time the trigger fires
+  POST /v1/containers/<id>/reclaim       {"page_out": false, "skip_gc": false}
+  POST /v1/containers/<id>/update        OCI LinuxResources, as in "runsc update"
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (c *ControlServer) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.server.Address, "address", "", "address to listen on: a Unix domain socket path or a TCP host:port.")
+	f.StringVar(&c.server.TokenFile, "token-file", "", "file containing the bearer token clients must present. Required for TCP addresses.")
+	f.StringVar(&c.server.TLSCert, "tls-cert", "", "PEM certificate presented to clients on TCP addresses. Required for non-loopback addresses.")
+	f.StringVar(&c.server.TLSKey, "tls-key", "", "PEM private key for -tls-cert.")
+	f.StringVar(&c.server.TLSClientCA, "tls-client-ca", "", "PEM CA certificate used to verify client certificates. If set, clients must present a certificate signed by it.")
+	f.BoolVar(&c.server.AllowCheckpoint, "allow-checkpoint", false, "allow clients to checkpoint containers to host paths of their choice.")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (c *ControlServer) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 0 || c.server.Address == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	c.server.Config = args[0].(*config.Config)
+	if err := c.server.Run(ctx); err != nil {
+		return util.Errorf("control server: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
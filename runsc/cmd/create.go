@@ -48,6 +48,10 @@ type Create struct {
 	// container, e.g. unsupported syscalls, while the later is more verbose and
 	// consumed by developers.
 	userLog string
+
+	// bootProfile is the name of a boot profile applied to the sandbox
+	// configuration, see config.BootProfiles.
+	bootProfile string
 }
 
 // Name implements subcommands.Command.Name.
@@ -72,6 +76,7 @@ func (c *Create) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.consoleSocket, "console-socket", "", "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the console's pseudoterminal")
 	f.StringVar(&c.pidFile, "pid-file", "", "filename that the container pid will be written to")
 	f.StringVar(&c.userLog, "user-log", "", "filename to send user-visible logs to. Empty means no logging.")
+	f.StringVar(&c.bootProfile, "profile", "", "boot profile that overrides the sandbox configuration. Values: micro (minimal sandbox for single-binary workloads: no network stack, minimal procfs, in-memory rootfs overlay, seccomp program cached across sandboxes).")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -87,6 +92,9 @@ func (c *Create) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcom
 	if conf.Rootless {
 		return util.Errorf("Rootless mode not supported with %q", c.Name())
 	}
+	if err := conf.ApplyBootProfile(flag.CommandLine, c.bootProfile); err != nil {
+		return util.Errorf("applying boot profile: %v", err)
+	}
 
 	bundleDir := c.bundleDir
 	if bundleDir == "" {
@@ -44,12 +44,15 @@ type Debug struct {
 	profileMutex string
 	trace        string
 	strace       string
+	straceJSON   string
+	straceOutput string
 	logLevel     string
 	logPackets   string
 	delay        time.Duration
 	duration     time.Duration
 	ps           bool
 	mount        string
+	overrides    string
 }
 
 // Name implements subcommands.Command.
@@ -80,10 +83,13 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&d.trace, "trace", "", "writes an execution trace to the given file.")
 	f.IntVar(&d.signal, "signal", -1, "sends signal to the sandbox")
 	f.StringVar(&d.strace, "strace", "", `A comma separated list of syscalls to trace. "all" enables all traces, "off" disables all.`)
+	f.StringVar(&d.straceJSON, "strace-json", "", `A comma separated list of syscalls to trace as JSON records. "all" enables all traces, "off" disables all.`)
+	f.StringVar(&d.straceOutput, "strace-json-output", "", `file to append JSON strace records to, or "-" to stream them to stdout. If unset, the current destination is kept.`)
 	f.StringVar(&d.logLevel, "log-level", "", "The log level to set: warning (0), info (1), or debug (2).")
 	f.StringVar(&d.logPackets, "log-packets", "", "A boolean value to enable or disable packet logging: true or false.")
 	f.BoolVar(&d.ps, "ps", false, "lists processes")
 	f.StringVar(&d.mount, "mount", "", "Mount a filesystem (-mount fstype:source:destination).")
+	f.StringVar(&d.overrides, "syscall-overrides", "", `A comma separated list of <syscall>=<action> overrides for the container, where action is errno:<errno>, delay:<duration>, or "default" to remove the override.`)
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -158,7 +164,7 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		}
 		util.Infof("     *** Stack dump ***\n%s", stacks)
 	}
-	if d.strace != "" || len(d.logLevel) != 0 || len(d.logPackets) != 0 {
+	if d.strace != "" || d.straceJSON != "" || len(d.logLevel) != 0 || len(d.logPackets) != 0 {
 		args := control.LoggingArgs{}
 		switch strings.ToLower(d.strace) {
 		case "":
@@ -180,6 +186,41 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 			args.StraceAllowlist = strings.Split(d.strace, ",")
 		}
 
+		switch strings.ToLower(d.straceJSON) {
+		case "":
+			// JSON strace not set, nothing to do here.
+
+		case "off":
+			util.Infof("Disabling JSON strace")
+			args.SetJSONStrace = true
+
+		case "all":
+			util.Infof("Enabling all JSON straces")
+			args.SetJSONStrace = true
+			args.EnableJSONStrace = true
+
+		default:
+			util.Infof("Enabling JSON strace for syscalls: %s", d.straceJSON)
+			args.SetJSONStrace = true
+			args.EnableJSONStrace = true
+			args.StraceJSONAllowlist = strings.Split(d.straceJSON, ",")
+		}
+		if args.EnableJSONStrace {
+			switch d.straceOutput {
+			case "":
+				// Keep the current destination.
+			case "-":
+				args.FilePayload.Files = []*os.File{os.Stdout}
+			default:
+				output, err := os.OpenFile(d.straceOutput, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+				if err != nil {
+					return util.Errorf("error opening JSON strace output: %v", err)
+				}
+				defer output.Close()
+				args.FilePayload.Files = []*os.File{output}
+			}
+		}
+
 		if len(d.logLevel) != 0 {
 			args.SetLevel = true
 			switch strings.ToLower(d.logLevel) {
@@ -238,6 +279,12 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 			util.Fatalf(err.Error())
 		}
 	}
+	if d.overrides != "" {
+		util.Infof("Setting syscall overrides: %s", d.overrides)
+		if err := c.Sandbox.SetSyscallOverrides(c.ID, d.overrides); err != nil {
+			return util.Errorf("setting syscall overrides: %v", err)
+		}
+	}
 
 	// Open profiling files.
 	var (
@@ -0,0 +1,260 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/google/subcommands"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/prometheus"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// debugFSDir is the directory under which debug filesystems are mounted by
+// default.
+const debugFSDir = "/run/gvisor-debug"
+
+// DebugFS implements subcommands.Command for the "debug-fs" command.
+type DebugFS struct {
+	mountpoint string
+}
+
+// Name implements subcommands.Command.
+func (*DebugFS) Name() string {
+	return "debug-fs"
+}
+
+// Synopsis implements subcommands.Command.
+func (*DebugFS) Synopsis() string {
+	return "mount a filesystem exposing sandbox internals for debugging"
+}
+
+// Usage implements subcommands.Command.
+func (*DebugFS) Usage() string {
+	return `debug-fs [flags] <container-id> - mount a read-only FUSE filesystem exposing sandbox internals.
+
+The filesystem is served by this command until it is interrupted or the
+container exits. The contents of each file are collected from the sandbox
+when the file is opened:
+
+	processes  processes in the container, as with "runsc ps"
+	mounts     mount table of the container, as /proc/[pid]/mountinfo
+	tasks      all processes of the sandbox, with their FD tables, memory
+	           mappings, limits and cgroups, as JSON
+	memory     memory usage of the sandbox, as JSON
+	metrics    sandbox metrics, including netstack statistics, in Prometheus
+	           format
+	stacks     stacks of all sandbox goroutines
+
+Only the user that mounted the filesystem can access it.
+
+OPTIONS:
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (d *DebugFS) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&d.mountpoint, "mountpoint", "", "directory to mount the filesystem on. Defaults to "+debugFSDir+"/<container-id>")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (d *DebugFS) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+
+	mountpoint := d.mountpoint
+	if mountpoint == "" {
+		mountpoint = filepath.Join(debugFSDir, c.ID)
+		if err := os.MkdirAll(mountpoint, 0700); err != nil {
+			util.Fatalf("creating mountpoint: %v", err)
+		}
+		defer os.Remove(mountpoint)
+	}
+
+	root := &debugFSRoot{files: debugFSFiles(c)}
+	server, err := fs.Mount(mountpoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: "gvisor-debug",
+			Name:   "gvisor-debug",
+		},
+	})
+	if err != nil {
+		util.Fatalf("mounting debug filesystem on %q: %v", mountpoint, err)
+	}
+	util.Infof("Mounted debug filesystem for container %q on %q", c.ID, mountpoint)
+
+	// Unmount when interrupted or when the container exits.
+	go func() {
+		sig := waitSignal()
+		log.Infof("Got %v, unmounting debug filesystem", sig)
+		if err := server.Unmount(); err != nil {
+			log.Warningf("Unmounting debug filesystem: %v", err)
+		}
+	}()
+	go func() {
+		_, _ = c.Wait()
+		log.Infof("Container %q stopped, unmounting debug filesystem", c.ID)
+		if err := server.Unmount(); err != nil {
+			log.Warningf("Unmounting debug filesystem: %v", err)
+		}
+	}()
+	server.Wait()
+	return subcommands.ExitSuccess
+}
+
+// debugFSFiles returns generators for the contents of the debug filesystem's
+// files, keyed by file name.
+func debugFSFiles(c *container.Container) map[string]func() ([]byte, error) {
+	return map[string]func() ([]byte, error){
+		"processes": func() ([]byte, error) {
+			procs, err := c.Processes()
+			if err != nil {
+				return nil, err
+			}
+			return []byte(control.ProcessListToTable(procs) + "\n"), nil
+		},
+		"mounts": func() ([]byte, error) {
+			info, err := c.MountInfo()
+			return []byte(info), err
+		},
+		"tasks": func() ([]byte, error) {
+			dump, err := c.Sandbox.ProcfsDump()
+			if err != nil {
+				return nil, err
+			}
+			return json.MarshalIndent(dump, "", "  ")
+		},
+		"memory": func() ([]byte, error) {
+			usage, err := c.Sandbox.Usage(true /* Full */)
+			if err != nil {
+				return nil, err
+			}
+			return json.MarshalIndent(usage, "", "  ")
+		},
+		"metrics": func() ([]byte, error) {
+			snapshot, err := c.Sandbox.ExportMetrics(control.MetricsExportOpts{})
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			if _, err := prometheus.Write(&buf, prometheus.ExportOptions{
+				CommentHeader: fmt.Sprintf("Debug filesystem export for sandbox %s", c.Sandbox.ID),
+			}, map[*prometheus.Snapshot]prometheus.SnapshotExportOptions{
+				snapshot: {},
+			}); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		},
+		"stacks": func() ([]byte, error) {
+			stacks, err := c.Sandbox.Stacks()
+			return []byte(stacks), err
+		},
+	}
+}
+
+// debugFSRoot is the root directory of the debug filesystem.
+type debugFSRoot struct {
+	fs.Inode
+
+	files map[string]func() ([]byte, error)
+}
+
+var _ = (fs.NodeOnAdder)((*debugFSRoot)(nil))
+
+// OnAdd implements fs.NodeOnAdder.OnAdd.
+func (r *debugFSRoot) OnAdd(ctx context.Context) {
+	for name, gen := range r.files {
+		file := r.NewPersistentInode(ctx, &debugFSFile{name: name, gen: gen}, fs.StableAttr{Mode: fuse.S_IFREG})
+		r.AddChild(name, file, false /* overwrite */)
+	}
+}
+
+// debugFSFile is a read-only file whose contents are generated when it is
+// opened.
+type debugFSFile struct {
+	fs.Inode
+
+	name string
+	gen  func() ([]byte, error)
+}
+
+var _ = (fs.NodeGetattrer)((*debugFSFile)(nil))
+var _ = (fs.NodeOpener)((*debugFSFile)(nil))
+
+// Getattr implements fs.NodeGetattrer.Getattr.
+func (f *debugFSFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = fuse.S_IFREG | 0444
+	if h, ok := fh.(*debugFSHandle); ok {
+		out.Size = uint64(len(h.data))
+	}
+	return fs.OK
+}
+
+// Open implements fs.NodeOpener.Open.
+func (f *debugFSFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	data, err := f.gen()
+	if err != nil {
+		log.Warningf("Generating debug file %q: %v", f.name, err)
+		return nil, 0, syscall.EIO
+	}
+	// The size of the contents is unknown until the file is opened, so
+	// bypass the page cache.
+	return &debugFSHandle{data: data}, fuse.FOPEN_DIRECT_IO, fs.OK
+}
+
+// debugFSHandle holds the contents of an open debugFSFile.
+type debugFSHandle struct {
+	data []byte
+}
+
+var _ = (fs.FileReader)((*debugFSHandle)(nil))
+
+// Read implements fs.FileReader.Read.
+func (h *debugFSHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if off >= int64(len(h.data)) {
+		return fuse.ReadResultData(nil), fs.OK
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(h.data)) {
+		end = int64(len(h.data))
+	}
+	return fuse.ReadResultData(h.data[off:end]), fs.OK
+}
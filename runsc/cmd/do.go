@@ -193,8 +193,8 @@ func (c *Do) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommand
 	if conf.Network == config.NetworkNone {
 		addNamespace(spec, specs.LinuxNamespace{Type: specs.NetworkNamespace})
 	} else if conf.Rootless {
-		if conf.Network == config.NetworkSandbox {
-			c.notifyUser("*** Warning: sandbox network isn't supported with --rootless, switching to host ***")
+		if conf.Network == config.NetworkSandbox && conf.NetworkHelper == config.NetworkHelperNone {
+			c.notifyUser("*** Warning: sandbox network isn't supported with --rootless without --network-helper, switching to host ***")
 			conf.Network = config.NetworkHost
 		}
 
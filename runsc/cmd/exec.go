@@ -58,6 +58,10 @@ type Exec struct {
 	// pseudoterminal.
 	consoleSocket string
 
+	// session runs the process on a terminal held by the sandbox, which can
+	// be detached from and reattached to with "runsc attach".
+	session bool
+
 	// passFDs are user-supplied FDs from the host to be exposed to the
 	// sandboxed app.
 	passFDs fdMappings
@@ -107,6 +111,7 @@ func (ex *Exec) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&ex.pidFile, "pid-file", "", "filename that the container pid will be written to")
 	f.StringVar(&ex.internalPidFile, "internal-pid-file", "", "filename that the container-internal pid will be written to")
 	f.StringVar(&ex.consoleSocket, "console-socket", "", "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the console's pseudoterminal")
+	f.BoolVar(&ex.session, "session", false, "run the process on a terminal held by the sandbox. Type Ctrl-P Ctrl-Q to detach, and reattach with 'runsc attach'. With --detach, print the process's PID and return without attaching")
 	f.Var(&ex.passFDs, "pass-fd", "file descriptor passed to the container in M:N format, where M is the host and N is the guest descriptor (can be supplied multiple times)")
 	f.IntVar(&ex.execFD, "exec-fd", -1, "host file descriptor used for program execution")
 }
@@ -155,6 +160,27 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		2: os.Stderr,
 	}
 
+	// In session mode, the process's stdio is a new pty whose master is
+	// handed over to the sandbox.
+	var master *os.File
+	if ex.session {
+		if ex.consoleSocket != "" {
+			util.Fatalf("--session and --console-socket are mutually exclusive")
+		}
+		var replica *os.File
+		master, replica, err = console.NewPair()
+		if err != nil {
+			util.Fatalf("creating session terminal: %v", err)
+		}
+		defer master.Close()
+		fdMap = map[int]*os.File{
+			0: replica,
+			1: replica,
+			2: replica,
+		}
+		e.StdioIsPty = true
+	}
+
 	// Add custom file descriptors to the map.
 	for _, mapping := range ex.passFDs {
 		file := os.NewFile(uintptr(mapping.Host), "")
@@ -185,6 +211,10 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 
 	e.FilePayload = control.NewFilePayload(fdMap, execFile)
 
+	if ex.session {
+		return ex.execSession(conf, c, e, master, waitStatus)
+	}
+
 	// containerd expects an actual process to represent the container being
 	// executed. If detach was specified, starts a child in non-detach mode,
 	// write the child's PID to the pid file. So when the container returns, the
@@ -209,11 +239,60 @@ func (ex *Exec) exec(conf *config.Config, c *container.Container, e *control.Exe
 		defer stopForwarding()
 	}
 
+	if err := ex.writePIDFiles(pid); err != nil {
+		return util.Errorf("%v", err)
+	}
+
+	// Wait for the process to exit.
+	ws, err := c.WaitPID(pid)
+	if err != nil {
+		return util.Errorf("waiting on pid %d: %v", pid, err)
+	}
+	*waitStatus = ws
+	return subcommands.ExitSuccess
+}
+
+// execSession starts the process on the pty whose master is given, and hands
+// the master over to the sandbox so that the process's terminal outlives this
+// command. Unless --detach is set, it then attaches to the session like
+// "runsc attach".
+func (ex *Exec) execSession(conf *config.Config, c *container.Container, e *control.ExecArgs, master *os.File, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
+	pid, err := c.Execute(conf, e)
+	if err != nil {
+		return util.Errorf("executing processes for container: %v", err)
+	}
+	if err := c.CreateExecSession(pid, master); err != nil {
+		// Without a session nothing can ever read the process's output.
+		if err := c.SignalProcess(unix.SIGKILL, pid); err != nil {
+			log.Warningf("Failed to kill PID %d: %v", pid, err)
+		}
+		return util.Errorf("creating exec session: %v", err)
+	}
+
+	if ex.detach {
+		if ex.internalPidFile != "" {
+			if err := ioutil.WriteFile(ex.internalPidFile, []byte(strconv.Itoa(int(pid))), 0644); err != nil {
+				return util.Errorf("writing internal pid file %q: %v", ex.internalPidFile, err)
+			}
+		}
+		fmt.Println(pid)
+		*waitStatus = 0
+		return subcommands.ExitSuccess
+	}
+	if err := ex.writePIDFiles(pid); err != nil {
+		return util.Errorf("%v", err)
+	}
+	return waitSession(c, pid, waitStatus)
+}
+
+// writePIDFiles writes the sandbox-internal PID of the exec'd process and the
+// PID of this process to the files requested by flags.
+func (ex *Exec) writePIDFiles(pid int32) error {
 	// Write the sandbox-internal pid if required.
 	if ex.internalPidFile != "" {
 		pidStr := []byte(strconv.Itoa(int(pid)))
 		if err := ioutil.WriteFile(ex.internalPidFile, pidStr, 0644); err != nil {
-			return util.Errorf("writing internal pid file %q: %v", ex.internalPidFile, err)
+			return fmt.Errorf("writing internal pid file %q: %v", ex.internalPidFile, err)
 		}
 	}
 
@@ -222,17 +301,10 @@ func (ex *Exec) exec(conf *config.Config, c *container.Container, e *control.Exe
 	// `runsc exec -d` returns.
 	if ex.pidFile != "" {
 		if err := ioutil.WriteFile(ex.pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
-			return util.Errorf("writing pid file: %v", err)
+			return fmt.Errorf("writing pid file: %v", err)
 		}
 	}
-
-	// Wait for the process to exit.
-	ws, err := c.WaitPID(pid)
-	if err != nil {
-		return util.Errorf("waiting on pid %d: %v", pid, err)
-	}
-	*waitStatus = ws
-	return subcommands.ExitSuccess
+	return nil
 }
 
 func (ex *Exec) execChildAndWait(waitStatus *unix.WaitStatus) subcommands.ExitStatus {
@@ -163,7 +163,17 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		overrides["apply-caps"] = "false"
 		overrides["setup-root"] = "false"
 		args := prepareArgs(g.Name(), f, overrides)
-		util.Fatalf("setCapsAndCallSelf(%v, %v): %v", args, goferCaps, setCapsAndCallSelf(args, goferCaps))
+		applyCaps := goferCaps
+		if conf.HostDelegations {
+			// Taking leases on files owned by other users requires CAP_LEASE.
+			leaseCaps := append(append([]string(nil), caps...), "CAP_LEASE")
+			applyCaps = &specs.LinuxCapabilities{
+				Bounding:  leaseCaps,
+				Effective: leaseCaps,
+				Permitted: leaseCaps,
+			}
+		}
+		util.Fatalf("setCapsAndCallSelf(%v, %v): %v", args, applyCaps, setCapsAndCallSelf(args, applyCaps))
 		panic("unreachable")
 	}
 
@@ -233,9 +243,12 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 
 	// Initialize filters.
 	opts := filter.Options{
-		UDSOpenEnabled:   conf.GetHostUDS().AllowOpen(),
-		UDSCreateEnabled: conf.GetHostUDS().AllowCreate(),
-		ProfileEnabled:   len(profileOpts) > 0,
+		UDSOpenEnabled:     conf.GetHostUDS().AllowOpen(),
+		UDSCreateEnabled:   conf.GetHostUDS().AllowCreate(),
+		ProfileEnabled:     len(profileOpts) > 0,
+		InotifyEnabled:     conf.HostInotify,
+		LocksEnabled:       conf.HostFileLocks,
+		DelegationsEnabled: conf.HostDelegations,
 	}
 	if err := filter.Install(opts); err != nil {
 		util.Fatalf("installing seccomp filters: %v", err)
@@ -265,6 +278,9 @@ func (g *Gofer) serve(spec *specs.Spec, conf *config.Config, root string) subcom
 		HostUDS:            conf.GetHostUDS(),
 		HostFifo:           conf.HostFifo,
 		DonateMountPointFD: conf.DirectFS,
+		HostInotify:        conf.HostInotify,
+		HostFileLocks:      conf.HostFileLocks,
+		HostDelegations:    conf.HostDelegations,
 	})
 
 	// Start with root mount, then add any other additional mount as needed.
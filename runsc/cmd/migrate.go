@@ -0,0 +1,481 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/sandbox"
+)
+
+// migrateFlags are the flags shared by the sending ("checkpoint") and
+// receiving ("restore") sides of a migration. A migration streams the
+// checkpoint image from the source sandbox to the destination sandbox over a
+// TCP connection, without storing it on disk.
+type migrateFlags struct {
+	// tlsCert and tlsKey are the certificate and key presented to the peer.
+	tlsCert string
+	tlsKey  string
+	// tlsCA is the CA certificate used to verify the peer.
+	tlsCA string
+	// workDir is the directory that memory pre-copied by the source is
+	// stored in, on both sides.
+	workDir string
+}
+
+func (m *migrateFlags) setFlags(f *flag.FlagSet) {
+	f.StringVar(&m.tlsCert, "migrate-tls-cert", "", "PEM certificate presented to the migration peer. Enables mutual TLS, along with -migrate-tls-key and -migrate-tls-ca.")
+	f.StringVar(&m.tlsKey, "migrate-tls-key", "", "PEM private key for -migrate-tls-cert.")
+	f.StringVar(&m.tlsCA, "migrate-tls-ca", "", "PEM CA certificate used to verify the migration peer.")
+	f.StringVar(&m.workDir, "migrate-work-dir", "", "directory to store memory pre-copied during migration in. Defaults to the temporary directory.")
+}
+
+// tlsConfig returns the TLS configuration for the migration connection, or
+// nil if TLS is not configured.
+func (m *migrateFlags) tlsConfig() (*tls.Config, error) {
+	if m.tlsCert == "" && m.tlsKey == "" && m.tlsCA == "" {
+		return nil, nil
+	}
+	if m.tlsCert == "" || m.tlsKey == "" || m.tlsCA == "" {
+		return nil, fmt.Errorf("-migrate-tls-cert, -migrate-tls-key and -migrate-tls-ca must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(m.tlsCert, m.tlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading migration certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(m.tlsCA)
+	if err != nil {
+		return nil, fmt.Errorf("reading migration CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %q", m.tlsCA)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// dial connects to the migration destination at addr.
+func (m *migrateFlags) dial(addr string) (net.Conn, error) {
+	tlsConf, err := m.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf == nil {
+		log.Warningf("Migration to %s is not encrypted nor authenticated, consider setting -migrate-tls-*", addr)
+		return net.Dial("tcp", addr)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConf.ServerName = host
+	return tls.Dial("tcp", addr, tlsConf)
+}
+
+// accept listens on addr and accepts a single connection from the migration
+// source.
+func (m *migrateFlags) accept(addr string) (net.Conn, error) {
+	tlsConf, err := m.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	if tlsConf == nil {
+		log.Warningf("Migration from %s is not encrypted nor authenticated, consider setting -migrate-tls-*", addr)
+	} else {
+		l = tls.NewListener(l, tlsConf)
+	}
+	log.Infof("Waiting for migration source on %s", l.Addr())
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		// Complete the handshake now, so that authentication failures are
+		// reported before the sandbox starts restoring.
+		if err := tc.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with %s: %w", conn.RemoteAddr(), err)
+		}
+	}
+	log.Infof("Accepted migration connection from %s", conn.RemoteAddr())
+	return conn, nil
+}
+
+// The migration protocol consists of frames sent by the source, each
+// starting with a frame type byte:
+//
+//   - frameChunks is followed by the sizes of an index and a pack file chunk,
+//     as big-endian uint64s, and their contents. These are appended to the
+//     chunk store holding pre-copied memory.
+//
+//   - frameImage is followed by the checkpoint image, up to the end of the
+//     stream.
+//
+// Once the destination has restored the container, it replies with
+// migrateAck. Until then, the source keeps the container paused, so that it
+// can resume it if the migration fails.
+const (
+	frameChunks = 'C'
+	frameImage  = 'I'
+	migrateAck  = 'A'
+)
+
+// migrationSource is the container being migrated. It's implemented by
+// *container.Container.
+type migrationSource interface {
+	Checkpoint(f *os.File, options statefile.Options) error
+	CheckpointToChunkStore(f *os.File, chunks *sandbox.ChunkStoreFiles, options statefile.Options) error
+	Pause() error
+	Resume() error
+}
+
+// send migrates src to the destination at the other end of conn.
+//
+// If precopy is true, memory is first copied while src keeps running, and
+// only memory that changed since is copied once src is paused. Otherwise, src
+// is paused for the whole migration.
+//
+// On success, src is left paused and must be destroyed by the caller, since
+// it now runs on the destination. On failure, src is resumed.
+func (m *migrateFlags) send(conn net.Conn, src migrationSource, options statefile.Options, precopy bool) (retErr error) {
+	// Keep the sandbox running after each checkpoint: src is only gone once
+	// the destination has restored it.
+	options.Resume = true
+
+	var store *precopyStore
+	if precopy {
+		var err error
+		if store, err = newPrecopyStore(m.workDir); err != nil {
+			return err
+		}
+		defer store.release()
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		log.Infof("Pre-copying memory to migration destination")
+		err = src.CheckpointToChunkStore(devNull, store.files, options)
+		devNull.Close()
+		if err != nil {
+			return fmt.Errorf("pre-copying memory: %w", err)
+		}
+		if err := store.send(conn); err != nil {
+			return err
+		}
+	}
+
+	if err := src.Pause(); err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			if err := src.Resume(); err != nil {
+				log.Warningf("Resuming container after failed migration: %v", err)
+			}
+		}
+	}()
+
+	if store != nil {
+		// The image can only be sent after the chunks it refers to, so
+		// save it to a file first.
+		image, err := os.CreateTemp(store.dir, "image")
+		if err != nil {
+			return err
+		}
+		defer image.Close()
+		if err := src.CheckpointToChunkStore(image, store.files, options); err != nil {
+			return err
+		}
+		if err := store.send(conn); err != nil {
+			return err
+		}
+		if _, err := conn.Write([]byte{frameImage}); err != nil {
+			return fmt.Errorf("sending checkpoint image: %w", err)
+		}
+		if _, err := io.Copy(conn, io.NewSectionReader(image, 0, 1<<63-1)); err != nil {
+			return fmt.Errorf("sending checkpoint image: %w", err)
+		}
+	} else if err := migrateSendImage(conn, func(f *os.File) error {
+		return src.Checkpoint(f, options)
+	}); err != nil {
+		return err
+	}
+
+	// Signal the end of the image to the destination.
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		if err := cw.CloseWrite(); err != nil {
+			return fmt.Errorf("closing migration connection: %w", err)
+		}
+	}
+	var ack [1]byte
+	if _, err := io.ReadFull(conn, ack[:]); err != nil || ack[0] != migrateAck {
+		return fmt.Errorf("destination failed to restore the container, see its logs for details")
+	}
+	return nil
+}
+
+// migrateSendImage streams the checkpoint image written by checkpoint to
+// conn. The image is passed to the sandbox through a pipe, since TLS is
+// terminated in this process.
+func migrateSendImage(conn net.Conn, checkpoint func(*os.File) error) error {
+	if _, err := conn.Write([]byte{frameImage}); err != nil {
+		return fmt.Errorf("sending checkpoint image: %w", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, r)
+		// If conn failed, the sandbox gets EPIPE instead of blocking on a
+		// full pipe.
+		r.Close()
+		copyErr <- err
+	}()
+
+	err = checkpoint(w)
+	// The sandbox closes its copy of the pipe when the checkpoint is complete.
+	// Closing ours makes the copy above see EOF.
+	w.Close()
+	if err != nil {
+		// Unblock the copy, in case the sandbox didn't close its copy.
+		r.Close()
+		if err := <-copyErr; err != nil {
+			log.Warningf("Sending checkpoint image: %v", err)
+		}
+		return err
+	}
+	if err := <-copyErr; err != nil {
+		return fmt.Errorf("sending checkpoint image: %w", err)
+	}
+	return nil
+}
+
+// precopyStore is a temporary chunk store that memory is pre-copied through.
+// The store's files are append-only, so only the parts that weren't sent yet
+// need to be sent to the destination.
+type precopyStore struct {
+	dir   string
+	files *sandbox.ChunkStoreFiles
+
+	// indexSent and packSent are the number of bytes of the index and pack
+	// files sent to the destination.
+	indexSent int64
+	packSent  int64
+}
+
+// newPrecopyStore creates an empty chunk store in a new temporary directory
+// in workDir.
+func newPrecopyStore(workDir string) (*precopyStore, error) {
+	dir, err := os.MkdirTemp(workDir, "runsc-migrate-")
+	if err != nil {
+		return nil, err
+	}
+	s := &precopyStore{
+		dir:   dir,
+		files: &sandbox.ChunkStoreFiles{},
+	}
+	if s.files.Index, err = os.Create(filepath.Join(dir, chunkStoreIndexName)); err != nil {
+		s.release()
+		return nil, err
+	}
+	if s.files.Pack, err = os.Create(filepath.Join(dir, chunkStorePackName)); err != nil {
+		s.release()
+		return nil, err
+	}
+	// The destination doesn't need to know which chunks are referenced.
+	if s.files.Refs, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0); err != nil {
+		s.release()
+		return nil, err
+	}
+	return s, nil
+}
+
+// release closes and removes the store's files.
+func (s *precopyStore) release() {
+	for _, f := range []*os.File{s.files.Index, s.files.Pack, s.files.Refs} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		log.Warningf("Removing %q: %v", s.dir, err)
+	}
+}
+
+// send sends the parts of the store that weren't sent yet to conn.
+func (s *precopyStore) send(conn net.Conn) error {
+	index, err := s.files.Index.Stat()
+	if err != nil {
+		return err
+	}
+	pack, err := s.files.Pack.Stat()
+	if err != nil {
+		return err
+	}
+	indexLen, packLen := index.Size()-s.indexSent, pack.Size()-s.packSent
+	var hdr [17]byte
+	hdr[0] = frameChunks
+	binary.BigEndian.PutUint64(hdr[1:], uint64(indexLen))
+	binary.BigEndian.PutUint64(hdr[9:], uint64(packLen))
+	if _, err := conn.Write(hdr[:]); err != nil {
+		return fmt.Errorf("sending memory: %w", err)
+	}
+	// The sandbox shares the files' offsets, so read them with pread.
+	if _, err := io.Copy(conn, io.NewSectionReader(s.files.Index, s.indexSent, indexLen)); err != nil {
+		return fmt.Errorf("sending memory: %w", err)
+	}
+	if _, err := io.Copy(conn, io.NewSectionReader(s.files.Pack, s.packSent, packLen)); err != nil {
+		return fmt.Errorf("sending memory: %w", err)
+	}
+	log.Infof("Sent %d bytes of memory to migration destination", packLen)
+	s.indexSent += indexLen
+	s.packSent += packLen
+	return nil
+}
+
+// migrationImage is a checkpoint image received from a migration source.
+type migrationImage struct {
+	// conn is the connection to the source.
+	conn net.Conn
+
+	// image yields the checkpoint image. Errors receiving the image are
+	// reported to the sandbox as a truncated image, and through received.
+	image *os.File
+
+	// received receives the result of receiving the image, once the source
+	// has sent it.
+	received <-chan error
+
+	// chunks is the chunk store holding memory pre-copied by the source, or
+	// nil if the source didn't pre-copy memory.
+	chunks *precopyStore
+}
+
+// receive receives the checkpoint image from conn. Memory pre-copied by the
+// source is received before receive returns. The caller must call
+// migrationImage.release.
+func (m *migrateFlags) receive(conn net.Conn) (*migrationImage, error) {
+	mi := &migrationImage{conn: conn}
+	br := bufio.NewReader(conn)
+	for {
+		frame, err := br.ReadByte()
+		if err != nil {
+			mi.release()
+			return nil, fmt.Errorf("receiving migration frame: %w", err)
+		}
+		if frame == frameImage {
+			break
+		}
+		if frame != frameChunks {
+			mi.release()
+			return nil, fmt.Errorf("unknown migration frame %#x", frame)
+		}
+		if mi.chunks == nil {
+			if mi.chunks, err = newPrecopyStore(m.workDir); err != nil {
+				return nil, err
+			}
+		}
+		if err := mi.chunks.receive(br); err != nil {
+			mi.release()
+			return nil, err
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		mi.release()
+		return nil, err
+	}
+	received := make(chan error, 1)
+	go func() {
+		defer w.Close()
+		n, err := io.Copy(w, br)
+		log.Infof("Received %d bytes of checkpoint image from %s", n, conn.RemoteAddr())
+		received <- err
+	}()
+	mi.image = r
+	mi.received = received
+	return mi, nil
+}
+
+// receive appends a frameChunks frame's contents, after the frame type, to
+// the store.
+func (s *precopyStore) receive(r io.Reader) error {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return fmt.Errorf("receiving memory: %w", err)
+	}
+	indexLen := int64(binary.BigEndian.Uint64(hdr[:]))
+	packLen := int64(binary.BigEndian.Uint64(hdr[8:]))
+	if _, err := io.CopyN(s.files.Index, r, indexLen); err != nil {
+		return fmt.Errorf("receiving memory: %w", err)
+	}
+	if _, err := io.CopyN(s.files.Pack, r, packLen); err != nil {
+		return fmt.Errorf("receiving memory: %w", err)
+	}
+	log.Infof("Received %d bytes of memory from migration source", packLen)
+	return nil
+}
+
+// storeFiles returns the files of the chunk store holding pre-copied memory,
+// or nil if there is none.
+func (mi *migrationImage) storeFiles() *sandbox.ChunkStoreFiles {
+	if mi.chunks == nil {
+		return nil
+	}
+	return &sandbox.ChunkStoreFiles{Index: mi.chunks.files.Index, Pack: mi.chunks.files.Pack}
+}
+
+// release releases the resources held by mi.
+func (mi *migrationImage) release() {
+	if mi.image != nil {
+		mi.image.Close()
+	}
+	if mi.chunks != nil {
+		mi.chunks.release()
+	}
+}
+
+// acknowledge tells the source that the container was restored, so that it
+// can be destroyed there.
+func (mi *migrationImage) acknowledge() error {
+	_, err := mi.conn.Write([]byte{migrateAck})
+	return err
+}
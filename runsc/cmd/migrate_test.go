@@ -0,0 +1,255 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/runsc/sandbox"
+)
+
+// fakeSource simulates a sandbox being checkpointed.
+type fakeSource struct {
+	// image is written as the checkpoint image.
+	image []byte
+
+	// index and pack are appended to the chunk store by each chunk store
+	// checkpoint.
+	index []byte
+	pack  []byte
+
+	// err is returned by checkpoints.
+	err error
+
+	paused  bool
+	resumed bool
+}
+
+func (s *fakeSource) Checkpoint(f *os.File, options statefile.Options) error {
+	if !options.Resume {
+		return errors.New("checkpoint without Resume")
+	}
+	if s.err != nil {
+		return s.err
+	}
+	_, err := f.Write(s.image)
+	return err
+}
+
+func (s *fakeSource) CheckpointToChunkStore(f *os.File, chunks *sandbox.ChunkStoreFiles, options statefile.Options) error {
+	for _, c := range []struct {
+		f    *os.File
+		data []byte
+	}{{chunks.Index, s.index}, {chunks.Pack, s.pack}} {
+		info, err := c.f.Stat()
+		if err != nil {
+			return err
+		}
+		if _, err := c.f.WriteAt(c.data, info.Size()); err != nil {
+			return err
+		}
+	}
+	return s.Checkpoint(f, options)
+}
+
+func (s *fakeSource) Pause() error {
+	s.paused = true
+	return nil
+}
+
+func (s *fakeSource) Resume() error {
+	s.resumed = true
+	return nil
+}
+
+// migrateResult is what the destination received.
+type migrateResult struct {
+	image []byte
+	index []byte
+	pack  []byte
+}
+
+// startMigrateDestination accepts a migration on l and acknowledges it if ack
+// is true.
+func startMigrateDestination(t *testing.T, l net.Listener, ack bool) <-chan migrateResult {
+	got := make(chan migrateResult, 1)
+	go func() {
+		var res migrateResult
+		defer func() { got <- res }()
+		conn, err := l.Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+			return
+		}
+		defer conn.Close()
+		m := migrateFlags{workDir: t.TempDir()}
+		mi, err := m.receive(conn)
+		if err != nil {
+			t.Errorf("receive: %v", err)
+			return
+		}
+		defer mi.release()
+		if chunks := mi.storeFiles(); chunks != nil {
+			if res.index, err = io.ReadAll(io.NewSectionReader(chunks.Index, 0, 1<<20)); err != nil {
+				t.Errorf("reading index: %v", err)
+			}
+			if res.pack, err = io.ReadAll(io.NewSectionReader(chunks.Pack, 0, 1<<20)); err != nil {
+				t.Errorf("reading pack: %v", err)
+			}
+		}
+		// Simulate the sandbox reading the whole image.
+		if res.image, err = io.ReadAll(mi.image); err != nil {
+			t.Errorf("reading image: %v", err)
+		}
+		if err := <-mi.received; err != nil {
+			t.Errorf("receiving image: %v", err)
+		}
+		if ack {
+			if err := mi.acknowledge(); err != nil {
+				t.Errorf("acknowledge: %v", err)
+			}
+		}
+	}()
+	return got
+}
+
+func TestMigrate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		precopy bool
+		ack     bool
+		// wantChunks is the number of copies of the source's index and
+		// pack the destination should receive.
+		wantChunks int
+	}{
+		{name: "stop and copy", ack: true},
+		{name: "precopy", precopy: true, ack: true, wantChunks: 2},
+		{name: "no ack", ack: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+			defer l.Close()
+			got := startMigrateDestination(t, l, tc.ack)
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer conn.Close()
+			src := &fakeSource{
+				image: bytes.Repeat([]byte("checkpoint"), 100000),
+				index: []byte("index"),
+				pack:  bytes.Repeat([]byte("pack"), 1000),
+			}
+			m := migrateFlags{workDir: t.TempDir()}
+			err = m.send(conn, src, statefile.Options{}, tc.precopy)
+			if tc.ack && err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			if !tc.ack && err == nil {
+				t.Fatalf("send succeeded without acknowledgement")
+			}
+			if !src.paused {
+				t.Errorf("source was not paused")
+			}
+			if src.resumed == tc.ack {
+				t.Errorf("source resumed: %t, want %t", src.resumed, !tc.ack)
+			}
+
+			res := <-got
+			if !bytes.Equal(res.image, src.image) {
+				t.Errorf("received %d bytes of image, want %d bytes", len(res.image), len(src.image))
+			}
+			if want := bytes.Repeat(src.index, tc.wantChunks); !bytes.Equal(res.index, want) {
+				t.Errorf("received index %q, want %q", res.index, want)
+			}
+			if want := bytes.Repeat(src.pack, tc.wantChunks); !bytes.Equal(res.pack, want) {
+				t.Errorf("received %d bytes of pack, want %d bytes", len(res.pack), len(want))
+			}
+		})
+	}
+}
+
+func TestMigrateCheckpointError(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go io.Copy(io.Discard, server)
+
+	wantErr := errors.New("checkpoint failed")
+	src := &fakeSource{err: wantErr}
+	var m migrateFlags
+	if err := m.send(client, src, statefile.Options{}, false /* precopy */); err != wantErr {
+		t.Errorf("send: got %v, want %v", err, wantErr)
+	}
+	if !src.resumed {
+		t.Errorf("source was not resumed after failed checkpoint")
+	}
+}
+
+func TestMigrateConnectionError(t *testing.T) {
+	client, server := net.Pipe()
+	// Accept the frame type, then fail while the image is being sent.
+	go func() {
+		var frame [1]byte
+		io.ReadFull(server, frame[:])
+		server.Close()
+	}()
+	defer client.Close()
+
+	src := &fakeSource{image: bytes.Repeat([]byte("checkpoint"), 100000)}
+	var m migrateFlags
+	if err := m.send(client, src, statefile.Options{}, false /* precopy */); err == nil {
+		t.Errorf("send succeeded, want error")
+	}
+	if !src.resumed {
+		t.Errorf("source was not resumed after failed migration")
+	}
+}
+
+func TestMigrateTLSConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		flags   migrateFlags
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "cert only", flags: migrateFlags{tlsCert: "cert.pem"}, wantErr: true},
+		{name: "no CA", flags: migrateFlags{tlsCert: "cert.pem", tlsKey: "key.pem"}, wantErr: true},
+		{name: "missing files", flags: migrateFlags{tlsCert: "/nonexistent/cert.pem", tlsKey: "/nonexistent/key.pem", tlsCA: "/nonexistent/ca.pem"}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, err := tc.flags.tlsConfig()
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("tlsConfig() succeeded, want error")
+				}
+				return
+			}
+			if err != nil || conf != nil {
+				t.Errorf("tlsConfig() = %v, %v, want nil, nil", conf, err)
+			}
+		})
+	}
+}
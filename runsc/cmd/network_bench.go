@@ -0,0 +1,551 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+const (
+	// networkBenchResultPrefix prefixes the line holding the result printed
+	// by benchmark workers.
+	networkBenchResultPrefix = "network-bench-result: "
+
+	// networkBenchDialTimeout bounds the time to connect to a benchmark
+	// server.
+	networkBenchDialTimeout = 5 * time.Second
+
+	// networkBenchMaxConnects is the maximum number of connections made to
+	// measure the connect latency to an external server.
+	networkBenchMaxConnects = 20
+
+	// networkBenchSlowRatio is the fraction of the host loopback throughput
+	// below which the sandbox is considered slow.
+	networkBenchSlowRatio = 0.25
+
+	// Benchmark names.
+	networkBenchHostLoopback = "host-loopback"
+	networkBenchLoopback     = "loopback"
+	networkBenchVeth         = "veth"
+	networkBenchExternal     = "external"
+
+	// Connection modes of the benchmark server, sent as the first byte of
+	// each connection.
+	networkBenchThroughputMode = 'T'
+	networkBenchLatencyMode    = 'L'
+)
+
+// NetworkBench implements subcommands.Command for the "network-bench"
+// command.
+type NetworkBench struct {
+	tests    string
+	duration time.Duration
+	samples  int
+	external string
+	ip       string
+	format   string
+
+	// worker and target are set when the command runs as a benchmark worker
+	// inside the sandbox.
+	worker string
+	target string
+}
+
+// Name implements subcommands.Command.Name.
+func (*NetworkBench) Name() string {
+	return "network-bench"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*NetworkBench) Synopsis() string {
+	return "Measure network performance under the current configuration and suggest flags to improve it."
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*NetworkBench) Usage() string {
+	return `network-bench [flags]
+
+Measures TCP throughput and latency in sandboxes started with "runsc do",
+using the runsc flags given before "network-bench", and compares them with
+the host loopback. The following benchmarks are available:
+
+  loopback: both ends run inside the sandbox, over its loopback interface.
+  veth:     the sandbox connects to a server on the host, through the veth
+            pair set up by "runsc do" with --network=sandbox, or the host
+            network with --network=host.
+  external: the sandbox connects to the -external address, which may be any
+            TCP server. Only the connect latency is measured.
+
+Based on the results and the configuration, flags that may improve network
+performance are suggested. Sandboxes are created in a temporary state
+directory, and the veth benchmark with --network=sandbox requires the same
+privileges as "runsc do".
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (n *NetworkBench) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&n.tests, "tests", "loopback,veth,external", "comma-separated list of benchmarks to run")
+	f.DurationVar(&n.duration, "duration", 5*time.Second, "duration of each throughput measurement")
+	f.IntVar(&n.samples, "samples", 1000, "number of round trips of each latency measurement")
+	f.StringVar(&n.external, "external", "", "host:port of a TCP server for the external benchmark, which is skipped if empty")
+	f.StringVar(&n.ip, "ip", "192.168.10.2", `IPv4 address of the sandbox, passed to "runsc do"`)
+	f.StringVar(&n.format, "format", "text", "output format: text or json")
+	f.StringVar(&n.worker, "worker", "", "internal use only: benchmark to run as a worker inside the sandbox")
+	f.StringVar(&n.target, "target", "", "internal use only: address of the server used by the worker")
+}
+
+// networkBenchResult is the result of one benchmark.
+type networkBenchResult struct {
+	Test string `json:"test"`
+
+	// Skipped is the reason the benchmark wasn't run, if any.
+	Skipped string `json:"skipped,omitempty"`
+
+	// Error is the error that ended the benchmark, if any.
+	Error string `json:"error,omitempty"`
+
+	// ThroughputMbps is the TCP throughput in megabits per second.
+	ThroughputMbps float64 `json:"throughput_mbps,omitempty"`
+
+	// LatencyP50 and LatencyP99 are percentiles of the round trip time of
+	// one byte messages or, for the external benchmark, of the connect time.
+	LatencyP50 time.Duration `json:"latency_p50_ns,omitempty"`
+	LatencyP99 time.Duration `json:"latency_p99_ns,omitempty"`
+}
+
+// networkBenchAdvice is a suggested flag.
+type networkBenchAdvice struct {
+	Flag   string `json:"flag"`
+	Reason string `json:"reason"`
+}
+
+// networkBenchReport is the output of the command.
+type networkBenchReport struct {
+	Network string               `json:"network"`
+	Results []networkBenchResult `json:"results"`
+	Advice  []networkBenchAdvice `json:"advice"`
+}
+
+// Execute implements subcommands.Command.Execute.
+func (n *NetworkBench) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 0 || n.duration <= 0 || n.samples <= 0 || (n.format != "text" && n.format != "json") {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	if n.worker != "" {
+		return n.runWorker()
+	}
+	conf := args[0].(*config.Config)
+
+	report := networkBenchReport{Network: conf.Network.String()}
+	results := make(map[string]networkBenchResult)
+	add := func(r networkBenchResult) {
+		results[r.Test] = r
+		report.Results = append(report.Results, r)
+	}
+	add(n.hostLoopback())
+	for _, test := range strings.Split(n.tests, ",") {
+		switch test = strings.TrimSpace(test); test {
+		case networkBenchLoopback:
+			add(n.runInSandbox(conf, test, ""))
+		case networkBenchVeth:
+			add(n.veth(conf))
+		case networkBenchExternal:
+			if n.external == "" {
+				add(networkBenchResult{Test: test, Skipped: "no -external address"})
+				continue
+			}
+			add(n.runInSandbox(conf, test, n.external))
+		default:
+			return util.Errorf("unknown benchmark %q", test)
+		}
+	}
+	report.Advice = networkBenchAdvise(conf, runtime.NumCPU(), results)
+
+	if n.format == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(&report); err != nil {
+			return util.Errorf("writing report: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+	printNetworkBenchReport(os.Stdout, &report)
+	return subcommands.ExitSuccess
+}
+
+// hostLoopback runs the loopback benchmark on the host, as a baseline.
+func (n *NetworkBench) hostLoopback() networkBenchResult {
+	r := n.loopback()
+	r.Test = networkBenchHostLoopback
+	return r
+}
+
+// veth runs the veth benchmark against a server on the host.
+func (n *NetworkBench) veth(conf *config.Config) networkBenchResult {
+	var host string
+	switch conf.Network {
+	case config.NetworkSandbox:
+		if conf.Rootless {
+			return networkBenchResult{Test: networkBenchVeth, Skipped: "no veth pair with --rootless"}
+		}
+		peerIP, err := calculatePeerIP(n.ip)
+		if err != nil {
+			return networkBenchResult{Test: networkBenchVeth, Error: err.Error()}
+		}
+		host = peerIP
+	case config.NetworkHost:
+		host = "127.0.0.1"
+	default:
+		return networkBenchResult{Test: networkBenchVeth, Skipped: fmt.Sprintf("not available with --network=%s", conf.Network)}
+	}
+
+	// With --network=sandbox, the peer address only exists once the sandbox
+	// is set up, so listen on all addresses.
+	l, err := net.Listen("tcp4", ":0")
+	if err != nil {
+		return networkBenchResult{Test: networkBenchVeth, Error: err.Error()}
+	}
+	defer l.Close()
+	go serveNetworkBench(l)
+	port := l.Addr().(*net.TCPAddr).Port
+	return n.runInSandbox(conf, networkBenchVeth, net.JoinHostPort(host, fmt.Sprint(port)))
+}
+
+// runInSandbox runs a benchmark worker in a sandbox started with "runsc do".
+func (n *NetworkBench) runInSandbox(conf *config.Config, test, target string) networkBenchResult {
+	r := networkBenchResult{Test: test}
+	exe, err := os.Executable()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	stateDir, err := os.MkdirTemp("", "runsc-network-bench-")
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer os.RemoveAll(stateDir)
+
+	args := append(conf.ToFlags(), "--root="+stateDir, "do", "-quiet", "-ip="+n.ip,
+		exe, "network-bench",
+		"-worker="+test,
+		"-target="+target,
+		"-duration="+n.duration.String(),
+		fmt.Sprintf("-samples=%d", n.samples))
+	cmd := exec.Command(exe, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	log.Infof("Running %q benchmark: %s %s", test, exe, strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		r.Error = fmt.Sprintf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		return r
+	}
+	s := bufio.NewScanner(&stdout)
+	for s.Scan() {
+		if line, ok := strings.CutPrefix(s.Text(), networkBenchResultPrefix); ok {
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				r.Error = fmt.Sprintf("parsing worker result: %v", err)
+			}
+			return r
+		}
+	}
+	r.Error = fmt.Sprintf("no result from worker: %s", strings.TrimSpace(stderr.String()))
+	return r
+}
+
+// runWorker runs n.worker and prints its result.
+func (n *NetworkBench) runWorker() subcommands.ExitStatus {
+	var r networkBenchResult
+	switch n.worker {
+	case networkBenchLoopback:
+		r = n.loopback()
+	case networkBenchVeth:
+		r = n.client(n.target)
+	case networkBenchExternal:
+		var err error
+		if r.LatencyP50, r.LatencyP99, err = measureConnectLatency(n.target, n.samples); err != nil {
+			r.Error = err.Error()
+		}
+	default:
+		return util.Errorf("unknown worker %q", n.worker)
+	}
+	r.Test = n.worker
+	b, err := json.Marshal(&r)
+	if err != nil {
+		return util.Errorf("encoding result: %v", err)
+	}
+	fmt.Printf("%s%s\n", networkBenchResultPrefix, b)
+	return subcommands.ExitSuccess
+}
+
+// loopback measures a server and a client running in this process.
+func (n *NetworkBench) loopback() networkBenchResult {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return networkBenchResult{Error: err.Error()}
+	}
+	defer l.Close()
+	go serveNetworkBench(l)
+	return n.client(l.Addr().String())
+}
+
+// client measures the throughput and latency to the benchmark server at
+// target.
+func (n *NetworkBench) client(target string) networkBenchResult {
+	var r networkBenchResult
+	var err error
+	if r.ThroughputMbps, err = measureThroughput(target, n.duration); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	if r.LatencyP50, r.LatencyP99, err = measureLatency(target, n.samples); err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// serveNetworkBench serves benchmark connections accepted on l until it's
+// closed.
+func serveNetworkBench(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			var mode [1]byte
+			if _, err := io.ReadFull(c, mode[:]); err != nil {
+				return
+			}
+			switch mode[0] {
+			case networkBenchThroughputMode:
+				// Discard everything, then report the number of bytes
+				// received, so that the client measures the time until
+				// the last byte is received.
+				received, _ := io.Copy(io.Discard, c)
+				var b [8]byte
+				binary.BigEndian.PutUint64(b[:], uint64(received))
+				c.Write(b[:])
+			case networkBenchLatencyMode:
+				io.Copy(c, c)
+			}
+		}()
+	}
+}
+
+// measureThroughput sends data to the benchmark server at target for d, and
+// returns the throughput in megabits per second.
+func measureThroughput(target string, d time.Duration) (float64, error) {
+	c, err := net.DialTimeout("tcp", target, networkBenchDialTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(d + networkBenchDialTimeout))
+	if _, err := c.Write([]byte{networkBenchThroughputMode}); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 128<<10)
+	start := time.Now()
+	for time.Since(start) < d {
+		if _, err := c.Write(buf); err != nil {
+			return 0, err
+		}
+	}
+	if err := c.(*net.TCPConn).CloseWrite(); err != nil {
+		return 0, err
+	}
+	var ack [8]byte
+	if _, err := io.ReadFull(c, ack[:]); err != nil {
+		return 0, fmt.Errorf("reading server acknowledgement: %w", err)
+	}
+	elapsed := time.Since(start)
+	received := binary.BigEndian.Uint64(ack[:])
+	return float64(received) * 8 / elapsed.Seconds() / 1e6, nil
+}
+
+// measureLatency measures the round trip time of samples one byte messages
+// echoed by the benchmark server at target.
+func measureLatency(target string, samples int) (p50, p99 time.Duration, err error) {
+	c, err := net.DialTimeout("tcp", target, networkBenchDialTimeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte{networkBenchLatencyMode}); err != nil {
+		return 0, 0, err
+	}
+
+	rtts := make([]time.Duration, 0, samples)
+	b := []byte{0}
+	for i := 0; i < samples; i++ {
+		c.SetDeadline(time.Now().Add(networkBenchDialTimeout))
+		start := time.Now()
+		if _, err := c.Write(b); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(c, b); err != nil {
+			return 0, 0, err
+		}
+		rtts = append(rtts, time.Since(start))
+	}
+	return percentile(rtts, 50), percentile(rtts, 99), nil
+}
+
+// measureConnectLatency measures the time to connect to target, which may be
+// any TCP server. It connects at most networkBenchMaxConnects times.
+func measureConnectLatency(target string, samples int) (p50, p99 time.Duration, err error) {
+	if samples > networkBenchMaxConnects {
+		samples = networkBenchMaxConnects
+	}
+	times := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		c, err := net.DialTimeout("tcp", target, networkBenchDialTimeout)
+		if err != nil {
+			return 0, 0, err
+		}
+		times = append(times, time.Since(start))
+		c.Close()
+	}
+	return percentile(times, 50), percentile(times, 99), nil
+}
+
+// percentile returns the p-th percentile of ds, using the nearest-rank
+// method. ds is sorted in place.
+func percentile(ds []time.Duration, p int) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	rank := (len(ds)*p + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return ds[rank-1]
+}
+
+// networkBenchAdvise returns flags that may improve network performance,
+// given the configuration, the number of CPUs and benchmark results indexed
+// by name.
+func networkBenchAdvise(conf *config.Config, numCPU int, results map[string]networkBenchResult) []networkBenchAdvice {
+	var advice []networkBenchAdvice
+	if conf.Network != config.NetworkSandbox {
+		if conf.Network == config.NetworkNone {
+			advice = append(advice, networkBenchAdvice{
+				Flag:   "--network=sandbox",
+				Reason: "only the loopback interface is available with --network=none",
+			})
+		}
+		return advice
+	}
+
+	// slow returns true if the throughput of test is known and much lower
+	// than the host loopback throughput.
+	host := results[networkBenchHostLoopback]
+	slow := func(test string) bool {
+		r, ok := results[test]
+		if !ok || r.Error != "" || r.Skipped != "" || host.Error != "" || host.ThroughputMbps == 0 {
+			return false
+		}
+		return r.ThroughputMbps < networkBenchSlowRatio*host.ThroughputMbps
+	}
+
+	if !conf.HostGSO && !conf.GvisorGSO {
+		advice = append(advice, networkBenchAdvice{
+			Flag:   "--software-gso=true",
+			Reason: "segmentation offload is disabled, so the sandbox processes TCP data one MTU-sized packet at a time",
+		})
+	}
+	if slow(networkBenchVeth) {
+		if !conf.AFXDP {
+			advice = append(advice, networkBenchAdvice{
+				Flag:   "--EXPERIMENTAL-afxdp=true",
+				Reason: "veth throughput is low; AF_XDP reduces the cost of receiving packets from the host",
+			})
+		}
+		if conf.NumNetworkChannels < numCPU {
+			advice = append(advice, networkBenchAdvice{
+				Flag:   fmt.Sprintf("--num-network-channels=%d", numCPU),
+				Reason: "veth throughput is low; more channels spread packet processing over more CPUs",
+			})
+		}
+	}
+	if slow(networkBenchVeth) || slow(networkBenchLoopback) {
+		advice = append(advice, networkBenchAdvice{
+			Flag:   "--network=host",
+			Reason: "the host network stack is faster than netstack, but weakens the isolation of the sandbox from the host",
+		})
+	}
+	return advice
+}
+
+// printNetworkBenchReport prints report as text.
+func printNetworkBenchReport(w io.Writer, report *networkBenchReport) {
+	fmt.Fprintf(w, "Network: %s\n\n", report.Network)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "BENCHMARK\tTHROUGHPUT\tLATENCY P50\tLATENCY P99\tNOTE")
+	for _, r := range report.Results {
+		switch {
+		case r.Skipped != "":
+			fmt.Fprintf(tw, "%s\t-\t-\t-\tskipped: %s\n", r.Test, r.Skipped)
+		case r.Error != "":
+			fmt.Fprintf(tw, "%s\t-\t-\t-\terror: %s\n", r.Test, r.Error)
+		default:
+			throughput := "-"
+			if r.ThroughputMbps != 0 {
+				throughput = fmt.Sprintf("%.1f Mbps", r.ThroughputMbps)
+			}
+			var note string
+			if r.Test == networkBenchExternal {
+				note = "connect latency"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%v\t%v\t%s\n", r.Test, throughput, r.LatencyP50, r.LatencyP99, note)
+		}
+	}
+	tw.Flush()
+
+	if len(report.Advice) == 0 {
+		fmt.Fprintln(w, "\nNo suggestions.")
+		return
+	}
+	fmt.Fprintln(w, "\nSuggestions:")
+	for _, a := range report.Advice {
+		fmt.Fprintf(w, "  %s: %s\n", a.Flag, a.Reason)
+	}
+}
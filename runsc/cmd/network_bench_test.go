@@ -0,0 +1,172 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+func TestPercentile(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ds   []time.Duration
+		p    int
+		want time.Duration
+	}{
+		{name: "empty", p: 50, want: 0},
+		{name: "single", ds: []time.Duration{3}, p: 99, want: 3},
+		{name: "p50", ds: []time.Duration{4, 1, 3, 2}, p: 50, want: 2},
+		{name: "p99", ds: []time.Duration{4, 1, 3, 2}, p: 99, want: 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := percentile(tc.ds, tc.p); got != tc.want {
+				t.Errorf("percentile(%v, %d) = %v, want %v", tc.ds, tc.p, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNetworkBenchAdvise(t *testing.T) {
+	fast := map[string]networkBenchResult{
+		networkBenchHostLoopback: {Test: networkBenchHostLoopback, ThroughputMbps: 10000},
+		networkBenchLoopback:     {Test: networkBenchLoopback, ThroughputMbps: 8000},
+		networkBenchVeth:         {Test: networkBenchVeth, ThroughputMbps: 5000},
+	}
+	slowVeth := map[string]networkBenchResult{
+		networkBenchHostLoopback: {Test: networkBenchHostLoopback, ThroughputMbps: 10000},
+		networkBenchLoopback:     {Test: networkBenchLoopback, ThroughputMbps: 8000},
+		networkBenchVeth:         {Test: networkBenchVeth, ThroughputMbps: 1000},
+	}
+	failedVeth := map[string]networkBenchResult{
+		networkBenchHostLoopback: {Test: networkBenchHostLoopback, ThroughputMbps: 10000},
+		networkBenchVeth:         {Test: networkBenchVeth, Error: "failed"},
+	}
+	for _, tc := range []struct {
+		name    string
+		conf    func(*config.Config)
+		numCPU  int
+		results map[string]networkBenchResult
+		want    []string
+	}{
+		{
+			name:    "fast",
+			numCPU:  1,
+			results: fast,
+		},
+		{
+			name: "no gso",
+			conf: func(c *config.Config) {
+				c.HostGSO = false
+				c.GvisorGSO = false
+			},
+			numCPU:  1,
+			results: fast,
+			want:    []string{"--software-gso=true"},
+		},
+		{
+			name:    "slow veth",
+			numCPU:  4,
+			results: slowVeth,
+			want:    []string{"--EXPERIMENTAL-afxdp=true", "--num-network-channels=4", "--network=host"},
+		},
+		{
+			name: "slow veth with afxdp",
+			conf: func(c *config.Config) {
+				c.AFXDP = true
+				c.NumNetworkChannels = 4
+			},
+			numCPU:  4,
+			results: slowVeth,
+			want:    []string{"--network=host"},
+		},
+		{
+			name:    "failed veth",
+			numCPU:  4,
+			results: failedVeth,
+		},
+		{
+			name: "host network",
+			conf: func(c *config.Config) {
+				c.Network = config.NetworkHost
+			},
+			numCPU:  4,
+			results: slowVeth,
+		},
+		{
+			name: "no network",
+			conf: func(c *config.Config) {
+				c.Network = config.NetworkNone
+			},
+			numCPU:  1,
+			results: fast,
+			want:    []string{"--network=sandbox"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.Config{
+				Network:            config.NetworkSandbox,
+				HostGSO:            true,
+				GvisorGSO:          true,
+				NumNetworkChannels: 1,
+			}
+			if tc.conf != nil {
+				tc.conf(conf)
+			}
+			var got []string
+			for _, a := range networkBenchAdvise(conf, tc.numCPU, tc.results) {
+				got = append(got, a.Flag)
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("networkBenchAdvise() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNetworkBenchLoopback(t *testing.T) {
+	n := &NetworkBench{duration: 100 * time.Millisecond, samples: 10}
+	r := n.hostLoopback()
+	if r.Error != "" {
+		t.Fatalf("hostLoopback() failed: %s", r.Error)
+	}
+	if r.ThroughputMbps <= 0 || r.LatencyP50 <= 0 || r.LatencyP99 < r.LatencyP50 {
+		t.Errorf("hostLoopback() = %+v, want positive throughput and latencies", r)
+	}
+
+	var out bytes.Buffer
+	printNetworkBenchReport(&out, &networkBenchReport{Network: "sandbox", Results: []networkBenchResult{r}})
+	if !strings.Contains(out.String(), networkBenchHostLoopback) {
+		t.Errorf("report doesn't contain %q:\n%s", networkBenchHostLoopback, out.String())
+	}
+}
+
+func TestMeasureConnectLatency(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	go serveNetworkBench(l)
+
+	if _, _, err := measureConnectLatency(l.Addr().String(), 100); err != nil {
+		t.Errorf("measureConnectLatency() failed: %v", err)
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// PCAP implements subcommands.Command for the "pcap" command.
+type PCAP struct {
+	nic         string
+	filter      string
+	snapLen     uint
+	output      string
+	outputFD    int
+	rotateMB    uint
+	rotateFiles uint
+	duration    time.Duration
+	stop        bool
+}
+
+// Name implements subcommands.Command.
+func (*PCAP) Name() string {
+	return "pcap"
+}
+
+// Synopsis implements subcommands.Command.
+func (*PCAP) Synopsis() string {
+	return "captures packets on a sandbox network interface in pcapng format"
+}
+
+// Usage implements subcommands.Command.
+func (*PCAP) Usage() string {
+	return `pcap [flags] <container id> - capture packets on a sandbox network interface.
+
+By default, packets are captured until the command is interrupted or -duration
+elapses, and are written to the file given by -w, optionally rotating files
+every -rotate-mb megabytes.
+
+With -output-fd, the sandbox streams packets directly into the given file
+descriptor, which is inherited by this command, and the command returns as
+soon as the capture has started. Such a capture runs until it is stopped with
+-stop or writing to the file descriptor fails.
+
+Packets start at their network header (link type RAW). -filter takes a
+classic BPF program compiled for this link type, in the format printed by
+"tcpdump -ddd" or "nfbpf_compile": an instruction count followed by one
+"code jt jf k" instruction per line or comma-separated item, e.g.:
+
+  runsc pcap -nic eth0 -w out.pcapng -filter "$(nfbpf_compile RAW 'tcp port 80')" <container id>
+
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (p *PCAP) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.nic, "nic", "", "name of the sandbox network interface to capture packets on.")
+	f.StringVar(&p.filter, "filter", "", "classic BPF program selecting the packets to capture. All packets are captured if empty.")
+	f.UintVar(&p.snapLen, "snaplen", sniffer.DefaultSnapLen, "maximum number of bytes captured from each packet.")
+	f.StringVar(&p.output, "w", "", `file to write packets to, or "-" for standard output.`)
+	f.IntVar(&p.outputFD, "output-fd", -1, "file descriptor the sandbox streams packets to. The command returns once the capture has started.")
+	f.UintVar(&p.rotateMB, "rotate-mb", 0, "if non-zero, start a new output file once the current one exceeds this many megabytes. Files after the first one get a numeric suffix.")
+	f.UintVar(&p.rotateFiles, "rotate-files", 0, "if non-zero, keep at most this many rotated files, overwriting the oldest one.")
+	f.DurationVar(&p.duration, "duration", 0, "if non-zero, stop capturing after this much time.")
+	f.BoolVar(&p.stop, "stop", false, "stop the capture running on -nic, e.g. one started with -output-fd.")
+}
+
+// Execute implements subcommands.Command.
+func (p *PCAP) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	if p.nic == "" {
+		return util.Errorf("-nic is required")
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{SkipCheck: true})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+
+	if p.stop {
+		stats, err := cont.Sandbox.StopPacketCapture(p.nic)
+		if err != nil {
+			util.Fatalf("%v", err)
+		}
+		reportCaptureStats(p.nic, stats)
+		return subcommands.ExitSuccess
+	}
+
+	filter, err := parseBPFProgram(p.filter)
+	if err != nil {
+		util.Fatalf("parsing -filter: %v", err)
+	}
+	captureArgs := boot.StartPacketCaptureArgs{
+		NIC:     p.nic,
+		Filter:  filter,
+		SnapLen: uint32(p.snapLen),
+	}
+
+	if p.outputFD >= 0 {
+		if p.output != "" || p.rotateMB != 0 || p.duration != 0 {
+			return util.Errorf("-output-fd cannot be used with -w, -rotate-mb or -duration")
+		}
+		out := os.NewFile(uintptr(p.outputFD), "pcapng-output")
+		defer out.Close()
+		captureArgs.FilePayload.Files = []*os.File{out}
+		if err := cont.Sandbox.StartPacketCapture(&captureArgs); err != nil {
+			util.Fatalf("%v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
+	if p.output == "" {
+		return util.Errorf("one of -w or -output-fd is required")
+	}
+	if p.output == "-" && p.rotateMB != 0 {
+		return util.Errorf("-rotate-mb cannot be used when writing to standard output")
+	}
+	w := &pcapngRotator{
+		path:     p.output,
+		maxSize:  int64(p.rotateMB) << 20,
+		maxFiles: int(p.rotateFiles),
+	}
+	defer w.Close()
+
+	r, pw, err := os.Pipe()
+	if err != nil {
+		util.Fatalf("creating pipe: %v", err)
+	}
+	defer r.Close()
+	captureArgs.FilePayload.Files = []*os.File{pw}
+	err = cont.Sandbox.StartPacketCapture(&captureArgs)
+	// The sandbox holds its own copy of the write end.
+	pw.Close()
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+
+	copyErr := make(chan error, 1)
+	go func() {
+		copyErr <- w.copyFrom(r)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, unix.SIGINT, unix.SIGTERM)
+	defer signal.Stop(signals)
+	var timeout <-chan time.Time
+	if p.duration != 0 {
+		timeout = time.After(p.duration)
+	}
+
+	select {
+	case err := <-copyErr:
+		// The sandbox stopped writing, e.g. because it exited or the
+		// capture was stopped by someone else.
+		if err != nil {
+			util.Fatalf("writing packets: %v", err)
+		}
+		return subcommands.ExitSuccess
+	case <-signals:
+	case <-timeout:
+	}
+
+	stats, stopErr := cont.Sandbox.StopPacketCapture(p.nic)
+	// Once stopped, the sandbox closes its end of the pipe after flushing
+	// all captured packets.
+	if err := <-copyErr; err != nil {
+		util.Fatalf("writing packets: %v", err)
+	}
+	if stopErr != nil {
+		util.Fatalf("%v", stopErr)
+	}
+	reportCaptureStats(p.nic, stats)
+	return subcommands.ExitSuccess
+}
+
+// reportCaptureStats prints capture statistics to stderr, since stdout may
+// hold the capture itself.
+func reportCaptureStats(nic string, stats sniffer.CaptureStats) {
+	log.Infof("Packet capture on %q: %+v", nic, stats)
+	fmt.Fprintf(os.Stderr, "%d packets captured, %d packets filtered, %d packets dropped\n", stats.Captured, stats.Filtered, stats.Dropped)
+}
+
+// parseBPFProgram parses a classic BPF program in the format printed by
+// "tcpdump -ddd": an instruction count followed by instructions made of four
+// decimal numbers "code jt jf k", separated by newlines or commas.
+func parseBPFProgram(s string) ([]bpf.Instruction, error) {
+	var fields []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	count, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instruction count %q: %w", fields[0], err)
+	}
+	fields = fields[1:]
+	if uint64(len(fields)) != count {
+		return nil, fmt.Errorf("program has %d instructions, but its header says %d", len(fields), count)
+	}
+
+	insns := make([]bpf.Instruction, 0, len(fields))
+	for i, f := range fields {
+		parts := strings.Fields(f)
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("instruction %d: want 4 numbers, got %q", i, f)
+		}
+		var vals [4]uint64
+		for j, bits := range []int{16, 8, 8, 32} {
+			v, err := strconv.ParseUint(parts[j], 10, bits)
+			if err != nil {
+				return nil, fmt.Errorf("instruction %d: %w", i, err)
+			}
+			vals[j] = v
+		}
+		insns = append(insns, bpf.Instruction{
+			OpCode:      uint16(vals[0]),
+			JumpIfTrue:  uint8(vals[1]),
+			JumpIfFalse: uint8(vals[2]),
+			K:           uint32(vals[3]),
+		})
+	}
+	return insns, nil
+}
+
+// maxPCAPNGBlockSize bounds the size of a single pcapng block read from the
+// sandbox, which is no larger than a packet plus some metadata.
+const maxPCAPNGBlockSize = 1 << 20
+
+// pcapngRotator writes a pcapng stream to a series of files, starting a new
+// file once the current one holds at least maxSize bytes. Every file starts
+// with the section header and interface description blocks of the stream, so
+// that it can be read on its own.
+//
+// Like "tcpdump -C", the first file is named path and later ones path1, path2,
+// etc. If maxFiles is non-zero, at most maxFiles files are used, the oldest one
+// being overwritten once they are exhausted.
+type pcapngRotator struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	// header holds the header blocks of the stream.
+	header []byte
+
+	// file is the file currently being written to, and written is the number
+	// of bytes written to it.
+	file    *os.File
+	written int64
+
+	// index is the number of the current file.
+	index int
+}
+
+// copyFrom copies the pcapng stream read from src to files, until src returns
+// EOF.
+func (w *pcapngRotator) copyFrom(src io.Reader) error {
+	br := bufio.NewReader(src)
+	hdr := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		// The sandbox always writes little-endian sections.
+		blockType := binary.LittleEndian.Uint32(hdr[0:])
+		length := binary.LittleEndian.Uint32(hdr[4:])
+		if length < 12 || length%4 != 0 || length > maxPCAPNGBlockSize {
+			return fmt.Errorf("invalid pcapng block length %d", length)
+		}
+		block := make([]byte, length)
+		copy(block, hdr)
+		if _, err := io.ReadFull(br, block[len(hdr):]); err != nil {
+			return err
+		}
+		if err := w.writeBlock(blockType, block); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *pcapngRotator) writeBlock(blockType uint32, block []byte) error {
+	switch blockType {
+	case sniffer.PCAPNGSectionHeaderBlock:
+		w.header = append(w.header[:0], block...)
+	case sniffer.PCAPNGInterfaceDescriptionBlock:
+		w.header = append(w.header, block...)
+	default:
+		if w.maxSize > 0 && w.written >= w.maxSize {
+			if err := w.rotate(); err != nil {
+				return err
+			}
+		}
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(block)
+	w.written += int64(n)
+	return err
+}
+
+// open opens the current file.
+func (w *pcapngRotator) open() error {
+	if w.path == "-" {
+		w.file = os.Stdout
+		return nil
+	}
+	path := w.path
+	if w.index > 0 {
+		path = fmt.Sprintf("%s%d", w.path, w.index)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.written = 0
+	return nil
+}
+
+// rotate closes the current file and starts the next one.
+func (w *pcapngRotator) rotate() error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	w.index++
+	if w.maxFiles > 0 {
+		w.index %= w.maxFiles
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	n, err := w.file.Write(w.header)
+	w.written += int64(n)
+	return err
+}
+
+// Close closes the current file.
+func (w *pcapngRotator) Close() error {
+	if w.file == nil || w.file == os.Stdout {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+func TestParseBPFProgram(t *testing.T) {
+	// "tcp" for LINKTYPE_RAW IPv4 packets.
+	want := []bpf.Instruction{
+		{OpCode: 0x30, JumpIfTrue: 0, JumpIfFalse: 0, K: 9},
+		{OpCode: 0x15, JumpIfTrue: 0, JumpIfFalse: 1, K: 6},
+		{OpCode: 0x06, JumpIfTrue: 0, JumpIfFalse: 0, K: 262144},
+		{OpCode: 0x06, JumpIfTrue: 0, JumpIfFalse: 0, K: 0},
+	}
+	for _, tc := range []struct {
+		name    string
+		in      string
+		want    []bpf.Instruction
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			in:   "",
+		},
+		{
+			name: "tcpdump",
+			in:   "4\n48 0 0 9\n21 0 1 6\n6 0 0 262144\n6 0 0 0\n",
+			want: want,
+		},
+		{
+			name: "comma-separated",
+			in:   "4,48 0 0 9,21 0 1 6,6 0 0 262144,6 0 0 0",
+			want: want,
+		},
+		{
+			name:    "wrong count",
+			in:      "3,48 0 0 9,21 0 1 6,6 0 0 262144,6 0 0 0",
+			wantErr: true,
+		},
+		{
+			name:    "short instruction",
+			in:      "1,6 0 0",
+			wantErr: true,
+		},
+		{
+			name:    "jump out of range",
+			in:      "1,21 256 0 6",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseBPFProgram(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseBPFProgram(%q) succeeded, want error", tc.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBPFProgram(%q): %v", tc.in, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("parseBPFProgram(%q) mismatch (-want +got):\n%s", tc.in, diff)
+			}
+		})
+	}
+}
+
+// testBlock returns a pcapng block of the given type with a body of n bytes.
+func testBlock(blockType uint32, n int, fill byte) []byte {
+	b := make([]byte, 12+n)
+	binary.LittleEndian.PutUint32(b[0:], blockType)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)))
+	for i := 8; i < 8+n; i++ {
+		b[i] = fill
+	}
+	binary.LittleEndian.PutUint32(b[8+n:], uint32(len(b)))
+	return b
+}
+
+func TestPCAPNGRotator(t *testing.T) {
+	dir, err := os.MkdirTemp(testutil.TmpDir(), "pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shb := testBlock(sniffer.PCAPNGSectionHeaderBlock, 16, 0)
+	idb := testBlock(sniffer.PCAPNGInterfaceDescriptionBlock, 8, 0)
+	header := append(append([]byte(nil), shb...), idb...)
+	var packets [][]byte
+	var stream bytes.Buffer
+	stream.Write(header)
+	for i := 0; i < 5; i++ {
+		p := testBlock(6, 100, byte(i+1))
+		packets = append(packets, p)
+		stream.Write(p)
+	}
+
+	path := filepath.Join(dir, "out.pcapng")
+	w := &pcapngRotator{
+		path:     path,
+		maxSize:  int64(len(header) + 2*len(packets[0])),
+		maxFiles: 2,
+	}
+	if err := w.copyFrom(&stream); err != nil {
+		t.Fatalf("copyFrom: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Packets 0 and 1 went to the first file, 2 and 3 to the second one, and
+	// 4 overwrote the first one.
+	for _, tc := range []struct {
+		path    string
+		packets [][]byte
+	}{
+		{path: path, packets: packets[4:]},
+		{path: path + "1", packets: packets[2:4]},
+	} {
+		got, err := os.ReadFile(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := append([]byte(nil), header...)
+		for _, p := range tc.packets {
+			want = append(want, p...)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes, want %d bytes", tc.path, len(got), len(want))
+		}
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s2", path)); !os.IsNotExist(err) {
+		t.Errorf("unexpected third file: %v", err)
+	}
+}
+
+func TestPCAPNGRotatorInvalidBlock(t *testing.T) {
+	b := testBlock(6, 4, 0)
+	binary.LittleEndian.PutUint32(b[4:], 10)
+	w := &pcapngRotator{path: filepath.Join(t.TempDir(), "out.pcapng")}
+	defer w.Close()
+	if err := w.copyFrom(bytes.NewReader(b)); err == nil {
+		t.Errorf("copyFrom succeeded on a block with an invalid length")
+	}
+}
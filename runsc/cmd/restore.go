@@ -40,6 +40,15 @@ type Restore struct {
 
 	// detach indicates that runsc has to start a process and exit without waiting it.
 	detach bool
+
+	// migrateFrom is the address to receive the image from a migration
+	// source on.
+	migrateFrom string
+	migrate     migrateFlags
+
+	// chunkStore is the directory of the chunk store that the image's
+	// memory contents were saved to, if any.
+	chunkStore string
 }
 
 // Name implements subcommands.Command.Name.
@@ -63,6 +72,9 @@ func (r *Restore) SetFlags(f *flag.FlagSet) {
 	r.Create.SetFlags(f)
 	f.StringVar(&r.imagePath, "image-path", "", "directory path to saved container image")
 	f.BoolVar(&r.detach, "detach", false, "detach from the container's process")
+	f.StringVar(&r.migrateFrom, "migrate-from", "", "listen on this host:port and restore from the image streamed by \"runsc checkpoint -migrate-to\", instead of -image-path")
+	r.migrate.setFlags(f)
+	f.StringVar(&r.chunkStore, "chunk-store", "", "directory of the chunk store passed to \"runsc checkpoint -chunk-store\" when the image was saved")
 
 	// Unimplemented flags necessary for compatibility with docker.
 
@@ -92,14 +104,33 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 	if bundleDir == "" {
 		bundleDir = getwdOrDie()
 	}
-	if r.imagePath == "" {
+	if r.migrateFrom != "" {
+		if r.imagePath != "" || r.chunkStore != "" {
+			return util.Errorf("migrate-from cannot be used with image-path or chunk-store")
+		}
+	} else if r.imagePath == "" {
 		return util.Errorf("image-path flag must be provided")
 	}
 
 	var cu cleanup.Cleanup
 	defer cu.Clean()
 
-	conf.RestoreFile = filepath.Join(r.imagePath, checkpointFileName)
+	var migration *migrationImage
+	if r.migrateFrom != "" {
+		// Wait for the source before creating the container, so that the
+		// sandbox is not left idle if the migration never happens.
+		conn, err := r.migrate.accept(r.migrateFrom)
+		if err != nil {
+			return util.Errorf("accepting migration connection: %v", err)
+		}
+		defer conn.Close()
+		if migration, err = r.migrate.receive(conn); err != nil {
+			return util.Errorf("receiving migration: %v", err)
+		}
+		defer migration.release()
+	} else {
+		conf.RestoreFile = filepath.Join(r.imagePath, checkpointFileName)
+	}
 
 	runArgs := container.Args{
 		ID:            id,
@@ -140,9 +171,27 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 		runArgs.Spec = c.Spec
 	}
 
-	log.Debugf("Restore: %v", conf.RestoreFile)
-	if err := c.Restore(conf, conf.RestoreFile); err != nil {
-		return util.Errorf("starting container: %v", err)
+	if migration != nil {
+		log.Debugf("Restore from migration source")
+		if chunks := migration.storeFiles(); chunks != nil {
+			err = c.RestoreFromChunkStore(conf, migration.image, chunks)
+		} else {
+			err = c.RestoreFrom(conf, migration.image)
+		}
+		if err != nil {
+			return util.Errorf("starting container: %v", err)
+		}
+		if err := <-migration.received; err != nil {
+			return util.Errorf("receiving migration: %v", err)
+		}
+		if err := migration.acknowledge(); err != nil {
+			return util.Errorf("acknowledging migration: %v", err)
+		}
+	} else {
+		log.Debugf("Restore: %v", conf.RestoreFile)
+		if err := restoreImage(conf, c, conf.RestoreFile, r.chunkStore); err != nil {
+			return util.Errorf("starting container: %v", err)
+		}
 	}
 
 	// If we allocate a terminal, forward signals to the sandbox process.
@@ -79,9 +79,13 @@ func (r *Run) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomman
 	conf := args[0].(*config.Config)
 	waitStatus := args[1].(*unix.WaitStatus)
 
+	if err := conf.ApplyBootProfile(flag.CommandLine, r.bootProfile); err != nil {
+		return util.Errorf("applying boot profile: %v", err)
+	}
+
 	if conf.Rootless {
-		if conf.Network == config.NetworkSandbox {
-			return util.Errorf("sandbox network isn't supported with --rootless, use --network=none or --network=host")
+		if conf.Network == config.NetworkSandbox && conf.NetworkHelper == config.NetworkHelperNone {
+			return util.Errorf("sandbox network isn't supported with --rootless without --network-helper, use --network-helper=slirp4netns|pasta, --network=none or --network=host")
 		}
 
 		if err := specutils.MaybeRunAsRoot(); err != nil {
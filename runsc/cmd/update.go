@@ -0,0 +1,143 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Update implements subcommands.Command for the "update" command.
+type Update struct {
+	resourcesPath string
+	cpuPeriod     uint64
+	cpuQuota      int64
+	cpuShares     uint64
+	cpusetCPUs    string
+	cpusetMems    string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Update) Name() string {
+	return "update"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Update) Synopsis() string {
+	return "update container resource limits"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Update) Usage() string {
+	return `update [flags] <container id> - update the resource limits of a container.
+
+Limits are read from the file given by --resources ("-" for stdin), which
+holds a JSON-encoded OCI LinuxResources object, and from the flags below;
+flags take precedence. Only the root container of a sandbox can be updated.
+
+The number of CPUs used to run application code (KVM vCPUs or systrap stub
+threads) is scaled to the new CPU limit. The number of CPUs visible to the
+application is unchanged.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (u *Update) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&u.resourcesPath, "resources", "", `path to the resources file, or "-" to read it from stdin`)
+	f.Uint64Var(&u.cpuPeriod, "cpu-period", 0, "CPU CFS period in microseconds")
+	f.Int64Var(&u.cpuQuota, "cpu-quota", 0, "CPU CFS quota in microseconds per period, or -1 for no limit")
+	f.Uint64Var(&u.cpuShares, "cpu-share", 0, "CPU shares (relative weight)")
+	f.StringVar(&u.cpusetCPUs, "cpuset-cpus", "", "CPUs to use (e.g. 0-3,7)")
+	f.StringVar(&u.cpusetMems, "cpuset-mems", "", "memory nodes to use (e.g. 0-1)")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (u *Update) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	res, err := u.resources(f)
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+
+	if err := cont.Update(conf, res); err != nil {
+		util.Fatalf("update failed: %v", err)
+	}
+
+	return subcommands.ExitSuccess
+}
+
+// resources returns the resource limits given by the resources file and the
+// flags that were set.
+func (u *Update) resources(f *flag.FlagSet) (*specs.LinuxResources, error) {
+	var res specs.LinuxResources
+	if u.resourcesPath != "" {
+		var r io.Reader = os.Stdin
+		if u.resourcesPath != "-" {
+			file, err := os.Open(u.resourcesPath)
+			if err != nil {
+				return nil, fmt.Errorf("opening resources file: %v", err)
+			}
+			defer file.Close()
+			r = file
+		}
+		if err := json.NewDecoder(r).Decode(&res); err != nil {
+			return nil, fmt.Errorf("parsing resources file %q: %v", u.resourcesPath, err)
+		}
+	}
+
+	f.Visit(func(fl *flag.Flag) {
+		if fl.Name == "resources" {
+			return
+		}
+		if res.CPU == nil {
+			res.CPU = &specs.LinuxCPU{}
+		}
+		switch fl.Name {
+		case "cpu-period":
+			res.CPU.Period = &u.cpuPeriod
+		case "cpu-quota":
+			res.CPU.Quota = &u.cpuQuota
+		case "cpu-share":
+			res.CPU.Shares = &u.cpuShares
+		case "cpuset-cpus":
+			res.CPU.Cpus = u.cpusetCPUs
+		case "cpuset-mems":
+			res.CPU.Mems = u.cpusetMems
+		}
+	})
+	return &res, nil
+}
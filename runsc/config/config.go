@@ -19,6 +19,7 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -98,14 +99,40 @@ type Config struct {
 	// HostFifo controls permission to access host FIFO (or named pipes).
 	HostFifo HostFifo `flag:"host-fifo"`
 
+	// HostInotify enables forwarding of inotify events for changes made on
+	// the host to files in gofer-backed mounts.
+	HostInotify bool `flag:"host-inotify"`
+
+	// HostFileLocks delegates advisory file locks on shared gofer-backed mounts
+	// to the host, making them visible outside of the sandbox.
+	HostFileLocks bool `flag:"host-file-locks"`
+
+	// HostDelegations lets gofer mounts that cache file data hold delegations,
+	// backed by host file leases, on the files they open. Cached data is
+	// dropped when a delegated file is opened outside of the sandbox.
+	HostDelegations bool `flag:"host-delegations"`
+
 	// Network indicates what type of network to use.
 	Network NetworkType `flag:"network"`
 
+	// NetworkHelper is the userspace NAT program that provides connectivity
+	// to the sandbox network namespace in rootless mode.
+	NetworkHelper NetworkHelper `flag:"network-helper"`
+
+	// PublishPorts lists host ports forwarded into the sandbox by
+	// NetworkHelper.
+	PublishPorts PortForwards `flag:"publish"`
+
 	// EnableRaw indicates whether raw sockets should be enabled. Raw
 	// sockets are disabled by stripping CAP_NET_RAW from the list of
 	// capabilities.
 	EnableRaw bool `flag:"net-raw"`
 
+	// HostKTLS lets applications enable kernel TLS on host network sockets,
+	// offloading TLS record processing to the host kernel. It requires
+	// Network to be NetworkHost.
+	HostKTLS bool `flag:"host-ktls"`
+
 	// AllowPacketEndpointWrite enables write operations on packet endpoints.
 	AllowPacketEndpointWrite bool `flag:"TESTONLY-allow-packet-endpoint-write"`
 
@@ -126,6 +153,11 @@ type Config struct {
 	// RXChecksumOffload indicates that RX Checksum Offload is enabled.
 	RXChecksumOffload bool `flag:"rx-checksum-offload"`
 
+	// NetSaveConnections indicates that established TCP connections are
+	// saved by checkpoint and resumed by restore, rather than preventing
+	// the checkpoint.
+	NetSaveConnections bool `flag:"net-save-connections"`
+
 	// QDisc indicates the type of queuening discipline to use by default
 	// for non-loopback interfaces.
 	QDisc QueueingDiscipline `flag:"qdisc"`
@@ -185,6 +217,15 @@ type Config struct {
 	// sent to log if false.
 	StraceEvent bool `flag:"strace-event"`
 
+	// StraceJSON is the file to write structured strace records to, one JSON
+	// object per line. Syscalls in StraceSyscalls (or all syscalls, if it is
+	// empty) are recorded, independently of Strace.
+	StraceJSON string `flag:"strace-json"`
+
+	// SyscallOverrides is a comma-separated list of syscall overrides applied
+	// to all containers, e.g. "ptrace=errno:ENOSYS,read=delay:10ms".
+	SyscallOverrides string `flag:"syscall-overrides"`
+
 	// DisableSeccomp indicates whether seccomp syscall filters should be
 	// disabled. Pardon the double negation, but default to enabled is important.
 	DisableSeccomp bool
@@ -253,13 +294,43 @@ type Config struct {
 	// E.g. 0.2 CPU quota will result in 1, and 1.9 in 2.
 	CPUNumFromQuota bool `flag:"cpu-num-from-quota"`
 
+	// CPUHotplug takes application CPUs offline and back online as the host
+	// CPUs that the sandbox may run on change, e.g. with its host cpuset.
+	CPUHotplug bool `flag:"cpu-hotplug"`
+
+	// CPUFeaturesMask is a comma-separated list of CPU features, as named in
+	// /proc/cpuinfo, that are hidden from applications.
+	CPUFeaturesMask string `flag:"cpu-features-mask"`
+
+	// CPUMicroarchLevel, if set, hides CPU features that are not part of the
+	// given x86-64 microarchitecture level, e.g. "x86-64-v3".
+	CPUMicroarchLevel string `flag:"cpu-microarch-level"`
+
+	// CPUBrand, if set, replaces the processor brand string seen by
+	// applications.
+	CPUBrand string `flag:"cpu-brand"`
+
+	// CPUThreadsPerCore is the number of hardware threads per core reported
+	// to applications. 0 means 1.
+	CPUThreadsPerCore uint `flag:"cpu-threads-per-core"`
+
+	// CPUCoresPerSocket is the number of cores per socket reported to
+	// applications. 0 means one socket per NUMA node.
+	CPUCoresPerSocket uint `flag:"cpu-cores-per-socket"`
+
+	// NUMANodes is the number of NUMA nodes reported to applications. 0
+	// means 1.
+	NUMANodes uint `flag:"numa-nodes"`
+
 	// Allows overriding of flags in OCI annotations.
 	AllowFlagOverride bool `flag:"allow-flag-override"`
 
 	// Enables seccomp inside the sandbox.
 	OCISeccomp bool `flag:"oci-seccomp"`
 
-	// Mounts the cgroup filesystem backed by the sentry's cgroupfs.
+	// Mounts the cgroup filesystem backed by the sentry's cgroupfs. Each
+	// container is placed in its own cgroup, with the resource limits from
+	// its spec.
 	Cgroupfs bool `flag:"cgroupfs"`
 
 	// Don't configure cgroups.
@@ -272,6 +343,11 @@ type Config struct {
 	// take during pod creation.
 	PodInitConfig string `flag:"pod-init-config"`
 
+	// SyscallFilterProfile is the path to a syscall filter profile that
+	// further restricts the syscalls made by the sentry and by containers.
+	// See runsc/specutils/seccomp.Profile.
+	SyscallFilterProfile string `flag:"syscall-filter-profile"`
+
 	// Use pools to manage buffer memory instead of heap.
 	BufferPooling bool `flag:"buffer-pooling"`
 
@@ -288,6 +364,79 @@ type Config struct {
 	// used.
 	DCache int `flag:"dcache"`
 
+	// HostFDAsyncWriteThreshold is how long writes to a donated host FD, e.g.
+	// stdio or container logs, may block before subsequent writes to it are
+	// offloaded to a buffered asynchronous writer. If zero, writes are never
+	// offloaded.
+	HostFDAsyncWriteThreshold time.Duration `flag:"host-fd-async-write-threshold"`
+
+	// HostFDAsyncWriteBuffer is the maximum number of bytes buffered for each
+	// host FD whose writes are offloaded.
+	HostFDAsyncWriteBuffer int `flag:"host-fd-async-write-buffer"`
+
+	// HostFDAsyncWriteDrop causes offloaded writes that don't fit in the buffer
+	// to be dropped instead of blocking the writer.
+	HostFDAsyncWriteDrop bool `flag:"host-fd-async-write-drop"`
+
+	// IdleMemoryReclaim controls how aggressively host memory is released
+	// while the sandbox is idle.
+	IdleMemoryReclaim IdleMemoryReclaim `flag:"idle-memory-reclaim"`
+
+	// IdleMemoryReclaimInterval is how long the sandbox must go without
+	// allocating memory to be considered idle, and how often idle memory
+	// reclaim runs while it remains idle.
+	IdleMemoryReclaimInterval time.Duration `flag:"idle-memory-reclaim-interval"`
+
+	// Hugepages controls the use of host transparent hugepages to back
+	// sandbox memory.
+	Hugepages Hugepages `flag:"hugepages"`
+
+	// HugepageCollapseInterval is the interval at which densely used sandbox
+	// memory is scanned for regions to collapse into hugepages, if Hugepages
+	// is HugepagesCollapse.
+	HugepageCollapseInterval time.Duration `flag:"hugepage-collapse-interval"`
+
+	// Swap enables swapping of application anonymous memory by the sentry.
+	Swap SwapMode `flag:"swap"`
+
+	// SwapFile is the host file used to store swapped pages if Swap is
+	// SwapFile.
+	SwapFile string `flag:"swap-file"`
+
+	// SwapFileSize is the maximum size in bytes of SwapFile.
+	SwapFileSize uint64 `flag:"swap-file-size"`
+
+	// SwapThreshold is the percentage of the sandbox's total memory above
+	// which memory usage causes application memory to be swapped out.
+	SwapThreshold uint `flag:"swap-threshold"`
+
+	// OOMKillThreshold is the percentage of the sandbox's total memory above
+	// which memory usage causes the sentry to kill a process, rather than
+	// letting the host kill the whole sandbox. 0 disables it.
+	OOMKillThreshold uint `flag:"oom-kill-threshold"`
+
+	// PageCacheHighWatermark is the percentage of the sandbox's total memory
+	// above which the sentry evicts cached file data, least recently used
+	// first, until it is below PageCacheLowWatermark. 0 disables it.
+	PageCacheHighWatermark uint `flag:"page-cache-high-watermark"`
+
+	// PageCacheLowWatermark is the percentage of the sandbox's total memory
+	// down to which cached file data is evicted once it exceeds
+	// PageCacheHighWatermark, or when the sandbox's host cgroup is under
+	// memory pressure.
+	PageCacheLowWatermark uint `flag:"page-cache-low-watermark"`
+
+	// PageMerging enables merging of application pages with identical
+	// contents.
+	PageMerging PageMerging `flag:"page-merging"`
+
+	// PageMergingInterval is the time between page merging scans.
+	PageMergingInterval time.Duration `flag:"page-merging-interval"`
+
+	// PageMergingPages is the number of pages scanned in each page merging
+	// scan.
+	PageMergingPages uint64 `flag:"page-merging-pages"`
+
 	// IOUring enables support for the IO_URING API calls to perform
 	// asynchronous I/O operations.
 	IOUring bool `flag:"iouring"`
@@ -305,9 +454,72 @@ type Config struct {
 	// containers or set by `docker --gpus`.
 	NVProxyDocker bool `flag:"nvproxy-docker"`
 
+	// CDI injects devices requested through Container Device Interface (CDI)
+	// annotations into containers, as described by the CDI specs on the
+	// host.
+	CDI bool `flag:"cdi"`
+
 	// TPUProxy enables support for TPUs.
 	TPUProxy bool `flag:"tpuproxy"`
 
+	// AMDProxy enables support for AMD GPUs through the amdkfd compute
+	// interface and amdgpu render nodes.
+	AMDProxy bool `flag:"amdproxy"`
+
+	// HostDevices lists the host character devices exposed to the sandbox,
+	// along with the ioctls passed through to each of them.
+	HostDevices HostDevices `flag:"host-devices"`
+
+	// AndroidDevices enables emulation of the Android binder and ashmem
+	// devices.
+	AndroidDevices bool `flag:"android-devices"`
+
+	// TPM selects how /dev/tpmrm0 is provided to the sandbox, if at all.
+	TPM TPMMode `flag:"tpm"`
+
+	// NestedKVM exposes a mediated passthrough of the host's /dev/kvm to the
+	// sandbox, allowing virtual machine monitors to run in it.
+	NestedKVM bool `flag:"nested-kvm"`
+
+	// VFIOGroups lists the host VFIO groups exposed to the sandbox through a
+	// mediated /dev/vfio, along with the device regions that may be mapped.
+	VFIOGroups VFIOGroups `flag:"vfio"`
+
+	// RDMAProxy enables support for host RDMA devices by proxying
+	// /dev/infiniband/uverbs* to the host.
+	RDMAProxy bool `flag:"rdmaproxy"`
+
+	// PTP exposes a PTP hardware clock device, /dev/ptp0, synthesized from
+	// the sandbox's CLOCK_TAI.
+	PTP bool `flag:"ptp"`
+
+	// MemfdSecret enables memfd_secret(2), backing secret memory with host
+	// files that the sentry does not map where the platform allows it.
+	MemfdSecret bool `flag:"memfd-secret"`
+
+	// Virtiofs enables virtiofs mounts, which connect to vhost-user virtio-fs
+	// servers outside of the sandbox.
+	Virtiofs bool `flag:"virtiofs"`
+
+	// MinimalBoot skips sandbox setup that single-binary workloads don't
+	// need: no network stack is created with --network=none, and procfs only
+	// exposes process directories.
+	MinimalBoot bool `flag:"minimal-boot"`
+
+	// SeccompCache caches the sentry's seccomp program in the root directory,
+	// so that sandboxes started with the same configuration don't build it
+	// again.
+	SeccompCache bool `flag:"seccomp-cache"`
+
+	// SandboxGroups allows pods annotated with the same sandbox group to share
+	// a single sandbox. Each pod runs as a set of subcontainers of the shared
+	// sandbox, and tearing down a pod only affects its own containers. Pods in
+	// a group must belong to the same tenant, and pods that join a sandbox get
+	// UTS, IPC and network namespaces of their own. With --network=sandbox,
+	// the network of a joining pod is taken from its own network namespace,
+	// and pods with resource limits can only join with --cgroupfs.
+	SandboxGroups bool `flag:"sandbox-groups"`
+
 	// TestOnlyAllowRunAsCurrentUserWithoutChroot should only be used in
 	// tests. It allows runsc to start the sandbox process as the current
 	// user, and without chrooting the sandbox process. This can be
@@ -340,9 +552,39 @@ func (c *Config) validate() error {
 	if overlay2 := c.GetOverlay2(); c.FileAccess == FileAccessShared && overlay2.Enabled() {
 		return fmt.Errorf("overlay flag is incompatible with shared file access for rootfs")
 	}
+	if c.HostDelegations && c.DirectFS {
+		return fmt.Errorf("host-delegations flag requires directfs to be disabled")
+	}
 	if c.NumNetworkChannels <= 0 {
 		return fmt.Errorf("num_network_channels must be > 0, got: %d", c.NumNetworkChannels)
 	}
+	if c.IdleMemoryReclaim != IdleMemoryReclaimOff && c.IdleMemoryReclaimInterval <= 0 {
+		return fmt.Errorf("idle-memory-reclaim-interval must be > 0, got: %v", c.IdleMemoryReclaimInterval)
+	}
+	if c.Hugepages == HugepagesCollapse && c.HugepageCollapseInterval <= 0 {
+		return fmt.Errorf("hugepage-collapse-interval must be > 0, got: %v", c.HugepageCollapseInterval)
+	}
+	if c.Swap == SwapFile && c.SwapFile == "" {
+		return fmt.Errorf("swap=file flag requires setting swap-file")
+	}
+	if c.SwapThreshold == 0 || c.SwapThreshold > 100 {
+		return fmt.Errorf("swap-threshold must be between 1 and 100, got: %d", c.SwapThreshold)
+	}
+	if c.OOMKillThreshold > 100 {
+		return fmt.Errorf("oom-kill-threshold must be between 0 and 100, got: %d", c.OOMKillThreshold)
+	}
+	if c.PageCacheHighWatermark > 100 {
+		return fmt.Errorf("page-cache-high-watermark must be between 0 and 100, got: %d", c.PageCacheHighWatermark)
+	}
+	if c.PageCacheHighWatermark != 0 && c.PageCacheLowWatermark >= c.PageCacheHighWatermark {
+		return fmt.Errorf("page-cache-low-watermark (%d) must be lower than page-cache-high-watermark (%d)", c.PageCacheLowWatermark, c.PageCacheHighWatermark)
+	}
+	if c.PageMergingInterval <= 0 {
+		return fmt.Errorf("page-merging-interval must be > 0, got: %v", c.PageMergingInterval)
+	}
+	if c.PageMergingPages == 0 {
+		return fmt.Errorf("page-merging-pages must be > 0")
+	}
 	// Require profile flags to explicitly opt-in to profiling with
 	// -profile rather than implying it since these options have security
 	// implications.
@@ -362,6 +604,15 @@ func (c *Config) validate() error {
 		// Deprecated flag was used together with flag that replaced it.
 		return fmt.Errorf("fsgofer-host-uds has been replaced with host-uds flag")
 	}
+	if c.NetworkHelper != NetworkHelperNone && c.Network != NetworkSandbox {
+		return fmt.Errorf("network-helper flag requires network=sandbox, got: %v", c.Network)
+	}
+	if len(c.PublishPorts) > 0 && c.NetworkHelper == NetworkHelperNone {
+		return fmt.Errorf("publish flag requires setting network-helper")
+	}
+	if c.HostKTLS && c.Network != NetworkHost {
+		return fmt.Errorf("host-ktls flag requires network=host, got: %v", c.Network)
+	}
 	if len(c.ProfilingMetrics) > 0 && len(c.ProfilingMetricsLog) == 0 {
 		return fmt.Errorf("profiling-metrics flag requires defining a profiling-metrics-log for output")
 	}
@@ -560,6 +811,59 @@ func (n NetworkType) String() string {
 	panic(fmt.Sprintf("Invalid network type %d", n))
 }
 
+// NetworkHelper is a host program that connects a network namespace to the
+// host network with a userspace NAT, without requiring CAP_NET_ADMIN on the
+// host.
+type NetworkHelper int
+
+const (
+	// NetworkHelperNone doesn't use a network helper.
+	NetworkHelperNone NetworkHelper = iota
+
+	// NetworkHelperSlirp4netns uses slirp4netns(1).
+	NetworkHelperSlirp4netns
+
+	// NetworkHelperPasta uses pasta(1), from the passt project.
+	NetworkHelperPasta
+)
+
+func networkHelperPtr(v NetworkHelper) *NetworkHelper {
+	return &v
+}
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (n *NetworkHelper) Set(v string) error {
+	switch v {
+	case "", "none":
+		*n = NetworkHelperNone
+	case "slirp4netns":
+		*n = NetworkHelperSlirp4netns
+	case "pasta":
+		*n = NetworkHelperPasta
+	default:
+		return fmt.Errorf("invalid network helper %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (n *NetworkHelper) Get() any {
+	return *n
+}
+
+// String implements flag.Value.
+func (n NetworkHelper) String() string {
+	switch n {
+	case NetworkHelperNone:
+		return "none"
+	case NetworkHelperSlirp4netns:
+		return "slirp4netns"
+	case NetworkHelperPasta:
+		return "pasta"
+	}
+	panic(fmt.Sprintf("Invalid network helper %d", n))
+}
+
 // QueueingDiscipline is used to specify the kind of Queueing Discipline to
 // apply for a give FDBasedLink.
 type QueueingDiscipline int
@@ -733,6 +1037,609 @@ func (g HostFifo) AllowOpen() bool {
 	return g&HostFifoOpen != 0
 }
 
+// TPMMode selects how the TPM device /dev/tpmrm0 is provided to the sandbox.
+type TPMMode int
+
+const (
+	// TPMNone doesn't provide a TPM device.
+	TPMNone TPMMode = iota
+
+	// TPMHost proxies commands to the host's TPM resource manager, filtering
+	// out commands that modify state shared with the host.
+	TPMHost
+
+	// TPMEmulated provides a software TPM implemented in the sentry.
+	TPMEmulated
+)
+
+func tpmModePtr(v TPMMode) *TPMMode {
+	return &v
+}
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (m *TPMMode) Set(v string) error {
+	switch v {
+	case "", "none":
+		*m = TPMNone
+	case "host":
+		*m = TPMHost
+	case "emulated":
+		*m = TPMEmulated
+	default:
+		return fmt.Errorf("invalid TPM mode %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (m *TPMMode) Get() any {
+	return *m
+}
+
+// String implements flag.Value.
+func (m TPMMode) String() string {
+	switch m {
+	case TPMNone:
+		return "none"
+	case TPMHost:
+		return "host"
+	case TPMEmulated:
+		return "emulated"
+	default:
+		panic(fmt.Sprintf("Invalid TPM mode %d", m))
+	}
+}
+
+// IdleMemoryReclaim selects how host memory is released while the sandbox is
+// idle.
+type IdleMemoryReclaim int
+
+const (
+	// IdleMemoryReclaimOff doesn't release memory that is still allocated.
+	IdleMemoryReclaimOff IdleMemoryReclaim = iota
+
+	// IdleMemoryReclaimCold marks allocated memory as cold, so that the host
+	// reclaims it first under memory pressure, and gradually shrinks caches.
+	IdleMemoryReclaimCold
+
+	// IdleMemoryReclaimPageOut pages out allocated memory immediately, and
+	// shrinks caches more aggressively.
+	IdleMemoryReclaimPageOut
+)
+
+func idleMemoryReclaimPtr(v IdleMemoryReclaim) *IdleMemoryReclaim {
+	return &v
+}
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (r *IdleMemoryReclaim) Set(v string) error {
+	switch v {
+	case "", "off":
+		*r = IdleMemoryReclaimOff
+	case "cold":
+		*r = IdleMemoryReclaimCold
+	case "pageout":
+		*r = IdleMemoryReclaimPageOut
+	default:
+		return fmt.Errorf("invalid idle memory reclaim mode %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (r *IdleMemoryReclaim) Get() any {
+	return *r
+}
+
+// String implements flag.Value.
+func (r IdleMemoryReclaim) String() string {
+	switch r {
+	case IdleMemoryReclaimOff:
+		return "off"
+	case IdleMemoryReclaimCold:
+		return "cold"
+	case IdleMemoryReclaimPageOut:
+		return "pageout"
+	default:
+		panic(fmt.Sprintf("Invalid idle memory reclaim mode %d", r))
+	}
+}
+
+// Hugepages selects how host transparent hugepages are used to back sandbox
+// memory.
+type Hugepages int
+
+const (
+	// HugepagesDefault uses the host's default policy.
+	HugepagesDefault Hugepages = iota
+
+	// HugepagesAdvise requests transparent hugepages for sandbox memory with
+	// MADV_HUGEPAGE.
+	HugepagesAdvise
+
+	// HugepagesCollapse behaves like HugepagesAdvise, and additionally
+	// collapses densely used memory that is backed by small pages into
+	// hugepages in the background.
+	HugepagesCollapse
+)
+
+func hugepagesPtr(v Hugepages) *Hugepages {
+	return &v
+}
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (h *Hugepages) Set(v string) error {
+	switch v {
+	case "", "default":
+		*h = HugepagesDefault
+	case "advise":
+		*h = HugepagesAdvise
+	case "collapse":
+		*h = HugepagesCollapse
+	default:
+		return fmt.Errorf("invalid hugepages mode %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (h *Hugepages) Get() any {
+	return *h
+}
+
+// String implements flag.Value.
+func (h Hugepages) String() string {
+	switch h {
+	case HugepagesDefault:
+		return "default"
+	case HugepagesAdvise:
+		return "advise"
+	case HugepagesCollapse:
+		return "collapse"
+	default:
+		panic(fmt.Sprintf("Invalid hugepages mode %d", h))
+	}
+}
+
+// SwapMode selects where swapped application memory is stored.
+type SwapMode int
+
+const (
+	// SwapOff disables swapping.
+	SwapOff SwapMode = iota
+
+	// SwapCompressed stores swapped pages compressed in the sentry's memory.
+	SwapCompressed
+
+	// SwapFile behaves like SwapCompressed, but stores pages that don't
+	// compress well, or that don't fit in memory, in a host file.
+	SwapFile
+)
+
+func swapModePtr(v SwapMode) *SwapMode {
+	return &v
+}
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (m *SwapMode) Set(v string) error {
+	switch v {
+	case "", "off":
+		*m = SwapOff
+	case "compressed":
+		*m = SwapCompressed
+	case "file":
+		*m = SwapFile
+	default:
+		return fmt.Errorf("invalid swap mode %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (m *SwapMode) Get() any {
+	return *m
+}
+
+// String implements flag.Value.
+func (m SwapMode) String() string {
+	switch m {
+	case SwapOff:
+		return "off"
+	case SwapCompressed:
+		return "compressed"
+	case SwapFile:
+		return "file"
+	default:
+		panic(fmt.Sprintf("Invalid swap mode %d", m))
+	}
+}
+
+// PageMerging selects which application memory may be merged with identical
+// pages.
+type PageMerging int
+
+const (
+	// PageMergingOff disables page merging.
+	PageMergingOff PageMerging = iota
+
+	// PageMergingAdvised merges only memory for which the application called
+	// madvise(MADV_MERGEABLE), like Linux's KSM.
+	PageMergingAdvised
+
+	// PageMergingAll merges all private memory.
+	PageMergingAll
+)
+
+func pageMergingPtr(v PageMerging) *PageMerging {
+	return &v
+}
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (p *PageMerging) Set(v string) error {
+	switch v {
+	case "", "off":
+		*p = PageMergingOff
+	case "advised":
+		*p = PageMergingAdvised
+	case "all":
+		*p = PageMergingAll
+	default:
+		return fmt.Errorf("invalid page merging mode %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (p *PageMerging) Get() any {
+	return *p
+}
+
+// String implements flag.Value.
+func (p PageMerging) String() string {
+	switch p {
+	case PageMergingOff:
+		return "off"
+	case PageMergingAdvised:
+		return "advised"
+	case PageMergingAll:
+		return "all"
+	default:
+		panic(fmt.Sprintf("Invalid page merging mode %d", p))
+	}
+}
+
+// HostDevice is a host character device exposed to the sandbox.
+type HostDevice struct {
+	// Path is the absolute path of the device under /dev, in the host and
+	// in the sandbox.
+	Path string
+
+	// Ioctls are the ioctls that are passed through to the device. Other
+	// ioctls fail with ENOTTY.
+	Ioctls []HostDeviceIoctl
+}
+
+// HostDeviceIoctl is an ioctl passed through to a host device.
+type HostDeviceIoctl struct {
+	// Request is the ioctl request number.
+	Request uint32
+
+	// Size is the size in bytes of the buffer that the ioctl's argument
+	// points to, or 0 if the argument is passed by value. The size encoded
+	// in Request isn't trusted, since some drivers access more than it
+	// says.
+	Size uint32
+}
+
+// maxHostDeviceIoctlSize is the maximum HostDeviceIoctl.Size.
+const maxHostDeviceIoctlSize = 4096
+
+// emulatedDevicePaths are devices that the sandbox implements itself, and
+// that therefore can't be passed through from the host.
+//
+// They are mapped to the flag that exposes them, if any.
+var emulatedDevicePaths = map[string]string{
+	"/dev/ashmem":    "--android-devices",
+	"/dev/binder":    "--android-devices",
+	"/dev/console":   "",
+	"/dev/full":      "",
+	"/dev/fuse":      "",
+	"/dev/hwbinder":  "--android-devices",
+	"/dev/kfd":       "--amdproxy",
+	"/dev/kvm":       "--nested-kvm",
+	"/dev/net/tun":   "",
+	"/dev/null":      "",
+	"/dev/ptmx":      "",
+	"/dev/ptp0":      "--ptp",
+	"/dev/random":    "",
+	"/dev/tpmrm0":    "--tpm",
+	"/dev/tty":       "",
+	"/dev/urandom":   "",
+	"/dev/vndbinder": "--android-devices",
+	"/dev/zero":      "",
+}
+
+// emulatedDevicePrefixes are directories of devices that the sandbox
+// implements itself, mapped to the flag that exposes them.
+var emulatedDevicePrefixes = map[string]string{
+	"/dev/accel":       "--tpuproxy",
+	"/dev/dri/":        "--amdproxy",
+	"/dev/infiniband/": "--rdmaproxy",
+	"/dev/nvidia":      "--nvproxy",
+	"/dev/pts/":        "",
+	"/dev/vfio/":       "--vfio",
+}
+
+// checkNotEmulatedDevice returns an error if path is a device that the sandbox
+// implements itself, since registering a host device with the same device
+// number would fail at boot.
+func checkNotEmulatedDevice(path string) error {
+	flag, ok := emulatedDevicePaths[path]
+	if !ok {
+		for prefix, f := range emulatedDevicePrefixes {
+			if strings.HasPrefix(path, prefix) {
+				flag, ok = f, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+	if flag != "" {
+		return fmt.Errorf("host device %q is implemented by the sandbox and can't be passed through with --host-devices; use %s instead", path, flag)
+	}
+	return fmt.Errorf("host device %q is implemented by the sandbox and can't be passed through with --host-devices", path)
+}
+
+// HostDevices is a list of host character devices exposed to the sandbox.
+//
+// The format is a comma-separated list of devices, each of which is a path
+// optionally followed by the ioctls allowed on it, separated by colons. Each
+// ioctl is a request number and the size of the buffer its argument points
+// to, or 0 if the argument is passed by value, separated by '=', e.g.
+// "/dev/hidraw0:0x80044801=4:0x5401=0,/dev/ttyUSB0".
+type HostDevices []HostDevice
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (h *HostDevices) Set(v string) error {
+	var devs HostDevices
+	seen := make(map[string]struct{})
+	for _, devStr := range strings.Split(v, ",") {
+		if devStr == "" {
+			continue
+		}
+		parts := strings.Split(devStr, ":")
+		dev := HostDevice{Path: parts[0]}
+		if !filepath.IsAbs(dev.Path) || filepath.Clean(dev.Path) != dev.Path || !strings.HasPrefix(dev.Path, "/dev/") {
+			return fmt.Errorf("host device path must be a clean absolute path under /dev, got %q", dev.Path)
+		}
+		if err := checkNotEmulatedDevice(dev.Path); err != nil {
+			return err
+		}
+		if _, ok := seen[dev.Path]; ok {
+			return fmt.Errorf("host device %q specified more than once", dev.Path)
+		}
+		seen[dev.Path] = struct{}{}
+		for _, ioctlStr := range parts[1:] {
+			reqStr, sizeStr, ok := strings.Cut(ioctlStr, "=")
+			if !ok {
+				return fmt.Errorf("ioctl %q for host device %q must be of the form request=size", ioctlStr, dev.Path)
+			}
+			req, err := strconv.ParseUint(reqStr, 0, 32)
+			if err != nil {
+				return fmt.Errorf("invalid ioctl request number %q for host device %q: %v", reqStr, dev.Path, err)
+			}
+			size, err := strconv.ParseUint(sizeStr, 0, 32)
+			if err != nil {
+				return fmt.Errorf("invalid ioctl argument size %q for host device %q: %v", sizeStr, dev.Path, err)
+			}
+			if size > maxHostDeviceIoctlSize {
+				return fmt.Errorf("ioctl argument size %d for host device %q exceeds the maximum of %d", size, dev.Path, maxHostDeviceIoctlSize)
+			}
+			dev.Ioctls = append(dev.Ioctls, HostDeviceIoctl{Request: uint32(req), Size: uint32(size)})
+		}
+		devs = append(devs, dev)
+	}
+	*h = devs
+	return nil
+}
+
+// Get implements flag.Value.
+func (h *HostDevices) Get() any {
+	return *h
+}
+
+// String implements flag.Value.
+func (h HostDevices) String() string {
+	devStrs := make([]string, 0, len(h))
+	for _, dev := range h {
+		parts := []string{dev.Path}
+		for _, ioctl := range dev.Ioctls {
+			parts = append(parts, fmt.Sprintf("%#x=%d", ioctl.Request, ioctl.Size))
+		}
+		devStrs = append(devStrs, strings.Join(parts, ":"))
+	}
+	return strings.Join(devStrs, ",")
+}
+
+// VFIOGroup is a host VFIO group exposed to the sandbox.
+type VFIOGroup struct {
+	// Group is the IOMMU group number, as in /dev/vfio/<group>.
+	Group uint32
+
+	// MmapAllRegions is true if all device regions that the host allows to
+	// be mapped may be mapped by the application. Otherwise, only the
+	// regions in MmapRegions may be mapped, and all other regions can only
+	// be accessed with pread(2) and pwrite(2).
+	MmapAllRegions bool
+
+	// MmapRegions are the indices of the device regions that may be mapped
+	// if MmapAllRegions is false.
+	MmapRegions []uint32
+}
+
+// VFIOGroups is a list of host VFIO groups exposed to the sandbox.
+//
+// The format is a comma-separated list of groups, each of which is a group
+// number optionally followed by the indices of the device regions that may
+// be mapped, separated by colons, e.g. "12,14:0:2". If no regions are given,
+// all regions may be mapped; "none" allows no region to be mapped, e.g.
+// "15:none".
+type VFIOGroups []VFIOGroup
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (g *VFIOGroups) Set(v string) error {
+	var groups VFIOGroups
+	seen := make(map[uint32]struct{})
+	for _, groupStr := range strings.Split(v, ",") {
+		if groupStr == "" {
+			continue
+		}
+		parts := strings.Split(groupStr, ":")
+		num, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid VFIO group %q: %v", parts[0], err)
+		}
+		group := VFIOGroup{Group: uint32(num)}
+		if _, ok := seen[group.Group]; ok {
+			return fmt.Errorf("VFIO group %d specified more than once", group.Group)
+		}
+		seen[group.Group] = struct{}{}
+		switch {
+		case len(parts) == 1:
+			group.MmapAllRegions = true
+		case len(parts) == 2 && parts[1] == "none":
+		default:
+			for _, regionStr := range parts[1:] {
+				region, err := strconv.ParseUint(regionStr, 10, 32)
+				if err != nil {
+					return fmt.Errorf("invalid region index %q for VFIO group %d: %v", regionStr, group.Group, err)
+				}
+				group.MmapRegions = append(group.MmapRegions, uint32(region))
+			}
+		}
+		groups = append(groups, group)
+	}
+	*g = groups
+	return nil
+}
+
+// Get implements flag.Value.
+func (g *VFIOGroups) Get() any {
+	return *g
+}
+
+// String implements flag.Value.
+func (g VFIOGroups) String() string {
+	groupStrs := make([]string, 0, len(g))
+	for _, group := range g {
+		parts := []string{strconv.FormatUint(uint64(group.Group), 10)}
+		switch {
+		case group.MmapAllRegions:
+		case len(group.MmapRegions) == 0:
+			parts = append(parts, "none")
+		default:
+			for _, region := range group.MmapRegions {
+				parts = append(parts, strconv.FormatUint(uint64(region), 10))
+			}
+		}
+		groupStrs = append(groupStrs, strings.Join(parts, ":"))
+	}
+	return strings.Join(groupStrs, ",")
+}
+
+// PortForward forwards a host port to a port in the sandbox.
+type PortForward struct {
+	// Proto is the transport protocol, "tcp" or "udp".
+	Proto string
+
+	// HostIP is the host address to listen on. Empty means all addresses.
+	HostIP string
+
+	// HostPort is the port to listen on in the host.
+	HostPort uint16
+
+	// Port is the port connections are forwarded to in the sandbox.
+	Port uint16
+}
+
+// String returns the forward in the format accepted by PortForwards.Set.
+func (p PortForward) String() string {
+	s := strconv.Itoa(int(p.HostPort))
+	if p.HostIP != "" {
+		s = net.JoinHostPort(p.HostIP, s)
+	}
+	return fmt.Sprintf("%s:%d/%s", s, p.Port, p.Proto)
+}
+
+// PortForwards is a list of host ports forwarded to the sandbox.
+//
+// Each forward has the format [hostIP:]hostPort:port[/tcp|/udp], and
+// forwards are separated by commas. IPv6 host addresses must be enclosed in
+// square brackets. The protocol defaults to tcp.
+type PortForwards []PortForward
+
+// Set implements flag.Value. Set(String()) should be idempotent.
+func (p *PortForwards) Set(v string) error {
+	var fwds PortForwards
+	for _, fwdStr := range strings.Split(v, ",") {
+		if fwdStr == "" {
+			continue
+		}
+		fwd := PortForward{Proto: "tcp"}
+		addr := fwdStr
+		if i := strings.LastIndex(addr, "/"); i >= 0 {
+			fwd.Proto = addr[i+1:]
+			addr = addr[:i]
+		}
+		if fwd.Proto != "tcp" && fwd.Proto != "udp" {
+			return fmt.Errorf("invalid protocol %q in port forward %q", fwd.Proto, fwdStr)
+		}
+		i := strings.LastIndex(addr, ":")
+		if i < 0 {
+			return fmt.Errorf("port forward %q must have the format [hostIP:]hostPort:port[/proto]", fwdStr)
+		}
+		port, err := strconv.ParseUint(addr[i+1:], 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("invalid port in port forward %q", fwdStr)
+		}
+		fwd.Port = uint16(port)
+		hostPort := addr[:i]
+		if strings.Contains(hostPort, ":") {
+			fwd.HostIP, hostPort, err = net.SplitHostPort(hostPort)
+			if err != nil {
+				return fmt.Errorf("invalid host address in port forward %q: %v", fwdStr, err)
+			}
+			if net.ParseIP(fwd.HostIP) == nil {
+				return fmt.Errorf("invalid host address %q in port forward %q", fwd.HostIP, fwdStr)
+			}
+		}
+		port, err = strconv.ParseUint(hostPort, 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("invalid host port in port forward %q", fwdStr)
+		}
+		fwd.HostPort = uint16(port)
+		fwds = append(fwds, fwd)
+	}
+	*p = fwds
+	return nil
+}
+
+// Get implements flag.Value.
+func (p *PortForwards) Get() any {
+	return *p
+}
+
+// String implements flag.Value.
+func (p PortForwards) String() string {
+	fwdStrs := make([]string, 0, len(p))
+	for _, fwd := range p {
+		fwdStrs = append(fwdStrs, fwd.String())
+	}
+	return strings.Join(fwdStrs, ",")
+}
+
 // Overlay2 holds the configuration for setting up overlay filesystems for the
 // container.
 type Overlay2 struct {
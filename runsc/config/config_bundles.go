@@ -28,4 +28,21 @@ var Bundles = map[BundleName]Bundle{
 		"overlay2": "root:self",
 		"platform": "systrap",
 	},
+	// micro is a minimal sandbox for single-binary workloads that don't need
+	// networking or a persistent root filesystem. The sentry's seccomp
+	// program is cached across sandboxes. The root filesystem is still served
+	// by a gofer per sandbox: sandboxes don't share a pool of root
+	// filesystems.
+	"micro": {
+		"directfs":      "true",
+		"minimal-boot":  "true",
+		"network":       "none",
+		"overlay2":      "root:memory",
+		"platform":      "systrap",
+		"seccomp-cache": "true",
+	},
 }
+
+// BootProfiles are the bundles that can be selected with the --profile flag
+// of `runsc create` and `runsc run`.
+var BootProfiles = []BundleName{"micro"}
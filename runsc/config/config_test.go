@@ -231,6 +231,71 @@ func TestInvalidFlags(t *testing.T) {
 			value: "root:dir=tmp",
 			error: "overlay host file directory should be an absolute path, got \"tmp\"",
 		},
+		{
+			name:  "host-devices",
+			value: "/dev/../etc/passwd",
+			error: "host device path must be a clean absolute path under /dev",
+		},
+		{
+			name:  "host-devices",
+			value: "/dev/hidraw0:ioctl=4",
+			error: "invalid ioctl request number",
+		},
+		{
+			name:  "host-devices",
+			value: "/dev/hidraw0:0x80044801",
+			error: "must be of the form request=size",
+		},
+		{
+			name:  "host-devices",
+			value: "/dev/hidraw0:0x80044801=4097",
+			error: "exceeds the maximum",
+		},
+		{
+			name:  "host-devices",
+			value: "/dev/net/tun:0x400454ca=40",
+			error: "is implemented by the sandbox",
+		},
+		{
+			name:  "host-devices",
+			value: "/dev/fuse",
+			error: "is implemented by the sandbox",
+		},
+		{
+			name:  "host-devices",
+			value: "/dev/nvidia0",
+			error: "use --nvproxy instead",
+		},
+		{
+			name:  "host-devices",
+			value: "/dev/hidraw0,/dev/hidraw0",
+			error: "specified more than once",
+		},
+		{
+			name:  "network-helper",
+			value: "invalid",
+			error: "invalid network helper",
+		},
+		{
+			name:  "publish",
+			value: "8080",
+			error: "must have the format",
+		},
+		{
+			name:  "publish",
+			value: "8080:80/sctp",
+			error: "invalid protocol",
+		},
+		{
+			name:  "publish",
+			value: "localhost:8080:80",
+			error: "invalid host address",
+		},
+		{
+			name:  "publish",
+			value: "70000:80",
+			error: "invalid host port",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
@@ -303,6 +368,36 @@ func TestValidationFail(t *testing.T) {
 			},
 			error: "overlay flag has been replaced with overlay2 flag",
 		},
+		{
+			name: "network-helper+network:host",
+			flags: map[string]string{
+				"network":        "host",
+				"network-helper": "pasta",
+			},
+			error: "network-helper flag requires network=sandbox",
+		},
+		{
+			name: "publish",
+			flags: map[string]string{
+				"publish": "8080:80",
+			},
+			error: "publish flag requires setting network-helper",
+		},
+		{
+			name: "host-ktls",
+			flags: map[string]string{
+				"host-ktls": "true",
+			},
+			error: "host-ktls flag requires network=host",
+		},
+		{
+			name: "page-cache-watermarks",
+			flags: map[string]string{
+				"page-cache-high-watermark": "50",
+				"page-cache-low-watermark":  "60",
+			},
+			error: "page-cache-low-watermark (60) must be lower than page-cache-high-watermark (50)",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
@@ -435,6 +530,14 @@ func TestOverrideAllowlist(t *testing.T) {
 			flag:  "oci-seccomp",
 			value: "true",
 		},
+		{
+			flag:  "cpu-features-mask",
+			value: "avx512f,avx512bw",
+		},
+		{
+			flag:  "cpu-microarch-level",
+			value: "x86-64-v3",
+		},
 		{
 			flag:  "oci-seccomp",
 			value: "false",
@@ -778,3 +881,111 @@ root = "%s"
 	}
 
 }
+
+func TestBootProfiles(t *testing.T) {
+	for _, profile := range BootProfiles {
+		t.Run(string(profile), func(t *testing.T) {
+			b, ok := Bundles[profile]
+			if !ok {
+				t.Fatalf("boot profile %q has no bundle", profile)
+			}
+			if err := b.Validate(); err != nil {
+				t.Fatalf("invalid bundle for boot profile %q: %v", profile, err)
+			}
+		})
+	}
+
+	flagSet := flag.NewFlagSet("micro", flag.ContinueOnError)
+	RegisterFlags(flagSet)
+	cfg, err := NewFromFlags(flagSet)
+	if err != nil {
+		t.Fatalf("cannot generate config from flags: %v", err)
+	}
+	if err := cfg.ApplyBootProfile(flagSet, "micro"); err != nil {
+		t.Fatalf("ApplyBootProfile(micro) failed: %v", err)
+	}
+	if !cfg.MinimalBoot {
+		t.Errorf("MinimalBoot is false after applying the micro profile")
+	}
+	if cfg.Network != NetworkNone {
+		t.Errorf("Network is %v after applying the micro profile, want %v", cfg.Network, NetworkNone)
+	}
+	if err := cfg.ApplyBootProfile(flagSet, "experimental-high-performance"); err == nil {
+		t.Errorf("ApplyBootProfile succeeded for a bundle that is not a boot profile")
+	}
+}
+
+func TestHostDevices(t *testing.T) {
+	var devs HostDevices
+	if err := devs.Set("/dev/hidraw0:0x80044801=4:0x5401=0,/dev/ttyUSB0"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	want := HostDevices{
+		{Path: "/dev/hidraw0", Ioctls: []HostDeviceIoctl{{Request: 0x80044801, Size: 4}, {Request: 0x5401, Size: 0}}},
+		{Path: "/dev/ttyUSB0"},
+	}
+	if diff := cmp.Diff(want, devs); diff != "" {
+		t.Errorf("Set() got unexpected devices, diff (-want +got):\n%s", diff)
+	}
+
+	// Set(String()) must be idempotent.
+	var roundTrip HostDevices
+	if err := roundTrip.Set(devs.String()); err != nil {
+		t.Fatalf("Set(%q) failed: %v", devs.String(), err)
+	}
+	if diff := cmp.Diff(devs, roundTrip); diff != "" {
+		t.Errorf("Set(String()) is not idempotent, diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestVFIOGroups(t *testing.T) {
+	var groups VFIOGroups
+	if err := groups.Set("12,14:0:2,15:none"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	want := VFIOGroups{
+		{Group: 12, MmapAllRegions: true},
+		{Group: 14, MmapRegions: []uint32{0, 2}},
+		{Group: 15},
+	}
+	if diff := cmp.Diff(want, groups); diff != "" {
+		t.Errorf("Set() got unexpected groups, diff (-want +got):\n%s", diff)
+	}
+
+	// Set(String()) must be idempotent.
+	var roundTrip VFIOGroups
+	if err := roundTrip.Set(groups.String()); err != nil {
+		t.Fatalf("Set(%q) failed: %v", groups.String(), err)
+	}
+	if diff := cmp.Diff(groups, roundTrip); diff != "" {
+		t.Errorf("Set(String()) is not idempotent, diff (-want +got):\n%s", diff)
+	}
+
+	if err := groups.Set("12,12:0"); err == nil {
+		t.Errorf("Set() succeeded with a duplicate group")
+	}
+}
+
+func TestPortForwards(t *testing.T) {
+	var fwds PortForwards
+	if err := fwds.Set("8080:80,127.0.0.1:5353:53/udp,[::1]:8443:443/tcp"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	want := PortForwards{
+		{Proto: "tcp", HostPort: 8080, Port: 80},
+		{Proto: "udp", HostIP: "127.0.0.1", HostPort: 5353, Port: 53},
+		{Proto: "tcp", HostIP: "::1", HostPort: 8443, Port: 443},
+	}
+	if diff := cmp.Diff(want, fwds); diff != "" {
+		t.Errorf("Set() got unexpected forwards, diff (-want +got):\n%s", diff)
+	}
+
+	// Set(String()) must be idempotent.
+	var roundTrip PortForwards
+	if err := roundTrip.Set(fwds.String()); err != nil {
+		t.Fatalf("Set(%q) failed: %v", fwds.String(), err)
+	}
+	if diff := cmp.Diff(fwds, roundTrip); diff != "" {
+		t.Errorf("Set(String()) is not idempotent, diff (-want +got):\n%s", diff)
+	}
+}
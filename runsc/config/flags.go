@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/refs"
@@ -70,11 +71,13 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("strace-syscalls", "", "comma-separated list of syscalls to trace. If --strace is true and this list is empty, then all syscalls will be traced.")
 	flagSet.Uint("strace-log-size", 1024, "default size (in bytes) to log data argument blobs.")
 	flagSet.Bool("strace-event", false, "send strace to event.")
+	flagSet.String("strace-json", "", "file to write strace records to as JSON, one per line. Traces the syscalls in --strace-syscalls.")
+	flagSet.String("syscall-overrides", "", "comma-separated list of <syscall>=<action> overrides applied to all containers, where action is errno:<errno> to fail the syscall without executing it, or delay:<duration> to delay it. (DO NOT USE IN PRODUCTION)")
 
 	// Flags that control sandbox runtime behavior.
 	flagSet.String("platform", "systrap", "specifies which platform to use: systrap (default), ptrace, kvm.")
 	flagSet.String("platform_device_path", "", "path to a platform-specific device file (e.g. /dev/kvm for KVM platform). If unset, will use a sane platform-specific default.")
-	flagSet.Var(watchdogActionPtr(watchdog.LogWarning), "watchdog-action", "sets what action the watchdog takes when triggered: log (default), panic.")
+	flagSet.Var(watchdogActionPtr(watchdog.LogWarning), "watchdog-action", "sets what action the watchdog takes when triggered: log (default), panic, kill-task, kill-container.")
 	flagSet.Int("panic-signal", -1, "register signal handling that panics. Usually set to SIGUSR2(12) to troubleshoot hangs. -1 disables it.")
 	flagSet.Bool("profile", false, "prepares the sandbox to use Golang profiler. Note that enabling profiler loosens the seccomp protection added to the sandbox (DO NOT USE IN PRODUCTION).")
 	flagSet.String("profile-block", "", "collects a block profile to this file path for the duration of the container execution. Requires -profile=true.")
@@ -85,9 +88,20 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("rootless", false, "it allows the sandbox to be started with a user that is not root. Sandbox and Gofer processes may run with same privileges as current user.")
 	flagSet.Var(leakModePtr(refs.NoLeakChecking), "ref-leak-mode", "sets reference leak check mode: disabled (default), log-names, log-traces.")
 	flagSet.Bool("cpu-num-from-quota", false, "set cpu number to cpu quota (least integer greater or equal to quota value, but not less than 2)")
+	flagSet.Bool("cpu-hotplug", false, "take CPUs offline and back online in the sandbox as the host CPUs that the sandbox may run on change, e.g. with its cpuset.")
+	flagSet.String("cpu-features-mask", "", "comma-separated list of CPU features, as named in /proc/cpuinfo, to hide from applications (e.g. avx512f). Features that depend on them are hidden as well.")
+	flagSet.String("cpu-microarch-level", "", "hide CPU features that are not part of the given x86-64 microarchitecture level (x86-64-v1 to x86-64-v4). The host must support the level.")
+	flagSet.String("cpu-brand", "", "processor brand string to expose to applications.")
+	flagSet.Uint("cpu-threads-per-core", 0, "number of hardware threads per core reported to applications in sysfs and /proc/cpuinfo (default 1).")
+	flagSet.Uint("cpu-cores-per-socket", 0, "number of cores per socket reported to applications in sysfs and /proc/cpuinfo (default: one socket per NUMA node).")
+	flagSet.Uint("numa-nodes", 0, "number of NUMA nodes reported to applications in sysfs (default 1). CPUs are divided evenly between nodes.")
 	flagSet.Bool("oci-seccomp", false, "Enables loading OCI seccomp filters inside the sandbox.")
 	flagSet.Bool("enable-core-tags", false, "enables core tagging. Requires host linux kernel >= 5.14.")
 	flagSet.String("pod-init-config", "", "path to configuration file with additional steps to take during pod creation.")
+	flagSet.String("syscall-filter-profile", "", "path to a syscall filter profile, in JSON or protobuf text format. Its \"sentry\" rules list host syscalls that the sandbox may not make in addition to its own filters, and its \"guest\" rules are an OCI seccomp configuration that constrains all container processes.")
+	flagSet.Bool("minimal-boot", false, "EXPERIMENTAL: skip sandbox setup that single-binary workloads don't need. With --network=none no network stack is created, so only Unix domain sockets are available, and procfs is mounted with subset=pid.")
+	flagSet.Bool("seccomp-cache", false, "EXPERIMENTAL: cache the sentry's seccomp program under --root, so that sandboxes started with the same configuration don't build it again.")
+	flagSet.Bool("sandbox-groups", false, "EXPERIMENTAL: allow pods annotated with the same dev.gvisor.sandbox-group to share a single sandbox. Pods in a group must belong to the same Kubernetes namespace, as they share a sentry. Pods joining a sandbox get UTS, IPC and network namespaces of their own, and pods with resource limits require --cgroupfs.")
 
 	// Flags that control sandbox runtime behavior: FS related.
 	flagSet.Var(fileAccessTypePtr(FileAccessExclusive), "file-access", "specifies which filesystem validation to use for the root mount: exclusive (default), shared.")
@@ -97,25 +111,49 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("fsgofer-host-uds", false, "DEPRECATED: use host-uds=all")
 	flagSet.Var(hostUDSPtr(HostUDSNone), "host-uds", "controls permission to access host Unix-domain sockets. Values: none|open|create|all, default: none")
 	flagSet.Var(hostFifoPtr(HostFifoNone), "host-fifo", "controls permission to access host FIFOs (or named pipes). Values: none|open, default: none")
+	flagSet.Bool("host-inotify", false, "forward inotify events for changes made on the host to files in gofer-backed mounts, so that watchers in the sandbox see external modifications.")
+	flagSet.Bool("host-delegations", false, "hold host file leases on files opened in gofer mounts with exclusive file access, so that cached file data is written back and dropped when the files are opened outside of the sandbox. Requires --directfs=false.")
+	flagSet.Bool("host-file-locks", false, "delegate flock(2) and fcntl(2) locks on shared gofer-backed mounts to the host, so that they are enforced across sandboxes and host processes sharing the files.")
 
 	flagSet.Bool("vfs2", true, "DEPRECATED: this flag has no effect.")
 	flagSet.Bool("fuse", true, "DEPRECATED: this flag has no effect.")
 	flagSet.Bool("lisafs", true, "DEPRECATED: this flag has no effect.")
-	flagSet.Bool("cgroupfs", false, "Automatically mount cgroupfs.")
+	flagSet.Bool("cgroupfs", false, "Automatically mount cgroupfs. Each container is placed in its own cgroup, and the CPU, memory and PID limits in its spec are enforced by the sentry.")
 	flagSet.Bool("ignore-cgroups", false, "don't configure cgroups.")
 	flagSet.Int("fdlimit", -1, "Specifies a limit on the number of host file descriptors that can be open. Applies separately to the sentry and gofer. Note: each file in the sandbox holds more than one host FD open.")
+	flagSet.Duration("host-fd-async-write-threshold", 0, "(e.g. \"500ms\") offload writes to donated host FDs, such as stdio and container logs, to buffered asynchronous writers once a write blocks for this long. Zero disables offloading.")
+	flagSet.Int("host-fd-async-write-buffer", 1<<20, "maximum number of bytes buffered for each host FD whose writes are offloaded.")
+	flagSet.Bool("host-fd-async-write-drop", false, "drop offloaded writes that don't fit in the buffer instead of blocking the writer.")
+	flagSet.Var(idleMemoryReclaimPtr(IdleMemoryReclaimOff), "idle-memory-reclaim", "release host memory while the sandbox is idle. Values: off (default), cold (mark memory as cold and gradually shrink caches), pageout (page out memory and shrink caches more aggressively).")
+	flagSet.Duration("idle-memory-reclaim-interval", time.Minute, "(e.g. \"30s\") how long the sandbox must go without allocating memory before idle memory reclaim starts, and how often it runs while the sandbox remains idle.")
+	flagSet.Var(hugepagesPtr(HugepagesDefault), "hugepages", "use host transparent hugepages for sandbox memory. Values: default (use the host's policy), advise (request hugepages with MADV_HUGEPAGE), collapse (also collapse densely used memory into hugepages in the background; requires Linux 6.1).")
+	flagSet.Duration("hugepage-collapse-interval", 10*time.Second, "(e.g. \"10s\") how often sandbox memory is scanned for regions to collapse into hugepages with --hugepages=collapse.")
+	flagSet.Var(swapModePtr(SwapOff), "swap", "EXPERIMENTAL: swap out application anonymous memory when memory usage exceeds --swap-threshold. Requires a memory limit. Values: off (default), compressed (store pages compressed in memory), file (also store pages in --swap-file).")
+	flagSet.String("swap-file", "", "host file used to store swapped pages with --swap=file. The file is created if it doesn't exist, and truncated.")
+	flagSet.Uint64("swap-file-size", 4<<30, "maximum size in bytes of --swap-file.")
+	flagSet.Uint("swap-threshold", 90, "percentage of the sandbox's memory limit above which memory is swapped out with --swap.")
+	flagSet.Uint("oom-kill-threshold", 0, "percentage of the sandbox's memory limit above which the sentry kills the process with the highest oom_score_adj-adjusted memory usage, preferring the container using the most memory, instead of the host killing the whole sandbox. 0 (default) disables it.")
+	flagSet.Uint("page-cache-high-watermark", 0, "percentage of the sandbox's memory limit above which cached file data is evicted, least recently used and clean data first, down to --page-cache-low-watermark. Cached data is also evicted when the sandbox's cgroup is under memory pressure. 0 (default) disables it.")
+	flagSet.Uint("page-cache-low-watermark", 0, "percentage of the sandbox's memory limit down to which cached file data is evicted with --page-cache-high-watermark.")
+	flagSet.Var(pageMergingPtr(PageMergingOff), "page-merging", "EXPERIMENTAL: merge application pages with identical contents, sharing them copy-on-write. Values: off (default), advised (only memory marked with madvise(MADV_MERGEABLE)), all (all private memory).")
+	flagSet.Duration("page-merging-interval", 100*time.Millisecond, "time between page merging scans with --page-merging.")
+	flagSet.Uint64("page-merging-pages", 1000, "number of pages scanned in each page merging scan with --page-merging.")
 	flagSet.Int("dcache", -1, "Set the global dentry cache size. This acts as a coarse-grained control on the number of host FDs simultaneously open by the sentry. If negative, per-mount caches are used.")
 	flagSet.Bool("iouring", false, "TEST ONLY; Enables io_uring syscalls in the sentry. Support is experimental and very limited.")
 	flagSet.Bool("directfs", true, "directly access the container filesystems from the sentry. Sentry runs with higher privileges.")
 
 	// Flags that control sandbox runtime behavior: network related.
 	flagSet.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, none. Using network inside the sandbox is more secure because it's isolated from the host network.")
+	flagSet.Var(networkHelperPtr(NetworkHelperNone), "network-helper", "userspace NAT program that provides network access to the sandbox in rootless mode, without requiring CAP_NET_ADMIN: none (default), slirp4netns, pasta. The program must be installed in PATH. Requires --network=sandbox.")
+	flagSet.Var(&PortForwards{}, "publish", "comma-separated list of host ports to forward to the sandbox through --network-helper, in the format [hostIP:]hostPort:port[/tcp|/udp], e.g. 8080:80,127.0.0.1:5353:53/udp.")
 	flagSet.Bool("net-raw", false, "enable raw sockets. When false, raw sockets are disabled by removing CAP_NET_RAW from containers (`runsc exec` will still be able to utilize raw sockets). Raw sockets allow malicious containers to craft packets and potentially attack the network.")
+	flagSet.Bool("host-ktls", false, "allow applications to enable kernel TLS on sockets with --network=host, offloading TLS record processing to the host kernel. Requires the host to support kernel TLS.")
 	flagSet.Bool("gso", true, "enable host segmentation offload if it is supported by a network device.")
 	flagSet.Bool("software-gso", true, "enable gVisor segmentation offload when host offload can't be enabled.")
 	flagSet.Duration("gvisor-gro", 0, "(e.g. \"20000ns\" or \"1ms\") sets gVisor's generic receive offload timeout. Zero bypasses GRO.")
 	flagSet.Bool("tx-checksum-offload", false, "enable TX checksum offload.")
 	flagSet.Bool("rx-checksum-offload", true, "enable RX checksum offload.")
+	flagSet.Bool("net-save-connections", false, "save established TCP connections on checkpoint and resume them on restore. Connections survive only if the restored sandbox has the same IP addresses.")
 	flagSet.Var(queueingDisciplinePtr(QDiscFIFO), "qdisc", "specifies which queueing discipline to apply by default to the non loopback nics used by the sandbox.")
 	flagSet.Int("num-network-channels", 1, "number of underlying channels(FDs) to use for network link endpoints.")
 	flagSet.Bool("buffer-pooling", true, "enable allocation of buffers from a shared pool instead of the heap.")
@@ -124,7 +162,18 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	// Flags that control sandbox runtime behavior: accelerator related.
 	flagSet.Bool("nvproxy", false, "EXPERIMENTAL: enable support for Nvidia GPUs")
 	flagSet.Bool("nvproxy-docker", false, "Expose GPUs to containers based on NVIDIA_VISIBLE_DEVICES, as requested by the container or set by `docker --gpus`. Allows containers to self-serve GPU access and thus disabled by default for security. libnvidia-container must be installed on the host. No effect unless --nvproxy is enabled.")
+	flagSet.Bool("cdi", false, "Inject devices requested through Container Device Interface (CDI) annotations (cdi.k8s.io/*) into containers, as described by CDI specs in /etc/cdi and /var/run/cdi. GPUs injected this way are exposed through nvproxy without libnvidia-container.")
 	flagSet.Bool("tpuproxy", false, "EXPERIMENTAL: enable support for TPU device passthrough.")
+	flagSet.Bool("amdproxy", false, "EXPERIMENTAL: enable support for AMD GPUs (ROCm) by proxying /dev/kfd and /dev/dri/renderD* to the host. Requires a platform that owns page tables (e.g. kvm).")
+	flagSet.Var(&HostDevices{}, "host-devices", "EXPERIMENTAL: comma-separated list of host character devices to expose to the sandbox, each optionally followed by the ioctls allowed on it, separated by colons. Each ioctl is given as request=size, where size is the size of the buffer its argument points to, or 0 if the argument is passed by value, e.g. /dev/hidraw0:0x80044801=4,/dev/ttyUSB0. Can be set per-sandbox with the dev.gvisor.flag.host-devices annotation if --allow-flag-override is enabled.")
+	flagSet.Bool("android-devices", false, "EXPERIMENTAL: emulate the Android /dev/binder, /dev/hwbinder, /dev/vndbinder and /dev/ashmem devices, allowing binder IPC between processes in the sandbox.")
+	flagSet.Var(tpmModePtr(TPMNone), "tpm", "EXPERIMENTAL: provides a TPM 2.0 device at /dev/tpmrm0. Values: none (default), host (proxy filtered commands to the host's /dev/tpmrm0), emulated (software TPM in the sandbox).")
+	flagSet.Bool("nested-kvm", false, "EXPERIMENTAL: expose the host's /dev/kvm to the sandbox, passing through an allowlist of KVM ioctls, so that virtual machine monitors like Firecracker can run in it.")
+	flagSet.Var(&VFIOGroups{}, "vfio", "EXPERIMENTAL: comma-separated list of host VFIO groups to expose to the sandbox through a mediated /dev/vfio, each optionally followed by the indices of the device regions that may be mapped, separated by colons, or \"none\", e.g. 12,14:0:2. DMA mappings are logged. Mapping device regions is not supported on platforms that own page tables (e.g. kvm).")
+	flagSet.Bool("rdmaproxy", false, "EXPERIMENTAL: enable support for RDMA devices (libibverbs) by proxying /dev/infiniband/uverbs* to the host. Supports devices using the mlx5, efa, rxe and siw drivers. Memory registered with the devices is pinned.")
+	flagSet.Bool("ptp", false, "EXPERIMENTAL: provides a read-only PTP hardware clock device at /dev/ptp0 that reports the sandbox's CLOCK_TAI.")
+	flagSet.Bool("memfd-secret", false, "EXPERIMENTAL: enable memfd_secret(2). Secret memory is not mapped by the sentry unless the platform owns page tables (e.g. KVM), and uses the host's memfd_secret(2) when available.")
+	flagSet.Bool("virtiofs", false, "EXPERIMENTAL: enable virtiofs mounts, whose source is the vhost-user socket of a virtio-fs server such as virtiofsd.")
 
 	// Test flags, not to be used outside tests, ever.
 	flagSet.Bool("TESTONLY-unsafe-nonroot", false, "TEST ONLY; do not ever use! This skips many security measures that isolate the host from the sandbox.")
@@ -146,6 +195,17 @@ var overrideAllowlist = map[string]struct {
 	"strace-log-size": {},
 	"host-uds":        {},
 
+	// CPU feature policies only hide features from applications.
+	"cpu-features-mask":   {},
+	"cpu-microarch-level": {},
+	"cpu-brand":           {},
+
+	// Like CPU feature policies, the CPU topology is only reported to
+	// applications.
+	"cpu-threads-per-core": {},
+	"cpu-cores-per-socket": {},
+	"numa-nodes":           {},
+
 	"oci-seccomp": {check: checkOciSeccomp},
 }
 
@@ -472,6 +532,20 @@ func (c *Config) ApplyBundles(flagSet *flag.FlagSet, bundleNames ...BundleName)
 	return c.validate()
 }
 
+// ApplyBootProfile applies the bundle for the given boot profile, which must
+// be one of BootProfiles. An empty name is a no-op.
+func (c *Config) ApplyBootProfile(flagSet *flag.FlagSet, name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, profile := range BootProfiles {
+		if BundleName(name) == profile {
+			return c.ApplyBundles(flagSet, profile)
+		}
+	}
+	return fmt.Errorf("invalid boot profile %q, must be one of: %v", name, BootProfiles)
+}
+
 func getVal(field reflect.Value) string {
 	if str, ok := field.Addr().Interface().(fmt.Stringer); ok {
 		return str.String()
@@ -61,3 +61,8 @@ func NewWithSocket(socketPath string) (*os.File, error) {
 	}
 	return ptyReplica, nil
 }
+
+// NewPair creates a new pty master/replica pair.
+func NewPair() (master, replica *os.File, err error) {
+	return pty.Open()
+}
@@ -24,3 +24,35 @@ func IsPty(fd uintptr) bool {
 	_, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
 	return err == nil
 }
+
+// MakeRaw puts the terminal FD into raw mode, as cfmakeraw(3) does. It returns
+// a function that restores the previous mode.
+func MakeRaw(fd uintptr) (func(), error) {
+	old, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(int(fd), unix.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return func() {
+		_ = unix.IoctlSetTermios(int(fd), unix.TCSETS, old)
+	}, nil
+}
+
+// WindowSize returns the number of rows and columns of the terminal FD.
+func WindowSize(fd uintptr) (rows, cols uint16, err error) {
+	ws, err := unix.IoctlGetWinsize(int(fd), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ws.Row, ws.Col, nil
+}
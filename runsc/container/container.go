@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path"
@@ -139,6 +140,14 @@ type Container struct {
 	// bind mounts in Spec.Mounts (in the same order).
 	OverlayMediums boot.OverlayMediumFlags `json:"overlayMediums"`
 
+	// PodID is the ID of the pod this container belongs to when the pod is in
+	// a sandbox group (see --sandbox-groups). It's empty otherwise.
+	PodID string `json:"podID,omitempty"`
+
+	// SandboxGroup is the sandbox group of the pod this container belongs to.
+	// It's empty when the pod isn't in a sandbox group.
+	SandboxGroup string `json:"sandboxGroup,omitempty"`
+
 	//
 	// Fields below this line are not saved in the state file and will not
 	// be preserved across commands.
@@ -207,12 +216,39 @@ func New(conf *config.Config, args Args) (*Container, error) {
 	}
 
 	sandboxID := args.ID
+	podID, group := "", ""
 	if !isRoot(args.Spec) {
 		var ok bool
 		sandboxID, ok = specutils.SandboxID(args.Spec)
 		if !ok {
 			return nil, fmt.Errorf("no sandbox ID found when creating container")
 		}
+		if conf.SandboxGroups {
+			var err error
+			podID, group, sandboxID, err = podSandboxID(conf.RootDir, sandboxID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if g, ok := specutils.SandboxGroup(args.Spec); ok && conf.SandboxGroups {
+		podID, group = args.ID, g
+	}
+	var unlockGroup func()
+	if group != "" {
+		// Keep the group's sandbox from going away until the container is
+		// created in it, and serialize with other pods joining the group.
+		var err error
+		unlockGroup, err = lockSandboxGroup(conf.RootDir, group)
+		if err != nil {
+			return nil, err
+		}
+		if podID == args.ID {
+			sandboxID, err = joinSandboxGroup(conf, podID, group, args.Spec)
+			if err != nil {
+				unlockGroup()
+				return nil, err
+			}
+		}
 	}
 
 	c := &Container{
@@ -223,6 +259,8 @@ func New(conf *config.Config, args Args) (*Container, error) {
 		Status:        Creating,
 		CreatedAt:     time.Now(),
 		Owner:         os.Getenv("USER"),
+		PodID:         podID,
+		SandboxGroup:  group,
 		Saver: StateFile{
 			RootDir: conf.RootDir,
 			ID: FullID{
@@ -235,6 +273,10 @@ func New(conf *config.Config, args Args) (*Container, error) {
 	// occurs. Any errors occurring during cleanup itself are ignored.
 	cu := cleanup.Make(func() { _ = c.Destroy() })
 	defer cu.Clean()
+	if unlockGroup != nil {
+		// Destroy locks the group, so it must be unlocked before cu runs.
+		defer unlockGroup()
+	}
 
 	// Lock the container metadata file to prevent concurrent creations of
 	// containers with the same id.
@@ -254,7 +296,10 @@ func New(conf *config.Config, args Args) (*Container, error) {
 	//   3. Container type == container: it means this is a subcontainer of an
 	//      already started sandbox. In this case, container ID is different than
 	//      the sandbox ID.
-	if isRoot(args.Spec) {
+	//   4. Container type == sandbox with a sandbox group: if another pod in the
+	//      group already started a sandbox, the pod's sandbox container is
+	//      created as a subcontainer of that sandbox.
+	if sandboxID == args.ID {
 		log.Debugf("Creating new sandbox for container, cid: %s", args.ID)
 
 		if args.Spec.Linux == nil {
@@ -292,6 +337,17 @@ func New(conf *config.Config, args Args) (*Container, error) {
 			return nil, err
 		}
 		c.OverlayMediums = overlayMediums
+		virtiofsFiles, err := connectVirtiofsServers(args.Spec, conf)
+		if err != nil {
+			return nil, err
+		}
+		nfsFiles, err := connectNFSServers(args.Spec)
+		if err != nil {
+			for _, f := range virtiofsFiles {
+				_ = f.Close()
+			}
+			return nil, err
+		}
 		if err := nvProxyPreGoferHostSetup(args.Spec, conf); err != nil {
 			return nil, err
 		}
@@ -315,6 +371,8 @@ func New(conf *config.Config, args Args) (*Container, error) {
 				Attached:              args.Attached,
 				OverlayFilestoreFiles: overlayFilestoreFiles,
 				OverlayMediums:        overlayMediums,
+				VirtiofsFiles:         virtiofsFiles,
+				NFSFiles:              nfsFiles,
 				MountHints:            mountHints,
 				PassFiles:             args.PassFiles,
 				ExecFile:              args.ExecFile,
@@ -323,7 +381,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 				// Expose all Nvidia devices in /dev/, because we don't know what
 				// devices future subcontainers will want.
 				searchDir := "/"
-				if conf.NVProxyDocker {
+				if specutils.NVProxyDockerMode(args.Spec, conf) {
 					// For single-container use cases like Docker, the container rootfs
 					// is populated with the devices that need to be exposed. Scan that.
 					// This scan needs to happen outside the sandbox process because
@@ -444,7 +502,7 @@ func (c *Container) Start(conf *config.Config) error {
 		log.Warningf("StartContainer hook skipped because running inside container namespace is not supported")
 	}
 
-	if isRoot(c.Spec) {
+	if c.IsSandboxRoot() {
 		if err := c.Sandbox.StartRoot(conf); err != nil {
 			return err
 		}
@@ -475,6 +533,25 @@ func (c *Container) Start(conf *config.Config) error {
 			}
 			c.Spec.Mounts = cleanMounts
 
+			virtiofsFiles, err := connectVirtiofsServers(c.Spec, conf)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				for _, f := range virtiofsFiles {
+					_ = f.Close()
+				}
+			}()
+			nfsFiles, err := connectNFSServers(c.Spec)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				for _, f := range nfsFiles {
+					_ = f.Close()
+				}
+			}()
+
 			// Setup stdios if the container is not using terminal. Otherwise TTY was
 			// already setup in create.
 			var stdios []*os.File
@@ -482,10 +559,18 @@ func (c *Container) Start(conf *config.Config) error {
 				stdios = []*os.File{os.Stdin, os.Stdout, os.Stderr}
 			}
 
-			return c.Sandbox.StartSubcontainer(c.Spec, conf, c.ID, stdios, goferFiles, overlayFilestoreFiles, overlayMediums)
+			return c.Sandbox.StartSubcontainer(c.Spec, conf, c.ID, stdios, goferFiles, overlayFilestoreFiles, virtiofsFiles, nfsFiles, overlayMediums)
 		}); err != nil {
 			return err
 		}
+		if c.PodID == c.ID && conf.Network == config.NetworkSandbox {
+			// The pod joined the sandbox of another pod of its sandbox group,
+			// and has its own network namespace in it (see joinSandboxGroup).
+			ns, _ := specutils.GetNS(specs.NetworkNamespace, c.Spec)
+			if err := c.Sandbox.SetupPodNetwork(conf, c.ID, ns.Path); err != nil {
+				return fmt.Errorf("setting up network of pod %q: %w", c.ID, err)
+			}
+		}
 	}
 
 	// "If any poststart hook fails, the runtime MUST log a warning, but
@@ -504,7 +589,7 @@ func (c *Container) Start(conf *config.Config) error {
 	unlock.Clean()
 
 	// Adjust the oom_score_adj for sandbox. This must be done after saveLocked().
-	if err := adjustSandboxOOMScoreAdj(c.Sandbox, c.Spec, c.Saver.RootDir, false); err != nil {
+	if err := adjustSandboxOOMScoreAdj(c.Sandbox, c.IsSandboxRoot(), c.Saver.RootDir, false); err != nil {
 		return err
 	}
 
@@ -516,6 +601,28 @@ func (c *Container) Start(conf *config.Config) error {
 // Restore takes a container and replaces its kernel and file system
 // to restore a container from its state file.
 func (c *Container) Restore(conf *config.Config, restoreFile string) error {
+	rf, err := os.Open(restoreFile)
+	if err != nil {
+		return fmt.Errorf("opening restore file %q failed: %v", restoreFile, err)
+	}
+	defer rf.Close()
+	return c.RestoreFrom(conf, rf)
+}
+
+// RestoreFrom is like Restore, but reads the state from rf, which may be a
+// stream, e.g. a pipe fed from a migration connection.
+func (c *Container) RestoreFrom(conf *config.Config, rf *os.File) error {
+	return c.restore(conf, rf, nil)
+}
+
+// RestoreFromChunkStore is like RestoreFrom, but loads memory contents from
+// the given chunk store. The image must have been saved with
+// CheckpointToChunkStore.
+func (c *Container) RestoreFromChunkStore(conf *config.Config, rf *os.File, chunks *sandbox.ChunkStoreFiles) error {
+	return c.restore(conf, rf, chunks)
+}
+
+func (c *Container) restore(conf *config.Config, rf *os.File, chunks *sandbox.ChunkStoreFiles) error {
 	log.Debugf("Restore container, cid: %s", c.ID)
 	if err := c.Saver.lock(BlockAcquire); err != nil {
 		return err
@@ -532,7 +639,7 @@ func (c *Container) Restore(conf *config.Config, restoreFile string) error {
 		log.Warningf("StartContainer hook skipped because running inside container namespace is not supported")
 	}
 
-	if err := c.Sandbox.Restore(conf, c.ID, restoreFile); err != nil {
+	if err := c.Sandbox.Restore(conf, c.ID, rf, chunks); err != nil {
 		return err
 	}
 	c.changeStatus(Running)
@@ -590,6 +697,38 @@ func (c *Container) Execute(conf *config.Config, args *control.ExecArgs) (int32,
 	return c.Sandbox.Execute(conf, args)
 }
 
+// CreateExecSession makes the terminal of exec'd process pid persistent, so
+// that clients can detach from it and reattach with AttachExecSession. master
+// is the master end of the pty whose replica was passed as the process's
+// stdio.
+func (c *Container) CreateExecSession(pid int32, master *os.File) error {
+	log.Debugf("Create exec session, cid: %s, pid: %d", c.ID, pid)
+	if err := c.requireStatus("create exec session in", Created, Running); err != nil {
+		return err
+	}
+	return c.Sandbox.CreateExecSession(c.ID, pid, master)
+}
+
+// AttachExecSession attaches conn, a connected socket, to the exec session of
+// process pid. Terminal output is written to conn and input read from conn is
+// written to the terminal. Shutting down conn detaches from the session.
+func (c *Container) AttachExecSession(pid int32, conn *os.File) error {
+	log.Debugf("Attach exec session, cid: %s, pid: %d", c.ID, pid)
+	if err := c.requireStatus("attach to exec session in", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.AttachExecSession(c.ID, pid, conn)
+}
+
+// ResizeExecSession changes the window size of the exec session of process
+// pid.
+func (c *Container) ResizeExecSession(pid int32, rows, cols uint16) error {
+	if err := c.requireStatus("resize exec session in", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.ResizeExecSession(c.ID, pid, rows, cols)
+}
+
 // Event returns events for the container.
 func (c *Container) Event() (*boot.EventOut, error) {
 	log.Debugf("Getting events for container, cid: %s", c.ID)
@@ -714,7 +853,18 @@ func (c *Container) Checkpoint(f *os.File, options statefile.Options) error {
 	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
 		return err
 	}
-	return c.Sandbox.Checkpoint(c.ID, f, options)
+	return c.Sandbox.Checkpoint(c.ID, f, options, nil)
+}
+
+// CheckpointToChunkStore is like Checkpoint, but saves memory contents to the
+// given chunk store instead of f. Only chunks that aren't already in the store
+// are written.
+func (c *Container) CheckpointToChunkStore(f *os.File, chunks *sandbox.ChunkStoreFiles, options statefile.Options) error {
+	log.Debugf("Checkpoint container to chunk store, cid: %s", c.ID)
+	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.Checkpoint(c.ID, f, options, chunks)
 }
 
 // Pause suspends the container and its kernel.
@@ -756,6 +906,31 @@ func (c *Container) Resume() error {
 	return c.saveLocked()
 }
 
+// Update applies new resource limits to the container. The root container's
+// limits apply to the whole sandbox. Limits of other containers are enforced
+// by the sentry, which requires --cgroupfs for limits other than the CPU
+// quota.
+func (c *Container) Update(conf *config.Config, res *specs.LinuxResources) error {
+	log.Debugf("Updating container, cid: %s", c.ID)
+	if err := c.Saver.lock(BlockAcquire); err != nil {
+		return err
+	}
+	defer c.Saver.UnlockOrDie()
+
+	if c.Status != Created && c.Status != Running && c.Status != Paused {
+		return fmt.Errorf("cannot update container %q in state %v", c.ID, c.Status)
+	}
+	if !c.IsSandboxRoot() {
+		// Subcontainers share the sandbox's host cgroup, so their limits
+		// can only be enforced by the sentry.
+		return c.Sandbox.UpdateContainer(c.ID, res)
+	}
+	if err := c.Sandbox.Update(conf, res); err != nil {
+		return fmt.Errorf("updating container %q: %v", c.ID, err)
+	}
+	return nil
+}
+
 // State returns the metadata of the container.
 func (c *Container) State() specs.State {
 	return specs.State{
@@ -777,11 +952,38 @@ func (c *Container) Processes() ([]*control.Process, error) {
 	return c.Sandbox.Processes(c.ID)
 }
 
+// MountInfo returns the mount table of the container, in the format of
+// /proc/[pid]/mountinfo.
+func (c *Container) MountInfo() (string, error) {
+	if err := c.requireStatus("get mount info of", Running, Paused); err != nil {
+		return "", err
+	}
+	return c.Sandbox.MountInfo(c.ID)
+}
+
 // Destroy stops all processes and frees all resources associated with the
 // container.
 func (c *Container) Destroy() error {
 	log.Debugf("Destroy container, cid: %s", c.ID)
 
+	// Containers of a pod that shares its sandbox with other pods must be
+	// destroyed along with the pod. This must happen before c is locked.
+	var errs []string
+	if err := c.destroyPodContainers(); err != nil {
+		err = fmt.Errorf("destroying pod containers: %v", err)
+		log.Warningf("%v", err)
+		errs = append(errs, err.Error())
+	}
+
+	if c.SandboxGroup != "" {
+		// Serialize with other containers of the group being created or
+		// destroyed, so that only the last container destroys the sandbox.
+		unlockGroup, err := lockSandboxGroup(c.Saver.RootDir, c.SandboxGroup)
+		if err != nil {
+			return err
+		}
+		defer unlockGroup()
+	}
 	if err := c.Saver.lock(BlockAcquire); err != nil {
 		return err
 	}
@@ -801,7 +1003,6 @@ func (c *Container) Destroy() error {
 	// It's possible for one or more of these steps to fail, but we should
 	// do our best to perform all of the cleanups. Hence, we keep a slice
 	// of errors return their concatenation.
-	var errs []string
 	if err := c.stop(); err != nil {
 		err = fmt.Errorf("stopping container: %v", err)
 		log.Warningf("%v", err)
@@ -832,7 +1033,7 @@ func (c *Container) Destroy() error {
 	// Use 'sb' to tell whether it has been executed before because Destroy must
 	// be idempotent.
 	if sb != nil {
-		if err := adjustSandboxOOMScoreAdj(sb, c.Spec, c.Saver.RootDir, true); err != nil {
+		if err := adjustSandboxOOMScoreAdj(sb, c.IsSandboxRoot(), c.Saver.RootDir, true); err != nil {
 			errs = append(errs, err.Error())
 		}
 	}
@@ -923,6 +1124,96 @@ func (c *Container) createOverlayFilestores(conf config.Overlay2, mountHints *bo
 	return filestoreFiles, overlayMediums, nil
 }
 
+// connectVirtiofsServers connects to the virtio-fs server of each virtiofs
+// mount in the spec. The returned files are in the same order as the mounts.
+func connectVirtiofsServers(spec *specs.Spec, conf *config.Config) ([]*os.File, error) {
+	var files []*os.File
+	for _, m := range spec.Mounts {
+		if !specutils.IsVirtiofsMount(m) {
+			continue
+		}
+		if !conf.Virtiofs {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, fmt.Errorf("virtiofs mount %q requires --virtiofs", m.Destination)
+		}
+		f, err := connectVirtiofsServer(m.Source)
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, fmt.Errorf("connecting to virtio-fs server for mount %q: %w", m.Destination, err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// connectVirtiofsServer connects to the virtio-fs server listening on the Unix
+// domain socket at path. The server speaks the vhost-user protocol, which runs
+// over SOCK_STREAM connections.
+func connectVirtiofsServer(path string) (*os.File, error) {
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("creating socket: %w", err)
+	}
+	if err := unix.Connect(fd, &unix.SockaddrUnix{Name: path}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("connecting to %q: %w", path, err)
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// connectNFSServers connects to the server of each NFS mount in the spec. The
+// returned files are in the same order as the mounts.
+func connectNFSServers(spec *specs.Spec) ([]*os.File, error) {
+	var files []*os.File
+	for _, m := range spec.Mounts {
+		if !specutils.IsNFSMount(m) {
+			continue
+		}
+		f, err := connectNFSServer(m)
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, fmt.Errorf("connecting to NFS server for mount %q: %w", m.Destination, err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// connectNFSServer connects to the server of the NFS mount m. The server
+// address is the host part of the mount source, unless overridden by the
+// "addr" mount option, and the port is 2049, unless overridden by the "port"
+// mount option.
+func connectNFSServer(m specs.Mount) (*os.File, error) {
+	i := strings.Index(m.Source, ":/")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid source %q, want host:/path", m.Source)
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(m.Source[:i], "["), "]")
+	port := "2049"
+	for _, opt := range m.Options {
+		if addr, ok := strings.CutPrefix(opt, "addr="); ok {
+			host = addr
+		} else if p, ok := strings.CutPrefix(opt, "port="); ok {
+			port = p
+		}
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	// File returns a dup of the connection's FD, which is in blocking mode as
+	// required by the sentry.
+	f, err := conn.(*net.TCPConn).File()
+	_ = conn.Close()
+	return f, err
+}
+
 func (c *Container) createOverlayFilestore(conf config.Overlay2, mountSrc string, shouldOverlay bool, hint *boot.MountHint) (*os.File, boot.OverlayMedium, error) {
 	if hint != nil && hint.ShouldOverlay() {
 		// MountHint information takes precedence over shouldOverlay.
@@ -1017,11 +1308,12 @@ func (c *Container) stop() error {
 
 	if c.Sandbox != nil {
 		log.Debugf("Destroying container, cid: %s", c.ID)
-		if err := c.Sandbox.DestroyContainer(c.ID); err != nil {
+		sandboxDestroyed, err := c.destroyInSandbox()
+		if err != nil {
 			return fmt.Errorf("destroying container %q: %v", c.ID, err)
 		}
 		// Only uninstall parentCgroup for sandbox stop.
-		if c.Sandbox.IsRootContainer(c.ID) {
+		if sandboxDestroyed {
 			parentCgroup = c.Sandbox.CgroupJSON.Cgroup
 		}
 		// Only set sandbox to nil after it has been told to destroy the container.
@@ -1133,7 +1425,7 @@ func (c *Container) createGoferProcess(spec *specs.Spec, conf *config.Config, bu
 	cmd.Args = append(cmd.Args, "--overlay-mediums="+c.OverlayMediums.String())
 
 	// Open the spec file to donate to the sandbox.
-	specFile, err := specutils.OpenSpec(bundleDir)
+	specFile, err := specutils.OpenSpecForChild(bundleDir, spec, conf)
 	if err != nil {
 		return nil, nil, fmt.Errorf("opening spec file: %v", err)
 	}
@@ -1328,7 +1620,7 @@ func (c *Container) requireStatus(action string, statuses ...Status) error {
 
 // IsSandboxRoot returns true if this container is its sandbox's root container.
 func (c *Container) IsSandboxRoot() bool {
-	return isRoot(c.Spec)
+	return isRoot(c.Spec) && c.ID == c.sandboxID()
 }
 
 func isRoot(spec *specs.Spec) bool {
@@ -1364,10 +1656,10 @@ func (c *Container) adjustGoferOOMScoreAdj() error {
 // TODO(gvisor.dev/issue/238): This call could race with other containers being
 // created at the same time and end up setting the wrong oom_score_adj to the
 // sandbox. Use rpc client to synchronize.
-func adjustSandboxOOMScoreAdj(s *sandbox.Sandbox, spec *specs.Spec, rootDir string, destroy bool) error {
+func adjustSandboxOOMScoreAdj(s *sandbox.Sandbox, root bool, rootDir string, destroy bool) error {
 	// Adjustment can be skipped if the root container is exiting, because it
 	// brings down the entire sandbox.
-	if isRoot(spec) && destroy {
+	if root && destroy {
 		return nil
 	}
 
@@ -1696,7 +1988,7 @@ func logIDMappings(mappings []specs.LinuxIDMapping, idType string) {
 // This should only be necessary once on the host. It should be run during the
 // root container setup sequence to make sure it has run at least once.
 func nvProxyPreGoferHostSetup(spec *specs.Spec, conf *config.Config) error {
-	if !specutils.GPUFunctionalityRequested(spec, conf) || !conf.NVProxyDocker {
+	if !specutils.GPUFunctionalityRequested(spec, conf) || !specutils.NVProxyDockerMode(spec, conf) {
 		return nil
 	}
 
@@ -1793,7 +2085,7 @@ func nvproxyLoadKernelModules() {
 // construction. For this reason, we don't need to parse
 // NVIDIA_VISIBLE_DEVICES or pass --device to nvidia-container-cli.
 func nvproxySetupAfterGoferUserns(spec *specs.Spec, conf *config.Config, goferCmd *exec.Cmd, goferDonations *donation.Agency) (func() error, error) {
-	if !specutils.GPUFunctionalityRequested(spec, conf) || !conf.NVProxyDocker {
+	if !specutils.GPUFunctionalityRequested(spec, conf) || !specutils.NVProxyDockerMode(spec, conf) {
 		return func() error { return nil }, nil
 	}
 
@@ -3268,3 +3268,61 @@ find $dir -type l -o -type f | sort | xargs cat | md5sum`), 0755); err != nil {
 		}
 	}
 }
+
+// BenchmarkMicroProfileCreate measures the time to create and start a sandbox
+// with the micro boot profile. The first iteration populates the seccomp
+// program cache, which the following ones reuse.
+func BenchmarkMicroProfileCreate(b *testing.B) {
+	flagSet := flag.NewFlagSet("micro", flag.ContinueOnError)
+	config.RegisterFlags(flagSet)
+	conf, err := config.NewFromFlags(flagSet)
+	if err != nil {
+		b.Fatalf("error loading configuration from flags: %v", err)
+	}
+	if err := conf.ApplyBootProfile(flagSet, "micro"); err != nil {
+		b.Fatalf("error applying the micro profile: %v", err)
+	}
+	conf.TestOnlyAllowRunAsCurrentUserWithoutChroot = true
+
+	spec := testutil.NewSpecWithArgs("/bin/true")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		b.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		args := Args{
+			ID:        testutil.RandomContainerID(),
+			Spec:      spec,
+			BundleDir: bundleDir,
+		}
+		c, err := New(conf, args)
+		if err != nil {
+			b.Fatalf("error creating container: %v", err)
+		}
+		if err := c.Start(conf); err != nil {
+			c.Destroy()
+			b.Fatalf("error starting container: %v", err)
+		}
+		b.StopTimer()
+		if ws, err := c.Wait(); err != nil || ws.ExitStatus() != 0 {
+			b.Errorf("container exited with status %v, error: %v", ws, err)
+		}
+		if err := c.Destroy(); err != nil {
+			b.Fatalf("error destroying container: %v", err)
+		}
+		b.StartTimer()
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.Elapsed().Microseconds())/float64(b.N)/1000, "ms/create")
+
+	entries, err := os.ReadDir(filepath.Join(conf.RootDir, "seccomp-cache"))
+	if err != nil {
+		b.Fatalf("error reading the seccomp cache: %v", err)
+	}
+	if len(entries) != 1 {
+		b.Errorf("seccomp cache has %d entries, want 1", len(entries))
+	}
+}
@@ -2522,3 +2522,207 @@ func TestMultiContainerMemoryLeakStress(t *testing.T) {
 		}
 	}
 }
+
+// TestMultiContainerCgroups checks that each container is placed in its own
+// cgroup inside the sandbox, with the limits from its spec.
+func TestMultiContainerCgroups(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	conf.Cgroupfs = true
+
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+	conf.RootDir = rootDir
+
+	sleep := []string{"sleep", "100"}
+	testSpecs, ids := createSpecs(sleep, sleep)
+	const limit = 64 << 20
+	memLimit := int64(limit)
+	if testSpecs[1].Linux == nil {
+		testSpecs[1].Linux = &specs.Linux{}
+	}
+	testSpecs[1].Linux.Resources = &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &memLimit},
+	}
+
+	containers, cleanup, err := startContainers(conf, testSpecs, ids)
+	if err != nil {
+		t.Fatalf("error starting containers: %v", err)
+	}
+	defer cleanup()
+
+	for i, cont := range containers {
+		out, err := executeCombinedOutput(conf, cont, nil, "/bin/cat", "/proc/self/cgroup")
+		if err != nil {
+			t.Fatalf("exec failed: %v", err)
+		}
+		if want := fmt.Sprintf(":memory:/%s\n", ids[i]); !strings.Contains(string(out), want) {
+			t.Errorf("container %d: /proc/self/cgroup got %q, want it to contain %q", i, out, want)
+		}
+	}
+
+	path := fmt.Sprintf("/sys/fs/cgroup/memory/%s/memory.limit_in_bytes", ids[1])
+	out, err := executeCombinedOutput(conf, containers[1], nil, "/bin/cat", path)
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if want := fmt.Sprintf("%d\n", limit); string(out) != want {
+		t.Errorf("%s got %q, want %q", path, out, want)
+	}
+}
+
+// TestSandboxGroup checks that pods in the same sandbox group and tenant share
+// a sandbox, that pods of another tenant or with limits that can't be
+// enforced can't join it, and that pods can be destroyed independently.
+func TestSandboxGroup(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+	conf.SandboxGroups = true
+
+	sleep := []string{"sleep", "100"}
+	podSpec := func(tenant, hostname string, cmds ...[]string) ([]*specs.Spec, []string) {
+		specs, ids := createSpecs(cmds...)
+		specs[0].Annotations[specutils.SandboxGroupAnnotation] = "group"
+		specs[0].Annotations[specutils.ContainerdSandboxNamespaceAnnotation] = tenant
+		specs[0].Hostname = hostname
+		return specs, ids
+	}
+
+	specsA, idsA := podSpec("tenant", "pod-a", sleep, sleep)
+	podA, cleanupA, err := startContainers(conf, specsA, idsA)
+	if err != nil {
+		t.Fatalf("error starting pod A: %v", err)
+	}
+	defer cleanupA()
+
+	specsB, idsB := podSpec("tenant", "pod-b", sleep, sleep)
+	podB, cleanupB, err := startContainers(conf, specsB, idsB)
+	if err != nil {
+		t.Fatalf("error starting pod B: %v", err)
+	}
+	defer cleanupB()
+
+	for _, c := range podB {
+		if got, want := c.Sandbox.ID, podA[0].Sandbox.ID; got != want {
+			t.Errorf("container %q of pod B runs in sandbox %q, want %q", c.ID, got, want)
+		}
+	}
+
+	// Pods joining the sandbox have a UTS namespace of their own.
+	execMany(t, conf, []execDesc{
+		{
+			c:    podA[1],
+			cmd:  []string{"/bin/sh", "-c", `test "$(hostname)" = pod-a`},
+			name: "hostname-pod-a",
+		},
+		{
+			c:    podB[1],
+			cmd:  []string{"/bin/sh", "-c", `test "$(hostname)" = pod-b`},
+			name: "hostname-pod-b",
+		},
+	})
+
+	// A pod of another tenant can't join the group.
+	specsC, idsC := podSpec("other-tenant", "pod-c", sleep)
+	bundleDir, cleanupC, err := testutil.SetupBundleDir(specsC[0])
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanupC()
+	if c, err := New(conf, Args{ID: idsC[0], Spec: specsC[0], BundleDir: bundleDir}); err == nil {
+		c.Destroy()
+		t.Errorf("pod of another tenant joined the sandbox group")
+	} else if !strings.Contains(err.Error(), "can't join sandbox group") {
+		t.Errorf("creating pod of another tenant: got error %v, want tenant mismatch", err)
+	}
+
+	// A pod with resource limits can't join the group without --cgroupfs,
+	// which enforces the limits of the pod.
+	specsD, idsD := podSpec("tenant", "pod-d", sleep)
+	specsD[0].Annotations[specutils.ContainerdSandboxMemoryAnnotation] = "268435456"
+	bundleDir, cleanupD, err := testutil.SetupBundleDir(specsD[0])
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanupD()
+	if c, err := New(conf, Args{ID: idsD[0], Spec: specsD[0], BundleDir: bundleDir}); err == nil {
+		c.Destroy()
+		t.Errorf("pod with resource limits joined the sandbox group without --cgroupfs")
+	} else if !strings.Contains(err.Error(), "--cgroupfs") {
+		t.Errorf("creating pod with resource limits: got error %v, want --cgroupfs required", err)
+	}
+
+	// Destroying the pod that created the sandbox leaves the other pod running.
+	if err := podA[0].Destroy(); err != nil {
+		t.Fatalf("error destroying pod A: %v", err)
+	}
+	for _, c := range podB {
+		if _, err := c.executeSync(conf, &control.ExecArgs{Argv: []string{"/bin/true"}}); err != nil {
+			t.Errorf("exec in container %q of pod B after destroying pod A: %v", c.ID, err)
+		}
+	}
+}
+
+// TestSandboxGroupCgroups checks that the containers of a pod that joined a
+// sandbox are placed under a cgroup of the pod, with the pod's limits.
+func TestSandboxGroupCgroups(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+	conf.SandboxGroups = true
+	conf.Cgroupfs = true
+
+	sleep := []string{"sleep", "100"}
+	podSpec := func(cmds ...[]string) ([]*specs.Spec, []string) {
+		specs, ids := createSpecs(cmds...)
+		specs[0].Annotations[specutils.SandboxGroupAnnotation] = "group"
+		specs[0].Annotations[specutils.ContainerdSandboxNamespaceAnnotation] = "tenant"
+		return specs, ids
+	}
+
+	specsA, idsA := podSpec(sleep)
+	_, cleanupA, err := startContainers(conf, specsA, idsA)
+	if err != nil {
+		t.Fatalf("error starting pod A: %v", err)
+	}
+	defer cleanupA()
+
+	const limit = 128 << 20
+	specsB, idsB := podSpec(sleep, sleep)
+	specsB[0].Annotations[specutils.ContainerdSandboxMemoryAnnotation] = fmt.Sprintf("%d", limit)
+	podB, cleanupB, err := startContainers(conf, specsB, idsB)
+	if err != nil {
+		t.Fatalf("error starting pod B: %v", err)
+	}
+	defer cleanupB()
+
+	out, err := executeCombinedOutput(conf, podB[1], nil, "/bin/cat", "/proc/self/cgroup")
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if want := fmt.Sprintf(":memory:/%s/%s\n", idsB[0], idsB[1]); !strings.Contains(string(out), want) {
+		t.Errorf("/proc/self/cgroup got %q, want it to contain %q", out, want)
+	}
+
+	path := fmt.Sprintf("/sys/fs/cgroup/memory/%s/memory.limit_in_bytes", idsB[0])
+	out, err = executeCombinedOutput(conf, podB[1], nil, "/bin/cat", path)
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if want := fmt.Sprintf("%d\n", limit); string(out) != want {
+		t.Errorf("%s got %q, want %q", path, out, want)
+	}
+}
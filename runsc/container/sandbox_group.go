@@ -0,0 +1,243 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// Sandbox groups allow multiple pods to share a single sandbox (see
+// --sandbox-groups). The first pod in a group creates the sandbox and becomes
+// its root container. Pods that join later have their sandbox container
+// created as a subcontainer of the shared sandbox, and the remaining
+// containers of the pod follow it there. Inside the sandbox, pods that joined
+// run in UTS, IPC and network namespaces of their own (see
+// boot.podNamespaces). With --network=sandbox, the network namespace of a pod
+// that joined is set up from the host network namespace of the pod's sandbox
+// container, as it's done for the sandbox's root container. Pod-level
+// resource limits are enforced by a cgroup of the pod inside the sandbox,
+// which requires --cgroupfs.
+//
+// All pods in a group must belong to the same tenant, i.e. Kubernetes
+// namespace, since they share a sentry. A pod whose namespace is unknown can't
+// use a sandbox group.
+//
+// Each container of a grouped pod records the pod ID in Container.PodID, so
+// that pods can be torn down independently:
+//   - Destroying a pod's sandbox container destroys the remaining containers
+//     of the pod, but not containers from other pods.
+//   - The sandbox is kept alive while any pod in the group has containers
+//     left, even if the pod that created it is gone. The last container to be
+//     destroyed brings the sandbox down.
+//
+// Creating and destroying the containers of a group is serialized by a lock
+// file per group, so that a pod can't join a sandbox that is going away and
+// concurrent destructions agree on which one is the last. The group lock is
+// acquired before container state files are locked.
+
+// lockSandboxGroup locks the given sandbox group, and returns a function that
+// unlocks it.
+func lockSandboxGroup(rootDir, group string) (func(), error) {
+	// Group names are arbitrary strings; hash them to get a valid file name.
+	sum := sha256.Sum256([]byte(group))
+	f := flock.New(filepath.Join(rootDir, fmt.Sprintf("sandbox-group-%x.lock", sum[:16])))
+	if err := f.Lock(); err != nil {
+		return nil, fmt.Errorf("acquiring lock on sandbox group %q: %v", group, err)
+	}
+	return func() {
+		if err := f.Unlock(); err != nil {
+			log.Warningf("Error releasing lock on sandbox group %q: %v", group, err)
+		}
+		_ = f.Close()
+	}, nil
+}
+
+// joinSandboxGroup returns the ID of the sandbox that the pod with the given
+// sandbox container spec must run in: the sandbox of another pod in the group
+// if there is one, or a new sandbox with the pod's ID otherwise.
+//
+// Preconditions: the sandbox group is locked.
+func joinSandboxGroup(conf *config.Config, podID, group string, spec *specs.Spec) (string, error) {
+	rootDir := conf.RootDir
+	tenant, ok := specutils.SandboxTenant(spec)
+	if !ok {
+		return "", fmt.Errorf("pod %q can't use sandbox group %q because its namespace is unknown, set the %q annotation", podID, group, specutils.ContainerdSandboxNamespaceAnnotation)
+	}
+	other, err := findGroupSandbox(rootDir, group)
+	if err != nil {
+		return "", fmt.Errorf("looking up sandbox group %q: %w", group, err)
+	}
+	if other == nil {
+		return podID, nil
+	}
+	if otherTenant, _ := specutils.SandboxTenant(other.Spec); otherTenant != tenant {
+		return "", fmt.Errorf("pod %q of namespace %q can't join sandbox group %q, which runs pods of namespace %q", podID, tenant, group, otherTenant)
+	}
+	if conf.Network == config.NetworkSandbox {
+		// The pod's network is copied from its own network namespace, which
+		// is only known if the container manager created one.
+		if ns, ok := specutils.GetNS(specs.NetworkNamespace, spec); !ok || ns.Path == "" {
+			return "", fmt.Errorf("pod %q can't join sandbox group %q without a network namespace of its own", podID, group)
+		}
+	}
+	res, err := specutils.PodResources(spec)
+	if err != nil {
+		return "", fmt.Errorf("pod %q: %w", podID, err)
+	}
+	if res != nil && !conf.Cgroupfs {
+		return "", fmt.Errorf("pod %q has resource limits and can only join sandbox group %q with --cgroupfs", podID, group)
+	}
+	log.Infof("Pod %q joining sandbox %q of sandbox group %q", podID, other.sandboxID(), group)
+	return other.sandboxID(), nil
+}
+
+// findGroupSandbox returns the sandbox container of a pod that runs in the
+// sandbox of the given sandbox group, or nil if the group has no sandbox.
+func findGroupSandbox(rootDir, group string) (*Container, error) {
+	ids, err := List(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		c, err := Load(rootDir, id, LoadOpts{Exact: true, SkipCheck: true})
+		if err != nil {
+			// Container file may have raced with deletion, skip it.
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if c.PodID == "" || c.PodID != c.ID || c.SandboxGroup != group {
+			// Only look at the sandbox containers of the group's pods.
+			continue
+		}
+		if !c.IsSandboxRunning() {
+			continue
+		}
+		return c, nil
+	}
+	return nil, nil
+}
+
+// podSandboxID returns the pod ID and sandbox group for a container that
+// belongs to the pod with the given sandbox container ID, and the ID of the
+// sandbox that is running the pod. podID and group are empty if the pod
+// doesn't belong to a sandbox group.
+func podSandboxID(rootDir, podSandboxContainerID string) (podID, group, sandboxID string, err error) {
+	pod, err := Load(rootDir, FullID{ContainerID: podSandboxContainerID}, LoadOpts{SkipCheck: true})
+	if err != nil {
+		return "", "", "", fmt.Errorf("cannot load pod sandbox container %q: %w", podSandboxContainerID, err)
+	}
+	return pod.PodID, pod.SandboxGroup, pod.sandboxID(), nil
+}
+
+// destroyInSandbox asks the sandbox to destroy the container. It returns true
+// if the sandbox itself was destroyed as a result.
+//
+// Preconditions: c's sandbox group, if any, is locked.
+func (c *Container) destroyInSandbox() (bool, error) {
+	if c.PodID == "" {
+		return c.Sandbox.IsRootContainer(c.ID), c.Sandbox.DestroyContainer(c.ID)
+	}
+
+	others, err := c.sandboxSiblings()
+	if err != nil {
+		return false, err
+	}
+	if c.Sandbox.IsRootContainer(c.ID) {
+		if len(others) > 0 {
+			// The root container's init process is the sandbox's init; stopping
+			// it would bring down every pod in the group. It's the pod's
+			// infrastructure (pause) container, so leave it around until the
+			// last container in the sandbox is gone.
+			log.Infof("Pod %q stopped, keeping sandbox %q for %d remaining container(s)", c.PodID, c.sandboxID(), len(others))
+			return false, nil
+		}
+		return true, c.Sandbox.DestroyContainer(c.ID)
+	}
+
+	if err := c.Sandbox.DestroyContainer(c.ID); err != nil {
+		return false, err
+	}
+	if len(others) > 0 {
+		return false, nil
+	}
+	// This is the last container in the sandbox and the root container is
+	// gone. Destroying the root container destroys the sandbox.
+	log.Infof("Last container in sandbox %q destroyed, destroying sandbox", c.sandboxID())
+	return true, c.Sandbox.DestroyContainer(c.Sandbox.ID)
+}
+
+// destroyPodContainers destroys all other containers that belong to the same
+// pod as c when c is the pod's sandbox container. It's a noop for pods that
+// don't belong to a sandbox group, since destroying the sandbox takes care of
+// them.
+//
+// Preconditions: c's state file must not be locked, as destroying the other
+// containers loads c.
+func (c *Container) destroyPodContainers() error {
+	if c.PodID == "" || c.PodID != c.ID || c.Sandbox == nil {
+		return nil
+	}
+	others, err := c.sandboxSiblings()
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		if other.PodID != c.PodID {
+			continue
+		}
+		log.Debugf("Destroying container %q of pod %q", other.ID, c.PodID)
+		if err := other.Destroy(); err != nil {
+			return fmt.Errorf("destroying container %q: %w", other.ID, err)
+		}
+	}
+	return nil
+}
+
+// sandboxSiblings returns all containers other than c that are in the same
+// sandbox. It doesn't load c itself, so it's safe to call with c's state file
+// locked.
+func (c *Container) sandboxSiblings() ([]*Container, error) {
+	ids, err := listMatch(c.Saver.RootDir, FullID{SandboxID: c.sandboxID()})
+	if err != nil {
+		return nil, fmt.Errorf("listing sandbox containers: %w", err)
+	}
+	var others []*Container
+	for _, id := range ids {
+		if id.SandboxID != c.sandboxID() || id.ContainerID == c.ID {
+			continue
+		}
+		other, err := Load(c.Saver.RootDir, id, LoadOpts{Exact: true, SkipCheck: true})
+		if err != nil {
+			// Container file may have raced with deletion, skip it.
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("loading container %q: %w", id.ContainerID, err)
+		}
+		others = append(others, other)
+	}
+	return others, nil
+}
@@ -0,0 +1,261 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package controlserver implements an HTTP server that exposes sandbox
+// control operations, so that orchestration systems can manage sandboxes
+// without running a runsc command for each operation.
+package controlserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+)
+
+// httpTimeout is the timeout used for reading requests and writing
+// responses. Checkpoints can take a long time, so it's large. Streaming
+// endpoints clear the write deadline, see startStream.
+const httpTimeout = 10 * time.Minute
+
+// Server is the control server configuration.
+type Server struct {
+	// Config is the runsc configuration. Its RootDir is the root directory
+	// of the sandboxes being controlled.
+	Config *config.Config
+
+	// Address is the address to listen on. If it starts with a path
+	// separator, it is a Unix domain socket path. Otherwise, it is a TCP
+	// address.
+	Address string
+
+	// TokenFile is the path to a file containing the token that clients
+	// must present as an "Authorization: Bearer <token>" header. It is
+	// required when listening on TCP.
+	TokenFile string
+
+	// TLSCert and TLSKey are the PEM certificate and private key presented to
+	// clients. TLS is required when listening on a non-loopback TCP address,
+	// so that the token and requests are not sent in cleartext.
+	TLSCert string
+	TLSKey  string
+
+	// TLSClientCA is the PEM CA certificate used to verify client
+	// certificates. If set, clients must present a certificate signed by it
+	// in addition to the token.
+	TLSClientCA string
+
+	// AllowCheckpoint enables the checkpoint endpoint, which writes files
+	// on the host at client-provided paths.
+	AllowCheckpoint bool
+}
+
+// controlServer implements the control server.
+type controlServer struct {
+	rootDir         string
+	conf            *config.Config
+	token           []byte
+	allowCheckpoint bool
+}
+
+// Run runs the control server until it receives SIGINT or SIGTERM.
+func (s *Server) Run(ctx context.Context) error {
+	if s.Address == "" {
+		return errors.New("control server address not specified")
+	}
+	c := &controlServer{
+		rootDir:         s.Config.RootDir,
+		conf:            s.Config,
+		allowCheckpoint: s.AllowCheckpoint,
+	}
+	isUDS := strings.HasPrefix(s.Address, string(os.PathSeparator))
+	if s.TokenFile != "" {
+		token, err := os.ReadFile(s.TokenFile)
+		if err != nil {
+			return fmt.Errorf("reading token file: %w", err)
+		}
+		c.token = []byte(strings.TrimSpace(string(token)))
+		if len(c.token) == 0 {
+			return fmt.Errorf("token file %q is empty", s.TokenFile)
+		}
+	} else if !isUDS {
+		return errors.New("a token file is required when listening on a TCP address")
+	}
+	if _, err := os.ReadDir(c.rootDir); err != nil {
+		return fmt.Errorf("invalid root directory %q: %w", c.rootDir, err)
+	}
+
+	listener, err := s.listen(ctx, isUDS)
+	if err != nil {
+		return err
+	}
+	if isUDS {
+		defer os.Remove(s.Address)
+	}
+
+	srv := http.Server{
+		Handler:      c.handler(),
+		ReadTimeout:  httpTimeout,
+		WriteTimeout: httpTimeout,
+	}
+	shutdownCh := make(chan os.Signal, 1)
+	signal.Notify(shutdownCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-shutdownCh
+		log.Infof("Received %v, shutting down.", sig)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Infof("Control server serving on %s for root directory %s.", s.Address, c.rootDir)
+	if err := srv.Serve(listener); err != http.ErrServerClosed {
+		return fmt.Errorf("cannot serve on address %s: %w", s.Address, err)
+	}
+	return nil
+}
+
+// listen returns a listener for s.Address.
+func (s *Server) listen(ctx context.Context, isUDS bool) (net.Listener, error) {
+	if isUDS {
+		if s.TLSCert != "" || s.TLSKey != "" || s.TLSClientCA != "" {
+			return nil, errors.New("TLS is not supported on unix domain sockets")
+		}
+		// Only the owner can control sandboxes through the socket. Create it
+		// with a restrictive umask rather than changing its mode afterwards,
+		// so that there is no window during which others can connect.
+		oldMask := unix.Umask(0077)
+		listener, err := (&net.ListenConfig{}).Listen(ctx, "unix", s.Address)
+		unix.Umask(oldMask)
+		if err != nil {
+			return nil, fmt.Errorf("cannot listen on unix domain socket %q: %w", s.Address, err)
+		}
+		return listener, nil
+	}
+
+	tlsConf, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf == nil {
+		loopback, err := isLoopback(s.Address)
+		if err != nil {
+			return nil, err
+		}
+		if !loopback {
+			return nil, fmt.Errorf("TLS is required when listening on non-loopback address %q, set -tls-cert and -tls-key", s.Address)
+		}
+	}
+	if strings.HasPrefix(s.Address, ":") {
+		log.Warningf("Binding on all interfaces. Anyone with the token will be able to control all sandboxes on this machine!")
+	}
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on TCP address %q: %w", s.Address, err)
+	}
+	if tlsConf != nil {
+		listener = tls.NewListener(listener, tlsConf)
+	}
+	return listener, nil
+}
+
+// tlsConfig returns the TLS configuration for TCP listeners, or nil if TLS
+// is not configured.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if s.TLSCert == "" && s.TLSKey == "" && s.TLSClientCA == "" {
+		return nil, nil
+	}
+	if s.TLSCert == "" || s.TLSKey == "" {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(s.TLSCert, s.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+	}
+	if s.TLSClientCA != "" {
+		caPEM, err := os.ReadFile(s.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %q", s.TLSClientCA)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+// isLoopback returns true if the TCP address addr only accepts connections
+// from the local host.
+func isLoopback(addr string) (bool, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false, fmt.Errorf("invalid TCP address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return true, nil
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback(), nil
+}
+
+// handler returns the HTTP handler for all endpoints.
+func (c *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/containers", c.serveList)
+	mux.HandleFunc("/v1/containers/", c.serveContainer)
+	return c.authenticate(mux)
+}
+
+// authenticate wraps h to reject requests that don't carry the token.
+func (c *controlServer) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if c.token != nil {
+			got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), c.token) != 1 {
+				log.Warningf("Request: %s %s: unauthenticated request from %s", req.Method, req.URL.Path, req.RemoteAddr)
+				writeError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+				return
+			}
+		}
+		log.Infof("Request: %s %s", req.Method, req.URL.Path)
+		h.ServeHTTP(w, req)
+	})
+}
+
+// loadContainer loads the container with the given ID, which may be a
+// prefix of the full ID.
+func (c *controlServer) loadContainer(id string) (*container.Container, error) {
+	return container.Load(c.rootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+}
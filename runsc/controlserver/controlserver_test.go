@@ -0,0 +1,329 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controlserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/runsc/cgroup"
+)
+
+func TestAuthenticate(t *testing.T) {
+	c := &controlServer{
+		rootDir: t.TempDir(),
+		token:   []byte("secret"),
+	}
+	h := c.handler()
+	for _, tc := range []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{name: "missing", wantCode: http.StatusUnauthorized},
+		{name: "wrong", header: "Bearer wrong", wantCode: http.StatusUnauthorized},
+		{name: "no scheme", header: "secret", wantCode: http.StatusUnauthorized},
+		{name: "valid", header: "Bearer secret", wantCode: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/containers", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.wantCode {
+				t.Errorf("got code %d, want %d: %s", rec.Code, tc.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key to
+// dir, and returns their paths along with the certificate.
+func writeTestCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return certPath, keyPath, cert
+}
+
+func TestListenTCP(t *testing.T) {
+	certPath, keyPath, _ := writeTestCert(t, t.TempDir())
+	for _, tc := range []struct {
+		name    string
+		server  Server
+		wantErr bool
+	}{
+		{name: "loopback", server: Server{Address: "127.0.0.1:0"}},
+		{name: "localhost", server: Server{Address: "localhost:0"}},
+		{name: "all interfaces", server: Server{Address: ":0"}, wantErr: true},
+		{name: "unspecified", server: Server{Address: "0.0.0.0:0"}, wantErr: true},
+		{name: "all interfaces with TLS", server: Server{Address: ":0", TLSCert: certPath, TLSKey: keyPath}},
+		{name: "cert without key", server: Server{Address: "127.0.0.1:0", TLSCert: certPath}, wantErr: true},
+		{name: "client CA without cert", server: Server{Address: "127.0.0.1:0", TLSClientCA: certPath}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := tc.server.listen(context.Background(), false /* isUDS */)
+			if tc.wantErr {
+				if err == nil {
+					l.Close()
+					t.Fatalf("listen(%q) succeeded, want error", tc.server.Address)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("listen(%q): %v", tc.server.Address, err)
+			}
+			l.Close()
+		})
+	}
+}
+
+func TestListenTLS(t *testing.T) {
+	certPath, keyPath, cert := writeTestCert(t, t.TempDir())
+	s := Server{Address: "127.0.0.1:0", TLSCert: certPath, TLSKey: keyPath}
+	l, err := s.listen(context.Background(), false /* isUDS */)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	srv := http.Server{Handler: (&controlServer{rootDir: t.TempDir()}).handler()}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + l.Addr().String() + "/v1/containers")
+	if err != nil {
+		t.Fatalf("GET over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// Plain HTTP must not be served.
+	if resp, err := http.Get("http://" + l.Addr().String() + "/v1/containers"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("GET over plain HTTP succeeded")
+		}
+	}
+}
+
+func TestListenUDSMode(t *testing.T) {
+	s := Server{Address: filepath.Join(t.TempDir(), "control.sock")}
+	l, err := s.listen(context.Background(), true /* isUDS */)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	fi, err := os.Stat(s.Address)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("socket mode is %#o, want no group or other permissions", perm)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	c := &controlServer{rootDir: t.TempDir()}
+	h := c.handler()
+	for _, tc := range []struct {
+		method   string
+		path     string
+		wantCode int
+	}{
+		{method: http.MethodGet, path: "/v1/containers", wantCode: http.StatusOK},
+		{method: http.MethodPost, path: "/v1/containers", wantCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/v1/containers/", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/v1/containers/foo/bar", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/v1/containers/foo/ps/extra", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/v1/containers/foo/signal", wantCode: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/v1/containers/foo/ps", wantCode: http.StatusMethodNotAllowed},
+		// Valid operations on a container that doesn't exist.
+		{method: http.MethodGet, path: "/v1/containers/foo", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/v1/containers/foo/ps", wantCode: http.StatusNotFound},
+		{method: http.MethodPost, path: "/v1/containers/foo/pause", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/v1/containers/foo/pressure", wantCode: http.StatusNotFound},
+		{method: http.MethodPost, path: "/v1/containers/foo/reclaim", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/v1/containers/foo/update", wantCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/unknown", wantCode: http.StatusNotFound},
+	} {
+		t.Run(tc.method+tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, strings.NewReader("{}")))
+			if rec.Code != tc.wantCode {
+				t.Errorf("got code %d, want %d: %s", rec.Code, tc.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	const (
+		writeTimeout = 50 * time.Millisecond
+		events       = 5
+	)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rc, err := startStream(w, "application/x-ndjson")
+		if err != nil {
+			t.Errorf("startStream: %v", err)
+			return
+		}
+		for i := 0; i < events; i++ {
+			time.Sleep(writeTimeout / 2)
+			w.Write([]byte("{}\n"))
+			if err := rc.Flush(); err != nil {
+				t.Errorf("Flush: %v", err)
+				return
+			}
+		}
+	}))
+	srv.Config.WriteTimeout = writeTimeout
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.Header.Get("Content-Type"), "application/x-ndjson"; got != want {
+		t.Errorf("got Content-Type %q, want %q", got, want)
+	}
+	got := 0
+	for s := bufio.NewScanner(resp.Body); s.Scan(); {
+		got++
+	}
+	if got != events {
+		t.Errorf("got %d events, want %d", got, events)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    unix.Signal
+		wantErr bool
+	}{
+		{in: "SIGTERM", want: unix.SIGTERM},
+		{in: "term", want: unix.SIGTERM},
+		{in: "KILL", want: unix.SIGKILL},
+		{in: "9", want: unix.SIGKILL},
+		{in: "", wantErr: true},
+		{in: "SIGFOO", wantErr: true},
+		{in: "1000", wantErr: true},
+	} {
+		got, err := parseSignal(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseSignal(%q) = %v, want error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseSignal(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestParsePressureTrigger(t *testing.T) {
+	for _, tc := range []struct {
+		query   string
+		want    cgroup.PressureTrigger
+		wantErr bool
+	}{
+		{
+			query: "watch=memory",
+			want:  cgroup.PressureTrigger{Resource: cgroup.PressureMemory, Stall: 100 * time.Millisecond, Window: 2 * time.Second},
+		},
+		{
+			query: "watch=cpu&stall=1s&window=4s&full=true",
+			want:  cgroup.PressureTrigger{Resource: cgroup.PressureCPU, Full: true, Stall: time.Second, Window: 4 * time.Second},
+		},
+		{query: "watch=disk", wantErr: true},
+		{query: "watch=io&stall=forever", wantErr: true},
+		{query: "watch=io&window=1m", wantErr: true},
+		{query: "watch=io&full=maybe", wantErr: true},
+	} {
+		query, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) failed: %v", tc.query, err)
+		}
+		got, err := parsePressureTrigger(query)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parsePressureTrigger(%q) = %+v, want error", tc.query, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parsePressureTrigger(%q) = %+v, %v, want %+v", tc.query, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controlserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/runsc/cgroup"
+	"gvisor.dev/gvisor/runsc/container"
+)
+
+// checkpointFileName is the name of the checkpoint image file, matching
+// "runsc checkpoint".
+const checkpointFileName = "checkpoint.img"
+
+// maxRequestSize is the maximum size of a request body.
+const maxRequestSize = 64 << 10
+
+// ContainerInfo describes a container in the list endpoint response.
+type ContainerInfo struct {
+	ID        string `json:"id"`
+	SandboxID string `json:"sandbox_id"`
+	Status    string `json:"status"`
+	PID       int    `json:"pid"`
+}
+
+// SignalRequest is the body of a signal request.
+type SignalRequest struct {
+	// Signal is the signal name (e.g. "SIGTERM" or "TERM") or number.
+	Signal string `json:"signal"`
+	// All sends the signal to all processes in the container.
+	All bool `json:"all"`
+	// PID, if non-zero, is the PID of the process to signal, in the
+	// container's PID namespace. It can't be used with All.
+	PID int32 `json:"pid"`
+}
+
+// CheckpointRequest is the body of a checkpoint request.
+type CheckpointRequest struct {
+	// ImagePath is the host directory where the checkpoint image is saved.
+	ImagePath string `json:"image_path"`
+	// Compression is the image compression, as in "runsc checkpoint
+	// -compression". Defaults to "flate-best-speed".
+	Compression string `json:"compression"`
+}
+
+// ReclaimRequest is the body of a reclaim request.
+type ReclaimRequest struct {
+	// PageOut also pages out all of the sandbox's allocated memory, so that
+	// the host can reclaim it immediately, e.g. to swap.
+	PageOut bool `json:"page_out"`
+	// SkipGC skips garbage collection in the sentry, which may take a while.
+	SkipGC bool `json:"skip_gc"`
+}
+
+// PressureEvent is sent by the pressure endpoint each time a watched
+// pressure trigger fires.
+type PressureEvent struct {
+	Time     time.Time               `json:"time"`
+	Resource cgroup.PressureResource `json:"resource"`
+	Pressure *cgroup.Pressure        `json:"pressure"`
+}
+
+// errorResponse is the body of all error responses.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warningf("Writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(errorResponse{Error: err.Error()}); err != nil {
+		log.Warningf("Writing error response: %v", err)
+	}
+}
+
+func readJSON(req *http.Request, v any) error {
+	dec := json.NewDecoder(io.LimitReader(req.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// serveList serves GET /v1/containers.
+func (c *controlServer) serveList(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+	ids, err := container.List(c.rootDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	infos := make([]ContainerInfo, 0, len(ids))
+	for _, id := range ids {
+		cont, err := container.Load(c.rootDir, id, container.LoadOpts{Exact: true})
+		if err != nil {
+			// The container may have been deleted after it was listed.
+			log.Debugf("Skipping container %v: %v", id, err)
+			continue
+		}
+		infos = append(infos, ContainerInfo{
+			ID:        cont.ID,
+			SandboxID: cont.Sandbox.ID,
+			Status:    string(cont.Status),
+			PID:       cont.SandboxPid(),
+		})
+	}
+	writeJSON(w, infos)
+}
+
+// containerRoute is a per-container endpoint.
+type containerRoute struct {
+	method string
+	serve  func(c *controlServer, w http.ResponseWriter, req *http.Request, cont *container.Container)
+}
+
+// containerRoutes maps the last path component of /v1/containers/<id>/<op>
+// to its endpoint. The empty operation is /v1/containers/<id>.
+var containerRoutes = map[string]containerRoute{
+	"":           {http.MethodGet, (*controlServer).serveState},
+	"events":     {http.MethodGet, (*controlServer).serveEvents},
+	"ps":         {http.MethodGet, (*controlServer).servePS},
+	"stacks":     {http.MethodGet, (*controlServer).serveStacks},
+	"usage":      {http.MethodGet, (*controlServer).serveUsage},
+	"signal":     {http.MethodPost, (*controlServer).serveSignal},
+	"pause":      {http.MethodPost, (*controlServer).servePause},
+	"resume":     {http.MethodPost, (*controlServer).serveResume},
+	"checkpoint": {http.MethodPost, (*controlServer).serveCheckpoint},
+	"pressure":   {http.MethodGet, (*controlServer).servePressure},
+	"reclaim":    {http.MethodPost, (*controlServer).serveReclaim},
+	"update":     {http.MethodPost, (*controlServer).serveUpdate},
+}
+
+// validID matches container IDs accepted by the server. Glob characters are
+// not allowed, since IDs are matched against state file names.
+var validID = regexp.MustCompile(`^[\w+\-\.]+$`)
+
+// parseContainerPath splits /v1/containers/<id>[/<op>] into its components.
+func parseContainerPath(path string) (id, op string, ok bool) {
+	rest := strings.TrimPrefix(path, "/v1/containers/")
+	id, op, _ = strings.Cut(rest, "/")
+	if !validID.MatchString(id) || strings.Contains(op, "/") {
+		return "", "", false
+	}
+	return id, op, true
+}
+
+// serveContainer dispatches requests under /v1/containers/<id>.
+func (c *controlServer) serveContainer(w http.ResponseWriter, req *http.Request) {
+	id, op, ok := parseContainerPath(req.URL.Path)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("path not found"))
+		return
+	}
+	route, ok := containerRoutes[op]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown operation %q", op))
+		return
+	}
+	if req.Method != route.method {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", req.Method))
+		return
+	}
+	cont, err := c.loadContainer(id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, fmt.Errorf("container %q not found", id))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("loading container: %w", err))
+		return
+	}
+	route.serve(c, w, req, cont)
+}
+
+// serveState serves GET /v1/containers/<id>.
+func (c *controlServer) serveState(w http.ResponseWriter, _ *http.Request, cont *container.Container) {
+	writeJSON(w, cont.State())
+}
+
+// serveEvents serves GET /v1/containers/<id>/events.
+func (c *controlServer) serveEvents(w http.ResponseWriter, _ *http.Request, cont *container.Container) {
+	ev, err := cont.Event()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, ev.Event)
+}
+
+// servePS serves GET /v1/containers/<id>/ps.
+func (c *controlServer) servePS(w http.ResponseWriter, _ *http.Request, cont *container.Container) {
+	procs, err := cont.Processes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, procs)
+}
+
+// serveStacks serves GET /v1/containers/<id>/stacks.
+func (c *controlServer) serveStacks(w http.ResponseWriter, _ *http.Request, cont *container.Container) {
+	stacks, err := cont.Sandbox.Stacks()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, stacks)
+}
+
+// serveUsage serves GET /v1/containers/<id>/usage. The "full" query
+// parameter requests a full (slower) memory accounting.
+func (c *controlServer) serveUsage(w http.ResponseWriter, req *http.Request, cont *container.Container) {
+	full, _ := strconv.ParseBool(req.URL.Query().Get("full"))
+	usage, err := cont.Sandbox.Usage(full)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, usage)
+}
+
+// parseSignal parses a signal name, with or without the "SIG" prefix, or
+// number.
+func parseSignal(s string) (unix.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		sig := unix.Signal(n)
+		if unix.SignalName(sig) == "" {
+			return -1, fmt.Errorf("unknown signal %q", s)
+		}
+		return sig, nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if sig := unix.SignalNum(name); sig != 0 {
+		return sig, nil
+	}
+	return -1, fmt.Errorf("unknown signal %q", s)
+}
+
+// serveSignal serves POST /v1/containers/<id>/signal.
+func (c *controlServer) serveSignal(w http.ResponseWriter, req *http.Request, cont *container.Container) {
+	var sr SignalRequest
+	if err := readJSON(req, &sr); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	sig, err := parseSignal(sr.Signal)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if sr.PID != 0 {
+		if sr.All {
+			writeError(w, http.StatusBadRequest, errors.New("all and pid are mutually exclusive"))
+			return
+		}
+		err = cont.SignalProcess(sig, sr.PID)
+	} else {
+		err = cont.SignalContainer(sig, sr.All)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// servePause serves POST /v1/containers/<id>/pause.
+func (c *controlServer) servePause(w http.ResponseWriter, _ *http.Request, cont *container.Container) {
+	if err := cont.Pause(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveResume serves POST /v1/containers/<id>/resume.
+func (c *controlServer) serveResume(w http.ResponseWriter, _ *http.Request, cont *container.Container) {
+	if err := cont.Resume(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveCheckpoint serves POST /v1/containers/<id>/checkpoint. As with
+// "runsc checkpoint", the sandbox exits once the checkpoint is complete.
+func (c *controlServer) serveCheckpoint(w http.ResponseWriter, req *http.Request, cont *container.Container) {
+	if !c.allowCheckpoint {
+		writeError(w, http.StatusForbidden, errors.New("checkpoint is disabled, see -allow-checkpoint"))
+		return
+	}
+	var cr CheckpointRequest
+	if err := readJSON(req, &cr); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !filepath.IsAbs(cr.ImagePath) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("image_path %q must be absolute", cr.ImagePath))
+		return
+	}
+	compression := statefile.CompressionLevelFlateBestSpeed
+	if cr.Compression != "" {
+		var err error
+		if compression, err = statefile.CompressionLevelFromString(cr.Compression); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := os.MkdirAll(cr.ImagePath, 0755); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("making directories at path provided: %w", err))
+		return
+	}
+	fullImagePath := filepath.Join(cr.ImagePath, checkpointFileName)
+	file, err := os.OpenFile(fullImagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+	if err := cont.Checkpoint(file, statefile.Options{Compression: compression}); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("checkpoint failed: %w", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pressureResources are the resources reported by the pressure endpoint.
+var pressureResources = []cgroup.PressureResource{cgroup.PressureCPU, cgroup.PressureMemory, cgroup.PressureIO}
+
+// servePressure serves GET /v1/containers/<id>/pressure, which returns the
+// pressure stall information of the sandbox's cgroup for each resource.
+//
+// If the "watch" query parameter names a resource, it instead streams a
+// PressureEvent, one JSON object per line, each time tasks in the sandbox are
+// stalled on that resource for "stall" within "window" (Go durations,
+// defaulting to 100ms and 2s). "full=true" watches for stalls of all tasks,
+// rather than some. The stream ends when the client disconnects.
+func (c *controlServer) servePressure(w http.ResponseWriter, req *http.Request, cont *container.Container) {
+	query := req.URL.Query()
+	if query.Get("watch") == "" {
+		pressure := make(map[cgroup.PressureResource]*cgroup.Pressure)
+		for _, resource := range pressureResources {
+			p, err := cont.Sandbox.Pressure(resource)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			pressure[resource] = p
+		}
+		writeJSON(w, pressure)
+		return
+	}
+
+	trigger, err := parsePressureTrigger(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rc, err := startStream(w, "application/x-ndjson")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	err = cont.Sandbox.WatchPressure(req.Context(), trigger, func() {
+		p, err := cont.Sandbox.Pressure(trigger.Resource)
+		if err != nil {
+			log.Warningf("Reading %s pressure: %v", trigger.Resource, err)
+			return
+		}
+		if err := enc.Encode(PressureEvent{Time: time.Now(), Resource: trigger.Resource, Pressure: p}); err != nil {
+			log.Warningf("Writing pressure event: %v", err)
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			log.Warningf("Flushing pressure event: %v", err)
+		}
+	})
+	if err != nil && req.Context().Err() == nil {
+		// The status has already been sent, so just log the error.
+		log.Warningf("Watching %s pressure of container %q: %v", trigger.Resource, cont.ID, err)
+	}
+}
+
+// startStream starts a response that streams data until the client
+// disconnects. It clears the write deadline, since the server's write timeout
+// is only meant for unary requests.
+func startStream(w http.ResponseWriter, contentType string) (*http.ResponseController, error) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("streaming is not supported: %w", err)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, fmt.Errorf("streaming is not supported: %w", err)
+	}
+	return rc, nil
+}
+
+// parsePressureTrigger parses the query parameters of a pressure watch
+// request.
+func parsePressureTrigger(query url.Values) (cgroup.PressureTrigger, error) {
+	trigger := cgroup.PressureTrigger{
+		Stall:  100 * time.Millisecond,
+		Window: 2 * time.Second,
+	}
+	var err error
+	if trigger.Resource, err = cgroup.ParsePressureResource(query.Get("watch")); err != nil {
+		return trigger, err
+	}
+	if v := query.Get("stall"); v != "" {
+		if trigger.Stall, err = time.ParseDuration(v); err != nil {
+			return trigger, fmt.Errorf("invalid stall: %w", err)
+		}
+	}
+	if v := query.Get("window"); v != "" {
+		if trigger.Window, err = time.ParseDuration(v); err != nil {
+			return trigger, fmt.Errorf("invalid window: %w", err)
+		}
+	}
+	if v := query.Get("full"); v != "" {
+		if trigger.Full, err = strconv.ParseBool(v); err != nil {
+			return trigger, fmt.Errorf("invalid full: %w", err)
+		}
+	}
+	return trigger, trigger.Validate()
+}
+
+// serveReclaim serves POST /v1/containers/<id>/reclaim, which asks the sentry
+// to release memory, e.g. in response to memory pressure. It returns once
+// memory has been released.
+func (c *controlServer) serveReclaim(w http.ResponseWriter, req *http.Request, cont *container.Container) {
+	var rr ReclaimRequest
+	if err := readJSON(req, &rr); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts := control.UsageReduceOpts{
+		Wait:    true,
+		DoNotGC: rr.SkipGC,
+		PageOut: rr.PageOut,
+	}
+	if err := cont.Sandbox.Reduce(opts); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveUpdate serves POST /v1/containers/<id>/update, which applies new
+// resource limits to the sandbox, as in "runsc update". The body is a
+// LinuxResources object from the OCI runtime spec.
+func (c *controlServer) serveUpdate(w http.ResponseWriter, req *http.Request, cont *container.Container) {
+	var res specs.LinuxResources
+	if err := readJSON(req, &res); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := cont.Update(c.conf, &res); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
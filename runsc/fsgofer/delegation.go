@@ -0,0 +1,223 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// hostDelegator implements lisafs.Delegator using host file leases (see
+// fcntl(2), "Leases"). The host notifies the lease holder with SIGIO when
+// another process opens the file in a conflicting way, and blocks that open
+// until the lease is downgraded or the lease break time expires. Recalls are
+// written to a pipe whose read end is donated to the client.
+type hostDelegator struct {
+	// recallR and recallW are the read and write ends of the pipe on which
+	// recalls are sent to the client. They are immutable.
+	recallR int
+	recallW int
+
+	// sigs receives SIGIO, which is sent when any lease held by the gofer is
+	// being broken.
+	sigs chan os.Signal
+
+	// stop is closed to stop the recall loop.
+	stop chan struct{}
+
+	// done is closed when the recall loop exits.
+	done chan struct{}
+
+	// mu protects leases.
+	mu sync.Mutex
+
+	// leases maps open FDs through which the client holds a delegation to the
+	// corresponding host lease.
+	leases map[*openFDLisa]*hostLease
+}
+
+// hostLease is a lease taken on behalf of the client.
+type hostLease struct {
+	// id identifies the open FD holding the lease to the client.
+	id lisafs.FDID
+
+	// typ is the lease type, F_RDLCK or F_WRLCK.
+	typ uint32
+
+	// recalled is true if the client has been asked to give up the lease.
+	recalled bool
+}
+
+var _ lisafs.Delegator = (*hostDelegator)(nil)
+
+// NewDelegator implements lisafs.DelegatorServerImpl.NewDelegator.
+func (s *LisafsServer) NewDelegator(c *lisafs.Connection) (lisafs.Delegator, error) {
+	if !s.config.HostDelegations {
+		return nil, unix.EOPNOTSUPP
+	}
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_NONBLOCK|unix.O_CLOEXEC); err != nil {
+		return nil, err
+	}
+	d := &hostDelegator{
+		recallR: p[0],
+		recallW: p[1],
+		sigs:    make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		leases:  make(map[*openFDLisa]*hostLease),
+	}
+	signal.Notify(d.sigs, unix.SIGIO)
+	go d.run() // S/R-SAFE: the gofer is not saved.
+	return d, nil
+}
+
+// RecallFD implements lisafs.Delegator.RecallFD.
+func (d *hostDelegator) RecallFD() int {
+	return d.recallR
+}
+
+// Delegate implements lisafs.Delegator.Delegate.
+func (d *hostDelegator) Delegate(impl lisafs.OpenFDImpl, id lisafs.FDID, typ uint32) error {
+	fd := impl.(*openFDLisa)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// The host checks for conflicting opens, and that read leases are only
+	// taken through read-only FDs.
+	if _, err := unix.FcntlInt(uintptr(fd.hostFD), unix.F_SETLEASE, int(typ)); err != nil {
+		return err
+	}
+	fd.delegator = d
+	if typ == unix.F_UNLCK {
+		delete(d.leases, fd)
+		return nil
+	}
+	d.leases[fd] = &hostLease{
+		id:  id,
+		typ: typ,
+	}
+	return nil
+}
+
+// forget is called when fd is closed, which releases its lease.
+func (d *hostDelegator) forget(fd *openFDLisa) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.leases, fd)
+}
+
+// Close implements lisafs.Delegator.Close.
+func (d *hostDelegator) Close() {
+	signal.Stop(d.sigs)
+	close(d.stop)
+	<-d.done
+
+	d.mu.Lock()
+	for fd := range d.leases {
+		if _, err := unix.FcntlInt(uintptr(fd.hostFD), unix.F_SETLEASE, unix.F_UNLCK); err != nil {
+			log.Warningf("Failed to release lease: %v", err)
+		}
+	}
+	d.leases = nil
+	d.mu.Unlock()
+
+	_ = unix.Close(d.recallR)
+	_ = unix.Close(d.recallW)
+}
+
+// run sends recalls until Close is called.
+func (d *hostDelegator) run() {
+	defer close(d.done)
+	for {
+		select {
+		case <-d.sigs:
+			d.recall()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// leaseRank orders lease types by the access that they grant.
+func leaseRank(typ uint32) int {
+	switch typ {
+	case unix.F_WRLCK:
+		return 2
+	case unix.F_RDLCK:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// recall sends recalls for the leases that the host is breaking. SIGIO
+// doesn't identify the lease, so all leases are checked.
+func (d *hostDelegator) recall() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for fd, l := range d.leases {
+		if l.recalled {
+			continue
+		}
+		// While a lease is being broken, F_GETLEASE returns the type that it
+		// is being downgraded to.
+		target, err := unix.FcntlInt(uintptr(fd.hostFD), unix.F_GETLEASE, 0)
+		if err != nil {
+			log.Warningf("Failed to get lease: %v", err)
+			continue
+		}
+		if leaseRank(uint32(target)) >= leaseRank(l.typ) {
+			continue
+		}
+		if !d.send(l.id, uint32(target)) {
+			// Retried on the next signal. The host breaks the lease by itself
+			// once the lease break time expires.
+			continue
+		}
+		if l.typ == unix.F_RDLCK {
+			// The client has no cached writes to flush, so release the lease
+			// right away instead of delaying the opener until the client
+			// returns it.
+			if _, err := unix.FcntlInt(uintptr(fd.hostFD), unix.F_SETLEASE, unix.F_UNLCK); err != nil {
+				log.Warningf("Failed to release lease: %v", err)
+			}
+			delete(d.leases, fd)
+			continue
+		}
+		l.recalled = true
+	}
+}
+
+// send writes a recall to the recall pipe. Recalls are smaller than
+// PIPE_BUF, so writes are atomic. send returns true if the recall was
+// written.
+func (d *hostDelegator) send(id lisafs.FDID, typ uint32) bool {
+	r := lisafs.DelegationRecall{
+		FD:   id,
+		Type: typ,
+	}
+	buf := make([]byte, r.SizeBytes())
+	r.MarshalUnsafe(buf)
+	if _, err := unix.Write(d.recallW, buf); err != nil {
+		log.Warningf("Writing delegation recall failed: %v", err)
+		return false
+	}
+	return true
+}
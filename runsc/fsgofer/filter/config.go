@@ -235,3 +235,41 @@ var xattrSyscalls = seccomp.SyscallRules{
 	unix.SYS_FGETXATTR: seccomp.MatchAll{},
 	unix.SYS_FSETXATTR: seccomp.MatchAll{},
 }
+
+var inotifySyscalls = seccomp.SyscallRules{
+	unix.SYS_FCHDIR:            seccomp.MatchAll{},
+	unix.SYS_INOTIFY_ADD_WATCH: seccomp.MatchAll{},
+	unix.SYS_INOTIFY_INIT1: seccomp.PerArg{
+		seccomp.EqualTo(unix.IN_NONBLOCK | unix.IN_CLOEXEC),
+	},
+	unix.SYS_INOTIFY_RM_WATCH: seccomp.MatchAll{},
+	unix.SYS_PIPE2: seccomp.PerArg{
+		seccomp.AnyValue{},
+		seccomp.EqualTo(unix.O_NONBLOCK | unix.O_CLOEXEC),
+	},
+}
+
+var lockSyscalls = seccomp.SyscallRules{
+	unix.SYS_FCNTL: seccomp.PerArg{
+		seccomp.AnyValue{},
+		seccomp.EqualTo(unix.F_OFD_SETLK),
+	},
+	unix.SYS_FLOCK: seccomp.MatchAll{},
+}
+
+var delegationSyscalls = seccomp.SyscallRules{
+	unix.SYS_FCNTL: seccomp.Or{
+		seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(unix.F_GETLEASE),
+		},
+		seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(unix.F_SETLEASE),
+		},
+	},
+	unix.SYS_PIPE2: seccomp.PerArg{
+		seccomp.AnyValue{},
+		seccomp.EqualTo(unix.O_NONBLOCK | unix.O_CLOEXEC),
+	},
+}
@@ -24,9 +24,12 @@ import (
 
 // Options are seccomp filter related options.
 type Options struct {
-	UDSOpenEnabled   bool
-	UDSCreateEnabled bool
-	ProfileEnabled   bool
+	UDSOpenEnabled     bool
+	UDSCreateEnabled   bool
+	ProfileEnabled     bool
+	InotifyEnabled     bool
+	LocksEnabled       bool
+	DelegationsEnabled bool
 }
 
 // Install installs seccomp filters.
@@ -49,6 +52,21 @@ func Install(opt Options) error {
 		}
 	}
 
+	if opt.InotifyEnabled {
+		report("host inotify enabled: syscall filters less restrictive!")
+		s.Merge(inotifySyscalls)
+	}
+
+	if opt.LocksEnabled {
+		report("host file locks enabled: syscall filters less restrictive!")
+		s.Merge(lockSyscalls)
+	}
+
+	if opt.DelegationsEnabled {
+		report("host delegations enabled: syscall filters less restrictive!")
+		s.Merge(delegationSyscalls)
+	}
+
 	// Set of additional filters used by -race and -msan. Returns empty
 	// when not enabled.
 	s.Merge(instrumentationFilters())
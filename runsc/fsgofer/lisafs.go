@@ -63,6 +63,18 @@ type Config struct {
 	// DonateMountPointFD indicates whether a host FD to the mount point should
 	// be donated to the client on Mount RPC.
 	DonateMountPointFD bool
+
+	// HostInotify indicates whether inotify events for changes made on the
+	// host are forwarded to the client.
+	HostInotify bool
+
+	// HostFileLocks indicates whether clients can take advisory locks on host
+	// files.
+	HostFileLocks bool
+
+	// HostDelegations indicates whether clients can hold delegations on host
+	// files, which are backed by host file leases.
+	HostDelegations bool
 }
 
 var procSelfFD *rwfd.FD
@@ -85,6 +97,8 @@ type LisafsServer struct {
 }
 
 var _ lisafs.ServerImpl = (*LisafsServer)(nil)
+var _ lisafs.NotifierServerImpl = (*LisafsServer)(nil)
+var _ lisafs.DelegatorServerImpl = (*LisafsServer)(nil)
 
 // NewLisafsServer initializes a new lisafs server for fsgofer.
 func NewLisafsServer(config Config) *LisafsServer {
@@ -148,7 +162,7 @@ func (s *LisafsServer) MaxMessageSize() uint32 {
 // SupportedMessages implements lisafs.ServerImpl.SupportedMessages.
 func (s *LisafsServer) SupportedMessages() []lisafs.MID {
 	// Note that Flush, FListXattr and FRemoveXattr are not supported.
-	return []lisafs.MID{
+	supported := []lisafs.MID{
 		lisafs.Mount,
 		lisafs.Channel,
 		lisafs.FStat,
@@ -178,6 +192,16 @@ func (s *LisafsServer) SupportedMessages() []lisafs.MID {
 		lisafs.Listen,
 		lisafs.Accept,
 	}
+	if s.config.HostInotify {
+		supported = append(supported, lisafs.InotifyInit, lisafs.InotifyAddWatch, lisafs.InotifyRmWatch)
+	}
+	if s.config.HostFileLocks {
+		supported = append(supported, lisafs.SetLock)
+	}
+	if s.config.HostDelegations {
+		supported = append(supported, lisafs.DelegationInit, lisafs.Delegate)
+	}
+	return supported
 }
 
 // controlFDLisa implements lisafs.ControlFDImpl.
@@ -925,6 +949,10 @@ type openFDLisa struct {
 
 	// hostFD is the host file descriptor which can be used to make syscalls.
 	hostFD int
+
+	// delegator is the hostDelegator through which the client has held a
+	// delegation on this FD, if any.
+	delegator *hostDelegator
 }
 
 var _ lisafs.OpenFDImpl = (*openFDLisa)(nil)
@@ -947,6 +975,9 @@ func (fd *openFDLisa) FD() *lisafs.OpenFD {
 
 // Close implements lisafs.OpenFDImpl.Close.
 func (fd *openFDLisa) Close() {
+	if fd.delegator != nil {
+		fd.delegator.forget(fd)
+	}
 	if fd.hostFD >= 0 {
 		_ = unix.Close(fd.hostFD)
 		fd.hostFD = -1
@@ -985,6 +1016,34 @@ func (fd *openFDLisa) Allocate(mode, off, length uint64) error {
 	return unix.Fallocate(fd.hostFD, uint32(mode), int64(off), int64(length))
 }
 
+// SetLock implements lisafs.OpenFDImpl.SetLock.
+func (fd *openFDLisa) SetLock(kind, typ uint32, start, length uint64) error {
+	if kind == lisafs.LockKindBSD {
+		var how int
+		switch typ {
+		case unix.F_RDLCK:
+			how = unix.LOCK_SH
+		case unix.F_WRLCK:
+			how = unix.LOCK_EX
+		default:
+			how = unix.LOCK_UN
+		}
+		return unix.Flock(fd.hostFD, how|unix.LOCK_NB)
+	}
+	if start > math.MaxInt64 || length > math.MaxInt64 {
+		return unix.EINVAL
+	}
+	// OFD locks are owned by the open file description, which is not shared
+	// with other clients, unlike process-associated POSIX locks.
+	flock := unix.Flock_t{
+		Type:   int16(typ),
+		Whence: unix.SEEK_SET,
+		Start:  int64(start),
+		Len:    int64(length),
+	}
+	return unix.FcntlFlock(uintptr(fd.hostFD), unix.F_OFD_SETLK, &flock)
+}
+
 // Flush implements lisafs.OpenFDImpl.Flush.
 func (fd *openFDLisa) Flush() error {
 	return nil
@@ -0,0 +1,244 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// hostWatchMask is the set of inotify_add_watch(2) flags that clients may
+// request. IN_DONT_FOLLOW is not allowed because watches are added through
+// /proc/self/fd magic links, which must be followed.
+const hostWatchMask = unix.IN_ALL_EVENTS | unix.IN_EXCL_UNLINK | unix.IN_ONLYDIR
+
+// addWatchMu serializes AddWatch calls, which change the working directory of
+// the gofer.
+var addWatchMu sync.Mutex
+
+// hostNotifier implements lisafs.Notifier using a host inotify instance. A
+// goroutine reads host events, translates them and writes them to a pipe whose
+// read end is donated to the client.
+type hostNotifier struct {
+	// inotifyFD is the host inotify instance. It is immutable.
+	inotifyFD int
+
+	// eventR and eventW are the read and write ends of the pipe on which
+	// events are sent to the client. They are immutable.
+	eventR int
+	eventW int
+
+	// stopFD is an eventfd used to stop the event loop. It is immutable.
+	stopFD int
+
+	// done is closed when the event loop exits.
+	done chan struct{}
+
+	// overflow is true if events have been dropped since the last
+	// IN_Q_OVERFLOW event was sent. It is only accessed by the event loop.
+	overflow bool
+}
+
+var _ lisafs.Notifier = (*hostNotifier)(nil)
+
+// NewNotifier implements lisafs.NotifierServerImpl.NewNotifier.
+func (s *LisafsServer) NewNotifier(c *lisafs.Connection) (lisafs.Notifier, error) {
+	if !s.config.HostInotify {
+		return nil, unix.EOPNOTSUPP
+	}
+	inotifyFD, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_NONBLOCK|unix.O_CLOEXEC); err != nil {
+		_ = unix.Close(inotifyFD)
+		return nil, err
+	}
+	stopFD, err := unix.Eventfd(0, 0)
+	if err != nil {
+		_ = unix.Close(inotifyFD)
+		_ = unix.Close(p[0])
+		_ = unix.Close(p[1])
+		return nil, err
+	}
+	n := &hostNotifier{
+		inotifyFD: inotifyFD,
+		eventR:    p[0],
+		eventW:    p[1],
+		stopFD:    stopFD,
+		done:      make(chan struct{}),
+	}
+	go n.run() // S/R-SAFE: the gofer is not saved.
+	return n, nil
+}
+
+// EventFD implements lisafs.Notifier.EventFD.
+func (n *hostNotifier) EventFD() int {
+	return n.eventR
+}
+
+// AddWatch implements lisafs.Notifier.AddWatch.
+func (n *hostNotifier) AddWatch(fd lisafs.ControlFDImpl, path lisafs.StringArray, mask uint32) (int32, error) {
+	if mask&^hostWatchMask != 0 || mask&unix.IN_ALL_EVENTS == 0 {
+		return -1, unix.EINVAL
+	}
+
+	// Walk path without following symlinks, as in WalkStat.
+	hostFD := fd.(*controlFDLisa).hostFD
+	for _, name := range path {
+		childFD, err := unix.Openat(hostFD, name, unix.O_PATH|openFlags, 0)
+		if hostFD != fd.(*controlFDLisa).hostFD {
+			_ = unix.Close(hostFD)
+		}
+		if err != nil {
+			return -1, err
+		}
+		hostFD = childFD
+	}
+	if hostFD != fd.(*controlFDLisa).hostFD {
+		defer unix.Close(hostFD)
+	}
+
+	// inotify_add_watch(2) only takes a path, and procfs is no longer mounted
+	// in the gofer. Resolve the magic link for hostFD relative to procSelfFD.
+	addWatchMu.Lock()
+	defer addWatchMu.Unlock()
+	if err := unix.Fchdir(procSelfFD.FD()); err != nil {
+		return -1, err
+	}
+	wd, err := unix.InotifyAddWatch(n.inotifyFD, strconv.Itoa(hostFD), mask)
+	if err != nil {
+		return -1, err
+	}
+	return int32(wd), nil
+}
+
+// RmWatch implements lisafs.Notifier.RmWatch.
+func (n *hostNotifier) RmWatch(wd int32) error {
+	_, err := unix.InotifyRmWatch(n.inotifyFD, uint32(wd))
+	return err
+}
+
+// Close implements lisafs.Notifier.Close.
+func (n *hostNotifier) Close() {
+	var one [8]byte
+	one[0] = 1
+	if _, err := unix.Write(n.stopFD, one[:]); err != nil {
+		log.Warningf("Failed to stop inotify event loop: %v", err)
+	} else {
+		<-n.done
+	}
+	_ = unix.Close(n.stopFD)
+	_ = unix.Close(n.inotifyFD)
+	_ = unix.Close(n.eventR)
+	_ = unix.Close(n.eventW)
+}
+
+// run reads host events and forwards them to the client until Close is
+// called.
+func (n *hostNotifier) run() {
+	defer close(n.done)
+	buf := make([]byte, 64*1024)
+	for {
+		fds := []unix.PollFd{
+			{Fd: int32(n.inotifyFD), Events: unix.POLLIN},
+			{Fd: int32(n.stopFD), Events: unix.POLLIN},
+		}
+		if _, err := unix.Ppoll(fds, nil, nil); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			log.Warningf("Polling inotify FD failed: %v", err)
+			return
+		}
+		if fds[1].Revents != 0 {
+			return
+		}
+		nr, err := unix.Read(n.inotifyFD, buf)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			log.Warningf("Reading inotify FD failed: %v", err)
+			return
+		}
+		n.forward(buf[:nr])
+	}
+}
+
+// forward translates the host events in buf and writes them to the client.
+func (n *hostNotifier) forward(buf []byte) {
+	for len(buf) >= unix.SizeofInotifyEvent {
+		var hdr lisafs.InotifyEvent
+		hdr.UnmarshalUnsafe(buf)
+		recLen := unix.SizeofInotifyEvent + int(hdr.NameLen)
+		if recLen > len(buf) {
+			log.Warningf("Truncated inotify event: %d bytes, want %d", len(buf), recLen)
+			return
+		}
+		rec := buf[:recLen]
+		buf = buf[recLen:]
+
+		if hdr.Mask&unix.IN_UNMOUNT != 0 {
+			// The file system that the watched file is on was unmounted on the
+			// host. This is not visible in the sandbox, but the watch is gone
+			// and IN_IGNORED follows, which is forwarded.
+			continue
+		}
+		if hdr.Mask&unix.IN_Q_OVERFLOW != 0 {
+			// The host dropped events. Let the client know.
+			n.overflow = true
+		}
+		if n.overflow {
+			if !n.send(overflowEvent()) {
+				continue
+			}
+			n.overflow = false
+		}
+		if hdr.Mask&unix.IN_Q_OVERFLOW == 0 {
+			n.send(rec)
+		}
+	}
+}
+
+// send writes rec to the event pipe. Records are smaller than PIPE_BUF, so
+// writes are atomic. If the pipe is full, the event is dropped and the client
+// is sent IN_Q_OVERFLOW when it catches up. send returns true if rec was
+// written.
+func (n *hostNotifier) send(rec []byte) bool {
+	if _, err := unix.Write(n.eventW, rec); err != nil {
+		if err != unix.EAGAIN {
+			log.Warningf("Writing inotify event failed: %v", err)
+		}
+		n.overflow = true
+		return false
+	}
+	return true
+}
+
+func overflowEvent() []byte {
+	ev := lisafs.InotifyEvent{
+		WD:   -1,
+		Mask: unix.IN_Q_OVERFLOW,
+	}
+	buf := make([]byte, ev.SizeBytes())
+	ev.MarshalUnsafe(buf)
+	return buf
+}
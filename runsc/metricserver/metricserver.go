@@ -532,6 +532,10 @@ type sandboxMetricsResult struct {
 	isRunning bool
 	snapshot  *prometheus.Snapshot
 	err       error
+
+	// containerStats contains per-container statistics, keyed by container
+	// ID. It may be nil even if err is nil.
+	containerStats map[string]containerStats
 }
 
 // queryMultiSandboxMetrics queries metric data from multiple loaded sandboxes.
@@ -569,10 +573,18 @@ func queryMultiSandboxMetrics(ctx context.Context, loadedSandboxes []sandboxLoad
 			for s := range loadedSandboxCh {
 				isRunning := false
 				var snapshot *prometheus.Snapshot
+				var stats map[string]containerStats
 				err := s.err
 				if err == nil {
 					queryCtx, queryCtxCancel := context.WithTimeout(ctx, perSandboxTime)
 					snapshot, err = querySandboxMetrics(queryCtx, s.sandbox, s.verifier, metricsFilter)
+					if err == nil {
+						var statsErr error
+						stats, statsErr = querySandboxContainerStats(queryCtx, s.sandbox)
+						if statsErr != nil {
+							log.Warningf("Could not query container statistics from sandbox %s: %v", s.served.rootContainerID.SandboxID, statsErr)
+						}
+					}
 					queryCtxCancel()
 					isRunning = s.sandbox.IsRunning()
 				}
@@ -581,6 +593,7 @@ func queryMultiSandboxMetrics(ctx context.Context, loadedSandboxes []sandboxLoad
 					isRunning:         isRunning,
 					snapshot:          snapshot,
 					err:               err,
+					containerStats:    stats,
 				})
 			}
 		}()
@@ -691,6 +704,9 @@ func (m *metricServer) serveMetrics(w http.ResponseWriter, req *http.Request) ht
 			selfMetrics.Add(prometheus.LabeledIntData(&SpecMetadataMetric, r.served.specMetadataLabels, 1).SetExternalLabels(r.served.extraLabels))
 			createdAt := float64(r.served.createdAt.Unix()) + (float64(r.served.createdAt.Nanosecond()) / 1e9)
 			selfMetrics.Add(prometheus.LabeledFloatData(&SandboxCreationMetric, nil, createdAt).SetExternalLabels(r.served.extraLabels))
+			for _, data := range containerStatsData(r.containerStats) {
+				selfMetrics.Add(data.SetExternalLabels(r.served.extraLabels))
+			}
 		} else {
 			// If the sandbox isn't running, it is normal that metrics are not exported for it, so
 			// do not report this case as an error.
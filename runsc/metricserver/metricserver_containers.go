@@ -0,0 +1,129 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metricserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/prometheus"
+	"gvisor.dev/gvisor/runsc/sandbox"
+)
+
+// maxContainersPerSandbox is the maximum number of containers per sandbox
+// that we export metrics for. Container IDs are reported by the sandbox, which
+// is not trusted, so this bounds the number of label values it can create.
+const maxContainersPerSandbox = 256
+
+// containerStats contains statistics about a single container of a sandbox.
+type containerStats struct {
+	// cpuUsageNanos is the CPU time used by the container's processes.
+	cpuUsageNanos uint64
+
+	// memoryUsageBytes is the memory usage attributed to the container.
+	memoryUsageBytes uint64
+
+	// numProcesses is the number of processes in the container.
+	numProcesses uint64
+}
+
+// querySandboxContainerStats queries the sandbox for per-container statistics.
+// The returned map is keyed by container ID.
+func querySandboxContainerStats(ctx context.Context, sand *sandbox.Sandbox) (map[string]containerStats, error) {
+	ch := make(chan struct {
+		stats map[string]containerStats
+		err   error
+	}, 1)
+	canceled := make(chan struct{}, 1)
+	defer close(canceled)
+	go func() {
+		stats, err := sandboxContainerStats(sand)
+		select {
+		case <-canceled:
+		case ch <- struct {
+			stats map[string]containerStats
+			err   error
+		}{stats, err}:
+			close(ch)
+		}
+	}()
+	select {
+	case <-ctx.Done():
+		canceled <- struct{}{}
+		return nil, ctx.Err()
+	case ret := <-ch:
+		return ret.stats, ret.err
+	}
+}
+
+// sandboxContainerStats synchronously queries the sandbox for per-container
+// statistics.
+func sandboxContainerStats(sand *sandbox.Sandbox) (map[string]containerStats, error) {
+	// The root container's event data contains the CPU usage of all
+	// containers, which also tells us which containers exist.
+	rootEvent, err := sand.Event(sand.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rootEvent.ContainerUsage) > maxContainersPerSandbox {
+		return nil, fmt.Errorf("sandbox reported %d containers, more than the maximum of %d", len(rootEvent.ContainerUsage), maxContainersPerSandbox)
+	}
+	stats := make(map[string]containerStats, len(rootEvent.ContainerUsage))
+	for cid, cpuUsage := range rootEvent.ContainerUsage {
+		if cid == "" {
+			continue
+		}
+		event := rootEvent
+		if cid != sand.ID {
+			event, err = sand.Event(cid)
+			if err != nil {
+				// The container may have exited since the root event was
+				// taken. Still export its CPU usage.
+				log.Debugf("Cannot get event data for container %q in sandbox %q: %v", cid, sand.ID, err)
+				stats[cid] = containerStats{cpuUsageNanos: cpuUsage}
+				continue
+			}
+		}
+		stats[cid] = containerStats{
+			cpuUsageNanos:    cpuUsage,
+			memoryUsageBytes: event.Event.Data.Memory.Usage.Usage,
+			numProcesses:     event.Event.Data.Pids.Current,
+		}
+	}
+	return stats, nil
+}
+
+// containerStatsData returns the Prometheus data for the given per-container
+// statistics, in a deterministic order.
+func containerStatsData(stats map[string]containerStats) []*prometheus.Data {
+	cids := make([]string, 0, len(stats))
+	for cid := range stats {
+		cids = append(cids, cid)
+	}
+	sort.Strings(cids)
+	data := make([]*prometheus.Data, 0, 3*len(cids))
+	for _, cid := range cids {
+		s := stats[cid]
+		labels := map[string]string{prometheus.ContainerIDLabel: cid}
+		data = append(data,
+			prometheus.LabeledFloatData(&ContainerCPUUsageMetric, labels, float64(s.cpuUsageNanos)/1e9),
+			prometheus.LabeledIntData(&ContainerMemoryUsageMetric, labels, int64(s.memoryUsageBytes)),
+			prometheus.LabeledIntData(&ContainerProcessesMetric, labels, int64(s.numProcesses)),
+		)
+	}
+	return data
+}
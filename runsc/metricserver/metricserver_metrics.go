@@ -51,6 +51,21 @@ var (
 		Type: prometheus.TypeGauge,
 		Help: "When the sandbox was created, as a unix timestamp in seconds.",
 	}
+	ContainerCPUUsageMetric = prometheus.Metric{
+		Name: "container_cpu_usage_seconds_total",
+		Type: prometheus.TypeCounter,
+		Help: "CPU time used by the processes of each container of the sandbox.",
+	}
+	ContainerMemoryUsageMetric = prometheus.Metric{
+		Name: "container_memory_usage_bytes",
+		Type: prometheus.TypeGauge,
+		Help: "Memory usage attributed to each container of the sandbox.",
+	}
+	ContainerProcessesMetric = prometheus.Metric{
+		Name: "container_processes",
+		Type: prometheus.TypeGauge,
+		Help: "Number of processes in each container of the sandbox.",
+	}
 	NumRunningSandboxesMetric = prometheus.Metric{
 		Name: "num_sandboxes_running",
 		Type: prometheus.TypeGauge,
@@ -76,6 +91,9 @@ var Metrics = []*prometheus.Metric{
 	&SandboxCapabilitiesMetric,
 	&SpecMetadataMetric,
 	&SandboxCreationMetric,
+	&ContainerCPUUsageMetric,
+	&ContainerMemoryUsageMetric,
+	&ContainerProcessesMetric,
 	&NumRunningSandboxesMetric,
 	&NumCannotExportSandboxesMetric,
 	&NumTotalSandboxesMetric,
@@ -20,6 +20,9 @@ import (
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/prometheus"
 )
 
 type fakeFileInfo struct {
@@ -196,3 +199,30 @@ func TestSufficientlyEqualStats(t *testing.T) {
 		})
 	}
 }
+
+func TestContainerStatsData(t *testing.T) {
+	data := containerStatsData(map[string]containerStats{
+		"b": {cpuUsageNanos: 1500000000, memoryUsageBytes: 4096, numProcesses: 2},
+		"a": {cpuUsageNanos: 250000000},
+	})
+	type point struct {
+		Metric    string
+		Container string
+		Value     prometheus.Number
+	}
+	got := make([]point, 0, len(data))
+	for _, d := range data {
+		got = append(got, point{d.Metric.Name, d.Labels[prometheus.ContainerIDLabel], *d.Number})
+	}
+	want := []point{
+		{"container_cpu_usage_seconds_total", "a", prometheus.Number{Float: 0.25}},
+		{"container_memory_usage_bytes", "a", prometheus.Number{Int: 0}},
+		{"container_processes", "a", prometheus.Number{Int: 0}},
+		{"container_cpu_usage_seconds_total", "b", prometheus.Number{Float: 1.5}},
+		{"container_memory_usage_bytes", "b", prometheus.Number{Int: 4096}},
+		{"container_processes", "b", prometheus.Number{Int: 2}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("containerStatsData returned unexpected data (-want +got):\n%s", diff)
+	}
+}
@@ -48,6 +48,9 @@ import (
 // All IP addresses assigned to the NIC, are removed and passed on to netstack's
 // device.
 //
+// If 'conf.NetworkHelper' is set, the helper is started first to create a tap
+// device in the namespace, which is then copied like any other interface.
+//
 // If 'conf.Network' is NoNetwork, skips local configuration and creates a
 // loopback interface only.
 //
@@ -59,15 +62,22 @@ func setupNetwork(conn *urpc.Client, pid int, conf *config.Config) error {
 
 	switch conf.Network {
 	case config.NetworkNone:
+		if conf.MinimalBoot {
+			log.Infof("Network is disabled and minimal boot is enabled, no network stack to configure")
+			break
+		}
 		log.Infof("Network is disabled, create loopback interface only")
 		if err := createDefaultLoopbackInterface(conf, conn); err != nil {
 			return fmt.Errorf("creating default loopback interface: %v", err)
 		}
 	case config.NetworkSandbox:
+		if err := startNetworkHelper(conf, pid); err != nil {
+			return fmt.Errorf("starting network helper %v: %w", conf.NetworkHelper, err)
+		}
 		// Build the path to the net namespace of the sandbox process.
 		// This is what we will copy.
 		nsPath := filepath.Join("/proc", strconv.Itoa(pid), "ns/net")
-		if err := createInterfacesAndRoutesFromNS(conn, nsPath, conf); err != nil {
+		if err := createInterfacesAndRoutesFromNS(conn, nsPath, "" /* podID */, conf); err != nil {
 			return fmt.Errorf("creating interfaces from net namespace %q: %v", nsPath, err)
 		}
 	case config.NetworkHost:
@@ -78,6 +88,23 @@ func setupNetwork(conn *urpc.Client, pid int, conf *config.Config) error {
 	return nil
 }
 
+// SetupPodNetwork configures the network of a pod that joined the sandbox
+// through a sandbox group (see --sandbox-groups). As for the sandbox's own
+// network, the interfaces and routes of the pod's network namespace on the
+// host, at nsPath, are moved to the pod's network namespace in the sandbox.
+func (s *Sandbox) SetupPodNetwork(conf *config.Config, podID, nsPath string) error {
+	log.Infof("Setting up network of pod %q from %q", podID, nsPath)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := createInterfacesAndRoutesFromNS(conn, nsPath, podID, conf); err != nil {
+		return fmt.Errorf("creating interfaces from net namespace %q: %w", nsPath, err)
+	}
+	return nil
+}
+
 func createDefaultLoopbackInterface(conf *config.Config, conn *urpc.Client) error {
 	link := boot.DefaultLoopbackLink
 	link.GvisorGROTimeout = conf.GvisorGROTimeout
@@ -121,8 +148,10 @@ func isRootNS() (bool, error) {
 
 // createInterfacesAndRoutesFromNS scrapes the interface and routes from the
 // net namespace with the given path, creates them in the sandbox, and removes
-// them from the host.
-func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *config.Config) error {
+// them from the host. If podID is set, they are created in the network
+// namespace of the pod that joined the sandbox with that ID, which already
+// has a loopback interface.
+func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath, podID string, conf *config.Config) error {
 	// Join the network namespace that we will be copying.
 	restore, err := joinNetNS(nsPath)
 	if err != nil {
@@ -145,7 +174,7 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 	}
 
 	// Collect addresses and routes from the interfaces.
-	var args boot.CreateLinksAndRoutesArgs
+	args := boot.CreateLinksAndRoutesArgs{PodID: podID}
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 {
 			log.Infof("Skipping down interface: %+v", iface)
@@ -159,6 +188,9 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 
 		// We build our own loopback device.
 		if iface.Flags&net.FlagLoopback != 0 {
+			if podID != "" {
+				continue
+			}
 			link, err := loopbackLink(conf, iface, allAddrs)
 			if err != nil {
 				return fmt.Errorf("getting loopback link for iface %q: %w", iface.Name, err)
@@ -264,6 +296,7 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 				LinkAddress:       linkAddress,
 				Addresses:         addresses,
 				GvisorGROTimeout:  conf.GvisorGROTimeout,
+				SaveRestore:       conf.NetSaveConnections,
 			})
 		} else {
 			link := boot.FDBasedLink{
@@ -277,6 +310,7 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 				Neighbors:         neighbors,
 				LinkAddress:       linkAddress,
 				Addresses:         addresses,
+				SaveRestore:       conf.NetSaveConnections,
 			}
 
 			log.Debugf("Setting up network channels")
@@ -309,8 +343,9 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 		}
 	}
 
-	// Pass PCAP log file if present.
-	if conf.PCAP != "" {
+	// Pass PCAP log file if present. It only captures the sandbox's own
+	// network.
+	if conf.PCAP != "" && podID == "" {
 		args.PCAP = true
 		pcap, err := os.OpenFile(conf.PCAP, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
 		if err != nil {
@@ -0,0 +1,223 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+const (
+	// networkHelperMTU is the MTU of the tap device created by network
+	// helpers. Both helpers support MTUs up to 65520, which avoids
+	// fragmenting large segments between netstack and the helper.
+	networkHelperMTU = 65520
+
+	// slirp4netnsTap is the name of the tap device created by slirp4netns.
+	slirp4netnsTap = "tap0"
+
+	// slirp4netnsGuestAddr is the address assigned to slirp4netnsTap by
+	// slirp4netns --configure.
+	slirp4netnsGuestAddr = "10.0.2.100"
+)
+
+// startNetworkHelper connects the network namespace of the sandbox process to
+// the host network using conf.NetworkHelper, a userspace NAT that doesn't
+// require CAP_NET_ADMIN on the host. Once it returns, the namespace contains
+// a configured tap device, which is handed to netstack by
+// createInterfacesAndRoutesFromNS like any other interface.
+//
+// The helper keeps running in the background and exits once the network
+// namespace is destroyed together with the sandbox.
+func startNetworkHelper(conf *config.Config, pid int) error {
+	switch conf.NetworkHelper {
+	case config.NetworkHelperNone:
+		return nil
+	case config.NetworkHelperSlirp4netns:
+		return startSlirp4netns(pid, conf.PublishPorts)
+	case config.NetworkHelperPasta:
+		return startPasta(pid, conf.PublishPorts)
+	default:
+		return fmt.Errorf("invalid network helper: %v", conf.NetworkHelper)
+	}
+}
+
+// startSlirp4netns starts slirp4netns(1) for the sandbox process pid and
+// forwards fwds to it using the slirp4netns API socket.
+func startSlirp4netns(pid int, fwds config.PortForwards) error {
+	path, err := exec.LookPath("slirp4netns")
+	if err != nil {
+		return fmt.Errorf("looking up slirp4netns: %w", err)
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("creating ready pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	// The API socket is only needed to set up port forwards.
+	apiSocket := filepath.Join(os.TempDir(), fmt.Sprintf("runsc-slirp4netns-%d.sock", pid))
+	_ = os.Remove(apiSocket)
+	defer os.Remove(apiSocket)
+
+	cmd := exec.Command(path,
+		"--configure",
+		fmt.Sprintf("--mtu=%d", networkHelperMTU),
+		// Don't let the sandbox reach services listening on the host's
+		// loopback interface through the gateway address.
+		"--disable-host-loopback",
+		"--ready-fd=3",
+		"--api-socket", apiSocket,
+		"--userns-path", filepath.Join("/proc", strconv.Itoa(pid), "ns/user"),
+		strconv.Itoa(pid),
+		slirp4netnsTap,
+	)
+	cmd.ExtraFiles = []*os.File{readyW}
+	// Detach from the session, so that the helper doesn't receive signals
+	// sent to the foreground process group.
+	cmd.SysProcAttr = &unix.SysProcAttr{Setsid: true}
+	log.Infof("Starting network helper: %s", cmd.Args)
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return fmt.Errorf("starting slirp4netns: %w", err)
+	}
+	go func() {
+		err := cmd.Wait()
+		log.Infof("slirp4netns exited: %v", err)
+	}()
+
+	// slirp4netns writes "1" to the ready FD once the tap device is
+	// configured. The FD is closed without writing to it if it fails.
+	var ready [1]byte
+	if n, err := readyR.Read(ready[:]); n != 1 {
+		return fmt.Errorf("slirp4netns failed to configure the network: %v", err)
+	}
+
+	for _, fwd := range fwds {
+		if err := slirp4netnsAddHostFwd(apiSocket, fwd); err != nil {
+			_ = cmd.Process.Kill()
+			return err
+		}
+	}
+	return nil
+}
+
+// slirp4netnsAddHostFwd adds fwd with the slirp4netns API listening on
+// apiSocket.
+func slirp4netnsAddHostFwd(apiSocket string, fwd config.PortForward) error {
+	conn, err := net.Dial("unix", apiSocket)
+	if err != nil {
+		return fmt.Errorf("connecting to slirp4netns API socket: %w", err)
+	}
+	defer conn.Close()
+
+	hostAddr := fwd.HostIP
+	if hostAddr == "" {
+		hostAddr = "0.0.0.0"
+	}
+	req := map[string]any{
+		"execute": "add_hostfwd",
+		"arguments": map[string]any{
+			"proto":      fwd.Proto,
+			"host_addr":  hostAddr,
+			"host_port":  fwd.HostPort,
+			"guest_addr": slirp4netnsGuestAddr,
+			"guest_port": fwd.Port,
+		},
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("sending port forward %v to slirp4netns: %w", fwd, err)
+	}
+	// slirp4netns replies once the request is complete.
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		return fmt.Errorf("sending port forward %v to slirp4netns: %w", fwd, err)
+	}
+	var resp struct {
+		Error *struct {
+			Desc string `json:"desc"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("reading slirp4netns reply for port forward %v: %w", fwd, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("forwarding port %v with slirp4netns: %s", fwd, resp.Error.Desc)
+	}
+	return nil
+}
+
+// pastaArgs returns the arguments for pasta(1) to configure the network
+// namespace of the sandbox process pid and forward fwds.
+func pastaArgs(pid int, fwds config.PortForwards) []string {
+	args := []string{
+		"--config-net",
+		"--quiet",
+		fmt.Sprintf("--mtu=%d", networkHelperMTU),
+		// Don't let the sandbox reach services listening on the host's
+		// loopback interface through the gateway address.
+		"--no-map-gw",
+		// Don't forward ports from the sandbox to the host.
+		"-T", "none",
+		"-U", "none",
+	}
+	var tcp, udp int
+	for _, fwd := range fwds {
+		spec := fmt.Sprintf("%d:%d", fwd.HostPort, fwd.Port)
+		if fwd.HostIP != "" {
+			spec = fwd.HostIP + "/" + spec
+		}
+		if fwd.Proto == "udp" {
+			args = append(args, "-u", spec)
+			udp++
+		} else {
+			args = append(args, "-t", spec)
+			tcp++
+		}
+	}
+	// pasta forwards all bound ports by default.
+	if tcp == 0 {
+		args = append(args, "-t", "none")
+	}
+	if udp == 0 {
+		args = append(args, "-u", "none")
+	}
+	return append(args, strconv.Itoa(pid))
+}
+
+// startPasta starts pasta(1) for the sandbox process pid. pasta joins the
+// user and network namespaces of pid, and moves to the background once the
+// network is configured.
+func startPasta(pid int, fwds config.PortForwards) error {
+	path, err := exec.LookPath("pasta")
+	if err != nil {
+		return fmt.Errorf("looking up pasta: %w", err)
+	}
+	cmd := exec.Command(path, pastaArgs(pid, fwds)...)
+	log.Infof("Starting network helper: %s", cmd.Args)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("running pasta: %w, output: %s", err, out)
+	}
+	return nil
+}
@@ -49,6 +49,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	"gvisor.dev/gvisor/pkg/state/statefile"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/boot/procfs"
@@ -57,6 +58,7 @@ import (
 	"gvisor.dev/gvisor/runsc/console"
 	"gvisor.dev/gvisor/runsc/donation"
 	"gvisor.dev/gvisor/runsc/specutils"
+	"gvisor.dev/gvisor/runsc/specutils/seccomp"
 )
 
 const (
@@ -67,6 +69,10 @@ const (
 	// namespaceAnnotation is a pod annotation populated by containerd.
 	// It contains the namespace of the pod that a sandbox is in when running in Kubernetes.
 	namespaceAnnotation = "io.kubernetes.cri.sandbox-namespace"
+
+	// seccompCacheDir is the directory under the root directory where the
+	// sentry's seccomp programs are cached with --seccomp-cache.
+	seccompCacheDir = "seccomp-cache"
 )
 
 // createControlSocket finds a location and creates the socket used to
@@ -232,6 +238,14 @@ type Args struct {
 	// mount in the overlay mounts.
 	OverlayFilestoreFiles []*os.File
 
+	// VirtiofsFiles are connections to the virtio-fs servers for the virtiofs
+	// mounts. They must be in the same order as mounts appear in the spec.
+	VirtiofsFiles []*os.File
+
+	// NFSFiles are connections to the servers of the NFS mounts. They must be
+	// in the same order as mounts appear in the spec.
+	NFSFiles []*os.File
+
 	// OverlayMediums contains information about how the gofer mounts have been
 	// overlaid. The first entry is for rootfs and the following entries are for
 	// bind mounts in Spec.Mounts (in the same order).
@@ -307,6 +321,13 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 			return nil, fmt.Errorf("cannot init config: %w", err)
 		}
 	}
+	if len(conf.SyscallFilterProfile) > 0 {
+		// The sandbox loads the profile again from the donated file; check
+		// it here to report errors before the sandbox is started.
+		if _, err := seccomp.LoadProfileFile(conf.SyscallFilterProfile); err != nil {
+			return nil, fmt.Errorf("loading syscall filter profile: %w", err)
+		}
+	}
 
 	// Create pipe to synchronize when sandbox process has been booted.
 	clientSyncFile, sandboxSyncFile, err := os.Pipe()
@@ -403,7 +424,7 @@ func (s *Sandbox) StartRoot(conf *config.Config) error {
 }
 
 // StartSubcontainer starts running a sub-container inside the sandbox.
-func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid string, stdios, goferFiles, overlayFilestoreFiles []*os.File, overlayMediums []boot.OverlayMedium) error {
+func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid string, stdios, goferFiles, overlayFilestoreFiles, virtiofsFiles, nfsFiles []*os.File, overlayMediums []boot.OverlayMedium) error {
 	log.Debugf("Start sub-container %q in sandbox %q, PID: %d", cid, s.ID, s.Pid.load())
 
 	if err := s.configureStdios(conf, stdios); err != nil {
@@ -415,10 +436,16 @@ func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid s
 	// * stdin/stdout/stderr (optional: only present when not using TTY)
 	// * The subcontainer's overlay filestore files (optional: only present when
 	//   host file backed overlay is configured)
+	// * Connections to virtio-fs servers (optional: only present when the
+	//   subcontainer has virtiofs mounts)
+	// * Connections to NFS servers (optional: only present when the
+	//   subcontainer has NFS mounts)
 	// * Gofer files.
 	payload := urpc.FilePayload{}
 	payload.Files = append(payload.Files, stdios...)
 	payload.Files = append(payload.Files, overlayFilestoreFiles...)
+	payload.Files = append(payload.Files, virtiofsFiles...)
+	payload.Files = append(payload.Files, nfsFiles...)
 	payload.Files = append(payload.Files, goferFiles...)
 
 	// Start running the container.
@@ -427,6 +454,8 @@ func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid s
 		Conf:                   conf,
 		CID:                    cid,
 		NumOverlayFilestoreFDs: len(overlayFilestoreFiles),
+		NumVirtiofsFDs:         len(virtiofsFiles),
+		NumNFSFDs:              len(nfsFiles),
 		OverlayMediums:         overlayMediums,
 		FilePayload:            payload,
 	}
@@ -436,22 +465,24 @@ func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid s
 	return nil
 }
 
-// Restore sends the restore call for a container in the sandbox.
-func (s *Sandbox) Restore(conf *config.Config, cid string, filename string) error {
+// Restore sends the restore call for a container in the sandbox. The state is
+// read from rf, which may be a regular file or a stream.
+//
+// If chunks is not nil, memory contents are loaded from the chunk store it
+// refers to. Its Refs file is unused.
+func (s *Sandbox) Restore(conf *config.Config, cid string, rf *os.File, chunks *ChunkStoreFiles) error {
 	log.Debugf("Restore sandbox %q", s.ID)
 
-	rf, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("opening restore file %q failed: %v", filename, err)
-	}
-	defer rf.Close()
-
 	opt := boot.RestoreOpts{
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{rf},
 		},
 		SandboxID: s.ID,
 	}
+	if chunks != nil {
+		opt.ChunkStore = true
+		opt.FilePayload.Files = append(opt.FilePayload.Files, chunks.Index, chunks.Pack)
+	}
 
 	// If the platform needs a device FD we must pass it in.
 	if deviceFile, err := deviceFileForPlatform(conf.Platform, conf.PlatformDevicePath); err != nil {
@@ -579,6 +610,51 @@ func (s *Sandbox) Execute(conf *config.Config, args *control.ExecArgs) (int32, e
 	return pid, nil
 }
 
+// CreateExecSession makes the terminal of exec'd process pid persistent.
+// master is the master end of the pty whose replica is the process's stdio.
+func (s *Sandbox) CreateExecSession(cid string, pid int32, master *os.File) error {
+	log.Debugf("Creating exec session for PID %d in container %q in sandbox %q", pid, cid, s.ID)
+	args := boot.ExecSessionArgs{
+		CID:         cid,
+		PID:         pid,
+		FilePayload: urpc.FilePayload{Files: []*os.File{master}},
+	}
+	if err := s.call(boot.ContMgrCreateExecSession, &args, nil); err != nil {
+		return fmt.Errorf("creating exec session for PID %d in sandbox: %w", pid, err)
+	}
+	return nil
+}
+
+// AttachExecSession attaches conn, a connected socket, to the exec session of
+// process pid.
+func (s *Sandbox) AttachExecSession(cid string, pid int32, conn *os.File) error {
+	log.Debugf("Attaching to exec session for PID %d in container %q in sandbox %q", pid, cid, s.ID)
+	args := boot.ExecSessionArgs{
+		CID:         cid,
+		PID:         pid,
+		FilePayload: urpc.FilePayload{Files: []*os.File{conn}},
+	}
+	if err := s.call(boot.ContMgrAttachExecSession, &args, nil); err != nil {
+		return fmt.Errorf("attaching to exec session for PID %d in sandbox: %w", pid, err)
+	}
+	return nil
+}
+
+// ResizeExecSession changes the window size of the exec session of process
+// pid.
+func (s *Sandbox) ResizeExecSession(cid string, pid int32, rows, cols uint16) error {
+	args := boot.ResizeExecSessionArgs{
+		CID:  cid,
+		PID:  pid,
+		Rows: rows,
+		Cols: cols,
+	}
+	if err := s.call(boot.ContMgrResizeExecSession, &args, nil); err != nil {
+		return fmt.Errorf("resizing exec session for PID %d in sandbox: %w", pid, err)
+	}
+	return nil
+}
+
 // Event retrieves stats about the sandbox such as memory and CPU utilization.
 func (s *Sandbox) Event(cid string) (*boot.EventOut, error) {
 	log.Debugf("Getting events for container %q in sandbox %q", cid, s.ID)
@@ -640,6 +716,16 @@ func (s *Sandbox) connError(err error) error {
 	return fmt.Errorf("connecting to control server at PID %d: %v", s.Pid.load(), err)
 }
 
+// pageCacheReclaimTrigger is the host memory pressure above which the sentry
+// evicts cached file data with --page-cache-high-watermark: 100ms of memory
+// stalls in a 2s window. The window is a multiple of 2s, as required for
+// unprivileged users.
+var pageCacheReclaimTrigger = cgroup.PressureTrigger{
+	Resource: cgroup.PressureMemory,
+	Stall:    100 * time.Millisecond,
+	Window:   2 * time.Second,
+}
+
 // createSandboxProcess starts the sandbox as a subprocess by running the "boot"
 // command, passing in the bundle dir.
 func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyncFile *os.File) error {
@@ -735,11 +821,18 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	// If there is a gofer, sends all socket ends to the sandbox.
 	donations.DonateAndClose("io-fds", args.IOFiles...)
 	donations.DonateAndClose("overlay-filestore-fds", args.OverlayFilestoreFiles...)
+	donations.DonateAndClose("virtiofs-fds", args.VirtiofsFiles...)
+	donations.DonateAndClose("nfs-fds", args.NFSFiles...)
 	donations.DonateAndClose("mounts-fd", args.MountsFile)
 	donations.Donate("start-sync-fd", startSyncFile)
 	if err := donations.OpenAndDonate("user-log-fd", args.UserLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
 		return err
 	}
+	if conf.Swap == config.SwapFile {
+		if err := donations.OpenAndDonate("swap-file-fd", conf.SwapFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC); err != nil {
+			return err
+		}
+	}
 	const profFlags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
 	if err := donations.OpenAndDonate("profile-block-fd", conf.ProfileBlock, profFlags); err != nil {
 		return err
@@ -756,6 +849,9 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	if err := donations.OpenAndDonate("trace-fd", conf.TraceFile, profFlags); err != nil {
 		return err
 	}
+	if err := donations.OpenAndDonate("strace-json-fd", conf.StraceJSON, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
+		return err
+	}
 
 	// Pass nvidia device minors.
 	if len(args.NvidiaDevMinors) > 0 {
@@ -774,7 +870,7 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	log.Infof("Control socket path: %q", s.ControlSocketPath)
 	donations.DonateAndClose("controller-fd", os.NewFile(uintptr(sockFD), "control_server_socket"))
 
-	specFile, err := specutils.OpenSpec(args.BundleDir)
+	specFile, err := specutils.OpenSpecForChild(args.BundleDir, args.Spec, conf)
 	if err != nil {
 		return fmt.Errorf("cannot open spec file in bundle dir %v: %w", args.BundleDir, err)
 	}
@@ -783,6 +879,18 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	if err := donations.OpenAndDonate("pod-init-config-fd", conf.PodInitConfig, os.O_RDONLY); err != nil {
 		return err
 	}
+	if err := donations.OpenAndDonate("syscall-filter-profile-fd", conf.SyscallFilterProfile, os.O_RDONLY); err != nil {
+		return err
+	}
+	if conf.SeccompCache && !conf.DisableSeccomp {
+		dir := filepath.Join(conf.RootDir, seccompCacheDir)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("creating seccomp cache directory: %w", err)
+		}
+		if err := donations.OpenAndDonate("seccomp-cache-fd", dir, os.O_RDONLY|unix.O_DIRECTORY); err != nil {
+			return err
+		}
+	}
 	donations.DonateAndClose("sink-fds", args.SinkFiles...)
 
 	gPlatform, err := platform.Lookup(conf.Platform)
@@ -1009,29 +1117,9 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 
 	mem := totalSysMem
 	if s.CgroupJSON.Cgroup != nil {
-		cpuNum, err := s.CgroupJSON.Cgroup.NumCPU()
+		cpuNum, err := s.cpuNum(conf)
 		if err != nil {
-			return fmt.Errorf("getting cpu count from cgroups: %v", err)
-		}
-		if conf.CPUNumFromQuota {
-			// Dropping below 2 CPUs can trigger application to disable
-			// locks that can lead do hard to debug errors, so just
-			// leaving two cores as reasonable default.
-			const minCPUs = 2
-
-			quota, err := s.CgroupJSON.Cgroup.CPUQuota()
-			if err != nil {
-				return fmt.Errorf("getting cpu quota from cgroups: %v", err)
-			}
-			if n := int(math.Ceil(quota)); n > 0 {
-				if n < minCPUs {
-					n = minCPUs
-				}
-				if n < cpuNum {
-					// Only lower the cpu number.
-					cpuNum = n
-				}
-			}
+			return err
 		}
 		cmd.Args = append(cmd.Args, "--cpu-num", strconv.Itoa(cpuNum))
 
@@ -1042,6 +1130,17 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		if memLimit < mem {
 			mem = memLimit
 		}
+
+		if conf.PageCacheHighWatermark != 0 {
+			// The sandbox can't see the host cgroupfs, so the pressure
+			// trigger is set up here and the file is donated to it.
+			f, err := s.CgroupJSON.Cgroup.OpenPressureTrigger(pageCacheReclaimTrigger)
+			if err != nil {
+				log.Infof("Page cache won't be reclaimed under host memory pressure: %v", err)
+			} else {
+				donations.DonateAndClose("memory-pressure-fd", f)
+			}
+		}
 	}
 	cmd.Args = append(cmd.Args, "--total-memory", strconv.FormatUint(mem, 10))
 
@@ -1243,14 +1342,22 @@ func (s *Sandbox) SignalProcess(cid string, pid int32, sig unix.Signal, fgProces
 
 // Checkpoint sends the checkpoint call for a container in the sandbox.
 // The statefile will be written to f.
-func (s *Sandbox) Checkpoint(cid string, f *os.File, options statefile.Options) error {
+//
+// If chunks is not nil, memory contents are saved to the chunk store it
+// refers to, instead of f.
+func (s *Sandbox) Checkpoint(cid string, f *os.File, options statefile.Options, chunks *ChunkStoreFiles) error {
 	log.Debugf("Checkpoint sandbox %q, options %+v", s.ID, options)
 	opt := control.SaveOpts{
 		Metadata: options.WriteToMetadata(map[string]string{}),
+		Resume:   options.Resume,
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{f},
 		},
 	}
+	if chunks != nil {
+		opt.ChunkStore = true
+		opt.FilePayload.Files = append(opt.FilePayload.Files, chunks.Index, chunks.Pack, chunks.Refs)
+	}
 
 	if err := s.call(boot.ContMgrCheckpoint, &opt, nil); err != nil {
 		return fmt.Errorf("checkpointing container %q: %w", cid, err)
@@ -1258,6 +1365,86 @@ func (s *Sandbox) Checkpoint(cid string, f *os.File, options statefile.Options)
 	return nil
 }
 
+// ChunkStoreFiles are the files making up a chunk store that memory contents
+// are saved to or loaded from. See chunkstore.Store.
+type ChunkStoreFiles struct {
+	// Index is the chunk store's index file.
+	Index *os.File
+
+	// Pack is the chunk store's pack file, holding chunk data.
+	Pack *os.File
+
+	// Refs receives the hashes of the chunks referenced by a checkpoint.
+	Refs *os.File
+}
+
+// cpuNum returns the number of CPUs that the sandbox may use, based on its
+// cgroup.
+//
+// Precondition: s.CgroupJSON.Cgroup != nil.
+func (s *Sandbox) cpuNum(conf *config.Config) (int, error) {
+	cpuNum, err := s.CgroupJSON.Cgroup.NumCPU()
+	if err != nil {
+		return 0, fmt.Errorf("getting cpu count from cgroups: %v", err)
+	}
+	if conf.CPUNumFromQuota {
+		// Dropping below 2 CPUs can trigger application to disable
+		// locks that can lead do hard to debug errors, so just
+		// leaving two cores as reasonable default.
+		const minCPUs = 2
+
+		quota, err := s.CgroupJSON.Cgroup.CPUQuota()
+		if err != nil {
+			return 0, fmt.Errorf("getting cpu quota from cgroups: %v", err)
+		}
+		if n := int(math.Ceil(quota)); n > 0 {
+			if n < minCPUs {
+				n = minCPUs
+			}
+			if n < cpuNum {
+				// Only lower the cpu number.
+				cpuNum = n
+			}
+		}
+	}
+	return cpuNum, nil
+}
+
+// Update applies new resource limits to the sandbox's cgroup, and changes the
+// number of CPUs used by the sandbox to match.
+func (s *Sandbox) Update(conf *config.Config, res *specs.LinuxResources) error {
+	log.Debugf("Update sandbox %q", s.ID)
+	if s.CgroupJSON.Cgroup == nil {
+		return fmt.Errorf("sandbox %q has no cgroup", s.ID)
+	}
+	if err := s.CgroupJSON.Cgroup.Update(res); err != nil {
+		return fmt.Errorf("updating cgroup: %w", err)
+	}
+	cpuNum, err := s.cpuNum(conf)
+	if err != nil {
+		return err
+	}
+	if err := s.call(boot.ContMgrSetCPULimit, &cpuNum, nil); err != nil {
+		return fmt.Errorf("setting CPU limit: %w", err)
+	}
+	return nil
+}
+
+// UpdateContainer applies new resource limits to the cgroups of container
+// cid inside the sandbox. Unlike Update, the sandbox's host cgroup is left
+// unchanged.
+func (s *Sandbox) UpdateContainer(cid string, res *specs.LinuxResources) error {
+	log.Debugf("Update container %q in sandbox %q", cid, s.ID)
+	args := boot.UpdateResourcesArgs{
+		CID:       cid,
+		Resources: res,
+	}
+	if err := s.call(boot.ContMgrUpdateResources, &args, nil); err != nil {
+		return fmt.Errorf("updating container %q: %w", cid, err)
+	}
+	return nil
+}
+
 // Pause sends the pause call for a container in the sandbox.
 func (s *Sandbox) Pause(cid string) error {
 	log.Debugf("Pause sandbox %q", s.ID)
@@ -1287,6 +1474,34 @@ func (s *Sandbox) Usage(Full bool) (control.MemoryUsage, error) {
 	return m, nil
 }
 
+// Reduce asks the sandbox to reduce its memory usage, e.g. by evicting cached
+// file data. See control.Usage.Reduce.
+func (s *Sandbox) Reduce(opts control.UsageReduceOpts) error {
+	log.Debugf("Reduce sandbox %q", s.ID)
+	if err := s.call(boot.UsageReduce, &opts, nil); err != nil {
+		return fmt.Errorf("reducing memory usage: %w", err)
+	}
+	return nil
+}
+
+// Pressure returns the pressure stall information for resource of the
+// sandbox's cgroup.
+func (s *Sandbox) Pressure(resource cgroup.PressureResource) (*cgroup.Pressure, error) {
+	if s.CgroupJSON.Cgroup == nil {
+		return nil, fmt.Errorf("sandbox %q has no cgroup", s.ID)
+	}
+	return s.CgroupJSON.Cgroup.Pressure(resource)
+}
+
+// WatchPressure calls fn each time the pressure trigger fires for the
+// sandbox's cgroup, until ctx is done or the cgroup is removed.
+func (s *Sandbox) WatchPressure(ctx context.Context, trigger cgroup.PressureTrigger, fn func()) error {
+	if s.CgroupJSON.Cgroup == nil {
+		return fmt.Errorf("sandbox %q has no cgroup", s.ID)
+	}
+	return s.CgroupJSON.Cgroup.WatchPressure(ctx, trigger, fn)
+}
+
 // UsageFD sends the usagefd call for a container in the sandbox.
 func (s *Sandbox) UsageFD() (*control.MemoryUsageRecord, error) {
 	log.Debugf("Usage sandbox %q", s.ID)
@@ -1402,6 +1617,27 @@ func (s *Sandbox) Trace(f *os.File, duration time.Duration) error {
 	return s.call(boot.ProfileTrace, &opts, nil)
 }
 
+// StartPacketCapture starts writing packets seen on a NIC of the sandbox to
+// args.Files[0] in pcapng format.
+func (s *Sandbox) StartPacketCapture(args *boot.StartPacketCaptureArgs) error {
+	log.Debugf("Start packet capture on NIC %q in sandbox %q", args.NIC, s.ID)
+	if err := s.call(boot.NetworkStartPacketCapture, args, nil); err != nil {
+		return fmt.Errorf("starting packet capture in sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// StopPacketCapture stops the packet capture on a NIC of the sandbox and
+// returns its statistics.
+func (s *Sandbox) StopPacketCapture(nic string) (sniffer.CaptureStats, error) {
+	log.Debugf("Stop packet capture on NIC %q in sandbox %q", nic, s.ID)
+	var stats sniffer.CaptureStats
+	if err := s.call(boot.NetworkStopPacketCapture, &nic, &stats); err != nil {
+		return stats, fmt.Errorf("stopping packet capture in sandbox %q: %w", s.ID, err)
+	}
+	return stats, nil
+}
+
 // ChangeLogging changes logging options.
 func (s *Sandbox) ChangeLogging(args control.LoggingArgs) error {
 	log.Debugf("Change logging start %q", s.ID)
@@ -1695,3 +1931,25 @@ func (s *Sandbox) Mount(cid, fstype, src, dest string) error {
 	}
 	return s.call(boot.ContMgrMount, &args, nil)
 }
+
+// MountInfo returns the mount table of the container with ID cid, in the
+// format of /proc/[pid]/mountinfo.
+func (s *Sandbox) MountInfo(cid string) (string, error) {
+	log.Debugf("Getting mount info of container %q in sandbox %q", cid, s.ID)
+	var info string
+	if err := s.call(boot.ContMgrMountInfo, &cid, &info); err != nil {
+		return "", fmt.Errorf("getting mount info of container %q: %w", cid, err)
+	}
+	return info, nil
+}
+
+// SetSyscallOverrides installs or removes syscall overrides in the container
+// with ID cid. See boot.SyscallOverridesArgs.
+func (s *Sandbox) SetSyscallOverrides(cid, overrides string) error {
+	log.Debugf("Setting syscall overrides in container %q in sandbox %q: %s", cid, s.ID, overrides)
+	args := boot.SyscallOverridesArgs{
+		ContainerID: cid,
+		Overrides:   overrides,
+	}
+	return s.call(boot.ContMgrSetSyscallOverrides, &args, nil)
+}
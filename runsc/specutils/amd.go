@@ -0,0 +1,55 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"sort"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// drmMajor is the major device number of DRM devices.
+	drmMajor = 226
+
+	// drmRenderMinorBase is the minor device number of the first DRM render
+	// node, /dev/dri/renderD128.
+	drmRenderMinorBase = 128
+)
+
+// AMDRenderNodeMinors returns the minor device numbers of the DRM render
+// nodes in spec.Linux.Devices, in increasing order. These are the GPUs that
+// were assigned to the container, e.g. with `docker run --device` or by a
+// Kubernetes device plugin, and that amdproxy exposes to the sandbox.
+func AMDRenderNodeMinors(spec *specs.Spec) []uint32 {
+	if spec.Linux == nil {
+		return nil
+	}
+	seen := make(map[uint32]struct{})
+	var minors []uint32
+	for _, dev := range spec.Linux.Devices {
+		if dev.Type != "c" || dev.Major != drmMajor || dev.Minor < drmRenderMinorBase {
+			continue
+		}
+		minor := uint32(dev.Minor)
+		if _, ok := seen[minor]; ok {
+			continue
+		}
+		seen[minor] = struct{}{}
+		minors = append(minors, minor)
+	}
+	sort.Slice(minors, func(i, j int) bool { return minors[i] < minors[j] })
+	return minors
+}
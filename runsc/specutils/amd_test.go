@@ -0,0 +1,70 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestAMDRenderNodeMinors(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		devices []specs.LinuxDevice
+		want    []uint32
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "render nodes",
+			devices: []specs.LinuxDevice{
+				{Path: "/dev/kfd", Type: "c", Major: 235, Minor: 0},
+				{Path: "/dev/dri/renderD129", Type: "c", Major: 226, Minor: 129},
+				{Path: "/dev/dri/renderD128", Type: "c", Major: 226, Minor: 128},
+			},
+			want: []uint32{128, 129},
+		},
+		{
+			name: "primary nodes and other devices",
+			devices: []specs.LinuxDevice{
+				{Path: "/dev/dri/card0", Type: "c", Major: 226, Minor: 0},
+				{Path: "/dev/sda", Type: "b", Major: 226, Minor: 130},
+				{Path: "/dev/dri/renderD130", Type: "c", Major: 226, Minor: 130},
+			},
+			want: []uint32{130},
+		},
+		{
+			name: "duplicates",
+			devices: []specs.LinuxDevice{
+				{Path: "/dev/dri/renderD128", Type: "c", Major: 226, Minor: 128},
+				{Path: "/dev/gpu0", Type: "c", Major: 226, Minor: 128},
+			},
+			want: []uint32{128},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			spec := &specs.Spec{Linux: &specs.Linux{Devices: test.devices}}
+			if got := AMDRenderNodeMinors(spec); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("AMDRenderNodeMinors() = %v, want %v", got, test.want)
+			}
+		})
+	}
+	if got := AMDRenderNodeMinors(&specs.Spec{}); got != nil {
+		t.Errorf("AMDRenderNodeMinors() with no Linux section = %v, want nil", got)
+	}
+}
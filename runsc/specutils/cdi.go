@@ -0,0 +1,424 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v2"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+// Container Device Interface (CDI) support. See
+// https://github.com/cncf-tags/container-device-interface/blob/main/SPEC.md.
+
+const (
+	// cdiAnnotationPrefix is the prefix of annotations that request CDI
+	// devices. Their values are comma-separated lists of fully-qualified
+	// device names, e.g. "nvidia.com/gpu=0,nvidia.com/gpu=1".
+	cdiAnnotationPrefix = "cdi.k8s.io/"
+
+	// annotationCDIDevices is set by ApplyCDIDevices to the comma-separated
+	// list of devices that were injected into the spec, so that the spec is
+	// not modified again when it is re-read.
+	annotationCDIDevices = "dev.gvisor.internal.cdi-devices"
+
+	nvidiaCDIVendor = "nvidia.com"
+)
+
+// CDISpecDirs are the directories searched for CDI specs, in increasing order
+// of priority.
+var CDISpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// cdiSpec is a CDI spec file. Only the fields needed by runsc are included.
+type cdiSpec struct {
+	Version        string            `yaml:"cdiVersion"`
+	Kind           string            `yaml:"kind"`
+	Devices        []cdiDevice       `yaml:"devices"`
+	ContainerEdits cdiContainerEdits `yaml:"containerEdits"`
+}
+
+type cdiDevice struct {
+	Name           string            `yaml:"name"`
+	ContainerEdits cdiContainerEdits `yaml:"containerEdits"`
+}
+
+type cdiContainerEdits struct {
+	Env         []string        `yaml:"env"`
+	DeviceNodes []cdiDeviceNode `yaml:"deviceNodes"`
+	Hooks       []cdiHook       `yaml:"hooks"`
+	Mounts      []cdiMount      `yaml:"mounts"`
+}
+
+type cdiDeviceNode struct {
+	Path        string       `yaml:"path"`
+	HostPath    string       `yaml:"hostPath"`
+	Type        string       `yaml:"type"`
+	Major       int64        `yaml:"major"`
+	Minor       int64        `yaml:"minor"`
+	FileMode    *os.FileMode `yaml:"fileMode"`
+	Permissions string       `yaml:"permissions"`
+	UID         *uint32      `yaml:"uid"`
+	GID         *uint32      `yaml:"gid"`
+}
+
+type cdiHook struct {
+	HookName string   `yaml:"hookName"`
+	Path     string   `yaml:"path"`
+	Args     []string `yaml:"args"`
+	Env      []string `yaml:"env"`
+	Timeout  *int     `yaml:"timeout"`
+}
+
+type cdiMount struct {
+	HostPath      string   `yaml:"hostPath"`
+	ContainerPath string   `yaml:"containerPath"`
+	Options       []string `yaml:"options"`
+	Type          string   `yaml:"type"`
+}
+
+// cdiRegistry holds the devices described by a set of CDI specs.
+type cdiRegistry struct {
+	// devices maps fully-qualified device names to devices.
+	devices map[string]*cdiDevice
+
+	// specs maps fully-qualified device names to the spec that describes
+	// them, whose containerEdits apply to all of its devices.
+	specs map[string]*cdiSpec
+}
+
+// loadCDIRegistry loads all CDI specs in dirs. Devices described by specs in
+// later directories take precedence.
+func loadCDIRegistry(dirs []string) (*cdiRegistry, error) {
+	r := &cdiRegistry{
+		devices: make(map[string]*cdiDevice),
+		specs:   make(map[string]*cdiSpec),
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("reading CDI spec directory %q: %w", dir, err)
+		}
+		// os.ReadDir returns entries sorted by name.
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".json", ".yaml", ".yml":
+			default:
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading CDI spec %q: %w", path, err)
+			}
+			// JSON is a subset of YAML.
+			spec := &cdiSpec{}
+			if err := yaml.Unmarshal(data, spec); err != nil {
+				return nil, fmt.Errorf("parsing CDI spec %q: %w", path, err)
+			}
+			if _, _, ok := parseCDIKind(spec.Kind); !ok {
+				return nil, fmt.Errorf("invalid kind %q in CDI spec %q", spec.Kind, path)
+			}
+			for i := range spec.Devices {
+				dev := &spec.Devices[i]
+				name := spec.Kind + "=" + dev.Name
+				r.devices[name] = dev
+				r.specs[name] = spec
+			}
+		}
+	}
+	return r, nil
+}
+
+// parseCDIKind splits a CDI kind ("vendor/class") into its components.
+func parseCDIKind(kind string) (string, string, bool) {
+	vendor, class, ok := strings.Cut(kind, "/")
+	if !ok || vendor == "" || class == "" || strings.Contains(class, "/") {
+		return "", "", false
+	}
+	return vendor, class, true
+}
+
+// cdiDevicesRequested returns the fully-qualified names of the CDI devices
+// requested by the spec's annotations, in a deterministic order.
+func cdiDevicesRequested(spec *specs.Spec) []string {
+	var keys []string
+	for key := range spec.Annotations {
+		if strings.HasPrefix(key, cdiAnnotationPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var names []string
+	seen := make(map[string]struct{})
+	for _, key := range keys {
+		for _, name := range strings.Split(spec.Annotations[key], ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ApplyCDIDevices injects the CDI devices requested by the spec's annotations
+// into the spec, as described by the CDI specs in dirs. It is a no-op if the
+// spec doesn't request any CDI devices, or if they were already injected.
+func ApplyCDIDevices(spec *specs.Spec, dirs []string) error {
+	if _, ok := spec.Annotations[annotationCDIDevices]; ok {
+		return nil
+	}
+	names := cdiDevicesRequested(spec)
+	if len(names) == 0 {
+		return nil
+	}
+	r, err := loadCDIRegistry(dirs)
+	if err != nil {
+		return err
+	}
+	appliedSpecs := make(map[*cdiSpec]struct{})
+	for _, name := range names {
+		dev, ok := r.devices[name]
+		if !ok {
+			return fmt.Errorf("unresolvable CDI device %q", name)
+		}
+		cdiSpec := r.specs[name]
+		if _, ok := appliedSpecs[cdiSpec]; !ok {
+			if err := cdiSpec.ContainerEdits.apply(spec); err != nil {
+				return fmt.Errorf("applying container edits of CDI kind %q: %w", cdiSpec.Kind, err)
+			}
+			appliedSpecs[cdiSpec] = struct{}{}
+		}
+		if err := dev.ContainerEdits.apply(spec); err != nil {
+			return fmt.Errorf("applying container edits of CDI device %q: %w", name, err)
+		}
+	}
+	log.Infof("Injected CDI devices: %v", names)
+	spec.Annotations[annotationCDIDevices] = strings.Join(names, ",")
+	return nil
+}
+
+// OpenSpecForChild returns a file from which a child process can read spec,
+// which was read from bundleDir. If CDI is enabled, the file contains spec
+// itself, since the child may be unable to read the CDI specs on the host, and
+// must not trust annotations in the bundle's config.json that are internal to
+// runsc. Otherwise, it is the bundle's config.json, as returned by OpenSpec.
+func OpenSpecForChild(bundleDir string, spec *specs.Spec, conf *config.Config) (*os.File, error) {
+	if !conf.CDI {
+		return OpenSpec(bundleDir)
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling spec: %w", err)
+	}
+	fd, err := unix.MemfdCreate("config.json", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("creating spec file: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), "config.json")
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing spec file: %w", err)
+	}
+	return f, nil
+}
+
+// NvidiaCDIDevicesInjected returns true if ApplyCDIDevices injected Nvidia
+// devices into the spec.
+func NvidiaCDIDevicesInjected(spec *specs.Spec) bool {
+	names, ok := spec.Annotations[annotationCDIDevices]
+	if !ok {
+		return false
+	}
+	for _, name := range strings.Split(names, ",") {
+		if strings.HasPrefix(name, nvidiaCDIVendor+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// apply applies e to spec. Edits that are already present in spec, e.g.
+// because the container runtime already injected the same device, are
+// skipped.
+func (e *cdiContainerEdits) apply(spec *specs.Spec) error {
+	if len(e.Env) > 0 {
+		if spec.Process == nil {
+			spec.Process = &specs.Process{}
+		}
+		for _, env := range e.Env {
+			spec.Process.Env = setEnv(spec.Process.Env, env)
+		}
+	}
+	for i := range e.DeviceNodes {
+		if err := e.DeviceNodes[i].apply(spec); err != nil {
+			return err
+		}
+	}
+	for _, m := range e.Mounts {
+		if hasMount(spec, m.ContainerPath) {
+			continue
+		}
+		mnt := specs.Mount{
+			Destination: m.ContainerPath,
+			Source:      m.HostPath,
+			Type:        m.Type,
+			Options:     m.Options,
+		}
+		if mnt.Type == "" {
+			mnt.Type = "bind"
+		}
+		spec.Mounts = append(spec.Mounts, mnt)
+	}
+	for _, h := range e.Hooks {
+		hook := specs.Hook{
+			Path:    h.Path,
+			Args:    h.Args,
+			Env:     h.Env,
+			Timeout: h.Timeout,
+		}
+		if spec.Hooks == nil {
+			spec.Hooks = &specs.Hooks{}
+		}
+		switch h.HookName {
+		case "createContainer", "startContainer":
+			// These hooks must run in the container's namespaces, which
+			// runsc doesn't support (see container.Container). Skipping them
+			// would leave the devices half-configured, e.g. without the
+			// library symlinks or ld.so cache entries they create.
+			return fmt.Errorf("CDI %s hook %q is not supported, since runsc can't run hooks inside the container", h.HookName, h.Path)
+		case "prestart":
+			spec.Hooks.Prestart = append(spec.Hooks.Prestart, hook)
+		case "createRuntime":
+			spec.Hooks.CreateRuntime = append(spec.Hooks.CreateRuntime, hook)
+		case "poststart":
+			spec.Hooks.Poststart = append(spec.Hooks.Poststart, hook)
+		case "poststop":
+			spec.Hooks.Poststop = append(spec.Hooks.Poststop, hook)
+		default:
+			return fmt.Errorf("invalid CDI hook name %q", h.HookName)
+		}
+	}
+	return nil
+}
+
+// apply adds d to the spec's device list and device cgroup rules. The device
+// type and numbers are taken from the host device file if not specified.
+func (d *cdiDeviceNode) apply(spec *specs.Spec) error {
+	if d.Path == "" {
+		return fmt.Errorf("CDI device node has no path")
+	}
+	if spec.Linux == nil {
+		spec.Linux = &specs.Linux{}
+	}
+	for _, dev := range spec.Linux.Devices {
+		if dev.Path == d.Path {
+			return nil
+		}
+	}
+	dev := specs.LinuxDevice{
+		Path:     d.Path,
+		Type:     d.Type,
+		Major:    d.Major,
+		Minor:    d.Minor,
+		FileMode: d.FileMode,
+		UID:      d.UID,
+		GID:      d.GID,
+	}
+	if dev.Type == "" || (dev.Major == 0 && dev.Minor == 0) {
+		hostPath := d.HostPath
+		if hostPath == "" {
+			hostPath = d.Path
+		}
+		var stat unix.Stat_t
+		if err := unix.Stat(hostPath, &stat); err != nil {
+			return fmt.Errorf("stat(%q) for CDI device node: %w", hostPath, err)
+		}
+		switch stat.Mode & unix.S_IFMT {
+		case unix.S_IFCHR:
+			dev.Type = "c"
+		case unix.S_IFBLK:
+			dev.Type = "b"
+		case unix.S_IFIFO:
+			dev.Type = "p"
+		default:
+			return fmt.Errorf("CDI device node %q is not a device", hostPath)
+		}
+		dev.Major = int64(unix.Major(stat.Rdev))
+		dev.Minor = int64(unix.Minor(stat.Rdev))
+		if dev.FileMode == nil {
+			mode := os.FileMode(stat.Mode &^ unix.S_IFMT)
+			dev.FileMode = &mode
+		}
+	}
+	spec.Linux.Devices = append(spec.Linux.Devices, dev)
+
+	access := d.Permissions
+	if access == "" {
+		access = "rwm"
+	}
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &specs.LinuxResources{}
+	}
+	major, minor := dev.Major, dev.Minor
+	spec.Linux.Resources.Devices = append(spec.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+		Allow:  true,
+		Type:   dev.Type,
+		Major:  &major,
+		Minor:  &minor,
+		Access: access,
+	})
+	return nil
+}
+
+// setEnv sets env, of the form "NAME=value", in envs, replacing any existing
+// value for NAME.
+func setEnv(envs []string, env string) []string {
+	name, _, _ := strings.Cut(env, "=")
+	for i, e := range envs {
+		if n, _, _ := strings.Cut(e, "="); n == name {
+			envs[i] = env
+			return envs
+		}
+	}
+	return append(envs, env)
+}
+
+// hasMount returns true if spec has a mount at dst.
+func hasMount(spec *specs.Spec, dst string) bool {
+	for _, m := range spec.Mounts {
+		if filepath.Clean(m.Destination) == filepath.Clean(dst) {
+			return true
+		}
+	}
+	return false
+}
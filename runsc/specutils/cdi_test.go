@@ -0,0 +1,184 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+const testCDISpec = `
+cdiVersion: "0.5.0"
+kind: "nvidia.com/gpu"
+devices:
+- name: "0"
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia0
+      type: c
+      major: 195
+      minor: 0
+- name: "1"
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia1
+      type: c
+      major: 195
+      minor: 1
+containerEdits:
+  env:
+  - NVIDIA_VISIBLE_DEVICES=void
+  deviceNodes:
+  - path: /dev/nvidiactl
+    type: c
+    major: 195
+    minor: 255
+  mounts:
+  - hostPath: /usr/lib/libcuda.so.1
+    containerPath: /usr/lib/libcuda.so.1
+    options: ["ro", "nosuid", "nodev", "bind"]
+`
+
+func TestApplyCDIDevices(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "nvidia.yaml"), []byte(testCDISpec), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	spec := &specs.Spec{
+		Process: &specs.Process{
+			Env: []string{"PATH=/bin", "NVIDIA_VISIBLE_DEVICES=all"},
+		},
+		Annotations: map[string]string{
+			"cdi.k8s.io/gpus": "nvidia.com/gpu=1",
+		},
+	}
+	if err := ApplyCDIDevices(spec, []string{dir}); err != nil {
+		t.Fatalf("ApplyCDIDevices failed: %v", err)
+	}
+
+	if got, _ := EnvVar(spec.Process.Env, "NVIDIA_VISIBLE_DEVICES"); got != "void" {
+		t.Errorf("NVIDIA_VISIBLE_DEVICES got %q, want %q", got, "void")
+	}
+	var devPaths []string
+	for _, dev := range spec.Linux.Devices {
+		devPaths = append(devPaths, dev.Path)
+	}
+	if len(devPaths) != 2 || devPaths[0] != "/dev/nvidiactl" || devPaths[1] != "/dev/nvidia1" {
+		t.Errorf("devices got %v, want [/dev/nvidiactl /dev/nvidia1]", devPaths)
+	}
+	if len(spec.Mounts) != 1 || spec.Mounts[0].Destination != "/usr/lib/libcuda.so.1" || spec.Mounts[0].Type != "bind" {
+		t.Errorf("mounts got %+v, want a bind mount of /usr/lib/libcuda.so.1", spec.Mounts)
+	}
+	if !NvidiaCDIDevicesInjected(spec) {
+		t.Errorf("NvidiaCDIDevicesInjected got false, want true")
+	}
+
+	// Applying the devices again should be a no-op.
+	if err := ApplyCDIDevices(spec, []string{dir}); err != nil {
+		t.Fatalf("ApplyCDIDevices failed: %v", err)
+	}
+	if len(spec.Linux.Devices) != 2 || len(spec.Mounts) != 1 {
+		t.Errorf("ApplyCDIDevices modified spec again: devices %+v, mounts %+v", spec.Linux.Devices, spec.Mounts)
+	}
+}
+
+func TestApplyCDIDevicesUnresolvable(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "nvidia.yaml"), []byte(testCDISpec), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	spec := &specs.Spec{
+		Annotations: map[string]string{
+			"cdi.k8s.io/gpus": "nvidia.com/gpu=2",
+		},
+	}
+	if err := ApplyCDIDevices(spec, []string{dir}); err == nil {
+		t.Errorf("ApplyCDIDevices succeeded for unknown device")
+	}
+}
+
+func TestApplyCDIDevicesContainerHooks(t *testing.T) {
+	dir := t.TempDir()
+	const hookSpec = `
+cdiVersion: "0.5.0"
+kind: "nvidia.com/gpu"
+devices:
+- name: "0"
+  containerEdits:
+    hooks:
+    - hookName: createContainer
+      path: /usr/bin/nvidia-ctk
+      args: ["nvidia-ctk", "hook", "update-ldcache"]
+`
+	if err := os.WriteFile(filepath.Join(dir, "nvidia.yaml"), []byte(hookSpec), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	spec := &specs.Spec{
+		Annotations: map[string]string{
+			"cdi.k8s.io/gpus": "nvidia.com/gpu=0",
+		},
+	}
+	if err := ApplyCDIDevices(spec, []string{dir}); err == nil {
+		t.Errorf("ApplyCDIDevices succeeded for createContainer hook")
+	}
+}
+
+func TestReadSpecIgnoresInternalCDIAnnotation(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		trusted bool
+		cdi     bool
+		want    bool
+	}{
+		{name: "untrusted", trusted: false, cdi: true, want: false},
+		{name: "trusted", trusted: true, cdi: true, want: true},
+		{name: "cdi disabled", trusted: true, cdi: false, want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := &specs.Spec{
+				Process: &specs.Process{Args: []string{"/bin/true"}},
+				Root:    &specs.Root{Path: "/"},
+				Annotations: map[string]string{
+					annotationCDIDevices: "nvidia.com/gpu=0",
+				},
+			}
+			data, err := json.Marshal(spec)
+			if err != nil {
+				t.Fatalf("json.Marshal failed: %v", err)
+			}
+			f, err := os.Create(filepath.Join(t.TempDir(), "config.json"))
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			defer f.Close()
+			if _, err := f.Write(data); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			conf := &config.Config{CDI: tc.cdi}
+			got, err := readSpecFromFile("/", f, conf, tc.trusted)
+			if err != nil {
+				t.Fatalf("readSpecFromFile failed: %v", err)
+			}
+			if injected := NvidiaCDIDevicesInjected(got); injected != tc.want {
+				t.Errorf("NvidiaCDIDevicesInjected got %t, want %t", injected, tc.want)
+			}
+		})
+	}
+}
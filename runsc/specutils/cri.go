@@ -15,6 +15,9 @@
 package specutils
 
 import (
+	"fmt"
+	"strconv"
+
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -51,6 +54,29 @@ const (
 	// which sandbox the container should be created in when the container
 	// is not the first container in the sandbox.
 	CRIOSandboxIDAnnotation = "io.kubernetes.cri-o.SandboxID"
+
+	// ContainerdSandboxNamespaceAnnotation is the OCI annotation set by
+	// containerd to indicate the Kubernetes namespace of the pod.
+	ContainerdSandboxNamespaceAnnotation = "io.kubernetes.cri.sandbox-namespace"
+
+	// CRIONamespaceAnnotation is the OCI annotation set by CRI-O to indicate
+	// the Kubernetes namespace of the pod.
+	CRIONamespaceAnnotation = "io.kubernetes.cri-o.Namespace"
+
+	// ContainerdSandboxCPUPeriodAnnotation, ContainerdSandboxCPUQuotaAnnotation,
+	// ContainerdSandboxCPUSharesAnnotation and
+	// ContainerdSandboxMemoryAnnotation are the OCI annotations set by
+	// containerd on a pod's sandbox container to indicate the resource limits
+	// of the whole pod.
+	ContainerdSandboxCPUPeriodAnnotation = "io.kubernetes.cri.sandbox-cpu-period"
+	ContainerdSandboxCPUQuotaAnnotation  = "io.kubernetes.cri.sandbox-cpu-quota"
+	ContainerdSandboxCPUSharesAnnotation = "io.kubernetes.cri.sandbox-cpu-shares"
+	ContainerdSandboxMemoryAnnotation    = "io.kubernetes.cri.sandbox-memory"
+
+	// SandboxGroupAnnotation is the OCI annotation set on a pod's sandbox
+	// container to request that the pod shares a sandbox with other pods in
+	// the same group. It only has effect with --sandbox-groups.
+	SandboxGroupAnnotation = "dev.gvisor.sandbox-group"
 )
 
 // ContainerType represents the type of container requested by the calling container manager.
@@ -108,3 +134,78 @@ func SandboxID(spec *specs.Spec) (string, bool) {
 	}
 	return "", false
 }
+
+// SandboxGroup returns the sandbox group that the pod wants to join and whether
+// a group was found in the spec. Only sandbox containers can request a group;
+// other containers follow the pod they belong to.
+func SandboxGroup(spec *specs.Spec) (string, bool) {
+	if SpecContainerType(spec) != ContainerTypeSandbox {
+		return "", false
+	}
+	group, ok := spec.Annotations[SandboxGroupAnnotation]
+	if !ok || group == "" {
+		return "", false
+	}
+	return group, true
+}
+
+// SandboxTenant returns the tenant of the pod, i.e. its Kubernetes namespace,
+// and whether it was found in the spec. Pods can only share a sandbox with
+// pods of the same tenant.
+func SandboxTenant(spec *specs.Spec) (string, bool) {
+	if ns, ok := spec.Annotations[ContainerdSandboxNamespaceAnnotation]; ok && ns != "" {
+		return ns, true
+	}
+	if ns, ok := spec.Annotations[CRIONamespaceAnnotation]; ok && ns != "" {
+		return ns, true
+	}
+	return "", false
+}
+
+// PodResources returns the resource limits of the whole pod, as set on the
+// pod's sandbox container, or nil if the pod has no limits.
+func PodResources(spec *specs.Spec) (*specs.LinuxResources, error) {
+	parse := func(name string) (int64, bool, error) {
+		val, ok := spec.Annotations[name]
+		if !ok || val == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %q annotation %q: %w", name, val, err)
+		}
+		// Containerd sets zero for limits that aren't set.
+		return n, n > 0, nil
+	}
+	var res specs.LinuxResources
+	if n, ok, err := parse(ContainerdSandboxMemoryAnnotation); err != nil {
+		return nil, err
+	} else if ok {
+		res.Memory = &specs.LinuxMemory{Limit: &n}
+	}
+	cpu := &specs.LinuxCPU{}
+	if n, ok, err := parse(ContainerdSandboxCPUQuotaAnnotation); err != nil {
+		return nil, err
+	} else if ok {
+		cpu.Quota = &n
+	}
+	if n, ok, err := parse(ContainerdSandboxCPUPeriodAnnotation); err != nil {
+		return nil, err
+	} else if ok {
+		period := uint64(n)
+		cpu.Period = &period
+	}
+	if n, ok, err := parse(ContainerdSandboxCPUSharesAnnotation); err != nil {
+		return nil, err
+	} else if ok {
+		shares := uint64(n)
+		cpu.Shares = &shares
+	}
+	if cpu.Quota != nil || cpu.Period != nil || cpu.Shares != nil {
+		res.CPU = cpu
+	}
+	if res.Memory == nil && res.CPU == nil {
+		return nil, nil
+	}
+	return &res, nil
+}
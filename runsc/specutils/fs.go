@@ -77,6 +77,11 @@ var propOptionsMap = map[string]mapping{
 	"runbindable": {set: true, val: unix.MS_UNBINDABLE | unix.MS_REC},
 }
 
+// sentryOptions lists the keys of options that are only interpreted by the
+// sentry and have no mount(2) equivalent. They take a value, e.g.
+// "fsync=batch".
+var sentryOptions = []string{"fsync", "fsync_delay"}
+
 // invalidOptions list options not allowed.
 //   - shared: sandbox must be isolated from the host. Propagating mount changes
 //     from the sandbox to the host breaks the isolation. The sandbox's mount
@@ -166,6 +171,9 @@ func validateMountOption(o string) error {
 	if ContainsStr(invalidOptions, o) {
 		return fmt.Errorf("mount option %q is not supported", o)
 	}
+	if o != moptKey(o) && ContainsStr(sentryOptions, moptKey(o)) {
+		return nil
+	}
 	_, ok1 := optionsMap[o]
 	_, ok2 := propOptionsMap[o]
 	if !ok1 && !ok2 {
@@ -36,7 +36,7 @@ func GPUFunctionalityRequested(spec *specs.Spec, conf *config.Config) bool {
 		// nvproxy disabled.
 		return false
 	}
-	if !conf.NVProxyDocker {
+	if !NVProxyDockerMode(spec, conf) {
 		// nvproxy enabled in non-Docker mode.
 		return true
 	}
@@ -52,6 +52,15 @@ func GPUFunctionalityRequested(spec *specs.Spec, conf *config.Config) bool {
 	return nvd != "" && nvd != "void"
 }
 
+// NVProxyDockerMode returns true if GPUs are exposed to the container based
+// on NVIDIA_VISIBLE_DEVICES, using libnvidia-container to set up its
+// filesystem. This is the case if --nvproxy-docker is enabled, unless Nvidia
+// devices were injected into the spec through CDI, in which case the spec
+// already describes the devices and files that the container needs.
+func NVProxyDockerMode(spec *specs.Spec, conf *config.Config) bool {
+	return conf.NVProxyDocker && !NvidiaCDIDevicesInjected(spec)
+}
+
 // FindAllGPUDevices returns the Nvidia GPU device minor numbers of all GPUs
 // mounted in the provided rootfs.
 func FindAllGPUDevices(rootfs string) ([]uint32, error) {
@@ -82,7 +91,7 @@ func NvidiaDeviceList(spec *specs.Spec, conf *config.Config) (string, error) {
 	if !GPUFunctionalityRequested(spec, conf) {
 		return "", nil
 	}
-	if !conf.NVProxyDocker {
+	if !NVProxyDockerMode(spec, conf) {
 		// nvproxy enabled in non-Docker mode.
 		// Return all GPUs on the machine.
 		return "all", nil
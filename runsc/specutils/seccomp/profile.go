@@ -0,0 +1,193 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"google.golang.org/protobuf/encoding/prototext"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/seccomp"
+	pb "gvisor.dev/gvisor/runsc/specutils/seccomp/profile_go_proto"
+)
+
+// Profile is a syscall filter policy supplied by the operator of a sandbox,
+// in addition to the filters that runsc installs on its own. It can only
+// further restrict the sandbox.
+//
+// Profiles are JSON objects. For example, the following profile prevents the
+// sentry from calling ptrace(2), and makes unshare(2) fail with EPERM in all
+// containers:
+//
+//	{
+//		"sentry": [{"names": ["ptrace"]}],
+//		"guest": {
+//			"defaultAction": "SCMP_ACT_ALLOW",
+//			"syscalls": [{"names": ["unshare"], "action": "SCMP_ACT_ERRNO"}]
+//		}
+//	}
+//
+// Profiles can also be written in the text format of the Profile message in
+// profile.proto. The profile above is then:
+//
+//	sentry { names: "ptrace" }
+//	guest {
+//		default_action: "SCMP_ACT_ALLOW"
+//		syscalls { names: "unshare" action: "SCMP_ACT_ERRNO" }
+//	}
+type Profile struct {
+	// Sentry lists the host syscalls that the sentry may not make, even if
+	// its own filters allow them. Entries use the format of OCI seccomp
+	// syscall rules, except that they may not specify an action: matching
+	// syscalls are treated as seccomp violations.
+	Sentry []specs.LinuxSyscall `json:"sentry,omitempty"`
+
+	// Guest is an OCI seccomp configuration that constrains every process in
+	// the sandbox's containers, including processes started with runsc exec,
+	// in addition to the container's own OCI seccomp configuration (if any).
+	Guest *specs.LinuxSeccomp `json:"guest,omitempty"`
+}
+
+// LoadProfile reads and validates a Profile from r. Profiles in JSON format
+// are JSON objects, so they start with '{'; anything else is parsed as text
+// format.
+func LoadProfile(r io.Reader) (*Profile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading syscall filter profile: %w", err)
+	}
+	var p Profile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p); err != nil {
+			return nil, fmt.Errorf("decoding syscall filter profile: %w", err)
+		}
+	} else {
+		var msg pb.Profile
+		if err := prototext.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("decoding syscall filter profile: %w", err)
+		}
+		p = profileFromProto(&msg)
+	}
+	if _, err := p.SentryDenyRules(); err != nil {
+		return nil, err
+	}
+	if _, err := p.GuestProgram(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// LoadProfileFile reads and validates a Profile from the file at path.
+func LoadProfileFile(path string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadProfile(f)
+}
+
+// profileFromProto converts the text format of a profile to a Profile.
+func profileFromProto(msg *pb.Profile) Profile {
+	p := Profile{
+		Sentry: syscallsFromProto(msg.GetSentry()),
+	}
+	if guest := msg.GetGuest(); guest != nil {
+		p.Guest = &specs.LinuxSeccomp{
+			DefaultAction: specs.LinuxSeccompAction(guest.GetDefaultAction()),
+			Syscalls:      syscallsFromProto(guest.GetSyscalls()),
+		}
+		if guest.DefaultErrnoRet != nil {
+			errno := uint(guest.GetDefaultErrnoRet())
+			p.Guest.DefaultErrnoRet = &errno
+		}
+		for _, arch := range guest.GetArchitectures() {
+			p.Guest.Architectures = append(p.Guest.Architectures, specs.Arch(arch))
+		}
+		for _, flag := range guest.GetFlags() {
+			p.Guest.Flags = append(p.Guest.Flags, specs.LinuxSeccompFlag(flag))
+		}
+	}
+	return p
+}
+
+func syscallsFromProto(msgs []*pb.Syscall) []specs.LinuxSyscall {
+	var syscalls []specs.LinuxSyscall
+	for _, msg := range msgs {
+		syscall := specs.LinuxSyscall{
+			Names:  msg.GetNames(),
+			Action: specs.LinuxSeccompAction(msg.GetAction()),
+		}
+		if msg.ErrnoRet != nil {
+			errno := uint(msg.GetErrnoRet())
+			syscall.ErrnoRet = &errno
+		}
+		for _, arg := range msg.GetArgs() {
+			syscall.Args = append(syscall.Args, specs.LinuxSeccompArg{
+				Index:    uint(arg.GetIndex()),
+				Value:    arg.GetValue(),
+				ValueTwo: arg.GetValueTwo(),
+				Op:       specs.LinuxSeccompOperator(arg.GetOp()),
+			})
+		}
+		syscalls = append(syscalls, syscall)
+	}
+	return syscalls
+}
+
+// SentryDenyRules returns the rules matching the host syscalls that the
+// sentry may not make.
+func (p *Profile) SentryDenyRules() (seccomp.SyscallRules, error) {
+	rules := seccomp.NewSyscallRules()
+	for _, syscall := range p.Sentry {
+		if syscall.Action != "" || syscall.ErrnoRet != nil {
+			return nil, fmt.Errorf("invalid sentry rule for %v: actions may not be specified", syscall.Names)
+		}
+		rule, err := convertArgs(syscall.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sentry rule for %v: %w", syscall.Names, err)
+		}
+		for _, name := range syscall.Names {
+			// Unlike OCI seccomp configurations, unknown syscalls are
+			// not ignored, since that would silently weaken the profile.
+			syscallNo, err := lookupSyscallNo(nativeArchAuditNo, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sentry rule: %w", err)
+			}
+			rules.AddRule(uintptr(syscallNo), rule)
+		}
+	}
+	return rules, nil
+}
+
+// GuestProgram returns the seccomp program that constrains container
+// processes, or an empty program if the profile does not restrict them.
+func (p *Profile) GuestProgram() (bpf.Program, error) {
+	if p.Guest == nil {
+		return bpf.Program{}, nil
+	}
+	program, err := BuildProgram(p.Guest)
+	if err != nil {
+		return bpf.Program{}, fmt.Errorf("invalid guest rules: %w", err)
+	}
+	return program, nil
+}
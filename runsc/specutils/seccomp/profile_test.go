@@ -0,0 +1,169 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+const testProfile = `{
+	"sentry": [
+		{"names": ["ptrace"]},
+		{"names": ["ioctl"], "args": [{"index": 1, "value": 21505, "op": "SCMP_CMP_EQ"}]}
+	],
+	"guest": {
+		"defaultAction": "SCMP_ACT_ALLOW",
+		"syscalls": [{"names": ["getcwd"], "action": "SCMP_ACT_ERRNO"}]
+	}
+}`
+
+// testTextProfile is testProfile in text format.
+const testTextProfile = `
+sentry { names: "ptrace" }
+sentry {
+	names: "ioctl"
+	args { index: 1 value: 21505 op: "SCMP_CMP_EQ" }
+}
+guest {
+	default_action: "SCMP_ACT_ALLOW"
+	syscalls { names: "getcwd" action: "SCMP_ACT_ERRNO" }
+}
+`
+
+func TestProfileTextFormat(t *testing.T) {
+	want, err := LoadProfile(strings.NewReader(testProfile))
+	if err != nil {
+		t.Fatalf("LoadProfile(JSON) failed: %v", err)
+	}
+	got, err := LoadProfile(strings.NewReader(testTextProfile))
+	if err != nil {
+		t.Fatalf("LoadProfile(text) failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("text profile = %+v, want %+v", got, want)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	p, err := LoadProfile(strings.NewReader(testProfile))
+	if err != nil {
+		t.Fatalf("LoadProfile failed: %v", err)
+	}
+
+	denyRules, err := p.SentryDenyRules()
+	if err != nil {
+		t.Fatalf("SentryDenyRules failed: %v", err)
+	}
+	instrs, err := seccomp.BuildProgram([]seccomp.RuleSet{
+		{
+			Rules:  denyRules,
+			Action: linux.SECCOMP_RET_KILL_PROCESS,
+		},
+	}, linux.SECCOMP_RET_ALLOW, linux.SECCOMP_RET_KILL_PROCESS)
+	if err != nil {
+		t.Fatalf("building sentry program: %v", err)
+	}
+	sentryProgram, err := bpf.Compile(instrs)
+	if err != nil {
+		t.Fatalf("compiling sentry program: %v", err)
+	}
+	for _, tc := range []struct {
+		name     string
+		input    bpf.Input
+		expected uint32
+	}{
+		{
+			name:     "denied",
+			input:    testInput(nativeArchAuditNo, "ptrace", nil),
+			expected: uint32(linux.SECCOMP_RET_KILL_PROCESS),
+		},
+		{
+			name:     "denied args",
+			input:    testInput(nativeArchAuditNo, "ioctl", &[6]uint64{0, 21505}),
+			expected: uint32(linux.SECCOMP_RET_KILL_PROCESS),
+		},
+		{
+			name:     "other args",
+			input:    testInput(nativeArchAuditNo, "ioctl", &[6]uint64{0, 21506}),
+			expected: uint32(linux.SECCOMP_RET_ALLOW),
+		},
+		{
+			name:     "other syscall",
+			input:    testInput(nativeArchAuditNo, "read", nil),
+			expected: uint32(linux.SECCOMP_RET_ALLOW),
+		},
+	} {
+		t.Run("sentry "+tc.name, func(t *testing.T) {
+			if err := checkProgram(sentryProgram, tc.input, tc.expected); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	guestProgram, err := p.GuestProgram()
+	if err != nil {
+		t.Fatalf("GuestProgram failed: %v", err)
+	}
+	if err := checkProgram(guestProgram, testInput(nativeArchAuditNo, "getcwd", nil), uint32(errnoAction)); err != nil {
+		t.Errorf("guest: %v", err)
+	}
+	if err := checkProgram(guestProgram, testInput(nativeArchAuditNo, "read", nil), uint32(allowAction)); err != nil {
+		t.Errorf("guest: %v", err)
+	}
+}
+
+func TestProfileInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		profile string
+	}{
+		{
+			name:    "unknown field",
+			profile: `{"host": []}`,
+		},
+		{
+			name:    "unknown syscall",
+			profile: `{"sentry": [{"names": ["not_a_syscall"]}]}`,
+		},
+		{
+			name:    "sentry action",
+			profile: `{"sentry": [{"names": ["ptrace"], "action": "SCMP_ACT_ALLOW"}]}`,
+		},
+		{
+			name:    "invalid guest action",
+			profile: `{"guest": {"defaultAction": "SCMP_ACT_BOGUS"}}`,
+		},
+		{
+			name:    "unknown text field",
+			profile: `host { names: "ptrace" }`,
+		},
+		{
+			name:    "text sentry action",
+			profile: `sentry { names: "ptrace" action: "SCMP_ACT_ALLOW" }`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := LoadProfile(strings.NewReader(tc.profile)); err == nil {
+				t.Errorf("LoadProfile(%q) succeeded, want error", tc.profile)
+			}
+		})
+	}
+}
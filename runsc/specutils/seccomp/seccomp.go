@@ -32,9 +32,11 @@ import (
 var (
 	killThreadAction = linux.SECCOMP_RET_KILL_THREAD
 	trapAction       = linux.SECCOMP_RET_TRAP
-	// runc always returns EPERM as the errorcode for SECCOMP_RET_ERRNO
+	// runc returns EPERM as the errorcode for SECCOMP_RET_ERRNO, unless
+	// errnoRet is set.
 	errnoAction = linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(unix.EPERM))
-	// runc always returns EPERM as the errorcode for SECCOMP_RET_TRACE
+	// runc returns EPERM as the errorcode for SECCOMP_RET_TRACE, unless
+	// errnoRet is set.
 	traceAction = linux.SECCOMP_RET_TRACE.WithReturnCode(uint16(unix.EPERM))
 	allowAction = linux.SECCOMP_RET_ALLOW
 )
@@ -42,7 +44,7 @@ var (
 // BuildProgram generates a bpf program based on the given OCI seccomp
 // config.
 func BuildProgram(s *specs.LinuxSeccomp) (bpf.Program, error) {
-	defaultAction, err := convertAction(s.DefaultAction)
+	defaultAction, err := convertAction(s.DefaultAction, s.DefaultErrnoRet)
 	if err != nil {
 		return bpf.Program{}, fmt.Errorf("secomp default action: %w", err)
 	}
@@ -84,8 +86,12 @@ func lookupSyscallNo(arch uint32, name string) (uint32, error) {
 	return uint32(n), nil
 }
 
-// convertAction converts a LinuxSeccompAction to BPFAction
-func convertAction(act specs.LinuxSeccompAction) (linux.BPFAction, error) {
+// convertAction converts a LinuxSeccompAction to BPFAction. errnoRet, if set,
+// overrides the errno returned by SECCOMP_RET_ERRNO and SECCOMP_RET_TRACE.
+func convertAction(act specs.LinuxSeccompAction, errnoRet *uint) (linux.BPFAction, error) {
+	if errnoRet != nil && *errnoRet > uint(linux.SECCOMP_RET_DATA) {
+		return 0, fmt.Errorf("invalid errnoRet: %d", *errnoRet)
+	}
 	// TODO(gvisor.dev/issue/3124): Update specs package to include ActLog and ActKillProcess.
 	switch act {
 	case specs.ActKill:
@@ -93,8 +99,14 @@ func convertAction(act specs.LinuxSeccompAction) (linux.BPFAction, error) {
 	case specs.ActTrap:
 		return trapAction, nil
 	case specs.ActErrno:
+		if errnoRet != nil {
+			return errnoAction.WithReturnCode(uint16(*errnoRet)), nil
+		}
 		return errnoAction, nil
 	case specs.ActTrace:
+		if errnoRet != nil {
+			return traceAction.WithReturnCode(uint16(*errnoRet)), nil
+		}
 		return traceAction, nil
 	case specs.ActAllow:
 		return allowAction, nil
@@ -115,7 +127,7 @@ func convertRules(s *specs.LinuxSeccomp) ([]seccomp.RuleSet, error) {
 	for _, syscall := range s.Syscalls {
 		sysRules := seccomp.NewSyscallRules()
 
-		action, err := convertAction(syscall.Action)
+		action, err := convertAction(syscall.Action, syscall.ErrnoRet)
 		if err != nil {
 			return nil, err
 		}
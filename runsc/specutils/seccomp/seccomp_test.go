@@ -62,6 +62,9 @@ type testCase struct {
 }
 
 var (
+	// enosysRet is used as errnoRet in test cases.
+	enosysRet = uint(unix.ENOSYS)
+
 	// seccompTests is a list of speccomp test cases.
 	seccompTests = []testCase{
 		{
@@ -121,6 +124,23 @@ var (
 			input:    testInput(nativeArchAuditNo, "getcwd", nil),
 			expected: uint32(errnoAction),
 		},
+		{
+			name: "match_name_errno_ret",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names: []string{
+							"getcwd",
+						},
+						Action:   specs.ActErrno,
+						ErrnoRet: &enosysRet,
+					},
+				},
+			},
+			input:    testInput(nativeArchAuditNo, "getcwd", nil),
+			expected: uint32(linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(enosysRet))),
+		},
 		{
 			name: "match_name_trace",
 			config: specs.LinuxSeccomp{
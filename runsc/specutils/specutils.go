@@ -175,7 +175,7 @@ func ReadSpec(bundleDir string, conf *config.Config) (*specs.Spec, error) {
 		return nil, fmt.Errorf("error opening spec file %q: %v", filepath.Join(bundleDir, "config.json"), err)
 	}
 	defer specFile.Close()
-	return ReadSpecFromFile(bundleDir, specFile, conf)
+	return readSpecFromFile(bundleDir, specFile, conf, false /* trusted */)
 }
 
 // ReadSpecFromFile reads an OCI runtime spec from the given file. It also fixes
@@ -184,7 +184,18 @@ func ReadSpec(bundleDir string, conf *config.Config) (*specs.Spec, error) {
 //     dir to them.
 //  2. Looks for flag overrides and applies them if any.
 //  3. Removes seccomp rules if `RuntimeDefault` was used.
+//  4. Injects CDI devices if enabled.
+//
+// specFile must have been opened by the parent runsc process with
+// OpenSpecForChild, since annotations that are internal to runsc are trusted.
 func ReadSpecFromFile(bundleDir string, specFile *os.File, conf *config.Config) (*specs.Spec, error) {
+	return readSpecFromFile(bundleDir, specFile, conf, true /* trusted */)
+}
+
+// readSpecFromFile implements ReadSpecFromFile. If trusted is false, the spec
+// was supplied by the user, and annotations that are internal to runsc are
+// removed.
+func readSpecFromFile(bundleDir string, specFile *os.File, conf *config.Config, trusted bool) (*specs.Spec, error) {
 	if _, err := specFile.Seek(0, io.SeekStart); err != nil {
 		return nil, fmt.Errorf("error seeking to beginning of file %q: %v", specFile.Name(), err)
 	}
@@ -199,6 +210,9 @@ func ReadSpecFromFile(bundleDir string, specFile *os.File, conf *config.Config)
 	if err := ValidateSpec(&spec); err != nil {
 		return nil, err
 	}
+	if !trusted {
+		delete(spec.Annotations, annotationCDIDevices)
+	}
 	if err := fixSpec(&spec, bundleDir, conf); err != nil {
 		return nil, err
 	}
@@ -271,6 +285,15 @@ func fixSpec(spec *specs.Spec, bundleDir string, conf *config.Config) error {
 			}
 		}
 	}
+
+	if conf.CDI {
+		if err := ApplyCDIDevices(spec, CDISpecDirs); err != nil {
+			return fmt.Errorf("injecting CDI devices: %w", err)
+		}
+	} else {
+		// Without CDI, no devices were injected by the parent.
+		delete(spec.Annotations, annotationCDIDevices)
+	}
 	return nil
 }
 
@@ -453,6 +476,19 @@ func IsGoferMount(m specs.Mount) bool {
 	return m.Type == "bind" && m.Source != ""
 }
 
+// IsVirtiofsMount returns true if the given mount is served by a virtio-fs
+// server outside of the sandbox. The mount source is the path to the server's
+// Unix domain socket.
+func IsVirtiofsMount(m specs.Mount) bool {
+	return m.Type == "virtiofs" && m.Source != ""
+}
+
+// IsNFSMount returns true if the given mount is an NFS export. The mount
+// source has the form "host:/path".
+func IsNFSMount(m specs.Mount) bool {
+	return (m.Type == "nfs" || m.Type == "nfs4") && m.Source != ""
+}
+
 // MaybeConvertToBindMount converts mount type to "bind" in case any of the
 // mount options are either "bind" or "rbind" as required by the OCI spec.
 //
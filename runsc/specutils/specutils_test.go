@@ -17,6 +17,7 @@ package specutils
 import (
 	"fmt"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -379,3 +380,172 @@ func TestSeccomp(t *testing.T) {
 		})
 	}
 }
+
+func TestSandboxGroup(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		want        string
+		wantOK      bool
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "sandbox with group",
+			annotations: map[string]string{
+				ContainerdContainerTypeAnnotation: ContainerdContainerTypeSandbox,
+				SandboxGroupAnnotation:            "tenant-a",
+			},
+			want:   "tenant-a",
+			wantOK: true,
+		},
+		{
+			name: "sandbox with empty group",
+			annotations: map[string]string{
+				ContainerdContainerTypeAnnotation: ContainerdContainerTypeSandbox,
+				SandboxGroupAnnotation:            "",
+			},
+		},
+		{
+			name: "sandbox without group",
+			annotations: map[string]string{
+				CRIOContainerTypeAnnotation: CRIOContainerTypeSandbox,
+			},
+		},
+		{
+			name: "container with group",
+			annotations: map[string]string{
+				ContainerdContainerTypeAnnotation: ContainerdContainerTypeContainer,
+				SandboxGroupAnnotation:            "tenant-a",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := &specs.Spec{Annotations: tc.annotations}
+			got, ok := SandboxGroup(spec)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("SandboxGroup() = (%q, %t), want: (%q, %t)", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestSandboxTenant(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		want        string
+		wantOK      bool
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "containerd",
+			annotations: map[string]string{
+				ContainerdSandboxNamespaceAnnotation: "team-a",
+			},
+			want:   "team-a",
+			wantOK: true,
+		},
+		{
+			name: "cri-o",
+			annotations: map[string]string{
+				CRIONamespaceAnnotation: "team-b",
+			},
+			want:   "team-b",
+			wantOK: true,
+		},
+		{
+			name: "empty namespace",
+			annotations: map[string]string{
+				ContainerdSandboxNamespaceAnnotation: "",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := &specs.Spec{Annotations: tc.annotations}
+			got, ok := SandboxTenant(spec)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("SandboxTenant() = (%q, %t), want: (%q, %t)", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestPodResources(t *testing.T) {
+	limit := int64(256 << 20)
+	quota := int64(50000)
+	period := uint64(100000)
+	shares := uint64(512)
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		want        *specs.LinuxResources
+		wantErr     bool
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "unset limits",
+			annotations: map[string]string{
+				ContainerdSandboxCPUQuotaAnnotation:  "0",
+				ContainerdSandboxCPUPeriodAnnotation: "0",
+				ContainerdSandboxCPUSharesAnnotation: "0",
+				ContainerdSandboxMemoryAnnotation:    "0",
+			},
+		},
+		{
+			name: "all limits",
+			annotations: map[string]string{
+				ContainerdSandboxCPUQuotaAnnotation:  "50000",
+				ContainerdSandboxCPUPeriodAnnotation: "100000",
+				ContainerdSandboxCPUSharesAnnotation: "512",
+				ContainerdSandboxMemoryAnnotation:    "268435456",
+			},
+			want: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Limit: &limit},
+				CPU: &specs.LinuxCPU{
+					Quota:  &quota,
+					Period: &period,
+					Shares: &shares,
+				},
+			},
+		},
+		{
+			name: "memory only",
+			annotations: map[string]string{
+				ContainerdSandboxMemoryAnnotation: "268435456",
+			},
+			want: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Limit: &limit},
+			},
+		},
+		{
+			name: "invalid",
+			annotations: map[string]string{
+				ContainerdSandboxCPUQuotaAnnotation: "lots",
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := &specs.Spec{Annotations: tc.annotations}
+			got, err := PodResources(spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("PodResources() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PodResources(): %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("PodResources() = %+v, want: %+v", got, tc.want)
+			}
+		})
+	}
+}
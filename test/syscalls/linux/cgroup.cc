@@ -47,6 +47,7 @@ using ::testing::Each;
 using ::testing::Eq;
 using ::testing::Ge;
 using ::testing::Gt;
+using ::testing::HasSubstr;
 using ::testing::Key;
 using ::testing::Not;
 
@@ -657,6 +658,20 @@ TEST(MemoryCgroup, MemoryUsageInBytes) {
   EXPECT_GE(usage, 0);
 }
 
+TEST(MemoryCgroup, MemoryStat) {
+  SKIP_IF(!CgroupsAvailable());
+
+  Mounter m(ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir()));
+  Cgroup c = ASSERT_NO_ERRNO_AND_VALUE(m.MountCgroupfs("memory"));
+  const std::string stat =
+      ASSERT_NO_ERRNO_AND_VALUE(c.ReadControlFile("memory.stat"));
+  EXPECT_THAT(stat, HasSubstr("cache "));
+  EXPECT_THAT(stat, HasSubstr("rss "));
+  EXPECT_THAT(stat, HasSubstr("shmem "));
+  EXPECT_THAT(stat, HasSubstr("total_cache "));
+  EXPECT_THAT(stat, HasSubstr("total_rss "));
+}
+
 TEST(CPUCgroup, ControlFilesHaveDefaultValues) {
   SKIP_IF(!CgroupsAvailable());
 
@@ -670,6 +685,61 @@ TEST(CPUCgroup, ControlFilesHaveDefaultValues) {
               IsPosixErrorOkAndHolds(1024));
 }
 
+TEST(CPUCgroup, SetBandwidth) {
+  SKIP_IF(!CgroupsAvailable());
+
+  Mounter m(ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir()));
+  Cgroup c = ASSERT_NO_ERRNO_AND_VALUE(m.MountCgroupfs("cpu"));
+  Cgroup child = ASSERT_NO_ERRNO_AND_VALUE(c.CreateChild("child"));
+
+  ASSERT_NO_ERRNO(child.WriteIntegerControlFile("cpu.cfs_quota_us", 50000));
+  EXPECT_THAT(child.ReadControlFile("cpu.max"),
+              IsPosixErrorOkAndHolds("50000 100000\n"));
+
+  ASSERT_NO_ERRNO(child.WriteControlFile("cpu.max", "max 200000"));
+  EXPECT_THAT(child.ReadIntegerControlFile("cpu.cfs_quota_us"),
+              IsPosixErrorOkAndHolds(-1));
+  EXPECT_THAT(child.ReadIntegerControlFile("cpu.cfs_period_us"),
+              IsPosixErrorOkAndHolds(200000));
+
+  // Periods must be between 1ms and 1s.
+  EXPECT_THAT(child.WriteIntegerControlFile("cpu.cfs_period_us", 999),
+              PosixErrorIs(EINVAL));
+  EXPECT_THAT(child.WriteIntegerControlFile("cpu.cfs_period_us", 1000001),
+              PosixErrorIs(EINVAL));
+  EXPECT_THAT(child.WriteControlFile("cpu.max", "m a x"), PosixErrorIs(EINVAL));
+
+  const std::string stat =
+      ASSERT_NO_ERRNO_AND_VALUE(child.ReadControlFile("cpu.stat"));
+  EXPECT_THAT(stat, HasSubstr("nr_periods"));
+  EXPECT_THAT(stat, HasSubstr("nr_throttled"));
+  EXPECT_THAT(stat, HasSubstr("throttled_time"));
+}
+
+TEST(MemoryCgroup, SetLimit) {
+  SKIP_IF(!CgroupsAvailable());
+
+  Mounter m(ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir()));
+  Cgroup c = ASSERT_NO_ERRNO_AND_VALUE(m.MountCgroupfs("memory"));
+  Cgroup child = ASSERT_NO_ERRNO_AND_VALUE(c.CreateChild("child"));
+
+  // Limits are rounded down to a multiple of the page size.
+  ASSERT_NO_ERRNO(child.WriteIntegerControlFile("memory.max", (1 << 30) + 1));
+  EXPECT_THAT(child.ReadIntegerControlFile("memory.limit_in_bytes"),
+              IsPosixErrorOkAndHolds(1 << 30));
+
+  ASSERT_NO_ERRNO(child.WriteControlFile("memory.max", "max"));
+  EXPECT_THAT(child.ReadControlFile("memory.max"),
+              IsPosixErrorOkAndHolds("max\n"));
+  ASSERT_NO_ERRNO(child.WriteControlFile("memory.high", "max"));
+  EXPECT_THAT(child.ReadControlFile("memory.high"),
+              IsPosixErrorOkAndHolds("max\n"));
+
+  EXPECT_THAT(child.WriteControlFile("memory.max", "-2"), PosixErrorIs(EINVAL));
+  EXPECT_THAT(child.ReadControlFile("memory.events"),
+              IsPosixErrorOkAndHolds(HasSubstr("oom_kill 0")));
+}
+
 TEST(CPUAcctCgroup, CPUAcctUsage) {
   SKIP_IF(!CgroupsAvailable());
 
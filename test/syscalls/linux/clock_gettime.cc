@@ -14,6 +14,7 @@
 
 #include <pthread.h>
 #include <sys/time.h>
+#include <sys/timex.h>
 
 #include <cerrno>
 #include <cstdint>
@@ -103,6 +104,20 @@ TEST(ClockGettime, RealtimeWorks) {
   EXPECT_THAT(clock_gettime(CLOCK_REALTIME, &tp), SyscallSucceeds());
 }
 
+// CLOCK_TAI is CLOCK_REALTIME offset by the TAI offset reported by adjtimex.
+TEST(ClockGettime, TAIIsRealtimePlusTAIOffset) {
+  struct timex tx = {};
+  ASSERT_THAT(adjtimex(&tx), SyscallSucceeds());
+
+  struct timespec realtime, tai;
+  ASSERT_THAT(clock_gettime(CLOCK_REALTIME, &realtime), SyscallSucceeds());
+  ASSERT_THAT(clock_gettime(CLOCK_TAI, &tai), SyscallSucceeds());
+  absl::Duration offset =
+      absl::TimeFromTimespec(tai) - absl::TimeFromTimespec(realtime);
+  EXPECT_GE(offset, absl::Seconds(tx.tai));
+  EXPECT_LT(offset, absl::Seconds(tx.tai + 1));
+}
+
 class MonotonicClockTest : public ::testing::TestWithParam<clockid_t> {};
 
 TEST_P(MonotonicClockTest, IsMonotonic) {
@@ -34,6 +34,8 @@
 #include "absl/strings/string_view.h"
 #include "absl/synchronization/mutex.h"
 #include "absl/types/optional.h"
+#include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
 #include "test/util/multiprocess_util.h"
@@ -325,6 +327,70 @@ TEST(ExecTest, InterpreterScriptNoPath) {
   EXPECT_EQ(execve_errno, ENOEXEC);
 }
 
+// Interpreter lines longer than 127 bytes are not truncated.
+TEST(ExecTest, InterpreterScriptLongArg) {
+  // Symlink through /tmp to ensure the path is short enough.
+  TempPath link = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateSymlinkTo(
+      GetShortTestTmpdir(), RunfilePath(kBasicWorkload)));
+
+  const std::string arg(160, 'a');
+  TempPath script = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      GetShortTestTmpdir(), absl::StrCat("#!", link.path(), " ", arg, "\n"),
+      0755));
+
+  CheckExec(script.path(), {script.path()}, {}, ArgEnvExitStatus(2, 0),
+            absl::StrCat(link.path(), "\n", arg, "\n", script.path(), "\n"));
+}
+
+// An interpreter path that doesn't fit in the first 256 bytes of the script
+// can't be executed.
+TEST(ExecTest, InterpreterScriptTruncatedPath) {
+  TempPath script = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      GetShortTestTmpdir(), absl::StrCat("#!/", std::string(300, 'a')), 0755));
+
+  int execve_errno;
+  ASSERT_NO_ERRNO_AND_VALUE(
+      ForkAndExec(script.path(), {script.path()}, {}, nullptr, &execve_errno));
+  EXPECT_EQ(execve_errno, ENOEXEC);
+}
+
+// Files with a registered binfmt_misc extension are run by its interpreter.
+TEST(ExecTest, BinfmtMiscExtension) {
+  // Registered formats are global, so don't modify them on the host.
+  SKIP_IF(!IsRunningOnGvisor());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  // Symlink through /tmp to ensure the path is short enough.
+  TempPath link = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateSymlinkTo(
+      GetShortTestTmpdir(), RunfilePath(kBasicWorkload)));
+
+  ASSERT_NO_ERRNO(SetContents("/proc/sys/fs/binfmt_misc/register",
+                              absl::StrCat(":gvisor_exec_test:E::gvtest::",
+                                           link.path(), ":")));
+  Cleanup unregister([] {
+    EXPECT_NO_ERRNO(SetContents("/proc/sys/fs/binfmt_misc/gvisor_exec_test",
+                                "-1"));
+  });
+
+  std::string status = ASSERT_NO_ERRNO_AND_VALUE(
+      GetContents("/proc/sys/fs/binfmt_misc/gvisor_exec_test"));
+  EXPECT_TRUE(absl::StartsWith(status, "enabled\n")) << status;
+  EXPECT_TRUE(absl::StrContains(status, "extension .gvtest\n")) << status;
+
+  // The file doesn't need to be executable by the interpreter, only by the
+  // caller.
+  TempPath file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetShortTestTmpdir(), "", 0755));
+  const std::string path = absl::StrCat(file.path(), ".gvtest");
+  ASSERT_THAT(rename(file.path().c_str(), path.c_str()), SyscallSucceeds());
+  TempPath renamed(path);
+
+  // Without the P flag, argv[0] is replaced by the interpreter and the file
+  // path.
+  CheckExec(path, {"REPLACED", "arg"}, {}, ArgEnvExitStatus(3, 0),
+            absl::StrCat(link.path(), "\n", path, "\narg\n"));
+}
+
 // AT_EXECFN is the path passed to execve.
 TEST(ExecTest, ExecFn) {
   // Symlink through /tmp to ensure the path is short enough.
@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <limits.h>
 #include <linux/futex.h>
 #include <linux/types.h>
 #include <sys/syscall.h>
@@ -738,6 +739,282 @@ TEST_P(PrivateAndSharedFutexTest, PITryLockConcurrency) {
   }
 }
 
+int futex_wait_requeue_pi(bool priv, std::atomic<int>* uaddr, int val,
+                          std::atomic<int>* uaddr2) {
+  int op = FUTEX_WAIT_REQUEUE_PI;
+  if (priv) {
+    op |= FUTEX_PRIVATE_FLAG;
+  }
+  return RetryEINTR(syscall)(SYS_futex, uaddr, op, val, nullptr, uaddr2, 0);
+}
+
+int futex_cmp_requeue_pi(bool priv, std::atomic<int>* uaddr, int nwake,
+                         int nrequeue, std::atomic<int>* uaddr2, int val) {
+  int op = FUTEX_CMP_REQUEUE_PI;
+  if (priv) {
+    op |= FUTEX_PRIVATE_FLAG;
+  }
+  return syscall(SYS_futex, uaddr, op, nwake, nrequeue, uaddr2, val);
+}
+
+TEST_P(PrivateAndSharedFutexTest, WaitRequeuePI_SameAddress) {
+  std::atomic<int> a(1);
+  EXPECT_THAT(futex_wait_requeue_pi(IsPrivate(), &a, 1, &a),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(PrivateAndSharedFutexTest, CmpRequeuePI_InvalidNrWake) {
+  std::atomic<int> a(1);
+  std::atomic<int> b(0);
+  EXPECT_THAT(futex_cmp_requeue_pi(IsPrivate(), &a, 2, 1, &b, 1),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(PrivateAndSharedFutexTest, WaitRequeuePI_WokenByWake) {
+  constexpr int kInitialValue = 1;
+  std::atomic<int> a(kInitialValue);
+  std::atomic<int> b(0);
+
+  DisableSave ds;
+  ScopedThread thread([&] {
+    EXPECT_THAT(futex_wait_requeue_pi(IsPrivate(), &a, kInitialValue, &b),
+                SyscallFailsWithErrno(EAGAIN));
+  });
+  absl::SleepFor(kWaiterStartupDelay);
+
+  // Change a so that if futex_wake happens before futex_wait_requeue_pi, the
+  // latter returns EAGAIN instead of hanging the test.
+  a.fetch_add(1);
+  futex_wake(IsPrivate(), &a, 1);
+}
+
+TEST_P(PrivateAndSharedFutexTest, WaitRequeuePI_CmpRequeuePI) {
+  constexpr int kInitialValue = 1;
+  std::atomic<int> a(kInitialValue);
+  std::atomic<int> b(0);
+  const bool is_priv = IsPrivate();
+
+  // Hold the PI futex so that the waiter is requeued rather than woken.
+  ASSERT_THAT(futex_lock_pi(is_priv, &b), SyscallSucceeds());
+
+  DisableSave ds;
+  ScopedThread thread([&] {
+    ASSERT_THAT(futex_wait_requeue_pi(is_priv, &a, kInitialValue, &b),
+                SyscallSucceeds());
+    // The waiter must now own the PI futex.
+    EXPECT_EQ(b.load() & FUTEX_TID_MASK, gettid());
+    EXPECT_THAT(futex_unlock_pi(is_priv, &b), SyscallSucceeds());
+  });
+  absl::SleepFor(kWaiterStartupDelay);
+
+  // Change a so that if futex_cmp_requeue_pi happens before
+  // futex_wait_requeue_pi, the latter returns EAGAIN instead of hanging the
+  // test.
+  a.fetch_add(1);
+  EXPECT_THAT(futex_cmp_requeue_pi(is_priv, &a, 1, INT_MAX, &b, a.load()),
+              SyscallSucceedsWithValue(1));
+  EXPECT_NE(b.load() & FUTEX_WAITERS, 0);
+
+  // Unlocking the PI futex hands it to the requeued waiter.
+  EXPECT_THAT(futex_unlock_pi(is_priv, &b), SyscallSucceeds());
+}
+
+#ifndef SYS_futex_waitv
+#define SYS_futex_waitv 449
+#endif
+#ifndef SYS_futex_wake
+#define SYS_futex_wake 454
+#endif
+#ifndef SYS_futex_wait
+#define SYS_futex_wait 455
+#endif
+#ifndef SYS_futex_requeue
+#define SYS_futex_requeue 456
+#endif
+
+constexpr uint32_t kFutex2SizeU32 = 0x02;
+constexpr uint32_t kFutex2Private = FUTEX_PRIVATE_FLAG;
+constexpr int kFutexWaitvMax = 128;
+
+// Equivalent to struct futex_waitv, which may be missing from older headers.
+struct futex_waitv_entry {
+  uint64_t val;
+  uint64_t uaddr;
+  uint32_t flags;
+  uint32_t reserved;
+};
+
+int futex_waitv(futex_waitv_entry* waiters, unsigned int nr,
+                const struct timespec* timeout = nullptr,
+                clockid_t clockid = CLOCK_MONOTONIC) {
+  return syscall(SYS_futex_waitv, waiters, nr, 0, timeout, clockid);
+}
+
+bool Futex2Supported(int nr) {
+  return IsRunningOnGvisor() ||
+         syscall(nr, nullptr, 0, 0, 0, nullptr, 0) >= 0 || errno != ENOSYS;
+}
+
+uint32_t Futex2Flags(bool priv) {
+  return kFutex2SizeU32 | (priv ? kFutex2Private : 0);
+}
+
+futex_waitv_entry WaitvEntry(bool priv, std::atomic<int>* uaddr, int val) {
+  return futex_waitv_entry{
+      .val = static_cast<uint32_t>(val),
+      .uaddr = reinterpret_cast<uint64_t>(uaddr),
+      .flags = Futex2Flags(priv),
+  };
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_WrongVal) {
+  SKIP_IF(!Futex2Supported(SYS_futex_waitv));
+
+  std::atomic<int> a(1);
+  std::atomic<int> b(1);
+  futex_waitv_entry waiters[] = {WaitvEntry(IsPrivate(), &a, 1),
+                                 WaitvEntry(IsPrivate(), &b, 2)};
+  EXPECT_THAT(futex_waitv(waiters, 2), SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_Timeout) {
+  SKIP_IF(!Futex2Supported(SYS_futex_waitv));
+
+  std::atomic<int> a(1);
+  futex_waitv_entry waiters[] = {WaitvEntry(IsPrivate(), &a, 1)};
+
+  MonotonicTimer timer;
+  timer.Start();
+  constexpr absl::Duration kTimeout = absl::Seconds(1);
+  struct timespec deadline;
+  ASSERT_THAT(clock_gettime(CLOCK_MONOTONIC, &deadline), SyscallSucceeds());
+  deadline = absl::ToTimespec(absl::DurationFromTimespec(deadline) + kTimeout);
+  EXPECT_THAT(futex_waitv(waiters, 1, &deadline),
+              SyscallFailsWithErrno(ETIMEDOUT));
+  EXPECT_GE(timer.Duration(), kTimeout);
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_WakeReturnsIndex) {
+  constexpr int kInitialValue = 1;
+  SKIP_IF(!Futex2Supported(SYS_futex_waitv));
+
+  std::atomic<int> a(kInitialValue);
+  std::atomic<int> b(kInitialValue);
+
+  // Prevent save/restore from interrupting futex_waitv, which will cause it
+  // to return EAGAIN instead of the expected result if futex_waitv is
+  // restarted after we change the value of b below.
+  DisableSave ds;
+  ScopedThread thread([&] {
+    futex_waitv_entry waiters[] = {WaitvEntry(IsPrivate(), &a, kInitialValue),
+                                   WaitvEntry(IsPrivate(), &b, kInitialValue)};
+    EXPECT_THAT(RetryEINTR(futex_waitv)(waiters, 2, nullptr, CLOCK_MONOTONIC),
+                SyscallSucceedsWithValue(1));
+  });
+  absl::SleepFor(kWaiterStartupDelay);
+
+  // Change b so that if futex_wake happens before futex_waitv, the latter
+  // returns EAGAIN instead of hanging the test.
+  b.fetch_add(1);
+  EXPECT_THAT(futex_wake(IsPrivate(), &b, 1), SyscallSucceedsWithValue(1));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_InvalidArguments) {
+  SKIP_IF(!Futex2Supported(SYS_futex_waitv));
+
+  std::atomic<int> a(1);
+  futex_waitv_entry waiters[kFutexWaitvMax + 1];
+  for (auto& w : waiters) {
+    w = WaitvEntry(IsPrivate(), &a, 1);
+  }
+  struct timespec timeout = {};
+
+  EXPECT_THAT(futex_waitv(waiters, 0), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(futex_waitv(waiters, kFutexWaitvMax + 1),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(syscall(SYS_futex_waitv, waiters, 1, 1, nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(futex_waitv(waiters, 1, &timeout, CLOCK_BOOTTIME),
+              SyscallFailsWithErrno(EINVAL));
+
+  waiters[0].reserved = 1;
+  EXPECT_THAT(futex_waitv(waiters, 1), SyscallFailsWithErrno(EINVAL));
+  waiters[0] = WaitvEntry(IsPrivate(), &a, 1);
+
+  waiters[0].flags &= ~kFutex2SizeU32;
+  EXPECT_THAT(futex_waitv(waiters, 1), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Futex2WaitWake) {
+  constexpr int kInitialValue = 1;
+  SKIP_IF(!Futex2Supported(SYS_futex_wait));
+
+  std::atomic<int> a(kInitialValue);
+  const uint32_t flags = Futex2Flags(IsPrivate());
+
+  // futex_wake(2), unlike FUTEX_WAKE, wakes nobody if nr is 0 and rejects
+  // negative nr.
+  EXPECT_THAT(syscall(SYS_futex_wake, &a, 0xffffffff, 0, flags),
+              SyscallSucceedsWithValue(0));
+  EXPECT_THAT(syscall(SYS_futex_wake, &a, 0xffffffff, -1, flags),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(syscall(SYS_futex_wake, &a, 0, 1, flags),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Prevent save/restore from interrupting futex_wait, which will cause it to
+  // return EAGAIN instead of the expected result if futex_wait is restarted
+  // after we change the value of a below.
+  DisableSave ds;
+  ScopedThread thread([&] {
+    EXPECT_THAT(RetryEINTR(syscall)(SYS_futex_wait, &a, kInitialValue,
+                                    0xffffffff, flags, nullptr, 0),
+                SyscallSucceedsWithValue(0));
+  });
+  absl::SleepFor(kWaiterStartupDelay);
+
+  a.fetch_add(1);
+  EXPECT_THAT(syscall(SYS_futex_wake, &a, 0xffffffff, 1, flags),
+              SyscallSucceedsWithValue(1));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Futex2Requeue) {
+  constexpr int kInitialValue = 1;
+  SKIP_IF(!Futex2Supported(SYS_futex_requeue));
+
+  std::atomic<int> a(kInitialValue);
+  std::atomic<int> b(kInitialValue);
+  const uint32_t flags = Futex2Flags(IsPrivate());
+
+  futex_waitv_entry waiters[] = {WaitvEntry(IsPrivate(), &a, kInitialValue + 1),
+                                 WaitvEntry(IsPrivate(), &b, 0)};
+  EXPECT_THAT(syscall(SYS_futex_requeue, waiters, 0, 1, 1),
+              SyscallFailsWithErrno(EAGAIN));
+  waiters[0].val = kInitialValue;
+  EXPECT_THAT(syscall(SYS_futex_requeue, waiters, 1, 1, 1),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Prevent save/restore from interrupting futex_wait, which will cause it to
+  // return EAGAIN instead of the expected result if futex_wait is restarted.
+  DisableSave ds;
+  ScopedThread thread([&] {
+    EXPECT_THAT(RetryEINTR(syscall)(SYS_futex_wait, &a, kInitialValue,
+                                    0xffffffff, flags, nullptr, 0),
+                SyscallSucceedsWithValue(0));
+  });
+  absl::SleepFor(kWaiterStartupDelay);
+
+  // Move the waiter from a to b, then wake it on b.
+  EXPECT_THAT(syscall(SYS_futex_requeue, waiters, 0, 0, 1),
+              SyscallSucceedsWithValue(1));
+  EXPECT_THAT(syscall(SYS_futex_wake, &b, 0xffffffff, 1, flags),
+              SyscallSucceedsWithValue(1));
+
+  // If the requeue raced with futex_wait, the waiter is still on a; release
+  // it rather than hanging the test.
+  a.fetch_add(1);
+  futex_wake(IsPrivate(), &a, 1);
+}
+
 // Robust mutex tests are disabled on Android because Bionic (Android's libc)
 // doesn't support robust pthread mutexes.
 #ifndef __ANDROID__
@@ -833,6 +1110,34 @@ TEST(RobustFutexTest, PthreadMutexAttr) {
   }
 }
 
+TEST(RobustFutexTest, PIMutexOwnerDiedWithWaiter) {
+  pthread_mutexattr_t attr;
+  pthread_mutex_t mtx;
+  TEST_PCHECK(pthread_mutexattr_init(&attr) == 0);
+  TEST_PCHECK(pthread_mutexattr_setrobust(&attr, PTHREAD_MUTEX_ROBUST) == 0);
+  TEST_PCHECK(pthread_mutexattr_setprotocol(&attr, PTHREAD_PRIO_INHERIT) ==
+              0);
+  TEST_PCHECK(pthread_mutex_init(&mtx, &attr) == 0);
+
+  // Start a thread to lock the mutex and exit while we are waiting for it.
+  std::atomic<bool> locked(false);
+  ScopedThread t([&] {
+    TEST_PCHECK(pthread_mutex_lock(&mtx) == 0);
+    locked = true;
+    absl::SleepFor(kWaiterStartupDelay);
+    pthread_exit(NULL);
+  });
+  while (!locked) {
+    absl::SleepFor(absl::Milliseconds(10));
+  }
+
+  // The mutex should be handed to us when its owner dies.
+  EXPECT_EQ(pthread_mutex_lock(&mtx), EOWNERDEAD);
+  EXPECT_EQ(pthread_mutex_consistent(&mtx), 0);
+  EXPECT_EQ(pthread_mutex_unlock(&mtx), 0);
+  t.Join();
+}
+
 #endif  // __ANDROID__
 
 }  // namespace
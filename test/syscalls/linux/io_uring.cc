@@ -28,11 +28,13 @@
 #include <cerrno>
 #include <cstddef>
 #include <cstdint>
+#include <memory>
 
 #include "gtest/gtest.h"
 #include "test/util/io_uring_util.h"
 #include "test/util/memory_util.h"
 #include "test/util/multiprocess_util.h"
+#include "test/util/posix_error.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
@@ -134,7 +136,7 @@ TEST(IOUringTest, UnsupportedFlags) {
 
   IOUringParams params = {};
   memset(&params, 0, sizeof(params));
-  params.flags |= IORING_SETUP_SQPOLL;
+  params.flags |= IORING_SETUP_IOPOLL;
   ASSERT_THAT(IOUringSetup(1, &params), SyscallFailsWithErrno(EINVAL));
 }
 
@@ -458,6 +460,98 @@ TEST(IOUringTest, MultiThreadedNOPTest) {
   io_uring->store_cq_head(cq_head + 4);
 }
 
+// Returns a new IOUring set up with IORING_SETUP_SQPOLL and the given poller
+// idle time.
+PosixErrorOr<std::unique_ptr<IOUring>> InitSQPollIOUring(
+    unsigned int entries, IOUringParams &params, uint32_t idle_ms) {
+  memset(&params, 0, sizeof(params));
+  params.flags = IORING_SETUP_SQPOLL;
+  params.sq_thread_idle = idle_ms;
+  int fd = IOUringSetup(entries, &params);
+  if (fd < 0) {
+    return PosixError(errno, "io_uring_setup");
+  }
+  return std::make_unique<IOUring>(FileDescriptor(fd), entries, params);
+}
+
+// Testing that io_uring_enter(2) with IORING_ENTER_GETEVENTS waits for
+// min_complete completions posted by the SQPOLL poller.
+TEST(IOUringTest, SQPollGetEventsTest) {
+  SKIP_IF(!IOUringAvailable());
+
+  IOUringParams params = {};
+  PosixErrorOr<std::unique_ptr<IOUring>> ring =
+      InitSQPollIOUring(1, params, 1000);
+  // Older Linux kernels only allow privileged SQPOLL rings.
+  SKIP_IF(!ring.ok() && ring.error().errno_value() == EPERM);
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(std::move(ring));
+
+  IOUringSqe *sqe = io_uring->get_sqes();
+  sqe->opcode = IORING_OP_NOP;
+  sqe->user_data = 42;
+
+  uint32_t sq_tail = io_uring->load_sq_tail();
+  io_uring->store_sq_tail(sq_tail + 1);
+
+  int ret = io_uring->Enter(1, 1, IORING_ENTER_GETEVENTS, nullptr);
+  ASSERT_EQ(ret, 1);
+
+  uint32_t cq_tail = io_uring->load_cq_tail();
+  ASSERT_EQ(cq_tail, 1);
+
+  IOUringCqe *cqe = io_uring->get_cqes();
+  ASSERT_EQ(cqe->user_data, 42);
+  ASSERT_EQ(cqe->res, 0);
+
+  uint32_t cq_head = io_uring->load_cq_head();
+  io_uring->store_cq_head(cq_head + 1);
+}
+
+// Testing that an idle SQPOLL poller sets IORING_SQ_NEED_WAKEUP and resumes
+// processing submissions after IORING_ENTER_SQ_WAKEUP.
+TEST(IOUringTest, SQPollNeedWakeupTest) {
+  SKIP_IF(!IOUringAvailable());
+
+  IOUringParams params = {};
+  PosixErrorOr<std::unique_ptr<IOUring>> ring =
+      InitSQPollIOUring(1, params, 10);
+  // Older Linux kernels only allow privileged SQPOLL rings.
+  SKIP_IF(!ring.ok() && ring.error().errno_value() == EPERM);
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(std::move(ring));
+
+  // Wait for the poller to go idle.
+  for (int i = 0; i < 1000; i++) {
+    if (io_uring->load_sq_flags() & IORING_SQ_NEED_WAKEUP) {
+      break;
+    }
+    usleep(10 * 1000);
+  }
+  ASSERT_TRUE(io_uring->load_sq_flags() & IORING_SQ_NEED_WAKEUP);
+
+  IOUringSqe *sqe = io_uring->get_sqes();
+  sqe->opcode = IORING_OP_NOP;
+  sqe->user_data = 42;
+
+  uint32_t sq_tail = io_uring->load_sq_tail();
+  io_uring->store_sq_tail(sq_tail + 1);
+
+  int ret = io_uring->Enter(
+      1, 1, IORING_ENTER_SQ_WAKEUP | IORING_ENTER_GETEVENTS, nullptr);
+  ASSERT_EQ(ret, 1);
+
+  uint32_t cq_tail = io_uring->load_cq_tail();
+  ASSERT_EQ(cq_tail, 1);
+
+  IOUringCqe *cqe = io_uring->get_cqes();
+  ASSERT_EQ(cqe->user_data, 42);
+  ASSERT_EQ(cqe->res, 0);
+
+  uint32_t cq_head = io_uring->load_cq_head();
+  io_uring->store_cq_head(cq_head + 1);
+}
+
 // Testing that io_uring_enter(2) successfully consumes submission with an
 // invalid opcode and returned CQE contains EINVAL in its result field.
 TEST(IOUringTest, InvalidOpCodeTest) {
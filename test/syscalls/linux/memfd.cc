@@ -18,6 +18,7 @@
 #include <linux/unistd.h>
 #include <string.h>
 #include <sys/mman.h>
+#include <sys/stat.h>
 #include <sys/syscall.h>
 
 #include <vector>
@@ -50,6 +51,20 @@ namespace {
 #define F_SEAL_SHRINK 0x0002
 #define F_SEAL_GROW 0x0004
 #define F_SEAL_WRITE 0x0008
+#define F_SEAL_FUTURE_WRITE 0x0010
+#define F_SEAL_EXEC 0x0020
+
+#ifndef MFD_NOEXEC_SEAL
+#define MFD_NOEXEC_SEAL 0x0008U
+#endif /* MFD_NOEXEC_SEAL */
+
+#ifndef MFD_EXEC
+#define MFD_EXEC 0x0010U
+#endif /* MFD_EXEC */
+
+#ifndef __NR_memfd_secret
+#define __NR_memfd_secret 447
+#endif /* __NR_memfd_secret */
 
 using ::gvisor::testing::IsTmpfs;
 using ::testing::StartsWith;
@@ -538,6 +553,111 @@ TEST(MemfdTest, MultipleWritableAndNonWritableRefsToSameFileRegion) {
   m2.reset();
 }
 
+// F_SEAL_FUTURE_WRITE prevents writes and new shared writable mappings, but
+// not new private mappings.
+TEST(MemfdTest, SealFutureWrite) {
+  const FileDescriptor memfd =
+      ASSERT_NO_ERRNO_AND_VALUE(MemfdCreate(kMemfdName, MFD_ALLOW_SEALING));
+  ASSERT_THAT(ftruncate(memfd.get(), kPageSize), SyscallSucceeds());
+  ASSERT_THAT(fcntl(memfd.get(), F_ADD_SEALS, F_SEAL_FUTURE_WRITE),
+              SyscallSucceeds());
+
+  char c = 'a';
+  EXPECT_THAT(write(memfd.get(), &c, 1), SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(reinterpret_cast<uintptr_t>(mmap(nullptr, kPageSize,
+                                               PROT_READ | PROT_WRITE,
+                                               MAP_SHARED, memfd.get(), 0)),
+              SyscallFailsWithErrno(EPERM));
+
+  // A read-only shared mapping can't be made writable.
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, kPageSize, PROT_READ, MAP_SHARED, memfd.get(), 0));
+  EXPECT_THAT(mprotect(m.ptr(), kPageSize, PROT_READ | PROT_WRITE),
+              SyscallFailsWithErrno(EACCES));
+
+  ASSERT_NO_ERRNO(Mmap(nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE,
+                       memfd.get(), 0));
+}
+
+// Unknown seals are rejected.
+TEST(MemfdTest, UnknownSeal) {
+  const FileDescriptor memfd =
+      ASSERT_NO_ERRNO_AND_VALUE(MemfdCreate(kMemfdName, MFD_ALLOW_SEALING));
+  EXPECT_THAT(fcntl(memfd.get(), F_ADD_SEALS, 0x8000),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// MFD_NOEXEC_SEAL creates a non-executable memfd sealed with F_SEAL_EXEC.
+TEST(MemfdTest, NoexecSeal) {
+  int fd = memfd_create(kMemfdName, MFD_NOEXEC_SEAL);
+  // Linux < 6.3 doesn't support MFD_NOEXEC_SEAL.
+  SKIP_IF(fd < 0 && errno == EINVAL);
+  ASSERT_THAT(fd, SyscallSucceeds());
+  const FileDescriptor memfd(fd);
+
+  struct stat st;
+  ASSERT_THAT(fstat(memfd.get(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_mode & 0777, 0666);
+  EXPECT_THAT(fcntl(memfd.get(), F_GET_SEALS),
+              SyscallSucceedsWithValue(F_SEAL_EXEC));
+  EXPECT_THAT(fchmod(memfd.get(), 0777), SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(fchmod(memfd.get(), 0644), SyscallSucceeds());
+
+  EXPECT_THAT(memfd_create(kMemfdName, MFD_NOEXEC_SEAL | MFD_EXEC),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// F_SEAL_EXEC on an executable memfd also seals it against writes.
+TEST(MemfdTest, SealExecOnExecutableImpliesWriteSeals) {
+  int fd = memfd_create(kMemfdName, MFD_ALLOW_SEALING | MFD_EXEC);
+  // Linux < 6.3 doesn't support MFD_EXEC.
+  SKIP_IF(fd < 0 && errno == EINVAL);
+  ASSERT_THAT(fd, SyscallSucceeds());
+  const FileDescriptor memfd(fd);
+
+  ASSERT_THAT(fcntl(memfd.get(), F_ADD_SEALS, F_SEAL_EXEC), SyscallSucceeds());
+  EXPECT_THAT(fcntl(memfd.get(), F_GET_SEALS),
+              SyscallSucceedsWithValue(F_SEAL_EXEC | F_SEAL_SHRINK |
+                                       F_SEAL_GROW | F_SEAL_WRITE |
+                                       F_SEAL_FUTURE_WRITE));
+  EXPECT_THAT(fchmod(memfd.get(), 0666), SyscallFailsWithErrno(EPERM));
+}
+
+TEST(MemfdSecretTest, Basic) {
+  int fd = syscall(__NR_memfd_secret, 0);
+  // memfd_secret is disabled by default on both Linux and gVisor.
+  SKIP_IF(fd < 0 && errno == ENOSYS);
+  ASSERT_THAT(fd, SyscallSucceeds());
+  const FileDescriptor memfd(fd);
+
+  ASSERT_THAT(ftruncate(memfd.get(), kPageSize), SyscallSucceeds());
+  // The size can only be set once.
+  EXPECT_THAT(ftruncate(memfd.get(), 2 * kPageSize),
+              SyscallFailsWithErrno(EINVAL));
+
+  EXPECT_THAT(reinterpret_cast<uintptr_t>(mmap(nullptr, kPageSize,
+                                               PROT_READ | PROT_WRITE,
+                                               MAP_PRIVATE, memfd.get(), 0)),
+              SyscallFailsWithErrno(EINVAL));
+
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(Mmap(
+      nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED, memfd.get(), 0));
+  Mapping m2 = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, kPageSize, PROT_READ, MAP_SHARED, memfd.get(), 0));
+  *reinterpret_cast<volatile char*>(m.ptr()) = 'a';
+  EXPECT_EQ(*reinterpret_cast<volatile char*>(m2.ptr()), 'a');
+
+  char c;
+  EXPECT_THAT(read(memfd.get(), &c, 1), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(write(memfd.get(), &c, 1), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MemfdSecretTest, InvalidFlags) {
+  int fd = syscall(__NR_memfd_secret, O_NONBLOCK);
+  SKIP_IF(fd < 0 && errno == ENOSYS);
+  EXPECT_THAT(fd, SyscallFailsWithErrno(EINVAL));
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -60,6 +60,11 @@ int mbind(void* addr, unsigned long len, int mode,
   return syscall(SYS_mbind, addr, len, mode, nodemask, maxnode, flags);
 }
 
+long move_pages(int pid, unsigned long count, void** pages, const int* nodes,
+                int* status, int flags) {
+  return syscall(SYS_move_pages, pid, count, pages, nodes, status, flags);
+}
+
 // Creates a cleanup object that resets the calling thread's mempolicy to the
 // system default when the calling scope ends.
 Cleanup ScopedMempolicy() {
@@ -289,6 +294,39 @@ TEST(MempolicyTest, Mbind) {
   EXPECT_EQ(mode, MPOL_PREFERRED);
 }
 
+TEST(MempolicyTest, MovePages) {
+  const auto mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  void* pages[2] = {mapping.ptr(),
+                    reinterpret_cast<char*>(mapping.ptr()) + kPageSize};
+  // Only fault in the first page.
+  *reinterpret_cast<volatile char*>(pages[0]) = 1;
+
+  int status[2] = {-1, -1};
+  ASSERT_THAT(move_pages(0, 2, pages, nullptr, status, 0), SyscallSucceeds());
+  // If we're not running on gvisor, the page may be allocated on a different
+  // numa node.
+  if (IsRunningOnGvisor()) {
+    EXPECT_EQ(status[0], 0);
+  }
+  EXPECT_GE(status[0], 0);
+  EXPECT_EQ(status[1], -ENOENT);
+
+  // Move the faulted-in page to node 0, which always exists.
+  const int nodes[1] = {0};
+  status[0] = -1;
+  ASSERT_THAT(move_pages(0, 1, pages, nodes, status, MPOL_MF_MOVE),
+              SyscallSucceeds());
+  EXPECT_EQ(status[0], 0);
+
+  // Invalid flags and nodes.
+  EXPECT_THAT(move_pages(0, 1, pages, nodes, status, MPOL_MF_STRICT),
+              SyscallFailsWithErrno(EINVAL));
+  const int bad_nodes[1] = {-1};
+  EXPECT_THAT(move_pages(0, 1, pages, bad_nodes, status, MPOL_MF_MOVE),
+              SyscallFailsWithErrno(ENODEV));
+}
+
 }  // namespace
 
 }  // namespace testing
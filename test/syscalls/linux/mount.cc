@@ -21,10 +21,12 @@
 #include <sys/eventfd.h>
 #include <sys/mman.h>
 #include <sys/mount.h>
+#include <sys/quota.h>
 #include <sys/resource.h>
 #include <sys/signalfd.h>
 #include <sys/stat.h>
 #include <sys/statfs.h>
+#include <sys/syscall.h>
 #include <sys/vfs.h>
 #include <unistd.h>
 
@@ -75,6 +77,9 @@ using ::testing::AnyOf;
 using ::testing::Contains;
 using ::testing::Pair;
 
+// QFMT_SHMEM from include/uapi/linux/quota.h.
+constexpr uint32_t kQfmtShmem = 5;
+
 TEST(MountTest, MountBadFilesystem) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
 
@@ -805,6 +810,79 @@ TEST(MountTest, TmpfsSizeMmap) {
   EXPECT_THAT(munmap(addr, 2 * kPageSize), SyscallSucceeds());
 }
 
+TEST(MountTest, TmpfsQuotaFormat) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", 0, "usrquota", 0));
+
+  uint32_t fmt = 0;
+  ASSERT_THAT(quotactl(QCMD(Q_GETFMT, USRQUOTA), dir.path().c_str(), 0,
+                       reinterpret_cast<caddr_t>(&fmt)),
+              SyscallSucceeds());
+  EXPECT_EQ(fmt, kQfmtShmem);
+
+  // Group quotas were not enabled.
+  EXPECT_THAT(quotactl(QCMD(Q_GETFMT, GRPQUOTA), dir.path().c_str(), 0,
+                       reinterpret_cast<caddr_t>(&fmt)),
+              SyscallFailsWithErrno(ESRCH));
+}
+
+TEST(MountTest, TmpfsQuotaBlockLimit) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", 0, "usrquota", 0));
+
+  struct dqblk dq = {};
+  dq.dqb_bhardlimit = 2 * kPageSize / 1024;
+  dq.dqb_valid = QIF_BLIMITS;
+  ASSERT_THAT(quotactl(QCMD(Q_SETQUOTA, USRQUOTA), dir.path().c_str(),
+                       getuid(), reinterpret_cast<caddr_t>(&dq)),
+              SyscallSucceeds());
+
+  // Holders of CAP_SYS_RESOURCE are not subject to quota limits.
+  AutoCapability cap(CAP_SYS_RESOURCE, false);
+  auto fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir.path(), "foo"), O_CREAT | O_RDWR, 0777));
+  ASSERT_THAT(fallocate(fd.get(), 0, 0, 2 * kPageSize), SyscallSucceeds());
+  EXPECT_THAT(fallocate(fd.get(), 0, 0, 3 * kPageSize),
+              SyscallFailsWithErrno(EDQUOT));
+
+  struct dqblk got = {};
+  ASSERT_THAT(quotactl(QCMD(Q_GETQUOTA, USRQUOTA), dir.path().c_str(),
+                       getuid(), reinterpret_cast<caddr_t>(&got)),
+              SyscallSucceeds());
+  EXPECT_EQ(got.dqb_bhardlimit, 2 * kPageSize / 1024);
+  EXPECT_EQ(got.dqb_curspace, 2 * kPageSize);
+  // The root directory and foo.
+  EXPECT_EQ(got.dqb_curinodes, 2);
+
+  // Releasing the file releases its usage.
+  ASSERT_THAT(ftruncate(fd.get(), 0), SyscallSucceeds());
+  ASSERT_THAT(quotactl(QCMD(Q_GETQUOTA, USRQUOTA), dir.path().c_str(),
+                       getuid(), reinterpret_cast<caddr_t>(&got)),
+              SyscallSucceeds());
+  EXPECT_EQ(got.dqb_curspace, 0);
+}
+
+TEST(MountTest, TmpfsQuotaInodeLimit) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", 0, "usrquota,usrquota_inode_hardlimit=3",
+            0));
+
+  // The root directory is charged to its owner as well.
+  AutoCapability cap(CAP_SYS_RESOURCE, false);
+  ASSERT_NO_ERRNO(Open(JoinPath(dir.path(), "a"), O_CREAT | O_RDWR, 0777));
+  ASSERT_NO_ERRNO(Open(JoinPath(dir.path(), "b"), O_CREAT | O_RDWR, 0777));
+  EXPECT_THAT(open(JoinPath(dir.path(), "c").c_str(), O_CREAT | O_RDWR, 0777),
+              SyscallFailsWithErrno(EDQUOT));
+  EXPECT_THAT(mkdir(JoinPath(dir.path(), "d").c_str(), 0777),
+              SyscallFailsWithErrno(EDQUOT));
+}
+
 TEST(MountTest, SimpleBind) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
 
@@ -2177,6 +2255,150 @@ TEST(MountTest, MountFailsOnPseudoFilesystemMountpoint) {
               SyscallFailsWithErrno(EINVAL));
 }
 
+// The new mount API is missing from older libc headers.
+#ifndef SYS_open_tree
+#define SYS_open_tree 428
+#define SYS_move_mount 429
+#define SYS_fsopen 430
+#define SYS_fsconfig 431
+#define SYS_fsmount 432
+#endif
+
+constexpr unsigned int kFsconfigSetFlag = 0;
+constexpr unsigned int kFsconfigSetString = 1;
+constexpr unsigned int kFsconfigCmdCreate = 6;
+constexpr unsigned int kMountAttrRdonly = 0x1;
+constexpr unsigned int kOpenTreeClone = 0x1;
+constexpr unsigned int kAtRecursive = 0x8000;
+constexpr unsigned int kMoveMountFEmptyPath = 0x4;
+
+PosixErrorOr<FileDescriptor> FsmountTmpfs(const std::string& size,
+                                          unsigned int attr) {
+  int fsfd = syscall(SYS_fsopen, "tmpfs", 0);
+  if (fsfd < 0) {
+    return PosixError(errno, "fsopen");
+  }
+  FileDescriptor fs(fsfd);
+  if (syscall(SYS_fsconfig, fs.get(), kFsconfigSetString, "size",
+              size.c_str(), 0) < 0) {
+    return PosixError(errno, "fsconfig(size)");
+  }
+  if (syscall(SYS_fsconfig, fs.get(), kFsconfigCmdCreate, nullptr, nullptr,
+              0) < 0) {
+    return PosixError(errno, "fsconfig(FSCONFIG_CMD_CREATE)");
+  }
+  int mntfd = syscall(SYS_fsmount, fs.get(), 0, attr);
+  if (mntfd < 0) {
+    return PosixError(errno, "fsmount");
+  }
+  return FileDescriptor(mntfd);
+}
+
+TEST(MountTest, FsmountAndMoveMount) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+
+  auto const mnt = ASSERT_NO_ERRNO_AND_VALUE(FsmountTmpfs("1m", 0));
+  // The detached mount can be used before it is attached.
+  ASSERT_THAT(mkdirat(mnt.get(), "foo", 0777), SyscallSucceeds());
+
+  ASSERT_THAT(syscall(SYS_move_mount, mnt.get(), "", AT_FDCWD,
+                      dir.path().c_str(), kMoveMountFEmptyPath),
+              SyscallSucceeds());
+  struct stat st;
+  EXPECT_THAT(stat(JoinPath(dir.path(), "foo").c_str(), &st),
+              SyscallSucceeds());
+  struct statfs sfs;
+  ASSERT_THAT(statfs(dir.path().c_str(), &sfs), SyscallSucceeds());
+  EXPECT_EQ(sfs.f_type, TMPFS_MAGIC);
+
+  // The mount can't be attached twice.
+  auto const dir2 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  EXPECT_THAT(syscall(SYS_move_mount, mnt.get(), "", AT_FDCWD,
+                      dir2.path().c_str(), kMoveMountFEmptyPath),
+              SyscallFailsWithErrno(EINVAL));
+
+  EXPECT_THAT(umount2(dir.path().c_str(), MNT_DETACH), SyscallSucceeds());
+}
+
+TEST(MountTest, FsmountReadonly) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const mnt =
+      ASSERT_NO_ERRNO_AND_VALUE(FsmountTmpfs("1m", kMountAttrRdonly));
+  EXPECT_THAT(mkdirat(mnt.get(), "foo", 0777), SyscallFailsWithErrno(EROFS));
+}
+
+TEST(MountTest, FsconfigErrors) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  EXPECT_THAT(syscall(SYS_fsopen, "nonexistentfs", 0),
+              SyscallFailsWithErrno(ENODEV));
+
+  int fsfd;
+  ASSERT_THAT(fsfd = syscall(SYS_fsopen, "tmpfs", 0), SyscallSucceeds());
+  FileDescriptor fs(fsfd);
+  // A flag takes no value.
+  EXPECT_THAT(
+      syscall(SYS_fsconfig, fs.get(), kFsconfigSetFlag, "ro", "x", 0),
+      SyscallFailsWithErrno(EINVAL));
+  // The filesystem must be created before it is mounted.
+  EXPECT_THAT(syscall(SYS_fsmount, fs.get(), 0, 0),
+              SyscallFailsWithErrno(EBUSY));
+  // Only filesystem contexts can be configured.
+  auto const efd = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD(0, 0));
+  EXPECT_THAT(syscall(SYS_fsconfig, efd.get(), kFsconfigCmdCreate, nullptr,
+                      nullptr, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MountTest, FsopenPermDenied) {
+  // Clear CAP_SYS_ADMIN.
+  AutoCapability cap(CAP_SYS_ADMIN, false);
+  EXPECT_THAT(syscall(SYS_fsopen, "tmpfs", 0), SyscallFailsWithErrno(EPERM));
+}
+
+TEST(MountTest, OpenTreeClone) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const src = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const dst = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const src_mnt = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", src.path(), "tmpfs", 0, "", MNT_DETACH));
+  auto const file =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileIn(src.path()));
+
+  int treefd;
+  ASSERT_THAT(treefd = syscall(SYS_open_tree, AT_FDCWD, src.path().c_str(),
+                               kOpenTreeClone | kAtRecursive | O_CLOEXEC),
+              SyscallSucceeds());
+  FileDescriptor tree(treefd);
+  ASSERT_THAT(syscall(SYS_move_mount, tree.get(), "", AT_FDCWD,
+                      dst.path().c_str(), kMoveMountFEmptyPath),
+              SyscallSucceeds());
+  struct stat st;
+  EXPECT_THAT(stat(JoinPath(dst.path(), Basename(file.path())).c_str(), &st),
+              SyscallSucceeds());
+  EXPECT_THAT(umount2(dst.path().c_str(), MNT_DETACH), SyscallSucceeds());
+}
+
+TEST(MountTest, OpenTreeWithoutClone) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const dst = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+
+  // AT_RECURSIVE requires OPEN_TREE_CLONE.
+  EXPECT_THAT(
+      syscall(SYS_open_tree, AT_FDCWD, dir.path().c_str(), kAtRecursive),
+      SyscallFailsWithErrno(EINVAL));
+
+  int pathfd;
+  ASSERT_THAT(pathfd = syscall(SYS_open_tree, AT_FDCWD, dir.path().c_str(), 0),
+              SyscallSucceeds());
+  FileDescriptor fd(pathfd);
+  // An attached mount can't be moved.
+  EXPECT_THAT(syscall(SYS_move_mount, fd.get(), "", AT_FDCWD,
+                      dst.path().c_str(), kMoveMountFEmptyPath),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 }  // namespace
 
 }  // namespace testing
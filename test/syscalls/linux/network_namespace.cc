@@ -13,11 +13,14 @@
 // limitations under the License.
 
 #include <sys/mount.h>
+#include <sys/socket.h>
+#include <sys/un.h>
 
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
 #include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
@@ -90,6 +93,45 @@ TEST(NetworkNamespaceTest, BindMount) {
   ASSERT_NE(ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex()), 0);
 }
 
+TEST(NetworkNamespaceTest, AbstractUnixSocketsAreIsolated) {
+  // TODO(b/267210840): Fix this tests for hostinet.
+  SKIP_IF(IsRunningWithHostinet());
+
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  struct sockaddr_un addr = {};
+  addr.sun_family = AF_UNIX;
+  constexpr char kName[] = "network_namespace_test";
+  memcpy(addr.sun_path + 1, kName, sizeof(kName) - 1);
+  const socklen_t addrlen = offsetof(struct sockaddr_un, sun_path) + 1 +
+                            sizeof(kName) - 1;
+
+  const FileDescriptor server =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+  ASSERT_THAT(
+      bind(server.get(), reinterpret_cast<struct sockaddr*>(&addr), addrlen),
+      SyscallSucceeds());
+  ASSERT_THAT(listen(server.get(), 1), SyscallSucceeds());
+
+  ScopedThread t([&] {
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceedsWithValue(0));
+
+    // The name bound in the parent namespace isn't visible here.
+    const FileDescriptor client =
+        ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+    ASSERT_THAT(connect(client.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                        addrlen),
+                SyscallFailsWithErrno(ECONNREFUSED));
+
+    // So it can be bound again.
+    const FileDescriptor other =
+        ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+    ASSERT_THAT(
+        bind(other.get(), reinterpret_cast<struct sockaddr*>(&addr), addrlen),
+        SyscallSucceeds());
+  });
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
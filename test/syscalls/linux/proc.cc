@@ -31,6 +31,7 @@
 #include <sys/statfs.h>
 #include <sys/utsname.h>
 #include <syscall.h>
+#include <time.h>
 #include <unistd.h>
 
 #include <algorithm>
@@ -1490,6 +1491,30 @@ TEST(ProcLoadavg, Fields) {
   EXPECT_TRUE(absl::SimpleAtoi(fields[5], &val2)) << proc_loadvg;
 }
 
+TEST(ProcPressure, Format) {
+  for (const char* resource : {"cpu", "io", "memory"}) {
+    const std::string path = absl::StrCat("/proc/pressure/", resource);
+    // PSI may be disabled on Linux.
+    SKIP_IF(!IsRunningOnGvisor() && access(path.c_str(), R_OK) != 0);
+    std::string contents = ASSERT_NO_ERRNO_AND_VALUE(GetContents(path));
+    std::vector<std::string> lines =
+        absl::StrSplit(contents, '\n', absl::SkipEmpty());
+    // Linux before 5.13 has no "full" line for cpu.
+    if (IsRunningOnGvisor() || strcmp(resource, "cpu") != 0) {
+      ASSERT_EQ(lines.size(), 2) << contents;
+      EXPECT_TRUE(absl::StartsWith(lines[1], "full ")) << contents;
+    }
+    ASSERT_GE(lines.size(), 1) << contents;
+    EXPECT_TRUE(absl::StartsWith(lines[0], "some ")) << contents;
+    const std::regex re(
+        "(some|full) avg10=[0-9]+\\.[0-9]{2} avg60=[0-9]+\\.[0-9]{2} "
+        "avg300=[0-9]+\\.[0-9]{2} total=[0-9]+");
+    for (const std::string& line : lines) {
+      EXPECT_TRUE(std::regex_match(line, re)) << line;
+    }
+  }
+}
+
 // NOTE: Tests in priority.cc also check certain priority related fields in
 // /proc/self/stat.
 
@@ -1572,6 +1597,40 @@ TEST_P(ProcPidStatmTest, HasBasicFields) {
 INSTANTIATE_TEST_SUITE_P(SelfAndNumericPid, ProcPidStatmTest,
                          ::testing::Values("self", absl::StrCat(getpid())));
 
+PosixErrorOr<uint64_t> ThreadSchedstatRuntime() {
+  ASSIGN_OR_RETURN_ERRNO(
+      auto schedstat,
+      GetContents(absl::StrCat("/proc/self/task/", gettid(), "/schedstat")));
+  std::vector<std::string> fields =
+      absl::StrSplit(schedstat, ' ', absl::SkipWhitespace());
+  if (fields.size() != 3) {
+    return PosixError(EINVAL, absl::StrCat("malformed schedstat: ", schedstat));
+  }
+  uint64_t runtime;
+  if (!absl::SimpleAtoi(fields[0], &runtime)) {
+    return PosixError(EINVAL, absl::StrCat("malformed runtime: ", fields[0]));
+  }
+  return runtime;
+}
+
+TEST(ProcPidSchedstat, RuntimeHasHighResolution) {
+  const uint64_t before = ASSERT_NO_ERRNO_AND_VALUE(ThreadSchedstatRuntime());
+
+  // Burn much less CPU time than a clock tick.
+  struct timespec start, now;
+  ASSERT_THAT(clock_gettime(CLOCK_THREAD_CPUTIME_ID, &start),
+              SyscallSucceeds());
+  do {
+    ASSERT_THAT(clock_gettime(CLOCK_THREAD_CPUTIME_ID, &now),
+                SyscallSucceeds());
+  } while (absl::DurationFromTimespec(now) -
+               absl::DurationFromTimespec(start) <
+           absl::Microseconds(500));
+
+  const uint64_t after = ASSERT_NO_ERRNO_AND_VALUE(ThreadSchedstatRuntime());
+  EXPECT_GE(after - before, 500 * 1000);
+}
+
 PosixErrorOr<uint64_t> CurrentRSS() {
   ASSIGN_OR_RETURN_ERRNO(auto proc_self_stat, GetContents("/proc/self/stat"));
   if (proc_self_stat.empty()) {
@@ -2583,6 +2642,26 @@ TEST(ProcSysKernelHostname, MatchesUname) {
   EXPECT_EQ(procfs_hostname, hostname);
 }
 
+TEST(ProcSysKernelPidMax, HasNumericValue) {
+  const std::string val_str =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/kernel/pid_max"));
+  int32_t val;
+  EXPECT_TRUE(absl::SimpleAtoi(val_str, &val))
+      << "/proc/sys/kernel/pid_max does not contain a numeric value: "
+      << val_str;
+  EXPECT_GT(val, 0);
+}
+
+TEST(ProcSysKernelThreadsMax, HasNumericValue) {
+  const std::string val_str =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/kernel/threads-max"));
+  int32_t val;
+  EXPECT_TRUE(absl::SimpleAtoi(val_str, &val))
+      << "/proc/sys/kernel/threads-max does not contain a numeric value: "
+      << val_str;
+  EXPECT_GT(val, 0);
+}
+
 TEST(ProcSysVmMaxmapCount, HasNumericValue) {
   const std::string val_str =
       ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sys/vm/max_map_count"));
@@ -12,8 +12,12 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <fcntl.h>
 #include <stddef.h>
 #include <stdint.h>
+#include <string.h>
+#include <sys/mman.h>
+#include <unistd.h>
 
 #include <algorithm>
 #include <iostream>
@@ -22,6 +26,8 @@
 #include <vector>
 
 #include "absl/container/flat_hash_set.h"
+#include "absl/strings/match.h"
+#include "absl/strings/numbers.h"
 #include "absl/strings/str_cat.h"
 #include "absl/strings/str_format.h"
 #include "absl/strings/str_split.h"
@@ -178,6 +184,112 @@ TEST(ProcPidSmapsTest, GvisorFields) {
   }
 }
 
+// Returns the value of the field with the given name, in kB, from the contents
+// of /proc/[pid]/smaps_rollup.
+PosixErrorOr<size_t> SmapsRollupField(absl::string_view contents,
+                                      absl::string_view name) {
+  for (absl::string_view line : absl::StrSplit(contents, '\n')) {
+    std::vector<absl::string_view> parts =
+        absl::StrSplit(line, ' ', absl::SkipEmpty());
+    if (parts.size() == 3 && parts[0] == absl::StrCat(name, ":") &&
+        parts[2] == "kB") {
+      size_t value;
+      if (!absl::SimpleAtoi(parts[1], &value)) {
+        return PosixError(EINVAL, absl::StrCat("invalid value: ", line));
+      }
+      return value;
+    }
+  }
+  return PosixError(ENOENT, absl::StrCat("field not found: ", name));
+}
+
+TEST(ProcPidSmapsTest, Rollup) {
+  // Map with MAP_POPULATE and touch the pages so we get some RSS.
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(4 * kPageSize, PROT_READ | PROT_WRITE,
+               MAP_PRIVATE | MAP_POPULATE));
+  memset(m.ptr(), 1, m.len());
+
+  std::string const contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/self/smaps_rollup"));
+  std::vector<absl::string_view> const lines =
+      absl::StrSplit(contents, '\n', absl::SkipEmpty());
+  ASSERT_FALSE(lines.empty());
+  EXPECT_TRUE(absl::EndsWith(lines[0], "[rollup]")) << lines[0];
+
+  size_t const rss =
+      ASSERT_NO_ERRNO_AND_VALUE(SmapsRollupField(contents, "Rss"));
+  size_t const pss =
+      ASSERT_NO_ERRNO_AND_VALUE(SmapsRollupField(contents, "Pss"));
+  size_t const anon =
+      ASSERT_NO_ERRNO_AND_VALUE(SmapsRollupField(contents, "Anonymous"));
+  EXPECT_GE(rss, m.len() / 1024);
+  EXPECT_LE(pss, rss);
+  EXPECT_GE(anon, m.len() / 1024);
+  EXPECT_LE(anon, rss);
+}
+
+constexpr uint64_t kPagemapPresent = uint64_t{1} << 63;
+constexpr uint64_t kPagemapFile = uint64_t{1} << 61;
+constexpr uint64_t kPagemapExclusive = uint64_t{1} << 56;
+
+// Returns the /proc/self/pagemap entry for the page containing addr.
+PosixErrorOr<uint64_t> PagemapEntry(int fd, uintptr_t addr) {
+  uint64_t entry;
+  off_t const offset = (addr / kPageSize) * sizeof(entry);
+  int const ret = pread(fd, &entry, sizeof(entry), offset);
+  if (ret < 0) {
+    return PosixError(errno, "pread");
+  }
+  if (ret != sizeof(entry)) {
+    return PosixError(EIO, absl::StrCat("short read: ", ret));
+  }
+  return entry;
+}
+
+TEST(ProcPidPagemapTest, PrivateAnon) {
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  // Only touch the first page.
+  *reinterpret_cast<volatile char*>(m.ptr()) = 1;
+
+  FileDescriptor const fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/proc/self/pagemap", O_RDONLY));
+  uint64_t const touched =
+      ASSERT_NO_ERRNO_AND_VALUE(PagemapEntry(fd.get(), m.addr()));
+  EXPECT_NE(touched & kPagemapPresent, 0);
+  EXPECT_NE(touched & kPagemapExclusive, 0);
+  EXPECT_EQ(touched & kPagemapFile, 0);
+
+  uint64_t const untouched =
+      ASSERT_NO_ERRNO_AND_VALUE(PagemapEntry(fd.get(), m.addr() + kPageSize));
+  EXPECT_EQ(untouched & kPagemapPresent, 0);
+}
+
+TEST(ProcPidPagemapTest, SharedAnon) {
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED));
+  *reinterpret_cast<volatile char*>(m.ptr()) = 1;
+
+  FileDescriptor const fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/proc/self/pagemap", O_RDONLY));
+  uint64_t const entry =
+      ASSERT_NO_ERRNO_AND_VALUE(PagemapEntry(fd.get(), m.addr()));
+  EXPECT_NE(entry & kPagemapPresent, 0);
+  // Shared anonymous pages are reported as file pages.
+  EXPECT_NE(entry & kPagemapFile, 0);
+}
+
+TEST(ProcPidPagemapTest, UnalignedRead) {
+  FileDescriptor const fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/proc/self/pagemap", O_RDONLY));
+  uint64_t entries[2];
+  EXPECT_THAT(pread(fd.get(), entries, sizeof(entries), 1),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(pread(fd.get(), entries, sizeof(entries) - 1, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 }  // namespace
 
 }  // namespace testing
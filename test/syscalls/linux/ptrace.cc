@@ -105,6 +105,51 @@ constexpr auto kPtraceSysemu = static_cast<__ptrace_request>(31);
 // PTRACE_EVENT_STOP").
 constexpr int kPtraceEventStop = 128;
 
+// PTRACE_GET_SYSCALL_INFO and struct ptrace_syscall_info are not defined until
+// glibc 2.31.
+constexpr auto kPtraceGetSyscallInfo = static_cast<__ptrace_request>(0x420e);
+constexpr uint8_t kPtraceSyscallInfoNone = 0;
+constexpr uint8_t kPtraceSyscallInfoEntry = 1;
+constexpr uint8_t kPtraceSyscallInfoExit = 2;
+
+// The number of bytes returned by PTRACE_GET_SYSCALL_INFO for each operation.
+constexpr int kPtraceSyscallInfoNoneSize = 24;
+constexpr int kPtraceSyscallInfoEntrySize = 80;
+constexpr int kPtraceSyscallInfoExitSize = 33;
+
+struct PtraceSyscallInfo {
+  uint8_t op;
+  uint8_t pad[3];
+  uint32_t arch;
+  uint64_t instruction_pointer;
+  uint64_t stack_pointer;
+  union {
+    struct {
+      uint64_t nr;
+      uint64_t args[6];
+    } entry;
+    struct {
+      int64_t rval;
+      uint8_t is_error;
+    } exit;
+    struct {
+      uint64_t nr;
+      uint64_t args[6];
+      uint32_t ret_data;
+    } seccomp;
+  };
+};
+
+// struct ptrace_peeksiginfo_args is named differently by glibc.
+struct PtracePeekSiginfoArgs {
+  uint64_t off;
+  uint32_t flags;
+  int32_t nr;
+};
+
+constexpr auto kPtracePeekSiginfo = static_cast<__ptrace_request>(0x4209);
+constexpr uint32_t kPtracePeekSiginfoShared = 1;
+
 // Sends sig to the current process with tgkill(2).
 //
 // glibc's raise(2) may change the signal mask before sending the signal. These
@@ -2284,6 +2329,216 @@ TEST(PtraceTest, SeizeSetOptions) {
       << " status " << status;
 }
 
+TEST(PtraceTest, GetSyscallInfo) {
+  constexpr uint64_t kArg = 0x1234;
+
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    // In child process.
+
+    // Enable tracing, then raise SIGSTOP and expect our parent to suppress it.
+    TEST_PCHECK(ptrace(PTRACE_TRACEME, 0, 0, 0) == 0);
+    RaiseSignal(SIGSTOP);
+
+    // getppid ignores its arguments; kArg is only observed by the tracer.
+    syscall(SYS_getppid, kArg);
+    _exit(0);
+  }
+  // In parent process.
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+
+  // Wait for the child to send itself SIGSTOP and enter signal-delivery-stop.
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSTOPPED(status) && WSTOPSIG(status) == SIGSTOP)
+      << " status " << status;
+
+  // Outside of a syscall-stop, only the common fields are returned.
+  PtraceSyscallInfo info = {};
+  EXPECT_THAT(ptrace(kPtraceGetSyscallInfo, child_pid, sizeof(info), &info),
+              SyscallSucceedsWithValue(kPtraceSyscallInfoNoneSize));
+  EXPECT_EQ(info.op, kPtraceSyscallInfoNone);
+  EXPECT_NE(info.instruction_pointer, 0);
+  EXPECT_NE(info.stack_pointer, 0);
+
+  // Syscall-stops can only be identified with PTRACE_O_TRACESYSGOOD.
+  ASSERT_THAT(ptrace(PTRACE_SETOPTIONS, child_pid, 0, PTRACE_O_TRACESYSGOOD),
+              SyscallSucceeds());
+
+  // Suppress the SIGSTOP and wait for the child to enter syscall-enter-stop
+  // for getppid.
+  ASSERT_THAT(ptrace(PTRACE_SYSCALL, child_pid, 0, 0), SyscallSucceeds());
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSTOPPED(status) && WSTOPSIG(status) == (SIGTRAP | 0x80))
+      << " status " << status;
+
+  info = {};
+  EXPECT_THAT(ptrace(kPtraceGetSyscallInfo, child_pid, sizeof(info), &info),
+              SyscallSucceedsWithValue(kPtraceSyscallInfoEntrySize));
+  EXPECT_EQ(info.op, kPtraceSyscallInfoEntry);
+  EXPECT_EQ(info.entry.nr, SYS_getppid);
+  EXPECT_EQ(info.entry.args[0], kArg);
+
+  // A smaller buffer truncates the output, but the full size is returned.
+  info = {};
+  EXPECT_THAT(ptrace(kPtraceGetSyscallInfo, child_pid, 1, &info),
+              SyscallSucceedsWithValue(kPtraceSyscallInfoEntrySize));
+  EXPECT_EQ(info.op, kPtraceSyscallInfoEntry);
+  EXPECT_EQ(info.entry.nr, 0);
+
+  // Resume the child and wait for it to enter syscall-exit-stop.
+  ASSERT_THAT(ptrace(PTRACE_SYSCALL, child_pid, 0, 0), SyscallSucceeds());
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSTOPPED(status) && WSTOPSIG(status) == (SIGTRAP | 0x80))
+      << " status " << status;
+
+  info = {};
+  EXPECT_THAT(ptrace(kPtraceGetSyscallInfo, child_pid, sizeof(info), &info),
+              SyscallSucceedsWithValue(kPtraceSyscallInfoExitSize));
+  EXPECT_EQ(info.op, kPtraceSyscallInfoExit);
+  EXPECT_EQ(info.exit.rval, getpid());
+  EXPECT_EQ(info.exit.is_error, 0);
+
+  // Detach and wait for the child to exit.
+  ASSERT_THAT(ptrace(PTRACE_DETACH, child_pid, 0, 0), SyscallSucceeds());
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+
+TEST(PtraceTest, PeekSiginfo) {
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    // In child process.
+
+    // Block SIGUSR1 and SIGUSR2 so that they remain pending, then send
+    // SIGUSR1 to this thread and SIGUSR2 to the thread group.
+    sigset_t set;
+    TEST_PCHECK(sigemptyset(&set) == 0);
+    TEST_PCHECK(sigaddset(&set, SIGUSR1) == 0);
+    TEST_PCHECK(sigaddset(&set, SIGUSR2) == 0);
+    TEST_PCHECK(sigprocmask(SIG_BLOCK, &set, nullptr) == 0);
+    RaiseSignal(SIGUSR1);
+    TEST_PCHECK(kill(getpid(), SIGUSR2) == 0);
+
+    // Enable tracing, then raise SIGSTOP and expect our parent to inspect the
+    // pending signals.
+    TEST_PCHECK(ptrace(PTRACE_TRACEME, 0, 0, 0) == 0);
+    RaiseSignal(SIGSTOP);
+    _exit(0);
+  }
+  // In parent process.
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+
+  // Wait for the child to send itself SIGSTOP and enter signal-delivery-stop.
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSTOPPED(status) && WSTOPSIG(status) == SIGSTOP)
+      << " status " << status;
+
+  siginfo_t infos[2] = {};
+  PtracePeekSiginfoArgs args = {};
+  args.nr = 2;
+  EXPECT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(infos[0].si_signo, SIGUSR1);
+
+  args.flags = kPtracePeekSiginfoShared;
+  EXPECT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(infos[0].si_signo, SIGUSR2);
+
+  // No signals are returned past the end of the queue.
+  args.off = 1;
+  EXPECT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallSucceedsWithValue(0));
+
+  args.flags = ~kPtracePeekSiginfoShared;
+  EXPECT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Clean up the child.
+  ASSERT_THAT(kill(child_pid, SIGKILL), SyscallSucceeds());
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSIGNALED(status) && WTERMSIG(status) == SIGKILL)
+      << " status " << status;
+}
+
+#if defined(__x86_64__)
+
+// Written by the child of PtraceTest.WriteWatchpoint.
+volatile int watched_value;
+
+TEST(PtraceTest, WriteWatchpoint) {
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    // In child process.
+
+    // Enable tracing, then raise SIGSTOP and expect our parent to set a
+    // watchpoint on watched_value.
+    TEST_PCHECK(ptrace(PTRACE_TRACEME, 0, 0, 0) == 0);
+    RaiseSignal(SIGSTOP);
+    watched_value = 1;
+    _exit(0);
+  }
+  // In parent process.
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+
+  // Wait for the child to send itself SIGSTOP and enter signal-delivery-stop.
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSTOPPED(status) && WSTOPSIG(status) == SIGSTOP)
+      << " status " << status;
+
+  // Watch writes to the 4 bytes of watched_value with DR0: enable it locally
+  // (L0), with R/W0 = 01 (writes) and LEN0 = 11 (4 bytes).
+  constexpr size_t kDR0 = offsetof(struct user, u_debugreg[0]);
+  constexpr size_t kDR6 = offsetof(struct user, u_debugreg[6]);
+  constexpr size_t kDR7 = offsetof(struct user, u_debugreg[7]);
+  ASSERT_THAT(ptrace(PTRACE_POKEUSER, child_pid, kDR0, &watched_value),
+              SyscallSucceeds());
+  ASSERT_THAT(
+      ptrace(PTRACE_POKEUSER, child_pid, kDR7, 0x1 | (0x1 << 16) | (0x3 << 18)),
+      SyscallSucceeds());
+
+  // Read watchpoints are rejected.
+  EXPECT_THAT(ptrace(PTRACE_POKEUSER, child_pid, kDR7, 0x1 | (0x3 << 16)),
+              SyscallFailsWithErrno(ENOSPC));
+
+  // The child should stop with SIGTRAP after writing to watched_value.
+  ASSERT_THAT(ptrace(PTRACE_CONT, child_pid, 0, 0), SyscallSucceeds());
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSTOPPED(status) && WSTOPSIG(status) == SIGTRAP)
+      << " status " << status;
+
+  // DR6 reports that DR0 was hit (B0), along with its reserved bits.
+  EXPECT_THAT(ptrace(PTRACE_PEEKUSER, child_pid, kDR6, 0),
+              SyscallSucceedsWithValue(0xffff0ff1));
+
+  siginfo_t siginfo = {};
+  ASSERT_THAT(ptrace(PTRACE_GETSIGINFO, child_pid, 0, &siginfo),
+              SyscallSucceeds());
+  EXPECT_EQ(siginfo.si_signo, SIGTRAP);
+  EXPECT_EQ(siginfo.si_code, TRAP_HWBKPT);
+
+  // Suppress the SIGTRAP; the child should exit normally.
+  ASSERT_THAT(ptrace(PTRACE_CONT, child_pid, 0, 0), SyscallSucceeds());
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+
+#endif  // defined(__x86_64__)
+
 TEST(PtraceTest, SetYAMAPtraceScope) {
   // Do not modify the ptrace scope on the host.
   SKIP_IF(!IsRunningOnGvisor());
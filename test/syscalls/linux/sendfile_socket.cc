@@ -158,6 +158,37 @@ TEST_P(SendFileTest, SendMultiple) {
   ASSERT_EQ(memcmp(data.data(), actual.data(), data.size()), 0);
 }
 
+// Sends part of a file at an explicit offset, which must be updated without
+// changing the file offset.
+TEST_P(SendFileTest, SendWithOffset) {
+  constexpr char kData[] = "0123456789abcdef";
+  constexpr int kDataSize = sizeof(kData) - 1;
+  const TempPath in_file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      GetAbsoluteTestTmpdir(), kData, TempPath::kDefaultFileMode));
+  const FileDescriptor inf =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(in_file.path(), O_RDONLY));
+  auto socks = ASSERT_NO_ERRNO_AND_VALUE(Sockets(SOCK_STREAM));
+
+  off_t offset = 4;
+  ASSERT_THAT(sendfile(socks->second_fd(), inf.get(), &offset, 8),
+              SyscallSucceedsWithValue(8));
+  EXPECT_EQ(offset, 12);
+  EXPECT_THAT(lseek(inf.get(), 0, SEEK_CUR), SyscallSucceedsWithValue(0));
+
+  // Sending past the end of the file is truncated.
+  ASSERT_THAT(sendfile(socks->second_fd(), inf.get(), &offset, kDataSize),
+              SyscallSucceedsWithValue(kDataSize - 12));
+  EXPECT_EQ(offset, kDataSize);
+  EXPECT_THAT(sendfile(socks->second_fd(), inf.get(), &offset, kDataSize),
+              SyscallSucceedsWithValue(0));
+
+  char buf[kDataSize] = {};
+  ASSERT_THAT(ReadFd(socks->first_fd(), buf, kDataSize - 4),
+              SyscallSucceedsWithValue(kDataSize - 4));
+  EXPECT_EQ(absl::string_view(buf, kDataSize - 4),
+            absl::string_view(kData + 4, kDataSize - 4));
+}
+
 TEST_P(SendFileTest, Shutdown) {
   // Create a socket.
   auto socks = ASSERT_NO_ERRNO_AND_VALUE(Sockets(SOCK_STREAM));
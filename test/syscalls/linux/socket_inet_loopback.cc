@@ -2659,6 +2659,55 @@ TEST_P(SocketMultiProtocolInetLoopbackTest, NoReusePortFollowingReusePort) {
   ASSERT_THAT(bind(fd, AsSockAddr(&addr), addrlen), SyscallSucceeds());
 }
 
+TEST_P(SocketMultiProtocolInetLoopbackTest, V6OnlyBindV4MappedFails) {
+  ProtocolTestParam const& param = GetParam();
+
+  TestAddress const& test_addr = V4MappedLoopback();
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(test_addr.family(), param.type, 0));
+  ASSERT_THAT(setsockopt(fd.get(), IPPROTO_IPV6, IPV6_V6ONLY, &kSockOptOn,
+                         sizeof(kSockOptOn)),
+              SyscallSucceeds());
+  EXPECT_THAT(
+      bind(fd.get(), AsSockAddr(&test_addr.addr), test_addr.addr_len),
+      SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(SocketMultiProtocolInetLoopbackTest, V6OnlyConnectV4MappedFails) {
+  ProtocolTestParam const& param = GetParam();
+
+  TestAddress const& test_addr = V4MappedLoopback();
+  sockaddr_storage addr = test_addr.addr;
+  ASSERT_NO_ERRNO(SetAddrPort(test_addr.family(), &addr, 1234));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(test_addr.family(), param.type, 0));
+  ASSERT_THAT(setsockopt(fd.get(), IPPROTO_IPV6, IPV6_V6ONLY, &kSockOptOn,
+                         sizeof(kSockOptOn)),
+              SyscallSucceeds());
+  EXPECT_THAT(connect(fd.get(), AsSockAddr(&addr), test_addr.addr_len),
+              SyscallFailsWithErrno(ENETUNREACH));
+
+  if (param.type == SOCK_DGRAM) {
+    char buf[1] = {};
+    EXPECT_THAT(sendto(fd.get(), buf, sizeof(buf), 0, AsSockAddr(&addr),
+                       test_addr.addr_len),
+                SyscallFailsWithErrno(ENETUNREACH));
+  }
+}
+
+TEST_P(SocketMultiProtocolInetLoopbackTest, V6OnlyAfterBindFails) {
+  ProtocolTestParam const& param = GetParam();
+
+  TestAddress const& test_addr = V6Loopback();
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(test_addr.family(), param.type, 0));
+  ASSERT_THAT(bind(fd.get(), AsSockAddr(&test_addr.addr), test_addr.addr_len),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(fd.get(), IPPROTO_IPV6, IPV6_V6ONLY, &kSockOptOn,
+                         sizeof(kSockOptOn)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 INSTANTIATE_TEST_SUITE_P(AllFamilies, SocketMultiProtocolInetLoopbackTest,
                          ProtocolTestValues(), DescribeProtocolTestParam);
 
@@ -0,0 +1,277 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <fcntl.h>
+#include <linux/tls.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+#include <sys/socket.h>
+#include <unistd.h>
+
+#include <cstring>
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/ip_socket_test_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+#ifndef SOL_TLS
+#define SOL_TLS 282
+#endif
+
+#ifndef TCP_ULP
+#define TCP_ULP 31
+#endif
+
+namespace gvisor {
+namespace testing {
+namespace {
+
+constexpr char kULP[] = "tls";
+
+// TLS record header: content type, version and payload length.
+constexpr int kTLSHeaderSize = 5;
+constexpr uint8_t kTLSApplicationData = 23;
+constexpr size_t kTLSMaxPayloadSize = 1 << 14;
+
+PosixErrorOr<std::unique_ptr<SocketPair>> TCPSockets() {
+  return SocketPairKind{
+      "TCP", AF_INET, SOCK_STREAM, 0,
+      TCPAcceptBindSocketPairCreator(AF_INET, SOCK_STREAM, 0, false)}
+      .Create();
+}
+
+// ReadFull reads exactly size bytes from fd.
+void ReadFull(int fd, void* buf, size_t size) {
+  char* p = static_cast<char*>(buf);
+  size_t done = 0;
+  while (done < size) {
+    int n;
+    ASSERT_THAT(n = RetryEINTR(read)(fd, p + done, size - done),
+                SyscallSucceeds());
+    ASSERT_GT(n, 0);
+    done += n;
+  }
+}
+
+tls12_crypto_info_aes_gcm_128 TestCryptoInfo() {
+  tls12_crypto_info_aes_gcm_128 info = {};
+  info.info.version = TLS_1_2_VERSION;
+  info.info.cipher_type = TLS_CIPHER_AES_GCM_128;
+  for (size_t i = 0; i < sizeof(info.key); i++) {
+    info.key[i] = i;
+  }
+  for (size_t i = 0; i < sizeof(info.iv); i++) {
+    info.iv[i] = 0x10 + i;
+  }
+  for (size_t i = 0; i < sizeof(info.salt); i++) {
+    info.salt[i] = 0x20 + i;
+  }
+  return info;
+}
+
+// EnableULP attaches the TLS ULP to fd, skipping the test if the host kernel
+// does not support kTLS.
+void EnableULP(int fd) {
+  int ret = setsockopt(fd, SOL_TCP, TCP_ULP, kULP, sizeof(kULP));
+  if (!IsRunningOnGvisor() && ret < 0 && errno == ENOENT) {
+    GTEST_SKIP() << "tls module not available on the host";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+}
+
+TEST(KTLSTest, ULPRequiresConnectedSocket) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, IPPROTO_TCP));
+  int ret = setsockopt(fd.get(), SOL_TCP, TCP_ULP, kULP, sizeof(kULP));
+  if (!IsRunningOnGvisor() && ret < 0 && errno == ENOENT) {
+    GTEST_SKIP() << "tls module not available on the host";
+  }
+  EXPECT_THAT(ret, SyscallFailsWithErrno(ENOTCONN));
+}
+
+TEST(KTLSTest, UnknownULP) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(TCPSockets());
+  constexpr char kBogus[] = "bogus";
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_TCP, TCP_ULP, kBogus,
+                         sizeof(kBogus)),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST(KTLSTest, GetULP) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(TCPSockets());
+  ASSERT_NO_FATAL_FAILURE(EnableULP(sockets->first_fd()));
+
+  char name[16] = {};
+  socklen_t len = sizeof(name);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_TCP, TCP_ULP, name, &len),
+              SyscallSucceeds());
+  EXPECT_STREQ(name, kULP);
+
+  EXPECT_THAT(
+      setsockopt(sockets->first_fd(), SOL_TCP, TCP_ULP, kULP, sizeof(kULP)),
+      SyscallFailsWithErrno(EEXIST));
+}
+
+TEST(KTLSTest, CryptoInfoRoundTrip) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(TCPSockets());
+  ASSERT_NO_FATAL_FAILURE(EnableULP(sockets->first_fd()));
+
+  tls12_crypto_info_aes_gcm_128 got = {};
+  socklen_t len = sizeof(got);
+  EXPECT_THAT(
+      getsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &got, &len),
+      SyscallFailsWithErrno(EBUSY));
+
+  tls12_crypto_info_aes_gcm_128 info = TestCryptoInfo();
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallFailsWithErrno(EBUSY));
+
+  len = sizeof(got);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  EXPECT_EQ(memcmp(&got, &info, sizeof(info)), 0);
+}
+
+TEST(KTLSTest, InvalidCipher) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(TCPSockets());
+  ASSERT_NO_FATAL_FAILURE(EnableULP(sockets->first_fd()));
+
+  tls12_crypto_info_aes_gcm_128 info = TestCryptoInfo();
+  info.info.cipher_type = 0xffff;
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(KTLSTest, SendIsFramed) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(TCPSockets());
+  ASSERT_NO_FATAL_FAILURE(EnableULP(sockets->first_fd()));
+
+  tls12_crypto_info_aes_gcm_128 info = TestCryptoInfo();
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallSucceeds());
+
+  constexpr char kData[] = "hello, kTLS";
+  ASSERT_THAT(WriteFd(sockets->first_fd(), kData, sizeof(kData)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+
+  // The peer has no RX key and sees the raw record: header, explicit nonce,
+  // ciphertext and tag.
+  const size_t want = kTLSHeaderSize + TLS_CIPHER_AES_GCM_128_IV_SIZE +
+                      sizeof(kData) + TLS_CIPHER_AES_GCM_128_TAG_SIZE;
+  std::vector<uint8_t> record(want);
+  ASSERT_NO_FATAL_FAILURE(
+      ReadFull(sockets->second_fd(), record.data(), record.size()));
+  EXPECT_EQ(record[0], kTLSApplicationData);
+  EXPECT_EQ(record[1], 0x03);
+  EXPECT_EQ(record[2], 0x03);
+  EXPECT_EQ((record[3] << 8) | record[4], want - kTLSHeaderSize);
+  EXPECT_NE(memcmp(record.data() + want - sizeof(kData) -
+                       TLS_CIPHER_AES_GCM_128_TAG_SIZE,
+                   kData, sizeof(kData)),
+            0);
+}
+
+TEST(KTLSTest, SendRecv) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(TCPSockets());
+  ASSERT_NO_FATAL_FAILURE(EnableULP(sockets->first_fd()));
+  ASSERT_NO_FATAL_FAILURE(EnableULP(sockets->second_fd()));
+
+  tls12_crypto_info_aes_gcm_128 info = TestCryptoInfo();
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallSucceeds());
+  ASSERT_THAT(setsockopt(sockets->second_fd(), SOL_TLS, TLS_RX, &info,
+                         sizeof(info)),
+              SyscallSucceeds());
+
+  // Span several records.
+  std::vector<char> data(3 * kTLSMaxPayloadSize / 2 + 7);
+  RandomizeBuffer(data.data(), data.size());
+  ASSERT_THAT(WriteFd(sockets->first_fd(), data.data(), data.size()),
+              SyscallSucceedsWithValue(data.size()));
+
+  std::vector<char> got(data.size());
+  ASSERT_NO_FATAL_FAILURE(
+      ReadFull(sockets->second_fd(), got.data(), got.size()));
+  EXPECT_EQ(got, data);
+}
+
+// Records that were accepted but couldn't be sent immediately must be sent
+// once the socket becomes writable, and before the write side is shut down.
+TEST(KTLSTest, PartialRecordsAreSent) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(TCPSockets());
+  ASSERT_NO_FATAL_FAILURE(EnableULP(sockets->first_fd()));
+  ASSERT_NO_FATAL_FAILURE(EnableULP(sockets->second_fd()));
+
+  tls12_crypto_info_aes_gcm_128 info = TestCryptoInfo();
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_TLS, TLS_TX, &info,
+                         sizeof(info)),
+              SyscallSucceeds());
+  ASSERT_THAT(setsockopt(sockets->second_fd(), SOL_TLS, TLS_RX, &info,
+                         sizeof(info)),
+              SyscallSucceeds());
+
+  constexpr int kSndBuf = 4096;
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_SNDBUF, &kSndBuf,
+                         sizeof(kSndBuf)),
+              SyscallSucceeds());
+  int flags;
+  ASSERT_THAT(flags = fcntl(sockets->first_fd(), F_GETFL), SyscallSucceeds());
+  ASSERT_THAT(fcntl(sockets->first_fd(), F_SETFL, flags | O_NONBLOCK),
+              SyscallSucceeds());
+
+  // Fill the send buffer so that the last record is only partially sent.
+  std::vector<char> chunk(kTLSMaxPayloadSize);
+  RandomizeBuffer(chunk.data(), chunk.size());
+  size_t sent = 0;
+  while (true) {
+    int n = write(sockets->first_fd(), chunk.data(), chunk.size());
+    if (n < 0) {
+      ASSERT_EQ(errno, EAGAIN);
+      break;
+    }
+    sent += n;
+  }
+  ASSERT_GT(sent, 0);
+  ASSERT_THAT(shutdown(sockets->first_fd(), SHUT_WR), SyscallSucceeds());
+
+  // The peer sees all accepted data followed by EOF.
+  std::vector<char> buf(kTLSMaxPayloadSize);
+  size_t got = 0;
+  while (true) {
+    int n;
+    ASSERT_THAT(n = RetryEINTR(read)(sockets->second_fd(), buf.data(),
+                                     buf.size()),
+                SyscallSucceeds());
+    if (n == 0) {
+      break;
+    }
+    got += n;
+  }
+  EXPECT_EQ(got, sent);
+}
+
+}  // namespace
+}  // namespace testing
+}  // namespace gvisor
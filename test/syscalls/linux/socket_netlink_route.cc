@@ -606,6 +606,58 @@ TEST(NetlinkRouteTest, GetAddrDump) {
       false));
 }
 
+// GetAddrDumpFamily tests that RTM_GETADDR dumps are filtered by the requested
+// family, and that IPv4 loopback addresses have host scope and a label.
+TEST(NetlinkRouteTest, GetAddrDumpFamily) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct rtgenmsg rgm;
+  };
+
+  struct request req;
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = RTM_GETADDR;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.hdr.nlmsg_seq = kSeq;
+  req.rgm.rtgen_family = AF_INET;
+
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != RTM_NEWADDR) {
+          return;
+        }
+
+        const struct ifaddrmsg* msg =
+            reinterpret_cast<const struct ifaddrmsg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->ifa_family, AF_INET);
+
+        bool isLoopback = false;
+        bool labelFound = false;
+        int len = IFA_PAYLOAD(hdr);
+        for (const struct rtattr* attr = IFA_RTA(msg); RTA_OK(attr, len);
+             attr = RTA_NEXT(attr, len)) {
+          if (attr->rta_type == IFA_LOCAL &&
+              RTA_PAYLOAD(attr) == sizeof(struct in_addr)) {
+            const struct in_addr* addr =
+                reinterpret_cast<const struct in_addr*>(RTA_DATA(attr));
+            isLoopback = addr->s_addr == htonl(INADDR_LOOPBACK);
+          }
+          if (attr->rta_type == IFA_LABEL) {
+            labelFound = true;
+          }
+        }
+        if (isLoopback) {
+          EXPECT_EQ(msg->ifa_scope, RT_SCOPE_HOST);
+          EXPECT_TRUE(labelFound);
+        }
+      },
+      false));
+}
+
 TEST(NetlinkRouteTest, LookupAll) {
   struct ifaddrs* if_addr_list = nullptr;
   auto cleanup = Cleanup([&if_addr_list]() { freeifaddrs(if_addr_list); });
@@ -726,9 +778,10 @@ TEST(NetlinkRouteTest, GetRouteDump) {
         std::cout << std::endl;
 
         // If the test is running in a new network namespace, it will have only
-        // the local route table.
+        // the local route table. gVisor reports the host's tables with
+        // --network=host.
         if (msg->rtm_table == RT_TABLE_MAIN ||
-            (!IsRunningOnGvisor() && msg->rtm_table == RT_TABLE_LOCAL)) {
+            msg->rtm_table == RT_TABLE_LOCAL) {
           routeFound = true;
           if (msg->rtm_dst_len) {
             dstFound = rtDstFound && dstFound;
@@ -0,0 +1,322 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <arpa/inet.h>
+#include <linux/inet_diag.h>
+#include <linux/netlink.h>
+#include <linux/rtnetlink.h>
+#include <linux/sock_diag.h>
+#include <linux/unix_diag.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+#include <sched.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/un.h>
+
+#include <cstring>
+
+#include "gmock/gmock.h"
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+#include "test/util/thread_util.h"
+
+// Tests for NETLINK_SOCK_DIAG sockets.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+using ::testing::_;
+
+constexpr uint32_t kSeq = 12345;
+
+// A dump of listening TCP sockets filtered by source port returns exactly the
+// socket bound to that port, along with its tcp_info.
+TEST(NetlinkSockDiagTest, InetDumpFiltered) {
+  FileDescriptor listener =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, 0));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  ASSERT_THAT(
+      bind(listener.get(), reinterpret_cast<struct sockaddr*>(&addr),
+           sizeof(addr)),
+      SyscallSucceeds());
+  ASSERT_THAT(listen(listener.get(), 5), SyscallSucceeds());
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(
+      getsockname(listener.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                  &addrlen),
+      SyscallSucceeds());
+  const uint16_t port = ntohs(addr.sin_port);
+
+  struct stat st;
+  ASSERT_THAT(fstat(listener.get(), &st), SyscallSucceeds());
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct inet_diag_req_v2 req;
+    struct rtattr rta;
+    struct inet_diag_bc_op ops[2];
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.hdr.nlmsg_seq = kSeq;
+  req.req.sdiag_family = AF_INET;
+  req.req.sdiag_protocol = IPPROTO_TCP;
+  req.req.idiag_ext = 1 << (INET_DIAG_INFO - 1);
+  req.req.idiag_states = 1 << TCP_LISTEN;
+  req.rta.rta_type = INET_DIAG_REQ_BYTECODE;
+  req.rta.rta_len = RTA_LENGTH(sizeof(req.ops));
+  // Match sockets whose source port is port.
+  req.ops[0].code = INET_DIAG_BC_S_EQ;
+  req.ops[0].yes = sizeof(req.ops);
+  req.ops[0].no = sizeof(req.ops) + 4;
+  req.ops[1].no = port;
+
+  int found = 0;
+  bool found_info = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        ASSERT_GE(hdr->nlmsg_len, NLMSG_LENGTH(sizeof(struct inet_diag_msg)));
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->idiag_family, AF_INET);
+        EXPECT_EQ(msg->idiag_state, TCP_LISTEN);
+        EXPECT_EQ(ntohs(msg->id.idiag_sport), port);
+        EXPECT_EQ(msg->idiag_inode, st.st_ino);
+        found++;
+
+        int len = hdr->nlmsg_len - NLMSG_LENGTH(sizeof(*msg));
+        for (const struct rtattr* rta =
+                 reinterpret_cast<const struct rtattr*>(msg + 1);
+             RTA_OK(rta, len); rta = RTA_NEXT(rta, len)) {
+          if (rta->rta_type != INET_DIAG_INFO) {
+            continue;
+          }
+          ASSERT_GE(RTA_PAYLOAD(rta), sizeof(struct tcp_info));
+          const struct tcp_info* info =
+              reinterpret_cast<const struct tcp_info*>(RTA_DATA(rta));
+          EXPECT_EQ(info->tcpi_state, TCP_LISTEN);
+          found_info = true;
+        }
+      },
+      false));
+  EXPECT_EQ(found, 1);
+  EXPECT_TRUE(found_info);
+}
+
+// Sockets in other network namespaces are not visible.
+TEST(NetlinkSockDiagTest, InetDumpOtherNamespace) {
+  SKIP_IF(IsRunningWithHostinet());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  FileDescriptor listener =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, 0));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  ASSERT_THAT(
+      bind(listener.get(), reinterpret_cast<struct sockaddr*>(&addr),
+           sizeof(addr)),
+      SyscallSucceeds());
+  ASSERT_THAT(listen(listener.get(), 5), SyscallSucceeds());
+  struct stat st;
+  ASSERT_THAT(fstat(listener.get(), &st), SyscallSucceeds());
+
+  ScopedThread t([&] {
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceedsWithValue(0));
+    FileDescriptor fd =
+        ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+
+    struct request {
+      struct nlmsghdr hdr;
+      struct inet_diag_req_v2 req;
+    };
+    struct request req = {};
+    req.hdr.nlmsg_len = sizeof(req);
+    req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+    req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+    req.hdr.nlmsg_seq = kSeq;
+    req.req.sdiag_family = AF_INET;
+    req.req.sdiag_protocol = IPPROTO_TCP;
+    req.req.idiag_states = 1 << TCP_LISTEN;
+
+    bool found = false;
+    ASSERT_NO_ERRNO(NetlinkRequestResponse(
+        fd, &req, sizeof(req),
+        [&](const struct nlmsghdr* hdr) {
+          if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+            return;
+          }
+          const struct inet_diag_msg* msg =
+              reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+          if (msg->idiag_inode == st.st_ino) {
+            found = true;
+          }
+        },
+        false));
+    EXPECT_FALSE(found);
+  });
+}
+
+// A lookup of a socket that doesn't exist fails with ENOENT.
+TEST(NetlinkSockDiagTest, InetLookupNotFound) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct inet_diag_req_v2 req;
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST;
+  req.hdr.nlmsg_seq = kSeq;
+  req.req.sdiag_family = AF_INET;
+  req.req.sdiag_protocol = IPPROTO_TCP;
+  req.req.id.idiag_cookie[0] = INET_DIAG_NOCOOKIE;
+  req.req.id.idiag_cookie[1] = INET_DIAG_NOCOOKIE;
+
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, kSeq, &req, sizeof(req)),
+              PosixErrorIs(ENOENT, _));
+}
+
+// Invalid bytecode is rejected.
+TEST(NetlinkSockDiagTest, InetInvalidBytecode) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct inet_diag_req_v2 req;
+    struct rtattr rta;
+    struct inet_diag_bc_op ops[2];
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.hdr.nlmsg_seq = kSeq;
+  req.req.sdiag_family = AF_INET;
+  req.req.sdiag_protocol = IPPROTO_TCP;
+  req.req.idiag_states = -1;
+  req.rta.rta_type = INET_DIAG_REQ_BYTECODE;
+  req.rta.rta_len = RTA_LENGTH(sizeof(req.ops));
+  // The no branch jumps past the end of the program.
+  req.ops[0].code = INET_DIAG_BC_S_EQ;
+  req.ops[0].yes = sizeof(req.ops);
+  req.ops[0].no = sizeof(req.ops) + 8;
+
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, kSeq, &req, sizeof(req)),
+              PosixErrorIs(EINVAL, _));
+}
+
+// A unix domain socket can be looked up by inode.
+TEST(NetlinkSockDiagTest, UnixLookup) {
+  FileDescriptor sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+  struct sockaddr_un addr =
+      ASSERT_NO_ERRNO_AND_VALUE(UniqueUnixAddr(true, AF_UNIX));
+  ASSERT_THAT(bind(sock.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                   sizeof(addr)),
+              SyscallSucceeds());
+  ASSERT_THAT(listen(sock.get(), 5), SyscallSucceeds());
+
+  struct stat st;
+  ASSERT_THAT(fstat(sock.get(), &st), SyscallSucceeds());
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct unix_diag_req req;
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST;
+  req.hdr.nlmsg_seq = kSeq;
+  req.req.sdiag_family = AF_UNIX;
+  req.req.udiag_ino = st.st_ino;
+  req.req.udiag_show = UDIAG_SHOW_NAME | UDIAG_SHOW_RQLEN;
+  req.req.udiag_cookie[0] = INET_DIAG_NOCOOKIE;
+  req.req.udiag_cookie[1] = INET_DIAG_NOCOOKIE;
+
+  bool found = false;
+  bool found_name = false;
+  bool found_rqlen = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponseSingle(
+      fd, &req, sizeof(req), [&](const struct nlmsghdr* hdr) {
+        ASSERT_EQ(hdr->nlmsg_type, SOCK_DIAG_BY_FAMILY);
+        ASSERT_GE(hdr->nlmsg_len, NLMSG_LENGTH(sizeof(struct unix_diag_msg)));
+        const struct unix_diag_msg* msg =
+            reinterpret_cast<const struct unix_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->udiag_family, AF_UNIX);
+        EXPECT_EQ(msg->udiag_type, SOCK_STREAM);
+        EXPECT_EQ(msg->udiag_state, TCP_LISTEN);
+        EXPECT_EQ(msg->udiag_ino, st.st_ino);
+        found = true;
+
+        int len = hdr->nlmsg_len - NLMSG_LENGTH(sizeof(*msg));
+        for (const struct rtattr* rta =
+                 reinterpret_cast<const struct rtattr*>(msg + 1);
+             RTA_OK(rta, len); rta = RTA_NEXT(rta, len)) {
+          switch (rta->rta_type) {
+            case UNIX_DIAG_NAME: {
+              // Abstract names start with a NUL byte.
+              size_t name_len = strlen(addr.sun_path + 1) + 1;
+              ASSERT_GE(RTA_PAYLOAD(rta), name_len);
+              EXPECT_EQ(memcmp(RTA_DATA(rta), addr.sun_path, name_len), 0);
+              found_name = true;
+              break;
+            }
+            case UNIX_DIAG_RQLEN:
+              EXPECT_EQ(RTA_PAYLOAD(rta), sizeof(struct unix_diag_rqlen));
+              found_rqlen = true;
+              break;
+          }
+        }
+      }));
+  EXPECT_TRUE(found);
+  EXPECT_TRUE(found_name);
+  EXPECT_TRUE(found_rqlen);
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
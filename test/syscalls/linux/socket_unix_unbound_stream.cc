@@ -14,6 +14,7 @@
 
 #include <stdio.h>
 #include <sys/un.h>
+#include <unistd.h>
 
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/unix_domain_socket_test_util.h"
@@ -653,6 +654,37 @@ TEST_P(UnixStreamSocketPairTest, CoalescedDifferingCreds) {
                       sizeof(sent_data3)));
 }
 
+TEST_P(UnixStreamSocketPairTest, PeerCred) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  for (int fd : {sockets->first_fd(), sockets->second_fd()}) {
+    struct ucred creds = {};
+    socklen_t len = sizeof(creds);
+    ASSERT_THAT(getsockopt(fd, SOL_SOCKET, SO_PEERCRED, &creds, &len),
+                SyscallSucceeds());
+    EXPECT_EQ(len, sizeof(creds));
+    EXPECT_EQ(creds.pid, getpid());
+    EXPECT_EQ(creds.uid, getuid());
+    EXPECT_EQ(creds.gid, getgid());
+  }
+}
+
+TEST_P(UnixStreamSocketPairTest, PassSec) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  int val = 1;
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_PASSSEC, &val,
+                         sizeof(val)),
+              SyscallSucceeds());
+
+  val = 0;
+  socklen_t len = sizeof(val);
+  ASSERT_THAT(
+      getsockopt(sockets->first_fd(), SOL_SOCKET, SO_PASSSEC, &val, &len),
+      SyscallSucceeds());
+  EXPECT_EQ(val, 1);
+}
+
 INSTANTIATE_TEST_SUITE_P(
     AllUnixDomainSockets, UnixStreamSocketPairTest,
     ::testing::ValuesIn(IncludeReversals(VecCat<SocketPairKind>(
@@ -727,6 +759,19 @@ INSTANTIATE_TEST_SUITE_P(
             AllBitwiseCombinations(List<int>{SOCK_STREAM},
                                    List<int>{0, SOCK_NONBLOCK}))))));
 
+TEST(UnixStreamSocketTest, PeerCredUnconnected) {
+  FileDescriptor sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+
+  struct ucred creds = {};
+  socklen_t len = sizeof(creds);
+  ASSERT_THAT(getsockopt(sock.get(), SOL_SOCKET, SO_PEERCRED, &creds, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(creds.pid, 0);
+  EXPECT_EQ(creds.uid, 65534u);
+  EXPECT_EQ(creds.gid, 65534u);
+}
+
 }  // namespace
 
 }  // namespace testing
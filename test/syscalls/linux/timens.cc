@@ -0,0 +1,175 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+#include <fcntl.h>
+#include <sched.h>
+#include <signal.h>
+#include <stdio.h>
+#include <sys/sysinfo.h>
+#include <sys/wait.h>
+#include <time.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/capability_util.h"
+#include "test/util/logging.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/test_util.h"
+
+#ifndef CLONE_NEWTIME
+#define CLONE_NEWTIME 0x80
+#endif
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr time_t kMonotonicOffset = 1000000;
+constexpr time_t kBoottimeOffset = 2000000;
+
+// SetOffsets sets the offsets of the time namespace for the children of the
+// calling process. It may only be called in a forked process.
+void SetOffsets() {
+  int fd = open("/proc/self/timens_offsets", O_WRONLY);
+  TEST_PCHECK(fd >= 0);
+  std::string offsets = absl::StrCat("monotonic ", kMonotonicOffset,
+                                     " 0\nboottime ", kBoottimeOffset, " 0\n");
+  TEST_PCHECK(write(fd, offsets.data(), offsets.size()) ==
+              static_cast<ssize_t>(offsets.size()));
+  TEST_PCHECK(close(fd) == 0);
+}
+
+// CheckOffsets checks that the calling process observes the offsets set by
+// SetOffsets, relative to the clocks read before, when no offsets applied.
+void CheckOffsets(const struct timespec& monotonic,
+                  const struct timespec& boottime) {
+  struct timespec ts;
+  // clock_gettime is normally served by the VDSO.
+  TEST_PCHECK(clock_gettime(CLOCK_MONOTONIC, &ts) == 0);
+  TEST_CHECK(ts.tv_sec >= monotonic.tv_sec + kMonotonicOffset);
+  TEST_CHECK(ts.tv_sec < monotonic.tv_sec + kBoottimeOffset);
+  TEST_PCHECK(clock_gettime(CLOCK_BOOTTIME, &ts) == 0);
+  TEST_CHECK(ts.tv_sec >= boottime.tv_sec + kBoottimeOffset);
+
+  struct sysinfo info;
+  TEST_PCHECK(sysinfo(&info) == 0);
+  TEST_CHECK(info.uptime >= boottime.tv_sec + kBoottimeOffset);
+
+  FILE* f = fopen("/proc/uptime", "r");
+  TEST_PCHECK(f != nullptr);
+  double uptime;
+  TEST_CHECK(fscanf(f, "%lf", &uptime) == 1);
+  fclose(f);
+  TEST_CHECK(uptime >= boottime.tv_sec + kBoottimeOffset);
+}
+
+// CheckNoOffsets checks that the calling process observes no offsets.
+void CheckNoOffsets(const struct timespec& monotonic) {
+  struct timespec ts;
+  TEST_PCHECK(clock_gettime(CLOCK_MONOTONIC, &ts) == 0);
+  TEST_CHECK(ts.tv_sec < monotonic.tv_sec + kMonotonicOffset);
+}
+
+TEST(TimeNamespaceTest, ForkedChildObservesOffsets) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const auto rest = [] {
+    struct timespec monotonic, boottime;
+    TEST_PCHECK(clock_gettime(CLOCK_MONOTONIC, &monotonic) == 0);
+    TEST_PCHECK(clock_gettime(CLOCK_BOOTTIME, &boottime) == 0);
+
+    TEST_PCHECK(unshare(CLONE_NEWTIME) == 0);
+    SetOffsets();
+
+    // The child enters the new namespace without exec.
+    pid_t child = fork();
+    if (child == 0) {
+      CheckOffsets(monotonic, boottime);
+      _exit(0);
+    }
+    TEST_PCHECK(child > 0);
+    int status;
+    TEST_PCHECK(waitpid(child, &status, 0) == child);
+    TEST_CHECK(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+
+    // The unsharing process stays in its namespace until it execs.
+    CheckNoOffsets(monotonic);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(TimeNamespaceTest, SetnsObservesOffsets) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const auto rest = [] {
+    struct timespec monotonic, boottime;
+    TEST_PCHECK(clock_gettime(CLOCK_MONOTONIC, &monotonic) == 0);
+    TEST_PCHECK(clock_gettime(CLOCK_BOOTTIME, &boottime) == 0);
+
+    TEST_PCHECK(unshare(CLONE_NEWTIME) == 0);
+    SetOffsets();
+
+    // Keep a task in the new namespace, so that it can be joined.
+    pid_t child = fork();
+    if (child == 0) {
+      pause();
+      _exit(0);
+    }
+    TEST_PCHECK(child > 0);
+
+    int fd = open(absl::StrCat("/proc/", child, "/ns/time").c_str(), O_RDONLY);
+    TEST_PCHECK(fd >= 0);
+    TEST_PCHECK(setns(fd, CLONE_NEWTIME) == 0);
+    TEST_PCHECK(close(fd) == 0);
+    CheckOffsets(monotonic, boottime);
+
+    TEST_PCHECK(kill(child, SIGKILL) == 0);
+    TEST_PCHECK(waitpid(child, nullptr, 0) == child);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(TimeNamespaceTest, OffsetsFrozenOnceEntered) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const auto rest = [] {
+    TEST_PCHECK(unshare(CLONE_NEWTIME) == 0);
+    SetOffsets();
+
+    pid_t child = fork();
+    if (child == 0) {
+      _exit(0);
+    }
+    TEST_PCHECK(child > 0);
+    TEST_PCHECK(waitpid(child, nullptr, 0) == child);
+
+    int fd = open("/proc/self/timens_offsets", O_WRONLY);
+    TEST_PCHECK(fd >= 0);
+    constexpr char kOffsets[] = "monotonic 1 0\n";
+    TEST_CHECK(write(fd, kOffsets, sizeof(kOffsets) - 1) == -1);
+    TEST_PCHECK(errno == EACCES);
+    TEST_PCHECK(close(fd) == 0);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
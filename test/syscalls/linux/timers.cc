@@ -50,6 +50,10 @@ namespace {
 #define CPUCLOCK_PROF 0
 #endif  // CPUCLOCK_PROF
 
+#ifndef CPUCLOCK_PERTHREAD_MASK
+#define CPUCLOCK_PERTHREAD_MASK 4
+#endif  // CPUCLOCK_PERTHREAD_MASK
+
 PosixErrorOr<absl::Duration> ProcessCPUTime(pid_t pid) {
   // Use pid-specific CPUCLOCK_PROF, which is the clock used to enforce
   // RLIMIT_CPU.
@@ -555,6 +559,110 @@ TEST(IntervalTimerTest, IgnoredSignalCountsAsOverrun) {
   sigtimedwait(&mask, &si, &zero_ts);
 }
 
+TEST(IntervalTimerTest, OtherThreadGroupCPUClock) {
+  // Create a subprocess that does nothing until killed.
+  pid_t child_pid;
+  const auto sp = ASSERT_NO_ERRNO_AND_VALUE(ForkAndExec(
+      "/proc/self/exe", ExecveArray({"timers", "--timers_test_sleep"}),
+      ExecveArray(), &child_pid, nullptr));
+
+  struct sigevent sev = {};
+  sev.sigev_notify = SIGEV_NONE;
+
+  // Thread CPU clocks are restricted to the caller's thread group.
+  const clockid_t thread_clockid = (~static_cast<clockid_t>(child_pid) << 3) |
+                                   CPUCLOCK_PERTHREAD_MASK | CPUCLOCK_PROF;
+  EXPECT_THAT(TimerCreate(thread_clockid, sev), PosixErrorIs(EINVAL, _));
+  struct timespec ts;
+  EXPECT_THAT(clock_gettime(thread_clockid, &ts),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Process CPU clocks of other processes may be used.
+  const clockid_t process_clockid =
+      (~static_cast<clockid_t>(child_pid) << 3) | CPUCLOCK_PROF;
+  EXPECT_NO_ERRNO(TimerCreate(process_clockid, sev));
+}
+
+TEST(IntervalTimerTest, ProcessCPUClockOfNonLeader) {
+  // A process CPU clock may be identified by the thread ID of a non-leader
+  // only by the thread itself, and only to read it.
+  ScopedThread thread([] {
+    const clockid_t clockid =
+        (~static_cast<clockid_t>(gettid()) << 3) | CPUCLOCK_PROF;
+    struct timespec ts;
+    EXPECT_THAT(clock_gettime(clockid, &ts), SyscallSucceeds());
+
+    struct sigevent sev = {};
+    sev.sigev_notify = SIGEV_NONE;
+    EXPECT_THAT(TimerCreate(clockid, sev), PosixErrorIs(EINVAL, _));
+  });
+}
+
+TEST(IntervalTimerTest, SignalNotLimitedBySignalQueue) {
+  const int kSigno = SIGRTMIN;
+  constexpr int kSigvalue = 42;
+
+  // Block kSigno so that signals remain queued.
+  sigset_t mask;
+  sigemptyset(&mask);
+  sigaddset(&mask, kSigno);
+  const auto scoped_sigmask =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSignalMask(SIG_BLOCK, mask));
+
+  // Create the timer before filling the signal queue, since Linux allocates
+  // the timer's signal when the timer is created.
+  struct sigevent sev = {};
+  sev.sigev_notify = SIGEV_THREAD_ID;
+  sev.sigev_signo = kSigno;
+  sev.sigev_value.sival_int = kSigvalue;
+  sev.sigev_notify_thread_id = gettid();
+  auto timer = ASSERT_NO_ERRNO_AND_VALUE(TimerCreate(CLOCK_MONOTONIC, sev));
+
+  // Fill the signal queue. Lower RLIMIT_SIGPENDING so that this terminates
+  // quickly on Linux.
+  struct rlimit rlim = {};
+  ASSERT_THAT(getrlimit(RLIMIT_SIGPENDING, &rlim), SyscallSucceeds());
+  struct rlimit new_rlim = rlim;
+  new_rlim.rlim_cur = 16;
+  ASSERT_THAT(setrlimit(RLIMIT_SIGPENDING, &new_rlim), SyscallSucceeds());
+  auto restore_rlimit = Cleanup([&] {
+    EXPECT_THAT(setrlimit(RLIMIT_SIGPENDING, &rlim), SyscallSucceeds());
+  });
+  const pid_t pid = getpid();
+  const pid_t tid = gettid();
+  int queued = 0;
+  while (true) {
+    siginfo_t uinfo = {};
+    uinfo.si_signo = kSigno;
+    uinfo.si_code = SI_QUEUE;
+    int ret = syscall(SYS_rt_tgsigqueueinfo, pid, tid, kSigno, &uinfo);
+    if (ret < 0) {
+      ASSERT_EQ(errno, EAGAIN);
+      break;
+    }
+    ASSERT_LT(++queued, 1 << 16);
+  }
+
+  struct itimerspec its = {};
+  its.it_value = absl::ToTimespec(absl::Milliseconds(10));
+  ASSERT_NO_ERRNO(timer.Set(0, its));
+  absl::SleepFor(absl::Milliseconds(10) + kTimerSlack);
+
+  // The timer's signal should have been queued after the others.
+  siginfo_t si;
+  struct timespec zero_ts = absl::ToTimespec(absl::ZeroDuration());
+  for (int i = 0; i < queued; i++) {
+    ASSERT_THAT(sigtimedwait(&mask, &si, &zero_ts),
+                SyscallSucceedsWithValue(kSigno));
+    EXPECT_EQ(si.si_code, SI_QUEUE);
+  }
+  ASSERT_THAT(sigtimedwait(&mask, &si, &zero_ts),
+              SyscallSucceedsWithValue(kSigno));
+  EXPECT_EQ(si.si_code, SI_TIMER);
+  EXPECT_EQ(si.si_timerid, timer.get());
+  EXPECT_EQ(si.si_int, kSigvalue);
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -690,5 +690,45 @@ TEST_F(TuntapTest, RawPacketSocket) {
   }
 }
 
+TEST_F(TuntapTest, MultiQueue) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  struct ifreq ifr = {};
+  ifr.ifr_flags = IFF_TAP | IFF_NO_PI | IFF_MULTI_QUEUE;
+  strncpy(ifr.ifr_name, kTapName, IFNAMSIZ);
+
+  // Attach two queues to the same interface.
+  FileDescriptor fd1 = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  ASSERT_THAT(ioctl(fd1.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+  FileDescriptor fd2 = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  ASSERT_THAT(ioctl(fd2.get(), TUNSETIFF, &ifr), SyscallSucceeds());
+
+  // The queueing mode must match the interface's.
+  FileDescriptor fd3 = ASSERT_NO_ERRNO_AND_VALUE(Open(kDevNetTun, O_RDWR));
+  struct ifreq ifr_single = ifr;
+  ifr_single.ifr_flags &= ~IFF_MULTI_QUEUE;
+  EXPECT_THAT(ioctl(fd3.get(), TUNSETIFF, &ifr_single),
+              SyscallFailsWithErrno(EINVAL));
+
+  struct ifreq ifr_get = {};
+  ASSERT_THAT(ioctl(fd2.get(), TUNGETIFF, &ifr_get), SyscallSucceeds());
+  EXPECT_NE(ifr_get.ifr_flags & IFF_MULTI_QUEUE, 0);
+
+  // A detached queue can't be used until it is attached again.
+  struct ifreq ifr_queue = {};
+  ifr_queue.ifr_flags = IFF_DETACH_QUEUE;
+  ASSERT_THAT(ioctl(fd2.get(), TUNSETQUEUE, &ifr_queue), SyscallSucceeds());
+  EXPECT_THAT(ioctl(fd2.get(), TUNSETQUEUE, &ifr_queue),
+              SyscallFailsWithErrno(EINVAL));
+  char buf[64];
+  EXPECT_THAT(read(fd2.get(), buf, sizeof(buf)),
+              SyscallFailsWithErrno(EBADFD));
+
+  ifr_queue.ifr_flags = IFF_ATTACH_QUEUE;
+  ASSERT_THAT(ioctl(fd2.get(), TUNSETQUEUE, &ifr_queue), SyscallSucceeds());
+  EXPECT_THAT(ioctl(fd2.get(), TUNSETQUEUE, &ifr_queue),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 }  // namespace testing
 }  // namespace gvisor
@@ -12,6 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <fcntl.h>
 #include <sched.h>
 #include <sys/utsname.h>
 #include <unistd.h>
@@ -104,6 +105,33 @@ TEST(UnameTest, UnshareUTS) {
   EXPECT_EQ(absl::string_view(after.nodename), init.nodename);
 }
 
+TEST(UnameTest, UnshareUTSProcHostname) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  struct utsname init;
+  ASSERT_THAT(uname(&init), SyscallSucceeds());
+
+  ScopedThread thread = ScopedThread([&]() {
+    EXPECT_THAT(unshare(CLONE_NEWUTS), SyscallSucceeds());
+
+    int fd = open("/proc/sys/kernel/hostname", O_WRONLY);
+    ASSERT_THAT(fd, SyscallSucceeds());
+    constexpr char kHostname[] = "wubbalubba\n";
+    EXPECT_THAT(write(fd, kHostname, sizeof(kHostname) - 1),
+                SyscallSucceedsWithValue(sizeof(kHostname) - 1));
+    EXPECT_THAT(close(fd), SyscallSucceeds());
+
+    char hostname[65];
+    EXPECT_THAT(gethostname(hostname, sizeof(hostname)), SyscallSucceeds());
+    EXPECT_EQ(absl::string_view(hostname), "wubbalubba");
+  });
+  thread.Join();
+
+  struct utsname after;
+  EXPECT_THAT(uname(&after), SyscallSucceeds());
+  EXPECT_EQ(absl::string_view(after.nodename), init.nodename);
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -106,7 +106,9 @@ TEST_F(XattrTest, XattrInvalidPrefix) {
 }
 
 TEST_F(XattrTest, SecurityCapacityXattr) {
-  SKIP_IF(!IsRunningOnGvisor());
+  // gVisor only supports the security namespace on tmpfs.
+  SKIP_IF(!IsRunningOnGvisor() ||
+          ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
   const char* path = test_file_name_.c_str();
   const char name[] = "security.capacity";
   const std::string val = "";
@@ -735,6 +737,46 @@ TEST_F(XattrTest, TrustedNamespaceWithoutCapSysAdmin) {
   EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EPERM));
 }
 
+TEST_F(XattrTest, SecurityNamespace) {
+  // gVisor only supports the security namespace on tmpfs.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.test";
+
+  // Set.
+  char val = 'a';
+  size_t size = sizeof(val);
+  EXPECT_THAT(setxattr(path, name, &val, size, /*flags=*/0), SyscallSucceeds());
+
+  // List.
+  char list[sizeof(name)];
+  EXPECT_THAT(listxattr(path, list, sizeof(list)),
+              SyscallSucceedsWithValue(sizeof(name)));
+  EXPECT_STREQ(list, name);
+
+  {
+    // Unprivileged users can read, but not change, security attributes.
+    AutoCapability cap(CAP_SYS_ADMIN, false);
+
+    char got = '\0';
+    EXPECT_THAT(getxattr(path, name, &got, size),
+                SyscallSucceedsWithValue(size));
+    EXPECT_EQ(val, got);
+
+    EXPECT_THAT(setxattr(path, name, &val, size, /*flags=*/0),
+                SyscallFailsWithErrno(EPERM));
+    EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EPERM));
+  }
+
+  // Remove.
+  EXPECT_THAT(removexattr(path, name), SyscallSucceeds());
+  char got = '\0';
+  EXPECT_THAT(getxattr(path, name, &got, size), SyscallFailsWithErrno(ENODATA));
+}
+
 }  // namespace
 
 }  // namespace testing
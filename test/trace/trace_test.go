@@ -133,6 +133,8 @@ func matchPoints(t *testing.T, msgs []test.Message) map[pb.MessageType]*checkers
 		pb.MessageType_MESSAGE_SYSCALL_INOTIFY_ADD_WATCH: {checker: checkSyscallInotifyInitAddWatch},
 		pb.MessageType_MESSAGE_SYSCALL_INOTIFY_RM_WATCH:  {checker: checkSyscallInotifyInitRmWatch},
 		pb.MessageType_MESSAGE_SYSCALL_CLONE:             {checker: checkSyscallClone},
+		pb.MessageType_MESSAGE_SENTRY_PAGE_FAULT:         {checker: checkSentryPageFault},
+		pb.MessageType_MESSAGE_NETSTACK_SOCKET_CLOSE:     {checker: checkNetstackSocketClose},
 	}
 	return matchers
 }
@@ -260,6 +262,46 @@ func checkSentryTaskExit(msg test.Message) error {
 	return nil
 }
 
+func checkSentryPageFault(msg test.Message) error {
+	p := pb.PageFault{}
+	if err := proto.Unmarshal(msg.Msg, &p); err != nil {
+		return err
+	}
+	if err := checkContextData(p.ContextData); err != nil {
+		return err
+	}
+	if p.Address == 0 {
+		return fmt.Errorf("missing Address: %+v", &p)
+	}
+	if len(p.Access) != 3 {
+		return fmt.Errorf("wrong Access, want: 3 characters, got: %q", p.Access)
+	}
+	return nil
+}
+
+func checkNetstackSocketClose(msg test.Message) error {
+	p := pb.SocketClose{}
+	if err := proto.Unmarshal(msg.Msg, &p); err != nil {
+		return err
+	}
+	if err := checkContextData(p.ContextData); err != nil {
+		return err
+	}
+	if want := unix.AF_INET; int32(want) != p.Domain {
+		return fmt.Errorf("wrong Domain, want: %v, got: %v", want, p.Domain)
+	}
+	if want := unix.SOCK_DGRAM; int32(want) != p.Type {
+		return fmt.Errorf("wrong Type, want: %v, got: %v", want, p.Type)
+	}
+	if !strings.HasPrefix(p.LocalAddress, "127.0.0.1:") {
+		return fmt.Errorf("wrong LocalAddress, want: 127.0.0.1:<port>, got: %q", p.LocalAddress)
+	}
+	if want := uint64(1); want != p.PacketsSent {
+		return fmt.Errorf("wrong PacketsSent, want: %v, got: %v", want, p.PacketsSent)
+	}
+	return nil
+}
+
 func checkSyscallRaw(msg test.Message) error {
 	p := pb.Syscall{}
 	if err := proto.Unmarshal(msg.Msg, &p); err != nil {
@@ -490,11 +532,19 @@ func checkSyscallSocket(msg test.Message) error {
 	if err := checkContextData(p.ContextData); err != nil {
 		return err
 	}
-	if want := unix.AF_UNIX; int32(want) != p.Domain {
-		return fmt.Errorf("wrong Domain, want: %v, got: %v", want, p.Domain)
-	}
-	if want := unix.SOCK_STREAM; int32(want) != p.Type {
-		return fmt.Errorf("wrong Type, want: %v, got: %v", want, p.Type)
+	// The workload creates Unix stream sockets, and a UDP socket for
+	// netstack/socket_close.
+	switch p.Domain {
+	case unix.AF_UNIX:
+		if want := unix.SOCK_STREAM; int32(want) != p.Type {
+			return fmt.Errorf("wrong Type, want: %v, got: %v", want, p.Type)
+		}
+	case unix.AF_INET:
+		if want := unix.SOCK_DGRAM; int32(want) != p.Type {
+			return fmt.Errorf("wrong Type, want: %v, got: %v", want, p.Type)
+		}
+	default:
+		return fmt.Errorf("wrong Domain, want: %v or %v, got: %v", unix.AF_UNIX, unix.AF_INET, p.Domain)
 	}
 	if want := int32(0); want != p.Protocol {
 		return fmt.Errorf("wrong Protocol, want: %v, got: %v", want, p.Protocol)
@@ -15,6 +15,7 @@
 #include <bits/types/struct_itimerspec.h>
 #include <err.h>
 #include <fcntl.h>
+#include <netinet/in.h>
 #include <sched.h>
 #include <stdlib.h>
 #include <sys/eventfd.h>
@@ -370,6 +371,28 @@ void runEventfd2() {
   }
 }
 
+// Creates a UDP socket and sends one datagram over the loopback interface, so
+// that the socket is backed by netstack.
+void runNetstackSocket() {
+  int fd = socket(AF_INET, SOCK_DGRAM, 0);
+  if (fd < 0) {
+    err(1, "socket");
+  }
+  auto sock_closer = absl::MakeCleanup([fd] { close(fd); });
+
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  // Nothing listens on the discard port, so the datagram is dropped.
+  addr.sin_port = htons(9);
+  char buf = 'a';
+  if (sendto(fd, &buf, sizeof(buf), 0,
+             reinterpret_cast<struct sockaddr*>(&addr),
+             sizeof(addr)) != sizeof(buf)) {
+    err(1, "sendto");
+  }
+}
+
 void runBind() {
   auto path = absl::StrCat(std::string("\0", 1), "trace_test.abc");
 
@@ -668,6 +691,7 @@ void runInotifyRmWatch() {
 int main(int argc, char** argv) {
   ::gvisor::testing::runForkExecve();
   ::gvisor::testing::runSocket();
+  ::gvisor::testing::runNetstackSocket();
   ::gvisor::testing::runReadWrite();
   ::gvisor::testing::runChdir();
   ::gvisor::testing::runFchdir();
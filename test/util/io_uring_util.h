@@ -34,11 +34,16 @@ namespace testing {
 #define __NR_io_uring_enter 426
 
 // io_uring_setup(2) flags.
+#define IORING_SETUP_IOPOLL (1U << 0)
 #define IORING_SETUP_SQPOLL (1U << 1)
 #define IORING_SETUP_CQSIZE (1U << 3)
 
 // io_uring_enter(2) flags
 #define IORING_ENTER_GETEVENTS (1U << 0)
+#define IORING_ENTER_SQ_WAKEUP (1U << 1)
+
+// io_uring SQ ring flags.
+#define IORING_SQ_NEED_WAKEUP (1U << 0)
 
 #define IORING_FEAT_SINGLE_MMAP (1U << 0)
 
@@ -173,6 +178,7 @@ class IOUring {
   uint32_t load_sq_tail();
   uint32_t load_cq_overflow();
   uint32_t load_sq_dropped();
+  uint32_t load_sq_flags();
   void store_cq_head(uint32_t cq_head_val);
   void store_sq_tail(uint32_t sq_tail_val);
   int Enter(unsigned int to_submit, unsigned int min_complete,
@@ -199,6 +205,7 @@ class IOUring {
   uint32_t *sq_tail_ptr_ = nullptr;
   uint32_t *cq_overflow_ptr_ = nullptr;
   uint32_t *sq_dropped_ptr_ = nullptr;
+  uint32_t *sq_flags_ptr_ = nullptr;
   void *sq_ptr_ = nullptr;
   void *cq_ptr_ = nullptr;
   void *sqe_ptr_ = nullptr;
@@ -0,0 +1,78 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#ifndef VDSO_PARAMS_H_
+#define VDSO_PARAMS_H_
+
+#include <stdint.h>
+
+// struct params defines the layout of the parameter page maintained by the
+// kernel (i.e., sentry).
+//
+// This is similar to the VVAR page maintained by the normal Linux kernel for
+// its VDSO, but it has a different layout.
+//
+// It must be kept in sync with VDSOParamPage in pkg/sentry/kernel/vdso.go.
+struct params {
+  uint64_t seq_count;
+
+  uint64_t monotonic_ready;
+  int64_t monotonic_base_cycles;
+  int64_t monotonic_base_ref;
+  uint64_t monotonic_frequency;
+
+  uint64_t realtime_ready;
+  int64_t realtime_base_cycles;
+  int64_t realtime_base_ref;
+  uint64_t realtime_frequency;
+
+  // rng_generation is incremented whenever existing vgetrandom states must
+  // be reseeded, and is 0 until the kernel's random number generator is
+  // ready. It is not protected by seq_count.
+  uint64_t rng_generation;
+};
+
+// Returns a pointer to the global parameter page.
+//
+// This page lives in the page just before the VDSO binary itself. The linker
+// defines _params as the page before the VDSO.
+//
+// Ideally, we'd simply declare _params as an extern struct params.
+// Unfortunately various combinations of old/new versions of gcc/clang and
+// gold/bfd struggle to generate references to such a global without generating
+// relocations.
+//
+// So instead, we use inline assembly with a construct that seems to have wide
+// compatibility across many toolchains.
+#if __x86_64__
+
+inline struct params* get_params() {
+  struct params* p = nullptr;
+  asm("leaq _params(%%rip), %0" : "=r"(p) : :);
+  return p;
+}
+
+#elif __aarch64__
+
+inline struct params* get_params() {
+  struct params* p = nullptr;
+  asm("adr %0, _params" : "=r"(p) : :);
+  return p;
+}
+
+#else
+#error "unsupported architecture"
+#endif
+
+#endif  // VDSO_PARAMS_H_
@@ -13,13 +13,15 @@
 // limitations under the License.
 
 // This is the VDSO for sandboxed binaries. This file just contains the entry
-// points to the VDSO. All of the real work is done in vdso_time.cc
+// points to the VDSO. All of the real work is done in vdso_time.cc and
+// vdso_getrandom.cc.
 
 #define _DEFAULT_SOURCE  // ensure glibc provides struct timezone.
 #include <sys/time.h>
 #include <time.h>
 
 #include "vdso/syscalls.h"
+#include "vdso/vdso_getrandom.h"
 #include "vdso/vdso_time.h"
 
 namespace vdso {
@@ -118,6 +120,16 @@ extern "C" long getcpu(unsigned* cpu, unsigned* node,
                        struct getcpu_cache* cache)
     __attribute__((weak, alias("__vdso_getcpu")));
 
+// __vdso_getrandom() implements getrandom()
+extern "C" ssize_t __vdso_getrandom(void* buffer, size_t len,
+                                    unsigned int flags, void* opaque_state,
+                                    size_t opaque_len) {
+  return GetRandom(buffer, len, flags, opaque_state, opaque_len);
+}
+extern "C" ssize_t getrandom(void* buffer, size_t len, unsigned int flags,
+                             void* opaque_state, size_t opaque_len)
+    __attribute__((weak, alias("__vdso_getrandom")));
+
 #elif __aarch64__
 
 // __kernel_clock_gettime() implements clock_gettime()
@@ -155,6 +167,13 @@ extern "C" int __kernel_clock_getres(clockid_t clock, struct timespec* res) {
   return ret;
 }
 
+// __kernel_getrandom() implements getrandom()
+extern "C" ssize_t __kernel_getrandom(void* buffer, size_t len,
+                                      unsigned int flags, void* opaque_state,
+                                      size_t opaque_len) {
+  return GetRandom(buffer, len, flags, opaque_state, opaque_len);
+}
+
 #else
 #error "unsupported architecture"
 #endif
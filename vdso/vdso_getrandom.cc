@@ -0,0 +1,302 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "vdso/vdso_getrandom.h"
+
+#include <errno.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <sys/mman.h>
+#include <sys/types.h>
+
+#include "vdso/barrier.h"
+#include "vdso/compiler.h"
+#include "vdso/params.h"
+#include "vdso/syscalls.h"
+
+namespace vdso {
+namespace {
+
+// Flags for getrandom(2), from include/uapi/linux/random.h.
+const unsigned int kGrndNonblock = 0x1;
+const unsigned int kGrndRandom = 0x2;
+const unsigned int kGrndInsecure = 0x4;
+
+const uintptr_t kPageSize = 4096;
+
+// kMaxLen is the maximum number of bytes returned by one call, as for
+// getrandom(2).
+const size_t kMaxLen = 0x7ffff000;
+
+const size_t kChaChaBlockSize = 64;
+const size_t kChaChaKeySize = 32;
+
+// kBatchSize is the number of bytes of output buffered in a state.
+const size_t kBatchSize = kChaChaBlockSize * 3 / 2;
+
+// struct opaque_params describes how callers must allocate states. It has the
+// same layout as struct vgetrandom_opaque_params in
+// include/uapi/linux/random.h.
+struct opaque_params {
+  uint32_t size_of_opaque_state;
+  uint32_t mmap_prot;
+  uint32_t mmap_flags;
+  uint32_t reserved[13];
+};
+
+// struct state is a per-thread state allocated by the caller. Its layout is
+// private to this VDSO; compare include/vdso/getrandom.h:struct
+// vgetrandom_state.
+struct state {
+  // batch_key holds a batch of unused output, followed by the ChaCha20 key
+  // used to generate the next batch. Both are regenerated together, so that
+  // the key that generated returned output is never kept.
+  uint8_t batch_key[kBatchSize + kChaChaKeySize];
+
+  // generation is the value of params.rng_generation when key was seeded.
+  uint64_t generation;
+
+  // pos is the offset of unused output in batch_key.
+  uint8_t pos;
+
+  // in_use is set while a call is using the state, to detect reentrance
+  // from signal handlers.
+  bool in_use;
+};
+
+template <typename T>
+inline T read_once(const T* p) {
+  return *static_cast<const volatile T*>(p);
+}
+
+template <typename T>
+inline void write_once(T* p, T v) {
+  *static_cast<volatile T*>(p) = v;
+}
+
+inline uint32_t load32_le(const uint8_t* p) {
+  return static_cast<uint32_t>(p[0]) | static_cast<uint32_t>(p[1]) << 8 |
+         static_cast<uint32_t>(p[2]) << 16 | static_cast<uint32_t>(p[3]) << 24;
+}
+
+inline void store32_le(uint8_t* p, uint32_t v) {
+  p[0] = v;
+  p[1] = v >> 8;
+  p[2] = v >> 16;
+  p[3] = v >> 24;
+}
+
+// wipe zeroes n words at p. The stores are volatile so that they are neither
+// elided nor turned into a call to memset.
+inline void wipe(uint32_t* p, size_t n) {
+  volatile uint32_t* v = p;
+  for (size_t i = 0; i < n; i++) {
+    v[i] = 0;
+  }
+}
+
+// copy_and_zero_src copies len bytes from src to dst, zeroing src as it goes
+// to preserve forward secrecy.
+inline void copy_and_zero_src(uint8_t* dst, uint8_t* src, size_t len) {
+  volatile uint8_t* vsrc = src;
+  for (size_t i = 0; i < len; i++) {
+    dst[i] = vsrc[i];
+    vsrc[i] = 0;
+  }
+}
+
+inline uint32_t rotl32(uint32_t v, int c) { return (v << c) | (v >> (32 - c)); }
+
+inline void quarter_round(uint32_t* x, int a, int b, int c, int d) {
+  x[a] += x[b];
+  x[d] = rotl32(x[d] ^ x[a], 16);
+  x[c] += x[d];
+  x[b] = rotl32(x[b] ^ x[c], 12);
+  x[a] += x[b];
+  x[d] = rotl32(x[d] ^ x[a], 8);
+  x[c] += x[d];
+  x[b] = rotl32(x[b] ^ x[c], 7);
+}
+
+// chacha20_blocks writes nblocks blocks of ChaCha20 output for key, a zero
+// nonce and a 64-bit block counter starting at *counter to dst, and advances
+// *counter. dst may overlap key.
+void chacha20_blocks(uint8_t* dst, const uint8_t* key, uint64_t* counter,
+                     size_t nblocks) {
+  uint32_t input[16];
+  uint32_t x[16];
+
+  // "expand 32-byte k".
+  input[0] = 0x61707865;
+  input[1] = 0x3320646e;
+  input[2] = 0x79622d32;
+  input[3] = 0x6b206574;
+  for (int i = 0; i < 8; i++) {
+    input[4 + i] = load32_le(key + 4 * i);
+  }
+  input[14] = 0;
+  input[15] = 0;
+
+  for (; nblocks > 0; nblocks--) {
+    input[12] = static_cast<uint32_t>(*counter);
+    input[13] = static_cast<uint32_t>(*counter >> 32);
+    for (int i = 0; i < 16; i++) {
+      x[i] = input[i];
+    }
+    for (int i = 0; i < 10; i++) {
+      quarter_round(x, 0, 4, 8, 12);
+      quarter_round(x, 1, 5, 9, 13);
+      quarter_round(x, 2, 6, 10, 14);
+      quarter_round(x, 3, 7, 11, 15);
+      quarter_round(x, 0, 5, 10, 15);
+      quarter_round(x, 1, 6, 11, 12);
+      quarter_round(x, 2, 7, 8, 13);
+      quarter_round(x, 3, 4, 9, 14);
+    }
+    for (int i = 0; i < 16; i++) {
+      store32_le(dst + 4 * i, x[i] + input[i]);
+    }
+    dst += kChaChaBlockSize;
+    (*counter)++;
+  }
+
+  // Don't leave the key on the stack.
+  wipe(input, 16);
+  wipe(x, 16);
+}
+
+}  // namespace
+
+// GetRandom() is the VDSO implementation of getrandom(), with the same
+// interface as Linux's vgetrandom. Compare lib/vdso/getrandom.c.
+//
+// Output is generated from a ChaCha20 key in the caller-allocated
+// opaque_state, which is seeded by getrandom(2) and then fast key erased
+// after every call. The sandbox kernel increments params.rng_generation on
+// fork and restore, which causes states to be reseeded before they are next
+// used.
+ssize_t GetRandom(void* buffer, size_t len, unsigned int flags,
+                  void* opaque_state, size_t opaque_len) {
+  // Report how states must be allocated.
+  if (unlikely(opaque_len == ~0UL && !buffer && !len && !flags)) {
+    struct opaque_params* p = static_cast<struct opaque_params*>(opaque_state);
+    p->size_of_opaque_state = sizeof(struct state);
+    p->mmap_prot = PROT_READ | PROT_WRITE;
+    // Linux uses MAP_DROPPABLE, which also wipes states on fork. Here,
+    // states are reseeded after fork instead.
+    p->mmap_flags = MAP_PRIVATE | MAP_ANONYMOUS;
+    wipe(p->reserved, 13);
+    return 0;
+  }
+
+  struct state* state = static_cast<struct state*>(opaque_state);
+
+  // As in Linux, states may not straddle a page.
+  if (unlikely((reinterpret_cast<uintptr_t>(opaque_state) & (kPageSize - 1)) +
+                   sizeof(*state) >
+               kPageSize)) {
+    return -EFAULT;
+  }
+
+  // Leave unexpected flags, states from a different implementation (e.g.
+  // after migration) and an RNG that isn't ready to the kernel.
+  if (unlikely(flags & ~(kGrndNonblock | kGrndRandom | kGrndInsecure)) ||
+      unlikely(opaque_len != sizeof(*state))) {
+    return sys_getrandom(buffer, len, flags);
+  }
+  struct params* params = get_params();
+  if (unlikely(read_once(&params->rng_generation) == 0)) {
+    return sys_getrandom(buffer, len, flags);
+  }
+
+  if (unlikely(!len)) {
+    return 0;
+  }
+
+  // If a signal handler interrupted a call using the same state, leave the
+  // state alone.
+  if (unlikely(read_once(&state->in_use))) {
+    return sys_getrandom(buffer, len, flags);
+  }
+  write_once(&state->in_use, true);
+
+  size_t ret = len < kMaxLen ? len : kMaxLen;
+  uint8_t* key = state->batch_key + kBatchSize;
+  bool have_retried = false;
+  for (;;) {
+    uint64_t generation = read_once(&params->rng_generation);
+    if (unlikely(state->generation != generation)) {
+      // Update the generation before reseeding, so that a fork after this
+      // point is detected in both processes.
+      write_once(&state->generation, generation);
+      read_barrier();
+      if (sys_getrandom(key, kChaChaKeySize, 0) !=
+          static_cast<ssize_t>(kChaChaKeySize)) {
+        write_once(&state->generation, static_cast<uint64_t>(0));
+        write_once(&state->in_use, false);
+        return sys_getrandom(buffer, len, flags);
+      }
+      // Discard the batch generated by the old key.
+      state->pos = kBatchSize;
+    }
+
+    uint8_t* dst = static_cast<uint8_t*>(buffer);
+    size_t remaining = ret;
+    uint64_t counter = 0;
+    for (;;) {
+      // Use buffered output first.
+      size_t batch_len = kBatchSize - state->pos;
+      if (batch_len > remaining) {
+        batch_len = remaining;
+      }
+      copy_and_zero_src(dst, state->batch_key + state->pos, batch_len);
+      state->pos += batch_len;
+      dst += batch_len;
+      remaining -= batch_len;
+      if (!remaining) {
+        break;
+      }
+
+      // Generate whole blocks directly into the buffer.
+      size_t nblocks = remaining / kChaChaBlockSize;
+      if (nblocks) {
+        chacha20_blocks(dst, key, &counter, nblocks);
+        dst += nblocks * kChaChaBlockSize;
+        remaining -= nblocks * kChaChaBlockSize;
+      }
+
+      // Refill the batch, overwriting the key.
+      chacha20_blocks(state->batch_key, key, &counter,
+                      sizeof(state->batch_key) / kChaChaBlockSize);
+      state->pos = 0;
+    }
+
+    barrier();
+    // If the generation changed while generating output, because of a fork
+    // or restore, or because the state was zeroed, start over once with a
+    // new key.
+    if (likely(read_once(&state->generation) ==
+               read_once(&params->rng_generation))) {
+      write_once(&state->in_use, false);
+      return ret;
+    }
+    if (have_retried) {
+      write_once(&state->in_use, false);
+      return sys_getrandom(buffer, len, flags);
+    }
+    have_retried = true;
+  }
+}
+
+}  // namespace vdso
@@ -0,0 +1,28 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#ifndef VDSO_VDSO_GETRANDOM_H_
+#define VDSO_VDSO_GETRANDOM_H_
+
+#include <stddef.h>
+#include <sys/types.h>
+
+namespace vdso {
+
+ssize_t GetRandom(void* buffer, size_t len, unsigned int flags,
+                  void* opaque_state, size_t opaque_len);
+
+}  // namespace vdso
+
+#endif  // VDSO_VDSO_GETRANDOM_H_